@@ -0,0 +1,199 @@
+// The abtest package runs two versions of the RTCM message pipeline side by
+// side on the same input and reports any difference in the messages that
+// they emit.  It's for proving that a redesign, for example a zero-copy
+// reader or lazy decoding, produces exactly the same messages as the code
+// that it replaces.
+//
+// A Path is one version of the pipeline.  It has the same form as
+// handler.Handler.HandleMessages, so an existing handler can be used
+// directly.  A tap copies each byte of the input to both paths as it's read,
+// and they run in parallel, each writing messages to its own channel.  When
+// both have finished, the messages are compared in order.  Two messages are
+// the same if they have the same type, error message and raw frame, byte
+// for byte, and the same readable display.
+//
+//	oldHandler := handler.New(startTime, slog.LevelDebug)
+//	newHandler := handler.New(startTime, slog.LevelDebug)
+//	differences, err := abtest.Compare(input, oldHandler.HandleMessages, newHandler.HandleMessages)
+//	for _, difference := range differences {
+//	    t.Error(difference.String())
+//	}
+//
+// The receipt times of the messages are ignored since the two paths can't
+// read each byte at the same instant.
+package abtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// Path is one version of the pipeline.  It reads bytes from ch_in until it's
+// closed, writes the messages to ch_out and then closes ch_out.
+type Path func(ch_in chan byte, ch_out chan rtcm.Message)
+
+// Difference describes a message that's not the same in both paths.
+type Difference struct {
+	// Index is the position of the message in the output, counting from 0.
+	Index int
+
+	// A is the message from the first path, nil if it emitted fewer messages.
+	A *rtcm.Message
+
+	// B is the message from the second path, nil if it emitted fewer
+	// messages.
+	B *rtcm.Message
+
+	// Reason says what's different.
+	Reason string
+}
+
+// String returns a readable version of the difference, including a dump of
+// both frames.
+func (difference *Difference) String() string {
+	display := fmt.Sprintf("message %d: %s\n", difference.Index, difference.Reason)
+	if difference.A != nil {
+		display += "A:\n" + hex.Dump(difference.A.RawData)
+	}
+	if difference.B != nil {
+		display += "B:\n" + hex.Dump(difference.B.RawData)
+	}
+	return display
+}
+
+// Compare reads the input to the end, feeding it to both paths, and returns
+// the differences between the messages that they emit.  An empty result means
+// that the two paths are indistinguishable on that input.  It returns an
+// error if the input can't be read.
+func Compare(input io.Reader, a, b Path) ([]Difference, error) {
+
+	ch_in := make(chan byte)
+	ch_a := make(chan byte, bufferSize)
+	ch_b := make(chan byte, bufferSize)
+	ch_out_a := make(chan rtcm.Message, bufferSize)
+	ch_out_b := make(chan rtcm.Message, bufferSize)
+
+	go Tee(ch_in, ch_a, ch_b)
+	go a(ch_a, ch_out_a)
+	go b(ch_b, ch_out_b)
+
+	// Collect the output of both paths while the input is being read, so
+	// that neither is held up by a full channel.
+	var messagesA, messagesB []rtcm.Message
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		messagesA = collect(ch_out_a)
+	}()
+	go func() {
+		defer wg.Done()
+		messagesB = collect(ch_out_b)
+	}()
+
+	readError := feed(input, ch_in)
+	close(ch_in)
+	wg.Wait()
+
+	if readError != nil {
+		return nil, readError
+	}
+
+	return Diff(messagesA, messagesB), nil
+}
+
+// bufferSize is the size of the channels between the tap, the paths and the
+// collectors.
+const bufferSize = 4096
+
+// Tee is the tap.  It copies each byte from ch_in to all of the outputs and
+// closes them when ch_in is closed.
+func Tee(ch_in chan byte, outputs ...chan byte) {
+	for b := range ch_in {
+		for _, ch := range outputs {
+			ch <- b
+		}
+	}
+	for _, ch := range outputs {
+		close(ch)
+	}
+}
+
+// Diff compares two lists of messages in order and returns the differences.
+func Diff(messagesA, messagesB []rtcm.Message) []Difference {
+	differences := make([]Difference, 0)
+
+	n := len(messagesA)
+	if len(messagesB) > n {
+		n = len(messagesB)
+	}
+
+	for i := 0; i < n; i++ {
+		var a, b *rtcm.Message
+		if i < len(messagesA) {
+			a = &messagesA[i]
+		}
+		if i < len(messagesB) {
+			b = &messagesB[i]
+		}
+
+		reason := compareMessages(a, b)
+		if len(reason) > 0 {
+			differences = append(differences, Difference{Index: i, A: a, B: b, Reason: reason})
+		}
+	}
+
+	return differences
+}
+
+// compareMessages returns a description of the first difference between the
+// two messages, or an empty string if they are the same.
+func compareMessages(a, b *rtcm.Message) string {
+	switch {
+	case a == nil:
+		return "missing from A"
+	case b == nil:
+		return "missing from B"
+	case a.MessageType != b.MessageType:
+		return fmt.Sprintf("message type %d in A, %d in B", a.MessageType, b.MessageType)
+	case a.ErrorMessage != b.ErrorMessage:
+		return fmt.Sprintf("error %q in A, %q in B", a.ErrorMessage, b.ErrorMessage)
+	case !bytes.Equal(a.RawData, b.RawData):
+		return fmt.Sprintf("frames differ - %d bytes in A, %d in B", len(a.RawData), len(b.RawData))
+	case a.String() != b.String():
+		return "readable displays differ"
+	default:
+		return ""
+	}
+}
+
+// feed reads the input and writes it to the channel a byte at a time.
+func feed(input io.Reader, ch chan byte) error {
+	buffer := make([]byte, bufferSize)
+	for {
+		n, err := input.Read(buffer)
+		for _, b := range buffer[:n] {
+			ch <- b
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// collect reads messages from the channel until it's closed.
+func collect(ch chan rtcm.Message) []rtcm.Message {
+	messages := make([]rtcm.Message, 0)
+	for message := range ch {
+		messages = append(messages, message)
+	}
+	return messages
+}
@@ -0,0 +1,167 @@
+package abtest
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// startTime is the time at which the corpus frames were collected.
+var startTime = time.Date(2023, time.May, 15, 0, 0, 0, 0, utils.LocationUTC)
+
+// corpus returns all of the frames in the test corpus, one after another,
+// with some junk in between.
+func corpus() []byte {
+	data := make([]byte, 0)
+	for _, entry := range testdata.Corpus {
+		data = append(data, entry.Frame...)
+	}
+	data = append(data, testdata.JunkAtStart...)
+	data = append(data, testdata.MessageBatchWithJunk...)
+	return data
+}
+
+// TestCompare checks that two handlers given the same input produce the
+// same messages.  This is the check to run against a redesigned pipeline.
+func TestCompare(t *testing.T) {
+	a := rtcm.New(startTime, slog.LevelDebug)
+	b := rtcm.New(startTime, slog.LevelDebug)
+
+	differences, err := Compare(bytes.NewReader(corpus()), a.HandleMessages, b.HandleMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, difference := range differences {
+		t.Error(difference.String())
+	}
+}
+
+// TestCompareFindsDifferences checks that Compare spots a path that emits
+// different messages.
+func TestCompareFindsDifferences(t *testing.T) {
+	a := rtcm.New(startTime, slog.LevelDebug)
+
+	// b corrupts the third message and drops the last one.
+	b := func(ch_in chan byte, ch_out chan rtcm.Message) {
+		ch := make(chan rtcm.Message)
+		go rtcm.New(startTime, slog.LevelDebug).HandleMessages(ch_in, ch)
+		messages := collect(ch)
+		for i, message := range messages[:len(messages)-1] {
+			if i == 2 {
+				message.RawData = append([]byte{}, message.RawData...)
+				message.RawData[4]++
+			}
+			ch_out <- message
+		}
+		close(ch_out)
+	}
+
+	differences, err := Compare(bytes.NewReader(corpus()), a.HandleMessages, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(differences) != 2 {
+		t.Fatalf("want 2 differences, got %d", len(differences))
+	}
+	if differences[0].Index != 2 || differences[0].Reason != "frames differ - 67 bytes in A, 67 in B" {
+		t.Errorf("want a difference in the frame of message 2, got %d %s",
+			differences[0].Index, differences[0].Reason)
+	}
+	if differences[1].B != nil || differences[1].Reason != "missing from B" {
+		t.Errorf("want the last message missing from B, got %s", differences[1].Reason)
+	}
+}
+
+// TestDiff checks that Diff finds each kind of difference.
+func TestDiff(t *testing.T) {
+	message := func(messageType int, errorMessage string, rawData []byte) rtcm.Message {
+		return *rtcm.NewMessage(messageType, errorMessage, rawData, slog.LevelInfo)
+	}
+
+	var testData = []struct {
+		description string
+		a           []rtcm.Message
+		b           []rtcm.Message
+		want        []string
+	}{
+		{"same", []rtcm.Message{message(1, "", []byte{1})}, []rtcm.Message{message(1, "", []byte{1})}, nil},
+		{"both empty", nil, nil, nil},
+		{"type", []rtcm.Message{message(1, "", nil)}, []rtcm.Message{message(2, "", nil)},
+			[]string{"message type 1 in A, 2 in B"}},
+		{"error", []rtcm.Message{message(1, "x", nil)}, []rtcm.Message{message(1, "y", nil)},
+			[]string{`error "x" in A, "y" in B`}},
+		{"frame", []rtcm.Message{message(1, "", []byte{1})}, []rtcm.Message{message(1, "", []byte{1, 2})},
+			[]string{"frames differ - 1 bytes in A, 2 in B"}},
+		{"missing from A", nil, []rtcm.Message{message(1, "", nil)}, []string{"missing from A"}},
+		{"missing from B", []rtcm.Message{message(1, "", nil), message(2, "", nil)},
+			[]rtcm.Message{message(1, "", nil)}, []string{"missing from B"}},
+	}
+
+	for _, td := range testData {
+		differences := Diff(td.a, td.b)
+		if len(differences) != len(td.want) {
+			t.Errorf("%s: want %d differences, got %d", td.description, len(td.want), len(differences))
+			continue
+		}
+		for i := range differences {
+			if differences[i].Reason != td.want[i] {
+				t.Errorf("%s: want %s got %s", td.description, td.want[i], differences[i].Reason)
+			}
+		}
+	}
+}
+
+// TestTee checks that the tap copies the input to all of the outputs.
+func TestTee(t *testing.T) {
+	ch_in := make(chan byte, 3)
+	ch_a := make(chan byte, 3)
+	ch_b := make(chan byte, 3)
+	ch_in <- 1
+	ch_in <- 2
+	ch_in <- 3
+	close(ch_in)
+
+	Tee(ch_in, ch_a, ch_b)
+
+	for _, ch := range []chan byte{ch_a, ch_b} {
+		got := make([]byte, 0)
+		for b := range ch {
+			got = append(got, b)
+		}
+		if !bytes.Equal([]byte{1, 2, 3}, got) {
+			t.Errorf("want [1 2 3] got %v", got)
+		}
+	}
+}
+
+// failingReader returns some data and then an error.
+type failingReader struct {
+	done bool
+}
+
+func (reader *failingReader) Read(buffer []byte) (int, error) {
+	if reader.done {
+		return 0, errors.New("read failed")
+	}
+	reader.done = true
+	return copy(buffer, testdata.MessageFrameType1005), nil
+}
+
+// TestCompareWithReadError checks that Compare returns a read error.
+func TestCompareWithReadError(t *testing.T) {
+	a := rtcm.New(startTime, slog.LevelDebug)
+	b := rtcm.New(startTime, slog.LevelDebug)
+
+	_, err := Compare(&failingReader{}, a.HandleMessages, b.HandleMessages)
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("want error read failed, got %v", err)
+	}
+}
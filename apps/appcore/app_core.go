@@ -9,6 +9,7 @@ import (
 
 	fileHandler "github.com/goblimey/go-ntrip/file_handler"
 	"github.com/goblimey/go-ntrip/jsonconfig"
+	"github.com/goblimey/go-ntrip/metrics"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
 	"github.com/goblimey/go-ntrip/rtcm/utils"
 )
@@ -16,6 +17,14 @@ import (
 type AppCore struct {
 	Config   *jsonconfig.Config
 	Channels []chan rtcm.Message
+
+	// Metrics optionally counts the reconnections to the device and the
+	// CRC failures.
+	Metrics *metrics.Registry
+
+	// Events optionally receives the events of each RTCM handler.  See
+	// rtcm.Handler.Subscribe.
+	Events chan<- rtcm.Event
 }
 
 func New(conf *jsonconfig.Config, channels []chan rtcm.Message) *AppCore {
@@ -45,10 +54,13 @@ func (appCore *AppCore) HandleMessages(startTime time.Time) {
 	// of service and then comes back.  The function simply waits until
 	// messages start arriving again.  However, if the GNSS device fails hard,
 	// this could hang and require human intervention to stop it.
-	for {
+	for trip := 0; ; trip++ {
 		// Find the input file and get a buffered reader.
 		r := appCore.Config.WaitAndConnectToInput()
 		reader := bufio.NewReader(r)
+		if trip > 0 && appCore.Metrics != nil {
+			appCore.Metrics.CountDeviceReconnect()
+		}
 
 		continueFlag := appCore.HandleMessagesUntilEOF(startTime, reader)
 
@@ -79,6 +91,8 @@ func (appCore *AppCore) HandleMessagesUntilEOF(startTime time.Time, reader *bufi
 
 	// Create a file handler.
 	fh := fileHandler.New(messageChan, appCore.Config)
+	fh.Metrics = appCore.Metrics
+	fh.Events = appCore.Events
 
 	// Start the file handler and feed the input into it.  Messages will come out
 	// of the message channel.  The file handler will die when it
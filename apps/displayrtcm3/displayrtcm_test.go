@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -130,7 +133,9 @@ This message provides corrections for the inter-frequency bias caused by the dif
 Frame length 14 bytes:
 00000000  d3 00 08 4c e0 00 8a 00  00 00 00 a8 f7 2a        |...L.........*|
 
-(Message type 1230 - GLONASS code-phase biases - don't know how to decode this)
+stationID 0, code-phase biases aligned true
+L1 C/A bias 0.00 m
+L2 C/A bias 0.00 m
 
 `
 
@@ -139,7 +144,7 @@ Frame length 14 bytes:
 
 	var config jsonconfig.Config
 
-	HandleMessages(time.Now(), reader, &buffer, &config)
+	HandleMessages(time.Now(), reader, &buffer, &config, formatText)
 
 	// Pause to allow the channels to drain.
 
@@ -205,3 +210,111 @@ func TestOpenFileWithError(t *testing.T) {
 		t.Errorf("want %s got %s", want, got)
 	}
 }
+
+// TestDisplayMessagesAsJSON checks that DisplayMessagesAsJSON writes each
+// message as a JSON object on a line of its own.
+func TestDisplayMessagesAsJSON(t *testing.T) {
+
+	rtcmHandler := rtcm.New(testdata.UTCTimeOfMessageFrameType1077, slog.LevelDebug)
+	frames := [][]byte{
+		testdata.MessageFrameType1005,
+		testdata.MessageFrameType1077,
+		testdata.Fake1230,
+	}
+	messageChan := make(chan rtcm.Message, len(frames))
+	for _, frame := range frames {
+		message, messageError := rtcmHandler.GetMessage(frame)
+		if messageError != nil {
+			t.Fatal(messageError)
+		}
+		messageChan <- *message
+	}
+	close(messageChan)
+
+	var buffer bytes.Buffer
+	displayError := DisplayMessagesAsJSON(messageChan, &buffer)
+	if displayError != nil {
+		t.Fatal(displayError)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != len(frames) {
+		t.Fatalf("want %d lines, got %d", len(frames), len(lines))
+	}
+
+	var got [3]jsonMessage
+	for i := range lines {
+		if err := json.Unmarshal([]byte(lines[i]), &got[i]); err != nil {
+			t.Fatalf("line %d - %v", i, err)
+		}
+	}
+
+	// The 1005 has station 2 and a position.
+	position := got[0].Position
+	if got[0].Type != 1005 || got[0].Station == nil || *got[0].Station != 2 {
+		t.Errorf("1005 - got type %d station %v", got[0].Type, got[0].Station)
+	}
+	if position == nil || position.X != 12.3456 || position.Y != 23.4567 || position.Z != 34.5678 {
+		t.Errorf("1005 - got position %v", position)
+	}
+	if got[0].Satellites != nil || got[0].Timestamp != nil {
+		t.Error("1005 - want no satellites or timestamp")
+	}
+
+	// The 1077 has eight satellites and fourteen signals.
+	msm := got[1]
+	if msm.Type != 1077 || msm.Constellation != "GPS" {
+		t.Errorf("1077 - got type %d constellation %s", msm.Type, msm.Constellation)
+	}
+	if msm.Timestamp == nil || *msm.Timestamp != 432023000 {
+		t.Errorf("1077 - got timestamp %v", msm.Timestamp)
+	}
+	if msm.SentAt != "2023-05-19T00:00:05Z" {
+		t.Errorf("1077 - got sent_at %s", msm.SentAt)
+	}
+	if len(msm.Satellites) != 8 || len(msm.Signals) != 14 {
+		t.Errorf("1077 - want 8 satellites and 14 signals, got %d and %d",
+			len(msm.Satellites), len(msm.Signals))
+	}
+	if len(msm.Signals) > 0 {
+		signal := msm.Signals[0]
+		if signal.Satellite != 4 || signal.Signal != 2 {
+			t.Errorf("1077 - got satellite %d signal %d", signal.Satellite, signal.Signal)
+		}
+		if signal.RangeM == nil || math.Abs(*signal.RangeM-24410527.355) > 0.001 {
+			t.Errorf("1077 - got range %v", signal.RangeM)
+		}
+		if signal.PhaseRange == nil || signal.RangeRate == nil || signal.CNR == nil {
+			t.Error("1077 - want phase range, phase range rate and CNR")
+		}
+	}
+
+	// The 1230 has biases for L1 C/A and L2 C/A.
+	if got[2].Type != 1230 || got[2].Length != 14 || got[2].Signals != nil || len(got[2].Biases) != 2 {
+		t.Errorf("1230 - got %v", got[2])
+	}
+}
+
+// TestHandleMessagesAsJSON checks that HandleMessages writes no heading in
+// JSON format.
+func TestHandleMessagesAsJSON(t *testing.T) {
+
+	const want = `{"type":1230,"title":"GLONASS L1 and L2 Code-Phase Biases","length":14,"station":0,"biases_m":{"L1 C/A":0,"L2 C/A":0}}` + "\n"
+
+	reader := bytes.NewReader(testdata.Fake1230)
+	var buffer bytes.Buffer
+
+	var config jsonconfig.Config
+
+	HandleMessages(time.Now(), reader, &buffer, &config, formatJSON)
+
+	// Pause to allow the channels to drain.
+
+	time.Sleep(time.Second)
+
+	got := buffer.String()
+
+	if want != got {
+		t.Error(diff.Diff(want, got))
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/rtcm/type1230"
+	msm4Message "github.com/goblimey/go-ntrip/rtcm/type_msm4/message"
+	msm5Message "github.com/goblimey/go-ntrip/rtcm/type_msm5/message"
+	msm6Message "github.com/goblimey/go-ntrip/rtcm/type_msm6/message"
+	msm7Message "github.com/goblimey/go-ntrip/rtcm/type_msm7/message"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// positionDivisor converts the antenna reference coordinates in messages of
+// type 1005 and 1006, which are in units of 0.1 mm, to metres.
+const positionDivisor = 10000.0
+
+// jsonMessage is the JSON form of a message, one per line of the output.
+type jsonMessage struct {
+	// Type is the message type, -1 for non-RTCM data.
+	Type int `json:"type"`
+
+	// Title is a short description of the message type.
+	Title string `json:"title,omitempty"`
+
+	// Length is the length of the frame in bytes.
+	Length int `json:"length"`
+
+	// Station is the reference station ID, if the message has one.
+	Station *uint `json:"station,omitempty"`
+
+	// Timestamp is the timestamp of an MSM, as sent.
+	Timestamp *uint `json:"timestamp,omitempty"`
+
+	// SentAt is the time of an MSM's observations in UTC.
+	SentAt string `json:"sent_at,omitempty"`
+
+	// Constellation is the constellation of an MSM.
+	Constellation string `json:"constellation,omitempty"`
+
+	// Position is the base position from a message of type 1005 or 1006.
+	Position *jsonPosition `json:"position,omitempty"`
+
+	// Satellites lists the IDs of the satellites observed in an MSM.
+	Satellites []uint `json:"satellites,omitempty"`
+
+	// Signals lists the signals observed in an MSM.
+	Signals []jsonSignal `json:"signals,omitempty"`
+
+	// Biases gives the valid Glonass code-phase biases in metres from a
+	// message of type 1230, keyed by signal name.
+	Biases map[string]float64 `json:"biases_m,omitempty"`
+
+	// NMEA is an NMEA sentence.
+	NMEA string `json:"nmea,omitempty"`
+
+	// Error describes anything that went wrong decoding the message.
+	Error string `json:"error,omitempty"`
+}
+
+// jsonPosition is a base position as ECEF coordinates in metres.
+type jsonPosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// jsonSignal is one signal from one satellite in an MSM.  The values that
+// are invalid or not in this level of MSM are left out.
+type jsonSignal struct {
+	Satellite  uint     `json:"satellite"`
+	Signal     uint     `json:"signal"`
+	RangeM     *float64 `json:"range_m,omitempty"`
+	PhaseRange *float64 `json:"phase_range_cycles,omitempty"`
+	RangeRate  *float64 `json:"phase_range_rate_m_s,omitempty"`
+	CNR        *float64 `json:"cnr_dbhz,omitempty"`
+	LockTime   uint     `json:"lock_time_indicator"`
+	HalfCycle  bool     `json:"half_cycle_ambiguity"`
+}
+
+// DisplayMessagesAsJSON receives messages from the given channel and writes
+// each of them to the writer as a JSON object on a line of its own.  It can
+// be run in a goroutine.
+func DisplayMessagesAsJSON(messageChan chan rtcm.Message, writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	for {
+		message, ok := <-messageChan
+		if !ok {
+			return nil
+		}
+		encodeError := encoder.Encode(toJSON(&message))
+		if encodeError != nil {
+			return encodeError
+		}
+	}
+}
+
+// toJSON returns the JSON form of a message.
+func toJSON(message *rtcm.Message) *jsonMessage {
+	result := jsonMessage{
+		Type:   message.MessageType,
+		Length: len(message.RawData),
+		Error:  message.ErrorMessage,
+	}
+
+	if message.MessageType == utils.NMEAMessage {
+		result.NMEA = strings.TrimSpace(string(message.RawData))
+		return &result
+	}
+	if message.MessageType == utils.NonRTCMMessage {
+		return &result
+	}
+
+	if titleAndComment := utils.GetTitleAndComment(message.MessageType); titleAndComment != nil {
+		result.Title = titleAndComment.Title
+	}
+	if stationID, ok := utils.GetStationID(message.MessageType, message.RawData); ok {
+		result.Station = &stationID
+	}
+
+	if utils.MSM(message.MessageType) {
+		timestamp := message.Timestamp
+		result.Timestamp = &timestamp
+		result.Constellation = utils.GetConstellation(message.MessageType)
+		if !message.SentAt.IsZero() {
+			result.SentAt = message.SentAt.UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	// Decoding may record an error in the message.
+	readable := rtcm.PrepareForDisplay(message)
+	result.Error = message.ErrorMessage
+
+	switch m := readable.(type) {
+	case *type1005.Message:
+		result.Position = &jsonPosition{
+			X: float64(m.AntennaRefX) / positionDivisor,
+			Y: float64(m.AntennaRefY) / positionDivisor,
+			Z: float64(m.AntennaRefZ) / positionDivisor,
+		}
+	case *type1006.Message:
+		result.Position = &jsonPosition{
+			X: float64(m.AntennaRefX) / positionDivisor,
+			Y: float64(m.AntennaRefY) / positionDivisor,
+			Z: float64(m.AntennaRefZ) / positionDivisor,
+		}
+	case *type1230.Message:
+		result.Biases = make(map[string]float64)
+		for signal := type1230.L1CA; signal <= type1230.L2P; signal++ {
+			if m.Valid(signal) {
+				result.Biases[type1230.SignalName(signal)] = m.BiasMetres(signal)
+			}
+		}
+	case *msm4Message.Message:
+		result.Satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				c := &cells[i]
+				valid := c.Satellite.RangeWholeMillis != utils.InvalidRange
+				result.Signals = append(result.Signals, newJSONSignal(
+					c.Satellite.ID, c.ID, valid, c.Wavelength > 0,
+					c.RangeInMetres, c.PhaseRange, nil, c.CNR(),
+					c.LockTimeIndicator, c.HalfCycleAmbiguity))
+			}
+		}
+	case *msm5Message.Message:
+		result.Satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				c := &cells[i]
+				valid := c.Satellite.RangeWholeMillis != utils.InvalidRange
+				result.Signals = append(result.Signals, newJSONSignal(
+					c.Satellite.ID, c.ID, valid, c.Wavelength > 0,
+					c.RangeInMetres, c.PhaseRange, c.PhaseRangeRate, c.CNR(),
+					c.LockTimeIndicator, c.HalfCycleAmbiguity))
+			}
+		}
+	case *msm6Message.Message:
+		result.Satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				c := &cells[i]
+				valid := c.Satellite.RangeWholeMillis != utils.InvalidRange
+				result.Signals = append(result.Signals, newJSONSignal(
+					c.Satellite.ID, c.ID, valid, c.Wavelength > 0,
+					c.RangeInMetres, c.PhaseRange, nil, c.CNR(),
+					c.LockTimeIndicator, c.HalfCycleAmbiguity))
+			}
+		}
+	case *msm7Message.Message:
+		result.Satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				c := &cells[i]
+				valid := c.Satellite.RangeWholeMillis != utils.InvalidRange
+				result.Signals = append(result.Signals, newJSONSignal(
+					c.Satellite.ID, c.ID, valid, c.Wavelength > 0,
+					c.RangeInMetres, c.PhaseRange, c.PhaseRangeRate, c.CNR(),
+					c.LockTimeIndicator, c.HalfCycleAmbiguity))
+			}
+		}
+	}
+
+	return &result
+}
+
+// newJSONSignal is a helper function for toJSON.  It builds the JSON form
+// of a signal cell from the cell's methods.  The range and the phase range
+// are left out if the range in the satellite cell is invalid, the phase range
+// also if the signal has no known wavelength.  The phase range rate is left
+// out if rangeRate is nil and the CNR if it's zero, meaning not available.
+func newJSONSignal(
+	satelliteID, signalID uint,
+	rangeValid, haveWavelength bool,
+	rangeInMetres, phaseRange, rangeRate func() float64,
+	cnr float64,
+	lockTime uint,
+	halfCycle bool,
+) jsonSignal {
+	signal := jsonSignal{
+		Satellite: satelliteID,
+		Signal:    signalID,
+		LockTime:  lockTime,
+		HalfCycle: halfCycle,
+	}
+	if rangeValid {
+		r := rangeInMetres()
+		signal.RangeM = &r
+		if haveWavelength {
+			p := phaseRange()
+			signal.PhaseRange = &p
+		}
+	}
+	if rangeRate != nil {
+		rr := rangeRate()
+		signal.RangeRate = &rr
+	}
+	if cnr != 0 {
+		signal.CNR = &cnr
+	}
+	return signal
+}
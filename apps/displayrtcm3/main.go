@@ -129,22 +129,55 @@
 //
 // Usage:
 //
-//	displayrtcm3 file date
+//	displayrtcm3 [-format text|json] file [date [timezone]]
 //
 // Examples:
 //
+//		displayrtcm3 testdata.rtcm
+//
 //		displayrtcm3 testdata.rtcm 2020-11-13
 //
 //	 displayrtcm3 - 2020-11-13 # take input from the standard input channel.
 //
+//		displayrtcm3 testdata.rtcm 2020-11-13 Europe/London
+//
+// With "-format json" each message is written as a JSON object on a line
+// of its own instead of the text display, so the output can be piped into
+// jq or loaded into a data frame:
+//
+//	displayrtcm3 -format json testdata.rtcm | jq 'select(.type == 1077)'
+//
+// An object has the message type, title, frame length and, where the
+// message has them, the station ID, the timestamp and time of an MSM, the
+// position in a type 1005 or 1006 (ECEF metres), the satellites and the
+// signals of an MSM, with the range in metres, the phase range in cycles,
+// the phase range rate in metres per second and the carrier to noise ratio
+// in dB-Hz.  Values that are invalid or not in the message are left out.
+//
+// The optional timezone is the name of a zone in the IANA time zone
+// database.  If it's given, the times in the display are shown in that
+// zone rather than in UTC.
+//
 // The RTCM data may contain other messages and these are displayed in
 // "od" format - hex values and readable text.  They are mostly ASCII
 // strings, for example NMEA messages, so they should be fairly readable.
+// NMEA GGA, RMC, GSV and GST sentences with a good checksum are also
+// decoded, showing the position, time, satellites in view and so on.
 //
-// The program takes one argument which should be in the format
-// "yyyy-mm-dd".  This is turned into a date/time at midnight UTC on
-// that day.  This is used to figure out the start of the various
-// GNSS weeks - the GPS week and so on.
+// The optional date should be in the format "yyyy-mm-dd".  This is
+// turned into a date/time at midnight UTC on that day.  This is used to
+// figure out the start of the various GNSS weeks - the GPS week and so on.
+// If the data contains a GPS ephemeris (message type 1019) or a system
+// parameters message (type 1013), the weeks are taken from that instead,
+// so the date is only needed to get the times right in the messages before
+// it, or if the data has neither.  Without a date, the current time is
+// used.
+//
+// The number of leap seconds by which GPS time is ahead of UTC depends on
+// the date, so data recorded before 2017 is displayed with the right times.
+// The tool knows about the leap seconds up to the start of 2017.  If another
+// is announced, the -leapseconds option names an up to date copy of the IERS
+// file leap-seconds.list.
 //
 // Each Multiple Signal Message (MSM) contains a timestamp.  The
 // timestamps in the input data should relate to the current GNSS weeks.
@@ -170,6 +203,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"io"
 	"log"
 	"os"
@@ -177,53 +211,96 @@ import (
 
 	AppCore "github.com/goblimey/go-ntrip/apps/appcore"
 	// handler "github.com/goblimey/go-ntrip/file_handler"
+	"github.com/goblimey/go-ntrip/exitcode"
 	"github.com/goblimey/go-ntrip/jsonconfig"
+	"github.com/goblimey/go-ntrip/leapseconds"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
 )
 
 func main() {
 
-	var startTime time.Time
-	var reader io.Reader
-	if len(os.Args) < 3 {
-		log.Fatalf("usage: %s file yyyy-mm-dd", os.Args[0])
-	}
+	var format string
+	flag.StringVar(&format, "format", formatText, "the output format, text or json")
+	var leapSecondsFile string
+	flag.StringVar(&leapSecondsFile, "leapseconds", "", "a copy of the IERS file leap-seconds.list")
+	flag.Parse()
+
+	const usage = "usage: %s [-format text|json] [-leapseconds file] file [yyyy-mm-dd [timezone]]"
 	appName := os.Args[0]
+	args := flag.Args()
+
+	if len(args) < 1 {
+		exitcode.Fatalf(exitcode.Config, usage, appName)
+	}
+	if format != formatText && format != formatJSON {
+		exitcode.Fatalf(exitcode.Config, "%s: unknown format %q - want text or json", appName, format)
+	}
+
+	if len(leapSecondsFile) > 0 {
+		leaps, leapError := leapseconds.Load(leapSecondsFile)
+		if leapError != nil {
+			exitcode.Fatalf(exitcode.Config, "%s: %v", appName, leapError)
+		}
+		leapseconds.SetDefault(leaps)
+	}
 
-	// The format of arg[2] should be yyyy-mm-dd.  arg[3] is a file containing RTCM messages.
-	var timeError error
-	startTime, timeError = getTime(os.Args[2])
-	if timeError != nil {
-		log.Printf("usage: %s file yyyy-mm-dd", appName)
-		log.Fatalf(timeError.Error())
+	// The format of args[1], if it's given, should be yyyy-mm-dd.  Otherwise
+	// the handler starts from the current time and takes the weeks from the
+	// data if it can.
+	startTime := time.Now()
+	if len(args) > 1 {
+		var timeError error
+		startTime, timeError = getTime(args[1])
+		if timeError != nil {
+			log.Printf(usage, appName)
+			exitcode.Fatal(exitcode.Config, timeError)
+		}
 	}
 
-	fileName := os.Args[1]
+	fileName := args[0]
 	reader, openError := openFile(fileName)
 	if openError != nil {
-		log.Fatalf("%s: cannot open %s - %v", appName, fileName, openError)
+		exitcode.Fatalf(exitcode.InputUnavailable, "%s: cannot open %s - %v", appName, fileName, openError)
 	}
 
 	// We just need the EOF timeout to be zero, which causes HandleMessages
 	// to stop when the input file is exhausted, so the zero value of the
 	// config is suitable.
 	var config jsonconfig.Config
+	config.ParseNMEA = true
+
+	if len(args) > 2 {
+		config.DisplayTimeZone = args[2]
+		if _, locationError := config.DisplayLocation(); locationError != nil {
+			exitcode.Fatalf(exitcode.Config, "%s: %v", appName, locationError)
+		}
+	}
 
-	HandleMessages(startTime, reader, os.Stdout, &config)
+	HandleMessages(startTime, reader, os.Stdout, &config, format)
 
 	os.Exit(0)
 }
 
-func HandleMessages(startTime time.Time, reader io.Reader, writer io.Writer, config *jsonconfig.Config) {
+// The output formats.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// HandleMessages reads messages from the reader until EOF and writes them to
+// the writer in the given format, text or json.  The text format starts with
+// a heading.
+func HandleMessages(startTime time.Time, reader io.Reader, writer io.Writer, config *jsonconfig.Config, format string) {
 
 	bufferedReader := bufio.NewReader(reader)
-	// Write the heading.
-	writer.Write([]byte("RTCM data\n"))
-	writer.Write([]byte("\nNote: times are in UTC.  RINEX format uses GPS time, which is currently (Jan 2021)\n"))
-	writer.Write([]byte("18 seconds ahead of UTC\n\n"))
 
 	messageChan := make(chan rtcm.Message, 2)
-	go DisplayMessages(messageChan, writer)
+	if format == formatJSON {
+		go DisplayMessagesAsJSON(messageChan, writer)
+	} else {
+		writeHeading(writer, config)
+		go DisplayMessages(messageChan, writer)
+	}
 
 	channels := make([]chan rtcm.Message, 0)
 	channels = append(channels, messageChan)
@@ -233,6 +310,17 @@ func HandleMessages(startTime time.Time, reader io.Reader, writer io.Writer, con
 	close(messageChan)
 }
 
+// writeHeading writes the heading of the text display.
+func writeHeading(writer io.Writer, config *jsonconfig.Config) {
+	writer.Write([]byte("RTCM data\n"))
+	zone := "UTC"
+	if len(config.DisplayTimeZone) > 0 {
+		zone = config.DisplayTimeZone
+	}
+	writer.Write([]byte("\nNote: times are in " + zone + ".  RINEX format uses GPS time, which is currently (Jan 2021)\n"))
+	writer.Write([]byte("18 seconds ahead of UTC\n\n"))
+}
+
 // DisplayMessages receives messages from the given channel, produces a
 // readable display of each and writes them to the writer.  It can be
 // run in a goroutine.
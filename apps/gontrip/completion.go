@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// completions gives, for each command, the words that can follow it.  The
+// scripts are made from it so that they stay in step with the commands.
+var completions = []struct {
+	command string
+	words   []string
+}{
+	{"init", []string{"-dir", "-install"}},
+	{"support-bundle", []string{"-dir", "-o", "-input", "-capture"}},
+	{"completion", []string{"bash", "zsh"}},
+	{"-version", nil},
+}
+
+// completionScript returns the script that makes the shell complete the
+// commands and options of gontrip.
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion(), nil
+	case "zsh":
+		// zsh can run a bash completion function.
+		return "autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion(), nil
+	default:
+		em := fmt.Sprintf("gontrip - no completion for shell %q - use bash or zsh", shell)
+		return "", errors.New(em)
+	}
+}
+
+// bashCompletion returns the bash completion script.
+func bashCompletion() string {
+	commands := make([]string, 0, len(completions))
+	for _, c := range completions {
+		commands = append(commands, c.command)
+	}
+
+	var b strings.Builder
+	b.WriteString("_gontrip() {\n")
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("\tlocal words=\"\"\n")
+	b.WriteString("\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	b.WriteString("\t\twords=\"" + strings.Join(commands, " ") + "\"\n")
+	b.WriteString("\telse\n")
+	b.WriteString("\t\tcase \"${COMP_WORDS[1]}\" in\n")
+	for _, c := range completions {
+		if len(c.words) == 0 {
+			continue
+		}
+		b.WriteString("\t\t" + c.command + ") words=\"" + strings.Join(c.words, " ") + "\" ;;\n")
+	}
+	b.WriteString("\t\tesac\n")
+	b.WriteString("\tfi\n")
+	b.WriteString("\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _gontrip gontrip\n")
+	return b.String()
+}
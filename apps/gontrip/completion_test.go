@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCompletionScript checks the completion scripts.
+func TestCompletionScript(t *testing.T) {
+	var testData = []struct {
+		shell     string
+		want      []string
+		wantError string
+	}{
+		{
+			"bash",
+			[]string{
+				`words="init support-bundle completion -version"`,
+				`init) words="-dir -install" ;;`,
+				`support-bundle) words="-dir -o -input -capture" ;;`,
+				`completion) words="bash zsh" ;;`,
+				"complete -o default -F _gontrip gontrip\n",
+			},
+			"",
+		},
+		{
+			"zsh",
+			[]string{"bashcompinit\n", "complete -o default -F _gontrip gontrip\n"},
+			"",
+		},
+		{"fish", nil, `gontrip - no completion for shell "fish" - use bash or zsh`},
+	}
+
+	for _, td := range testData {
+		got, err := completionScript(td.shell)
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.shell, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.shell, err)
+			continue
+		}
+		for _, want := range td.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: want %q in\n%s", td.shell, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/go-ntrip/config"
+)
+
+// The names of the files that the wizard writes.
+const (
+	configFileName  = "base-station.json"
+	scriptFileName  = "base-station.sh"
+	serviceFileName = "gontrip-base.service"
+)
+
+// systemdDirectory is where the systemd unit is installed.
+const systemdDirectory = "/etc/systemd/system"
+
+// writeFiles writes the config file, the script and the systemd unit into
+// the directory and checks the config by reading it back.  It returns the
+// names of the files.
+func writeFiles(directory string, answers *Answers) ([]string, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	host, portText, _ := net.SplitHostPort(answers.Caster)
+	port, _ := strconv.ParseUint(portText, 10, 16)
+	cfg := config.Config{
+		Input: config.Input{
+			Devices:                              []string{answers.Port},
+			Serial:                               config.Serial{Speed: answers.Speed},
+			ReadTimeoutMilliseconds:              3000,
+			SleepTimeAfterFailedOpenMilliseconds: 1000,
+			WaitTimeOnEOFMilliseconds:            1000,
+		},
+		Caster: config.Caster{
+			Host:       host,
+			Port:       uint(port),
+			Mountpoint: answers.Mountpoint,
+			User:       answers.User,
+			Password:   answers.Password,
+		},
+		Logging: config.Logging{
+			DisplayMessages:     true,
+			RecordMessages:      answers.RecordMessages,
+			MessageLogDirectory: answers.LogDirectory,
+		},
+	}
+	configFile := filepath.Join(directory, configFileName)
+	if err := writeJSON(configFile, &cfg); err != nil {
+		return nil, err
+	}
+	if err := checkConfig(configFile, &cfg); err != nil {
+		return nil, err
+	}
+
+	scriptFile := filepath.Join(directory, scriptFileName)
+	if err := os.WriteFile(scriptFile, []byte(script(answers)), 0700); err != nil {
+		return nil, err
+	}
+
+	serviceFile := filepath.Join(directory, serviceFileName)
+	if err := os.WriteFile(serviceFile, []byte(serviceUnit(directory)), 0644); err != nil {
+		return nil, err
+	}
+
+	return []string{configFile, scriptFile, serviceFile}, nil
+}
+
+// writeJSON writes the value to the file as indented JSON.  The config file
+// holds the password, so only the owner can read it.
+func writeJSON(file string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0600)
+}
+
+// checkConfig reads the config back the way that the programs do and
+// checks that it's the one that was written.
+func checkConfig(file string, want *config.Config) error {
+	got, err := config.Load(file)
+	if err != nil {
+		em := fmt.Sprintf("init - %s is not valid - %v", file, err)
+		return errors.New(em)
+	}
+	if !reflect.DeepEqual(got, want) {
+		em := fmt.Sprintf("init - %s does not contain the answers", file)
+		return errors.New(em)
+	}
+	return nil
+}
+
+// script returns the shell script that runs the pipeline.  It runs in its
+// own directory so that the programs find their configs.
+func script(answers *Answers) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Written by gontrip init.  Sends the RTCM messages from the receiver to the caster.\n")
+	b.WriteString("cd \"$(dirname \"$0\")\" || exit 1\n")
+	b.WriteString("serial_usb_grabber -c " + configFileName + " |\n")
+	b.WriteString("\trtcmfilter -c " + configFileName + " |\n")
+	b.WriteString("\tntripserver -caster " + shellQuote(answers.Caster))
+	b.WriteString(" -mountpoint " + shellQuote(answers.Mountpoint))
+	if len(answers.User) > 0 {
+		b.WriteString(" -user " + shellQuote(answers.User))
+	}
+	b.WriteString(" -password " + shellQuote(answers.Password) + "\n")
+	return b.String()
+}
+
+// serviceUnit returns the systemd unit that runs the script in the
+// directory and restarts it if it stops.
+func serviceUnit(directory string) string {
+	return "[Unit]\n" +
+		"Description=GNSS base station sending RTCM to a caster\n" +
+		"After=network-online.target\n" +
+		"Wants=network-online.target\n" +
+		"\n" +
+		"[Service]\n" +
+		"WorkingDirectory=" + directory + "\n" +
+		"ExecStart=" + filepath.Join(directory, scriptFileName) + "\n" +
+		"Restart=always\n" +
+		"RestartSec=10\n" +
+		"\n" +
+		"[Install]\n" +
+		"WantedBy=multi-user.target\n"
+}
+
+// shellQuote quotes the text for the shell.
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+// installSystemdService copies the unit file into the systemd directory,
+// then enables and starts the service.
+func installSystemdService(unitFile string) error {
+	data, readError := os.ReadFile(unitFile)
+	if readError != nil {
+		return readError
+	}
+	target := filepath.Join(systemdDirectory, filepath.Base(unitFile))
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		em := fmt.Sprintf("init - cannot install the service (are you root?) - %v", err)
+		return errors.New(em)
+	}
+
+	service := strings.TrimSuffix(filepath.Base(unitFile), ".service")
+	commands := [][]string{
+		{"systemctl", "daemon-reload"},
+		{"systemctl", "enable", "--now", service},
+	}
+	for _, command := range commands {
+		output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+		if err != nil {
+			em := fmt.Sprintf("init - %s failed - %v %s",
+				strings.Join(command, " "), err, strings.TrimSpace(string(output)))
+			return errors.New(em)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// gontrip is the front door to the go-ntrip tools.  Its init command is a
+// wizard that sets up a new base station, which is the most error-prone
+// part of using them:
+//
+//	gontrip init -dir /home/pi/base
+//
+// The wizard looks for serial ports, listens on each at the usual speeds
+// to find the one with a GNSS receiver sending RTCM, and asks which port to
+// use.  Then it asks for the caster's address, the mountpoint and the
+// credentials and where to keep the logs.  It writes, in the directory:
+//
+//	base-station.json     the config of serial_usb_grabber and rtcmfilter
+//	base-station.sh       the pipeline from the receiver to the caster
+//	gontrip-base.service  a systemd unit that runs the pipeline
+//
+// The pipeline is serial_usb_grabber | rtcmfilter | ntripserver, so those
+// programs must be on the PATH.  The config is in the format of the config
+// package and is read back to check it before the wizard finishes.  With
+// -install, or if the answer to the last question is yes, the wizard
+// installs the systemd unit and starts the service, which needs root.
+//
+// To report a problem, stop the service and run the support-bundle command
+// in the same directory:
+//
+//	gontrip support-bundle -dir /home/pi/base -o bundle.tar.gz
+//
+// It captures a minute of raw input from the receiver (see the -capture
+// option) and writes it to a gzipped tar file with the config (with the
+// password redacted), the recent event logs of the rtcmfilter and the
+// version.  With -input it captures the input from a file instead, or from
+// the standard input if the name is "-".  See the bundle package.
+//
+// The completion command writes a script that makes the shell complete the
+// commands and options of gontrip:
+//
+//	source <(gontrip completion bash)
+//
+// It can write a script for bash or zsh.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// usage describes the commands.
+const usage = "usage: gontrip init [-dir directory] [-install] | " +
+	"gontrip support-bundle [-dir directory] [-o file] [-input file] [-capture duration] | " +
+	"gontrip completion bash|zsh | gontrip -version"
+
+func main() {
+	if len(os.Args) < 2 {
+		exitcode.Fatal(exitcode.Config, usage)
+	}
+
+	switch os.Args[1] {
+	case "init":
+		initCommand(os.Args[2:])
+	case "support-bundle":
+		supportBundleCommand(os.Args[2:])
+	case "completion":
+		if len(os.Args) != 3 {
+			exitcode.Fatal(exitcode.Config, usage)
+		}
+		script, err := completionScript(os.Args[2])
+		if err != nil {
+			exitcode.Fatal(exitcode.Config, err)
+		}
+		fmt.Print(script)
+	case "-version", "--version":
+		fmt.Println(version.String("gontrip"))
+	default:
+		exitcode.Fatal(exitcode.Config, usage)
+	}
+}
+
+// initCommand runs the wizard.
+func initCommand(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	var directory string
+	var install bool
+	flags.StringVar(&directory, "dir", ".", "directory to receive the config files")
+	flags.BoolVar(&install, "install", false, "install and start the systemd service")
+	flags.Parse(args)
+
+	w := wizard{
+		in:             bufio.NewReader(os.Stdin),
+		out:            os.Stdout,
+		listPorts:      listSerialPorts,
+		probe:          probeSerialPort,
+		installService: installSystemdService,
+	}
+
+	if err := w.run(directory, install); err != nil {
+		exitcode.FatalError(err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+
+	"go.bug.st/serial"
+)
+
+// probeSpeeds are the line speeds tried on each port, most likely first.
+var probeSpeeds = []int{115200, 38400, 9600, 230400, 460800}
+
+// probeTime is the time spent listening on a port at each speed.  A
+// receiver sends its observations at least once a second.
+const probeTime = 3 * time.Second
+
+// probeLimit is the most data read from a port at each speed.
+const probeLimit = 64 * 1024
+
+// probeResult is what was found on a port at one speed.
+type probeResult struct {
+	// Types holds the types of the valid RTCM messages seen, in order.
+	// It's empty if there were none.
+	Types []int
+
+	// Err is the error if the port couldn't be read.
+	Err error
+}
+
+// listSerialPorts returns the names of the serial ports.
+func listSerialPorts() ([]string, error) {
+	return serial.GetPortsList()
+}
+
+// probeSerialPort listens on the port at the given speed for a few seconds
+// and reports the RTCM messages seen.
+func probeSerialPort(port string, speed int) probeResult {
+	p, openError := serial.Open(port, &serial.Mode{BaudRate: speed})
+	if openError != nil {
+		return probeResult{Err: openError}
+	}
+	defer p.Close()
+
+	p.SetReadTimeout(probeTime / 10)
+
+	data := make([]byte, 0, probeLimit)
+	buffer := make([]byte, 4096)
+	deadline := time.Now().Add(probeTime)
+	for time.Now().Before(deadline) && len(data) < probeLimit {
+		n, readError := p.Read(buffer)
+		if readError != nil {
+			return probeResult{Err: readError}
+		}
+		data = append(data, buffer[:n]...)
+	}
+
+	return probeResult{Types: rtcmTypes(data)}
+}
+
+// rtcmTypes returns the types of the valid RTCM messages in the data, in
+// order.  At the wrong speed the data is junk and there are none.
+func rtcmTypes(data []byte) []int {
+	scanner := rtcm.NewScanner(bytes.NewReader(data))
+	seen := make(map[int]bool)
+	for {
+		message, err := scanner.Next()
+		if err != nil {
+			break
+		}
+		if message.MessageType > 0 {
+			seen[message.MessageType] = true
+		}
+	}
+
+	types := make([]int, 0, len(seen))
+	for messageType := range seen {
+		types = append(types, messageType)
+	}
+	sort.Ints(types)
+	return types
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goblimey/go-ntrip/bundle"
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/serialin"
+)
+
+// defaultBundleFileName is the file that receives the support bundle if
+// the -o option isn't given.
+const defaultBundleFileName = "support-bundle.tar.gz"
+
+// eventLogPattern matches the event logs that the pipeline writes, relative
+// to the directory in which it runs.  See utils.GetDailyLogger.
+const eventLogPattern = "logs/rtcmfilter.*.log"
+
+// supportBundleCommand writes a support bundle for the base station set up
+// in a directory by the init command.
+func supportBundleCommand(args []string) {
+	flags := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	var directory, bundleFileName, inputName string
+	var captureTime time.Duration
+	flags.StringVar(&directory, "dir", ".", "directory holding the base station's config")
+	flags.StringVar(&bundleFileName, "o", defaultBundleFileName, "file to receive the bundle")
+	flags.StringVar(&inputName, "input", "",
+		"file from which to capture the input, - for the standard input - by default the receiver")
+	flags.DurationVar(&captureTime, "capture", bundle.DefaultCaptureTime, "time for which the input is captured")
+	flags.Parse(args)
+
+	effective, configError := config.Load(filepath.Join(directory, configFileName))
+	if configError != nil {
+		exitcode.Fatal(exitcode.Config, configError)
+	}
+
+	input, inputError := openInput(inputName, &effective.Input)
+	if inputError != nil {
+		exitcode.Fatal(exitcode.InputUnavailable, inputError)
+	}
+	defer input.Close()
+
+	file, createError := os.Create(bundleFileName)
+	if createError != nil {
+		exitcode.Fatal(exitcode.IOError, createError)
+	}
+
+	bundleError := writeBundle(file, directory, effective, input, captureTime)
+	closeError := file.Close()
+	if bundleError != nil {
+		exitcode.Fatal(exitcode.IOError, bundleError)
+	}
+	if closeError != nil {
+		exitcode.Fatal(exitcode.IOError, closeError)
+	}
+}
+
+// writeBundle writes a support bundle for the base station in the directory,
+// capturing the input from the reader.
+func writeBundle(out io.Writer, directory string, effective *config.Config, input io.Reader, captureTime time.Duration) error {
+	logPattern := filepath.Join(directory, eventLogPattern)
+	return bundle.Write(out, "gontrip", effective, input, captureTime, logPattern)
+}
+
+// openInput opens the named file, the standard input if the name is "-" or
+// the receiver given in the input section of the config if it's empty.
+// The receiver can't be read while the base station is running, so the
+// service should be stopped first.
+func openInput(name string, input *config.Input) (io.ReadCloser, error) {
+	switch name {
+	case "-":
+		return ioutil.NopCloser(os.Stdin), nil
+	case "":
+		reader, err := serialin.New(input, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := reader.Open(); err != nil {
+			return nil, err
+		}
+		return reader, nil
+	default:
+		return os.Open(name)
+	}
+}
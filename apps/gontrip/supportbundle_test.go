@@ -0,0 +1,100 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+)
+
+// TestWriteBundle checks the support bundle of a base station set up by
+// the init command.
+func TestWriteBundle(t *testing.T) {
+	directory := t.TempDir()
+	answers := Answers{
+		Port: "/dev/ttyACM0", Speed: 115200, Caster: "caster.example.com:2101",
+		Mountpoint: "MYBASE", Password: "secret", LogDirectory: "rtcmlog",
+	}
+	if _, err := writeFiles(directory, &answers); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(directory, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(directory, "logs", "rtcmfilter.2024-08-30.log")
+	if err := os.WriteFile(logFile, []byte("an event"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	effective, err := config.Load(filepath.Join(directory, configFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	bundleError := writeBundle(&out, directory, effective, strings.NewReader("raw input"), time.Hour)
+	if bundleError != nil {
+		t.Fatal(bundleError)
+	}
+
+	zipReader, zipError := gzip.NewReader(&out)
+	if zipError != nil {
+		t.Fatal(zipError)
+	}
+	archive := tar.NewReader(zipReader)
+	got := make(map[string]string)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := ioutil.ReadAll(archive)
+		got[header.Name] = string(contents)
+	}
+
+	if !strings.HasPrefix(got["version.txt"], "gontrip ") {
+		t.Errorf("unexpected version %q", got["version.txt"])
+	}
+	if !strings.Contains(got["config.json"], "MYBASE") || strings.Contains(got["config.json"], "secret") {
+		t.Errorf("want the config with the password redacted, got\n%s", got["config.json"])
+	}
+	if got["logs/rtcmfilter.2024-08-30.log"] != "an event" {
+		t.Errorf("want the event log, got %v", got)
+	}
+	if got["input.rtcm"] != "raw input" {
+		t.Errorf("want raw input got %q", got["input.rtcm"])
+	}
+}
+
+// TestOpenInput checks that the input can come from a file.
+func TestOpenInput(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "input.rtcm")
+	if err := os.WriteFile(fileName, []byte("recorded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := openInput(fileName, &config.Input{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	got, _ := ioutil.ReadAll(input)
+	if string(got) != "recorded" {
+		t.Errorf("want recorded got %q", got)
+	}
+
+	if _, err := openInput(filepath.Join(t.TempDir(), "junk"), &config.Input{}); err == nil {
+		t.Error("want an error for a missing file")
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// defaultCaster is offered when asking for the caster.  It's a free caster
+// that accepts any base station.
+const defaultCaster = "rtk2go.com:2101"
+
+// Answers holds the answers to the wizard's questions.
+type Answers struct {
+	// Port is the serial port of the receiver and Speed its line speed.
+	Port  string
+	Speed int
+
+	// Caster is the host and port of the caster.
+	Caster string
+
+	// Mountpoint, User and Password are the caster details.  The user is
+	// only needed for NTRIP version 2.
+	Mountpoint string
+	User       string
+	Password   string
+
+	// LogDirectory receives the logs.  If RecordMessages is set, the RTCM
+	// messages are recorded there.
+	LogDirectory   string
+	RecordMessages bool
+}
+
+// wizard asks the questions and writes the files.  The functions that
+// touch the hardware and the system are fields to support testing.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// listPorts returns the names of the serial ports.
+	listPorts func() ([]string, error)
+
+	// probe listens on a port at a speed.
+	probe func(port string, speed int) probeResult
+
+	// installService installs and starts the systemd unit in the file.
+	installService func(unitFile string) error
+}
+
+// run asks the questions, writes the files into the directory and, if
+// asked, installs the service.
+func (w *wizard) run(directory string, install bool) error {
+	directory, absError := filepath.Abs(directory)
+	if absError != nil {
+		return absError
+	}
+
+	fmt.Fprintln(w.out, "Setting up a base station.  Press Enter to take the answer in brackets.")
+
+	answers, err := w.ask()
+	if err != nil {
+		return err
+	}
+
+	files, writeError := writeFiles(directory, answers)
+	if writeError != nil {
+		return writeError
+	}
+	for _, file := range files {
+		fmt.Fprintf(w.out, "wrote %s\n", file)
+	}
+
+	if runtime.GOOS != "linux" {
+		fmt.Fprintln(w.out, "The service can only be installed on Linux.  Run base-station.sh to start.")
+		return nil
+	}
+
+	if !install {
+		install, err = w.yesNo("Install and start the systemd service (needs root)?", false)
+		if err != nil {
+			return err
+		}
+	}
+	if !install {
+		fmt.Fprintln(w.out, "Run base-station.sh to start, or gontrip init -install to install the service.")
+		return nil
+	}
+
+	unitFile := filepath.Join(directory, serviceFileName)
+	if err := w.installService(unitFile); err != nil {
+		return err
+	}
+	fmt.Fprintf(w.out, "installed and started %s\n", serviceFileName)
+	return nil
+}
+
+// ask asks the questions.
+func (w *wizard) ask() (*Answers, error) {
+	var answers Answers
+
+	port, speed, err := w.findReceiver()
+	if err != nil {
+		return nil, err
+	}
+	answers.Port, err = w.question("Serial port of the receiver", port, checkNotEmpty)
+	if err != nil {
+		return nil, err
+	}
+	speedText, err := w.question("Line speed", strconv.Itoa(speed), checkSpeed)
+	if err != nil {
+		return nil, err
+	}
+	answers.Speed, _ = strconv.Atoi(speedText)
+
+	answers.Caster, err = w.question("Caster (host:port)", defaultCaster, checkCaster)
+	if err != nil {
+		return nil, err
+	}
+	answers.Mountpoint, err = w.question("Mountpoint", "", checkMountpoint)
+	if err != nil {
+		return nil, err
+	}
+	answers.User, err = w.question("User (only for NTRIP version 2)", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	answers.Password, err = w.question("Password", "", checkNotEmpty)
+	if err != nil {
+		return nil, err
+	}
+
+	answers.LogDirectory, err = w.question("Log directory", "rtcmlog", checkNotEmpty)
+	if err != nil {
+		return nil, err
+	}
+	answers.RecordMessages, err = w.yesNo("Record the RTCM messages (for PPP)?", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &answers, nil
+}
+
+// findReceiver probes the serial ports and returns the port and speed on
+// which RTCM messages were found, to be offered as the answers.  If none
+// was found, it returns the first port, if there is one, and the first
+// speed.
+func (w *wizard) findReceiver() (string, int, error) {
+	fmt.Fprintln(w.out, "Looking for the receiver...")
+
+	ports, err := w.listPorts()
+	if err != nil {
+		fmt.Fprintf(w.out, "cannot list the serial ports - %v\n", err)
+	}
+	if len(ports) == 0 {
+		fmt.Fprintln(w.out, "no serial ports found - is the receiver plugged in?")
+		return "", probeSpeeds[0], nil
+	}
+
+	for _, port := range ports {
+		for _, speed := range probeSpeeds {
+			result := w.probe(port, speed)
+			if result.Err != nil {
+				fmt.Fprintf(w.out, "%s: %v\n", port, result.Err)
+				break
+			}
+			if len(result.Types) > 0 {
+				fmt.Fprintf(w.out, "%s: RTCM at %d baud - message types %s\n",
+					port, speed, joinTypes(result.Types))
+				return port, speed, nil
+			}
+		}
+		fmt.Fprintf(w.out, "%s: no RTCM\n", port)
+	}
+
+	return ports[0], probeSpeeds[0], nil
+}
+
+// question asks a question and returns the answer, or the default if the
+// answer is empty.  If the check function is not nil and the answer fails
+// the check, the question is asked again.
+func (w *wizard) question(question, defaultAnswer string, check func(string) error) (string, error) {
+	for {
+		if len(defaultAnswer) > 0 {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, defaultAnswer)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", question)
+		}
+
+		line, readError := w.in.ReadString('\n')
+		if readError != nil && len(line) == 0 {
+			return "", errors.New("init - the input ended before the questions were answered")
+		}
+		answer := strings.TrimSpace(line)
+		if len(answer) == 0 {
+			answer = defaultAnswer
+		}
+
+		if check == nil {
+			return answer, nil
+		}
+		checkError := check(answer)
+		if checkError == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(w.out, "%v\n", checkError)
+	}
+}
+
+// yesNo asks a question with the answer yes or no.
+func (w *wizard) yesNo(question string, defaultYes bool) (bool, error) {
+	defaultAnswer := "n"
+	if defaultYes {
+		defaultAnswer = "y"
+	}
+	answer, err := w.question(question+" (y/n)", defaultAnswer, checkYesNo)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+// checkNotEmpty checks that an answer is given.
+func checkNotEmpty(answer string) error {
+	if len(answer) == 0 {
+		return errors.New("an answer is needed")
+	}
+	return nil
+}
+
+// checkSpeed checks a line speed.
+func checkSpeed(answer string) error {
+	speed, err := strconv.Atoi(answer)
+	if err != nil || speed <= 0 {
+		return fmt.Errorf("%q is not a line speed", answer)
+	}
+	return nil
+}
+
+// checkCaster checks the address of a caster.
+func checkCaster(answer string) error {
+	host, port, err := net.SplitHostPort(answer)
+	if err != nil || len(host) == 0 {
+		return fmt.Errorf("%q is not host:port", answer)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%q is not a port number", port)
+	}
+	return nil
+}
+
+// checkMountpoint checks a mountpoint.
+func checkMountpoint(answer string) error {
+	if len(answer) == 0 {
+		return errors.New("an answer is needed")
+	}
+	if strings.ContainsAny(answer, "/?&=: ") {
+		return fmt.Errorf("%q is not a legal mountpoint", answer)
+	}
+	return nil
+}
+
+// checkYesNo checks a yes or no answer.
+func checkYesNo(answer string) error {
+	switch strings.ToLower(answer) {
+	case "y", "yes", "n", "no":
+		return nil
+	default:
+		return errors.New("answer y or n")
+	}
+}
+
+// joinTypes returns the message types separated by commas.
+func joinTypes(types []int) string {
+	text := make([]string, 0, len(types))
+	for _, t := range types {
+		text = append(text, strconv.Itoa(t))
+	}
+	return strings.Join(text, ",")
+}
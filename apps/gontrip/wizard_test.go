@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// newTestWizard is a helper function.  It returns a wizard that reads the
+// given input and finds a receiver on /dev/ttyACM1 at 38400 baud.  The
+// returned slice records the unit files that the wizard installs.
+func newTestWizard(input string) (*wizard, *bytes.Buffer, *[]string) {
+	var output bytes.Buffer
+	var installed []string
+	w := wizard{
+		in:  bufio.NewReader(strings.NewReader(input)),
+		out: &output,
+		listPorts: func() ([]string, error) {
+			return []string{"/dev/ttyACM0", "/dev/ttyACM1"}, nil
+		},
+		probe: func(port string, speed int) probeResult {
+			if port == "/dev/ttyACM1" && speed == 38400 {
+				return probeResult{Types: []int{1005, 1077, 1230}}
+			}
+			return probeResult{}
+		},
+		installService: func(unitFile string) error {
+			installed = append(installed, unitFile)
+			return nil
+		},
+	}
+	return &w, &output, &installed
+}
+
+// TestWizard checks that the wizard writes the files from the answers.
+func TestWizard(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the service is only installed on linux")
+	}
+
+	directory := t.TempDir()
+
+	// Take the port and speed found, give a bad caster and a bad
+	// mountpoint before good ones, no user, a password with a quote in it,
+	// the default log directory, don't record and install the service.
+	input := "\n\n" +
+		"caster.example.com\n" +
+		"caster.example.com:2101\n" +
+		"MY/BASE\n" +
+		"MYBASE\n" +
+		"\n" +
+		"it's secret\n" +
+		"\n" +
+		"n\n" +
+		"y\n"
+	w, output, installed := newTestWizard(input)
+
+	if err := w.run(directory, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"/dev/ttyACM0: no RTCM",
+		"/dev/ttyACM1: RTCM at 38400 baud - message types 1005,1077,1230",
+		"Serial port of the receiver [/dev/ttyACM1]: ",
+		`"caster.example.com" is not host:port`,
+		`"MY/BASE" is not a legal mountpoint`,
+		"installed and started gontrip-base.service",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("want %q in the output\n%s", want, output.String())
+		}
+	}
+
+	unitFile := filepath.Join(directory, serviceFileName)
+	if len(*installed) != 1 || (*installed)[0] != unitFile {
+		t.Errorf("want %s installed got %v", unitFile, *installed)
+	}
+
+	cfg, configError := config.Load(filepath.Join(directory, configFileName))
+	if configError != nil {
+		t.Fatal(configError)
+	}
+	if len(cfg.Input.Devices) != 1 || cfg.Input.Devices[0] != "/dev/ttyACM1" || cfg.Input.Serial.Speed != 38400 {
+		t.Errorf("unexpected input section %+v", cfg.Input)
+	}
+	if cfg.Caster.Address() != "caster.example.com:2101" || cfg.Caster.Mountpoint != "MYBASE" {
+		t.Errorf("unexpected caster section %+v", cfg.Caster)
+	}
+	if cfg.Logging.MessageLogDirectory != "rtcmlog" || cfg.Logging.RecordMessages || !cfg.Logging.DisplayMessages {
+		t.Errorf("unexpected logging section %+v", cfg.Logging)
+	}
+
+	wantScript := "ntripserver -caster 'caster.example.com:2101' -mountpoint 'MYBASE' -password 'it'\\''s secret'\n"
+	script, _ := os.ReadFile(filepath.Join(directory, scriptFileName))
+	if !strings.HasSuffix(string(script), wantScript) {
+		t.Errorf("want the script to end\n%s\ngot\n%s", wantScript, script)
+	}
+	if strings.Contains(string(script), "-user") {
+		t.Errorf("want no user in the script\n%s", script)
+	}
+	info, _ := os.Stat(filepath.Join(directory, scriptFileName))
+	if info == nil || info.Mode().Perm() != 0700 {
+		t.Errorf("want the script to be executable - %v", info)
+	}
+
+	unit, _ := os.ReadFile(unitFile)
+	wantExec := "ExecStart=" + filepath.Join(directory, scriptFileName) + "\n"
+	if !strings.Contains(string(unit), wantExec) {
+		t.Errorf("want %q in the unit\n%s", wantExec, unit)
+	}
+}
+
+// TestWizardWithoutInstall checks that the service is not installed if the
+// answer is no, and that -install skips the question.
+func TestWizardWithoutInstall(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the service is only installed on linux")
+	}
+
+	const answers = "\n\n\nMYBASE\nuser\npassword\n\ny\n"
+
+	var testData = []struct {
+		description string
+		input       string
+		install     bool
+		want        int
+	}{
+		{"answer no", answers + "n\n", false, 0},
+		{"-install", answers, true, 1},
+	}
+
+	for _, td := range testData {
+		w, _, installed := newTestWizard(td.input)
+		if err := w.run(t.TempDir(), td.install); err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if len(*installed) != td.want {
+			t.Errorf("%s: want %d installs got %d", td.description, td.want, len(*installed))
+		}
+	}
+}
+
+// TestWizardErrors checks the errors from the wizard.
+func TestWizardErrors(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the service is only installed on linux")
+	}
+
+	var testData = []struct {
+		description  string
+		input        string
+		installError error
+		want         string
+	}{
+		{
+			"input ends",
+			"\n\n",
+			nil,
+			"init - the input ended before the questions were answered",
+		},
+		{
+			"install fails",
+			"\n\n\nMYBASE\n\npassword\n\nn\ny\n",
+			errors.New("init - cannot install the service"),
+			"init - cannot install the service",
+		},
+	}
+
+	for _, td := range testData {
+		w, _, _ := newTestWizard(td.input)
+		installError := td.installError
+		w.installService = func(string) error { return installError }
+		err := w.run(t.TempDir(), false)
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want error %s got %v", td.description, td.want, err)
+		}
+	}
+}
+
+// TestFindReceiver checks the defaults offered when no receiver is found.
+func TestFindReceiver(t *testing.T) {
+	var testData = []struct {
+		description string
+		ports       []string
+		portError   error
+		wantPort    string
+		wantOutput  string
+	}{
+		{"no ports", nil, nil, "", "no serial ports found"},
+		{"list fails", nil, errors.New("no access"), "", "cannot list the serial ports - no access"},
+		{"no receiver", []string{"/dev/ttyUSB0"}, nil, "/dev/ttyUSB0", "/dev/ttyUSB0: no RTCM"},
+	}
+
+	for _, td := range testData {
+		w, output, _ := newTestWizard("")
+		ports, portError := td.ports, td.portError
+		w.listPorts = func() ([]string, error) { return ports, portError }
+
+		port, speed, err := w.findReceiver()
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+		}
+		if port != td.wantPort || speed != probeSpeeds[0] {
+			t.Errorf("%s: want %q %d got %q %d", td.description, td.wantPort, probeSpeeds[0], port, speed)
+		}
+		if !strings.Contains(output.String(), td.wantOutput) {
+			t.Errorf("%s: want %q in the output\n%s", td.description, td.wantOutput, output.String())
+		}
+	}
+}
+
+// TestChecks checks the checks on the answers.
+func TestChecks(t *testing.T) {
+	var testData = []struct {
+		description string
+		check       func(string) error
+		answer      string
+		want        bool
+	}{
+		{"speed", checkSpeed, "115200", true},
+		{"bad speed", checkSpeed, "fast", false},
+		{"negative speed", checkSpeed, "-1", false},
+		{"caster", checkCaster, "rtk2go.com:2101", true},
+		{"caster without port", checkCaster, "rtk2go.com", false},
+		{"caster with bad port", checkCaster, "rtk2go.com:99999", false},
+		{"caster without host", checkCaster, ":2101", false},
+		{"mountpoint", checkMountpoint, "MYBASE_1", true},
+		{"empty mountpoint", checkMountpoint, "", false},
+		{"mountpoint with space", checkMountpoint, "MY BASE", false},
+		{"yes", checkYesNo, "Yes", true},
+		{"maybe", checkYesNo, "maybe", false},
+		{"empty", checkNotEmpty, "", false},
+	}
+
+	for _, td := range testData {
+		err := td.check(td.answer)
+		if (err == nil) != td.want {
+			t.Errorf("%s: want ok %v got %v", td.description, td.want, err)
+		}
+	}
+}
+
+// TestRTCMTypes checks that rtcmTypes finds the message types in the data
+// and none in junk.
+func TestRTCMTypes(t *testing.T) {
+	var data []byte
+	data = append(data, "junk"...)
+	data = append(data, testdata.MessageFrameType1077...)
+	data = append(data, testdata.MessageFrameType1005...)
+	data = append(data, testdata.MessageFrameType1077...)
+
+	got := rtcmTypes(data)
+	if joinTypes(got) != "1005,1077" {
+		t.Errorf("want 1005,1077 got %v", got)
+	}
+
+	if got := rtcmTypes([]byte("junk at the wrong speed")); len(got) != 0 {
+		t.Errorf("want no types got %v", got)
+	}
+}
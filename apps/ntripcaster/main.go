@@ -0,0 +1,291 @@
+// The ntripcaster is an NTRIP caster.  Base stations send their RTCM data to
+// it and rovers fetch the data from it, so with the rtcmfilter and an NTRIP
+// server, the whole chain from the base station to the rover runs on go-ntrip
+// code:
+//
+//	ntripcaster -c ntripcaster.json
+//
+// The config file is read by the config package, so it can be in JSON or
+// YAML and can take the passwords from environment variables.  The
+// ntripcaster section gives the address to listen on (":2101" by default)
+// and the mountpoints.  Each mountpoint has the password that its server
+// must give and, optionally, the rovers that may use it:
+//
+//	{
+//	    "ntripcaster": {
+//	        "listen_address": ":2101",
+//	        "mountpoints": [
+//	            {
+//	                "name": "MYBASE",
+//	                "source_password": "${MYBASE_PASSWORD}",
+//	                "users": [
+//	                    {"name": "rover", "password": "letmein"}
+//	                ]
+//	            }
+//	        ]
+//	    }
+//	}
+//
+// The old config, with the listen address and the mountpoints at the top
+// level, is still accepted.
+//
+// If a mountpoint has no users, anybody can use it.  A rover can ask for a
+// subset of the message types, for example "/MYBASE?types=1005,1077".  See
+// the caster package for the details.
+//
+// A mountpoint can be limited to rovers on particular networks with "allow"
+// and "deny" lists of address ranges in CIDR form, for example
+// ["192.0.2.0/24"].  A rover that isn't allowed is refused with 403
+// Forbidden.
+//
+// A mountpoint can also be given "aliases", a list of other names under
+// which servers and rovers can use it.  To rename a mountpoint, give it the
+// new name and put the old one in its aliases, so that the base station and
+// any rovers that still use the old name carry on working.  A running
+// caster rereads its config file when it's sent a hangup signal
+// ("kill -HUP") and renames the mountpoints without disconnecting them.
+// Other changes to the config take effect when the caster is restarted.
+//
+// If a rover stalls, the messages that have waited for it for longer than
+// max_age_milliseconds (default 5000) are thrown away, so that it doesn't
+// get a backlog of stale corrections when it recovers.
+//
+// If the section gives a status_snapshot_file, the state of each mountpoint
+// is written to that file in JSON form every status_snapshot_seconds (default
+// 60), including percentiles of the intervals between the epochs from its
+// server.  A wide spread of intervals from a base station whose data is
+// steady points to a network problem between the base and the caster.
+//
+// If the section gives an access_log_file, an entry for each connection is
+// appended to it in the combined log format that web servers use, so that
+// the usual log analysers can read it.  See caster.SetAccessLog.
+//
+// If the section gives an mdns_name, the caster advertises itself under
+// that name on the local network, with its mountpoints and their aliases,
+// so that a rover there can find it without being given its address.  See
+// the mdns package.
+//
+// The program logs connections and problems to the standard error channel.
+// It stops with one of the exit statuses listed in the exitcode package.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/goblimey/go-ntrip/caster"
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/mdns"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// defaultListenAddress is the address that the caster listens on if the
+// config doesn't give one.  2101 is the port registered for NTRIP.
+const defaultListenAddress = ":2101"
+
+// defaultStatusSnapshotInterval is the time between status snapshots if
+// the config doesn't give one.
+const defaultStatusSnapshotInterval = time.Minute
+
+func main() {
+	var configFileName string
+	flag.StringVar(&configFileName, "c", "", "config file")
+	flag.StringVar(&configFileName, "config", "", "config file")
+
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(version.String("ntripcaster"))
+		os.Exit(0)
+	}
+
+	if len(configFileName) == 0 {
+		exitcode.Fatal(exitcode.Config, "missing config file: -c or --config")
+	}
+
+	file, openError := os.Open(configFileName)
+	if openError != nil {
+		exitcode.Fatal(exitcode.Config, openError)
+	}
+	settings, configError := getConfigFromReader(file)
+	file.Close()
+	if configError != nil {
+		exitcode.Fatal(exitcode.Config, configError)
+	}
+
+	logger := log.New(os.Stderr, "ntripcaster ", log.LstdFlags)
+
+	c, casterError := caster.New(&settings.Config, logger)
+	if casterError != nil {
+		exitcode.Fatal(exitcode.Config, casterError)
+	}
+
+	if len(settings.AccessLogFile) > 0 {
+		accessLog, accessLogError := os.OpenFile(settings.AccessLogFile,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if accessLogError != nil {
+			exitcode.Fatal(exitcode.IOError, accessLogError)
+		}
+		c.SetAccessLog(accessLog)
+	}
+
+	if len(settings.StatusSnapshotFile) > 0 {
+		interval := defaultStatusSnapshotInterval
+		if settings.StatusSnapshotSeconds > 0 {
+			interval = time.Duration(settings.StatusSnapshotSeconds) * time.Second
+		}
+		go snapshotStatus(c, settings.StatusSnapshotFile, interval, logger)
+	}
+
+	listener, listenError := net.Listen("tcp", settings.ListenAddress)
+	if listenError != nil {
+		exitcode.Fatal(exitcode.InputUnavailable, listenError)
+	}
+
+	logger.Printf("listening on %s", settings.ListenAddress)
+
+	var advertiser *mdns.Advertiser
+	if len(settings.MDNSName) > 0 {
+		port := listener.Addr().(*net.TCPAddr).Port
+		var advertiseError error
+		advertiser, advertiseError = mdns.NewAdvertiser(advertisedService(settings, port), logger)
+		if advertiseError != nil {
+			exitcode.Fatal(exitcode.Config, advertiseError)
+		}
+		go func() {
+			if runError := advertiser.Run(nil); runError != nil {
+				logger.Printf("cannot advertise on the local network - %v", runError)
+			}
+		}()
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if reloadError := reload(c, configFileName, advertiser, logger); reloadError != nil {
+				logger.Printf("cannot reload %s - %v", configFileName, reloadError)
+			}
+		}
+	}()
+
+	exitcode.Fatal(exitcode.IOError, c.Serve(listener))
+}
+
+// reload rereads the config file and renames the mountpoints whose names
+// have been changed, keeping their servers and clients connected.  If the
+// caster is advertised on the local network, the advertisement is brought
+// up to date.  The advertiser may be nil.
+func reload(c *caster.Caster, fileName string, advertiser *mdns.Advertiser, logger *log.Logger) error {
+	file, openError := os.Open(fileName)
+	if openError != nil {
+		return openError
+	}
+	settings, configError := getConfigFromReader(file)
+	file.Close()
+	if configError != nil {
+		return configError
+	}
+
+	renamed, renameError := c.ApplyRenames(&settings.Config)
+	logger.Printf("reloaded %s - %d mountpoints renamed", fileName, renamed)
+	if renameError != nil {
+		return renameError
+	}
+
+	if advertiser != nil {
+		return advertiser.SetMountpoints(c.Names())
+	}
+
+	return nil
+}
+
+// getConfigFromReader reads the config and returns the ntripcaster
+// section, defaulted and checked.
+func getConfigFromReader(reader io.Reader) (*config.NTRIPCaster, error) {
+	loaded, readError := config.Read(reader)
+	if readError != nil {
+		return nil, readError
+	}
+
+	settings := loaded.NTRIPCaster
+	if len(settings.ListenAddress) == 0 {
+		settings.ListenAddress = defaultListenAddress
+	}
+
+	validateError := settings.Validate()
+	if validateError != nil {
+		return nil, validateError
+	}
+
+	if len(settings.MDNSName) > 0 {
+		_, portString, splitError := net.SplitHostPort(settings.ListenAddress)
+		if splitError != nil {
+			return nil, splitError
+		}
+		port, _ := strconv.Atoi(portString)
+		service := advertisedService(&settings, port)
+		if serviceError := service.Validate(); serviceError != nil {
+			return nil, serviceError
+		}
+	}
+
+	return &settings, nil
+}
+
+// advertisedService returns the description of the caster that's advertised
+// on the local network, giving the port that it listens on and the names
+// and aliases of its mountpoints.
+func advertisedService(settings *config.NTRIPCaster, port int) mdns.Service {
+	service := mdns.Service{Instance: settings.MDNSName, Port: port}
+	for _, mountpoint := range settings.Mountpoints {
+		service.Mountpoints = append(service.Mountpoints, mountpoint.Name)
+		service.Mountpoints = append(service.Mountpoints, mountpoint.Aliases...)
+	}
+	return service
+}
+
+// snapshotStatus writes the caster's stats to the given file at the given
+// intervals.  It runs forever, so it should be run in a goroutine.
+func snapshotStatus(c *caster.Caster, fileName string, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := writeStatusSnapshot(c, fileName)
+		if err != nil {
+			logger.Printf("cannot write status snapshot %s - %v", fileName, err)
+		}
+	}
+}
+
+// writeStatusSnapshot writes the caster's stats to the given file in JSON
+// form.  The file is replaced by renaming a temporary file, so a reader
+// never sees a half-written snapshot.
+func writeStatusSnapshot(c *caster.Caster, fileName string) error {
+	statsJSON, err := json.Marshal(c.Stats())
+	if err != nil {
+		return err
+	}
+
+	temporaryName := fileName + ".tmp"
+	writeError := os.WriteFile(temporaryName, statsJSON, 0644)
+	if writeError != nil {
+		return writeError
+	}
+
+	return os.Rename(temporaryName, fileName)
+}
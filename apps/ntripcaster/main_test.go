@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/caster"
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/mdns"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestGetConfigFromReader checks that the config is read, defaulted and
+// checked.
+func TestGetConfigFromReader(t *testing.T) {
+	const full = `{
+		"ntripcaster": {
+			"listen_address": "127.0.0.1:2102",
+			"status_snapshot_file": "/var/www/caster.json",
+			"status_snapshot_seconds": 30,
+			"access_log_file": "/var/log/ntripcaster/access.log",
+			"mdns_name": "Base in the shed",
+			"mountpoints": [
+				{"name": "MYBASE", "source_password": "secret",
+				 "users": [{"name": "rover", "password": "letmein"}]}
+			]
+		}
+	}`
+	const noAddress = `{"ntripcaster": {"mountpoints": [{"name": "MYBASE", "source_password": "secret"}]}}`
+	const oldFormat = `{"mountpoints": [{"name": "MYBASE", "source_password": "secret"}]}`
+	const yamlConfig = `
+ntripcaster:
+  mountpoints:
+    - name: MYBASE
+      source_password: secret
+`
+
+	defaultAddress := &config.NTRIPCaster{
+		ListenAddress: ":2101",
+		Config: caster.Config{Mountpoints: []caster.Mountpoint{{
+			Name: "MYBASE", SourcePassword: "secret",
+		}}},
+	}
+
+	var testData = []struct {
+		description string
+		json        string
+		want        *config.NTRIPCaster
+		wantError   string
+	}{
+		{"full", full, &config.NTRIPCaster{
+			ListenAddress:         "127.0.0.1:2102",
+			StatusSnapshotFile:    "/var/www/caster.json",
+			StatusSnapshotSeconds: 30,
+			AccessLogFile:         "/var/log/ntripcaster/access.log",
+			MDNSName:              "Base in the shed",
+			Config: caster.Config{Mountpoints: []caster.Mountpoint{{
+				Name: "MYBASE", SourcePassword: "secret",
+				Users: []caster.User{{Name: "rover", Password: "letmein"}},
+			}}},
+		}, ""},
+		{"default address", noAddress, defaultAddress, ""},
+		{"old format", oldFormat, defaultAddress, ""},
+		{"YAML", yamlConfig, defaultAddress, ""},
+		{"no mountpoints", `{}`, nil, "caster - want at least one mountpoint"},
+		{"bad mDNS name",
+			`{"ntripcaster": {"mdns_name": "shed.local", "mountpoints": [{"name": "M", "source_password": "s"}]}}`,
+			nil, `mdns - name "shed.local" contains a dot`},
+		{"junk", `{junk}`, nil, "config - cannot parse the config - invalid character 'j' looking for beginning of object key string"},
+	}
+	for _, td := range testData {
+		got, err := getConfigFromReader(strings.NewReader(td.json))
+		if len(td.wantError) > 0 {
+			if err == nil {
+				t.Errorf("%s: want error %s", td.description, td.wantError)
+			} else if err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestAdvertisedService checks that the caster advertises the names and
+// the aliases of its mountpoints.
+func TestAdvertisedService(t *testing.T) {
+	settings := config.NTRIPCaster{
+		MDNSName: "shed",
+		Config: caster.Config{Mountpoints: []caster.Mountpoint{
+			{Name: "MYBASE", Aliases: []string{"OLDBASE"}},
+			{Name: "OTHER"},
+		}},
+	}
+
+	want := mdns.Service{Instance: "shed", Port: 2101, Mountpoints: []string{"MYBASE", "OLDBASE", "OTHER"}}
+	got := advertisedService(&settings, 2101)
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestExampleConfig checks that the example config is valid.
+func TestExampleConfig(t *testing.T) {
+	file, err := os.Open("ntripcaster.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := getConfigFromReader(file); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestWriteStatusSnapshot checks that the snapshot holds the state of each
+// mountpoint.
+func TestWriteStatusSnapshot(t *testing.T) {
+	c, err := caster.New(&caster.Config{Mountpoints: []caster.Mountpoint{
+		{Name: "MYBASE", SourcePassword: "secret"},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileName := filepath.Join(t.TempDir(), "status.json")
+	if err := writeStatusSnapshot(c, fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, readError := os.ReadFile(fileName)
+	if readError != nil {
+		t.Fatal(readError)
+	}
+	var got map[string]caster.MountpointStats
+	if err := json.Unmarshal(contents, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]caster.MountpointStats{"MYBASE": {}}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestReload checks that reload renames a mountpoint whose name has been
+// changed in the config file and that its server carries on feeding rovers
+// under the new name.
+func TestReload(t *testing.T) {
+	const before = `{"ntripcaster": {"mountpoints": [{"name": "OLDBASE", "source_password": "secret"}]}}`
+	const after = `{"ntripcaster": {"mountpoints": [
+		{"name": "NEWBASE", "aliases": ["OLDBASE"], "source_password": "secret"}
+	]}}`
+
+	fileName := filepath.Join(t.TempDir(), "ntripcaster.json")
+	if err := os.WriteFile(fileName, []byte(before), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings, configError := getConfigFromReader(strings.NewReader(before))
+	if configError != nil {
+		t.Fatal(configError)
+	}
+	c, err := caster.New(&settings.Config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, serverReader := request(t, c, "SOURCE secret /OLDBASE\r\n\r\n")
+	defer server.Close()
+	if line, _ := serverReader.ReadString('\n'); line != caster.ResponseOK {
+		t.Fatalf("server: want %q got %q", caster.ResponseOK, line)
+	}
+	for i := 0; i < 100 && !c.Stats()["OLDBASE"].Live; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := os.WriteFile(fileName, []byte(after), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reload(c, fileName, nil, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Stats()["NEWBASE"].Live {
+		t.Fatal("want NEWBASE to be live")
+	}
+
+	rover, roverReader := request(t, c, "GET /NEWBASE HTTP/1.0\r\n\r\n")
+	defer rover.Close()
+	if line, _ := roverReader.ReadString('\n'); line != caster.ResponseOK {
+		t.Fatalf("rover: want %q got %q", caster.ResponseOK, line)
+	}
+
+	go server.Write(testdata.MessageFrameType1005)
+	got := make([]byte, len(testdata.MessageFrameType1005))
+	if _, err := io.ReadFull(roverReader, got); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(testdata.MessageFrameType1005, got) {
+		t.Error("the rover got the wrong data")
+	}
+}
+
+// request connects to the caster, sends the request and returns the
+// connection and a reader for the response.
+func request(t *testing.T, c *caster.Caster, text string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	clientEnd, casterEnd := net.Pipe()
+	go c.ServeConn(casterEnd)
+	if _, err := clientEnd.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	return clientEnd, bufio.NewReader(clientEnd)
+}
@@ -0,0 +1,340 @@
+// The ntripclient is an NTRIP client, the rover's side of NTRIP.  It fetches
+// the RTCM corrections from a mountpoint on a caster and writes them to the
+// serial line of the rover's GNSS device, or to the standard output channel:
+//
+//	ntripclient -c ntripclient.json
+//
+// The JSON config file is in the format of the config package.  The caster
+// section gives the caster, the mountpoint and the credentials and the
+// ntripclient section gives the serial line.  If the caster is a network
+// caster that makes up a virtual reference station, it needs to know roughly
+// where the rover is, so the caster section can give a position, which is
+// sent to the caster in a GGA sentence every interval_seconds:
+//
+//	{
+//	    "caster": {
+//	        "host": "caster.example.com",
+//	        "port": 2101,
+//	        "mountpoint": "MYBASE",
+//	        "user": "rover",
+//	        "password": "letmein",
+//	        "gga": {
+//	            "latitude": 51.4779,
+//	            "longitude": -0.0015,
+//	            "height": 45.0,
+//	            "interval_seconds": 10
+//	        }
+//	    },
+//	    "ntripclient": {
+//	        "serial_device": "/dev/ttyACM0",
+//	        "serial_speed": 115200,
+//	        "serial_devices": ["/dev/ttyACM1"],
+//	        "serial_retry_milliseconds": 1000
+//	    }
+//	}
+//
+// The old flat format, with "caster": "host:port", is still accepted.
+// If there is no serial_device, the RTCM goes to the standard output channel.
+// Only complete RTCM messages that pass the CRC check are passed on.  If the
+// connection to the caster fails, the program waits for a few seconds and
+// then connects again.
+//
+// The serial device must be present when the program starts.  If it
+// vanishes later, for example because the GNSS device is reset, the
+// corrections are dropped until it comes back, perhaps under one of the
+// names in serial_devices.  The program tries to open the devices again
+// every serial_retry_milliseconds (default one second).
+//
+// The program can also relay the stream from a mountpoint on one caster to a
+// mountpoint on another, for example to republish a private base station's
+// corrections on a public caster.  The ntripclient section gives the second
+// caster in place of the serial line, and the program acts as an NTRIP
+// server there:
+//
+//	"ntripclient": {
+//	    "relay": {
+//	        "host": "public.example.com",
+//	        "port": 2101,
+//	        "mountpoint": "MYBASE_RELAY",
+//	        "password": "secret"
+//	    }
+//	}
+//
+// If the second caster goes down, the messages are dropped until it comes
+// back.  The filter section can give the message types to pass on or to
+// drop, as it does for the rtcmfilter, for example to leave out message type
+// 1230, or the sub-types of the u-blox message type 4072 to drop.  The
+// filter applies whether the messages go to a serial line, to stdout or to
+// another caster:
+//
+//	"filter": {"drop_types": [1230], "drop_sub_types": ["4072.1"]}
+//
+// The ntripclient section can also list fallback casters, in order of
+// priority, for when the caster in the caster section is down.  If the
+// caster in use closes the connection or sends no RTCM messages for 30
+// seconds, the program moves on to the next in the list.  While it's using a
+// fallback, it checks the casters above it every primary_check_seconds
+// (default 60) and goes back to the first of them that accepts the request:
+//
+//	"ntripclient": {
+//	    "serial_device": "/dev/ttyACM0",
+//	    "fallbacks": [
+//	        {"host": "backup.example.com", "mountpoint": "MYBASE", "password": "letmein"}
+//	    ],
+//	    "primary_check_seconds": 60
+//	}
+//
+// On a local network with a caster that advertises itself, such as an
+// ntripcaster with an mdns_name, the caster section can give just the
+// mountpoint and the credentials and the program can find the caster:
+//
+//	"ntripclient": {"serial_device": "/dev/ttyACM0", "discover": true}
+//
+// It uses the first caster to answer that offers the mountpoint.  See the
+// mdns package.
+//
+// After the last caster in the list, the program pauses and starts again at
+// the top.  If the last caster refuses the credentials, the program stops
+// with one of the exit statuses listed in the exitcode package rather than
+// trying again.  That includes the second caster when it's relaying, but
+// only when the program starts.
+//
+// The program logs connections and problems to the standard error channel.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/mdns"
+	"github.com/goblimey/go-ntrip/ntrip"
+	"github.com/goblimey/go-ntrip/serialout"
+	"github.com/goblimey/go-ntrip/typefilter"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// defaultSerialSpeed is the speed of the serial line in bits per second
+// used if the config doesn't give one.
+const defaultSerialSpeed = 115200
+
+// retryDelay is the time to wait before connecting to the caster again.
+const retryDelay = 5 * time.Second
+
+// Config is the config of the program, made from the caster and
+// ntripclient sections of the config file.
+type Config struct {
+	ntrip.Config
+
+	// SerialDevice is the name of the serial line to write to, for example
+	// "/dev/ttyACM0".  If it's empty, the program writes to stdout.
+	SerialDevice string
+
+	// SerialSpeed is the speed of the serial line in bits per second.
+	SerialSpeed int
+
+	// SerialDevices lists other devices to try if SerialDevice can't be
+	// opened.
+	SerialDevices []string
+
+	// SerialRetry is the pause between attempts to open the serial line
+	// after it's been lost.
+	SerialRetry time.Duration
+
+	// Fallbacks lists the casters to fetch from, in order of priority, when
+	// the first is down.
+	Fallbacks []ntrip.Config
+
+	// PrimaryCheck is the time between checks of the casters with a higher
+	// priority than the one in use.
+	PrimaryCheck time.Duration
+
+	// Discover says that the caster is to be found on the local network.
+	Discover bool
+
+	// Relay, if it's not nil, gives the mountpoint to which the messages
+	// are relayed, instead of writing them to the serial line or stdout.
+	Relay *ntrip.SourceConfig
+
+	// ForwardTypes, DropTypes and DropSubTypes choose the message types
+	// that are passed on.  See the typefilter package.
+	ForwardTypes []int
+	DropTypes    []int
+	DropSubTypes []string
+}
+
+func main() {
+	var configFileName string
+	flag.StringVar(&configFileName, "c", "", "JSON config file")
+	flag.StringVar(&configFileName, "config", "", "JSON config file")
+
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(version.String("ntripclient"))
+		os.Exit(0)
+	}
+
+	if len(configFileName) == 0 {
+		exitcode.Fatal(exitcode.Config, "missing config file: -c or --config")
+	}
+
+	file, openError := os.Open(configFileName)
+	if openError != nil {
+		exitcode.Fatal(exitcode.Config, openError)
+	}
+	config, configError := getConfigFromReader(file)
+	file.Close()
+	if configError != nil {
+		exitcode.Fatal(exitcode.Config, configError)
+	}
+
+	logger := log.New(os.Stderr, "ntripclient ", log.LstdFlags)
+
+	if config.Discover {
+		entry, findError := mdns.Find(config.Mountpoint, mdns.DefaultBrowseTime)
+		if findError != nil {
+			exitcode.Fatal(exitcode.InputUnavailable, findError)
+		}
+		logger.Printf("found caster %q at %s", entry.Instance, entry.Address())
+		config.Caster = entry.Address()
+	}
+
+	var writer io.Writer = os.Stdout
+	switch {
+	case config.Relay != nil:
+		source, sourceError := ntrip.NewSource(*config.Relay, logger)
+		if sourceError != nil {
+			exitcode.Fatal(exitcode.Config, sourceError)
+		}
+		// Insist that the caster accepts the login at the start.  After
+		// that, the source connects again if it loses the caster.
+		if connectError := source.Connect(); connectError != nil {
+			exitcode.FatalError(connectError)
+		}
+		writer = source
+	case len(config.SerialDevice) > 0:
+		devices := append([]string{config.SerialDevice}, config.SerialDevices...)
+		mode := serial.Mode{BaudRate: config.SerialSpeed}
+		serialWriter := serialout.New(devices, &mode, config.SerialRetry, logger)
+		// Insist on a device at the start.  After that, the writer finds
+		// it again if it vanishes.
+		if portError := serialWriter.Open(); portError != nil {
+			exitcode.Fatal(exitcode.InputUnavailable, portError)
+		}
+		writer = serialWriter
+	}
+
+	casters := append([]ntrip.Config{config.Config}, config.Fallbacks...)
+	client, clientError := ntrip.NewFailover(casters, config.PrimaryCheck, logger)
+	if clientError != nil {
+		exitcode.Fatal(exitcode.Config, clientError)
+	}
+	// The types were checked with the config.
+	if filter, _ := config.typeFilter(); filter != nil {
+		client.SetTypeFilter(filter)
+	}
+
+	for {
+		runError := client.Run(writer)
+		switch exitcode.Code(runError) {
+		case exitcode.AuthFailure, exitcode.IOError:
+			exitcode.FatalError(runError)
+		}
+		logger.Printf("%v - reconnecting in %v", runError, retryDelay)
+		time.Sleep(retryDelay)
+	}
+}
+
+// getConfigFromReader reads and checks the JSON config.
+func getConfigFromReader(reader io.Reader) (*Config, error) {
+	file, readError := config.Read(reader)
+	if readError != nil {
+		return nil, readError
+	}
+
+	config := Config{
+		Config:        file.Caster.ClientConfig(),
+		SerialDevice:  file.NTRIPClient.SerialDevice,
+		SerialSpeed:   file.NTRIPClient.SerialSpeed,
+		SerialDevices: file.NTRIPClient.SerialDevices,
+		SerialRetry:   file.NTRIPClient.SerialRetry(),
+		PrimaryCheck:  file.NTRIPClient.PrimaryCheck(),
+		Discover:      file.NTRIPClient.Discover,
+		ForwardTypes:  file.Filter.ForwardTypes,
+		DropTypes:     file.Filter.DropTypes,
+		DropSubTypes:  file.Filter.DropSubTypes,
+	}
+	for i := range file.NTRIPClient.Fallbacks {
+		config.Fallbacks = append(config.Fallbacks, file.NTRIPClient.Fallbacks[i].ClientConfig())
+	}
+	if file.NTRIPClient.Relay != nil {
+		relay := file.NTRIPClient.Relay.SourceConfig()
+		config.Relay = &relay
+	}
+
+	if config.SerialSpeed == 0 {
+		config.SerialSpeed = defaultSerialSpeed
+	}
+
+	// If the caster is to be discovered, it's not known yet, so check the
+	// rest of the config with a stand-in.
+	toCheck := config.Config
+	if config.Discover {
+		if len(toCheck.Caster) > 0 {
+			return nil, errors.New("give a caster host or discover, not both")
+		}
+		toCheck.Caster = "discovered"
+	}
+	validateError := toCheck.Validate()
+	if validateError != nil {
+		return nil, validateError
+	}
+	for i := range config.Fallbacks {
+		if fallbackError := config.Fallbacks[i].Validate(); fallbackError != nil {
+			return nil, fallbackError
+		}
+	}
+
+	if config.Relay != nil {
+		if len(config.SerialDevice) > 0 {
+			return nil, errors.New("give a serial device or a relay, not both")
+		}
+		if relayError := config.Relay.Validate(); relayError != nil {
+			return nil, relayError
+		}
+	}
+
+	if _, filterError := config.typeFilter(); filterError != nil {
+		return nil, filterError
+	}
+
+	return &config, nil
+}
+
+// typeFilter returns the filter that chooses the message types to pass on,
+// or nil if all types are passed on.
+func (config *Config) typeFilter() (*typefilter.Filter, error) {
+	if len(config.ForwardTypes) == 0 && len(config.DropTypes) == 0 && len(config.DropSubTypes) == 0 {
+		return nil, nil
+	}
+	filter, filterError := typefilter.New(config.ForwardTypes, config.DropTypes)
+	if filterError != nil {
+		return nil, filterError
+	}
+	if subTypeError := filter.DropSubTypes(config.DropSubTypes); subTypeError != nil {
+		return nil, subTypeError
+	}
+	return filter, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/ntrip"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestGetConfigFromReader checks that the config is read, defaulted and
+// checked.
+func TestGetConfigFromReader(t *testing.T) {
+	const full = `{
+		"caster": "caster.example.com:2101",
+		"mountpoint": "MYBASE",
+		"user": "rover",
+		"password": "letmein",
+		"gga": {"latitude": 51.5, "longitude": -0.25, "height": 45, "interval_seconds": 5},
+		"serial_device": "/dev/ttyACM0",
+		"serial_speed": 9600
+	}`
+	const minimal = `{"caster": "caster.example.com:2101", "mountpoint": "MYBASE"}`
+	const sectioned = `{
+		"caster": {"host": "caster.example.com", "mountpoint": "MYBASE", "password": "letmein"},
+		"ntripclient": {
+			"serial_device": "/dev/ttyUSB0",
+			"serial_devices": ["/dev/ttyUSB1"],
+			"serial_retry_milliseconds": 500
+		}
+	}`
+	const relay = `{
+		"caster": {"host": "private.example.com", "mountpoint": "MYBASE", "user": "relay", "password": "letmein"},
+		"filter": {"drop_types": [1230], "drop_sub_types": ["4072.1"]},
+		"ntripclient": {
+			"relay": {"host": "public.example.com", "port": 2102, "mountpoint": "MYBASE_RELAY", "password": "secret"}
+		}
+	}`
+
+	const fallbacks = `{
+		"caster": {"host": "primary.example.com", "mountpoint": "MYBASE"},
+		"ntripclient": {
+			"fallbacks": [
+				{"host": "backup.example.com", "mountpoint": "MYBASE", "password": "letmein"},
+				{"host": "last.example.com", "port": 2102, "mountpoint": "OTHER"}
+			],
+			"primary_check_seconds": 30
+		}
+	}`
+
+	const discover = `{
+		"caster": {"mountpoint": "MYBASE", "user": "rover", "password": "letmein"},
+		"ntripclient": {"discover": true}
+	}`
+
+	var testData = []struct {
+		description string
+		json        string
+		want        *Config
+		wantError   string
+	}{
+		{"full", full, &Config{
+			Config: ntrip.Config{
+				Caster: "caster.example.com:2101", Mountpoint: "MYBASE",
+				User: "rover", Password: "letmein",
+				GGA: &ntrip.GGAConfig{Latitude: 51.5, Longitude: -0.25, Height: 45, IntervalSeconds: 5},
+			},
+			SerialDevice: "/dev/ttyACM0",
+			SerialSpeed:  9600,
+		}, ""},
+		{"defaults", minimal, &Config{
+			Config:      ntrip.Config{Caster: "caster.example.com:2101", Mountpoint: "MYBASE"},
+			SerialSpeed: 115200,
+		}, ""},
+		{"sectioned", sectioned, &Config{
+			Config: ntrip.Config{
+				Caster: "caster.example.com:2101", Mountpoint: "MYBASE", Password: "letmein",
+			},
+			SerialDevice:  "/dev/ttyUSB0",
+			SerialSpeed:   115200,
+			SerialDevices: []string{"/dev/ttyUSB1"},
+			SerialRetry:   500 * time.Millisecond,
+		}, ""},
+		{"relay", relay, &Config{
+			Config: ntrip.Config{
+				Caster: "private.example.com:2101", Mountpoint: "MYBASE", User: "relay", Password: "letmein",
+			},
+			SerialSpeed: 115200,
+			Relay: &ntrip.SourceConfig{
+				Caster: "public.example.com:2102", Mountpoint: "MYBASE_RELAY", Password: "secret",
+			},
+			DropTypes:    []int{1230},
+			DropSubTypes: []string{"4072.1"},
+		}, ""},
+		{"fallbacks", fallbacks, &Config{
+			Config:      ntrip.Config{Caster: "primary.example.com:2101", Mountpoint: "MYBASE"},
+			SerialSpeed: 115200,
+			Fallbacks: []ntrip.Config{
+				{Caster: "backup.example.com:2101", Mountpoint: "MYBASE", Password: "letmein"},
+				{Caster: "last.example.com:2102", Mountpoint: "OTHER"},
+			},
+			PrimaryCheck: 30 * time.Second,
+		}, ""},
+		{"discover", discover, &Config{
+			Config:      ntrip.Config{Mountpoint: "MYBASE", User: "rover", Password: "letmein"},
+			SerialSpeed: 115200,
+			Discover:    true,
+		}, ""},
+		{"discover with a host",
+			`{"caster": {"host": "a", "mountpoint": "M"}, "ntripclient": {"discover": true}}`,
+			nil, "give a caster host or discover, not both"},
+		{"discover with no mountpoint",
+			`{"ntripclient": {"discover": true}}`,
+			nil, "ntrip - want a mountpoint"},
+		{"fallback with no host",
+			`{"caster": {"host": "a", "mountpoint": "M"}, "ntripclient": {"fallbacks": [{"mountpoint": "M"}]}}`,
+			nil, "ntrip - want a caster"},
+		{"relay and serial device",
+			`{"caster": {"host": "a", "mountpoint": "M"}, "ntripclient": {"serial_device": "/dev/ttyACM0", "relay": {"host": "b", "mountpoint": "N"}}}`,
+			nil, "give a serial device or a relay, not both"},
+		{"relay with no mountpoint",
+			`{"caster": {"host": "a", "mountpoint": "M"}, "ntripclient": {"relay": {"host": "b"}}}`,
+			nil, "ntrip - want a mountpoint to send to"},
+		{"bad type",
+			`{"caster": {"host": "a", "mountpoint": "M"}, "filter": {"forward_types": [5000]}}`,
+			nil, "typefilter - illegal message type 5000"},
+		{"bad sub-type",
+			`{"caster": {"host": "a", "mountpoint": "M"}, "filter": {"drop_sub_types": ["4072"]}}`,
+			nil, `typefilter - "4072" - want a message type and a sub-type, for example 4072.1`},
+		{"no caster", `{"mountpoint": "MYBASE"}`, nil, "ntrip - want a caster"},
+		{"no caster host", `{"caster": {"mountpoint": "MYBASE"}}`, nil, "ntrip - want a caster"},
+		{"junk", `junk`, nil, "config - cannot parse the YAML at line 1 - want a mapping of names to values"},
+	}
+	for _, td := range testData {
+		got, err := getConfigFromReader(strings.NewReader(td.json))
+		if len(td.wantError) > 0 {
+			if err == nil {
+				t.Errorf("%s: want error %s", td.description, td.wantError)
+			} else if err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestExampleConfig checks that the example config is valid.
+func TestExampleConfig(t *testing.T) {
+	file, err := os.Open("ntripclient.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := getConfigFromReader(file); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/serialin"
+)
+
+// dryRun checks the settings without pushing anything, to catch mistakes
+// before the program is left running somewhere awkward to reach.  It looks
+// at the input using the given function, then connects and logs in to the
+// caster, which checks the address, the mountpoint and the credentials, and
+// disconnects straight away.  It writes a report of what would happen to the
+// writer.
+func dryRun(input func() (string, error), connect func() (net.Conn, error), acct *account, timeout time.Duration, report io.Writer) error {
+	description, inputError := input()
+	if inputError != nil {
+		return inputError
+	}
+	fmt.Fprintf(report, "input: %s\n", description)
+
+	conn, loginError := connectAndLogin(connect, acct, timeout)
+	if loginError != nil {
+		return loginError
+	}
+
+	// A version 2 connection is wrapped to send chunks.  Closing it sends
+	// the end of the (empty) chunked data.
+	loggedInWith := version1
+	if _, ok := conn.(*chunkedConn); ok {
+		loggedInWith = version2
+	}
+	conn.Close()
+
+	fmt.Fprintf(report, "caster: logged in to %s mountpoint %s using NTRIP version %s\n",
+		acct.caster, acct.mountpoint, loggedInWith)
+	fmt.Fprintln(report, "dry run - would push the RTCM messages from the input to the caster, nothing sent")
+
+	return nil
+}
+
+// fileInput returns a function for dryRun that describes the input file.
+func fileInput(input *os.File) func() (string, error) {
+	return func() (string, error) {
+		info, statError := input.Stat()
+		if statError != nil {
+			return "", exitcode.Wrap(exitcode.InputUnavailable, statError)
+		}
+		return fmt.Sprintf("%s (%s)", input.Name(), describeFile(info.Mode())), nil
+	}
+}
+
+// serialInput returns a function for dryRun that opens the serial line,
+// says which device it found and closes it again.
+func serialInput(reader *serialin.Reader) func() (string, error) {
+	return func() (string, error) {
+		openError := reader.Open()
+		if openError != nil {
+			return "", exitcode.Wrap(exitcode.InputUnavailable, openError)
+		}
+		device := reader.Device()
+		reader.Close()
+		return fmt.Sprintf("%s (serial device)", device), nil
+	}
+}
+
+// describeFile says what sort of file the mode describes.
+func describeFile(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "pipe"
+	case mode&os.ModeCharDevice != 0:
+		return "device or terminal"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode.IsRegular():
+		return "file"
+	default:
+		return "unknown"
+	}
+}
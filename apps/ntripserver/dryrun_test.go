@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/ntriptest"
+)
+
+// TestDryRun checks that a dry run logs in to the caster, sends no data and
+// reports what it would do.
+func TestDryRun(t *testing.T) {
+	caster := ntriptest.NewCaster("secret")
+	defer caster.Close()
+
+	input, createError := os.CreateTemp(t.TempDir(), "input")
+	if createError != nil {
+		t.Fatal(createError)
+	}
+	defer input.Close()
+
+	acct := account{caster: "caster.example.com:2101", mountpoint: "MYBASE", password: "secret", version: version1}
+
+	var report bytes.Buffer
+	err := dryRun(fileInput(input), caster.Dial, &acct, defaultWriteTimeout, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines := []string{
+		"input: " + input.Name() + " (file)",
+		"caster: logged in to caster.example.com:2101 mountpoint MYBASE using NTRIP version 1",
+		"dry run - would push the RTCM messages from the input to the caster, nothing sent",
+	}
+	want := strings.Join(wantLines, "\n") + "\n"
+	if report.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, report.String())
+	}
+
+	if received := caster.Received("MYBASE"); len(received) != 0 {
+		t.Errorf("want nothing sent, got %d bytes", len(received))
+	}
+}
+
+// TestDryRunWithBadPassword checks that a dry run returns the login error
+// with the exit status for refused credentials.
+func TestDryRunWithBadPassword(t *testing.T) {
+	const wantError = "caster refused the connection - ERROR - Bad Password"
+
+	caster := ntriptest.NewCaster("secret")
+	defer caster.Close()
+
+	acct := account{mountpoint: "MYBASE", password: "wrong", version: version1}
+
+	var report bytes.Buffer
+	err := dryRun(fileInput(os.Stdin), caster.Dial, &acct, defaultWriteTimeout, &report)
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if err.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, err.Error())
+	}
+	if exitcode.Code(err) != exitcode.AuthFailure {
+		t.Errorf("want exit status %d got %d", exitcode.AuthFailure, exitcode.Code(err))
+	}
+}
+
+// TestDescribeFile checks the descriptions of the input.
+func TestDescribeFile(t *testing.T) {
+	var testData = []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0644, "file"},
+		{os.ModeNamedPipe | 0600, "pipe"},
+		{os.ModeDevice | os.ModeCharDevice | 0620, "device or terminal"},
+		{os.ModeSocket, "socket"},
+		{os.ModeDir | 0755, "unknown"},
+	}
+	for _, td := range testData {
+		if got := describeFile(td.mode); got != td.want {
+			t.Errorf("%v: want %s got %s", td.mode, td.want, got)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+// The ntripserver reads RTCM3 data from standard input and pushes the RTCM
+// messages to an NTRIP caster, making the base station available to rovers
+// on the internet:
+//
+//	serial_usb_grabber -c grabber.json | rtcmfilter -c filter.json | \
+//	    ntripserver -caster caster.example.com:2101 \
+//	        -mountpoint MYBASE -password secret
+//
+// By default it uses NTRIP version 1, which most casters accept from a
+// server.  The server sends a SOURCE request carrying the password and the
+// mountpoint and the caster replies "ICY 200 OK".  After that the server
+// just sends RTCM data.  Non-RTCM data is dropped.
+//
+// Some casters insist on NTRIP version 2, which is HTTP/1.1 with a POST
+// request, basic authentication and chunked data.  -ntrip-version 2 uses
+// that, with the user name given by -user.  -ntrip-version auto tries
+// version 2 and falls back to version 1 if the caster doesn't understand
+// it.  See transport.go.
+//
+// If the GNSS device goes quiet for a few minutes, a NAT router between the
+// server and the caster may decide that the idle connection is dead and drop
+// it.  To stop that, the program turns on TCP keepalive, sending a probe after
+// the connection has been idle for the time given by -keepalive (30 seconds by
+// default).  A negative value turns keepalive off.
+//
+// Keepalive doesn't help if the caster crashes while data is flowing.  The
+// connection is left half open, the data piles up in the send buffer and the
+// kernel may take many minutes to give up.  To notice that sooner, each write
+// to the caster has a deadline given by -write-timeout (30 seconds by
+// default).  If a write doesn't complete in time, or fails for any other
+// reason, the program drops the connection, connects and logs in again and
+// resends the message.  If that fails, it gives up.  Zero turns the deadline
+// off.
+//
+// A slow or unreliable link, such as one carried over the mains wiring, can
+// be checked with -probe, which gives the time to spend sending test data:
+//
+//	ntripserver -caster caster.example.com:2101 \
+//	    -mountpoint SPEEDTEST -password secret -probe 10s
+//
+// The program logs in to the mountpoint and sends type 1029 text messages
+// as fast as it can, then logs the connection and login round trip times
+// and the throughput and stops.  It doesn't read its input.  Rovers
+// connected to the mountpoint receive the test messages, so use a temporary
+// mountpoint.  The base station's data needs a few kilobits per second.
+//
+// Before leaving the program running on a base station that's hard to get
+// at, the settings can be checked with -dry-run:
+//
+//	ntripserver -caster caster.example.com:2101 \
+//	    -mountpoint MYBASE -password secret -dry-run
+//
+// The program looks at its input, logs in to the caster to check the
+// mountpoint and the credentials, disconnects and says what it would do.
+// It doesn't send any data.  See dryrun.go.
+//
+// The running figures - the messages of each type, the CRC failures, the
+// bytes in and out, the reconnections to the caster and the messages waiting
+// to be sent - can be served to Prometheus with -metrics, which gives the
+// address to listen on:
+//
+//	ntripserver -caster caster.example.com:2101 \
+//	    -mountpoint MYBASE -password secret -metrics :9100
+//
+// The figures are at /metrics.  See the metrics package.
+//
+// Under systemd or Kubernetes the program can serve health checks with
+// -health, which gives the address to listen on:
+//
+//	ntripserver -c server.json -health :8081
+//
+// /livez answers as long as the program is running.  /healthz gives the
+// time since the last valid message and whether the device and the caster
+// are connected as JSON, with the status 503 if no message has arrived for
+// 30 seconds or either connection is down, so that the supervisor can
+// restart the program.  When the input is the standard input, the device
+// is taken to be connected while the messages are arriving.  See the health
+// package.
+//
+// Instead of the flags, the settings can come from a config file in the
+// format of the config package, JSON or YAML, the same file that the other
+// programs use:
+//
+//	ntripserver -c ntripserver.json
+//
+// The caster section gives the caster, the mountpoint and the credentials.
+// Any of the -caster, -mountpoint, -user and -password flags that are given
+// override the file.  If the input section lists serial devices, the
+// program reads the GNSS device itself rather than taking its input from
+// serial_usb_grabber and rtcmfilter through pipes, so one process and one
+// config file run the whole base station:
+//
+//	{
+//	    "input": {
+//	        "devices": ["/dev/ttyACM0", "/dev/ttyACM1"],
+//	        "serial": {"speed": 115200},
+//	        "read_timeout_milliseconds": 5000,
+//	        "sleep_time_after_failed_open_milliseconds": 1000,
+//	        "wait_time_on_eof_milliseconds": 100
+//	    },
+//	    "caster": {
+//	        "host": "caster.example.com",
+//	        "mountpoint": "MYBASE",
+//	        "password": "secret"
+//	    }
+//	}
+//
+// A device must be present at the start.  If it vanishes later, or goes
+// quiet for longer than the read timeout, the program opens the first of
+// the devices that it can find again, as serial_usb_grabber does.  The
+// input section's validation policy and frame limits are applied to the
+// incoming data.  See the serialin package.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/health"
+	"github.com/goblimey/go-ntrip/metrics"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/serialin"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// sourceAgent identifies this program to the caster.
+const sourceAgent = "NTRIP go-ntrip-ntripserver"
+
+// defaultKeepalive is the default idle time before a TCP keepalive probe.
+const defaultKeepalive = 30 * time.Second
+
+// dialTimeout is the time allowed to connect to the caster.
+const dialTimeout = 10 * time.Second
+
+// defaultWriteTimeout is the default time allowed for a write to the caster.
+const defaultWriteTimeout = 30 * time.Second
+
+// deviceWatchInterval is the time between checks that the serial device is
+// connected, for the health checks.
+const deviceWatchInterval = time.Second
+
+// messageBuffer is the number of messages that can wait to be sent while the
+// uploader is busy, for example while it's connecting again.
+const messageBuffer = 256
+
+func main() {
+	var caster string
+	var mountpoint string
+	var user string
+	var password string
+	var ntripVersion string
+	var keepalive time.Duration
+	var writeTimeout time.Duration
+	var probeDuration time.Duration
+	var dryRunOnly bool
+	var metricsAddress string
+	var healthAddress string
+	var configFileName string
+	var showVersion bool
+	flag.StringVar(&caster, "caster", "", "caster host:port")
+	flag.StringVar(&mountpoint, "mountpoint", "", "mountpoint")
+	flag.StringVar(&user, "user", "", "user name - NTRIP version 2 only")
+	flag.StringVar(&password, "password", "", "password")
+	flag.StringVar(&ntripVersion, "ntrip-version", version1,
+		"NTRIP version - 1, 2 or auto to try 2 and fall back to 1")
+	flag.DurationVar(&keepalive, "keepalive", defaultKeepalive,
+		"idle time before a TCP keepalive probe - negative turns keepalive off")
+	flag.DurationVar(&writeTimeout, "write-timeout", defaultWriteTimeout,
+		"time allowed for a write to the caster before reconnecting - zero waits forever")
+	flag.DurationVar(&probeDuration, "probe", 0,
+		"measure the link to the caster by sending test data for this long, then stop")
+	flag.BoolVar(&dryRunOnly, "dry-run", false,
+		"check the input and log in to the caster, then stop without sending anything")
+	flag.StringVar(&metricsAddress, "metrics", "",
+		"serve the running figures to Prometheus on this host:port")
+	flag.StringVar(&healthAddress, "health", "",
+		"serve health checks at /healthz and /livez on this host:port")
+	flag.StringVar(&configFileName, "c", "", "config file")
+	flag.StringVar(&configFileName, "config", "", "config file")
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(version.String("ntripserver"))
+		os.Exit(0)
+	}
+
+	// The config file, if there is one, gives the settings that the flags
+	// don't.
+	var input *config.Input
+	if len(configFileName) > 0 {
+		cfg, configError := config.Load(configFileName)
+		if configError != nil {
+			exitcode.Fatal(exitcode.Config, configError)
+		}
+		caster = firstNonEmpty(caster, cfg.Caster.Address())
+		mountpoint = firstNonEmpty(mountpoint, cfg.Caster.Mountpoint)
+		user = firstNonEmpty(user, cfg.Caster.User)
+		password = firstNonEmpty(password, cfg.Caster.Password)
+		input = &cfg.Input
+	}
+
+	if len(caster) == 0 || len(mountpoint) == 0 {
+		exitcode.Fatal(exitcode.Config, "-caster and -mountpoint are mandatory")
+	}
+
+	if versionError := checkVersion(ntripVersion); versionError != nil {
+		exitcode.Fatal(exitcode.Config, versionError)
+	}
+
+	acct := account{
+		caster:     caster,
+		mountpoint: mountpoint,
+		user:       user,
+		password:   password,
+		version:    ntripVersion,
+	}
+
+	var registry *metrics.Registry
+	if len(metricsAddress) > 0 {
+		r, metricsError := metrics.New(metrics.Config{ListenAddress: metricsAddress}, log.Default())
+		if metricsError != nil {
+			exitcode.Fatal(exitcode.Config, metricsError)
+		}
+		registry = r
+	}
+
+	var checker *health.Checker
+	if len(healthAddress) > 0 {
+		c, healthError := health.New(health.Config{ListenAddress: healthAddress}, log.Default())
+		if healthError != nil {
+			exitcode.Fatal(exitcode.Config, healthError)
+		}
+		checker = c
+	}
+
+	// Read the serial line if the config lists devices, otherwise the
+	// standard input.
+	var reader io.Reader = os.Stdin
+	describeInput := fileInput(os.Stdin)
+	if input != nil && len(input.Devices) > 0 {
+		serialReader, serialError := serialin.New(input, log.Default())
+		if serialError != nil {
+			exitcode.Fatal(exitcode.Config, serialError)
+		}
+		reader = serialReader
+		describeInput = serialInput(serialReader)
+	}
+
+	connect := func() (net.Conn, error) { return dial(caster, keepalive) }
+
+	if dryRunOnly {
+		dryRunError := dryRun(describeInput, connect, &acct, writeTimeout, os.Stdout)
+		if dryRunError != nil {
+			exitcode.FatalError(dryRunError)
+		}
+		return
+	}
+
+	if probeDuration > 0 {
+		result, probeError := probe(connect, &acct, probeDuration)
+		if probeError != nil {
+			exitcode.FatalError(probeError)
+		}
+		log.Print(result)
+		return
+	}
+
+	if registry != nil {
+		listenError := registry.Listen()
+		if listenError != nil {
+			exitcode.Fatal(exitcode.Config, listenError)
+		}
+		go registry.Run(nil)
+	}
+
+	if checker != nil {
+		listenError := checker.Listen()
+		if listenError != nil {
+			exitcode.Fatal(exitcode.Config, listenError)
+		}
+		go checker.Run(nil)
+		if serialReader, ok := reader.(*serialin.Reader); ok {
+			go watchDevice(serialReader, checker, deviceWatchInterval, nil)
+		}
+	}
+
+	// Like serial_usb_grabber, insist on a device at the start.
+	if serialReader, ok := reader.(*serialin.Reader); ok {
+		if openError := serialReader.Open(); openError != nil {
+			exitcode.Fatal(exitcode.InputUnavailable, openError)
+		}
+	}
+
+	up := newUploader(connect, &acct, writeTimeout)
+	up.metrics = registry
+	up.health = checker
+	defer up.close()
+
+	pushError := push(reader, up, time.Now(), input)
+	if pushError != nil {
+		exitcode.FatalError(pushError)
+	}
+}
+
+// dial connects to the caster with the given TCP keepalive period.  Zero
+// gives the system default and a negative value turns keepalive off.
+func dial(caster string, keepalive time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout, KeepAlive: keepalive}
+	return dialer.Dial("tcp", caster)
+}
+
+// uploader sends data to the caster, connecting again if a write stalls or
+// fails.
+type uploader struct {
+	// connect makes a new connection to the caster.
+	connect func() (net.Conn, error)
+
+	// account holds the details needed to log in.
+	account *account
+
+	// writeTimeout is the time allowed for each write.  Zero means no limit.
+	writeTimeout time.Duration
+
+	// conn is the current connection, nil if there isn't one.
+	conn net.Conn
+
+	// metrics counts the messages, the bytes and the reconnections.  It's
+	// nil unless the figures are wanted.
+	metrics *metrics.Registry
+
+	// health is told about the messages and the connection to the caster.
+	// It's nil unless the health checks are wanted.
+	health *health.Checker
+}
+
+// newUploader creates an uploader.  It doesn't connect until it's used.
+func newUploader(connect func() (net.Conn, error), acct *account, writeTimeout time.Duration) *uploader {
+	return &uploader{
+		connect:      connect,
+		account:      acct,
+		writeTimeout: writeTimeout,
+	}
+}
+
+// open connects to the caster and logs in, if there is no connection.
+func (up *uploader) open() error {
+	if up.conn != nil {
+		return nil
+	}
+
+	// The login is bound by the write timeout too, so that a caster that
+	// accepts the connection but never answers is noticed.
+	conn, loginError := connectAndLogin(up.connect, up.account, up.writeTimeout)
+	if loginError != nil {
+		return loginError
+	}
+
+	up.conn = conn
+	if up.health != nil {
+		up.health.SetCasterConnected(true)
+	}
+	return nil
+}
+
+// close drops the connection, if there is one.
+func (up *uploader) close() {
+	if up.conn != nil {
+		up.conn.Close()
+		up.conn = nil
+		if up.health != nil {
+			up.health.SetCasterConnected(false)
+		}
+	}
+}
+
+// send writes the data to the caster.  If the write fails or doesn't
+// complete within the write timeout, it drops the connection, connects
+// again and resends the data once.
+func (up *uploader) send(data []byte) error {
+	writeError := up.write(data)
+	if writeError == nil {
+		return nil
+	}
+
+	log.Printf("write to caster failed - %v - reconnecting", writeError)
+	up.close()
+	if up.metrics != nil {
+		up.metrics.CountCasterReconnect()
+	}
+
+	return up.write(data)
+}
+
+// write connects if necessary and writes the data, within the write timeout.
+func (up *uploader) write(data []byte) error {
+	openError := up.open()
+	if openError != nil {
+		return openError
+	}
+
+	if up.writeTimeout > 0 {
+		up.conn.SetWriteDeadline(time.Now().Add(up.writeTimeout))
+	}
+	n, writeError := up.conn.Write(data)
+	if up.metrics != nil {
+		up.metrics.AddBytesOut(n)
+	}
+	return writeError
+}
+
+// push connects and logs in to the caster, then reads RTCM data from the
+// reader until end of file and sends the RTCM messages to the caster.  If the
+// input config is not nil, its validation policy and frame limits are
+// applied to the data.
+func push(reader io.Reader, up *uploader, startTime time.Time, input *config.Input) error {
+
+	openError := up.open()
+	if openError != nil {
+		return openError
+	}
+
+	scanner := rtcm.NewScannerAt(reader, startTime)
+	messageChan := make(chan rtcm.Message, messageBuffer)
+
+	handler := scanner.Handler()
+	if input != nil {
+		if input.ValidationPolicy != nil {
+			handler.SetValidationPolicy(input.ValidationPolicy)
+		}
+		handler.SetFrameLimits(input.FrameLimits())
+	}
+	if up.metrics != nil {
+		up.metrics.WatchHandler(handler)
+		up.metrics.WatchBacklog("caster", func() int { return len(messageChan) })
+	}
+
+	// Decode in a goroutine, so that the input isn't held up while a
+	// message is being sent.
+	go func() {
+		defer close(messageChan)
+		for {
+			message, scanError := scanner.Next()
+			if scanError != nil {
+				return
+			}
+			messageChan <- *message
+		}
+	}()
+
+	var writeError error
+	for message := range messageChan {
+		if up.metrics != nil {
+			up.metrics.Count(&message)
+		}
+		if up.health != nil {
+			up.health.Observe(&message)
+		}
+		if message.MessageType == utils.NonRTCMMessage || writeError != nil {
+			// Drain the channel so that the handler can finish.
+			continue
+		}
+		writeError = up.send(message.RawData)
+	}
+
+	return writeError
+}
+
+// watchDevice tells the health checker at the given interval whether the
+// serial device is connected.  It runs until the stop channel is closed.  If
+// the channel is nil, it runs forever.  It can be run in a goroutine.
+func watchDevice(reader *serialin.Reader, checker *health.Checker, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checker.SetDeviceConnected(len(reader.Device()) > 0)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// login sends an NTRIP version 1 SOURCE request and checks the response.
+func login(conn io.ReadWriter, mountpoint, password string) error {
+	request := fmt.Sprintf("SOURCE %s /%s\r\nSource-Agent: %s\r\n\r\n",
+		password, strings.TrimPrefix(mountpoint, "/"), sourceAgent)
+	_, writeError := conn.Write([]byte(request))
+	if writeError != nil {
+		return writeError
+	}
+
+	response, readError := bufio.NewReader(conn).ReadString('\n')
+	if readError != nil {
+		return readError
+	}
+
+	response = strings.TrimSpace(response)
+	if response != "ICY 200 OK" {
+		return refusal(response)
+	}
+
+	return nil
+}
+
+// firstNonEmpty returns the first of the strings that's not empty.
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
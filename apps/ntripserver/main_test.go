@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/health"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/ntriptest"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// fakeCaster accepts one connection on the listener, reads the SOURCE
+// request, sends the given response and then collects everything sent to
+// it.  It sends the request and the data on the channels.
+func fakeCaster(listener net.Listener, response string, requests chan<- string, data chan<- []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		close(requests)
+		close(data)
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	request := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		request += line
+		if line == "\r\n" {
+			break
+		}
+	}
+	requests <- request
+
+	conn.Write([]byte(response))
+
+	received, _ := ioutil.ReadAll(reader)
+	data <- received
+}
+
+// dialer returns a function that connects to the listener.
+func dialer(listener net.Listener) func() (net.Conn, error) {
+	return func() (net.Conn, error) {
+		return net.Dial("tcp", listener.Addr().String())
+	}
+}
+
+// pipeCaster serves one end of a pipe as a caster.  It reads the SOURCE
+// request and accepts the login.  If stall is true it then stops reading,
+// as a crashed caster would, otherwise it sends everything it receives on
+// the data channel.
+func pipeCaster(conn net.Conn, stall bool, data chan<- []byte) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || line == "\r\n" {
+			break
+		}
+	}
+	conn.Write([]byte("ICY 200 OK\r\n"))
+
+	if stall {
+		return
+	}
+
+	received, _ := ioutil.ReadAll(reader)
+	data <- received
+}
+
+// TestPush checks that push logs in and sends the RTCM messages.
+func TestPush(t *testing.T) {
+	const wantRequest = "SOURCE secret /MYBASE\r\nSource-Agent: NTRIP go-ntrip-ntripserver\r\n\r\n"
+
+	var input []byte
+	input = append(input, testdata.AllJunk...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	var want []byte
+	want = append(want, testdata.MessageFrameType1005...)
+	want = append(want, testdata.MessageFrameType1077...)
+
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, "ICY 200 OK\r\n", requests, data)
+
+	up := newUploader(dialer(listener), &account{mountpoint: "/MYBASE", password: "secret", version: version1}, time.Second)
+	pushError := push(bytes.NewReader(input), up, time.Now(), nil)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	gotRequest := <-requests
+	if gotRequest != wantRequest {
+		t.Errorf("want request %q got %q", wantRequest, gotRequest)
+	}
+
+	got := <-data
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %d bytes got %d", len(want), len(got))
+	}
+}
+
+// TestPushWithInputConfig checks that push applies the frame limits in the
+// input config - here a maximum message length that rejects the 1077.
+func TestPushWithInputConfig(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, "ICY 200 OK\r\n", requests, data)
+
+	inputConfig := config.Input{MaxMessageLength: 100}
+	up := newUploader(dialer(listener), &account{mountpoint: "/MYBASE", password: "secret", version: version1}, time.Second)
+	pushError := push(bytes.NewReader(input), up, time.Now(), &inputConfig)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	<-requests
+	got := <-data
+	if !bytes.Equal(testdata.MessageFrameType1005, got) {
+		t.Errorf("want the 1005 only, got %d bytes", len(got))
+	}
+}
+
+// TestFirstNonEmpty checks firstNonEmpty.
+func TestFirstNonEmpty(t *testing.T) {
+	if got := firstNonEmpty("", "b", "c"); got != "b" {
+		t.Errorf("want b got %s", got)
+	}
+	if got := firstNonEmpty("", ""); got != "" {
+		t.Errorf("want nothing got %s", got)
+	}
+}
+
+// TestPushWithBadPassword checks that push returns an error when the caster
+// refuses the connection.
+func TestPushWithBadPassword(t *testing.T) {
+	const wantError = "caster refused the connection - ERROR - Bad Password"
+
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, "ERROR - Bad Password\r\n", requests, data)
+
+	up := newUploader(dialer(listener), &account{mountpoint: "MYBASE", password: "wrong", version: version1}, time.Second)
+	defer up.close()
+
+	err := push(strings.NewReader(""), up, time.Now(), nil)
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if err.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, err.Error())
+	}
+}
+
+// TestDial checks that dial connects with keepalive on and off.
+func TestDial(t *testing.T) {
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	for _, keepalive := range []time.Duration{defaultKeepalive, 0, -1} {
+		conn, err := dial(listener.Addr().String(), keepalive)
+		if err != nil {
+			t.Errorf("keepalive %v: %v", keepalive, err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+// TestPushReconnectsWhenStalled checks that push notices a caster that has
+// stopped reading, connects again and resends the message.
+func TestPushReconnectsWhenStalled(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	data := make(chan []byte, 1)
+	connections := 0
+	connect := func() (net.Conn, error) {
+		client, server := net.Pipe()
+		connections++
+		// The first caster stalls after the login.
+		go pipeCaster(server, connections == 1, data)
+		return client, nil
+	}
+
+	up := newUploader(connect, &account{mountpoint: "MYBASE", password: "secret", version: version1}, 100*time.Millisecond)
+	pushError := push(bytes.NewReader(input), up, time.Now(), nil)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	if connections != 2 {
+		t.Errorf("want 2 connections got %d", connections)
+	}
+
+	got := <-data
+	if !bytes.Equal(input, got) {
+		t.Errorf("want %d bytes got %d", len(input), len(got))
+	}
+}
+
+// TestPushMetrics checks that push counts the messages, the bytes sent and
+// the reconnections.
+func TestPushMetrics(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	data := make(chan []byte, 1)
+	connections := 0
+	connect := func() (net.Conn, error) {
+		client, server := net.Pipe()
+		connections++
+		go pipeCaster(server, connections == 1, data)
+		return client, nil
+	}
+
+	registry, metricsError := metrics.New(metrics.Config{ListenAddress: ":9100"}, nil)
+	if metricsError != nil {
+		t.Fatal(metricsError)
+	}
+
+	up := newUploader(connect, &account{mountpoint: "MYBASE", password: "secret", version: version1}, 100*time.Millisecond)
+	up.metrics = registry
+	pushError := push(bytes.NewReader(input), up, time.Now(), nil)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+	<-data
+
+	var buffer bytes.Buffer
+	registry.Write(&buffer)
+	figures := buffer.String()
+
+	wantLines := []string{
+		`ntrip_messages_total{type="1005"} 1`,
+		`ntrip_messages_total{type="1077"} 1`,
+		"ntrip_crc_failures_total 0",
+		fmt.Sprintf("ntrip_bytes_in_total %d", len(input)),
+		"ntrip_caster_reconnects_total 1",
+		`ntrip_backlog_messages{stage="caster"} 0`,
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(figures, line+"\n") {
+			t.Errorf("want %s in\n%s", line, figures)
+		}
+	}
+
+	// The bytes out include the resent message and the bytes that reached
+	// the stalled caster, so all that's certain is that it's not less than
+	// the input.
+	var bytesOut int
+	for _, line := range strings.Split(figures, "\n") {
+		if strings.HasPrefix(line, "ntrip_bytes_out_total ") {
+			fmt.Sscanf(line, "ntrip_bytes_out_total %d", &bytesOut)
+		}
+	}
+	if bytesOut < len(input) {
+		t.Errorf("want at least %d bytes out, got %d", len(input), bytesOut)
+	}
+}
+
+// TestPushHealth checks that push tells the health checker about the
+// messages and the connection to the caster.
+func TestPushHealth(t *testing.T) {
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, "ICY 200 OK\r\n", requests, data)
+
+	checker, healthError := health.New(health.Config{ListenAddress: ":8081"}, nil)
+	if healthError != nil {
+		t.Fatal(healthError)
+	}
+
+	up := newUploader(dialer(listener), &account{mountpoint: "MYBASE", password: "secret", version: version1}, time.Second)
+	up.health = checker
+	pushError := push(bytes.NewReader(testdata.MessageFrameType1005), up, time.Now(), nil)
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	status := checker.Status()
+	if !status.Healthy || status.SecondsSinceLastMessage == nil ||
+		status.CasterConnected == nil || !*status.CasterConnected {
+		t.Errorf("after the push: unexpected status %+v", status)
+	}
+
+	up.close()
+	<-data
+	status = checker.Status()
+	if status.Healthy || status.CasterConnected == nil || *status.CasterConnected {
+		t.Errorf("after the close: unexpected status %+v", status)
+	}
+}
+
+// TestPushToCaster checks that the messages pushed to a caster reach a
+// rover.
+func TestPushToCaster(t *testing.T) {
+	want := append([]byte{}, testdata.MessageFrameType1005...)
+	want = append(want, testdata.MessageFrameType1077...)
+
+	caster := ntriptest.NewCaster("secret")
+	defer caster.Close()
+
+	// Log in once so that the mountpoint exists for the rover.
+	up := newUploader(caster.Dial, &account{mountpoint: "MYBASE", password: "secret", version: version1}, time.Second)
+	if err := up.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	rover, getError := ntriptest.Get(caster.Dial, "MYBASE")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	defer rover.Close()
+
+	got := make([]byte, len(want))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(rover, got)
+		done <- err
+	}()
+
+	pushError := push(bytes.NewReader(want), up, time.Now(), nil)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %d bytes got %d", len(want), len(got))
+	}
+}
+
+// TestExampleConfig checks that the example config is valid and gives the
+// caster.
+func TestExampleConfig(t *testing.T) {
+	cfg, err := config.Load("ntripserver.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Caster.Address() != "caster.example.com:2101" || cfg.Caster.Mountpoint != "MYBASE" {
+		t.Errorf("want the caster, got %v", cfg.Caster)
+	}
+	if len(cfg.Input.Devices) == 0 {
+		t.Error("want the serial devices")
+	}
+}
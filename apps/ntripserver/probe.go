@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/type1029"
+)
+
+// probeText is the text of the messages sent during a probe.  The caster
+// passes them on to any rover connected to the mountpoint, so they say what
+// they are.
+const probeText = "go-ntrip speed test - ignore this message"
+
+// probeResult holds the measurements from a probe of the link to the
+// caster.
+type probeResult struct {
+	// Connect is the time taken to make the TCP connection, roughly one
+	// round trip.
+	Connect time.Duration
+
+	// Login is the time from sending the login request to receiving the
+	// response, one round trip plus the caster's processing time.  If the
+	// NTRIP version is auto and the caster only speaks version 1, it
+	// includes the failed attempt at version 2.
+	Login time.Duration
+
+	// Bytes is the number of bytes sent.
+	Bytes int64
+
+	// Elapsed is the time spent sending.
+	Elapsed time.Duration
+}
+
+// BitsPerSecond returns the rate at which data was sent.
+func (result *probeResult) BitsPerSecond() float64 {
+	if result.Elapsed <= 0 {
+		return 0
+	}
+	return float64(result.Bytes*8) / result.Elapsed.Seconds()
+}
+
+// String returns a readable version of the result, for the log.
+func (result *probeResult) String() string {
+	return fmt.Sprintf("probe: connect %v, login %v, sent %d bytes in %v, %.1f kbit/s",
+		result.Connect.Round(time.Millisecond), result.Login.Round(time.Millisecond),
+		result.Bytes, result.Elapsed.Round(time.Millisecond), result.BitsPerSecond()/1000)
+}
+
+// probe measures the link to the caster.  It connects, logs in to the
+// mountpoint and then sends type 1029 text messages as fast as it can for
+// the given duration.  Use a temporary mountpoint, not the one that rovers
+// use.
+//
+// The rate is worked out from the data that the system accepted, so the
+// first send buffer full is included even though it may not have reached
+// the caster.  A probe of ten seconds or more makes that error small on a
+// slow link, which is the one that matters.
+func probe(connect func() (net.Conn, error), acct *account, duration time.Duration) (*probeResult, error) {
+	var result probeResult
+
+	// Time the last connection made during the login.
+	timedConnect := func() (net.Conn, error) {
+		connectStart := time.Now()
+		conn, err := connect()
+		result.Connect = time.Since(connectStart)
+		return conn, err
+	}
+
+	loginStart := time.Now()
+	conn, loginError := connectAndLogin(timedConnect, acct, 0)
+	if loginError != nil {
+		return nil, loginError
+	}
+	defer conn.Close()
+	result.Login = time.Since(loginStart) - result.Connect
+
+	frame, frameError := probeFrame()
+	if frameError != nil {
+		return nil, frameError
+	}
+
+	// Send until the time is up.  The deadline stops a write that's held
+	// up by a full send buffer from running over.
+	sendStart := time.Now()
+	deadline := sendStart.Add(duration)
+	conn.SetWriteDeadline(deadline)
+	for time.Now().Before(deadline) {
+		n, writeError := conn.Write(frame)
+		result.Bytes += int64(n)
+		if writeError != nil {
+			if netError, ok := writeError.(net.Error); ok && netError.Timeout() {
+				break
+			}
+			return nil, writeError
+		}
+	}
+	result.Elapsed = time.Since(sendStart)
+
+	return &result, nil
+}
+
+// probeFrame returns the message frame sent during a probe.  The text is
+// repeated to make the frame as long as a big MSM7.
+func probeFrame() ([]byte, error) {
+	text := strings.Repeat(probeText+" ", 3)
+	message, err := type1029.New(0, time.Now(), text, slog.LevelInfo)
+	if err != nil {
+		return nil, err
+	}
+	return message.Frame(), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/ntriptest"
+)
+
+// TestProbe checks that probe sends test messages for the given time and
+// reports what it sent.
+func TestProbe(t *testing.T) {
+	caster := ntriptest.NewCaster("secret")
+	defer caster.Close()
+
+	result, err := probe(caster.Dial, &account{mountpoint: "SPEEDTEST", password: "secret", version: version1}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Bytes == 0 {
+		t.Fatal("want some data sent")
+	}
+
+	if result.Elapsed < 50*time.Millisecond {
+		t.Errorf("want at least 50ms got %v", result.Elapsed)
+	}
+
+	if result.BitsPerSecond() <= 0 {
+		t.Errorf("want a rate, got %f", result.BitsPerSecond())
+	}
+
+	// Wait for the caster to catch up, then check that it got whole frames.
+	frame, _ := probeFrame()
+	var received []byte
+	for i := 0; i < 100; i++ {
+		received = caster.Received("SPEEDTEST")
+		if int64(len(received)) >= result.Bytes {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if int64(len(received)) != result.Bytes {
+		t.Errorf("want %d bytes received got %d", result.Bytes, len(received))
+	}
+	if !bytes.HasPrefix(received, frame[:6]) {
+		t.Error("want a type 1029 message first")
+	}
+}
+
+// TestProbeWithBadPassword checks that probe returns the login error.
+func TestProbeWithBadPassword(t *testing.T) {
+	const wantError = "caster refused the connection - ERROR - Bad Password"
+
+	caster := ntriptest.NewCaster("secret")
+	defer caster.Close()
+
+	_, err := probe(caster.Dial, &account{mountpoint: "SPEEDTEST", password: "wrong", version: version1}, time.Second)
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if err.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, err.Error())
+	}
+}
+
+// TestProbeResultString checks the log entry.
+func TestProbeResultString(t *testing.T) {
+	const want = "probe: connect 20ms, login 45ms, sent 125000 bytes in 10s, 100.0 kbit/s"
+
+	result := probeResult{
+		Connect: 20 * time.Millisecond,
+		Login:   45 * time.Millisecond,
+		Bytes:   125000,
+		Elapsed: 10 * time.Second,
+	}
+	if got := result.String(); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+)
+
+// The program can log in to the caster using NTRIP version 1 or version 2.
+// Version 1 sends a SOURCE request with the password and the caster replies
+// "ICY 200 OK".  Version 2, which casters such as SNIP and BKG's require,
+// is proper HTTP/1.1:  the server sends a POST request with an
+// Ntrip-Version header and HTTP basic authentication, the caster replies
+// "HTTP/1.1 200 OK" with some headers, and the data is then sent with
+// chunked transfer encoding.
+//
+// With version "auto" the program tries version 2 first.  If the caster
+// doesn't answer in HTTP/1.1, it connects again and uses version 1.  A
+// caster that answers in HTTP/1.1 but refuses the login, for example
+// because the password is wrong, understood version 2, so the program
+// doesn't fall back.
+
+// The NTRIP versions given by the -ntrip-version flag.
+const (
+	version1    = "1"
+	version2    = "2"
+	versionAuto = "auto"
+)
+
+// closeTimeout is the time allowed to send the end of the chunked data when
+// a version 2 connection is closed.
+const closeTimeout = time.Second
+
+// account holds the details needed to log in to a mountpoint.
+type account struct {
+	// caster is the caster's host:port, sent in the Host header.
+	caster string
+
+	mountpoint string
+
+	// user is only used by version 2.
+	user     string
+	password string
+
+	// version is version1, version2 or versionAuto.
+	version string
+}
+
+// checkVersion returns an error if the version is not one that the program
+// knows.
+func checkVersion(version string) error {
+	switch version {
+	case version1, version2, versionAuto:
+		return nil
+	default:
+		em := fmt.Sprintf("unknown NTRIP version %q - want %s, %s or %s",
+			version, version1, version2, versionAuto)
+		return errors.New(em)
+	}
+}
+
+// connectAndLogin connects to the caster and logs in to the mountpoint using
+// the account's NTRIP version.  If the timeout is not zero, each login must
+// complete within it.  A version 2 connection is wrapped so that the data
+// written to it is sent in chunks.
+func connectAndLogin(connect func() (net.Conn, error), acct *account, timeout time.Duration) (net.Conn, error) {
+	if acct.version == version1 {
+		return attemptLogin(connect, timeout, func(conn net.Conn) error {
+			return login(conn, acct.mountpoint, acct.password)
+		})
+	}
+
+	understood := false
+	conn, loginError := attemptLogin(connect, timeout, func(conn net.Conn) error {
+		var err error
+		understood, err = loginVersion2(conn, acct)
+		return err
+	})
+	if loginError == nil {
+		return &chunkedConn{Conn: conn}, nil
+	}
+
+	if acct.version == version2 || understood {
+		return nil, loginError
+	}
+
+	log.Printf("caster doesn't speak NTRIP version 2 - %v - trying version 1", loginError)
+	return attemptLogin(connect, timeout, func(conn net.Conn) error {
+		return login(conn, acct.mountpoint, acct.password)
+	})
+}
+
+// attemptLogin connects and runs the login function, within the timeout if
+// it's not zero.  If the login fails, it closes the connection.
+func attemptLogin(connect func() (net.Conn, error), timeout time.Duration, loginFunc func(conn net.Conn) error) (net.Conn, error) {
+	conn, connectError := connect()
+	if connectError != nil {
+		return nil, exitcode.Wrap(exitcode.InputUnavailable, connectError)
+	}
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	loginError := loginFunc(conn)
+	if loginError != nil {
+		conn.Close()
+		return nil, loginError
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// loginVersion2 sends an NTRIP version 2 POST request and checks the
+// response.  understood is true if the caster answered in HTTP/1.1, even if
+// it refused the login.
+func loginVersion2(conn io.ReadWriter, acct *account) (understood bool, err error) {
+	credentials := base64.StdEncoding.EncodeToString([]byte(acct.user + ":" + acct.password))
+	request := fmt.Sprintf("POST /%s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Ntrip-Version: Ntrip/2.0\r\n"+
+		"User-Agent: %s\r\n"+
+		"Authorization: Basic %s\r\n"+
+		"Content-Type: gnss/data\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Connection: close\r\n"+
+		"\r\n",
+		strings.TrimPrefix(acct.mountpoint, "/"), acct.caster, sourceAgent, credentials)
+	_, writeError := conn.Write([]byte(request))
+	if writeError != nil {
+		return false, writeError
+	}
+
+	reader := bufio.NewReader(conn)
+	status, readError := reader.ReadString('\n')
+	if readError != nil {
+		return false, readError
+	}
+	status = strings.TrimSpace(status)
+
+	if !strings.HasPrefix(status, "HTTP/1.1 ") {
+		return false, refusal(status)
+	}
+
+	// Skip the headers.  The caster sends nothing after them.
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return true, err
+		}
+		if line == "\r\n" || line == "\n" {
+			break
+		}
+	}
+
+	if !strings.HasPrefix(status, "HTTP/1.1 200 ") {
+		return true, refusal(status)
+	}
+
+	return true, nil
+}
+
+// chunkedConn is a connection that sends the data written to it using HTTP
+// chunked transfer encoding.
+type chunkedConn struct {
+	net.Conn
+}
+
+// Write sends the data as one chunk.  The chunk is written in one go so that
+// an RTCM message isn't split between packets.  The count returned is the
+// number of bytes of the data that were sent.
+func (conn *chunkedConn) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		// An empty chunk would mark the end of the data.
+		return 0, nil
+	}
+
+	header := fmt.Sprintf("%x\r\n", len(data))
+	chunk := make([]byte, 0, len(header)+len(data)+2)
+	chunk = append(chunk, header...)
+	chunk = append(chunk, data...)
+	chunk = append(chunk, "\r\n"...)
+
+	n, err := conn.Conn.Write(chunk)
+
+	sent := n - len(header)
+	if sent < 0 {
+		sent = 0
+	}
+	if sent > len(data) {
+		sent = len(data)
+	}
+	return sent, err
+}
+
+// Close sends the end of the chunked data and closes the connection.
+func (conn *chunkedConn) Close() error {
+	conn.Conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	conn.Conn.Write([]byte("0\r\n\r\n"))
+	return conn.Conn.Close()
+}
+
+// refusal returns the error for the caster's refusal of a login.  If the
+// caster refused the password, the error carries the exit status
+// exitcode.AuthFailure, since there's no point in trying again.
+func refusal(status string) error {
+	em := fmt.Sprintf("caster refused the connection - %s", status)
+	if strings.Contains(status, " 401 ") || strings.Contains(status, "Bad Password") {
+		return exitcode.Wrap(exitcode.AuthFailure, errors.New(em))
+	}
+	return errors.New(em)
+}
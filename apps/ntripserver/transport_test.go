@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/caster"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/ntriptest"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// newVersion2Caster returns a caster with one mountpoint, MYBASE, and a
+// function that connects to it through a pipe.
+func newVersion2Caster(t *testing.T) func() (net.Conn, error) {
+	t.Helper()
+
+	config := caster.Config{Mountpoints: []caster.Mountpoint{
+		{Name: "MYBASE", SourcePassword: "secret"},
+	}}
+	c, err := caster.New(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func() (net.Conn, error) {
+		client, server := net.Pipe()
+		go c.ServeConn(server)
+		return client, nil
+	}
+}
+
+// getWhenLive connects a rover to the mountpoint once a server is sending
+// to it.  Until then the caster sends the sourcetable.
+func getWhenLive(t *testing.T, connect func() (net.Conn, error), mountpoint string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		conn, _ := connect()
+		conn.Write([]byte("GET /" + mountpoint + " HTTP/1.0\r\n\r\n"))
+		reader := bufio.NewReader(conn)
+		response, _ := reader.ReadString('\n')
+		if response == caster.ResponseOK {
+			return conn, reader
+		}
+		conn.Close()
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("mountpoint %s never went live", mountpoint)
+	return nil, nil
+}
+
+// TestCheckVersion checks that only the known NTRIP versions are accepted.
+func TestCheckVersion(t *testing.T) {
+	var testData = []struct {
+		version   string
+		wantError string
+	}{
+		{"1", ""},
+		{"2", ""},
+		{"auto", ""},
+		{"3", `unknown NTRIP version "3" - want 1, 2 or auto`},
+	}
+	for _, td := range testData {
+		err := checkVersion(td.version)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.version, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.version, td.wantError)
+		} else if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.version, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestPushVersion2 checks the version 2 request and that the data is
+// chunked.
+func TestPushVersion2(t *testing.T) {
+	const wantRequest = "POST /MYBASE HTTP/1.1\r\n" +
+		"Host: caster.example.com:2101\r\n" +
+		"Ntrip-Version: Ntrip/2.0\r\n" +
+		"User-Agent: NTRIP go-ntrip-ntripserver\r\n" +
+		"Authorization: Basic YmFzZTpzZWNyZXQ=\r\n" +
+		"Content-Type: gnss/data\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Connection: close\r\n" +
+		"\r\n"
+
+	frame := testdata.MessageFrameType1005
+	want := []byte(fmt.Sprintf("%x\r\n", len(frame)))
+	want = append(want, frame...)
+	want = append(want, "\r\n0\r\n\r\n"...)
+
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, caster.ResponseOKVersion2, requests, data)
+
+	acct := account{
+		caster:     "caster.example.com:2101",
+		mountpoint: "MYBASE",
+		user:       "base",
+		password:   "secret",
+		version:    version2,
+	}
+	up := newUploader(dialer(listener), &acct, time.Second)
+	pushError := push(bytes.NewReader(frame), up, time.Now(), nil)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	gotRequest := <-requests
+	if gotRequest != wantRequest {
+		t.Errorf("want request %q got %q", wantRequest, gotRequest)
+	}
+
+	got := <-data
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
+
+// TestPushVersion2ToCaster checks that the messages pushed to a version 2
+// caster reach a rover.
+func TestPushVersion2ToCaster(t *testing.T) {
+	want := append([]byte{}, testdata.MessageFrameType1005...)
+	want = append(want, testdata.MessageFrameType1077...)
+
+	connect := newVersion2Caster(t)
+
+	acct := account{mountpoint: "MYBASE", password: "secret", version: version2}
+	up := newUploader(connect, &acct, time.Second)
+	if err := up.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	rover, roverReader := getWhenLive(t, connect, "MYBASE")
+	defer rover.Close()
+
+	got := make([]byte, len(want))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(roverReader, got)
+		done <- err
+	}()
+
+	pushError := push(bytes.NewReader(want), up, time.Now(), nil)
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	up.close()
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %d bytes got %d", len(want), len(got))
+	}
+}
+
+// TestAutoFallsBackToVersion1 checks that auto uses version 1 with a caster
+// that doesn't understand version 2.
+func TestAutoFallsBackToVersion1(t *testing.T) {
+	want := testdata.MessageFrameType1005
+
+	v1Caster := ntriptest.NewCaster("secret")
+	defer v1Caster.Close()
+
+	connections := 0
+	connect := func() (net.Conn, error) {
+		connections++
+		return v1Caster.Dial()
+	}
+
+	acct := account{mountpoint: "MYBASE", password: "secret", version: versionAuto}
+	up := newUploader(connect, &acct, time.Second)
+	pushError := push(bytes.NewReader(want), up, time.Now(), nil)
+	up.close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	if connections != 2 {
+		t.Errorf("want 2 connections got %d", connections)
+	}
+
+	var received []byte
+	for i := 0; i < 100; i++ {
+		received = v1Caster.Received("MYBASE")
+		if len(received) >= len(want) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !bytes.Equal(want, received) {
+		t.Errorf("want %d bytes got %d", len(want), len(received))
+	}
+}
+
+// TestAutoWithBadPassword checks that auto doesn't fall back to version 1
+// when a version 2 caster refuses the login.
+func TestAutoWithBadPassword(t *testing.T) {
+	const wantError = "caster refused the connection - HTTP/1.1 401 Unauthorized"
+
+	v2Connect := newVersion2Caster(t)
+	connections := 0
+	connect := func() (net.Conn, error) {
+		connections++
+		return v2Connect()
+	}
+
+	acct := account{mountpoint: "MYBASE", password: "wrong", version: versionAuto}
+	_, err := connectAndLogin(connect, &acct, time.Second)
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if err.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, err.Error())
+	}
+	if exitcode.Code(err) != exitcode.AuthFailure {
+		t.Errorf("want exit code %d got %d", exitcode.AuthFailure, exitcode.Code(err))
+	}
+	if connections != 1 {
+		t.Errorf("want 1 connection got %d", connections)
+	}
+}
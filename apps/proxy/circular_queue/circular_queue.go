@@ -9,6 +9,12 @@
 //
 // GetMessages() gets the messages in the circular queue as a slice,
 // in the order in which they were added.
+//
+// GetRecentMessageOfType(messageType, n) gets the nth most recent message
+// of the given type.
+//
+// SetMaxItems(n) changes the size of the queue, removing the oldest
+// messages if it shrinks.
 package circularQueue
 
 import (
@@ -69,6 +75,23 @@ func (cb *CircularQueue) Add(message rtcm.Message) {
 	cb.NextIndex++
 }
 
+// SetMaxItems changes the maximum number of items in the queue.  If the
+// queue now holds too many, the oldest are removed.
+func (cb *CircularQueue) SetMaxItems(max int) {
+	// Write lock.
+	cb.Lock()
+	defer cb.Unlock()
+
+	cb.MaxItems = max
+
+	keys := cb.getKeysInAscendingOrder()
+	for _, key := range keys {
+		if len(cb.Items) > cb.MaxItems {
+			delete(cb.Items, key)
+		}
+	}
+}
+
 // GetMessages gets the items in the circular queue as a slice,
 // in ascending order of key, ie in the order that they were added.
 func (cb *CircularQueue) GetMessages() []rtcm.Message {
@@ -89,6 +112,37 @@ func (cb *CircularQueue) GetMessages() []rtcm.Message {
 	return result
 }
 
+// GetRecentMessageOfType gets the nth most recent message of the given type
+// from the queue.  n is counted from 1, so n == 1 gets the most recent
+// message of that type.  The boolean result is false if there is no such
+// message in the queue.
+func (cb *CircularQueue) GetRecentMessageOfType(messageType, n int) (rtcm.Message, bool) {
+	// Read lock.
+	cb.RLock()
+	defer cb.RUnlock()
+
+	if n < 1 {
+		return rtcm.Message{}, false
+	}
+
+	// Search backwards from the most recent message.
+	keys := cb.getKeysInAscendingOrder()
+	found := 0
+	for i := len(keys) - 1; i >= 0; i-- {
+		item, ok := cb.Items[keys[i]]
+		if !ok || item.MessageType != messageType {
+			continue
+		}
+
+		found++
+		if found == n {
+			return item, true
+		}
+	}
+
+	return rtcm.Message{}, false
+}
+
 // getKeysInAscendingOrder gets the keys in ascending order.
 func (cb *CircularQueue) getKeysInAscendingOrder() []int {
 
@@ -104,3 +104,82 @@ func TestCircularBufferFull(t *testing.T) {
 		t.Error("wanted m4")
 	}
 }
+
+// TestGetRecentMessageOfType checks that GetRecentMessageOfType finds the nth
+// most recent message of a given type.
+func TestGetRecentMessageOfType(t *testing.T) {
+	m1 := rtcm.Message{MessageType: 1077, RawData: []byte{1}}
+	m2 := rtcm.Message{MessageType: 1087, RawData: []byte{2}}
+	m3 := rtcm.Message{MessageType: 1077, RawData: []byte{3}}
+	m4 := rtcm.Message{MessageType: 1087, RawData: []byte{4}}
+
+	buf := NewCircularQueue(4)
+	buf.Add(m1)
+	buf.Add(m2)
+	buf.Add(m3)
+	buf.Add(m4)
+
+	var testData = []struct {
+		description string
+		messageType int
+		n           int
+		wantFound   bool
+		wantData    byte
+	}{
+		{"most recent 1077", 1077, 1, true, 3},
+		{"second most recent 1077", 1077, 2, true, 1},
+		{"most recent 1087", 1087, 1, true, 4},
+		{"second most recent 1087", 1087, 2, true, 2},
+		{"third most recent 1077", 1077, 3, false, 0},
+		{"type not present", 1005, 1, false, 0},
+		{"n zero", 1077, 0, false, 0},
+		{"n negative", 1077, -1, false, 0},
+	}
+	for _, td := range testData {
+		got, found := buf.GetRecentMessageOfType(td.messageType, td.n)
+		if found != td.wantFound {
+			t.Errorf("%s: want found %v got %v", td.description, td.wantFound, found)
+			continue
+		}
+		if !found {
+			continue
+		}
+		if got.MessageType != td.messageType {
+			t.Errorf("%s: want type %d got %d",
+				td.description, td.messageType, got.MessageType)
+		}
+		if got.RawData[0] != td.wantData {
+			t.Errorf("%s: want data %d got %d",
+				td.description, td.wantData, got.RawData[0])
+		}
+	}
+}
+
+// TestSetMaxItems checks that SetMaxItems shrinks the queue, keeping the
+// most recent messages.
+func TestSetMaxItems(t *testing.T) {
+	buf := NewCircularQueue(4)
+	for _, messageType := range []int{1074, 1077, 1084, 1087} {
+		buf.Add(rtcm.Message{MessageType: messageType})
+	}
+
+	buf.SetMaxItems(2)
+
+	got := buf.GetMessages()
+
+	if len(got) != 2 {
+		t.Errorf("want 2 items got %d", len(got))
+		return
+	}
+
+	if got[0].MessageType != 1084 || got[1].MessageType != 1087 {
+		t.Errorf("want 1084 and 1087, got %d and %d",
+			got[0].MessageType, got[1].MessageType)
+	}
+
+	// The queue should stay at the new size.
+	buf.Add(rtcm.Message{MessageType: 1094})
+	if len(buf.GetMessages()) != 2 {
+		t.Errorf("want 2 items got %d", len(buf.GetMessages()))
+	}
+}
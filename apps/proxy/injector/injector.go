@@ -0,0 +1,140 @@
+// Injector inserts extra RTCM message frames into a stream of data, for
+// example a message type 1029 carrying an announcement to the rover users.
+//
+// New() creates an Injector.
+//
+// Add(frame) queues a complete message frame for injection.
+//
+// Write(writer, data) writes the data to the writer.  If there are frames
+// queued, it writes them at the first point in the data where one RTCM
+// frame has finished and the next hasn't started, so the injected frames
+// never split a frame in the stream.
+//
+// The stream is tracked across calls, so one Injector should be used for
+// one stream.
+package injector
+
+import (
+	"io"
+	"sync"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Injector inserts message frames into a stream.  It's safe against
+// asynchronous access.
+type Injector struct {
+	// pending holds the frames waiting to be injected.
+	pending [][]byte
+
+	// leader holds the bytes of the leader of the frame being read so far.
+	leader []byte
+
+	// remaining is the number of bytes left in the frame being read, not
+	// counting the leader.
+	remaining int
+
+	// The mutex controls asynchronous access.
+	mutex sync.Mutex
+}
+
+// New creates an Injector.
+func New() *Injector {
+	return &Injector{}
+}
+
+// Add queues a message frame to be injected.
+func (injector *Injector) Add(frame []byte) {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	injector.pending = append(injector.pending, frame)
+}
+
+// Pending returns the number of frames waiting to be injected.
+func (injector *Injector) Pending() int {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	return len(injector.pending)
+}
+
+// Write writes the data to the writer, injecting any queued frames at the
+// first frame boundary.
+func (injector *Injector) Write(writer io.Writer, data []byte) error {
+	injector.mutex.Lock()
+
+	// Find the first boundary, if there are frames to inject.
+	boundary := -1
+	if len(injector.pending) > 0 && injector.atBoundary() {
+		boundary = 0
+	}
+	for i, b := range data {
+		injector.track(b)
+		if boundary < 0 && len(injector.pending) > 0 && injector.atBoundary() {
+			boundary = i + 1
+		}
+	}
+
+	var frames [][]byte
+	if boundary >= 0 {
+		frames = injector.pending
+		injector.pending = nil
+	} else {
+		boundary = len(data)
+	}
+
+	injector.mutex.Unlock()
+
+	if _, err := writer.Write(data[:boundary]); err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		if _, err := writer.Write(frame); err != nil {
+			return err
+		}
+	}
+	if boundary < len(data) {
+		if _, err := writer.Write(data[boundary:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// track follows the framing of the stream, one byte at a time.
+func (injector *Injector) track(b byte) {
+	if injector.remaining > 0 {
+		injector.remaining--
+		return
+	}
+
+	if len(injector.leader) == 0 {
+		// Outside a frame, waiting for the start of the next.
+		if b == utils.StartOfMessageFrame {
+			injector.leader = append(injector.leader, b)
+		}
+		return
+	}
+
+	injector.leader = append(injector.leader, b)
+
+	// The top six bits of the second byte must be zero.  If not, this
+	// isn't a frame.
+	if len(injector.leader) == 2 && b&0xfc != 0 {
+		injector.leader = nil
+		return
+	}
+
+	if len(injector.leader) == utils.LeaderLengthBytes {
+		messageLength := int(injector.leader[1]&0x3)<<8 | int(injector.leader[2])
+		injector.remaining = messageLength + utils.CRCLengthBytes
+		injector.leader = nil
+	}
+}
+
+// atBoundary returns true if the stream is between frames.
+func (injector *Injector) atBoundary() bool {
+	return injector.remaining == 0 && len(injector.leader) == 0
+}
@@ -0,0 +1,108 @@
+package injector
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// failingWriter always fails.
+type failingWriter struct{}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// TestWrite checks that queued frames are injected at a frame boundary.
+func TestWrite(t *testing.T) {
+	frame := testdata.MessageFrameType1005
+	injected := []byte{0xd3, 0, 0, 1, 2, 3}
+
+	var testData = []struct {
+		description string
+		before      [][]byte // Written before the frame is queued.
+		after       [][]byte // Written after the frame is queued.
+		want        []byte
+	}{
+		{"at start", nil, [][]byte{frame},
+			join(injected, frame)},
+		{"after junk", [][]byte{[]byte("junk")}, [][]byte{frame},
+			join([]byte("junk"), injected, frame)},
+		{"after a frame", [][]byte{frame}, [][]byte{frame},
+			join(frame, injected, frame)},
+		{"in the middle of a frame", [][]byte{frame[:5]}, [][]byte{frame[5:], frame},
+			join(frame, injected, frame)},
+		{"junk that looks like a leader", nil, [][]byte{join([]byte{0xd3, 0xff}, frame)},
+			join(injected, []byte{0xd3, 0xff}, frame)},
+	}
+	for _, td := range testData {
+		injector := New()
+
+		var buffer bytes.Buffer
+		for _, chunk := range td.before {
+			injector.Write(&buffer, chunk)
+		}
+		injector.Add(injected)
+		for _, chunk := range td.after {
+			err := injector.Write(&buffer, chunk)
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+		}
+
+		if !bytes.Equal(td.want, buffer.Bytes()) {
+			t.Errorf("%s: want\n%x\ngot\n%x", td.description, td.want, buffer.Bytes())
+		}
+	}
+}
+
+// TestWriteKeepsFramesUntilBoundary checks that a frame waits in the queue
+// until the end of the frame being written.
+func TestWriteKeepsFramesUntilBoundary(t *testing.T) {
+	frame := testdata.MessageFrameType1005
+	injected := []byte{0xd3, 0, 0, 1, 2, 3}
+
+	injector := New()
+	var buffer bytes.Buffer
+
+	injector.Write(&buffer, frame[:5])
+	injector.Add(injected)
+	injector.Write(&buffer, frame[5:10])
+
+	if injector.Pending() != 1 {
+		t.Errorf("want 1 pending frame, got %d", injector.Pending())
+	}
+
+	injector.Write(&buffer, frame[10:])
+
+	if injector.Pending() != 0 {
+		t.Errorf("want no pending frames, got %d", injector.Pending())
+	}
+
+	want := join(frame, injected)
+	if !bytes.Equal(want, buffer.Bytes()) {
+		t.Errorf("want\n%x\ngot\n%x", want, buffer.Bytes())
+	}
+}
+
+// TestWriteWithError checks that Write returns a write error.
+func TestWriteWithError(t *testing.T) {
+	injector := New()
+	injector.Add([]byte{0xd3, 0, 0, 1, 2, 3})
+
+	err := injector.Write(&failingWriter{}, []byte("junk"))
+	if err == nil || err.Error() != "write failed" {
+		t.Errorf("want write failed, got %v", err)
+	}
+}
+
+// join concatenates some byte slices.
+func join(slices ...[]byte) []byte {
+	var result []byte
+	for _, s := range slices {
+		result = append(result, s...)
+	}
+	return result
+}
@@ -2,17 +2,23 @@ package reportfeed
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	circularQueue "github.com/goblimey/go-ntrip/apps/proxy/circular_queue"
-	"github.com/goblimey/go-tools/dailylogger"
+	"github.com/goblimey/go-ntrip/logrotate"
 	"github.com/goblimey/go-tools/statusreporter"
 )
 
+// hiddenBuffer is displayed in place of a buffer when HideBuffers is set.
+const hiddenBuffer = "(not shown - it may contain the base position)\n"
+
 // Buffer contains an input or output buffer.
 type Buffer struct {
 	Timestamp     time.Time
@@ -23,13 +29,21 @@ type Buffer struct {
 
 // ReportFeed satisfies the status-reporter ReportFeedT interface.
 type ReportFeed struct {
-	logger           *dailylogger.Writer
+	logger           *logrotate.Writer
 	lastClientBuffer *Buffer
 	lastServerBuffer *Buffer
 
 	// RecentMessages contains the messages recently sent.
 	RecentMessages *circularQueue.CircularQueue
 
+	// HideBuffers stops the status report showing the raw input and output
+	// buffers, which may contain the exact base position.
+	HideBuffers bool
+
+	// Station is a readable description of the base station, shown at the
+	// top of the status report.  Empty means none.
+	Station string
+
 	*sync.Mutex
 }
 
@@ -39,7 +53,7 @@ var _ statusreporter.ReportFeedT = (*ReportFeed)(nil)
 // New creates and returns a new ReportFeed object.
 // The ReportFeed object contains a pointer to a mutex so always use this
 // method to create one.
-func New(lgr *dailylogger.Writer, queue *circularQueue.CircularQueue) *ReportFeed {
+func New(lgr *logrotate.Writer, queue *circularQueue.CircularQueue) *ReportFeed {
 	var mu sync.Mutex
 	reportFeed := ReportFeed{logger: lgr, RecentMessages: queue, Mutex: &mu}
 
@@ -68,15 +82,21 @@ func (rf *ReportFeed) Status() []byte {
 		clientLeader = fmt.Sprintf("From Client [%d]:\n%s\n", rf.lastClientBuffer.Source,
 			rf.lastClientBuffer.Timestamp.Format("Mon Jan _2 15:04:05 2006"))
 
-		clientHexDump =
-			Sanitise(hex.Dump((*rf.lastClientBuffer.Content)[:rf.lastClientBuffer.ContentLength]))
+		clientHexDump = hiddenBuffer
+		if !rf.HideBuffers {
+			clientHexDump =
+				Sanitise(hex.Dump((*rf.lastClientBuffer.Content)[:rf.lastClientBuffer.ContentLength]))
+		}
 	}
 	if rf.lastServerBuffer != nil && rf.lastServerBuffer.Content != nil {
 		fmt.Fprintf(os.Stderr, "server buffer")
 		serverLeader = fmt.Sprintf("To Server [%d]:\n%s\n", rf.lastServerBuffer.Source,
 			rf.lastServerBuffer.Timestamp.Format("Mon Jan _2 15:04:05 2006"))
-		serverHexDump =
-			Sanitise(hex.Dump((*rf.lastServerBuffer.Content)[:rf.lastServerBuffer.ContentLength]))
+		serverHexDump = hiddenBuffer
+		if !rf.HideBuffers {
+			serverHexDump =
+				Sanitise(hex.Dump((*rf.lastServerBuffer.Content)[:rf.lastServerBuffer.ContentLength]))
+		}
 	}
 
 	// Get the recent messages from the queue.  (Note that the
@@ -88,7 +108,12 @@ func (rf *ReportFeed) Status() []byte {
 		messageDisplay += message.String() + "\n"
 	}
 
-	reportBody := fmt.Sprintf(reportFormat,
+	stationDisplay := ""
+	if len(rf.Station) > 0 {
+		stationDisplay = fmt.Sprintf(stationFormat, Sanitise(rf.Station))
+	}
+
+	reportBody := stationDisplay + fmt.Sprintf(reportFormat,
 		clientLeader,
 		clientHexDump,
 		serverLeader,
@@ -100,7 +125,7 @@ func (rf *ReportFeed) Status() []byte {
 }
 
 // SetLogger sets the logger.
-func (rf *ReportFeed) SetLogger(logger *dailylogger.Writer) {
+func (rf *ReportFeed) SetLogger(logger *logrotate.Writer) {
 	rf.logger = logger
 }
 
@@ -118,6 +143,79 @@ func (rf *ReportFeed) RecordServerBuffer(buffer *[]byte, source uint64, length i
 	rf.lastServerBuffer = &Buffer{time.Now(), uint64(source), buffer, length}
 }
 
+// RawFrameHexDump returns a hex dump of the raw frame of the nth most recent
+// message of the given type, n counting from 1.  Only the messages in the
+// queue of recent messages are searched.
+func (rf *ReportFeed) RawFrameHexDump(messageType, n int) (string, error) {
+	message, found := rf.RecentMessages.GetRecentMessageOfType(messageType, n)
+	if !found {
+		em := fmt.Sprintf("no message %d of type %d in the last %d messages",
+			n, messageType, rf.RecentMessages.MaxItems)
+		return "", errors.New(em)
+	}
+
+	if message.HidesPosition() {
+		em := fmt.Sprintf("the frame of message type %d contains the base position", messageType)
+		return "", errors.New(em)
+	}
+
+	return hex.Dump(message.RawData), nil
+}
+
+// ServeRawFrame handles an HTTP request of the form /status/frame/{type}/{n}
+// and responds with a hex dump of the raw frame of the nth most recent message
+// of that type.  If n is not given, the most recent message is dumped.
+func (rf *ReportFeed) ServeRawFrame(w http.ResponseWriter, r *http.Request) {
+	messageType, n, parseError := parseFramePath(r.URL.Path)
+	if parseError != nil {
+		http.Error(w, parseError.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dump, dumpError := rf.RawFrameHexDump(messageType, n)
+	if dumpError != nil {
+		http.Error(w, dumpError.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, dump)
+}
+
+// parseFramePath gets the message type and the count from a request path of
+// the form /status/frame/{type}/{n}.  The count is optional and defaults to 1.
+func parseFramePath(path string) (int, int, error) {
+	const prefix = "/status/frame/"
+	if !strings.HasPrefix(path, prefix) {
+		em := fmt.Sprintf("path %s does not start with %s", path, prefix)
+		return 0, 0, errors.New(em)
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+	if len(parts) < 1 || len(parts) > 2 || len(parts[0]) == 0 {
+		em := fmt.Sprintf("path %s - want %s{type}/{n}", path, prefix)
+		return 0, 0, errors.New(em)
+	}
+
+	messageType, typeError := strconv.Atoi(parts[0])
+	if typeError != nil {
+		em := fmt.Sprintf("illegal message type %s", parts[0])
+		return 0, 0, errors.New(em)
+	}
+
+	n := 1
+	if len(parts) == 2 {
+		var nError error
+		n, nError = strconv.Atoi(parts[1])
+		if nError != nil || n < 1 {
+			em := fmt.Sprintf("illegal message count %s", parts[1])
+			return 0, 0, errors.New(em)
+		}
+	}
+
+	return messageType, n, nil
+}
+
 // Sanitise edits a string, replacing some dangerous HTML characters.
 func Sanitise(s string) string {
 	s = strings.Replace(s, "<", "&lt;", -1)
@@ -1,12 +1,17 @@
 package reportfeed
 
 import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 
 	circularQueue "github.com/goblimey/go-ntrip/apps/proxy/circular_queue"
+	"github.com/goblimey/go-ntrip/logrotate"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
 
-	"github.com/goblimey/go-tools/dailylogger"
 	"github.com/goblimey/go-tools/testsupport"
 )
 
@@ -60,7 +65,7 @@ func TestStatus(t *testing.T) {
 	defer testsupport.RemoveWorkingDirectory(workingDirectory)
 
 	name := "abc."
-	dailyLog := dailylogger.New("logs", name, ".log")
+	dailyLog := logrotate.New("logs", name, ".log")
 	reportFeed := New(dailyLog, q)
 
 	// Record only two characters of the client buffer.
@@ -77,6 +82,123 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+// TestStatusWithHiddenBuffers checks that the status report doesn't show
+// the buffers when they are hidden.
+func TestStatusWithHiddenBuffers(t *testing.T) {
+	clientBuffer := []byte("foo")
+	serverBuffer := []byte("bar")
+
+	workingDirectory, err := testsupport.CreateWorkingDirectory()
+	if err != nil {
+		t.Errorf("createWorkingDirectory failed - %v", err)
+	}
+	defer testsupport.RemoveWorkingDirectory(workingDirectory)
+
+	dailyLog := logrotate.New("logs", "abc.", ".log")
+	reportFeed := New(dailyLog, circularQueue.NewCircularQueue(1))
+	reportFeed.HideBuffers = true
+
+	reportFeed.RecordClientBuffer(&clientBuffer, 0, len(clientBuffer))
+	reportFeed.RecordServerBuffer(&serverBuffer, 1, len(serverBuffer))
+
+	result := string(reportFeed.Status())
+
+	if strings.Contains(result, "|foo|") || strings.Contains(result, "|bar|") {
+		t.Errorf("want the buffers hidden, got %s", result)
+	}
+
+	if strings.Count(result, hiddenBuffer) != 2 {
+		t.Errorf("want two hidden buffers, got %s", result)
+	}
+}
+
+// TestStatusWithStation checks that the status report starts with the
+// description of the station, if there is one.
+func TestStatusWithStation(t *testing.T) {
+	workingDirectory, err := testsupport.CreateWorkingDirectory()
+	if err != nil {
+		t.Errorf("createWorkingDirectory failed - %v", err)
+	}
+	defer testsupport.RemoveWorkingDirectory(workingDirectory)
+
+	dailyLog := logrotate.New("logs", "abc.", ".log")
+	reportFeed := New(dailyLog, circularQueue.NewCircularQueue(1))
+
+	if strings.Contains(string(reportFeed.Status()), "<h3>Station</h3>") {
+		t.Error("want no station section")
+	}
+
+	reportFeed.Station = "Station HOME\nOperator <me>\n"
+
+	result := string(reportFeed.Status())
+
+	const want = "\n<h3>Station</h3>\n<pre>\n<code>\n<div class=\"preformatted\" id='station'>\n" +
+		"Station HOME\nOperator &lt;me&gt;\n\n</div>"
+	if !strings.HasPrefix(result, want) {
+		t.Errorf("want the report to start with %q, got %q", want, result)
+	}
+}
+
+// TestServeRawFrame checks that ServeRawFrame responds with a hex dump of the
+// requested message or a suitable error.
+func TestServeRawFrame(t *testing.T) {
+	frame1 := []byte{0xd3, 0x00, 0x01, 0x01}
+	frame2 := []byte{0xd3, 0x00, 0x01, 0x02}
+	frame3 := []byte{0xd3, 0x00, 0x01, 0x03}
+	frame4 := []byte{0xd3, 0x00, 0x01, 0x04}
+
+	q := circularQueue.NewCircularQueue(5)
+	q.Add(rtcm.Message{MessageType: 1006, RawData: frame4, PositionPrecision: 100})
+	q.Add(rtcm.Message{MessageType: 1077, RawData: frame1})
+	q.Add(rtcm.Message{MessageType: 1005, RawData: frame2})
+	q.Add(rtcm.Message{MessageType: 1077, RawData: frame3})
+
+	workingDirectory, err := testsupport.CreateWorkingDirectory()
+	if err != nil {
+		t.Errorf("createWorkingDirectory failed - %v", err)
+	}
+	defer testsupport.RemoveWorkingDirectory(workingDirectory)
+
+	dailyLog := logrotate.New("logs", "abc.", ".log")
+	reportFeed := New(dailyLog, q)
+
+	var testData = []struct {
+		description string
+		path        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"most recent by default", "/status/frame/1077", http.StatusOK, hex.Dump(frame3)},
+		{"most recent", "/status/frame/1077/1", http.StatusOK, hex.Dump(frame3)},
+		{"second most recent", "/status/frame/1077/2/", http.StatusOK, hex.Dump(frame1)},
+		{"other type", "/status/frame/1005/1", http.StatusOK, hex.Dump(frame2)},
+		{"position hidden", "/status/frame/1006", http.StatusNotFound,
+			"the frame of message type 1006 contains the base position\n"},
+		{"not in queue", "/status/frame/1077/3", http.StatusNotFound,
+			"no message 3 of type 1077 in the last 5 messages\n"},
+		{"bad type", "/status/frame/junk/1", http.StatusBadRequest,
+			"illegal message type junk\n"},
+		{"bad count", "/status/frame/1077/0", http.StatusBadRequest,
+			"illegal message count 0\n"},
+		{"no type", "/status/frame/", http.StatusBadRequest,
+			"path /status/frame/ - want /status/frame/{type}/{n}\n"},
+	}
+	for _, td := range testData {
+		request := httptest.NewRequest(http.MethodGet, td.path, nil)
+		recorder := httptest.NewRecorder()
+
+		reportFeed.ServeRawFrame(recorder, request)
+
+		if recorder.Code != td.wantStatus {
+			t.Errorf("%s: want status %d got %d", td.description, td.wantStatus, recorder.Code)
+		}
+
+		if recorder.Body.String() != td.wantBody {
+			t.Errorf("%s: want body\n%s\ngot\n%s", td.description, td.wantBody, recorder.Body.String())
+		}
+	}
+}
+
 // reduceString removes all newlines and reduces all other white space to a single space.
 func reduceString(str string) string {
 	re := regexp.MustCompile(`(?)\n+`)
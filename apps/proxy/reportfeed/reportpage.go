@@ -1,5 +1,18 @@
 package reportfeed
 
+// stationFormat defines the HTML structure of the description of the base
+// station, which comes before the report.
+const stationFormat = `
+<h3>Station</h3>
+<pre>
+<code>
+<div class="preformatted" id='station'>
+%s
+</div>
+</code>
+</pre>
+`
+
 // reportFormat defines the HTML structure of the report.
 const reportFormat = `
 <h3>Last Client Buffer</h3>
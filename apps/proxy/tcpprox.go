@@ -9,13 +9,20 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"time"
 
 	circularQueue "github.com/goblimey/go-ntrip/apps/proxy/circular_queue"
+	"github.com/goblimey/go-ntrip/apps/proxy/injector"
 	reportfeed "github.com/goblimey/go-ntrip/apps/proxy/reportfeed"
+	ntripconfig "github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/logrotate"
+	"github.com/goblimey/go-ntrip/memorymonitor"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
-	"github.com/goblimey/go-tools/dailylogger"
+	"github.com/goblimey/go-ntrip/rtcm/type1029"
+	"github.com/goblimey/go-ntrip/version"
 	reporter "github.com/goblimey/go-tools/statusreporter"
 )
 
@@ -36,6 +43,31 @@ import (
 //
 // The /status/report request displays the timestamp and contents of the last
 // input and output buffers.
+//
+// The /status/frame/{type}/{n} request displays a hex dump of the raw frame of
+// the nth most recent message of the given type, for example
+// /status/frame/1077/2.  If n is not given, the most recent one is displayed.
+//
+// The /status/stats request returns the RTCM handler's message counts as JSON,
+// with the time of the last frame and a health score from 0 to 100 combining
+// latency, completeness, CRC failures and constellation coverage, and
+// percentiles of the recent intervals between epochs of observations, which
+// show jitter introduced by the network.  It's cheap enough to be polled
+// frequently.
+//
+// The /status/announce request (a POST with a "text" form value and an
+// optional "station_id") sends an announcement to the rover users, such as
+// "maintenance at 12:00 UTC", as an RTCM message type 1029 injected into the
+// stream between two frames.
+//
+// If the config gives position_precision_metres, the base position in
+// messages of type 1005 and 1006 is rounded to that precision on the status
+// pages and the raw frames of those messages are not shown, so the pages
+// can be made public without giving away the exact position.
+//
+// If the config gives a status_snapshot_file, the stats are also written to
+// that file every status_snapshot_seconds (default 60), so that a static web
+// host can publish them without the control port being exposed.
 
 var reportFeed *reportfeed.ReportFeed
 
@@ -47,9 +79,21 @@ var messageChan chan rtcm.Message
 
 const maxNumberOfMessagesStored = 20
 
+// numberOfMessagesStoredWhenShort is the number of messages stored once
+// the memory soft cap has been exceeded.
+const numberOfMessagesStoredWhenShort = 5
+
 var recentMessages *circularQueue.CircularQueue
 
-var rtcmLog *dailylogger.Writer
+// defaultStatusSnapshotInterval is the time between status snapshots if
+// the config doesn't give one.
+const defaultStatusSnapshotInterval = time.Minute
+
+// announcements holds the announcements waiting to be injected into the
+// stream sent to the server.
+var announcements = injector.New()
+
+var rtcmLog *logrotate.Writer
 
 func main() {
 
@@ -72,8 +116,15 @@ func main() {
 	flag.BoolVar(&quiet, "q", false, "quiet logging (shorthand)")
 	flag.BoolVar(&quiet, "quiet", false, "quiet logging")
 
+	showVersion := flag.Bool("version", false, "display the version and stop")
+
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(version.String("proxy"))
+		os.Exit(0)
+	}
+
 	// Non-zero config values from the command line override any config file.
 	configFromCommandLine := Config{
 		ProxyHost:   *proxyHostnamePtr,
@@ -107,7 +158,7 @@ func main() {
 		}
 
 		// Create the logger.
-		rtcmLog = dailylogger.New(config.MessageLogDirectory, "data.", ".rtcm")
+		rtcmLog = logrotate.New(config.MessageLogDirectory, "data.", ".rtcm")
 	}
 	// Set the logging level.  It should be either quiet or verbose.
 	if verbose {
@@ -134,6 +185,7 @@ func start(isTLS bool) {
 	// message channel.  The incoming data is sent to the byte channel
 	// by handleClientMessages.
 	rtcmHandler = rtcm.New(time.Now(), slog.LevelInfo)
+	rtcmHandler.SetPositionPrecision(config.PositionPrecisionMetres)
 	go rtcmHandler.HandleMessages(byteChan, messageChan)
 
 	// Create a circular queue to hold the recent messages from the message
@@ -145,6 +197,23 @@ func start(isTLS bool) {
 	recentMessages = circularQueue.NewCircularQueue(maxNumberOfMessagesStored)
 	go keepCircularQueueUpdated(messageChan, recentMessages)
 
+	// If there is a memory soft cap, start monitoring the heap.
+	if config.MemorySoftCapMegabytes > 0 {
+		softCap := config.MemorySoftCapMegabytes * memorymonitor.Megabyte
+		monitor := memorymonitor.New(softCap, memorymonitor.DefaultInterval, nil)
+		monitor.OnSoftCapExceeded(shedOptionalWork)
+		go monitor.Run(nil)
+	}
+
+	// If there is a status snapshot file, start writing to it.
+	if len(config.StatusSnapshotFile) > 0 {
+		interval := defaultStatusSnapshotInterval
+		if config.StatusSnapshotSeconds > 0 {
+			interval = time.Duration(config.StatusSnapshotSeconds) * time.Second
+		}
+		go snapshotStatus(config.StatusSnapshotFile, interval)
+	}
+
 	// Set up the status reporter and the proxy server
 	m := fmt.Sprintf("setting up status reporter - %s:%d\n", config.ControlHost, config.ControlPort)
 	slog.Info(m)
@@ -153,7 +222,7 @@ func start(isTLS bool) {
 	if config.RemoteHost == "" {
 		slog.Error("[x] Remote host required")
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(exitcode.Config)
 	}
 
 	// Start the main server for NTRIP traffic.
@@ -251,7 +320,7 @@ func handleClientMessages(server, client net.Conn, id int) {
 
 			// Hang onto the buffer for reporting until the next one arrives
 			reportFeed.RecordClientBuffer(&data, uint64(id), n)
-			server.Write(data[:n])
+			announcements.Write(server, data[:n])
 		}
 		if err != nil && err == io.EOF { // INCONSISTENT?
 			fmt.Println(err)
@@ -286,13 +355,13 @@ func SetConfig(configFile string, configFromCommandLine *Config) {
 		if err != nil {
 			em := fmt.Sprintf("[-] Cannot open config file: %s\n", err.Error())
 			slog.Error(em)
-			os.Exit(1)
+			os.Exit(exitcode.Config)
 		}
 
 		parseError := SetConfigFromReader(file, configFromCommandLine)
 
 		if parseError != nil {
-			os.Exit(-1)
+			os.Exit(exitcode.Config)
 		}
 
 	} else {
@@ -310,21 +379,18 @@ func SetConfig(configFile string, configFromCommandLine *Config) {
 // SetConfigFrom Reader sets the proxy config from data on a reader.
 func SetConfigFromReader(configReader io.Reader, configFromCommandLine *Config) error {
 
-	data := make([]byte, 4096)
-	n, err := configReader.Read(data)
+	data, err := io.ReadAll(configReader)
 	if err != nil {
 		em := fmt.Sprintf("[-] Error reading config file: %s\n", err.Error())
 		slog.Error(em)
 		return err
 	}
 
-	fmt.Printf("data\n%s", string(data))
-
-	parseError := parseConfig(data[:n], &config)
+	parseError := parseConfig(data, &config)
 	if parseError != nil {
 		em := fmt.Sprintf("[-] Not a valid config file: %s\n", parseError.Error())
 		slog.Error(em)
-		return err
+		return parseError
 	}
 
 	// Non-Zero command line values override values in the config file.
@@ -362,12 +428,39 @@ func SetConfigFromReader(configReader io.Reader, configFromCommandLine *Config)
 	return nil
 }
 
-func parseConfig(data []byte, config *Config) error {
-	err := json.Unmarshal(data, config)
+// parseConfig parses the config, in any of the forms that the config
+// package accepts, and sets the proxy's settings from it.  The old flat
+// config is converted.
+func parseConfig(data []byte, proxyConfig *Config) error {
+	loaded, err := ntripconfig.Parse(data)
 	if err != nil {
 		return err
 	}
 
+	settings := loaded.Proxy
+	*proxyConfig = Config{
+		RemoteHost:              settings.RemoteHost,
+		ProxyHost:               settings.ProxyHost,
+		ProxyPort:               settings.ProxyPort,
+		ControlHost:             settings.ControlHost,
+		ControlPort:             settings.ControlPort,
+		CertFile:                settings.CertFile,
+		RecordMessages:          loaded.Logging.RecordMessages,
+		MessageLogDirectory:     loaded.Logging.MessageLogDirectory,
+		MemorySoftCapMegabytes:  settings.MemorySoftCapMegabytes,
+		StatusSnapshotFile:      settings.StatusSnapshotFile,
+		StatusSnapshotSeconds:   settings.StatusSnapshotSeconds,
+		PositionPrecisionMetres: loaded.Logging.PositionPrecisionMetres,
+		Station:                 loaded.Station,
+	}
+	if settings.TLS != nil {
+		proxyConfig.TLS = &TLS{
+			Country:    settings.TLS.Country,
+			Org:        settings.TLS.Org,
+			CommonName: settings.TLS.CommonName,
+		}
+	}
+
 	return nil
 }
 
@@ -375,17 +468,114 @@ func makeReporter(controlHost string, controlPort int, queue *circularQueue.Circ
 	rtcmLog.Write([]byte("setting up the status reporter\n"))
 
 	rf := reportfeed.New(rtcmLog, queue)
+	rf.HideBuffers = config.PositionPrecisionMetres > 0
+	rf.Station = config.Station.String(config.PositionPrecisionMetres)
 
 	proxyReporter := reporter.MakeReporter(rf, controlHost, controlPort)
 
 	proxyReporter.SetUseTextTemplates(true)
 
+	// The status reporter serves its requests using the default mux, so
+	// the raw frame request can be added alongside them.
+	http.HandleFunc("/status/frame/", rf.ServeRawFrame)
+	http.HandleFunc("/status/stats", serveStats)
+	http.HandleFunc("/status/announce", serveAnnounce)
+
 	// Start the HTTP server for control requests.
 	go proxyReporter.StartService()
 
 	return rf
 }
 
+// shedOptionalWork is called when memory is short.  It stops the verbose
+// tracing of the traffic and shrinks the queue of recent messages.
+func shedOptionalWork() {
+	slog.Warn("memory soft cap exceeded - shedding optional work")
+	slog.SetLogLoggerLevel(slog.LevelWarn)
+	recentMessages.SetMaxItems(numberOfMessagesStoredWhenShort)
+}
+
+// serveStats handles the /status/stats request, responding with the RTCM
+// handler's counters in JSON form.
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	statsJSON, err := json.Marshal(rtcmHandler.Stats())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statsJSON)
+}
+
+// snapshotStatus writes the stats to the given file at the given intervals.
+// It runs forever, so it should be run in a goroutine.
+func snapshotStatus(fileName string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := writeStatusSnapshot(fileName)
+		if err != nil {
+			slog.Error("cannot write status snapshot", "file", fileName, "error", err)
+		}
+	}
+}
+
+// writeStatusSnapshot writes the RTCM handler's stats to the given file in
+// JSON form.  The file is replaced by renaming a temporary file, so a web
+// server reading it never sees a half-written snapshot.
+func writeStatusSnapshot(fileName string) error {
+	statsJSON, err := json.Marshal(rtcmHandler.Stats())
+	if err != nil {
+		return err
+	}
+
+	temporaryName := fileName + ".tmp"
+	writeError := os.WriteFile(temporaryName, statsJSON, 0644)
+	if writeError != nil {
+		return writeError
+	}
+
+	return os.Rename(temporaryName, fileName)
+}
+
+// serveAnnounce handles the /status/announce request, queueing a message
+// type 1029 containing the text to be injected into the stream.
+func serveAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "want POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	text := r.FormValue("text")
+	if len(text) == 0 {
+		http.Error(w, "want some text", http.StatusBadRequest)
+		return
+	}
+
+	var stationID uint
+	if len(r.FormValue("station_id")) > 0 {
+		_, scanError := fmt.Sscanf(r.FormValue("station_id"), "%d", &stationID)
+		if scanError != nil {
+			http.Error(w, "station_id must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	message, err := type1029.New(stationID, time.Now(), text, slog.LevelInfo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	announcements.Add(message.Frame())
+
+	slog.Info(fmt.Sprintf("announcement queued - %q", text))
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "announcement queued\n")
+}
+
 // keepCircularQueueUpdated loops, reading messages from the message channel
 // and putting them into the circular queue.  It terminates when the message
 // queue is closed.  It can be run in a goroutine.
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	circularQueue "github.com/goblimey/go-ntrip/apps/proxy/circular_queue"
+	"github.com/goblimey/go-ntrip/apps/proxy/injector"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
 )
 
@@ -86,6 +96,35 @@ func TestParseConfig(t *testing.T) {
 	}
 }
 
+// TestParseConfigSectioned checks that the proxy reads the sectioned config
+// of the config package, here in YAML.
+func TestParseConfigSectioned(t *testing.T) {
+	const yamlConfig = `
+proxy:
+  remote_host: remote:1001
+  proxy_port: 42
+  tls: {country: [GB], common_name: "*.domain.com"}
+logging:
+  record_messages: true
+  message_log_directory: ./logs
+`
+	var config Config
+	if err := parseConfig([]byte(yamlConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.RemoteHost != "remote:1001" || config.ProxyPort != 42 {
+		t.Errorf("want remote:1001 and port 42 got %s and %d", config.RemoteHost, config.ProxyPort)
+	}
+	if config.TLS == nil || config.TLS.CommonName != "*.domain.com" {
+		t.Errorf("want the TLS common name, got %v", config.TLS)
+	}
+	if !config.RecordMessages || config.MessageLogDirectory != "./logs" {
+		t.Errorf("want the messages recorded in ./logs, got %v and %s",
+			config.RecordMessages, config.MessageLogDirectory)
+	}
+}
+
 func TestParseConfigWithError(t *testing.T) {
 
 	j := "{junk}"
@@ -198,3 +237,172 @@ func TestCircularBufferFull(t *testing.T) {
 		t.Error("wanted m4")
 	}
 }
+
+// TestServeStats checks that serveStats responds with the handler's stats.
+func TestServeStats(t *testing.T) {
+	rtcmHandler = rtcm.New(time.Now(), slog.LevelInfo)
+
+	request := httptest.NewRequest(http.MethodGet, "/status/stats", nil)
+	recorder := httptest.NewRecorder()
+
+	serveStats(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("want status %d got %d", http.StatusOK, recorder.Code)
+	}
+
+	var got rtcm.Stats
+	err := json.Unmarshal(recorder.Body.Bytes(), &got)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if got.Frames != 0 || len(got.MessagesByType) != 0 {
+		t.Errorf("want empty stats, got %v", got)
+	}
+}
+
+// TestParseConfigWithStatusSnapshot checks that the status snapshot config
+// is parsed.
+func TestParseConfigWithStatusSnapshot(t *testing.T) {
+	j := `{
+		"remote_host": "remote:1001",
+		"status_snapshot_file": "/var/www/status.json",
+		"status_snapshot_seconds": 30
+	}`
+
+	var config Config
+
+	err := parseConfig([]byte(j), &config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if config.StatusSnapshotFile != "/var/www/status.json" {
+		t.Errorf("want /var/www/status.json got %s", config.StatusSnapshotFile)
+	}
+
+	if config.StatusSnapshotSeconds != 30 {
+		t.Errorf("want 30 got %d", config.StatusSnapshotSeconds)
+	}
+}
+
+// TestParseConfigWithPositionPrecision checks that the position precision
+// is parsed.
+func TestParseConfigWithPositionPrecision(t *testing.T) {
+	var config Config
+
+	err := parseConfig([]byte(`{"position_precision_metres": 100}`), &config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if config.PositionPrecisionMetres != 100 {
+		t.Errorf("want 100 got %f", config.PositionPrecisionMetres)
+	}
+}
+
+// TestParseConfigWithStation checks that the station description is parsed
+// and checked.
+func TestParseConfigWithStation(t *testing.T) {
+	var config Config
+
+	err := parseConfig([]byte(`{"station": {"name": "HOME", "operator": "me"}}`), &config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if config.Station == nil || config.Station.Name != "HOME" || config.Station.Operator != "me" {
+		t.Errorf("want the station, got %v", config.Station)
+	}
+
+	var badConfig Config
+	const wantError = "station HOME - antenna height -1.0000 is negative"
+	badError := parseConfig([]byte(`{"station": {"name": "HOME", "antenna_height_metres": -1}}`), &badConfig)
+	if badError == nil || badError.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, badError)
+	}
+}
+
+// TestWriteStatusSnapshot checks that writeStatusSnapshot writes the
+// handler's stats to the file, replacing any previous snapshot.
+func TestWriteStatusSnapshot(t *testing.T) {
+	rtcmHandler = rtcm.New(time.Now(), slog.LevelInfo)
+
+	fileName := filepath.Join(t.TempDir(), "status.json")
+
+	writeError := os.WriteFile(fileName, []byte("old snapshot"), 0644)
+	if writeError != nil {
+		t.Fatal(writeError)
+	}
+
+	err := writeStatusSnapshot(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	contents, readError := os.ReadFile(fileName)
+	if readError != nil {
+		t.Error(readError)
+		return
+	}
+
+	var got rtcm.Stats
+	jsonError := json.Unmarshal(contents, &got)
+	if jsonError != nil {
+		t.Error(jsonError)
+		return
+	}
+
+	if got.Frames != 0 || len(got.MessagesByType) != 0 {
+		t.Errorf("want empty stats, got %v", got)
+	}
+
+	_, statError := os.Stat(fileName + ".tmp")
+	if !os.IsNotExist(statError) {
+		t.Error("want the temporary file to be gone")
+	}
+}
+
+// TestServeAnnounce checks that serveAnnounce queues a message type 1029.
+func TestServeAnnounce(t *testing.T) {
+	var testData = []struct {
+		description string
+		method      string
+		form        url.Values
+		wantStatus  int
+		wantPending int
+	}{
+		{"good", http.MethodPost, url.Values{"text": {"maintenance at 12:00 UTC"}, "station_id": {"2"}},
+			http.StatusAccepted, 1},
+		{"GET", http.MethodGet, nil, http.StatusMethodNotAllowed, 0},
+		{"no text", http.MethodPost, url.Values{}, http.StatusBadRequest, 0},
+		{"bad station", http.MethodPost, url.Values{"text": {"x"}, "station_id": {"x"}},
+			http.StatusBadRequest, 0},
+		{"too long", http.MethodPost, url.Values{"text": {strings.Repeat("x", 200)}},
+			http.StatusBadRequest, 0},
+	}
+	for _, td := range testData {
+		announcements = injector.New()
+
+		request := httptest.NewRequest(td.method, "/status/announce",
+			strings.NewReader(td.form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+
+		serveAnnounce(recorder, request)
+
+		if recorder.Code != td.wantStatus {
+			t.Errorf("%s: want status %d got %d", td.description, td.wantStatus, recorder.Code)
+		}
+
+		if announcements.Pending() != td.wantPending {
+			t.Errorf("%s: want %d pending got %d", td.description, td.wantPending, announcements.Pending())
+		}
+	}
+}
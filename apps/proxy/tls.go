@@ -10,6 +10,8 @@ import (
 	"math/big"
 	"net"
 	"time"
+
+	"github.com/goblimey/go-ntrip/station"
 )
 
 // TLS LINT
@@ -30,6 +32,25 @@ type Config struct {
 	CertFile            string `json:"cert_file"`
 	RecordMessages      bool   `json:"record_messages"`
 	MessageLogDirectory string `json:"message_log_directory"`
+
+	// MemorySoftCapMegabytes is the heap size above which the proxy sheds
+	// optional work.  0 means no cap.
+	MemorySoftCapMegabytes uint64 `json:"memory_soft_cap_megabytes"`
+
+	// StatusSnapshotFile is a file to which the stats are written
+	// periodically, for a static web host to serve.  Empty means none.
+	StatusSnapshotFile string `json:"status_snapshot_file"`
+
+	// StatusSnapshotSeconds is the time between snapshots.  0 means
+	// defaultStatusSnapshotInterval.
+	StatusSnapshotSeconds uint `json:"status_snapshot_seconds"`
+
+	// PositionPrecisionMetres is the precision to which the base position
+	// is displayed on the status pages.  0 means show the exact position.
+	PositionPrecisionMetres float64 `json:"position_precision_metres"`
+
+	// Station describes the base station.  It's shown on the status page.
+	Station *station.Config `json:"station"`
 }
 
 var config Config
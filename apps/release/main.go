@@ -0,0 +1,417 @@
+// The release tool builds the applications for the platforms that base
+// station operators use and packages them, with example config files, into
+// one archive per platform.  Operators can then download an archive, unpack
+// it and run the programs without installing a Go toolchain.
+//
+// Run it from the root of the repository:
+//
+//	go run ./apps/release -version v1.2.0
+//
+// The archives are written to the directory dist, one per platform:
+//
+//	go-ntrip-v1.2.0-linux-armv6.tar.gz    (Raspberry Pi, all models)
+//	go-ntrip-v1.2.0-linux-arm64.tar.gz    (64-bit Raspberry Pi OS etc)
+//	go-ntrip-v1.2.0-linux-amd64.tar.gz
+//	go-ntrip-v1.2.0-windows-amd64.zip
+//
+// along with a file SHA256SUMS containing their checksums.  The version, the
+// git commit and the build date are embedded in each program via the version
+// package, so "rtcmfilter --version" says exactly what's running.
+//
+// The -targets option gives a comma-separated list of platforms to build,
+// for example "linux/arm,linux/arm64".
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+)
+
+// versionPackage is the package containing the version variables.
+const versionPackage = "github.com/goblimey/go-ntrip/version"
+
+// Target is a platform to build for.
+type Target struct {
+	// OS is the operating system, as GOOS.
+	OS string
+	// Arch is the architecture, as GOARCH.
+	Arch string
+	// ARM is the ARM version, as GOARM.  Only used when Arch is "arm".
+	ARM string
+}
+
+// String returns the target in the form used on the command line, for
+// example "linux/arm".
+func (target *Target) String() string {
+	return target.OS + "/" + target.Arch
+}
+
+// defaultTargets are the platforms built when none are specified.  ARMv6
+// binaries run on every model of Raspberry Pi, including the Zero.
+var defaultTargets = []Target{
+	{OS: "linux", Arch: "arm", ARM: "6"},
+	{OS: "linux", Arch: "arm64"},
+	{OS: "linux", Arch: "amd64"},
+	{OS: "windows", Arch: "amd64"},
+}
+
+// Program is an application included in the release.
+type Program struct {
+	// Name is the name of the executable.
+	Name string
+	// Package is the path of the main package relative to the repository root.
+	Package string
+	// Configs is a list of example config files relative to the repository root.
+	Configs []string
+}
+
+// programs are the applications included in the release.
+var programs = []Program{
+	{"rtcmfilter", "./apps/rtcmfilter", []string{"apps/rtcmfilter/filter.json"}},
+	{"serial_usb_grabber", "./apps/serial_usb_grabber", []string{"apps/serial_usb_grabber/config.json"}},
+	{"displayrtcm3", "./apps/displayrtcm3", nil},
+	{"rtcmlogger", "./apps/rtcmlogger", []string{"apps/rtcmlogger/rtcmlogger.json"}},
+	{"proxy", "./apps/proxy", []string{"apps/proxy/proxy.json"}},
+	{"ntripcaster", "./apps/ntripcaster", []string{"apps/ntripcaster/ntripcaster.json"}},
+	{"ntripclient", "./apps/ntripclient", []string{"apps/ntripclient/ntripclient.json"}},
+	{"ntripserver", "./apps/ntripserver", []string{"apps/ntripserver/ntripserver.json"}},
+	{"gontrip", "./apps/gontrip", nil},
+	{"rtcmreplay", "./apps/rtcmreplay", nil},
+	{"rtcmgenerate", "./apps/rtcmgenerate", nil},
+	{"rtcmextract", "./apps/rtcmextract", nil},
+}
+
+// archiveFile is a file to be added to an archive.
+type archiveFile struct {
+	// Name is the name of the file within the archive.
+	Name string
+	// Source is the path of the file to copy into the archive.
+	Source string
+	// Executable is true if the file should be marked as executable.
+	Executable bool
+}
+
+func main() {
+	var releaseVersion, commit, outputDirectory, targetList string
+	flag.StringVar(&releaseVersion, "version", "", "version of the release, for example v1.2.0 (mandatory)")
+	flag.StringVar(&commit, "commit", "", "git commit (default: the current HEAD)")
+	flag.StringVar(&outputDirectory, "out", "dist", "directory to receive the archives")
+	flag.StringVar(&targetList, "targets", "", "comma-separated list of os/arch (default: all)")
+	flag.Parse()
+
+	if len(releaseVersion) == 0 {
+		exitcode.Fatal(exitcode.Config, "missing -version")
+	}
+
+	targets, targetError := parseTargets(targetList)
+	if targetError != nil {
+		exitcode.Fatal(exitcode.Config, targetError)
+	}
+
+	if len(commit) == 0 {
+		commit = currentCommit()
+	}
+
+	buildDate := time.Now().UTC().Format(time.RFC3339)
+
+	archives, err := release(releaseVersion, commit, buildDate, outputDirectory, targets)
+	if err != nil {
+		exitcode.FatalError(err)
+	}
+
+	for _, archive := range archives {
+		fmt.Println(archive)
+	}
+}
+
+// release builds and packages the programs for each target and writes the
+// checksums.  It returns the paths of the archives.
+func release(releaseVersion, commit, buildDate, outputDirectory string, targets []Target) ([]string, error) {
+	mkdirError := os.MkdirAll(outputDirectory, 0755)
+	if mkdirError != nil {
+		return nil, mkdirError
+	}
+
+	flags := ldflags(releaseVersion, commit, buildDate)
+
+	archives := make([]string, 0, len(targets))
+	for _, target := range targets {
+		archive, err := releaseTarget(releaseVersion, flags, outputDirectory, target)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, archive)
+	}
+
+	checksumError := writeChecksums(filepath.Join(outputDirectory, "SHA256SUMS"), archives)
+	if checksumError != nil {
+		return nil, checksumError
+	}
+
+	return archives, nil
+}
+
+// releaseTarget builds the programs for one target in a scratch directory
+// and packages them.  It returns the path of the archive.
+func releaseTarget(releaseVersion, flags, outputDirectory string, target Target) (string, error) {
+	buildDirectory, tempError := ioutil.TempDir("", "go-ntrip-release")
+	if tempError != nil {
+		return "", tempError
+	}
+	defer os.RemoveAll(buildDirectory)
+
+	topDirectory := strings.TrimSuffix(strings.TrimSuffix(
+		archiveName(releaseVersion, target), ".zip"), ".tar.gz")
+
+	files := make([]archiveFile, 0)
+	for _, program := range programs {
+		binary := binaryName(program.Name, target)
+		binaryPath := filepath.Join(buildDirectory, binary)
+		buildError := build(target, program.Package, binaryPath, flags)
+		if buildError != nil {
+			em := fmt.Sprintf("building %s for %s - %v", program.Name, target.String(), buildError)
+			return "", errors.New(em)
+		}
+		files = append(files, archiveFile{
+			Name:       topDirectory + "/" + binary,
+			Source:     binaryPath,
+			Executable: true,
+		})
+
+		for _, config := range program.Configs {
+			files = append(files, archiveFile{
+				Name:   topDirectory + "/configs/" + program.Name + "/" + filepath.Base(config),
+				Source: config,
+			})
+		}
+	}
+
+	files = append(files, archiveFile{Name: topDirectory + "/README.md", Source: "README.md"})
+
+	archivePath := filepath.Join(outputDirectory, archiveName(releaseVersion, target))
+	archiveError := writeArchive(archivePath, files)
+	if archiveError != nil {
+		return "", archiveError
+	}
+
+	return archivePath, nil
+}
+
+// parseTargets parses a comma-separated list of targets such as
+// "linux/arm,windows/amd64".  An empty list gives the default targets.
+func parseTargets(list string) ([]Target, error) {
+	if len(strings.TrimSpace(list)) == 0 {
+		return defaultTargets, nil
+	}
+
+	targets := make([]Target, 0)
+	for _, item := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(item), "/")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			em := fmt.Sprintf("target %q - want os/arch", item)
+			return nil, errors.New(em)
+		}
+		target := Target{OS: parts[0], Arch: parts[1]}
+		if target.Arch == "arm" {
+			target.ARM = "6"
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// ldflags returns the linker flags that embed the version information.
+func ldflags(releaseVersion, commit, buildDate string) string {
+	flags := []string{"-s", "-w"}
+	flags = append(flags, fmt.Sprintf("-X %s.Version=%s", versionPackage, releaseVersion))
+	if len(commit) > 0 {
+		flags = append(flags, fmt.Sprintf("-X %s.Commit=%s", versionPackage, commit))
+	}
+	if len(buildDate) > 0 {
+		flags = append(flags, fmt.Sprintf("-X %s.BuildDate=%s", versionPackage, buildDate))
+	}
+	return strings.Join(flags, " ")
+}
+
+// binaryName returns the name of the executable for the target.
+func binaryName(program string, target Target) string {
+	if target.OS == "windows" {
+		return program + ".exe"
+	}
+	return program
+}
+
+// archiveName returns the name of the archive for the target.  Windows users
+// get a zip file, everybody else gets a gzipped tar file.
+func archiveName(releaseVersion string, target Target) string {
+	arch := target.Arch
+	if target.Arch == "arm" && len(target.ARM) > 0 {
+		arch = "armv" + target.ARM
+	}
+
+	name := fmt.Sprintf("go-ntrip-%s-%s-%s", releaseVersion, target.OS, arch)
+	if target.OS == "windows" {
+		return name + ".zip"
+	}
+	return name + ".tar.gz"
+}
+
+// buildEnvironment returns the environment for cross-compiling for the target.
+// The binaries are statically linked so they don't depend on the C library
+// on the target machine.
+func buildEnvironment(target Target) []string {
+	env := os.Environ()
+	env = append(env, "CGO_ENABLED=0", "GOOS="+target.OS, "GOARCH="+target.Arch)
+	if target.Arch == "arm" {
+		env = append(env, "GOARM="+target.ARM)
+	}
+	return env
+}
+
+// build runs "go build" to build the given package for the target.
+func build(target Target, mainPackage, outputPath, flags string) error {
+	command := exec.Command("go", "build", "-trimpath", "-ldflags", flags, "-o", outputPath, mainPackage)
+	command.Env = buildEnvironment(target)
+	command.Stdout = os.Stderr
+	command.Stderr = os.Stderr
+	return command.Run()
+}
+
+// currentCommit returns the short hash of the current git commit or "" if
+// it can't be found.
+func currentCommit() string {
+	output, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// writeArchive writes the files into a zip or gzipped tar archive, depending
+// on the suffix of the path.
+func writeArchive(path string, files []archiveFile) error {
+	out, createError := os.Create(path)
+	if createError != nil {
+		return createError
+	}
+
+	var writeError error
+	if strings.HasSuffix(path, ".zip") {
+		writeError = writeZip(out, files)
+	} else {
+		writeError = writeTarGz(out, files)
+	}
+
+	closeError := out.Close()
+	if writeError != nil {
+		return writeError
+	}
+	return closeError
+}
+
+// writeTarGz writes the files to the writer as a gzipped tar archive.
+func writeTarGz(writer io.Writer, files []archiveFile) error {
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, file := range files {
+		contents, readError := ioutil.ReadFile(file.Source)
+		if readError != nil {
+			return readError
+		}
+
+		var mode int64 = 0644
+		if file.Executable {
+			mode = 0755
+		}
+
+		header := tar.Header{
+			Name:    file.Name,
+			Mode:    mode,
+			Size:    int64(len(contents)),
+			ModTime: time.Now(),
+		}
+		headerError := tarWriter.WriteHeader(&header)
+		if headerError != nil {
+			return headerError
+		}
+		_, writeError := tarWriter.Write(contents)
+		if writeError != nil {
+			return writeError
+		}
+	}
+
+	tarError := tarWriter.Close()
+	if tarError != nil {
+		return tarError
+	}
+	return gzipWriter.Close()
+}
+
+// writeZip writes the files to the writer as a zip archive.
+func writeZip(writer io.Writer, files []archiveFile) error {
+	zipWriter := zip.NewWriter(writer)
+
+	for _, file := range files {
+		contents, readError := ioutil.ReadFile(file.Source)
+		if readError != nil {
+			return readError
+		}
+
+		header := zip.FileHeader{Name: file.Name, Method: zip.Deflate}
+		header.Modified = time.Now()
+		if file.Executable {
+			header.SetMode(0755)
+		} else {
+			header.SetMode(0644)
+		}
+
+		entry, createError := zipWriter.CreateHeader(&header)
+		if createError != nil {
+			return createError
+		}
+		_, writeError := entry.Write(contents)
+		if writeError != nil {
+			return writeError
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// writeChecksums writes a file of SHA256 checksums of the given files in the
+// format produced by sha256sum, so it can be checked with "sha256sum -c".
+func writeChecksums(path string, files []string) error {
+	names := make([]string, len(files))
+	copy(names, files)
+	sort.Strings(names)
+
+	lines := ""
+	for _, name := range names {
+		contents, readError := ioutil.ReadFile(name)
+		if readError != nil {
+			return readError
+		}
+		sum := sha256.Sum256(contents)
+		lines += fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), filepath.Base(name))
+	}
+
+	return ioutil.WriteFile(path, []byte(lines), 0644)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestParseTargets checks that parseTargets handles good and bad lists.
+func TestParseTargets(t *testing.T) {
+	var testData = []struct {
+		description string
+		list        string
+		want        []Target
+		wantError   string
+	}{
+		{"empty", "", defaultTargets, ""},
+		{"one", "linux/amd64", []Target{{OS: "linux", Arch: "amd64"}}, ""},
+		{"arm", "linux/arm, windows/amd64",
+			[]Target{{OS: "linux", Arch: "arm", ARM: "6"}, {OS: "windows", Arch: "amd64"}}, ""},
+		{"bad", "linux", nil, `target "linux" - want os/arch`},
+		{"missing arch", "linux/", nil, `target "linux/" - want os/arch`},
+	}
+	for _, td := range testData {
+		got, err := parseTargets(td.list)
+		if len(td.wantError) > 0 {
+			if err == nil {
+				t.Errorf("%s: want an error", td.description)
+				continue
+			}
+			if err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestLdflags checks the linker flags that embed the version.
+func TestLdflags(t *testing.T) {
+	const want = "-s -w -X github.com/goblimey/go-ntrip/version.Version=v1.2.0" +
+		" -X github.com/goblimey/go-ntrip/version.Commit=abc1234" +
+		" -X github.com/goblimey/go-ntrip/version.BuildDate=2024-09-01T10:00:00Z"
+
+	got := ldflags("v1.2.0", "abc1234", "2024-09-01T10:00:00Z")
+	if got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+
+	const wantVersionOnly = "-s -w -X github.com/goblimey/go-ntrip/version.Version=v1.2.0"
+	gotVersionOnly := ldflags("v1.2.0", "", "")
+	if gotVersionOnly != wantVersionOnly {
+		t.Errorf("want %s got %s", wantVersionOnly, gotVersionOnly)
+	}
+}
+
+// TestNames checks the names of the binaries and the archives.
+func TestNames(t *testing.T) {
+	var testData = []struct {
+		target      Target
+		wantBinary  string
+		wantArchive string
+	}{
+		{Target{OS: "linux", Arch: "arm", ARM: "6"}, "rtcmfilter", "go-ntrip-v1.0.0-linux-armv6.tar.gz"},
+		{Target{OS: "linux", Arch: "arm64"}, "rtcmfilter", "go-ntrip-v1.0.0-linux-arm64.tar.gz"},
+		{Target{OS: "linux", Arch: "amd64"}, "rtcmfilter", "go-ntrip-v1.0.0-linux-amd64.tar.gz"},
+		{Target{OS: "windows", Arch: "amd64"}, "rtcmfilter.exe", "go-ntrip-v1.0.0-windows-amd64.zip"},
+	}
+	for _, td := range testData {
+		gotBinary := binaryName("rtcmfilter", td.target)
+		if gotBinary != td.wantBinary {
+			t.Errorf("%s: want %s got %s", td.target.String(), td.wantBinary, gotBinary)
+		}
+		gotArchive := archiveName("v1.0.0", td.target)
+		if gotArchive != td.wantArchive {
+			t.Errorf("%s: want %s got %s", td.target.String(), td.wantArchive, gotArchive)
+		}
+	}
+}
+
+// TestBuildEnvironment checks that the environment sets up cross-compilation.
+func TestBuildEnvironment(t *testing.T) {
+	env := strings.Join(buildEnvironment(Target{OS: "linux", Arch: "arm", ARM: "6"}), " ")
+	for _, want := range []string{"CGO_ENABLED=0", "GOOS=linux", "GOARCH=arm", "GOARM=6"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("want %s in the environment", want)
+		}
+	}
+}
+
+// TestWriteArchive checks that writeArchive writes tar.gz and zip files
+// containing the given files.
+func TestWriteArchive(t *testing.T) {
+	directory := t.TempDir()
+
+	binary := filepath.Join(directory, "prog")
+	ioutil.WriteFile(binary, []byte("binary"), 0755)
+	config := filepath.Join(directory, "config.json")
+	ioutil.WriteFile(config, []byte("{}"), 0644)
+
+	files := []archiveFile{
+		{Name: "top/prog", Source: binary, Executable: true},
+		{Name: "top/configs/prog/config.json", Source: config},
+	}
+
+	want := map[string]string{
+		"top/prog":                     "binary 755",
+		"top/configs/prog/config.json": "{} 644",
+	}
+
+	tarPath := filepath.Join(directory, "a.tar.gz")
+	tarError := writeArchive(tarPath, files)
+	if tarError != nil {
+		t.Error(tarError)
+		return
+	}
+
+	gotTar := readTarGz(t, tarPath)
+	if !cmp.Equal(want, gotTar) {
+		t.Error(cmp.Diff(want, gotTar))
+	}
+
+	zipPath := filepath.Join(directory, "a.zip")
+	zipError := writeArchive(zipPath, files)
+	if zipError != nil {
+		t.Error(zipError)
+		return
+	}
+
+	gotZip := readZip(t, zipPath)
+	if !cmp.Equal(want, gotZip) {
+		t.Error(cmp.Diff(want, gotZip))
+	}
+}
+
+// TestWriteArchiveWithMissingFile checks that writeArchive returns an error
+// if a source file doesn't exist.
+func TestWriteArchiveWithMissingFile(t *testing.T) {
+	directory := t.TempDir()
+	files := []archiveFile{{Name: "x", Source: filepath.Join(directory, "missing")}}
+
+	err := writeArchive(filepath.Join(directory, "a.tar.gz"), files)
+	if err == nil {
+		t.Error("want an error")
+	}
+}
+
+// TestWriteChecksums checks the checksum file.
+func TestWriteChecksums(t *testing.T) {
+	directory := t.TempDir()
+	a := filepath.Join(directory, "a")
+	ioutil.WriteFile(a, []byte("hello\n"), 0644)
+
+	sums := filepath.Join(directory, "SHA256SUMS")
+	err := writeChecksums(sums, []string{a})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const want = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  a\n"
+	got, _ := ioutil.ReadFile(sums)
+	if string(got) != want {
+		t.Errorf("want %s got %s", want, string(got))
+	}
+}
+
+// readTarGz returns the contents and permissions of the files in a tar.gz archive.
+func readTarGz(t *testing.T, path string) map[string]string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipReader, gzipError := gzip.NewReader(file)
+	if gzipError != nil {
+		t.Fatal(gzipError)
+	}
+
+	result := make(map[string]string)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := ioutil.ReadAll(tarReader)
+		result[header.Name] = string(contents) + " " + os.FileMode(header.Mode).Perm().String()[1:]
+	}
+
+	return convertModes(result)
+}
+
+// readZip returns the contents and permissions of the files in a zip archive.
+func readZip(t *testing.T, path string) map[string]string {
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zipReader.Close()
+
+	result := make(map[string]string)
+	for _, file := range zipReader.File {
+		reader, openError := file.Open()
+		if openError != nil {
+			t.Fatal(openError)
+		}
+		contents, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		result[file.Name] = string(contents) + " " + file.Mode().Perm().String()[1:]
+	}
+
+	return convertModes(result)
+}
+
+// convertModes converts permissions such as "rwxr-xr-x" to octal such as "755".
+func convertModes(files map[string]string) map[string]string {
+	replacer := strings.NewReplacer("rwxr-xr-x", "755", "rw-r--r--", "644")
+	for name, value := range files {
+		files[name] = replacer.Replace(value)
+	}
+	return files
+}
@@ -0,0 +1,250 @@
+// rtcmextract reads a recording of RTCM data, for example a day's file
+// written by rtcmlogger, and writes the messages from a window of time to
+// the standard output channel, for example the two hours around a survey
+// for post-processing:
+//
+//	rtcmextract -start 2023-05-15T10:00:00Z -end 2023-05-15T12:00:00Z \
+//	    data.rtcm >survey.rtcm
+//
+// The times are in UTC.  A Multiple Signal Message (MSM) is written if the
+// time in its timestamp is at or after the start and before the end.  A
+// message without a timestamp, such as the base position in message type
+// 1005, is taken to have the time of the MSM before it, so it's written if
+// that MSM was.  Non-RTCM data and message frames that fail their CRC check
+// are left out.  The messages written are unchanged.
+//
+// The options are:
+//
+//	-start 2023-05-15T10:00:00Z
+//	                    the start of the window.  The default is the
+//	                    start of the recording.
+//	-end 2023-05-15T12:00:00Z
+//	                    the end of the window.  The default is the end of
+//	                    the recording.
+//	-types 1005,1077    write only the messages of these types.  The
+//	                    default is all types.
+//
+// The timestamp of an MSM only gives the time within the week, so the week
+// is taken from the start time, or the end time if there's no start:  the
+// messages are taken to be from the week either side of it.  That's right
+// for a recording that starts up to three and a half days before that time
+// and runs on for any length of time.  A recording that contains a GPS
+// ephemeris (type 1019) gives the week itself.
+//
+// The file name "-" means the standard input channel.
+//
+// The program logs to the standard error channel and stops at the end of
+// the recording with one of the exit statuses in the exitcode package.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/typefilter"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+func main() {
+	var start, end, typeList string
+	flag.StringVar(&start, "start", "", "the start of the window in UTC, for example 2023-05-15T10:00:00Z")
+	flag.StringVar(&end, "end", "", "the end of the window in UTC, for example 2023-05-15T12:00:00Z")
+	flag.StringVar(&typeList, "types", "", "comma-separated list of message types (default: all)")
+
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(version.String("rtcmextract"))
+		os.Exit(0)
+	}
+
+	if flag.NArg() != 1 {
+		exitcode.Fatalf(exitcode.Config, "usage: %s [options] file", os.Args[0])
+	}
+
+	e, configError := newExtractor(start, end, typeList)
+	if configError != nil {
+		exitcode.Fatal(exitcode.Config, configError)
+	}
+
+	logger := log.New(os.Stderr, "rtcmextract ", log.LstdFlags)
+
+	var reader io.Reader = os.Stdin
+	fileName := flag.Arg(0)
+	if fileName != "-" {
+		file, openError := os.Open(fileName)
+		if openError != nil {
+			exitcode.Fatal(exitcode.InputUnavailable, openError)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	count, extractError := e.extract(rtcm.NewScannerAt(reader, e.weekTime()), os.Stdout)
+	logger.Printf("wrote %d messages", count)
+	if extractError != nil {
+		exitcode.FatalError(extractError)
+	}
+}
+
+// extractor chooses the messages to write.
+type extractor struct {
+	// start and end give the window.  A zero time means no limit.
+	start time.Time
+	end   time.Time
+
+	// filter chooses the message types.  It's nil if all types are written.
+	filter *typefilter.Filter
+
+	// inWindow is true if the last MSM with a time was in the window.
+	inWindow bool
+}
+
+// newExtractor creates an extractor from the values of the options.
+func newExtractor(start, end, typeList string) (*extractor, error) {
+	var e extractor
+
+	if len(start) > 0 {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return nil, fmt.Errorf("-start - %v", err)
+		}
+		e.start = t
+	}
+	if len(end) > 0 {
+		t, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			return nil, fmt.Errorf("-end - %v", err)
+		}
+		e.end = t
+	}
+	if !e.start.IsZero() && !e.end.IsZero() && !e.start.Before(e.end) {
+		em := fmt.Sprintf("the start %s is not before the end %s",
+			e.start.UTC().Format(time.RFC3339), e.end.UTC().Format(time.RFC3339))
+		return nil, errors.New(em)
+	}
+
+	types, typesError := parseTypes(typeList)
+	if typesError != nil {
+		return nil, typesError
+	}
+	if len(types) > 0 {
+		filter, filterError := typefilter.New(types, nil)
+		if filterError != nil {
+			return nil, filterError
+		}
+		e.filter = filter
+	}
+
+	// With no window, everything is in it.
+	e.inWindow = e.start.IsZero() && e.end.IsZero()
+
+	return &e, nil
+}
+
+// parseTypes converts a list of message types such as "1005,1077" to a
+// slice.  An empty list gives an empty slice.
+func parseTypes(list string) ([]int, error) {
+	types := make([]int, 0)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		messageType, err := strconv.Atoi(field)
+		if err != nil {
+			em := fmt.Sprintf("illegal message type %q", field)
+			return nil, errors.New(em)
+		}
+		types = append(types, messageType)
+	}
+	return types, nil
+}
+
+// halfWeek is half the length of a week.
+const halfWeek = 84 * time.Hour
+
+// weekTime returns the time at which the handler starts, from which it
+// works out the weeks of the MSMs.  The handler takes an MSM to be from the
+// week that starts with the last Sunday before the start time if its time
+// in the week is later than the start time and from the next week if not.
+// So a start time half a week before the window covers the week either
+// side of it.
+func (e *extractor) weekTime() time.Time {
+	if !e.start.IsZero() {
+		return e.start.Add(-halfWeek)
+	}
+	if !e.end.IsZero() {
+		return e.end.Add(-halfWeek)
+	}
+	return time.Now()
+}
+
+// contains returns true if the time is in the window.
+func (e *extractor) contains(t time.Time) bool {
+	if !e.start.IsZero() && t.Before(e.start) {
+		return false
+	}
+	if !e.end.IsZero() && !t.Before(e.end) {
+		return false
+	}
+	return true
+}
+
+// keep returns true if the message is to be written.
+func (e *extractor) keep(message *rtcm.Message) bool {
+	if message.MessageType == utils.NonRTCMMessage || len(message.ErrorMessage) > 0 {
+		return false
+	}
+
+	// An MSM whose time couldn't be worked out is taken to have the time of
+	// the MSM before it, like a message without a timestamp.
+	if utils.MSM(message.MessageType) && !message.SentAt.IsZero() {
+		e.inWindow = e.contains(message.SentAt)
+	}
+	if !e.inWindow {
+		return false
+	}
+
+	return e.filter == nil || e.filter.KeepFrame(message.MessageType, message.RawData)
+}
+
+// extract reads the messages from the scanner and writes the ones to be
+// kept to the writer.  It returns the number of messages written.  A read
+// or write error is returned wrapped with the IOError exit status.  The end
+// of the input isn't an error.
+func (e *extractor) extract(scanner *rtcm.Scanner, writer io.Writer) (int, error) {
+	count := 0
+	for {
+		message, err := scanner.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, exitcode.Wrap(exitcode.IOError, err)
+		}
+
+		if !e.keep(message) {
+			continue
+		}
+
+		_, writeError := writer.Write(message.RawData)
+		if writeError != nil {
+			return count, exitcode.Wrap(exitcode.IOError, writeError)
+		}
+		count++
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// msm is a helper function.  It returns a copy of the type 1077 test frame
+// with the timestamp of the given UTC time of day on a Monday.  GPS time is
+// 18 seconds ahead of UTC and the GPS week starts on Sunday.
+func msm(hour, minute, second int) []byte {
+	timestamp := uint64(((24+hour)*3600 + minute*60 + second + 18) * 1000)
+	frame := make([]byte, len(testdata.MessageFrameType1077))
+	copy(frame, testdata.MessageFrameType1077)
+	const timestampPosition = utils.LeaderLengthBits + header.LenMessageType + header.LenStationID
+	// SetBits only sets bits, so clear the old timestamp first.
+	for p := uint(timestampPosition); p < timestampPosition+header.LenTimeStamp; p++ {
+		frame[p/8] &^= 1 << (7 - p%8)
+	}
+	utils.SetBits(frame, timestampPosition, header.LenTimeStamp, timestamp)
+	utils.SetCRC(frame)
+	return frame
+}
+
+// TestExtract checks that only the messages in the window, and of the
+// chosen types, are written.
+func TestExtract(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, msm(9, 59, 59)...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, msm(10, 0, 0)...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, []byte("junk")...)
+	input = append(input, msm(10, 59, 59)...)
+	input = append(input, msm(11, 0, 0)...)
+	input = append(input, testdata.MessageFrameType1005...)
+
+	var testData = []struct {
+		description string
+		start       string
+		end         string
+		types       string
+		want        [][]byte
+	}{
+		{
+			"window", "2023-05-15T10:00:00Z", "2023-05-15T11:00:00Z", "",
+			[][]byte{msm(10, 0, 0), testdata.MessageFrameType1005, msm(10, 59, 59)},
+		},
+		{
+			"window and types", "2023-05-15T10:00:00Z", "2023-05-15T11:00:00Z", "1005",
+			[][]byte{testdata.MessageFrameType1005},
+		},
+		{
+			"start only", "2023-05-15T10:59:59Z", "", "",
+			[][]byte{msm(10, 59, 59), msm(11, 0, 0), testdata.MessageFrameType1005},
+		},
+		{
+			"end only", "", "2023-05-15T10:00:00Z", "1077",
+			[][]byte{msm(9, 59, 59)},
+		},
+		{
+			"no window", "", "", "1077",
+			[][]byte{msm(9, 59, 59), msm(10, 0, 0), msm(10, 59, 59), msm(11, 0, 0)},
+		},
+	}
+	for _, td := range testData {
+		e, err := newExtractor(td.start, td.end, td.types)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		weekTime := e.weekTime()
+		if len(td.start) == 0 && len(td.end) == 0 {
+			weekTime = time.Date(2023, time.May, 14, 0, 0, 0, 0, time.UTC)
+		}
+		scanner := rtcm.NewScannerAt(bytes.NewReader(input), weekTime)
+		var output bytes.Buffer
+		count, err := e.extract(scanner, &output)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+
+		var want []byte
+		for _, frame := range td.want {
+			want = append(want, frame...)
+		}
+		if count != len(td.want) {
+			t.Errorf("%s: want %d messages got %d", td.description, len(td.want), count)
+		}
+		if !cmp.Equal(want, output.Bytes()) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(want, output.Bytes()))
+		}
+	}
+}
+
+// TestNewExtractorErrors checks the checks on the options.
+func TestNewExtractorErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		start       string
+		end         string
+		types       string
+		want        string
+	}{
+		{"bad start", "10:00", "", "",
+			`-start - parsing time "10:00" as "2006-01-02T15:04:05Z07:00": cannot parse "10:00" as "2006"`},
+		{"end before start", "2023-05-15T11:00:00Z", "2023-05-15T10:00:00+01:00", "",
+			"the start 2023-05-15T11:00:00Z is not before the end 2023-05-15T09:00:00Z"},
+		{"bad type", "", "", "1005,x", `illegal message type "x"`},
+	}
+	for _, td := range testData {
+		_, err := newExtractor(td.start, td.end, td.types)
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want error %s got %v", td.description, td.want, err)
+		}
+	}
+}
+
+// TestWeekTime checks the choice of the time from which the week is taken.
+func TestWeekTime(t *testing.T) {
+	e, err := newExtractor("", "2023-05-15T10:00:00Z", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2023, time.May, 11, 22, 0, 0, 0, time.UTC)
+	if got := e.weekTime(); !got.Equal(want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/decimate"
+	"github.com/goblimey/go-ntrip/demux"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/maintenance"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/notify"
+	"github.com/goblimey/go-ntrip/reposition"
+	"github.com/goblimey/go-ntrip/telemetry"
+	"github.com/goblimey/go-ntrip/transform"
+	"github.com/goblimey/go-ntrip/transport"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// dryRun checks the config and the things that it names without filtering
+// anything, so that mistakes show up before the filter is left running in a
+// shed at the bottom of the garden.  It opens and closes the input, the
+// output, the log directory and the NMEA beacon's sink, logs in to the MQTT
+// broker, looks for the transform command and checks the other sections of
+// the config.  It writes a report of what the filter would do to the given
+// writer and returns the first problem that it finds.
+func dryRun(config *config.Config, displayLocation *time.Location, input, output *os.File, report io.Writer) error {
+
+	if config.RTCMFilter.Listen != nil {
+		listener, listenError := transport.Listen(*config.RTCMFilter.Listen, nil)
+		if listenError != nil {
+			return exitcode.Wrap(exitcode.Config, listenError)
+		}
+		listener.Close()
+		fmt.Fprintf(report, "input: listening on %s\n", config.RTCMFilter.Listen.String())
+		input = nil
+	}
+
+	if config.RTCMFilter.Forward != nil {
+		forwarder, forwardError := transport.NewForwarder(*config.RTCMFilter.Forward, nil)
+		if forwardError != nil {
+			return exitcode.Wrap(exitcode.Config, forwardError)
+		}
+		checkError := forwarder.Check()
+		if checkError != nil {
+			return exitcode.Wrap(exitcode.InputUnavailable, checkError)
+		}
+		output = nil
+	}
+
+	for _, f := range []struct {
+		role string
+		file *os.File
+	}{{"input", input}, {"output", output}} {
+		if f.file == nil {
+			continue
+		}
+		info, statError := f.file.Stat()
+		if statError != nil {
+			return exitcode.Wrap(exitcode.InputUnavailable, statError)
+		}
+		fmt.Fprintf(report, "%s: %s (%s)\n", f.role, f.file.Name(), describeFile(info.Mode()))
+	}
+
+	if config.RTCMFilter.Forward != nil {
+		fmt.Fprintf(report, "output: forwarding to %s, connected and disconnected\n",
+			config.RTCMFilter.Forward.String())
+	}
+
+	filter, filterError := config.Filter.TypeFilter()
+	if filterError != nil {
+		return exitcode.Wrap(exitcode.Config, filterError)
+	}
+	if filter != nil {
+		fmt.Fprintf(report, "output types: %s\n", filter.String())
+	}
+
+	if config.Filter.StationPosition != nil {
+		r, repositionError := reposition.New(*config.Filter.StationPosition)
+		if repositionError != nil {
+			return exitcode.Wrap(exitcode.Config, repositionError)
+		}
+		fmt.Fprintf(report, "output station position: %s\n", r.String())
+	}
+
+	if config.Logging.DisplayMessages || config.Logging.RecordMessages {
+		directory := config.Logging.MessageLogDirectory
+		if len(directory) == 0 {
+			directory = "."
+		}
+		directoryError := checkDirectory(directory)
+		if directoryError != nil {
+			em := fmt.Sprintf("log directory %s - %v", directory, directoryError)
+			return exitcode.Wrap(exitcode.InputUnavailable, errors.New(em))
+		}
+		if config.Logging.DisplayMessages {
+			fmt.Fprintf(report, "readable log: %s/rtcm.*.txt, times in %s\n",
+				directory, displayLocation.String())
+		}
+		if config.Logging.RecordMessages {
+			fmt.Fprintf(report, "RTCM log: %s/rtcmfilter.*.rtcm\n", directory)
+		}
+		if config.Logging.RecordMessages && config.Logging.RecordDecimationSeconds > 0 {
+			interval := time.Duration(config.Logging.RecordDecimationSeconds) * time.Second
+			_, decimateError := decimate.New(interval)
+			if decimateError != nil {
+				return exitcode.Wrap(exitcode.Config, decimateError)
+			}
+			fmt.Fprintf(report, "RTCM log: epochs every %v\n", interval)
+		}
+	}
+
+	if config.Logging.LogHandlerEvents {
+		fmt.Fprintln(report, "handler events: counted and logged")
+	}
+
+	if queueError := checkQueues(config.RTCMFilter.Queues); queueError != nil {
+		return exitcode.Wrap(exitcode.Config, queueError)
+	}
+	for _, description := range describeQueues(config.RTCMFilter.Queues) {
+		fmt.Fprintf(report, "queue %s\n", description)
+	}
+
+	if config.RTCMFilter.MemorySoftCapMegabytes > 0 {
+		fmt.Fprintf(report, "memory: readable log stops above %d MB\n",
+			config.RTCMFilter.MemorySoftCapMegabytes)
+	}
+
+	if config.RTCMFilter.TimeCheck != nil {
+		fmt.Fprintf(report, "time check: against %s, threshold %v\n",
+			config.RTCMFilter.TimeCheck.Server, config.RTCMFilter.TimeCheck.Threshold())
+	}
+
+	if config.RTCMFilter.NMEABeacon != nil {
+		beacon, beaconError := nmea.NewBeacon(*config.RTCMFilter.NMEABeacon)
+		if beaconError != nil {
+			return exitcode.Wrap(exitcode.Config, beaconError)
+		}
+		sinkError := beacon.CheckSink()
+		if sinkError != nil {
+			em := fmt.Sprintf("NMEA beacon %s sink %s - %v",
+				config.RTCMFilter.NMEABeacon.Sink, config.RTCMFilter.NMEABeacon.Address, sinkError)
+			return exitcode.Wrap(exitcode.InputUnavailable, errors.New(em))
+		}
+		fmt.Fprintf(report, "NMEA beacon: %s sink %s opened and closed\n",
+			config.RTCMFilter.NMEABeacon.Sink, config.RTCMFilter.NMEABeacon.Address)
+	}
+
+	if len(config.RTCMFilter.MaintenanceWindows) > 0 {
+		_, scheduleError := maintenance.New(config.RTCMFilter.MaintenanceWindows, nil)
+		if scheduleError != nil {
+			return exitcode.Wrap(exitcode.Config, scheduleError)
+		}
+		fmt.Fprintf(report, "maintenance windows: %d\n", len(config.RTCMFilter.MaintenanceWindows))
+	}
+
+	if config.RTCMFilter.Notify != nil {
+		_, notifyError := notify.New(*config.RTCMFilter.Notify, nil)
+		if notifyError != nil {
+			return exitcode.Wrap(exitcode.Config, notifyError)
+		}
+		fmt.Fprintf(report, "notifications: for station %s, none sent\n", config.RTCMFilter.Notify.Station)
+	}
+
+	if config.RTCMFilter.Telemetry != nil {
+		_, telemetryError := telemetry.New(*config.RTCMFilter.Telemetry, version.String("rtcmfilter"), nil)
+		if telemetryError != nil {
+			return exitcode.Wrap(exitcode.Config, telemetryError)
+		}
+		fmt.Fprintf(report, "telemetry: to %s, none sent\n", config.RTCMFilter.Telemetry.Endpoint)
+	}
+
+	if config.RTCMFilter.Metrics != nil {
+		_, metricsError := metrics.New(*config.RTCMFilter.Metrics, nil)
+		if metricsError != nil {
+			return exitcode.Wrap(exitcode.Config, metricsError)
+		}
+		fmt.Fprintf(report, "metrics: on %s%s, not listening\n",
+			config.RTCMFilter.Metrics.ListenAddress, config.RTCMFilter.Metrics.EndpointPath())
+	}
+
+	if extrasError := checkExtras(config, report); extrasError != nil {
+		return extrasError
+	}
+
+	if len(config.Filter.TransformCommand) > 0 {
+		_, transformError := transform.New(config.Filter.TransformCommand, nil, nil)
+		if transformError != nil {
+			return exitcode.Wrap(exitcode.Config, transformError)
+		}
+		path, lookError := exec.LookPath(config.Filter.TransformCommand[0])
+		if lookError != nil {
+			return exitcode.Wrap(exitcode.Config, lookError)
+		}
+		fmt.Fprintf(report, "transform command: %s\n", path)
+	}
+
+	if config.RTCMFilter.Demux != nil {
+		_, demuxError := demux.New(config.RTCMFilter.Demux, 0)
+		if demuxError != nil {
+			return exitcode.Wrap(exitcode.Config, demuxError)
+		}
+		fmt.Fprintf(report, "demux: %d stations mapped to mountpoints\n",
+			len(config.RTCMFilter.Demux.Stations))
+		directory := config.RTCMFilter.Demux.LogDirectory
+		if len(directory) > 0 {
+			directoryError := checkDirectory(directory)
+			if directoryError != nil {
+				em := fmt.Sprintf("station log directory %s - %v", directory, directoryError)
+				return exitcode.Wrap(exitcode.InputUnavailable, errors.New(em))
+			}
+			fmt.Fprintf(report, "station logs: %s/*.rtcm\n", directory)
+		}
+	}
+
+	if config.Filter.ReorderWindowMilliseconds > 0 {
+		fmt.Fprintf(report, "reorder window: %dms\n", config.Filter.ReorderWindowMilliseconds)
+	}
+
+	fmt.Fprintln(report, "dry run - would filter the input to the output, nothing read")
+
+	return nil
+}
+
+// checkDirectory checks that files can be created in the directory by
+// creating one and removing it again.
+func checkDirectory(directory string) error {
+	file, createError := os.CreateTemp(directory, ".rtcmfilter-dry-run-")
+	if createError != nil {
+		return createError
+	}
+	name := file.Name()
+	file.Close()
+	return os.Remove(name)
+}
+
+// describeFile says what sort of file the mode describes.
+func describeFile(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "pipe"
+	case mode&os.ModeCharDevice != 0:
+		return "device or terminal"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode.IsRegular():
+		return "file"
+	default:
+		return "unknown"
+	}
+}
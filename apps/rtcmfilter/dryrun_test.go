@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/demux"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/queue"
+	"github.com/goblimey/go-ntrip/reposition"
+	"github.com/goblimey/go-ntrip/transport"
+)
+
+// tempFile is a helper function.  It creates an empty file that's removed
+// at the end of the test.
+func tempFile(t *testing.T) *os.File {
+	file, err := os.CreateTemp(t.TempDir(), "dryrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+// TestDryRun checks that a dry run opens the things that the config names
+// and reports what the filter would do.
+func TestDryRun(t *testing.T) {
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	logDirectory := t.TempDir()
+	input := tempFile(t)
+	output := tempFile(t)
+
+	cfg := config.Config{
+		Logging: config.Logging{
+			DisplayMessages:     true,
+			RecordMessages:      true,
+			MessageLogDirectory: logDirectory,
+			LogHandlerEvents:    true,
+		},
+		Filter: config.Filter{
+			TransformCommand:          []string{"cat"},
+			ReorderWindowMilliseconds: 200,
+			DropTypes:                 []int{1230, 1004},
+			DropSubTypes:              []string{"4072.1"},
+			StationPosition:           &reposition.Config{X: 3978364.8574, Y: -12345.6789, Z: 4968423.4712},
+		},
+		RTCMFilter: config.RTCMFilter{
+			Queues:     map[string]queue.Config{"display": {Size: 1000}, "output": {Policy: "drop_oldest"}},
+			NMEABeacon: &nmea.BeaconConfig{Sink: "tcp", Address: listener.Addr().String()},
+			Metrics:    &metrics.Config{ListenAddress: ":9100"},
+			Demux: &demux.Config{
+				Stations:     []demux.Station{{ID: 42, Mountpoint: "SHED"}},
+				LogDirectory: logDirectory,
+			},
+		},
+	}
+
+	var report bytes.Buffer
+	err := dryRun(&cfg, time.UTC, input, output, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catPath, _ := exec.LookPath("cat")
+	wantLines := []string{
+		"input: " + input.Name() + " (file)",
+		"output: " + output.Name() + " (file)",
+		"output types: drop 1004,1230,4072.1",
+		"output station position: (3978364.8574, -12345.6789, 4968423.4712) metres",
+		"readable log: " + logDirectory + "/rtcm.*.txt, times in UTC",
+		"RTCM log: " + logDirectory + "/rtcmfilter.*.rtcm",
+		"handler events: counted and logged",
+		"queue display: 1000 messages, drop_oldest",
+		"queue output: 256 messages, drop_oldest",
+		"NMEA beacon: tcp sink " + listener.Addr().String() + " opened and closed",
+		"metrics: on :9100/metrics, not listening",
+		"transform command: " + catPath,
+		"demux: 1 stations mapped to mountpoints",
+		"station logs: " + logDirectory + "/*.rtcm",
+		"reorder window: 200ms",
+		"dry run - would filter the input to the output, nothing read",
+	}
+	want := strings.Join(wantLines, "\n") + "\n"
+	if report.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, report.String())
+	}
+
+	// The check of the log directory leaves nothing behind.
+	entries, _ := os.ReadDir(logDirectory)
+	if len(entries) != 0 {
+		t.Errorf("want an empty log directory, got %d entries", len(entries))
+	}
+}
+
+// TestDryRunWithErrors checks that a dry run reports the first problem with
+// the right exit status.
+func TestDryRunWithErrors(t *testing.T) {
+	missingDirectory := filepath.Join(t.TempDir(), "nosuchdirectory")
+
+	// Get an address that nothing is listening on.
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadAddress := listener.Addr().String()
+	listener.Close()
+
+	var testData = []struct {
+		description string
+		config      config.Config
+		wantPrefix  string
+		wantCode    int
+	}{
+		{
+			"missing log directory",
+			config.Config{Logging: config.Logging{RecordMessages: true, MessageLogDirectory: missingDirectory}},
+			"log directory " + missingDirectory + " - ",
+			exitcode.InputUnavailable,
+		},
+		{
+			"bad NMEA sink",
+			config.Config{RTCMFilter: config.RTCMFilter{NMEABeacon: &nmea.BeaconConfig{Sink: "udp"}}},
+			`NMEA sink "udp" - want serial or tcp`,
+			exitcode.Config,
+		},
+		{
+			"unreachable NMEA sink",
+			config.Config{RTCMFilter: config.RTCMFilter{NMEABeacon: &nmea.BeaconConfig{Sink: "tcp", Address: deadAddress}}},
+			"NMEA beacon tcp sink " + deadAddress + " - ",
+			exitcode.InputUnavailable,
+		},
+		{
+			"bad metrics address",
+			config.Config{RTCMFilter: config.RTCMFilter{Metrics: &metrics.Config{ListenAddress: "9100"}}},
+			`metrics - the listen address "9100" is not host:port`,
+			exitcode.Config,
+		},
+		{
+			"bad demux",
+			config.Config{RTCMFilter: config.RTCMFilter{Demux: &demux.Config{Stations: []demux.Station{{ID: 42}}}}},
+			"demux - station 42 - want a mountpoint",
+			exitcode.Config,
+		},
+		{
+			"missing station log directory",
+			config.Config{RTCMFilter: config.RTCMFilter{Demux: &demux.Config{LogDirectory: missingDirectory}}},
+			"station log directory " + missingDirectory + " - ",
+			exitcode.InputUnavailable,
+		},
+		{
+			"bad type filter",
+			config.Config{Filter: config.Filter{ForwardTypes: []int{1005, 1230}, DropTypes: []int{1230}}},
+			"typefilter - message type 1230 is both forwarded and dropped",
+			exitcode.Config,
+		},
+		{
+			"unknown queue",
+			config.Config{RTCMFilter: config.RTCMFilter{Queues: map[string]queue.Config{"displya": {}}}},
+			`queues - no stage called "displya"`,
+			exitcode.Config,
+		},
+		{
+			"bad queue policy",
+			config.Config{RTCMFilter: config.RTCMFilter{Queues: map[string]queue.Config{"display": {Policy: "drop"}}}},
+			`queues - display - queue - unknown policy "drop", want block or drop_oldest`,
+			exitcode.Config,
+		},
+		{
+			"bad sub-type filter",
+			config.Config{Filter: config.Filter{DropSubTypes: []string{"1230.1"}}},
+			"typefilter - message type 1230 has no sub-types",
+			exitcode.Config,
+		},
+		{
+			"bad station position",
+			config.Config{Filter: config.Filter{StationPosition: &reposition.Config{X: 1, Y: 2, Z: 3}}},
+			"reposition - position (1.0000, 2.0000, 3.0000) is 4 metres from the centre of the earth",
+			exitcode.Config,
+		},
+		{
+			"bad listen network",
+			config.Config{RTCMFilter: config.RTCMFilter{Listen: &transport.Config{Network: "serial", Address: ":5000"}}},
+			`transport - network "serial" - want tcp, udp or rtp`,
+			exitcode.Config,
+		},
+		{
+			"unreachable forward endpoint",
+			config.Config{RTCMFilter: config.RTCMFilter{Forward: &transport.Config{Address: deadAddress}}},
+			"transport - cannot connect to tcp " + deadAddress + " - ",
+			exitcode.InputUnavailable,
+		},
+		{
+			"missing transform command",
+			config.Config{Filter: config.Filter{TransformCommand: []string{"no-such-command-anywhere"}}},
+			`exec: "no-such-command-anywhere"`,
+			exitcode.Config,
+		},
+	}
+
+	for _, td := range testData {
+		var report bytes.Buffer
+		err := dryRun(&td.config, time.UTC, tempFile(t), tempFile(t), &report)
+		if err == nil {
+			t.Errorf("%s: want an error", td.description)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), td.wantPrefix) {
+			t.Errorf("%s: want an error starting %s got %s", td.description, td.wantPrefix, err.Error())
+		}
+		if exitcode.Code(err) != td.wantCode {
+			t.Errorf("%s: want exit status %d got %d", td.description, td.wantCode, exitcode.Code(err))
+		}
+	}
+}
+
+// TestDryRunWithTransports checks that a dry run reports the network input
+// and output in place of the files.
+func TestDryRunWithTransports(t *testing.T) {
+	endpoint, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer endpoint.Close()
+	go func() {
+		for {
+			conn, err := endpoint.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	cfg := config.Config{
+		RTCMFilter: config.RTCMFilter{
+			Listen:  &transport.Config{Network: "udp", Address: "127.0.0.1:0"},
+			Forward: &transport.Config{Address: endpoint.Addr().String()},
+		},
+	}
+
+	var report bytes.Buffer
+	err := dryRun(&cfg, time.UTC, tempFile(t), tempFile(t), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines := []string{
+		"input: listening on udp 127.0.0.1:0",
+		"output: forwarding to tcp " + endpoint.Addr().String() + ", connected and disconnected",
+		"dry run - would filter the input to the output, nothing read",
+	}
+	want := strings.Join(wantLines, "\n") + "\n"
+	if report.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, report.String())
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/dashboard"
+	"github.com/goblimey/go-ntrip/exitcode"
+)
+
+// The status dashboard.  See extras.go.
+
+func init() {
+	register("dashboard", extra{start: startDashboard, check: checkDashboard})
+}
+
+// startDashboard starts serving the status page and, if the config has a
+// caster section, checking that the caster can be reached.
+func startDashboard(config *config.Config, logger *log.Logger) (func(MessageChannel), error) {
+	d, dashboardError := dashboard.New(*config.RTCMFilter.Dashboard, logger)
+	if dashboardError != nil {
+		return nil, dashboardError
+	}
+	listenError := d.Listen()
+	if listenError != nil {
+		return nil, listenError
+	}
+	go d.Run(nil)
+	if casterAddress := config.Caster.Address(); len(casterAddress) > 0 {
+		go d.WatchCaster(casterAddress, casterWatchInterval, nil)
+	}
+
+	return func(ch MessageChannel) { observeMessages(ch, d) }, nil
+}
+
+// checkDashboard checks the dashboard section of the config for a dry run.
+func checkDashboard(config *config.Config, report io.Writer) error {
+	_, dashboardError := dashboard.New(*config.RTCMFilter.Dashboard, nil)
+	if dashboardError != nil {
+		return exitcode.Wrap(exitcode.Config, dashboardError)
+	}
+	fmt.Fprintf(report, "dashboard: on %s, not listening\n", config.RTCMFilter.Dashboard.ListenAddress)
+	return nil
+}
+
+// observeMessages receives the messages from the channel and gives them to
+// the status dashboard.  It terminates when the channel is closed.  It can
+// be run in a go routine.
+func observeMessages(ch MessageChannel, d *dashboard.Dashboard) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+		d.Observe(&message)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/health"
+)
+
+// The health checks.  See extras.go.
+
+func init() {
+	register("health", extra{start: startHealth, check: checkHealthConfig})
+}
+
+// startHealth starts serving the health checks and, if the config has a
+// caster section, checking that the caster can be reached.
+func startHealth(config *config.Config, logger *log.Logger) (func(MessageChannel), error) {
+	c, healthError := health.New(*config.RTCMFilter.Health, logger)
+	if healthError != nil {
+		return nil, healthError
+	}
+	listenError := c.Listen()
+	if listenError != nil {
+		return nil, listenError
+	}
+	go c.Run(nil)
+	if casterAddress := config.Caster.Address(); len(casterAddress) > 0 {
+		go c.WatchCaster(casterAddress, casterWatchInterval, nil)
+	}
+
+	return func(ch MessageChannel) { checkHealth(ch, c) }, nil
+}
+
+// checkHealthConfig checks the health section of the config for a dry run.
+func checkHealthConfig(config *config.Config, report io.Writer) error {
+	_, healthError := health.New(*config.RTCMFilter.Health, nil)
+	if healthError != nil {
+		return exitcode.Wrap(exitcode.Config, healthError)
+	}
+	fmt.Fprintf(report, "health checks: on %s, stale after %v, not listening\n",
+		config.RTCMFilter.Health.ListenAddress, config.RTCMFilter.Health.StaleAfter())
+	return nil
+}
+
+// checkHealth receives the messages from the channel and gives them to the
+// health checker.  It terminates when the channel is closed.  It can be run
+// in a go routine.
+func checkHealth(ch MessageChannel, checker *health.Checker) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+		checker.Observe(&message)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/mqtt"
+)
+
+// The MQTT publisher.  See extras.go.
+
+func init() {
+	register("mqtt", extra{start: startMQTT, check: checkMQTT})
+}
+
+// startMQTT sets up the publisher.  It connects to the broker when it
+// publishes the first message.
+func startMQTT(config *config.Config, logger *log.Logger) (func(MessageChannel), error) {
+	p, mqttError := mqtt.New(*config.RTCMFilter.MQTT, logger)
+	if mqttError != nil {
+		return nil, mqttError
+	}
+
+	return func(ch MessageChannel) { publishMessages(ch, p) }, nil
+}
+
+// checkMQTT checks the mqtt section of the config for a dry run by logging
+// in to the broker and out again.
+func checkMQTT(config *config.Config, report io.Writer) error {
+	publisher, mqttError := mqtt.New(*config.RTCMFilter.MQTT, nil)
+	if mqttError != nil {
+		return exitcode.Wrap(exitcode.Config, mqttError)
+	}
+	checkError := publisher.Check()
+	if checkError != nil {
+		return exitcode.Wrap(exitcode.InputUnavailable, checkError)
+	}
+	fmt.Fprintf(report, "MQTT: broker %s connected and disconnected, topic %s\n",
+		config.RTCMFilter.MQTT.Broker, config.RTCMFilter.MQTT.TopicTemplate())
+	if len(config.RTCMFilter.MQTT.JSONTopic) > 0 {
+		fmt.Fprintf(report, "MQTT: JSON topic %s\n", config.RTCMFilter.MQTT.JSONTopic)
+	}
+	return nil
+}
+
+// publishMessages receives the messages from the channel and publishes
+// them to the MQTT broker.  It terminates when the channel is closed.  It
+// can be run in a go routine.
+func publishMessages(ch MessageChannel, publisher *mqtt.Publisher) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			publisher.Close()
+			return
+		}
+		publisher.Publish(&message)
+	}
+}
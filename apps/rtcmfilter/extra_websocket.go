@@ -0,0 +1,59 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/websocket"
+)
+
+// The WebSocket server.  See extras.go.
+
+func init() {
+	register("websocket", extra{start: startWebSocket, check: checkWebSocket})
+}
+
+// startWebSocket starts serving the messages over WebSocket.
+func startWebSocket(config *config.Config, logger *log.Logger) (func(MessageChannel), error) {
+	w, webSocketError := websocket.New(*config.RTCMFilter.WebSocket, logger)
+	if webSocketError != nil {
+		return nil, webSocketError
+	}
+	listenError := w.Listen()
+	if listenError != nil {
+		return nil, listenError
+	}
+	go w.Run(nil)
+
+	return func(ch MessageChannel) { streamMessages(ch, w) }, nil
+}
+
+// checkWebSocket checks the websocket section of the config for a dry run.
+func checkWebSocket(config *config.Config, report io.Writer) error {
+	_, webSocketError := websocket.New(*config.RTCMFilter.WebSocket, nil)
+	if webSocketError != nil {
+		return exitcode.Wrap(exitcode.Config, webSocketError)
+	}
+	fmt.Fprintf(report, "WebSocket: on %s%s, not listening\n",
+		config.RTCMFilter.WebSocket.ListenAddress, config.RTCMFilter.WebSocket.EndpointPath())
+	return nil
+}
+
+// streamMessages receives the messages from the channel and sends them to
+// the WebSocket subscribers.  It terminates when the channel is closed.  It
+// can be run in a go routine.
+func streamMessages(ch MessageChannel, server *websocket.Server) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+		server.Publish(&message)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+)
+
+// The subsystems that serve or publish the messages over the network - the
+// status dashboard, the WebSocket server, the health checks and the MQTT
+// publisher - are extras.  Each one registers itself from a file of its own
+// which is left out when the filter is built with the tag "minimal":
+//
+//	go build -tags minimal ./apps/rtcmfilter
+//
+// so that a filter for a small embedded machine doesn't carry code that it
+// will never run.  A minimal filter refuses to start if its config asks for
+// one of the missing extras.  The metrics are not an extra, since the
+// device reader counts its reconnections with them.
+
+// An extra is one of the optional subsystems.
+type extra struct {
+	// start sets the extra up from the config and returns the function
+	// that its stage runs.
+	start func(config *config.Config, logger *log.Logger) (func(MessageChannel), error)
+
+	// check checks the extra's part of the config for a dry run and writes
+	// a report of what the filter would do with it.
+	check func(config *config.Config, report io.Writer) error
+}
+
+// extraNames lists the extras, built in or not, in the order in which they
+// are started, each with a function that says whether the config asks for
+// it.  The name is also the name of the extra's stage.
+var extraNames = []struct {
+	name       string
+	configured func(*config.Config) bool
+}{
+	{"dashboard", func(c *config.Config) bool { return c.RTCMFilter.Dashboard != nil }},
+	{"websocket", func(c *config.Config) bool { return c.RTCMFilter.WebSocket != nil }},
+	{"health", func(c *config.Config) bool { return c.RTCMFilter.Health != nil }},
+	{"mqtt", func(c *config.Config) bool { return c.RTCMFilter.MQTT != nil }},
+}
+
+// extras holds the extras built into the filter, by name.
+var extras = make(map[string]extra)
+
+// register adds an extra to the filter.  It's called from the init function
+// in the extra's file.
+func register(name string, e extra) {
+	extras[name] = e
+}
+
+// extraStage is the stage of an extra that has been started.
+type extraStage struct {
+	name string
+	run  func(MessageChannel)
+}
+
+// runningExtras holds the stages of the extras started by main.
+var runningExtras []extraStage
+
+// startExtras starts the extras that the config asks for and returns their
+// stages.  It returns an error if the config asks for one that isn't built
+// into the filter.
+func startExtras(config *config.Config, logger *log.Logger) ([]extraStage, error) {
+	var started []extraStage
+	for _, x := range extraNames {
+		if !x.configured(config) {
+			continue
+		}
+		e, builtIn := extras[x.name]
+		if !builtIn {
+			return nil, missingExtra(x.name)
+		}
+		run, startError := e.start(config, logger)
+		if startError != nil {
+			return nil, startError
+		}
+		started = append(started, extraStage{name: x.name, run: run})
+	}
+	return started, nil
+}
+
+// checkExtras checks the parts of the config that belong to the extras for
+// a dry run.
+func checkExtras(config *config.Config, report io.Writer) error {
+	for _, x := range extraNames {
+		if !x.configured(config) {
+			continue
+		}
+		e, builtIn := extras[x.name]
+		if !builtIn {
+			return exitcode.Wrap(exitcode.Config, missingExtra(x.name))
+		}
+		if checkError := e.check(config, report); checkError != nil {
+			return checkError
+		}
+	}
+	return nil
+}
+
+// missingExtra returns the error for a config that asks for an extra that
+// isn't built into the filter.
+func missingExtra(name string) error {
+	em := fmt.Sprintf("the config has a %s section but this filter was built without it", name)
+	return errors.New(em)
+}
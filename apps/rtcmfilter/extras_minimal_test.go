@@ -0,0 +1,59 @@
+//go:build minimal
+// +build minimal
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/dashboard"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/health"
+	"github.com/goblimey/go-ntrip/mqtt"
+	"github.com/goblimey/go-ntrip/websocket"
+)
+
+// TestMissingExtras checks that a minimal filter refuses a config that asks
+// for one of the extras.
+func TestMissingExtras(t *testing.T) {
+	var testData = []struct {
+		name   string
+		config config.Config
+	}{
+		{"dashboard", config.Config{RTCMFilter: config.RTCMFilter{Dashboard: &dashboard.Config{ListenAddress: ":8080"}}}},
+		{"websocket", config.Config{RTCMFilter: config.RTCMFilter{WebSocket: &websocket.Config{ListenAddress: ":2102"}}}},
+		{"health", config.Config{RTCMFilter: config.RTCMFilter{Health: &health.Config{ListenAddress: ":8081"}}}},
+		{"mqtt", config.Config{RTCMFilter: config.RTCMFilter{MQTT: &mqtt.Config{Broker: "broker.example.com:1883"}}}},
+	}
+
+	if len(extras) != 0 {
+		t.Errorf("want no extras, got %d", len(extras))
+	}
+
+	for _, td := range testData {
+		want := "the config has a " + td.name + " section but this filter was built without it"
+
+		_, startError := startExtras(&td.config, nil)
+		if startError == nil {
+			t.Errorf("%s: want an error from startExtras", td.name)
+		} else if startError.Error() != want {
+			t.Errorf("%s: want %s got %s", td.name, want, startError.Error())
+		}
+
+		var report bytes.Buffer
+		dryRunError := dryRun(&td.config, time.UTC, tempFile(t), tempFile(t), &report)
+		if dryRunError == nil {
+			t.Errorf("%s: want an error from dryRun", td.name)
+			continue
+		}
+		if dryRunError.Error() != want {
+			t.Errorf("%s: want %s got %s", td.name, want, dryRunError.Error())
+		}
+		if exitcode.Code(dryRunError) != exitcode.Config {
+			t.Errorf("%s: want exit status %d got %d", td.name, exitcode.Config, exitcode.Code(dryRunError))
+		}
+	}
+}
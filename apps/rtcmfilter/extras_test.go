@@ -0,0 +1,123 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/dashboard"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/health"
+	"github.com/goblimey/go-ntrip/mqtt"
+	"github.com/goblimey/go-ntrip/websocket"
+)
+
+// TestExtrasRegistered checks that a full build has all of the extras.
+func TestExtrasRegistered(t *testing.T) {
+	for _, x := range extraNames {
+		if _, ok := extras[x.name]; !ok {
+			t.Errorf("%s is not registered", x.name)
+		}
+	}
+}
+
+// TestDryRunWithExtras checks that a dry run reports the extras.
+func TestDryRunWithExtras(t *testing.T) {
+	input := tempFile(t)
+	output := tempFile(t)
+
+	cfg := config.Config{
+		RTCMFilter: config.RTCMFilter{
+			Dashboard: &dashboard.Config{ListenAddress: ":8080"},
+			Health:    &health.Config{ListenAddress: ":8081"},
+			WebSocket: &websocket.Config{ListenAddress: ":2102"},
+		},
+	}
+
+	var report bytes.Buffer
+	err := dryRun(&cfg, time.UTC, input, output, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines := []string{
+		"input: " + input.Name() + " (file)",
+		"output: " + output.Name() + " (file)",
+		"dashboard: on :8080, not listening",
+		"WebSocket: on :2102/rtcm, not listening",
+		"health checks: on :8081, stale after 30s, not listening",
+		"dry run - would filter the input to the output, nothing read",
+	}
+	want := strings.Join(wantLines, "\n") + "\n"
+	if report.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, report.String())
+	}
+}
+
+// TestDryRunWithExtrasErrors checks that a dry run reports the problems
+// with the config of the extras with the right exit status.
+func TestDryRunWithExtrasErrors(t *testing.T) {
+	// Get an address that nothing is listening on.
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadAddress := listener.Addr().String()
+	listener.Close()
+
+	var testData = []struct {
+		description string
+		config      config.Config
+		wantPrefix  string
+		wantCode    int
+	}{
+		{
+			"bad dashboard address",
+			config.Config{RTCMFilter: config.RTCMFilter{Dashboard: &dashboard.Config{ListenAddress: "8080"}}},
+			`dashboard - the listen address "8080" is not host:port`,
+			exitcode.Config,
+		},
+		{
+			"bad health address",
+			config.Config{RTCMFilter: config.RTCMFilter{Health: &health.Config{ListenAddress: "8081"}}},
+			`health - the listen address "8081" is not host:port`,
+			exitcode.Config,
+		},
+		{
+			"bad MQTT topic",
+			config.Config{RTCMFilter: config.RTCMFilter{MQTT: &mqtt.Config{Broker: deadAddress, Topic: "rtcm/+"}}},
+			`mqtt - topic "rtcm/+" - wildcards are not allowed in a published topic`,
+			exitcode.Config,
+		},
+		{
+			"unreachable MQTT broker",
+			config.Config{RTCMFilter: config.RTCMFilter{MQTT: &mqtt.Config{Broker: deadAddress}}},
+			"mqtt - cannot connect to " + deadAddress + " - ",
+			exitcode.InputUnavailable,
+		},
+		{
+			"bad WebSocket path",
+			config.Config{RTCMFilter: config.RTCMFilter{WebSocket: &websocket.Config{ListenAddress: ":2102", Path: "rtcm"}}},
+			`websocket - the path "rtcm" doesn't start with /`,
+			exitcode.Config,
+		},
+	}
+
+	for _, td := range testData {
+		var report bytes.Buffer
+		err := dryRun(&td.config, time.UTC, tempFile(t), tempFile(t), &report)
+		if err == nil {
+			t.Errorf("%s: want an error", td.description)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), td.wantPrefix) {
+			t.Errorf("%s: want an error starting %s got %s", td.description, td.wantPrefix, err.Error())
+		}
+		if exitcode.Code(err) != td.wantCode {
+			t.Errorf("%s: want exit status %d got %d", td.description, td.wantCode, exitcode.Code(err))
+		}
+	}
+}
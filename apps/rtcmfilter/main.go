@@ -7,38 +7,17 @@
 // the details of the USB connection and transmits messages on
 // stdout, so we can connect it to this via a pipe.
 //
-// When the application starts up it looks for a JSON config file
-// ntrip.json in the current directory.  The config settings define
-// which processor functions are run, so the results will be different
-// depending on the config.  For example:
-//
-//	{
-//	    "display_messages": true,
-//      "record_messages": true,
-//      "log_directory": "rtcmlog"
-//	}
+// The settings in the config file given by the -c option define which
+// processor functions are run.  The file is read by the config package.
+// The settings are described in README.md.
 //
 // The incoming data is assumed to contain bursts of RTCM3 messages
-// interspersed with other data such as NMEA sentences.  All
-// data is presented as rtcm.Message objects, each with a message type.
-// There is a special message type for non-RTCM3 data.
-//
-// The incoming stream of data can be a mixture of RTCM and other
-// messages.  It's assumed to come from a GNSS device which is
-// issuing messages continuously, for example a Ublox ZED-FP9 sending
-// data on a serial USB, IRC or RS/232 connection.  Some of these media
-// are prone to dropping or scrambling the occasional character.  That
-// will cause the message's CRC check to fail and the message will be
-// deemed invalid.
-//
-// The application starts a new log file each day with a datestamped
-// name (such as "filter.2024-08-31.rtcm"), so each log file contains
-// data collected in one day.
-//
-// The filter can be used to clean up a stream of incoming data by
-// filtering out the non-RTCM data and any RTCM messages that are
-// corrupted in transit and sending only valid RTCM messages along a
-// pipe to software such as an NTRIP client:
+// interspersed with other data such as NMEA sentences.  Some of the
+// media that carry it are prone to dropping or scrambling the occasional
+// character, which causes the message's CRC check to fail.  The filter
+// can clean up the stream by dropping the non-RTCM data and the corrupted
+// messages, sending only valid RTCM messages along a pipe to software
+// such as an NTRIP client:
 //
 //		      RTCM and                                        RTCM
 //	 ------   other data                                      data  ------
@@ -46,10 +25,21 @@
 //	|device|  serial USB                      pipe            pipe |client|
 //	 ------   connection                                            ------
 //
-// Another potential use is to capture the incoming RTCM messages, and
-// record files of RTCM messages.  These can be converted into RINEX
-// format for Precise Point Positioning (PPP) processing.  PPP can be
-// used to find the correct position of a fixed base station.
+// It can also record the messages in daily files, which can be converted
+// into RINEX format for Precise Point Positioning (PPP).
+//
+// The -dry-run option checks the config, opens and closes the input, the
+// output and the other resources and reports what the filter would do,
+// without reading any data.  The -support-bundle option captures a minute
+// of input and writes it to a gzipped tar file with the redacted config and
+// the recent logs, for reporting a problem.  See the bundle package.
+//
+// Built with the tag "minimal", the filter leaves out the dashboard, the
+// health checks, the MQTT publisher and the WebSocket server, and refuses
+// to start if the config asks for any of them.
+//
+// If the program can't start, it stops with one of the exit statuses listed
+// in the exitcode package.
 
 package main
 
@@ -58,19 +48,112 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	AppCore "github.com/goblimey/go-ntrip/apps/appcore"
-	"github.com/goblimey/go-ntrip/apps/rtcmfilter/config"
+	"github.com/goblimey/go-ntrip/bundle"
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/decimate"
+	"github.com/goblimey/go-ntrip/demux"
+	"github.com/goblimey/go-ntrip/exitcode"
 	"github.com/goblimey/go-ntrip/jsonconfig"
+	"github.com/goblimey/go-ntrip/leapseconds"
+	"github.com/goblimey/go-ntrip/logrotate"
+	"github.com/goblimey/go-ntrip/maintenance"
+	"github.com/goblimey/go-ntrip/memorymonitor"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/notify"
+	"github.com/goblimey/go-ntrip/reorder"
+	"github.com/goblimey/go-ntrip/reposition"
+	"github.com/goblimey/go-ntrip/rtcm/changes"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
 	"github.com/goblimey/go-ntrip/rtcm/utils"
-	"github.com/goblimey/go-tools/dailylogger"
+	"github.com/goblimey/go-ntrip/rtp"
+	"github.com/goblimey/go-ntrip/stats"
+	"github.com/goblimey/go-ntrip/telemetry"
+	"github.com/goblimey/go-ntrip/timecheck"
+	"github.com/goblimey/go-ntrip/transform"
+	"github.com/goblimey/go-ntrip/transport"
+	"github.com/goblimey/go-ntrip/typefilter"
+	"github.com/goblimey/go-ntrip/version"
 )
 
 type MessageChannel chan rtcm.Message
 
+// casterWatchInterval is the time between the checks that the caster can
+// be reached made by the dashboard and the health checker.  See extras.go.
+const casterWatchInterval = time.Minute
+
+// lossReportInterval is the time between reports of the RTP packets lost.
+const lossReportInterval = time.Minute
+
+// eventLogDirectory is the directory holding the daily event logs.  See
+// utils.GetDailyLogger.
+const eventLogDirectory = "logs"
+
+// eventBufferSize is the number of the RTCM handler's events that can wait
+// to be logged.  More are dropped.
+const eventBufferSize = 100
+
+// displayShed is set to 1 when the memory monitor asks for the readable
+// display to be shed.  It's accessed atomically.
+var displayShed int32
+
+// nmeaBeacon sends the base position as NMEA sentences.  It's nil unless
+// the config asks for it.
+var nmeaBeacon *nmea.Beacon
+
+// notifier sends notifications of critical events.  It's nil unless the
+// config asks for it.
+var notifier *notify.Notifier
+
+// reorderWindow is the time for which messages are held to put them into
+// order.  Zero means that they are not reordered.
+var reorderWindow time.Duration
+
+// recordDecimator thins out the recorded messages.  It's nil unless the
+// config asks for it.
+var recordDecimator *decimate.Decimator
+
+// transformer passes the messages through an external command.  It's nil
+// unless the config asks for it.
+var transformer *transform.Transformer
+
+// reporter sends anonymous statistics to the maintainers.  It's nil unless
+// the config asks for it.
+var reporter *telemetry.Reporter
+
+// metricsRegistry serves the running figures to Prometheus.  It's nil
+// unless the config asks for it.
+var metricsRegistry *metrics.Registry
+
+// observationStats keeps rolling statistics of the observations for the
+// metrics.  It's nil unless the config asks for metrics.
+var observationStats *stats.Aggregator
+
+// typeFilter chooses the message types written to the output.  It's nil
+// unless the config asks for it.
+var typeFilter *typefilter.Filter
+
+// repositioner replaces the base position in the output.  It's nil unless
+// the config asks for it.
+var repositioner *reposition.Repositioner
+
+// demultiplexer records the messages of each station separately.  It's nil
+// unless the config asks for it.
+var demultiplexer *demux.Demultiplexer
+
+// changeWatcher, if set, stops the readable display repeating messages
+// that describe the station unless they change.
+var changeWatcher *changes.Watcher
+
 func main() {
 
 	// logger writes to the daily event log.
@@ -81,31 +164,265 @@ func main() {
 	flag.StringVar(&configFileName, "c", "", "JSON config file")
 	flag.StringVar(&configFileName, "config", "", "JSON config file")
 
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
+	var bundleFileName string
+	var captureTime time.Duration
+	flag.StringVar(&bundleFileName, "support-bundle", "",
+		"write a support bundle to the given file and stop")
+	flag.DurationVar(&captureTime, "capture", bundle.DefaultCaptureTime,
+		"time for which the input is captured for a support bundle")
+
+	var dryRunOnly bool
+	flag.BoolVar(&dryRunOnly, "dry-run", false,
+		"check the config, the input and the outputs, then stop without filtering")
+
 	flag.Parse()
 
+	if showVersion {
+		fmt.Println(version.String("rtcmfilter"))
+		os.Exit(0)
+	}
+
 	if len(configFileName) == 0 {
 		logger.Println("missing config file: -c or --config")
-		os.Exit(-1)
+		os.Exit(exitcode.Config)
 	}
 
 	// Get the config.
-	config, errConfig := config.GetConfig(configFileName)
+	config, errConfig := config.Load(configFileName)
 
-	_ = config
 	if errConfig != nil {
 		logger.Println(errConfig.Error())
-		os.Exit(-1)
+		os.Exit(exitcode.Config)
+	}
+
+	if len(bundleFileName) > 0 {
+		if err := makeSupportBundle(bundleFileName, config, captureTime); err != nil {
+			logger.Println(err.Error())
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitcode.IOError)
+		}
+		os.Exit(0)
+	}
+
+	jc := jsonconfig.New(config, nil)
+
+	displayLocation, locationError := config.Logging.DisplayLocation()
+	if locationError != nil {
+		logger.Println(locationError.Error())
+		os.Exit(exitcode.Config)
+	}
+
+	if len(config.Input.LeapSecondsFile) > 0 {
+		leaps, leapError := leapseconds.Load(config.Input.LeapSecondsFile)
+		if leapError != nil {
+			logger.Println(leapError.Error())
+			os.Exit(exitcode.Config)
+		}
+		leapseconds.SetDefault(leaps)
+	}
+
+	if queueError := checkQueues(config.RTCMFilter.Queues); queueError != nil {
+		logger.Println(queueError.Error())
+		os.Exit(exitcode.Config)
+	}
+
+	if dryRunOnly {
+		// The standard output is where the filtered messages go, so the
+		// report goes to the standard error channel.
+		dryRunError := dryRun(config, displayLocation, os.Stdin, os.Stdout, os.Stderr)
+		if dryRunError != nil {
+			logger.Println(dryRunError.Error())
+			fmt.Fprintln(os.Stderr, dryRunError.Error())
+			os.Exit(exitcode.Code(dryRunError))
+		}
+		os.Exit(0)
+	}
+
+	queueConfigs = config.RTCMFilter.Queues
+
+	if config.RTCMFilter.MemorySoftCapMegabytes > 0 {
+		softCap := config.RTCMFilter.MemorySoftCapMegabytes * memorymonitor.Megabyte
+		interval := time.Duration(config.RTCMFilter.MemoryCheckIntervalSeconds) * time.Second
+		monitor := memorymonitor.New(softCap, interval, logger)
+		monitor.OnSoftCapExceeded(shedDisplay)
+		go monitor.Run(nil)
+	}
+
+	if config.RTCMFilter.TimeCheck != nil && !checkTime(config.RTCMFilter.TimeCheck, logger) {
+		logger.Println("the system clock is wrong close to a weekly rollover - not starting")
+		os.Exit(exitcode.Failure)
+	}
+
+	if config.RTCMFilter.NMEABeacon != nil {
+		beacon, beaconError := nmea.NewBeacon(*config.RTCMFilter.NMEABeacon)
+		if beaconError != nil {
+			logger.Println(beaconError.Error())
+			os.Exit(exitcode.Config)
+		}
+		nmeaBeacon = beacon
+		reportError := func(err error) {
+			logger.Printf("NMEA beacon: %v", err)
+		}
+		go nmeaBeacon.Run(nil, reportError)
 	}
 
-	jc := jsonconfig.Config{
-		RecordMessages:      config.RecordMessages,
-		DisplayMessages:     config.DisplayMessages,
-		MessageLogDirectory: config.LogDirectory,
+	var schedule *maintenance.Schedule
+	if len(config.RTCMFilter.MaintenanceWindows) > 0 {
+		s, scheduleError := maintenance.New(config.RTCMFilter.MaintenanceWindows, logger)
+		if scheduleError != nil {
+			logger.Println(scheduleError.Error())
+			os.Exit(exitcode.Config)
+		}
+		schedule = s
+		go schedule.Run(nil)
+	}
+
+	if config.RTCMFilter.Notify != nil {
+		n, notifyError := notify.New(*config.RTCMFilter.Notify, logger)
+		if notifyError != nil {
+			logger.Println(notifyError.Error())
+			os.Exit(exitcode.Config)
+		}
+		notifier = n
+		if schedule != nil {
+			notifier.SuppressWhen(schedule.InWindow)
+		}
+		go notifier.Run(nil)
+	}
+
+	if config.Logging.DisplayChangesOnly {
+		changeWatcher = changes.New()
+	}
+
+	if config.RTCMFilter.Telemetry != nil {
+		r, telemetryError := telemetry.New(*config.RTCMFilter.Telemetry, version.String("rtcmfilter"), logger)
+		if telemetryError != nil {
+			logger.Println(telemetryError.Error())
+			os.Exit(exitcode.Config)
+		}
+		reporter = r
+		go reporter.Run(nil)
+	}
+
+	if config.RTCMFilter.Metrics != nil {
+		r, metricsError := metrics.New(*config.RTCMFilter.Metrics, logger)
+		if metricsError != nil {
+			logger.Println(metricsError.Error())
+			os.Exit(exitcode.Config)
+		}
+		listenError := r.Listen()
+		if listenError != nil {
+			logger.Println(listenError.Error())
+			os.Exit(exitcode.Config)
+		}
+		metricsRegistry = r
+		observationStats = stats.New(0)
+		metricsRegistry.WatchStats(observationStats)
+		go metricsRegistry.Run(nil)
+	}
+
+	started, extrasError := startExtras(config, logger)
+	if extrasError != nil {
+		logger.Println(extrasError.Error())
+		os.Exit(exitcode.Config)
+	}
+	runningExtras = started
+
+	if len(config.Filter.TransformCommand) > 0 {
+		handler := rtcm.New(time.Now(), slog.LevelDebug)
+		handler.SetPositionPrecision(config.Logging.PositionPrecisionMetres)
+		handler.SetDisplayLocation(displayLocation)
+		t, transformError := transform.New(config.Filter.TransformCommand, handler, logger)
+		if transformError != nil {
+			logger.Println(transformError.Error())
+			os.Exit(exitcode.Config)
+		}
+		transformer = t
+	}
+
+	reorderWindow = time.Duration(config.Filter.ReorderWindowMilliseconds) * time.Millisecond
+
+	if config.Logging.RecordDecimationSeconds > 0 {
+		d, decimateError := decimate.New(time.Duration(config.Logging.RecordDecimationSeconds) * time.Second)
+		if decimateError != nil {
+			logger.Println(decimateError.Error())
+			os.Exit(exitcode.Config)
+		}
+		recordDecimator = d
+	}
+
+	f, filterError := config.Filter.TypeFilter()
+	if filterError != nil {
+		logger.Println(filterError.Error())
+		os.Exit(exitcode.Config)
+	}
+	typeFilter = f
+
+	if config.Filter.StationPosition != nil {
+		r, repositionError := reposition.New(*config.Filter.StationPosition)
+		if repositionError != nil {
+			logger.Println(repositionError.Error())
+			os.Exit(exitcode.Config)
+		}
+		repositioner = r
+	}
+
+	if config.RTCMFilter.Demux != nil {
+		d, demuxError := demux.New(config.RTCMFilter.Demux, 0)
+		if demuxError != nil {
+			logger.Println(demuxError.Error())
+			os.Exit(exitcode.Config)
+		}
+		demultiplexer = d
+	}
+
+	var input io.Reader = os.Stdin
+	if config.RTCMFilter.Listen != nil {
+		listener, listenError := transport.Listen(*config.RTCMFilter.Listen, logger)
+		if listenError != nil {
+			logger.Println(listenError.Error())
+			os.Exit(exitcode.Config)
+		}
+		input = listener
+		if config.RTCMFilter.Listen.NetworkName() == "rtp" {
+			go reportLoss(listener, lossReportInterval, logger, nil)
+		}
+	}
+
+	var output io.Writer = os.Stdout
+	if config.RTCMFilter.Forward != nil {
+		forwarder, forwardError := transport.NewForwarder(*config.RTCMFilter.Forward, logger)
+		if forwardError != nil {
+			logger.Println(forwardError.Error())
+			os.Exit(exitcode.Config)
+		}
+		output = forwarder
 	}
 
 	now := time.Now()
 
-	HandleMessages(now, os.Stdin, os.Stdout, &jc)
+	HandleMessages(now, input, output, jc)
+}
+
+// makeSupportBundle creates the named file and writes a support bundle to
+// it, containing the given config and capturing the standard input for the
+// given time.
+func makeSupportBundle(bundleFileName string, effective *config.Config, captureTime time.Duration) error {
+	file, createError := os.Create(bundleFileName)
+	if createError != nil {
+		return createError
+	}
+
+	logPattern := filepath.Join(eventLogDirectory, "rtcmfilter.*.log")
+	bundleError := bundle.Write(file, "rtcmfilter", effective, os.Stdin, captureTime, logPattern)
+	closeError := file.Close()
+	if bundleError != nil {
+		return bundleError
+	}
+	return closeError
 }
 
 // writeRTCMMessages receives the messages from the channel and writes them
@@ -135,6 +452,61 @@ func writeRTCMMessages(ch MessageChannel, writer io.Writer) {
 	}
 }
 
+// writeDecimatedMessages receives the messages from the channel and writes
+// the valid RTCM messages that the decimator keeps to the given writer.  If
+// the channel is closed or there is an error while writing, it terminates.
+// It can be run in a go routine.
+func writeDecimatedMessages(ch MessageChannel, writer io.Writer, decimator *decimate.Decimator) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+
+		if message.MessageType == utils.NonRTCMMessage || !decimator.Keep(&message) {
+			continue
+		}
+
+		n, err := writer.Write(message.RawData)
+		if err != nil || n != len(message.RawData) {
+			// Run out of disk space or some other trouble.
+			return
+		}
+	}
+}
+
+// writeFilteredMessages receives the messages from the channel and writes
+// the valid RTCM messages that the type filter keeps to the given writer,
+// with the base position replaced if there is a repositioner.  The filter
+// and the repositioner may be nil.  If the channel is closed or there is an
+// error while writing, it terminates.  It can be run in a go routine.
+func writeFilteredMessages(ch MessageChannel, writer io.Writer, filter *typefilter.Filter, repositioner *reposition.Repositioner) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+
+		if message.MessageType == utils.NonRTCMMessage {
+			continue
+		}
+
+		if filter != nil && !filter.KeepFrame(message.MessageType, message.RawData) {
+			continue
+		}
+
+		if repositioner != nil {
+			repositioner.Rewrite(&message)
+		}
+
+		n, err := writer.Write(message.RawData)
+		if err != nil || n != len(message.RawData) {
+			// The reader has gone away or some other trouble.
+			return
+		}
+	}
+}
+
 // writeAllMessages receives the messages from the channel and writes them
 // to the given writer.  If the channel is closed or there is an error while
 // writing, it terminates.  It can be run in a go routine.
@@ -168,39 +540,329 @@ func writeReadableMessages(ch MessageChannel, writer io.Writer) {
 		if !ok {
 			return
 		}
+		if atomic.LoadInt32(&displayShed) != 0 {
+			// Memory is short.  Just drain the channel.
+			continue
+		}
 		// Decode the message.  (The result is very verbose!)
-		display := fmt.Sprintf("%s\n", message.String())
-		writer.Write([]byte(display))
+		display := message.String()
+		if changeWatcher != nil {
+			var show bool
+			display, show = changeWatcher.Display(&message)
+			if !show {
+				continue
+			}
+		}
+		writer.Write([]byte(display + "\n"))
+	}
+}
+
+// checkTime checks the system clock against an NTP server and, if the
+// config asks for it, starts checking at intervals.  It returns false if
+// the config says that the application should refuse to start.
+func checkTime(config *timecheck.Config, logger *log.Logger) bool {
+	checker := timecheck.New(config.Server, config.Threshold(), logger)
+
+	result, err := checker.Check()
+
+	if config.IntervalMinutes > 0 {
+		go checker.Run(nil, config.Interval())
+	}
+
+	if err != nil {
+		// The checker has logged the error.  Not being able to reach the
+		// server is no reason to refuse to start.
+		return true
+	}
+
+	return !(config.RefuseToStart && result.Refuse(config.RolloverWindow()))
+}
+
+// updateBeacon receives the messages from the channel and gives the
+// position from each message type 1005 to the beacon.  It terminates when
+// the channel is closed.  It can be run in a go routine.
+func updateBeacon(ch MessageChannel, beacon *nmea.Beacon) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+		if message.MessageType != utils.MessageType1005 {
+			continue
+		}
+		position, err := type1005.GetMessage(message.RawData, slog.LevelInfo)
+		if err != nil {
+			continue
+		}
+		beacon.Update(position)
+	}
+}
+
+// reportLoss logs the counts of the RTP packets received, lost and late at
+// the given intervals if any more have been lost or were late since the
+// last report.  It runs until the stop channel is closed.  If the channel
+// is nil, it runs forever.  It can be run in a go routine.
+func reportLoss(listener *transport.Listener, interval time.Duration, logger *log.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last rtp.LossStats
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		stats := listener.LossStats()
+		if stats.Lost != last.Lost || stats.Late != last.Late {
+			logger.Printf("RTP packets received %d lost %d late %d", stats.Received, stats.Lost, stats.Late)
+		}
+		last = stats
+	}
+}
+
+// watchInput receives the messages from the channel and tells the notifier
+// that data is arriving from the device.  It terminates when the channel is
+// closed.  It can be run in a go routine.
+func watchInput(ch MessageChannel, notifier *notify.Notifier) {
+	for {
+		_, ok := <-ch
+		if !ok {
+			return
+		}
+		notifier.Seen()
+	}
+}
+
+// countMessages receives the messages from the channel and gives them to
+// the telemetry reporter to count.  It terminates when the channel is
+// closed.  It can be run in a go routine.
+func countMessages(ch MessageChannel, reporter *telemetry.Reporter) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+		reporter.Count(&message)
 	}
 }
 
+// meterMessages receives the messages from the channel and gives them to
+// the metrics registry to count and to the aggregator, if there is one, for
+// the statistics.  It terminates when the channel is closed.  It can be run
+// in a go routine.
+func meterMessages(ch MessageChannel, registry *metrics.Registry, aggregator *stats.Aggregator) {
+	for {
+		message, ok := <-ch
+		if !ok {
+			return
+		}
+		registry.Count(&message)
+		if aggregator != nil {
+			aggregator.Observe(&message)
+		}
+	}
+}
+
+// logHandlerEvents writes the RTCM handler's events to the log until the
+// channel is closed.
+func logHandlerEvents(events <-chan rtcm.Event, logger *log.Logger) {
+	for event := range events {
+		logger.Println(event.String())
+	}
+}
+
+// shedDisplay stops writeReadableMessages from writing the readable display.
+func shedDisplay() {
+	atomic.StoreInt32(&displayShed, 1)
+}
+
 func HandleMessages(startTime time.Time, reader io.Reader, writer io.Writer, config *jsonconfig.Config) {
 
 	bufferedReader := bufio.NewReader(reader)
 
 	channels := make([]chan rtcm.Message, 0)
 
-	messageChan := make(chan rtcm.Message)
-	go writeRTCMMessages(messageChan, writer)
-	channels = append(channels, messageChan)
+	// Each stage runs behind a queue.  See stages.go.
+	var running stages
+
+	if typeFilter != nil || repositioner != nil {
+		channels = append(channels, running.start("output", func(ch MessageChannel) {
+			writeFilteredMessages(ch, writer, typeFilter, repositioner)
+		}))
+	} else {
+		channels = append(channels, running.start("output", func(ch MessageChannel) {
+			writeRTCMMessages(ch, writer)
+		}))
+	}
 
 	if config.DisplayMessages {
 		displayLogWriter :=
-			dailylogger.New(config.MessageLogDirectory, "rtcm.", ".txt")
-		displayChan := make(chan rtcm.Message)
-		go writeReadableMessages(displayChan, displayLogWriter)
-		channels = append(channels, displayChan)
+			logrotate.New(config.MessageLogDirectory, "rtcm.", ".txt")
+		channels = append(channels, running.start("display", func(ch MessageChannel) {
+			writeReadableMessages(ch, displayLogWriter)
+		}))
 	}
 	if config.RecordMessages {
-		messageLogWriter := dailylogger.New(config.MessageLogDirectory, "rtcmfilter.", ".rtcm")
-		rtcmChan := make(chan rtcm.Message)
-		go writeRTCMMessages(rtcmChan, messageLogWriter)
-		channels = append(channels, rtcmChan)
+		messageLogWriter := logrotate.New(config.MessageLogDirectory, "rtcmfilter.", ".rtcm")
+		if recordDecimator != nil {
+			channels = append(channels, running.start("record", func(ch MessageChannel) {
+				writeDecimatedMessages(ch, messageLogWriter, recordDecimator)
+			}))
+		} else {
+			channels = append(channels, running.start("record", func(ch MessageChannel) {
+				writeRTCMMessages(ch, messageLogWriter)
+			}))
+		}
+	}
+
+	if nmeaBeacon != nil {
+		channels = append(channels, running.start("beacon", func(ch MessageChannel) {
+			updateBeacon(ch, nmeaBeacon)
+		}))
+	}
+
+	if notifier != nil {
+		channels = append(channels, running.start("notify", func(ch MessageChannel) {
+			watchInput(ch, notifier)
+		}))
+	}
+
+	if reporter != nil {
+		channels = append(channels, running.start("telemetry", func(ch MessageChannel) {
+			countMessages(ch, reporter)
+		}))
+	}
+
+	if metricsRegistry != nil {
+		channels = append(channels, running.start("metrics", func(ch MessageChannel) {
+			meterMessages(ch, metricsRegistry, observationStats)
+		}))
+	}
+
+	for _, e := range runningExtras {
+		channels = append(channels, running.start(e.name, e.run))
+	}
+
+	if demultiplexer != nil {
+		channels = append(channels, running.start("demux", func(ch MessageChannel) {
+			demultiplexer.Run(ch)
+		}))
+	}
+
+	// If the messages are to be transformed, they go through the external
+	// command on their way to the other channels.
+	var transformChan chan rtcm.Message
+	var transformDone chan struct{}
+	if transformer != nil {
+		transformChan, transformDone = startTransform(channels, transformer)
+		channels = []chan rtcm.Message{transformChan}
+	}
+
+	// If the messages are to be reordered, they go through the reorder
+	// buffer before anything else.
+	var reorderChan chan rtcm.Message
+	var reorderDone chan struct{}
+	if reorderWindow > 0 {
+		reorderChan, reorderDone = startReorder(channels, reorderWindow)
+		channels = []chan rtcm.Message{reorderChan}
 	}
 
 	appCore := AppCore.New(config, channels)
+	appCore.Metrics = metricsRegistry
+	var events chan rtcm.Event
+	if config.LogHandlerEvents && config.SystemLog != nil {
+		events = make(chan rtcm.Event, eventBufferSize)
+		appCore.Events = events
+		go logHandlerEvents(events, config.SystemLog)
+	}
 	appCore.HandleMessagesUntilEOF(startTime, bufferedReader)
+	if events != nil {
+		// The handler has stopped, so nothing more will be sent.
+		close(events)
+	}
+
+	// We only get to here if the handler stops.  Let the reorder buffer
+	// release the messages it's holding before closing the channel.
+	if reorderChan != nil {
+		close(reorderChan)
+		<-reorderDone
+	}
+	if transformChan != nil {
+		close(transformChan)
+		<-transformDone
+	}
+	running.stop()
+}
+
+// startTransform starts the transformer.  It returns a channel for the
+// incoming messages and a channel which is closed when the transformer has
+// finished.  The transformer sends each valid message produced by its
+// command to all of the given channels.  When the incoming channel is
+// closed, the command's input is closed and the transformer finishes when
+// the command does.
+func startTransform(channels []chan rtcm.Message, transformer *transform.Transformer) (chan rtcm.Message, chan struct{}) {
+	in := make(chan rtcm.Message)
+	done := make(chan struct{})
+
+	release := func(message rtcm.Message) {
+		for _, ch := range channels {
+			ch <- message
+		}
+	}
+
+	go func() {
+		err := transformer.Run(in, release)
+		if err != nil {
+			slog.Error("transform command failed", "error", err)
+		}
+		close(done)
+	}()
+
+	return in, done
+}
+
+// startReorder starts a reorder buffer with the given window.  It returns
+// a channel for the incoming messages and a channel which is closed when
+// the buffer has finished.  The buffer sends each message to all of the
+// given channels when it's released.  When the incoming channel is closed,
+// the buffer releases the messages it's holding and finishes.  If there are
+// metrics, the number of messages held is shown as the reorder backlog.
+func startReorder(channels []chan rtcm.Message, window time.Duration) (chan rtcm.Message, chan struct{}) {
+	in := make(chan rtcm.Message)
+	buffered := make(chan rtcm.Message)
+	done := make(chan struct{})
+
+	// held is the number of messages taken in and not yet released.  It's
+	// accessed atomically.
+	var held int64
+
+	release := func(message rtcm.Message) {
+		atomic.AddInt64(&held, -1)
+		for _, ch := range channels {
+			ch <- message
+		}
+	}
+
+	if metricsRegistry != nil {
+		metricsRegistry.WatchBacklog("reorder", func() int {
+			return int(atomic.LoadInt64(&held))
+		})
+	}
+
+	go func() {
+		for message := range in {
+			atomic.AddInt64(&held, 1)
+			buffered <- message
+		}
+		close(buffered)
+	}()
+
+	go func() {
+		reorder.Run(buffered, window, release)
+		close(done)
+	}()
 
-	// We only get to here if the handler stops.
-	close(messageChan)
+	return in, done
 }
@@ -3,13 +3,29 @@ package main
 import (
 	"bytes"
 	"io"
+	"log"
 	"log/slog"
+	"net"
+	"os/exec"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/goblimey/go-ntrip/decimate"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/notify"
+	"github.com/goblimey/go-ntrip/reposition"
+	"github.com/goblimey/go-ntrip/rtcm/changes"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
 	"github.com/goblimey/go-ntrip/rtcm/testdata"
 	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/rtp"
+	"github.com/goblimey/go-ntrip/timecheck"
+	"github.com/goblimey/go-ntrip/transform"
+	"github.com/goblimey/go-ntrip/transport"
+	"github.com/goblimey/go-ntrip/typefilter"
 
 	"github.com/kylelemons/godebug/diff"
 )
@@ -115,3 +131,352 @@ func TestWriteRTCMMessages(t *testing.T) {
 		}
 	}
 }
+
+// TestWriteDecimatedMessages checks that writeDecimatedMessages writes the
+// messages from the epochs on the boundary, the messages that are not MSMs
+// and no junk.
+func TestWriteDecimatedMessages(t *testing.T) {
+	decimator, err := decimate.New(30 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GPS timestamps at 30 and 31 seconds past midnight GPS time.
+	messages := []rtcm.Message{
+		{MessageType: utils.MessageTypeMSM7GPS, Timestamp: 30000, RawData: []byte("a")},
+		{MessageType: utils.MessageTypeMSM7GPS, Timestamp: 31000, RawData: []byte("b")},
+		{MessageType: utils.MessageType1005, RawData: []byte("c")},
+		{MessageType: utils.NonRTCMMessage, RawData: []byte("d")},
+		{MessageType: utils.MessageTypeMSM7GPS, Timestamp: 60000, RawData: []byte("e")},
+	}
+
+	messageChan := make(chan rtcm.Message, len(messages))
+	for _, m := range messages {
+		messageChan <- m
+	}
+	close(messageChan)
+
+	var writer bytes.Buffer
+	writeDecimatedMessages(messageChan, &writer, decimator)
+
+	const want = "ace"
+	if writer.String() != want {
+		t.Errorf("want %s got %s", want, writer.String())
+	}
+}
+
+// TestWriteFilteredMessages checks that writeFilteredMessages writes only
+// the message types that the filter keeps.
+func TestWriteFilteredMessages(t *testing.T) {
+	filter, err := typefilter.New(nil, []int{1004, 1230})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []rtcm.Message{
+		{MessageType: utils.MessageType1005, RawData: []byte("a")},
+		{MessageType: 1004, RawData: []byte("b")},
+		{MessageType: utils.MessageTypeMSM7GPS, RawData: []byte("c")},
+		{MessageType: utils.NonRTCMMessage, RawData: []byte("d")},
+		{MessageType: 1230, RawData: []byte("e")},
+	}
+
+	messageChan := make(chan rtcm.Message, len(messages))
+	for _, m := range messages {
+		messageChan <- m
+	}
+	close(messageChan)
+
+	var writer bytes.Buffer
+	writeFilteredMessages(messageChan, &writer, filter, nil)
+
+	const want = "ac"
+	if writer.String() != want {
+		t.Errorf("want %s got %s", want, writer.String())
+	}
+}
+
+// TestWriteFilteredMessagesWithRepositioner checks that
+// writeFilteredMessages replaces the base position in a message type 1005
+// when there's a repositioner and no type filter.
+func TestWriteFilteredMessagesWithRepositioner(t *testing.T) {
+	r, err := reposition.New(reposition.Config{X: 3978364.8574, Y: -12345.6789, Z: 4968423.4712})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []rtcm.Message{
+		{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005},
+		{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")},
+		{MessageType: utils.MessageTypeMSM7GPS, RawData: testdata.MessageFrameType1077},
+	}
+
+	messageChan := make(chan rtcm.Message, len(messages))
+	for _, m := range messages {
+		messageChan <- m
+	}
+	close(messageChan)
+
+	var writer bytes.Buffer
+	writeFilteredMessages(messageChan, &writer, nil, r)
+
+	rewritten := rtcm.NewMessage(utils.MessageType1005, "", testdata.MessageFrameType1005, slog.LevelInfo)
+	r.Rewrite(rewritten)
+	want := append(append([]byte{}, rewritten.RawData...), testdata.MessageFrameType1077...)
+	if !bytes.Equal(want, writer.Bytes()) {
+		t.Errorf("want % x\ngot % x", want, writer.Bytes())
+	}
+}
+
+// TestWriteReadableMessagesWhenShed checks that writeReadableMessages
+// writes nothing once the display has been shed.
+func TestWriteReadableMessagesWhenShed(t *testing.T) {
+	shedDisplay()
+	defer atomic.StoreInt32(&displayShed, 0)
+
+	messageChan := make(chan rtcm.Message, 10)
+	messageChan <- rtcm.Message{MessageType: 1024, RawData: testdata.UnhandledMessageType1024}
+	close(messageChan)
+
+	var w bytes.Buffer
+
+	writeReadableMessages(messageChan, &w)
+
+	if w.Len() != 0 {
+		t.Errorf("want no output, got %s", w.String())
+	}
+}
+
+// TestWriteReadableMessagesWithChangesOnly checks that, with the change
+// watcher set, a repeated message type 1005 is only displayed once.
+func TestWriteReadableMessagesWithChangesOnly(t *testing.T) {
+	changeWatcher = changes.New()
+	defer func() { changeWatcher = nil }()
+
+	message := rtcm.NewMessage(utils.MessageType1005, "", testdata.MessageFrameType1005, slog.LevelInfo)
+
+	messageChan := make(chan rtcm.Message, 10)
+	for i := 0; i < 3; i++ {
+		messageChan <- *message
+	}
+	close(messageChan)
+
+	var w bytes.Buffer
+
+	writeReadableMessages(messageChan, &w)
+
+	want := message.String() + "\n"
+	if w.String() != want {
+		t.Error(diff.Diff(want, w.String()))
+	}
+}
+
+// TestUpdateBeacon checks that updateBeacon gives the position from a
+// message type 1005 to the beacon.
+func TestUpdateBeacon(t *testing.T) {
+	beacon, beaconError := nmea.NewBeacon(nmea.BeaconConfig{Sink: "tcp"})
+	if beaconError != nil {
+		t.Fatal(beaconError)
+	}
+
+	messageChan := make(chan rtcm.Message, 10)
+	messageChan <- rtcm.Message{MessageType: 1024, RawData: testdata.UnhandledMessageType1024}
+	close(messageChan)
+
+	updateBeacon(messageChan, beacon)
+
+	if beacon.Sentences(time.Now()) != "" {
+		t.Error("want no position before a message type 1005")
+	}
+
+	messageChan = make(chan rtcm.Message, 10)
+	messageChan <- rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005}
+	close(messageChan)
+
+	updateBeacon(messageChan, beacon)
+
+	if !strings.HasPrefix(beacon.Sentences(time.Now()), "$GPGGA,") {
+		t.Error("want a GGA sentence after a message type 1005")
+	}
+}
+
+// TestWatchInput checks that watchInput tells the notifier when data arrives.
+func TestWatchInput(t *testing.T) {
+	config := notify.Config{Telegram: &notify.TelegramConfig{BotToken: "x", ChatID: "y"}}
+	n, err := notify.New(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	messageChan := make(chan rtcm.Message, 10)
+	messageChan <- rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")}
+	close(messageChan)
+
+	watchInput(messageChan, n)
+
+	if n.LastSeen().Before(start) {
+		t.Errorf("want data seen after %v, last seen %v", start, n.LastSeen())
+	}
+}
+
+// TestReportLoss checks that the RTP packets lost are logged.
+func TestReportLoss(t *testing.T) {
+	listener, err := transport.Listen(transport.Config{Network: "rtp", Address: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sender, err := net.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// The packet with sequence number 2 is lost.
+	for _, sequenceNumber := range []uint16{1, 3} {
+		packet := rtp.Packet{PayloadType: rtp.PayloadTypeGNSS, SequenceNumber: sequenceNumber, Payload: []byte("x")}
+		sender.Write(packet.Marshal())
+		buffer := make([]byte, 1)
+		listener.Read(buffer)
+	}
+
+	var logBuffer bytes.Buffer
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		reportLoss(listener, time.Millisecond, log.New(&logBuffer, "", 0), stop)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	<-done
+
+	// It's only logged once because nothing more was lost.
+	const want = "RTP packets received 2 lost 1 late 0\n"
+	if logBuffer.String() != want {
+		t.Errorf("want %q got %q", want, logBuffer.String())
+	}
+}
+
+// TestStartReorder checks that the reorder buffer sends the messages to
+// all the channels in order of their timestamps.
+func TestStartReorder(t *testing.T) {
+	gps := utils.MessageTypeMSM7GPS
+
+	channels := []chan rtcm.Message{make(chan rtcm.Message, 10), make(chan rtcm.Message, 10)}
+
+	in, done := startReorder(channels, time.Hour)
+	in <- rtcm.Message{MessageType: gps, Timestamp: 2000}
+	in <- rtcm.Message{MessageType: gps, Timestamp: 1000}
+	close(in)
+	<-done
+
+	for i, ch := range channels {
+		if len(ch) != 2 {
+			t.Errorf("channel %d: want 2 messages, got %d", i, len(ch))
+			continue
+		}
+		first := <-ch
+		second := <-ch
+		if first.Timestamp != 1000 || second.Timestamp != 2000 {
+			t.Errorf("channel %d: want 1000 then 2000, got %d then %d",
+				i, first.Timestamp, second.Timestamp)
+		}
+	}
+}
+
+// TestStartReorderBacklog checks that the messages held in the reorder
+// buffer are shown as a backlog in the metrics.
+func TestStartReorderBacklog(t *testing.T) {
+	registry, err := metrics.New(metrics.Config{ListenAddress: ":9100"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsRegistry = registry
+	defer func() { metricsRegistry = nil }()
+
+	backlog := func() string {
+		var buffer bytes.Buffer
+		registry.Write(&buffer)
+		for _, line := range strings.Split(buffer.String(), "\n") {
+			if strings.HasPrefix(line, `ntrip_backlog_messages{stage="reorder"}`) {
+				return line
+			}
+		}
+		return ""
+	}
+
+	channels := []chan rtcm.Message{make(chan rtcm.Message, 10)}
+	in, done := startReorder(channels, time.Hour)
+	in <- rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, Timestamp: 1000}
+	in <- rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, Timestamp: 2000}
+
+	want := `ntrip_backlog_messages{stage="reorder"} 2`
+	deadline := time.Now().Add(5 * time.Second)
+	for backlog() != want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if backlog() != want {
+		t.Errorf("want %s got %s", want, backlog())
+	}
+
+	close(in)
+	<-done
+
+	want = `ntrip_backlog_messages{stage="reorder"} 0`
+	if backlog() != want {
+		t.Errorf("after release want %s got %s", want, backlog())
+	}
+}
+
+// TestStartTransform checks that the transformer sends the messages that
+// come out of the command to all the channels.
+func TestStartTransform(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+
+	tr, err := transform.New([]string{"cat"}, rtcm.New(time.Now(), slog.LevelInfo), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels := []chan rtcm.Message{make(chan rtcm.Message, 10), make(chan rtcm.Message, 10)}
+
+	in, done := startTransform(channels, tr)
+	in <- rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005}
+	close(in)
+	<-done
+
+	for i, ch := range channels {
+		if len(ch) != 1 {
+			t.Errorf("channel %d: want 1 message, got %d", i, len(ch))
+			continue
+		}
+		message := <-ch
+		if message.MessageType != utils.MessageType1005 {
+			t.Errorf("channel %d: want type 1005, got %d", i, message.MessageType)
+		}
+	}
+}
+
+// TestCheckTimeWithNoServer checks that checkTime doesn't refuse to start
+// when it can't reach the NTP server.
+func TestCheckTimeWithNoServer(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger := log.New(&logBuffer, "", 0)
+
+	// Nothing listens on port 1.
+	config := timecheck.Config{Server: "127.0.0.1:1", RefuseToStart: true}
+
+	if !checkTime(&config, logger) {
+		t.Error("want true")
+	}
+
+	if !strings.HasPrefix(logBuffer.String(), "cannot check the system clock") {
+		t.Errorf("want an error in the log, got %s", logBuffer.String())
+	}
+}
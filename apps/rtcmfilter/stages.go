@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/goblimey/go-ntrip/queue"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// Each stage that takes the messages, for example the writer of the
+// readable display, runs in its own goroutine behind a queue, so that a
+// stage that falls behind doesn't hold up the others or the reading of the
+// input.  The queues can be configured by the name of the stage:
+//
+//	"queues": {"display": {"size": 1000, "policy": "drop_oldest"}}
+//
+// By default the readable display drops its oldest messages when it's
+// behind and the other stages hold up the input rather than lose anything.
+// See the queue package.
+
+// stageNames lists the stages whose queues can be configured.
+var stageNames = []string{
+	"output", "display", "record", "beacon", "notify", "telemetry", "metrics",
+	"dashboard", "mqtt", "websocket", "health", "demux",
+}
+
+// queueConfigs gives the config of the queue of each stage.  It's set from
+// the config file.
+var queueConfigs map[string]queue.Config
+
+// defaultPolicy returns the overflow policy of a stage's queue when the
+// config doesn't give one.
+func defaultPolicy(stage string) queue.Policy {
+	if stage == "display" {
+		return queue.DropOldest
+	}
+	return queue.Block
+}
+
+// checkQueues checks the config of the queues.
+func checkQueues(queues map[string]queue.Config) error {
+	for stage, config := range queues {
+		if !knownStage(stage) {
+			em := fmt.Sprintf("queues - no stage called %q", stage)
+			return errors.New(em)
+		}
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("queues - %s - %v", stage, err)
+		}
+	}
+	return nil
+}
+
+// describeQueues returns a description of each configured queue, in order
+// of the stage names, for example "display: 1000 messages, drop_oldest".
+func describeQueues(queues map[string]queue.Config) []string {
+	stages := make([]string, 0, len(queues))
+	for stage := range queues {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+
+	descriptions := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		config := queues[stage]
+		size := config.Size
+		if size == 0 {
+			size = queue.DefaultSize
+		}
+		policy := defaultPolicy(stage)
+		if len(config.Policy) > 0 {
+			policy, _ = queue.ParsePolicy(config.Policy)
+		}
+		descriptions = append(descriptions,
+			fmt.Sprintf("%s: %d messages, %s", stage, size, policy.String()))
+	}
+	return descriptions
+}
+
+// knownStage returns true if the stage is one of the named stages.
+func knownStage(stage string) bool {
+	for _, name := range stageNames {
+		if stage == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stages runs the stages that take the messages.
+type stages struct {
+	queues []*queue.Queue
+	wg     sync.WaitGroup
+}
+
+// start puts a queue in front of a stage and runs the stage in a goroutine.
+// It returns the channel to which the messages are sent.  If there are
+// metrics, the queue's backlog and the messages it drops are shown.
+func (s *stages) start(stage string, run func(MessageChannel)) chan rtcm.Message {
+	q, queueError := queue.New(queueConfigs[stage], defaultPolicy(stage))
+	if queueError != nil {
+		// The config was checked at startup.
+		q, _ = queue.New(queue.Config{}, defaultPolicy(stage))
+	}
+
+	if metricsRegistry != nil {
+		metricsRegistry.WatchBacklog(stage, q.Len)
+		metricsRegistry.WatchDropped(stage, q.Dropped)
+	}
+
+	s.queues = append(s.queues, q)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		run(q.Out())
+	}()
+
+	return q.In()
+}
+
+// stop closes the queues and waits for the stages to deal with the
+// messages left in them.
+func (s *stages) stop() {
+	for _, q := range s.queues {
+		close(q.In())
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/queue"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// TestStagesStop checks that stop waits for each stage to deal with the
+// messages left in its queue.
+func TestStagesStop(t *testing.T) {
+	var running stages
+	var got []int
+	in := running.start("output", func(ch MessageChannel) {
+		for message := range ch {
+			time.Sleep(time.Millisecond)
+			got = append(got, message.MessageType)
+		}
+	})
+
+	for messageType := 1001; messageType <= 1003; messageType++ {
+		in <- rtcm.Message{MessageType: messageType}
+	}
+	running.stop()
+
+	want := []int{1001, 1002, 1003}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestStagesDropped checks that a display stage that's behind drops
+// messages without holding up the input, and that the metrics show them.
+func TestStagesDropped(t *testing.T) {
+	registry, err := metrics.New(metrics.Config{ListenAddress: ":9100"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsRegistry = registry
+	queueConfigs = map[string]queue.Config{"display": {Size: 1}}
+	defer func() {
+		metricsRegistry = nil
+		queueConfigs = nil
+	}()
+
+	var running stages
+	release := make(chan struct{})
+	in := running.start("display", func(ch MessageChannel) {
+		<-release
+		for range ch {
+		}
+	})
+
+	// The stage takes nothing, so these only get through if the queue
+	// drops the old ones.
+	for i := 0; i < 5; i++ {
+		in <- rtcm.Message{MessageType: 1005}
+	}
+
+	const want = `ntrip_dropped_messages_total{stage="display"} 4`
+	dropped := func() string {
+		var buffer bytes.Buffer
+		registry.Write(&buffer)
+		for _, line := range strings.Split(buffer.String(), "\n") {
+			if strings.HasPrefix(line, `ntrip_dropped_messages_total{stage="display"}`) {
+				return line
+			}
+		}
+		return ""
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for dropped() != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if dropped() != want {
+		t.Errorf("want %s got %s", want, dropped())
+	}
+
+	close(release)
+	running.stop()
+}
+
+// TestCheckQueues checks the config of the queues and its description.
+func TestCheckQueues(t *testing.T) {
+	queues := map[string]queue.Config{
+		"output":  {Size: 100},
+		"display": {Policy: "block"},
+	}
+	if err := checkQueues(queues); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"display: 256 messages, block", "output: 100 messages, block"}
+	if got := describeQueues(queues); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	const wantError = "queues - output - queue - the size -1 is negative"
+	err := checkQueues(map[string]queue.Config{"output": {Size: -1}})
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+}
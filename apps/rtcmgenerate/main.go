@@ -0,0 +1,193 @@
+// rtcmgenerate writes a stream of made-up but syntactically valid RTCM3
+// messages to the standard output channel - a type 1005 (base station
+// position) and an MSM4 or MSM7 message per constellation at each epoch.
+// It's for testing and benchmarking the other programs without a GNSS
+// device or a recording:
+//
+//	rtcmgenerate -epochs 3600 >hour.rtcm
+//
+//	rtcmgenerate -realtime | rtcmfilter -c filter.json
+//
+// The options are:
+//
+//	-station 1             the station ID.  The default is 0.
+//	-position x,y,z        the ECEF coordinates of the station in metres.
+//	-msm 4                 produce MSM4 messages.  The default is 7.
+//	-gps 10, -glonass 8,
+//	-galileo 8, -beidou 0  the number of satellites of each constellation,
+//	                       up to 32.  The defaults are shown.
+//	-interval 200ms        the time between epochs.  The default is 1s.
+//	-posevery 10           send the 1005 every ten epochs.  0 means every
+//	                       epoch.  The default is 10.
+//	-epochs 3600           stop after 3600 epochs.  The default is 0, which
+//	                       means never stop.
+//	-start 2023-05-15T12:00:00Z
+//	                       the time of the first epoch.  The default is now.
+//	-realtime              write each epoch when it's due rather than as fast
+//	                       as possible.
+//	-seed 42               seed the random observations.  The same options
+//	                       always give the same stream.
+//
+// The program logs to the standard error channel and stops with one of the
+// exit statuses in the exitcode package.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/rtcm/generator"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// defaultPosition is a position in London.
+const defaultPosition = "3977611.5,-7419.8,4968784.2"
+
+func main() {
+	var stationID uint
+	flag.UintVar(&stationID, "station", 0, "the station ID, 0-4095")
+
+	var position string
+	flag.StringVar(&position, "position", defaultPosition, "the ECEF coordinates x,y,z of the station in metres")
+
+	var msm int
+	flag.IntVar(&msm, "msm", 7, "the type of MSM, 4 or 7")
+
+	var gps, glonass, galileo, beidou int
+	flag.IntVar(&gps, "gps", 10, "the number of GPS satellites")
+	flag.IntVar(&glonass, "glonass", 8, "the number of GLONASS satellites")
+	flag.IntVar(&galileo, "galileo", 8, "the number of Galileo satellites")
+	flag.IntVar(&beidou, "beidou", 0, "the number of Beidou satellites")
+
+	var interval time.Duration
+	flag.DurationVar(&interval, "interval", time.Second, "the time between epochs")
+
+	var positionEvery int
+	flag.IntVar(&positionEvery, "posevery", 10, "send the station position every n epochs, 0 for every epoch")
+
+	var epochs int
+	flag.IntVar(&epochs, "epochs", 0, "the number of epochs, 0 for no limit")
+
+	var start string
+	flag.StringVar(&start, "start", "", "the time of the first epoch, RFC3339, default now")
+
+	var realtime bool
+	flag.BoolVar(&realtime, "realtime", false, "write each epoch when it's due")
+
+	var seed int64
+	flag.Int64Var(&seed, "seed", 0, "the seed for the random observations")
+
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(version.String("rtcmgenerate"))
+		os.Exit(0)
+	}
+
+	if flag.NArg() != 0 {
+		exitcode.Fatalf(exitcode.Config, "usage: %s [options]", os.Args[0])
+	}
+	if msm != 4 && msm != 7 {
+		exitcode.Fatalf(exitcode.Config, "-msm must be 4 or 7, got %d", msm)
+	}
+
+	x, y, z, positionError := parsePosition(position)
+	if positionError != nil {
+		exitcode.Fatal(exitcode.Config, positionError)
+	}
+
+	config := generator.Config{
+		StationID: stationID,
+		X:         x,
+		Y:         y,
+		Z:         z,
+		MSM7:      msm == 7,
+		Satellites: map[string]int{
+			"GPS":     gps,
+			"Glonass": glonass,
+			"Galileo": galileo,
+			"Beidou":  beidou,
+		},
+		Interval:      interval,
+		PositionEvery: positionEvery,
+		Seed:          seed,
+	}
+	if len(start) > 0 {
+		startTime, parseError := time.Parse(time.RFC3339, start)
+		if parseError != nil {
+			exitcode.Fatal(exitcode.Config, parseError)
+		}
+		config.Start = startTime
+	}
+
+	gen, generatorError := generator.New(config)
+	if generatorError != nil {
+		exitcode.Fatal(exitcode.Config, generatorError)
+	}
+
+	logger := log.New(os.Stderr, "rtcmgenerate ", log.LstdFlags)
+
+	var wait func(time.Time)
+	if realtime {
+		wait = func(due time.Time) {
+			time.Sleep(time.Until(due))
+		}
+	}
+
+	count, writeError := generate(gen, epochs, os.Stdout, wait)
+	logger.Printf("wrote %d epochs", count)
+	if writeError != nil {
+		exitcode.FatalError(writeError)
+	}
+}
+
+// generate writes the given number of epochs from the generator to the
+// writer, or carries on for ever if the number is 0.  If wait is not nil it's
+// called with the time of each epoch before the epoch is written.  It
+// returns the number of epochs written.  A write error is returned wrapped
+// with the IOError exit status.
+func generate(gen *generator.Generator, epochs int, writer io.Writer, wait func(time.Time)) (int, error) {
+	count := 0
+	for epochs == 0 || count < epochs {
+		if wait != nil {
+			wait(gen.Time())
+		}
+		for _, frame := range gen.Epoch() {
+			_, writeError := writer.Write(frame)
+			if writeError != nil {
+				return count, exitcode.Wrap(exitcode.IOError, writeError)
+			}
+		}
+		count++
+	}
+	return count, nil
+}
+
+// parsePosition parses a position given as "x,y,z".
+func parsePosition(position string) (float64, float64, float64, error) {
+	em := fmt.Sprintf("the position must be x,y,z - got %q", position)
+	parts := strings.Split(position, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, errors.New(em)
+	}
+	var coordinates [3]float64
+	for i := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+		if err != nil {
+			return 0, 0, 0, errors.New(em)
+		}
+		coordinates[i] = value
+	}
+	return coordinates[0], coordinates[1], coordinates[2], nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/rtcm/generator"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// newGenerator is a helper function.  It returns a generator of one GPS MSM
+// per epoch and a 1005 every other epoch.
+func newGenerator(t *testing.T) *generator.Generator {
+	config := generator.Config{
+		Satellites:    map[string]int{"GPS": 6},
+		PositionEvery: 2,
+		Start:         time.Now().Truncate(time.Second),
+	}
+	gen, err := generator.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+// TestGenerate checks that generate writes the epochs when they're due.
+func TestGenerate(t *testing.T) {
+	gen := newGenerator(t)
+	start := gen.Time()
+	var waits []time.Time
+	wait := func(due time.Time) { waits = append(waits, due) }
+
+	var output bytes.Buffer
+	count, err := generate(gen, 3, &output, wait)
+	if err != nil || count != 3 {
+		t.Fatalf("want 3, nil got %d, %v", count, err)
+	}
+
+	for i := range waits {
+		want := start.Add(time.Duration(i) * time.Second)
+		if !waits[i].Equal(want) {
+			t.Errorf("%d: want to wait until %v got %v", i, want, waits[i])
+		}
+	}
+	if len(waits) != 3 {
+		t.Errorf("want 3 waits got %d", len(waits))
+	}
+
+	// 1005, MSM, MSM, 1005, MSM.
+	scanner := rtcm.NewScanner(&output)
+	messages := 0
+	for {
+		message, err := scanner.Next()
+		if err != nil {
+			break
+		}
+		if len(message.ErrorMessage) > 0 {
+			t.Error(message.ErrorMessage)
+		}
+		messages++
+	}
+	if messages != 5 {
+		t.Errorf("want 5 messages got %d", messages)
+	}
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+// TestGenerateWriteError checks that a write error stops the program with
+// the IOError exit status.
+func TestGenerateWriteError(t *testing.T) {
+	count, err := generate(newGenerator(t), 0, failingWriter{}, nil)
+	if count != 0 || err == nil || err.Error() != "broken pipe" {
+		t.Errorf("want 0, broken pipe got %d, %v", count, err)
+	}
+	if exitcode.Code(err) != exitcode.IOError {
+		t.Errorf("want exit status %d got %d", exitcode.IOError, exitcode.Code(err))
+	}
+}
+
+// TestParsePosition checks parsePosition.
+func TestParsePosition(t *testing.T) {
+	var testData = []struct {
+		position string
+		x, y, z  float64
+		want     string
+	}{
+		{"1.5,-2, 3e6", 1.5, -2, 3e6, ""},
+		{"1,2", 0, 0, 0, `the position must be x,y,z - got "1,2"`},
+		{"1,2,junk", 0, 0, 0, `the position must be x,y,z - got "1,2,junk"`},
+	}
+	for _, td := range testData {
+		x, y, z, err := parsePosition(td.position)
+		if len(td.want) > 0 {
+			if err == nil || err.Error() != td.want {
+				t.Errorf("%s: want %q got %v", td.position, td.want, err)
+			}
+			continue
+		}
+		if err != nil || x != td.x || y != td.y || z != td.z {
+			t.Errorf("%s: want %v, %v, %v got %v, %v, %v, %v", td.position, td.x, td.y, td.z, x, y, z, err)
+		}
+	}
+}
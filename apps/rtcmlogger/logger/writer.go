@@ -8,9 +8,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/goblimey/go-ntrip/apps/rtcmlogger/config"
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/logrotate"
 	"github.com/goblimey/go-tools/clock"
-	"github.com/goblimey/go-tools/dailylogger"
 )
 
 // Writer satisfies the io.Writer interface and writes data (which are presumed to
@@ -44,11 +45,11 @@ import (
 var _ io.Writer = (*Writer)(nil)
 
 type Writer struct {
-	clock        clock.Clock         // This clock may be a fake during testing.
-	logWriter    *dailylogger.Writer // The daily log writer.
-	pushing      bool                // true if we should check for old logs to push at end of day.
-	logDirectory string              // The directory in which to create the logs
-	CFG          *config.Config      // CFG holds the configuration.
+	clock        clock.Clock       // This clock may be a fake during testing.
+	logWriter    *logrotate.Writer // The daily log writer.
+	pushing      bool              // true if we should check for old logs to push at end of day.
+	logDirectory string            // The directory in which to create the logs
+	CFG          *config.Logging   // CFG holds the configuration.
 
 	// Components of the date of the previous write - used to detect the first
 	// write of the day.
@@ -84,7 +85,7 @@ func New(logDirectory string) io.Writer {
 // NewRTCMWriter creates a Writer and returns it as a log.Writer.  It's called by New
 // and can be called explicitely by tests.
 func NewRTCMWriter(clock clock.Clock, logDirectory string, mutex *sync.Mutex) *Writer {
-	logWriter := dailylogger.New(logDirectory, "data.", ".rtcm")
+	logWriter := logrotate.New(logDirectory, "data.", ".rtcm")
 	writer := Writer{clock: clock, logWriter: logWriter, mutex: mutex, pushing: true}
 	writer.logDirectory = logDirectory
 	return &writer
@@ -227,8 +228,8 @@ func (writer *Writer) pushLogs(now time.Time) {
 	todaysLogFile := getTodaysLogFilename(now)
 	files, err := os.ReadDir(writer.CFG.DirectoryForOldMessageLogs)
 	if err != nil {
-		log.Fatal("pushOldLogs: cannot open logging directory " +
-			writer.CFG.DirectoryForOldMessageLogs + " - " + err.Error())
+		exitcode.Fatal(exitcode.IOError, "pushOldLogs: cannot open logging directory "+
+			writer.CFG.DirectoryForOldMessageLogs+" - "+err.Error())
 	}
 
 	for _, fileInfo := range files {
@@ -293,8 +294,8 @@ func (writer *Writer) pushOldLogs(logDirectory string, now time.Time) {
 	logFilename := getTodaysLogFilename(now)
 	files, err := os.ReadDir(logDirectory)
 	if err != nil {
-		log.Fatal("pushOldLogs: cannot open logging directory " +
-			logDirectory + " - " + err.Error())
+		exitcode.Fatal(exitcode.IOError, "pushOldLogs: cannot open logging directory "+
+			logDirectory+" - "+err.Error())
 	}
 
 	for _, fileInfo := range files {
@@ -317,8 +318,8 @@ func (writer *Writer) pushLogfile(logDirectory, logFilename string) {
 	// Ensure that the destination directory exists.
 	err := os.MkdirAll(writer.CFG.DirectoryForOldMessageLogs, os.ModePerm)
 	if err != nil {
-		log.Fatal("pushLogFile: cannot create directory '" +
-			writer.CFG.DirectoryForOldMessageLogs + "' - " + err.Error())
+		exitcode.Fatal(exitcode.IOError, "pushLogFile: cannot create directory '"+
+			writer.CFG.DirectoryForOldMessageLogs+"' - "+err.Error())
 	}
 	logFilePath := logDirectory + "/" + logFilename
 	newLogFilePath := writer.CFG.DirectoryForOldMessageLogs + "/" + logFilename
@@ -9,7 +9,7 @@ import (
 	"github.com/goblimey/go-tools/clock"
 	"github.com/goblimey/go-tools/testsupport"
 
-	"github.com/goblimey/go-ntrip/apps/rtcmlogger/config"
+	"github.com/goblimey/go-ntrip/config"
 	"github.com/goblimey/go-ntrip/rtcm/utils"
 )
 
@@ -334,7 +334,7 @@ func TestPushOldLogs(t *testing.T) {
 	writer.YearOfLastWrite = now.Year()
 	writer.MonthOfLastWrite = now.Month()
 	writer.DayOfLastWrite = now.Day()
-	cfg := config.Config{
+	cfg := config.Logging{
 		MessageLogDirectory:        loggingDirectory,
 		DirectoryForOldMessageLogs: "./old_logs",
 	}
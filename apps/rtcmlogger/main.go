@@ -22,6 +22,9 @@
 // collected within a 24-hour period.  This only applies to the messages written to the
 // logfile, not the ones written to the stdout.  All incoming messages are written to
 // stdout regardless of the time of day.
+//
+// If the program can't start, or it can't look after the log files, it stops
+// with one of the exit statuses listed in the exitcode package.
 package main
 
 import (
@@ -31,8 +34,10 @@ import (
 	"log/slog"
 	"os"
 
-	"github.com/goblimey/go-ntrip/apps/rtcmlogger/config"
-	"github.com/goblimey/go-tools/dailylogger"
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/logrotate"
+	"github.com/goblimey/go-ntrip/version"
 )
 
 const bufferLength = 8096
@@ -58,20 +63,29 @@ func main() {
 	flag.StringVar(&configFileName, "c", "", "JSON config file")
 	flag.StringVar(&configFileName, "config", "", "JSON config file")
 
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
 	flag.Parse()
 
+	if showVersion {
+		fmt.Println(version.String("rtcmlogger"))
+		os.Exit(0)
+	}
+
 	if len(configFileName) == 0 {
 		os.Stderr.Write([]byte("missing config file: -c or --config"))
-		os.Exit(-1)
+		os.Exit(exitcode.Config)
 	}
 
-	// Get the config.
-	cfg, errConfig := config.GetConfig(configFileName)
+	// Get the config.  The logger only uses the logging section.
+	loaded, errConfig := config.Load(configFileName)
 
 	if errConfig != nil {
 		os.Stderr.Write([]byte((errConfig.Error())))
-		os.Exit(-1)
+		os.Exit(exitcode.Config)
 	}
+	cfg := &loaded.Logging
 
 	// The directory in which to record RTCM messages is defined in the
 	// JSON config file, or "." by default.
@@ -83,12 +97,12 @@ func main() {
 }
 
 // start kicks off the RTCM record and (if configured) the event logger.
-func start(cfg *config.Config) {
+func start(cfg *config.Logging) {
 
 	if cfg.LogEvents {
 		// Create the event logger.  It uses structured logging and
 		// switches to a new file each day with a datestamped name.
-		dailyEventLogger := dailylogger.New(cfg.EventLogDirectory, "rtcmlogger.", ".log")
+		dailyEventLogger := logrotate.New(cfg.EventLogDirectory, "rtcmlogger.", ".log")
 		eventLogger = slog.New(slog.NewTextHandler(dailyEventLogger, nil))
 	}
 
@@ -111,7 +125,7 @@ func start(cfg *config.Config) {
 // readAndWrite runs until the input is exhausted (which may never
 // happen) or the process is forcibly stopped.  It reads from stdin,
 // writes the result to stdout and copies it to the recorder channel.
-func readAndWrite(recorderChannel chan []byte, cfg *config.Config) {
+func readAndWrite(recorderChannel chan []byte, cfg *config.Logging) {
 
 	readBuffer := make([]byte, bufferLength)
 
@@ -180,7 +194,7 @@ func readAndWrite(recorderChannel chan []byte, cfg *config.Config) {
 
 // recorder loops, reading buffers from the channel and writing them
 // to the daily log file.
-func recorder(recorderChannel chan []byte, writer io.Writer, cfg *config.Config) {
+func recorder(recorderChannel chan []byte, writer io.Writer, cfg *config.Logging) {
 
 	if writer == nil {
 		if cfg.LogEvents {
@@ -208,11 +222,11 @@ func recorder(recorderChannel chan []byte, writer io.Writer, cfg *config.Config)
 	}
 }
 
-func newEventWriter(cfg *config.Config) *slog.Logger {
+func newEventWriter(cfg *config.Logging) *slog.Logger {
 	if cfg.LogEvents {
 		// Create the event logger.  It uses structured logging and
 		// switches to a new file each day with a datestamped name.
-		dailyEventLogger := dailylogger.New(cfg.EventLogDirectory, "rtcmlogger.", ".log")
+		dailyEventLogger := logrotate.New(cfg.EventLogDirectory, "rtcmlogger.", ".log")
 		eventLogger = slog.New(slog.NewTextHandler(dailyEventLogger, nil))
 		return eventLogger
 	}
@@ -222,14 +236,14 @@ func newEventWriter(cfg *config.Config) *slog.Logger {
 
 // newLogWriter creates an RTCM log writer and returns it.  It's separated out to
 // support integration testing.
-func newLogWriter(cfg *config.Config) io.Writer {
-	dailyRecorder := dailylogger.New(cfg.MessageLogDirectory, "rtcmlogger.", ".rtcm")
+func newLogWriter(cfg *config.Logging) io.Writer {
+	dailyRecorder := logrotate.New(cfg.MessageLogDirectory, "rtcmlogger.", ".rtcm")
 	return dailyRecorder
 }
 
 // writeRTCMLog writes the buffer to the given writer.  It's separated
 // out to support unit testing.
-func writeRTCMLog(buffer *[]byte, writer io.Writer, cfg *config.Config) {
+func writeRTCMLog(buffer *[]byte, writer io.Writer, cfg *config.Logging) {
 
 	n, err := writer.Write(*buffer)
 
@@ -9,7 +9,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/goblimey/go-ntrip/apps/rtcmlogger/config"
+	"github.com/goblimey/go-ntrip/config"
 
 	"github.com/goblimey/go-tools/testsupport"
 )
@@ -22,7 +22,7 @@ func TestRecorder(t *testing.T) {
 	b := make([]byte, 0, len(want))
 	output := bytes.NewBuffer(b)
 	ch := make(chan []byte)
-	var cfg config.Config
+	var cfg config.Logging
 	go recorder(ch, output, &cfg)
 
 	// Send text to the channel.  It should be written to the buffer.
@@ -62,13 +62,13 @@ func TestWriteToLog(t *testing.T) {
 	// Create an RTCM log writer.  Behind the scenes that will create a log file
 	// with a datestamp that we can't easily predict.  However, there should only
 	// be one logfile so we can just look for it.
-	cfg := config.Config{MessageLogDirectory: logDirectory}
+	cfg := config.Logging{MessageLogDirectory: logDirectory}
 	logWriter := newLogWriter(&cfg)
 
 	buffer := []byte(wantFileContents)
 
 	// ch := make(chan []byte)
-	// cfg := config.Config{RecordMessages: true, RecorderChannel: ch}
+	// cfg := config.Logging{RecordMessages: true, RecorderChannel: ch}
 
 	writeRTCMLog(&buffer, logWriter, &cfg)
 
@@ -0,0 +1,198 @@
+// rtcmreplay reads a recording of RTCM data, for example a file written by
+// rtcmlogger, and sends it on again at the pace at which it was recorded, so
+// that a recorded day of data can be fed into rtcmfilter, a caster or a
+// rover for testing:
+//
+//	rtcmreplay data.rtcm | rtcmfilter -c filter.json
+//
+//	rtcmreplay -forward caster.example.com:2102 data.rtcm
+//
+// The pace is taken from the timestamps in the Multiple Signal Messages
+// (MSMs).  The first MSM is sent straight away and each later one is sent
+// when the same time has passed since then as passed between the two when
+// they were recorded.  The other messages, and any non-RTCM data, are sent
+// as soon as the MSM before them has been sent.  Everything in the file is
+// sent unchanged.
+//
+// The options are:
+//
+//	-speed 10           replay ten times as fast as the recording.  0 sends
+//	                    the data as fast as possible.  The default is 1.
+//	-maxgap 5s          shorten any gap in the recording longer than five
+//	                    seconds to five seconds.  The default is no limit.
+//	-forward host:port  send the data to a TCP endpoint instead of the
+//	                    standard output channel.
+//	-network udp        with -forward, send UDP datagrams instead, or with
+//	                    rtp, UDP datagrams carrying RTP packets.
+//
+// The file name "-" means the standard input channel.
+//
+// The program logs to the standard error channel and stops at the end of
+// the recording with one of the exit statuses in the exitcode package.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/transport"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+func main() {
+	var speed float64
+	flag.Float64Var(&speed, "speed", 1, "replay speed as a multiple of the recorded speed, 0 for as fast as possible")
+
+	var maxGap time.Duration
+	flag.DurationVar(&maxGap, "maxgap", 0, "the longest gap to reproduce, 0 for no limit")
+
+	var forward, network string
+	flag.StringVar(&forward, "forward", "", "host:port to send the data to instead of stdout")
+	flag.StringVar(&network, "network", "tcp", "with -forward, tcp, udp or rtp")
+
+	var showVersion bool
+	flag.BoolVar(&showVersion, "version", false, "display the version and stop")
+
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(version.String("rtcmreplay"))
+		os.Exit(0)
+	}
+
+	if flag.NArg() != 1 {
+		exitcode.Fatalf(exitcode.Config, "usage: %s [options] file", os.Args[0])
+	}
+	if speed < 0 {
+		exitcode.Fatalf(exitcode.Config, "the speed must not be negative - %v", speed)
+	}
+
+	logger := log.New(os.Stderr, "rtcmreplay ", log.LstdFlags)
+
+	var reader io.Reader = os.Stdin
+	fileName := flag.Arg(0)
+	if fileName != "-" {
+		file, openError := os.Open(fileName)
+		if openError != nil {
+			exitcode.Fatal(exitcode.InputUnavailable, openError)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	var writer io.Writer = os.Stdout
+	if len(forward) > 0 {
+		forwarder, forwarderError := transport.NewForwarder(
+			transport.Config{Network: network, Address: forward}, logger)
+		if forwarderError != nil {
+			exitcode.Fatal(exitcode.Config, forwarderError)
+		}
+		if checkError := forwarder.Check(); checkError != nil {
+			exitcode.Fatal(exitcode.InputUnavailable, checkError)
+		}
+		defer forwarder.Close()
+		writer = forwarder
+	}
+
+	replayer := newReplayer(speed, maxGap)
+	count, replayError := replayer.replay(rtcm.NewScanner(reader), writer)
+	logger.Printf("replayed %d messages", count)
+	if replayError != nil {
+		exitcode.FatalError(replayError)
+	}
+}
+
+// replayer sends messages at the pace at which they were recorded.
+type replayer struct {
+	// speed is the replay speed as a multiple of the recorded speed.  0
+	// means as fast as possible.
+	speed float64
+
+	// maxGap is the longest gap between messages to reproduce.  0 means no
+	// limit.
+	maxGap time.Duration
+
+	// firstSentAt is the time of the first MSM and startedAt is the time at
+	// which it was replayed.
+	firstSentAt time.Time
+	startedAt   time.Time
+
+	// latestSentAt is the latest MSM time seen so far.
+	latestSentAt time.Time
+
+	// skipped is the recorded time left out by shortening long gaps.
+	skipped time.Duration
+
+	// now gives the time and sleep waits.  They're replaced in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newReplayer creates a replayer.
+func newReplayer(speed float64, maxGap time.Duration) *replayer {
+	r := replayer{speed: speed, maxGap: maxGap, now: time.Now, sleep: time.Sleep}
+	return &r
+}
+
+// replay reads the messages from the scanner and writes them to the writer,
+// each when it's due.  It returns the number of messages written.  A read or
+// write error is returned wrapped with the IOError exit status.  The end of
+// the input isn't an error.
+func (r *replayer) replay(scanner *rtcm.Scanner, writer io.Writer) (int, error) {
+	count := 0
+	for {
+		message, err := scanner.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, exitcode.Wrap(exitcode.IOError, err)
+		}
+
+		if !message.SentAt.IsZero() {
+			r.wait(message.SentAt)
+		}
+
+		_, writeError := writer.Write(message.RawData)
+		if writeError != nil {
+			return count, exitcode.Wrap(exitcode.IOError, writeError)
+		}
+		count++
+	}
+}
+
+// wait waits until it's time to replay an MSM sent at the given time.
+// Messages from other constellations may come slightly out of order, so an
+// MSM earlier than the latest one isn't waited for.
+func (r *replayer) wait(sentAt time.Time) {
+	if r.speed == 0 {
+		return
+	}
+
+	if r.firstSentAt.IsZero() {
+		r.firstSentAt = sentAt
+		r.latestSentAt = sentAt
+		r.startedAt = r.now()
+		return
+	}
+
+	if sentAt.After(r.latestSentAt) {
+		gap := sentAt.Sub(r.latestSentAt)
+		if r.maxGap > 0 && gap > r.maxGap {
+			r.skipped += gap - r.maxGap
+		}
+		r.latestSentAt = sentAt
+	}
+
+	recorded := sentAt.Sub(r.firstSentAt) - r.skipped
+	due := r.startedAt.Add(time.Duration(float64(recorded) / r.speed))
+	if delay := due.Sub(r.now()); delay > 0 {
+		r.sleep(delay)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// msm is a helper function.  It returns a copy of the type 1077 test frame
+// with the given timestamp, in milliseconds from the start of the GPS week.
+func msm(timestamp uint64) []byte {
+	frame := make([]byte, len(testdata.MessageFrameType1077))
+	copy(frame, testdata.MessageFrameType1077)
+	const timestampPosition = utils.LeaderLengthBits + header.LenMessageType + header.LenStationID
+	// SetBits only sets bits, so clear the old timestamp first.
+	for p := uint(timestampPosition); p < timestampPosition+header.LenTimeStamp; p++ {
+		frame[p/8] &^= 1 << (7 - p%8)
+	}
+	utils.SetBits(frame, timestampPosition, header.LenTimeStamp, timestamp)
+	utils.SetCRC(frame)
+	return frame
+}
+
+// testReplayer is a helper function.  It returns a replayer with a clock
+// that only moves when it sleeps, and the list of the sleeps.
+func testReplayer(speed float64, maxGap time.Duration) (*replayer, *[]time.Duration) {
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	sleeps := make([]time.Duration, 0)
+	r := newReplayer(speed, maxGap)
+	r.now = func() time.Time { return now }
+	r.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	return r, &sleeps
+}
+
+// TestReplay checks the pace of the replay.
+func TestReplay(t *testing.T) {
+	// An epoch of two MSMs and a 1005, an epoch a second later with a
+	// 1005, some junk and an epoch a minute later.
+	var input []byte
+	input = append(input, msm(10000)...)
+	input = append(input, msm(10000)...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, msm(11000)...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, []byte("junk")...)
+	input = append(input, msm(71000)...)
+
+	var testData = []struct {
+		description string
+		speed       float64
+		maxGap      time.Duration
+		wantSleeps  []time.Duration
+	}{
+		{"recorded speed", 1, 0, []time.Duration{time.Second, time.Minute}},
+		{"twice the speed", 2, 0, []time.Duration{500 * time.Millisecond, 30 * time.Second}},
+		{"max gap", 1, 5 * time.Second, []time.Duration{time.Second, 5 * time.Second}},
+		{"as fast as possible", 0, 0, []time.Duration{}},
+	}
+	for _, td := range testData {
+		r, sleeps := testReplayer(td.speed, td.maxGap)
+		var output bytes.Buffer
+		count, err := r.replay(rtcm.NewScanner(bytes.NewReader(input)), &output)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if count != 7 {
+			t.Errorf("%s: want 7 messages got %d", td.description, count)
+		}
+		if !bytes.Equal(input, output.Bytes()) {
+			t.Errorf("%s: the output isn't the same as the input", td.description)
+		}
+		if len(*sleeps) != len(td.wantSleeps) {
+			t.Errorf("%s: want sleeps %v got %v", td.description, td.wantSleeps, *sleeps)
+			continue
+		}
+		for i := range td.wantSleeps {
+			if (*sleeps)[i] != td.wantSleeps[i] {
+				t.Errorf("%s: want sleeps %v got %v", td.description, td.wantSleeps, *sleeps)
+				break
+			}
+		}
+	}
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+// TestReplayWriteError checks that a write error stops the replay with the
+// IOError exit status.
+func TestReplayWriteError(t *testing.T) {
+	r, _ := testReplayer(1, 0)
+	count, err := r.replay(rtcm.NewScanner(bytes.NewReader(msm(1000))), failingWriter{})
+	if count != 0 || err == nil || err.Error() != "broken pipe" {
+		t.Errorf("want 0, broken pipe got %d, %v", count, err)
+	}
+	if exitcode.Code(err) != exitcode.IOError {
+		t.Errorf("want exit status %d got %d", exitcode.IOError, exitcode.Code(err))
+	}
+}
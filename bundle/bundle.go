@@ -0,0 +1,197 @@
+// The bundle package writes support bundles.  A support bundle is a gzipped
+// tar archive that a user can attach to a bug report.  It holds everything
+// needed to reproduce a decoding problem:
+//
+//	version.txt        the version of the program that made it
+//	config.json        the effective config, with the secrets redacted
+//	logs/...           the most recent event logs
+//	input.rtcm         the raw input captured for a minute or so
+//
+// The input can be replayed with rtcmreplay or fed to displayrtcm3.  The
+// rtcmfilter makes a bundle with its -support-bundle option and gontrip
+// with its support-bundle command:
+//
+//	err := bundle.Write(file, "rtcmfilter", effective, os.Stdin,
+//	    bundle.DefaultCaptureTime, "logs/rtcmfilter.*.log")
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/version"
+)
+
+// DefaultCaptureTime is the usual time for which the input is captured.
+const DefaultCaptureTime = time.Minute
+
+// eventLogsInBundle is the number of recent event logs in a support bundle.
+const eventLogsInBundle = 3
+
+// redacted replaces secret values in the config in a support bundle.
+const redacted = "REDACTED"
+
+// secretKeys contains words which, if they appear in the name of a config
+// item, mark it as secret.
+var secretKeys = []string{"password", "token", "secret", "key"}
+
+// Write writes a support bundle containing the version of the named
+// program, the effective config with the secrets redacted, the most recent
+// of the event logs that match the glob pattern and the raw input captured
+// for the given time.  The effective config is the one that the program
+// runs with - after the YAML has been converted, the environment variables
+// replaced and an old format config converted - so it's written as JSON
+// whatever form the file was in.
+func Write(out io.Writer, program string, effective *config.Config, input io.Reader, captureTime time.Duration, logPattern string) error {
+	zipper := gzip.NewWriter(out)
+	archive := tar.NewWriter(zipper)
+
+	now := time.Now()
+
+	versionText := version.String(program) + "\n"
+	if err := addFile(archive, "version.txt", []byte(versionText), now); err != nil {
+		return err
+	}
+
+	safeConfig, redactError := redact(effective)
+	if redactError != nil {
+		return redactError
+	}
+	if err := addFile(archive, "config.json", safeConfig, now); err != nil {
+		return err
+	}
+
+	logNames, _ := filepath.Glob(logPattern)
+	sort.Strings(logNames)
+	if len(logNames) > eventLogsInBundle {
+		logNames = logNames[len(logNames)-eventLogsInBundle:]
+	}
+	for _, name := range logNames {
+		contents, readError := os.ReadFile(name)
+		if readError != nil {
+			return readError
+		}
+		if err := addFile(archive, "logs/"+filepath.Base(name), contents, now); err != nil {
+			return err
+		}
+	}
+
+	captured := captureInput(input, captureTime)
+	if err := addFile(archive, "input.rtcm", captured, time.Now()); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return zipper.Close()
+}
+
+// addFile adds a file with the given name and contents to the archive.
+func addFile(archive *tar.Writer, name string, contents []byte, modified time.Time) error {
+	header := tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: modified,
+	}
+	if err := archive.WriteHeader(&header); err != nil {
+		return err
+	}
+	_, err := archive.Write(contents)
+	return err
+}
+
+// redact returns the config as JSON with the values of any secret items
+// replaced, at any depth.
+func redact(effective *config.Config) ([]byte, error) {
+	configJSON, marshalError := json.Marshal(effective)
+	if marshalError != nil {
+		return nil, marshalError
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(configJSON, &value); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(redactValue(value), "", "    ")
+}
+
+// redactValue replaces the secret items in a value produced by
+// json.Unmarshal.
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			if secret(name) {
+				v[name] = redacted
+			} else {
+				v[name] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+// secret returns true if the config item with the given name is a secret.
+func secret(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretKeys {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureInput reads from the reader for the given time or until end of
+// file, whichever comes first, and returns what it read.  If the reader is
+// still blocked when the time is up, the goroutine reading it is left
+// behind, so this should only be used just before the program exits.
+func captureInput(reader io.Reader, captureTime time.Duration) []byte {
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buffer := make([]byte, 4096)
+		for {
+			n, err := reader.Read(buffer)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buffer[:n])
+				chunks <- chunk
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(captureTime)
+	defer timer.Stop()
+
+	var captured []byte
+	for {
+		select {
+		case chunk, more := <-chunks:
+			if !more {
+				return captured
+			}
+			captured = append(captured, chunk...)
+		case <-timer.C:
+			return captured
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/config"
+)
+
+// parseConfig parses a config for a test.
+func parseConfig(t *testing.T, text string) *config.Config {
+	t.Helper()
+	effective, err := config.Parse([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return effective
+}
+
+// TestRedact checks that redact replaces the secrets at any depth.
+func TestRedact(t *testing.T) {
+	effective := parseConfig(t, `{
+		"caster": {"host": "caster.example.com", "mountpoint": "MYBASE", "password": "x"},
+		"rtcmfilter": {
+			"notify": {
+				"smtp": {"server": "mail:587", "username": "me", "password": "y"},
+				"telegram": {"bot_token": "123:ABC", "chat_id": "987"}
+			}
+		}
+	}`)
+
+	result, err := redact(effective)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(result, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	caster := got["caster"].(map[string]interface{})
+	if caster["password"] != redacted || caster["host"] != "caster.example.com" {
+		t.Errorf("want the password redacted and the host kept, got %v", caster)
+	}
+
+	notify := got["rtcmfilter"].(map[string]interface{})["notify"].(map[string]interface{})
+	wantSMTP := map[string]interface{}{"server": "mail:587", "username": "me", "password": redacted}
+	smtp := notify["smtp"].(map[string]interface{})
+	for name, want := range wantSMTP {
+		if smtp[name] != want {
+			t.Errorf("smtp %s: want %v got %v", name, want, smtp[name])
+		}
+	}
+	telegram := notify["telegram"].(map[string]interface{})
+	if telegram["bot_token"] != redacted || telegram["chat_id"] != "987" {
+		t.Errorf("want the bot token redacted and the chat ID kept, got %v", telegram)
+	}
+}
+
+// TestCaptureInput checks that captureInput stops at the end of the input
+// or when the time is up.
+func TestCaptureInput(t *testing.T) {
+	got := captureInput(strings.NewReader("some input"), time.Hour)
+	if string(got) != "some input" {
+		t.Errorf("want some input got %q", got)
+	}
+
+	// A reader that never returns.
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	got = captureInput(reader, 10*time.Millisecond)
+	if len(got) != 0 {
+		t.Errorf("want nothing got %q", got)
+	}
+}
+
+// TestWrite checks the contents of a support bundle.
+func TestWrite(t *testing.T) {
+	logDirectory := t.TempDir()
+	logNames := []string{
+		"rtcmfilter.2024-08-27.log",
+		"rtcmfilter.2024-08-28.log",
+		"rtcmfilter.2024-08-29.log",
+		"rtcmfilter.2024-08-30.log",
+		"other.2024-08-30.log",
+	}
+	for _, name := range logNames {
+		err := ioutil.WriteFile(filepath.Join(logDirectory, name), []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	effective := parseConfig(t, `{"rtcmfilter": {"notify": {"telegram": {"bot_token": "123:ABC"}}}}`)
+
+	got := readBundle(t, effective, logDirectory)
+
+	wantNames := []string{
+		"version.txt",
+		"config.json",
+		"logs/rtcmfilter.2024-08-28.log",
+		"logs/rtcmfilter.2024-08-29.log",
+		"logs/rtcmfilter.2024-08-30.log",
+		"input.rtcm",
+	}
+	if len(got) != len(wantNames) {
+		t.Errorf("want %d files got %d", len(wantNames), len(got))
+	}
+	for _, name := range wantNames {
+		if _, ok := got[name]; !ok {
+			t.Errorf("want %s in the bundle", name)
+		}
+	}
+
+	if !strings.HasPrefix(got["version.txt"], "rtcmfilter ") {
+		t.Errorf("unexpected version %q", got["version.txt"])
+	}
+
+	if strings.Contains(got["config.json"], "123:ABC") {
+		t.Error("want the bot token redacted")
+	}
+
+	if got["input.rtcm"] != "raw input" {
+		t.Errorf("want raw input got %q", got["input.rtcm"])
+	}
+}
+
+// TestWriteYAML checks that a support bundle can be made from
+// a config in YAML and that it holds the effective config, with the
+// references to environment variables replaced, as JSON.
+func TestWriteYAML(t *testing.T) {
+	os.Setenv("BUNDLE_TEST_HOST", "caster.example.com")
+	os.Setenv("BUNDLE_TEST_PASSWORD", "s3cret")
+	defer os.Unsetenv("BUNDLE_TEST_HOST")
+	defer os.Unsetenv("BUNDLE_TEST_PASSWORD")
+
+	effective := parseConfig(t, `
+caster:
+  host: ${BUNDLE_TEST_HOST}
+  mountpoint: MYBASE
+  password: ${BUNDLE_TEST_PASSWORD}
+`)
+
+	got := readBundle(t, effective, t.TempDir())
+
+	var bundled config.Config
+	if err := json.Unmarshal([]byte(got["config.json"]), &bundled); err != nil {
+		t.Fatalf("want the config as JSON - %v\n%s", err, got["config.json"])
+	}
+	if bundled.Caster.Host != "caster.example.com" {
+		t.Errorf("want the host from the environment, got %q", bundled.Caster.Host)
+	}
+	if bundled.Caster.Password != redacted {
+		t.Errorf("want the password redacted, got %q", bundled.Caster.Password)
+	}
+	if strings.Contains(got["config.json"], "s3cret") {
+		t.Error("the password is in the bundle")
+	}
+}
+
+// readBundle writes a support bundle with the given config and returns
+// the contents of its files, by name.
+func readBundle(t *testing.T, effective *config.Config, logDirectory string) map[string]string {
+	t.Helper()
+
+	var out bytes.Buffer
+	pattern := filepath.Join(logDirectory, "rtcmfilter.*.log")
+	err := Write(&out, "rtcmfilter", effective, strings.NewReader("raw input"), time.Hour, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zipReader, zipError := gzip.NewReader(&out)
+	if zipError != nil {
+		t.Fatal(zipError)
+	}
+	archive := tar.NewReader(zipReader)
+
+	got := make(map[string]string)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := ioutil.ReadAll(archive)
+		got[header.Name] = string(contents)
+	}
+	return got
+}
@@ -0,0 +1,1016 @@
+// The caster package provides an NTRIP caster, which relays RTCM data from
+// base stations to rovers.  A base station's NTRIP server connects to the
+// caster and sends its data to a mountpoint.  Rovers connect as NTRIP
+// clients, ask for a mountpoint and receive the data sent to it:
+//
+//	c, err := caster.New(&config, logger)
+//	...
+//	listener, err := net.Listen("tcp", ":2101")
+//	...
+//	err = c.Serve(listener)
+//
+// The config lists the mountpoints.  Each has the password that its server
+// must give and, optionally, the names and passwords of the rovers that may
+// use it.  If no rovers are listed, anybody can use it.
+//
+// Servers can log in with NTRIP version 1 (a SOURCE request carrying the
+// password) or version 2 (a POST request with HTTP basic authentication,
+// possibly with chunked transfer encoding).  Clients send a GET request,
+// with basic authentication if the mountpoint requires it.  A client that
+// asks for a mountpoint that isn't live, or for "/", gets the sourcetable,
+// which lists the live mountpoints.
+//
+// The caster splits the data from each server into RTCM messages, drops
+// anything that isn't RTCM and passes each message to every client of the
+// mountpoint that wants it (see Subscription).  Out-of-date corrections do a
+// rover more harm than good, so if a client stalls for a while, the messages
+// that have been waiting for longer than the maximum age (five seconds by
+// default) are thrown away rather than sent when it recovers.  A client that
+// falls too far behind is dropped, so that it can't hold up the others.  If a
+// server goes away, its clients stay connected and get the data when it comes
+// back.
+//
+// A mountpoint can be limited to clients from particular networks.  Its
+// allow and deny lists give address ranges in CIDR form, for example
+// "192.0.2.0/24".  A client whose address is in the deny list, or not in the
+// allow list if there is one, is refused with 403 Forbidden when it asks for
+// the mountpoint.
+//
+// A mountpoint can have aliases, other names under which servers and clients
+// can use it.  Rename gives a mountpoint a new name without dropping its
+// server or its clients and keeps the old name as an alias, so rovers that
+// have the old name built into them carry on working.
+//
+// SetAccessLog sends an entry for each connection to a writer in the
+// combined log format used by web servers, so that the usual log analysers
+// can read it.  The entry gives the client's address, the user, the time,
+// the request, the status, the number of bytes sent to a client (or received
+// from a server) and the user agent, with the length of the connection in
+// milliseconds added at the end:
+//
+//	192.0.2.1 - rover [01/Mar/2024:12:00:00 +0000] "GET /MYBASE HTTP/1.1" 200 52301 "-" "NTRIP RTKLIB/2.4.3" 61007
+//
+// Stats gives the state of each mountpoint, including the spread of the
+// intervals between the epochs that its server sends.  A wide spread with
+// steady data from the base station points to the network between the two,
+// which helps when rovers report intermittent fixes.
+package caster
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/ntrip/sourcetable"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// Responses to NTRIP version 1 requests.
+const (
+	ResponseOK            = "ICY 200 OK\r\n"
+	ResponseBadPassword   = "ERROR - Bad Password\r\n"
+	ResponseBadMountpoint = "ERROR - Bad Mountpoint\r\n"
+	ResponseTaken         = "ERROR - Mount Point Taken\r\n"
+)
+
+// Responses to NTRIP version 2 requests and to requests that the caster
+// doesn't understand.
+const (
+	ResponseOKVersion2     = "HTTP/1.1 200 OK\r\nNtrip-Version: Ntrip/2.0\r\nContent-Type: gnss/data\r\nConnection: close\r\n\r\n"
+	ResponseUnauthorized   = "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"NTRIP\"\r\n\r\n"
+	ResponseForbidden      = "HTTP/1.1 403 Forbidden\r\n\r\n"
+	ResponseNotFound       = "HTTP/1.1 404 Not Found\r\n\r\n"
+	ResponseConflict       = "HTTP/1.1 409 Conflict\r\n\r\n"
+	ResponseBadRequest     = "HTTP/1.1 400 Bad Request\r\n\r\n"
+	ResponseNotImplemented = "HTTP/1.1 501 Not Implemented\r\n\r\n"
+)
+
+// requestTimeout is the time allowed for a connection to send its request.
+const requestTimeout = 10 * time.Second
+
+// writeTimeout is the time allowed for a write to a client.
+const writeTimeout = 30 * time.Second
+
+// clientQueueLength is the number of messages held for a client that's
+// slow to read.  If the queue fills up, the client is dropped.
+const clientQueueLength = 256
+
+// DefaultMaxAge is the time for which a message waits to be sent to a client
+// before it's thrown away, if the config doesn't give one.
+const DefaultMaxAge = 5 * time.Second
+
+// User is a rover user allowed to use a mountpoint.
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// Mountpoint is the config of one mountpoint.
+type Mountpoint struct {
+	// Name is the name of the mountpoint, for example "MYBASE".
+	Name string `json:"name"`
+
+	// Aliases are other names for the mountpoint.  The sourcetable only
+	// lists the name.
+	Aliases []string `json:"aliases"`
+
+	// SourcePassword is the password that the server must give.
+	SourcePassword string `json:"source_password"`
+
+	// Users lists the rovers allowed to use the mountpoint.  If it's empty,
+	// anybody can use it.
+	Users []User `json:"users"`
+
+	// Allow lists the networks, in CIDR form, from which clients may use
+	// the mountpoint.  If it's empty, clients may come from anywhere.  A
+	// single address is taken as a network containing just that address.
+	Allow []string `json:"allow"`
+
+	// Deny lists the networks from which clients may not use the
+	// mountpoint.  It overrides Allow.
+	Deny []string `json:"deny"`
+}
+
+// Config is the config of the caster.
+type Config struct {
+	Mountpoints []Mountpoint `json:"mountpoints"`
+
+	// MaxAgeMilliseconds is the time for which a message waits to be sent
+	// to a client before it's thrown away.  0 means DefaultMaxAge.
+	MaxAgeMilliseconds uint `json:"max_age_milliseconds"`
+}
+
+// MaxAge returns the time for which a message waits to be sent to a client.
+func (config *Config) MaxAge() time.Duration {
+	if config.MaxAgeMilliseconds == 0 {
+		return DefaultMaxAge
+	}
+	return time.Duration(config.MaxAgeMilliseconds) * time.Millisecond
+}
+
+// Validate checks the config.
+func (config *Config) Validate() error {
+	if config == nil || len(config.Mountpoints) == 0 {
+		return errors.New("caster - want at least one mountpoint")
+	}
+
+	seen := make(map[string]bool)
+	for i, mountpoint := range config.Mountpoints {
+		if len(mountpoint.Name) == 0 {
+			em := fmt.Sprintf("caster - mountpoint %d - want a name", i+1)
+			return errors.New(em)
+		}
+		for _, name := range append([]string{mountpoint.Name}, mountpoint.Aliases...) {
+			if err := checkName(name); err != nil {
+				return err
+			}
+			if seen[name] {
+				em := fmt.Sprintf("caster - mountpoint %s is given more than once", name)
+				return errors.New(em)
+			}
+			seen[name] = true
+		}
+		if len(mountpoint.SourcePassword) == 0 {
+			em := fmt.Sprintf("caster - mountpoint %s - want a source password", mountpoint.Name)
+			return errors.New(em)
+		}
+		if _, err := parseNetworks(mountpoint.Name, mountpoint.Allow); err != nil {
+			return err
+		}
+		if _, err := parseNetworks(mountpoint.Name, mountpoint.Deny); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseNetworks parses a list of networks in CIDR form.  A single address
+// is taken as a network containing just that address.
+func parseNetworks(mountpoint string, networks []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(networks))
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			if ip := net.ParseIP(network); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					bits = 8 * net.IPv4len
+				}
+				network = fmt.Sprintf("%s/%d", network, bits)
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			em := fmt.Sprintf("caster - mountpoint %s - illegal network %q", mountpoint, network)
+			return nil, errors.New(em)
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+// checkName checks that a mountpoint name can be used in a request.
+func checkName(name string) error {
+	if len(name) == 0 || strings.ContainsAny(name, "/?&= ") {
+		em := fmt.Sprintf("caster - mountpoint %q - illegal name", name)
+		return errors.New(em)
+	}
+	return nil
+}
+
+// client is a rover connected to a mountpoint.
+type client struct {
+	// subscription says which messages the client wants.
+	subscription *Subscription
+
+	// queue holds the messages waiting to be written to the client.  It's
+	// closed when the client is dropped.
+	queue chan queued
+}
+
+// queued is a message waiting to be written to a client.
+type queued struct {
+	// data is the message frame.
+	data []byte
+
+	// at is the time at which the message was queued.
+	at time.Time
+}
+
+// mount holds the state of one mountpoint.
+type mount struct {
+	config Mountpoint
+
+	// allow and deny are the parsed networks from the config.
+	allow []*net.IPNet
+	deny  []*net.IPNet
+
+	// live is true while a server is connected.
+	live bool
+
+	// clients holds the connected clients.
+	clients map[*client]bool
+
+	// capabilities works out the constellations and message types of the
+	// server's data, for the sourcetable.
+	capabilities *sourcetable.Capabilities
+
+	// handler splits the server's data into messages and measures the
+	// intervals between its epochs.  It's nil until a server connects.
+	handler *rtcm.Handler
+}
+
+// MountpointStats gives the state of a mountpoint.
+type MountpointStats struct {
+	// Live is true while a server is connected.
+	Live bool `json:"live"`
+
+	// Clients is the number of connected clients.
+	Clients int `json:"clients"`
+
+	// Epochs summarises the intervals between the recent epochs from the
+	// server, or the last server if none is connected now.
+	Epochs rtcm.EpochStats `json:"epochs"`
+}
+
+// Caster is an NTRIP caster.
+type Caster struct {
+	// mounts holds the mountpoints, by name.
+	mounts map[string]*mount
+
+	// aliases gives the name of the mountpoint for each alias.
+	aliases map[string]string
+
+	// logger receives the log entries.  It may be nil.
+	logger *log.Logger
+
+	// accessLog receives the access log entries.  It may be nil.
+	accessLog io.Writer
+
+	// accessLogMutex stops the access log entries from being interleaved.
+	accessLogMutex sync.Mutex
+
+	// maxAge is the time for which a message waits to be sent to a client.
+	maxAge time.Duration
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to the mountpoints.
+	mutex sync.Mutex
+}
+
+// New creates a Caster with the given config.  The logger may be nil.
+func New(config *Config, logger *log.Logger) (*Caster, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	caster := Caster{
+		mounts:  make(map[string]*mount),
+		aliases: make(map[string]string),
+		logger:  logger,
+		maxAge:  config.MaxAge(),
+		now:     time.Now,
+	}
+	for _, mountpoint := range config.Mountpoints {
+		// Validate has checked the networks.
+		allow, _ := parseNetworks(mountpoint.Name, mountpoint.Allow)
+		deny, _ := parseNetworks(mountpoint.Name, mountpoint.Deny)
+		caster.mounts[mountpoint.Name] = &mount{
+			config:       mountpoint,
+			allow:        allow,
+			deny:         deny,
+			clients:      make(map[*client]bool),
+			capabilities: sourcetable.NewCapabilities(),
+		}
+		for _, alias := range mountpoint.Aliases {
+			caster.aliases[alias] = mountpoint.Name
+		}
+	}
+
+	return &caster, nil
+}
+
+// Rename gives a mountpoint a new name, keeping the old one as an alias.
+// Its server and clients stay connected.  The new name can be one of the
+// mountpoint's aliases but not one used by another mountpoint.
+func (caster *Caster) Rename(oldName, newName string) error {
+	if err := checkName(newName); err != nil {
+		return err
+	}
+
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	m, found := caster.mounts[oldName]
+	if !found {
+		em := fmt.Sprintf("caster - no mountpoint %s", oldName)
+		return errors.New(em)
+	}
+	if newName == oldName {
+		return nil
+	}
+	_, taken := caster.mounts[newName]
+	if owner, isAlias := caster.aliases[newName]; taken || (isAlias && owner != oldName) {
+		em := fmt.Sprintf("caster - mountpoint %s is already in use", newName)
+		return errors.New(em)
+	}
+
+	delete(caster.mounts, oldName)
+	delete(caster.aliases, newName)
+	caster.mounts[newName] = m
+	caster.aliases[oldName] = newName
+	for alias, name := range caster.aliases {
+		if name == oldName {
+			caster.aliases[alias] = newName
+		}
+	}
+
+	aliases := []string{oldName}
+	for _, alias := range m.config.Aliases {
+		if alias != newName {
+			aliases = append(aliases, alias)
+		}
+	}
+	m.config.Name = newName
+	m.config.Aliases = aliases
+
+	eventlog.Printf(caster.logger, "mountpoint %s renamed to %s", oldName, newName)
+
+	return nil
+}
+
+// ApplyRenames renames each mountpoint whose name has been changed in the
+// config, that is, each one whose name in the config isn't in use and one
+// of whose aliases in the config is its current name.  Its server and
+// clients stay connected.  Other changes to the config are ignored.  It
+// returns the number of mountpoints renamed.
+func (caster *Caster) ApplyRenames(config *Config) (int, error) {
+	renamed := 0
+	for i := range config.Mountpoints {
+		mountpoint := &config.Mountpoints[i]
+
+		oldName := ""
+		caster.mutex.Lock()
+		if _, inUse := caster.mounts[mountpoint.Name]; !inUse {
+			for _, alias := range mountpoint.Aliases {
+				if _, found := caster.mounts[alias]; found {
+					oldName = alias
+					break
+				}
+			}
+		}
+		caster.mutex.Unlock()
+
+		if len(oldName) == 0 {
+			continue
+		}
+		if err := caster.Rename(oldName, mountpoint.Name); err != nil {
+			return renamed, err
+		}
+		renamed++
+	}
+
+	return renamed, nil
+}
+
+// Names returns the names and the aliases of the mountpoints, sorted.
+func (caster *Caster) Names() []string {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	names := make([]string, 0, len(caster.mounts)+len(caster.aliases))
+	for name := range caster.mounts {
+		names = append(names, name)
+	}
+	for alias := range caster.aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the mountpoint with the given name or alias.  The caller
+// must hold the mutex.
+func (caster *Caster) lookup(name string) (*mount, bool) {
+	if actual, isAlias := caster.aliases[name]; isAlias {
+		name = actual
+	}
+	m, found := caster.mounts[name]
+	return m, found
+}
+
+// SetAccessLog sets the writer that receives the access log, one line for
+// each connection in combined log format.  nil turns the access log off.
+func (caster *Caster) SetAccessLog(writer io.Writer) {
+	caster.accessLogMutex.Lock()
+	defer caster.accessLogMutex.Unlock()
+	caster.accessLog = writer
+}
+
+// Stats returns the state of each mountpoint, by name.
+func (caster *Caster) Stats() map[string]MountpointStats {
+	result := make(map[string]MountpointStats)
+	handlers := make(map[string]*rtcm.Handler)
+
+	caster.mutex.Lock()
+	for name, m := range caster.mounts {
+		result[name] = MountpointStats{Live: m.live, Clients: len(m.clients)}
+		handlers[name] = m.handler
+	}
+	caster.mutex.Unlock()
+
+	// The handlers do their own locking.
+	for name, handler := range handlers {
+		if handler == nil {
+			continue
+		}
+		stats := result[name]
+		stats.Epochs = handler.Stats().Epochs
+		result[name] = stats
+	}
+
+	return result
+}
+
+// Serve accepts connections on the listener and handles each in its own
+// goroutine.  It returns when the listener fails, for example when it's
+// closed.
+func (caster *Caster) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go caster.ServeConn(conn)
+	}
+}
+
+// ServeConn handles one connection, from a server or a client, and closes
+// it at the end.
+func (caster *Caster) ServeConn(netConn net.Conn) {
+	defer netConn.Close()
+
+	start := caster.now()
+	conn := &countingConn{Conn: netConn}
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	req, readError := readRequest(reader)
+	if readError != nil {
+		eventlog.Printf(caster.logger, "%s - bad request - %v", conn.RemoteAddr(), readError)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// Only count the data that follows the request.
+	conn.read = int64(reader.Buffered())
+
+	defer caster.logAccess(conn, req, start)
+
+	switch req.method {
+	case "SOURCE":
+		caster.source(conn, reader, req)
+	case "POST":
+		// Only NTRIP version 2 servers use POST.
+		req.version2 = true
+		caster.source(conn, reader, req)
+	case "GET":
+		caster.get(conn, req)
+	default:
+		conn.Write([]byte(ResponseNotImplemented))
+	}
+}
+
+// source handles a connection from a server.
+func (caster *Caster) source(conn net.Conn, reader *bufio.Reader, req *request) {
+	// The target may have a leading "/".  Parameters are ignored.
+	name := strings.TrimPrefix(req.target, "/")
+	if i := strings.Index(name, "?"); i >= 0 {
+		name = name[:i]
+	}
+
+	caster.mutex.Lock()
+	m, found := caster.lookup(name)
+	if !found {
+		caster.mutex.Unlock()
+		eventlog.Printf(caster.logger, "server %s - no mountpoint %q", conn.RemoteAddr(), name)
+		conn.Write([]byte(req.choose(ResponseBadMountpoint, ResponseNotFound)))
+		return
+	}
+	if req.password != m.config.SourcePassword {
+		caster.mutex.Unlock()
+		eventlog.Printf(caster.logger, "server %s - bad password for mountpoint %s", conn.RemoteAddr(), name)
+		conn.Write([]byte(req.choose(ResponseBadPassword, ResponseUnauthorized)))
+		return
+	}
+	if m.live {
+		caster.mutex.Unlock()
+		eventlog.Printf(caster.logger, "server %s - mountpoint %s is taken", conn.RemoteAddr(), name)
+		conn.Write([]byte(req.choose(ResponseTaken, ResponseConflict)))
+		return
+	}
+	m.live = true
+	// The new server may send different data from the last one.
+	m.capabilities = sourcetable.NewCapabilities()
+	caster.mutex.Unlock()
+
+	defer func() {
+		caster.mutex.Lock()
+		m.live = false
+		caster.mutex.Unlock()
+		eventlog.Printf(caster.logger, "server %s - mountpoint %s is down", conn.RemoteAddr(), name)
+	}()
+
+	_, writeError := conn.Write([]byte(req.choose(ResponseOK, ResponseOKVersion2)))
+	if writeError != nil {
+		return
+	}
+	eventlog.Printf(caster.logger, "server %s - mountpoint %s is up", conn.RemoteAddr(), name)
+
+	var data io.Reader = reader
+	if req.chunked {
+		data = httputil.NewChunkedReader(reader)
+	}
+
+	caster.relay(m, data)
+}
+
+// relay splits the data from a server into messages and passes them to the
+// clients of the mountpoint, until the data ends.
+func (caster *Caster) relay(m *mount, data io.Reader) {
+	scanner := rtcm.NewScanner(data)
+	caster.mutex.Lock()
+	m.handler = scanner.Handler()
+	caster.mutex.Unlock()
+
+	for {
+		message, err := scanner.Next()
+		if err != nil {
+			return
+		}
+		caster.fanOut(m, message)
+	}
+}
+
+// fanOut passes a message to the clients of the mountpoint that want it,
+// dropping any client whose queue is full.
+func (caster *Caster) fanOut(m *mount, message *rtcm.Message) {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	now := caster.now()
+	m.capabilities.Observe(message.MessageType, now)
+
+	for c := range m.clients {
+		if !c.subscription.Wants(message.MessageType) {
+			continue
+		}
+		select {
+		case c.queue <- queued{data: message.RawData, at: now}:
+		default:
+			eventlog.Printf(caster.logger, "mountpoint %s - dropping a client that's too slow", m.config.Name)
+			delete(m.clients, c)
+			close(c.queue)
+		}
+	}
+}
+
+// get handles a connection from a client.
+func (caster *Caster) get(conn net.Conn, req *request) {
+	name, subscription, parseError := ParseRequestTarget(req.target)
+	if parseError != nil {
+		eventlog.Printf(caster.logger, "client %s - %v", conn.RemoteAddr(), parseError)
+		conn.Write([]byte(ResponseBadRequest))
+		return
+	}
+
+	caster.mutex.Lock()
+	m, found := caster.lookup(name)
+	if !found || !m.live {
+		caster.mutex.Unlock()
+		conn.Write([]byte(caster.sourcetable()))
+		return
+	}
+
+	if !m.admits(conn.RemoteAddr()) {
+		caster.mutex.Unlock()
+		eventlog.Printf(caster.logger, "client %s - refused by the network rules of mountpoint %s",
+			conn.RemoteAddr(), name)
+		conn.Write([]byte(ResponseForbidden))
+		return
+	}
+
+	if !m.config.allows(req.user, req.password) {
+		caster.mutex.Unlock()
+		eventlog.Printf(caster.logger, "client %s - not authorised for mountpoint %s",
+			conn.RemoteAddr(), name)
+		conn.Write([]byte(ResponseUnauthorized))
+		return
+	}
+
+	// Register the client before replying, so that it gets all the data
+	// sent after the reply.  The data waits in the queue until the reply
+	// has been written.
+	c := &client{subscription: subscription, queue: make(chan queued, clientQueueLength)}
+	m.clients[c] = true
+	caster.mutex.Unlock()
+
+	defer caster.dropClient(m, c)
+
+	eventlog.Printf(caster.logger, "client %s - connected to mountpoint %s", conn.RemoteAddr(), name)
+
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, writeError := conn.Write([]byte(req.choose(ResponseOK, ResponseOKVersion2)))
+	if writeError != nil {
+		return
+	}
+
+	caster.send(conn, c)
+}
+
+// send writes the messages queued for the client to the connection until
+// the client is dropped or a write fails.  Messages that have waited for
+// longer than the maximum age are thrown away.
+func (caster *Caster) send(conn net.Conn, c *client) {
+	discarded := 0
+	for item := range c.queue {
+		if caster.now().Sub(item.at) > caster.maxAge {
+			discarded++
+			continue
+		}
+		if discarded > 0 {
+			eventlog.Printf(caster.logger, "client %s - discarded %d messages older than %v",
+				conn.RemoteAddr(), discarded, caster.maxAge)
+			discarded = 0
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, writeError := conn.Write(item.data)
+		if writeError != nil {
+			eventlog.Printf(caster.logger, "client %s - %v", conn.RemoteAddr(), writeError)
+			return
+		}
+	}
+}
+
+// dropClient removes the client from the mountpoint, if it's still there.
+func (caster *Caster) dropClient(m *mount, c *client) {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	if m.clients[c] {
+		delete(m.clients, c)
+		close(c.queue)
+	}
+}
+
+// sourcetable returns the response giving the sourcetable, which lists the
+// live mountpoints.  The constellations and the message types with their
+// intervals are worked out from the data that the server has sent recently.
+// The caster knows nothing else about the base stations, so most of the
+// other fields in each entry are empty.
+func (caster *Caster) sourcetable() string {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	var table sourcetable.Table
+	for _, mountpoint := range caster.sortedNames() {
+		m := caster.mounts[mountpoint]
+		if !m.live {
+			continue
+		}
+		authentication := "N"
+		if len(m.config.Users) > 0 {
+			authentication = "B"
+		}
+		stream := sourcetable.Stream{
+			Mountpoint:     mountpoint,
+			Identifier:     mountpoint,
+			Format:         "RTCM 3",
+			Generator:      "go-ntrip",
+			Compression:    "none",
+			Authentication: authentication,
+		}
+		m.capabilities.Describe(&stream, time.Now())
+		table.Streams = append(table.Streams, stream)
+	}
+	body := table.String()
+
+	return fmt.Sprintf("SOURCETABLE 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s",
+		len(body), body)
+}
+
+// sortedNames returns the names of the mountpoints in alphabetical order.
+func (caster *Caster) sortedNames() []string {
+	names := make([]string, 0, len(caster.mounts))
+	for name := range caster.mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// admits returns true if a client at the given address may use the
+// mountpoint.  If the mountpoint has network rules and the address isn't an
+// IP address, the client is refused.
+func (m *mount) admits(address net.Addr) bool {
+	if len(m.allow) == 0 && len(m.deny) == 0 {
+		return true
+	}
+
+	host, _, splitError := net.SplitHostPort(address.String())
+	if splitError != nil {
+		host = address.String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range m.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(m.allow) == 0 {
+		return true
+	}
+	for _, network := range m.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if the user may use the mountpoint.
+func (mountpoint *Mountpoint) allows(user, password string) bool {
+	if len(mountpoint.Users) == 0 {
+		return true
+	}
+	for _, u := range mountpoint.Users {
+		if u.Name == user && u.Password == password {
+			return true
+		}
+	}
+	return false
+}
+
+// logAccess writes an entry for a connection to the access log, if there
+// is one.
+func (caster *Caster) logAccess(conn *countingConn, req *request, start time.Time) {
+	caster.accessLogMutex.Lock()
+	defer caster.accessLogMutex.Unlock()
+
+	if caster.accessLog == nil {
+		return
+	}
+
+	host, _, splitError := net.SplitHostPort(conn.RemoteAddr().String())
+	if splitError != nil {
+		host = conn.RemoteAddr().String()
+	}
+
+	// Servers send the data and clients receive it.
+	bytes := conn.written
+	if req.method != "GET" {
+		bytes = conn.read
+	}
+
+	requestLine := req.method + " " + req.target
+	if len(req.protocol) > 0 {
+		requestLine += " " + req.protocol
+	}
+
+	fmt.Fprintf(caster.accessLog, "%s - %s [%s] %q %d %d \"-\" %q %d\n",
+		host, orDash(req.user), start.Format("02/Jan/2006:15:04:05 -0700"),
+		requestLine, conn.status, bytes, orDash(req.userAgent),
+		caster.now().Sub(start).Milliseconds())
+}
+
+// orDash returns the string or, if it's empty, "-", which is how the
+// combined log format shows a missing field.
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+// countingConn is a connection that counts the bytes read and written and
+// notes the status of the response.
+type countingConn struct {
+	net.Conn
+
+	read    int64
+	written int64
+
+	// status is the HTTP status equivalent to the response, or 0 if there
+	// hasn't been one yet.
+	status int
+}
+
+// Read reads from the connection and counts the bytes.
+func (conn *countingConn) Read(buffer []byte) (int, error) {
+	n, err := conn.Conn.Read(buffer)
+	conn.read += int64(n)
+	return n, err
+}
+
+// Write writes to the connection and counts the bytes.  The first write is
+// the response.
+func (conn *countingConn) Write(buffer []byte) (int, error) {
+	if conn.status == 0 {
+		conn.status = statusOf(string(buffer))
+	}
+	n, err := conn.Conn.Write(buffer)
+	conn.written += int64(n)
+	return n, err
+}
+
+// statusOf returns the HTTP status equivalent to a response.
+func statusOf(response string) int {
+	switch {
+	case strings.HasPrefix(response, ResponseBadPassword):
+		return 401
+	case strings.HasPrefix(response, ResponseBadMountpoint):
+		return 404
+	case strings.HasPrefix(response, ResponseTaken):
+		return 409
+	case strings.HasPrefix(response, "HTTP/"):
+		fields := strings.Fields(response)
+		if len(fields) >= 2 {
+			if status, err := strconv.Atoi(fields[1]); err == nil {
+				return status
+			}
+		}
+	}
+	// ICY 200 OK and SOURCETABLE 200 OK.
+	return 200
+}
+
+// request holds the parts of a request that the caster uses.
+type request struct {
+	method string
+	target string
+
+	// protocol is from the request line, for example "HTTP/1.1".  It's
+	// empty for a SOURCE request.
+	protocol string
+
+	// userAgent is from the User-Agent or Source-Agent header.
+	userAgent string
+
+	// user and password are from the SOURCE request or the basic
+	// authentication header.
+	user     string
+	password string
+
+	// version2 is true for an NTRIP version 2 request.
+	version2 bool
+
+	// chunked is true if the data from a server has chunked transfer
+	// encoding.
+	chunked bool
+}
+
+// choose returns the first response for an NTRIP version 1 request and
+// the second for version 2.
+func (req *request) choose(version1, version2 string) string {
+	if req.version2 {
+		return version2
+	}
+	return version1
+}
+
+// readRequest reads a request up to the empty line that ends the headers.
+func readRequest(reader *bufio.Reader) (*request, error) {
+	firstLine, readError := reader.ReadString('\n')
+	if readError != nil {
+		return nil, readError
+	}
+
+	fields := strings.Fields(firstLine)
+	var req request
+	switch {
+	case len(fields) >= 3 && fields[0] == "SOURCE":
+		// SOURCE password /mountpoint
+		req.method = fields[0]
+		req.password = fields[1]
+		req.target = fields[2]
+	case len(fields) >= 2:
+		// GET /mountpoint HTTP/1.1
+		req.method = fields[0]
+		req.target = fields[1]
+		if len(fields) >= 3 {
+			req.protocol = fields[2]
+		}
+	default:
+		em := fmt.Sprintf("illegal request line %q", strings.TrimSpace(firstLine))
+		return nil, errors.New(em)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			return &req, nil
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch name {
+		case "ntrip-version":
+			req.version2 = strings.HasPrefix(value, "Ntrip/2")
+		case "user-agent", "source-agent":
+			req.userAgent = value
+		case "transfer-encoding":
+			req.chunked = strings.EqualFold(value, "chunked")
+		case "authorization":
+			if user, password, ok := parseBasicAuth(value); ok {
+				req.user = user
+				req.password = password
+			}
+		}
+	}
+}
+
+// parseBasicAuth gets the user and password from the value of an HTTP
+// basic authorization header.
+func parseBasicAuth(value string) (string, string, bool) {
+	const prefix = "Basic "
+	if len(value) < len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+	credentials := string(decoded)
+	i := strings.Index(credentials, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	return credentials[:i], credentials[i+1:], true
+}
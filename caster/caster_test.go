@@ -0,0 +1,781 @@
+package caster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httputil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/generator"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testConfig has an open mountpoint and one that needs a user name and
+// password.
+var testConfig = Config{
+	Mountpoints: []Mountpoint{
+		{Name: "OPEN", SourcePassword: "secret"},
+		{Name: "CLOSED", SourcePassword: "secret", Users: []User{{"rover", "letmein"}}},
+	},
+}
+
+// connect returns a connection to the caster.
+func connect(caster *Caster) net.Conn {
+	clientEnd, casterEnd := net.Pipe()
+	go caster.ServeConn(casterEnd)
+	return clientEnd
+}
+
+// send connects to the caster, sends the request and returns the connection
+// and a reader for the response.
+func send(t *testing.T, caster *Caster, request string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn := connect(caster)
+	_, err := conn.Write([]byte(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, bufio.NewReader(conn)
+}
+
+// readResponse reads the response up to and including the empty line after
+// the headers, or the single line of an NTRIP version 1 response.
+func readResponse(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	response := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading response %q - %v", response, err)
+		}
+		response += line
+		if line == "\r\n" || strings.HasPrefix(response, "ICY") || strings.HasPrefix(response, "ERROR") {
+			return response
+		}
+	}
+}
+
+// basic returns an HTTP basic authorization header.
+func basic(user, password string) string {
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)) + "\r\n"
+}
+
+func newTestCaster(t *testing.T) *Caster {
+	t.Helper()
+	caster, err := New(&testConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caster
+}
+
+// waitUntilLive waits for a server's login to be complete.
+func waitUntilLive(caster *Caster, name string) {
+	for i := 0; i < 100; i++ {
+		caster.mutex.Lock()
+		live := caster.mounts[name].live
+		caster.mutex.Unlock()
+		if live {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestValidate checks that Validate rejects bad configs.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      *Config
+		wantError   string
+	}{
+		{"good", &testConfig, ""},
+		{"nil", nil, "caster - want at least one mountpoint"},
+		{"empty", &Config{}, "caster - want at least one mountpoint"},
+		{"no name", &Config{Mountpoints: []Mountpoint{{SourcePassword: "x"}}},
+			"caster - mountpoint 1 - want a name"},
+		{"illegal name", &Config{Mountpoints: []Mountpoint{{Name: "MY/BASE", SourcePassword: "x"}}},
+			`caster - mountpoint "MY/BASE" - illegal name`},
+		{"duplicate", &Config{Mountpoints: []Mountpoint{{Name: "A", SourcePassword: "x"}, {Name: "A", SourcePassword: "y"}}},
+			"caster - mountpoint A is given more than once"},
+		{"no password", &Config{Mountpoints: []Mountpoint{{Name: "A"}}},
+			"caster - mountpoint A - want a source password"},
+		{"illegal alias", &Config{Mountpoints: []Mountpoint{{Name: "A", Aliases: []string{"B?"}, SourcePassword: "x"}}},
+			`caster - mountpoint "B?" - illegal name`},
+		{"illegal network", &Config{Mountpoints: []Mountpoint{{Name: "A", SourcePassword: "x", Deny: []string{"10.0.0.0/33"}}}},
+			`caster - mountpoint A - illegal network "10.0.0.0/33"`},
+		{"alias clash", &Config{Mountpoints: []Mountpoint{
+			{Name: "A", SourcePassword: "x"}, {Name: "B", Aliases: []string{"A"}, SourcePassword: "y"}}},
+			"caster - mountpoint A is given more than once"},
+	}
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestRelay checks that the messages from an NTRIP version 1 server reach
+// a client, filtered by its subscription, and that non-RTCM data is dropped.
+func TestRelay(t *testing.T) {
+	caster := newTestCaster(t)
+
+	server, serverReader := send(t, caster, "SOURCE secret /OPEN\r\nSource-Agent: test\r\n\r\n")
+	defer server.Close()
+	if got := readResponse(t, serverReader); got != ResponseOK {
+		t.Fatalf("server: want %q got %q", ResponseOK, got)
+	}
+	waitUntilLive(caster, "OPEN")
+
+	rover, roverReader := send(t, caster, "GET /OPEN?types=1005 HTTP/1.0\r\n\r\n")
+	defer rover.Close()
+	if got := readResponse(t, roverReader); got != ResponseOK {
+		t.Fatalf("rover: want %q got %q", ResponseOK, got)
+	}
+
+	var data []byte
+	data = append(data, testdata.AllJunk...)
+	data = append(data, testdata.MessageFrameType1005...)
+	data = append(data, testdata.MessageFrameType1074_2...)
+	data = append(data, testdata.MessageFrameType1005...)
+
+	go func() {
+		server.Write(data)
+		server.Close()
+	}()
+
+	want := append(append([]byte{}, testdata.MessageFrameType1005...), testdata.MessageFrameType1005...)
+	got := make([]byte, len(want))
+	_, readError := io.ReadFull(roverReader, got)
+	if readError != nil {
+		t.Fatal(readError)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+}
+
+// TestAliases checks that a server and a client can use a mountpoint
+// under one of its aliases.
+func TestAliases(t *testing.T) {
+	config := Config{Mountpoints: []Mountpoint{
+		{Name: "NEWBASE", Aliases: []string{"OLDBASE"}, SourcePassword: "secret"},
+	}}
+	caster, err := New(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, serverReader := send(t, caster, "SOURCE secret /OLDBASE\r\n\r\n")
+	defer server.Close()
+	if got := readResponse(t, serverReader); got != ResponseOK {
+		t.Fatalf("server: want %q got %q", ResponseOK, got)
+	}
+	waitUntilLive(caster, "NEWBASE")
+
+	for _, name := range []string{"NEWBASE", "OLDBASE"} {
+		rover, roverReader := send(t, caster, "GET /"+name+" HTTP/1.0\r\n\r\n")
+		if got := readResponse(t, roverReader); got != ResponseOK {
+			t.Errorf("%s: want %q got %q", name, ResponseOK, got)
+		}
+		rover.Close()
+	}
+
+	if table := caster.sourcetable(); strings.Contains(table, "OLDBASE") {
+		t.Errorf("want only the name in the sourcetable\n%s", table)
+	}
+}
+
+// TestRename checks that renaming a mountpoint keeps its server and its
+// clients connected.
+func TestRename(t *testing.T) {
+	config := Config{Mountpoints: []Mountpoint{
+		{Name: "OLDBASE", Aliases: []string{"ALIAS"}, SourcePassword: "secret"},
+		{Name: "OTHER", SourcePassword: "secret"},
+	}}
+	caster, err := New(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, serverReader := send(t, caster, "SOURCE secret /OLDBASE\r\n\r\n")
+	defer server.Close()
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "OLDBASE")
+
+	rover, roverReader := send(t, caster, "GET /OLDBASE HTTP/1.0\r\n\r\n")
+	defer rover.Close()
+	readResponse(t, roverReader)
+
+	if err := caster.Rename("OLDBASE", "NEWBASE"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server and the client are still connected.
+	go server.Write(testdata.MessageFrameType1005)
+	got := make([]byte, len(testdata.MessageFrameType1005))
+	if _, err := io.ReadFull(roverReader, got); err != nil {
+		t.Fatal(err)
+	}
+
+	// All three names work.
+	for _, name := range []string{"NEWBASE", "OLDBASE", "ALIAS"} {
+		conn, reader := send(t, caster, "GET /"+name+" HTTP/1.0\r\n\r\n")
+		if got := readResponse(t, reader); got != ResponseOK {
+			t.Errorf("%s: want %q got %q", name, ResponseOK, got)
+		}
+		conn.Close()
+	}
+	if table := caster.sourcetable(); !strings.Contains(table, "STR;NEWBASE;") {
+		t.Errorf("want NEWBASE in the sourcetable\n%s", table)
+	}
+
+	var testData = []struct {
+		oldName   string
+		newName   string
+		wantError string
+	}{
+		{"NOSUCH", "X", "caster - no mountpoint NOSUCH"},
+		{"NEWBASE", "OTHER", "caster - mountpoint OTHER is already in use"},
+		{"OTHER", "OLDBASE", "caster - mountpoint OLDBASE is already in use"},
+		{"NEWBASE", "A/B", `caster - mountpoint "A/B" - illegal name`},
+	}
+	for _, td := range testData {
+		err := caster.Rename(td.oldName, td.newName)
+		if err == nil {
+			t.Errorf("%s to %s: want an error", td.oldName, td.newName)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s to %s: want error %s got %s", td.oldName, td.newName, td.wantError, err.Error())
+		}
+	}
+
+	// Renaming back to an alias is allowed.
+	if err := caster.Rename("NEWBASE", "OLDBASE"); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestApplyRenames checks that ApplyRenames renames the mountpoints whose
+// names have been changed in the config, and that the server of a renamed
+// mountpoint carries on feeding its rovers.
+func TestApplyRenames(t *testing.T) {
+	config := Config{Mountpoints: []Mountpoint{
+		{Name: "OLDBASE", SourcePassword: "secret"},
+		{Name: "OTHER", SourcePassword: "secret"},
+	}}
+	caster, err := New(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, serverReader := send(t, caster, "SOURCE secret /OLDBASE\r\n\r\n")
+	defer server.Close()
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "OLDBASE")
+
+	reloaded := Config{Mountpoints: []Mountpoint{
+		{Name: "NEWBASE", Aliases: []string{"OLDBASE"}, SourcePassword: "secret"},
+		{Name: "OTHER", SourcePassword: "secret"},
+		{Name: "ADDED", Aliases: []string{"NOSUCH"}, SourcePassword: "secret"},
+	}}
+	renamed, err := caster.ApplyRenames(&reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 1 {
+		t.Errorf("want 1 renamed, got %d", renamed)
+	}
+
+	wantNames := []string{"NEWBASE", "OLDBASE", "OTHER"}
+	if diff := cmp.Diff(wantNames, caster.Names()); diff != "" {
+		t.Error(diff)
+	}
+
+	// A rover that uses the new name is fed by the server that connected
+	// under the old one.
+	rover, roverReader := send(t, caster, "GET /NEWBASE HTTP/1.0\r\n\r\n")
+	defer rover.Close()
+	if got := readResponse(t, roverReader); got != ResponseOK {
+		t.Fatalf("want %q got %q", ResponseOK, got)
+	}
+	go server.Write(testdata.MessageFrameType1005)
+	got := make([]byte, len(testdata.MessageFrameType1005))
+	if _, err := io.ReadFull(roverReader, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(testdata.MessageFrameType1005, got) {
+		t.Error("the rover got the wrong data")
+	}
+
+	// Applying the same config again changes nothing.
+	renamed, err = caster.ApplyRenames(&reloaded)
+	if err != nil || renamed != 0 {
+		t.Errorf("second time: want 0 renamed and no error, got %d and %v", renamed, err)
+	}
+}
+
+// accessLogLines waits for the access log to have the given number of lines
+// and returns them.
+func accessLogLines(caster *Caster, buffer *bytes.Buffer, want int) []string {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		caster.accessLogMutex.Lock()
+		lines = strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+		caster.accessLogMutex.Unlock()
+		if len(lines) >= want && len(lines[0]) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return lines
+}
+
+// TestAccessLog checks the access log entries for a server, a client that
+// sends a bad request and a client that asks for the sourcetable.
+func TestAccessLog(t *testing.T) {
+	caster := newTestCaster(t)
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	caster.now = func() time.Time { return start }
+	var buffer bytes.Buffer
+	caster.SetAccessLog(&buffer)
+
+	server, serverReader := send(t, caster,
+		"POST /OPEN HTTP/1.1\r\nNtrip-Version: Ntrip/2.0\r\nUser-Agent: NTRIP test-server\r\n"+
+			basic("base", "secret")+"\r\n")
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "OPEN")
+	server.Write(testdata.MessageFrameType1005)
+	server.Close()
+	accessLogLines(caster, &buffer, 1)
+
+	rover, roverReader := send(t, caster,
+		"GET /OPEN?types=junk HTTP/1.1\r\nUser-Agent: NTRIP test-rover\r\n"+basic("rover", "letmein")+"\r\n")
+	readResponse(t, roverReader)
+	rover.Close()
+	accessLogLines(caster, &buffer, 2)
+
+	rover, roverReader = send(t, caster, "GET / HTTP/1.0\r\n\r\n")
+	readResponse(t, roverReader)
+	rover.Close()
+
+	want := []string{
+		fmt.Sprintf(`pipe - base [01/Mar/2024:12:00:00 +0000] "POST /OPEN HTTP/1.1" 200 %d "-" "NTRIP test-server" 0`,
+			len(testdata.MessageFrameType1005)),
+		fmt.Sprintf(`pipe - rover [01/Mar/2024:12:00:00 +0000] "GET /OPEN?types=junk HTTP/1.1" 400 %d "-" "NTRIP test-rover" 0`,
+			len(ResponseBadRequest)),
+	}
+	got := accessLogLines(caster, &buffer, 3)
+	if len(got) != 3 {
+		t.Fatalf("want 3 lines got %d\n%s", len(got), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("want %s\ngot  %s", want[i], got[i])
+		}
+	}
+	if !strings.HasPrefix(got[2], `pipe - - [01/Mar/2024:12:00:00 +0000] "GET / HTTP/1.0" 200 `) {
+		t.Errorf("unexpected sourcetable entry %s", got[2])
+	}
+}
+
+// TestStatusOf checks the HTTP status equivalent to each response.
+func TestStatusOf(t *testing.T) {
+	var testData = []struct {
+		response string
+		want     int
+	}{
+		{ResponseOK, 200},
+		{ResponseOKVersion2, 200},
+		{"SOURCETABLE 200 OK\r\n", 200},
+		{ResponseBadPassword, 401},
+		{ResponseBadMountpoint, 404},
+		{ResponseTaken, 409},
+		{ResponseUnauthorized, 401},
+		{ResponseNotFound, 404},
+		{ResponseConflict, 409},
+		{ResponseBadRequest, 400},
+		{ResponseNotImplemented, 501},
+	}
+	for _, td := range testData {
+		if got := statusOf(td.response); got != td.want {
+			t.Errorf("%q: want %d got %d", td.response, td.want, got)
+		}
+	}
+}
+
+// addressedConn is a connection that appears to come from a given address.
+type addressedConn struct {
+	net.Conn
+	address net.Addr
+}
+
+// RemoteAddr returns the address.
+func (conn *addressedConn) RemoteAddr() net.Addr {
+	return conn.address
+}
+
+// TestAdmits checks the network rules of a mountpoint.
+func TestAdmits(t *testing.T) {
+	config := Config{Mountpoints: []Mountpoint{
+		{Name: "OPEN", SourcePassword: "x"},
+		{Name: "LOCAL", SourcePassword: "x",
+			Allow: []string{"192.0.2.0/24", "2001:db8::/32"}, Deny: []string{"192.0.2.7"}},
+		{Name: "BLOCKED", SourcePassword: "x", Deny: []string{"198.51.100.0/24"}},
+	}}
+	caster, err := New(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = []struct {
+		mountpoint string
+		address    net.Addr
+		want       bool
+	}{
+		{"OPEN", &net.TCPAddr{IP: net.ParseIP("203.0.113.1")}, true},
+		{"OPEN", pipeAddr{}, true},
+		{"LOCAL", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}, true},
+		{"LOCAL", &net.TCPAddr{IP: net.ParseIP("2001:db8::1")}, true},
+		{"LOCAL", &net.TCPAddr{IP: net.ParseIP("192.0.2.7")}, false},
+		{"LOCAL", &net.TCPAddr{IP: net.ParseIP("203.0.113.1")}, false},
+		{"LOCAL", pipeAddr{}, false},
+		{"BLOCKED", &net.TCPAddr{IP: net.ParseIP("198.51.100.9")}, false},
+		{"BLOCKED", &net.TCPAddr{IP: net.ParseIP("203.0.113.1")}, true},
+	}
+	for _, td := range testData {
+		got := caster.mounts[td.mountpoint].admits(td.address)
+		if got != td.want {
+			t.Errorf("%s %v: want %v got %v", td.mountpoint, td.address, td.want, got)
+		}
+	}
+}
+
+// pipeAddr is an address that isn't an IP address, like that of a pipe.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// TestForbidden checks that a client from a network that isn't allowed is
+// refused with 403 Forbidden.
+func TestForbidden(t *testing.T) {
+	config := Config{Mountpoints: []Mountpoint{
+		{Name: "LOCAL", SourcePassword: "secret", Allow: []string{"192.0.2.0/24"}},
+	}}
+	caster, err := New(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, serverReader := send(t, caster, "SOURCE secret /LOCAL\r\n\r\n")
+	defer server.Close()
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "LOCAL")
+
+	var testData = []struct {
+		address string
+		want    string
+	}{
+		{"192.0.2.1", ResponseOK},
+		{"203.0.113.1", ResponseForbidden},
+	}
+	for _, td := range testData {
+		clientEnd, casterEnd := net.Pipe()
+		address := &net.TCPAddr{IP: net.ParseIP(td.address), Port: 40000}
+		go caster.ServeConn(&addressedConn{Conn: casterEnd, address: address})
+		go clientEnd.Write([]byte("GET /LOCAL HTTP/1.0\r\n\r\n"))
+		got := readResponse(t, bufio.NewReader(clientEnd))
+		clientEnd.Close()
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.address, td.want, got)
+		}
+	}
+}
+
+// TestVersion2 checks a server that sends chunked data with NTRIP version 2
+// and a client that authenticates.
+func TestVersion2(t *testing.T) {
+	caster := newTestCaster(t)
+
+	server, serverReader := send(t, caster,
+		"POST /CLOSED HTTP/1.1\r\nNtrip-Version: Ntrip/2.0\r\n"+basic("base", "secret")+
+			"Transfer-Encoding: chunked\r\n\r\n")
+	defer server.Close()
+	if got := readResponse(t, serverReader); got != ResponseOKVersion2 {
+		t.Fatalf("server: want %q got %q", ResponseOKVersion2, got)
+	}
+	waitUntilLive(caster, "CLOSED")
+
+	rover, roverReader := send(t, caster,
+		"GET /CLOSED HTTP/1.1\r\nNtrip-Version: Ntrip/2.0\r\n"+basic("rover", "letmein")+"\r\n")
+	defer rover.Close()
+	if got := readResponse(t, roverReader); got != ResponseOKVersion2 {
+		t.Fatalf("rover: want %q got %q", ResponseOKVersion2, got)
+	}
+
+	go func() {
+		chunked := httputil.NewChunkedWriter(server)
+		chunked.Write(testdata.MessageFrameType1005)
+		chunked.Close()
+		server.Close()
+	}()
+
+	got := make([]byte, len(testdata.MessageFrameType1005))
+	_, readError := io.ReadFull(roverReader, got)
+	if readError != nil {
+		t.Fatal(readError)
+	}
+	if !bytes.Equal(testdata.MessageFrameType1005, got) {
+		t.Errorf("want %v\ngot  %v", testdata.MessageFrameType1005, got)
+	}
+}
+
+// TestRefusals checks the responses to requests that the caster refuses.
+func TestRefusals(t *testing.T) {
+	caster := newTestCaster(t)
+
+	// Make OPEN live.
+	server, serverReader := send(t, caster, "SOURCE secret /OPEN\r\n\r\n")
+	defer server.Close()
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "OPEN")
+
+	var testData = []struct {
+		description string
+		request     string
+		want        string
+	}{
+		{"v1 bad mountpoint", "SOURCE secret /NOSUCH\r\n\r\n", ResponseBadMountpoint},
+		{"v1 bad password", "SOURCE wrong /CLOSED\r\n\r\n", ResponseBadPassword},
+		{"v1 taken", "SOURCE secret /OPEN\r\n\r\n", ResponseTaken},
+		{"v2 bad mountpoint", "POST /NOSUCH HTTP/1.1\r\n" + basic("", "secret") + "\r\n", ResponseNotFound},
+		{"v2 bad password", "POST /CLOSED HTTP/1.1\r\n" + basic("", "wrong") + "\r\n", ResponseUnauthorized},
+		{"v2 taken", "POST /OPEN HTTP/1.1\r\n" + basic("", "secret") + "\r\n", ResponseConflict},
+		{"bad types", "GET /OPEN?types=junk HTTP/1.0\r\n\r\n", ResponseBadRequest},
+		{"unknown method", "DELETE /OPEN HTTP/1.1\r\n\r\n", ResponseNotImplemented},
+	}
+	for _, td := range testData {
+		conn, reader := send(t, caster, td.request)
+		got := readResponse(t, reader)
+		conn.Close()
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.description, td.want, got)
+		}
+	}
+}
+
+// TestClientAuthorisation checks that a mountpoint with users only accepts
+// those users.
+func TestClientAuthorisation(t *testing.T) {
+	caster := newTestCaster(t)
+
+	server, serverReader := send(t, caster, "SOURCE secret /CLOSED\r\n\r\n")
+	defer server.Close()
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "CLOSED")
+
+	var testData = []struct {
+		description string
+		auth        string
+		want        string
+	}{
+		{"none", "", ResponseUnauthorized},
+		{"wrong password", basic("rover", "wrong"), ResponseUnauthorized},
+		{"wrong user", basic("intruder", "letmein"), ResponseUnauthorized},
+		{"good", basic("rover", "letmein"), ResponseOK},
+	}
+	for _, td := range testData {
+		conn, reader := send(t, caster, "GET /CLOSED HTTP/1.0\r\n"+td.auth+"\r\n")
+		got := readResponse(t, reader)
+		conn.Close()
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.description, td.want, got)
+		}
+	}
+}
+
+// TestSourcetable checks that the sourcetable lists the live mountpoints.
+func TestSourcetable(t *testing.T) {
+	const wantBody = "STR;CLOSED;CLOSED;RTCM 3;;0;;;;0.00;0.00;0;0;go-ntrip;none;B;N;0;\r\n" +
+		"ENDSOURCETABLE\r\n"
+	want := fmt.Sprintf("SOURCETABLE 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s",
+		len(wantBody), wantBody)
+
+	caster := newTestCaster(t)
+
+	server, serverReader := send(t, caster, "SOURCE secret /CLOSED\r\n\r\n")
+	defer server.Close()
+	readResponse(t, serverReader)
+	waitUntilLive(caster, "CLOSED")
+
+	// OPEN isn't live, so asking for it gives the sourcetable too.
+	for _, target := range []string{"/", "/OPEN"} {
+		conn, _ := send(t, caster, "GET "+target+" HTTP/1.0\r\n\r\n")
+		got, _ := io.ReadAll(conn)
+		conn.Close()
+		if string(got) != want {
+			t.Errorf("%s: want %q got %q", target, want, string(got))
+		}
+	}
+}
+
+// TestSourcetableCapabilities checks that the sourcetable shows the
+// constellations and message types that the server has sent.
+func TestSourcetableCapabilities(t *testing.T) {
+	caster := newTestCaster(t)
+	m := caster.mounts["OPEN"]
+	m.live = true
+
+	caster.fanOut(m, &rtcm.Message{MessageType: 1005})
+	caster.fanOut(m, &rtcm.Message{MessageType: 1074})
+	caster.fanOut(m, &rtcm.Message{MessageType: 1094})
+
+	const want = "STR;OPEN;OPEN;RTCM 3;1005,1074,1094;0;GPS+GAL;;;0.00;0.00;0;0;go-ntrip;none;N;N;0;\r\n"
+	got := caster.sourcetable()
+	if !strings.Contains(got, want) {
+		t.Errorf("want %q in %q", want, got)
+	}
+}
+
+// TestSlowClient checks that a client whose queue is full is dropped.
+func TestSlowClient(t *testing.T) {
+	caster := newTestCaster(t)
+	m := caster.mounts["OPEN"]
+
+	slow := &client{queue: make(chan queued, 1)}
+	m.clients[slow] = true
+
+	message := &rtcm.Message{MessageType: 1005, RawData: testdata.MessageFrameType1005}
+
+	caster.fanOut(m, message)
+	if !m.clients[slow] {
+		t.Fatal("client dropped too soon")
+	}
+
+	caster.fanOut(m, message)
+	if m.clients[slow] {
+		t.Error("want the client dropped")
+	}
+
+	// The queue is closed after the message that was queued.
+	<-slow.queue
+	if _, open := <-slow.queue; open {
+		t.Error("want the queue closed")
+	}
+}
+
+// TestSendDiscardsOldMessages checks that the messages that have waited
+// too long for a client are thrown away.
+func TestSendDiscardsOldMessages(t *testing.T) {
+	var logBuffer bytes.Buffer
+	caster, err := New(&Config{Mountpoints: testConfig.Mountpoints, MaxAgeMilliseconds: 2000},
+		log.New(&logBuffer, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	caster.now = func() time.Time { return now }
+
+	// The client stalled while these were queued.
+	c := &client{queue: make(chan queued, 4)}
+	c.queue <- queued{data: []byte("old "), at: now.Add(-3 * time.Second)}
+	c.queue <- queued{data: []byte("older "), at: now.Add(-10 * time.Second)}
+	c.queue <- queued{data: []byte("recent "), at: now.Add(-time.Second)}
+	c.queue <- queued{data: []byte("new"), at: now}
+	close(c.queue)
+
+	clientEnd, casterEnd := net.Pipe()
+	go func() {
+		caster.send(casterEnd, c)
+		casterEnd.Close()
+	}()
+
+	got, _ := io.ReadAll(clientEnd)
+	if string(got) != "recent new" {
+		t.Errorf("want recent new got %q", got)
+	}
+	if !strings.Contains(logBuffer.String(), "discarded 2 messages older than 2s") {
+		t.Errorf("want the discards logged\n%s", logBuffer.String())
+	}
+}
+
+// TestMaxAge checks the default maximum age.
+func TestMaxAge(t *testing.T) {
+	if got := (&Config{}).MaxAge(); got != DefaultMaxAge {
+		t.Errorf("want %v got %v", DefaultMaxAge, got)
+	}
+	if got := (&Config{MaxAgeMilliseconds: 500}).MaxAge(); got != 500*time.Millisecond {
+		t.Errorf("want 500ms got %v", got)
+	}
+}
+
+// TestStats checks that the caster reports the state of each mountpoint
+// and the epochs from its server.
+func TestStats(t *testing.T) {
+	caster := newTestCaster(t)
+
+	got := caster.Stats()
+	if len(got) != 2 || got["OPEN"].Live || got["OPEN"].Epochs.Epochs != 0 {
+		t.Fatalf("before the server connects: got %v", got)
+	}
+
+	server, serverReader := send(t, caster, "SOURCE secret /OPEN\r\nSource-Agent: test\r\n\r\n")
+	defer server.Close()
+	if got := readResponse(t, serverReader); got != ResponseOK {
+		t.Fatalf("server: want %q got %q", ResponseOK, got)
+	}
+	waitUntilLive(caster, "OPEN")
+
+	gen, err := generator.New(generator.Config{
+		Satellites: map[string]int{"GPS": 8, "Galileo": 6},
+		Start:      time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 3; i++ {
+			for _, frame := range gen.Epoch() {
+				server.Write(frame)
+			}
+		}
+	}()
+
+	// The stats follow the data.
+	for i := 0; i < 100; i++ {
+		got = caster.Stats()
+		if got["OPEN"].Epochs.Epochs == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !got["OPEN"].Live || got["OPEN"].Epochs.Epochs != 3 {
+		t.Errorf("OPEN: want live with 3 epochs, got %v", got["OPEN"])
+	}
+	if got["CLOSED"].Live || got["CLOSED"].Epochs.Epochs != 0 {
+		t.Errorf("CLOSED: want nothing, got %v", got["CLOSED"])
+	}
+}
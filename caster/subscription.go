@@ -0,0 +1,75 @@
+package caster
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// A rover on a metered mobile connection may not want everything that a
+// base station sends - a single-frequency GPS rover has no use for the
+// Galileo or Beidou observations, for example.  The rover can ask for just
+// the message types it needs by adding a types parameter to the mountpoint
+// in its request:
+//
+//	GET /MYBASE?types=1005,1077 HTTP/1.0
+//
+// and the caster then forwards only messages of those types to it.
+
+// typesParameter is the name of the query parameter listing the message
+// types.
+const typesParameter = "types"
+
+// Subscription says which messages a client wants.
+type Subscription struct {
+	// types holds the wanted message types.  If it's empty, the client
+	// wants all the RTCM messages.
+	types map[int]bool
+}
+
+// ParseRequestTarget splits the target of a client's request, for example
+// "/MYBASE?types=1005,1077", into the mountpoint and the subscription.  If
+// there is no types parameter, the client gets all the RTCM messages.
+func ParseRequestTarget(target string) (string, *Subscription, error) {
+	parsed, parseError := url.Parse(target)
+	if parseError != nil {
+		em := fmt.Sprintf("illegal request target %q", target)
+		return "", nil, errors.New(em)
+	}
+
+	mountpoint := strings.TrimPrefix(parsed.Path, "/")
+
+	subscription := Subscription{types: make(map[int]bool)}
+	for _, list := range parsed.Query()[typesParameter] {
+		for _, field := range strings.Split(list, ",") {
+			field = strings.TrimSpace(field)
+			if len(field) == 0 {
+				continue
+			}
+			messageType, err := strconv.Atoi(field)
+			if err != nil || messageType <= 0 {
+				em := fmt.Sprintf("illegal message type %q", field)
+				return "", nil, errors.New(em)
+			}
+			subscription.types[messageType] = true
+		}
+	}
+
+	return mountpoint, &subscription, nil
+}
+
+// Wants returns true if the client wants messages of the given type.  A
+// client never wants non-RTCM data.
+func (subscription *Subscription) Wants(messageType int) bool {
+	if messageType == utils.NonRTCMMessage {
+		return false
+	}
+	if subscription == nil || len(subscription.types) == 0 {
+		return true
+	}
+	return subscription.types[messageType]
+}
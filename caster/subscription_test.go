@@ -0,0 +1,82 @@
+package caster
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestParseRequestTarget checks that the mountpoint and the wanted message
+// types are taken from the request target.
+func TestParseRequestTarget(t *testing.T) {
+	var testData = []struct {
+		target         string
+		wantMountpoint string
+		wantTypes      []int
+		wantError      string
+	}{
+		{"/MYBASE", "MYBASE", nil, ""},
+		{"MYBASE", "MYBASE", nil, ""},
+		{"/MYBASE?types=1005,1077", "MYBASE", []int{1005, 1077}, ""},
+		{"/MYBASE?types=1005&types=1087", "MYBASE", []int{1005, 1087}, ""},
+		{"/MYBASE?types=", "MYBASE", nil, ""},
+		{"/MYBASE?types=1005,junk", "", nil, `illegal message type "junk"`},
+		{"/MYBASE?types=-1", "", nil, `illegal message type "-1"`},
+		{"/MY%zzBASE", "", nil, `illegal request target "/MY%zzBASE"`},
+	}
+	for _, td := range testData {
+		mountpoint, subscription, err := ParseRequestTarget(td.target)
+		if len(td.wantError) > 0 {
+			if err == nil {
+				t.Errorf("%s: want error %s", td.target, td.wantError)
+			} else if err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %s", td.target, td.wantError, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.target, err)
+			continue
+		}
+
+		if mountpoint != td.wantMountpoint {
+			t.Errorf("%s: want mountpoint %s got %s", td.target, td.wantMountpoint, mountpoint)
+		}
+
+		if len(subscription.types) != len(td.wantTypes) {
+			t.Errorf("%s: want %d types got %d", td.target, len(td.wantTypes), len(subscription.types))
+		}
+		for _, messageType := range td.wantTypes {
+			if !subscription.Wants(messageType) {
+				t.Errorf("%s: want type %d", td.target, messageType)
+			}
+		}
+	}
+}
+
+// TestWants checks which messages a subscription lets through.
+func TestWants(t *testing.T) {
+	_, some, _ := ParseRequestTarget("/MYBASE?types=1005,1077")
+	_, all, _ := ParseRequestTarget("/MYBASE")
+	var none *Subscription
+
+	var testData = []struct {
+		description  string
+		subscription *Subscription
+		messageType  int
+		want         bool
+	}{
+		{"some wanted", some, 1077, true},
+		{"some not wanted", some, 1087, false},
+		{"some non-RTCM", some, utils.NonRTCMMessage, false},
+		{"all", all, 1087, true},
+		{"all non-RTCM", all, utils.NonRTCMMessage, false},
+		{"nil", none, 1087, true},
+	}
+	for _, td := range testData {
+		got := td.subscription.Wants(td.messageType)
+		if got != td.want {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
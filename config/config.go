@@ -0,0 +1,633 @@
+// The config package reads the JSON config shared by the go-ntrip commands.
+// There is one schema for all of them.  It has sections for the things that
+// most of the commands need - the input device and its serial parameters,
+// the caster, the base station, the logs and the filtering of the message
+// stream - plus a section for each command that needs settings of its own.
+// A command reads the sections that it uses and ignores the rest, so one
+// file can drive all the commands in a pipeline.  For example:
+//
+//	{
+//	    "input": {
+//	        "devices": ["/dev/ttyACM0", "/dev/ttyACM1"],
+//	        "serial": {"speed": 115200},
+//	        "read_timeout_milliseconds": 3000
+//	    },
+//	    "caster": {
+//	        "host": "caster.example.com",
+//	        "port": 2101,
+//	        "mountpoint": "MYBASE",
+//	        "password": "secret"
+//	    },
+//	    "logging": {
+//	        "display_messages": true,
+//	        "record_messages": true,
+//	        "message_log_directory": "rtcmlog"
+//	    },
+//	    "filter": {
+//	        "drop_types": [1230]
+//	    },
+//	    "rtcmfilter": {
+//	        "memory_soft_cap_megabytes": 200
+//	    }
+//	}
+//
+// Before this package, each command had its own flat config with its own
+// names for the same things.  Those files are still accepted:  a file whose
+// top-level names are not all section names is read in the old format and
+// converted.  See legacy.go.
+//
+// The config may also be written in YAML - see yaml.go - and any value may
+// refer to an environment variable, for example "${CASTER_PASSWORD}", so
+// that secrets don't have to be stored in the file - see env.go.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/goblimey/go-ntrip/caster"
+	"github.com/goblimey/go-ntrip/dashboard"
+	"github.com/goblimey/go-ntrip/demux"
+	"github.com/goblimey/go-ntrip/health"
+	"github.com/goblimey/go-ntrip/maintenance"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/mqtt"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/notify"
+	"github.com/goblimey/go-ntrip/ntrip"
+	"github.com/goblimey/go-ntrip/queue"
+	"github.com/goblimey/go-ntrip/reposition"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/station"
+	"github.com/goblimey/go-ntrip/telemetry"
+	"github.com/goblimey/go-ntrip/timecheck"
+	"github.com/goblimey/go-ntrip/transport"
+	"github.com/goblimey/go-ntrip/typefilter"
+	"github.com/goblimey/go-ntrip/ubx"
+	"github.com/goblimey/go-ntrip/websocket"
+)
+
+// DefaultCasterPort is the port of the caster if the config doesn't give
+// one.
+const DefaultCasterPort = 2101
+
+// Config is the config of the go-ntrip commands.
+type Config struct {
+	// Input describes where the RTCM data comes from.
+	Input Input `json:"input"`
+
+	// Caster gives the NTRIP caster and the credentials to use it.
+	Caster Caster `json:"caster"`
+
+	// Station describes the base station - its name, operator, surveyed
+	// position and antenna.  It's optional.  See the station package.
+	Station *station.Config `json:"station"`
+
+	// Logging controls the logs of the messages and of events.
+	Logging Logging `json:"logging"`
+
+	// Filter controls what is done to the message stream on its way
+	// through.
+	Filter Filter `json:"filter"`
+
+	// RTCMFilter holds the settings of rtcmfilter only.
+	RTCMFilter RTCMFilter `json:"rtcmfilter"`
+
+	// NTRIPClient holds the settings of ntripclient only.
+	NTRIPClient NTRIPClient `json:"ntripclient"`
+
+	// NTRIPCaster holds the settings of ntripcaster only.
+	NTRIPCaster NTRIPCaster `json:"ntripcaster"`
+
+	// Proxy holds the settings of the proxy only.
+	Proxy Proxy `json:"proxy"`
+}
+
+// Input describes the input devices and how to read them.
+type Input struct {
+	// Devices is a list of devices to try to open, for example
+	// "/dev/ttyACM0", "/dev/ttyACM1" or, on Windows, "COM4".  The first
+	// one found wins.
+	Devices []string `json:"devices"`
+
+	// Serial gives the parameters of a serial line.
+	Serial Serial `json:"serial"`
+
+	// Receiver optionally gives the settings to send to a u-blox receiver
+	// such as the ZED-F9P when its serial line is opened, so that it
+	// produces the wanted RTCM messages.  See the ubx package.
+	Receiver *ubx.Config `json:"receiver"`
+
+	// ReadTimeoutMilliseconds is the input timeout.  See ReadTimeout.
+	ReadTimeoutMilliseconds uint `json:"read_timeout_milliseconds"`
+
+	// SleepTimeAfterFailedOpenMilliseconds is the time to pause before
+	// retrying if none of the devices can be opened.  See
+	// SleepTimeAfterFailedOpen.
+	SleepTimeAfterFailedOpenMilliseconds uint `json:"sleep_time_after_failed_open_milliseconds"`
+
+	// WaitTimeOnEOFMilliseconds is the time to pause before retrying if a
+	// read returns end of file.  See WaitTimeOnEOF.
+	WaitTimeOnEOFMilliseconds uint `json:"wait_time_on_eof_milliseconds"`
+
+	// TimeoutOnEOFMilliseconds is the time after which to give up when a
+	// series of reads return end of file.  0 means give up on the first.
+	// See TimeoutOnEOF.
+	TimeoutOnEOFMilliseconds uint `json:"timeout_on_eof_milliseconds"`
+
+	// ValidationPolicy optionally relaxes the checks that the RTCM handler
+	// applies to incoming message frames, for devices that produce frames
+	// with vendor extensions.  If it's not given, the handler only accepts
+	// frames that follow the RTCM standard.
+	ValidationPolicy *rtcm.TolerantPolicy `json:"validation_policy"`
+
+	// MaxMessageLength is the maximum length in bytes of the message
+	// embedded in an RTCM frame.  0 means the standard maximum, 1023.
+	MaxMessageLength uint `json:"max_message_length"`
+
+	// FrameTimeoutMilliseconds is the time allowed for the rest of a
+	// message frame to arrive once its start has been seen.  0 means no
+	// timeout.
+	FrameTimeoutMilliseconds uint `json:"frame_timeout_milliseconds"`
+
+	// ResyncWindow is the number of bytes after the start of a bad message
+	// frame within which the handler looks for the start of a good one.  0
+	// turns resyncing off.
+	ResyncWindow int `json:"resync_window"`
+
+	// LeapSecondsFile optionally names a copy of the IERS file
+	// leap-seconds.list, to replace the table of leap seconds built into
+	// the leapseconds package when a new leap second is announced.
+	LeapSecondsFile string `json:"leap_seconds_file"`
+}
+
+// Caster gives an NTRIP caster and the credentials to use it.
+type Caster struct {
+	// Host and Port give the caster.  Port 0 means DefaultCasterPort.
+	Host string `json:"host"`
+	Port uint   `json:"port"`
+
+	// Mountpoint is the mountpoint to send to or fetch from.
+	Mountpoint string `json:"mountpoint"`
+
+	// User and Password are the credentials.  The user is only needed for
+	// NTRIP version 2.
+	User     string `json:"user"`
+	Password string `json:"password"`
+
+	// GGA optionally gives a rover's position, to be sent to the caster by
+	// a client.
+	GGA *ntrip.GGAConfig `json:"gga"`
+}
+
+// Logging controls the logs.
+type Logging struct {
+	// DisplayMessages says whether to write a readable display of the
+	// messages.  Note: turning this on produces a lot of output.
+	DisplayMessages bool `json:"display_messages"`
+
+	// RecordMessages says whether to record a verbatim copy of the
+	// messages.
+	RecordMessages bool `json:"record_messages"`
+
+	// MessageLogDirectory is the directory that receives the display and
+	// the recording.
+	MessageLogDirectory string `json:"message_log_directory"`
+
+	// DirectoryForOldMessageLogs is the directory into which rtcmlogger
+	// moves the recordings of previous days.
+	DirectoryForOldMessageLogs string `json:"directory_for_old_message_logs"`
+
+	// RecordDecimationSeconds, if not zero, thins out the recording to the
+	// epochs at the boundaries of that many seconds.  See the decimate
+	// package.
+	RecordDecimationSeconds uint `json:"record_decimation_seconds"`
+
+	// LogEvents says whether to keep a log of events, and
+	// EventLogDirectory is where.
+	LogEvents         bool   `json:"log_events"`
+	EventLogDirectory string `json:"event_log_directory"`
+
+	// PositionPrecisionMetres is the precision to which the base position
+	// is displayed, so that the display can be published without giving
+	// away the exact position.  0 means show the exact position.
+	PositionPrecisionMetres float64 `json:"position_precision_metres"`
+
+	// DisplayTimeZone is the IANA name of the time zone in which times are
+	// displayed, for example "Europe/London".  Empty means UTC.  See
+	// DisplayLocation.
+	DisplayTimeZone string `json:"display_time_zone"`
+
+	// DisplayChangesOnly says that the display should only show the
+	// messages that describe the station when they change.
+	DisplayChangesOnly bool `json:"display_changes_only"`
+
+	// LogHandlerEvents says whether the trouble that the RTCM handler finds
+	// in the input, such as CRC failures, is written to the event log as
+	// well as being counted.  See rtcm.Handler.Subscribe.
+	LogHandlerEvents bool `json:"log_handler_events"`
+
+	// ParseNMEA says whether NMEA sentences in the non-RTCM data are to be
+	// picked out and parsed for the display.
+	ParseNMEA bool `json:"parse_nmea"`
+}
+
+// Filter controls what is done to the message stream.
+type Filter struct {
+	// ForwardTypes, if not empty, lists the only message types that are
+	// passed on.  DropTypes lists message types that are not.  See the
+	// typefilter package.
+	ForwardTypes []int `json:"forward_types"`
+	DropTypes    []int `json:"drop_types"`
+
+	// DropSubTypes lists sub-types of the u-blox message type 4072 that
+	// are not passed on, for example "4072.1".
+	DropSubTypes []string `json:"drop_sub_types"`
+
+	// ReorderWindowMilliseconds is the time for which messages are held so
+	// that any that arrive out of order can be put back into order.  0
+	// means no reordering.  See the reorder package.
+	ReorderWindowMilliseconds uint `json:"reorder_window_milliseconds"`
+
+	// TransformCommand is an optional command and its arguments through
+	// which the messages are passed.  See the transform package.
+	TransformCommand []string `json:"transform_command"`
+
+	// StationPosition optionally replaces the base position in the
+	// outgoing messages of type 1005 and 1006.  See the reposition package.
+	StationPosition *reposition.Config `json:"station_position"`
+}
+
+// RTCMFilter holds the settings of rtcmfilter only.
+type RTCMFilter struct {
+	// MemorySoftCapMegabytes is the heap size above which the filter stops
+	// writing the readable display.  0 means no cap.
+	MemorySoftCapMegabytes uint64 `json:"memory_soft_cap_megabytes"`
+
+	// MemoryCheckIntervalSeconds is the time between checks of the heap
+	// size.  0 means use the default.
+	MemoryCheckIntervalSeconds uint `json:"memory_check_interval_seconds"`
+
+	// Queues gives the size and the overflow policy of the queue in front
+	// of each stage that takes the messages, by the stage's name, for
+	// example "display".  A stage that's not listed gets the defaults.
+	// See the queue package.
+	Queues map[string]queue.Config `json:"queues"`
+
+	// NMEABeacon optionally sends the base position from message type 1005
+	// as NMEA sentences.  See the nmea package.
+	NMEABeacon *nmea.BeaconConfig `json:"nmea_beacon"`
+
+	// TimeCheck optionally checks the system clock against an NTP server.
+	// See the timecheck package.
+	TimeCheck *timecheck.Config `json:"time_check"`
+
+	// Notify optionally sends notifications of critical events.  See the
+	// notify package.
+	Notify *notify.Config `json:"notify"`
+
+	// MaintenanceWindows optionally lists times when notifications are
+	// suppressed and commands are run.  See the maintenance package.
+	MaintenanceWindows []maintenance.Window `json:"maintenance_windows"`
+
+	// Telemetry optionally sends anonymous statistics about the messages
+	// to the maintainers.  See the telemetry package.
+	Telemetry *telemetry.Config `json:"telemetry"`
+
+	// Metrics optionally serves the running figures to Prometheus.  See
+	// the metrics package.
+	Metrics *metrics.Config `json:"metrics"`
+
+	// Dashboard optionally serves a status page for the station.  See the
+	// dashboard package.
+	Dashboard *dashboard.Config `json:"dashboard"`
+
+	// Health optionally serves health-check endpoints for a supervisor
+	// such as systemd or Kubernetes.  See the health package.
+	Health *health.Config `json:"health"`
+
+	// Listen optionally takes the input from a TCP or UDP port instead of
+	// the standard input.  See the transport package.
+	Listen *transport.Config `json:"listen"`
+
+	// Forward optionally sends the output to a TCP or UDP endpoint instead
+	// of the standard output.  See the transport package.
+	Forward *transport.Config `json:"forward"`
+
+	// MQTT optionally publishes the messages to an MQTT broker.  See the
+	// mqtt package.
+	MQTT *mqtt.Config `json:"mqtt"`
+
+	// WebSocket optionally serves the messages over WebSocket to rover apps
+	// on the local network.  See the websocket package.
+	WebSocket *websocket.Config `json:"websocket"`
+
+	// Demux optionally records the messages of each station in a stream
+	// aggregated from several in a separate log.  See the demux package.
+	Demux *demux.Config `json:"demux"`
+}
+
+// NTRIPClient holds the settings of ntripclient only.
+type NTRIPClient struct {
+	// SerialDevice is the serial line to write the messages to, for
+	// example "/dev/ttyACM0".  If it's empty, the client writes to stdout.
+	SerialDevice string `json:"serial_device"`
+
+	// SerialSpeed is the speed of the serial line in bits per second.
+	SerialSpeed int `json:"serial_speed"`
+
+	// SerialDevices lists other devices to try if SerialDevice can't be
+	// opened, for example "/dev/ttyACM1", because a USB device that's been
+	// reset may come back under another name.
+	SerialDevices []string `json:"serial_devices"`
+
+	// SerialRetryMilliseconds is the pause between attempts to open the
+	// serial line after it's been lost.  See SerialRetry.
+	SerialRetryMilliseconds uint `json:"serial_retry_milliseconds"`
+
+	// Relay, if it's given, is a mountpoint on another caster.  Instead
+	// of writing the messages to a serial line, the client republishes them
+	// there, acting as an NTRIP server.
+	Relay *Caster `json:"relay"`
+
+	// Fallbacks lists other casters to fetch from, in order of priority,
+	// when the one in the caster section is down.  See ntrip.Failover.
+	Fallbacks []Caster `json:"fallbacks"`
+
+	// PrimaryCheckSeconds is the time between checks of the casters with
+	// a higher priority than the one in use.  See PrimaryCheck.
+	PrimaryCheckSeconds uint `json:"primary_check_seconds"`
+
+	// Discover says that the caster is to be found on the local network,
+	// rather than given in the caster section.  See the mdns package.
+	Discover bool `json:"discover"`
+}
+
+// NTRIPCaster holds the settings of ntripcaster only.
+type NTRIPCaster struct {
+	// ListenAddress is the address to listen on, for example ":2101".
+	ListenAddress string `json:"listen_address"`
+
+	// StatusSnapshotFile is a file to which the state of each mountpoint is
+	// written periodically.  Empty means none.
+	StatusSnapshotFile string `json:"status_snapshot_file"`
+
+	// StatusSnapshotSeconds is the time between snapshots.
+	StatusSnapshotSeconds uint `json:"status_snapshot_seconds"`
+
+	// AccessLogFile is a file to which an entry is appended for each
+	// connection, in combined log format.  Empty means none.
+	AccessLogFile string `json:"access_log_file"`
+
+	// MDNSName, if it's given, is the name under which the caster
+	// advertises itself on the local network.  See the mdns package.
+	MDNSName string `json:"mdns_name"`
+
+	// The mountpoints.  See the caster package.
+	caster.Config
+}
+
+// Proxy holds the settings of the proxy only.  The proxy takes its message
+// log and its position precision from the logging section and the
+// description of the base station from the station section.
+type Proxy struct {
+	// RemoteHost is the caster that the proxy stands in front of, as
+	// "host:port".
+	RemoteHost string `json:"remote_host"`
+
+	// ProxyHost and ProxyPort give the address to listen on.
+	ProxyHost string `json:"proxy_host"`
+	ProxyPort int    `json:"proxy_port"`
+
+	// ControlHost and ControlPort give the address of the status server.
+	ControlHost string `json:"control_host"`
+	ControlPort int    `json:"control_port"`
+
+	// TLS and CertFile control the certificate of the TLS listener.
+	TLS      *ProxyTLS `json:"tls"`
+	CertFile string    `json:"cert_file"`
+
+	// MemorySoftCapMegabytes is the heap size above which the proxy sheds
+	// optional work.  0 means no cap.
+	MemorySoftCapMegabytes uint64 `json:"memory_soft_cap_megabytes"`
+
+	// StatusSnapshotFile is a file to which the stats are written
+	// periodically, for a static web host to serve.  Empty means none.
+	StatusSnapshotFile string `json:"status_snapshot_file"`
+
+	// StatusSnapshotSeconds is the time between snapshots.
+	StatusSnapshotSeconds uint `json:"status_snapshot_seconds"`
+}
+
+// ProxyTLS gives the subject of the certificate that the proxy generates
+// if it isn't given one.
+type ProxyTLS struct {
+	Country    []string `json:"country"`
+	Org        []string `json:"org"`
+	CommonName string   `json:"common_name"`
+}
+
+// Load reads the config from the named file.
+func Load(fileName string) (*Config, error) {
+	file, openError := os.Open(fileName)
+	if openError != nil {
+		em := fmt.Sprintf("config - cannot open %s - %v", fileName, openError)
+		return nil, errors.New(em)
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read reads the config from the reader, to the end.
+func Read(reader io.Reader) (*Config, error) {
+	data, readError := io.ReadAll(reader)
+	if readError != nil {
+		em := fmt.Sprintf("config - cannot read the config - %v", readError)
+		return nil, errors.New(em)
+	}
+	return Parse(data)
+}
+
+// Parse parses the config in the data, which may be in JSON or YAML and
+// in the old format of any of the commands, replaces the references to
+// environment variables and checks it.
+func Parse(data []byte) (*Config, error) {
+	if isYAML(data) {
+		converted, yamlError := yamlToJSON(data)
+		if yamlError != nil {
+			return nil, yamlError
+		}
+		data = converted
+	} else {
+		expanded, envError := expandEnv(string(data), jsonEscape)
+		if envError != nil {
+			return nil, envError
+		}
+		data = []byte(expanded)
+	}
+
+	var config *Config
+	var parseError error
+	if isLegacy(data) {
+		config, parseError = parseLegacy(data)
+	} else {
+		config, parseError = parse(data)
+	}
+	if parseError != nil {
+		em := fmt.Sprintf("config - cannot parse the config - %v", parseError)
+		return nil, errors.New(em)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// parse parses a config in the sectioned format.  Names that are not in
+// the schema are rejected, so that a misspelt name doesn't silently leave
+// a setting at its default.
+func parse(data []byte) (*Config, error) {
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks the parts of the config that are the same for all the
+// commands.
+func (config *Config) Validate() error {
+	if err := config.Station.Validate(); err != nil {
+		return err
+	}
+	if _, err := config.Input.Serial.Mode(); err != nil {
+		return err
+	}
+	if err := config.Input.Receiver.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadTimeout returns the input timeout.
+func (input *Input) ReadTimeout() time.Duration {
+	return time.Duration(input.ReadTimeoutMilliseconds) * time.Millisecond
+}
+
+// SleepTimeAfterFailedOpen returns the time to pause before retrying if
+// none of the devices can be opened.
+func (input *Input) SleepTimeAfterFailedOpen() time.Duration {
+	return time.Duration(input.SleepTimeAfterFailedOpenMilliseconds) * time.Millisecond
+}
+
+// WaitTimeOnEOF returns the time to pause before retrying after a read has
+// returned end of file.
+func (input *Input) WaitTimeOnEOF() time.Duration {
+	return time.Duration(input.WaitTimeOnEOFMilliseconds) * time.Millisecond
+}
+
+// TimeoutOnEOF returns the time after which to give up when a series of
+// reads return end of file.
+func (input *Input) TimeoutOnEOF() time.Duration {
+	return time.Duration(input.TimeoutOnEOFMilliseconds) * time.Millisecond
+}
+
+// SerialRetry returns the pause between attempts to open the serial line
+// after it's been lost.  Zero means the default of the serialout package.
+func (client *NTRIPClient) SerialRetry() time.Duration {
+	return time.Duration(client.SerialRetryMilliseconds) * time.Millisecond
+}
+
+// PrimaryCheck returns the time between checks of the casters with a
+// higher priority than the one in use.  Zero means the default of the ntrip
+// package.
+func (client *NTRIPClient) PrimaryCheck() time.Duration {
+	return time.Duration(client.PrimaryCheckSeconds) * time.Second
+}
+
+// FrameLimits returns the limits that the RTCM handler should apply when
+// it scans the input for message frames.
+func (input *Input) FrameLimits() rtcm.FrameLimits {
+	return rtcm.FrameLimits{
+		MaxMessageLength: input.MaxMessageLength,
+		FrameTimeout:     time.Duration(input.FrameTimeoutMilliseconds) * time.Millisecond,
+		ResyncWindow:     input.ResyncWindow,
+	}
+}
+
+// Address returns the host and port of the caster, or an empty string if
+// there is no host.
+func (caster *Caster) Address() string {
+	if len(caster.Host) == 0 {
+		return ""
+	}
+	port := caster.Port
+	if port == 0 {
+		port = DefaultCasterPort
+	}
+	return net.JoinHostPort(caster.Host, strconv.FormatUint(uint64(port), 10))
+}
+
+// ClientConfig returns the config of an NTRIP client that fetches from the
+// caster.
+func (caster *Caster) ClientConfig() ntrip.Config {
+	return ntrip.Config{
+		Caster:     caster.Address(),
+		Mountpoint: caster.Mountpoint,
+		User:       caster.User,
+		Password:   caster.Password,
+		GGA:        caster.GGA,
+	}
+}
+
+// SourceConfig returns the config of an NTRIP server that sends to the
+// caster.
+func (caster *Caster) SourceConfig() ntrip.SourceConfig {
+	return ntrip.SourceConfig{
+		Caster:     caster.Address(),
+		Mountpoint: caster.Mountpoint,
+		Password:   caster.Password,
+	}
+}
+
+// TypeFilter returns the filter that chooses the message types to pass on,
+// or nil if all types are passed on.
+func (filter *Filter) TypeFilter() (*typefilter.Filter, error) {
+	if len(filter.ForwardTypes) == 0 && len(filter.DropTypes) == 0 && len(filter.DropSubTypes) == 0 {
+		return nil, nil
+	}
+	typeFilter, err := typefilter.New(filter.ForwardTypes, filter.DropTypes)
+	if err != nil {
+		return nil, err
+	}
+	if err := typeFilter.DropSubTypes(filter.DropSubTypes); err != nil {
+		return nil, err
+	}
+	return typeFilter, nil
+}
+
+// DisplayLocation returns the time zone in which the display shows times,
+// or nil if none is given, meaning UTC.
+func (logging *Logging) DisplayLocation() (*time.Location, error) {
+	if len(logging.DisplayTimeZone) == 0 {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(logging.DisplayTimeZone)
+	if err != nil {
+		em := fmt.Sprintf("display time zone %s - %v", logging.DisplayTimeZone, err)
+		return nil, errors.New(em)
+	}
+	return location, nil
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/dashboard"
+	"github.com/goblimey/go-ntrip/demux"
+	"github.com/goblimey/go-ntrip/health"
+	"github.com/goblimey/go-ntrip/mqtt"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/queue"
+	"github.com/goblimey/go-ntrip/reposition"
+	"github.com/goblimey/go-ntrip/transport"
+	"github.com/goblimey/go-ntrip/ubx"
+	"github.com/goblimey/go-ntrip/websocket"
+
+	"github.com/google/go-cmp/cmp"
+	"go.bug.st/serial"
+)
+
+// TestParse checks that a config in the sectioned format is parsed and
+// checked.
+func TestParse(t *testing.T) {
+	const full = `{
+		"input": {
+			"devices": ["/dev/ttyACM0", "/dev/ttyACM1"],
+			"serial": {"speed": 115200, "parity": "even_parity"},
+			"receiver": {"interface": "uart2", "message_types": [1005, 1074], "save": true},
+			"read_timeout_milliseconds": 3000,
+			"wait_time_on_eof_milliseconds": 1000,
+			"leap_seconds_file": "/etc/leap-seconds.list"
+		},
+		"caster": {"host": "caster.example.com", "mountpoint": "MYBASE", "password": "secret"},
+		"logging": {"display_messages": true, "message_log_directory": "rtcmlog", "log_handler_events": true},
+		"filter": {"drop_types": [1230], "drop_sub_types": ["4072.1"], "station_position": {"x": 3978364.8574, "y": -12345.6789, "z": 4968423.4712}},
+		"rtcmfilter": {
+			"queues": {"display": {"size": 1000, "policy": "drop_oldest"}},
+			"nmea_beacon": {"sink": "tcp", "address": "localhost:10110"},
+			"dashboard": {"listen_address": ":8080"},
+			"health": {"listen_address": ":8081", "stale_after_seconds": 60},
+			"listen": {"network": "udp", "address": ":5000"},
+			"forward": {"address": "192.168.1.20:2103", "retry_milliseconds": 500},
+			"websocket": {"listen_address": ":2102", "max_clients": 4},
+			"mqtt": {"broker": "broker.example.com:1883", "json_topic": "rtcm/{type}/json"},
+			"demux": {"stations": [{"station_id": 42, "mountpoint": "SHED"}], "log_directory": "stations"}
+		},
+		"ntripclient": {"serial_device": "/dev/ttyUSB0"}
+	}`
+
+	var testData = []struct {
+		description string
+		json        string
+		want        *Config
+		wantError   string
+	}{
+		{"full", full, &Config{
+			Input: Input{
+				Devices:                   []string{"/dev/ttyACM0", "/dev/ttyACM1"},
+				Serial:                    Serial{Speed: 115200, Parity: "even_parity"},
+				Receiver:                  &ubx.Config{Interface: "uart2", MessageTypes: []int{1005, 1074}, Save: true},
+				ReadTimeoutMilliseconds:   3000,
+				WaitTimeOnEOFMilliseconds: 1000,
+				LeapSecondsFile:           "/etc/leap-seconds.list",
+			},
+			Caster:  Caster{Host: "caster.example.com", Mountpoint: "MYBASE", Password: "secret"},
+			Logging: Logging{DisplayMessages: true, MessageLogDirectory: "rtcmlog", LogHandlerEvents: true},
+			Filter: Filter{
+				DropTypes:       []int{1230},
+				DropSubTypes:    []string{"4072.1"},
+				StationPosition: &reposition.Config{X: 3978364.8574, Y: -12345.6789, Z: 4968423.4712},
+			},
+			RTCMFilter: RTCMFilter{
+				Queues:     map[string]queue.Config{"display": {Size: 1000, Policy: "drop_oldest"}},
+				NMEABeacon: &nmea.BeaconConfig{Sink: "tcp", Address: "localhost:10110"},
+				Dashboard:  &dashboard.Config{ListenAddress: ":8080"},
+				Health:     &health.Config{ListenAddress: ":8081", StaleAfterSeconds: 60},
+				Listen:     &transport.Config{Network: "udp", Address: ":5000"},
+				Forward:    &transport.Config{Address: "192.168.1.20:2103", RetryMilliseconds: 500},
+				WebSocket:  &websocket.Config{ListenAddress: ":2102", MaxClients: 4},
+				MQTT:       &mqtt.Config{Broker: "broker.example.com:1883", JSONTopic: "rtcm/{type}/json"},
+				Demux: &demux.Config{
+					Stations:     []demux.Station{{ID: 42, Mountpoint: "SHED"}},
+					LogDirectory: "stations",
+				},
+			},
+			NTRIPClient: NTRIPClient{SerialDevice: "/dev/ttyUSB0"},
+		}, ""},
+		{"empty", `{}`, &Config{}, ""},
+		{
+			"misspelt name",
+			`{"logging": {"record_mesages": true}}`,
+			nil, `config - cannot parse the config - json: unknown field "record_mesages"`,
+		},
+		{
+			"bad serial parameters",
+			`{"input": {"serial": {"data_bits": 9}}}`,
+			nil, "config - data bits must be 5-8, got 9",
+		},
+		{
+			"bad receiver",
+			`{"input": {"receiver": {"interface": "usb3"}}}`,
+			nil, `ubx - unknown interface "usb3", want usb, uart1, uart2, i2c or spi`,
+		},
+		{
+			"bad station",
+			`{"station": {"operator": "me"}}`,
+			nil, "station - want a name",
+		},
+		{
+			"junk",
+			`{junk}`,
+			nil, "config - cannot parse the config - invalid character 'j' looking for beginning of object key string",
+		},
+		{
+			"junk YAML",
+			`junk`,
+			nil, "config - cannot parse the YAML at line 1 - want a mapping of names to values",
+		},
+		{
+			"unset variable",
+			`{"caster": {"password": "${NO_SUCH_VARIABLE}"}}`,
+			nil, "config - the environment variable NO_SUCH_VARIABLE is not set",
+		},
+	}
+
+	for _, td := range testData {
+		got, err := Parse([]byte(td.json))
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// oneByteReader is a reader that gives one byte at a time.
+type oneByteReader struct {
+	data []byte
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("EOF")
+	}
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+// TestRead checks that Read reads to the end, however long the config is
+// and however the reader delivers it.
+func TestRead(t *testing.T) {
+	// Make a config longer than the buffer of the old readers.
+	devices := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		devices = append(devices, `"/dev/ttyACM0"`)
+	}
+	long := `{"input": {"devices": [` + strings.Join(devices, ",") + `]}}`
+
+	got, err := Read(strings.NewReader(long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Input.Devices) != 500 {
+		t.Errorf("want 500 devices got %d", len(got.Input.Devices))
+	}
+
+	_, err = Read(&oneByteReader{data: []byte(`{"logging": {}}`)})
+	const wantError = "config - cannot read the config - EOF"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+}
+
+// TestLoad checks that Load reads a file and reports a missing one.
+func TestLoad(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	_, err := Load(missing)
+	wantPrefix := "config - cannot open " + missing + " - "
+	if err == nil || !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("want error starting %s got %v", wantPrefix, err)
+	}
+}
+
+// TestExampleConfigs checks that the example configs of the commands are
+// valid.
+func TestExampleConfigs(t *testing.T) {
+	examples := []string{
+		"../apps/serial_usb_grabber/config.json",
+		"../apps/rtcmfilter/filter.json",
+		"../apps/rtcmfilter/ntrip.json",
+		"../apps/rtcmlogger/config.json",
+		"../apps/rtcmlogger/rtcmlogger.json",
+		"../apps/ntripclient/ntripclient.json",
+	}
+	for _, example := range examples {
+		if _, err := Load(example); err != nil {
+			t.Errorf("%s: %v", example, err)
+		}
+	}
+}
+
+// TestSerialMode checks that the serial parameters are turned into a mode.
+func TestSerialMode(t *testing.T) {
+	var testData = []struct {
+		description string
+		serial      Serial
+		want        *serial.Mode
+		wantError   string
+	}{
+		{"defaults", Serial{}, &serial.Mode{BaudRate: 9600}, ""},
+		{
+			"all",
+			Serial{Speed: 1, Parity: "even_parity", DataBits: 5, StopBits: 1.5, InitialStatusBits: []string{"dtr"}},
+			&serial.Mode{
+				BaudRate: 1, Parity: serial.EvenParity, DataBits: 5,
+				StopBits: serial.OnePointFiveStopBits, InitialStatusBits: &serial.ModemOutputBits{DTR: true},
+			},
+			"",
+		},
+		{
+			"two stop bits, RTS",
+			Serial{Speed: 115200, Parity: "no_parity", DataBits: 7, StopBits: 2, InitialStatusBits: []string{"RTS"}},
+			&serial.Mode{
+				BaudRate: 115200, DataBits: 7, StopBits: serial.TwoStopBits,
+				InitialStatusBits: &serial.ModemOutputBits{RTS: true},
+			},
+			"",
+		},
+		{"bad parity", Serial{Parity: "odd"}, nil, "config - illegal parity value odd"},
+		{"bad data bits", Serial{DataBits: 4}, nil, "config - data bits must be 5-8, got 4"},
+		{"bad stop bits", Serial{StopBits: 3}, nil, "config - stop bits must be 1, 1.5 or 2, got 3"},
+		{"bad status bit", Serial{InitialStatusBits: []string{"cts"}}, nil, "config - illegal initial status bit value cts"},
+	}
+
+	for _, td := range testData {
+		got, err := td.serial.Mode()
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestDurations checks the functions that return the times in the input
+// section as durations.
+func TestDurations(t *testing.T) {
+	input := Input{
+		ReadTimeoutMilliseconds:              1,
+		SleepTimeAfterFailedOpenMilliseconds: 2,
+		WaitTimeOnEOFMilliseconds:            3,
+		TimeoutOnEOFMilliseconds:             4,
+		FrameTimeoutMilliseconds:             5,
+		MaxMessageLength:                     2000,
+		ResyncWindow:                         64,
+	}
+
+	got := []time.Duration{
+		input.ReadTimeout(), input.SleepTimeAfterFailedOpen(),
+		input.WaitTimeOnEOF(), input.TimeoutOnEOF(), input.FrameLimits().FrameTimeout,
+	}
+	for i, d := range got {
+		want := time.Duration(i+1) * time.Millisecond
+		if d != want {
+			t.Errorf("%d: want %v got %v", i, want, d)
+		}
+	}
+
+	limits := input.FrameLimits()
+	if limits.MaxMessageLength != 2000 || limits.ResyncWindow != 64 {
+		t.Errorf("unexpected frame limits %+v", limits)
+	}
+}
+
+// TestCasterAddress checks the address of the caster.
+func TestCasterAddress(t *testing.T) {
+	var testData = []struct {
+		caster Caster
+		want   string
+	}{
+		{Caster{Host: "caster.example.com", Port: 2102}, "caster.example.com:2102"},
+		{Caster{Host: "caster.example.com"}, "caster.example.com:2101"},
+		{Caster{Host: "::1", Port: 2101}, "[::1]:2101"},
+		{Caster{Port: 2101}, ""},
+	}
+
+	for _, td := range testData {
+		if got := td.caster.Address(); got != td.want {
+			t.Errorf("%+v: want %q got %q", td.caster, td.want, got)
+		}
+	}
+}
+
+// TestDisplayLocation checks that the display time zone is loaded.
+func TestDisplayLocation(t *testing.T) {
+	logging := Logging{}
+	if location, err := logging.DisplayLocation(); location != nil || err != nil {
+		t.Errorf("want nil, nil got %v, %v", location, err)
+	}
+
+	logging.DisplayTimeZone = "Europe/London"
+	location, err := logging.DisplayLocation()
+	if err != nil || location.String() != "Europe/London" {
+		t.Errorf("want Europe/London got %v, %v", location, err)
+	}
+
+	logging.DisplayTimeZone = "Nowhere/Special"
+	if _, err := logging.DisplayLocation(); err == nil {
+		t.Error("want an error")
+	}
+}
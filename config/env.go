@@ -0,0 +1,116 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A value in the config can refer to an environment variable, so that a
+// secret such as the caster password doesn't have to be stored in the file:
+//
+//	"caster": {"host": "caster.example.com", "password": "${CASTER_PASSWORD}"}
+//
+// ${NAME} is replaced by the value of the variable NAME.  It's an error if
+// the variable is not set.  ${NAME:-default} is replaced by the default if
+// the variable is not set or is empty.  $${ gives a literal ${.
+
+// lookupEnv gets the value of an environment variable.  It's replaced in
+// tests.
+var lookupEnv = os.LookupEnv
+
+// expandEnv replaces the references to environment variables in the text.
+// Each value is passed through escape before it's put into the text.
+func expandEnv(text string, escape func(string) string) (string, error) {
+	var result strings.Builder
+	for {
+		i := strings.Index(text, "${")
+		if i < 0 {
+			result.WriteString(text)
+			return result.String(), nil
+		}
+
+		if i > 0 && text[i-1] == '$' {
+			// $${ gives a literal ${.
+			result.WriteString(text[:i-1])
+			result.WriteString("${")
+			text = text[i+2:]
+			continue
+		}
+
+		result.WriteString(text[:i])
+		end := strings.Index(text[i:], "}")
+		if end < 0 {
+			em := fmt.Sprintf("config - unterminated reference %q", text[i:])
+			return "", errors.New(em)
+		}
+		reference := text[i+2 : i+end]
+		text = text[i+end+1:]
+
+		value, err := lookupReference(reference)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(escape(value))
+	}
+}
+
+// lookupReference returns the value of a reference, which is the part
+// between ${ and }, for example "CASTER_PASSWORD" or "PORT:-2101".
+func lookupReference(reference string) (string, error) {
+	name := reference
+	defaultValue := ""
+	hasDefault := false
+	if i := strings.Index(reference, ":-"); i >= 0 {
+		name = reference[:i]
+		defaultValue = reference[i+2:]
+		hasDefault = true
+	}
+
+	if !validEnvName(name) {
+		em := fmt.Sprintf("config - %q is not a valid environment variable name", name)
+		return "", errors.New(em)
+	}
+
+	value, set := lookupEnv(name)
+	if hasDefault && len(value) == 0 {
+		return defaultValue, nil
+	}
+	if !set {
+		em := fmt.Sprintf("config - the environment variable %s is not set", name)
+		return "", errors.New(em)
+	}
+	return value, nil
+}
+
+// validEnvName returns true if the name is a letter or an underscore
+// followed by letters, digits and underscores.
+func validEnvName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// jsonEscape returns the value escaped for a JSON string, without the
+// quotes.  A number is unchanged, so a reference can also stand for a
+// number, for example "port": ${CASTER_PORT}.
+func jsonEscape(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted[1 : len(quoted)-1])
+}
+
+// noEscape returns the value unchanged.
+func noEscape(value string) string {
+	return value
+}
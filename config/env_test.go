@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeEnv replaces lookupEnv with a lookup in the given variables until the
+// returned function is called.
+func fakeEnv(variables map[string]string) func() {
+	saved := lookupEnv
+	lookupEnv = func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+	return func() { lookupEnv = saved }
+}
+
+// TestExpandEnv checks that the references to environment variables are
+// replaced.
+func TestExpandEnv(t *testing.T) {
+	defer fakeEnv(map[string]string{
+		"CASTER_PASSWORD": `se"cret`,
+		"CASTER_PORT":     "2102",
+		"EMPTY":           "",
+	})()
+
+	var testData = []struct {
+		description string
+		text        string
+		escape      func(string) string
+		want        string
+		wantError   string
+	}{
+		{"none", `{"port": 2101}`, jsonEscape, `{"port": 2101}`, ""},
+		{"string", `{"password": "${CASTER_PASSWORD}"}`, jsonEscape, `{"password": "se\"cret"}`, ""},
+		{"unescaped", `${CASTER_PASSWORD}`, noEscape, `se"cret`, ""},
+		{"number", `{"port": ${CASTER_PORT}}`, jsonEscape, `{"port": 2102}`, ""},
+		{"two", `${CASTER_PORT}:${CASTER_PORT}`, noEscape, `2102:2102`, ""},
+		{"default unset", `${PORT:-2101}`, noEscape, "2101", ""},
+		{"default empty", `${EMPTY:-2101}`, noEscape, "2101", ""},
+		{"default not used", `${CASTER_PORT:-2101}`, noEscape, "2102", ""},
+		{"empty default", `${PORT:-}`, noEscape, "", ""},
+		{"empty", `${EMPTY}`, noEscape, "", ""},
+		{"literal", `$${CASTER_PORT}`, noEscape, "${CASTER_PORT}", ""},
+		{"dollar", `$5 or $CASTER_PORT`, noEscape, "$5 or $CASTER_PORT", ""},
+		{"unset", `${PORT}`, noEscape, "", "config - the environment variable PORT is not set"},
+		{"bad name", `${1PORT}`, noEscape, "", `config - "1PORT" is not a valid environment variable name`},
+		{"no name", `${:-x}`, noEscape, "", `config - "" is not a valid environment variable name`},
+		{"unterminated", `"${CASTER_PORT"`, noEscape, "", `config - unterminated reference "${CASTER_PORT\""`},
+	}
+
+	for _, td := range testData {
+		got, err := expandEnv(td.text, td.escape)
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if got != td.want {
+			t.Errorf("%s: want %s got %s", td.description, td.want, got)
+		}
+	}
+}
+
+// TestParseWithEnv checks that a config can take its secrets from the
+// environment, in JSON and in YAML.
+func TestParseWithEnv(t *testing.T) {
+	defer fakeEnv(map[string]string{
+		"CASTER_PASSWORD": `pass"word`,
+		"CASTER_PORT":     "2102",
+	})()
+
+	want := Caster{Host: "caster.example.com", Port: 2102, Mountpoint: "MYBASE", Password: `pass"word`}
+
+	const jsonConfig = `{"caster": {"host": "caster.example.com", "port": ${CASTER_PORT},
+		"mountpoint": "MYBASE", "password": "${CASTER_PASSWORD}"}}`
+	const yamlConfig = `
+caster:
+  host: caster.example.com
+  port: ${CASTER_PORT}
+  mountpoint: MYBASE
+  password: ${CASTER_PASSWORD}
+`
+	for _, text := range []string{jsonConfig, yamlConfig} {
+		got, err := Parse([]byte(text))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !cmp.Equal(want, got.Caster) {
+			t.Error(cmp.Diff(want, got.Caster))
+		}
+	}
+}
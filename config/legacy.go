@@ -0,0 +1,278 @@
+package config
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+
+	"github.com/goblimey/go-ntrip/caster"
+	"github.com/goblimey/go-ntrip/maintenance"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/notify"
+	"github.com/goblimey/go-ntrip/ntrip"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/station"
+	"github.com/goblimey/go-ntrip/telemetry"
+	"github.com/goblimey/go-ntrip/timecheck"
+)
+
+// sections are the top-level names of the sectioned format.
+var sections = map[string]bool{
+	"input":       true,
+	"caster":      true,
+	"station":     true,
+	"logging":     true,
+	"filter":      true,
+	"rtcmfilter":  true,
+	"ntripclient": true,
+	"ntripcaster": true,
+	"proxy":       true,
+}
+
+// legacyConfig holds the names used by the flat configs that the commands
+// had before this package.  Where two commands used different names for
+// the same thing, both are here.
+type legacyConfig struct {
+	// The input, from the jsonconfig package and serial_usb_grabber.
+	Input                                []string `json:"input"`
+	Filenames                            []string `json:"filenames"`
+	Speed                                int      `json:"speed"`
+	Parity                               string   `json:"parity"`
+	DataBits                             int      `json:"data_bits"`
+	StopBits                             float32  `json:"stop_bits"`
+	InitialStatusBits                    []string `json:"initial_status_bits"`
+	ReadTimeoutMilliseconds              uint     `json:"read_timeout_milliseconds"`
+	SleepTimeAfterFailedOpenMilliseconds uint     `json:"sleep_time_after_failed_open_milliseconds"`
+	WaitTimeOnEOFMillis                  uint     `json:"wait_time_on_EOF_millis"`
+	SleepTimeOnEOFMillis                 uint     `json:"sleep_time_on_EOF_millis"`
+	TimeoutOnEOFMilliseconds             uint     `json:"timeout_on_EOF_milliseconds"`
+
+	// The RTCM handler, from the jsonconfig package.
+	ValidationPolicy         *rtcm.TolerantPolicy `json:"validation_policy"`
+	MaxMessageLength         uint                 `json:"max_message_length"`
+	FrameTimeoutMilliseconds uint                 `json:"frame_timeout_milliseconds"`
+	ResyncWindow             int                  `json:"resync_window"`
+
+	// The caster, from the jsonconfig package and ntripclient.
+	CasterHostName string           `json:"caster_host_name"`
+	CasterPort     uint             `json:"caster_port"`
+	CasterUserName string           `json:"caster_user_name"`
+	CasterPassword string           `json:"caster_password"`
+	Caster         string           `json:"caster"`
+	Mountpoint     string           `json:"mountpoint"`
+	User           string           `json:"user"`
+	Password       string           `json:"password"`
+	GGA            *ntrip.GGAConfig `json:"gga"`
+
+	Station *station.Config `json:"station"`
+
+	// The logs, from all of them.
+	DisplayMessages            bool    `json:"display_messages"`
+	RecordMessages             bool    `json:"record_messages"`
+	MessageLogDirectory        string  `json:"message_log_directory"`
+	LogDirectory               string  `json:"log_directory"`
+	DirectoryForOldMessageLogs string  `json:"directory_for_old_message_logs"`
+	RecordDecimationSeconds    uint    `json:"record_decimation_seconds"`
+	LogEvents                  bool    `json:"log_events"`
+	EventLogDirectory          string  `json:"event_log_directory"`
+	PositionPrecisionMetres    float64 `json:"position_precision_metres"`
+	DisplayTimeZone            string  `json:"display_time_zone"`
+	DisplayChangesOnly         bool    `json:"display_changes_only"`
+	ParseNMEA                  bool    `json:"parse_nmea"`
+
+	// The filtering, from rtcmfilter.
+	ForwardTypes              []int    `json:"forward_types"`
+	DropTypes                 []int    `json:"drop_types"`
+	ReorderWindowMilliseconds uint     `json:"reorder_window_milliseconds"`
+	TransformCommand          []string `json:"transform_command"`
+
+	// The rest of rtcmfilter.
+	MemorySoftCapMegabytes     uint64               `json:"memory_soft_cap_megabytes"`
+	MemoryCheckIntervalSeconds uint                 `json:"memory_check_interval_seconds"`
+	NMEABeacon                 *nmea.BeaconConfig   `json:"nmea_beacon"`
+	TimeCheck                  *timecheck.Config    `json:"time_check"`
+	Notify                     *notify.Config       `json:"notify"`
+	MaintenanceWindows         []maintenance.Window `json:"maintenance_windows"`
+	Telemetry                  *telemetry.Config    `json:"telemetry"`
+	Metrics                    *metrics.Config      `json:"metrics"`
+
+	// The rest of ntripclient.
+	SerialDevice string `json:"serial_device"`
+	SerialSpeed  int    `json:"serial_speed"`
+
+	// ntripcaster.
+	ListenAddress string              `json:"listen_address"`
+	Mountpoints   []caster.Mountpoint `json:"mountpoints"`
+
+	// The rest of the proxy.
+	RemoteHost            string    `json:"remote_host"`
+	ProxyHost             string    `json:"proxy_host"`
+	ProxyPort             int       `json:"proxy_port"`
+	ControlHost           string    `json:"control_host"`
+	ControlPort           int       `json:"control_port"`
+	TLS                   *ProxyTLS `json:"tls"`
+	CertFile              string    `json:"cert_file"`
+	StatusSnapshotFile    string    `json:"status_snapshot_file"`
+	StatusSnapshotSeconds uint      `json:"status_snapshot_seconds"`
+}
+
+// isLegacy returns true if the data is a config in the old flat format.
+// In the sectioned format every top-level name is a section and every
+// value is an object.  Data that isn't a JSON object is left to the
+// parser to complain about.
+func isLegacy(data []byte) bool {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return false
+	}
+	for name, value := range top {
+		if !sections[name] {
+			return true
+		}
+		var section map[string]json.RawMessage
+		if err := json.Unmarshal(value, &section); err != nil {
+			// For example "input" as a list of devices, or "caster" as
+			// "host:port".
+			return true
+		}
+	}
+	return false
+}
+
+// parseLegacy parses a config in the old flat format.  Unknown names are
+// ignored, as they were.
+func parseLegacy(data []byte) (*Config, error) {
+	var legacy legacyConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	return legacy.convert(), nil
+}
+
+// convert returns the config in the sectioned format.
+func (legacy *legacyConfig) convert() *Config {
+	config := Config{
+		Input: Input{
+			Devices: firstList(legacy.Input, legacy.Filenames),
+			Serial: Serial{
+				Speed:             legacy.Speed,
+				Parity:            legacy.Parity,
+				DataBits:          legacy.DataBits,
+				StopBits:          legacy.StopBits,
+				InitialStatusBits: legacy.InitialStatusBits,
+			},
+			ReadTimeoutMilliseconds:              legacy.ReadTimeoutMilliseconds,
+			SleepTimeAfterFailedOpenMilliseconds: legacy.SleepTimeAfterFailedOpenMilliseconds,
+			WaitTimeOnEOFMilliseconds:            firstNonZero(legacy.WaitTimeOnEOFMillis, legacy.SleepTimeOnEOFMillis),
+			TimeoutOnEOFMilliseconds:             legacy.TimeoutOnEOFMilliseconds,
+			ValidationPolicy:                     legacy.ValidationPolicy,
+			MaxMessageLength:                     legacy.MaxMessageLength,
+			FrameTimeoutMilliseconds:             legacy.FrameTimeoutMilliseconds,
+			ResyncWindow:                         legacy.ResyncWindow,
+		},
+		Caster: Caster{
+			Host:       legacy.CasterHostName,
+			Port:       legacy.CasterPort,
+			Mountpoint: legacy.Mountpoint,
+			User:       firstString(legacy.CasterUserName, legacy.User),
+			Password:   firstString(legacy.CasterPassword, legacy.Password),
+			GGA:        legacy.GGA,
+		},
+		Station: legacy.Station,
+		Logging: Logging{
+			DisplayMessages:            legacy.DisplayMessages,
+			RecordMessages:             legacy.RecordMessages,
+			MessageLogDirectory:        firstString(legacy.MessageLogDirectory, legacy.LogDirectory),
+			DirectoryForOldMessageLogs: legacy.DirectoryForOldMessageLogs,
+			RecordDecimationSeconds:    legacy.RecordDecimationSeconds,
+			LogEvents:                  legacy.LogEvents,
+			EventLogDirectory:          legacy.EventLogDirectory,
+			PositionPrecisionMetres:    legacy.PositionPrecisionMetres,
+			DisplayTimeZone:            legacy.DisplayTimeZone,
+			DisplayChangesOnly:         legacy.DisplayChangesOnly,
+			ParseNMEA:                  legacy.ParseNMEA,
+		},
+		Filter: Filter{
+			ForwardTypes:              legacy.ForwardTypes,
+			DropTypes:                 legacy.DropTypes,
+			ReorderWindowMilliseconds: legacy.ReorderWindowMilliseconds,
+			TransformCommand:          legacy.TransformCommand,
+		},
+		RTCMFilter: RTCMFilter{
+			MemorySoftCapMegabytes:     legacy.MemorySoftCapMegabytes,
+			MemoryCheckIntervalSeconds: legacy.MemoryCheckIntervalSeconds,
+			NMEABeacon:                 legacy.NMEABeacon,
+			TimeCheck:                  legacy.TimeCheck,
+			Notify:                     legacy.Notify,
+			MaintenanceWindows:         legacy.MaintenanceWindows,
+			Telemetry:                  legacy.Telemetry,
+			Metrics:                    legacy.Metrics,
+		},
+		NTRIPClient: NTRIPClient{
+			SerialDevice: legacy.SerialDevice,
+			SerialSpeed:  legacy.SerialSpeed,
+		},
+		NTRIPCaster: NTRIPCaster{
+			ListenAddress: legacy.ListenAddress,
+			Config:        caster.Config{Mountpoints: legacy.Mountpoints},
+		},
+		Proxy: Proxy{
+			RemoteHost:             legacy.RemoteHost,
+			ProxyHost:              legacy.ProxyHost,
+			ProxyPort:              legacy.ProxyPort,
+			ControlHost:            legacy.ControlHost,
+			ControlPort:            legacy.ControlPort,
+			TLS:                    legacy.TLS,
+			CertFile:               legacy.CertFile,
+			MemorySoftCapMegabytes: legacy.MemorySoftCapMegabytes,
+			StatusSnapshotFile:     legacy.StatusSnapshotFile,
+			StatusSnapshotSeconds:  legacy.StatusSnapshotSeconds,
+		},
+	}
+
+	// ntripclient gave the caster as "host:port".
+	if len(config.Caster.Host) == 0 && len(legacy.Caster) > 0 {
+		config.Caster.Host = legacy.Caster
+		host, portText, splitError := net.SplitHostPort(legacy.Caster)
+		if splitError == nil {
+			port, portError := strconv.ParseUint(portText, 10, 16)
+			if portError == nil {
+				config.Caster.Host = host
+				config.Caster.Port = uint(port)
+			}
+		}
+	}
+
+	return &config
+}
+
+// firstList returns the first of the lists that is not empty.
+func firstList(lists ...[]string) []string {
+	for _, list := range lists {
+		if len(list) > 0 {
+			return list
+		}
+	}
+	return nil
+}
+
+// firstString returns the first of the strings that is not empty.
+func firstString(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// firstNonZero returns the first of the values that is not zero.
+func firstNonZero(values ...uint) uint {
+	for _, value := range values {
+		if value != 0 {
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/caster"
+	"github.com/goblimey/go-ntrip/maintenance"
+	"github.com/goblimey/go-ntrip/metrics"
+	"github.com/goblimey/go-ntrip/ntrip"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestParseLegacy checks that the flat configs that the commands used
+// before the config package are converted.
+func TestParseLegacy(t *testing.T) {
+	var testData = []struct {
+		description string
+		json        string
+		want        *Config
+	}{
+		{
+			"jsonconfig",
+			`{
+				"input": ["/dev/ttyUSB0", "/dev/ttyUSB1"],
+				"display_messages": true,
+				"record_messages": true,
+				"message_log_directory": "logs",
+				"caster_host_name": "caster.example.com",
+				"caster_port": 2102,
+				"caster_user_name": "user",
+				"caster_password": "secret",
+				"read_timeout_milliseconds": 500,
+				"sleep_time_after_failed_open_milliseconds": 100,
+				"wait_time_on_EOF_millis": 10,
+				"timeout_on_EOF_milliseconds": 500,
+				"max_message_length": 2000,
+				"frame_timeout_milliseconds": 50,
+				"resync_window": 64,
+				"parse_nmea": true
+			}`,
+			&Config{
+				Input: Input{
+					Devices:                              []string{"/dev/ttyUSB0", "/dev/ttyUSB1"},
+					ReadTimeoutMilliseconds:              500,
+					SleepTimeAfterFailedOpenMilliseconds: 100,
+					WaitTimeOnEOFMilliseconds:            10,
+					TimeoutOnEOFMilliseconds:             500,
+					MaxMessageLength:                     2000,
+					FrameTimeoutMilliseconds:             50,
+					ResyncWindow:                         64,
+				},
+				Caster: Caster{Host: "caster.example.com", Port: 2102, User: "user", Password: "secret"},
+				Logging: Logging{
+					DisplayMessages: true, RecordMessages: true, MessageLogDirectory: "logs", ParseNMEA: true,
+				},
+			},
+		},
+		{
+			"serial_usb_grabber",
+			`{
+				"speed": 115200,
+				"parity": "no_parity",
+				"data_bits": 7,
+				"stop_bits": 2,
+				"initial_status_bits": ["dtr"],
+				"read_timeout_milliseconds": 3000,
+				"sleep_time_after_failed_open_milliseconds": 4000,
+				"sleep_time_on_EOF_millis": 5000,
+				"filenames": ["/dev/ttyACM0", "/dev/ttyACM1"]
+			}`,
+			&Config{
+				Input: Input{
+					Devices: []string{"/dev/ttyACM0", "/dev/ttyACM1"},
+					Serial: Serial{
+						Speed: 115200, Parity: "no_parity", DataBits: 7, StopBits: 2,
+						InitialStatusBits: []string{"dtr"},
+					},
+					ReadTimeoutMilliseconds:              3000,
+					SleepTimeAfterFailedOpenMilliseconds: 4000,
+					WaitTimeOnEOFMilliseconds:            5000,
+				},
+			},
+		},
+		{
+			"rtcmlogger",
+			`{
+				"log_events": true,
+				"message_log_directory": "l",
+				"directory_for_old_message_logs": "l/m",
+				"event_log_directory": "events"
+			}`,
+			&Config{
+				Logging: Logging{
+					LogEvents: true, MessageLogDirectory: "l",
+					DirectoryForOldMessageLogs: "l/m", EventLogDirectory: "events",
+				},
+			},
+		},
+		{
+			"rtcmfilter",
+			`{
+				"display_messages": true,
+				"record_messages": true,
+				"log_directory": "rtcmlog",
+				"record_decimation_seconds": 30,
+				"memory_soft_cap_megabytes": 200,
+				"memory_check_interval_seconds": 5,
+				"maintenance_windows": [{"days": ["Sunday"], "start": "02:00", "duration_minutes": 30}],
+				"reorder_window_milliseconds": 200,
+				"position_precision_metres": 100,
+				"transform_command": ["cat"],
+				"display_time_zone": "Europe/London",
+				"display_changes_only": true,
+				"metrics": {"listen_address": ":9100"},
+				"forward_types": [1005, 1077],
+				"drop_types": [1230]
+			}`,
+			&Config{
+				Logging: Logging{
+					DisplayMessages:         true,
+					RecordMessages:          true,
+					MessageLogDirectory:     "rtcmlog",
+					RecordDecimationSeconds: 30,
+					PositionPrecisionMetres: 100,
+					DisplayTimeZone:         "Europe/London",
+					DisplayChangesOnly:      true,
+				},
+				Filter: Filter{
+					ForwardTypes:              []int{1005, 1077},
+					DropTypes:                 []int{1230},
+					ReorderWindowMilliseconds: 200,
+					TransformCommand:          []string{"cat"},
+				},
+				RTCMFilter: RTCMFilter{
+					MemorySoftCapMegabytes:     200,
+					MemoryCheckIntervalSeconds: 5,
+					MaintenanceWindows: []maintenance.Window{
+						{Days: []string{"Sunday"}, Start: "02:00", DurationMinutes: 30},
+					},
+					Metrics: &metrics.Config{ListenAddress: ":9100"},
+				},
+				// The proxy used the same name for its memory cap.
+				Proxy: Proxy{MemorySoftCapMegabytes: 200},
+			},
+		},
+		{
+			"ntripclient",
+			`{
+				"caster": "caster.example.com:2101",
+				"mountpoint": "MYBASE",
+				"user": "rover",
+				"password": "letmein",
+				"gga": {"latitude": 51.5, "longitude": -0.25},
+				"serial_device": "/dev/ttyACM0",
+				"serial_speed": 9600
+			}`,
+			&Config{
+				Caster: Caster{
+					Host: "caster.example.com", Port: 2101, Mountpoint: "MYBASE",
+					User: "rover", Password: "letmein",
+					GGA: &ntrip.GGAConfig{Latitude: 51.5, Longitude: -0.25},
+				},
+				NTRIPClient: NTRIPClient{SerialDevice: "/dev/ttyACM0", SerialSpeed: 9600},
+			},
+		},
+		{
+			"ntripclient without a port",
+			`{"caster": "caster.example.com", "mountpoint": "MYBASE"}`,
+			&Config{Caster: Caster{Host: "caster.example.com", Mountpoint: "MYBASE"}},
+		},
+		{
+			"ntripcaster",
+			`{
+				"listen_address": ":2102",
+				"mountpoints": [{"name": "MYBASE", "source_password": "secret"}]
+			}`,
+			&Config{
+				NTRIPCaster: NTRIPCaster{
+					ListenAddress: ":2102",
+					Config: caster.Config{Mountpoints: []caster.Mountpoint{
+						{Name: "MYBASE", SourcePassword: "secret"},
+					}},
+				},
+			},
+		},
+		{
+			"proxy",
+			`{
+				"remote_host": "caster.example.com:2101",
+				"proxy_host": "localhost",
+				"proxy_port": 2102,
+				"control_port": 8081,
+				"tls": {"country": ["GB"], "common_name": "*.example.com"},
+				"record_messages": true,
+				"message_log_directory": "logs",
+				"position_precision_metres": 100,
+				"status_snapshot_file": "/var/www/status.json"
+			}`,
+			&Config{
+				Logging: Logging{
+					RecordMessages:          true,
+					MessageLogDirectory:     "logs",
+					PositionPrecisionMetres: 100,
+				},
+				Proxy: Proxy{
+					RemoteHost:         "caster.example.com:2101",
+					ProxyHost:          "localhost",
+					ProxyPort:          2102,
+					ControlPort:        8081,
+					TLS:                &ProxyTLS{Country: []string{"GB"}, CommonName: "*.example.com"},
+					StatusSnapshotFile: "/var/www/status.json",
+				},
+			},
+		},
+	}
+
+	for _, td := range testData {
+		got, err := Parse([]byte(td.json))
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestIsLegacy checks that the format of a config is recognised.
+func TestIsLegacy(t *testing.T) {
+	var testData = []struct {
+		json string
+		want bool
+	}{
+		{`{}`, false},
+		{`{"logging": {"record_messages": true}}`, false},
+		{`{"station": null, "filter": {}}`, false},
+		{`{"record_messages": true}`, true},
+		{`{"input": ["/dev/ttyACM0"]}`, true},
+		{`{"caster": "caster.example.com:2101"}`, true},
+		{`{"logging": {}, "speed": 9600}`, true},
+		{`junk`, false},
+	}
+
+	for _, td := range testData {
+		if got := isLegacy([]byte(td.json)); got != td.want {
+			t.Errorf("%s: want %v got %v", td.json, td.want, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.bug.st/serial"
+)
+
+// DefaultSerialSpeed is the line speed if the config doesn't give one.
+const DefaultSerialSpeed = 9600
+
+// Serial gives the parameters of a serial line.
+type Serial struct {
+	// Speed is the line speed in bits per second.  0 means
+	// DefaultSerialSpeed.
+	Speed int `json:"speed"`
+
+	// Parity is the parity of the bytes - no_parity (the default),
+	// odd_parity, even_parity, mark_parity or space_parity.
+	Parity string `json:"parity"`
+
+	// DataBits is the number of data bits in a byte, 5-8.  0 means 8.
+	DataBits int `json:"data_bits"`
+
+	// StopBits is the number of stop bits, 1, 1.5 or 2.  0 means 1.
+	StopBits float32 `json:"stop_bits"`
+
+	// InitialStatusBits holds up to two values, "dtr" and "rts", which set
+	// DTR (DataTerminalReady) and RTS (ReadyToSend) when the line is
+	// opened.  If it's empty, both are set.
+	InitialStatusBits []string `json:"initial_status_bits"`
+}
+
+// Mode returns the mode with which to open the serial line.
+func (s *Serial) Mode() (*serial.Mode, error) {
+	mode := serial.Mode{BaudRate: DefaultSerialSpeed}
+	if s.Speed != 0 {
+		mode.BaudRate = s.Speed
+	}
+
+	switch s.Parity {
+	case "", "no_parity":
+		mode.Parity = serial.NoParity
+	case "odd_parity":
+		mode.Parity = serial.OddParity
+	case "even_parity":
+		mode.Parity = serial.EvenParity
+	case "mark_parity":
+		mode.Parity = serial.MarkParity
+	case "space_parity":
+		mode.Parity = serial.SpaceParity
+	default:
+		return nil, errors.New("config - illegal parity value " + s.Parity)
+	}
+
+	if s.DataBits > 0 {
+		if s.DataBits < 5 || s.DataBits > 8 {
+			em := fmt.Sprintf("config - data bits must be 5-8, got %d", s.DataBits)
+			return nil, errors.New(em)
+		}
+		mode.DataBits = s.DataBits
+	}
+
+	switch s.StopBits {
+	case 0, 1:
+		mode.StopBits = serial.OneStopBit
+	case 1.5:
+		mode.StopBits = serial.OnePointFiveStopBits
+	case 2:
+		mode.StopBits = serial.TwoStopBits
+	default:
+		em := fmt.Sprintf("config - stop bits must be 1, 1.5 or 2, got %g", s.StopBits)
+		return nil, errors.New(em)
+	}
+
+	if len(s.InitialStatusBits) > 0 {
+		var bits serial.ModemOutputBits
+		for _, b := range s.InitialStatusBits {
+			switch strings.ToLower(b) {
+			case "dtr":
+				bits.DTR = true
+			case "rts":
+				bits.RTS = true
+			default:
+				return nil, errors.New("config - illegal initial status bit value " + b)
+			}
+		}
+		mode.InitialStatusBits = &bits
+	}
+
+	return &mode, nil
+}
@@ -0,0 +1,683 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The config can also be written in YAML, which some find easier to read
+// and which allows comments:
+//
+//	# The base station in the shed.
+//	input:
+//	  devices: [/dev/ttyACM0, /dev/ttyACM1]
+//	  serial:
+//	    speed: 115200
+//	caster:
+//	  host: caster.example.com
+//	  mountpoint: MYBASE
+//	  password: ${CASTER_PASSWORD}
+//	filter:
+//	  drop_types:
+//	    - 1230
+//
+// A file whose first character, apart from white space and comments, is
+// "{" is read as JSON and anything else as YAML.  The YAML is converted to
+// JSON and then read in the same way, so the names and the checks are the
+// same.  Only the part of YAML that a config needs is supported:  block
+// mappings and sequences indented with spaces, sequences and mappings in
+// the flow style on one line, plain, single-quoted and double-quoted
+// scalars, and comments.  Anchors, tags, block scalars and multiple
+// documents are not.
+//
+// A plain scalar that looks like a number or a boolean is read as one,
+// unless it's given for a setting that's a string, so that
+//
+//	password: 12345
+//
+// gives the password "12345", just as written.
+
+// isYAML returns true if the data is to be read as YAML rather than JSON.
+func isYAML(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return !strings.HasPrefix(line, "{")
+	}
+	return false
+}
+
+// yamlLine is a line of YAML with the comment and the indentation removed.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser parses YAML into the values that encoding/json produces from
+// JSON - maps, slices, strings, numbers, booleans and nil.
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+// plainScalar is a plain scalar that looks like a number or a boolean.
+// The text is kept in case it's given for a setting that's a string.
+type plainScalar struct {
+	// value is the json.Number or the bool.
+	value interface{}
+
+	// text is the scalar as written, after the references to environment
+	// variables have been replaced.
+	text string
+}
+
+// MarshalJSON gives the number or the boolean.
+func (scalar plainScalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(scalar.value)
+}
+
+// yamlToJSON converts a config in YAML to JSON, replacing the references to
+// environment variables in the values.
+func yamlToJSON(data []byte) ([]byte, error) {
+	lines, splitError := splitYAML(string(data))
+	if splitError != nil {
+		return nil, splitError
+	}
+
+	parser := yamlParser{lines: lines}
+	var value interface{}
+	if len(lines) > 0 {
+		v, parseError := parser.parseBlock(lines[0].indent)
+		if parseError != nil {
+			return nil, parseError
+		}
+		if parser.next < len(lines) {
+			return nil, yamlError(lines[parser.next].number, "unexpected indentation")
+		}
+		if _, isMapping := v.(map[string]interface{}); !isMapping {
+			return nil, yamlError(lines[0].number, "want a mapping of names to values")
+		}
+		value = v
+	} else {
+		// Nothing but comments.
+		value = map[string]interface{}{}
+	}
+
+	// Find out which format the config is in, so that the plain scalars
+	// given for strings can be turned back into strings.
+	converted, marshalError := json.Marshal(value)
+	if marshalError != nil {
+		return nil, marshalError
+	}
+	schema := reflect.TypeOf(Config{})
+	if isLegacy(converted) {
+		schema = reflect.TypeOf(legacyConfig{})
+	}
+
+	return json.Marshal(restoreStrings(value, schema))
+}
+
+// unmarshalerType is the type of json.Unmarshaler.
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// restoreStrings returns the value with each plain scalar that's given for
+// a string in the schema replaced by its text.  Names that aren't in the
+// schema are left alone - the JSON decoder deals with them.
+func restoreStrings(value interface{}, schema reflect.Type) interface{} {
+	for schema.Kind() == reflect.Ptr {
+		schema = schema.Elem()
+	}
+	if reflect.PtrTo(schema).Implements(unmarshalerType) {
+		// The type reads the JSON itself.
+		return value
+	}
+
+	switch v := value.(type) {
+	case plainScalar:
+		if schema.Kind() == reflect.String {
+			return v.text
+		}
+	case []interface{}:
+		if schema.Kind() == reflect.Slice || schema.Kind() == reflect.Array {
+			for i := range v {
+				v[i] = restoreStrings(v[i], schema.Elem())
+			}
+		}
+	case map[string]interface{}:
+		for name := range v {
+			if fieldType, found := fieldFor(name, schema); found {
+				v[name] = restoreStrings(v[name], fieldType)
+			}
+		}
+	}
+	return value
+}
+
+// fieldFor returns the type of the value given by the name in a mapping
+// for the schema, which is a struct or a map.  As in encoding/json, the
+// name is matched against the JSON names of the fields ignoring case, and
+// the fields of embedded structs are included.
+func fieldFor(name string, schema reflect.Type) (reflect.Type, bool) {
+	switch schema.Kind() {
+	case reflect.Map:
+		return schema.Elem(), true
+	case reflect.Struct:
+	default:
+		return nil, false
+	}
+
+	for i := 0; i < schema.NumField(); i++ {
+		field := schema.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && len(tag) == 0 {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if fieldType, found := fieldFor(name, embedded); found {
+				return fieldType, true
+			}
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			// Not exported.
+			continue
+		}
+		if len(tag) == 0 {
+			tag = field.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// yamlError returns an error at the given line.
+func yamlError(lineNumber int, problem string) error {
+	em := fmt.Sprintf("config - cannot parse the YAML at line %d - %s", lineNumber, problem)
+	return errors.New(em)
+}
+
+// splitYAML splits the text into lines, leaving out blank lines, comments
+// and the document markers.
+func splitYAML(text string) ([]yamlLine, error) {
+	lines := make([]yamlLine, 0)
+	for i, line := range strings.Split(text, "\n") {
+		number := i + 1
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		content := strings.TrimLeft(line, " ")
+		if len(content) == 0 {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, yamlError(number, "indent with spaces, not tabs")
+		}
+		if len(lines) == 0 && content == "---" {
+			continue
+		}
+		if content == "---" || content == "..." {
+			return nil, yamlError(number, "only one document is supported")
+		}
+		lines = append(lines, yamlLine{number: number, indent: len(line) - len(content), text: content})
+	}
+	return lines, nil
+}
+
+// stripComment removes a comment from the end of a line.  A comment starts
+// with a # at the start of the line or after white space, outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseBlock parses the mapping or sequence whose lines start at the given
+// indentation.
+func (parser *yamlParser) parseBlock(indent int) (interface{}, error) {
+	line := parser.lines[parser.next]
+	if isSequenceItem(line.text) {
+		return parser.parseSequence(indent)
+	}
+	if _, _, isPair := splitPair(line.text); isPair {
+		return parser.parseMapping(indent)
+	}
+
+	// A lone scalar or flow collection.
+	parser.next++
+	return parseValue(line.text, line.number)
+}
+
+// isSequenceItem returns true if the text is an item of a block sequence.
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseSequence parses a block sequence whose items start at the given
+// indentation.
+func (parser *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := make([]interface{}, 0)
+	for parser.next < len(parser.lines) {
+		line := parser.lines[parser.next]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, yamlError(line.number, "unexpected indentation")
+		}
+		if !isSequenceItem(line.text) {
+			break
+		}
+
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if len(item) == 0 {
+			// The item is the block on the following lines.
+			parser.next++
+			value, err := parser.parseNested(indent)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+			continue
+		}
+
+		// The item starts on this line.  Treat its text as the first line
+		// of a block indented to where it starts, so that an item such as
+		// "- station_id: 42" can carry on as a mapping on the lines below.
+		parser.lines[parser.next] = yamlLine{
+			number: line.number,
+			indent: line.indent + len(line.text) - len(item),
+			text:   item,
+		}
+		value, err := parser.parseBlock(parser.lines[parser.next].indent)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+	return sequence, nil
+}
+
+// parseMapping parses a block mapping whose keys start at the given
+// indentation.
+func (parser *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := make(map[string]interface{})
+	for parser.next < len(parser.lines) {
+		line := parser.lines[parser.next]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, yamlError(line.number, "unexpected indentation")
+		}
+		key, rest, isPair := splitPair(line.text)
+		if !isPair {
+			return nil, yamlError(line.number, "want a key and a value")
+		}
+		name, keyError := parseKey(key, line.number)
+		if keyError != nil {
+			return nil, keyError
+		}
+		if _, duplicate := mapping[name]; duplicate {
+			return nil, yamlError(line.number, fmt.Sprintf("%q appears twice", name))
+		}
+		parser.next++
+
+		if len(rest) > 0 {
+			value, err := parseValue(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			mapping[name] = value
+			continue
+		}
+
+		// The value is the block on the following lines, or null if there
+		// isn't one.  A sequence may be at the same indentation as the key.
+		if parser.next < len(parser.lines) {
+			following := parser.lines[parser.next]
+			if following.indent == indent && isSequenceItem(following.text) {
+				value, err := parser.parseSequence(indent)
+				if err != nil {
+					return nil, err
+				}
+				mapping[name] = value
+				continue
+			}
+		}
+		value, err := parser.parseNested(indent)
+		if err != nil {
+			return nil, err
+		}
+		mapping[name] = value
+	}
+	return mapping, nil
+}
+
+// parseNested parses the block, if any, that's indented further than the
+// line before it.  If there isn't one, the value is null.
+func (parser *yamlParser) parseNested(indent int) (interface{}, error) {
+	if parser.next >= len(parser.lines) || parser.lines[parser.next].indent <= indent {
+		return nil, nil
+	}
+	return parser.parseBlock(parser.lines[parser.next].indent)
+}
+
+// splitPair splits a line of a mapping into the key and the rest.  The
+// key ends at the first ": " or at a ":" at the end of the line, outside
+// quotes.
+func splitPair(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '[' || c == '{':
+			if i == 0 {
+				// A flow collection, not a key.
+				return "", "", false
+			}
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseKey returns the name given by a key, which may be quoted.
+func parseKey(key string, lineNumber int) (string, error) {
+	if len(key) > 0 && (key[0] == '"' || key[0] == '\'') {
+		return unquote(key, lineNumber)
+	}
+	return key, nil
+}
+
+// parseValue parses a value on one line - a scalar or a flow collection.
+func parseValue(text string, lineNumber int) (interface{}, error) {
+	scanner := flowScanner{text: text, lineNumber: lineNumber}
+	value, err := scanner.value()
+	if err != nil {
+		return nil, err
+	}
+	scanner.skipSpace()
+	if scanner.pos < len(scanner.text) {
+		return nil, yamlError(lineNumber, fmt.Sprintf("unexpected %q", scanner.text[scanner.pos:]))
+	}
+	return value, nil
+}
+
+// flowScanner parses a scalar or a flow collection such as [1005, 1077] or
+// {x: 1, y: 2}.
+type flowScanner struct {
+	text       string
+	pos        int
+	lineNumber int
+	inFlow     bool
+}
+
+// skipSpace moves past any spaces.
+func (scanner *flowScanner) skipSpace() {
+	for scanner.pos < len(scanner.text) && scanner.text[scanner.pos] == ' ' {
+		scanner.pos++
+	}
+}
+
+// value parses the value at the current position.
+func (scanner *flowScanner) value() (interface{}, error) {
+	scanner.skipSpace()
+	if scanner.pos >= len(scanner.text) {
+		return nil, nil
+	}
+	switch scanner.text[scanner.pos] {
+	case '[':
+		return scanner.sequence()
+	case '{':
+		return scanner.mapping()
+	case '"', '\'':
+		text, err := scanner.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return expandScalar(text)
+	case '&', '*', '!', '|', '>':
+		return nil, yamlError(scanner.lineNumber,
+			fmt.Sprintf("%q is not supported", scanner.text[scanner.pos:scanner.pos+1]))
+	default:
+		return scanner.plain()
+	}
+}
+
+// sequence parses a flow sequence.
+func (scanner *flowScanner) sequence() (interface{}, error) {
+	scanner.pos++ // Skip the [.
+	sequence := make([]interface{}, 0)
+	outer := scanner.inFlow
+	scanner.inFlow = true
+	defer func() { scanner.inFlow = outer }()
+
+	for {
+		scanner.skipSpace()
+		if scanner.pos >= len(scanner.text) {
+			return nil, yamlError(scanner.lineNumber, "a flow sequence must end on the same line")
+		}
+		if scanner.text[scanner.pos] == ']' {
+			scanner.pos++
+			return sequence, nil
+		}
+		item, err := scanner.value()
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, item)
+		if err := scanner.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// mapping parses a flow mapping.
+func (scanner *flowScanner) mapping() (interface{}, error) {
+	scanner.pos++ // Skip the {.
+	mapping := make(map[string]interface{})
+	outer := scanner.inFlow
+	scanner.inFlow = true
+	defer func() { scanner.inFlow = outer }()
+
+	for {
+		scanner.skipSpace()
+		if scanner.pos >= len(scanner.text) {
+			return nil, yamlError(scanner.lineNumber, "a flow mapping must end on the same line")
+		}
+		if scanner.text[scanner.pos] == '}' {
+			scanner.pos++
+			return mapping, nil
+		}
+
+		var name string
+		if c := scanner.text[scanner.pos]; c == '"' || c == '\'' {
+			key, err := scanner.quoted()
+			if err != nil {
+				return nil, err
+			}
+			name = key
+		} else {
+			start := scanner.pos
+			for scanner.pos < len(scanner.text) && scanner.text[scanner.pos] != ':' &&
+				scanner.text[scanner.pos] != ',' && scanner.text[scanner.pos] != '}' {
+				scanner.pos++
+			}
+			name = strings.TrimSpace(scanner.text[start:scanner.pos])
+		}
+		scanner.skipSpace()
+		if scanner.pos >= len(scanner.text) || scanner.text[scanner.pos] != ':' {
+			return nil, yamlError(scanner.lineNumber, fmt.Sprintf("want a value for %q", name))
+		}
+		scanner.pos++ // Skip the :.
+
+		value, err := scanner.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, duplicate := mapping[name]; duplicate {
+			return nil, yamlError(scanner.lineNumber, fmt.Sprintf("%q appears twice", name))
+		}
+		mapping[name] = value
+		if err := scanner.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator moves past the comma after an item of a flow collection.  The
+// collection may end instead.
+func (scanner *flowScanner) separator(end byte) error {
+	scanner.skipSpace()
+	if scanner.pos < len(scanner.text) {
+		switch scanner.text[scanner.pos] {
+		case ',':
+			scanner.pos++
+			return nil
+		case end:
+			return nil
+		}
+	}
+	return yamlError(scanner.lineNumber, fmt.Sprintf("want , or %c", end))
+}
+
+// quoted parses a quoted scalar and returns its text.
+func (scanner *flowScanner) quoted() (string, error) {
+	quote := scanner.text[scanner.pos]
+	end := scanner.pos + 1
+	for ; end < len(scanner.text); end++ {
+		c := scanner.text[end]
+		if c == '\\' && quote == '"' {
+			end++
+			continue
+		}
+		if c == quote {
+			if quote == '\'' && end+1 < len(scanner.text) && scanner.text[end+1] == '\'' {
+				// '' is a quote inside single quotes.
+				end++
+				continue
+			}
+			break
+		}
+	}
+	if end >= len(scanner.text) {
+		return "", yamlError(scanner.lineNumber, "unterminated string")
+	}
+	text, err := unquote(scanner.text[scanner.pos:end+1], scanner.lineNumber)
+	scanner.pos = end + 1
+	return text, err
+}
+
+// plain parses a plain scalar - one without quotes.
+func (scanner *flowScanner) plain() (interface{}, error) {
+	start := scanner.pos
+	for scanner.pos < len(scanner.text) {
+		c := scanner.text[scanner.pos]
+		if scanner.inFlow && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		scanner.pos++
+	}
+	text := strings.TrimSpace(scanner.text[start:scanner.pos])
+	expanded, err := expandEnv(text, noEscape)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePlain(expanded), nil
+}
+
+// unquote returns the text of a single-quoted or double-quoted scalar.
+func unquote(quoted string, lineNumber int) (string, error) {
+	if quoted[0] == '\'' {
+		return strings.ReplaceAll(quoted[1:len(quoted)-1], "''", "'"), nil
+	}
+	text, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", yamlError(lineNumber, fmt.Sprintf("bad string %s", quoted))
+	}
+	return text, nil
+}
+
+// expandScalar replaces the references to environment variables in a
+// quoted scalar, which is always a string.
+func expandScalar(text string) (interface{}, error) {
+	expanded, err := expandEnv(text, noEscape)
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// resolvePlain returns the value of a plain scalar - null, a boolean, a
+// number or otherwise a string.  A boolean or a number is returned as a
+// plainScalar.
+func resolvePlain(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return plainScalar{value: true, text: text}
+	case "false", "False", "FALSE":
+		return plainScalar{value: false, text: text}
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return plainScalar{value: json.Number(strconv.FormatInt(i, 10)), text: text}
+	}
+	if isDecimal(text) {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return plainScalar{value: json.Number(strconv.FormatFloat(f, 'g', -1, 64)), text: text}
+		}
+	}
+	return text
+}
+
+// isDecimal returns true if the text looks like a decimal number, so that
+// strings such as "Inf" or "0x10" are not taken as numbers.
+func isDecimal(text string) bool {
+	digits := false
+	for i, c := range text {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' || c == 'e' || c == 'E':
+		case (c == '+' || c == '-') && (i == 0 || text[i-1] == 'e' || text[i-1] == 'E'):
+		default:
+			return false
+		}
+	}
+	return digits
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestParseYAML checks that a config in YAML gives the same result as the
+// same config in JSON.
+func TestParseYAML(t *testing.T) {
+	const jsonConfig = `{
+		"input": {
+			"devices": ["/dev/ttyACM0", "/dev/ttyACM1"],
+			"serial": {"speed": 115200, "parity": "even_parity"},
+			"receiver": {"interface": "uart2", "message_types": [1005, 1074], "save": true},
+			"read_timeout_milliseconds": 3000
+		},
+		"caster": {"host": "caster.example.com", "mountpoint": "MYBASE", "password": "it's a # secret"},
+		"logging": {"display_messages": true, "message_log_directory": "rtcmlog"},
+		"filter": {"drop_types": [1230], "station_position": {"x": 3978364.8574, "y": -12345.6789, "z": 4968423.4712}},
+		"rtcmfilter": {
+			"queues": {"display": {"size": 1000, "policy": "drop_oldest"}},
+			"demux": {"stations": [{"station_id": 42, "mountpoint": "SHED"}, {"station_id": 43, "mountpoint": "ROOF"}]}
+		}
+	}`
+
+	const yamlConfig = `---
+# The base station in the shed.
+input:
+  devices:
+  - /dev/ttyACM0
+  - "/dev/ttyACM1"   # The spare.
+  serial: {speed: 115200, parity: even_parity}
+  receiver:
+    interface: uart2
+    message_types: [1005, 1074]
+    save: true
+  read_timeout_milliseconds: 3000
+
+caster:
+  host: caster.example.com
+  mountpoint: 'MYBASE'
+  password: 'it''s a # secret'
+logging:
+  display_messages: True
+  message_log_directory: rtcmlog
+filter:
+  drop_types:
+    - 1230
+  station_position:
+    x: 3978364.8574
+    y: -12345.6789
+    z: 4.9684234712e+06
+rtcmfilter:
+  queues:
+    display: {size: 1000, policy: drop_oldest}
+  demux:
+    stations:
+      - station_id: 42
+        mountpoint: SHED
+      - {station_id: 43, mountpoint: ROOF}
+`
+
+	want, jsonError := Parse([]byte(jsonConfig))
+	if jsonError != nil {
+		t.Fatal(jsonError)
+	}
+	got, yamlError := Parse([]byte(yamlConfig))
+	if yamlError != nil {
+		t.Fatal(yamlError)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestYAMLToJSON checks the conversion of YAML to JSON.
+func TestYAMLToJSON(t *testing.T) {
+	var testData = []struct {
+		description string
+		yaml        string
+		want        string
+		wantError   string
+	}{
+		{"empty", "# Nothing yet.\n", `{}`, ""},
+		{"scalars", "a: 1\nb: -2.50\nc: yes\nd: false\ne: ~\nf:\ng: 0x10\nh: \"1\"\n",
+			`{"a":1,"b":-2.5,"c":"yes","d":false,"e":null,"f":null,"g":"0x10","h":"1"}`, ""},
+		{"double quotes", `a: "tab\there \"quoted\" # not a comment"`,
+			`{"a":"tab\there \"quoted\" # not a comment"}`, ""},
+		{"colons", "a: http://example.com:80/x\n\"b: c\": d", `{"a":"http://example.com:80/x","b: c":"d"}`, ""},
+		{"hash", "a: b#c # comment", `{"a":"b#c"}`, ""},
+		{"nested sequences", "a:\n  -\n    - 1\n    - 2\n  - []\n", `{"a":[[1,2],[]]}`, ""},
+		{"flow", "a: {b: [1, {c: d}], e: ''}", `{"a":{"b":[1,{"c":"d"}],"e":""}}`, ""},
+		{"indented", "  a:\n    b: 1\n", `{"a":{"b":1}}`, ""},
+		{"tab", "a:\n\tb: 1", "", "config - cannot parse the YAML at line 2 - indent with spaces, not tabs"},
+		{"bad indentation", "a:\n    b: 1\n  c: 2", "", "config - cannot parse the YAML at line 3 - unexpected indentation"},
+		{"top level unindented", "  a: 1\nb: 2", "", "config - cannot parse the YAML at line 2 - unexpected indentation"},
+		{"duplicate", "a: 1\na: 2", "", `config - cannot parse the YAML at line 2 - "a" appears twice`},
+		{"duplicate in flow", "a: {b: 1, b: 2}", "", `config - cannot parse the YAML at line 1 - "b" appears twice`},
+		{"not a pair", "a: 1\nb", "", "config - cannot parse the YAML at line 2 - want a key and a value"},
+		{"sequence", "- a\n- b", "", "config - cannot parse the YAML at line 1 - want a mapping of names to values"},
+		{"block scalar", "a: |\n  text", "", `config - cannot parse the YAML at line 1 - "|" is not supported`},
+		{"anchor", "a: &x 1", "", `config - cannot parse the YAML at line 1 - "&" is not supported`},
+		{"two documents", "a: 1\n---\nb: 2", "", "config - cannot parse the YAML at line 2 - only one document is supported"},
+		{"multi-line flow", "a: [1,\n  2]", "", "config - cannot parse the YAML at line 1 - a flow sequence must end on the same line"},
+		{"unterminated string", `a: "b`, "", "config - cannot parse the YAML at line 1 - unterminated string"},
+		{"junk after string", `a: "b" c`, "", `config - cannot parse the YAML at line 1 - unexpected "c"`},
+		{"wrong bracket", "a: [1, 2}", "", "config - cannot parse the YAML at line 1 - want , or ]"},
+		{"unset variable", "a: ${NO_SUCH_VARIABLE}", "", "config - the environment variable NO_SUCH_VARIABLE is not set"},
+	}
+
+	for _, td := range testData {
+		got, err := yamlToJSON([]byte(td.yaml))
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !json.Valid(got) || string(got) != td.want {
+			t.Errorf("%s: want %s got %s", td.description, td.want, got)
+		}
+	}
+}
+
+// TestYAMLVariables checks that the references to environment variables in
+// YAML are replaced and that a plain value is then resolved.
+func TestYAMLVariables(t *testing.T) {
+	defer fakeEnv(map[string]string{"PORT": "2102", "SECRET": `a "b" c`})()
+
+	got, err := yamlToJSON([]byte("port: ${PORT}\nquoted: \"${PORT}\"\nsecret: ${SECRET}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"port":2102,"quoted":"2102","secret":"a \"b\" c"}`
+	if string(got) != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+// TestYAMLStrings checks that a plain scalar that looks like a number or a
+// boolean is read as a string, just as it was written, when it's given for
+// a setting that's a string.
+func TestYAMLStrings(t *testing.T) {
+	defer fakeEnv(map[string]string{"PIN": "0042"})()
+
+	const yamlConfig = `
+caster:
+  host: caster.example.com
+  port: 2101
+  mountpoint: 1234
+  user: true
+  password: 007
+ntripcaster:
+  mountpoints:
+    - name: MYBASE
+      source_password: ${PIN}
+`
+	got, err := Parse([]byte(yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Caster{Host: "caster.example.com", Port: 2101, Mountpoint: "1234", User: "true", Password: "007"}
+	if diff := cmp.Diff(want, got.Caster); diff != "" {
+		t.Error(diff)
+	}
+	if len(got.NTRIPCaster.Mountpoints) != 1 || got.NTRIPCaster.Mountpoints[0].SourcePassword != "0042" {
+		t.Errorf("want the source password 0042, got %+v", got.NTRIPCaster.Mountpoints)
+	}
+
+	// The same goes for the old flat format.
+	legacy, legacyError := Parse([]byte("caster_host: caster.example.com\npassword: 12345\n"))
+	if legacyError != nil {
+		t.Fatal(legacyError)
+	}
+	if legacy.Caster.Password != "12345" {
+		t.Errorf("want the password 12345, got %q", legacy.Caster.Password)
+	}
+}
+
+// TestIsYAML checks that JSON and YAML are told apart.
+func TestIsYAML(t *testing.T) {
+	var testData = []struct {
+		text string
+		want bool
+	}{
+		{``, false},
+		{`{}`, false},
+		{"\n  # A comment.\n  {\"input\": {}}", false},
+		{"input:\n  devices: [/dev/ttyACM0]", true},
+		{"# A comment.\n---\n", true},
+		{`junk`, true},
+	}
+
+	for _, td := range testData {
+		if got := isYAML([]byte(td.text)); got != td.want {
+			t.Errorf("%q: want %v got %v", td.text, td.want, got)
+		}
+	}
+}
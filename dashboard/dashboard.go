@@ -0,0 +1,509 @@
+// The dashboard package serves a small status page for a base station, so
+// that someone on the local network can see at a glance whether it's
+// working without logging in and reading the logs.  The page shows:
+//
+//   - the rate of each message type over the last minute,
+//   - the last base position from a message type 1005, with a plot of the
+//     recent positions to show any wander,
+//   - the satellites and signals seen in the latest MSM from each
+//     constellation,
+//   - the state of the connection to the device, and
+//   - the state of the connection to the caster.
+//
+// The page refreshes itself every few seconds.  The same figures are served
+// as JSON at /status.json for scripts.
+//
+// The dashboard is off unless the application's config has a dashboard
+// section:
+//
+//	"dashboard": {"listen_address": ":8080"}
+//
+// The application creates the Dashboard, starts listening and feeds it:
+//
+//	d, err := dashboard.New(config, logger)
+//	...
+//	err = d.Listen()
+//	...
+//	go d.Run(nil)
+//	d.Observe(&message)  // Call for each message.
+//
+// An application that connects to the device or the caster itself reports
+// the state of the connection with SetDeviceState and SetCasterState.
+// Otherwise the device state is worked out from the arrival of the messages
+// and the caster state is "unknown" unless WatchCaster is running.
+package dashboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/nmea"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// RateWindow is the period over which the message rates are worked out.
+const RateWindow = time.Minute
+
+// SilentAfter is the time without a message after which the device is
+// shown as silent.
+const SilentAfter = 10 * time.Second
+
+// MaxPositions is the number of base positions kept for the plot.
+const MaxPositions = 100
+
+// refreshSeconds is the time between refreshes of the page.
+const refreshSeconds = 5
+
+// plotSize is the width and height of the position plot in pixels.
+const plotSize = 200
+
+// metresPerDegree is the length of a degree of latitude, near enough for a
+// plot of a few metres.
+const metresPerDegree = 111320.0
+
+// casterDialTimeout is the time allowed by WatchCaster to connect to the
+// caster.
+const casterDialTimeout = 10 * time.Second
+
+// Config is the config of a Dashboard, as it appears in an application's
+// JSON config file.
+type Config struct {
+	// ListenAddress is the host:port on which the page is served, for
+	// example ":8080" for all interfaces.
+	ListenAddress string `json:"listen_address"`
+}
+
+// Rate is the rate of one message type.
+type Rate struct {
+	MessageType int     `json:"message_type"`
+	PerSecond   float64 `json:"per_second"`
+}
+
+// Constellation describes the latest MSM from one constellation.
+type Constellation struct {
+	Name        string    `json:"name"`
+	MessageType int       `json:"message_type"`
+	Satellites  int       `json:"satellites"`
+	Signals     int       `json:"signals"`
+	SignalCells int       `json:"signal_cells"`
+	At          time.Time `json:"at"`
+}
+
+// Status is the content of the page.
+type Status struct {
+	At             time.Time       `json:"at"`
+	Rates          []Rate          `json:"rates"`
+	Position       *nmea.Position  `json:"position,omitempty"`
+	PositionAt     time.Time       `json:"position_at,omitempty"`
+	Positions      []nmea.Position `json:"positions,omitempty"`
+	Constellations []Constellation `json:"constellations"`
+	Device         string          `json:"device"`
+	LastMessage    time.Time       `json:"last_message,omitempty"`
+	Caster         string          `json:"caster"`
+}
+
+// Dashboard holds the state of the station and serves the page.  It's safe
+// for concurrent use.
+type Dashboard struct {
+	// config is the config of the Dashboard.
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// listener is the listener on which the page is served, nil until
+	// Listen is called.
+	listener net.Listener
+
+	// arrivals holds the arrival times of the messages of each type within
+	// the rate window.
+	arrivals map[int][]time.Time
+
+	// positions holds the recent base positions, oldest first.
+	positions []nmea.Position
+
+	// positionAt is the time at which the last position arrived.
+	positionAt time.Time
+
+	// constellations holds the latest MSM from each constellation.
+	constellations map[string]Constellation
+
+	// lastMessage is the time at which the last message arrived.
+	lastMessage time.Time
+
+	// deviceState and casterState are as set by SetDeviceState and
+	// SetCasterState.
+	deviceState string
+	casterState string
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// New creates a Dashboard that serves on the address in the config.  The
+// logger may be nil.
+func New(config Config, logger *log.Logger) (*Dashboard, error) {
+	_, _, splitError := net.SplitHostPort(config.ListenAddress)
+	if splitError != nil {
+		em := fmt.Sprintf("dashboard - the listen address %q is not host:port", config.ListenAddress)
+		return nil, errors.New(em)
+	}
+
+	dashboard := Dashboard{
+		config:         config,
+		logger:         logger,
+		arrivals:       make(map[int][]time.Time),
+		constellations: make(map[string]Constellation),
+		now:            time.Now,
+	}
+
+	return &dashboard, nil
+}
+
+// Observe takes note of a message.  Non-RTCM data is ignored.
+func (dashboard *Dashboard) Observe(message *rtcm.Message) {
+	if message == nil || message.MessageType == utils.NonRTCMMessage {
+		return
+	}
+
+	// Decode what's needed before taking the lock.
+	var position *nmea.Position
+	if message.MessageType == utils.MessageType1005 {
+		m, err := type1005.GetMessage(message.RawData, slog.LevelInfo)
+		if err == nil {
+			p := nmea.PositionFrom1005(m)
+			position = &p
+		}
+	}
+	var msmHeader *header.Header
+	if utils.MSM(message.MessageType) {
+		h, _, err := header.GetMSMHeader(message.RawData, slog.LevelInfo)
+		if err == nil {
+			msmHeader = h
+		}
+	}
+
+	dashboard.mutex.Lock()
+	defer dashboard.mutex.Unlock()
+
+	now := dashboard.now()
+	dashboard.lastMessage = now
+	dashboard.arrivals[message.MessageType] =
+		append(prune(dashboard.arrivals[message.MessageType], now), now)
+
+	if position != nil {
+		dashboard.positions = append(dashboard.positions, *position)
+		if len(dashboard.positions) > MaxPositions {
+			dashboard.positions = dashboard.positions[len(dashboard.positions)-MaxPositions:]
+		}
+		dashboard.positionAt = now
+	}
+
+	if msmHeader != nil {
+		dashboard.constellations[msmHeader.Constellation] = Constellation{
+			Name:        msmHeader.Constellation,
+			MessageType: msmHeader.MessageType,
+			Satellites:  len(msmHeader.Satellites),
+			Signals:     len(msmHeader.Signals),
+			SignalCells: msmHeader.NumSignalCells,
+			At:          now,
+		}
+	}
+}
+
+// SetDeviceState sets the state of the connection to the device shown on
+// the page, for example "connected to /dev/ttyACM0".  An empty state goes
+// back to working it out from the arrival of the messages.
+func (dashboard *Dashboard) SetDeviceState(state string) {
+	dashboard.mutex.Lock()
+	defer dashboard.mutex.Unlock()
+	dashboard.deviceState = state
+}
+
+// SetCasterState sets the state of the connection to the caster shown on
+// the page, for example "connected".
+func (dashboard *Dashboard) SetCasterState(state string) {
+	dashboard.mutex.Lock()
+	defer dashboard.mutex.Unlock()
+	dashboard.casterState = state
+}
+
+// WatchCaster is for an application that doesn't connect to the caster
+// itself.  At the given interval it tries to connect to the address and
+// sets the caster state to say whether it can be reached.  It runs until
+// the stop channel is closed.  If the channel is nil, it runs forever.  It
+// can be run in a goroutine.
+func (dashboard *Dashboard) WatchCaster(address string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		connection, dialError := net.DialTimeout("tcp", address, casterDialTimeout)
+		if dialError != nil {
+			dashboard.SetCasterState(fmt.Sprintf("%s cannot be reached - %v", address, dialError))
+		} else {
+			connection.Close()
+			dashboard.SetCasterState(fmt.Sprintf("%s can be reached", address))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the content of the page.
+func (dashboard *Dashboard) Status() *Status {
+	dashboard.mutex.Lock()
+	defer dashboard.mutex.Unlock()
+
+	now := dashboard.now()
+	status := Status{
+		At:             now,
+		Rates:          make([]Rate, 0, len(dashboard.arrivals)),
+		Constellations: make([]Constellation, 0, len(dashboard.constellations)),
+		LastMessage:    dashboard.lastMessage,
+	}
+
+	for messageType, times := range dashboard.arrivals {
+		times = prune(times, now)
+		dashboard.arrivals[messageType] = times
+		if len(times) == 0 {
+			continue
+		}
+		perSecond := float64(len(times)) / RateWindow.Seconds()
+		status.Rates = append(status.Rates, Rate{MessageType: messageType, PerSecond: perSecond})
+	}
+	sort.Slice(status.Rates, func(i, j int) bool {
+		return status.Rates[i].MessageType < status.Rates[j].MessageType
+	})
+
+	if len(dashboard.positions) > 0 {
+		last := dashboard.positions[len(dashboard.positions)-1]
+		status.Position = &last
+		status.PositionAt = dashboard.positionAt
+		status.Positions = append([]nmea.Position{}, dashboard.positions...)
+	}
+
+	for _, constellation := range dashboard.constellations {
+		status.Constellations = append(status.Constellations, constellation)
+	}
+	sort.Slice(status.Constellations, func(i, j int) bool {
+		return status.Constellations[i].MessageType < status.Constellations[j].MessageType
+	})
+
+	switch {
+	case len(dashboard.deviceState) > 0:
+		status.Device = dashboard.deviceState
+	case dashboard.lastMessage.IsZero():
+		status.Device = "no messages yet"
+	case now.Sub(dashboard.lastMessage) > SilentAfter:
+		status.Device = "silent"
+	default:
+		status.Device = "receiving"
+	}
+
+	status.Caster = dashboard.casterState
+	if len(status.Caster) == 0 {
+		status.Caster = "unknown"
+	}
+
+	return &status
+}
+
+// ServeHTTP serves the page at / and the figures as JSON at /status.json.
+func (dashboard *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := page.Execute(w, newPageData(dashboard.Status()))
+		if err != nil {
+			eventlog.Printf(dashboard.logger, "dashboard - %v", err)
+		}
+	case "/status.json":
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(dashboard.Status())
+		if err != nil {
+			eventlog.Printf(dashboard.logger, "dashboard - %v", err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Listen starts listening on the address in the config.  It returns an
+// error if the address can't be used, for example because another program
+// is listening on it.
+func (dashboard *Dashboard) Listen() error {
+	listener, listenError := net.Listen("tcp", dashboard.config.ListenAddress)
+	if listenError != nil {
+		em := fmt.Sprintf("dashboard - cannot listen on %s - %v", dashboard.config.ListenAddress, listenError)
+		return errors.New(em)
+	}
+
+	dashboard.mutex.Lock()
+	defer dashboard.mutex.Unlock()
+	dashboard.listener = listener
+	return nil
+}
+
+// Addr returns the address on which the Dashboard is listening, nil if
+// Listen has not been called.
+func (dashboard *Dashboard) Addr() net.Addr {
+	dashboard.mutex.Lock()
+	defer dashboard.mutex.Unlock()
+	if dashboard.listener == nil {
+		return nil
+	}
+	return dashboard.listener.Addr()
+}
+
+// Run serves the page until the stop channel is closed.  If the channel is
+// nil, it runs forever.  Listen must be called first.  It can be run in a
+// goroutine.
+func (dashboard *Dashboard) Run(stop <-chan struct{}) {
+	dashboard.mutex.Lock()
+	listener := dashboard.listener
+	dashboard.mutex.Unlock()
+	if listener == nil {
+		eventlog.Println(dashboard.logger, "dashboard - Run called before Listen")
+		return
+	}
+
+	server := http.Server{Handler: dashboard}
+
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	serveError := server.Serve(listener)
+	if serveError != nil && serveError != http.ErrServerClosed {
+		eventlog.Printf(dashboard.logger, "dashboard - %v", serveError)
+	}
+}
+
+// prune returns the arrival times that are within the rate window.  The
+// times are in order, so it drops them from the front.
+func prune(times []time.Time, now time.Time) []time.Time {
+	start := now.Add(-RateWindow)
+	i := 0
+	for i < len(times) && !times[i].After(start) {
+		i++
+	}
+	return times[i:]
+}
+
+// point is a point on the position plot, in pixels.
+type point struct {
+	X, Y float64
+}
+
+// pageData is what the page template needs.
+type pageData struct {
+	*Status
+
+	// Points are the recent positions on the plot.  The last position is in
+	// the middle.
+	Points []point
+
+	// PlotMetres is the distance in metres from the middle of the plot to
+	// the edge.
+	PlotMetres float64
+
+	// Refresh is the time between refreshes of the page in seconds.
+	Refresh int
+
+	// Size is the width and height of the plot in pixels.
+	Size int
+}
+
+// newPageData returns the data for the page template.  The positions are
+// plotted in metres east and north of the last one, scaled so that the one
+// furthest away is near the edge.
+func newPageData(status *Status) *pageData {
+	data := pageData{Status: status, Refresh: refreshSeconds, Size: plotSize}
+	if status.Position == nil {
+		return &data
+	}
+
+	last := *status.Position
+	cosLatitude := math.Cos(last.Latitude * math.Pi / 180)
+	east := make([]float64, len(status.Positions))
+	north := make([]float64, len(status.Positions))
+	furthest := 0.01 // A centimetre, so that a steady position is a dot.
+	for i, p := range status.Positions {
+		east[i] = (p.Longitude - last.Longitude) * metresPerDegree * cosLatitude
+		north[i] = (p.Latitude - last.Latitude) * metresPerDegree
+		furthest = math.Max(furthest, math.Max(math.Abs(east[i]), math.Abs(north[i])))
+	}
+
+	middle := float64(plotSize) / 2
+	scale := (middle - 10) / furthest
+	for i := range status.Positions {
+		data.Points = append(data.Points, point{X: middle + east[i]*scale, Y: middle - north[i]*scale})
+	}
+	data.PlotMetres = middle / scale
+
+	return &data
+}
+
+// page is the template of the status page.
+var page = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Base station status</title>
+<style>
+body {font-family: sans-serif;}
+table {border-collapse: collapse;}
+td, th {border: 1px solid #ccc; padding: 2px 8px; text-align: right;}
+</style>
+</head>
+<body>
+<h1>Base station status</h1>
+<p>At {{.At.UTC.Format "2006-01-02 15:04:05 MST"}}</p>
+<h2>Connections</h2>
+<table>
+<tr><th>Device</th><td>{{.Device}}</td></tr>
+<tr><th>Caster</th><td>{{.Caster}}</td></tr>
+</table>
+<h2>Message rates</h2>
+{{if .Rates}}<table>
+<tr><th>Type</th><th>Per second</th></tr>
+{{range .Rates}}<tr><td>{{.MessageType}}</td><td>{{printf "%.2f" .PerSecond}}</td></tr>
+{{end}}</table>{{else}}<p>No messages in the last minute.</p>{{end}}
+<h2>Base position</h2>
+{{with .Position}}<p>Latitude {{printf "%.8f" .Latitude}}, longitude {{printf "%.8f" .Longitude}}, height {{printf "%.3f" .Height}} m</p>
+{{else}}<p>No message type 1005 yet.</p>{{end}}
+{{if .Points}}<svg width="{{.Size}}" height="{{.Size}}" style="border: 1px solid #ccc">
+{{range .Points}}<circle cx="{{printf "%.1f" .X}}" cy="{{printf "%.1f" .Y}}" r="2" fill="steelblue"/>
+{{end}}</svg>
+<p>The last {{len .Points}} positions, the latest in the middle, {{printf "%.3f" .PlotMetres}} m to the edge.</p>{{end}}
+<h2>Satellites</h2>
+{{if .Constellations}}<table>
+<tr><th>Constellation</th><th>Message</th><th>Satellites</th><th>Signals</th><th>Signal cells</th></tr>
+{{range .Constellations}}<tr><td>{{.Name}}</td><td>{{.MessageType}}</td><td>{{.Satellites}}</td><td>{{.Signals}}</td><td>{{.SignalCells}}</td></tr>
+{{end}}</table>{{else}}<p>No MSM yet.</p>{{end}}
+</body>
+</html>
+`))
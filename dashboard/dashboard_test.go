@@ -0,0 +1,291 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// newTestDashboard is a helper function.  It returns a Dashboard whose
+// clock is controlled by the test.
+func newTestDashboard(t *testing.T, now *time.Time) *Dashboard {
+	dashboard, err := New(Config{ListenAddress: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dashboard.now = func() time.Time { return *now }
+	return dashboard
+}
+
+// TestNew checks that New checks the config.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"all interfaces", Config{ListenAddress: ":8080"}, ""},
+		{"localhost", Config{ListenAddress: "localhost:8080"}, ""},
+		{"no port", Config{ListenAddress: "localhost"},
+			`dashboard - the listen address "localhost" is not host:port`},
+		{"empty", Config{},
+			`dashboard - the listen address "" is not host:port`},
+	}
+	for _, td := range testData {
+		_, err := New(td.config, nil)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestStatus checks the rates, the position, the constellations and the
+// connection states.
+func TestStatus(t *testing.T) {
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	dashboard := newTestDashboard(t, &now)
+
+	status := dashboard.Status()
+	if status.Device != "no messages yet" || status.Caster != "unknown" {
+		t.Errorf("want no messages yet and unknown, got %q and %q", status.Device, status.Caster)
+	}
+	if status.Position != nil || len(status.Rates) != 0 || len(status.Constellations) != 0 {
+		t.Errorf("want an empty status, got %+v", status)
+	}
+
+	// 30 MSM7s two seconds apart and then two 1005s.  The first of the MSM7s
+	// falls out of the rate window.
+	msm := rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, RawData: testdata.MessageFrameType1077}
+	for i := 0; i < 30; i++ {
+		dashboard.Observe(&msm)
+		now = now.Add(2 * time.Second)
+	}
+	position := rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005}
+	dashboard.Observe(&position)
+	dashboard.Observe(&position)
+	dashboard.Observe(&rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")})
+	dashboard.Observe(nil)
+
+	status = dashboard.Status()
+
+	if len(status.Rates) != 2 {
+		t.Fatalf("want 2 rates got %+v", status.Rates)
+	}
+	if status.Rates[0].MessageType != 1005 || status.Rates[0].PerSecond != 2.0/60 {
+		t.Errorf("unexpected rate %+v", status.Rates[0])
+	}
+	if status.Rates[1].MessageType != 1077 || status.Rates[1].PerSecond != 29.0/60 {
+		t.Errorf("unexpected rate %+v", status.Rates[1])
+	}
+
+	if status.Position == nil || len(status.Positions) != 2 {
+		t.Fatalf("want a position and 2 positions got %+v", status)
+	}
+	if status.Position.Latitude == 0 || status.Position.Longitude == 0 {
+		t.Errorf("unexpected position %+v", *status.Position)
+	}
+
+	wantHeader, _, headerError := header.GetMSMHeader(testdata.MessageFrameType1077, slog.LevelInfo)
+	if headerError != nil {
+		t.Fatal(headerError)
+	}
+	if len(status.Constellations) != 1 {
+		t.Fatalf("want 1 constellation got %+v", status.Constellations)
+	}
+	got := status.Constellations[0]
+	if got.Name != "GPS" || got.MessageType != 1077 ||
+		got.Satellites != len(wantHeader.Satellites) || got.Signals != len(wantHeader.Signals) ||
+		got.SignalCells != wantHeader.NumSignalCells {
+		t.Errorf("unexpected constellation %+v", got)
+	}
+	if got.Satellites == 0 {
+		t.Error("want some satellites")
+	}
+
+	if status.Device != "receiving" {
+		t.Errorf("want receiving got %q", status.Device)
+	}
+	now = now.Add(SilentAfter + time.Second)
+	if got := dashboard.Status().Device; got != "silent" {
+		t.Errorf("want silent got %q", got)
+	}
+
+	dashboard.SetDeviceState("connected to /dev/ttyACM0")
+	dashboard.SetCasterState("connected")
+	status = dashboard.Status()
+	if status.Device != "connected to /dev/ttyACM0" || status.Caster != "connected" {
+		t.Errorf("want the states that were set, got %q and %q", status.Device, status.Caster)
+	}
+
+	// After a minute with nothing, there are no rates.
+	now = now.Add(RateWindow)
+	if rates := dashboard.Status().Rates; len(rates) != 0 {
+		t.Errorf("want no rates got %+v", rates)
+	}
+}
+
+// TestMaxPositions checks that only the recent positions are kept.
+func TestMaxPositions(t *testing.T) {
+	now := time.Now()
+	dashboard := newTestDashboard(t, &now)
+	position := rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005}
+	for i := 0; i < MaxPositions+5; i++ {
+		dashboard.Observe(&position)
+	}
+	if n := len(dashboard.Status().Positions); n != MaxPositions {
+		t.Errorf("want %d positions got %d", MaxPositions, n)
+	}
+}
+
+// TestNewPageData checks that the positions are plotted around the last one.
+func TestNewPageData(t *testing.T) {
+	now := time.Now()
+	dashboard := newTestDashboard(t, &now)
+	position := rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005}
+	dashboard.Observe(&position)
+
+	data := newPageData(dashboard.Status())
+	if len(data.Points) != 1 {
+		t.Fatalf("want 1 point got %d", len(data.Points))
+	}
+	middle := float64(plotSize) / 2
+	if data.Points[0].X != middle || data.Points[0].Y != middle {
+		t.Errorf("want the last position in the middle, got %+v", data.Points[0])
+	}
+
+	// A position a metre north of the last one is at the top edge, less the
+	// margin.
+	status := dashboard.Status()
+	north := *status.Position
+	north.Latitude += 1 / metresPerDegree
+	status.Positions = append(status.Positions[:0], north, *status.Position)
+	data = newPageData(status)
+	if math.Abs(data.Points[0].Y-10) > 1e-6 || data.Points[0].X != middle {
+		t.Errorf("want the position a metre north at the top, got %+v", data.Points[0])
+	}
+	if math.Abs(data.PlotMetres-middle/(middle-10)) > 1e-6 {
+		t.Errorf("unexpected plot size %f", data.PlotMetres)
+	}
+}
+
+// TestServeHTTP checks the page, the JSON and an unknown path.
+func TestServeHTTP(t *testing.T) {
+	now := time.Now()
+	dashboard := newTestDashboard(t, &now)
+	dashboard.Observe(&rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, RawData: testdata.MessageFrameType1077})
+	dashboard.Observe(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+
+	recorder := httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("want status %d got %d", http.StatusOK, recorder.Code)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"<td>1077</td>", "<td>GPS</td>", "<svg", "<circle", "<td>receiving</td>", "<td>unknown</td>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want %q in the page\n%s", want, body)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, httptest.NewRequest("GET", "/status.json", nil))
+	var status Status
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Rates) != 2 || status.Position == nil || len(status.Constellations) != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, httptest.NewRequest("GET", "/other", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("want status %d got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+// TestRun checks that the page is served on the listen address and that Run
+// stops when asked.
+func TestRun(t *testing.T) {
+	dashboard, err := New(Config{ListenAddress: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dashboard.Addr() != nil {
+		t.Error("want no address before Listen")
+	}
+	if err := dashboard.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		dashboard.Run(stop)
+		close(done)
+	}()
+
+	response, getError := http.Get("http://" + dashboard.Addr().String() + "/")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.Contains(string(body), "Base station status") {
+		t.Errorf("page missing from\n%s", string(body))
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Run didn't stop")
+	}
+}
+
+// TestWatchCaster checks that the caster state says whether the caster can
+// be reached.
+func TestWatchCaster(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	now := time.Now()
+	dashboard := newTestDashboard(t, &now)
+	stop := make(chan struct{})
+	close(stop)
+
+	dashboard.WatchCaster(address, time.Hour, stop)
+	if got, want := dashboard.Status().Caster, address+" can be reached"; got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+
+	listener.Close()
+	dashboard.WatchCaster(address, time.Hour, stop)
+	wantPrefix := address + " cannot be reached - "
+	if got := dashboard.Status().Caster; !strings.HasPrefix(got, wantPrefix) {
+		t.Errorf("want %q... got %q", wantPrefix, got)
+	}
+}
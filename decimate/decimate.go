@@ -0,0 +1,142 @@
+// The decimate package thins out a stream of RTCM messages, for example to
+// keep only the observations at 30 second boundaries.  A recording made for
+// Precise Point Positioning (PPP) at one epoch per second is large, and the
+// PPP services are just as happy with one epoch every 30 seconds, which
+// makes a daily file a thirtieth of the size.
+//
+// An epoch is the set of Multiple Signal Messages (MSMs), one for each
+// constellation, that carry the observations made at one instant.  The
+// decimator works on whole epochs, not on the count of messages:  an epoch
+// is kept if its time falls on a boundary of the interval and dropped if
+// not, so the MSMs of an epoch are kept or dropped together and the epochs
+// that are kept stay at the same times from one day to the next.
+//
+// The MSMs of an epoch all carry the same instant, but each constellation
+// gives it in its own time scale.  GPS, Galileo, QZSS, SBAS and NavIC give
+// milliseconds since the start of the GPS week.  Beidou time is a few
+// seconds behind GPS time and GLONASS gives milliseconds since the start of
+// the day in Moscow.  The decimator converts each of them to GPS time, which
+// is the time scale of a RINEX observation file, before looking for the
+// boundary.
+//
+// Messages that are not MSMs, such as the base position in message type 1005,
+// are always kept.
+//
+//	decimator, err := decimate.New(30 * time.Second)
+//	...
+//	if decimator.Keep(&message) {
+//	    // write the message
+//	}
+package decimate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goblimey/go-ntrip/leapseconds"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// millisPerDay is the number of milliseconds in a day.
+const millisPerDay = 24 * 60 * 60 * 1000
+
+// glonassMillisMask extracts the milliseconds since the start of the day
+// from a GLONASS timestamp.  The top three bits are the day of the week.
+const glonassMillisMask = 1<<27 - 1
+
+// moscowOffsetMillis is the time that the Moscow time zone, in which the
+// GLONASS day starts, is ahead of UTC.
+const moscowOffsetMillis = 3 * 60 * 60 * 1000
+
+// Decimator decides which messages to keep.  It holds no state apart from
+// the interval, so it's safe for concurrent use.
+type Decimator struct {
+	// intervalMillis is the time between the epochs that are kept.
+	intervalMillis uint
+}
+
+// New creates a Decimator that keeps the epochs at the boundaries of the
+// given interval in GPS time.  The interval must be a whole number of
+// seconds that divides evenly into a day, such as 1, 5, 15, 30 or 60
+// seconds, so that the boundaries fall at the same times each day.
+func New(interval time.Duration) (*Decimator, error) {
+	if interval <= 0 || interval%time.Second != 0 ||
+		millisPerDay%interval.Milliseconds() != 0 {
+		em := fmt.Sprintf("decimation interval %v - want a whole number of seconds that divides into a day", interval)
+		return nil, errors.New(em)
+	}
+
+	decimator := Decimator{intervalMillis: uint(interval.Milliseconds())}
+	return &decimator, nil
+}
+
+// Interval returns the time between the epochs that are kept.
+func (decimator *Decimator) Interval() time.Duration {
+	return time.Duration(decimator.intervalMillis) * time.Millisecond
+}
+
+// Keep returns true if the message should be kept - if it's not an MSM, or
+// it's an MSM from an epoch on a boundary of the interval.  An MSM from a
+// constellation whose time scale is not known is kept.
+func (decimator *Decimator) Keep(message *rtcm.Message) bool {
+	if !utils.MSM(message.MessageType) {
+		return true
+	}
+
+	millis, ok := GPSMillisOfDay(message.MessageType, message.Timestamp, TimeOf(message))
+	if !ok {
+		return true
+	}
+
+	return millis%decimator.intervalMillis == 0
+}
+
+// TimeOf gives the approximate time in UTC at which a message was sent,
+// which is near enough to find the leap seconds in force:  the time from
+// its timestamp if the handler could work that out, otherwise the time it
+// was received, otherwise now.
+func TimeOf(message *rtcm.Message) time.Time {
+	switch {
+	case !message.SentAt.IsZero():
+		return message.SentAt
+	case !message.ReceivedAt.IsZero():
+		return message.ReceivedAt
+	default:
+		return time.Now()
+	}
+}
+
+// GPSMillisOfDay converts the timestamp of an MSM of the given type to
+// milliseconds since the start of the day in GPS time.  GLONASS keeps UTC,
+// so converting its timestamp needs the number of leap seconds, which is
+// taken from the leapseconds package for the given time, the approximate
+// time in UTC at which the message was sent.  It returns false if the
+// constellation's time scale is not known.
+func GPSMillisOfDay(messageType int, timestamp uint, when time.Time) (uint, bool) {
+	var millis int
+
+	switch utils.GetConstellation(messageType) {
+	case "GPS", "Galileo", "QZSS", "SBAS", "NavIC/IRNSS":
+		// Milliseconds since the start of the GPS week.
+		millis = int(timestamp)
+	case "Beidou":
+		// Milliseconds since the start of the Beidou week, which starts a
+		// few seconds after the GPS week.
+		millis = int(timestamp) + int(leapseconds.BeidouBehindGPS/time.Millisecond)
+	case "Glonass":
+		// Milliseconds since the start of the day in Moscow, in UTC(SU).
+		gpsAheadOfUTC := leapseconds.Default().GPSMinusUTC(when)
+		millis = int(timestamp&glonassMillisMask) - moscowOffsetMillis + int(gpsAheadOfUTC/time.Millisecond)
+	default:
+		return 0, false
+	}
+
+	millis %= millisPerDay
+	if millis < 0 {
+		millis += millisPerDay
+	}
+
+	return uint(millis), true
+}
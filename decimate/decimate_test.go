@@ -0,0 +1,146 @@
+package decimate
+
+import (
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The timestamps of an epoch at 00:00:30 GPS time on the Wednesday of a GPS
+// week, as each constellation gives them.
+const wednesday = 3 * millisPerDay
+const gpsAt30 = wednesday + 30000
+
+// Beidou time is 14 seconds behind GPS time.
+const beidouAt30 = gpsAt30 - 14000
+
+// GLONASS gives the day of the week in the top three bits and the time of
+// day in Moscow below that.  Since the start of 2017 GPS time has been 18
+// seconds ahead of UTC, so 00:00:30 GPS time is 00:00:12 UTC, which is
+// 03:00:12 in Moscow.  During 2016 it was 17 seconds ahead.
+const glonassAt30 = 3<<27 | (3*60*60+12)*1000
+const glonassAt30In2016 = 3<<27 | (3*60*60+13)*1000
+
+// in2023 and in2016 are times at which the epochs above could have been
+// sent, after and before the leap second at the end of 2016.
+var in2023 = time.Date(2023, time.May, 17, 0, 0, 12, 0, time.UTC)
+var in2016 = time.Date(2016, time.May, 18, 0, 0, 13, 0, time.UTC)
+
+// TestNew checks that New accepts only intervals that divide into a day.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		interval time.Duration
+		wantOK   bool
+	}{
+		{time.Second, true},
+		{30 * time.Second, true},
+		{time.Minute, true},
+		{0, false},
+		{-time.Second, false},
+		{1500 * time.Millisecond, false},
+		{7 * time.Second, false},
+	}
+	for _, td := range testData {
+		decimator, err := New(td.interval)
+		if td.wantOK {
+			if err != nil {
+				t.Errorf("%v: %v", td.interval, err)
+			} else if decimator.Interval() != td.interval {
+				t.Errorf("%v: got interval %v", td.interval, decimator.Interval())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: want an error", td.interval)
+		}
+	}
+
+	const wantError = "decimation interval 7s - want a whole number of seconds that divides into a day"
+	_, err := New(7 * time.Second)
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+}
+
+// TestGPSMillisOfDay checks the conversion of each constellation's
+// timestamp to GPS time.
+func TestGPSMillisOfDay(t *testing.T) {
+	var testData = []struct {
+		description string
+		messageType int
+		timestamp   uint
+		when        time.Time
+		want        uint
+		wantOK      bool
+	}{
+		{"GPS", utils.MessageTypeMSM7GPS, gpsAt30, in2023, 30000, true},
+		{"Galileo", utils.MessageTypeMSM4Galileo, gpsAt30, in2023, 30000, true},
+		{"QZSS", utils.MessageTypeMSM7QZSS, gpsAt30, in2023, 30000, true},
+		{"Beidou", utils.MessageTypeMSM7Beidou, beidouAt30, in2023, 30000, true},
+		{"GLONASS", utils.MessageTypeMSM7Glonass, glonassAt30, in2023, 30000, true},
+		{"GLONASS in 2016", utils.MessageTypeMSM7Glonass, glonassAt30In2016, in2016, 30000, true},
+		// Just after midnight Moscow time is late in the previous GPS day.
+		{"GLONASS wraps", utils.MessageTypeMSM7Glonass, 3<<27 | 1000, in2023, millisPerDay - (3*60*60-18-1)*1000, true},
+		{"Beidou end of week", utils.MessageTypeMSM7Beidou, 7*millisPerDay - 14000, in2023, 0, true},
+		{"not an MSM", 1005, 0, in2023, 0, false},
+	}
+	for _, td := range testData {
+		got, ok := GPSMillisOfDay(td.messageType, td.timestamp, td.when)
+		if ok != td.wantOK {
+			t.Errorf("%s: want %v got %v", td.description, td.wantOK, ok)
+			continue
+		}
+		if got != td.want {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+	}
+}
+
+// TestKeep checks that whole epochs are kept or dropped together, and that
+// other messages are always kept.
+func TestKeep(t *testing.T) {
+	decimator, err := New(30 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = []struct {
+		description string
+		message     rtcm.Message
+		want        bool
+	}{
+		{"GPS on the boundary", rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, Timestamp: gpsAt30}, true},
+		{"GLONASS on the boundary", rtcm.Message{MessageType: utils.MessageTypeMSM7Glonass, Timestamp: glonassAt30, SentAt: in2023}, true},
+		{"GLONASS on the boundary in 2016", rtcm.Message{MessageType: utils.MessageTypeMSM7Glonass, Timestamp: glonassAt30In2016, SentAt: in2016}, true},
+		{"Beidou on the boundary", rtcm.Message{MessageType: utils.MessageTypeMSM7Beidou, Timestamp: beidouAt30}, true},
+		{"GPS a second later", rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, Timestamp: gpsAt30 + 1000}, false},
+		{"GLONASS a second later", rtcm.Message{MessageType: utils.MessageTypeMSM7Glonass, Timestamp: glonassAt30 + 1000, SentAt: in2023}, false},
+		{"GLONASS with 2023 leap seconds in 2016", rtcm.Message{MessageType: utils.MessageTypeMSM7Glonass, Timestamp: glonassAt30, SentAt: in2016}, false},
+		{"Beidou a second later", rtcm.Message{MessageType: utils.MessageTypeMSM7Beidou, Timestamp: beidouAt30 + 1000}, false},
+		{"base position", rtcm.Message{MessageType: utils.MessageType1005}, true},
+		{"non-RTCM data", rtcm.Message{MessageType: utils.NonRTCMMessage}, true},
+	}
+	for _, td := range testData {
+		if got := decimator.Keep(&td.message); got != td.want {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
+
+// TestTimeOf checks that the time used to find the leap seconds comes
+// from the message if possible.
+func TestTimeOf(t *testing.T) {
+	received := in2023.Add(time.Second)
+
+	if got := TimeOf(&rtcm.Message{SentAt: in2016, ReceivedAt: received}); !got.Equal(in2016) {
+		t.Errorf("sent: want %v got %v", in2016, got)
+	}
+	if got := TimeOf(&rtcm.Message{ReceivedAt: received}); !got.Equal(received) {
+		t.Errorf("received: want %v got %v", received, got)
+	}
+	if got := TimeOf(&rtcm.Message{}); got.IsZero() {
+		t.Error("neither: want the time now")
+	}
+}
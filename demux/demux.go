@@ -0,0 +1,282 @@
+// The demux package splits a stream of messages aggregated from several base
+// stations into one stream per station, using the 12-bit reference station
+// ID that most RTCM messages carry.  Each station can have its own channel of
+// messages and its own daily recording, and can be mapped to the name of the
+// mountpoint that a caster will publish it on.  The mapping is given in one
+// section of the application's JSON config:
+//
+//	"demux": {
+//	    "stations": [
+//	        {"station_id": 1, "mountpoint": "HOME"},
+//	        {"station_id": 42, "mountpoint": "SHED"}
+//	    ],
+//	    "log_directory": "stations"
+//	}
+//
+// With a log directory, each station's messages are recorded in daily files
+// named after its mountpoint, such as stations/SHED.2024-08-31.rtcm.  A
+// station that's not in the list is recorded under its ID, for example
+// stations/station0007.2024-08-31.rtcm.
+//
+//	demultiplexer, err := demux.New(config, 100)
+//	shed := demultiplexer.Output(42)
+//	go demultiplexer.Run(messages)
+//	for message := range shed { ... }
+//
+// Messages that have no station ID, such as the ephemerides, describe the
+// satellites rather than a station, so they are sent to every station seen
+// so far.  Non-RTCM data is dropped.
+package demux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/goblimey/go-ntrip/logrotate"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// maxStationID is the largest station ID, the largest 12-bit value.
+const maxStationID = 4095
+
+// Station maps a station ID to a mountpoint.
+type Station struct {
+	// ID is the reference station ID in the messages, 0-4095.
+	ID uint `json:"station_id"`
+
+	// Mountpoint is the name of the mountpoint, for example "MYBASE".
+	Mountpoint string `json:"mountpoint"`
+}
+
+// Config holds the mapping of stations to mountpoints and the log settings.
+type Config struct {
+	// Stations maps station IDs to mountpoints.  It can be empty.
+	Stations []Station `json:"stations"`
+
+	// LogDirectory, if set, is the directory in which each station's
+	// messages are recorded.
+	LogDirectory string `json:"log_directory"`
+}
+
+// Validate checks the config.  No station may be given twice, each must
+// have a legal mountpoint and no two stations may share a mountpoint.
+func (config *Config) Validate() error {
+	if config == nil {
+		return nil
+	}
+
+	ids := make(map[uint]bool)
+	mountpoints := make(map[string]uint)
+	for _, station := range config.Stations {
+		if station.ID > maxStationID {
+			em := fmt.Sprintf("demux - illegal station ID %d", station.ID)
+			return errors.New(em)
+		}
+		if ids[station.ID] {
+			em := fmt.Sprintf("demux - station %d is given more than once", station.ID)
+			return errors.New(em)
+		}
+		ids[station.ID] = true
+
+		if len(station.Mountpoint) == 0 {
+			em := fmt.Sprintf("demux - station %d - want a mountpoint", station.ID)
+			return errors.New(em)
+		}
+		if strings.ContainsAny(station.Mountpoint, "/?&= ") {
+			em := fmt.Sprintf("demux - station %d - illegal mountpoint %q", station.ID, station.Mountpoint)
+			return errors.New(em)
+		}
+		other, taken := mountpoints[station.Mountpoint]
+		if taken {
+			em := fmt.Sprintf("demux - stations %d and %d are both sent to mountpoint %s",
+				other, station.ID, station.Mountpoint)
+			return errors.New(em)
+		}
+		mountpoints[station.Mountpoint] = station.ID
+	}
+
+	return nil
+}
+
+// Mountpoint returns the mountpoint of the station, "" if it has none.
+func (config *Config) Mountpoint(stationID uint) string {
+	if config == nil {
+		return ""
+	}
+	for _, station := range config.Stations {
+		if station.ID == stationID {
+			return station.Mountpoint
+		}
+	}
+	return ""
+}
+
+// Name returns the name by which a station is known - its mountpoint if it
+// has one, otherwise "station" and its ID, for example "station0007".
+func (config *Config) Name(stationID uint) string {
+	mountpoint := config.Mountpoint(stationID)
+	if len(mountpoint) > 0 {
+		return mountpoint
+	}
+	return fmt.Sprintf("station%04d", stationID)
+}
+
+// Demultiplexer sends each message to the channel and the log of the
+// station that it came from.
+type Demultiplexer struct {
+	// config holds the mapping and the log settings.
+	config *Config
+
+	// capacity is the capacity of each output channel.
+	capacity int
+
+	// mutex protects the maps and the list.
+	mutex sync.Mutex
+
+	// outputs holds the output channels, keyed by station ID.
+	outputs map[uint]chan rtcm.Message
+
+	// logs holds the station logs, keyed by station ID.
+	logs map[uint]io.WriteCloser
+
+	// seen lists the IDs of the stations seen so far, in the order in which
+	// they were seen.
+	seen []uint
+
+	// newLog creates the log of a station.  It's replaced in tests.
+	newLog func(name string) io.WriteCloser
+}
+
+// New creates a Demultiplexer.  Its output channels have the given capacity.
+// It returns an error if the config is not valid.
+func New(config *Config, capacity int) (*Demultiplexer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	demultiplexer := Demultiplexer{
+		config:   config,
+		capacity: capacity,
+		outputs:  make(map[uint]chan rtcm.Message),
+		logs:     make(map[uint]io.WriteCloser),
+		seen:     make([]uint, 0),
+	}
+
+	if len(config.LogDirectory) > 0 {
+		demultiplexer.newLog = func(name string) io.WriteCloser {
+			return logrotate.New(config.LogDirectory, name+".", ".rtcm")
+		}
+	}
+
+	return &demultiplexer, nil
+}
+
+// Output returns the channel that receives the messages from the station,
+// creating it if necessary.  It should be called before Run, otherwise any
+// messages that arrive before it's called are not sent to the channel.  The
+// channel is closed when Run finishes.  The consumer must keep reading it,
+// because Run waits until each message has been taken.
+func (demultiplexer *Demultiplexer) Output(stationID uint) <-chan rtcm.Message {
+	demultiplexer.mutex.Lock()
+	defer demultiplexer.mutex.Unlock()
+
+	ch, ok := demultiplexer.outputs[stationID]
+	if !ok {
+		ch = make(chan rtcm.Message, demultiplexer.capacity)
+		demultiplexer.outputs[stationID] = ch
+	}
+	return ch
+}
+
+// Stations returns the IDs of the stations seen so far, in numerical order.
+func (demultiplexer *Demultiplexer) Stations() []uint {
+	demultiplexer.mutex.Lock()
+	defer demultiplexer.mutex.Unlock()
+
+	stations := make([]uint, len(demultiplexer.seen))
+	copy(stations, demultiplexer.seen)
+	sort.Slice(stations, func(i, j int) bool { return stations[i] < stations[j] })
+	return stations
+}
+
+// Run reads the messages from the channel and sends each one on to its
+// station, until the channel is closed.  Then it closes the output channels
+// and the logs.  It can be run in a go routine.
+func (demultiplexer *Demultiplexer) Run(in <-chan rtcm.Message) {
+	for message := range in {
+		demultiplexer.route(&message)
+	}
+
+	demultiplexer.mutex.Lock()
+	defer demultiplexer.mutex.Unlock()
+	for _, ch := range demultiplexer.outputs {
+		close(ch)
+	}
+	for _, log := range demultiplexer.logs {
+		log.Close()
+	}
+}
+
+// route sends a message to its station, or to every station seen so far if
+// it has no station ID.
+func (demultiplexer *Demultiplexer) route(message *rtcm.Message) {
+	if message.MessageType == utils.NonRTCMMessage || message.MessageType == utils.NMEAMessage {
+		return
+	}
+
+	stationID, ok := utils.GetStationID(message.MessageType, message.RawData)
+	if !ok {
+		for _, id := range demultiplexer.Stations() {
+			demultiplexer.send(id, message)
+		}
+		return
+	}
+
+	demultiplexer.see(stationID)
+	demultiplexer.send(stationID, message)
+}
+
+// see records that a station has been seen and, if there is a log
+// directory, creates its log the first time.
+func (demultiplexer *Demultiplexer) see(stationID uint) {
+	demultiplexer.mutex.Lock()
+	defer demultiplexer.mutex.Unlock()
+
+	for _, id := range demultiplexer.seen {
+		if id == stationID {
+			return
+		}
+	}
+	demultiplexer.seen = append(demultiplexer.seen, stationID)
+
+	if demultiplexer.newLog != nil {
+		demultiplexer.logs[stationID] =
+			demultiplexer.newLog(demultiplexer.config.Name(stationID))
+	}
+}
+
+// send sends a message to the station's channel, if it has one, and writes
+// it to the station's log, if it has one.
+func (demultiplexer *Demultiplexer) send(stationID uint, message *rtcm.Message) {
+	demultiplexer.mutex.Lock()
+	ch := demultiplexer.outputs[stationID]
+	log := demultiplexer.logs[stationID]
+	demultiplexer.mutex.Unlock()
+
+	if log != nil {
+		// A failed write, for example because the disk is full, is
+		// ignored so that the other stations carry on.
+		log.Write(message.RawData)
+	}
+	if ch != nil {
+		ch <- *message
+	}
+}
@@ -0,0 +1,198 @@
+package demux
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestValidate checks that Validate finds the mistakes in the config.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      *Config
+		want        string
+	}{
+		{"nil", nil, ""},
+		{"empty", &Config{}, ""},
+		{
+			"valid",
+			&Config{Stations: []Station{{ID: 1, Mountpoint: "HOME"}, {ID: 4095, Mountpoint: "SHED"}}},
+			"",
+		},
+		{
+			"illegal ID",
+			&Config{Stations: []Station{{ID: 4096, Mountpoint: "HOME"}}},
+			"demux - illegal station ID 4096",
+		},
+		{
+			"ID given twice",
+			&Config{Stations: []Station{{ID: 1, Mountpoint: "A"}, {ID: 1, Mountpoint: "B"}}},
+			"demux - station 1 is given more than once",
+		},
+		{
+			"no mountpoint",
+			&Config{Stations: []Station{{ID: 1}}},
+			"demux - station 1 - want a mountpoint",
+		},
+		{
+			"illegal mountpoint",
+			&Config{Stations: []Station{{ID: 1, Mountpoint: "HO ME"}}},
+			`demux - station 1 - illegal mountpoint "HO ME"`,
+		},
+		{
+			"collision",
+			&Config{Stations: []Station{{ID: 1, Mountpoint: "A"}, {ID: 2, Mountpoint: "B"}, {ID: 3, Mountpoint: "A"}}},
+			"demux - stations 1 and 3 are both sent to mountpoint A",
+		},
+	}
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want %q got %v", td.description, td.want, err)
+		}
+	}
+
+	if _, err := New(&Config{Stations: []Station{{ID: 1}}}, 0); err == nil {
+		t.Error("want New to reject a bad config")
+	}
+}
+
+// TestName checks the names of the stations.
+func TestName(t *testing.T) {
+	config := &Config{Stations: []Station{{ID: 42, Mountpoint: "SHED"}}}
+	if got := config.Name(42); got != "SHED" {
+		t.Errorf("want SHED got %s", got)
+	}
+	if got := config.Name(7); got != "station0007" {
+		t.Errorf("want station0007 got %s", got)
+	}
+	var nilConfig *Config
+	if got := nilConfig.Mountpoint(42); got != "" {
+		t.Errorf("want no mountpoint got %s", got)
+	}
+}
+
+// message is a helper function.  It returns a message of the given type
+// from the given station.
+func message(messageType int, stationID uint) rtcm.Message {
+	frame := utils.NewFrame(24)
+	utils.SetBits(frame, utils.LeaderLengthBits, 12, uint64(messageType))
+	utils.SetBits(frame, utils.LeaderLengthBits+12, 12, uint64(stationID))
+	utils.SetCRC(frame)
+	return rtcm.Message{MessageType: messageType, RawData: frame}
+}
+
+// testLog is a station log that records what's written to it.
+type testLog struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (log *testLog) Close() error {
+	log.closed = true
+	return nil
+}
+
+// TestRun checks that the messages are sent to the right stations.
+func TestRun(t *testing.T) {
+	config := &Config{Stations: []Station{{ID: 1, Mountpoint: "HOME"}, {ID: 42, Mountpoint: "SHED"}}}
+	demultiplexer, err := New(config, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := make(map[string]*testLog)
+	demultiplexer.newLog = func(name string) io.WriteCloser {
+		logs[name] = &testLog{}
+		return logs[name]
+	}
+
+	home := demultiplexer.Output(1)
+	shed := demultiplexer.Output(42)
+
+	// The ephemeris comes before any station is seen, so it goes nowhere.
+	// The second goes to both stations seen by then.
+	input := []rtcm.Message{
+		message(utils.MessageType1019, 0),
+		message(utils.MessageType1005, 1),
+		message(utils.MessageTypeMSM7GPS, 42),
+		{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")},
+		message(utils.MessageType1019, 0),
+		message(utils.MessageTypeMSM7GPS, 7),
+		message(utils.MessageTypeMSM4GPS, 1),
+	}
+	in := make(chan rtcm.Message)
+	go func() {
+		for _, m := range input {
+			in <- m
+		}
+		close(in)
+	}()
+	demultiplexer.Run(in)
+
+	checkChannel := func(name string, ch <-chan rtcm.Message, want []int) {
+		got := make([]int, 0)
+		for m := range ch {
+			got = append(got, m.MessageType)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: want %v got %v", name, want, got)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: want %v got %v", name, want, got)
+				return
+			}
+		}
+	}
+	checkChannel("HOME", home, []int{1005, 1019, 1074})
+	checkChannel("SHED", shed, []int{1077, 1019})
+
+	// Station 7 has no channel but it has a log.
+	wantLogs := map[string][]byte{
+		"HOME":        concat(input[1], input[4], input[6]),
+		"SHED":        concat(input[2], input[4]),
+		"station0007": concat(input[5]),
+	}
+	if len(logs) != len(wantLogs) {
+		t.Errorf("want %d logs got %d", len(wantLogs), len(logs))
+	}
+	for name, want := range wantLogs {
+		log, ok := logs[name]
+		if !ok {
+			t.Errorf("no log %s", name)
+			continue
+		}
+		if !bytes.Equal(want, log.Bytes()) {
+			t.Errorf("%s: want %x got %x", name, want, log.Bytes())
+		}
+		if !log.closed {
+			t.Errorf("%s: want the log to be closed", name)
+		}
+	}
+
+	stations := demultiplexer.Stations()
+	if len(stations) != 3 || stations[0] != 1 || stations[1] != 7 || stations[2] != 42 {
+		t.Errorf("want stations [1 7 42] got %v", stations)
+	}
+}
+
+// concat is a helper function.  It returns the raw data of the messages
+// one after the other.
+func concat(messages ...rtcm.Message) []byte {
+	var result []byte
+	for _, m := range messages {
+		result = append(result, m.RawData...)
+	}
+	return result
+}
@@ -0,0 +1,266 @@
+// The epoch package gathers the Multiple Signal Messages (MSMs) of each
+// epoch into one Epoch.  An epoch is the set of MSMs, typically one for
+// each constellation, that carry the observations made by a base station
+// at one instant.  A RINEX writer, the statistics and a check on the
+// completeness of the stream all work on epochs rather than on single
+// messages.
+//
+// The MSMs of an epoch all carry the same instant, but each constellation
+// gives it in its own time scale, so the instant is converted to
+// milliseconds of the day in GPS time for comparison - see
+// decimate.GPSMillisOfDay.  MSMs from different stations, for example in a
+// stream from a caster that merges several, are in different epochs.
+//
+// The header of each MSM has a multiple message flag, which is set in all
+// but the last MSM of the epoch.  An epoch is complete when an MSM with the
+// flag clear arrives.  If that MSM is lost, the epoch is given up on after
+// a timeout, a little longer than the time between epochs, and is passed
+// on marked as incomplete.  Messages that are not MSMs are ignored.
+//
+//	in := make(chan rtcm.Message)
+//	go epoch.Run(in, 1500*time.Millisecond, func(e epoch.Epoch) { ... })
+package epoch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/decimate"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// multipleMessagePosition is the position in an MSM frame, including the
+// leader, of the multiple message flag.
+const multipleMessagePosition = utils.LeaderLengthBits + header.LenMessageType +
+	header.LenStationID + header.LenTimeStamp
+
+// minimumTick is the shortest time between checks for epochs that have
+// timed out.
+const minimumTick = time.Millisecond
+
+// Epoch is the set of MSMs that carry the observations of one station at
+// one instant.
+type Epoch struct {
+	// StationID is the reference station ID from the MSMs.
+	StationID uint
+
+	// GPSMillisOfDay is the instant of the epoch in milliseconds since the
+	// start of the day in GPS time.  For an epoch of a constellation whose
+	// time scale isn't known it's the timestamp of the MSMs.
+	GPSMillisOfDay uint
+
+	// Time is the instant of the epoch in UTC, taken from the first MSM
+	// whose timestamp could be converted.  It's zero if none could.
+	Time time.Time
+
+	// Messages holds the MSMs in order of arrival.
+	Messages []rtcm.Message
+
+	// Complete is true if the last MSM of the epoch arrived, false if the
+	// epoch timed out or the input ended before it did.
+	Complete bool
+}
+
+// MessageTypes returns the types of the MSMs in order of arrival.
+func (epoch *Epoch) MessageTypes() []int {
+	types := make([]int, 0, len(epoch.Messages))
+	for i := range epoch.Messages {
+		types = append(types, epoch.Messages[i].MessageType)
+	}
+	return types
+}
+
+// String returns a one-line summary of the epoch, for example
+// "station 0 12:34:56.000 1077,1087,1097 complete".
+func (epoch *Epoch) String() string {
+	types := make([]string, 0, len(epoch.Messages))
+	for _, messageType := range epoch.MessageTypes() {
+		types = append(types, fmt.Sprint(messageType))
+	}
+	state := "complete"
+	if !epoch.Complete {
+		state = "incomplete"
+	}
+	when := fmt.Sprintf("GPS millis of day %d", epoch.GPSMillisOfDay)
+	if !epoch.Time.IsZero() {
+		when = epoch.Time.UTC().Format("15:04:05.000")
+	}
+	return fmt.Sprintf("station %d %s %s %s",
+		epoch.StationID, when, strings.Join(types, ","), state)
+}
+
+// key identifies the epoch to which an MSM belongs.  For a constellation
+// whose time scale isn't known, the constellation is part of the key, since
+// the timestamp can't be compared with those of other constellations.
+type key struct {
+	stationID     uint
+	millis        uint
+	constellation string
+}
+
+// openEpoch is an epoch that's still being gathered.
+type openEpoch struct {
+	key     key
+	epoch   Epoch
+	started time.Time
+}
+
+// Assembler gathers the MSMs into epochs.  It's not safe for concurrent
+// use - see Run.
+type Assembler struct {
+	// Timeout is the time after the first MSM of an epoch arrives after
+	// which the epoch is given up on.
+	Timeout time.Duration
+
+	// open holds the epochs that are still being gathered, oldest first.
+	open []*openEpoch
+}
+
+// New creates an Assembler with the given timeout.
+func New(timeout time.Duration) *Assembler {
+	assembler := Assembler{Timeout: timeout}
+	return &assembler
+}
+
+// Len returns the number of epochs still being gathered.
+func (assembler *Assembler) Len() int {
+	return len(assembler.open)
+}
+
+// Add adds a message that arrived at the given time.  If it's the last MSM
+// of its epoch, it returns the epoch, complete.  Otherwise it returns nil.
+// A message that's not an MSM is ignored.
+func (assembler *Assembler) Add(message rtcm.Message, arrival time.Time) *Epoch {
+	if !utils.MSM(message.MessageType) {
+		return nil
+	}
+
+	k := keyOf(&message)
+	var open *openEpoch
+	for _, candidate := range assembler.open {
+		if candidate.key == k {
+			open = candidate
+			break
+		}
+	}
+	if open == nil {
+		open = &openEpoch{
+			key:     k,
+			epoch:   Epoch{StationID: k.stationID, GPSMillisOfDay: k.millis},
+			started: arrival,
+		}
+		assembler.open = append(assembler.open, open)
+	}
+
+	open.epoch.Messages = append(open.epoch.Messages, message)
+	if open.epoch.Time.IsZero() && !message.SentAt.IsZero() {
+		open.epoch.Time = message.SentAt
+	}
+
+	if moreToCome(&message) {
+		return nil
+	}
+
+	assembler.remove(open)
+	open.epoch.Complete = true
+	return &open.epoch
+}
+
+// Expire removes the epochs that have timed out at the given time and
+// returns them, oldest first, marked as incomplete.
+func (assembler *Assembler) Expire(now time.Time) []Epoch {
+	var expired []Epoch
+	remaining := assembler.open[:0]
+	for _, open := range assembler.open {
+		if now.Sub(open.started) >= assembler.Timeout {
+			expired = append(expired, open.epoch)
+		} else {
+			remaining = append(remaining, open)
+		}
+	}
+	assembler.open = remaining
+	return expired
+}
+
+// Flush removes all the epochs still being gathered and returns them,
+// oldest first, marked as incomplete.
+func (assembler *Assembler) Flush() []Epoch {
+	var flushed []Epoch
+	for _, open := range assembler.open {
+		flushed = append(flushed, open.epoch)
+	}
+	assembler.open = nil
+	return flushed
+}
+
+// remove removes an epoch from the ones still being gathered.
+func (assembler *Assembler) remove(target *openEpoch) {
+	for i, open := range assembler.open {
+		if open == target {
+			assembler.open = append(assembler.open[:i], assembler.open[i+1:]...)
+			return
+		}
+	}
+}
+
+// Run reads messages from the channel, gathers the MSMs into epochs with
+// the given timeout and calls emit with each epoch when it's complete or
+// has timed out.  When the channel is closed it emits the epochs still
+// being gathered and returns.  It can be run in a go routine.
+func Run(in <-chan rtcm.Message, timeout time.Duration, emit func(Epoch)) {
+	assembler := New(timeout)
+
+	tick := timeout / 4
+	if tick < minimumTick {
+		tick = minimumTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, more := <-in:
+			if !more {
+				for _, e := range assembler.Flush() {
+					emit(e)
+				}
+				return
+			}
+			if e := assembler.Add(message, time.Now()); e != nil {
+				emit(*e)
+			}
+		case now := <-ticker.C:
+			for _, e := range assembler.Expire(now) {
+				emit(e)
+			}
+		}
+	}
+}
+
+// keyOf returns the key of the epoch to which an MSM belongs.
+func keyOf(message *rtcm.Message) key {
+	stationID, _ := utils.GetStationID(message.MessageType, message.RawData)
+	millis, ok := decimate.GPSMillisOfDay(message.MessageType, message.Timestamp, decimate.TimeOf(message))
+	if !ok {
+		return key{
+			stationID:     stationID,
+			millis:        message.Timestamp,
+			constellation: utils.GetConstellation(message.MessageType),
+		}
+	}
+	return key{stationID: stationID, millis: millis}
+}
+
+// moreToCome returns true if the multiple message flag of an MSM is set,
+// meaning that more MSMs of the epoch follow.  If the frame is too short to
+// hold the flag, it's taken to be set, so the epoch is only passed on when
+// it times out.
+func moreToCome(message *rtcm.Message) bool {
+	if len(message.RawData)*8 <= multipleMessagePosition {
+		return true
+	}
+	return utils.GetBitsAsUint64(message.RawData, multipleMessagePosition, 1) == 1
+}
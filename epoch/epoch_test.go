@@ -0,0 +1,157 @@
+package epoch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// msm is a helper function.  It returns an MSM of the given type from the
+// given station with the given timestamp and multiple message flag.  The
+// frame holds just enough of the header for the Assembler.
+func msm(messageType int, stationID uint, timestamp uint, more bool) rtcm.Message {
+	frame := utils.NewFrame(header.LenMessageType + header.LenStationID + header.LenTimeStamp + 1)
+	pos := utils.SetBits(frame, utils.LeaderLengthBits, header.LenMessageType, uint64(messageType))
+	pos = utils.SetBits(frame, pos, header.LenStationID, uint64(stationID))
+	pos = utils.SetBits(frame, pos, header.LenTimeStamp, uint64(timestamp))
+	utils.SetFlag(frame, pos, more)
+	utils.SetCRC(frame)
+	return rtcm.Message{MessageType: messageType, Timestamp: timestamp, RawData: frame}
+}
+
+// The timestamps of one instant in the time scales of GPS, Galileo,
+// Beidou and GLONASS.  It's 12:00:00 GPS time on a Monday.  Beidou time is
+// 14 seconds behind GPS time.  The GLONASS timestamp is the day of the week
+// in the top three bits and the milliseconds of the day in Moscow, which is
+// the time of day in UTC, 18 seconds behind GPS time since 2017, plus three
+// hours.
+const (
+	gpsTimestamp     = (24 + 12) * 3600 * 1000
+	beidouTimestamp  = gpsTimestamp - 14000
+	glonassTimestamp = 1<<27 | ((12+3)*3600*1000 - 18*1000)
+)
+
+// TestAdd checks that the MSMs of one instant from different
+// constellations make one epoch, complete when the last one arrives.
+func TestAdd(t *testing.T) {
+	assembler := New(time.Second)
+	start := time.Now()
+
+	messages := []rtcm.Message{
+		msm(1077, 0, gpsTimestamp, true),
+		msm(1087, 0, glonassTimestamp, true),
+		msm(1097, 0, gpsTimestamp, true),
+		// A message that's not an MSM is ignored.
+		{MessageType: 1005},
+	}
+	for _, message := range messages {
+		if got := assembler.Add(message, start); got != nil {
+			t.Fatalf("message %d: want no epoch got %s", message.MessageType, got.String())
+		}
+	}
+	if assembler.Len() != 1 {
+		t.Errorf("want 1 epoch open got %d", assembler.Len())
+	}
+
+	got := assembler.Add(msm(1127, 0, beidouTimestamp, false), start)
+	if got == nil {
+		t.Fatal("want an epoch got nil")
+	}
+	want := []int{1077, 1087, 1097, 1127}
+	if !cmp.Equal(want, got.MessageTypes()) {
+		t.Error(cmp.Diff(want, got.MessageTypes()))
+	}
+	if !got.Complete || got.GPSMillisOfDay != 12*3600*1000 {
+		t.Errorf("want complete at 12:00 got %v %d", got.Complete, got.GPSMillisOfDay)
+	}
+	if assembler.Len() != 0 {
+		t.Errorf("want no epochs open got %d", assembler.Len())
+	}
+}
+
+// TestSeparateEpochs checks that MSMs of different instants or from
+// different stations go in different epochs.
+func TestSeparateEpochs(t *testing.T) {
+	assembler := New(time.Second)
+	start := time.Now()
+
+	assembler.Add(msm(1077, 1, gpsTimestamp, true), start)
+	assembler.Add(msm(1077, 2, gpsTimestamp, true), start)
+	assembler.Add(msm(1077, 1, gpsTimestamp+1000, true), start)
+	if assembler.Len() != 3 {
+		t.Errorf("want 3 epochs open got %d", assembler.Len())
+	}
+
+	got := assembler.Add(msm(1087, 2, glonassTimestamp, false), start)
+	if got == nil || got.StationID != 2 || len(got.Messages) != 2 {
+		t.Errorf("want the epoch of station 2 with 2 messages got %v", got)
+	}
+}
+
+// TestExpire checks that an epoch whose last MSM is lost is passed on when
+// it times out, marked as incomplete.
+func TestExpire(t *testing.T) {
+	assembler := New(time.Second)
+	start := time.Now()
+
+	assembler.Add(msm(1077, 0, gpsTimestamp, true), start)
+	assembler.Add(msm(1077, 0, gpsTimestamp+1000, true), start.Add(time.Second))
+
+	if got := assembler.Expire(start.Add(999 * time.Millisecond)); len(got) != 0 {
+		t.Errorf("want nothing expired got %d epochs", len(got))
+	}
+
+	got := assembler.Expire(start.Add(time.Second))
+	if len(got) != 1 || got[0].Complete || got[0].GPSMillisOfDay != 12*3600*1000 {
+		t.Fatalf("want the first epoch incomplete got %v", got)
+	}
+
+	flushed := assembler.Flush()
+	if len(flushed) != 1 || flushed[0].GPSMillisOfDay != 12*3600*1000+1000 {
+		t.Errorf("want the second epoch flushed got %v", flushed)
+	}
+}
+
+// TestRun checks that Run emits the epochs and, when the input ends, the
+// ones still being gathered.
+func TestRun(t *testing.T) {
+	in := make(chan rtcm.Message)
+	var got []string
+	done := make(chan struct{})
+	go func() {
+		Run(in, time.Hour, func(e Epoch) { got = append(got, e.String()) })
+		close(done)
+	}()
+
+	in <- msm(1077, 0, gpsTimestamp, true)
+	in <- msm(1097, 0, gpsTimestamp, false)
+	in <- msm(1077, 0, gpsTimestamp+1000, true)
+	close(in)
+	<-done
+
+	want := []string{
+		"station 0 GPS millis of day 43200000 1077,1097 complete",
+		"station 0 GPS millis of day 43201000 1077 incomplete",
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestString checks the summary of an epoch with a time.
+func TestString(t *testing.T) {
+	epoch := Epoch{
+		Time:     time.Date(2023, time.May, 15, 11, 59, 42, 0, time.UTC),
+		Messages: []rtcm.Message{{MessageType: 1077}, {MessageType: 1087}},
+		Complete: true,
+	}
+	const want = "station 0 11:59:42.000 1077,1087 complete"
+	if got := epoch.String(); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
@@ -0,0 +1,23 @@
+// The eventlog package writes entries to an event log that may not be there.
+// Most go-ntrip packages take a *log.Logger for their event log and accept
+// nil to mean that there isn't one.  Println and Printf do nothing when
+// given nil, so those packages don't need to check:
+//
+//	eventlog.Printf(server.logger, "client %s - connected", address)
+package eventlog
+
+import "log"
+
+// Println writes an entry to the logger, if there is one.
+func Println(logger *log.Logger, entry string) {
+	if logger != nil {
+		logger.Println(entry)
+	}
+}
+
+// Printf writes a formatted entry to the logger, if there is one.
+func Printf(logger *log.Logger, format string, args ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,31 @@
+package eventlog
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+// TestPrintln checks that Println writes to a logger and ignores nil.
+func TestPrintln(t *testing.T) {
+	var buffer bytes.Buffer
+	Println(log.New(&buffer, "", 0), "an entry")
+	if buffer.String() != "an entry\n" {
+		t.Errorf("want an entry got %q", buffer.String())
+	}
+
+	// This should do nothing.
+	Println(nil, "an entry")
+}
+
+// TestPrintf checks that Printf writes to a logger and ignores nil.
+func TestPrintf(t *testing.T) {
+	var buffer bytes.Buffer
+	Printf(log.New(&buffer, "", 0), "entry %d", 2)
+	if buffer.String() != "entry 2\n" {
+		t.Errorf("want entry 2 got %q", buffer.String())
+	}
+
+	// This should do nothing.
+	Printf(nil, "entry %d", 2)
+}
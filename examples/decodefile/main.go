@@ -0,0 +1,55 @@
+// decodefile reads a file of RTCM3 data, for example one written by
+// rtcmlogger, and writes a readable version of each message to standard
+// output.  It's about the smallest useful program that can be built on the
+// RTCM handler:
+//
+//	go run ./examples/decodefile data.rtcm 2023-05-18
+//
+// The date is any date in the week in which the data was collected.  The
+// handler needs it to make sense of the timestamps in the messages.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		log.Fatalf("usage: %s file yyyy-mm-dd", os.Args[0])
+	}
+
+	startTime, timeError := time.Parse("2006-01-02", os.Args[2])
+	if timeError != nil {
+		log.Fatal(timeError)
+	}
+
+	file, openError := os.Open(os.Args[1])
+	if openError != nil {
+		log.Fatal(openError)
+	}
+	defer file.Close()
+
+	decode(file, os.Stdout, startTime)
+}
+
+// decode reads RTCM data from the reader until end of file and writes a
+// readable version of each message to the writer.
+func decode(reader io.Reader, writer io.Writer, startTime time.Time) {
+
+	// The scanner returns the messages one at a time, including any
+	// non-RTCM data between them, and io.EOF at the end of the input.
+	scanner := rtcm.NewScannerAt(reader, startTime)
+	for {
+		message, err := scanner.Next()
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(writer, message.String())
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// TestDecode checks that decode produces a readable version of the input.
+func TestDecode(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.AllJunk...)
+	input = append(input, testdata.MessageFrameType1005...)
+
+	var output bytes.Buffer
+	decode(bytes.NewReader(input), &output, testdata.UTCTimeOfMessageFrameType1077)
+
+	got := output.String()
+
+	for _, want := range []string{
+		"Message type -1, Non-RTCM data",
+		"Message type 1005, Stationary RTK Reference Station Antenna Reference Point (ARP)",
+		"ECEF coords in metres",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in the output, got\n%s", want, got)
+		}
+	}
+}
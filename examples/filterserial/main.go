@@ -0,0 +1,90 @@
+// filterserial reads data from a GNSS device on a serial port and writes
+// the RTCM3 messages of the chosen types to standard output, dropping
+// everything else, including any NMEA or UBX messages that the device
+// sends on the same port:
+//
+//	go run ./examples/filterserial -port /dev/ttyACM0 -types 1005,1077,1087
+//
+// With no -types option it passes all RTCM messages.  The serial_usb_grabber
+// and rtcmfilter applications do the same job with more configuration and
+// more care about devices that disappear and reappear.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+
+	"go.bug.st/serial"
+)
+
+func main() {
+	var portName string
+	var speed int
+	var typeList string
+	flag.StringVar(&portName, "port", "/dev/ttyACM0", "serial port")
+	flag.IntVar(&speed, "speed", 115200, "line speed in bits per second")
+	flag.StringVar(&typeList, "types", "", "comma-separated list of message types (default: all)")
+	flag.Parse()
+
+	wanted, typeError := parseTypes(typeList)
+	if typeError != nil {
+		log.Fatal(typeError)
+	}
+
+	port, openError := serial.Open(portName, &serial.Mode{BaudRate: speed})
+	if openError != nil {
+		log.Fatal(openError)
+	}
+	defer port.Close()
+
+	filter(port, os.Stdout, wanted, time.Now())
+}
+
+// parseTypes converts a list of message types such as "1005,1077" to a
+// set.  An empty list gives an empty set.
+func parseTypes(list string) (map[int]bool, error) {
+	wanted := make(map[int]bool)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		messageType, err := strconv.Atoi(field)
+		if err != nil {
+			em := fmt.Sprintf("illegal message type %q", field)
+			return nil, errors.New(em)
+		}
+		wanted[messageType] = true
+	}
+	return wanted, nil
+}
+
+// filter reads RTCM data from the reader until end of file and writes the
+// messages of the wanted types to the writer.  If wanted is empty, it
+// writes all RTCM messages.  Non-RTCM data is always dropped.
+func filter(reader io.Reader, writer io.Writer, wanted map[int]bool, startTime time.Time) {
+	scanner := rtcm.NewScannerAt(reader, startTime)
+	for {
+		message, err := scanner.Next()
+		if err != nil {
+			return
+		}
+		if message.MessageType == utils.NonRTCMMessage {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[message.MessageType] {
+			continue
+		}
+		writer.Write(message.RawData)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestParseTypes checks that parseTypes handles good and bad lists.
+func TestParseTypes(t *testing.T) {
+	var testData = []struct {
+		description string
+		list        string
+		want        map[int]bool
+		wantError   string
+	}{
+		{"empty", "", map[int]bool{}, ""},
+		{"two", "1005, 1077", map[int]bool{1005: true, 1077: true}, ""},
+		{"bad", "1005,x", nil, `illegal message type "x"`},
+	}
+	for _, td := range testData {
+		got, err := parseTypes(td.list)
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestFilter checks that filter passes only RTCM messages of the wanted types.
+func TestFilter(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.AllJunk...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	var bothTypes []byte
+	bothTypes = append(bothTypes, testdata.MessageFrameType1005...)
+	bothTypes = append(bothTypes, testdata.MessageFrameType1077...)
+
+	var testData = []struct {
+		description string
+		wanted      map[int]bool
+		want        []byte
+	}{
+		{"all", map[int]bool{}, bothTypes},
+		{"1005", map[int]bool{1005: true}, testdata.MessageFrameType1005},
+		{"none", map[int]bool{1230: true}, nil},
+	}
+	for _, td := range testData {
+		var output bytes.Buffer
+		filter(bytes.NewReader(input), &output, td.wanted, time.Now())
+
+		if !bytes.Equal(td.want, output.Bytes()) {
+			t.Errorf("%s: want %d bytes got %d", td.description, len(td.want), output.Len())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// positions reads RTCM3 data from standard input and prints the base
+// station position each time a message type 1005 arrives.  It shows how to
+// subscribe to one message type and use the decoded values rather than the
+// readable text:
+//
+//	go run ./examples/filterserial -types 1005 | go run ./examples/positions
+//
+// Each line gives the station ID and the ECEF coordinates of the antenna
+// reference point in metres.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// scaleFactor converts the antenna reference coordinates, which are in
+// units of 1/10,000 of a metre, to metres.
+const scaleFactor = 0.0001
+
+func main() {
+	for position := range subscribe(os.Stdin, time.Now()) {
+		x := float64(position.AntennaRefX) * scaleFactor
+		y := float64(position.AntennaRefY) * scaleFactor
+		z := float64(position.AntennaRefZ) * scaleFactor
+		fmt.Printf("station %d: (%.4f, %.4f, %.4f)\n", position.StationID, x, y, z)
+	}
+}
+
+// subscribe reads RTCM data from the reader and returns a channel which
+// receives the decoded type 1005 messages.  The channel is closed at the
+// end of the input.  Messages that can't be decoded are dropped.
+func subscribe(reader io.Reader, startTime time.Time) <-chan *type1005.Message {
+	positionChan := make(chan *type1005.Message)
+	scanner := rtcm.NewScannerAt(reader, startTime)
+
+	go func() {
+		defer close(positionChan)
+		for {
+			message, scanError := scanner.Next()
+			if scanError != nil {
+				return
+			}
+			if message.MessageType != utils.MessageType1005 {
+				continue
+			}
+			position, err := type1005.GetMessage(message.RawData, slog.LevelInfo)
+			if err != nil {
+				continue
+			}
+			positionChan <- position
+		}
+	}()
+
+	return positionChan
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// TestSubscribe checks that subscribe delivers only the type 1005 messages.
+func TestSubscribe(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+	input = append(input, testdata.AllJunk...)
+	input = append(input, testdata.MessageFrameType1005...)
+
+	got := 0
+	for position := range subscribe(bytes.NewReader(input), time.Now()) {
+		got++
+		if position.MessageType != 1005 {
+			t.Errorf("want message type 1005, got %d", position.MessageType)
+		}
+		if position.AntennaRefX == 0 || position.AntennaRefY == 0 || position.AntennaRefZ == 0 {
+			t.Errorf("want a position, got (%d, %d, %d)",
+				position.AntennaRefX, position.AntennaRefY, position.AntennaRefZ)
+		}
+	}
+
+	if got != 2 {
+		t.Errorf("want 2 positions, got %d", got)
+	}
+}
@@ -0,0 +1,104 @@
+// pushtocaster reads RTCM3 data from standard input and pushes the RTCM
+// messages to an NTRIP caster, making the base station available to rovers
+// on the internet:
+//
+//	go run ./examples/filterserial | \
+//	    go run ./examples/pushtocaster -caster caster.example.com:2101 \
+//	        -mountpoint MYBASE -password secret
+//
+// It uses NTRIP version 1, which most casters accept from a server.  The
+// server sends a SOURCE request carrying the password and the mountpoint and
+// the caster replies "ICY 200 OK".  After that the server just sends RTCM
+// data.  Non-RTCM data is dropped.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// sourceAgent identifies this program to the caster.
+const sourceAgent = "NTRIP go-ntrip-pushtocaster"
+
+func main() {
+	var caster string
+	var mountpoint string
+	var password string
+	flag.StringVar(&caster, "caster", "", "caster host:port")
+	flag.StringVar(&mountpoint, "mountpoint", "", "mountpoint")
+	flag.StringVar(&password, "password", "", "password")
+	flag.Parse()
+
+	if len(caster) == 0 || len(mountpoint) == 0 {
+		log.Fatal("-caster and -mountpoint are mandatory")
+	}
+
+	conn, dialError := net.Dial("tcp", caster)
+	if dialError != nil {
+		log.Fatal(dialError)
+	}
+	defer conn.Close()
+
+	pushError := push(os.Stdin, conn, mountpoint, password, time.Now())
+	if pushError != nil {
+		log.Fatal(pushError)
+	}
+}
+
+// push logs in to the caster on the given connection, then reads RTCM data
+// from the reader until end of file and sends the RTCM messages to the caster.
+func push(reader io.Reader, conn io.ReadWriter, mountpoint, password string, startTime time.Time) error {
+
+	loginError := login(conn, mountpoint, password)
+	if loginError != nil {
+		return loginError
+	}
+
+	scanner := rtcm.NewScannerAt(reader, startTime)
+	for {
+		message, scanError := scanner.Next()
+		if scanError != nil {
+			return nil
+		}
+		if message.MessageType == utils.NonRTCMMessage {
+			continue
+		}
+		if _, writeError := conn.Write(message.RawData); writeError != nil {
+			return writeError
+		}
+	}
+}
+
+// login sends an NTRIP version 1 SOURCE request and checks the response.
+func login(conn io.ReadWriter, mountpoint, password string) error {
+	request := fmt.Sprintf("SOURCE %s /%s\r\nSource-Agent: %s\r\n\r\n",
+		password, strings.TrimPrefix(mountpoint, "/"), sourceAgent)
+	_, writeError := conn.Write([]byte(request))
+	if writeError != nil {
+		return writeError
+	}
+
+	response, readError := bufio.NewReader(conn).ReadString('\n')
+	if readError != nil {
+		return readError
+	}
+
+	response = strings.TrimSpace(response)
+	if response != "ICY 200 OK" {
+		em := fmt.Sprintf("caster refused the connection - %s", response)
+		return errors.New(em)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// fakeCaster accepts one connection on the listener, reads the SOURCE
+// request, sends the given response and then collects everything sent to
+// it.  It sends the request and the data on the channels.
+func fakeCaster(listener net.Listener, response string, requests chan<- string, data chan<- []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		close(requests)
+		close(data)
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	request := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		request += line
+		if line == "\r\n" {
+			break
+		}
+	}
+	requests <- request
+
+	conn.Write([]byte(response))
+
+	received, _ := ioutil.ReadAll(reader)
+	data <- received
+}
+
+// TestPush checks that push logs in and sends the RTCM messages.
+func TestPush(t *testing.T) {
+	const wantRequest = "SOURCE secret /MYBASE\r\nSource-Agent: NTRIP go-ntrip-pushtocaster\r\n\r\n"
+
+	var input []byte
+	input = append(input, testdata.AllJunk...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	var want []byte
+	want = append(want, testdata.MessageFrameType1005...)
+	want = append(want, testdata.MessageFrameType1077...)
+
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, "ICY 200 OK\r\n", requests, data)
+
+	conn, dialError := net.Dial("tcp", listener.Addr().String())
+	if dialError != nil {
+		t.Fatal(dialError)
+	}
+
+	pushError := push(bytes.NewReader(input), conn, "/MYBASE", "secret", time.Now())
+	conn.Close()
+	if pushError != nil {
+		t.Fatal(pushError)
+	}
+
+	gotRequest := <-requests
+	if gotRequest != wantRequest {
+		t.Errorf("want request %q got %q", wantRequest, gotRequest)
+	}
+
+	got := <-data
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %d bytes got %d", len(want), len(got))
+	}
+}
+
+// TestPushWithBadPassword checks that push returns an error when the caster
+// refuses the connection.
+func TestPushWithBadPassword(t *testing.T) {
+	const wantError = "caster refused the connection - ERROR - Bad Password"
+
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	data := make(chan []byte, 1)
+	go fakeCaster(listener, "ERROR - Bad Password\r\n", requests, data)
+
+	conn, dialError := net.Dial("tcp", listener.Addr().String())
+	if dialError != nil {
+		t.Fatal(dialError)
+	}
+	defer conn.Close()
+
+	err := push(strings.NewReader(""), conn, "MYBASE", "wrong", time.Now())
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if err.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, err.Error())
+	}
+}
@@ -0,0 +1,160 @@
+// udp sends RTCM3 messages over UDP and receives them again, for radio modem
+// and VPN setups that only pass UDP.  One end reads RTCM data from standard
+// input and sends each message in its own datagram:
+//
+//	go run ./examples/filterserial | \
+//	    go run ./examples/udp -send rover.example.com:2102
+//
+// and the other end receives the datagrams and writes the RTCM data to
+// standard output:
+//
+//	go run ./examples/udp -listen :2102 > corrections.rtcm
+//
+// By default each message is wrapped in an RTP packet as in NTRIP version 2,
+// so the receiver can use the sequence numbers to count the lost and late
+// packets, which it logs every minute (see the -report flag).  With -raw the
+// datagrams contain just the RTCM message frames.  The RTSP session setup
+// that NTRIP version 2 uses to start an RTP stream from a caster is not
+// handled.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/rtp"
+)
+
+// maxDatagram is the largest datagram expected.  An RTCM3 frame is at most
+// 1029 bytes.
+const maxDatagram = 2048
+
+func main() {
+	var sendTo string
+	var listenOn string
+	var raw bool
+	var report time.Duration
+	flag.StringVar(&sendTo, "send", "", "host:port to send to")
+	flag.StringVar(&listenOn, "listen", "", "host:port to listen on")
+	flag.BoolVar(&raw, "raw", false, "send or expect bare RTCM frames rather than RTP packets")
+	flag.DurationVar(&report, "report", time.Minute, "time between loss reports when listening")
+	flag.Parse()
+
+	switch {
+	case len(sendTo) > 0:
+		conn, dialError := net.Dial("udp", sendTo)
+		if dialError != nil {
+			log.Fatal(dialError)
+		}
+		defer conn.Close()
+
+		sendError := send(os.Stdin, conn, raw, time.Now())
+		if sendError != nil {
+			log.Fatal(sendError)
+		}
+
+	case len(listenOn) > 0:
+		conn, listenError := net.ListenPacket("udp", listenOn)
+		if listenError != nil {
+			log.Fatal(listenError)
+		}
+		defer conn.Close()
+
+		var tracker rtp.Tracker
+		if !raw {
+			go reportLoss(&tracker, report)
+		}
+
+		receiveError := receive(conn, os.Stdout, raw, &tracker)
+		if receiveError != nil {
+			log.Fatal(receiveError)
+		}
+
+	default:
+		log.Fatal("want -send or -listen")
+	}
+}
+
+// send reads RTCM data from the reader until end of file and writes each
+// RTCM message to the connection as a datagram.  Non-RTCM data is dropped.
+// Unless raw is set, each message is wrapped in an RTP packet.
+func send(reader io.Reader, conn io.Writer, raw bool, startTime time.Time) error {
+	scanner := rtcm.NewScannerAt(reader, startTime)
+
+	// The sequence numbers start at a random value, as RFC 3550 suggests.
+	packet := rtp.Packet{
+		PayloadType:    rtp.PayloadTypeGNSS,
+		SequenceNumber: uint16(rand.Uint32()),
+		SSRC:           rand.Uint32(),
+	}
+
+	for {
+		message, scanError := scanner.Next()
+		if scanError == io.EOF {
+			return nil
+		}
+		if scanError != nil {
+			return scanError
+		}
+		if message.MessageType == utils.NonRTCMMessage {
+			continue
+		}
+
+		datagram := message.RawData
+		if !raw {
+			packet.Timestamp = uint32(time.Now().UnixNano() / int64(time.Millisecond))
+			packet.Payload = message.RawData
+			datagram = packet.Marshal()
+			packet.SequenceNumber++
+		}
+
+		if _, writeError := conn.Write(datagram); writeError != nil {
+			return writeError
+		}
+	}
+}
+
+// receive reads datagrams from the connection and writes their contents
+// to the writer until there is an error.  Unless raw is set, each datagram
+// must be an RTP packet.  The tracker counts the lost packets.  Bad packets
+// are logged and dropped.
+func receive(conn net.PacketConn, writer io.Writer, raw bool, tracker *rtp.Tracker) error {
+	buffer := make([]byte, maxDatagram)
+	for {
+		n, _, readError := conn.ReadFrom(buffer)
+		if readError != nil {
+			return readError
+		}
+
+		data := buffer[:n]
+		if !raw {
+			packet, parseError := rtp.Parse(data)
+			if parseError != nil {
+				log.Println(parseError)
+				continue
+			}
+			tracker.Record(packet.SequenceNumber)
+			data = packet.Payload
+		}
+
+		_, writeError := writer.Write(data)
+		if writeError != nil {
+			return writeError
+		}
+	}
+}
+
+// reportLoss logs the loss counts at the given intervals.  It runs forever.
+func reportLoss(tracker *rtp.Tracker, interval time.Duration) {
+	for range time.Tick(interval) {
+		stats := tracker.Stats()
+		log.Printf("received %d lost %d late %d", stats.Received, stats.Lost, stats.Late)
+	}
+}
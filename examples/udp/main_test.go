@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtp"
+)
+
+// TestSendAndReceive checks that the RTCM messages sent by send are
+// received by receive, with and without RTP.
+func TestSendAndReceive(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.AllJunk...)
+	input = append(input, testdata.MessageFrameType1005...)
+	input = append(input, testdata.MessageFrameType1077...)
+
+	var want []byte
+	want = append(want, testdata.MessageFrameType1005...)
+	want = append(want, testdata.MessageFrameType1077...)
+
+	for _, raw := range []bool{false, true} {
+		listener, listenError := net.ListenPacket("udp", "127.0.0.1:0")
+		if listenError != nil {
+			t.Fatal(listenError)
+		}
+
+		var received bytes.Buffer
+		var tracker rtp.Tracker
+		done := make(chan error)
+		go func() {
+			done <- receive(listener, &received, raw, &tracker)
+		}()
+
+		conn, dialError := net.Dial("udp", listener.LocalAddr().String())
+		if dialError != nil {
+			t.Fatal(dialError)
+		}
+
+		sendError := send(bytes.NewReader(input), conn, raw, time.Now())
+		conn.Close()
+		if sendError != nil {
+			t.Errorf("raw %v: %v", raw, sendError)
+		}
+
+		// Give the datagrams time to arrive, then stop the receiver.
+		time.Sleep(100 * time.Millisecond)
+		listener.Close()
+		<-done
+
+		if !bytes.Equal(want, received.Bytes()) {
+			t.Errorf("raw %v: want %d bytes got %d", raw, len(want), received.Len())
+		}
+
+		wantStats := rtp.LossStats{Received: 2}
+		if raw {
+			wantStats = rtp.LossStats{}
+		}
+		if tracker.Stats() != wantStats {
+			t.Errorf("raw %v: want %v got %v", raw, wantStats, tracker.Stats())
+		}
+	}
+}
+
+// TestReceiveWithBadPacket checks that receive drops a datagram that isn't
+// an RTP packet.
+func TestReceiveWithBadPacket(t *testing.T) {
+	listener, listenError := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+
+	var received bytes.Buffer
+	var tracker rtp.Tracker
+	done := make(chan error)
+	go func() {
+		done <- receive(listener, &received, false, &tracker)
+	}()
+
+	conn, dialError := net.Dial("udp", listener.LocalAddr().String())
+	if dialError != nil {
+		t.Fatal(dialError)
+	}
+	conn.Write([]byte("junk"))
+	packet := rtp.Packet{PayloadType: rtp.PayloadTypeGNSS, Payload: []byte("good")}
+	conn.Write(packet.Marshal())
+	conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	listener.Close()
+	<-done
+
+	if received.String() != "good" {
+		t.Errorf("want good got %q", received.String())
+	}
+}
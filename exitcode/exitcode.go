@@ -0,0 +1,108 @@
+// The exitcode package defines the exit statuses of the go-ntrip commands, so
+// that a shell script or a service manager such as systemd can tell one kind
+// of failure from another, for example to give up when the caster refuses
+// the credentials but to restart after a network failure.
+//
+// All of the commands use the same scheme:
+//
+//	0  OK                the command succeeded
+//	1  Failure           a failure not covered below
+//	2  Config            the command line or the config file is wrong
+//	3  InputUnavailable  a device, file or caster can't be reached or opened
+//	4  AuthFailure       the caster refused the credentials
+//	5  IOError           reading or writing failed while running
+//
+// The flag package also exits with status 2 when the command line is wrong.
+//
+// A function that knows what kind of failure it has seen can say so by
+// wrapping its error:
+//
+//	return exitcode.Wrap(exitcode.AuthFailure, err)
+//
+// and the command can then exit with the right status:
+//
+//	if err != nil {
+//	    exitcode.FatalError(err)
+//	}
+package exitcode
+
+import (
+	"errors"
+	"log"
+	"os"
+)
+
+// The exit statuses.
+const (
+	OK               = 0
+	Failure          = 1
+	Config           = 2
+	InputUnavailable = 3
+	AuthFailure      = 4
+	IOError          = 5
+)
+
+// exit stops the program.  It's a variable to support testing.
+var exit = os.Exit
+
+// Error is an error with the exit status that it should produce.
+type Error struct {
+	// Code is the exit status.
+	Code int
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the text of the underlying error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns the error with the given exit status attached.  It returns
+// nil if the error is nil.
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Code returns the exit status for the error - OK if it's nil, the attached
+// status if it was wrapped, otherwise Failure.
+func Code(err error) int {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return Failure
+}
+
+// Fatal writes the values to the standard logger and exits with the given
+// status.
+func Fatal(code int, v ...interface{}) {
+	log.Print(v...)
+	exit(code)
+}
+
+// Fatalf writes a formatted message to the standard logger and exits with
+// the given status.
+func Fatalf(code int, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	exit(code)
+}
+
+// FatalError writes the error to the standard logger and exits with the
+// status given by Code.
+func FatalError(err error) {
+	log.Print(err)
+	exit(Code(err))
+}
@@ -0,0 +1,78 @@
+package exitcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+)
+
+// TestCode checks that Code finds the exit status of an error.
+func TestCode(t *testing.T) {
+	base := errors.New("caster refused the request - ERROR - Bad Password")
+
+	var testData = []struct {
+		description string
+		err         error
+		want        int
+	}{
+		{"nil", nil, OK},
+		{"plain", base, Failure},
+		{"wrapped", Wrap(AuthFailure, base), AuthFailure},
+		{"wrapped twice", fmt.Errorf("connect - %w", Wrap(IOError, base)), IOError},
+		{"wrapped nil", Wrap(Config, nil), OK},
+	}
+	for _, td := range testData {
+		got := Code(td.err)
+		if got != td.want {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+	}
+
+	if Wrap(AuthFailure, base).Error() != base.Error() {
+		t.Errorf("want %s got %s", base.Error(), Wrap(AuthFailure, base).Error())
+	}
+	if !errors.Is(Wrap(AuthFailure, base), base) {
+		t.Error("want the wrapped error to be the base error")
+	}
+}
+
+// TestFatal checks that the fatal functions log the message and exit with
+// the right status.
+func TestFatal(t *testing.T) {
+	var got int
+	exit = func(code int) { got = code }
+	defer func() { exit = os.Exit }()
+
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	var testData = []struct {
+		description string
+		fatal       func()
+		wantCode    int
+		wantLog     string
+	}{
+		{"Fatal", func() { Fatal(Config, "missing config file") }, Config, "missing config file\n"},
+		{"Fatalf", func() { Fatalf(InputUnavailable, "cannot open %s", "x.rtcm") }, InputUnavailable, "cannot open x.rtcm\n"},
+		{"FatalError", func() { FatalError(Wrap(IOError, errors.New("write failed"))) }, IOError, "write failed\n"},
+		{"FatalError plain", func() { FatalError(errors.New("oops")) }, Failure, "oops\n"},
+	}
+	for _, td := range testData {
+		buffer.Reset()
+		td.fatal()
+		if got != td.wantCode {
+			t.Errorf("%s: want code %d got %d", td.description, td.wantCode, got)
+		}
+		if buffer.String() != td.wantLog {
+			t.Errorf("%s: want log %q got %q", td.description, td.wantLog, buffer.String())
+		}
+	}
+}
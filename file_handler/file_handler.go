@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/goblimey/go-ntrip/jsonconfig"
+	"github.com/goblimey/go-ntrip/metrics"
 	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
 )
 
 // Handler provides code to handle a text file containing RTCM3 messages, possibly
@@ -21,6 +23,8 @@ type Handler struct {
 	RetryIntervalOnEOF time.Duration     // The time to wait between retries on EOF.
 	EOFTimeout         time.Duration     // Give up retrying after this time has elapsed.
 	Config             *jsonconfig.Config
+	Metrics            *metrics.Registry // Optional - counts the CRC failures.
+	Events             chan<- rtcm.Event // Optional - receives the RTCM handler's events.
 }
 
 // New creates a handler.
@@ -71,13 +75,38 @@ func (handler *Handler) Handle(startTime time.Time, reader *bufio.Reader) error
 	//
 	var timeOfFirstEOF *time.Time
 
+	// Set up an RTCM handler connected to the input and output channels
+	// and start it running.
+	handler.RTCMHandler = rtcm.New(startTime, slog.LevelDebug)
+	if handler.Config.ValidationPolicy != nil {
+		handler.RTCMHandler.SetValidationPolicy(handler.Config.ValidationPolicy)
+	}
+	handler.RTCMHandler.SetFrameLimits(handler.Config.FrameLimits())
+	handler.RTCMHandler.SetPositionPrecision(handler.Config.PositionPrecisionMetres)
+	location, locationError := handler.Config.DisplayLocation()
+	if locationError != nil && handler.Config.SystemLog != nil {
+		handler.Config.SystemLog.Printf("%v - showing times in UTC", locationError)
+	}
+	handler.RTCMHandler.SetDisplayLocation(location)
+	handler.RTCMHandler.SetNMEAParsing(handler.Config.ParseNMEA)
+	if handler.Metrics != nil {
+		handler.Metrics.WatchHandler(handler.RTCMHandler)
+	}
+	if handler.Events != nil {
+		handler.RTCMHandler.Subscribe(handler.Events)
+	}
+
+	if handler.Config.TimeoutOnEOF() == 0 {
+		// There's no retrying on EOF, so the RTCM handler can read the file
+		// directly, which is much faster than passing it the bytes one at a
+		// time through a channel.
+		return handler.handleWithoutRetries(reader)
+	}
+
 	byteChan := make(chan byte)
 	// Ensure that the byte channel is closed on return.
 	defer close(byteChan)
 
-	// Set up an RTCM handler connected to the input and output channels
-	// and start it running.
-	handler.RTCMHandler = rtcm.New(startTime, slog.LevelDebug)
 	go handler.RTCMHandler.HandleMessages(byteChan, handler.MessageChan)
 
 	// Read the file and send the data to the byte channel.
@@ -150,3 +179,33 @@ func (handler *Handler) Handle(startTime time.Time, reader *bufio.Reader) error
 		}
 	}
 }
+
+// handleWithoutRetries is Handle when there is no EOF timeout.  It reads
+// until the first EOF or error, sends the messages to the message channel
+// and then closes it.  It returns the error.
+func (handler *Handler) handleWithoutRetries(reader *bufio.Reader) error {
+	byteChannel := pushback.NewFromReader(reader)
+	for {
+		message, err := handler.RTCMHandler.FetchNextMessageFrame(byteChannel)
+		if err != nil && err.Error() == "done" {
+			close(handler.MessageChan)
+			break
+		}
+		if message != nil {
+			handler.MessageChan <- *message
+		}
+	}
+
+	err := byteChannel.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	if handler.Config.SystemLog != nil {
+		if err != io.EOF && !strings.Contains(err.Error(), "i/o timeout") {
+			handler.Config.SystemLog.Printf("%v", err)
+		} else {
+			handler.Config.SystemLog.Printf("%v\n", err)
+		}
+	}
+	return err
+}
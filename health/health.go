@@ -0,0 +1,299 @@
+// The health package serves health-check endpoints so that a supervisor
+// such as systemd or Kubernetes can tell whether an application is working
+// and restart it if it isn't.  There are two endpoints:
+//
+//   - /livez answers "ok" as long as the application is running and can
+//     serve HTTP.  It's the liveness probe.
+//   - /healthz gives the state of the application as JSON and answers 200
+//     if it's healthy, 503 (service unavailable) if not.
+//
+// The state looks like this:
+//
+//	{
+//	    "healthy": true,
+//	    "seconds_since_last_message": 0.8,
+//	    "device_connected": true,
+//	    "caster_connected": true
+//	}
+//
+// The application is healthy if a valid RTCM message has arrived within the
+// stale time (30 seconds unless the config says otherwise), the device is
+// connected and the caster is connected.  The seconds since the last
+// message is null until the first one arrives.
+//
+// The endpoints are off unless the application's config has a health
+// section:
+//
+//	"health": {"listen_address": ":8081", "stale_after_seconds": 60}
+//
+// The application creates the Checker, starts listening and feeds it:
+//
+//	checker, err := health.New(config, logger)
+//	...
+//	err = checker.Listen()
+//	...
+//	go checker.Run(nil)
+//	checker.Observe(&message)  // Call for each message.
+//
+// An application that connects to the device or the caster itself reports
+// the state of the connection with SetDeviceConnected and
+// SetCasterConnected.  Otherwise the device is taken to be connected while
+// the messages are arriving, and the caster state is left out of the JSON
+// and doesn't affect the health unless WatchCaster is running.
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// DefaultStaleAfter is the time without a valid message after which the
+// application is unhealthy, unless the config says otherwise.
+const DefaultStaleAfter = 30 * time.Second
+
+// casterDialTimeout is the time allowed by WatchCaster to connect to the
+// caster.
+const casterDialTimeout = 10 * time.Second
+
+// Config is the config of a Checker, as it appears in an application's JSON
+// config file.
+type Config struct {
+	// ListenAddress is the host:port on which the endpoints are served, for
+	// example ":8081" for all interfaces.
+	ListenAddress string `json:"listen_address"`
+
+	// StaleAfterSeconds is the time without a valid message after which the
+	// application is unhealthy.  Zero means DefaultStaleAfter.
+	StaleAfterSeconds uint `json:"stale_after_seconds"`
+}
+
+// StaleAfter returns the time without a valid message after which the
+// application is unhealthy.
+func (config *Config) StaleAfter() time.Duration {
+	if config.StaleAfterSeconds == 0 {
+		return DefaultStaleAfter
+	}
+	return time.Duration(config.StaleAfterSeconds) * time.Second
+}
+
+// Status is the content of the /healthz response.  CasterConnected is nil
+// if the state of the caster is not known.
+type Status struct {
+	Healthy                 bool     `json:"healthy"`
+	SecondsSinceLastMessage *float64 `json:"seconds_since_last_message"`
+	DeviceConnected         bool     `json:"device_connected"`
+	CasterConnected         *bool    `json:"caster_connected,omitempty"`
+}
+
+// Checker holds the state of the application and serves the endpoints.
+// It's safe for concurrent use.
+type Checker struct {
+	// config is the config of the Checker.
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// listener is the listener on which the endpoints are served, nil until
+	// Listen is called.
+	listener net.Listener
+
+	// lastMessage is the time at which the last valid message arrived.
+	lastMessage time.Time
+
+	// deviceConnected and casterConnected are as set by SetDeviceConnected
+	// and SetCasterConnected, nil if they have not been called.
+	deviceConnected *bool
+	casterConnected *bool
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// New creates a Checker that serves on the address in the config.  The
+// logger may be nil.
+func New(config Config, logger *log.Logger) (*Checker, error) {
+	_, _, splitError := net.SplitHostPort(config.ListenAddress)
+	if splitError != nil {
+		em := fmt.Sprintf("health - the listen address %q is not host:port", config.ListenAddress)
+		return nil, errors.New(em)
+	}
+
+	checker := Checker{
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+
+	return &checker, nil
+}
+
+// Observe takes note of a message.  Non-RTCM data, which includes messages
+// with a bad CRC, is ignored.
+func (checker *Checker) Observe(message *rtcm.Message) {
+	if message == nil || message.MessageType == utils.NonRTCMMessage {
+		return
+	}
+
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	checker.lastMessage = checker.now()
+}
+
+// SetDeviceConnected says whether the application is connected to the
+// device.
+func (checker *Checker) SetDeviceConnected(connected bool) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	checker.deviceConnected = &connected
+}
+
+// SetCasterConnected says whether the application is connected to the
+// caster.
+func (checker *Checker) SetCasterConnected(connected bool) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	checker.casterConnected = &connected
+}
+
+// WatchCaster is for an application that doesn't connect to the caster
+// itself.  At the given interval it tries to connect to the address and
+// sets the caster state to say whether it can be reached.  It runs until
+// the stop channel is closed.  If the channel is nil, it runs forever.  It
+// can be run in a goroutine.
+func (checker *Checker) WatchCaster(address string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		connection, dialError := net.DialTimeout("tcp", address, casterDialTimeout)
+		if dialError == nil {
+			connection.Close()
+		}
+		checker.SetCasterConnected(dialError == nil)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the state of the application.
+func (checker *Checker) Status() *Status {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	var status Status
+
+	fresh := false
+	if !checker.lastMessage.IsZero() {
+		age := checker.now().Sub(checker.lastMessage)
+		seconds := age.Seconds()
+		status.SecondsSinceLastMessage = &seconds
+		fresh = age <= checker.config.StaleAfter()
+	}
+
+	if checker.deviceConnected != nil {
+		status.DeviceConnected = *checker.deviceConnected
+	} else {
+		status.DeviceConnected = fresh
+	}
+
+	status.Healthy = fresh && status.DeviceConnected
+
+	if checker.casterConnected != nil {
+		connected := *checker.casterConnected
+		status.CasterConnected = &connected
+		status.Healthy = status.Healthy && connected
+	}
+
+	return &status
+}
+
+// ServeHTTP serves the liveness check at /livez and the health check at
+// /healthz.
+func (checker *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/livez":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	case "/healthz":
+		status := checker.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		err := json.NewEncoder(w).Encode(status)
+		if err != nil {
+			eventlog.Printf(checker.logger, "health - %v", err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Listen starts listening on the address in the config.  It returns an
+// error if the address can't be used, for example because another program
+// is listening on it.
+func (checker *Checker) Listen() error {
+	listener, listenError := net.Listen("tcp", checker.config.ListenAddress)
+	if listenError != nil {
+		em := fmt.Sprintf("health - cannot listen on %s - %v", checker.config.ListenAddress, listenError)
+		return errors.New(em)
+	}
+
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	checker.listener = listener
+	return nil
+}
+
+// Addr returns the address on which the Checker is listening, nil if Listen
+// has not been called.
+func (checker *Checker) Addr() net.Addr {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	if checker.listener == nil {
+		return nil
+	}
+	return checker.listener.Addr()
+}
+
+// Run serves the endpoints until the stop channel is closed.  If the
+// channel is nil, it runs forever.  Listen must be called first.  It can be
+// run in a goroutine.
+func (checker *Checker) Run(stop <-chan struct{}) {
+	checker.mutex.Lock()
+	listener := checker.listener
+	checker.mutex.Unlock()
+	if listener == nil {
+		eventlog.Println(checker.logger, "health - Run called before Listen")
+		return
+	}
+
+	server := http.Server{Handler: checker}
+
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	serveError := server.Serve(listener)
+	if serveError != nil && serveError != http.ErrServerClosed {
+		eventlog.Printf(checker.logger, "health - %v", serveError)
+	}
+}
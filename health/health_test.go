@@ -0,0 +1,247 @@
+package health
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// newTestChecker is a helper function.  It returns a Checker whose clock is
+// controlled by the test.
+func newTestChecker(t *testing.T, config Config, now *time.Time) *Checker {
+	checker, err := New(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.now = func() time.Time { return *now }
+	return checker
+}
+
+// TestNew checks that New checks the config.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"all interfaces", Config{ListenAddress: ":8081"}, ""},
+		{"localhost", Config{ListenAddress: "localhost:8081", StaleAfterSeconds: 60}, ""},
+		{"no port", Config{ListenAddress: "localhost"},
+			`health - the listen address "localhost" is not host:port`},
+		{"empty", Config{},
+			`health - the listen address "" is not host:port`},
+	}
+	for _, td := range testData {
+		_, err := New(td.config, nil)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestStaleAfter checks the default stale time.
+func TestStaleAfter(t *testing.T) {
+	var testData = []struct {
+		config Config
+		want   time.Duration
+	}{
+		{Config{}, DefaultStaleAfter},
+		{Config{StaleAfterSeconds: 5}, 5 * time.Second},
+	}
+	for _, td := range testData {
+		if got := td.config.StaleAfter(); got != td.want {
+			t.Errorf("%d: want %v got %v", td.config.StaleAfterSeconds, td.want, got)
+		}
+	}
+}
+
+// TestStatus checks the health as the messages arrive and stop and as the
+// connections come and go.
+func TestStatus(t *testing.T) {
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	checker := newTestChecker(t, Config{ListenAddress: ":0", StaleAfterSeconds: 10}, &now)
+
+	// No messages yet.
+	status := checker.Status()
+	if status.Healthy || status.SecondsSinceLastMessage != nil || status.DeviceConnected || status.CasterConnected != nil {
+		t.Errorf("before the first message: unexpected status %+v", status)
+	}
+
+	// Non-RTCM data doesn't count.
+	checker.Observe(&rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")})
+	checker.Observe(nil)
+	if checker.Status().SecondsSinceLastMessage != nil {
+		t.Error("non-RTCM data counted as a message")
+	}
+
+	checker.Observe(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+	now = now.Add(2500 * time.Millisecond)
+	status = checker.Status()
+	if !status.Healthy || !status.DeviceConnected || status.SecondsSinceLastMessage == nil || *status.SecondsSinceLastMessage != 2.5 {
+		t.Errorf("receiving: unexpected status %+v", status)
+	}
+
+	// The caster goes and comes back.
+	checker.SetCasterConnected(false)
+	status = checker.Status()
+	if status.Healthy || status.CasterConnected == nil || *status.CasterConnected {
+		t.Errorf("caster lost: unexpected status %+v", status)
+	}
+	checker.SetCasterConnected(true)
+	if !checker.Status().Healthy {
+		t.Error("caster back: want healthy")
+	}
+
+	// The application says that the device has gone.
+	checker.SetDeviceConnected(false)
+	status = checker.Status()
+	if status.Healthy || status.DeviceConnected {
+		t.Errorf("device lost: unexpected status %+v", status)
+	}
+	checker.SetDeviceConnected(true)
+
+	// The messages stop.
+	now = now.Add(10 * time.Second)
+	status = checker.Status()
+	if status.Healthy || !status.DeviceConnected || *status.SecondsSinceLastMessage != 12.5 {
+		t.Errorf("stale: unexpected status %+v", status)
+	}
+}
+
+// TestServeHTTP checks the two endpoints and an unknown path.
+func TestServeHTTP(t *testing.T) {
+	now := time.Now()
+	checker := newTestChecker(t, Config{ListenAddress: ":0"}, &now)
+
+	var testData = []struct {
+		description string
+		path        string
+		observe     bool
+		wantCode    int
+		wantBody    string
+	}{
+		{"live", "/livez", false, http.StatusOK, "ok\n"},
+		{"unhealthy", "/healthz", false, http.StatusServiceUnavailable,
+			`{"healthy":false,"seconds_since_last_message":null,"device_connected":false}` + "\n"},
+		{"healthy", "/healthz", true, http.StatusOK,
+			`{"healthy":true,"seconds_since_last_message":0,"device_connected":true}` + "\n"},
+		{"unknown", "/other", false, http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, td := range testData {
+		if td.observe {
+			checker.Observe(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+		}
+		recorder := httptest.NewRecorder()
+		checker.ServeHTTP(recorder, httptest.NewRequest("GET", td.path, nil))
+		if recorder.Code != td.wantCode {
+			t.Errorf("%s: want status %d got %d", td.description, td.wantCode, recorder.Code)
+		}
+		if got := recorder.Body.String(); got != td.wantBody {
+			t.Errorf("%s: want body %q got %q", td.description, td.wantBody, got)
+		}
+	}
+}
+
+// TestRun checks that the endpoints are served on the listen address and
+// that Run stops when asked.
+func TestRun(t *testing.T) {
+	checker, err := New(Config{ListenAddress: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checker.Addr() != nil {
+		t.Error("want no address before Listen")
+	}
+	if err := checker.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		checker.Run(stop)
+		close(done)
+	}()
+
+	response, getError := http.Get("http://" + checker.Addr().String() + "/healthz")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("want status %d got %d", http.StatusServiceUnavailable, response.StatusCode)
+	}
+	var status Status
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Errorf("%v in\n%s", err, string(body))
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Run didn't stop")
+	}
+}
+
+// TestWatchCaster checks that the caster state says whether the caster can
+// be reached.
+func TestWatchCaster(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	now := time.Now()
+	checker := newTestChecker(t, Config{ListenAddress: ":0"}, &now)
+	stop := make(chan struct{})
+	close(stop)
+
+	checker.WatchCaster(address, time.Hour, stop)
+	if got := checker.Status().CasterConnected; got == nil || !*got {
+		t.Errorf("want the caster connected")
+	}
+
+	listener.Close()
+	checker.WatchCaster(address, time.Hour, stop)
+	if got := checker.Status().CasterConnected; got == nil || *got {
+		t.Errorf("want the caster not connected")
+	}
+}
+
+// TestListenError checks the error when the address is in use.
+func TestListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	checker, err := New(Config{ListenAddress: address}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checker.Listen()
+	wantPrefix := "health - cannot listen on " + address + " - "
+	if err == nil || !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("want %q... got %v", wantPrefix, err)
+	}
+}
@@ -3,99 +3,151 @@ package jsonconfig
 // The jsonconfig package provides support for reading and using a JSON configuration
 // file in a standard format for various NTRIP applications.
 //
-// An example config file:
+// The file is read by the config package, which describes the format.  The Config
+// here holds the settings that the code that handles the input needs - the list of
+// devices that may be used to represent the USB connection, flags that determine
+// which output channels should be enabled, the details needed to connect to an NTRIP
+// caster and some controls for handling timeouts and retries if the incoming message
+// stream dies.  New makes one from a config.Config.  For files written before the
+// config package, GetJSONConfigFromFile still accepts the old format of this
+// package, for example:
 //
 // {
 //		"input": ["/dev/ttyACM0", "/dev/ttyACM1", "/dev/ttyACM2", "/dev/ttyACM3"],
-//      "sendToCaster": true,
-//		"writeoutputLog": false,
-//		"writereadableLog": false,
-//      "casterhostname": "caster.example.com",
-//      "casterport": 2101,
-//      "casterUserName": "user",
-//		"casterPassword": "password",
-//		"timeout": 1,
-//		"sleeptime": 2
+//		"record_messages": false,
+//		"display_messages": false,
+//		"caster_host_name": "caster.example.com",
+//		"caster_port": 2101,
+//		"caster_user_name": "user",
+//		"caster_password": "password",
+//		"read_timeout_milliseconds": 1000,
+//		"sleep_time_after_failed_open_milliseconds": 2000
 //	}
 //
-// This example suits the NTRIP server running on a Raspberry Pi and reading RTCM
-// messages from a GPS device over a serial USB connection and sending them to a set
-// of output channels for processing.  (For example, the goroutine at the other end of
-// the channel might send the messages to an NTRIP caster, or it might log them in a
-// file.)  The config specifies the list of Linux devices that may be used to
-// represent the USB connection, flags that determine which output channels should be
-// enabled, the details needed to  connect to an NTRIP caster and some controls for
-// handling timeouts and retries if the incoming message stream dies.
-//
-// Other applications such as the RTCM Filter use the same format but don't use all
-// the fields.
-//
 // The package contains functions to read a configuration from a file, connect to the
 // incoming data stream and to attempt to reconnect if the stream then dies.
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/goblimey/go-ntrip/config"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/serialin"
+	"github.com/goblimey/go-ntrip/station"
 )
 
-// Config contains the values from the JSON config file and a ready-made writer
-// that writes to the system log.  To support unit testing, functions that
-// write to the log should use this writer - we don't want to force unit tests
-// to write to a real log file.)
+// Config contains the values from the JSON config file that the input handling
+// uses and a ready-made writer that writes to the system log.  To support
+// unit testing, functions that write to the log should use this writer - we
+// don't want to force unit tests to write to a real log file.)
 type Config struct {
-	// Filenames is a list of filenames to try to open - first one wins.
-	Filenames []string `json:"input"`
+	// Filenames is a list of filenames to try to open - first one wins.  A
+	// name can be that of a serial port, for example "/dev/ttyACM0" or, on
+	// Windows, "COM4", a pattern that matches serial ports, for example
+	// "/dev/ttyACM*" or "COM*", or that of an ordinary file such as a
+	// recording.  See getInputFile.
+	Filenames []string
+
+	// Serial gives the parameters with which a serial port is opened.
+	Serial config.Serial
 
 	// RecordMessages says whether to record a verbatim copy of RTCM messages in a file.
-	RecordMessages bool `json:"record_messages"`
+	RecordMessages bool
 
 	// MessageLogDirectory specifies the directory in which the file of RTCM
 	// messages is stored
-	MessageLogDirectory string `json:"message_log_directory"`
+	MessageLogDirectory string
 
 	// DisplayMessages says whether to write a readable display of the incoming messages.
 	// Note: turning this on will produce a lot of output.
-	DisplayMessages bool `json:"display_messages"`
+	DisplayMessages bool
 
 	// CasterHostName is host name of the NTRIP (broad)caster.
-	CasterHostName string `json:"caster_host_name"`
+	CasterHostName string
 
 	// CasterPort is port on which the (broad)caster is listening for NTRIP traffic.
-	CasterPort uint `json:"caster_port"`
+	CasterPort uint
 
 	// CasterUsername is the user name to connect to the NTRIP (broad)caster.
-	CasterUserName string `json:"caster_user_name"`
+	CasterUserName string
 
 	// CasterPassword is password to connect to the NTRIP (broad)caster.
-	CasterPassword string `json:"caster_password"`
+	CasterPassword string
 
 	// ReadTimeoutSeconds defines the input timeout in milliseconds.  This is
 	// bound into the reader by getInputFile.  The function ReadTimeout
 	// returns this as a duration.
-	ReadTimeoutMilliSeconds uint `json:"read_timeout_milliseconds"`
+	ReadTimeoutMilliSeconds uint
 
 	// SleepTimeAfterFailedOpenMilliSeconds defines the time that a caller of
 	// getInputFile should pause before retrying if it fails to find any of
 	// the files listed in the config.  The function SleepTimeAfterFailedOpen returns this
 	// as a duration.
-	SleepTimeAfterFailedOpenMilliSeconds uint `json:"sleep_time_after_failed_open_milliseconds"`
+	SleepTimeAfterFailedOpenMilliSeconds uint
 
 	// WaitTimeOnEOFMilliseconds specifies in milliseconds how long a caller
 	// should wait before retrying if a read operation on a serial connection
 	// returns EOF.  The function WaitTimeOnEOF returns this as a duration.
-	WaitTimeOnEOFMilliseconds uint `json:"wait_time_on_EOF_millis"`
+	WaitTimeOnEOFMilliseconds uint
 
 	// TimeoutOnEOFMilliSeconds returns the duration of the timeout that a caller
 	// should apply when a series of read operations return EOF.  A value of 0 means
 	// that the caller should give up on the first EOF.
 	//
 	// The function TimeoutOnEOF returns this as a duration.
-	TimeoutOnEOFMilliSeconds uint `json:"timeout_on_EOF_milliseconds"`
+	TimeoutOnEOFMilliSeconds uint
+
+	// ValidationPolicy optionally relaxes the checks that the RTCM handler
+	// applies to incoming message frames, for devices that produce frames
+	// with vendor extensions.  If it's not given, the handler only accepts
+	// frames that follow the RTCM standard.
+	ValidationPolicy *rtcm.TolerantPolicy
+
+	// MaxMessageLength is the maximum length in bytes of the message embedded
+	// in an RTCM frame.  The standard maximum is 1023.  A larger value allows
+	// vendor frames that use the reserved bits of the leader to extend the
+	// length.  0 means use the standard maximum.
+	MaxMessageLength uint
+
+	// FrameTimeoutMilliseconds is the time allowed for the rest of a message
+	// frame to arrive once its start has been seen.  0 means no timeout.  The
+	// function FrameLimits returns this as a duration.
+	FrameTimeoutMilliseconds uint
+
+	// ResyncWindow is the number of bytes after the start of a bad message
+	// frame within which the handler looks for the start of a good one.  0
+	// turns resyncing off.
+	ResyncWindow int
+
+	// PositionPrecisionMetres is the precision to which the base position
+	// is displayed in the readable log, so that the log can be published
+	// without giving away the exact position.  0 means show the exact
+	// position.  See rtcm.Handler.SetPositionPrecision.
+	PositionPrecisionMetres float64
+
+	// DisplayTimeZone is the IANA name of the time zone in which times are
+	// shown in the readable display, for example "Europe/London".  Empty
+	// means UTC.  See DisplayLocation.
+	DisplayTimeZone string
+
+	// ParseNMEA is true if NMEA sentences in the non-RTCM data are to be
+	// picked out and parsed.  See rtcm.Handler.SetNMEAParsing.
+	ParseNMEA bool
+
+	// LogHandlerEvents is true if the RTCM handler's events are to be
+	// written to the system log.  See rtcm.Handler.Subscribe.
+	LogHandlerEvents bool
+
+	// Station describes the base station - its name, operator, surveyed
+	// position and antenna.  It's optional.  See the station package.
+	Station *station.Config
 
 	// SystemLog is the Writer used for the daily activity log (as opposed to
 	// the log of incoming RTCM messages) and can be nil.  It's not supplied
@@ -104,7 +156,40 @@ type Config struct {
 	SystemLog *log.Logger
 }
 
+// New returns the config made from the sections of the shared config
+// that the input handling uses, with the given system log, which can be
+// nil.
+func New(c *config.Config, systemLog *log.Logger) *Config {
+	return &Config{
+		Filenames:                            c.Input.Devices,
+		Serial:                               c.Input.Serial,
+		RecordMessages:                       c.Logging.RecordMessages,
+		MessageLogDirectory:                  c.Logging.MessageLogDirectory,
+		DisplayMessages:                      c.Logging.DisplayMessages,
+		CasterHostName:                       c.Caster.Host,
+		CasterPort:                           c.Caster.Port,
+		CasterUserName:                       c.Caster.User,
+		CasterPassword:                       c.Caster.Password,
+		ReadTimeoutMilliSeconds:              c.Input.ReadTimeoutMilliseconds,
+		SleepTimeAfterFailedOpenMilliSeconds: c.Input.SleepTimeAfterFailedOpenMilliseconds,
+		WaitTimeOnEOFMilliseconds:            c.Input.WaitTimeOnEOFMilliseconds,
+		TimeoutOnEOFMilliSeconds:             c.Input.TimeoutOnEOFMilliseconds,
+		ValidationPolicy:                     c.Input.ValidationPolicy,
+		MaxMessageLength:                     c.Input.MaxMessageLength,
+		FrameTimeoutMilliseconds:             c.Input.FrameTimeoutMilliseconds,
+		ResyncWindow:                         c.Input.ResyncWindow,
+		PositionPrecisionMetres:              c.Logging.PositionPrecisionMetres,
+		DisplayTimeZone:                      c.Logging.DisplayTimeZone,
+		ParseNMEA:                            c.Logging.ParseNMEA,
+		LogHandlerEvents:                     c.Logging.LogHandlerEvents,
+		Station:                              c.Station,
+		SystemLog:                            systemLog,
+	}
+}
+
 // GetJSONConfigFromFile gets the config from the file given by configName.
+// The file can be in the format of the config package or in the old format
+// of this package.
 func GetJSONConfigFromFile(configFileName string, systemLog *log.Logger) (*Config, error) {
 	jsonReader, fileErr := os.Open(configFileName)
 	if fileErr != nil {
@@ -115,6 +200,7 @@ func GetJSONConfigFromFile(configFileName string, systemLog *log.Logger) (*Confi
 		}
 		return nil, fileErr
 	}
+	defer jsonReader.Close()
 
 	// There is a JSON control file.  Read and unmarshall it.
 	config, jsonError := getJSONConfig(jsonReader, systemLog)
@@ -128,36 +214,18 @@ func GetJSONConfigFromFile(configFileName string, systemLog *log.Logger) (*Confi
 // getJSONConfig reads from the given source and returns the config.
 func getJSONConfig(jsonSource io.Reader, systemLog *log.Logger) (*Config, error) {
 
-	jsonBytes, jsonReadError := ioutil.ReadAll(jsonSource)
-	if jsonReadError != nil {
-		// We can't read the control file - permissions?
-		errorMessage1 := fmt.Sprintf("cannot read the JSON control file - %v\n", jsonReadError)
-		if systemLog != nil {
-			systemLog.Println(errorMessage1)
-		} else {
-			log.Println(errorMessage1)
-		}
-		return nil, jsonReadError
-	}
-
-	var config Config
-	// Parse the JSON control file
-	jsonParseError := json.Unmarshal(jsonBytes, &config)
-	if jsonParseError != nil {
-		errorMessage2 := fmt.Sprintf("cannot parse the JSON control file - %v\n", jsonParseError)
+	c, configError := config.Read(jsonSource)
+	if configError != nil {
+		errorMessage := fmt.Sprintf("cannot use the JSON control file - %v\n", configError)
 		if systemLog != nil {
-			systemLog.Println(errorMessage2)
+			systemLog.Println(errorMessage)
 		} else {
-			log.Println(errorMessage2)
+			log.Println(errorMessage)
 		}
-		return nil, jsonParseError
+		return nil, configError
 	}
 
-	// Set the fields that are not set by the JSON.
-
-	config.SystemLog = systemLog
-
-	return &config, nil
+	return New(c, systemLog), nil
 }
 
 // ReadTimeout gets the read timeout as a duration.
@@ -184,6 +252,31 @@ func (config *Config) TimeoutOnEOF() time.Duration {
 	return time.Duration(config.TimeoutOnEOFMilliSeconds) * time.Millisecond
 }
 
+// FrameLimits returns the limits that the RTCM handler should apply when it
+// scans the input for message frames.
+func (config *Config) FrameLimits() rtcm.FrameLimits {
+	limits := rtcm.FrameLimits{
+		MaxMessageLength: config.MaxMessageLength,
+		FrameTimeout:     time.Duration(config.FrameTimeoutMilliseconds) * time.Millisecond,
+		ResyncWindow:     config.ResyncWindow,
+	}
+	return limits
+}
+
+// DisplayLocation returns the time zone in which the readable display shows
+// times, or nil if none is given, meaning UTC.
+func (config *Config) DisplayLocation() (*time.Location, error) {
+	if len(config.DisplayTimeZone) == 0 {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(config.DisplayTimeZone)
+	if err != nil {
+		em := fmt.Sprintf("display time zone %s - %v", config.DisplayTimeZone, err)
+		return nil, errors.New(em)
+	}
+	return location, nil
+}
+
 // connectionFailureLogged controls when a connection failure is
 // logged.
 var connectionFailureLogged = false
@@ -220,22 +313,62 @@ func (config *Config) WaitAndConnectToInput() io.Reader {
 	}
 }
 
+// listPorts lists the serial ports that the system knows about.  It's
+// replaced in tests.
+var listPorts = serial.GetPortsList
+
+// openPort opens a serial port.  It's replaced in tests.
+var openPort = func(name string, mode *serial.Mode) (serialPort, error) {
+	return serial.Open(name, mode)
+}
+
+// serialPort is the part of serial.Port that getInputFile uses.
+type serialPort interface {
+	io.ReadCloser
+	SetReadTimeout(t time.Duration) error
+}
+
+// timeoutReader reads from a serial port.  When a read times out, the port
+// returns nothing and no error.  timeoutReader turns that into an i/o
+// timeout error, which the file handler treats like the end of a file.
+type timeoutReader struct {
+	serialPort
+}
+
+// Read reads from the serial port.
+func (reader timeoutReader) Read(buffer []byte) (int, error) {
+	n, err := reader.serialPort.Read(buffer)
+	if n == 0 && err == nil {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
 // getInputFile returns a connection to the first file in the given list
-// that it can open for reading or nil if it can't open any file.  The
-// connection returned has a read deadline set given by the configuration.
+// that it can open for reading or nil if it can't open any file.  A name
+// that matches any of the serial ports that the serial library finds, on
+// any platform, is opened as a serial port with the parameters given by
+// the config.  Any other name is opened as an ordinary file.  The
+// connection returned has a read timeout given by the configuration.
 func (config *Config) getInputFile() io.Reader {
+	// If the ports can't be listed, the names can still be opened as files.
+	known, _ := listPorts()
+
 	for _, name := range config.Filenames {
+		for _, port := range serialin.FindPorts([]string{name}, known) {
+			reader := config.openSerialPort(port)
+			if reader != nil {
+				return reader
+			}
+		}
 
-		// Use https://github.com/tarm/serial
+		if serialin.IsPattern(name) {
+			continue
+		}
 
 		file, err := os.Open(name)
 		if err == nil {
-			logEntry := fmt.Sprintf("getInputFile: found %s", name)
-			if config.SystemLog != nil {
-				config.SystemLog.Println(logEntry)
-			} else {
-				log.Println(logEntry)
-			}
+			config.logFound(name)
 			// The file exists and we've just opened it for reading.
 			// Set the read deadline using the value given in the config.
 			deadline := time.Now().Add(config.ReadTimeout())
@@ -250,3 +383,36 @@ func (config *Config) getInputFile() io.Reader {
 	// The attempt to open every file in the list failed.
 	return nil
 }
+
+// openSerialPort opens the named serial port and sets its read timeout.  It
+// returns nil if the port can't be opened.
+func (config *Config) openSerialPort(name string) io.Reader {
+	// The mode was checked when the config was read.
+	mode, modeError := config.Serial.Mode()
+	if modeError != nil {
+		return nil
+	}
+	port, openError := openPort(name, mode)
+	if openError != nil {
+		return nil
+	}
+	// A zero timeout would make every read return at once, so it means
+	// wait for ever.
+	timeout := config.ReadTimeout()
+	if timeout == 0 {
+		timeout = serial.NoTimeout
+	}
+	port.SetReadTimeout(timeout)
+	config.logFound(name)
+	return timeoutReader{port}
+}
+
+// logFound logs the name of the input that getInputFile has opened.
+func (config *Config) logFound(name string) {
+	logEntry := fmt.Sprintf("getInputFile: found %s", name)
+	if config.SystemLog != nil {
+		config.SystemLog.Println(logEntry)
+	} else {
+		log.Println(logEntry)
+	}
+}
@@ -1,13 +1,116 @@
 package jsonconfig
 
 import (
+	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/goblimey/go-ntrip/config"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
 
 	"github.com/goblimey/go-tools/switchwriter"
 )
 
+// TestPositionPrecision checks that the position precision is read from the
+// JSON.
+func TestPositionPrecision(t *testing.T) {
+	reader := strings.NewReader(`{
+		"input": ["a"],
+		"position_precision_metres": 100
+	}`)
+
+	writer := switchwriter.New()
+	logger := log.New(writer, "jsonconfig_test", 0)
+
+	config, err := getJSONConfig(reader, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if config.PositionPrecisionMetres != 100 {
+		t.Errorf("want 100 got %f", config.PositionPrecisionMetres)
+	}
+}
+
+// TestDisplayLocation checks that the display time zone is loaded.
+func TestDisplayLocation(t *testing.T) {
+	var testData = []struct {
+		zone      string
+		want      string
+		wantError string
+	}{
+		{"", "", ""},
+		{"Europe/London", "Europe/London", ""},
+		{"Middle/Earth", "", "display time zone Middle/Earth - unknown time zone Middle/Earth"},
+	}
+	for _, td := range testData {
+		config := Config{DisplayTimeZone: td.zone}
+
+		location, err := config.DisplayLocation()
+
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("want error %s got %v", td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if len(td.want) == 0 {
+			if location != nil {
+				t.Errorf("want nil got %v", location)
+			}
+		} else if location == nil || location.String() != td.want {
+			t.Errorf("want %s got %v", td.want, location)
+		}
+	}
+}
+
+// TestStation checks that the station description is read from the JSON
+// and checked.
+func TestStation(t *testing.T) {
+	writer := switchwriter.New()
+	logger := log.New(writer, "jsonconfig_test", 0)
+
+	reader := strings.NewReader(`{
+		"input": ["a"],
+		"station": {
+			"name": "HOME",
+			"position": {"x": 1, "y": 2, "z": 3},
+			"antenna_model": "TRM59800.00     SCIS"
+		}
+	}`)
+
+	config, err := getJSONConfig(reader, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if config.Station == nil || config.Station.Name != "HOME" ||
+		config.Station.Position == nil || config.Station.Position.Z != 3 ||
+		config.Station.AntennaModel != "TRM59800.00     SCIS" {
+
+		t.Errorf("want the station, got %v", config.Station)
+	}
+
+	const wantError = "station - want a name"
+	_, badError := getJSONConfig(strings.NewReader(`{"station": {"operator": "me"}}`), logger)
+	if badError == nil || badError.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, badError)
+	}
+}
+
 // TestJSONControl tests that the correct data is produced when the
 // text from a JSON control file is unmarshalled.
 func TestGetJSONControl(t *testing.T) {
@@ -113,6 +216,82 @@ func TestGetJSONControl(t *testing.T) {
 	}
 }
 
+// TestGetJSONControlWithValidationPolicy checks that a validation policy
+// is read from the JSON.
+func TestGetJSONControlWithValidationPolicy(t *testing.T) {
+	reader := strings.NewReader(`{
+		"input": ["a"],
+		"validation_policy": {
+			"allow_reserved_bits": true,
+			"skip_crc_types": [{"first": 4000, "last": 4095}],
+			"pass_through_types": [{"first": 4072, "last": 4072}],
+			"discard_zero_padding": true
+		}
+	}`)
+
+	writer := switchwriter.New()
+	logger := log.New(writer, "jsonconfig_test", 0)
+
+	config, err := getJSONConfig(reader, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	policy := config.ValidationPolicy
+	if policy == nil {
+		t.Error("want a validation policy")
+		return
+	}
+
+	if !policy.AllowReservedBits {
+		t.Error("want reserved bits to be allowed")
+	}
+
+	if policy.CheckCRC(4001) {
+		t.Error("want CRC check to be skipped for type 4001")
+	}
+
+	if policy.Decode(4072) {
+		t.Error("want type 4072 to be passed through")
+	}
+
+	if !policy.DiscardPadding() {
+		t.Error("want padding to be discarded")
+	}
+}
+
+// TestFrameLimits checks that the frame limits are read from the JSON.
+func TestFrameLimits(t *testing.T) {
+	reader := strings.NewReader(`{
+		"input": ["a"],
+		"max_message_length": 4096,
+		"frame_timeout_milliseconds": 1500,
+		"resync_window": 64
+	}`)
+
+	writer := switchwriter.New()
+	logger := log.New(writer, "jsonconfig_test", 0)
+
+	config, err := getJSONConfig(reader, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := rtcm.FrameLimits{
+		MaxMessageLength: 4096,
+		FrameTimeout:     1500 * time.Millisecond,
+		ResyncWindow:     64,
+	}
+
+	got := config.FrameLimits()
+
+	if got != want {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
 // TestJSONControl tests that the correct data is produced when the
 // text from a JSON control file is unmarshalled.
 func TestGetJSONControlWithOneFile(t *testing.T) {
@@ -186,3 +365,120 @@ func TestSleepTimeAfterReadTimeout(t *testing.T) {
 		t.Errorf("want %d got %d", want, got)
 	}
 }
+
+// fakePort is a serial port that gives one read and then times out.
+type fakePort struct {
+	name    string
+	data    string
+	timeout time.Duration
+}
+
+func (port *fakePort) Read(buffer []byte) (int, error) {
+	n := copy(buffer, port.data)
+	port.data = port.data[n:]
+	return n, nil
+}
+
+func (port *fakePort) Close() error { return nil }
+
+func (port *fakePort) SetReadTimeout(t time.Duration) error {
+	port.timeout = t
+	return nil
+}
+
+// TestGetInputFile checks that getInputFile opens serial ports, including
+// Windows COM ports, through the serial library and other names as files.
+func TestGetInputFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "recording.rtcm")
+	if err := os.WriteFile(file, []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		listPorts = serial.GetPortsList
+		openPort = func(name string, mode *serial.Mode) (serialPort, error) {
+			return serial.Open(name, mode)
+		}
+	}()
+	var opened *fakePort
+	openPort = func(name string, mode *serial.Mode) (serialPort, error) {
+		if mode.BaudRate != 115200 {
+			t.Errorf("want speed 115200 got %d", mode.BaudRate)
+		}
+		opened = &fakePort{name: name, data: "port"}
+		return opened, nil
+	}
+
+	var testData = []struct {
+		description string
+		known       []string
+		filenames   []string
+		wantPort    string
+		wantData    string
+	}{
+		{"Linux", []string{"/dev/ttyACM0"}, []string{"/dev/ttyACM0"}, "/dev/ttyACM0", "port"},
+		{"Linux pattern", []string{"/dev/ttyS0", "/dev/ttyACM1"}, []string{"/dev/ttyACM*"}, "/dev/ttyACM1", "port"},
+		{"Windows", []string{"COM1", "COM4"}, []string{"com4"}, "COM4", "port"},
+		{"Windows device namespace", []string{"COM10"}, []string{`\\.\COM10`}, "COM10", "port"},
+		{"file", []string{"COM4"}, []string{"COM3", file}, "", "file"},
+		{"nothing", []string{"COM4"}, []string{"COM*3", "COM5"}, "", ""},
+	}
+	for _, td := range testData {
+		known := td.known
+		listPorts = func() ([]string, error) { return known, nil }
+		opened = nil
+		inputConfig := Config{
+			Filenames:               td.filenames,
+			Serial:                  config.Serial{Speed: 115200},
+			ReadTimeoutMilliSeconds: 1000,
+			SystemLog:               log.New(switchwriter.New(), "", 0),
+		}
+
+		reader := inputConfig.getInputFile()
+		if len(td.wantData) == 0 {
+			if reader != nil {
+				t.Errorf("%s: want nil got a reader", td.description)
+			}
+			continue
+		}
+		if reader == nil {
+			t.Errorf("%s: want a reader got nil", td.description)
+			continue
+		}
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		gotPort := ""
+		if opened != nil {
+			gotPort = opened.name
+			if opened.timeout != time.Second {
+				t.Errorf("%s: want timeout 1s got %v", td.description, opened.timeout)
+			}
+		}
+		if gotPort != td.wantPort {
+			t.Errorf("%s: want port %q got %q", td.description, td.wantPort, gotPort)
+		}
+
+		buffer := make([]byte, 10)
+		n, _ := reader.Read(buffer)
+		if string(buffer[:n]) != td.wantData {
+			t.Errorf("%s: want %s got %s", td.description, td.wantData, string(buffer[:n]))
+		}
+	}
+}
+
+// TestTimeoutReader checks that a serial read that times out gives an i/o
+// timeout error, as a file with a read deadline does.
+func TestTimeoutReader(t *testing.T) {
+	reader := timeoutReader{&fakePort{data: "a"}}
+	buffer := make([]byte, 10)
+	n, err := reader.Read(buffer)
+	if n != 1 || err != nil {
+		t.Errorf("want 1, nil got %d, %v", n, err)
+	}
+	n, err = reader.Read(buffer)
+	if n != 0 || err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("want 0, i/o timeout got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,237 @@
+// The leapseconds package keeps the history of leap seconds so that a GPS
+// time can be converted to UTC for any date, not just for dates since the
+// last leap second.
+//
+// GPS time doesn't have leap seconds.  When it started at the beginning of
+// 1980 it agreed with UTC, but every leap second since then has put it
+// another second ahead.  Since the start of 2017 it's been 18 seconds
+// ahead.  Galileo, QZSS and SBAS keep GPS time, and Beidou time is a fixed 14
+// seconds behind GPS time, so all of them have moved against UTC in the same
+// way.  (GLONASS keeps UTC, so it's not affected.)
+//
+// The history is a Table.  The package has one built in, taken from the
+// leap-seconds.list file that the IERS publishes.  When a new leap second
+// is announced, an up to date copy of that file can be downloaded from
+// https://hpiers.obspm.fr/iers/bul/bulc/ntp/leap-seconds.list and loaded
+// in place of the built in table:
+//
+//	table, err := leapseconds.Load("/etc/leap-seconds.list")
+//	...
+//	leapseconds.SetDefault(table)
+//
+// The RTCM handler uses the default table, so the application should load
+// the file before it creates any handlers.
+package leapseconds
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// taiAheadOfGPS is the time that International Atomic Time (TAI) is ahead
+// of GPS time.  The IERS file gives the offsets between TAI and UTC.
+const taiAheadOfGPS = 19
+
+// BeidouBehindGPS is the time that Beidou time is behind GPS time.  It
+// doesn't change.
+const BeidouBehindGPS = 14 * time.Second
+
+// ntpEpoch is the origin of the times in the IERS file, the start of 1900.
+var ntpEpoch = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+//go:embed leap-seconds.list
+var embeddedList string
+
+// Leap is an entry in the table.
+type Leap struct {
+	// Time is the time in UTC from which the offset applies.
+	Time time.Time
+
+	// TAIMinusUTC is the number of seconds that TAI is ahead of UTC from
+	// that time on.
+	TAIMinusUTC int
+}
+
+// GPSMinusUTC gives the time that GPS time is ahead of UTC from the time
+// of the leap on.
+func (leap *Leap) GPSMinusUTC() time.Duration {
+	return time.Duration(leap.TAIMinusUTC-taiAheadOfGPS) * time.Second
+}
+
+// Table is the history of leap seconds.  It's safe for concurrent use.
+type Table struct {
+	// leaps is the list of entries, in time order.
+	leaps []Leap
+}
+
+// New creates a Table from a list of entries, which must be in time order.
+func New(leaps []Leap) (*Table, error) {
+	return newTable(leaps, "leapseconds - ")
+}
+
+// newTable creates a Table from a list of entries.  The prefix starts any
+// error message.
+func newTable(leaps []Leap, prefix string) (*Table, error) {
+	if len(leaps) == 0 {
+		return nil, errors.New(prefix + "no entries")
+	}
+	for i := 1; i < len(leaps); i++ {
+		if !leaps[i].Time.After(leaps[i-1].Time) {
+			em := fmt.Sprintf("%sentry %d (%s) is not after the one before",
+				prefix, i+1, leaps[i].Time.Format("2006-01-02"))
+			return nil, errors.New(em)
+		}
+	}
+
+	table := Table{leaps: make([]Leap, len(leaps))}
+	copy(table.leaps, leaps)
+	return &table, nil
+}
+
+// Parse reads a table in the format of the IERS file leap-seconds.list.
+// Each line gives the time of a leap as seconds since the start of 1900
+// followed by the offset between TAI and UTC in seconds from then on.
+// Anything after a "#" is a comment.
+func Parse(reader io.Reader) (*Table, error) {
+	return parse(reader, "leapseconds - ")
+}
+
+// parse reads a table.  The prefix starts any error message.
+func parse(reader io.Reader, prefix string) (*Table, error) {
+	leaps := make([]Leap, 0)
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			em := fmt.Sprintf("%sline %d - want the time and the offset, got %q",
+				prefix, lineNumber, strings.TrimSpace(line))
+			return nil, errors.New(em)
+		}
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || seconds < 0 {
+			em := fmt.Sprintf("%sline %d - bad time %q", prefix, lineNumber, fields[0])
+			return nil, errors.New(em)
+		}
+		offset, err := strconv.Atoi(fields[1])
+		if err != nil {
+			em := fmt.Sprintf("%sline %d - bad offset %q", prefix, lineNumber, fields[1])
+			return nil, errors.New(em)
+		}
+		leap := Leap{
+			Time:        ntpEpoch.Add(time.Duration(seconds) * time.Second),
+			TAIMinusUTC: offset,
+		}
+		leaps = append(leaps, leap)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(prefix + err.Error())
+	}
+
+	return newTable(leaps, prefix)
+}
+
+// Load reads a table from the named file.  See Parse.
+func Load(fileName string) (*Table, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		em := fmt.Sprintf("leapseconds - cannot open %s - %v", fileName, err)
+		return nil, errors.New(em)
+	}
+	defer file.Close()
+
+	return parse(file, "leapseconds - "+fileName+" - ")
+}
+
+// Embedded returns the table built into the package.
+func Embedded() *Table {
+	return embedded
+}
+
+// embedded is the table built into the package.
+var embedded = mustParse(embeddedList)
+
+// mustParse parses a table that's known to be good.
+func mustParse(list string) *Table {
+	table, err := Parse(strings.NewReader(list))
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// defaultTable is the table returned by Default.
+var defaultTable = embedded
+
+// defaultMutex protects defaultTable.
+var defaultMutex sync.Mutex
+
+// Default returns the table that the other packages use, which is the
+// built in table unless SetDefault has been called.
+func Default() *Table {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	return defaultTable
+}
+
+// SetDefault replaces the table that Default returns.  nil restores the
+// built in table.
+func SetDefault(table *Table) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	if table == nil {
+		table = embedded
+	}
+	defaultTable = table
+}
+
+// Last returns the latest entry in the table.
+func (table *Table) Last() Leap {
+	return table.leaps[len(table.leaps)-1]
+}
+
+// GPSMinusUTC gives the time that GPS time was ahead of UTC at the given
+// time.  Before the first entry in the table it gives the offset of the
+// first entry.
+func (table *Table) GPSMinusUTC(t time.Time) time.Duration {
+	// Find the first entry after the time.  The one before it applies.
+	i := sort.Search(len(table.leaps), func(i int) bool {
+		return table.leaps[i].Time.After(t)
+	})
+	if i > 0 {
+		i--
+	}
+	return table.leaps[i].GPSMinusUTC()
+}
+
+// UTC converts a GPS time to UTC.  The GPS time is given as a time.Time in
+// the UTC location, so for example midnight GPS time at the start of Sunday
+// 1st January 2017 is given as time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+// and converts to 23:59:43 on the Saturday before.
+func (table *Table) UTC(gpsTime time.Time) time.Time {
+	// Find the first entry that took effect after the time, in GPS terms.
+	// The one before it applies.
+	i := sort.Search(len(table.leaps), func(i int) bool {
+		leap := table.leaps[i]
+		return leap.Time.Add(leap.GPSMinusUTC()).After(gpsTime)
+	})
+	if i > 0 {
+		i--
+	}
+	return gpsTime.Add(-1 * table.leaps[i].GPSMinusUTC())
+}
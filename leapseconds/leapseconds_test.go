@@ -0,0 +1,165 @@
+package leapseconds
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEmbedded checks the built in table against some well known values.
+func TestEmbedded(t *testing.T) {
+	var testData = []struct {
+		utc  time.Time
+		want time.Duration
+	}{
+		{time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(1999, time.August, 22, 0, 0, 0, 0, time.UTC), 13 * time.Second},
+		{time.Date(2016, time.December, 31, 23, 59, 59, 0, time.UTC), 17 * time.Second},
+		{time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), 18 * time.Second},
+		{time.Date(2023, time.May, 12, 0, 0, 0, 0, time.UTC), 18 * time.Second},
+		// Before the first entry the first offset applies.
+		{time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC), -9 * time.Second},
+	}
+	table := Embedded()
+	for _, td := range testData {
+		got := table.GPSMinusUTC(td.utc)
+		if td.want != got {
+			t.Errorf("%s: want %v got %v", td.utc.Format(time.RFC3339), td.want, got)
+		}
+	}
+
+	last := table.Last()
+	if !last.Time.Equal(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)) || last.TAIMinusUTC != 37 {
+		t.Errorf("unexpected last entry %+v", last)
+	}
+}
+
+// TestUTC checks the conversion of GPS time to UTC either side of a leap
+// second.
+func TestUTC(t *testing.T) {
+	var testData = []struct {
+		gps  time.Time
+		want time.Time
+	}{
+		// The leap second at the end of 2016 was 23:59:60 UTC, which was
+		// 00:00:17 GPS time.
+		{
+			time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2016, time.December, 31, 23, 59, 43, 0, time.UTC),
+		},
+		{
+			time.Date(2017, time.January, 1, 0, 0, 16, 0, time.UTC),
+			time.Date(2016, time.December, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			time.Date(2017, time.January, 1, 0, 0, 18, 0, time.UTC),
+			time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2012, time.March, 4, 0, 0, 0, 0, time.UTC),
+			time.Date(2012, time.March, 3, 23, 59, 45, 0, time.UTC),
+		},
+		{
+			time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC),
+			time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	table := Embedded()
+	for _, td := range testData {
+		got := table.UTC(td.gps)
+		if !td.want.Equal(got) {
+			t.Errorf("%s: want %s got %s", td.gps.Format(time.RFC3339),
+				td.want.Format(time.RFC3339), got.Format(time.RFC3339))
+		}
+	}
+}
+
+// TestParse checks that a table is read and that errors are reported.
+func TestParse(t *testing.T) {
+	var testData = []struct {
+		description string
+		list        string
+		wantLast    Leap
+		wantError   string
+	}{
+		{"good", "#$ 3676924800\n\n3644697600\t36\t# 1 Jul 2015\n3692217600 37\n4000000000 38 # made up\n",
+			Leap{Time: time.Date(2026, time.October, 3, 7, 6, 40, 0, time.UTC), TAIMinusUTC: 38}, ""},
+		{"empty", "# nothing\n", Leap{},
+			"leapseconds - no entries"},
+		{"one field", "3692217600\n", Leap{},
+			`leapseconds - line 1 - want the time and the offset, got "3692217600"`},
+		{"bad time", "# comment\nJan 37\n", Leap{},
+			`leapseconds - line 2 - bad time "Jan"`},
+		{"bad offset", "3692217600 x\n", Leap{},
+			`leapseconds - line 1 - bad offset "x"`},
+		{"out of order", "3692217600 37\n3644697600 36\n", Leap{},
+			"leapseconds - entry 2 (2015-07-01) is not after the one before"},
+	}
+	for _, td := range testData {
+		table, err := Parse(strings.NewReader(td.list))
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		got := table.Last()
+		if !td.wantLast.Time.Equal(got.Time) || td.wantLast.TAIMinusUTC != got.TAIMinusUTC {
+			t.Errorf("%s: want %+v got %+v", td.description, td.wantLast, got)
+		}
+	}
+}
+
+// TestLoadAndSetDefault checks that a table can be loaded from a file and
+// made the default, and that nil restores the built in table.
+func TestLoadAndSetDefault(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "leap-seconds.list")
+	// A leap second on 1st January 2027, which hasn't been announced.
+	list := "3692217600 37\n4007750400 38\n"
+	if err := os.WriteFile(fileName, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(table)
+	defer SetDefault(nil)
+
+	after := time.Date(2027, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if got := Default().GPSMinusUTC(after); got != 19*time.Second {
+		t.Errorf("want 19s got %v", got)
+	}
+
+	SetDefault(nil)
+	if Default() != Embedded() {
+		t.Error("want the built in table after SetDefault(nil)")
+	}
+}
+
+// TestLoadErrors checks the errors from Load.
+func TestLoadErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err := Load(missing)
+	wantPrefix := "leapseconds - cannot open " + missing + " - "
+	if err == nil || !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("want %q... got %v", wantPrefix, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad")
+	if err := os.WriteFile(bad, []byte("3692217600 x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(bad)
+	want := "leapseconds - " + bad + ` - line 1 - bad offset "x"`
+	if err == nil || err.Error() != want {
+		t.Errorf("want %s got %v", want, err)
+	}
+}
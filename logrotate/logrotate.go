@@ -0,0 +1,359 @@
+// The logrotate package provides a log file writer that starts a new file
+// each day or each hour, and can compress the old files and delete them
+// when they're too old.
+//
+// It's a drop-in replacement for go-tools' dailylogger, which can't do the
+// last three things:
+//
+//	writer := logrotate.New("logs", "rtcmfilter.", ".log")
+//
+// writes to files such as logs/rtcmfilter.2024-08-31.log, starting a new one
+// each day.  With options:
+//
+//	writer := logrotate.NewWithOptions("rtcmlog", "data.", ".rtcm", logrotate.Options{
+//	    Period:    logrotate.Hourly,
+//	    Compress:  true,
+//	    Retention: 30 * 24 * time.Hour,
+//	})
+//
+// it writes to files such as rtcmlog/data.2024-08-31-14.rtcm, compresses
+// each file with gzip when it's finished with it (giving
+// data.2024-08-31-13.rtcm.gz) and deletes the files more than 30 days old.
+//
+// The file is changed on the first write after the end of its period, so
+// there is no file for a period in which nothing was written.  The times are
+// local times from the writer's clock, which can be replaced for testing
+// using NewWithClock.
+package logrotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-tools/clock"
+)
+
+// Period is the length of time covered by each log file.
+type Period int
+
+const (
+	// Daily starts a new file at midnight.
+	Daily Period = iota
+
+	// Hourly starts a new file on the hour.
+	Hourly
+)
+
+// The layouts of the datestamps in the file names.
+const (
+	dailyLayout  = "2006-01-02"
+	hourlyLayout = "2006-01-02-15"
+)
+
+// compressedSuffix is added to the name of a compressed file.
+const compressedSuffix = ".gz"
+
+// Options controls the rotation, compression and retention of the files.
+// The zero value gives daily files that are kept for ever, uncompressed.
+type Options struct {
+	// Period is the time covered by each file.
+	Period Period
+
+	// Compress says that each file is compressed with gzip once the writer
+	// has moved on to the next one.
+	Compress bool
+
+	// Retention is the time for which files are kept, measured from the
+	// end of the period that each covers.  Zero means for ever.
+	Retention time.Duration
+}
+
+// Writer writes to a log file, changing the file at the end of each period.
+type Writer struct {
+	directory string
+	leader    string
+	trailer   string
+	options   Options
+
+	// clock gives the time.  It's the system clock in production.
+	clock clock.Clock
+
+	// file is the current log file.  It's nil if it couldn't be opened.
+	file *os.File
+
+	// periodStart and periodEnd are the start and end of the period
+	// covered by the current file.
+	periodStart time.Time
+	periodEnd   time.Time
+
+	// disabled is true if logging is turned off.
+	disabled bool
+
+	// housekeeping waits for the compression and retention to finish.
+	housekeeping sync.WaitGroup
+
+	// The mutex controls access to the fields above.
+	mutex sync.Mutex
+}
+
+var _ io.WriteCloser = (*Writer)(nil)
+
+// New creates a Writer that writes daily log files in the given directory,
+// creating it if necessary.  The name of each file is the leader, the date
+// and the trailer.  An empty directory means the current directory, an empty
+// leader "daily." and an empty trailer ".log", as with dailylogger.
+func New(directory, leader, trailer string) *Writer {
+	return NewWithOptions(directory, leader, trailer, Options{})
+}
+
+// NewWithOptions creates a Writer with the given options.
+func NewWithOptions(directory, leader, trailer string, options Options) *Writer {
+	return NewWithClock(clock.NewSystemClock(), directory, leader, trailer, options)
+}
+
+// NewWithClock creates a Writer that gets the time from the given clock, for
+// testing.
+func NewWithClock(cl clock.Clock, directory, leader, trailer string, options Options) *Writer {
+	if len(directory) == 0 {
+		directory = "."
+	}
+	if len(leader) == 0 {
+		leader = "daily."
+	}
+	if len(trailer) == 0 {
+		trailer = ".log"
+	}
+
+	writer := Writer{
+		directory: directory,
+		leader:    leader,
+		trailer:   trailer,
+		options:   options,
+		clock:     cl,
+	}
+
+	mkdirError := os.MkdirAll(directory, os.ModePerm)
+	if mkdirError != nil {
+		log.Printf("logrotate - cannot create log directory %s - %v", directory, mkdirError)
+	}
+
+	writer.mutex.Lock()
+	writer.open(cl.Now())
+	writer.mutex.Unlock()
+
+	// Tidy up after the last run.
+	writer.startHousekeeping("")
+
+	return &writer
+}
+
+// Write writes the data to the log file, changing to a new file first if
+// the current one's period has ended.
+func (writer *Writer) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.disabled {
+		return 0, nil
+	}
+
+	now := writer.clock.Now()
+	if !now.Before(writer.periodEnd) || now.Before(writer.periodStart) {
+		writer.rotate(now)
+	}
+
+	if writer.file == nil {
+		return 0, errors.New("logrotate - no log file")
+	}
+
+	return writer.file.Write(data)
+}
+
+// EnableLogging turns logging on.  It's on by default.
+func (writer *Writer) EnableLogging() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.disabled = false
+}
+
+// DisableLogging turns logging off.  Writes succeed but nothing is written.
+func (writer *Writer) DisableLogging() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.disabled = true
+}
+
+// Close closes the current file and waits for any compression or deletion
+// of old files to finish.  The current file is not compressed.
+func (writer *Writer) Close() error {
+	writer.mutex.Lock()
+	var closeError error
+	if writer.file != nil {
+		closeError = writer.file.Close()
+		writer.file = nil
+	}
+	writer.mutex.Unlock()
+
+	writer.housekeeping.Wait()
+	return closeError
+}
+
+// rotate closes the current file, opens the file for the period containing
+// the given time and starts the housekeeping.  The caller must hold the
+// mutex.
+func (writer *Writer) rotate(now time.Time) {
+	finished := ""
+	if writer.file != nil {
+		finished = writer.file.Name()
+		writer.file.Close()
+		writer.file = nil
+	}
+
+	writer.open(now)
+
+	if finished == writer.pathname(writer.periodStart) {
+		// The clock went backwards within the period.  Keep the file.
+		finished = ""
+	}
+	writer.startHousekeeping(finished)
+}
+
+// open opens the file for the period containing the given time, appending
+// to it if it exists.  The caller must hold the mutex.
+func (writer *Writer) open(now time.Time) {
+	writer.periodStart, writer.periodEnd = writer.period(now)
+
+	name := writer.pathname(writer.periodStart)
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("logrotate - cannot open log file %s - %v", name, err)
+		return
+	}
+	writer.file = file
+}
+
+// period returns the start and end of the period containing the given time.
+func (writer *Writer) period(t time.Time) (time.Time, time.Time) {
+	if writer.options.Period == Hourly {
+		start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		return start, start.Add(time.Hour)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// layout returns the layout of the datestamp in the file names.
+func (writer *Writer) layout() string {
+	if writer.options.Period == Hourly {
+		return hourlyLayout
+	}
+	return dailyLayout
+}
+
+// pathname returns the pathname of the file for the period starting at the
+// given time.
+func (writer *Writer) pathname(start time.Time) string {
+	return filepath.Join(writer.directory, writer.leader+start.Format(writer.layout())+writer.trailer)
+}
+
+// startHousekeeping compresses the finished file, if there is one and the
+// options ask for it, and deletes the old files, in the background.
+func (writer *Writer) startHousekeeping(finished string) {
+	compress := writer.options.Compress && len(finished) > 0
+	if !compress && writer.options.Retention <= 0 {
+		return
+	}
+
+	now := writer.clock.Now()
+	writer.housekeeping.Add(1)
+	go func() {
+		defer writer.housekeeping.Done()
+		if compress {
+			if err := compressFile(finished); err != nil {
+				log.Printf("logrotate - %v", err)
+			}
+		}
+		if writer.options.Retention > 0 {
+			writer.deleteOldFiles(now)
+		}
+	}()
+}
+
+// deleteOldFiles deletes the files whose periods ended more than the
+// retention time before the given time.
+func (writer *Writer) deleteOldFiles(now time.Time) {
+	entries, readError := ioutil.ReadDir(writer.directory)
+	if readError != nil {
+		log.Printf("logrotate - %v", readError)
+		return
+	}
+
+	cutoff := now.Add(-1 * writer.options.Retention)
+	for _, entry := range entries {
+		start, ok := writer.periodStartFromName(entry.Name(), now.Location())
+		if !ok {
+			continue
+		}
+		_, end := writer.period(start)
+		if end.Before(cutoff) {
+			name := filepath.Join(writer.directory, entry.Name())
+			if err := os.Remove(name); err != nil {
+				log.Printf("logrotate - %v", err)
+			}
+		}
+	}
+}
+
+// periodStartFromName gets the start of the period from the name of one of
+// the writer's files, compressed or not, in the given time zone.  It returns
+// false if the name is not one of the writer's.
+func (writer *Writer) periodStartFromName(name string, location *time.Location) (time.Time, bool) {
+	name = strings.TrimSuffix(name, compressedSuffix)
+	if !strings.HasPrefix(name, writer.leader) || !strings.HasSuffix(name, writer.trailer) {
+		return time.Time{}, false
+	}
+	stamp := name[len(writer.leader) : len(name)-len(writer.trailer)]
+	start, err := time.ParseInLocation(writer.layout(), stamp, location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// compressFile compresses the named file with gzip, replacing it with a
+// file with ".gz" on the end of its name.
+func compressFile(name string) error {
+	in, openError := os.Open(name)
+	if openError != nil {
+		return openError
+	}
+	defer in.Close()
+
+	out, createError := os.Create(name + compressedSuffix)
+	if createError != nil {
+		return createError
+	}
+
+	zipper := gzip.NewWriter(out)
+	_, copyError := io.Copy(zipper, in)
+	zipError := zipper.Close()
+	closeError := out.Close()
+	for _, err := range []error{copyError, zipError, closeError} {
+		if err != nil {
+			os.Remove(name + compressedSuffix)
+			em := fmt.Sprintf("cannot compress %s - %v", name, err)
+			return errors.New(em)
+		}
+	}
+
+	return os.Remove(name)
+}
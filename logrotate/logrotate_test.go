@@ -0,0 +1,190 @@
+package logrotate
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/goblimey/go-tools/clock"
+)
+
+// newTestClock returns a stopped clock set to the given time.
+func newTestClock(t time.Time) *clock.StoppedClock {
+	return clock.NewStoppedClock(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+		t.Second(), t.Nanosecond(), t.Location()).(*clock.StoppedClock)
+}
+
+// readFiles returns the contents of the files in the directory by name,
+// decompressing those that are compressed.
+func readFiles(t *testing.T, directory string) map[string]string {
+	t.Helper()
+
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		file, openError := os.Open(filepath.Join(directory, entry.Name()))
+		if openError != nil {
+			t.Fatal(openError)
+		}
+		var contents []byte
+		var readError error
+		if filepath.Ext(entry.Name()) == compressedSuffix {
+			zipReader, zipError := gzip.NewReader(file)
+			if zipError != nil {
+				t.Fatal(zipError)
+			}
+			contents, readError = ioutil.ReadAll(zipReader)
+		} else {
+			contents, readError = ioutil.ReadAll(file)
+		}
+		file.Close()
+		if readError != nil {
+			t.Fatal(readError)
+		}
+		files[entry.Name()] = string(contents)
+	}
+	return files
+}
+
+// TestRotation checks that a new file is started at the end of each period.
+func TestRotation(t *testing.T) {
+	var testData = []struct {
+		description string
+		options     Options
+		times       []time.Time
+		want        map[string]string
+	}{
+		{
+			"daily",
+			Options{},
+			[]time.Time{
+				time.Date(2024, time.August, 31, 23, 59, 0, 0, time.UTC),
+				time.Date(2024, time.August, 31, 23, 59, 59, 0, time.UTC),
+				time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+			},
+			map[string]string{
+				"data.2024-08-31.rtcm": "01",
+				"data.2024-09-01.rtcm": "2",
+			},
+		},
+		{
+			"hourly",
+			Options{Period: Hourly},
+			[]time.Time{
+				time.Date(2024, time.August, 31, 13, 30, 0, 0, time.UTC),
+				time.Date(2024, time.August, 31, 14, 0, 0, 0, time.UTC),
+				time.Date(2024, time.August, 31, 16, 5, 0, 0, time.UTC),
+			},
+			map[string]string{
+				"data.2024-08-31-13.rtcm": "0",
+				"data.2024-08-31-14.rtcm": "1",
+				"data.2024-08-31-16.rtcm": "2",
+			},
+		},
+		{
+			"hourly compressed",
+			Options{Period: Hourly, Compress: true},
+			[]time.Time{
+				time.Date(2024, time.August, 31, 13, 30, 0, 0, time.UTC),
+				time.Date(2024, time.August, 31, 14, 0, 0, 0, time.UTC),
+			},
+			map[string]string{
+				"data.2024-08-31-13.rtcm.gz": "0",
+				"data.2024-08-31-14.rtcm":    "1",
+			},
+		},
+	}
+	for _, td := range testData {
+		directory := t.TempDir()
+		cl := newTestClock(td.times[0])
+		writer := NewWithClock(cl, directory, "data.", ".rtcm", td.options)
+
+		for i, now := range td.times {
+			cl.SetTime(now)
+			_, err := writer.Write([]byte{byte('0' + i)})
+			if err != nil {
+				t.Fatalf("%s: %v", td.description, err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("%s: %v", td.description, err)
+		}
+
+		got := readFiles(t, directory)
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestRetention checks that old files are deleted, compressed or not, and
+// other files are left alone.
+func TestRetention(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{
+		"data.2024-08-01.rtcm",
+		"data.2024-08-19.rtcm.gz",
+		"data.2024-08-25.rtcm",
+		"data.junk.rtcm",
+		"other.2024-08-01.rtcm",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cl := newTestClock(time.Date(2024, time.August, 31, 12, 0, 0, 0, time.UTC))
+	writer := NewWithClock(cl, directory, "data.", ".rtcm", Options{Retention: 10 * 24 * time.Hour})
+	writer.Close()
+
+	want := []string{
+		"data.2024-08-25.rtcm",
+		"data.2024-08-31.rtcm",
+		"data.junk.rtcm",
+		"other.2024-08-01.rtcm",
+	}
+
+	var got []string
+	for name := range readFiles(t, directory) {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestDisableLogging checks that nothing is written while logging is off.
+func TestDisableLogging(t *testing.T) {
+	directory := t.TempDir()
+	cl := newTestClock(time.Date(2024, time.August, 31, 12, 0, 0, 0, time.UTC))
+	writer := NewWithClock(cl, directory, "", "", Options{})
+
+	writer.Write([]byte("a"))
+	writer.DisableLogging()
+	n, err := writer.Write([]byte("b"))
+	if n != 0 || err != nil {
+		t.Errorf("want 0 and no error got %d and %v", n, err)
+	}
+	writer.EnableLogging()
+	writer.Write([]byte("c"))
+	writer.Close()
+
+	// The default leader and trailer are those of dailylogger.
+	want := map[string]string{"daily.2024-08-31.log": "ac"}
+	got := readFiles(t, directory)
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,261 @@
+// The maintenance package handles scheduled maintenance windows.
+//
+// A long-running process such as the rtcmfilter can be given a set of
+// windows, each on some days of the week at a given time for a given
+// duration.  During a window, notifications of critical events are
+// suppressed, so a planned restart of the receiver or a router doesn't
+// wake anybody up.  A window can also run a command when it starts, for
+// example a script that uploads the logs or resets the receiver.  Doing that
+// from inside the process rather than from cron avoids the two fighting.
+// A window without a command gives quiet hours.
+//
+//	schedule, err := maintenance.New(config.MaintenanceWindows, logger)
+//	...
+//	if schedule.InWindow(time.Now()) { ... }
+//	go schedule.Run(nil)
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+)
+
+// CheckInterval is the time between checks for the start of a window when
+// the schedule is running.
+const CheckInterval = 30 * time.Second
+
+// Window is the config of a maintenance window, as it appears in an
+// application's JSON config file, for example:
+//
+//	"maintenance_windows": [
+//	    {
+//	        "days": ["Sunday"],
+//	        "start": "02:00",
+//	        "duration_minutes": 30,
+//	        "command": ["/usr/local/bin/upload-logs", "rtcmlog"]
+//	    },
+//	    {
+//	        "start": "23:00",
+//	        "duration_minutes": 480
+//	    }
+//	]
+//
+// The first window runs a command at 2am every Sunday.  The second gives
+// quiet hours every night.
+type Window struct {
+	// Days lists the days of the week on which the window starts, for
+	// example "Sunday".  Empty means every day.
+	Days []string `json:"days"`
+
+	// Start is the time of day at which the window starts, as "HH:MM" in
+	// the local time of the machine.
+	Start string `json:"start"`
+
+	// DurationMinutes is the length of the window.  A window may run past
+	// midnight.
+	DurationMinutes uint `json:"duration_minutes"`
+
+	// Command is an optional command and its arguments, run when the window
+	// starts.
+	Command []string `json:"command"`
+}
+
+// window is a Window in the form used by the Schedule.
+type window struct {
+	// days says which days of the week the window starts on.
+	days [7]bool
+
+	// start is the time after midnight at which the window starts.
+	start time.Duration
+
+	// duration is the length of the window.
+	duration time.Duration
+
+	// command is the command to run at the start of the window.
+	command []string
+
+	// lastRun is the start of the occurrence of the window for which the
+	// command was last run.
+	lastRun time.Time
+}
+
+// Schedule holds the maintenance windows.
+type Schedule struct {
+	windows []*window
+
+	// location is the time zone in which the windows are defined.
+	location *time.Location
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// now returns the current time.  It's a variable to support testing.
+	now func() time.Time
+
+	// runCommand runs a command.  It's a variable to support testing.
+	runCommand func(command []string) ([]byte, error)
+
+	// The mutex controls access to the lastRun times.
+	mutex sync.Mutex
+}
+
+// New creates a Schedule from the config.  The logger may be nil.
+func New(windows []Window, logger *log.Logger) (*Schedule, error) {
+	schedule := Schedule{
+		location:   time.Local,
+		logger:     logger,
+		now:        time.Now,
+		runCommand: runCommand,
+	}
+
+	for i, config := range windows {
+		w, err := parseWindow(config)
+		if err != nil {
+			em := fmt.Sprintf("maintenance window %d - %v", i+1, err)
+			return nil, errors.New(em)
+		}
+		schedule.windows = append(schedule.windows, w)
+	}
+
+	return &schedule, nil
+}
+
+// InWindow returns true if the given time is inside a maintenance window.
+func (schedule *Schedule) InWindow(t time.Time) bool {
+	for _, w := range schedule.windows {
+		if _, in := schedule.occurrence(w, t); in {
+			return true
+		}
+	}
+	return false
+}
+
+// Check runs the command of any window that has started since the last
+// check.  The command of each occurrence of a window is only run once.
+func (schedule *Schedule) Check() {
+	now := schedule.now()
+
+	for _, w := range schedule.windows {
+		if len(w.command) == 0 {
+			continue
+		}
+
+		start, in := schedule.occurrence(w, now)
+		if !in {
+			continue
+		}
+
+		schedule.mutex.Lock()
+		alreadyRun := w.lastRun.Equal(start)
+		w.lastRun = start
+		schedule.mutex.Unlock()
+
+		if alreadyRun {
+			continue
+		}
+
+		eventlog.Printf(schedule.logger, "maintenance window started - running %s",
+			strings.Join(w.command, " "))
+		output, err := schedule.runCommand(w.command)
+		if err != nil {
+			eventlog.Println(schedule.logger, fmt.Sprintf("maintenance command failed - %v - %s",
+				err, strings.TrimSpace(string(output))))
+		}
+	}
+}
+
+// Run calls Check at intervals until the stop channel is closed.  If the
+// channel is nil, it runs forever.  It can be run in a goroutine.
+func (schedule *Schedule) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			schedule.Check()
+		}
+	}
+}
+
+// occurrence returns the start of the occurrence of the window that contains
+// the given time and true, or false if the time is outside the window.
+func (schedule *Schedule) occurrence(w *window, t time.Time) (time.Time, bool) {
+	t = t.In(schedule.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, schedule.location)
+
+	// The window may have started today or, if it runs past midnight, on
+	// an earlier day.
+	for daysBack := 0; time.Duration(daysBack)*24*time.Hour <= w.start+w.duration; daysBack++ {
+		day := midnight.AddDate(0, 0, -daysBack)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		start := day.Add(w.start)
+		if !t.Before(start) && t.Before(start.Add(w.duration)) {
+			return start, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// parseWindow checks a Window and converts it to a window.
+func parseWindow(config Window) (*window, error) {
+	var w window
+
+	if len(config.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, name := range config.Days {
+		day, ok := parseDay(name)
+		if !ok {
+			em := fmt.Sprintf("day %q - want Monday, Tuesday ...", name)
+			return nil, errors.New(em)
+		}
+		w.days[day] = true
+	}
+
+	var hour, minute int
+	n, _ := fmt.Sscanf(config.Start, "%d:%d", &hour, &minute)
+	if n != 2 || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		em := fmt.Sprintf("start %q - want HH:MM", config.Start)
+		return nil, errors.New(em)
+	}
+	w.start = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+
+	if config.DurationMinutes == 0 {
+		return nil, errors.New("duration_minutes must be more than 0")
+	}
+	w.duration = time.Duration(config.DurationMinutes) * time.Minute
+
+	w.command = config.Command
+
+	return &w, nil
+}
+
+// parseDay converts the name of a day of the week, in any case, to a Weekday.
+func parseDay(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// runCommand runs a command and returns its combined output.
+func runCommand(command []string) ([]byte, error) {
+	return exec.Command(command[0], command[1:]...).CombinedOutput()
+}
@@ -0,0 +1,128 @@
+package maintenance
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewWithBadConfig checks that New rejects bad windows.
+func TestNewWithBadConfig(t *testing.T) {
+	var testData = []struct {
+		window    Window
+		wantError string
+	}{
+		{Window{Days: []string{"Funday"}, Start: "02:00", DurationMinutes: 10},
+			`maintenance window 1 - day "Funday" - want Monday, Tuesday ...`},
+		{Window{Start: "2am", DurationMinutes: 10},
+			`maintenance window 1 - start "2am" - want HH:MM`},
+		{Window{Start: "24:00", DurationMinutes: 10},
+			`maintenance window 1 - start "24:00" - want HH:MM`},
+		{Window{Start: "02:00"},
+			"maintenance window 1 - duration_minutes must be more than 0"},
+	}
+	for _, td := range testData {
+		_, err := New([]Window{td.window}, nil)
+		if err == nil {
+			t.Errorf("want error %s", td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("want error %s got %s", td.wantError, err.Error())
+		}
+	}
+}
+
+// TestInWindow checks that InWindow recognises times inside the windows.
+func TestInWindow(t *testing.T) {
+	windows := []Window{
+		{Days: []string{"sunday"}, Start: "02:00", DurationMinutes: 30},
+		// Every night from 23:00 to 01:00.
+		{Start: "23:00", DurationMinutes: 120},
+	}
+	schedule, err := New(windows, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule.location = time.UTC
+
+	// Sunday 1st September 2024.
+	sunday := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+	var testData = []struct {
+		description string
+		time        time.Time
+		want        bool
+	}{
+		{"Sunday window start", sunday.Add(2 * time.Hour), true},
+		{"Sunday window end", sunday.Add(2*time.Hour + 29*time.Minute), true},
+		{"after Sunday window", sunday.Add(2*time.Hour + 30*time.Minute), false},
+		{"Monday", sunday.Add(26 * time.Hour), false},
+		{"night before midnight", sunday.Add(23*time.Hour + 30*time.Minute), true},
+		{"night after midnight", sunday.Add(30 * time.Minute), true},
+		{"after night", sunday.Add(time.Hour), false},
+		{"other timezone", sunday.Add(2 * time.Hour).In(time.FixedZone("X", 3600)), true},
+	}
+	for _, td := range testData {
+		got := schedule.InWindow(td.time)
+		if got != td.want {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
+
+// TestCheck checks that Check runs the command once at the start of each
+// occurrence of a window.
+func TestCheck(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger := log.New(&logBuffer, "", 0)
+
+	windows := []Window{
+		{Start: "02:00", DurationMinutes: 30, Command: []string{"upload", "logs"}},
+		{Start: "02:00", DurationMinutes: 30},
+	}
+	schedule, err := New(windows, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule.location = time.UTC
+
+	clock := time.Date(2024, time.September, 1, 1, 59, 0, 0, time.UTC)
+	schedule.now = func() time.Time { return clock }
+
+	runs := 0
+	schedule.runCommand = func(command []string) ([]byte, error) {
+		runs++
+		if strings.Join(command, " ") != "upload logs" {
+			t.Errorf("unexpected command %v", command)
+		}
+		return []byte("no network\n"), errors.New("exit status 1")
+	}
+
+	var testData = []struct {
+		time     time.Time
+		wantRuns int
+	}{
+		{clock, 0},
+		{clock.Add(time.Minute), 1},
+		{clock.Add(2 * time.Minute), 1},
+		{clock.Add(time.Hour), 1},
+		{clock.Add(24*time.Hour + time.Minute), 2},
+	}
+	for _, td := range testData {
+		clock = td.time
+		schedule.Check()
+		if runs != td.wantRuns {
+			t.Errorf("%v: want %d runs got %d", td.time, td.wantRuns, runs)
+		}
+	}
+
+	const wantLog = "maintenance window started - running upload logs\n" +
+		"maintenance command failed - exit status 1 - no network\n"
+	if !strings.HasPrefix(logBuffer.String(), wantLog) {
+		t.Errorf("want log\n%s\ngot\n%s", wantLog, logBuffer.String())
+	}
+}
@@ -0,0 +1,545 @@
+// The mdns package advertises NTRIP casters on the local network and finds
+// them, using multicast DNS (RFC 6762) and DNS service discovery (RFC 6763),
+// the protocols behind Apple's Bonjour and Avahi on Linux.  A rover tablet
+// on the same network as a base station can then find the caster without
+// anybody typing in an IP address.
+//
+// The caster advertises itself as an instance of the service type
+// _ntrip._tcp, giving its port and, in a TXT record, its mountpoints:
+//
+//	service := mdns.Service{Instance: "shed", Port: 2101, Mountpoints: []string{"MYBASE"}}
+//	advertiser, err := mdns.NewAdvertiser(service, logger)
+//	...
+//	go advertiser.Run(stop)
+//
+// and the client looks for a caster that offers its mountpoint:
+//
+//	entry, err := mdns.Find("MYBASE", mdns.DefaultBrowseTime)
+//	...
+//	conn, err := net.Dial("tcp", entry.Address())
+//
+// On a Mac, "dns-sd -B _ntrip._tcp" lists the casters that are advertised,
+// and on Linux "avahi-browse -r _ntrip._tcp" does the same.  Only IPv4 is
+// supported.
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+)
+
+// ServiceType is the name of the DNS service type of an NTRIP caster.
+const ServiceType = "_ntrip._tcp.local."
+
+// servicesName is the name that's asked for to list all of the service
+// types on the network.  See RFC 6763 section 9.
+const servicesName = "_services._dns-sd._udp.local."
+
+// DefaultBrowseTime is the time for which Find waits for the answers.
+const DefaultBrowseTime = 3 * time.Second
+
+// recordTTL is the time to live of the records, in seconds.  RFC 6762
+// recommends 120 seconds for records that give a host name.
+const recordTTL = 120
+
+// mdnsPort is the port used by mDNS.  A query from any other port is a
+// "legacy unicast" query, which is answered directly rather than by
+// multicast.
+const mdnsPort = 5353
+
+// maxMessageLength is the size of the buffer used to read a message.
+const maxMessageLength = 9000
+
+// groupAddress is the IPv4 multicast address of mDNS.
+var groupAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// Service describes a caster to be advertised.
+type Service struct {
+	// Instance is the name of the caster, for example "shed".  It's shown
+	// to the users of browsers such as dns-sd, so it can contain spaces
+	// and capital letters, but not dots.
+	Instance string
+
+	// Port is the port that the caster listens on.
+	Port int
+
+	// Mountpoints lists the caster's mountpoints.
+	Mountpoints []string
+}
+
+// Validate checks the service.
+func (service *Service) Validate() error {
+	if labelError := checkLabel(service.Instance); labelError != nil {
+		return labelError
+	}
+	if service.Port <= 0 || service.Port > 65535 {
+		em := fmt.Sprintf("mdns - illegal port %d", service.Port)
+		return errors.New(em)
+	}
+	if len(mountpointsText(service.Mountpoints)) > 255 {
+		return errors.New("mdns - too many mountpoints to advertise")
+	}
+	return nil
+}
+
+// mountpointsText returns the TXT string that lists the mountpoints.
+func mountpointsText(mountpoints []string) string {
+	return "mountpoints=" + strings.Join(mountpoints, ",")
+}
+
+// An Advertiser answers the mDNS queries for a caster.
+type Advertiser struct {
+	service Service
+
+	// fullName is the name of the service instance, for example
+	// "shed._ntrip._tcp.local.".
+	fullName string
+
+	// host is the name of the host in the .local domain, for example
+	// "raspberrypi.local.".
+	host string
+
+	// addresses holds the IPv4 addresses of the host.
+	addresses []net.IP
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// listen joins the mDNS multicast group and group is the address to
+	// which announcements are sent.  They are variables to support
+	// testing.
+	listen func() (net.PacketConn, error)
+	group  net.Addr
+
+	// mutex guards the mountpoints in the service, which can be changed
+	// while the Advertiser runs.
+	mutex sync.Mutex
+}
+
+// NewAdvertiser creates an Advertiser for the service, on this host.  The
+// logger may be nil.
+func NewAdvertiser(service Service, logger *log.Logger) (*Advertiser, error) {
+	if validateError := service.Validate(); validateError != nil {
+		return nil, validateError
+	}
+
+	hostName, hostError := os.Hostname()
+	if hostError != nil {
+		return nil, hostError
+	}
+	// Use the first part of a name such as "pi.example.com".
+	hostName = strings.Split(hostName, ".")[0]
+	if labelError := checkLabel(hostName); labelError != nil {
+		return nil, labelError
+	}
+
+	addresses, addressError := localAddresses()
+	if addressError != nil {
+		return nil, addressError
+	}
+
+	advertiser := Advertiser{
+		service:   service,
+		fullName:  service.Instance + "." + ServiceType,
+		host:      hostName + ".local.",
+		addresses: addresses,
+		logger:    logger,
+		listen: func() (net.PacketConn, error) {
+			return net.ListenMulticastUDP("udp4", nil, groupAddress)
+		},
+		group: groupAddress,
+	}
+
+	return &advertiser, nil
+}
+
+// localAddresses returns the IPv4 addresses of this host, apart from the
+// loopback address.
+func localAddresses() ([]net.IP, error) {
+	interfaceAddresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []net.IP
+	for _, a := range interfaceAddresses {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		addresses = append(addresses, ipNet.IP.To4())
+	}
+	return addresses, nil
+}
+
+// Run announces the service and then answers the queries for it until the
+// stop channel is closed, when it withdraws the announcement.  If the
+// channel is nil, it runs forever.  It can be run in a go routine.
+func (advertiser *Advertiser) Run(stop <-chan struct{}) error {
+	conn, listenError := advertiser.listen()
+	if listenError != nil {
+		return listenError
+	}
+
+	eventlog.Printf(advertiser.logger, "advertising %s on port %d",
+		advertiser.fullName, advertiser.service.Port)
+	advertiser.send(conn, advertiser.group, advertiser.announcement(recordTTL))
+
+	done := make(chan struct{})
+	defer close(done)
+	if stop != nil {
+		go func() {
+			select {
+			case <-stop:
+				// A time to live of zero says goodbye.
+				advertiser.send(conn, advertiser.group, advertiser.announcement(0))
+				conn.Close()
+			case <-done:
+			}
+		}()
+	}
+
+	buffer := make([]byte, maxMessageLength)
+	for {
+		n, from, readError := conn.ReadFrom(buffer)
+		if readError != nil {
+			select {
+			case <-stop:
+				// The connection was closed to stop the loop.
+				return nil
+			default:
+			}
+			conn.Close()
+			return readError
+		}
+
+		query, parseError := parseMessage(buffer[:n])
+		if parseError != nil || query.isResponse() {
+			continue
+		}
+
+		response := advertiser.answer(query)
+		if response == nil {
+			continue
+		}
+
+		if udpAddress, ok := from.(*net.UDPAddr); ok && udpAddress.Port != mdnsPort {
+			// A legacy unicast query.  The response goes straight back,
+			// with the ID and the questions of the query.  See RFC 6762
+			// section 6.7.
+			response.id = query.id
+			response.questions = query.questions
+			response.forLegacy()
+			advertiser.send(conn, from, response)
+			continue
+		}
+
+		advertiser.send(conn, advertiser.group, response)
+	}
+}
+
+// send sends a message, logging any failure.
+func (advertiser *Advertiser) send(conn net.PacketConn, to net.Addr, m *message) {
+	if _, err := conn.WriteTo(m.marshal(), to); err != nil {
+		eventlog.Printf(advertiser.logger, "mdns - cannot send to %s - %v", to.String(), err)
+	}
+}
+
+// announcement returns the unsolicited response that announces the service
+// or, with a time to live of zero, withdraws it.
+func (advertiser *Advertiser) announcement(ttl uint32) *message {
+	answers := []record{advertiser.pointer(ttl), advertiser.serviceRecord(ttl), advertiser.textRecord(ttl)}
+	answers = append(answers, advertiser.addressRecords(ttl)...)
+	return &message{flags: flagResponse, answers: answers}
+}
+
+// answer returns the response to a query, or nil if the query isn't about
+// the service.
+func (advertiser *Advertiser) answer(query *message) *message {
+	response := message{flags: flagResponse}
+	var wantService, wantAddresses bool
+	for _, q := range query.questions {
+		qtype := q.qtype
+		switch {
+		case strings.EqualFold(q.name, ServiceType) && (qtype == typePTR || qtype == typeANY):
+			response.answers = append(response.answers, advertiser.pointer(recordTTL))
+			wantService = true
+
+		case strings.EqualFold(q.name, servicesName) && (qtype == typePTR || qtype == typeANY):
+			response.answers = append(response.answers, record{
+				name: servicesName, rtype: typePTR, rclass: classIN, ttl: recordTTL, target: ServiceType,
+			})
+
+		case strings.EqualFold(q.name, advertiser.fullName):
+			if qtype == typeSRV || qtype == typeANY {
+				response.answers = append(response.answers, advertiser.serviceRecord(recordTTL))
+				wantAddresses = true
+			}
+			if qtype == typeTXT || qtype == typeANY {
+				response.answers = append(response.answers, advertiser.textRecord(recordTTL))
+			}
+
+		case strings.EqualFold(q.name, advertiser.host) && (qtype == typeA || qtype == typeANY):
+			response.answers = append(response.answers, advertiser.addressRecords(recordTTL)...)
+		}
+	}
+
+	if len(response.answers) == 0 {
+		return nil
+	}
+
+	// Save the asker another round trip.  See RFC 6763 section 12.
+	if wantService {
+		response.additionals = append(response.additionals,
+			advertiser.serviceRecord(recordTTL), advertiser.textRecord(recordTTL))
+		wantAddresses = true
+	}
+	if wantAddresses {
+		response.additionals = append(response.additionals, advertiser.addressRecords(recordTTL)...)
+	}
+
+	return &response
+}
+
+// pointer returns the PTR record that points from the service type to the
+// service instance.
+func (advertiser *Advertiser) pointer(ttl uint32) record {
+	return record{name: ServiceType, rtype: typePTR, rclass: classIN, ttl: ttl, target: advertiser.fullName}
+}
+
+// serviceRecord returns the SRV record that gives the host and the port of
+// the service.
+func (advertiser *Advertiser) serviceRecord(ttl uint32) record {
+	return record{
+		name: advertiser.fullName, rtype: typeSRV, rclass: classIN | cacheFlush, ttl: ttl,
+		target: advertiser.host, port: uint16(advertiser.service.Port),
+	}
+}
+
+// SetMountpoints changes the list of mountpoints that's advertised, for
+// example when the caster renames one.  The new list is given in the
+// answers to later queries.
+func (advertiser *Advertiser) SetMountpoints(mountpoints []string) error {
+	if len(mountpointsText(mountpoints)) > 255 {
+		return errors.New("mdns - too many mountpoints to advertise")
+	}
+
+	advertiser.mutex.Lock()
+	defer advertiser.mutex.Unlock()
+	advertiser.service.Mountpoints = mountpoints
+	return nil
+}
+
+// textRecord returns the TXT record that lists the mountpoints.
+func (advertiser *Advertiser) textRecord(ttl uint32) record {
+	advertiser.mutex.Lock()
+	defer advertiser.mutex.Unlock()
+
+	return record{
+		name: advertiser.fullName, rtype: typeTXT, rclass: classIN | cacheFlush, ttl: ttl,
+		text: []string{mountpointsText(advertiser.service.Mountpoints)},
+	}
+}
+
+// addressRecords returns the A records that give the addresses of the host.
+func (advertiser *Advertiser) addressRecords(ttl uint32) []record {
+	var records []record
+	for _, ip := range advertiser.addresses {
+		records = append(records, record{
+			name: advertiser.host, rtype: typeA, rclass: classIN | cacheFlush, ttl: ttl, ip: ip,
+		})
+	}
+	return records
+}
+
+// Entry is a caster found on the local network.
+type Entry struct {
+	// Instance is the name under which the caster is advertised.
+	Instance string
+
+	// Host is the name of the caster's host, for example
+	// "raspberrypi.local.".
+	Host string
+
+	// Port is the port that the caster listens on.
+	Port int
+
+	// Addresses holds the addresses of the host.
+	Addresses []net.IP
+
+	// Mountpoints lists the caster's mountpoints.
+	Mountpoints []string
+}
+
+// Address returns the address of the caster in the form "host:port", using
+// the first of its IP addresses, or the host name if there are none.
+func (entry *Entry) Address() string {
+	host := strings.TrimSuffix(entry.Host, ".")
+	if len(entry.Addresses) > 0 {
+		host = entry.Addresses[0].String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(entry.Port))
+}
+
+// Offers returns true if the caster has the given mountpoint.
+func (entry *Entry) Offers(mountpoint string) bool {
+	mountpoint = strings.TrimPrefix(mountpoint, "/")
+	for _, m := range entry.Mountpoints {
+		if m == mountpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// Browse asks for the casters on the local network and returns the ones
+// that answer within the given time.
+func Browse(browseTime time.Duration) ([]Entry, error) {
+	conn, listenError := net.ListenUDP("udp4", &net.UDPAddr{})
+	if listenError != nil {
+		return nil, listenError
+	}
+	return browse(conn, groupAddress, browseTime)
+}
+
+// Find looks for a caster on the local network that offers the given
+// mountpoint, waiting for the answers for the given time.  If several do,
+// it returns the first to answer.
+func Find(mountpoint string, browseTime time.Duration) (*Entry, error) {
+	entries, browseError := Browse(browseTime)
+	if browseError != nil {
+		return nil, browseError
+	}
+	return choose(entries, mountpoint)
+}
+
+// choose returns the first of the entries that offers the mountpoint.
+func choose(entries []Entry, mountpoint string) (*Entry, error) {
+	for i := range entries {
+		if entries[i].Offers(mountpoint) {
+			return &entries[i], nil
+		}
+	}
+	em := fmt.Sprintf("mdns - no caster on the local network offers mountpoint %s",
+		strings.TrimPrefix(mountpoint, "/"))
+	return nil, errors.New(em)
+}
+
+// browse sends a query for the casters from the connection to the group
+// address and collects the answers until the browse time is up.  It closes
+// the connection.
+func browse(conn net.PacketConn, group net.Addr, browseTime time.Duration) ([]Entry, error) {
+	defer conn.Close()
+
+	query := message{
+		id:        uint16(time.Now().UnixNano()),
+		questions: []question{{name: ServiceType, qtype: typePTR, qclass: classIN}},
+	}
+	if _, err := conn.WriteTo(query.marshal(), group); err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(browseTime)); err != nil {
+		return nil, err
+	}
+
+	var answers []record
+	buffer := make([]byte, maxMessageLength)
+	for {
+		n, _, readError := conn.ReadFrom(buffer)
+		if readError != nil {
+			if netError, ok := readError.(net.Error); ok && netError.Timeout() {
+				break
+			}
+			return nil, readError
+		}
+		response, parseError := parseMessage(buffer[:n])
+		if parseError != nil || !response.isResponse() {
+			continue
+		}
+		answers = append(answers, response.answers...)
+		answers = append(answers, response.additionals...)
+	}
+
+	return entries(answers), nil
+}
+
+// entries returns the casters described by the records, in the order in
+// which they were first pointed to.
+func entries(records []record) []Entry {
+	var instances []string
+	services := make(map[string]record)
+	texts := make(map[string][]string)
+	addresses := make(map[string][]net.IP)
+
+	for _, r := range records {
+		name := strings.ToLower(r.name)
+		switch r.rtype {
+		case typePTR:
+			if strings.EqualFold(r.name, ServiceType) && r.ttl > 0 && !contains(instances, r.target) {
+				instances = append(instances, r.target)
+			}
+		case typeSRV:
+			services[name] = r
+		case typeTXT:
+			texts[name] = r.text
+		case typeA:
+			if !containsIP(addresses[name], r.ip) {
+				addresses[name] = append(addresses[name], r.ip)
+			}
+		}
+	}
+
+	var found []Entry
+	for _, instance := range instances {
+		service, ok := services[strings.ToLower(instance)]
+		if !ok {
+			continue
+		}
+		entry := Entry{
+			Instance:  strings.TrimSuffix(instance, "."+ServiceType),
+			Host:      service.target,
+			Port:      int(service.port),
+			Addresses: addresses[strings.ToLower(service.target)],
+		}
+		for _, s := range texts[strings.ToLower(instance)] {
+			if strings.HasPrefix(s, "mountpoints=") {
+				list := strings.TrimPrefix(s, "mountpoints=")
+				if len(list) > 0 {
+					entry.Mountpoints = strings.Split(list, ",")
+				}
+			}
+		}
+		found = append(found, entry)
+	}
+
+	return found
+}
+
+// contains returns true if the list contains the name, ignoring case.
+func contains(list []string, name string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIP returns true if the list contains the address.
+func containsIP(list []net.IP, ip net.IP) bool {
+	for _, a := range list {
+		if a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newTestAdvertiser returns an advertiser for a caster on a host called pi
+// at 192.168.1.20, listening on a UDP port on the loopback address rather
+// than joining the multicast group.
+func newTestAdvertiser(t *testing.T) (*Advertiser, net.PacketConn) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := Service{Instance: "Base in the shed", Port: 2101, Mountpoints: []string{"MYBASE", "OTHER"}}
+	advertiser := Advertiser{
+		service:   service,
+		fullName:  service.Instance + "." + ServiceType,
+		host:      "pi.local.",
+		addresses: []net.IP{net.IPv4(192, 168, 1, 20)},
+		listen:    func() (net.PacketConn, error) { return conn, nil },
+		group:     conn.LocalAddr(),
+	}
+	return &advertiser, conn
+}
+
+// TestServiceValidate checks that Validate rejects bad services.
+func TestServiceValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		service     Service
+		want        string
+	}{
+		{"ok", Service{Instance: "shed", Port: 2101}, ""},
+		{"no name", Service{Port: 2101}, "mdns - empty name"},
+		{"dot", Service{Instance: "shed.local", Port: 2101}, `mdns - name "shed.local" contains a dot`},
+		{"no port", Service{Instance: "shed"}, "mdns - illegal port 0"},
+		{"big port", Service{Instance: "shed", Port: 65536}, "mdns - illegal port 65536"},
+	}
+
+	for _, td := range testData {
+		err := td.service.Validate()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.description, td.want, got)
+		}
+	}
+}
+
+// TestAnswer checks the answers to the queries.
+func TestAnswer(t *testing.T) {
+	advertiser, conn := newTestAdvertiser(t)
+	conn.Close()
+
+	var testData = []struct {
+		description     string
+		q               question
+		wantAnswers     []uint16
+		wantAdditionals []uint16
+	}{
+		{"service type", question{ServiceType, typePTR, classIN},
+			[]uint16{typePTR}, []uint16{typeSRV, typeTXT, typeA}},
+		{"service types", question{servicesName, typePTR, classIN}, []uint16{typePTR}, nil},
+		{"instance SRV", question{"base in the shed." + ServiceType, typeSRV, classIN},
+			[]uint16{typeSRV}, []uint16{typeA}},
+		{"instance TXT", question{advertiser.fullName, typeTXT, classIN}, []uint16{typeTXT}, nil},
+		{"instance ANY", question{advertiser.fullName, typeANY, classIN},
+			[]uint16{typeSRV, typeTXT}, []uint16{typeA}},
+		{"host", question{"PI.local.", typeA, classIN}, []uint16{typeA}, nil},
+		{"other service", question{"_http._tcp.local.", typePTR, classIN}, nil, nil},
+	}
+
+	for _, td := range testData {
+		response := advertiser.answer(&message{questions: []question{td.q}})
+		if td.wantAnswers == nil {
+			if response != nil {
+				t.Errorf("%s: want no response", td.description)
+			}
+			continue
+		}
+		if response == nil {
+			t.Errorf("%s: want a response", td.description)
+			continue
+		}
+		if diff := cmp.Diff(td.wantAnswers, types(response.answers)); diff != "" {
+			t.Errorf("%s: answers %s", td.description, diff)
+		}
+		if diff := cmp.Diff(td.wantAdditionals, types(response.additionals)); diff != "" {
+			t.Errorf("%s: additionals %s", td.description, diff)
+		}
+	}
+}
+
+// types returns the types of the records.
+func types(records []record) []uint16 {
+	var list []uint16
+	for _, r := range records {
+		list = append(list, r.rtype)
+	}
+	return list
+}
+
+// TestBrowse checks that browse finds the caster that an Advertiser
+// advertises, and that the Advertiser says goodbye when it's stopped.
+func TestBrowse(t *testing.T) {
+	advertiser, advertiserConn := newTestAdvertiser(t)
+
+	stop := make(chan struct{})
+	finished := make(chan error)
+	go func() {
+		finished <- advertiser.Run(stop)
+	}()
+
+	browserConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, browseError := browse(browserConn, advertiserConn.LocalAddr(), 200*time.Millisecond)
+	if browseError != nil {
+		t.Fatal(browseError)
+	}
+
+	want := []Entry{
+		{
+			Instance:    "Base in the shed",
+			Host:        "pi.local.",
+			Port:        2101,
+			Addresses:   []net.IP{net.IPv4(192, 168, 1, 20)},
+			Mountpoints: []string{"MYBASE", "OTHER"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+
+	close(stop)
+	select {
+	case runError := <-finished:
+		if runError != nil {
+			t.Error(runError)
+		}
+	case <-time.After(time.Second):
+		t.Error("Run didn't stop")
+	}
+}
+
+// TestEntries checks that entries pieces the casters together from the
+// records and ignores the ones that are incomplete or withdrawn.
+func TestEntries(t *testing.T) {
+	records := []record{
+		{name: ServiceType, rtype: typePTR, ttl: 120, target: "shed." + ServiceType},
+		{name: ServiceType, rtype: typePTR, ttl: 120, target: "nosrv." + ServiceType},
+		{name: ServiceType, rtype: typePTR, ttl: 0, target: "gone." + ServiceType},
+		{name: "gone." + ServiceType, rtype: typeSRV, ttl: 0, target: "gone.local.", port: 2101},
+		{name: "SHED." + ServiceType, rtype: typeSRV, ttl: 120, target: "pi.local.", port: 2102},
+		{name: "pi.local.", rtype: typeA, ttl: 120, ip: net.IPv4(10, 0, 0, 1)},
+		{name: "pi.local.", rtype: typeA, ttl: 120, ip: net.IPv4(10, 0, 0, 1)},
+		{name: ServiceType, rtype: typePTR, ttl: 120, target: "shed." + ServiceType},
+	}
+
+	want := []Entry{
+		{Instance: "shed", Host: "pi.local.", Port: 2102, Addresses: []net.IP{net.IPv4(10, 0, 0, 1)}},
+	}
+	if diff := cmp.Diff(want, entries(records)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// TestChoose checks that choose finds the first caster that offers the
+// mountpoint.
+func TestChoose(t *testing.T) {
+	list := []Entry{
+		{Instance: "a", Host: "a.local.", Port: 2101, Mountpoints: []string{"OTHER"}},
+		{Instance: "b", Host: "b.local.", Port: 2101, Mountpoints: []string{"MYBASE"}},
+		{Instance: "c", Host: "c.local.", Port: 2101, Mountpoints: []string{"MYBASE"}},
+	}
+
+	got, err := choose(list, "/MYBASE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Instance != "b" {
+		t.Errorf("want b got %s", got.Instance)
+	}
+	if got.Address() != "b.local:2101" {
+		t.Errorf("want b.local:2101 got %s", got.Address())
+	}
+
+	_, err = choose(list, "NONE")
+	const wantError = "mdns - no caster on the local network offers mountpoint NONE"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+}
+
+// TestSetMountpoints checks that the TXT record gives the mountpoints set
+// by SetMountpoints.
+func TestSetMountpoints(t *testing.T) {
+	advertiser, conn := newTestAdvertiser(t)
+	conn.Close()
+
+	if err := advertiser.SetMountpoints([]string{"NEWBASE", "MYBASE"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"mountpoints=NEWBASE,MYBASE"}
+	if diff := cmp.Diff(want, advertiser.textRecord(recordTTL).text); diff != "" {
+		t.Error(diff)
+	}
+
+	tooMany := make([]string, 100)
+	for i := range tooMany {
+		tooMany[i] = "MOUNT"
+	}
+	const wantError = "mdns - too many mountpoints to advertise"
+	err := advertiser.SetMountpoints(tooMany)
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+}
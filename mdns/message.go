@@ -0,0 +1,358 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// The DNS message format (RFC 1035 section 4), as far as service discovery
+// needs it.  A message is a 12-byte header followed by the questions, the
+// answers, the authority records and the additional records.  A name is a
+// list of labels, each preceded by its length and ending with a zero
+// length.  A name in a message that's read can also end with a pointer to
+// a name earlier in the message.
+
+// The record types.
+const (
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+	typeANY = 255
+)
+
+// classIN is the Internet class, the only one used.
+const classIN = 1
+
+// classMask masks out the top bit of the class, which has a special meaning
+// in mDNS.  In a question it asks for a unicast response and in a response
+// it says that the record replaces any cached records of the same name and
+// type.
+const classMask = 0x7fff
+
+// cacheFlush is the top bit of the class of a record in a response.
+const cacheFlush = 0x8000
+
+// legacyTTL is the longest time to live of a record sent in answer to a
+// legacy unicast query, in seconds.
+const legacyTTL = 10
+
+// flagResponse is the flags of an mDNS response - the QR bit, which says
+// that the message is a response, and the AA bit, which says that the
+// answers are authoritative.
+const flagResponse = 0x8400
+
+// headerLength is the length of the header of a DNS message.
+const headerLength = 12
+
+// maxLabelLength is the longest that a label in a name can be.
+const maxLabelLength = 63
+
+// maxPointers is the number of pointers that readName follows before it
+// decides that it's in a loop.
+const maxPointers = 16
+
+// question is a question in a DNS message.
+type question struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+// record is a resource record in a DNS message.  Only the data of the types
+// that service discovery uses is kept.
+type record struct {
+	name   string
+	rtype  uint16
+	rclass uint16
+	ttl    uint32
+
+	// target is the name given by a PTR or an SRV record.
+	target string
+
+	// port is the port given by an SRV record.
+	port uint16
+
+	// text holds the strings of a TXT record.
+	text []string
+
+	// ip is the address given by an A record.
+	ip net.IP
+}
+
+// message is a DNS message.  The authority records are not used.
+type message struct {
+	id          uint16
+	flags       uint16
+	questions   []question
+	answers     []record
+	additionals []record
+}
+
+// isResponse returns true if the message is a response rather than a
+// query.
+func (m *message) isResponse() bool {
+	return m.flags&0x8000 != 0
+}
+
+// forLegacy changes a response to suit a legacy unicast query.  The cache
+// flush bits are cleared and the time to live is limited to ten seconds.
+// See RFC 6762 section 6.7.
+func (m *message) forLegacy() {
+	for _, records := range [][]record{m.answers, m.additionals} {
+		for i := range records {
+			records[i].rclass &= classMask
+			if records[i].ttl > legacyTTL {
+				records[i].ttl = legacyTTL
+			}
+		}
+	}
+}
+
+// marshal returns the message in its wire form.  Names are not compressed.
+func (m *message) marshal() []byte {
+	buffer := make([]byte, headerLength)
+	binary.BigEndian.PutUint16(buffer[0:], m.id)
+	binary.BigEndian.PutUint16(buffer[2:], m.flags)
+	binary.BigEndian.PutUint16(buffer[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(buffer[6:], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(buffer[10:], uint16(len(m.additionals)))
+
+	for _, q := range m.questions {
+		buffer = appendName(buffer, q.name)
+		buffer = appendUint16(buffer, q.qtype)
+		buffer = appendUint16(buffer, q.qclass)
+	}
+	for i := range m.answers {
+		buffer = m.answers[i].append(buffer)
+	}
+	for i := range m.additionals {
+		buffer = m.additionals[i].append(buffer)
+	}
+
+	return buffer
+}
+
+// append appends the record in its wire form to the buffer and returns the
+// result.
+func (r *record) append(buffer []byte) []byte {
+	var data []byte
+	switch r.rtype {
+	case typeA:
+		data = append(data, r.ip.To4()...)
+	case typePTR:
+		data = appendName(data, r.target)
+	case typeSRV:
+		// The priority and the weight are zero.
+		data = appendUint16(data, 0)
+		data = appendUint16(data, 0)
+		data = appendUint16(data, r.port)
+		data = appendName(data, r.target)
+	case typeTXT:
+		for _, s := range r.text {
+			data = append(data, byte(len(s)))
+			data = append(data, s...)
+		}
+	}
+
+	buffer = appendName(buffer, r.name)
+	buffer = appendUint16(buffer, r.rtype)
+	buffer = appendUint16(buffer, r.rclass)
+	buffer = append(buffer, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buffer[len(buffer)-4:], r.ttl)
+	buffer = appendUint16(buffer, uint16(len(data)))
+	return append(buffer, data...)
+}
+
+// appendUint16 appends a 16-bit number to the buffer, most significant
+// byte first, and returns the result.
+func appendUint16(buffer []byte, n uint16) []byte {
+	return append(buffer, byte(n>>8), byte(n))
+}
+
+// appendName appends a name such as "shed._ntrip._tcp.local." to the buffer
+// and returns the result.  The labels must have been checked with
+// checkLabel.
+func appendName(buffer []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 {
+			continue
+		}
+		buffer = append(buffer, byte(len(label)))
+		buffer = append(buffer, label...)
+	}
+	return append(buffer, 0)
+}
+
+// checkLabel checks that a string can be used as one label of a name.
+func checkLabel(label string) error {
+	if len(label) == 0 {
+		return errors.New("mdns - empty name")
+	}
+	if len(label) > maxLabelLength {
+		em := fmt.Sprintf("mdns - name %q is longer than %d bytes", label, maxLabelLength)
+		return errors.New(em)
+	}
+	if strings.Contains(label, ".") {
+		em := fmt.Sprintf("mdns - name %q contains a dot", label)
+		return errors.New(em)
+	}
+	return nil
+}
+
+// parseMessage reads a DNS message in its wire form.
+func parseMessage(buffer []byte) (*message, error) {
+	if len(buffer) < headerLength {
+		return nil, errors.New("mdns - message too short")
+	}
+
+	m := message{
+		id:    binary.BigEndian.Uint16(buffer[0:]),
+		flags: binary.BigEndian.Uint16(buffer[2:]),
+	}
+	questions := int(binary.BigEndian.Uint16(buffer[4:]))
+	answers := int(binary.BigEndian.Uint16(buffer[6:]))
+	authorities := int(binary.BigEndian.Uint16(buffer[8:]))
+	additionals := int(binary.BigEndian.Uint16(buffer[10:]))
+
+	offset := headerLength
+	for i := 0; i < questions; i++ {
+		name, next, err := readName(buffer, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(buffer) {
+			return nil, errors.New("mdns - question truncated")
+		}
+		m.questions = append(m.questions, question{
+			name:   name,
+			qtype:  binary.BigEndian.Uint16(buffer[next:]),
+			qclass: binary.BigEndian.Uint16(buffer[next+2:]),
+		})
+		offset = next + 4
+	}
+
+	for i := 0; i < answers+authorities+additionals; i++ {
+		r, next, err := readRecord(buffer, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next
+		switch {
+		case i < answers:
+			m.answers = append(m.answers, *r)
+		case i >= answers+authorities:
+			m.additionals = append(m.additionals, *r)
+		}
+	}
+
+	return &m, nil
+}
+
+// readRecord reads the resource record at the given offset in the message.
+// It returns the record and the offset of the byte after it.
+func readRecord(buffer []byte, offset int) (*record, int, error) {
+	name, next, err := readName(buffer, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if next+10 > len(buffer) {
+		return nil, 0, errors.New("mdns - record truncated")
+	}
+
+	r := record{
+		name:   name,
+		rtype:  binary.BigEndian.Uint16(buffer[next:]),
+		rclass: binary.BigEndian.Uint16(buffer[next+2:]),
+		ttl:    binary.BigEndian.Uint32(buffer[next+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(buffer[next+8:]))
+	start := next + 10
+	end := start + length
+	if end > len(buffer) {
+		return nil, 0, errors.New("mdns - record data truncated")
+	}
+	data := buffer[start:end]
+
+	switch r.rtype {
+	case typeA:
+		if length != net.IPv4len {
+			return nil, 0, errors.New("mdns - bad A record")
+		}
+		r.ip = net.IPv4(data[0], data[1], data[2], data[3])
+	case typePTR:
+		// The name may point back into the rest of the message.
+		r.target, _, err = readName(buffer, start)
+		if err != nil {
+			return nil, 0, err
+		}
+	case typeSRV:
+		if length < 7 {
+			return nil, 0, errors.New("mdns - bad SRV record")
+		}
+		r.port = binary.BigEndian.Uint16(data[4:])
+		r.target, _, err = readName(buffer, start+6)
+		if err != nil {
+			return nil, 0, err
+		}
+	case typeTXT:
+		for i := 0; i < len(data); {
+			n := int(data[i])
+			if i+1+n > len(data) {
+				return nil, 0, errors.New("mdns - bad TXT record")
+			}
+			r.text = append(r.text, string(data[i+1:i+1+n]))
+			i += 1 + n
+		}
+	}
+
+	return &r, end, nil
+}
+
+// readName reads the name at the given offset in the message, following
+// any pointers.  It returns the name, ending with a dot, and the offset of
+// the byte after it.
+func readName(buffer []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for pointers := 0; ; {
+		if offset >= len(buffer) {
+			return "", 0, errors.New("mdns - name truncated")
+		}
+		length := int(buffer[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+
+		case length&0xc0 == 0xc0:
+			// A pointer to the rest of the name.
+			if offset+1 >= len(buffer) {
+				return "", 0, errors.New("mdns - name truncated")
+			}
+			pointers++
+			if pointers > maxPointers {
+				return "", 0, errors.New("mdns - too many pointers in a name")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(buffer[offset:]) & 0x3fff)
+
+		case length > maxLabelLength:
+			return "", 0, errors.New("mdns - bad label length")
+
+		default:
+			if offset+1+length > len(buffer) {
+				return "", 0, errors.New("mdns - name truncated")
+			}
+			labels = append(labels, string(buffer[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
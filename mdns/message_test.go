@@ -0,0 +1,121 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestMarshalAndParse checks that a message survives being marshalled and
+// parsed.
+func TestMarshalAndParse(t *testing.T) {
+	want := message{
+		id:        42,
+		flags:     flagResponse,
+		questions: []question{{name: ServiceType, qtype: typePTR, qclass: classIN}},
+		answers: []record{
+			{name: ServiceType, rtype: typePTR, rclass: classIN, ttl: 120, target: "shed." + ServiceType},
+		},
+		additionals: []record{
+			{name: "shed." + ServiceType, rtype: typeSRV, rclass: classIN | cacheFlush, ttl: 120,
+				target: "pi.local.", port: 2101},
+			{name: "shed." + ServiceType, rtype: typeTXT, rclass: classIN | cacheFlush, ttl: 120,
+				text: []string{"mountpoints=MYBASE,OTHER"}},
+			{name: "pi.local.", rtype: typeA, rclass: classIN | cacheFlush, ttl: 120,
+				ip: net.IPv4(192, 168, 1, 20)},
+		},
+	}
+
+	got, err := parseMessage(want.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := cmp.AllowUnexported(message{}, question{}, record{})
+	if diff := cmp.Diff(&want, got, options); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// TestParseWithPointers checks that parseMessage follows the pointers in
+// a compressed name.
+func TestParseWithPointers(t *testing.T) {
+	// A response with one PTR record.  Its name is _ntrip._tcp.local. and
+	// its data is "shed" followed by a pointer to that name at offset 12.
+	buffer := []byte{
+		0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0,
+		6, '_', 'n', 't', 'r', 'i', 'p', 4, '_', 't', 'c', 'p', 5, 'l', 'o', 'c', 'a', 'l', 0,
+		0, typePTR, 0, classIN, 0, 0, 0, 120, 0, 7,
+		4, 's', 'h', 'e', 'd', 0xc0, 12,
+	}
+
+	got, err := parseMessage(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.answers) != 1 {
+		t.Fatalf("want 1 answer, got %d", len(got.answers))
+	}
+	if got.answers[0].name != ServiceType {
+		t.Errorf("want name %s, got %s", ServiceType, got.answers[0].name)
+	}
+	want := "shed." + ServiceType
+	if got.answers[0].target != want {
+		t.Errorf("want target %s, got %s", want, got.answers[0].target)
+	}
+}
+
+// TestParseWithErrors checks that parseMessage rejects broken messages.
+func TestParseWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		buffer      []byte
+		want        string
+	}{
+		{"short", []byte{0, 0, 0}, "mdns - message too short"},
+		{"truncated name", []byte{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 5, 'a'}, "mdns - name truncated"},
+		{"truncated question", []byte{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, "mdns - question truncated"},
+		{"pointer loop", []byte{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12}, "mdns - too many pointers in a name"},
+		{"truncated record", []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}, "mdns - record truncated"},
+		{"bad A record",
+			[]byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, typeA, 0, classIN, 0, 0, 0, 0, 0, 2, 1, 2},
+			"mdns - bad A record"},
+	}
+
+	for _, td := range testData {
+		_, err := parseMessage(td.buffer)
+		if err == nil {
+			t.Errorf("%s: want an error", td.description)
+			continue
+		}
+		if err.Error() != td.want {
+			t.Errorf("%s: want %s got %s", td.description, td.want, err.Error())
+		}
+	}
+}
+
+// TestCheckLabel checks checkLabel.
+func TestCheckLabel(t *testing.T) {
+	var testData = []struct {
+		label string
+		want  string
+	}{
+		{"Base station in the shed", ""},
+		{"", "mdns - empty name"},
+		{"a.b", `mdns - name "a.b" contains a dot`},
+		{"0123456789012345678901234567890123456789012345678901234567890123",
+			`mdns - name "0123456789012345678901234567890123456789012345678901234567890123" is longer than 63 bytes`},
+	}
+
+	for _, td := range testData {
+		err := checkLabel(td.label)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != td.want {
+			t.Errorf("%q: want %q got %q", td.label, td.want, got)
+		}
+	}
+}
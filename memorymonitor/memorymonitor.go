@@ -0,0 +1,148 @@
+// The memorymonitor package watches the heap usage of a long-running process.
+//
+// A process such as the rtcmfilter may run for months on a small machine such
+// as a Raspberry Pi with 512 MB of memory.  If it grows too big the kernel
+// kills it.  The monitor checks the heap at intervals against a soft cap.  When
+// the cap is exceeded, it logs the event and calls the shedding actions that
+// the application has registered, so the application can stop doing optional
+// work (for example writing the readable log) and release memory.
+//
+//	monitor := memorymonitor.New(200*memorymonitor.Megabyte, 10*time.Second, logger)
+//	monitor.OnSoftCapExceeded(func() { ... })
+//	go monitor.Run(nil)
+//
+// Shedding is one-way:  once the actions have been called they are not called
+// again and the work that was shed stays shed until the process is restarted.
+package memorymonitor
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+)
+
+// Megabyte is the number of bytes in a megabyte.
+const Megabyte = 1024 * 1024
+
+// DefaultInterval is the interval between checks used when none is given.
+const DefaultInterval = 10 * time.Second
+
+// Monitor checks the heap usage against a soft cap.
+type Monitor struct {
+	// SoftCap is the heap size in bytes above which work is shed.
+	SoftCap uint64
+
+	// Interval is the time between checks when the monitor is running.
+	Interval time.Duration
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// readHeap returns the current heap size.  It's a variable to
+	// support testing.
+	readHeap func() uint64
+
+	// freeMemory asks the runtime to return memory to the operating
+	// system.  It's a variable to support testing.
+	freeMemory func()
+
+	// actions are called when the soft cap is first exceeded.
+	actions []func()
+
+	// shed is true once the actions have been called.
+	shed bool
+
+	// The mutex controls access to the actions and the shed flag.
+	mutex sync.Mutex
+}
+
+// New creates a Monitor with the given soft cap in bytes.  If the interval is
+// zero, DefaultInterval is used.  The logger may be nil.
+func New(softCap uint64, interval time.Duration, logger *log.Logger) *Monitor {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	monitor := Monitor{
+		SoftCap:    softCap,
+		Interval:   interval,
+		logger:     logger,
+		readHeap:   heapInUse,
+		freeMemory: debug.FreeOSMemory,
+	}
+
+	return &monitor
+}
+
+// OnSoftCapExceeded registers an action to be called when the soft cap is
+// exceeded.
+func (monitor *Monitor) OnSoftCapExceeded(action func()) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	monitor.actions = append(monitor.actions, action)
+}
+
+// Shed returns true if the soft cap has been exceeded and the work shed.
+func (monitor *Monitor) Shed() bool {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	return monitor.shed
+}
+
+// Check reads the heap size and, if it's over the soft cap for the first time,
+// logs the event, calls the shedding actions and releases memory to the
+// operating system.  It returns the heap size and true if it's over the cap.
+func (monitor *Monitor) Check() (uint64, bool) {
+	heap := monitor.readHeap()
+	if heap <= monitor.SoftCap {
+		return heap, false
+	}
+
+	monitor.mutex.Lock()
+	alreadyShed := monitor.shed
+	monitor.shed = true
+	actions := monitor.actions
+	monitor.mutex.Unlock()
+
+	if alreadyShed {
+		return heap, true
+	}
+
+	eventlog.Printf(monitor.logger, "heap %d MB exceeds soft cap %d MB - shedding optional work",
+		heap/Megabyte, monitor.SoftCap/Megabyte)
+
+	for _, action := range actions {
+		action()
+	}
+
+	monitor.freeMemory()
+
+	return heap, true
+}
+
+// Run checks the heap at intervals until the stop channel is closed.  If the
+// channel is nil, it runs forever.  It can be run in a goroutine.
+func (monitor *Monitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(monitor.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			monitor.Check()
+		}
+	}
+}
+
+// heapInUse returns the number of bytes in use in the heap.
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
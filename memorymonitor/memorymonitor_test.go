@@ -0,0 +1,117 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheck checks that Check sheds work once when the soft cap is exceeded.
+func TestCheck(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := log.New(&buffer, "", 0)
+
+	monitor := New(100*Megabyte, time.Second, logger)
+
+	heap := uint64(50 * Megabyte)
+	monitor.readHeap = func() uint64 { return heap }
+	freeCalls := 0
+	monitor.freeMemory = func() { freeCalls++ }
+
+	actionCalls := 0
+	monitor.OnSoftCapExceeded(func() { actionCalls++ })
+	monitor.OnSoftCapExceeded(func() { actionCalls += 10 })
+
+	var testData = []struct {
+		description     string
+		heap            uint64
+		wantOver        bool
+		wantActionCalls int
+		wantFreeCalls   int
+	}{
+		{"under the cap", 50 * Megabyte, false, 0, 0},
+		{"at the cap", 100 * Megabyte, false, 0, 0},
+		{"over the cap", 101 * Megabyte, true, 11, 1},
+		{"still over the cap", 150 * Megabyte, true, 11, 1},
+		{"back under the cap", 50 * Megabyte, false, 11, 1},
+		{"over the cap again", 101 * Megabyte, true, 11, 1},
+	}
+	for _, td := range testData {
+		heap = td.heap
+		gotHeap, gotOver := monitor.Check()
+		if gotHeap != td.heap {
+			t.Errorf("%s: want heap %d got %d", td.description, td.heap, gotHeap)
+		}
+		if gotOver != td.wantOver {
+			t.Errorf("%s: want over %v got %v", td.description, td.wantOver, gotOver)
+		}
+		if actionCalls != td.wantActionCalls {
+			t.Errorf("%s: want %d action calls got %d",
+				td.description, td.wantActionCalls, actionCalls)
+		}
+		if freeCalls != td.wantFreeCalls {
+			t.Errorf("%s: want %d free calls got %d",
+				td.description, td.wantFreeCalls, freeCalls)
+		}
+	}
+
+	if !monitor.Shed() {
+		t.Error("want work to be shed")
+	}
+
+	const wantLog = "heap 101 MB exceeds soft cap 100 MB - shedding optional work\n"
+	if buffer.String() != wantLog {
+		t.Errorf("want log %q got %q", wantLog, buffer.String())
+	}
+}
+
+// TestNew checks that New supplies the default interval.
+func TestNew(t *testing.T) {
+	monitor := New(Megabyte, 0, nil)
+	if monitor.Interval != DefaultInterval {
+		t.Errorf("want %v got %v", DefaultInterval, monitor.Interval)
+	}
+
+	// With no logger, Check should still work.
+	monitor.readHeap = func() uint64 { return 2 * Megabyte }
+	monitor.freeMemory = func() {}
+	_, over := monitor.Check()
+	if !over {
+		t.Error("want over the cap")
+	}
+}
+
+// TestRun checks that Run checks the heap until it's stopped.
+func TestRun(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := log.New(&buffer, "", 0)
+
+	monitor := New(Megabyte, time.Millisecond, logger)
+	monitor.readHeap = func() uint64 { return 2 * Megabyte }
+	monitor.freeMemory = func() {}
+
+	shed := make(chan struct{})
+	monitor.OnSoftCapExceeded(func() { close(shed) })
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(stop)
+		close(done)
+	}()
+
+	select {
+	case <-shed:
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for the work to be shed")
+	}
+
+	close(stop)
+	<-done
+
+	if !strings.Contains(buffer.String(), "shedding") {
+		t.Errorf("want a log entry, got %q", buffer.String())
+	}
+}
@@ -0,0 +1,410 @@
+// The metrics package exposes the running figures of an application on an
+// HTTP endpoint in the Prometheus text format, so that a base station that
+// runs day and night can be watched from a dashboard rather than by reading
+// the daily logs.
+//
+// The Registry holds these figures:
+//
+//	ntrip_messages_total{type="1077"}   RTCM messages received, by type
+//	ntrip_crc_failures_total            frames that failed the CRC check
+//	ntrip_handler_events_total{kind="crc_failure"} trouble found in the input, by kind
+//	ntrip_bytes_in_total                bytes of input, RTCM or not
+//	ntrip_bytes_out_total               bytes sent on, for example to a caster
+//	ntrip_caster_reconnects_total       times the connection to the caster was remade
+//	ntrip_device_reconnects_total       times the connection to the device was remade
+//	ntrip_backlog_messages{stage="..."} messages waiting in each stage
+//	ntrip_dropped_messages_total{stage="..."} messages dropped by each stage's queue
+//
+// If the application keeps rolling statistics of the observations (see the
+// stats package and WatchStats), these are added:
+//
+//	ntrip_satellites{constellation="GPS"}                 satellites in the latest epoch
+//	ntrip_signal_cnr_dbhz{constellation="GPS",signal="2"} mean CNR of each signal
+//	ntrip_message_gap_max_seconds{type="1077"}            longest gap between messages
+//	ntrip_epoch_completeness_percent                      epochs with all constellations
+//
+// The totals are counters, so the number of messages of each type per
+// second is given by the Prometheus rate function, for example
+// rate(ntrip_messages_total[1m]).  The backlogs and the statistics are
+// gauges.
+//
+// Metrics are off unless the application's config has a metrics section:
+//
+//	"metrics": {"listen_address": ":9100"}
+//
+// The figures are served at /metrics unless the section gives some other
+// path.  The application creates the Registry, starts listening and feeds it:
+//
+//	registry, err := metrics.New(config, logger)
+//	...
+//	err = registry.Listen()
+//	...
+//	go registry.Run(nil)
+//	registry.Count(&message)  // Call for each message.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/stats"
+)
+
+// DefaultPath is the path at which the figures are served when the config
+// doesn't give one.
+const DefaultPath = "/metrics"
+
+// contentType is the content type of the Prometheus text format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Config is the config of a Registry, as it appears in an application's
+// JSON config file.
+type Config struct {
+	// ListenAddress is the host:port on which the figures are served, for
+	// example ":9100" for all interfaces.
+	ListenAddress string `json:"listen_address"`
+
+	// Path is the path of the endpoint.  Empty means DefaultPath.
+	Path string `json:"path"`
+}
+
+// EndpointPath returns the path of the endpoint.
+func (config *Config) EndpointPath() string {
+	if len(config.Path) == 0 {
+		return DefaultPath
+	}
+	return config.Path
+}
+
+// Registry holds the figures and serves them.  It's safe for concurrent use.
+type Registry struct {
+	// The counters are first so that they are correctly aligned for atomic
+	// access on 32-bit platforms such as the Raspberry Pi.
+	bytesIn          uint64
+	bytesOut         uint64
+	casterReconnects uint64
+	deviceReconnects uint64
+
+	// config is the config of the Registry.
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// listener is the listener on which the figures are served, nil until
+	// Listen is called.
+	listener net.Listener
+
+	// byType holds the number of messages of each type.
+	byType map[int]uint64
+
+	// handlers are the RTCM handlers whose CRC failures are counted.
+	handlers []*rtcm.Handler
+
+	// backlogs gives a function that returns the length of each stage's
+	// backlog.
+	backlogs map[string]func() int
+
+	// dropped gives a function that returns the number of messages that
+	// each stage has dropped.
+	dropped map[string]func() uint64
+
+	// aggregator keeps the rolling statistics of the observations.  It may
+	// be nil.
+	aggregator *stats.Aggregator
+
+	// The mutex controls access to listener, byType, handlers, backlogs,
+	// dropped and aggregator.
+	mutex sync.Mutex
+}
+
+// New creates a Registry that serves on the address in the config.  The
+// logger may be nil.
+func New(config Config, logger *log.Logger) (*Registry, error) {
+	_, _, splitError := net.SplitHostPort(config.ListenAddress)
+	if splitError != nil {
+		em := fmt.Sprintf("metrics - the listen address %q is not host:port", config.ListenAddress)
+		return nil, errors.New(em)
+	}
+
+	if !strings.HasPrefix(config.EndpointPath(), "/") {
+		em := fmt.Sprintf("metrics - the path %q does not start with /", config.Path)
+		return nil, errors.New(em)
+	}
+
+	registry := Registry{
+		config:   config,
+		logger:   logger,
+		byType:   make(map[int]uint64),
+		backlogs: make(map[string]func() int),
+		dropped:  make(map[string]func() uint64),
+	}
+
+	return &registry, nil
+}
+
+// Count counts a message and its bytes.  The bytes of non-RTCM data are
+// counted but the data is not counted as a message.
+func (registry *Registry) Count(message *rtcm.Message) {
+	if message == nil {
+		return
+	}
+
+	atomic.AddUint64(&registry.bytesIn, uint64(len(message.RawData)))
+
+	if message.MessageType == utils.NonRTCMMessage {
+		return
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.byType[message.MessageType]++
+}
+
+// AddBytesOut counts bytes sent on.
+func (registry *Registry) AddBytesOut(n int) {
+	atomic.AddUint64(&registry.bytesOut, uint64(n))
+}
+
+// CountCasterReconnect counts a new connection to the caster made after the
+// last one failed.
+func (registry *Registry) CountCasterReconnect() {
+	atomic.AddUint64(&registry.casterReconnects, 1)
+}
+
+// CountDeviceReconnect counts a new connection to the device made after the
+// last one was lost.
+func (registry *Registry) CountDeviceReconnect() {
+	atomic.AddUint64(&registry.deviceReconnects, 1)
+}
+
+// WatchHandler adds the CRC failures and the other events counted by the
+// RTCM handler to the totals.  An application that makes a new handler each
+// time it connects to the device should watch each of them.
+func (registry *Registry) WatchHandler(handler *rtcm.Handler) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.handlers = append(registry.handlers, handler)
+}
+
+// WatchBacklog reports the length of a stage's backlog, as given by the
+// function, under the stage's name.  Watching the same stage again replaces
+// the function.
+func (registry *Registry) WatchBacklog(stage string, length func() int) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.backlogs[stage] = length
+}
+
+// WatchDropped reports the number of messages that a stage has dropped, as
+// given by the function, under the stage's name.  Watching the same stage
+// again replaces the function.
+func (registry *Registry) WatchDropped(stage string, count func() uint64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.dropped[stage] = count
+}
+
+// WatchStats adds the rolling statistics kept by the aggregator to the
+// figures.  The application feeds the aggregator.
+func (registry *Registry) WatchStats(aggregator *stats.Aggregator) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.aggregator = aggregator
+}
+
+// ServeHTTP writes the figures in the Prometheus text format.
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	registry.Write(w)
+}
+
+// Write writes the figures in the Prometheus text format.
+func (registry *Registry) Write(w io.Writer) {
+	registry.mutex.Lock()
+	byType := make(map[int]uint64)
+	for messageType, n := range registry.byType {
+		byType[messageType] = n
+	}
+	handlers := append([]*rtcm.Handler{}, registry.handlers...)
+	backlogs := make(map[string]func() int)
+	for stage, length := range registry.backlogs {
+		backlogs[stage] = length
+	}
+	dropped := make(map[string]func() uint64)
+	for stage, count := range registry.dropped {
+		dropped[stage] = count
+	}
+	aggregator := registry.aggregator
+	registry.mutex.Unlock()
+
+	writeHeader(w, "ntrip_messages_total", "counter", "RTCM messages received, by message type.")
+	types := make([]int, 0, len(byType))
+	for messageType := range byType {
+		types = append(types, messageType)
+	}
+	sort.Ints(types)
+	for _, messageType := range types {
+		fmt.Fprintf(w, "ntrip_messages_total{type=\"%d\"} %d\n", messageType, byType[messageType])
+	}
+
+	var crcFailures uint64
+	for _, handler := range handlers {
+		crcFailures += handler.Stats().CRCFailures
+	}
+	writeCounter(w, "ntrip_crc_failures_total", "Message frames that failed the CRC check.", crcFailures)
+
+	events := make(map[string]uint64)
+	for _, handler := range handlers {
+		for kind, n := range handler.Stats().Events {
+			events[kind] += n
+		}
+	}
+	writeHeader(w, "ntrip_handler_events_total", "counter", "Trouble found in the input by the RTCM handler, by kind.")
+	for _, kind := range rtcm.EventKinds() {
+		fmt.Fprintf(w, "ntrip_handler_events_total{kind=%q} %d\n", kind.String(), events[kind.String()])
+	}
+
+	writeCounter(w, "ntrip_bytes_in_total", "Bytes of input, RTCM or not.",
+		atomic.LoadUint64(&registry.bytesIn))
+	writeCounter(w, "ntrip_bytes_out_total", "Bytes sent on.",
+		atomic.LoadUint64(&registry.bytesOut))
+	writeCounter(w, "ntrip_caster_reconnects_total", "Connections to the caster made after a failure.",
+		atomic.LoadUint64(&registry.casterReconnects))
+	writeCounter(w, "ntrip_device_reconnects_total", "Connections to the device made after it was lost.",
+		atomic.LoadUint64(&registry.deviceReconnects))
+
+	writeHeader(w, "ntrip_backlog_messages", "gauge", "Messages waiting in each stage.")
+	stages := make([]string, 0, len(backlogs))
+	for stage := range backlogs {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		fmt.Fprintf(w, "ntrip_backlog_messages{stage=%q} %d\n", stage, backlogs[stage]())
+	}
+
+	writeHeader(w, "ntrip_dropped_messages_total", "counter", "Messages dropped because a stage was behind.")
+	stages = make([]string, 0, len(dropped))
+	for stage := range dropped {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		fmt.Fprintf(w, "ntrip_dropped_messages_total{stage=%q} %d\n", stage, dropped[stage]())
+	}
+
+	if aggregator != nil {
+		writeStats(w, aggregator.Snapshot())
+	}
+}
+
+// writeStats writes the rolling statistics of the observations.
+func writeStats(w io.Writer, snapshot *stats.Snapshot) {
+	writeHeader(w, "ntrip_satellites", "gauge", "Satellites in the latest epoch, by constellation.")
+	constellations := make([]string, 0, len(snapshot.Constellations))
+	for constellation := range snapshot.Constellations {
+		constellations = append(constellations, constellation)
+	}
+	sort.Strings(constellations)
+	for _, constellation := range constellations {
+		fmt.Fprintf(w, "ntrip_satellites{constellation=%q} %d\n",
+			constellation, snapshot.Constellations[constellation].Latest)
+	}
+
+	writeHeader(w, "ntrip_signal_cnr_dbhz", "gauge", "Mean carrier to noise ratio, by constellation and signal.")
+	for _, signal := range snapshot.Signals {
+		fmt.Fprintf(w, "ntrip_signal_cnr_dbhz{constellation=%q,signal=\"%d\"} %g\n",
+			signal.Constellation, signal.ID, signal.MeanCNR)
+	}
+
+	writeHeader(w, "ntrip_message_gap_max_seconds", "gauge", "Longest recent gap between messages, by message type.")
+	types := make([]int, 0, len(snapshot.Messages))
+	for messageType := range snapshot.Messages {
+		types = append(types, messageType)
+	}
+	sort.Ints(types)
+	for _, messageType := range types {
+		fmt.Fprintf(w, "ntrip_message_gap_max_seconds{type=\"%d\"} %g\n",
+			messageType, snapshot.Messages[messageType].MaxGapSeconds)
+	}
+
+	writeHeader(w, "ntrip_epoch_completeness_percent", "gauge", "Recent epochs with observations from all constellations.")
+	fmt.Fprintf(w, "ntrip_epoch_completeness_percent %g\n", snapshot.Epochs.Percent)
+}
+
+// Listen starts listening on the address in the config.  It returns an
+// error if the address can't be used, for example because another program
+// is listening on it.
+func (registry *Registry) Listen() error {
+	listener, listenError := net.Listen("tcp", registry.config.ListenAddress)
+	if listenError != nil {
+		em := fmt.Sprintf("metrics - cannot listen on %s - %v", registry.config.ListenAddress, listenError)
+		return errors.New(em)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.listener = listener
+	return nil
+}
+
+// Addr returns the address on which the Registry is listening, nil if
+// Listen has not been called.
+func (registry *Registry) Addr() net.Addr {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if registry.listener == nil {
+		return nil
+	}
+	return registry.listener.Addr()
+}
+
+// Run serves the figures until the stop channel is closed.  If the channel
+// is nil, it runs forever.  Listen must be called first.  It can be run in
+// a goroutine.
+func (registry *Registry) Run(stop <-chan struct{}) {
+	registry.mutex.Lock()
+	listener := registry.listener
+	registry.mutex.Unlock()
+	if listener == nil {
+		eventlog.Println(registry.logger, "metrics - Run called before Listen")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(registry.config.EndpointPath(), registry)
+	server := http.Server{Handler: mux}
+
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	serveError := server.Serve(listener)
+	if serveError != nil && serveError != http.ErrServerClosed {
+		eventlog.Printf(registry.logger, "metrics - %v", serveError)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeCounter writes a counter with no labels.
+func writeCounter(w io.Writer, name, help string, value uint64) {
+	writeHeader(w, name, "counter", help)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
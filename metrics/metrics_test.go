@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/stats"
+)
+
+// TestNew checks that New checks the config.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"all interfaces", Config{ListenAddress: ":9100"}, ""},
+		{"localhost", Config{ListenAddress: "localhost:9100", Path: "/stats"}, ""},
+		{"no port", Config{ListenAddress: "localhost"},
+			`metrics - the listen address "localhost" is not host:port`},
+		{"empty", Config{},
+			`metrics - the listen address "" is not host:port`},
+		{"relative path", Config{ListenAddress: ":9100", Path: "stats"},
+			`metrics - the path "stats" does not start with /`},
+	}
+	for _, td := range testData {
+		_, err := New(td.config, nil)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+		} else if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestEndpointPath checks the default path.
+func TestEndpointPath(t *testing.T) {
+	var testData = []struct {
+		path string
+		want string
+	}{
+		{"", DefaultPath},
+		{"/stats", "/stats"},
+	}
+	for _, td := range testData {
+		config := Config{ListenAddress: ":9100", Path: td.path}
+		got := config.EndpointPath()
+		if got != td.want {
+			t.Errorf("%q: want %s got %s", td.path, td.want, got)
+		}
+	}
+}
+
+// TestWrite checks the text produced by Write.
+func TestWrite(t *testing.T) {
+	registry, err := New(Config{ListenAddress: ":9100"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Feed the handler a good frame and one that fails the CRC check.
+	handler := rtcm.New(time.Now(), slog.LevelDebug)
+	input := append(append([]byte{}, testdata.MessageFrameType1005...), testdata.MessageFrameWithCRCFailure...)
+	registry.WatchHandler(handler)
+	ch_in := make(chan byte, len(input))
+	ch_out := make(chan rtcm.Message, 10)
+	for _, b := range input {
+		ch_in <- b
+	}
+	close(ch_in)
+	handler.HandleMessages(ch_in, ch_out)
+	for message := range ch_out {
+		registry.Count(&message)
+	}
+
+	registry.Count(&rtcm.Message{MessageType: 1077, RawData: make([]byte, 10)})
+	registry.Count(&rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: make([]byte, 5)})
+	registry.Count(nil)
+	registry.AddBytesOut(42)
+	registry.CountCasterReconnect()
+	registry.CountCasterReconnect()
+	registry.CountDeviceReconnect()
+	registry.WatchBacklog("reorder", func() int { return 3 })
+	registry.WatchBacklog("caster", func() int { return 0 })
+	registry.WatchDropped("display", func() uint64 { return 7 })
+
+	bytesIn := len(input) + 15
+
+	want := `# HELP ntrip_messages_total RTCM messages received, by message type.
+# TYPE ntrip_messages_total counter
+ntrip_messages_total{type="1005"} 1
+ntrip_messages_total{type="1077"} 1
+# HELP ntrip_crc_failures_total Message frames that failed the CRC check.
+# TYPE ntrip_crc_failures_total counter
+ntrip_crc_failures_total 1
+# HELP ntrip_handler_events_total Trouble found in the input by the RTCM handler, by kind.
+# TYPE ntrip_handler_events_total counter
+ntrip_handler_events_total{kind="crc_failure"} 1
+ntrip_handler_events_total{kind="truncated_frame"} 0
+ntrip_handler_events_total{kind="timestamp_out_of_range"} 0
+ntrip_handler_events_total{kind="unknown_type"} 0
+# HELP ntrip_bytes_in_total Bytes of input, RTCM or not.
+# TYPE ntrip_bytes_in_total counter
+ntrip_bytes_in_total ` + strconv.Itoa(bytesIn) + `
+# HELP ntrip_bytes_out_total Bytes sent on.
+# TYPE ntrip_bytes_out_total counter
+ntrip_bytes_out_total 42
+# HELP ntrip_caster_reconnects_total Connections to the caster made after a failure.
+# TYPE ntrip_caster_reconnects_total counter
+ntrip_caster_reconnects_total 2
+# HELP ntrip_device_reconnects_total Connections to the device made after it was lost.
+# TYPE ntrip_device_reconnects_total counter
+ntrip_device_reconnects_total 1
+# HELP ntrip_backlog_messages Messages waiting in each stage.
+# TYPE ntrip_backlog_messages gauge
+ntrip_backlog_messages{stage="caster"} 0
+ntrip_backlog_messages{stage="reorder"} 3
+# HELP ntrip_dropped_messages_total Messages dropped because a stage was behind.
+# TYPE ntrip_dropped_messages_total counter
+ntrip_dropped_messages_total{stage="display"} 7
+`
+
+	var buffer bytes.Buffer
+	registry.Write(&buffer)
+	got := buffer.String()
+	if got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+// TestWriteStats checks that the rolling statistics are added to the
+// figures.
+func TestWriteStats(t *testing.T) {
+	registry, err := New(Config{ListenAddress: ":9100"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggregator := stats.New(0)
+	registry.WatchStats(aggregator)
+	aggregator.Observe(&rtcm.Message{MessageType: 1074, RawData: testdata.MessageFrameType1074_2})
+
+	var buffer bytes.Buffer
+	registry.Write(&buffer)
+	got := buffer.String()
+
+	for _, want := range []string{
+		"# TYPE ntrip_satellites gauge\n",
+		"ntrip_satellites{constellation=\"GPS\"} 1\n",
+		"ntrip_signal_cnr_dbhz{constellation=\"GPS\",signal=\"2\"} 7\n",
+		"ntrip_signal_cnr_dbhz{constellation=\"GPS\",signal=\"16\"} 16\n",
+		"ntrip_message_gap_max_seconds{type=\"1074\"} ",
+		"ntrip_epoch_completeness_percent 100\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in\n%s", want, got)
+		}
+	}
+}
+
+// TestServeHTTP checks that the figures are served with the Prometheus
+// content type.
+func TestServeHTTP(t *testing.T) {
+	registry, err := New(Config{ListenAddress: ":9100"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Count(&rtcm.Message{MessageType: 1074, RawData: make([]byte, 10)})
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", DefaultPath, nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("want status %d got %d", http.StatusOK, recorder.Code)
+	}
+	if recorder.Header().Get("Content-Type") != contentType {
+		t.Errorf("want content type %s got %s", contentType, recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(recorder.Body.String(), "ntrip_messages_total{type=\"1074\"} 1\n") {
+		t.Errorf("message count missing from\n%s", recorder.Body.String())
+	}
+}
+
+// TestRun checks that the figures are served on the listen address and path
+// and that Run stops when asked.
+func TestRun(t *testing.T) {
+	registry, err := New(Config{ListenAddress: "127.0.0.1:0", Path: "/stats"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if registry.Addr() != nil {
+		t.Error("want no address before Listen")
+	}
+
+	listenError := registry.Listen()
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		registry.Run(stop)
+		close(done)
+	}()
+
+	url := "http://" + registry.Addr().String()
+
+	response, getError := http.Get(url + "/stats")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.Contains(string(body), "ntrip_bytes_in_total 0\n") {
+		t.Errorf("figures missing from\n%s", string(body))
+	}
+
+	response, getError = http.Get(url + "/other")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("want status %d for another path, got %d", http.StatusNotFound, response.StatusCode)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Run didn't stop")
+	}
+}
+
+// TestListenFails checks that Listen reports an address that's in use.
+func TestListenFails(t *testing.T) {
+	first, _ := New(Config{ListenAddress: "127.0.0.1:0"}, nil)
+	listenError := first.Listen()
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	address := first.Addr().String()
+
+	second, _ := New(Config{ListenAddress: address}, nil)
+	err := second.Listen()
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	wantPrefix := "metrics - cannot listen on " + address + " - "
+	if !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("want error starting %s got %s", wantPrefix, err.Error())
+	}
+
+	first.listener.Close()
+}
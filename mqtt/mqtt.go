@@ -0,0 +1,402 @@
+// The mqtt package publishes RTCM messages to an MQTT broker.  Some users,
+// for example those with fleets of drones or farm machinery, distribute
+// corrections over MQTT rather than NTRIP.  Each message is published as
+// its raw frame, and optionally as JSON, on a topic made from a template:
+//
+//	"mqtt": {
+//	    "broker": "broker.example.com:1883",
+//	    "user": "base",
+//	    "password": "secret",
+//	    "topic": "rtcm/{station}/{type}",
+//	    "json_topic": "rtcm/{station}/{type}/json"
+//	}
+//
+// In a template, {type} is replaced by the message type and {station} by
+// the reference station ID, or "none" for a message that has no station
+// ID.  The default topic is "rtcm/{station}/{type}".  The decoded JSON is
+// only published if there is a json_topic.  It holds the message type, the
+// station ID and the decoded message, for example:
+//
+//	{"message_type":1230,"station_id":0,"decoded":{"message_type":1230,...}}
+//
+// The Publisher speaks MQTT 3.1.1 and publishes with quality of service 0
+// (at most once).  Corrections are no use to a rover when they are late, so
+// there is no point in the broker storing them or the Publisher resending
+// them.  For the same reason, messages published while the broker can't be
+// reached are dropped rather than queued.  The Publisher connects when it's
+// first used and connects again, pausing between attempts, after the
+// connection fails.  Only the first of a series of failures is logged.
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// DefaultTopic is the topic template used when the config doesn't give one.
+const DefaultTopic = "rtcm/{station}/{type}"
+
+// DefaultRetry is the pause between attempts to connect used when the
+// config doesn't give one.
+const DefaultRetry = 5 * time.Second
+
+// noStation replaces {station} in the topic of a message that has no
+// station ID.
+const noStation = "none"
+
+// dialTimeout is the time allowed to connect to the broker and for it to
+// accept the connection.
+const dialTimeout = 10 * time.Second
+
+// writeTimeout is the time allowed to write to the broker, so that one that
+// has stopped reading doesn't stall the application.
+const writeTimeout = 10 * time.Second
+
+// tcpKeepalive is the idle time before a TCP keepalive probe.  The
+// Publisher asks the broker not to drop an idle connection, so this is what
+// notices a broker that has gone.
+const tcpKeepalive = 30 * time.Second
+
+// Config is the config of a Publisher, as it appears in an application's
+// JSON config file.
+type Config struct {
+	// Broker is the host:port of the MQTT broker, for example
+	// "broker.example.com:1883".
+	Broker string `json:"broker"`
+
+	// ClientID identifies the Publisher to the broker.  Empty means
+	// "go-ntrip-" followed by the process ID.
+	ClientID string `json:"client_id"`
+
+	// User and Password are the credentials, if the broker wants them.
+	User     string `json:"user"`
+	Password string `json:"password"`
+
+	// Topic is the template of the topic on which the raw frames are
+	// published.  Empty means DefaultTopic.
+	Topic string `json:"topic"`
+
+	// JSONTopic is the template of the topic on which the decoded messages
+	// are published as JSON.  Empty means that they are not published.
+	JSONTopic string `json:"json_topic"`
+
+	// Retain asks the broker to keep the last message on each topic and
+	// give it to new subscribers.  It suits a topic per message type, so
+	// that a new rover gets the base position at once.
+	Retain bool `json:"retain"`
+
+	// RetryMilliseconds is the pause after a failed attempt to connect
+	// before the next one.  0 means DefaultRetry.
+	RetryMilliseconds uint `json:"retry_milliseconds"`
+}
+
+// TopicTemplate returns the template of the topic for the raw frames.
+func (config *Config) TopicTemplate() string {
+	if len(config.Topic) == 0 {
+		return DefaultTopic
+	}
+	return config.Topic
+}
+
+// Retry returns the pause after a failed attempt to connect.
+func (config *Config) Retry() time.Duration {
+	if config.RetryMilliseconds == 0 {
+		return DefaultRetry
+	}
+	return time.Duration(config.RetryMilliseconds) * time.Millisecond
+}
+
+// Validate checks the config.
+func (config *Config) Validate() error {
+	_, _, splitError := net.SplitHostPort(config.Broker)
+	if splitError != nil {
+		em := fmt.Sprintf("mqtt - the broker %q is not host:port", config.Broker)
+		return errors.New(em)
+	}
+
+	templates := []string{config.TopicTemplate()}
+	if len(config.JSONTopic) > 0 {
+		templates = append(templates, config.JSONTopic)
+	}
+	for _, template := range templates {
+		if err := checkTemplate(template); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkTemplate checks a topic template.
+func checkTemplate(template string) error {
+	if strings.ContainsAny(template, "+#") {
+		em := fmt.Sprintf("mqtt - topic %q - wildcards are not allowed in a published topic", template)
+		return errors.New(em)
+	}
+	rest := strings.NewReplacer("{type}", "", "{station}", "").Replace(template)
+	if strings.ContainsAny(rest, "{}") {
+		em := fmt.Sprintf("mqtt - topic %q - want only {type} and {station} in braces", template)
+		return errors.New(em)
+	}
+	return nil
+}
+
+// Topic returns the topic made from the template for a message.
+func Topic(template string, message *rtcm.Message) string {
+	station := noStation
+	stationID, ok := utils.GetStationID(message.MessageType, message.RawData)
+	if ok {
+		station = strconv.Itoa(int(stationID))
+	}
+	return strings.NewReplacer(
+		"{type}", strconv.Itoa(message.MessageType),
+		"{station}", station,
+	).Replace(template)
+}
+
+// jsonMessage is the JSON form of a message.
+type jsonMessage struct {
+	MessageType int         `json:"message_type"`
+	StationID   *uint       `json:"station_id,omitempty"`
+	Decoded     interface{} `json:"decoded,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// JSON returns the message as JSON, decoding it first if that hasn't been
+// done.
+func JSON(message *rtcm.Message) ([]byte, error) {
+	if message.Readable == nil && len(message.ErrorMessage) == 0 {
+		rtcm.PrepareForDisplay(message)
+	}
+
+	m := jsonMessage{
+		MessageType: message.MessageType,
+		Decoded:     message.Readable,
+		Error:       message.ErrorMessage,
+	}
+	if stationID, ok := utils.GetStationID(message.MessageType, message.RawData); ok {
+		m.StationID = &stationID
+	}
+
+	return json.Marshal(&m)
+}
+
+// Publisher publishes messages to an MQTT broker.  It's safe for
+// concurrent use.
+type Publisher struct {
+	// config is the config of the Publisher.
+	config Config
+
+	// clientID identifies the Publisher to the broker.
+	clientID string
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// conn is the connection to the broker, nil if there isn't one.
+	conn net.Conn
+
+	// nextAttempt is the earliest time at which to try to connect again.
+	nextAttempt time.Time
+
+	// failureLogged is true if the last failure to connect has been logged.
+	failureLogged bool
+
+	// jsonFailures holds the message types that could not be turned into
+	// JSON, so that each is only logged once.
+	jsonFailures map[int]bool
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// New creates a Publisher that publishes to the broker in the config.  It
+// doesn't connect until it's used.  The logger may be nil.
+func New(config Config, logger *log.Logger) (*Publisher, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	clientID := config.ClientID
+	if len(clientID) == 0 {
+		clientID = fmt.Sprintf("go-ntrip-%d", os.Getpid())
+	}
+
+	publisher := Publisher{
+		config:       config,
+		clientID:     clientID,
+		logger:       logger,
+		jsonFailures: make(map[int]bool),
+		now:          time.Now,
+	}
+	return &publisher, nil
+}
+
+// Check connects to the broker, logs in and disconnects again.
+func (publisher *Publisher) Check() error {
+	conn, connectError := publisher.connect()
+	if connectError != nil {
+		return connectError
+	}
+	conn.Write(disconnectPacket())
+	return conn.Close()
+}
+
+// Publish publishes a message on its topic and, if the config has a JSON
+// topic, publishes it as JSON too.  Non-RTCM data is ignored.  If the
+// broker can't be reached the message is dropped.
+func (publisher *Publisher) Publish(message *rtcm.Message) {
+	if message == nil || message.MessageType == utils.NonRTCMMessage {
+		return
+	}
+
+	var jsonPacket []byte
+	if len(publisher.config.JSONTopic) > 0 {
+		jsonPacket = publisher.jsonPacket(message)
+	}
+
+	rawPacket, packetError := publishPacket(
+		Topic(publisher.config.TopicTemplate(), message), message.RawData, publisher.config.Retain)
+	if packetError != nil {
+		eventlog.Println(publisher.logger, packetError.Error())
+		return
+	}
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	if !publisher.ensureConnected() {
+		return
+	}
+
+	publisher.write(rawPacket)
+	if jsonPacket != nil {
+		publisher.write(jsonPacket)
+	}
+}
+
+// Close disconnects from the broker, if there is a connection.
+func (publisher *Publisher) Close() error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.conn == nil {
+		return nil
+	}
+	publisher.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	publisher.conn.Write(disconnectPacket())
+	err := publisher.conn.Close()
+	publisher.conn = nil
+	return err
+}
+
+// jsonPacket returns a PUBLISH packet carrying the message as JSON, nil if
+// it can't be made.
+func (publisher *Publisher) jsonPacket(message *rtcm.Message) []byte {
+	payload, jsonError := JSON(message)
+	if jsonError == nil {
+		p, packetError := publishPacket(
+			Topic(publisher.config.JSONTopic, message), payload, publisher.config.Retain)
+		if packetError == nil {
+			return p
+		}
+		jsonError = packetError
+	}
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if !publisher.jsonFailures[message.MessageType] {
+		eventlog.Printf(publisher.logger, "mqtt - cannot publish message type %d as JSON - %v",
+			message.MessageType, jsonError)
+		publisher.jsonFailures[message.MessageType] = true
+	}
+	return nil
+}
+
+// ensureConnected connects to the broker if there is no connection and it's
+// time to try again.  It returns true if there is a connection.  The
+// caller must hold the mutex.
+func (publisher *Publisher) ensureConnected() bool {
+	if publisher.conn != nil {
+		return true
+	}
+
+	now := publisher.now()
+	if now.Before(publisher.nextAttempt) {
+		return false
+	}
+
+	conn, connectError := publisher.connect()
+	if connectError != nil {
+		if !publisher.failureLogged {
+			eventlog.Println(publisher.logger, connectError.Error()+".  Retrying")
+			publisher.failureLogged = true
+		}
+		publisher.nextAttempt = now.Add(publisher.config.Retry())
+		return false
+	}
+
+	eventlog.Printf(publisher.logger, "mqtt - connected to %s", publisher.config.Broker)
+	publisher.failureLogged = false
+	publisher.conn = conn
+	return true
+}
+
+// write writes a packet to the broker, dropping the connection if that
+// fails.  The caller must hold the mutex.
+func (publisher *Publisher) write(p []byte) {
+	if publisher.conn == nil {
+		return
+	}
+	publisher.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, writeError := publisher.conn.Write(p)
+	if writeError != nil {
+		eventlog.Printf(publisher.logger, "mqtt - lost the connection to %s - %v",
+			publisher.config.Broker, writeError)
+		publisher.conn.Close()
+		publisher.conn = nil
+	}
+}
+
+// connect connects to the broker and logs in.
+func (publisher *Publisher) connect() (net.Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout, KeepAlive: tcpKeepalive}
+	conn, dialError := dialer.Dial("tcp", publisher.config.Broker)
+	if dialError != nil {
+		em := fmt.Sprintf("mqtt - cannot connect to %s - %v", publisher.config.Broker, dialError)
+		return nil, errors.New(em)
+	}
+
+	// A keepalive of zero asks the broker not to drop the connection when
+	// the messages stop for a while.
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	_, writeError := conn.Write(connectPacket(
+		publisher.clientID, publisher.config.User, publisher.config.Password, 0))
+	if writeError != nil {
+		conn.Close()
+		em := fmt.Sprintf("mqtt - cannot log in to %s - %v", publisher.config.Broker, writeError)
+		return nil, errors.New(em)
+	}
+	ackError := readConnAck(conn)
+	if ackError != nil {
+		conn.Close()
+		return nil, ackError
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
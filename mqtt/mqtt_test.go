@@ -0,0 +1,264 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// published is a message received by the fake broker.
+type published struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// readPacket is a helper.  It reads a control packet and returns the first
+// byte and the body.
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	first, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	return first, body, err
+}
+
+// fakeBroker accepts one connection on the listener, sends the CONNECT
+// packet on the connects channel, replies with the given return code and
+// then sends each message published on the messages channel.  It closes
+// the messages channel when it gets a DISCONNECT or the connection is
+// closed.
+func fakeBroker(listener net.Listener, returnCode byte, connects chan<- []byte, messages chan<- published) {
+	defer close(messages)
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	_, connect, err := readPacket(reader)
+	if err != nil {
+		return
+	}
+	connects <- connect
+	conn.Write([]byte{0x20, 2, 0, returnCode})
+
+	for {
+		first, body, err := readPacket(reader)
+		if err != nil || first>>4 == packetDisconnect {
+			return
+		}
+		topicLength := int(body[0])<<8 | int(body[1])
+		messages <- published{
+			topic:   string(body[2 : 2+topicLength]),
+			payload: body[2+topicLength:],
+			retain:  first&flagRetain != 0,
+		}
+	}
+}
+
+// TestValidate checks that the config is checked.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"default topic", Config{Broker: "localhost:1883"}, ""},
+		{"both topics", Config{Broker: ":1883", Topic: "base/{type}", JSONTopic: "json/{station}/{type}"}, ""},
+		{"no port", Config{Broker: "localhost"},
+			`mqtt - the broker "localhost" is not host:port`},
+		{"wildcard", Config{Broker: ":1883", Topic: "rtcm/#"},
+			`mqtt - topic "rtcm/#" - wildcards are not allowed in a published topic`},
+		{"bad placeholder", Config{Broker: ":1883", JSONTopic: "rtcm/{stn}"},
+			`mqtt - topic "rtcm/{stn}" - want only {type} and {station} in braces`},
+	}
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestTopic checks that the placeholders are replaced.
+func TestTopic(t *testing.T) {
+	var testData = []struct {
+		template string
+		message  rtcm.Message
+		want     string
+	}{
+		{DefaultTopic, rtcm.Message{MessageType: 1005, RawData: testdata.MessageFrameType1005}, "rtcm/2/1005"},
+		{"base/{type}", rtcm.Message{MessageType: 1077, RawData: testdata.MessageFrameType1077}, "base/1077"},
+		{DefaultTopic, rtcm.Message{MessageType: 1013, RawData: []byte{0xd3, 0, 0}}, "rtcm/none/1013"},
+	}
+	for _, td := range testData {
+		got := Topic(td.template, &td.message)
+		if td.want != got {
+			t.Errorf("want %s got %s", td.want, got)
+		}
+	}
+}
+
+// TestJSON checks that a message is decoded and turned into JSON.
+func TestJSON(t *testing.T) {
+	const want = `{"message_type":1230,"station_id":0,"decoded":{"message_type":1230,"aligned":true,"signals_mask":10,"biases":[0,0,0,0]}}`
+
+	message := rtcm.Message{MessageType: utils.MessageTypeGCPB, RawData: testdata.Fake1230}
+	got, err := JSON(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != string(got) {
+		t.Errorf("want %s\ngot  %s", want, string(got))
+	}
+}
+
+// TestPublish checks that the Publisher logs in, publishes the raw frames
+// and the JSON on their topics, ignores non-RTCM data and disconnects.
+func TestPublish(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	connects := make(chan []byte, 1)
+	messages := make(chan published, 10)
+	go fakeBroker(listener, 0, connects, messages)
+
+	config := Config{
+		Broker:    listener.Addr().String(),
+		ClientID:  "base",
+		User:      "user",
+		Password:  "secret",
+		JSONTopic: "json/{type}",
+		Retain:    true,
+	}
+	publisher, err := New(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher.Publish(&rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")})
+	publisher.Publish(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+	publisher.Close()
+
+	wantConnect := connectPacket("base", "user", "secret", 0)
+	if got := <-connects; !bytes.Equal(wantConnect[2:], got) {
+		t.Errorf("want CONNECT % x got % x", wantConnect[2:], got)
+	}
+
+	var got []published
+	for m := range messages {
+		got = append(got, m)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want 2 messages got %d", len(got))
+	}
+
+	if got[0].topic != "rtcm/2/1005" || !bytes.Equal(got[0].payload, testdata.MessageFrameType1005) || !got[0].retain {
+		t.Errorf("unexpected raw message %+v", got[0])
+	}
+
+	if got[1].topic != "json/1005" || !got[1].retain {
+		t.Errorf("unexpected JSON message %+v", got[1])
+	}
+	var decoded jsonMessage
+	if err := json.Unmarshal(got[1].payload, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.MessageType != 1005 || decoded.StationID == nil || *decoded.StationID != 2 || decoded.Decoded == nil {
+		t.Errorf("unexpected JSON %s", string(got[1].payload))
+	}
+}
+
+// TestPublishRefused checks that Check reports a refused login and that
+// Publish drops the message and doesn't try again until the retry time has
+// passed.
+func TestPublishRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	connects := make(chan []byte, 1)
+	messages := make(chan published, 1)
+	go fakeBroker(listener, 5, connects, messages)
+
+	publisher, err := New(Config{Broker: listener.Addr().String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const wantError = "mqtt - the broker refused the connection - not authorised"
+	checkError := publisher.Check()
+	if checkError == nil || checkError.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, checkError)
+	}
+	<-connects
+	<-messages
+
+	// Another broker on the same address would accept the connection, but
+	// the Publisher waits for the retry time after a failure.
+	now := time.Now()
+	publisher.now = func() time.Time { return now }
+	publisher.nextAttempt = now.Add(time.Second)
+	go fakeBroker(listener, 0, connects, make(chan published, 1))
+	publisher.Publish(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+	if publisher.conn != nil {
+		t.Error("want no connection before the retry time")
+	}
+}
+
+// TestCheckUnreachable checks the error when the broker can't be reached.
+func TestCheckUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	publisher, err := New(Config{Broker: address}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPrefix := "mqtt - cannot connect to " + address + " - "
+	checkError := publisher.Check()
+	if checkError == nil || !strings.HasPrefix(checkError.Error(), wantPrefix) {
+		t.Errorf("want %q... got %v", wantPrefix, checkError)
+	}
+}
@@ -0,0 +1,150 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The MQTT 3.1.1 control packet types used here, in the top four bits of
+// the first byte of a packet.
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetDisconnect = 14
+)
+
+// protocolLevel is the protocol level of MQTT 3.1.1.
+const protocolLevel = 4
+
+// Connect flags.
+const (
+	flagUserName     = 0x80
+	flagPassword     = 0x40
+	flagCleanSession = 0x02
+)
+
+// flagRetain is the retain flag in the first byte of a PUBLISH packet.
+const flagRetain = 0x01
+
+// maxRemainingLength is the largest length that can follow the first byte
+// of a packet.
+const maxRemainingLength = 268435455
+
+// connAckReasons gives the meaning of each CONNACK return code that isn't
+// zero (accepted).
+var connAckReasons = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorised",
+}
+
+// appendString appends a string to the buffer preceded by its length, as
+// MQTT encodes strings.
+func appendString(buffer []byte, s string) []byte {
+	buffer = append(buffer, byte(len(s)>>8), byte(len(s)))
+	return append(buffer, s...)
+}
+
+// appendRemainingLength appends the length of the rest of a packet to the
+// buffer, seven bits to a byte, low order first.
+func appendRemainingLength(buffer []byte, length int) []byte {
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buffer = append(buffer, b)
+		if length == 0 {
+			return buffer
+		}
+	}
+}
+
+// packet returns a complete control packet made of the first byte and the
+// body.
+func packet(first byte, body []byte) []byte {
+	p := appendRemainingLength([]byte{first}, len(body))
+	return append(p, body...)
+}
+
+// connectPacket returns a CONNECT packet.  The user name and the password
+// are left out if they are empty.
+func connectPacket(clientID, userName, password string, keepaliveSeconds uint16) []byte {
+	flags := byte(flagCleanSession)
+	if len(userName) > 0 {
+		flags |= flagUserName
+	}
+	if len(password) > 0 {
+		flags |= flagPassword
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags, byte(keepaliveSeconds>>8), byte(keepaliveSeconds))
+	body = appendString(body, clientID)
+	if len(userName) > 0 {
+		body = appendString(body, userName)
+	}
+	if len(password) > 0 {
+		body = appendString(body, password)
+	}
+
+	return packet(packetConnect<<4, body)
+}
+
+// publishPacket returns a PUBLISH packet with quality of service 0 (at most
+// once), which needs no acknowledgement.
+func publishPacket(topic string, payload []byte, retain bool) ([]byte, error) {
+	length := 2 + len(topic) + len(payload)
+	if length > maxRemainingLength {
+		em := fmt.Sprintf("mqtt - a payload of %d bytes is too big to publish", len(payload))
+		return nil, errors.New(em)
+	}
+
+	first := byte(packetPublish << 4)
+	if retain {
+		first |= flagRetain
+	}
+
+	body := make([]byte, 0, length)
+	body = appendString(body, topic)
+	body = append(body, payload...)
+
+	return packet(first, body), nil
+}
+
+// disconnectPacket returns a DISCONNECT packet.
+func disconnectPacket() []byte {
+	return packet(packetDisconnect<<4, nil)
+}
+
+// readConnAck reads a CONNACK packet and returns an error if it's not one
+// or the broker refused the connection.
+func readConnAck(reader io.Reader) error {
+	var ack [4]byte
+	_, readError := io.ReadFull(reader, ack[:])
+	if readError != nil {
+		em := fmt.Sprintf("mqtt - no reply from the broker - %v", readError)
+		return errors.New(em)
+	}
+
+	if ack[0] != packetConnAck<<4 || ack[1] != 2 {
+		em := fmt.Sprintf("mqtt - expected a CONNACK packet, got % x", ack)
+		return errors.New(em)
+	}
+
+	if ack[3] != 0 {
+		reason, ok := connAckReasons[ack[3]]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", ack[3])
+		}
+		em := fmt.Sprintf("mqtt - the broker refused the connection - %s", reason)
+		return errors.New(em)
+	}
+
+	return nil
+}
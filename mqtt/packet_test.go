@@ -0,0 +1,113 @@
+package mqtt
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAppendRemainingLength checks the encoding of the length at the edges
+// of each number of bytes.
+func TestAppendRemainingLength(t *testing.T) {
+	var testData = []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{maxRemainingLength, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, td := range testData {
+		got := appendRemainingLength(nil, td.length)
+		if !bytes.Equal(td.want, got) {
+			t.Errorf("%d: want % x got % x", td.length, td.want, got)
+		}
+	}
+}
+
+// TestConnectPacket checks the CONNECT packet with and without
+// credentials.
+func TestConnectPacket(t *testing.T) {
+	var testData = []struct {
+		description string
+		user        string
+		password    string
+		want        []byte
+	}{
+		{"anonymous", "", "", []byte{
+			0x10, 14,
+			0, 4, 'M', 'Q', 'T', 'T', 4, 0x02, 0, 60,
+			0, 2, 'i', 'd',
+		}},
+		{"credentials", "u", "pw", []byte{
+			0x10, 21,
+			0, 4, 'M', 'Q', 'T', 'T', 4, 0xc2, 0, 60,
+			0, 2, 'i', 'd',
+			0, 1, 'u',
+			0, 2, 'p', 'w',
+		}},
+	}
+	for _, td := range testData {
+		got := connectPacket("id", td.user, td.password, 60)
+		if !bytes.Equal(td.want, got) {
+			t.Errorf("%s: want % x got % x", td.description, td.want, got)
+		}
+	}
+}
+
+// TestPublishPacket checks the PUBLISH packet with and without the retain
+// flag.
+func TestPublishPacket(t *testing.T) {
+	var testData = []struct {
+		retain bool
+		want   []byte
+	}{
+		{false, []byte{0x30, 6, 0, 2, 'a', '/', 0xd3, 0}},
+		{true, []byte{0x31, 6, 0, 2, 'a', '/', 0xd3, 0}},
+	}
+	for _, td := range testData {
+		got, err := publishPacket("a/", []byte{0xd3, 0}, td.retain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(td.want, got) {
+			t.Errorf("retain %v: want % x got % x", td.retain, td.want, got)
+		}
+	}
+}
+
+// TestReadConnAck checks that readConnAck accepts a good CONNACK and
+// explains a refusal.
+func TestReadConnAck(t *testing.T) {
+	var testData = []struct {
+		description string
+		reply       []byte
+		wantError   string
+	}{
+		{"accepted", []byte{0x20, 2, 0, 0}, ""},
+		{"bad password", []byte{0x20, 2, 0, 4},
+			"mqtt - the broker refused the connection - bad user name or password"},
+		{"unknown code", []byte{0x20, 2, 0, 99},
+			"mqtt - the broker refused the connection - return code 99"},
+		{"not a CONNACK", []byte{0x30, 2, 0, 0},
+			"mqtt - expected a CONNACK packet, got 30 02 00 00"},
+		{"short", []byte{0x20, 2},
+			"mqtt - no reply from the broker - unexpected EOF"},
+	}
+	for _, td := range testData {
+		err := readConnAck(bytes.NewReader(td.reply))
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package nmea
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+
+	"go.bug.st/serial"
+)
+
+// DefaultInterval is the time between bursts of sentences if the config
+// doesn't specify one.
+const DefaultInterval = time.Second
+
+// DefaultAccuracy is the standard deviation in metres given in GST sentences
+// if the config doesn't specify one.
+const DefaultAccuracy = 0.02
+
+// dialTimeout is the time allowed to connect to a TCP sink.
+const dialTimeout = 5 * time.Second
+
+// BeaconConfig is the config of a Beacon, as it appears in the JSON config
+// file, for example:
+//
+//	"nmea_beacon": {
+//	    "sink": "tcp",
+//	    "address": "monitor.example.com:10110",
+//	    "interval_seconds": 5,
+//	    "sentences": ["GGA", "GST"]
+//	}
+type BeaconConfig struct {
+	// Sink is "serial" or "tcp".
+	Sink string `json:"sink"`
+
+	// Address is the device name of the serial line (for example
+	// "/dev/ttyUSB0") or the host and port to connect to.
+	Address string `json:"address"`
+
+	// Speed is the line speed of a serial sink in bits per second.  0 means 9600.
+	Speed int `json:"speed"`
+
+	// IntervalSeconds is the time between bursts of sentences.  0 means one second.
+	IntervalSeconds uint `json:"interval_seconds"`
+
+	// Sentences lists the sentences to send, "GGA" and/or "GST".  Empty
+	// means just GGA.
+	Sentences []string `json:"sentences"`
+
+	// FixQuality is the fix quality given in GGA sentences.  0 means
+	// FixQualityGPS.  Some tools ignore sentences with other qualities.
+	FixQuality int `json:"fix_quality"`
+
+	// GeoidSeparation is the height in metres of the geoid above the
+	// ellipsoid at the base station, used to give the altitude in GGA
+	// sentences.
+	GeoidSeparation float64 `json:"geoid_separation"`
+
+	// AccuracyMetres is the standard deviation given in GST sentences.  0
+	// means DefaultAccuracy.
+	AccuracyMetres float64 `json:"accuracy_metres"`
+}
+
+// Beacon holds the base station's position and sends it as NMEA sentences
+// to a sink at regular intervals.  Until it's given a position, it sends
+// nothing.  If the sink fails, the Beacon closes it and reopens it next time.
+type Beacon struct {
+	config   BeaconConfig
+	interval time.Duration
+
+	// open opens the sink.  It's set according to the config and replaced
+	// during testing.
+	open func() (io.WriteCloser, error)
+
+	// sink is the open sink or nil.
+	sink io.WriteCloser
+
+	// position is the latest position, nil if there isn't one yet.
+	position *Position
+
+	mutex sync.Mutex
+}
+
+// NewBeacon creates a Beacon from the given config.
+func NewBeacon(config BeaconConfig) (*Beacon, error) {
+	beacon := Beacon{config: config}
+
+	switch config.Sink {
+	case "serial":
+		speed := config.Speed
+		if speed == 0 {
+			speed = 9600
+		}
+		beacon.open = func() (io.WriteCloser, error) {
+			return serial.Open(config.Address, &serial.Mode{BaudRate: speed})
+		}
+	case "tcp":
+		beacon.open = func() (io.WriteCloser, error) {
+			return net.DialTimeout("tcp", config.Address, dialTimeout)
+		}
+	default:
+		em := fmt.Sprintf("NMEA sink %q - want serial or tcp", config.Sink)
+		return nil, errors.New(em)
+	}
+
+	for _, sentence := range config.Sentences {
+		if sentence != "GGA" && sentence != "GST" {
+			em := fmt.Sprintf("NMEA sentence %q - want GGA or GST", sentence)
+			return nil, errors.New(em)
+		}
+	}
+
+	beacon.interval = DefaultInterval
+	if config.IntervalSeconds > 0 {
+		beacon.interval = time.Duration(config.IntervalSeconds) * time.Second
+	}
+
+	return &beacon, nil
+}
+
+// SetPosition sets the position sent by the Beacon.
+func (beacon *Beacon) SetPosition(position Position) {
+	beacon.mutex.Lock()
+	defer beacon.mutex.Unlock()
+
+	beacon.position = &position
+}
+
+// Update sets the position from a message type 1005.
+func (beacon *Beacon) Update(message *type1005.Message) {
+	beacon.SetPosition(PositionFrom1005(message))
+}
+
+// Sentences returns the sentences for the given time, or an empty string
+// if the Beacon doesn't have a position yet.
+func (beacon *Beacon) Sentences(t time.Time) string {
+	beacon.mutex.Lock()
+	defer beacon.mutex.Unlock()
+
+	if beacon.position == nil {
+		return ""
+	}
+
+	quality := beacon.config.FixQuality
+	if quality == 0 {
+		quality = FixQualityGPS
+	}
+
+	accuracy := beacon.config.AccuracyMetres
+	if accuracy == 0 {
+		accuracy = DefaultAccuracy
+	}
+
+	wanted := beacon.config.Sentences
+	if len(wanted) == 0 {
+		wanted = []string{"GGA"}
+	}
+
+	var sentences strings.Builder
+	for _, sentence := range wanted {
+		switch sentence {
+		case "GGA":
+			sentences.WriteString(GGA(t, *beacon.position, quality, 0, beacon.config.GeoidSeparation))
+		case "GST":
+			sentences.WriteString(GST(t, accuracy))
+		}
+	}
+
+	return sentences.String()
+}
+
+// CheckSink opens the sink and closes it again, to check that it can be
+// reached.  It doesn't write anything.
+func (beacon *Beacon) CheckSink() error {
+	sink, openError := beacon.open()
+	if openError != nil {
+		return openError
+	}
+	return sink.Close()
+}
+
+// Emit writes the sentences for the given time to the sink, opening it if
+// necessary.  If the write fails, the sink is closed.
+func (beacon *Beacon) Emit(t time.Time) error {
+	sentences := beacon.Sentences(t)
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	if beacon.sink == nil {
+		sink, openError := beacon.open()
+		if openError != nil {
+			return openError
+		}
+		beacon.sink = sink
+	}
+
+	_, writeError := beacon.sink.Write([]byte(sentences))
+	if writeError != nil {
+		beacon.sink.Close()
+		beacon.sink = nil
+		return writeError
+	}
+
+	return nil
+}
+
+// Run emits the sentences at regular intervals until the stop channel is
+// closed, then closes the sink.  Errors are reported to the given function,
+// which may be nil.  It can be run in a goroutine.
+func (beacon *Beacon) Run(stop <-chan struct{}, reportError func(error)) {
+	ticker := time.NewTicker(beacon.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			if beacon.sink != nil {
+				beacon.sink.Close()
+				beacon.sink = nil
+			}
+			return
+		case t := <-ticker.C:
+			err := beacon.Emit(t)
+			if err != nil && reportError != nil {
+				reportError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package nmea
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSink is a sink that records what's written to it and can be made
+// to fail.
+type fakeSink struct {
+	bytes.Buffer
+	fail   bool
+	closed bool
+}
+
+func (sink *fakeSink) Write(data []byte) (int, error) {
+	if sink.fail {
+		return 0, errors.New("write failed")
+	}
+	return sink.Buffer.Write(data)
+}
+
+func (sink *fakeSink) Close() error {
+	sink.closed = true
+	return nil
+}
+
+// TestNewBeaconWithBadConfig checks that NewBeacon rejects a bad config.
+func TestNewBeaconWithBadConfig(t *testing.T) {
+	var testData = []struct {
+		config    BeaconConfig
+		wantError string
+	}{
+		{BeaconConfig{Sink: "udp"}, `NMEA sink "udp" - want serial or tcp`},
+		{BeaconConfig{Sink: "tcp", Sentences: []string{"RMC"}}, `NMEA sentence "RMC" - want GGA or GST`},
+	}
+	for _, td := range testData {
+		_, err := NewBeacon(td.config)
+		if err == nil {
+			t.Errorf("want error %s", td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("want error %s got %s", td.wantError, err.Error())
+		}
+	}
+}
+
+// TestBeaconSentences checks that the beacon produces the configured sentences.
+func TestBeaconSentences(t *testing.T) {
+	timestamp := time.Date(2024, time.March, 1, 12, 35, 19, 250000000, time.UTC)
+	position := Position{Latitude: 48.1173, Longitude: -11.51666667, Height: 592.3}
+
+	gga := GGA(timestamp, position, FixQualityGPS, 0, 0)
+	gst := GST(timestamp, DefaultAccuracy)
+
+	var testData = []struct {
+		description string
+		sentences   []string
+		want        string
+	}{
+		{"default", nil, gga},
+		{"both", []string{"GGA", "GST"}, gga + gst},
+		{"GST", []string{"GST"}, gst},
+	}
+	for _, td := range testData {
+		beacon, err := NewBeacon(BeaconConfig{Sink: "tcp", Sentences: td.sentences})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if beacon.Sentences(timestamp) != "" {
+			t.Errorf("%s: want no sentences before the position is known", td.description)
+		}
+
+		beacon.SetPosition(position)
+
+		got := beacon.Sentences(timestamp)
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.description, td.want, got)
+		}
+	}
+}
+
+// TestBeaconEmit checks that Emit writes to the sink and reopens it after
+// a failure.
+func TestBeaconEmit(t *testing.T) {
+	timestamp := time.Date(2024, time.March, 1, 12, 35, 19, 250000000, time.UTC)
+
+	beacon, _ := NewBeacon(BeaconConfig{Sink: "tcp"})
+
+	opens := 0
+	sinks := []*fakeSink{{fail: true}, {}}
+	beacon.open = func() (io.WriteCloser, error) {
+		sink := sinks[opens]
+		opens++
+		return sink, nil
+	}
+
+	// With no position, nothing is sent and the sink is not opened.
+	noPositionError := beacon.Emit(timestamp)
+	if noPositionError != nil {
+		t.Error(noPositionError)
+	}
+	if opens != 0 {
+		t.Errorf("want no opens, got %d", opens)
+	}
+
+	beacon.SetPosition(Position{Latitude: 1, Longitude: 2, Height: 3})
+
+	// The first sink fails and is closed.
+	failError := beacon.Emit(timestamp)
+	if failError == nil {
+		t.Error("want an error")
+	}
+	if !sinks[0].closed {
+		t.Error("want the failed sink to be closed")
+	}
+
+	// The next call opens a new sink.
+	emitError := beacon.Emit(timestamp)
+	if emitError != nil {
+		t.Error(emitError)
+	}
+	if opens != 2 {
+		t.Errorf("want 2 opens, got %d", opens)
+	}
+	if !strings.HasPrefix(sinks[1].String(), "$GPGGA,123519.25,") {
+		t.Errorf("want a GGA sentence, got %q", sinks[1].String())
+	}
+}
+
+// TestBeaconEmitWithOpenFailure checks that Emit returns an error if it
+// can't open the sink.
+func TestBeaconEmitWithOpenFailure(t *testing.T) {
+	beacon, _ := NewBeacon(BeaconConfig{Sink: "serial"})
+	beacon.open = func() (io.WriteCloser, error) {
+		return nil, errors.New("no such device")
+	}
+	beacon.SetPosition(Position{})
+
+	err := beacon.Emit(time.Now())
+	if err == nil || err.Error() != "no such device" {
+		t.Errorf("want error no such device, got %v", err)
+	}
+}
+
+// TestBeaconCheckSink checks that CheckSink opens and closes the sink
+// without writing to it, and returns an error if it can't open it.
+func TestBeaconCheckSink(t *testing.T) {
+	beacon, _ := NewBeacon(BeaconConfig{Sink: "tcp"})
+	sink := &fakeSink{}
+	beacon.open = func() (io.WriteCloser, error) {
+		return sink, nil
+	}
+	beacon.SetPosition(Position{})
+
+	if err := beacon.CheckSink(); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed {
+		t.Error("want the sink closed")
+	}
+	if sink.Len() != 0 {
+		t.Errorf("want nothing written, got %q", sink.String())
+	}
+
+	beacon.open = func() (io.WriteCloser, error) {
+		return nil, errors.New("connection refused")
+	}
+	err := beacon.CheckSink()
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("want error connection refused, got %v", err)
+	}
+}
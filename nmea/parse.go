@@ -0,0 +1,489 @@
+package nmea
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GNSS receivers often send NMEA sentences on the same line as the RTCM
+// messages.  The RTCM handler presents anything between two message frames
+// as non-RTCM data.  Parse recognises the GGA, RMC, GSV and GST sentences in
+// that data and breaks them out, and Split cuts a chunk of non-RTCM data
+// into sentences and the text between them.
+
+// maxSentenceLength is the longest sentence that Split will look for.  The
+// standard allows 82 characters but some receivers send longer proprietary
+// sentences.
+const maxSentenceLength = 255
+
+// Parsed is a parsed NMEA sentence.  The fields of the sentence are always
+// set.  One of the typed parts is set if the sentence is one that Parse
+// understands.
+type Parsed struct {
+	// Talker is the talker ID, for example "GP" or "GN", or "P" for a
+	// proprietary sentence.
+	Talker string
+
+	// Type is the sentence type, for example "GGA".
+	Type string
+
+	// Fields holds the fields after the talker and type, without the
+	// checksum.
+	Fields []string
+
+	GGA *GGAData
+	RMC *RMCData
+	GSV *GSVData
+	GST *GSTData
+}
+
+// GGAData is the content of a GGA (fix data) sentence.
+type GGAData struct {
+	// TimeOfDay is the time of the fix since midnight UTC.
+	TimeOfDay time.Duration
+	// Latitude and Longitude are in degrees, north and east positive.
+	Latitude  float64
+	Longitude float64
+	// Quality is the fix quality, for example FixQualityGPS.
+	Quality int
+	// Satellites is the number of satellites in use.
+	Satellites int
+	// HDOP is the horizontal dilution of precision.
+	HDOP float64
+	// Altitude is the height in metres above mean sea level.
+	Altitude float64
+	// GeoidSeparation is the height in metres of the geoid above the
+	// ellipsoid.
+	GeoidSeparation float64
+}
+
+// RMCData is the content of an RMC (recommended minimum) sentence.
+type RMCData struct {
+	// Time is the date and time of the fix in UTC.
+	Time time.Time
+	// Valid is true if the receiver says that the fix is valid.
+	Valid bool
+	// Latitude and Longitude are in degrees, north and east positive.
+	Latitude  float64
+	Longitude float64
+	// SpeedKnots is the speed over the ground.
+	SpeedKnots float64
+	// Course is the course over the ground in degrees from true north.
+	Course float64
+}
+
+// GSVData is the content of a GSV (satellites in view) sentence.  The
+// satellites are spread over several sentences, up to four in each.
+type GSVData struct {
+	// Sentences is the number of sentences in the set.
+	Sentences int
+	// Sentence is the number of this sentence in the set, starting at 1.
+	Sentence int
+	// InView is the total number of satellites in view.
+	InView int
+	// Satellites holds the satellites described in this sentence.
+	Satellites []SatelliteInView
+}
+
+// SatelliteInView describes one satellite in a GSV sentence.
+type SatelliteInView struct {
+	// PRN is the satellite number.
+	PRN int
+	// Elevation and Azimuth are in degrees.
+	Elevation int
+	Azimuth   int
+	// SNR is the signal to noise ratio in dB-Hz, -1 if the satellite is
+	// not being tracked.
+	SNR int
+}
+
+// GSTData is the content of a GST (error statistics) sentence.  The errors
+// are standard deviations in metres.
+type GSTData struct {
+	// TimeOfDay is the time of the fix since midnight UTC.
+	TimeOfDay time.Duration
+	// RMS is the RMS of the pseudorange residuals.
+	RMS float64
+	// SemiMajor and SemiMinor are the axes of the error ellipse.
+	SemiMajor float64
+	SemiMinor float64
+	// Orientation is the orientation of the semi-major axis in degrees
+	// from true north.
+	Orientation    float64
+	LatitudeError  float64
+	LongitudeError float64
+	HeightError    float64
+}
+
+// Parse parses a sentence such as "$GPGGA,...*hh", with or without the
+// trailing CRLF.  It returns an error if the text is not a sentence or the
+// checksum is wrong, or if the sentence is a GGA, RMC, GSV or GST and its
+// fields are malformed.  Other sentences are returned with just the fields
+// set.
+func Parse(sentence string) (*Parsed, error) {
+	sentence = strings.TrimRight(sentence, "\r\n")
+	if len(sentence) < 4 || sentence[0] != '$' {
+		return nil, errors.New("nmea - not a sentence")
+	}
+
+	star := strings.LastIndexByte(sentence, '*')
+	if star < 0 || len(sentence)-star != 3 {
+		return nil, errors.New("nmea - no checksum")
+	}
+	body := sentence[1:star]
+	given, err := strconv.ParseUint(sentence[star+1:], 16, 8)
+	if err != nil {
+		em := fmt.Sprintf("nmea - illegal checksum %q", sentence[star+1:])
+		return nil, errors.New(em)
+	}
+	if calculated := Checksum(body); byte(given) != calculated {
+		em := fmt.Sprintf("nmea - checksum %02X, calculated %02X", given, calculated)
+		return nil, errors.New(em)
+	}
+
+	fields := strings.Split(body, ",")
+	address := fields[0]
+	var parsed Parsed
+	switch {
+	case strings.HasPrefix(address, "P") && len(address) > 1:
+		parsed.Talker = "P"
+		parsed.Type = address[1:]
+	case len(address) == 5:
+		parsed.Talker = address[:2]
+		parsed.Type = address[2:]
+	default:
+		em := fmt.Sprintf("nmea - illegal address field %q", address)
+		return nil, errors.New(em)
+	}
+	parsed.Fields = fields[1:]
+
+	switch parsed.Type {
+	case "GGA":
+		parsed.GGA, err = parseGGA(parsed.Fields)
+	case "RMC":
+		parsed.RMC, err = parseRMC(parsed.Fields)
+	case "GSV":
+		parsed.GSV, err = parseGSV(parsed.Fields)
+	case "GST":
+		parsed.GST, err = parseGST(parsed.Fields)
+	}
+	if err != nil {
+		em := fmt.Sprintf("nmea - %s - %s", parsed.Type, err.Error())
+		return nil, errors.New(em)
+	}
+
+	return &parsed, nil
+}
+
+// Split cuts a chunk of data into pieces, each of which is either a
+// complete sentence, from the "$" to the end of the line, or the data
+// between two sentences.  Joining the pieces gives back the chunk.  A
+// sentence that isn't terminated by a newline is not complete, so it's left
+// in the data between.
+func Split(data []byte) [][]byte {
+	var pieces [][]byte
+	start := 0 // The start of the current piece of data between sentences.
+	i := 0
+	for i < len(data) {
+		if data[i] != '$' {
+			i++
+			continue
+		}
+		end := bytes.IndexByte(data[i:], '\n')
+		if end < 0 {
+			i++
+			continue
+		}
+		// A sentence can't contain a "$", so it starts at the last one
+		// before the end of the line.
+		if next := bytes.LastIndexByte(data[i:i+end], '$'); next > 0 {
+			i += next
+			end -= next
+		}
+		if end > maxSentenceLength {
+			i += end
+			continue
+		}
+		if start < i {
+			pieces = append(pieces, data[start:i])
+		}
+		pieces = append(pieces, data[i:i+end+1])
+		i += end + 1
+		start = i
+	}
+	if start < len(data) {
+		pieces = append(pieces, data[start:])
+	}
+	return pieces
+}
+
+// String returns a readable version of the sentence.
+func (parsed *Parsed) String() string {
+	talker := parsed.Talker
+	if talker == "P" {
+		talker = "proprietary"
+	}
+	display := fmt.Sprintf("NMEA %s sentence, talker %s\n", parsed.Type, talker)
+
+	switch {
+	case parsed.GGA != nil:
+		g := parsed.GGA
+		display += fmt.Sprintf("time %s, lat %.7f, lon %.7f, quality %d, satellites %d, HDOP %.1f\n",
+			formatTimeOfDay(g.TimeOfDay), g.Latitude, g.Longitude, g.Quality, g.Satellites, g.HDOP)
+		display += fmt.Sprintf("altitude %.3f m, geoid separation %.3f m\n",
+			g.Altitude, g.GeoidSeparation)
+	case parsed.RMC != nil:
+		r := parsed.RMC
+		validity := "invalid"
+		if r.Valid {
+			validity = "valid"
+		}
+		display += fmt.Sprintf("time %s, %s, lat %.7f, lon %.7f, speed %.1f knots, course %.1f\n",
+			r.Time.Format("2006-01-02 15:04:05.00 MST"), validity,
+			r.Latitude, r.Longitude, r.SpeedKnots, r.Course)
+	case parsed.GSV != nil:
+		g := parsed.GSV
+		display += fmt.Sprintf("sentence %d of %d, %d satellites in view\n",
+			g.Sentence, g.Sentences, g.InView)
+		for _, s := range g.Satellites {
+			snr := "not tracked"
+			if s.SNR >= 0 {
+				snr = fmt.Sprintf("SNR %d", s.SNR)
+			}
+			display += fmt.Sprintf("PRN %d, elevation %d, azimuth %d, %s\n",
+				s.PRN, s.Elevation, s.Azimuth, snr)
+		}
+	case parsed.GST != nil:
+		g := parsed.GST
+		display += fmt.Sprintf("time %s, RMS %.3f, ellipse %.3f x %.3f at %.1f\n",
+			formatTimeOfDay(g.TimeOfDay), g.RMS, g.SemiMajor, g.SemiMinor, g.Orientation)
+		display += fmt.Sprintf("errors lat %.3f m, lon %.3f m, height %.3f m\n",
+			g.LatitudeError, g.LongitudeError, g.HeightError)
+	default:
+		display += strings.Join(parsed.Fields, ",") + "\n"
+	}
+
+	return display
+}
+
+// parseGGA parses the fields of a GGA sentence.
+func parseGGA(fields []string) (*GGAData, error) {
+	if len(fields) < 11 {
+		return nil, tooFewFields(len(fields), 11)
+	}
+	var p fieldParser
+	data := GGAData{
+		TimeOfDay:       p.timeOfDay(fields[0]),
+		Latitude:        p.angle(fields[1], fields[2], "N", "S"),
+		Longitude:       p.angle(fields[3], fields[4], "E", "W"),
+		Quality:         p.integer(fields[5]),
+		Satellites:      p.integer(fields[6]),
+		HDOP:            p.float(fields[7]),
+		Altitude:        p.float(fields[8]),
+		GeoidSeparation: p.float(fields[10]),
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &data, nil
+}
+
+// parseRMC parses the fields of an RMC sentence.
+func parseRMC(fields []string) (*RMCData, error) {
+	if len(fields) < 9 {
+		return nil, tooFewFields(len(fields), 9)
+	}
+	var p fieldParser
+	timeOfDay := p.timeOfDay(fields[0])
+	data := RMCData{
+		Valid:      fields[1] == "A",
+		Latitude:   p.angle(fields[2], fields[3], "N", "S"),
+		Longitude:  p.angle(fields[4], fields[5], "E", "W"),
+		SpeedKnots: p.float(fields[6]),
+		Course:     p.float(fields[7]),
+	}
+	date := p.date(fields[8])
+	if p.err != nil {
+		return nil, p.err
+	}
+	data.Time = date.Add(timeOfDay)
+	return &data, nil
+}
+
+// parseGSV parses the fields of a GSV sentence.
+func parseGSV(fields []string) (*GSVData, error) {
+	if len(fields) < 3 {
+		return nil, tooFewFields(len(fields), 3)
+	}
+	var p fieldParser
+	data := GSVData{
+		Sentences: p.integer(fields[0]),
+		Sentence:  p.integer(fields[1]),
+		InView:    p.integer(fields[2]),
+	}
+	// Each satellite takes four fields.  NMEA 4.1 adds a signal ID at the
+	// end, which makes the number of fields odd.
+	for i := 3; i+3 < len(fields); i += 4 {
+		if len(fields[i]) == 0 {
+			continue
+		}
+		snr := -1
+		if len(fields[i+3]) > 0 {
+			snr = p.integer(fields[i+3])
+		}
+		data.Satellites = append(data.Satellites, SatelliteInView{
+			PRN:       p.integer(fields[i]),
+			Elevation: p.integer(fields[i+1]),
+			Azimuth:   p.integer(fields[i+2]),
+			SNR:       snr,
+		})
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &data, nil
+}
+
+// parseGST parses the fields of a GST sentence.
+func parseGST(fields []string) (*GSTData, error) {
+	if len(fields) < 8 {
+		return nil, tooFewFields(len(fields), 8)
+	}
+	var p fieldParser
+	data := GSTData{
+		TimeOfDay:      p.timeOfDay(fields[0]),
+		RMS:            p.float(fields[1]),
+		SemiMajor:      p.float(fields[2]),
+		SemiMinor:      p.float(fields[3]),
+		Orientation:    p.float(fields[4]),
+		LatitudeError:  p.float(fields[5]),
+		LongitudeError: p.float(fields[6]),
+		HeightError:    p.float(fields[7]),
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &data, nil
+}
+
+// tooFewFields returns the error for a sentence that's too short.
+func tooFewFields(got, want int) error {
+	em := fmt.Sprintf("want %d fields, got %d", want, got)
+	return errors.New(em)
+}
+
+// fieldParser converts the fields of a sentence, keeping the first error.
+// Receivers leave fields empty when they have nothing to put in them, so an
+// empty field gives zero.
+type fieldParser struct {
+	err error
+}
+
+// fail records an error unless there is one already.
+func (p *fieldParser) fail(kind, field string) {
+	if p.err == nil {
+		em := fmt.Sprintf("illegal %s %q", kind, field)
+		p.err = errors.New(em)
+	}
+}
+
+// integer converts a whole number.
+func (p *fieldParser) integer(field string) int {
+	if len(field) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(field)
+	if err != nil {
+		p.fail("number", field)
+	}
+	return n
+}
+
+// float converts a decimal number.
+func (p *fieldParser) float(field string) float64 {
+	if len(field) == 0 {
+		return 0
+	}
+	f, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		p.fail("number", field)
+	}
+	return f
+}
+
+// angle converts an angle in degrees and decimal minutes (ddmm.mmmm or
+// dddmm.mmmm) and its hemisphere to signed degrees.
+func (p *fieldParser) angle(field, hemisphere, positive, negative string) float64 {
+	if len(field) == 0 {
+		return 0
+	}
+	point := strings.IndexByte(field, '.')
+	if point < 0 {
+		point = len(field)
+	}
+	if point < 3 {
+		p.fail("angle", field)
+		return 0
+	}
+	degrees, err1 := strconv.Atoi(field[:point-2])
+	minutes, err2 := strconv.ParseFloat(field[point-2:], 64)
+	if err1 != nil || err2 != nil || minutes >= 60 {
+		p.fail("angle", field)
+		return 0
+	}
+	angle := float64(degrees) + minutes/60
+	switch hemisphere {
+	case positive:
+		return angle
+	case negative:
+		return -angle
+	default:
+		p.fail("hemisphere", hemisphere)
+		return 0
+	}
+}
+
+// timeOfDay converts a time of day hhmmss.ss to the duration since
+// midnight.
+func (p *fieldParser) timeOfDay(field string) time.Duration {
+	if len(field) == 0 {
+		return 0
+	}
+	if len(field) < 6 {
+		p.fail("time", field)
+		return 0
+	}
+	hours, err1 := strconv.Atoi(field[:2])
+	minutes, err2 := strconv.Atoi(field[2:4])
+	seconds, err3 := strconv.ParseFloat(field[4:], 64)
+	if err1 != nil || err2 != nil || err3 != nil || hours > 23 || minutes > 59 || seconds >= 61 {
+		p.fail("time", field)
+		return 0
+	}
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)+0.5)
+}
+
+// date converts a date ddmmyy to midnight UTC at the start of that day.
+func (p *fieldParser) date(field string) time.Time {
+	if len(field) == 0 {
+		return time.Time{}
+	}
+	t, err := time.Parse("020106", field)
+	if err != nil {
+		p.fail("date", field)
+		return time.Time{}
+	}
+	return t
+}
+
+// formatTimeOfDay returns a time of day as hh:mm:ss.ss.
+func formatTimeOfDay(d time.Duration) string {
+	t := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(d)
+	return t.Format("15:04:05.00")
+}
@@ -0,0 +1,244 @@
+package nmea
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestParse checks that Parse breaks out the sentences that it knows.
+func TestParse(t *testing.T) {
+	var testData = []struct {
+		description string
+		sentence    string
+		want        *Parsed
+	}{
+		{
+			"GGA",
+			Sentence("GNGGA,123456.70,5128.67400,N,00007.68000,W,4,12,0.8,45.123,M,47.000,M,,"),
+			&Parsed{
+				Talker: "GN", Type: "GGA",
+				Fields: strings.Split("123456.70,5128.67400,N,00007.68000,W,4,12,0.8,45.123,M,47.000,M,,", ","),
+				GGA: &GGAData{
+					TimeOfDay:       12*time.Hour + 34*time.Minute + 56700*time.Millisecond,
+					Latitude:        51.4779,
+					Longitude:       -0.128,
+					Quality:         4,
+					Satellites:      12,
+					HDOP:            0.8,
+					Altitude:        45.123,
+					GeoidSeparation: 47,
+				},
+			},
+		},
+		{
+			"RMC",
+			Sentence("GPRMC,123456.00,A,3352.12800,S,15112.55800,E,0.02,31.5,180523,,,A"),
+			&Parsed{
+				Talker: "GP", Type: "RMC",
+				Fields: strings.Split("123456.00,A,3352.12800,S,15112.55800,E,0.02,31.5,180523,,,A", ","),
+				RMC: &RMCData{
+					Time:       time.Date(2023, time.May, 18, 12, 34, 56, 0, time.UTC),
+					Valid:      true,
+					Latitude:   -33.8688,
+					Longitude:  151.2093,
+					SpeedKnots: 0.02,
+					Course:     31.5,
+				},
+			},
+		},
+		{
+			"GSV",
+			Sentence("GPGSV,3,1,11,04,45,120,40,09,10,300,,16,,,35"),
+			&Parsed{
+				Talker: "GP", Type: "GSV",
+				Fields: strings.Split("3,1,11,04,45,120,40,09,10,300,,16,,,35", ","),
+				GSV: &GSVData{
+					Sentences: 3, Sentence: 1, InView: 11,
+					Satellites: []SatelliteInView{
+						{PRN: 4, Elevation: 45, Azimuth: 120, SNR: 40},
+						{PRN: 9, Elevation: 10, Azimuth: 300, SNR: -1},
+						{PRN: 16, SNR: 35},
+					},
+				},
+			},
+		},
+		{
+			"GST",
+			Sentence("GPGST,000001.00,0.020,0.030,0.010,12.5,0.011,0.012,0.025"),
+			&Parsed{
+				Talker: "GP", Type: "GST",
+				Fields: strings.Split("000001.00,0.020,0.030,0.010,12.5,0.011,0.012,0.025", ","),
+				GST: &GSTData{
+					TimeOfDay:      time.Second,
+					RMS:            0.02,
+					SemiMajor:      0.03,
+					SemiMinor:      0.01,
+					Orientation:    12.5,
+					LatitudeError:  0.011,
+					LongitudeError: 0.012,
+					HeightError:    0.025,
+				},
+			},
+		},
+		{
+			"other",
+			Sentence("GPVTG,31.5,T,,M,0.02,N,0.04,K,A"),
+			&Parsed{
+				Talker: "GP", Type: "VTG",
+				Fields: strings.Split("31.5,T,,M,0.02,N,0.04,K,A", ","),
+			},
+		},
+		{
+			"proprietary",
+			Sentence("PUBX,00,123456.00"),
+			&Parsed{Talker: "P", Type: "UBX", Fields: []string{"00", "123456.00"}},
+		},
+		{
+			"no CRLF",
+			strings.TrimSpace(Sentence("GPVTG,31.5,T")),
+			&Parsed{Talker: "GP", Type: "VTG", Fields: []string{"31.5", "T"}},
+		},
+	}
+
+	for _, td := range testData {
+		got, err := Parse(td.sentence)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		// The positions are converted from degrees and minutes, so allow
+		// for rounding.
+		approx := cmp.Comparer(func(a, b float64) bool {
+			diff := a - b
+			return diff < 1e-9 && diff > -1e-9
+		})
+		if diff := cmp.Diff(td.want, got, approx); len(diff) > 0 {
+			t.Errorf("%s: %s", td.description, diff)
+		}
+	}
+}
+
+// TestParseErrors checks that Parse rejects text that is not a valid
+// sentence.
+func TestParseErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		sentence    string
+		want        string
+	}{
+		{"empty", "", "nmea - not a sentence"},
+		{"no dollar", "GPGGA,1*00", "nmea - not a sentence"},
+		{"no checksum", "$GPGGA,1,2,3", "nmea - no checksum"},
+		{"illegal checksum", "$GPVTG*ZZ", `nmea - illegal checksum "ZZ"`},
+		{"wrong checksum", "$GPVTG*00\r\n", "nmea - checksum 00, calculated 52"},
+		{"address", Sentence("GPGGGA,1"), `nmea - illegal address field "GPGGGA"`},
+		{"short", Sentence("GPGGA,1,2"), "nmea - GGA - want 11 fields, got 2"},
+		{
+			"bad latitude",
+			Sentence("GPGGA,120000.00,51x8.6,N,00007.68000,W,4,12,0.8,45.123,M,47.000,M,,"),
+			`nmea - GGA - illegal angle "51x8.6"`,
+		},
+		{
+			"bad hemisphere",
+			Sentence("GPGGA,120000.00,5128.6,E,00007.68000,W,4,12,0.8,45.123,M,47.000,M,,"),
+			`nmea - GGA - illegal hemisphere "E"`,
+		},
+		{
+			"bad time",
+			Sentence("GPGST,250000.00,0.020,0.030,0.010,12.5,0.011,0.012,0.025"),
+			`nmea - GST - illegal time "250000.00"`,
+		},
+		{
+			"bad date",
+			Sentence("GPRMC,123456.00,A,3352.128,S,15112.558,E,0.02,31.5,321323,,,A"),
+			`nmea - RMC - illegal date "321323"`,
+		},
+	}
+
+	for _, td := range testData {
+		_, err := Parse(td.sentence)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.want)
+		} else if err.Error() != td.want {
+			t.Errorf("%s: want error %s got %s", td.description, td.want, err.Error())
+		}
+	}
+}
+
+// TestParseGenerated checks that Parse understands the sentences that the
+// package produces.
+func TestParseGenerated(t *testing.T) {
+	at := time.Date(2023, time.May, 18, 12, 34, 56, 0, time.UTC)
+	position := Position{Latitude: 51.4779, Longitude: -0.128, Height: 92.123}
+
+	gga, err := Parse(GGA(at, position, FixQualityManual, 10, 47))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gga.GGA.Quality != FixQualityManual || gga.GGA.Satellites != 10 {
+		t.Errorf("want quality %d and 10 satellites, got %+v", FixQualityManual, gga.GGA)
+	}
+	if gga.GGA.Altitude != 45.123 {
+		t.Errorf("want altitude 45.123, got %f", gga.GGA.Altitude)
+	}
+
+	gst, err := Parse(GST(at, 0.02))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gst.GST.HeightError != 0.02 {
+		t.Errorf("want height error 0.02, got %f", gst.GST.HeightError)
+	}
+}
+
+// TestSplit checks that Split cuts data into sentences and the data between.
+func TestSplit(t *testing.T) {
+	var testData = []struct {
+		description string
+		data        string
+		want        []string
+	}{
+		{"empty", "", nil},
+		{"text", "hello", []string{"hello"}},
+		{"sentence", "$GPVTG*52\r\n", []string{"$GPVTG*52\r\n"}},
+		{
+			"mixed",
+			"junk$GPVTG*52\r\n$GPGGA*56\r\nmore",
+			[]string{"junk", "$GPVTG*52\r\n", "$GPGGA*56\r\n", "more"},
+		},
+		{"unterminated", "junk$GPVTG*52", []string{"junk$GPVTG*52"}},
+		{"two dollars", "$$GPVTG*52\n", []string{"$", "$GPVTG*52\n"}},
+	}
+
+	for _, td := range testData {
+		pieces := Split([]byte(td.data))
+		var got []string
+		for _, piece := range pieces {
+			got = append(got, string(piece))
+		}
+		if diff := cmp.Diff(td.want, got); len(diff) > 0 {
+			t.Errorf("%s: %s", td.description, diff)
+		}
+	}
+}
+
+// TestString checks the display of a parsed sentence.
+func TestString(t *testing.T) {
+	parsed, err := Parse(Sentence("GPGSV,1,1,02,04,45,120,40,09,10,300,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "NMEA GSV sentence, talker GP\n" +
+		"sentence 1 of 1, 2 satellites in view\n" +
+		"PRN 4, elevation 45, azimuth 120, SNR 40\n" +
+		"PRN 9, elevation 10, azimuth 300, not tracked\n"
+
+	got := parsed.String()
+	if got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
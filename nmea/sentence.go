@@ -0,0 +1,200 @@
+// The nmea package produces NMEA 0183 sentences describing the position of
+// a base station, so that tools which understand NMEA but not RTCM can
+// monitor it.  The position comes from RTCM message type 1005, which gives
+// the antenna reference point in Earth-Centred Earth-Fixed (ECEF)
+// coordinates.  The package converts that to latitude, longitude and height
+// on the WGS84 ellipsoid and produces GGA (fix data) and GST (error
+// statistics) sentences.
+//
+//	position := nmea.PositionFrom1005(message1005)
+//	gga := nmea.GGA(time.Now(), position, nmea.FixQualityGPS, 0, 0)
+//
+// A Beacon holds the latest position and writes sentences to a serial line
+// or a TCP connection at regular intervals.
+package nmea
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+)
+
+// TalkerID is the talker ID at the start of each sentence.  "GP" is
+// understood by all NMEA tools.
+const TalkerID = "GP"
+
+// Fix qualities for a GGA sentence.
+const (
+	// FixQualityGPS is an ordinary GPS fix.
+	FixQualityGPS = 1
+	// FixQualityRTKFixed is an RTK fix with fixed integers.
+	FixQualityRTKFixed = 4
+	// FixQualityManual is a position entered by hand, which is the nearest
+	// thing in the standard to a surveyed base position.
+	FixQualityManual = 7
+)
+
+// WGS84 ellipsoid parameters.
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+)
+
+// eccentricitySquared is the square of the first eccentricity of the ellipsoid.
+var eccentricitySquared = flattening * (2 - flattening)
+
+// scaleFactor converts the antenna reference coordinates in a message type
+// 1005, which are in units of 1/10,000 of a metre, to metres.
+const scaleFactor = 0.0001
+
+// Position is a position on the WGS84 ellipsoid.
+type Position struct {
+	// Latitude in degrees, north positive.
+	Latitude float64
+	// Longitude in degrees, east positive.
+	Longitude float64
+	// Height in metres above the ellipsoid.
+	Height float64
+}
+
+// PositionFrom1005 returns the position given by a message type 1005.
+func PositionFrom1005(message *type1005.Message) Position {
+	x := float64(message.AntennaRefX) * scaleFactor
+	y := float64(message.AntennaRefY) * scaleFactor
+	z := float64(message.AntennaRefZ) * scaleFactor
+	return PositionFromECEF(x, y, z)
+}
+
+// PositionFromECEF converts ECEF coordinates in metres to a position on the
+// WGS84 ellipsoid.  It iterates until the latitude settles, which takes a
+// handful of rounds for any point near the Earth's surface.
+func PositionFromECEF(x, y, z float64) Position {
+	longitude := math.Atan2(y, x)
+	p := math.Hypot(x, y)
+
+	// At the poles the longitude is arbitrary and the iteration below
+	// divides by zero.
+	if p < 1e-9 {
+		semiMinorAxis := semiMajorAxis * (1 - flattening)
+		latitude := 90.0
+		if z < 0 {
+			latitude = -90.0
+		}
+		return Position{Latitude: latitude, Longitude: 0, Height: math.Abs(z) - semiMinorAxis}
+	}
+
+	latitude := math.Atan2(z, p*(1-eccentricitySquared))
+	var height float64
+	for i := 0; i < 10; i++ {
+		sinLatitude := math.Sin(latitude)
+		n := semiMajorAxis / math.Sqrt(1-eccentricitySquared*sinLatitude*sinLatitude)
+		height = p/math.Cos(latitude) - n
+		previous := latitude
+		latitude = math.Atan2(z, p*(1-eccentricitySquared*n/(n+height)))
+		if math.Abs(latitude-previous) < 1e-12 {
+			break
+		}
+	}
+
+	return Position{
+		Latitude:  latitude * 180 / math.Pi,
+		Longitude: longitude * 180 / math.Pi,
+		Height:    height,
+	}
+}
+
+// Checksum returns the NMEA checksum of the body of a sentence, the text
+// between the "$" and the "*".
+func Checksum(body string) byte {
+	var checksum byte
+	for i := 0; i < len(body); i++ {
+		checksum ^= body[i]
+	}
+	return checksum
+}
+
+// Sentence wraps the body in "$", a checksum and a CRLF.
+func Sentence(body string) string {
+	return fmt.Sprintf("$%s*%02X\r\n", body, Checksum(body))
+}
+
+// GGA returns a GGA sentence giving the position at the given time.  The
+// height in the position is relative to the ellipsoid but GGA gives the
+// altitude above mean sea level plus the geoid separation (the height of
+// the geoid above the ellipsoid), so the caller supplies the separation.  If
+// it's not known, 0 gives the ellipsoidal height as the altitude.  If
+// satellites is 0, the number of satellites and the HDOP are left empty.
+func GGA(t time.Time, position Position, quality int, satellites int, geoidSeparation float64) string {
+	latitude, northOrSouth := formatAngle(position.Latitude, 2, "N", "S")
+	longitude, eastOrWest := formatAngle(position.Longitude, 3, "E", "W")
+
+	satellitesField := ""
+	hdopField := ""
+	if satellites > 0 {
+		satellitesField = fmt.Sprintf("%02d", satellites)
+		hdopField = "1.0"
+	}
+
+	body := strings.Join([]string{
+		TalkerID + "GGA",
+		formatTime(t),
+		latitude, northOrSouth,
+		longitude, eastOrWest,
+		fmt.Sprintf("%d", quality),
+		satellitesField,
+		hdopField,
+		fmt.Sprintf("%.3f", position.Height-geoidSeparation), "M",
+		fmt.Sprintf("%.3f", geoidSeparation), "M",
+		"", // Age of differential corrections.
+		"", // Differential reference station ID.
+	}, ",")
+
+	return Sentence(body)
+}
+
+// GST returns a GST sentence at the given time giving the same standard
+// deviation in metres for all of the error fields.
+func GST(t time.Time, accuracy float64) string {
+	a := fmt.Sprintf("%.3f", accuracy)
+	body := strings.Join([]string{
+		TalkerID + "GST",
+		formatTime(t),
+		a,     // RMS of the pseudorange residuals.
+		a,     // Semi-major axis of the error ellipse.
+		a,     // Semi-minor axis of the error ellipse.
+		"0.0", // Orientation of the semi-major axis.
+		a,     // Latitude error.
+		a,     // Longitude error.
+		a,     // Height error.
+	}, ",")
+
+	return Sentence(body)
+}
+
+// formatTime returns the time of day in UTC as hhmmss.ss.
+func formatTime(t time.Time) string {
+	t = t.UTC()
+	centiseconds := t.Nanosecond() / 1e7
+	return fmt.Sprintf("%02d%02d%02d.%02d", t.Hour(), t.Minute(), t.Second(), centiseconds)
+}
+
+// formatAngle returns the angle in NMEA form, degrees and decimal minutes
+// (ddmm.mmmmm or dddmm.mmmmm), and the hemisphere.
+func formatAngle(angle float64, degreeDigits int, positive, negative string) (string, string) {
+	hemisphere := positive
+	if angle < 0 {
+		hemisphere = negative
+		angle = -angle
+	}
+
+	// Round to the displayed precision first so that the minutes never
+	// come out as 60.
+	totalMinutes := math.Round(angle*60*1e5) / 1e5
+	degrees := int(totalMinutes / 60)
+	minutes := totalMinutes - float64(degrees*60)
+
+	return fmt.Sprintf("%0*d%08.5f", degreeDigits, degrees, minutes), hemisphere
+}
@@ -0,0 +1,137 @@
+package nmea
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+)
+
+// toECEF converts a position to ECEF coordinates, the reverse of
+// PositionFromECEF.
+func toECEF(position Position) (float64, float64, float64) {
+	latitude := position.Latitude * math.Pi / 180
+	longitude := position.Longitude * math.Pi / 180
+	sinLatitude := math.Sin(latitude)
+	n := semiMajorAxis / math.Sqrt(1-eccentricitySquared*sinLatitude*sinLatitude)
+	x := (n + position.Height) * math.Cos(latitude) * math.Cos(longitude)
+	y := (n + position.Height) * math.Cos(latitude) * math.Sin(longitude)
+	z := (n*(1-eccentricitySquared) + position.Height) * sinLatitude
+	return x, y, z
+}
+
+// TestPositionFromECEF checks the conversion from ECEF coordinates.
+func TestPositionFromECEF(t *testing.T) {
+	var testData = []Position{
+		{Latitude: 0, Longitude: 0, Height: 0},
+		{Latitude: 51.4778, Longitude: -0.0014, Height: 45.9},
+		{Latitude: -33.8568, Longitude: 151.2153, Height: 12.5},
+		{Latitude: 64.1466, Longitude: -21.9426, Height: 1500},
+		{Latitude: 90, Longitude: 0, Height: 100},
+		{Latitude: -90, Longitude: 0, Height: -20},
+	}
+	for _, want := range testData {
+		x, y, z := toECEF(want)
+		got := PositionFromECEF(x, y, z)
+		if math.Abs(want.Latitude-got.Latitude) > 1e-9 ||
+			math.Abs(want.Longitude-got.Longitude) > 1e-9 ||
+			math.Abs(want.Height-got.Height) > 1e-4 {
+			t.Errorf("want %v got %v", want, got)
+		}
+	}
+}
+
+// TestPositionFrom1005 checks that the coordinates in a message type 1005
+// are scaled correctly.
+func TestPositionFrom1005(t *testing.T) {
+	want := Position{Latitude: 51.4778, Longitude: -0.0014, Height: 45.9}
+	x, y, z := toECEF(want)
+	message := type1005.New(2, 0, 0,
+		int64(math.Round(x/scaleFactor)), 0,
+		int64(math.Round(y/scaleFactor)), 0,
+		int64(math.Round(z/scaleFactor)), 0)
+
+	got := PositionFrom1005(message)
+
+	if math.Abs(want.Latitude-got.Latitude) > 1e-8 ||
+		math.Abs(want.Longitude-got.Longitude) > 1e-8 ||
+		math.Abs(want.Height-got.Height) > 1e-3 {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+// TestChecksum checks the checksum against the example in the NMEA literature.
+func TestChecksum(t *testing.T) {
+	const body = "GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,"
+	const want = 0x47
+
+	got := Checksum(body)
+	if got != want {
+		t.Errorf("want %02X got %02X", want, got)
+	}
+}
+
+// TestGGA checks the GGA sentence.
+func TestGGA(t *testing.T) {
+	timestamp := time.Date(2024, time.March, 1, 12, 35, 19, 250000000, time.UTC)
+	position := Position{Latitude: 48.1173, Longitude: -11.51666667, Height: 592.3}
+
+	var testData = []struct {
+		description     string
+		quality         int
+		satellites      int
+		geoidSeparation float64
+		want            string
+	}{
+		{"ellipsoid", FixQualityManual, 8, 0,
+			"$GPGGA,123519.25,4807.03800,N,01131.00000,W,7,08,1.0,592.300,M,0.000,M,,*44\r\n"},
+		{"geoid", FixQualityGPS, 0, 46.9,
+			"$GPGGA,123519.25,4807.03800,N,01131.00000,W,1,,,545.400,M,46.900,M,,*53\r\n"},
+	}
+	for _, td := range testData {
+		got := GGA(timestamp, position, td.quality, td.satellites, td.geoidSeparation)
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.description, td.want, got)
+		}
+	}
+}
+
+// TestGST checks the GST sentence.
+func TestGST(t *testing.T) {
+	const want = "$GPGST,123519.25,0.020,0.020,0.020,0.0,0.020,0.020,0.020*5D\r\n"
+	timestamp := time.Date(2024, time.March, 1, 12, 35, 19, 250000000, time.UTC)
+
+	got := GST(timestamp, 0.02)
+	if got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
+
+// TestFormatAngle checks the conversion of angles to degrees and minutes.
+func TestFormatAngle(t *testing.T) {
+	var testData = []struct {
+		angle          float64
+		degreeDigits   int
+		want           string
+		wantHemisphere string
+	}{
+		{0, 2, "0000.00000", "N"},
+		{48.1173, 2, "4807.03800", "N"},
+		{-33.5, 2, "3330.00000", "S"},
+		{151.25, 3, "15115.00000", "E"},
+		{-0.0014, 3, "00000.08400", "W"},
+		// Just under a whole degree - must not give 60 minutes.
+		{0.9999999999, 2, "0100.00000", "N"},
+	}
+	for _, td := range testData {
+		got, gotHemisphere := formatAngle(td.angle, td.degreeDigits, "N", "S")
+		if td.degreeDigits == 3 {
+			got, gotHemisphere = formatAngle(td.angle, td.degreeDigits, "E", "W")
+		}
+		if got != td.want || gotHemisphere != td.wantHemisphere {
+			t.Errorf("%f: want %s %s got %s %s",
+				td.angle, td.want, td.wantHemisphere, got, gotHemisphere)
+		}
+	}
+}
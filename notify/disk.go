@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package notify
+
+import "syscall"
+
+// freeSpace returns the space in bytes available to an unprivileged user
+// on the disk holding the given path.
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,8 @@
+package notify
+
+import "errors"
+
+// freeSpace is not supported on Windows.
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("not supported on Windows")
+}
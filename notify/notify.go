@@ -0,0 +1,290 @@
+// The notify package sends notifications of critical events by email and/or
+// by Telegram message.
+//
+// A base station in a garden shed can fail silently and nobody notices for
+// days.  The Notifier watches for some common failures - the GNSS device
+// going quiet, the disk filling up - and the application can report others,
+// such as the caster rejecting its credentials.
+//
+//	notifier, err := notify.New(config, logger)
+//	...
+//	notifier.Seen()  // Call whenever data arrives from the device.
+//	go notifier.Run(nil)
+//	...
+//	notifier.Notify(notify.CredentialsRejected, "caster refused the password")
+//
+// To avoid a flood of messages, an event is only notified once within the
+// repeat interval.  Notifications can also be suppressed at times when
+// trouble is expected, such as during a maintenance window.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+)
+
+// Event identifies the kind of event being notified.
+type Event string
+
+const (
+	// DeviceOffline means that no data has arrived from the GNSS device for
+	// a while.
+	DeviceOffline Event = "device offline"
+
+	// CredentialsRejected means that a caster refused the credentials.
+	CredentialsRejected Event = "credentials rejected"
+
+	// DiskNearlyFull means that the free space on the disk is low.
+	DiskNearlyFull Event = "disk nearly full"
+)
+
+// DefaultRepeat is the time within which an event is only notified once,
+// used when the config doesn't give one.
+const DefaultRepeat = time.Hour
+
+// DefaultCheckInterval is the time between checks when the Notifier is running.
+const DefaultCheckInterval = time.Minute
+
+// Config is the config of a Notifier, as it appears in an application's JSON
+// config file, for example:
+//
+//	"notify": {
+//	    "station": "shed",
+//	    "smtp": {
+//	        "server": "smtp.example.com:587",
+//	        "username": "base@example.com",
+//	        "password": "secret",
+//	        "from": "base@example.com",
+//	        "to": ["me@example.com"]
+//	    },
+//	    "telegram": {
+//	        "bot_token": "123456:ABC-DEF",
+//	        "chat_id": "987654"
+//	    },
+//	    "device_offline_minutes": 10,
+//	    "disk_path": "/home/pi/rtcmlog",
+//	    "disk_free_megabytes": 500
+//	}
+type Config struct {
+	// Station names the base station in the notifications.
+	Station string `json:"station"`
+
+	// SMTP optionally sends notifications by email.
+	SMTP *SMTPConfig `json:"smtp"`
+
+	// Telegram optionally sends notifications using a Telegram bot.
+	Telegram *TelegramConfig `json:"telegram"`
+
+	// DeviceOfflineMinutes is the time without data from the device after
+	// which a DeviceOffline event is notified.  0 means don't check.
+	DeviceOfflineMinutes uint `json:"device_offline_minutes"`
+
+	// DiskPath is a file or directory on the disk to check.
+	DiskPath string `json:"disk_path"`
+
+	// DiskFreeMegabytes is the free space below which a DiskNearlyFull event
+	// is notified.  0 means don't check.
+	DiskFreeMegabytes uint64 `json:"disk_free_megabytes"`
+
+	// RepeatMinutes is the time within which an event is only notified
+	// once.  0 means DefaultRepeat.
+	RepeatMinutes uint `json:"repeat_minutes"`
+}
+
+// sender sends a notification by some means.
+type sender interface {
+	send(subject, text string) error
+}
+
+// Notifier sends notifications and watches for the device going offline
+// and the disk filling up.
+type Notifier struct {
+	config Config
+
+	// senders send the notifications.
+	senders []sender
+
+	// repeat is the time within which an event is only notified once.
+	repeat time.Duration
+
+	// interval is the time between checks when the Notifier is running.
+	interval time.Duration
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// lastSeen is the time that data last arrived from the device, as Unix
+	// nanoseconds.  It's accessed atomically.
+	lastSeen int64
+
+	// lastSent holds the time that each event was last notified.
+	lastSent map[Event]time.Time
+
+	// now returns the current time.  It's a variable to support testing.
+	now func() time.Time
+
+	// freeSpace returns the free space on the disk holding the given
+	// path.  It's a variable to support testing.
+	freeSpace func(path string) (uint64, error)
+
+	// quiet returns true if notifications should be suppressed at the
+	// given time.  It may be nil.
+	quiet func(t time.Time) bool
+
+	// The mutex controls access to lastSent.
+	mutex sync.Mutex
+}
+
+// New creates a Notifier from the config.  At least one of SMTP and Telegram
+// must be configured.  The logger may be nil.
+func New(config Config, logger *log.Logger) (*Notifier, error) {
+	notifier := Notifier{
+		config:    config,
+		repeat:    DefaultRepeat,
+		interval:  DefaultCheckInterval,
+		logger:    logger,
+		lastSent:  make(map[Event]time.Time),
+		now:       time.Now,
+		freeSpace: freeSpace,
+	}
+
+	if config.SMTP != nil {
+		smtpSender, err := newSMTPSender(*config.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		notifier.senders = append(notifier.senders, smtpSender)
+	}
+
+	if config.Telegram != nil {
+		telegramSender, err := newTelegramSender(*config.Telegram)
+		if err != nil {
+			return nil, err
+		}
+		notifier.senders = append(notifier.senders, telegramSender)
+	}
+
+	if len(notifier.senders) == 0 {
+		return nil, errors.New("notify - want smtp and/or telegram")
+	}
+
+	if config.DiskFreeMegabytes > 0 && len(config.DiskPath) == 0 {
+		return nil, errors.New("notify - disk_free_megabytes needs a disk_path")
+	}
+
+	if config.RepeatMinutes > 0 {
+		notifier.repeat = time.Duration(config.RepeatMinutes) * time.Minute
+	}
+
+	// Start the clock for the device going offline.
+	notifier.Seen()
+
+	return &notifier, nil
+}
+
+// SuppressWhen sets a function that says whether notifications should be
+// suppressed at a given time, for example Schedule.InWindow from the
+// maintenance package.  The function must be set before the Notifier runs.
+func (notifier *Notifier) SuppressWhen(quiet func(t time.Time) bool) {
+	notifier.quiet = quiet
+}
+
+// Notify logs the event and sends a notification, unless the same event has
+// been notified within the repeat interval or notifications are suppressed.
+func (notifier *Notifier) Notify(event Event, text string) {
+	now := notifier.now()
+
+	if notifier.quiet != nil && notifier.quiet(now) {
+		eventlog.Printf(notifier.logger, "notification suppressed - %s - %s", event, text)
+		return
+	}
+
+	notifier.mutex.Lock()
+	last, sent := notifier.lastSent[event]
+	if sent && now.Sub(last) < notifier.repeat {
+		notifier.mutex.Unlock()
+		return
+	}
+	notifier.lastSent[event] = now
+	notifier.mutex.Unlock()
+
+	subject := string(event)
+	if len(notifier.config.Station) > 0 {
+		subject = notifier.config.Station + ": " + subject
+	}
+
+	eventlog.Printf(notifier.logger, "notify %s - %s", subject, text)
+
+	for _, s := range notifier.senders {
+		err := s.send(subject, text)
+		if err != nil {
+			eventlog.Printf(notifier.logger, "cannot send notification - %v", err)
+		}
+	}
+}
+
+// Seen records that data has arrived from the device.  It's safe to call
+// from any goroutine.
+func (notifier *Notifier) Seen() {
+	atomic.StoreInt64(&notifier.lastSeen, notifier.now().UnixNano())
+}
+
+// LastSeen returns the time that data last arrived from the device, or the
+// time that the Notifier was created if none has.
+func (notifier *Notifier) LastSeen() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&notifier.lastSeen))
+}
+
+// Check notifies a DeviceOffline event if the device has been quiet for too
+// long and a DiskNearlyFull event if the free space is too low, if the
+// config asks for those checks.
+func (notifier *Notifier) Check() {
+	config := notifier.config
+
+	if config.DeviceOfflineMinutes > 0 {
+		limit := time.Duration(config.DeviceOfflineMinutes) * time.Minute
+		quiet := notifier.now().Sub(notifier.LastSeen())
+		if quiet > limit {
+			text := fmt.Sprintf("no data from the GNSS device for %v",
+				quiet.Round(time.Minute))
+			notifier.Notify(DeviceOffline, text)
+		}
+	}
+
+	if config.DiskFreeMegabytes > 0 {
+		free, err := notifier.freeSpace(config.DiskPath)
+		if err != nil {
+			eventlog.Printf(notifier.logger, "cannot check the free space on %s - %v",
+				config.DiskPath, err)
+		} else if free/megabyte < config.DiskFreeMegabytes {
+			text := fmt.Sprintf("only %d MB free on the disk holding %s",
+				free/megabyte, config.DiskPath)
+			notifier.Notify(DiskNearlyFull, text)
+		}
+	}
+}
+
+// Run calls Check at intervals until the stop channel is closed.  If the
+// channel is nil, it runs forever.  It can be run in a goroutine.
+func (notifier *Notifier) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(notifier.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			notifier.Check()
+		}
+	}
+}
+
+// megabyte is the number of bytes in a megabyte.
+const megabyte = 1024 * 1024
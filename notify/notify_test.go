@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSender records the notifications and can be made to fail.
+type fakeSender struct {
+	sent []string
+	fail bool
+}
+
+func (sender *fakeSender) send(subject, text string) error {
+	if sender.fail {
+		return errors.New("send failed")
+	}
+	sender.sent = append(sender.sent, subject+" - "+text)
+	return nil
+}
+
+// newTestNotifier creates a Notifier with a fake sender and a clock that
+// the test can move.
+func newTestNotifier(t *testing.T, config Config, logger *log.Logger) (*Notifier, *fakeSender, *time.Time) {
+	config.Telegram = &TelegramConfig{BotToken: "token", ChatID: "chat"}
+	notifier, err := New(config, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := fakeSender{}
+	notifier.senders = []sender{&fake}
+
+	clock := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return clock }
+	notifier.Seen()
+
+	return notifier, &fake, &clock
+}
+
+// TestNewWithBadConfig checks that New rejects a bad config.
+func TestNewWithBadConfig(t *testing.T) {
+	var testData = []struct {
+		config    Config
+		wantError string
+	}{
+		{Config{}, "notify - want smtp and/or telegram"},
+		{Config{Telegram: &TelegramConfig{BotToken: "x"}},
+			"notify - Telegram needs a bot_token and a chat_id"},
+		{Config{SMTP: &SMTPConfig{Server: "smtp.example.com"}},
+			`notify - SMTP server "smtp.example.com" - want host:port`},
+		{Config{SMTP: &SMTPConfig{Server: "smtp.example.com:25", From: "a@example.com"}},
+			"notify - SMTP needs from and to addresses"},
+		{Config{Telegram: &TelegramConfig{BotToken: "x", ChatID: "y"}, DiskFreeMegabytes: 10},
+			"notify - disk_free_megabytes needs a disk_path"},
+	}
+	for _, td := range testData {
+		_, err := New(td.config, nil)
+		if err == nil {
+			t.Errorf("want error %s", td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("want error %s got %s", td.wantError, err.Error())
+		}
+	}
+}
+
+// TestNotify checks that Notify sends a notification and suppresses repeats.
+func TestNotify(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger := log.New(&logBuffer, "", 0)
+
+	notifier, sender, clock := newTestNotifier(t, Config{Station: "shed"}, logger)
+
+	notifier.Notify(CredentialsRejected, "bad password")
+	notifier.Notify(CredentialsRejected, "bad password")
+	notifier.Notify(DiskNearlyFull, "1 MB free")
+
+	*clock = clock.Add(DefaultRepeat)
+	notifier.Notify(CredentialsRejected, "bad password again")
+
+	want := []string{
+		"shed: credentials rejected - bad password",
+		"shed: disk nearly full - 1 MB free",
+		"shed: credentials rejected - bad password again",
+	}
+
+	if strings.Join(want, "\n") != strings.Join(sender.sent, "\n") {
+		t.Errorf("want\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(sender.sent, "\n"))
+	}
+
+	if !strings.HasPrefix(logBuffer.String(), "notify shed: credentials rejected - bad password\n") {
+		t.Errorf("want the event logged, got %s", logBuffer.String())
+	}
+}
+
+// TestNotifyWhenSuppressed checks that nothing is sent while notifications
+// are suppressed.
+func TestNotifyWhenSuppressed(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger := log.New(&logBuffer, "", 0)
+
+	notifier, sender, clock := newTestNotifier(t, Config{}, logger)
+
+	start := *clock
+	notifier.SuppressWhen(func(t time.Time) bool {
+		return t.Sub(start) < time.Hour
+	})
+
+	notifier.Notify(DeviceOffline, "quiet")
+	if len(sender.sent) != 0 {
+		t.Errorf("want no notifications, got %v", sender.sent)
+	}
+	if logBuffer.String() != "notification suppressed - device offline - quiet\n" {
+		t.Errorf("want the suppression logged, got %s", logBuffer.String())
+	}
+
+	// The suppressed event doesn't count towards the repeat interval.
+	*clock = clock.Add(time.Hour)
+	notifier.Notify(DeviceOffline, "still quiet")
+	if len(sender.sent) != 1 {
+		t.Errorf("want one notification, got %v", sender.sent)
+	}
+}
+
+// TestNotifyWithSendFailure checks that a failure to send is logged.
+func TestNotifyWithSendFailure(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger := log.New(&logBuffer, "", 0)
+
+	notifier, sender, _ := newTestNotifier(t, Config{}, logger)
+	sender.fail = true
+
+	notifier.Notify(DeviceOffline, "quiet")
+
+	if !strings.Contains(logBuffer.String(), "cannot send notification - send failed") {
+		t.Errorf("want the failure logged, got %s", logBuffer.String())
+	}
+}
+
+// TestCheckDeviceOffline checks that Check notices when the device goes quiet.
+func TestCheckDeviceOffline(t *testing.T) {
+	notifier, sender, clock := newTestNotifier(t, Config{DeviceOfflineMinutes: 10}, nil)
+
+	*clock = clock.Add(5 * time.Minute)
+	notifier.Check()
+	if len(sender.sent) != 0 {
+		t.Errorf("want no notifications, got %v", sender.sent)
+	}
+
+	// Data arrives, then nothing for 11 minutes.
+	notifier.Seen()
+	*clock = clock.Add(11 * time.Minute)
+	notifier.Check()
+
+	const want = "device offline - no data from the GNSS device for 11m0s"
+	if len(sender.sent) != 1 || sender.sent[0] != want {
+		t.Errorf("want %s got %v", want, sender.sent)
+	}
+}
+
+// TestCheckDiskSpace checks that Check notices when the disk is nearly full.
+func TestCheckDiskSpace(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger := log.New(&logBuffer, "", 0)
+
+	config := Config{DiskPath: "/data", DiskFreeMegabytes: 100}
+	notifier, sender, _ := newTestNotifier(t, config, logger)
+
+	var free uint64 = 200 * megabyte
+	var freeError error
+	notifier.freeSpace = func(path string) (uint64, error) {
+		return free, freeError
+	}
+
+	notifier.Check()
+	if len(sender.sent) != 0 {
+		t.Errorf("want no notifications, got %v", sender.sent)
+	}
+
+	freeError = errors.New("no such file")
+	notifier.Check()
+	if !strings.Contains(logBuffer.String(), "cannot check the free space on /data - no such file") {
+		t.Errorf("want the error logged, got %s", logBuffer.String())
+	}
+
+	free = 50 * megabyte
+	freeError = nil
+	notifier.Check()
+
+	const want = "disk nearly full - only 50 MB free on the disk holding /data"
+	if len(sender.sent) != 1 || sender.sent[0] != want {
+		t.Errorf("want %s got %v", want, sender.sent)
+	}
+}
+
+// TestFreeSpace checks that the free space on a real disk can be read.
+func TestFreeSpace(t *testing.T) {
+	free, err := freeSpace(t.TempDir())
+	if err != nil {
+		t.Skip(err)
+	}
+	if free == 0 {
+		t.Error("want some free space")
+	}
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPConfig is the config for sending notifications by email.
+type SMTPConfig struct {
+	// Server is the host and port of the mail server, for example
+	// "smtp.example.com:587".
+	Server string `json:"server"`
+
+	// Username and Password are used to log in to the server.  If the
+	// username is empty, the Notifier doesn't log in.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// From is the sender's address.
+	From string `json:"from"`
+
+	// To lists the recipients' addresses.
+	To []string `json:"to"`
+}
+
+// sendMail sends an email.  It's a variable to support testing.
+var sendMail = smtp.SendMail
+
+// smtpSender sends notifications by email.
+type smtpSender struct {
+	config SMTPConfig
+	auth   smtp.Auth
+}
+
+// newSMTPSender creates an smtpSender, checking the config.
+func newSMTPSender(config SMTPConfig) (*smtpSender, error) {
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		em := fmt.Sprintf("notify - SMTP server %q - want host:port", config.Server)
+		return nil, errors.New(em)
+	}
+
+	if len(config.From) == 0 || len(config.To) == 0 {
+		return nil, errors.New("notify - SMTP needs from and to addresses")
+	}
+
+	sender := smtpSender{config: config}
+	if len(config.Username) > 0 {
+		sender.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+
+	return &sender, nil
+}
+
+// send sends the notification as an email.
+func (sender *smtpSender) send(subject, text string) error {
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		sender.config.From, strings.Join(sender.config.To, ", "), subject, text)
+
+	return sendMail(sender.config.Server, sender.auth, sender.config.From,
+		sender.config.To, []byte(message))
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"net/smtp"
+	"testing"
+)
+
+// TestSMTPSend checks the email sent by an smtpSender.
+func TestSMTPSend(t *testing.T) {
+	const want = "From: base@example.com\r\nTo: a@example.com, b@example.com\r\n" +
+		"Subject: shed: device offline\r\n\r\nno data\r\n"
+
+	config := SMTPConfig{
+		Server:   "smtp.example.com:587",
+		Username: "base@example.com",
+		Password: "secret",
+		From:     "base@example.com",
+		To:       []string{"a@example.com", "b@example.com"},
+	}
+
+	sender, err := newSMTPSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotServer string
+	var gotAuth smtp.Auth
+	var gotMessage string
+	saved := sendMail
+	defer func() { sendMail = saved }()
+	sendMail = func(server string, auth smtp.Auth, from string, to []string, message []byte) error {
+		gotServer = server
+		gotAuth = auth
+		gotMessage = string(message)
+		return nil
+	}
+
+	sendError := sender.send("shed: device offline", "no data")
+	if sendError != nil {
+		t.Fatal(sendError)
+	}
+
+	if gotServer != config.Server {
+		t.Errorf("want server %s got %s", config.Server, gotServer)
+	}
+	if gotAuth == nil {
+		t.Error("want authentication")
+	}
+	if gotMessage != want {
+		t.Errorf("want %q got %q", want, gotMessage)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TelegramConfig is the config for sending notifications using a Telegram
+// bot.  The bot is created by talking to Telegram's BotFather, which gives
+// the token.  The chat ID identifies the chat or group that receives the
+// messages.
+type TelegramConfig struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+}
+
+// telegramURL is the base URL of the Telegram bot API.  It's a variable to
+// support testing.
+var telegramURL = "https://api.telegram.org"
+
+// telegramTimeout is the time allowed for a request to the Telegram API.
+const telegramTimeout = 30 * time.Second
+
+// telegramSender sends notifications using a Telegram bot.
+type telegramSender struct {
+	config TelegramConfig
+	client *http.Client
+}
+
+// newTelegramSender creates a telegramSender, checking the config.
+func newTelegramSender(config TelegramConfig) (*telegramSender, error) {
+	if len(config.BotToken) == 0 || len(config.ChatID) == 0 {
+		return nil, errors.New("notify - Telegram needs a bot_token and a chat_id")
+	}
+
+	sender := telegramSender{
+		config: config,
+		client: &http.Client{Timeout: telegramTimeout},
+	}
+
+	return &sender, nil
+}
+
+// send sends the notification as a Telegram message.
+func (sender *telegramSender) send(subject, text string) error {
+	apiURL := fmt.Sprintf("%s/bot%s/sendMessage", telegramURL, sender.config.BotToken)
+	form := url.Values{
+		"chat_id": {sender.config.ChatID},
+		"text":    {subject + "\n" + text},
+	}
+
+	response, err := sender.client.PostForm(apiURL, form)
+	if err != nil {
+		// The error contains the URL, which contains the token.
+		em := fmt.Sprintf("Telegram request failed - %v", errors.Unwrap(err))
+		return errors.New(em)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		em := fmt.Sprintf("Telegram request failed - %s", response.Status)
+		return errors.New(em)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTelegramSend checks the request sent by a telegramSender.
+func TestTelegramSend(t *testing.T) {
+	var gotPath, gotChatID, gotText string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotChatID = r.FormValue("chat_id")
+		gotText = r.FormValue("text")
+		if gotChatID != "987654" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	saved := telegramURL
+	defer func() { telegramURL = saved }()
+	telegramURL = server.URL
+
+	sender, _ := newTelegramSender(TelegramConfig{BotToken: "123:ABC", ChatID: "987654"})
+
+	err := sender.send("shed: disk nearly full", "10 MB free")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotPath != "/bot123:ABC/sendMessage" {
+		t.Errorf("want path /bot123:ABC/sendMessage got %s", gotPath)
+	}
+	if gotText != "shed: disk nearly full\n10 MB free" {
+		t.Errorf("want text %q got %q", "shed: disk nearly full\n10 MB free", gotText)
+	}
+
+	// The API rejects a bad chat ID.
+	badSender, _ := newTelegramSender(TelegramConfig{BotToken: "123:ABC", ChatID: "1"})
+	badError := badSender.send("x", "y")
+	if badError == nil || badError.Error() != "Telegram request failed - 400 Bad Request" {
+		t.Errorf("want a bad request error, got %v", badError)
+	}
+}
@@ -0,0 +1,347 @@
+// The ntrip package provides an NTRIP client, the rover's side of NTRIP.
+//
+// The Client connects to a mountpoint on a caster, receives the RTCM
+// stream and writes the valid RTCM messages to a writer, typically the
+// serial line of a rover's GNSS device:
+//
+//	client, err := ntrip.New(config, logger)
+//	...
+//	err = client.Run(device)
+//
+// The data passes through the RTCM handler, so any non-RTCM data and any
+// frames that fail the CRC check are dropped rather than confusing the
+// device.  If the caster sends the stream in HTTP chunks or interleaves it
+// with ICY metadata, the framing is stripped out first.
+//
+// A network caster that makes up a virtual reference station near the rover
+// needs to know where the rover is.  If the config gives a position, the
+// Client sends it to the caster in a GGA sentence when it connects and at
+// intervals after that.
+//
+// A Failover fetches the stream from the first of several casters that
+// works, in order of priority, and goes back to a better one when it comes
+// back - see failover.go.
+//
+// The package also provides a Source, which sends a stream to a mountpoint
+// the way that a base station does.  A Client writing to a Source relays a
+// mountpoint from one caster to another - see source.go.
+package ntrip
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/nmea"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+	"github.com/goblimey/go-ntrip/typefilter"
+)
+
+// userAgent identifies the client to the caster.
+const userAgent = "NTRIP go-ntrip-client"
+
+// dialTimeout is the time allowed to connect to the caster.
+const dialTimeout = 10 * time.Second
+
+// responseTimeout is the time allowed for the caster to answer the request.
+const responseTimeout = 30 * time.Second
+
+// DefaultGGAInterval is the time between GGA sentences used when the config
+// doesn't give one.
+const DefaultGGAInterval = 10 * time.Second
+
+// Config is the config of a Client, as it appears in an application's JSON
+// config file, for example:
+//
+//	{
+//	    "caster": "caster.example.com:2101",
+//	    "mountpoint": "MYBASE",
+//	    "user": "rover",
+//	    "password": "letmein",
+//	    "gga": {
+//	        "latitude": 51.4779,
+//	        "longitude": -0.0015,
+//	        "height": 45.0,
+//	        "interval_seconds": 10
+//	    }
+//	}
+type Config struct {
+	// Caster is the host and port of the caster.
+	Caster string `json:"caster"`
+
+	// Mountpoint is the mountpoint to fetch.
+	Mountpoint string `json:"mountpoint"`
+
+	// User and Password are the credentials, if the caster wants them.
+	User     string `json:"user"`
+	Password string `json:"password"`
+
+	// GGA optionally gives the rover's position, to be sent to the caster.
+	GGA *GGAConfig `json:"gga"`
+}
+
+// GGAConfig gives the rover's approximate position and how often to send
+// it.
+type GGAConfig struct {
+	// Latitude and Longitude in degrees, north and east positive.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	// Height in metres above the ellipsoid.
+	Height float64 `json:"height"`
+
+	// IntervalSeconds is the time between sentences.  0 means
+	// DefaultGGAInterval.
+	IntervalSeconds uint `json:"interval_seconds"`
+}
+
+// Interval returns the time between GGA sentences.
+func (config *GGAConfig) Interval() time.Duration {
+	if config.IntervalSeconds == 0 {
+		return DefaultGGAInterval
+	}
+	return time.Duration(config.IntervalSeconds) * time.Second
+}
+
+// Validate checks the config.
+func (config *Config) Validate() error {
+	if len(config.Caster) == 0 {
+		return errors.New("ntrip - want a caster")
+	}
+	if len(strings.TrimPrefix(config.Mountpoint, "/")) == 0 {
+		return errors.New("ntrip - want a mountpoint")
+	}
+	if config.GGA != nil {
+		if config.GGA.Latitude < -90 || config.GGA.Latitude > 90 ||
+			config.GGA.Longitude < -180 || config.GGA.Longitude > 180 {
+
+			em := fmt.Sprintf("ntrip - illegal GGA position %f, %f",
+				config.GGA.Latitude, config.GGA.Longitude)
+			return errors.New(em)
+		}
+	}
+	return nil
+}
+
+// Client fetches the RTCM stream from a mountpoint.
+type Client struct {
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// dial connects to the caster.  It's a variable to support testing.
+	dial func() (net.Conn, error)
+
+	// now returns the current time.  It's a variable to support testing.
+	now func() time.Time
+
+	// filter chooses the message types that are passed on.  If it's nil,
+	// all the valid RTCM messages are passed on.
+	filter *typefilter.Filter
+}
+
+// New creates a Client, checking the config.  The logger may be nil.
+func New(config Config, logger *log.Logger) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	client := Client{
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+	client.dial = func() (net.Conn, error) {
+		return net.DialTimeout("tcp", config.Caster, dialTimeout)
+	}
+
+	return &client, nil
+}
+
+// SetTypeFilter sets the filter that chooses the message types passed on
+// by Run, for example to drop message type 1230 from a relayed stream.  nil
+// passes on all types.
+func (client *Client) SetTypeFilter(filter *typefilter.Filter) {
+	client.filter = filter
+}
+
+// Connect connects to the caster and asks for the mountpoint.  If the
+// caster accepts, it returns the connection and a reader positioned at the
+// start of the data.  If the caster sends the data in HTTP chunks or with
+// ICY metadata blocks, the reader strips them out - see stream.go.
+func (client *Client) Connect() (net.Conn, *bufio.Reader, error) {
+	conn, dialError := client.dial()
+	if dialError != nil {
+		return nil, nil, exitcode.Wrap(exitcode.InputUnavailable, dialError)
+	}
+
+	conn.SetDeadline(time.Now().Add(responseTimeout))
+
+	_, writeError := conn.Write([]byte(client.request()))
+	if writeError != nil {
+		conn.Close()
+		return nil, nil, writeError
+	}
+
+	reader := bufio.NewReader(conn)
+	format, responseError := readResponse(reader)
+	if responseError != nil {
+		conn.Close()
+		return nil, nil, responseError
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return conn, format.reader(reader), nil
+}
+
+// request returns the NTRIP version 1 request for the mountpoint.
+func (client *Client) request() string {
+	request := fmt.Sprintf("GET /%s HTTP/1.0\r\nUser-Agent: %s\r\n",
+		strings.TrimPrefix(client.config.Mountpoint, "/"), userAgent)
+	if len(client.config.User) > 0 || len(client.config.Password) > 0 {
+		credentials := base64.StdEncoding.EncodeToString(
+			[]byte(client.config.User + ":" + client.config.Password))
+		request += "Authorization: Basic " + credentials + "\r\n"
+	}
+	return request + "\r\n"
+}
+
+// readResponse reads the caster's response to the request and returns the
+// format of the data that follows.  An NTRIP version 1 caster replies "ICY
+// 200 OK", sometimes followed by headers.  Some reply with an HTTP status
+// line and headers.  A caster that doesn't have the mountpoint sends the
+// sourcetable.
+func readResponse(reader *bufio.Reader) (streamFormat, error) {
+	status, readError := reader.ReadString('\n')
+	if readError != nil {
+		return streamFormat{}, readError
+	}
+	status = strings.TrimSpace(status)
+
+	switch {
+	case status == "ICY 200 OK":
+		if hasHeaders(reader) {
+			return readHeaders(reader)
+		}
+		return streamFormat{}, nil
+	case strings.HasPrefix(status, "SOURCETABLE "):
+		return streamFormat{}, errors.New("caster doesn't have the mountpoint")
+	case strings.HasPrefix(status, "HTTP/1.") && strings.Contains(status, " 200 "):
+		return readHeaders(reader)
+	default:
+		return streamFormat{}, refusal(status)
+	}
+}
+
+// refusal returns the error for the caster's refusal of the request.  If
+// the caster refused the credentials, the error carries the exit status
+// exitcode.AuthFailure, since there's no point in trying again.
+func refusal(status string) error {
+	em := fmt.Sprintf("caster refused the request - %s", status)
+	if strings.Contains(status, " 401 ") || strings.Contains(status, "Bad Password") {
+		return exitcode.Wrap(exitcode.AuthFailure, errors.New(em))
+	}
+	return errors.New(em)
+}
+
+// Run connects to the caster and writes the valid RTCM messages that it
+// receives to the writer, leaving out any types that the filter drops.  It
+// returns when the caster closes the connection or there is an error.  The
+// caller can call it again to reconnect.
+func (client *Client) Run(writer io.Writer) error {
+	return client.run(writer, nil)
+}
+
+// run is Run, but it also returns when the stop channel is closed.  The
+// channel may be nil.
+func (client *Client) run(writer io.Writer, stop <-chan struct{}) error {
+	conn, reader, connectError := client.Connect()
+	if connectError != nil {
+		return connectError
+	}
+	defer conn.Close()
+
+	if stop != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-stop:
+				// Stop reading so that the handler finishes.
+				conn.Close()
+			case <-done:
+			}
+		}()
+	}
+
+	eventlog.Printf(client.logger, "connected to %s/%s", client.config.Caster, client.config.Mountpoint)
+
+	stopGGA := make(chan struct{})
+	var ggaDone sync.WaitGroup
+	if client.config.GGA != nil {
+		ggaDone.Add(1)
+		go func() {
+			defer ggaDone.Done()
+			client.sendGGA(conn, stopGGA)
+		}()
+	}
+	defer ggaDone.Wait()
+	defer close(stopGGA)
+
+	scanner := rtcm.NewScannerAt(reader, client.now())
+	for {
+		message, scanError := scanner.Next()
+		if scanError != nil {
+			return errors.New("caster closed the connection")
+		}
+		if message.MessageType == utils.NonRTCMMessage {
+			continue
+		}
+		if client.filter != nil && !client.filter.KeepFrame(message.MessageType, message.RawData) {
+			continue
+		}
+		if _, writeError := writer.Write(message.RawData); writeError != nil {
+			return exitcode.Wrap(exitcode.IOError, writeError)
+		}
+	}
+}
+
+// sendGGA sends the position to the caster at once and then at intervals
+// until the stop channel is closed.
+func (client *Client) sendGGA(conn net.Conn, stop <-chan struct{}) {
+	position := nmea.Position{
+		Latitude:  client.config.GGA.Latitude,
+		Longitude: client.config.GGA.Longitude,
+		Height:    client.config.GGA.Height,
+	}
+
+	ticker := time.NewTicker(client.config.GGA.Interval())
+	defer ticker.Stop()
+
+	for {
+		sentence := nmea.GGA(client.now(), position, nmea.FixQualityGPS, 0, 0)
+		conn.SetWriteDeadline(time.Now().Add(responseTimeout))
+		if _, err := conn.Write([]byte(sentence)); err != nil {
+			eventlog.Printf(client.logger, "cannot send the position to the caster - %v", err)
+			return
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package ntrip
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/typefilter"
+)
+
+// A Failover fetches an RTCM stream from one of several casters, given in
+// order of priority, so that a rover or a relay keeps getting corrections
+// when its usual caster is down:
+//
+//	failover, err := ntrip.NewFailover(configs, 0, logger)
+//	...
+//	err = failover.Run(device)
+//
+// Run uses the first caster in the list that accepts the request.  If that
+// caster closes the connection, or sends no RTCM messages for StallTimeout,
+// Run moves on to the next.  While it's using a caster that isn't the
+// first, it checks the ones before it at intervals by asking them for the
+// mountpoint, and goes back to the first of them that accepts.
+
+// DefaultCheckInterval is the time between checks of the casters with a
+// higher priority than the one in use, if NewFailover isn't given one.
+const DefaultCheckInterval = time.Minute
+
+// StallTimeout is the time for which a caster can send no RTCM messages
+// before the Failover gives up on it.
+const StallTimeout = 30 * time.Second
+
+// watchInterval is the time between checks for a stall.
+const watchInterval = time.Second
+
+// Failover fetches the RTCM stream from the first of several casters that
+// works.
+type Failover struct {
+	// clients holds a Client for each caster, in order of priority.
+	clients []*Client
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// checkInterval is the time between checks of the casters with a
+	// higher priority than the one in use.
+	checkInterval time.Duration
+
+	// stallTimeout and watchInterval are variables to support testing.
+	stallTimeout  time.Duration
+	watchInterval time.Duration
+}
+
+// NewFailover creates a Failover that fetches from the casters in the
+// configs, the first having the highest priority.  A checkInterval of 0
+// means DefaultCheckInterval.  The logger may be nil.
+func NewFailover(configs []Config, checkInterval time.Duration, logger *log.Logger) (*Failover, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("ntrip - want at least one caster")
+	}
+
+	failover := Failover{
+		logger:        logger,
+		checkInterval: checkInterval,
+		stallTimeout:  StallTimeout,
+		watchInterval: watchInterval,
+	}
+	if failover.checkInterval == 0 {
+		failover.checkInterval = DefaultCheckInterval
+	}
+
+	for _, config := range configs {
+		client, err := New(config, logger)
+		if err != nil {
+			return nil, err
+		}
+		failover.clients = append(failover.clients, client)
+	}
+
+	return &failover, nil
+}
+
+// SetTypeFilter sets the filter that chooses the message types passed on
+// from every caster.  nil passes on all types.
+func (failover *Failover) SetTypeFilter(filter *typefilter.Filter) {
+	for _, client := range failover.clients {
+		client.SetTypeFilter(filter)
+	}
+}
+
+// Run writes the valid RTCM messages from the first caster that works to
+// the writer, moving down the list when a caster fails and back up when a
+// better one works again.  It returns when it reaches the end of the list,
+// with the error from the last caster, or when writing fails.  The caller
+// can call it again to start again from the top of the list.
+func (failover *Failover) Run(writer io.Writer) error {
+	var lastError error
+	for i := 0; i < len(failover.clients); i++ {
+		better, runError := failover.runOne(i, writer)
+		if exitcode.Code(runError) == exitcode.IOError {
+			return runError
+		}
+		if better >= 0 {
+			eventlog.Printf(failover.logger, "%s is back - switching to it", failover.name(better))
+			// The loop moves i on to better.
+			i = better - 1
+			continue
+		}
+		eventlog.Printf(failover.logger, "%s - %v", failover.name(i), runError)
+		lastError = runError
+	}
+	return lastError
+}
+
+// runOne runs the client of the caster with the given index until it fails,
+// it stalls or a caster with a higher priority accepts the request.  In the
+// last case it returns the index of that caster, otherwise -1.
+func (failover *Failover) runOne(i int, writer io.Writer) (int, error) {
+	watched := &watchedWriter{writer: writer, last: time.Now()}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	better := -1
+	var watching sync.WaitGroup
+	watching.Add(1)
+	go func() {
+		defer watching.Done()
+		better = failover.watch(i, watched, stop, done)
+	}()
+
+	runError := failover.clients[i].run(watched, stop)
+	close(done)
+	watching.Wait()
+
+	return better, runError
+}
+
+// watch watches the client of the caster with the given index, closing the
+// stop channel if it stalls or if a caster with a higher priority accepts
+// the request.  In the last case it returns the index of that caster,
+// otherwise -1.  It returns when the done channel is closed.
+func (failover *Failover) watch(i int, watched *watchedWriter, stop chan<- struct{}, done <-chan struct{}) int {
+	ticker := time.NewTicker(failover.watchInterval)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-done:
+			return -1
+		case <-ticker.C:
+		}
+
+		if time.Since(watched.lastWrite()) > failover.stallTimeout {
+			eventlog.Printf(failover.logger, "%s - no RTCM messages for %v",
+				failover.name(i), failover.stallTimeout)
+			close(stop)
+			return -1
+		}
+
+		if i > 0 && time.Since(lastCheck) >= failover.checkInterval {
+			lastCheck = time.Now()
+			if better := failover.firstWorking(i); better >= 0 {
+				close(stop)
+				return better
+			}
+		}
+	}
+}
+
+// firstWorking returns the index of the first caster before the given one
+// that accepts the request, or -1 if none does.
+func (failover *Failover) firstWorking(before int) int {
+	for j := 0; j < before; j++ {
+		conn, _, err := failover.clients[j].Connect()
+		if err == nil {
+			conn.Close()
+			return j
+		}
+	}
+	return -1
+}
+
+// name returns the caster and mountpoint of the client with the given
+// index, for the log.
+func (failover *Failover) name(i int) string {
+	config := &failover.clients[i].config
+	return config.Caster + "/" + config.Mountpoint
+}
+
+// watchedWriter is a writer that notes the time of the last successful
+// write.
+type watchedWriter struct {
+	writer io.Writer
+
+	// The mutex controls access to last.
+	mutex sync.Mutex
+	last  time.Time
+}
+
+// Write writes to the writer and notes the time.
+func (watched *watchedWriter) Write(buffer []byte) (int, error) {
+	n, err := watched.writer.Write(buffer)
+	if err == nil {
+		watched.mutex.Lock()
+		watched.last = time.Now()
+		watched.mutex.Unlock()
+	}
+	return n, err
+}
+
+// lastWrite returns the time of the last successful write.
+func (watched *watchedWriter) lastWrite() time.Time {
+	watched.mutex.Lock()
+	defer watched.mutex.Unlock()
+	return watched.last
+}
@@ -0,0 +1,169 @@
+package ntrip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// session returns a function that plays a caster for one connection.  It
+// reads the request, sends the response and the data and then, if hold is
+// true, waits for the client to close the connection.
+func session(response string, data []byte, hold bool) func(net.Conn) {
+	return func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		conn.Write([]byte(response))
+		conn.Write(data)
+		if hold {
+			io.Copy(ioutil.Discard, reader)
+		}
+	}
+}
+
+// scriptedDial returns a dial function that plays the sessions in turn, one
+// for each connection, and then refuses to connect.
+func scriptedDial(sessions ...func(net.Conn)) func() (net.Conn, error) {
+	var mutex sync.Mutex
+	return func() (net.Conn, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(sessions) == 0 {
+			return nil, errors.New("connection refused")
+		}
+		play := sessions[0]
+		sessions = sessions[1:]
+		clientEnd, casterEnd := net.Pipe()
+		go play(casterEnd)
+		return clientEnd, nil
+	}
+}
+
+// newTestFailover returns a Failover for the given number of casters,
+// with short timings.
+func newTestFailover(t *testing.T, casters int, logger *log.Logger) *Failover {
+	t.Helper()
+	var configs []Config
+	for i := 0; i < casters; i++ {
+		configs = append(configs, Config{Caster: "caster.example.com:2101", Mountpoint: "MYBASE"})
+	}
+	failover, err := NewFailover(configs, 10*time.Millisecond, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failover.stallTimeout = time.Hour
+	failover.watchInterval = 5 * time.Millisecond
+	return failover
+}
+
+// TestNewFailover checks that NewFailover checks the configs.
+func TestNewFailover(t *testing.T) {
+	var testData = []struct {
+		description string
+		configs     []Config
+		wantError   string
+	}{
+		{"none", nil, "ntrip - want at least one caster"},
+		{"bad fallback", []Config{{Caster: "a:2101", Mountpoint: "A"}, {Caster: "b:2101"}},
+			"ntrip - want a mountpoint"},
+	}
+	for _, td := range testData {
+		_, err := NewFailover(td.configs, 0, nil)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+		} else if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+
+	failover, err := NewFailover([]Config{{Caster: "a:2101", Mountpoint: "A"}}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failover.checkInterval != DefaultCheckInterval {
+		t.Errorf("want %v got %v", DefaultCheckInterval, failover.checkInterval)
+	}
+}
+
+// TestFailoverToFallback checks that the stream comes from the fallback
+// when the primary is down.
+func TestFailoverToFallback(t *testing.T) {
+	failover := newTestFailover(t, 2, nil)
+	failover.clients[0].dial = scriptedDial()
+	failover.clients[1].dial = scriptedDial(session("ICY 200 OK\r\n", testdata.MessageFrameType1005, false))
+
+	var output bytes.Buffer
+	err := failover.Run(&output)
+
+	const wantError = "caster closed the connection"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+	if !bytes.Equal(testdata.MessageFrameType1005, output.Bytes()) {
+		t.Errorf("want %v got %v", testdata.MessageFrameType1005, output.Bytes())
+	}
+}
+
+// TestFallbackToPrimary checks that the stream goes back to the primary
+// when it comes back.
+func TestFallbackToPrimary(t *testing.T) {
+	var logBuffer bytes.Buffer
+	failover := newTestFailover(t, 2, log.New(&logBuffer, "", 0))
+
+	// The primary is down at first.  When it's back, it accepts the check
+	// and then sends a message.
+	failover.clients[0].dial = scriptedDial(
+		session("SOURCETABLE 200 OK\r\n", nil, false),
+		session("ICY 200 OK\r\n", nil, false),
+		session("ICY 200 OK\r\n", testdata.MessageFrameType1077, false),
+	)
+	// The fallback sends a message and then stays connected.
+	failover.clients[1].dial = scriptedDial(
+		session("ICY 200 OK\r\n", testdata.MessageFrameType1005, true),
+	)
+
+	var output bytes.Buffer
+	failover.Run(&output)
+
+	want := append(append([]byte{}, testdata.MessageFrameType1005...), testdata.MessageFrameType1077...)
+	if !bytes.Equal(want, output.Bytes()) {
+		t.Errorf("want %v\ngot  %v", want, output.Bytes())
+	}
+	if !strings.Contains(logBuffer.String(), "caster.example.com:2101/MYBASE is back - switching to it") {
+		t.Errorf("want the switch logged\n%s", logBuffer.String())
+	}
+}
+
+// TestStall checks that the Failover gives up on a caster that accepts the
+// request but sends nothing.
+func TestStall(t *testing.T) {
+	var logBuffer bytes.Buffer
+	failover := newTestFailover(t, 1, log.New(&logBuffer, "", 0))
+	failover.stallTimeout = 20 * time.Millisecond
+	failover.clients[0].dial = scriptedDial(session("ICY 200 OK\r\n", nil, true))
+
+	var output bytes.Buffer
+	err := failover.Run(&output)
+	if err == nil {
+		t.Error("want an error")
+	}
+	if !strings.Contains(logBuffer.String(), "no RTCM messages for 20ms") {
+		t.Errorf("want the stall logged\n%s", logBuffer.String())
+	}
+}
@@ -0,0 +1,193 @@
+package ntrip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/exitcode"
+)
+
+// A Source is the other side of NTRIP, an NTRIP server.  It sends an RTCM
+// stream to a mountpoint on a caster, logging in with an NTRIP version 1
+// SOURCE request.  It's a writer, so it can take the place of the rover's
+// device and turn a Client into a relay that fetches the stream from one
+// caster and republishes it on another:
+//
+//	source, err := ntrip.NewSource(sourceConfig, logger)
+//	...
+//	err = source.Connect()  // Check the login.
+//	...
+//	err = client.Run(source)
+//
+// The Source connects when it's first written to if it's not already
+// connected.  If the caster can't be reached or the connection fails, the
+// data is dropped and the Source doesn't try to connect again until
+// SourceRetry has passed, so a caster that's down doesn't hold up the
+// stream that's being fetched.
+
+// sourceAgent identifies the Source to the caster.
+const sourceAgent = "NTRIP go-ntrip-source"
+
+// SourceRetry is the time that a Source waits after a failure before it
+// connects again.
+const SourceRetry = 5 * time.Second
+
+// sourceWriteTimeout is the time allowed for each write to the caster.
+const sourceWriteTimeout = 10 * time.Second
+
+// SourceConfig is the config of a Source.
+type SourceConfig struct {
+	// Caster is the host and port of the caster.
+	Caster string `json:"caster"`
+
+	// Mountpoint is the mountpoint to send to.
+	Mountpoint string `json:"mountpoint"`
+
+	// Password is the mountpoint's password.
+	Password string `json:"password"`
+}
+
+// Validate checks the config.
+func (config *SourceConfig) Validate() error {
+	if len(config.Caster) == 0 {
+		return errors.New("ntrip - want a caster to send to")
+	}
+	if len(strings.TrimPrefix(config.Mountpoint, "/")) == 0 {
+		return errors.New("ntrip - want a mountpoint to send to")
+	}
+	return nil
+}
+
+// Source sends an RTCM stream to a mountpoint.  It's not safe for
+// concurrent use.
+type Source struct {
+	config SourceConfig
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// dial connects to the caster.  It's a variable to support testing.
+	dial func() (net.Conn, error)
+
+	// now returns the current time.  It's a variable to support testing.
+	now func() time.Time
+
+	// conn is the connection to the caster, nil if there isn't one.
+	conn net.Conn
+
+	// nextAttempt is the earliest time to connect again after a failure.
+	nextAttempt time.Time
+
+	// failing is true from a failure until the next successful connection,
+	// so that a failure is only logged once.
+	failing bool
+}
+
+// NewSource creates a Source, checking the config.  It doesn't connect.  The
+// logger may be nil.
+func NewSource(config SourceConfig, logger *log.Logger) (*Source, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	source := Source{
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+	source.dial = func() (net.Conn, error) {
+		return net.DialTimeout("tcp", config.Caster, dialTimeout)
+	}
+
+	return &source, nil
+}
+
+// Connect connects to the caster and logs in to the mountpoint, if the
+// Source isn't already connected.  If the caster refuses the password, the
+// error carries the exit status exitcode.AuthFailure.
+func (source *Source) Connect() error {
+	if source.conn != nil {
+		return nil
+	}
+
+	conn, dialError := source.dial()
+	if dialError != nil {
+		return exitcode.Wrap(exitcode.InputUnavailable, dialError)
+	}
+
+	conn.SetDeadline(time.Now().Add(responseTimeout))
+
+	request := fmt.Sprintf("SOURCE %s /%s\r\nSource-Agent: %s\r\n\r\n",
+		source.config.Password, strings.TrimPrefix(source.config.Mountpoint, "/"), sourceAgent)
+	if _, writeError := conn.Write([]byte(request)); writeError != nil {
+		conn.Close()
+		return writeError
+	}
+
+	response, readError := bufio.NewReader(conn).ReadString('\n')
+	if readError != nil {
+		conn.Close()
+		return readError
+	}
+	response = strings.TrimSpace(response)
+	if response != "ICY 200 OK" {
+		conn.Close()
+		return refusal(response)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	source.conn = conn
+	source.failing = false
+	eventlog.Printf(source.logger, "sending to %s/%s", source.config.Caster, source.config.Mountpoint)
+	return nil
+}
+
+// Write sends the data to the caster, connecting first if necessary.  If
+// that fails, the data is dropped.  It never returns an error, so the
+// stream that's being relayed carries on while the caster is unavailable.
+func (source *Source) Write(data []byte) (int, error) {
+	if source.conn == nil {
+		if source.now().Before(source.nextAttempt) {
+			return len(data), nil
+		}
+		if connectError := source.Connect(); connectError != nil {
+			source.fail(connectError)
+			return len(data), nil
+		}
+	}
+
+	source.conn.SetWriteDeadline(time.Now().Add(sourceWriteTimeout))
+	if _, writeError := source.conn.Write(data); writeError != nil {
+		source.fail(writeError)
+	}
+	return len(data), nil
+}
+
+// Close drops the connection, if there is one.
+func (source *Source) Close() error {
+	if source.conn == nil {
+		return nil
+	}
+	err := source.conn.Close()
+	source.conn = nil
+	return err
+}
+
+// fail drops the connection after an error and puts off the next attempt
+// to connect.
+func (source *Source) fail(err error) {
+	if !source.failing {
+		eventlog.Printf(source.logger, "cannot send to %s/%s - %v - dropping the data until the caster is back",
+			source.config.Caster, source.config.Mountpoint, err)
+		source.failing = true
+	}
+	source.Close()
+	source.nextAttempt = source.now().Add(SourceRetry)
+}
@@ -0,0 +1,192 @@
+package ntrip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/exitcode"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/typefilter"
+)
+
+// fakeReceivingCaster serves one end of a pipe as a caster receiving a
+// stream.  It reads the SOURCE request, sends it on the channel, sends the
+// response and then, if the login succeeded, sends everything that arrives
+// on the data channel.
+func fakeReceivingCaster(conn net.Conn, response string, requests chan<- string, data chan<- []byte) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	request := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		request += line
+		if line == "\r\n" {
+			break
+		}
+	}
+	requests <- request
+
+	conn.Write([]byte(response))
+	if response != "ICY 200 OK\r\n" {
+		return
+	}
+
+	received, _ := io.ReadAll(reader)
+	data <- received
+}
+
+// newTestSource returns a Source that connects to a fake caster.
+func newTestSource(t *testing.T, response string) (*Source, chan string, chan []byte) {
+	t.Helper()
+
+	config := SourceConfig{Caster: "caster.example.com:2101", Mountpoint: "/RELAY", Password: "secret"}
+	source, err := NewSource(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := make(chan string, 2)
+	data := make(chan []byte, 2)
+	source.dial = func() (net.Conn, error) {
+		sourceEnd, casterEnd := net.Pipe()
+		go fakeReceivingCaster(casterEnd, response, requests, data)
+		return sourceEnd, nil
+	}
+
+	return source, requests, data
+}
+
+// TestSourceValidate checks that the config of a Source is checked.
+func TestSourceValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      SourceConfig
+		wantError   string
+	}{
+		{"good", SourceConfig{Caster: "caster.example.com:2101", Mountpoint: "RELAY"}, ""},
+		{"no caster", SourceConfig{Mountpoint: "RELAY"}, "ntrip - want a caster to send to"},
+		{"no mountpoint", SourceConfig{Caster: "caster.example.com:2101"}, "ntrip - want a mountpoint to send to"},
+	}
+	for _, td := range testData {
+		_, err := NewSource(td.config, nil)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestSourceConnect checks the login and the handling of a refusal.
+func TestSourceConnect(t *testing.T) {
+	const wantRequest = "SOURCE secret /RELAY\r\nSource-Agent: NTRIP go-ntrip-source\r\n\r\n"
+
+	var testData = []struct {
+		description string
+		response    string
+		wantError   string
+		wantCode    int
+	}{
+		{"accepted", "ICY 200 OK\r\n", "", exitcode.OK},
+		{"bad password", "ERROR - Bad Password\r\n",
+			"caster refused the request - ERROR - Bad Password", exitcode.AuthFailure},
+		{"in use", "ERROR - Mount Point Taken or Invalid\r\n",
+			"caster refused the request - ERROR - Mount Point Taken or Invalid", exitcode.Failure},
+	}
+	for _, td := range testData {
+		source, requests, _ := newTestSource(t, td.response)
+
+		err := source.Connect()
+		if got := <-requests; got != wantRequest {
+			t.Errorf("%s: want request %q got %q", td.description, wantRequest, got)
+		}
+		if exitcode.Code(err) != td.wantCode {
+			t.Errorf("%s: want exit code %d got %d", td.description, td.wantCode, exitcode.Code(err))
+		}
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			source.Close()
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestSourceWriteWhileCasterDown checks that the data is dropped without an
+// error while the caster can't be reached, and that the Source doesn't try
+// again until the retry time has passed.
+func TestSourceWriteWhileCasterDown(t *testing.T) {
+	source, err := NewSource(SourceConfig{Caster: "caster.example.com:2101", Mountpoint: "RELAY"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, time.May, 15, 12, 0, 0, 0, time.UTC)
+	source.now = func() time.Time { return now }
+	dials := 0
+	source.dial = func() (net.Conn, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	}
+
+	for i := 0; i < 3; i++ {
+		n, err := source.Write(testdata.MessageFrameType1005)
+		if err != nil || n != len(testdata.MessageFrameType1005) {
+			t.Errorf("want %d, nil got %d, %v", len(testdata.MessageFrameType1005), n, err)
+		}
+	}
+	if dials != 1 {
+		t.Errorf("want 1 attempt to connect got %d", dials)
+	}
+
+	now = now.Add(SourceRetry)
+	source.Write(testdata.MessageFrameType1005)
+	if dials != 2 {
+		t.Errorf("want 2 attempts to connect got %d", dials)
+	}
+}
+
+// TestRelay checks that a Client writing to a Source relays the messages
+// that the filter keeps from one caster to the other.
+func TestRelay(t *testing.T) {
+	var data []byte
+	data = append(data, testdata.MessageFrameType1005...)
+	data = append(data, testdata.AllJunk...)
+	data = append(data, testdata.MessageFrameType1077...)
+
+	client, _ := newTestClient(t, Config{Caster: "upstream:2101", Mountpoint: "MYBASE"}, "ICY 200 OK\r\n", data)
+	filter, err := typefilter.New(nil, []int{1077})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTypeFilter(filter)
+
+	source, _, received := newTestSource(t, "ICY 200 OK\r\n")
+	if err := source.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Run(source)
+	source.Close()
+
+	got := <-received
+	if !bytes.Equal(testdata.MessageFrameType1005, got) {
+		t.Errorf("want % x\ngot  % x", testdata.MessageFrameType1005, got)
+	}
+}
@@ -0,0 +1,169 @@
+package sourcetable
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The nav-system and format-details fields of a stream's STR record say
+// which constellations the station tracks and which message types it sends
+// how often, for example "GPS+GLO+GAL" and "1005(10),1077(1),1087(1)".
+// Rovers use them to choose a stream, but they're typed in by hand and soon
+// go out of date when the receiver is reconfigured.  Capabilities works
+// them out from the messages that are actually sent.
+
+// staleIntervals is the number of intervals that may pass without a message
+// of a type before the type is taken to be no longer sent.
+const staleIntervals = 3
+
+// staleUnknown is the time after which a type that has only been seen once
+// is taken to be no longer sent.
+const staleUnknown = 5 * time.Minute
+
+// navSystems gives the name of each constellation in the nav-system field,
+// in the order in which they are listed.
+var navSystems = []struct {
+	constellation string
+	name          string
+}{
+	{"GPS", "GPS"},
+	{"Glonass", "GLO"},
+	{"Galileo", "GAL"},
+	{"Beidou", "BDS"},
+	{"QZSS", "QZS"},
+	{"SBAS", "SBAS"},
+	{"NavIC/IRNSS", "IRS"},
+}
+
+// seen records when messages of one type were seen.
+type seen struct {
+	// last is the time of the latest message.
+	last time.Time
+
+	// interval is the time between the last two messages, zero if there
+	// has been only one.
+	interval time.Duration
+}
+
+// Capabilities works out the nav-system and format-details fields of a
+// stream from the messages seen on it.  It's safe for concurrent use.
+type Capabilities struct {
+	// types holds the message types seen, by type.
+	types map[int]*seen
+
+	// The mutex controls access to types.
+	mutex sync.Mutex
+}
+
+// NewCapabilities creates a Capabilities that has seen nothing.
+func NewCapabilities() *Capabilities {
+	return &Capabilities{types: make(map[int]*seen)}
+}
+
+// Observe records a message of the given type seen at the given time.
+// Non-RTCM data is ignored.
+func (capabilities *Capabilities) Observe(messageType int, at time.Time) {
+	if messageType == utils.NonRTCMMessage {
+		return
+	}
+
+	capabilities.mutex.Lock()
+	defer capabilities.mutex.Unlock()
+
+	s, ok := capabilities.types[messageType]
+	if !ok {
+		capabilities.types[messageType] = &seen{last: at}
+		return
+	}
+	if at.After(s.last) {
+		s.interval = at.Sub(s.last)
+		s.last = at
+	}
+}
+
+// Describe sets the nav-system and format-details fields of the stream from
+// the message types seen recently.  A type that hasn't been seen for three
+// of its intervals, or for five minutes if it has only been seen once, is
+// no longer sent, so it's left out, and so is a constellation with no
+// observations left.  If nothing has been seen, the fields are left alone.
+func (capabilities *Capabilities) Describe(stream *Stream, now time.Time) {
+	capabilities.mutex.Lock()
+	defer capabilities.mutex.Unlock()
+
+	types := make([]int, 0, len(capabilities.types))
+	for messageType, s := range capabilities.types {
+		stale := staleUnknown
+		if s.interval > 0 {
+			stale = staleIntervals * s.interval
+		}
+		if now.Sub(s.last) > stale {
+			delete(capabilities.types, messageType)
+			continue
+		}
+		types = append(types, messageType)
+	}
+	if len(types) == 0 {
+		return
+	}
+	sort.Ints(types)
+
+	constellations := make(map[string]bool)
+	details := make([]string, 0, len(types))
+	for _, messageType := range types {
+		constellation := observationConstellation(messageType)
+		if len(constellation) > 0 {
+			constellations[constellation] = true
+		}
+		details = append(details, formatDetail(messageType, capabilities.types[messageType].interval))
+	}
+
+	names := make([]string, 0, len(constellations))
+	for _, n := range navSystems {
+		if constellations[n.constellation] {
+			names = append(names, n.name)
+		}
+	}
+
+	stream.NavSystem = strings.Join(names, "+")
+	stream.FormatDetails = strings.Join(details, ",")
+}
+
+// observationConstellation returns the constellation whose observations
+// are carried by a message of the given type, or an empty string if the
+// message doesn't carry observations.
+func observationConstellation(messageType int) string {
+	switch {
+	case utils.MSM(messageType):
+		return utils.GetConstellation(messageType)
+	case messageType >= 1001 && messageType <= 1004:
+		// Legacy GPS observations.
+		return "GPS"
+	case messageType >= 1009 && messageType <= 1012:
+		// Legacy GLONASS observations.
+		return "Glonass"
+	default:
+		return ""
+	}
+}
+
+// formatDetail returns the entry for a message type in the format-details
+// field - the type followed by its interval in seconds in brackets, or just
+// the type if its interval is not known.
+func formatDetail(messageType int, interval time.Duration) string {
+	if interval <= 0 {
+		return fmt.Sprintf("%d", messageType)
+	}
+	// Round to hide the jitter in the arrival times - to whole seconds, or
+	// to tenths for messages sent more often than once a second.
+	seconds := math.Round(interval.Seconds())
+	if seconds < 1 {
+		seconds = math.Max(0.1, math.Round(interval.Seconds()*10)/10)
+	}
+	return fmt.Sprintf("%d(%g)", messageType, seconds)
+}
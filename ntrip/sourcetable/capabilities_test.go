@@ -0,0 +1,132 @@
+package sourcetable
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestDescribe checks that Describe works out the nav-system and
+// format-details fields from the messages seen.
+func TestDescribe(t *testing.T) {
+	start := time.Date(2023, time.May, 18, 0, 0, 0, 0, time.UTC)
+
+	capabilities := NewCapabilities()
+
+	// Ten seconds of MSM7s for GPS, Galileo and GLONASS once a second, the
+	// base position every ten seconds, a text message once and some
+	// non-RTCM data.
+	for second := 0; second <= 10; second++ {
+		at := start.Add(time.Duration(second) * time.Second)
+		// The arrival times jitter a little.
+		if second%2 == 1 {
+			at = at.Add(40 * time.Millisecond)
+		}
+		capabilities.Observe(1077, at)
+		capabilities.Observe(1087, at)
+		capabilities.Observe(1097, at)
+		capabilities.Observe(utils.NonRTCMMessage, at)
+		if second%10 == 0 {
+			capabilities.Observe(1005, at)
+		}
+	}
+	capabilities.Observe(1029, start.Add(5*time.Second))
+
+	stream := Stream{Mountpoint: "MYBASE"}
+	capabilities.Describe(&stream, start.Add(10*time.Second))
+
+	const wantNavSystem = "GPS+GLO+GAL"
+	const wantDetails = "1005(10),1029,1077(1),1087(1),1097(1)"
+	if stream.NavSystem != wantNavSystem {
+		t.Errorf("want nav system %s got %s", wantNavSystem, stream.NavSystem)
+	}
+	if stream.FormatDetails != wantDetails {
+		t.Errorf("want format details %s got %s", wantDetails, stream.FormatDetails)
+	}
+
+	// The receiver is reconfigured to send GPS and Beidou MSM4s.  After a
+	// few seconds the GLONASS and Galileo messages are taken to have stopped.
+	for second := 11; second <= 20; second++ {
+		at := start.Add(time.Duration(second) * time.Second)
+		capabilities.Observe(1074, at)
+		capabilities.Observe(1124, at)
+		if second == 20 {
+			capabilities.Observe(1005, at)
+		}
+	}
+
+	capabilities.Describe(&stream, start.Add(20*time.Second))
+
+	const wantNavSystemAfter = "GPS+BDS"
+	const wantDetailsAfter = "1005(10),1029,1074(1),1124(1)"
+	if stream.NavSystem != wantNavSystemAfter {
+		t.Errorf("after: want nav system %s got %s", wantNavSystemAfter, stream.NavSystem)
+	}
+	if stream.FormatDetails != wantDetailsAfter {
+		t.Errorf("after: want format details %s got %s", wantDetailsAfter, stream.FormatDetails)
+	}
+
+	// The text message seen once is dropped after five minutes.
+	capabilities.Observe(1074, start.Add(6*time.Minute))
+	capabilities.Observe(1074, start.Add(6*time.Minute+time.Second))
+	capabilities.Describe(&stream, start.Add(6*time.Minute+time.Second))
+	if stream.FormatDetails != "1074(1)" {
+		t.Errorf("later: want format details 1074(1) got %s", stream.FormatDetails)
+	}
+}
+
+// TestDescribeWithNothingSeen checks that Describe leaves the fields alone
+// if no messages have been seen.
+func TestDescribeWithNothingSeen(t *testing.T) {
+	stream := Stream{NavSystem: "GPS", FormatDetails: "1077(1)"}
+	NewCapabilities().Describe(&stream, time.Now())
+	if stream.NavSystem != "GPS" || stream.FormatDetails != "1077(1)" {
+		t.Errorf("want the fields left alone, got %s and %s", stream.NavSystem, stream.FormatDetails)
+	}
+}
+
+// TestFormatDetail checks the entry for one message type.
+func TestFormatDetail(t *testing.T) {
+	var testData = []struct {
+		messageType int
+		interval    time.Duration
+		want        string
+	}{
+		{1005, 0, "1005"},
+		{1077, time.Second, "1077(1)"},
+		{1077, 960 * time.Millisecond, "1077(1)"},
+		{1077, 1040 * time.Millisecond, "1077(1)"},
+		{1005, 30 * time.Second, "1005(30)"},
+		{1077, 200 * time.Millisecond, "1077(0.2)"},
+		{1077, 10 * time.Millisecond, "1077(0.1)"},
+	}
+	for _, td := range testData {
+		got := formatDetail(td.messageType, td.interval)
+		if got != td.want {
+			t.Errorf("%d %v: want %s got %s", td.messageType, td.interval, td.want, got)
+		}
+	}
+}
+
+// TestObservationConstellation checks which messages carry observations.
+func TestObservationConstellation(t *testing.T) {
+	var testData = []struct {
+		messageType int
+		want        string
+	}{
+		{1004, "GPS"},
+		{1012, "Glonass"},
+		{1077, "GPS"},
+		{1117, "QZSS"},
+		{1127, "Beidou"},
+		{1005, ""},
+		{1230, ""},
+	}
+	for _, td := range testData {
+		got := observationConstellation(td.messageType)
+		if got != td.want {
+			t.Errorf("%d: want %q got %q", td.messageType, td.want, got)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+// The sourcetable package reads and writes the sourcetable of an NTRIP
+// caster.  A client that asks a caster for "/", or for a mountpoint that the
+// caster doesn't have, gets the sourcetable, which lists what the caster
+// offers.  Each line is a record of fields separated by semicolons.  The
+// first field gives the type of the record:
+//
+//	STR - a stream, one per mountpoint, giving the format of the data and
+//	      the position of the base station
+//	CAS - a caster, for example this one or a fallback
+//	NET - a network of base stations
+//
+// The table ends with a line "ENDSOURCETABLE".  Fetch gets a caster's
+// sourcetable and Parse reads one:
+//
+//	table, err := sourcetable.Fetch("caster.example.com:2101", "", "")
+//	...
+//	stream := table.Nearest(51.4779, -0.0015)
+//
+// A caster writes its own sourcetable with Table.String.  Capabilities
+// fills in the constellations and the message types of each stream from the
+// data that's actually sent.
+//
+// Real sourcetables are often untidy.  A record that can't be understood is
+// not treated as an error - it's skipped and kept in the table's Rejected
+// list, so that one bad entry doesn't hide the rest.
+package sourcetable
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EndOfTable is the line that ends the sourcetable.
+const EndOfTable = "ENDSOURCETABLE"
+
+// userAgent identifies the program to the caster.
+const userAgent = "NTRIP go-ntrip-sourcetable"
+
+// dialTimeout is the time allowed to connect to the caster.
+const dialTimeout = 10 * time.Second
+
+// responseTimeout is the time allowed for the caster to send the table.
+const responseTimeout = 30 * time.Second
+
+// earthRadiusMetres is the mean radius of the Earth, used to find the
+// distance to a stream.
+const earthRadiusMetres = 6371000.0
+
+// The number of fields in each type of record, not counting the misc
+// field at the end, which may be missing.
+const (
+	streamFields  = 18
+	casterFields  = 11
+	networkFields = 8
+)
+
+// Stream is an STR record, which describes one mountpoint.
+type Stream struct {
+	// Mountpoint is the name of the mountpoint.
+	Mountpoint string
+
+	// Identifier is the name of the source, often the nearest town.
+	Identifier string
+
+	// Format is the format of the data, for example "RTCM 3.3".
+	Format string
+
+	// FormatDetails lists the message types and their intervals in
+	// seconds, for example "1005(10),1077(1)".
+	FormatDetails string
+
+	// Carrier is 0 for no carrier phase, 1 for L1 and 2 for L1 and L2.
+	Carrier int
+
+	// NavSystem lists the constellations, for example "GPS+GLO+GAL".
+	NavSystem string
+
+	// Network is the name of the network to which the station belongs.
+	Network string
+
+	// Country is the three-letter country code.
+	Country string
+
+	// Latitude and Longitude give the position of the station in degrees,
+	// north and east positive.
+	Latitude  float64
+	Longitude float64
+
+	// NMEA is true if the client must send its position in a GGA sentence.
+	NMEA bool
+
+	// Solution is 0 for a single base station and 1 for a network solution.
+	Solution int
+
+	// Generator names the software or hardware that generates the data.
+	Generator string
+
+	// Compression names the compression or encryption, "none" if there is
+	// none.
+	Compression string
+
+	// Authentication is "N" for none, "B" for basic and "D" for digest.
+	Authentication string
+
+	// Fee is true if the user must pay for the data.
+	Fee bool
+
+	// Bitrate is the data rate in bits per second.
+	Bitrate int
+
+	// Misc is any other information.
+	Misc string
+}
+
+// Caster is a CAS record, which describes a caster.
+type Caster struct {
+	// Host and Port give the address of the caster.
+	Host string
+	Port int
+
+	// Identifier is the name of the caster.
+	Identifier string
+
+	// Operator is the organisation that runs the caster.
+	Operator string
+
+	// NMEA is true if the caster can take GGA sentences from clients.
+	NMEA bool
+
+	// Country is the three-letter country code.
+	Country string
+
+	// Latitude and Longitude give the position of the caster in degrees.
+	Latitude  float64
+	Longitude float64
+
+	// FallbackHost and FallbackPort give the address of a caster to use if
+	// this one is down.
+	FallbackHost string
+	FallbackPort int
+
+	// Misc is any other information.
+	Misc string
+}
+
+// Network is a NET record, which describes a network of stations.
+type Network struct {
+	// Identifier is the name of the network.
+	Identifier string
+
+	// Operator is the organisation that runs the network.
+	Operator string
+
+	// Authentication is "N" for none, "B" for basic and "D" for digest.
+	Authentication string
+
+	// Fee is true if the user must pay for the data.
+	Fee bool
+
+	// WebNet, WebStream and WebRegister are web addresses giving
+	// information about the network, the streams and how to register.
+	WebNet      string
+	WebStream   string
+	WebRegister string
+
+	// Misc is any other information.
+	Misc string
+}
+
+// Table is a sourcetable.
+type Table struct {
+	Streams  []Stream
+	Casters  []Caster
+	Networks []Network
+
+	// Rejected holds the lines that could not be understood.
+	Rejected []string
+}
+
+// Parse reads a sourcetable up to the ENDSOURCETABLE line or the end of the
+// input.  It returns an error only if the input can't be read.
+func Parse(reader io.Reader) (*Table, error) {
+	var table Table
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == EndOfTable {
+			return &table, nil
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !table.add(line) {
+			table.Rejected = append(table.Rejected, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &table, nil
+}
+
+// add adds the record in the line to the table.  It returns false if the
+// line is not a record that it understands.
+func (table *Table) add(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "STR;"):
+		stream, err := ParseStream(line)
+		if err != nil {
+			return false
+		}
+		table.Streams = append(table.Streams, *stream)
+	case strings.HasPrefix(line, "CAS;"):
+		caster, err := ParseCaster(line)
+		if err != nil {
+			return false
+		}
+		table.Casters = append(table.Casters, *caster)
+	case strings.HasPrefix(line, "NET;"):
+		network, err := ParseNetwork(line)
+		if err != nil {
+			return false
+		}
+		table.Networks = append(table.Networks, *network)
+	default:
+		return false
+	}
+	return true
+}
+
+// ParseStream parses an STR record.
+func ParseStream(line string) (*Stream, error) {
+	fields, splitError := split(line, "STR", streamFields)
+	if splitError != nil {
+		return nil, splitError
+	}
+
+	var p parser
+	stream := Stream{
+		Mountpoint:     fields[1],
+		Identifier:     fields[2],
+		Format:         fields[3],
+		FormatDetails:  fields[4],
+		Carrier:        p.integer("carrier", fields[5]),
+		NavSystem:      fields[6],
+		Network:        fields[7],
+		Country:        fields[8],
+		Latitude:       p.float("latitude", fields[9]),
+		Longitude:      p.float("longitude", fields[10]),
+		NMEA:           p.flag("nmea", fields[11], "1", "0"),
+		Solution:       p.integer("solution", fields[12]),
+		Generator:      fields[13],
+		Compression:    fields[14],
+		Authentication: fields[15],
+		Fee:            p.flag("fee", fields[16], "Y", "N"),
+		Bitrate:        p.integer("bitrate", fields[17]),
+		Misc:           fields[18],
+	}
+	if p.err != nil {
+		return nil, p.fail("STR", stream.Mountpoint)
+	}
+
+	return &stream, nil
+}
+
+// ParseCaster parses a CAS record.
+func ParseCaster(line string) (*Caster, error) {
+	fields, splitError := split(line, "CAS", casterFields)
+	if splitError != nil {
+		return nil, splitError
+	}
+
+	var p parser
+	caster := Caster{
+		Host:         fields[1],
+		Port:         p.integer("port", fields[2]),
+		Identifier:   fields[3],
+		Operator:     fields[4],
+		NMEA:         p.flag("nmea", fields[5], "1", "0"),
+		Country:      fields[6],
+		Latitude:     p.float("latitude", fields[7]),
+		Longitude:    p.float("longitude", fields[8]),
+		FallbackHost: fields[9],
+		FallbackPort: p.integer("fallback port", fields[10]),
+		Misc:         fields[11],
+	}
+	if p.err != nil {
+		return nil, p.fail("CAS", caster.Host)
+	}
+
+	return &caster, nil
+}
+
+// ParseNetwork parses a NET record.
+func ParseNetwork(line string) (*Network, error) {
+	fields, splitError := split(line, "NET", networkFields)
+	if splitError != nil {
+		return nil, splitError
+	}
+
+	var p parser
+	network := Network{
+		Identifier:     fields[1],
+		Operator:       fields[2],
+		Authentication: fields[3],
+		Fee:            p.flag("fee", fields[4], "Y", "N"),
+		WebNet:         fields[5],
+		WebStream:      fields[6],
+		WebRegister:    fields[7],
+		Misc:           fields[8],
+	}
+	if p.err != nil {
+		return nil, p.fail("NET", network.Identifier)
+	}
+
+	return &network, nil
+}
+
+// split splits a record into its fields.  The result has the given number
+// of fields followed by the misc field, which is empty if it's missing and
+// may contain semicolons.
+func split(line, recordType string, n int) ([]string, error) {
+	fields := strings.SplitN(line, ";", n+1)
+	if len(fields) < n {
+		em := fmt.Sprintf("%s record - want at least %d fields, got %d", recordType, n, len(fields))
+		return nil, errors.New(em)
+	}
+	if len(fields) == n {
+		fields = append(fields, "")
+	}
+	return fields, nil
+}
+
+// parser converts the fields of a record, remembering the first failure.
+type parser struct {
+	err error
+}
+
+// integer converts a field to an int.  An empty field is 0.
+func (p *parser) integer(name, field string) int {
+	if len(field) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(field)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("%s %q is not a number", name, field)
+	}
+	return n
+}
+
+// float converts a field to a float64.  An empty field is 0.
+func (p *parser) float(name, field string) float64 {
+	if len(field) == 0 {
+		return 0
+	}
+	f, err := strconv.ParseFloat(field, 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("%s %q is not a number", name, field)
+	}
+	return f
+}
+
+// flag converts a field that holds one of two values to a bool.  An empty
+// field is false.
+func (p *parser) flag(name, field, yes, no string) bool {
+	switch field {
+	case yes:
+		return true
+	case no, "":
+		return false
+	default:
+		if p.err == nil {
+			p.err = fmt.Errorf("%s %q is not %s or %s", name, field, yes, no)
+		}
+		return false
+	}
+}
+
+// fail returns the error describing the first failure.
+func (p *parser) fail(recordType, name string) error {
+	em := fmt.Sprintf("%s record %s - %v", recordType, name, p.err)
+	return errors.New(em)
+}
+
+// String returns the STR record.
+func (stream *Stream) String() string {
+	return fmt.Sprintf("STR;%s;%s;%s;%s;%d;%s;%s;%s;%.2f;%.2f;%s;%d;%s;%s;%s;%s;%d;%s",
+		stream.Mountpoint, stream.Identifier, stream.Format, stream.FormatDetails,
+		stream.Carrier, stream.NavSystem, stream.Network, stream.Country,
+		stream.Latitude, stream.Longitude, flag(stream.NMEA, "1", "0"),
+		stream.Solution, stream.Generator, stream.Compression,
+		stream.Authentication, flag(stream.Fee, "Y", "N"), stream.Bitrate,
+		stream.Misc)
+}
+
+// String returns the CAS record.
+func (caster *Caster) String() string {
+	return fmt.Sprintf("CAS;%s;%d;%s;%s;%s;%s;%.2f;%.2f;%s;%d;%s",
+		caster.Host, caster.Port, caster.Identifier, caster.Operator,
+		flag(caster.NMEA, "1", "0"), caster.Country,
+		caster.Latitude, caster.Longitude,
+		caster.FallbackHost, caster.FallbackPort, caster.Misc)
+}
+
+// String returns the NET record.
+func (network *Network) String() string {
+	return fmt.Sprintf("NET;%s;%s;%s;%s;%s;%s;%s;%s",
+		network.Identifier, network.Operator, network.Authentication,
+		flag(network.Fee, "Y", "N"),
+		network.WebNet, network.WebStream, network.WebRegister, network.Misc)
+}
+
+// String returns the sourcetable - the casters, the networks and the
+// streams, each line ending in CR LF, and the ENDSOURCETABLE line.
+func (table *Table) String() string {
+	var builder strings.Builder
+	for i := range table.Casters {
+		builder.WriteString(table.Casters[i].String() + "\r\n")
+	}
+	for i := range table.Networks {
+		builder.WriteString(table.Networks[i].String() + "\r\n")
+	}
+	for i := range table.Streams {
+		builder.WriteString(table.Streams[i].String() + "\r\n")
+	}
+	builder.WriteString(EndOfTable + "\r\n")
+	return builder.String()
+}
+
+// flag returns one of two values for a bool.
+func flag(value bool, yes, no string) string {
+	if value {
+		return yes
+	}
+	return no
+}
+
+// Stream returns the stream with the given mountpoint, nil if there isn't
+// one.
+func (table *Table) Stream(mountpoint string) *Stream {
+	mountpoint = strings.TrimPrefix(mountpoint, "/")
+	for i := range table.Streams {
+		if table.Streams[i].Mountpoint == mountpoint {
+			return &table.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Nearest returns the stream nearest to the given position in degrees,
+// north and east positive.  Network solutions, which make up a station near
+// the client, are as near as it gets.  A stream at exactly 0, 0 is taken to
+// have no position and is ignored.  It returns nil if no stream has a
+// position.
+func (table *Table) Nearest(latitude, longitude float64) *Stream {
+	var nearest *Stream
+	nearestDistance := math.Inf(1)
+	for i := range table.Streams {
+		stream := &table.Streams[i]
+		if stream.Latitude == 0 && stream.Longitude == 0 {
+			continue
+		}
+		distance := Distance(latitude, longitude, stream.Latitude, stream.Longitude)
+		if distance < nearestDistance {
+			nearest = stream
+			nearestDistance = distance
+		}
+	}
+	return nearest
+}
+
+// Distance returns the distance in metres along the surface of the Earth
+// between two positions given in degrees.  It takes the Earth to be a
+// sphere, which is close enough for choosing a base station.
+func Distance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	phi1 := latitude1 * math.Pi / 180
+	phi2 := latitude2 * math.Pi / 180
+	deltaPhi := phi2 - phi1
+	deltaLambda := (longitude2 - longitude1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * earthRadiusMetres * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Fetch connects to the caster, given as host:port, and gets its
+// sourcetable.  The user and password may be empty.
+func Fetch(caster, user, password string) (*Table, error) {
+	conn, dialError := net.DialTimeout("tcp", caster, dialTimeout)
+	if dialError != nil {
+		return nil, dialError
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(responseTimeout))
+
+	return Request(conn, user, password)
+}
+
+// Request asks for the sourcetable on a connection to a caster and reads
+// it.  The user and password may be empty.
+func Request(conn io.ReadWriter, user, password string) (*Table, error) {
+	request := fmt.Sprintf("GET / HTTP/1.0\r\nUser-Agent: %s\r\n", userAgent)
+	if len(user) > 0 || len(password) > 0 {
+		credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+		request += "Authorization: Basic " + credentials + "\r\n"
+	}
+	request += "\r\n"
+
+	_, writeError := conn.Write([]byte(request))
+	if writeError != nil {
+		return nil, writeError
+	}
+
+	reader := bufio.NewReader(conn)
+	status, readError := reader.ReadString('\n')
+	if readError != nil {
+		return nil, readError
+	}
+	status = strings.TrimSpace(status)
+	if status != "SOURCETABLE 200 OK" &&
+		!(strings.HasPrefix(status, "HTTP/1.") && strings.Contains(status, " 200 ")) {
+
+		em := fmt.Sprintf("caster refused the request - %s", status)
+		return nil, errors.New(em)
+	}
+
+	// Skip the headers.
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == "\r\n" || line == "\n" {
+			break
+		}
+	}
+
+	return Parse(reader)
+}
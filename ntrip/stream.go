@@ -0,0 +1,242 @@
+package ntrip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Most casters send the RTCM stream straight after the response, but some
+// frame it.  An NTRIP version 2 caster, and some version 1 casters that
+// answer with an HTTP status line, send it in HTTP chunks, each preceded by
+// its size in hex and possibly a chunk extension.  Casters built on
+// Shoutcast-style servers may interleave ICY metadata blocks:  if the
+// response has an "icy-metaint: N" header, a block follows every N bytes of
+// data, a length byte giving the size of the block in units of 16 bytes
+// followed by that many bytes of text.  Left in, either sort of framing
+// breaks the RTCM frames that it lands in, so the client strips it.
+
+// maxHeaderLength is the longest header line that the client will look for
+// after an "ICY 200 OK".
+const maxHeaderLength = 256
+
+// metadataBlockUnit is the unit of the length byte of an ICY metadata block.
+const metadataBlockUnit = 16
+
+// streamFormat describes the framing of the data after the response.
+type streamFormat struct {
+	// chunked is true if the data is sent in HTTP chunks.
+	chunked bool
+
+	// metaInterval is the number of bytes of data between ICY metadata
+	// blocks, 0 if there are none.
+	metaInterval int
+}
+
+// header records a header line of the response in the format.
+func (format *streamFormat) header(line string) error {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return nil
+	}
+	name := strings.ToLower(strings.TrimSpace(line[:colon]))
+	value := strings.TrimSpace(line[colon+1:])
+
+	switch name {
+	case "transfer-encoding":
+		format.chunked = strings.Contains(strings.ToLower(value), "chunked")
+	case "icy-metaint":
+		interval, err := strconv.Atoi(value)
+		if err != nil || interval < 0 {
+			em := fmt.Sprintf("ntrip - illegal icy-metaint header %q", value)
+			return errors.New(em)
+		}
+		format.metaInterval = interval
+	}
+	return nil
+}
+
+// reader returns a reader that gives the data without the framing.  If the
+// data is not framed, it's the given reader.
+func (format streamFormat) reader(reader *bufio.Reader) *bufio.Reader {
+	if !format.chunked && format.metaInterval == 0 {
+		return reader
+	}
+
+	if format.chunked {
+		reader = bufio.NewReader(&chunkedReader{reader: reader})
+	}
+	if format.metaInterval > 0 {
+		reader = bufio.NewReader(&metadataReader{
+			reader:        reader,
+			interval:      format.metaInterval,
+			untilMetadata: format.metaInterval,
+		})
+	}
+	return reader
+}
+
+// readHeaders reads the header lines of the response up to the empty line
+// after them, and returns the format that they describe.
+func readHeaders(reader *bufio.Reader) (streamFormat, error) {
+	var format streamFormat
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return format, err
+		}
+		if strings.TrimSpace(line) == "" {
+			return format, nil
+		}
+		if err := format.header(line); err != nil {
+			return format, err
+		}
+	}
+}
+
+// hasHeaders returns true if the data after an "ICY 200 OK" starts with a
+// header line.  Most casters send the data straight after the status line,
+// but some send headers such as icy-metaint first.  RTCM data starts with
+// 0xd3 and NMEA with "$", so only a line that starts with a letter is
+// looked at.  A caster that makes up a virtual reference station sends
+// nothing until it gets the rover's position, so waiting for more data
+// would hang.  Only the data that arrived with the status line is looked
+// at - headers are sent along with it.
+func hasHeaders(reader *bufio.Reader) bool {
+	limit := reader.Buffered()
+	if limit > maxHeaderLength {
+		limit = maxHeaderLength
+	}
+	for n := 1; n <= limit; n++ {
+		b, err := reader.Peek(n)
+		if err != nil {
+			return false
+		}
+		c := b[n-1]
+		switch {
+		case c == ':':
+			return n > 1
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case n > 1 && (c >= '0' && c <= '9' || c == '-' || c == '_'):
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// chunkedReader reads data sent in HTTP chunks and gives the data without
+// the chunk sizes.  It's tolerant:  it ignores chunk extensions, bare line
+// feeds and blank lines between chunks.
+type chunkedReader struct {
+	reader *bufio.Reader
+
+	// remaining is the number of bytes left in the current chunk.
+	remaining int64
+
+	// done is set when the last chunk has been read.
+	done bool
+}
+
+// Read reads data from the chunks.
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		size, err := c.readSize()
+		if err != nil {
+			return 0, err
+		}
+		if size == 0 {
+			// The last chunk.  Any trailer lines are not wanted.
+			c.done = true
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	c.remaining -= int64(n)
+	if err == io.EOF && c.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readSize reads the line that starts a chunk and returns the size of the
+// chunk.
+func (c *chunkedReader) readSize() (int64, error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && len(line) == 0 {
+				return 0, io.EOF
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if semicolon := strings.IndexByte(line, ';'); semicolon >= 0 {
+			// Drop the chunk extension.
+			line = line[:semicolon]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			// The end of the previous chunk.
+			continue
+		}
+
+		size, parseError := strconv.ParseInt(line, 16, 64)
+		if parseError != nil || size < 0 {
+			em := fmt.Sprintf("ntrip - illegal chunk size %q", line)
+			return 0, errors.New(em)
+		}
+		return size, nil
+	}
+}
+
+// metadataReader reads data interleaved with ICY metadata blocks and gives
+// the data without the blocks.
+type metadataReader struct {
+	reader *bufio.Reader
+
+	// interval is the number of bytes of data between blocks.
+	interval int
+
+	// untilMetadata is the number of bytes of data before the next block.
+	untilMetadata int
+}
+
+// Read reads data, skipping the metadata blocks.
+func (m *metadataReader) Read(p []byte) (int, error) {
+	if m.untilMetadata == 0 {
+		length, err := m.reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		blockLength := int64(length) * metadataBlockUnit
+		skipped, err := io.CopyN(io.Discard, m.reader, blockLength)
+		if err != nil {
+			if err == io.EOF && skipped < blockLength {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		m.untilMetadata = m.interval
+	}
+
+	if len(p) > m.untilMetadata {
+		p = p[:m.untilMetadata]
+	}
+	n, err := m.reader.Read(p)
+	m.untilMetadata -= n
+	return n, err
+}
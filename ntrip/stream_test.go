@@ -0,0 +1,262 @@
+package ntrip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// chunk is a helper function.  It returns the data as an HTTP chunk with
+// the given text between the size and the CRLF, for example a chunk
+// extension.
+func chunk(data []byte, extra string) []byte {
+	result := []byte(fmt.Sprintf("%x%s\r\n", len(data), extra))
+	result = append(result, data...)
+	return append(result, '\r', '\n')
+}
+
+// interleave is a helper function.  It returns the data with an ICY
+// metadata block after every interval bytes.
+func interleave(data []byte, interval int, metadata string) []byte {
+	block := []byte(metadata)
+	for len(block)%metadataBlockUnit != 0 {
+		block = append(block, 0)
+	}
+
+	var result []byte
+	for len(data) > interval {
+		result = append(result, data[:interval]...)
+		result = append(result, byte(len(block)/metadataBlockUnit))
+		result = append(result, block...)
+		data = data[interval:]
+		// Servers send an empty block when the metadata hasn't changed.
+		block = nil
+	}
+	return append(result, data...)
+}
+
+// TestChunkedReader checks that the chunk framing is stripped out.
+func TestChunkedReader(t *testing.T) {
+	frames := append(append([]byte{}, testdata.MessageFrameType1005...), testdata.MessageFrameType1077...)
+
+	var testData = []struct {
+		description string
+		input       []byte
+		want        []byte
+		wantError   error
+	}{
+		{
+			"one chunk",
+			append(chunk(frames, ""), "0\r\n\r\n"...),
+			frames, io.EOF,
+		},
+		{
+			"frame split across chunks",
+			bytes.Join([][]byte{
+				chunk(frames[:10], ""),
+				chunk(frames[10:100], ""),
+				chunk(frames[100:], ""),
+				[]byte("0\r\n\r\n"),
+			}, nil),
+			frames, io.EOF,
+		},
+		{
+			"chunk extensions and a trailer",
+			bytes.Join([][]byte{
+				chunk(frames[:50], ";name=value"),
+				chunk(frames[50:], "; stream=MYBASE"),
+				[]byte("0;end\r\nX-Trailer: junk\r\n\r\n"),
+			}, nil),
+			frames, io.EOF,
+		},
+		{
+			"bare line feeds and upper case",
+			[]byte(fmt.Sprintf("%X\n%s\n\n%X\n%s\n0\n\n",
+				50, frames[:50], len(frames)-50, frames[50:])),
+			frames, io.EOF,
+		},
+		{
+			"connection closed between chunks",
+			chunk(frames, ""),
+			frames, io.EOF,
+		},
+		{
+			"connection closed in a chunk",
+			append([]byte(fmt.Sprintf("%x\r\n", len(frames))), frames[:40]...),
+			frames[:40], io.ErrUnexpectedEOF,
+		},
+		{
+			"bad size",
+			[]byte("junk\r\n"),
+			nil, fmt.Errorf("ntrip - illegal chunk size %q", "junk"),
+		},
+	}
+
+	for _, td := range testData {
+		reader := &chunkedReader{reader: bufio.NewReader(bytes.NewReader(td.input))}
+		got, err := readAll(reader)
+		if !bytes.Equal(td.want, got) {
+			t.Errorf("%s: want %d bytes got %d", td.description, len(td.want), len(got))
+		}
+		if err == nil || err.Error() != td.wantError.Error() {
+			t.Errorf("%s: want error %v got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestMetadataReader checks that ICY metadata blocks are stripped out.
+func TestMetadataReader(t *testing.T) {
+	frames := append(append([]byte{}, testdata.MessageFrameType1005...), testdata.MessageFrameType1077...)
+
+	var testData = []struct {
+		description string
+		interval    int
+		input       []byte
+		want        []byte
+		wantError   error
+	}{
+		{
+			"short interval",
+			8, interleave(frames, 8, "StreamTitle='MYBASE';"),
+			frames, io.EOF,
+		},
+		{
+			"long interval",
+			100, interleave(frames, 100, ""),
+			frames, io.EOF,
+		},
+		{
+			"connection closed in a block",
+			8, append(append([]byte{}, frames[:8]...), 2, 'S', 't'),
+			frames[:8], io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, td := range testData {
+		reader := &metadataReader{
+			reader:        bufio.NewReader(bytes.NewReader(td.input)),
+			interval:      td.interval,
+			untilMetadata: td.interval,
+		}
+		got, err := readAll(reader)
+		if !bytes.Equal(td.want, got) {
+			t.Errorf("%s: want %d bytes got %d", td.description, len(td.want), len(got))
+		}
+		if err != td.wantError {
+			t.Errorf("%s: want error %v got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestReadResponse checks that readResponse finds the framing of the data.
+func TestReadResponse(t *testing.T) {
+	var testData = []struct {
+		description string
+		response    string
+		want        streamFormat
+		wantError   string
+	}{
+		{"version 1", "ICY 200 OK\r\n\xd3\x00", streamFormat{}, ""},
+		{"version 1 with junk", "ICY 200 OK\r\njunk\xd3\x00", streamFormat{}, ""},
+		{"version 1 with NMEA", "ICY 200 OK\r\n$GPGGA,1*00\r\n", streamFormat{}, ""},
+		{
+			"version 1 with metadata",
+			"ICY 200 OK\r\nicy-name: MYBASE\r\nicy-metaint: 8192\r\n\r\n\xd3",
+			streamFormat{metaInterval: 8192}, "",
+		},
+		{
+			"version 2",
+			"HTTP/1.1 200 OK\r\nNtrip-Version: Ntrip/2.0\r\nTransfer-Encoding: chunked\r\n\r\n",
+			streamFormat{chunked: true}, "",
+		},
+		{
+			"HTTP with metadata",
+			"HTTP/1.0 200 OK\r\ntransfer-encoding: Chunked\r\nICY-MetaInt: 16\r\n\r\n",
+			streamFormat{chunked: true, metaInterval: 16}, "",
+		},
+		{
+			"HTTP without framing",
+			"HTTP/1.1 200 OK\r\nContent-Type: gnss/data\r\n\r\n",
+			streamFormat{}, "",
+		},
+		{
+			"bad metaint",
+			"HTTP/1.1 200 OK\r\nicy-metaint: lots\r\n\r\n",
+			streamFormat{}, `ntrip - illegal icy-metaint header "lots"`,
+		},
+	}
+
+	for _, td := range testData {
+		got, err := readResponse(bufio.NewReader(strings.NewReader(td.response)))
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if got != td.want {
+			t.Errorf("%s: want %+v got %+v", td.description, td.want, got)
+		}
+	}
+}
+
+// TestRunWithFramedStream checks that the client passes on the RTCM
+// messages from a stream sent in chunks with metadata blocks.
+func TestRunWithFramedStream(t *testing.T) {
+	var frames []byte
+	frames = append(frames, testdata.MessageFrameType1005...)
+	frames = append(frames, testdata.MessageFrameType1077...)
+	frames = append(frames, testdata.MessageFrameType1005...)
+
+	body := interleave(frames, 64, "StreamTitle='MYBASE';")
+	var data []byte
+	for len(body) > 100 {
+		data = append(data, chunk(body[:100], ";seq=1")...)
+		body = body[100:]
+	}
+	data = append(data, chunk(body, "")...)
+	data = append(data, "0\r\n\r\n"...)
+
+	const response = "HTTP/1.1 200 OK\r\n" +
+		"Ntrip-Version: Ntrip/2.0\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"icy-metaint: 64\r\n" +
+		"\r\n"
+
+	config := Config{Caster: "caster.example.com:2101", Mountpoint: "MYBASE"}
+	client, received := newTestClient(t, config, response, data)
+
+	var output bytes.Buffer
+	err := client.Run(&output)
+	if err == nil || err.Error() != "caster closed the connection" {
+		t.Errorf("want error caster closed the connection got %v", err)
+	}
+	<-received
+
+	if !bytes.Equal(frames, output.Bytes()) {
+		t.Errorf("want %d bytes got %d", len(frames), output.Len())
+	}
+}
+
+// readAll is a helper function.  It reads until there is an error and
+// returns the data and the error.
+func readAll(reader io.Reader) ([]byte, error) {
+	var result []byte
+	buffer := make([]byte, 7)
+	for {
+		n, err := reader.Read(buffer)
+		result = append(result, buffer[:n]...)
+		if err != nil {
+			return result, err
+		}
+	}
+}
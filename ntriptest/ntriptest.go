@@ -0,0 +1,344 @@
+// The ntriptest package provides an in-memory NTRIP caster for testing code
+// that sends data to a caster or fetches data from one, without opening any
+// sockets.  Each connection is one end of a net.Pipe, so deadlines work as
+// they do on a TCP connection.
+//
+//	caster := ntriptest.NewCaster("secret")
+//	defer caster.Close()
+//
+//	rover, err := ntriptest.Get(caster.Dial, "MYBASE")
+//	...
+//	server, err := caster.Dial()
+//	// Log in with "SOURCE secret /MYBASE" and send RTCM data.
+//	...
+//	received := caster.Received("MYBASE")
+//
+// The caster speaks NTRIP version 1.  A server logs in with a SOURCE request
+// carrying the password and the mountpoint and a client (a rover) asks for a
+// mountpoint with a GET request.  In both cases the caster replies
+// "ICY 200 OK" and after that the data from the server on a mountpoint is
+// copied to every client connected to it.  Data that arrives before a client
+// connects is not copied to it, but it's kept and Received returns it all.
+//
+// Clients must keep reading.  As with net.Pipe, writes are not buffered, so a
+// client that stops reading holds up the server.  That's useful for testing
+// what happens when a connection stalls.
+package ntriptest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// OK is the caster's reply to a successful request.
+const OK = "ICY 200 OK\r\n"
+
+// BadPassword is the caster's reply to a SOURCE request with the wrong
+// password.
+const BadPassword = "ERROR - Bad Password\r\n"
+
+// BadMountpoint is the caster's reply to a GET request for a mountpoint
+// that no server has logged in to.
+const BadMountpoint = "ERROR - Bad Mountpoint\r\n"
+
+// BadRequest is the caster's reply to a request that it doesn't understand.
+const BadRequest = "HTTP/1.0 400 Bad Request\r\n"
+
+// client is a client reading a mountpoint.
+type client struct {
+	// conn is the caster's end of the connection.
+	conn net.Conn
+
+	// queue carries the data to be written to the client.  It's not
+	// buffered, so a client that stops reading holds up the server.
+	queue chan []byte
+
+	// done is closed when the client has gone.
+	done chan struct{}
+}
+
+// mount holds the state of one mountpoint.
+type mount struct {
+	// received is all the data that servers have sent to the mountpoint.
+	received []byte
+
+	// clients are the clients reading the mountpoint.
+	clients []*client
+}
+
+// Caster is an in-memory NTRIP caster.  It's safe for concurrent use.
+type Caster struct {
+	// password is the password that servers must give.
+	password string
+
+	// mounts holds the mountpoints that servers have logged in to, by name.
+	mounts map[string]*mount
+
+	// conns holds the caster's end of every open connection.
+	conns map[net.Conn]bool
+
+	// closed is true when the caster has been closed.
+	closed bool
+
+	// The mutex controls access to all the fields.
+	mutex sync.Mutex
+}
+
+// NewCaster creates a Caster that accepts servers giving the password.
+func NewCaster(password string) *Caster {
+	return &Caster{
+		password: password,
+		mounts:   make(map[string]*mount),
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// Dial returns a new connection to the caster.  It has the same signature
+// as a function that connects to a real caster, so it can be passed in its
+// place.
+func (caster *Caster) Dial() (net.Conn, error) {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	if caster.closed {
+		return nil, errors.New("caster is closed")
+	}
+
+	client, server := net.Pipe()
+	caster.conns[server] = true
+	go caster.serve(server)
+
+	return client, nil
+}
+
+// Received returns a copy of all the data sent to the mountpoint.
+func (caster *Caster) Received(mountpoint string) []byte {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	m, found := caster.mounts[strings.TrimPrefix(mountpoint, "/")]
+	if !found {
+		return nil
+	}
+
+	received := make([]byte, len(m.received))
+	copy(received, m.received)
+	return received
+}
+
+// Close closes all the connections.  After that Dial fails.
+func (caster *Caster) Close() {
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	caster.closed = true
+	for conn := range caster.conns {
+		conn.Close()
+	}
+}
+
+// serve handles one connection from the caster's end.
+func (caster *Caster) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	request, readError := readRequest(reader)
+	if readError != nil {
+		caster.drop(conn)
+		return
+	}
+
+	fields := strings.Fields(request)
+	switch {
+	case len(fields) >= 3 && fields[0] == "SOURCE":
+		caster.source(conn, reader, fields[1], fields[2])
+	case len(fields) >= 2 && fields[0] == "GET":
+		caster.get(conn, fields[1])
+	default:
+		conn.Write([]byte(BadRequest))
+		caster.drop(conn)
+	}
+}
+
+// source handles a server that has sent a SOURCE request.
+func (caster *Caster) source(conn net.Conn, reader *bufio.Reader, password, mountpoint string) {
+	if password != caster.password {
+		conn.Write([]byte(BadPassword))
+		caster.drop(conn)
+		return
+	}
+
+	name := strings.TrimPrefix(mountpoint, "/")
+	caster.mutex.Lock()
+	if _, found := caster.mounts[name]; !found {
+		caster.mounts[name] = &mount{}
+	}
+	caster.mutex.Unlock()
+
+	_, writeError := conn.Write([]byte(OK))
+	if writeError != nil {
+		caster.drop(conn)
+		return
+	}
+
+	buffer := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			caster.copyToClients(name, buffer[:n])
+		}
+		if err != nil {
+			caster.drop(conn)
+			return
+		}
+	}
+}
+
+// get handles a client that has sent a GET request.
+func (caster *Caster) get(conn net.Conn, mountpoint string) {
+	name := strings.TrimPrefix(mountpoint, "/")
+
+	caster.mutex.Lock()
+	m, found := caster.mounts[name]
+	if !found {
+		caster.mutex.Unlock()
+		conn.Write([]byte(BadMountpoint))
+		caster.drop(conn)
+		return
+	}
+
+	// Register the client before replying, so that it gets all the data
+	// sent after the reply.  The reply is written first.
+	c := &client{conn: conn, queue: make(chan []byte), done: make(chan struct{})}
+	m.clients = append(m.clients, c)
+	caster.mutex.Unlock()
+
+	defer close(c.done)
+	defer caster.drop(conn)
+
+	_, writeError := conn.Write([]byte(OK))
+	if writeError != nil {
+		return
+	}
+
+	for data := range c.queue {
+		_, writeError := conn.Write(data)
+		if writeError != nil {
+			return
+		}
+	}
+}
+
+// copyToClients records data sent to the mountpoint and passes it to the
+// clients.
+func (caster *Caster) copyToClients(name string, data []byte) {
+	caster.mutex.Lock()
+	m := caster.mounts[name]
+	m.received = append(m.received, data...)
+	clients := make([]*client, len(m.clients))
+	copy(clients, m.clients)
+	caster.mutex.Unlock()
+
+	// The clients share the buffer, so give each a copy.  Pass the data
+	// without holding the mutex, since it waits for the client to read.
+	for _, c := range clients {
+		dataCopy := make([]byte, len(data))
+		copy(dataCopy, data)
+		select {
+		case c.queue <- dataCopy:
+		case <-c.done:
+		}
+	}
+}
+
+// drop closes the caster's end of a connection and forgets it.
+func (caster *Caster) drop(conn net.Conn) {
+	conn.Close()
+
+	caster.mutex.Lock()
+	defer caster.mutex.Unlock()
+
+	delete(caster.conns, conn)
+	for _, m := range caster.mounts {
+		for i, c := range m.clients {
+			if c.conn == conn {
+				m.clients = append(m.clients[:i], m.clients[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// readRequest reads the lines of a request up to the empty line that ends
+// it and returns the first line.
+func readRequest(reader *bufio.Reader) (string, error) {
+	first := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == "\r\n" || line == "\n" {
+			return first, nil
+		}
+		if len(first) == 0 {
+			first = strings.TrimSpace(line)
+		}
+	}
+}
+
+// Get connects using the dial function and asks for the mountpoint as an
+// NTRIP version 1 client would.  If the caster accepts, it returns the
+// connection, from which the data can be read.  The dial function can be
+// the Dial method of a Caster or one that connects to a real caster.
+func Get(dial func() (net.Conn, error), mountpoint string) (net.Conn, error) {
+	conn, dialError := dial()
+	if dialError != nil {
+		return nil, dialError
+	}
+
+	request := fmt.Sprintf("GET /%s HTTP/1.0\r\nUser-Agent: NTRIP go-ntrip-ntriptest\r\n\r\n",
+		strings.TrimPrefix(mountpoint, "/"))
+	_, writeError := conn.Write([]byte(request))
+	if writeError != nil {
+		conn.Close()
+		return nil, writeError
+	}
+
+	// Read the response a byte at a time so that none of the data that
+	// follows it is lost.
+	response, readError := readLine(conn)
+	if readError != nil {
+		conn.Close()
+		return nil, readError
+	}
+
+	if response != strings.TrimSpace(OK) {
+		conn.Close()
+		em := fmt.Sprintf("caster refused the request - %s", response)
+		return nil, errors.New(em)
+	}
+
+	return conn, nil
+}
+
+// readLine reads one line from the reader without reading ahead and returns
+// it without the line ending.
+func readLine(reader io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		_, err := reader.Read(b)
+		if err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSpace(string(line)), nil
+		}
+		line = append(line, b[0])
+	}
+}
@@ -0,0 +1,160 @@
+package ntriptest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// login logs in to the caster as a server and returns the connection.
+func login(t *testing.T, caster *Caster, password, mountpoint string) (net.Conn, string) {
+	t.Helper()
+
+	conn, dialError := caster.Dial()
+	if dialError != nil {
+		t.Fatal(dialError)
+	}
+
+	_, writeError := conn.Write([]byte("SOURCE " + password + " /" + mountpoint + "\r\nSource-Agent: test\r\n\r\n"))
+	if writeError != nil {
+		t.Fatal(writeError)
+	}
+
+	response, readError := bufio.NewReader(conn).ReadString('\n')
+	if readError != nil {
+		t.Fatal(readError)
+	}
+
+	return conn, response
+}
+
+// TestRelay checks that the data from a server is copied to a client and
+// recorded.
+func TestRelay(t *testing.T) {
+	caster := NewCaster("secret")
+	defer caster.Close()
+
+	server, response := login(t, caster, "secret", "MYBASE")
+	defer server.Close()
+	if response != OK {
+		t.Fatalf("want %q got %q", OK, response)
+	}
+
+	rover, getError := Get(caster.Dial, "/MYBASE")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	defer rover.Close()
+
+	want := []byte{0xd3, 0x00, 0x01, 0x02}
+	got := make([]byte, len(want))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(rover, got)
+		done <- err
+	}()
+
+	_, writeError := server.Write(want)
+	if writeError != nil {
+		t.Fatal(writeError)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	// The caster reads the data before it's copied, so it's recorded by now.
+	received := caster.Received("MYBASE")
+	if !bytes.Equal(want, received) {
+		t.Errorf("want received %v got %v", want, received)
+	}
+}
+
+// TestRefusals checks the caster's replies to requests that it refuses.
+func TestRefusals(t *testing.T) {
+	caster := NewCaster("secret")
+	defer caster.Close()
+
+	_, response := login(t, caster, "wrong", "MYBASE")
+	if response != BadPassword {
+		t.Errorf("want %q got %q", BadPassword, response)
+	}
+
+	const wantError = "caster refused the request - ERROR - Bad Mountpoint"
+	_, getError := Get(caster.Dial, "NOSUCH")
+	if getError == nil {
+		t.Error("want an error")
+	} else if getError.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, getError.Error())
+	}
+
+	conn, _ := caster.Dial()
+	defer conn.Close()
+	conn.Write([]byte("HELLO\r\n\r\n"))
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	if reply != BadRequest {
+		t.Errorf("want %q got %q", BadRequest, reply)
+	}
+
+	if caster.Received("NOSUCH") != nil {
+		t.Error("want nothing received")
+	}
+}
+
+// TestStall checks that a client that stops reading holds up the server, so
+// that a write deadline expires.
+func TestStall(t *testing.T) {
+	caster := NewCaster("secret")
+	defer caster.Close()
+
+	server, _ := login(t, caster, "secret", "MYBASE")
+	defer server.Close()
+
+	rover, getError := Get(caster.Dial, "MYBASE")
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	defer rover.Close()
+
+	// The caster holds a little data on the way to the client, so the
+	// server can write a few times before it's held up.
+	server.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	var writeError error
+	for i := 0; i < 10 && writeError == nil; i++ {
+		_, writeError = server.Write([]byte{byte(i)})
+	}
+	if writeError == nil {
+		t.Fatal("want a timeout")
+	}
+	netError, ok := writeError.(net.Error)
+	if !ok || !netError.Timeout() {
+		t.Errorf("want a timeout got %v", writeError)
+	}
+}
+
+// TestClose checks that closing the caster drops the connections and stops
+// new ones.
+func TestClose(t *testing.T) {
+	caster := NewCaster("secret")
+
+	server, _ := login(t, caster, "secret", "MYBASE")
+	defer server.Close()
+
+	caster.Close()
+
+	_, readError := server.Read(make([]byte, 1))
+	if readError == nil {
+		t.Error("want the connection closed")
+	}
+
+	_, dialError := caster.Dial()
+	if dialError == nil {
+		t.Error("want an error from Dial")
+	}
+}
@@ -0,0 +1,208 @@
+// The queue package decouples the goroutine that produces RTCM messages from
+// one that consumes them, so that a slow consumer, for example a log on a
+// slow SD card or a stalled stdout, doesn't hold up the decoding and
+// eventually the reading of the serial line, losing the input.
+//
+// A Queue holds up to a fixed number of messages.  What happens when it's
+// full depends on its policy:
+//
+//	block        the producer waits for room, so nothing is lost but the
+//	             producer is held up.  This is right for the output to the
+//	             caster, where every message matters.
+//	drop_oldest  the oldest message in the queue is dropped to make room,
+//	             so the producer never waits.  This is right for the
+//	             readable display, where recent messages matter most.
+//
+// The messages dropped are counted:
+//
+//	q, err := queue.New(queue.Config{Size: 1000}, queue.DropOldest)
+//	...
+//	go writeReadableMessages(q.Out(), writer)
+//	q.In() <- message  // Doesn't wait if the writer is behind.
+//	...
+//	close(q.In())      // Out is closed once the queue is empty.
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// DefaultSize is the number of messages held by a queue whose config
+// doesn't give a size.  A base station typically sends a few tens of
+// messages per second, so it's several seconds' worth.
+const DefaultSize = 256
+
+// Policy says what a Queue does when it's full.
+type Policy int
+
+const (
+	// Block makes the producer wait for room.
+	Block Policy = iota
+
+	// DropOldest drops the oldest message to make room.
+	DropOldest
+)
+
+// policyNames gives the name of each policy, as it appears in the config.
+var policyNames = map[Policy]string{
+	Block:      "block",
+	DropOldest: "drop_oldest",
+}
+
+// String returns the name of the policy, for example "drop_oldest".
+func (policy Policy) String() string {
+	name, ok := policyNames[policy]
+	if !ok {
+		return fmt.Sprintf("policy %d", int(policy))
+	}
+	return name
+}
+
+// ParsePolicy returns the policy with the given name.
+func ParsePolicy(name string) (Policy, error) {
+	for policy, policyName := range policyNames {
+		if name == policyName {
+			return policy, nil
+		}
+	}
+	em := fmt.Sprintf("queue - unknown policy %q, want block or drop_oldest", name)
+	return Block, errors.New(em)
+}
+
+// Config is the config of a Queue, as it appears in an application's JSON
+// config file.
+type Config struct {
+	// Size is the number of messages that the queue holds.  0 means
+	// DefaultSize.
+	Size int `json:"size"`
+
+	// Policy is "block" or "drop_oldest".  Empty means the default given
+	// by the application.
+	Policy string `json:"policy"`
+}
+
+// Validate checks the config.
+func (config *Config) Validate() error {
+	if config.Size < 0 {
+		em := fmt.Sprintf("queue - the size %d is negative", config.Size)
+		return errors.New(em)
+	}
+	if len(config.Policy) > 0 {
+		if _, policyError := ParsePolicy(config.Policy); policyError != nil {
+			return policyError
+		}
+	}
+	return nil
+}
+
+// Queue holds messages on their way from a producer to a consumer.  It's
+// safe for concurrent use.
+type Queue struct {
+	// dropped is first so that it's correctly aligned for atomic access on
+	// 32-bit platforms such as the Raspberry Pi.
+	dropped uint64
+
+	// policy is what happens when the queue is full.
+	policy Policy
+
+	// in receives the messages from the producer.
+	in chan rtcm.Message
+
+	// out holds the queued messages for the consumer.
+	out chan rtcm.Message
+}
+
+// New creates a Queue from the config and starts it.  The policy is used if
+// the config doesn't give one.
+func New(config Config, defaultPolicy Policy) (*Queue, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	size := config.Size
+	if size == 0 {
+		size = DefaultSize
+	}
+
+	policy := defaultPolicy
+	if len(config.Policy) > 0 {
+		policy, _ = ParsePolicy(config.Policy)
+	}
+
+	queue := Queue{
+		policy: policy,
+		in:     make(chan rtcm.Message),
+		out:    make(chan rtcm.Message, size),
+	}
+
+	go queue.run()
+
+	return &queue, nil
+}
+
+// In returns the channel to which the producer sends the messages.  The
+// producer closes it when it's finished.
+func (queue *Queue) In() chan rtcm.Message {
+	return queue.in
+}
+
+// Out returns the channel from which the consumer takes the messages.  It's
+// closed when In has been closed and the queue is empty.
+func (queue *Queue) Out() chan rtcm.Message {
+	return queue.out
+}
+
+// Policy returns the queue's policy.
+func (queue *Queue) Policy() Policy {
+	return queue.policy
+}
+
+// Len returns the number of messages waiting in the queue.
+func (queue *Queue) Len() int {
+	return len(queue.out)
+}
+
+// Cap returns the number of messages that the queue holds when it's full.
+func (queue *Queue) Cap() int {
+	return cap(queue.out)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (queue *Queue) Dropped() uint64 {
+	return atomic.LoadUint64(&queue.dropped)
+}
+
+// run moves the messages from in to out until in is closed.
+func (queue *Queue) run() {
+	for message := range queue.in {
+		queue.put(message)
+	}
+	close(queue.out)
+}
+
+// put adds a message to the queue, applying the policy if it's full.
+func (queue *Queue) put(message rtcm.Message) {
+	if queue.policy == Block {
+		queue.out <- message
+		return
+	}
+
+	for {
+		select {
+		case queue.out <- message:
+			return
+		default:
+		}
+
+		// The queue is full.  Drop the oldest message, unless the consumer
+		// has just taken it.
+		select {
+		case <-queue.out:
+			atomic.AddUint64(&queue.dropped, 1)
+		default:
+		}
+	}
+}
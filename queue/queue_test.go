@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+)
+
+// TestNew checks that New applies the defaults and rejects a bad config.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantSize    int
+		wantPolicy  Policy
+		wantError   string
+	}{
+		{"defaults", Config{}, DefaultSize, DropOldest, ""},
+		{"given", Config{Size: 10, Policy: "block"}, 10, Block, ""},
+		{"negative", Config{Size: -1}, 0, Block, "queue - the size -1 is negative"},
+		{"bad policy", Config{Policy: "drop_newest"}, 0, Block,
+			`queue - unknown policy "drop_newest", want block or drop_oldest`},
+	}
+	for _, td := range testData {
+		q, err := New(td.config, DropOldest)
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if q.Cap() != td.wantSize || q.Policy() != td.wantPolicy {
+			t.Errorf("%s: want %d %v got %d %v",
+				td.description, td.wantSize, td.wantPolicy, q.Cap(), q.Policy())
+		}
+		close(q.In())
+	}
+}
+
+// waitForLen waits for the queue to hold n messages.
+func waitForLen(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for q.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %d messages queued got %d", n, q.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// drain returns the message types left in the queue once In is closed.
+func drain(q *Queue) []int {
+	close(q.In())
+	var types []int
+	for message := range q.Out() {
+		types = append(types, message.MessageType)
+	}
+	return types
+}
+
+// TestDropOldest checks that a full queue with the drop_oldest policy
+// drops the oldest messages without holding up the producer, and counts
+// them.
+func TestDropOldest(t *testing.T) {
+	q, err := New(Config{Size: 3}, DropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing takes the messages, so the sends only complete if the queue
+	// drops the old ones.
+	for messageType := 1001; messageType <= 1005; messageType++ {
+		q.In() <- rtcm.Message{MessageType: messageType}
+	}
+	// The last message may still be on its way into the queue.
+	deadline := time.Now().Add(time.Second)
+	for q.Dropped() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if q.Dropped() != 2 {
+		t.Errorf("want 2 dropped got %d", q.Dropped())
+	}
+	want := []int{1003, 1004, 1005}
+	if got := drain(q); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestBlock checks that a full queue with the block policy holds up the
+// producer and drops nothing.
+func TestBlock(t *testing.T) {
+	q, err := New(Config{Size: 2, Policy: "block"}, DropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue holds two messages and run holds a third while it waits
+	// for room.  The fourth send waits.
+	for messageType := 1001; messageType <= 1003; messageType++ {
+		q.In() <- rtcm.Message{MessageType: messageType}
+	}
+	waitForLen(t, q, 2)
+
+	sent := make(chan struct{})
+	go func() {
+		q.In() <- rtcm.Message{MessageType: 1004}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("want the producer to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Taking a message makes room.
+	<-q.Out()
+	<-sent
+
+	if q.Dropped() != 0 {
+		t.Errorf("want none dropped got %d", q.Dropped())
+	}
+	want := []int{1002, 1003, 1004}
+	if got := drain(q); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestPolicyNames checks the names of the policies.
+func TestPolicyNames(t *testing.T) {
+	for _, policy := range []Policy{Block, DropOldest} {
+		got, err := ParsePolicy(policy.String())
+		if err != nil || got != policy {
+			t.Errorf("%s: got %v, %v", policy.String(), got, err)
+		}
+	}
+}
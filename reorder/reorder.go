@@ -0,0 +1,163 @@
+// The reorder package puts RTCM messages back into order.
+//
+// When the input arrives by UDP or by more than one TCP path, the messages
+// can be slightly out of order.  A Buffer holds each message for a short
+// window before releasing it.  While it's held, a message that arrives late
+// can overtake it.  Multiple Signal Messages (MSMs) are put into the order
+// of their timestamps.  The timestamps of different constellations are in
+// different forms, so an MSM can only overtake MSMs of its own constellation.
+// Other messages have no timestamp and stay in order of arrival.
+//
+// The window adds the same delay to every message, so it should be as small
+// as possible, typically a few hundred milliseconds.
+//
+//	in := make(chan rtcm.Message)
+//	go reorder.Run(in, 200*time.Millisecond, func(message rtcm.Message) { ... })
+package reorder
+
+import (
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// halfTimestampRange is used to spot a timestamp that has rolled over at the
+// end of the week.  The timestamps are 30 bits.  If a later timestamp is
+// smaller than an earlier one by more than half the range, it's taken to be
+// in the next week.
+const halfTimestampRange = 1 << 29
+
+// minimumTick is the shortest time between checks for messages to release.
+const minimumTick = time.Millisecond
+
+// heldMessage is a message in the buffer.
+type heldMessage struct {
+	message rtcm.Message
+	arrival time.Time
+}
+
+// Buffer holds messages for a window and releases them in order.  It's not
+// safe for concurrent use - see Run.
+type Buffer struct {
+	// Window is the time for which each message is held.
+	Window time.Duration
+
+	// held contains the messages in the order in which they will be released.
+	held []heldMessage
+}
+
+// New creates a Buffer with the given window.
+func New(window time.Duration) *Buffer {
+	buffer := Buffer{Window: window}
+	return &buffer
+}
+
+// Len returns the number of messages held.
+func (buffer *Buffer) Len() int {
+	return len(buffer.held)
+}
+
+// Add adds a message that arrived at the given time.  An MSM is placed
+// before any held MSM of the same constellation with a later timestamp.
+// Any other message is placed at the end.
+func (buffer *Buffer) Add(message rtcm.Message, arrival time.Time) {
+	position := len(buffer.held)
+
+	if utils.MSM(message.MessageType) {
+		constellation := utils.GetConstellation(message.MessageType)
+		for i := len(buffer.held) - 1; i >= 0; i-- {
+			other := &buffer.held[i].message
+			if !utils.MSM(other.MessageType) ||
+				utils.GetConstellation(other.MessageType) != constellation {
+				continue
+			}
+			if !before(message.Timestamp, other.Timestamp) {
+				break
+			}
+			position = i
+		}
+	}
+
+	buffer.held = append(buffer.held, heldMessage{})
+	copy(buffer.held[position+1:], buffer.held[position:])
+	buffer.held[position] = heldMessage{message: message, arrival: arrival}
+}
+
+// Release removes the messages that are due for release at the given time
+// and returns them in order.  A message is due when it has been held for
+// the window, and so is every message in front of it.
+func (buffer *Buffer) Release(now time.Time) []rtcm.Message {
+	last := -1
+	for i := range buffer.held {
+		if now.Sub(buffer.held[i].arrival) >= buffer.Window {
+			last = i
+		}
+	}
+
+	return buffer.take(last + 1)
+}
+
+// Flush removes all the messages and returns them in order.
+func (buffer *Buffer) Flush() []rtcm.Message {
+	return buffer.take(len(buffer.held))
+}
+
+// take removes the first n messages and returns them.
+func (buffer *Buffer) take(n int) []rtcm.Message {
+	if n == 0 {
+		return nil
+	}
+
+	messages := make([]rtcm.Message, n)
+	for i := 0; i < n; i++ {
+		messages[i] = buffer.held[i].message
+	}
+
+	remaining := len(buffer.held) - n
+	copy(buffer.held, buffer.held[n:])
+	buffer.held = buffer.held[:remaining]
+
+	return messages
+}
+
+// Run reads messages from the channel, holds them in a Buffer with the
+// given window and calls release with each message in order when it's
+// due.  When the channel is closed it releases the messages that are still
+// held and returns.  It can be run in a go routine.
+func Run(in <-chan rtcm.Message, window time.Duration, release func(rtcm.Message)) {
+	buffer := New(window)
+
+	tick := window / 4
+	if tick < minimumTick {
+		tick = minimumTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, more := <-in:
+			if !more {
+				for _, m := range buffer.Flush() {
+					release(m)
+				}
+				return
+			}
+			buffer.Add(message, time.Now())
+		case now := <-ticker.C:
+			for _, m := range buffer.Release(now) {
+				release(m)
+			}
+		}
+	}
+}
+
+// before returns true if timestamp a is before timestamp b, allowing for
+// the rollover at the end of the week.
+func before(a, b uint) bool {
+	if a < b {
+		return b-a < halfTimestampRange
+	}
+	return a-b > halfTimestampRange
+}
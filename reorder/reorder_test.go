@@ -0,0 +1,140 @@
+package reorder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// summary gives the type and timestamp of each message, for comparison.
+func summary(messages []rtcm.Message) [][2]uint {
+	result := make([][2]uint, 0, len(messages))
+	for _, m := range messages {
+		result = append(result, [2]uint{uint(m.MessageType), m.Timestamp})
+	}
+	return result
+}
+
+// TestBefore checks the comparison of timestamps.
+func TestBefore(t *testing.T) {
+	const endOfWeek = 604800000 - 1000
+
+	var testData = []struct {
+		a, b uint
+		want bool
+	}{
+		{1000, 2000, true},
+		{2000, 1000, false},
+		{1000, 1000, false},
+		{endOfWeek, 0, true},
+		{0, endOfWeek, false},
+	}
+	for _, td := range testData {
+		got := before(td.a, td.b)
+		if got != td.want {
+			t.Errorf("%d before %d: want %v got %v", td.a, td.b, td.want, got)
+		}
+	}
+}
+
+// TestAdd checks that a late MSM overtakes the held MSMs of its own
+// constellation and nothing else.
+func TestAdd(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	gps := utils.MessageTypeMSM7GPS
+	galileo := utils.MessageTypeMSM7Galileo
+
+	arrivals := []rtcm.Message{
+		{MessageType: gps, Timestamp: 2000},
+		{MessageType: 1005},
+		{MessageType: galileo, Timestamp: 5000},
+		{MessageType: gps, Timestamp: 3000},
+		// Late - overtakes the GPS messages at 2000 and 3000.
+		{MessageType: gps, Timestamp: 1000},
+		// Late - overtakes the Galileo message but not the GPS ones.
+		{MessageType: galileo, Timestamp: 4000},
+	}
+
+	want := [][2]uint{
+		{uint(gps), 1000},
+		{uint(gps), 2000},
+		{1005, 0},
+		{uint(galileo), 4000},
+		{uint(galileo), 5000},
+		{uint(gps), 3000},
+	}
+
+	buffer := New(time.Second)
+	for i, m := range arrivals {
+		buffer.Add(m, start.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	got := summary(buffer.Flush())
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	if buffer.Len() != 0 {
+		t.Errorf("want an empty buffer, got %d", buffer.Len())
+	}
+}
+
+// TestRelease checks that messages are released when they have been held
+// for the window, along with any messages in front of them.
+func TestRelease(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	window := 100 * time.Millisecond
+	gps := utils.MessageTypeMSM4GPS
+
+	buffer := New(window)
+	buffer.Add(rtcm.Message{MessageType: gps, Timestamp: 2000}, start)
+	buffer.Add(rtcm.Message{MessageType: gps, Timestamp: 1000}, start.Add(50*time.Millisecond))
+	buffer.Add(rtcm.Message{MessageType: gps, Timestamp: 3000}, start.Add(80*time.Millisecond))
+
+	if len(buffer.Release(start.Add(window-time.Millisecond))) != 0 {
+		t.Error("want nothing released before the window has passed")
+	}
+
+	// The message at 2000 is due, so the one at 1000 in front of it goes too.
+	got := summary(buffer.Release(start.Add(window)))
+	want := [][2]uint{{uint(gps), 1000}, {uint(gps), 2000}}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	got = summary(buffer.Release(start.Add(200 * time.Millisecond)))
+	want = [][2]uint{{uint(gps), 3000}}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestRun checks that Run releases all the messages in order when the
+// channel is closed.
+func TestRun(t *testing.T) {
+	gps := utils.MessageTypeMSM7GPS
+
+	in := make(chan rtcm.Message)
+	got := make([]rtcm.Message, 0)
+	done := make(chan struct{})
+
+	go func() {
+		Run(in, time.Hour, func(m rtcm.Message) { got = append(got, m) })
+		close(done)
+	}()
+
+	in <- rtcm.Message{MessageType: gps, Timestamp: 2000}
+	in <- rtcm.Message{MessageType: gps, Timestamp: 1000}
+	close(in)
+	<-done
+
+	want := [][2]uint{{uint(gps), 1000}, {uint(gps), 2000}}
+	if !cmp.Equal(want, summary(got)) {
+		t.Error(cmp.Diff(want, summary(got)))
+	}
+}
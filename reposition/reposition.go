@@ -0,0 +1,164 @@
+// The reposition package replaces the base position in messages of type
+// 1005 and 1006 with one supplied by the operator.  A receiver sends the
+// position that it was configured with, often a rough one found by averaging
+// its own fixes.  Once a precise position has been found, for example by
+// sending a day of observations to a PPP service, the outgoing messages can
+// carry it without reconfiguring the receiver's firmware.  The position is
+// given as earth-centred, earth-fixed (ECEF) coordinates in metres, as in
+// the messages themselves:
+//
+//	"station_position": {
+//	    "x": 3978364.8574,
+//	    "y": -12345.6789,
+//	    "z": 4968423.4712,
+//	    "antenna_height_metres": 0.15
+//	}
+//
+// The antenna height is optional and only affects messages of type 1006.
+// Each message is decoded, given the new position and encoded again with a
+// new CRC:
+//
+//	repositioner, err := reposition.New(config)
+//	...
+//	repositioner.Rewrite(&message)
+//
+// Every message of type 1005 and 1006 is rewritten, so the package should
+// not be used on a stream aggregated from several base stations.
+package reposition
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// scaleFactor is the unit of the coordinates and the antenna height in the
+// messages, in metres.
+const scaleFactor = 0.0001
+
+// maxAntennaHeight is the largest antenna height that fits into the 16-bit
+// field of a message type 1006, in units of scaleFactor.
+const maxAntennaHeight = 1<<16 - 1
+
+// minRadius and maxRadius are the limits in metres of the distance of the
+// position from the centre of the earth.  They catch a position given in
+// the wrong units or with a digit missing.
+const minRadius = 6300000.0
+const maxRadius = 6400000.0
+
+// Config is the operator-supplied position.
+type Config struct {
+	// X, Y and Z are the ECEF coordinates of the antenna reference point in
+	// metres.
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+
+	// AntennaHeightMetres, if set, replaces the antenna height in messages
+	// of type 1006.
+	AntennaHeightMetres *float64 `json:"antenna_height_metres"`
+}
+
+// Repositioner rewrites the base position in messages.
+type Repositioner struct {
+	// x, y and z are the coordinates in units of scaleFactor.
+	x, y, z int64
+
+	// antennaHeight is the antenna height in units of scaleFactor.  It's
+	// only used if setHeight is true.
+	antennaHeight uint
+	setHeight     bool
+}
+
+// New creates a Repositioner from the config.  It returns an error if the
+// position is not near the surface of the earth or the antenna height is
+// out of range.
+func New(config Config) (*Repositioner, error) {
+	radius := math.Sqrt(config.X*config.X + config.Y*config.Y + config.Z*config.Z)
+	if radius < minRadius || radius > maxRadius {
+		em := fmt.Sprintf("reposition - position (%.4f, %.4f, %.4f) is %.0f metres from the centre of the earth - want ECEF coordinates in metres",
+			config.X, config.Y, config.Z, radius)
+		return nil, errors.New(em)
+	}
+
+	repositioner := Repositioner{
+		x: int64(math.Round(config.X / scaleFactor)),
+		y: int64(math.Round(config.Y / scaleFactor)),
+		z: int64(math.Round(config.Z / scaleFactor)),
+	}
+
+	if config.AntennaHeightMetres != nil {
+		height := math.Round(*config.AntennaHeightMetres / scaleFactor)
+		if height < 0 || height > maxAntennaHeight {
+			em := fmt.Sprintf("reposition - antenna height %.4f metres is out of range - want 0 to %.4f",
+				*config.AntennaHeightMetres, maxAntennaHeight*scaleFactor)
+			return nil, errors.New(em)
+		}
+		repositioner.antennaHeight = uint(height)
+		repositioner.setHeight = true
+	}
+
+	return &repositioner, nil
+}
+
+// String describes the position, for example "(3978364.8574, -12345.6789,
+// 4968423.4712) metres".
+func (repositioner *Repositioner) String() string {
+	display := fmt.Sprintf("(%.4f, %.4f, %.4f) metres",
+		float64(repositioner.x)*scaleFactor,
+		float64(repositioner.y)*scaleFactor,
+		float64(repositioner.z)*scaleFactor)
+	if repositioner.setHeight {
+		display += fmt.Sprintf(", antenna height %.4f metres",
+			float64(repositioner.antennaHeight)*scaleFactor)
+	}
+	return display
+}
+
+// Rewrite replaces the position in the message if it's of type 1005 or
+// 1006, giving it a new frame.  The old frame is not changed, so a copy of
+// the message that shares it is not affected.  It returns true if the
+// message was rewritten.  A message that can't be decoded is left alone.
+func (repositioner *Repositioner) Rewrite(message *rtcm.Message) bool {
+	var frame []byte
+
+	switch message.MessageType {
+	case utils.MessageType1005:
+		m, err := type1005.GetMessage(message.RawData, slog.LevelInfo)
+		if err != nil {
+			return false
+		}
+		m.AntennaRefX = repositioner.x
+		m.AntennaRefY = repositioner.y
+		m.AntennaRefZ = repositioner.z
+		frame = m.Frame()
+
+	case utils.MessageType1006:
+		m, err := type1006.GetMessage(message.RawData, slog.LevelInfo)
+		if err != nil {
+			return false
+		}
+		m.AntennaRefX = repositioner.x
+		m.AntennaRefY = repositioner.y
+		m.AntennaRefZ = repositioner.z
+		if repositioner.setHeight {
+			m.AntennaHeight = repositioner.antennaHeight
+		}
+		frame = m.Frame()
+
+	default:
+		return false
+	}
+
+	message.RawData = frame
+	// The readable version, if any, has the old position.
+	message.Readable = nil
+
+	return true
+}
@@ -0,0 +1,170 @@
+package reposition
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/crc24q"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// height is an antenna height for the tests.
+var height = 1.5
+
+// surveyed is a position for the tests.
+var surveyed = Config{X: 3978364.8574, Y: -12345.6789, Z: 4968423.4712}
+
+// TestNew checks that New accepts a position on the surface of the earth
+// and rejects one that isn't, and checks the antenna height.
+func TestNew(t *testing.T) {
+	negative := -0.1
+	tooHigh := 6.6
+
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"surveyed", surveyed, ""},
+		{"with height", Config{X: surveyed.X, Y: surveyed.Y, Z: surveyed.Z, AntennaHeightMetres: &height}, ""},
+		{"zero", Config{},
+			"reposition - position (0.0000, 0.0000, 0.0000) is 0 metres from the centre of the earth - want ECEF coordinates in metres"},
+		{"kilometres", Config{X: 3978.3648574, Y: -12.3456789, Z: 4968.4234712},
+			"reposition - position (3978.3649, -12.3457, 4968.4235) is 6365 metres from the centre of the earth - want ECEF coordinates in metres"},
+		{"negative height", Config{X: surveyed.X, Y: surveyed.Y, Z: surveyed.Z, AntennaHeightMetres: &negative},
+			"reposition - antenna height -0.1000 metres is out of range - want 0 to 6.5535"},
+		{"height too big", Config{X: surveyed.X, Y: surveyed.Y, Z: surveyed.Z, AntennaHeightMetres: &tooHigh},
+			"reposition - antenna height 6.6000 metres is out of range - want 0 to 6.5535"},
+	}
+	for _, td := range testData {
+		_, err := New(td.config)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestString checks the description of the position.
+func TestString(t *testing.T) {
+	repositioner, err := New(Config{X: surveyed.X, Y: surveyed.Y, Z: surveyed.Z, AntennaHeightMetres: &height})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "(3978364.8574, -12345.6789, 4968423.4712) metres, antenna height 1.5000 metres"
+	if got := repositioner.String(); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+// TestRewrite1005 checks that Rewrite replaces the position in a message
+// type 1005, leaves the other fields alone, gives the frame a good CRC and
+// doesn't change the original frame.
+func TestRewrite1005(t *testing.T) {
+	repositioner, err := New(surveyed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := append([]byte{}, testdata.MessageFrameType1005...)
+	message := rtcm.NewMessage(utils.MessageType1005, "", testdata.MessageFrameType1005, slog.LevelInfo)
+	message.Readable = "old position"
+
+	if !repositioner.Rewrite(message) {
+		t.Fatal("want the message rewritten")
+	}
+
+	if !bytes.Equal(original, testdata.MessageFrameType1005) {
+		t.Error("the original frame was changed")
+	}
+	if message.Readable != nil {
+		t.Error("want the readable version cleared")
+	}
+	if crc24q.Checksum(message.RawData) != 0 {
+		t.Error("bad CRC")
+	}
+
+	want, _ := type1005.GetMessage(testdata.MessageFrameType1005, slog.LevelInfo)
+	want.AntennaRefX = 39783648574
+	want.AntennaRefY = -123456789
+	want.AntennaRefZ = 49684234712
+
+	got, err := type1005.GetMessage(message.RawData, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *want != *got {
+		t.Errorf("want %v got %v", *want, *got)
+	}
+}
+
+// TestRewrite1006 checks that Rewrite replaces the position and the
+// antenna height in a message type 1006.
+func TestRewrite1006(t *testing.T) {
+	repositioner, err := New(Config{X: surveyed.X, Y: surveyed.Y, Z: surveyed.Z, AntennaHeightMetres: &height})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := rtcm.NewMessage(utils.MessageType1006, "", testdata.MessageFrameType1006, slog.LevelInfo)
+
+	if !repositioner.Rewrite(message) {
+		t.Fatal("want the message rewritten")
+	}
+	if crc24q.Checksum(message.RawData) != 0 {
+		t.Error("bad CRC")
+	}
+
+	want, _ := type1006.GetMessage(testdata.MessageFrameType1006, slog.LevelInfo)
+	want.AntennaRefX = 39783648574
+	want.AntennaRefY = -123456789
+	want.AntennaRefZ = 49684234712
+	want.AntennaHeight = 15000
+
+	got, err := type1006.GetMessage(message.RawData, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *want != *got {
+		t.Errorf("want %v got %v", *want, *got)
+	}
+}
+
+// TestRewriteOtherMessages checks that Rewrite leaves other messages, and
+// messages that can't be decoded, alone.
+func TestRewriteOtherMessages(t *testing.T) {
+	repositioner, err := New(surveyed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = []struct {
+		description string
+		messageType int
+		frame       []byte
+	}{
+		{"MSM7", utils.MessageTypeMSM7GPS, testdata.MessageFrameType1077},
+		{"short 1005", utils.MessageType1005, testdata.MessageFrameType1005[:10]},
+		{"non-RTCM", utils.NonRTCMMessage, []byte("junk")},
+	}
+	for _, td := range testData {
+		message := rtcm.NewMessage(td.messageType, "", td.frame, slog.LevelInfo)
+		if repositioner.Rewrite(message) {
+			t.Errorf("%s: want the message left alone", td.description)
+		}
+		if !bytes.Equal(td.frame, message.RawData) {
+			t.Errorf("%s: the frame was changed", td.description)
+		}
+	}
+}
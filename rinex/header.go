@@ -0,0 +1,130 @@
+// The rinex package produces the parts of a RINEX observation file that
+// describe the base station.  A RINEX file starts with a header of fixed
+// format lines, each 60 characters of content followed by a 20-character
+// label.  PPP services reject files whose header doesn't give the marker
+// name, the antenna type and the approximate position, so the header is
+// filled in from the station description in the config and from the
+// decoded messages:
+//
+//	header := rinex.NewHeader(config.Station, rinex.PositionFrom1005(message), time.Second)
+//	fmt.Fprint(w, header.Lines())
+package rinex
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/station"
+)
+
+// scaleFactor converts the antenna reference coordinates in messages of
+// type 1005 and 1006, which are in units of 1/10,000 of a metre, to metres.
+const scaleFactor = 0.0001
+
+// Header holds the values for the station part of a RINEX header.
+type Header struct {
+	// MarkerName is the name of the station.
+	MarkerName string
+
+	// AntennaNumber is the serial number of the antenna.
+	AntennaNumber string
+
+	// AntennaType is the antenna model and radome.
+	AntennaType string
+
+	// AntennaHeight is the height of the antenna reference point above
+	// the marker in metres.
+	AntennaHeight float64
+
+	// Position is the approximate ECEF position of the marker in metres.
+	// It may be nil.
+	Position *station.Position
+
+	// Interval is the time between epochs.  Zero means unknown.
+	Interval time.Duration
+}
+
+// NewHeader creates a Header from the station description and the position
+// decoded from the messages.  Values given in the station description take
+// precedence, so a surveyed position is preferred to the one that the base
+// station reports.  Either may be nil.
+func NewHeader(config *station.Config, decoded *station.Position, interval time.Duration) *Header {
+	header := Header{Position: decoded, Interval: interval}
+
+	if config != nil {
+		header.MarkerName = config.Name
+		header.AntennaType = config.AntennaModel
+		header.AntennaHeight = config.AntennaHeightMetres
+		if config.Position != nil {
+			header.Position = config.Position
+		}
+	}
+
+	return &header
+}
+
+// PositionFrom1005 returns the position in a message of type 1005.
+func PositionFrom1005(message *type1005.Message) *station.Position {
+	if message == nil {
+		return nil
+	}
+	return &station.Position{
+		X: float64(message.AntennaRefX) * scaleFactor,
+		Y: float64(message.AntennaRefY) * scaleFactor,
+		Z: float64(message.AntennaRefZ) * scaleFactor,
+	}
+}
+
+// PositionFrom1006 returns the position in a message of type 1006.
+func PositionFrom1006(message *type1006.Message) *station.Position {
+	if message == nil {
+		return nil
+	}
+	return &station.Position{
+		X: float64(message.AntennaRefX) * scaleFactor,
+		Y: float64(message.AntennaRefY) * scaleFactor,
+		Z: float64(message.AntennaRefZ) * scaleFactor,
+	}
+}
+
+// Lines returns the header lines for the values that are known, in the
+// order that they appear in a RINEX version 3 header.
+func (header *Header) Lines() string {
+	var b strings.Builder
+
+	if len(header.MarkerName) > 0 {
+		b.WriteString(line(header.MarkerName, "MARKER NAME"))
+	}
+
+	if len(header.AntennaNumber) > 0 || len(header.AntennaType) > 0 {
+		content := fmt.Sprintf("%-20.20s%-20.20s", header.AntennaNumber, header.AntennaType)
+		b.WriteString(line(content, "ANT # / TYPE"))
+	}
+
+	if header.Position != nil {
+		content := fmt.Sprintf("%14.4f%14.4f%14.4f",
+			header.Position.X, header.Position.Y, header.Position.Z)
+		b.WriteString(line(content, "APPROX POSITION XYZ"))
+	}
+
+	// The eccentricities east and north are always zero for a base
+	// station antenna mounted over the marker.
+	content := fmt.Sprintf("%14.4f%14.4f%14.4f", header.AntennaHeight, 0.0, 0.0)
+	b.WriteString(line(content, "ANTENNA: DELTA H/E/N"))
+
+	if header.Interval > 0 {
+		content := fmt.Sprintf("%10.3f", header.Interval.Seconds())
+		b.WriteString(line(content, "INTERVAL"))
+	}
+
+	return b.String()
+}
+
+// line returns a header line with the content in columns 1-60 and the
+// label in columns 61-80.
+func line(content, label string) string {
+	return fmt.Sprintf("%-60.60s%-20s\n", content, label)
+}
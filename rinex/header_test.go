@@ -0,0 +1,102 @@
+package rinex
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/station"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestPositionFrom checks that the positions in messages of type 1005 and
+// 1006 are scaled to metres.
+func TestPositionFrom(t *testing.T) {
+	want := station.Position{X: 3977478.6123, Y: -9616.8456, Z: 4968953.4789}
+
+	m1005 := type1005.New(2, 0, 0, 39774786123, 0, -96168456, 0, 49689534789, slog.LevelInfo)
+	m1006 := type1006.New(2, 0, 0, 39774786123, 0, -96168456, 0, 49689534789, 820, slog.LevelInfo)
+
+	for _, got := range []*station.Position{PositionFrom1005(m1005), PositionFrom1006(m1006)} {
+		if got == nil {
+			t.Error("want a position")
+			continue
+		}
+		if abs(got.X-want.X) > 1e-6 || abs(got.Y-want.Y) > 1e-6 || abs(got.Z-want.Z) > 1e-6 {
+			t.Errorf("want %v got %v", want, *got)
+		}
+	}
+
+	if PositionFrom1005(nil) != nil || PositionFrom1006(nil) != nil {
+		t.Error("want nil from nil")
+	}
+}
+
+// TestNewHeader checks that the station description takes precedence over
+// the decoded position.
+func TestNewHeader(t *testing.T) {
+	surveyed := &station.Position{X: 1, Y: 2, Z: 3}
+	decoded := &station.Position{X: 4, Y: 5, Z: 6}
+
+	var testData = []struct {
+		description string
+		config      *station.Config
+		want        *station.Position
+	}{
+		{"no config", nil, decoded},
+		{"not surveyed", &station.Config{Name: "HOME"}, decoded},
+		{"surveyed", &station.Config{Name: "HOME", Position: surveyed}, surveyed},
+	}
+	for _, td := range testData {
+		header := NewHeader(td.config, decoded, time.Second)
+		if header.Position != td.want {
+			t.Errorf("%s: want %v got %v", td.description, *td.want, *header.Position)
+		}
+	}
+}
+
+// TestLines checks the formatting of the header lines.
+func TestLines(t *testing.T) {
+	config := station.Config{
+		Name:                "HOME00GBR0",
+		AntennaModel:        "TRM59800.00     SCIS",
+		AntennaHeightMetres: 0.082,
+	}
+	decoded := &station.Position{X: 3977478.6123, Y: -9616.8456, Z: 4968953.4789}
+
+	const want = "" +
+		"HOME00GBR0                                                  MARKER NAME         \n" +
+		"                    TRM59800.00     SCIS                    ANT # / TYPE        \n" +
+		"  3977478.6123    -9616.8456  4968953.4789                  APPROX POSITION XYZ \n" +
+		"        0.0820        0.0000        0.0000                  ANTENNA: DELTA H/E/N\n" +
+		"     1.000                                                  INTERVAL            \n"
+
+	got := NewHeader(&config, decoded, time.Second).Lines()
+	if got != want {
+		t.Error(diff.Diff(want, got))
+	}
+
+	for _, l := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		if len(l) != 80 {
+			t.Errorf("want 80 characters, got %d in %q", len(l), l)
+		}
+	}
+
+	// With nothing known, only the antenna delta is given.
+	const wantEmpty = "        0.0000        0.0000        0.0000                  ANTENNA: DELTA H/E/N\n"
+	gotEmpty := NewHeader(nil, nil, 0).Lines()
+	if gotEmpty != wantEmpty {
+		t.Error(diff.Diff(wantEmpty, gotEmpty))
+	}
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
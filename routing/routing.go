@@ -0,0 +1,129 @@
+// The routing package holds the rules that say which caster mountpoint each
+// source of messages is sent to, for an application that takes messages
+// from more than one base station at once.  Each route names a source, such
+// as a device or a host:port, the mountpoint that its messages go to and,
+// optionally, the message types that are sent.  The rules are given in one
+// section of the application's JSON config:
+//
+//	"routing": {
+//	    "routes": [
+//	        {"source": "/dev/ttyACM0", "mountpoint": "HOME"},
+//	        {"source": "192.168.1.20:5000", "mountpoint": "SHED", "types": [1005, 1077, 1087]}
+//	    ]
+//	}
+//
+// Validate checks that each source is routed once and that no two sources
+// share a mountpoint, since a caster can only take one stream of data on
+// each mountpoint:
+//
+//	if err := config.Routing.Validate(); err != nil { ... }
+//	route := config.Routing.Route(source)
+//	if route != nil && route.Wants(message.MessageType) {
+//	    // send the message to route.Mountpoint
+//	}
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Route sends the messages from one source to a mountpoint.
+type Route struct {
+	// Source identifies the source of the messages, for example a device
+	// name or a host:port.
+	Source string `json:"source"`
+
+	// Mountpoint is the name of the mountpoint, for example "MYBASE".
+	Mountpoint string `json:"mountpoint"`
+
+	// Types lists the message types that are sent.  If it's empty, all the
+	// RTCM messages are sent.
+	Types []int `json:"types"`
+}
+
+// Config holds the routes.
+type Config struct {
+	Routes []Route `json:"routes"`
+}
+
+// Validate checks the routes.  Each must have a source and a mountpoint,
+// no source may be given twice and no two sources may be sent to the same
+// mountpoint.
+func (config *Config) Validate() error {
+	if config == nil || len(config.Routes) == 0 {
+		return errors.New("routing - want at least one route")
+	}
+
+	sources := make(map[string]bool)
+	mountpoints := make(map[string]string)
+	for i, route := range config.Routes {
+		if len(route.Source) == 0 {
+			em := fmt.Sprintf("routing - route %d - want a source", i+1)
+			return errors.New(em)
+		}
+		if sources[route.Source] {
+			em := fmt.Sprintf("routing - source %s is given more than once", route.Source)
+			return errors.New(em)
+		}
+		sources[route.Source] = true
+
+		if len(route.Mountpoint) == 0 {
+			em := fmt.Sprintf("routing - source %s - want a mountpoint", route.Source)
+			return errors.New(em)
+		}
+		if strings.ContainsAny(route.Mountpoint, "/?&= ") {
+			em := fmt.Sprintf("routing - source %s - illegal mountpoint %q", route.Source, route.Mountpoint)
+			return errors.New(em)
+		}
+		other, taken := mountpoints[route.Mountpoint]
+		if taken {
+			em := fmt.Sprintf("routing - sources %s and %s are both sent to mountpoint %s",
+				other, route.Source, route.Mountpoint)
+			return errors.New(em)
+		}
+		mountpoints[route.Mountpoint] = route.Source
+
+		for _, messageType := range route.Types {
+			if messageType <= 0 {
+				em := fmt.Sprintf("routing - source %s - illegal message type %d", route.Source, messageType)
+				return errors.New(em)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Route returns the route for the source, nil if it has none.
+func (config *Config) Route(source string) *Route {
+	if config == nil {
+		return nil
+	}
+	for i := range config.Routes {
+		if config.Routes[i].Source == source {
+			return &config.Routes[i]
+		}
+	}
+	return nil
+}
+
+// Wants returns true if messages of the given type are sent on the route.
+// Non-RTCM data is never sent.
+func (route *Route) Wants(messageType int) bool {
+	if messageType == utils.NonRTCMMessage {
+		return false
+	}
+	if len(route.Types) == 0 {
+		return true
+	}
+	for _, t := range route.Types {
+		if t == messageType {
+			return true
+		}
+	}
+	return false
+}
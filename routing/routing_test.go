@@ -0,0 +1,157 @@
+package routing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestValidate checks that Validate finds the mistakes in the routes.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      *Config
+		want        string
+	}{
+		{
+			"valid",
+			&Config{Routes: []Route{
+				{Source: "/dev/ttyACM0", Mountpoint: "HOME"},
+				{Source: "192.168.1.20:5000", Mountpoint: "SHED", Types: []int{1005, 1077}},
+			}},
+			"",
+		},
+		{"nil", nil, "routing - want at least one route"},
+		{"no routes", &Config{}, "routing - want at least one route"},
+		{
+			"no source",
+			&Config{Routes: []Route{{Source: "a", Mountpoint: "A"}, {Mountpoint: "B"}}},
+			"routing - route 2 - want a source",
+		},
+		{
+			"source given twice",
+			&Config{Routes: []Route{{Source: "a", Mountpoint: "A"}, {Source: "a", Mountpoint: "B"}}},
+			"routing - source a is given more than once",
+		},
+		{
+			"no mountpoint",
+			&Config{Routes: []Route{{Source: "a"}}},
+			"routing - source a - want a mountpoint",
+		},
+		{
+			"illegal mountpoint",
+			&Config{Routes: []Route{{Source: "a", Mountpoint: "/HOME"}}},
+			`routing - source a - illegal mountpoint "/HOME"`,
+		},
+		{
+			"collision",
+			&Config{Routes: []Route{
+				{Source: "a", Mountpoint: "HOME"},
+				{Source: "b", Mountpoint: "SHED"},
+				{Source: "c", Mountpoint: "HOME"},
+			}},
+			"routing - sources a and c are both sent to mountpoint HOME",
+		},
+		{
+			"illegal type",
+			&Config{Routes: []Route{{Source: "a", Mountpoint: "HOME", Types: []int{1005, 0}}}},
+			"routing - source a - illegal message type 0",
+		},
+	}
+
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.want)
+		} else if err.Error() != td.want {
+			t.Errorf("%s: want error %s got %s", td.description, td.want, err.Error())
+		}
+	}
+}
+
+// TestRoute checks that Route finds the route for a source.
+func TestRoute(t *testing.T) {
+	config := Config{Routes: []Route{
+		{Source: "/dev/ttyACM0", Mountpoint: "HOME"},
+		{Source: "192.168.1.20:5000", Mountpoint: "SHED"},
+	}}
+
+	var testData = []struct {
+		source string
+		want   string
+	}{
+		{"/dev/ttyACM0", "HOME"},
+		{"192.168.1.20:5000", "SHED"},
+		{"/dev/ttyUSB0", ""},
+	}
+	for _, td := range testData {
+		route := config.Route(td.source)
+		got := ""
+		if route != nil {
+			got = route.Mountpoint
+		}
+		if got != td.want {
+			t.Errorf("%s: want %q got %q", td.source, td.want, got)
+		}
+	}
+
+	var nilConfig *Config
+	if nilConfig.Route("/dev/ttyACM0") != nil {
+		t.Error("nil config: want no route")
+	}
+}
+
+// TestWants checks the type filter of a route.
+func TestWants(t *testing.T) {
+	all := Route{Source: "a", Mountpoint: "A"}
+	some := Route{Source: "b", Mountpoint: "B", Types: []int{1005, 1077}}
+
+	var testData = []struct {
+		route       *Route
+		messageType int
+		want        bool
+	}{
+		{&all, 1005, true},
+		{&all, 1127, true},
+		{&all, utils.NonRTCMMessage, false},
+		{&some, 1005, true},
+		{&some, 1077, true},
+		{&some, 1087, false},
+		{&some, utils.NonRTCMMessage, false},
+	}
+	for _, td := range testData {
+		got := td.route.Wants(td.messageType)
+		if got != td.want {
+			t.Errorf("%s %d: want %v got %v", td.route.Source, td.messageType, td.want, got)
+		}
+	}
+}
+
+// TestJSON checks that the routes can be read from the JSON config.
+func TestJSON(t *testing.T) {
+	text := `{"routes": [
+		{"source": "/dev/ttyACM0", "mountpoint": "HOME"},
+		{"source": "192.168.1.20:5000", "mountpoint": "SHED", "types": [1005, 1077]}
+	]}`
+
+	var config Config
+	err := json.Unmarshal([]byte(text), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	route := config.Route("192.168.1.20:5000")
+	if route == nil || route.Mountpoint != "SHED" || len(route.Types) != 2 {
+		t.Errorf("want the SHED route with 2 types, got %+v", route)
+	}
+}
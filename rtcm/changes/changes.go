@@ -0,0 +1,131 @@
+// The changes package supports a quieter readable display for debugging
+// base stations, for example after a firmware update.  Messages that
+// describe the station, such as type 1005 (the base position), are normally
+// sent every few seconds and are the same every time, so the full display
+// of each one buries the rare message that differs.  A Watcher remembers
+// the last message of each watched type from each station and, after the
+// first, only displays the fields that changed:
+//
+//	watcher := changes.New()
+//	display, show := watcher.Display(&message)
+//	if show { fmt.Println(display) }
+//
+// For example:
+//
+//	Message type 1005 from station 2 changed:
+//	    AntennaRefZ 345678 -> 345679
+//
+// Messages of other types are displayed in full.  Message type 1033
+// (receiver and antenna descriptors) would also be worth watching, but
+// it's not yet decoded.
+package changes
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// key identifies a watched message stream.
+type key struct {
+	messageType int
+	stationID   uint
+}
+
+// Watcher remembers the last decoded message of each watched type from
+// each station.  It's safe for concurrent use.
+type Watcher struct {
+	previous map[key]interface{}
+	mutex    sync.Mutex
+}
+
+// New creates a Watcher.
+func New() *Watcher {
+	return &Watcher{previous: make(map[key]interface{})}
+}
+
+// Watched returns true if messages of the given type are watched.
+func Watched(messageType int) bool {
+	return messageType == utils.MessageType1005 || messageType == utils.MessageType1006
+}
+
+// Display returns the display of the message and whether it should be
+// shown.  A watched message is displayed in full the first time it's seen
+// from a station.  After that, if any field has changed, the display lists
+// the changed fields.  If nothing has changed, the message should not be
+// shown.  A message that isn't watched, or that can't be decoded, is always
+// displayed in full.
+func (watcher *Watcher) Display(message *rtcm.Message) (string, bool) {
+	if !Watched(message.MessageType) {
+		return message.String(), true
+	}
+
+	// Decode a copy, so that the display of the original is not affected.
+	decoded := message.Copy()
+	rtcm.PrepareForDisplay(&decoded)
+
+	var stationID uint
+	switch readable := decoded.Readable.(type) {
+	case *type1005.Message:
+		stationID = readable.StationID
+	case *type1006.Message:
+		stationID = readable.StationID
+	default:
+		return message.String(), true
+	}
+
+	k := key{message.MessageType, stationID}
+
+	watcher.mutex.Lock()
+	previous, seen := watcher.previous[k]
+	watcher.previous[k] = decoded.Readable
+	watcher.mutex.Unlock()
+
+	if !seen {
+		return message.String(), true
+	}
+
+	differences := fieldDifferences(previous, decoded.Readable)
+	if len(differences) == 0 {
+		return "", false
+	}
+
+	display := fmt.Sprintf("Message type %d from station %d changed:\n", message.MessageType, stationID)
+	for _, difference := range differences {
+		display += "    " + difference + "\n"
+	}
+
+	return display, true
+}
+
+// fieldDifferences compares the exported fields of two structs of the same
+// type, given by pointers, and returns a description of each one that
+// differs.
+func fieldDifferences(before, after interface{}) []string {
+	beforeValue := reflect.ValueOf(before).Elem()
+	afterValue := reflect.ValueOf(after).Elem()
+	structType := beforeValue.Type()
+
+	differences := make([]string, 0)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if len(field.PkgPath) > 0 {
+			// Unexported.
+			continue
+		}
+		b := beforeValue.Field(i).Interface()
+		a := afterValue.Field(i).Interface()
+		if !reflect.DeepEqual(b, a) {
+			differences = append(differences,
+				strings.TrimSpace(fmt.Sprintf("%s %v -> %v", field.Name, b, a)))
+		}
+	}
+
+	return differences
+}
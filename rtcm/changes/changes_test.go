@@ -0,0 +1,64 @@
+package changes
+
+import (
+	"log/slog"
+	"testing"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// changedFrame returns a copy of the frame with a bit of the last byte of
+// the message changed.  That byte holds the end of the Z coordinate.  The
+// CRC is not corrected, but it isn't checked when the message is decoded.
+func changedFrame(frame []byte) []byte {
+	changed := make([]byte, len(frame))
+	copy(changed, frame)
+	changed[len(changed)-utils.CRCLengthBytes-1] ^= 0x01
+	return changed
+}
+
+// TestDisplay checks that a watched message is displayed in full the first
+// time, not at all when it's repeated and as a list of differences when
+// it changes.
+func TestDisplay(t *testing.T) {
+	original := rtcm.NewMessage(utils.MessageType1005, "", testdata.MessageFrameType1005, slog.LevelInfo)
+	changed := rtcm.NewMessage(utils.MessageType1005, "", changedFrame(testdata.MessageFrameType1005), slog.LevelInfo)
+	msm := rtcm.NewMessage(utils.MessageTypeMSM7GPS, "", testdata.MessageFrameType1077, slog.LevelInfo)
+
+	watcher := New()
+
+	// The first message of a watched type is displayed in full.
+	first, showFirst := watcher.Display(original)
+	if !showFirst || first != original.String() {
+		t.Errorf("want the full display, got %v %s", showFirst, first)
+	}
+
+	// A repeat is not shown.
+	_, showRepeat := watcher.Display(original)
+	if showRepeat {
+		t.Error("want a repeat not to be shown")
+	}
+
+	// A change is shown as a list of differences.
+	const want = "Message type 1005 from station 2 changed:\n" +
+		"    AntennaRefZ 345678 -> 345679\n"
+	got, showChange := watcher.Display(changed)
+	if !showChange {
+		t.Error("want a change to be shown")
+	}
+	if got != want {
+		t.Error(diff.Diff(want, got))
+	}
+
+	// Other messages are always displayed in full.
+	for i := 0; i < 2; i++ {
+		display, show := watcher.Display(msm)
+		if !show || display != msm.String() {
+			t.Errorf("want the full display of an MSM, got %v %s", show, display)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// The crc24q package calculates the Qualcomm CRC-24Q, the 24-bit Cyclic
+// Redundancy Check at the end of each RTCM3 message frame.  (It's also used
+// by other GNSS formats such as SBAS messages.)
+//
+// Checksum gives the CRC of some data in one call:
+//
+//	crc := crc24q.Checksum(frame[:len(frame)-3])
+//
+// A Hash gives the CRC of data that arrives in pieces.  It satisfies
+// hash.Hash32, so it can be used anywhere that a standard hash can:
+//
+//	h := crc24q.New()
+//	h.Write(leader)
+//	h.Write(body)
+//	crc := h.Sum32()
+//
+// The CRC is big-endian in an RTCM3 frame.  HiByte, MiByte and LoByte give
+// its three bytes in that order, and Hash.Sum appends them.
+package crc24q
+
+import "hash"
+
+// Size is the size of the CRC in bytes.
+const Size = 3
+
+// BlockSize is the block size of the Hash in bytes.
+const BlockSize = 1
+
+// polynomial is the CRC-24Q polynomial,
+//
+//	x^24 + x^23 + x^18 + x^17 + x^14 + x^11 + x^10 + x^7 + x^6 + x^5 + x^4 + x^3 + x + 1
+//
+// without the x^24 term.
+const polynomial = 0x864cfb
+
+// The CRC is calculated in the top 24 bits of a 32-bit register, which lets
+// it use the "slicing by four" method, taking four bytes at a time with four
+// lookup tables.  tables[0] is the usual table for one byte.  tables[k] gives
+// the effect of a byte followed by k zero bytes.
+var tables = makeTables()
+
+// makeTables returns the lookup tables for the CRC.
+func makeTables() *[4][256]uint32 {
+	var tables [4][256]uint32
+	const shiftedPolynomial = polynomial << 8
+	for i := range tables[0] {
+		register := uint32(i) << 24
+		for bit := 0; bit < 8; bit++ {
+			if register&0x80000000 != 0 {
+				register = (register << 1) ^ shiftedPolynomial
+			} else {
+				register <<= 1
+			}
+		}
+		tables[0][i] = register
+	}
+	for k := 1; k < len(tables); k++ {
+		for i := range tables[k] {
+			previous := tables[k-1][i]
+			tables[k][i] = (previous << 8) ^ tables[0][previous>>24]
+		}
+	}
+	return &tables
+}
+
+// Hash calculates the CRC-24Q of data given in as many pieces as needed.
+// The zero value is ready to use.
+type Hash struct {
+	// register holds the CRC so far in its top 24 bits.
+	register uint32
+}
+
+// Check that Hash satisfies the standard interface.
+var _ hash.Hash32 = (*Hash)(nil)
+
+// New returns a Hash.
+func New() *Hash {
+	return &Hash{}
+}
+
+// Write adds the data to the CRC.  It never returns an error.
+func (h *Hash) Write(data []byte) (int, error) {
+	n := len(data)
+	register := h.register
+	t0, t1, t2, t3 := &tables[0], &tables[1], &tables[2], &tables[3]
+	for len(data) >= 4 {
+		register ^= uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+		register = t3[register>>24] ^ t2[byte(register>>16)] ^ t1[byte(register>>8)] ^ t0[byte(register)]
+		data = data[4:]
+	}
+	for _, b := range data {
+		register = (register << 8) ^ t0[byte(register>>24)^b]
+	}
+	h.register = register
+	return n, nil
+}
+
+// Sum32 returns the 24-bit CRC of the data so far.
+func (h *Hash) Sum32() uint32 {
+	return h.register >> 8
+}
+
+// Sum appends the three bytes of the CRC so far to b, high byte first as in
+// an RTCM3 frame, and returns the result.  It doesn't change the Hash.
+func (h *Hash) Sum(b []byte) []byte {
+	crc := h.Sum32()
+	return append(b, HiByte(crc), MiByte(crc), LoByte(crc))
+}
+
+// Reset clears the Hash, ready for new data.
+func (h *Hash) Reset() {
+	h.register = 0
+}
+
+// Size returns the size of the CRC in bytes, 3.
+func (h *Hash) Size() int {
+	return Size
+}
+
+// BlockSize returns the block size of the Hash, 1.
+func (h *Hash) BlockSize() int {
+	return BlockSize
+}
+
+// Checksum returns the CRC-24Q of the data.
+func Checksum(data []byte) uint32 {
+	var h Hash
+	h.Write(data)
+	return h.Sum32()
+}
+
+// HiByte returns the high byte of a 24-bit CRC.
+func HiByte(crc uint32) byte {
+	return byte(crc >> 16)
+}
+
+// MiByte returns the middle byte of a 24-bit CRC.
+func MiByte(crc uint32) byte {
+	return byte(crc >> 8)
+}
+
+// LoByte returns the low byte of a 24-bit CRC.
+func LoByte(crc uint32) byte {
+	return byte(crc)
+}
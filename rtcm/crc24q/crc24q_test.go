@@ -0,0 +1,121 @@
+package crc24q
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	reference "github.com/goblimey/go-crc24q/crc24q"
+)
+
+// frameType1005 is an RTCM3 frame containing a message of type 1005.  The
+// last three bytes are the CRC.
+var frameType1005 = []byte{
+	0xd3, 0x00, 0x13, 0x3e, 0xd0, 0x02, 0x0f, 0xc0,
+	0x00, 0x01, 0xe2, 0x40, 0x40, 0x00, 0x03, 0x94,
+	0x47, 0x80, 0x00, 0x05, 0x46, 0x4e, 0x5b, 0x90,
+	0x5f,
+}
+
+// TestChecksum checks Checksum and Hash against the go-crc24q package, for
+// data of many lengths given in pieces of many sizes.
+func TestChecksum(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for length := 0; length < 100; length++ {
+		data := make([]byte, length)
+		random.Read(data)
+		want := reference.Hash(data)
+
+		if got := Checksum(data); got != want {
+			t.Errorf("length %d: want %06x got %06x", length, want, got)
+		}
+
+		for piece := 1; piece < 7; piece++ {
+			h := New()
+			for start := 0; start < length; start += piece {
+				end := start + piece
+				if end > length {
+					end = length
+				}
+				h.Write(data[start:end])
+			}
+			if got := h.Sum32(); got != want {
+				t.Errorf("length %d in pieces of %d: want %06x got %06x", length, piece, want, got)
+			}
+		}
+	}
+}
+
+// TestFrame checks the CRC of a real frame.
+func TestFrame(t *testing.T) {
+	startOfCRC := len(frameType1005) - Size
+	want := frameType1005[startOfCRC:]
+
+	got := Checksum(frameType1005[:startOfCRC])
+	if HiByte(got) != want[0] || MiByte(got) != want[1] || LoByte(got) != want[2] {
+		t.Errorf("want % x got %06x", want, got)
+	}
+
+	// The CRC of the whole frame, CRC included, is zero.
+	if crc := Checksum(frameType1005); crc != 0 {
+		t.Errorf("want 0 got %06x", crc)
+	}
+}
+
+// TestHash checks the methods of Hash.
+func TestHash(t *testing.T) {
+	startOfCRC := len(frameType1005) - Size
+
+	var h Hash
+	n, err := h.Write(frameType1005[:startOfCRC])
+	if err != nil {
+		t.Error(err)
+	}
+	if n != startOfCRC {
+		t.Errorf("want %d got %d", startOfCRC, n)
+	}
+
+	prefix := []byte{1, 2}
+	want := append([]byte{1, 2}, frameType1005[startOfCRC:]...)
+	if got := h.Sum(prefix); !bytes.Equal(want, got) {
+		t.Errorf("want % x got % x", want, got)
+	}
+
+	// Sum doesn't change the Hash.
+	if got := h.Sum(nil); !bytes.Equal(frameType1005[startOfCRC:], got) {
+		t.Errorf("want % x got % x", frameType1005[startOfCRC:], got)
+	}
+
+	h.Reset()
+	if got := h.Sum32(); got != 0 {
+		t.Errorf("after Reset want 0 got %06x", got)
+	}
+
+	if h.Size() != 3 || h.BlockSize() != 1 {
+		t.Errorf("want size 3 and block size 1, got %d and %d", h.Size(), h.BlockSize())
+	}
+}
+
+// checksumSink stops the compiler optimising away the CRCs in the benchmarks.
+var checksumSink uint32
+
+// BenchmarkChecksum measures the CRC of a kilobyte.
+func BenchmarkChecksum(b *testing.B) {
+	data := make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		checksumSink = Checksum(data)
+	}
+}
+
+// BenchmarkChecksumByteTable measures the go-crc24q package on a kilobyte,
+// for comparison.
+func BenchmarkChecksumByteTable(b *testing.B) {
+	data := make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		checksumSink = reference.Hash(data)
+	}
+}
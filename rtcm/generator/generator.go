@@ -0,0 +1,417 @@
+// Package generator produces streams of syntactically valid RTCM3 messages -
+// a type 1005 (base station position) and a set of MSM4 or MSM7 messages at
+// each epoch - for testing and benchmarking.  The station position, the
+// number of satellites in each constellation and the epoch rate are
+// configurable:
+//
+//	config := generator.Config{
+//		StationID:  1,
+//		X:          3977611.5,
+//		Y:          -7419.8,
+//		Z:          4968784.2,
+//		MSM7:       true,
+//		Satellites: map[string]int{"GPS": 8, "Galileo": 6},
+//		Interval:   time.Second,
+//		Start:      time.Date(2023, time.May, 15, 12, 0, 0, 0, time.UTC),
+//	}
+//	gen, err := generator.New(config)
+//	...
+//	for i := 0; i < 3600; i++ {
+//		for _, frame := range gen.Epoch() {
+//			writer.Write(frame)
+//		}
+//	}
+//
+// The observations are plausible but made up.  Each satellite gets a range
+// and a range rate and its range moves at that rate from epoch to epoch,
+// plus some noise.  The same Config, including the Seed, always produces the
+// same stream.
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/goblimey/go-ntrip/leapseconds"
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	msm4Message "github.com/goblimey/go-ntrip/rtcm/type_msm4/message"
+	msm4Satellite "github.com/goblimey/go-ntrip/rtcm/type_msm4/satellite"
+	msm4Signal "github.com/goblimey/go-ntrip/rtcm/type_msm4/signal"
+	msm7Message "github.com/goblimey/go-ntrip/rtcm/type_msm7/message"
+	msm7Satellite "github.com/goblimey/go-ntrip/rtcm/type_msm7/satellite"
+	msm7Signal "github.com/goblimey/go-ntrip/rtcm/type_msm7/signal"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// DefaultInterval is the time between epochs if the Config doesn't give one.
+const DefaultInterval = time.Second
+
+// maxCells is the largest number of signal cells in an MSM, limited by the
+// 64-bit cell mask.
+const maxCells = 64
+
+// lenWeekInMillis is the length of a week in milliseconds.
+const lenWeekInMillis = 7 * 24 * 3600 * 1000
+
+// beidouOffsetMillis is the time by which Beidou time is behind GPS time.
+const beidouOffsetMillis = 14000
+
+// constellation describes one of the constellations that the generator
+// can produce MSMs for.
+type constellation struct {
+	// msm4Type is the MSM4 message type.  The MSM7 is three more.
+	msm4Type int
+
+	// signals are the IDs of the signals observed from each satellite, two
+	// per satellite as from a dual-band receiver.
+	signals []uint
+}
+
+// constellations gives the constellations that the generator supports,
+// keyed by the names that utils.GetConstellation returns.
+var constellations = map[string]constellation{
+	"GPS":     {utils.MessageTypeMSM4GPS, []uint{2, 16}},     // L1 C/A, L2C (L).
+	"Glonass": {utils.MessageTypeMSM4Glonass, []uint{2, 8}},  // G1 C/A, G2 C/A.
+	"Galileo": {utils.MessageTypeMSM4Galileo, []uint{2, 14}}, // E1 C, E5b I.
+	"Beidou":  {utils.MessageTypeMSM4Beidou, []uint{2, 14}},  // B1 I, B2 I.
+}
+
+// Config controls the stream that a Generator produces.
+type Config struct {
+	// StationID is the station ID in all of the messages - uint12.
+	StationID uint
+
+	// X, Y and Z give the position of the base station in Earth-Centred,
+	// Earth-Fixed (ECEF) coordinates in metres.
+	X, Y, Z float64
+
+	// MSM7 selects MSM7 messages (1077 etc).  Otherwise the generator
+	// produces MSM4 messages (1074 etc).
+	MSM7 bool
+
+	// Satellites gives the number of satellites observed for each
+	// constellation, keyed by "GPS", "Glonass", "Galileo" or "Beidou".  Each
+	// satellite gives two signals, so there can be up to 32 satellites per
+	// constellation.
+	Satellites map[string]int
+
+	// Interval is the time between epochs.  The default is DefaultInterval.
+	Interval time.Duration
+
+	// PositionEvery controls how often the type 1005 message is sent - at
+	// the first epoch and then every PositionEvery epochs.  0 means at every
+	// epoch.
+	PositionEvery int
+
+	// Start is the time of the first epoch.  The zero value means the current
+	// time, rounded down to a whole Interval.
+	Start time.Time
+
+	// Seed seeds the random numbers that give the observations.
+	Seed int64
+}
+
+// Generator produces the messages.
+type Generator struct {
+	// config is the configuration, with the defaults filled in.
+	config Config
+
+	// names is the list of constellations in the order in which their
+	// MSMs are sent.
+	names []string
+
+	// satellites holds the state of the satellites, keyed by constellation.
+	satellites map[string][]satelliteState
+
+	// epoch is the number of epochs produced so far.
+	epoch int
+
+	// time is the time of the next epoch.
+	time time.Time
+
+	// random gives the noise in the observations.
+	random *rand.Rand
+}
+
+// satelliteState is the state of one satellite.
+type satelliteState struct {
+	// id is the satellite ID, 1-64.
+	id uint
+
+	// rangeMillis is the range (the transit time of the signal) in
+	// milliseconds at the current epoch.
+	rangeMillis float64
+
+	// rangeRate is the rate of change of the range in metres per second.
+	rangeRate float64
+
+	// lockTime counts the epochs for which the signals have been locked.
+	lockTime uint
+}
+
+// New creates a Generator.  It returns an error if the configuration can't
+// be satisfied.
+func New(config Config) (*Generator, error) {
+
+	if config.StationID > 4095 {
+		em := fmt.Sprintf("the station ID must be 0-4095, got %d", config.StationID)
+		return nil, errors.New(em)
+	}
+
+	if config.Interval < 0 {
+		em := fmt.Sprintf("the interval must not be negative, got %v", config.Interval)
+		return nil, errors.New(em)
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+
+	if config.PositionEvery < 0 {
+		em := fmt.Sprintf("PositionEvery must not be negative, got %d", config.PositionEvery)
+		return nil, errors.New(em)
+	}
+
+	if config.Start.IsZero() {
+		config.Start = time.Now().Truncate(config.Interval)
+	}
+
+	names := make([]string, 0, len(config.Satellites))
+	for name, count := range config.Satellites {
+		c, ok := constellations[name]
+		if !ok {
+			em := fmt.Sprintf("unknown constellation %q", name)
+			return nil, errors.New(em)
+		}
+		if count < 0 || count*len(c.signals) > maxCells {
+			em := fmt.Sprintf("%s: the number of satellites must be 0-%d, got %d",
+				name, maxCells/len(c.signals), count)
+			return nil, errors.New(em)
+		}
+		if count > 0 {
+			names = append(names, name)
+		}
+	}
+	// Send the MSMs in message type order, as most receivers do.
+	sort.Slice(names, func(i, j int) bool {
+		return constellations[names[i]].msm4Type < constellations[names[j]].msm4Type
+	})
+
+	generator := Generator{
+		config:     config,
+		names:      names,
+		satellites: make(map[string][]satelliteState),
+		time:       config.Start.UTC(),
+		random:     rand.New(rand.NewSource(config.Seed)),
+	}
+
+	for _, name := range names {
+		states := make([]satelliteState, config.Satellites[name])
+		for i := range states {
+			// The range of a satellite in medium Earth orbit is roughly
+			// 20,000 to 26,000 km, 67 to 87 light milliseconds.
+			states[i] = satelliteState{
+				id:          uint(i + 1),
+				rangeMillis: 67 + 20*generator.random.Float64(),
+				rangeRate:   1600*generator.random.Float64() - 800,
+			}
+		}
+		generator.satellites[name] = states
+	}
+
+	return &generator, nil
+}
+
+// Time returns the time of the next epoch.
+func (generator *Generator) Time() time.Time {
+	return generator.time
+}
+
+// Epoch returns the message frames for the next epoch - the type 1005 if it's
+// due and then one MSM per constellation - and moves on to the next epoch.
+func (generator *Generator) Epoch() [][]byte {
+
+	frames := make([][]byte, 0, len(generator.names)+1)
+
+	every := generator.config.PositionEvery
+	if every == 0 || generator.epoch%every == 0 {
+		frames = append(frames, generator.Position())
+	}
+
+	for i, name := range generator.names {
+		// The multiple message flag says that more MSMs follow for this
+		// epoch.
+		more := i < len(generator.names)-1
+		frames = append(frames, generator.msm(name, more))
+	}
+
+	generator.advance()
+
+	return frames
+}
+
+// Position returns a type 1005 message frame giving the station position.
+func (generator *Generator) Position() []byte {
+	const scale = 10000 // The coordinates are in units of 0.1 mm.
+	message := type1005.New(
+		generator.config.StationID, 0, 0,
+		int64(math.Round(generator.config.X*scale)), 0,
+		int64(math.Round(generator.config.Y*scale)), 0,
+		int64(math.Round(generator.config.Z*scale)),
+		slog.LevelInfo,
+	)
+	return message.Frame()
+}
+
+// advance moves the satellites on to the next epoch.
+func (generator *Generator) advance() {
+	seconds := generator.config.Interval.Seconds()
+	for _, name := range generator.names {
+		states := generator.satellites[name]
+		for i := range states {
+			states[i].rangeMillis += states[i].rangeRate * seconds / utils.OneLightMillisecond
+			states[i].lockTime++
+		}
+	}
+	generator.epoch++
+	generator.time = generator.time.Add(generator.config.Interval)
+}
+
+// msm returns the MSM frame for a constellation at the current epoch.
+func (generator *Generator) msm(name string, more bool) []byte {
+	c := constellations[name]
+	states := generator.satellites[name]
+
+	messageType := c.msm4Type
+	if generator.config.MSM7 {
+		messageType += 3
+	}
+
+	var satelliteMask uint64
+	for _, state := range states {
+		satelliteMask |= 1 << (64 - state.id)
+	}
+	var signalMask uint32
+	for _, id := range c.signals {
+		signalMask |= 1 << (32 - id)
+	}
+	// Every satellite gives every signal, so the cell mask is all ones.
+	numCells := uint(len(states) * len(c.signals))
+	cellMask := uint64(1)<<numCells - 1
+	if numCells == 64 {
+		cellMask = math.MaxUint64
+	}
+
+	msmHeader := header.New(
+		messageType, generator.config.StationID,
+		Timestamp(name, generator.time),
+		more, 0, 0, 0, 0, false, 0,
+		satelliteMask, signalMask, cellMask, slog.LevelInfo,
+	)
+
+	if generator.config.MSM7 {
+		return generator.msm7(msmHeader, name, c.signals, states)
+	}
+	return generator.msm4(msmHeader, name, c.signals, states)
+}
+
+// msm4 returns an MSM4 message frame.
+func (generator *Generator) msm4(msmHeader *header.Header, name string, signals []uint, states []satelliteState) []byte {
+	satellites := make([]msm4Satellite.Cell, len(states))
+	signalCells := make([][]msm4Signal.Cell, len(states))
+	for i, state := range states {
+		whole, fraction := splitRange(state.rangeMillis)
+		satellites[i] = *msm4Satellite.New(state.id, whole, fraction, slog.LevelInfo)
+
+		signalCells[i] = make([]msm4Signal.Cell, len(signals))
+		for j, id := range signals {
+			// The range delta is in units of 2^-24 milliseconds, the phase
+			// range delta in 2^-29 milliseconds and the CNR in dB-Hz.
+			signalCells[i][j] = *msm4Signal.New(
+				id, &satellites[i],
+				generator.noise(1000), generator.noise(8000),
+				lockTimeIndicator(state.lockTime, 15), false,
+				uint(40+generator.random.Intn(10)),
+				utils.GetSignalWavelength(name, id), slog.LevelInfo,
+			)
+		}
+	}
+	return msm4Message.New(msmHeader, satellites, signalCells, slog.LevelInfo).Frame()
+}
+
+// msm7 returns an MSM7 message frame.
+func (generator *Generator) msm7(msmHeader *header.Header, name string, signals []uint, states []satelliteState) []byte {
+	satellites := make([]msm7Satellite.Cell, len(states))
+	signalCells := make([][]msm7Signal.Cell, len(states))
+	for i, state := range states {
+		whole, fraction := splitRange(state.rangeMillis)
+		satellites[i] = *msm7Satellite.New(
+			state.id, whole, fraction, 0, int(math.Round(state.rangeRate)), slog.LevelInfo)
+
+		signalCells[i] = make([]msm7Signal.Cell, len(signals))
+		for j, id := range signals {
+			// The range delta is in units of 2^-29 milliseconds, the phase
+			// range delta in 2^-31 milliseconds, the CNR in 1/16 dB-Hz and
+			// the phase range rate delta in 0.1 mm/s.
+			signalCells[i][j] = *msm7Signal.New(
+				id, &satellites[i],
+				generator.noise(30000), generator.noise(120000),
+				lockTimeIndicator(state.lockTime, 1023), false,
+				uint(16*40+generator.random.Intn(160)),
+				generator.noise(5000),
+				utils.GetSignalWavelength(name, id), slog.LevelInfo,
+			)
+		}
+	}
+	return msm7Message.New(msmHeader, satellites, signalCells, slog.LevelInfo).Frame()
+}
+
+// noise returns a random number between -limit and limit.
+func (generator *Generator) noise(limit int) int {
+	return generator.random.Intn(2*limit+1) - limit
+}
+
+// splitRange splits a range in milliseconds into the whole milliseconds and
+// the fraction in units of 1/1024 milliseconds, as in the satellite cell of
+// an MSM.
+func splitRange(rangeMillis float64) (uint, uint) {
+	whole := math.Floor(rangeMillis)
+	fraction := math.Floor((rangeMillis - whole) * 1024)
+	return uint(whole), uint(fraction)
+}
+
+// lockTimeIndicator returns a lock time indicator for a signal locked for
+// the given number of epochs, which counts up to the largest value that the
+// field can hold.
+func lockTimeIndicator(epochs, max uint) uint {
+	if epochs > max {
+		return max
+	}
+	return epochs
+}
+
+// Timestamp returns the MSM timestamp for the given time in the given
+// constellation.  For Glonass it's the day of the week and the milliseconds
+// since the start of the day in Moscow time.  For the others it's the
+// milliseconds since the start of the week - the GPS week for GPS and
+// Galileo, the Beidou week for Beidou.
+func Timestamp(constellation string, t time.Time) uint {
+	if constellation == "Glonass" {
+		moscow := t.UTC().Add(-1 * utils.GlonassTimeOffset)
+		midnight := time.Date(moscow.Year(), moscow.Month(), moscow.Day(), 0, 0, 0, 0, time.UTC)
+		millis := uint(moscow.Sub(midnight).Milliseconds())
+		return uint(moscow.Weekday())<<27 | millis
+	}
+
+	gpsAhead := leapseconds.Default().GPSMinusUTC(t)
+	millis := (t.Sub(utils.GPSTimeOrigin) + gpsAhead).Milliseconds() % lenWeekInMillis
+	if constellation == "Beidou" {
+		millis = (millis - beidouOffsetMillis + lenWeekInMillis) % lenWeekInMillis
+	}
+	return uint(millis)
+}
@@ -0,0 +1,272 @@
+package generator
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/type1005"
+	msm4Message "github.com/goblimey/go-ntrip/rtcm/type_msm4/message"
+	msm7Message "github.com/goblimey/go-ntrip/rtcm/type_msm7/message"
+)
+
+// start is the time of the first epoch in the tests, a Monday.
+var start = time.Date(2023, time.May, 15, 12, 0, 0, 0, time.UTC)
+
+// TestNewErrors checks that New rejects bad configurations.
+func TestNewErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		want        string
+	}{
+		{"station ID", Config{StationID: 4096},
+			"the station ID must be 0-4095, got 4096"},
+		{"interval", Config{Interval: -time.Second},
+			"the interval must not be negative, got -1s"},
+		{"position every", Config{PositionEvery: -1},
+			"PositionEvery must not be negative, got -1"},
+		{"constellation", Config{Satellites: map[string]int{"Foo": 1}},
+			`unknown constellation "Foo"`},
+		{"too many satellites", Config{Satellites: map[string]int{"GPS": 33}},
+			"GPS: the number of satellites must be 0-32, got 33"},
+		{"negative satellites", Config{Satellites: map[string]int{"Beidou": -1}},
+			"Beidou: the number of satellites must be 0-32, got -1"},
+	}
+	for _, td := range testData {
+		generator, err := New(td.config)
+		if generator != nil {
+			t.Errorf("%s: want nil generator", td.description)
+		}
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want %q got %v", td.description, td.want, err)
+		}
+	}
+}
+
+// TestEpoch checks that the generated messages decode cleanly and give the
+// configured values.
+func TestEpoch(t *testing.T) {
+	satellites := map[string]int{"GPS": 32, "Glonass": 7, "Galileo": 1, "Beidou": 12}
+	wantOrder := []string{"GPS", "Glonass", "Galileo", "Beidou"}
+
+	var testData = []struct {
+		description string
+		msm7        bool
+		msmOffset   int
+	}{
+		{"MSM4", false, 0},
+		{"MSM7", true, 3},
+	}
+	for _, td := range testData {
+		config := Config{
+			StationID:     42,
+			X:             3977611.5432,
+			Y:             -7419.8765,
+			Z:             4968784.2109,
+			MSM7:          td.msm7,
+			Satellites:    satellites,
+			Interval:      500 * time.Millisecond,
+			PositionEvery: 2,
+			Start:         start,
+		}
+		generator, err := New(config)
+		if err != nil {
+			t.Fatalf("%s: %v", td.description, err)
+		}
+
+		handler := rtcm.New(start, slog.LevelInfo)
+		for epoch := 0; epoch < 4; epoch++ {
+			wantTime := start.Add(time.Duration(epoch) * config.Interval)
+			if !generator.Time().Equal(wantTime) {
+				t.Errorf("%s %d: want time %v got %v", td.description, epoch, wantTime, generator.Time())
+			}
+
+			frames := generator.Epoch()
+
+			// The 1005 comes with every other epoch.
+			if epoch%2 == 0 {
+				if len(frames) != 5 {
+					t.Fatalf("%s %d: want 5 frames got %d", td.description, epoch, len(frames))
+				}
+				checkPosition(t, td.description, frames[0], config)
+				frames = frames[1:]
+			}
+			if len(frames) != 4 {
+				t.Fatalf("%s %d: want 4 MSMs got %d", td.description, epoch, len(frames))
+			}
+
+			for i, frame := range frames {
+				name := wantOrder[i]
+				wantType := constellations[name].msm4Type + td.msmOffset
+
+				message, err := handler.GetMessage(frame)
+				if err != nil {
+					t.Fatalf("%s %d %s: %v", td.description, epoch, name, err)
+				}
+				if message.MessageType != wantType {
+					t.Errorf("%s %d: want type %d got %d", td.description, epoch, wantType, message.MessageType)
+				}
+				if !message.SentAt.Equal(wantTime) {
+					t.Errorf("%s %d %s: want sent at %v got %v", td.description, epoch, name, wantTime, message.SentAt)
+				}
+
+				checkMSM(t, td.description, frame, td.msm7, satellites[name], i < len(frames)-1)
+			}
+		}
+	}
+}
+
+// checkPosition is a helper function.  It checks a type 1005 frame.
+func checkPosition(t *testing.T, description string, frame []byte, config Config) {
+	message, err := type1005.GetMessage(frame, slog.LevelInfo)
+	if err != nil {
+		t.Errorf("%s: %v", description, err)
+		return
+	}
+	if message.StationID != config.StationID {
+		t.Errorf("%s: want station %d got %d", description, config.StationID, message.StationID)
+	}
+	if message.AntennaRefX != 39776115432 || message.AntennaRefY != -74198765 ||
+		message.AntennaRefZ != 49687842109 {
+		t.Errorf("%s: want the configured position got (%d, %d, %d)", description,
+			message.AntennaRefX, message.AntennaRefY, message.AntennaRefZ)
+	}
+}
+
+// checkMSM is a helper function.  It decodes an MSM frame and checks the
+// numbers of satellites and signal cells and the multiple message flag.
+func checkMSM(t *testing.T, description string, frame []byte, msm7 bool, wantSatellites int, wantMore bool) {
+	var numSatellites, numCells int
+	var more bool
+	var warning string
+	if msm7 {
+		message, err := msm7Message.GetMessage(frame, slog.LevelInfo)
+		if err != nil {
+			t.Errorf("%s: %v", description, err)
+			return
+		}
+		numSatellites = len(message.Satellites)
+		for i := range message.Signals {
+			numCells += len(message.Signals[i])
+		}
+		more, warning = message.Header.MultipleMessage, message.Header.Warning
+	} else {
+		message, err := msm4Message.GetMessage(frame, slog.LevelInfo)
+		if err != nil {
+			t.Errorf("%s: %v", description, err)
+			return
+		}
+		numSatellites = len(message.Satellites)
+		for i := range message.Signals {
+			numCells += len(message.Signals[i])
+		}
+		more, warning = message.Header.MultipleMessage, message.Header.Warning
+	}
+
+	if numSatellites != wantSatellites {
+		t.Errorf("%s: want %d satellites got %d", description, wantSatellites, numSatellites)
+	}
+	if numCells != 2*wantSatellites {
+		t.Errorf("%s: want %d signal cells got %d", description, 2*wantSatellites, numCells)
+	}
+	if more != wantMore {
+		t.Errorf("%s: want multiple message %v got %v", description, wantMore, more)
+	}
+	if len(warning) > 0 {
+		t.Errorf("%s: %s", description, warning)
+	}
+}
+
+// TestSeed checks that the same configuration gives the same stream and a
+// different seed gives a different one.
+func TestSeed(t *testing.T) {
+	stream := func(seed int64) []byte {
+		config := Config{
+			Satellites: map[string]int{"GPS": 10, "Galileo": 8},
+			MSM7:       true,
+			Start:      start,
+			Seed:       seed,
+		}
+		generator, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []byte
+		for i := 0; i < 10; i++ {
+			for _, frame := range generator.Epoch() {
+				result = append(result, frame...)
+			}
+		}
+		return result
+	}
+
+	if !bytes.Equal(stream(1), stream(1)) {
+		t.Error("the same seed gave different streams")
+	}
+	if bytes.Equal(stream(1), stream(2)) {
+		t.Error("different seeds gave the same stream")
+	}
+}
+
+// TestScan checks that a generated stream can be read by a Scanner.
+func TestScan(t *testing.T) {
+	config := Config{
+		Satellites: map[string]int{"GPS": 12, "Glonass": 8},
+		Start:      time.Now().Truncate(time.Second),
+	}
+	generator, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input []byte
+	for i := 0; i < 60; i++ {
+		for _, frame := range generator.Epoch() {
+			input = append(input, frame...)
+		}
+	}
+
+	scanner := rtcm.NewScanner(bytes.NewReader(input))
+	count := 0
+	for {
+		message, err := scanner.Next()
+		if err != nil {
+			break
+		}
+		if len(message.ErrorMessage) > 0 {
+			t.Errorf("message %d: %s", count, message.ErrorMessage)
+		}
+		count++
+	}
+	if count != 180 {
+		t.Errorf("want 180 messages got %d", count)
+	}
+	if stats := scanner.Handler().Stats(); stats.CRCFailures != 0 {
+		t.Errorf("want no CRC failures got %d", stats.CRCFailures)
+	}
+}
+
+// TestTimestamp checks the timestamps for each constellation.
+func TestTimestamp(t *testing.T) {
+	// Monday 15th May 2023 12:00 UTC is 1 day, 12 hours and 18 seconds into
+	// the GPS week, 1 day, 12 hours and 4 seconds into the Beidou week and
+	// 15:00 on Monday Moscow time.
+	const gps = (36*3600 + 18) * 1000
+	var testData = []struct {
+		constellation string
+		want          uint
+	}{
+		{"GPS", gps},
+		{"Galileo", gps},
+		{"Beidou", gps - 14000},
+		{"Glonass", 1<<27 | 15*3600*1000},
+	}
+	for _, td := range testData {
+		got := Timestamp(td.constellation, start)
+		if got != td.want {
+			t.Errorf("%s: want %d got %d", td.constellation, td.want, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// The handler notes the time at which it received each message frame, taken
+// from the host clock.  On a host without NTP, such as a Raspberry Pi in a
+// shed, that clock can drift by seconds a day, so the latency figures
+// worked out from the receipt times drift too.  The handler can discipline
+// the receipt times against the GNSS time in the MSMs, which doesn't drift.
+//
+// The difference between the receipt time and the GNSS time of an MSM is the
+// latency of the message plus the error in the host clock.  The smallest
+// difference over a window of recent MSMs is taken to be the error plus the
+// smallest latency, which is roughly constant.  The smallest difference over
+// the first window is the baseline, and any change from it after that is
+// taken to be drift.  The corrected receipt time is the receipt time less
+// the drift, so it keeps the latency measured when the handler started but
+// not the drift since.  Until the first window is full, no correction is
+// made.
+//
+// The estimate lags behind the drift by up to the length of the window, a
+// few milliseconds for a typical host clock.  The corrected receipt time is
+// only as good as the base station's clock, and a change in the network that
+// alters the smallest latency is mistaken for drift.
+
+// clockWindow is the number of recent MSMs used to estimate the drift.
+const clockWindow = 300
+
+// receiptClock disciplines receipt times against the GNSS time.
+type receiptClock struct {
+	// offsets holds the differences between the receipt times and the GNSS
+	// times of recent MSMs in a ring buffer.  next is the index of the next
+	// slot to fill.
+	offsets []time.Duration
+	next    int
+
+	// baseline is the smallest offset in the first window, set when the
+	// window fills.  settled is true from then on.
+	baseline time.Duration
+	settled  bool
+
+	// The mutex controls access to all the fields.
+	mutex sync.Mutex
+}
+
+// correct records the offset of an MSM with the given GNSS time and returns
+// the corrected receipt time.  If the GNSS time is zero, the message is not
+// an MSM or its timestamp couldn't be converted, and the receipt time is
+// corrected using the existing estimate of the drift.
+func (clock *receiptClock) correct(receivedAt, gnssTime time.Time) time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	if !gnssTime.IsZero() {
+		offset := receivedAt.Sub(gnssTime)
+		if len(clock.offsets) < clockWindow {
+			clock.offsets = append(clock.offsets, offset)
+		} else {
+			clock.offsets[clock.next] = offset
+		}
+		clock.next = (clock.next + 1) % clockWindow
+
+		if !clock.settled && len(clock.offsets) == clockWindow {
+			clock.baseline = clock.smallestOffset()
+			clock.settled = true
+		}
+	}
+
+	return receivedAt.Add(-1 * clock.drift())
+}
+
+// drift returns the estimated drift of the host clock since the baseline was
+// set.  The caller must hold the mutex.
+func (clock *receiptClock) drift() time.Duration {
+	if !clock.settled {
+		return 0
+	}
+	return clock.smallestOffset() - clock.baseline
+}
+
+// smallestOffset returns the smallest of the recent offsets.  The caller
+// must hold the mutex and there must be at least one offset.
+func (clock *receiptClock) smallestOffset() time.Duration {
+	smallest := clock.offsets[0]
+	for _, offset := range clock.offsets[1:] {
+		if offset < smallest {
+			smallest = offset
+		}
+	}
+	return smallest
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestReceiptClock checks that the clock corrects receipt times for drift
+// once the first window is full.
+func TestReceiptClock(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := receiptClock{}
+
+	// receive returns the receipt time of the nth epoch given a latency of
+	// 100 to 140 ms and the host clock error.
+	receive := func(n int, clockError time.Duration) (time.Time, time.Time) {
+		gnssTime := start.Add(time.Duration(n) * time.Second)
+		latency := time.Duration(100+10*(n%5)) * time.Millisecond
+		return gnssTime.Add(latency + clockError), gnssTime
+	}
+
+	// Until the first window is full, there's no correction.
+	n := 0
+	for ; n < clockWindow; n++ {
+		receivedAt, gnssTime := receive(n, 0)
+		corrected := clock.correct(receivedAt, gnssTime)
+		if !corrected.Equal(receivedAt) {
+			t.Fatalf("%d: want %v got %v", n, receivedAt, corrected)
+		}
+	}
+
+	// The host clock now jumps forward by two seconds.  The corrected times
+	// follow it until the offsets from before the jump have left the window.
+	const clockError = 2 * time.Second
+	for ; n < 2*clockWindow; n++ {
+		receivedAt, gnssTime := receive(n, clockError)
+		clock.correct(receivedAt, gnssTime)
+	}
+
+	// From then on, the jump is taken off.
+	for ; n < 2*clockWindow+10; n++ {
+		receivedAt, gnssTime := receive(n, clockError)
+		corrected := clock.correct(receivedAt, gnssTime)
+		want := receivedAt.Add(-1 * clockError)
+		if !corrected.Equal(want) {
+			t.Errorf("%d: want %v got %v", n, want, corrected)
+		}
+	}
+
+	// A message without a GNSS time is corrected using the estimate.
+	receivedAt := start.Add(time.Hour)
+	corrected := clock.correct(receivedAt, time.Time{})
+	want := receivedAt.Add(-1 * clockError)
+	if !corrected.Equal(want) {
+		t.Errorf("no GNSS time: want %v got %v", want, corrected)
+	}
+}
+
+// TestReceiptTimes checks that FetchNextMessageFrame sets the receipt time
+// and, if the clock discipline is on, the corrected receipt time.
+func TestReceiptTimes(t *testing.T) {
+	var testData = []struct {
+		description string
+		discipline  bool
+	}{
+		{"off", false},
+		{"on", true},
+	}
+	for _, td := range testData {
+		ch := make(chan byte, 10000)
+		for _, b := range testdata.MessageFrameType1077 {
+			ch <- b
+		}
+		bc := pushback.New(ch)
+		bc.Close()
+
+		startDate := time.Date(2023, time.August, 29, 00, 00, 00, 0, utils.LocationUTC)
+		handler := New(startDate, slog.LevelDebug)
+		handler.SetClockDiscipline(td.discipline)
+
+		before := time.Now()
+		message, err := handler.FetchNextMessageFrame(bc)
+		after := time.Now()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message.ReceivedAt.Before(before) || message.ReceivedAt.After(after) {
+			t.Errorf("%s: want the receipt time between %v and %v got %v",
+				td.description, before, after, message.ReceivedAt)
+		}
+
+		if message.SentAt.IsZero() {
+			t.Errorf("%s: want the time from the timestamp", td.description)
+		}
+
+		if td.discipline {
+			// The first window isn't full, so there's no correction yet.
+			if !message.CorrectedReceivedAt.Equal(message.ReceivedAt) {
+				t.Errorf("%s: want %v got %v",
+					td.description, message.ReceivedAt, message.CorrectedReceivedAt)
+			}
+		} else if !message.CorrectedReceivedAt.IsZero() {
+			t.Errorf("%s: want no corrected time got %v",
+				td.description, message.CorrectedReceivedAt)
+		}
+
+		// The copy keeps the receipt times.
+		c := message.Copy()
+		if !c.ReceivedAt.Equal(message.ReceivedAt) ||
+			!c.CorrectedReceivedAt.Equal(message.CorrectedReceivedAt) {
+			t.Errorf("%s: want the copy to keep the receipt times", td.description)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The handler measures the completeness of the stream for each
+// constellation: the percentage of the expected epochs that arrived over
+// the last few minutes and over the last hour.  That's the single number
+// that answers the question "is my base actually producing usable data?".
+//
+// The expected number of epochs is worked out from the median interval
+// between epochs (see EpochStats) and the time covered, which is the
+// window or the time since the first MSM arrived, whichever is shorter.
+// Only the constellations seen since the handler started are reported, so
+// a constellation that stops shows up as a falling percentage.
+
+// shortCompletenessWindow and longCompletenessWindow are the periods over
+// which the completeness is measured.
+const shortCompletenessWindow = 5 * time.Minute
+const longCompletenessWindow = time.Hour
+
+// Completeness gives the percentage of the expected epochs of one
+// constellation that arrived recently.
+type Completeness struct {
+	// Last5MinutesPercent is the percentage over the last five minutes.
+	Last5MinutesPercent float64 `json:"last_5_minutes_percent"`
+
+	// Last60MinutesPercent is the percentage over the last hour.
+	Last60MinutesPercent float64 `json:"last_60_minutes_percent"`
+}
+
+// epochTrail holds the arrival times of the recent epochs of one
+// constellation.
+type epochTrail struct {
+	// lastTimestamp is the timestamp of the last MSM.
+	lastTimestamp uint
+
+	// arrivals holds the arrival times in Unix nanoseconds, oldest first.
+	// Times are only ever appended to the end and dropped from the front,
+	// so once a time is in the slice it doesn't change.  That allows stats
+	// to take a copy of the slice (not of the times) under the lock and
+	// work on it after releasing the lock.
+	arrivals []int64
+}
+
+// completenessMeter records the arrival of epochs for each constellation.
+type completenessMeter struct {
+	// start is the time that the first MSM arrived.
+	start time.Time
+
+	// trails is the record of each constellation, by name.
+	trails map[string]*epochTrail
+
+	// The mutex controls access to all the fields.
+	mutex sync.Mutex
+}
+
+// record notes the arrival time of a message, if it starts a new epoch of
+// its constellation.
+func (meter *completenessMeter) record(message *Message, arrival time.Time) {
+	if message == nil || !utils.MSM(message.MessageType) {
+		return
+	}
+
+	constellation := utils.GetConstellation(message.MessageType)
+
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	if meter.trails == nil {
+		meter.trails = make(map[string]*epochTrail)
+		meter.start = arrival
+	}
+
+	trail, found := meter.trails[constellation]
+	if !found {
+		trail = &epochTrail{}
+		meter.trails[constellation] = trail
+	} else if message.Timestamp == trail.lastTimestamp {
+		// Another message of the same epoch.
+		return
+	}
+
+	trail.lastTimestamp = message.Timestamp
+	trail.arrivals = append(trail.arrivals, arrival.UnixNano())
+
+	// Forget the epochs that are too old to matter.
+	oldest := arrival.Add(-1 * longCompletenessWindow).UnixNano()
+	i := 0
+	for i < len(trail.arrivals) && trail.arrivals[i] < oldest {
+		i++
+	}
+	trail.arrivals = trail.arrivals[i:]
+}
+
+// stats returns the completeness of each constellation at the given time,
+// given the interval between epochs.  It returns nil if the interval is not
+// known.  It holds the lock only while it takes a copy of each trail, so
+// it doesn't hold up the handler while it works out the percentages.
+func (meter *completenessMeter) stats(now time.Time, interval time.Duration) map[string]Completeness {
+	if interval <= 0 {
+		return nil
+	}
+
+	meter.mutex.Lock()
+	start := meter.start
+	trails := make(map[string][]int64, len(meter.trails))
+	for constellation, trail := range meter.trails {
+		trails[constellation] = trail.arrivals
+	}
+	meter.mutex.Unlock()
+
+	if len(trails) == 0 {
+		return nil
+	}
+
+	result := make(map[string]Completeness)
+	for constellation, arrivals := range trails {
+		result[constellation] = Completeness{
+			Last5MinutesPercent:  percent(arrivals, start, now, shortCompletenessWindow, interval),
+			Last60MinutesPercent: percent(arrivals, start, now, longCompletenessWindow, interval),
+		}
+	}
+
+	return result
+}
+
+// percent returns the percentage of the expected epochs that arrived in the
+// window ending at the given time, to one decimal place.  The arrival times
+// are oldest first and start is the time that the first MSM arrived.
+func percent(arrivals []int64, start, now time.Time, window, interval time.Duration) float64 {
+	covered := now.Sub(start)
+	if covered > window {
+		covered = window
+	}
+
+	// The window includes both ends, so one more than the number of whole
+	// intervals is expected.
+	expected := int64(covered/interval) + 1
+
+	windowStart := now.Add(-1 * window).UnixNano()
+	first := sort.Search(len(arrivals), func(i int) bool { return arrivals[i] >= windowStart })
+	received := int64(len(arrivals) - first)
+
+	if received >= expected {
+		return 100
+	}
+
+	return math.Round(float64(received)*1000/float64(expected)) / 10
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestCompleteness checks the percentage of expected epochs received for
+// each constellation.
+func TestCompleteness(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	meter := completenessMeter{}
+
+	// GPS sends MSM4 and MSM7 every second for ten minutes, apart from a
+	// gap of a minute after seven minutes.  Galileo stops after two minutes.
+	for i := 0; i < 600; i++ {
+		arrival := start.Add(time.Duration(i) * time.Second)
+		timestamp := uint(1000 * (i + 1))
+		if i < 420 || i >= 480 {
+			meter.record(msmWithTimestamp(utils.MessageTypeMSM4GPS, timestamp), arrival)
+			meter.record(msmWithTimestamp(utils.MessageTypeMSM7GPS, timestamp), arrival)
+		}
+		if i < 120 {
+			meter.record(msmWithTimestamp(utils.MessageTypeMSM7Galileo, timestamp), arrival)
+		}
+	}
+
+	// Messages that aren't MSMs are ignored.
+	meter.record(&Message{MessageType: 1005}, start)
+	meter.record(nil, start)
+
+	now := start.Add(599 * time.Second)
+
+	// Over the last five minutes 301 GPS epochs are expected and 241
+	// arrived.  Over the last hour the stream has only been running for
+	// ten minutes, so 600 are expected and 540 arrived.
+	want := map[string]Completeness{
+		"GPS":     {Last5MinutesPercent: 80.1, Last60MinutesPercent: 90},
+		"Galileo": {Last5MinutesPercent: 0, Last60MinutesPercent: 20},
+	}
+
+	got := meter.stats(now, time.Second)
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	// Until the interval is known, there's no result.
+	if meter.stats(now, 0) != nil {
+		t.Error("want nil with no interval")
+	}
+
+	// If the interval is overestimated, the percentage is capped.
+	capped := meter.stats(now, time.Minute)
+	if capped["GPS"].Last60MinutesPercent != 100 {
+		t.Errorf("want 100 got %f", capped["GPS"].Last60MinutesPercent)
+	}
+}
+
+// TestCompletenessForgetsOldEpochs checks that only the last hour of
+// epochs is kept.
+func TestCompletenessForgetsOldEpochs(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	meter := completenessMeter{}
+
+	for i := 0; i < 7200; i++ {
+		arrival := start.Add(time.Duration(i) * time.Second)
+		meter.record(msmWithTimestamp(utils.MessageTypeMSM4GPS, uint(i+1)), arrival)
+	}
+
+	// The epochs from the last hour, including both ends.
+	const want = 3601
+	got := len(meter.trails["GPS"].arrivals)
+	if got != want {
+		t.Errorf("want %d got %d", want, got)
+	}
+
+	completeness := meter.stats(start.Add(7199*time.Second), time.Second)
+	if completeness["GPS"].Last60MinutesPercent != 100 {
+		t.Errorf("want 100 got %f", completeness["GPS"].Last60MinutesPercent)
+	}
+}
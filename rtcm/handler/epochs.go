@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The handler measures the time between the arrival of successive epochs of
+// observations.  A base station sends one epoch per second (or whatever its
+// rate is), so the intervals should all be about the same.  If the rovers
+// report intermittent fixes, a wide spread of intervals at the handler
+// points to the network between the base and the handler, while regular
+// intervals point elsewhere.
+//
+// An epoch is a set of MSMs with the same timestamp.  The arrival of an
+// epoch is taken to be the arrival of the first MSM type seen in the stream
+// with a new timestamp.  (The GLONASS timestamp is in a different form from
+// the others, so the timestamps of different types can't be compared.)
+
+// epochIntervalWindow is the number of recent intervals used for the
+// statistics.
+const epochIntervalWindow = 300
+
+// EpochStats summarises the intervals between recent epochs.  The spread
+// between the median and the 99th percentile is a measure of the jitter.
+type EpochStats struct {
+	// Epochs is the number of epochs seen.
+	Epochs uint64 `json:"epochs"`
+
+	// IntervalMillisP50, P90 and P99 are percentiles of the recent
+	// intervals in milliseconds.
+	IntervalMillisP50 int64 `json:"interval_ms_p50"`
+	IntervalMillisP90 int64 `json:"interval_ms_p90"`
+	IntervalMillisP99 int64 `json:"interval_ms_p99"`
+
+	// IntervalMillisMax is the longest recent interval in milliseconds.
+	IntervalMillisMax int64 `json:"interval_ms_max"`
+}
+
+// epochTimer records the intervals between epochs.
+type epochTimer struct {
+	// referenceType is the message type used to spot new epochs - the
+	// first MSM type seen.
+	referenceType int
+
+	// lastTimestamp is the timestamp of the last message of the reference type.
+	lastTimestamp uint
+
+	// lastArrival is the time that the last epoch arrived.
+	lastArrival time.Time
+
+	// epochs is the number of epochs seen.
+	epochs uint64
+
+	// intervals holds the recent intervals in a ring buffer.  next is
+	// the index of the next slot to fill.
+	intervals []time.Duration
+	next      int
+
+	// The mutex controls access to all the fields.
+	mutex sync.Mutex
+}
+
+// record notes the arrival time of a message, if it starts a new epoch.
+func (timer *epochTimer) record(message *Message, arrival time.Time) {
+	if message == nil || !utils.MSM(message.MessageType) {
+		return
+	}
+
+	timer.mutex.Lock()
+	defer timer.mutex.Unlock()
+
+	if timer.referenceType == 0 {
+		timer.referenceType = message.MessageType
+	} else if message.MessageType != timer.referenceType || message.Timestamp == timer.lastTimestamp {
+		return
+	}
+
+	timer.lastTimestamp = message.Timestamp
+
+	if timer.epochs > 0 {
+		interval := arrival.Sub(timer.lastArrival)
+		if len(timer.intervals) < epochIntervalWindow {
+			timer.intervals = append(timer.intervals, interval)
+		} else {
+			timer.intervals[timer.next] = interval
+		}
+		timer.next = (timer.next + 1) % epochIntervalWindow
+	}
+
+	timer.lastArrival = arrival
+	timer.epochs++
+}
+
+// stats returns a summary of the recent intervals.  The handler calls
+// record for every message, so stats holds the lock only while it copies
+// the intervals into a buffer made beforehand, and sorts them afterwards.
+func (timer *epochTimer) stats() EpochStats {
+	sorted := make([]time.Duration, 0, epochIntervalWindow)
+
+	timer.mutex.Lock()
+	sorted = append(sorted, timer.intervals...)
+	stats := EpochStats{Epochs: timer.epochs}
+	timer.mutex.Unlock()
+
+	if len(sorted) == 0 {
+		return stats
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	percentile := func(p int) int64 {
+		i := (len(sorted)*p+99)/100 - 1
+		return sorted[i].Milliseconds()
+	}
+
+	stats.IntervalMillisP50 = percentile(50)
+	stats.IntervalMillisP90 = percentile(90)
+	stats.IntervalMillisP99 = percentile(99)
+	stats.IntervalMillisMax = sorted[len(sorted)-1].Milliseconds()
+
+	return stats
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// msmWithTimestamp returns a message of the given type with the given
+// timestamp.
+func msmWithTimestamp(messageType int, timestamp uint) *Message {
+	return &Message{MessageType: messageType, Timestamp: timestamp}
+}
+
+// TestEpochTimer checks that the timer spots new epochs and measures the
+// intervals between them.
+func TestEpochTimer(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	timer := epochTimer{}
+
+	// Ten epochs of GPS and Galileo MSMs, the first nine at intervals of a
+	// second and then a gap of three seconds.  The Galileo messages and
+	// the repeated GPS message don't start new epochs.
+	intervals := []time.Duration{0, 1, 2, 3, 4, 5, 6, 7, 8, 11}
+	for i, seconds := range intervals {
+		arrival := start.Add(seconds * time.Second)
+		timestamp := uint(1000 * (i + 1))
+		timer.record(msmWithTimestamp(utils.MessageTypeMSM7GPS, timestamp), arrival)
+		timer.record(msmWithTimestamp(utils.MessageTypeMSM7GPS, timestamp), arrival.Add(time.Millisecond))
+		timer.record(msmWithTimestamp(utils.MessageTypeMSM7Galileo, timestamp), arrival.Add(2*time.Millisecond))
+	}
+
+	// Messages that aren't MSMs are ignored.
+	timer.record(&Message{MessageType: 1005}, start.Add(time.Hour))
+	timer.record(nil, start.Add(time.Hour))
+
+	// Nine intervals, so the 90th percentile is the longest.
+	want := EpochStats{
+		Epochs:            10,
+		IntervalMillisP50: 1000,
+		IntervalMillisP90: 3000,
+		IntervalMillisP99: 3000,
+		IntervalMillisMax: 3000,
+	}
+
+	got := timer.stats()
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestEpochTimerWindow checks that only the recent intervals are used.
+func TestEpochTimerWindow(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	timer := epochTimer{}
+
+	// A long interval followed by a full window of short ones.
+	arrival := start
+	timer.record(msmWithTimestamp(utils.MessageTypeMSM4GPS, 1), arrival)
+	arrival = arrival.Add(time.Minute)
+	for i := 0; i <= epochIntervalWindow; i++ {
+		timer.record(msmWithTimestamp(utils.MessageTypeMSM4GPS, uint(i+2)), arrival)
+		arrival = arrival.Add(500 * time.Millisecond)
+	}
+
+	got := timer.stats()
+
+	if got.Epochs != epochIntervalWindow+2 {
+		t.Errorf("want %d epochs got %d", epochIntervalWindow+2, got.Epochs)
+	}
+	if got.IntervalMillisMax != 500 {
+		t.Errorf("want the long interval to be forgotten, got max %d", got.IntervalMillisMax)
+	}
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The handler reports the trouble that it finds in the input as events,
+// rather than leaving it to be dug out of the error messages of the
+// Messages.  Each event is counted (see Stats) and sent to any channels
+// that have subscribed:
+//
+//	events := make(chan rtcm.Event, 100)
+//	handler.Subscribe(events)
+//	go func() {
+//	    for event := range events {
+//	        log.Println(event.String())
+//	    }
+//	}()
+//
+// An event is only sent if there's room in the subscriber's channel, so a
+// slow subscriber misses events but never holds up the handler.  The
+// counts include all of the events.
+
+// EventKind says what sort of trouble an event reports.
+type EventKind int
+
+const (
+	// EventCRCFailure is a candidate message frame that failed the CRC
+	// check.
+	EventCRCFailure EventKind = iota
+
+	// EventTruncatedFrame is a message frame that ended before the length
+	// in its leader said it should, for example because the input ended.
+	EventTruncatedFrame
+
+	// EventTimestampOutOfRange is an MSM whose timestamp couldn't be
+	// converted to a time.
+	EventTimestampOutOfRange
+
+	// EventUnknownType is a valid message frame of a type that the handler
+	// can't decode.  It's passed on, but it can't be displayed.
+	EventUnknownType
+
+	// numEventKinds is the number of kinds of event.
+	numEventKinds
+)
+
+// eventKindNames gives the name of each kind of event, as it appears in
+// Stats and in the metrics.
+var eventKindNames = [numEventKinds]string{
+	EventCRCFailure:          "crc_failure",
+	EventTruncatedFrame:      "truncated_frame",
+	EventTimestampOutOfRange: "timestamp_out_of_range",
+	EventUnknownType:         "unknown_type",
+}
+
+// eventKindLevels gives the level of each kind of event.  The errors mean
+// that data was lost or is wrong, the warnings that it was passed on as it
+// was.
+var eventKindLevels = [numEventKinds]slog.Level{
+	EventCRCFailure:          slog.LevelError,
+	EventTruncatedFrame:      slog.LevelWarn,
+	EventTimestampOutOfRange: slog.LevelError,
+	EventUnknownType:         slog.LevelWarn,
+}
+
+// EventKinds returns all of the kinds of event, in order.
+func EventKinds() []EventKind {
+	kinds := make([]EventKind, 0, numEventKinds)
+	for kind := EventKind(0); kind < numEventKinds; kind++ {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// String returns the name of the kind of event, for example "crc_failure".
+func (kind EventKind) String() string {
+	if kind < 0 || kind >= numEventKinds {
+		return fmt.Sprintf("event_%d", int(kind))
+	}
+	return eventKindNames[kind]
+}
+
+// MarshalText gives the name of the kind of event in JSON.
+func (kind EventKind) MarshalText() ([]byte, error) {
+	return []byte(kind.String()), nil
+}
+
+// Level returns the level of the kind of event, slog.LevelError or
+// slog.LevelWarn.
+func (kind EventKind) Level() slog.Level {
+	if kind < 0 || kind >= numEventKinds {
+		return slog.LevelWarn
+	}
+	return eventKindLevels[kind]
+}
+
+// Event reports some trouble found by the handler.
+type Event struct {
+	// Kind says what sort of trouble it is.
+	Kind EventKind `json:"kind"`
+
+	// Level is slog.LevelError or slog.LevelWarn, depending on the kind.
+	Level slog.Level `json:"level"`
+
+	// MessageType is the type of the message concerned, if it's known.
+	MessageType int `json:"message_type"`
+
+	// Detail describes the trouble, for example the error message from
+	// the CRC check.
+	Detail string `json:"detail"`
+
+	// Time is the time at which the handler found the trouble.
+	Time time.Time `json:"time"`
+}
+
+// String returns a readable version of the event, for example "ERROR
+// crc_failure message type 1077 - CRC check failed ...".
+func (event *Event) String() string {
+	return fmt.Sprintf("%s %s message type %d - %s",
+		event.Level.String(), event.Kind.String(), event.MessageType, event.Detail)
+}
+
+// eventStream holds the channels subscribed to a handler's events.
+type eventStream struct {
+	mutex       sync.Mutex
+	subscribers []chan<- Event
+}
+
+// Subscribe arranges for the handler's events to be sent to the channel.
+// The channel should be buffered.  The handler never closes it.
+func (rtcmHandler *Handler) Subscribe(ch chan<- Event) {
+	stream := rtcmHandler.events
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	stream.subscribers = append(stream.subscribers, ch)
+}
+
+// Unsubscribe stops the handler's events going to the channel.
+func (rtcmHandler *Handler) Unsubscribe(ch chan<- Event) {
+	stream := rtcmHandler.events
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	for i := range stream.subscribers {
+		if stream.subscribers[i] == ch {
+			stream.subscribers = append(stream.subscribers[:i], stream.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// report counts an event and sends it to the subscribers.
+func (rtcmHandler *Handler) report(kind EventKind, messageType int, detail string) {
+	if kind >= 0 && kind < numEventKinds {
+		atomic.AddUint64(&rtcmHandler.counters.events[kind], 1)
+	}
+
+	event := Event{
+		Kind:        kind,
+		Level:       kind.Level(),
+		MessageType: messageType,
+		Detail:      detail,
+		Time:        time.Now(),
+	}
+
+	stream := rtcmHandler.events
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	for _, ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// The subscriber is behind.  It misses this one.
+		}
+	}
+}
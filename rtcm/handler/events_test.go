@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestEvents checks that the handler reports each kind of trouble to a
+// subscriber and counts it.
+func TestEvents(t *testing.T) {
+
+	// A Glonass MSM7 with day 7 in its timestamp, which is illegal.
+	badDay := testdata.Retype(testdata.MessageFrameType1077, utils.MessageTypeMSM7Glonass)
+	badDay = badDay[:len(badDay)-utils.CRCLengthBytes]
+	badDay[6] |= 0xe0
+	badDay = addCRC(badDay)
+
+	// A frame whose length says that there's more to come.
+	truncated := testdata.MessageFrameType1005[:10]
+
+	var testData = []struct {
+		description     string
+		bitStream       []byte
+		wantKind        EventKind
+		wantLevel       slog.Level
+		wantMessageType int
+	}{
+		{"CRC", testdata.MessageFrameWithCRCFailure, EventCRCFailure, slog.LevelError, 1230},
+		{"truncated", truncated, EventTruncatedFrame, slog.LevelWarn, 1005},
+		{"timestamp", badDay, EventTimestampOutOfRange, slog.LevelError, utils.MessageTypeMSM7Glonass},
+		{"unknown", testdata.Retype(testdata.MessageFrameType1005, 1033), EventUnknownType, slog.LevelWarn, 1033},
+	}
+	for _, td := range testData {
+		ch := make(chan byte, 10000)
+		for _, b := range td.bitStream {
+			ch <- b
+		}
+		bc := pushback.New(ch)
+		bc.Close()
+
+		handler := New(time.Now(), slog.LevelDebug)
+		events := make(chan Event, 10)
+		handler.Subscribe(events)
+
+		for {
+			_, err := handler.FetchNextMessageFrame(bc)
+			if err != nil && err.Error() == "done" {
+				break
+			}
+		}
+
+		if len(events) != 1 {
+			t.Errorf("%s: want 1 event got %d", td.description, len(events))
+			continue
+		}
+		got := <-events
+		if got.Kind != td.wantKind || got.Level != td.wantLevel || got.MessageType != td.wantMessageType {
+			t.Errorf("%s: want %v %v %d got %v %v %d", td.description,
+				td.wantKind, td.wantLevel, td.wantMessageType, got.Kind, got.Level, got.MessageType)
+		}
+
+		stats := handler.Stats()
+		for _, kind := range EventKinds() {
+			want := uint64(0)
+			if kind == td.wantKind {
+				want = 1
+			}
+			if stats.Events[kind.String()] != want {
+				t.Errorf("%s: want %d %s events got %d", td.description, want, kind, stats.Events[kind.String()])
+			}
+		}
+	}
+}
+
+// TestSubscribe checks that a full channel misses events without holding up
+// the handler, and that an unsubscribed channel gets none.
+func TestSubscribe(t *testing.T) {
+	handler := New(time.Now(), slog.LevelDebug)
+	full := make(chan Event, 1)
+	gone := make(chan Event, 10)
+	handler.Subscribe(full)
+	handler.Subscribe(gone)
+	handler.Unsubscribe(gone)
+
+	for i := 0; i < 3; i++ {
+		handler.report(EventUnknownType, 1033, "")
+	}
+
+	if len(full) != 1 {
+		t.Errorf("want 1 event in the full channel got %d", len(full))
+	}
+	if len(gone) != 0 {
+		t.Errorf("want no events in the unsubscribed channel got %d", len(gone))
+	}
+	if got := handler.Stats().Events["unknown_type"]; got != 3 {
+		t.Errorf("want 3 events counted got %d", got)
+	}
+}
+
+// TestEventString checks the display and the JSON form of an event.
+func TestEventString(t *testing.T) {
+	event := Event{
+		Kind:        EventCRCFailure,
+		Level:       slog.LevelError,
+		MessageType: 1077,
+		Detail:      "CRC check failed",
+		Time:        time.Date(2023, time.May, 15, 12, 0, 0, 0, time.UTC),
+	}
+
+	const wantString = "ERROR crc_failure message type 1077 - CRC check failed"
+	if got := event.String(); got != wantString {
+		t.Errorf("want %s got %s", wantString, got)
+	}
+
+	const wantJSON = `{"kind":"crc_failure","level":"ERROR","message_type":1077,"detail":"CRC check failed","time":"2023-05-15T12:00:00Z"}`
+	got, err := json.Marshal(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != wantJSON {
+		t.Errorf("want %s got %s", wantJSON, string(got))
+	}
+}
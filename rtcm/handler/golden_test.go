@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/type1029"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// update says that the golden files should be rewritten from the current
+// output rather than compared with it:
+//
+//	go test ./rtcm/handler -run TestGolden -update
+//
+// Check the changes with git diff before committing them.
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// goldenDirectory holds the golden files.
+var goldenDirectory = filepath.Join("testdata", "golden")
+
+// decodeAll uses a handler with the given start time and log level to
+// decode the data and returns the messages.
+func decodeAll(startTime time.Time, logLevel slog.Level, data []byte) []Message {
+	ch_source := make(chan byte, len(data))
+	for _, b := range data {
+		ch_source <- b
+	}
+	close(ch_source)
+
+	ch_result := make(chan Message, len(data)+1)
+	New(startTime, logLevel).HandleMessages(ch_source, ch_result)
+
+	messages := make([]Message, 0)
+	for message := range ch_result {
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// TestGolden checks the display of each message type that the handler can
+// decode against the golden files, so that changes to the format are
+// deliberate and show up in a review.
+func TestGolden(t *testing.T) {
+
+	// The test data in MessageFrameType1077 and friends was collected in May
+	// 2023 and the rest in November 2020.
+	may2023 := time.Date(2023, time.May, 15, 0, 0, 0, 0, utils.LocationUTC)
+	november2020 := time.Date(2020, time.November, 13, 0, 0, 0, 0, utils.LocationUTC)
+
+	text, textError := type1029.New(2, may2023, "maintenance at 12:00 UTC", slog.LevelDebug)
+	if textError != nil {
+		t.Fatal(textError)
+	}
+
+	var testData = []struct {
+		name      string
+		startTime time.Time
+		data      []byte
+	}{
+		{"1005", may2023, testdata.MessageFrameType1005},
+		{"1006", may2023, testdata.MessageFrameType1006},
+		{"1029", may2023, text.Frame()},
+		{"1074", may2023, append(append([]byte{}, testdata.MessageFrameType1074_1...), testdata.MessageFrameType1074_2...)},
+		{"1077", may2023, testdata.MessageFrameType1077},
+		{"1077_2020", november2020, testdata.MessageFrame1077},
+		{"1230", may2023, testdata.Fake1230},
+		{"unhandled", may2023, testdata.UnhandledMessageType1024},
+		{"crc_failure", may2023, testdata.MessageFrameWithCRCFailure},
+		{"glonass_illegal_day", november2020, testdata.GlonassMSM7WithIllegalDay},
+		{"batch", november2020, testdata.MessageBatch},
+		{"batch_with_junk", november2020, testdata.MessageBatchWithJunk},
+	}
+
+	// Add the corpus, which covers every type decoded.
+	for _, entry := range testdata.Corpus {
+		testData = append(testData, struct {
+			name      string
+			startTime time.Time
+			data      []byte
+		}{"corpus_" + entry.Name, may2023, entry.Frame})
+	}
+
+	for _, td := range testData {
+		for _, logLevel := range []slog.Level{slog.LevelDebug, slog.LevelInfo} {
+
+			var displays []string
+			for _, message := range decodeAll(td.startTime, logLevel, td.data) {
+				displays = append(displays, message.String())
+			}
+			got := strings.Join(displays, "\n")
+
+			level := strings.ToLower(logLevel.String())
+			fileName := filepath.Join(goldenDirectory, td.name+"."+level+".golden")
+
+			if *update {
+				if err := os.MkdirAll(goldenDirectory, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(fileName, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+
+			want, readError := os.ReadFile(fileName)
+			if readError != nil {
+				t.Errorf("%s - %v - run the test with -update to create it", fileName, readError)
+				continue
+			}
+
+			if string(want) != got {
+				t.Errorf("%s:\n%s", fileName, diff.Diff(string(want), got))
+			}
+		}
+	}
+}
+
+// TestDecodeCorpus checks that each frame in the corpus is decoded as one
+// message of the expected type.  A frame that fails the CRC check comes out
+// as a non-RTCM message, so that's covered too.
+func TestDecodeCorpus(t *testing.T) {
+	startTime := time.Date(2023, time.May, 15, 0, 0, 0, 0, utils.LocationUTC)
+
+	for _, entry := range testdata.Corpus {
+		messages := decodeAll(startTime, slog.LevelInfo, entry.Frame)
+		if len(messages) != 1 {
+			t.Errorf("%s: want 1 message got %d", entry.Name, len(messages))
+			continue
+		}
+
+		message := messages[0]
+		if message.MessageType != entry.MessageType {
+			t.Errorf("%s: want type %d got %d", entry.Name, entry.MessageType, message.MessageType)
+		}
+
+		Analyse(&message)
+		if message.Readable == nil {
+			t.Errorf("%s: not decoded - %s", entry.Name, message.ErrorMessage)
+		}
+
+		if utils.MSM(entry.MessageType) {
+			got := utils.GetConstellation(message.MessageType)
+			if got != entry.Constellation {
+				t.Errorf("%s: want constellation %s got %s", entry.Name, entry.Constellation, got)
+			}
+		}
+	}
+}
@@ -5,17 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"sync"
 	"time"
 
+	"github.com/goblimey/go-ntrip/leapseconds"
+	"github.com/goblimey/go-ntrip/nmea"
 	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/legacy"
 	"github.com/goblimey/go-ntrip/rtcm/pushback"
 	"github.com/goblimey/go-ntrip/rtcm/type1005"
 	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/rtcm/type1019"
+	"github.com/goblimey/go-ntrip/rtcm/type1020"
+	"github.com/goblimey/go-ntrip/rtcm/type1029"
+	"github.com/goblimey/go-ntrip/rtcm/type1042"
+	"github.com/goblimey/go-ntrip/rtcm/type1044"
+	"github.com/goblimey/go-ntrip/rtcm/type1045"
+	"github.com/goblimey/go-ntrip/rtcm/type1230"
+	"github.com/goblimey/go-ntrip/rtcm/type4072"
+	msm123Message "github.com/goblimey/go-ntrip/rtcm/type_msm123/message"
 	msm4Message "github.com/goblimey/go-ntrip/rtcm/type_msm4/message"
+	msm5Message "github.com/goblimey/go-ntrip/rtcm/type_msm5/message"
+	msm6Message "github.com/goblimey/go-ntrip/rtcm/type_msm6/message"
 	msm7Message "github.com/goblimey/go-ntrip/rtcm/type_msm7/message"
 	"github.com/goblimey/go-ntrip/rtcm/utils"
 
-	"github.com/goblimey/go-crc24q/crc24q"
+	"github.com/goblimey/go-ntrip/rtcm/crc24q"
 )
 
 // The rtcm package contains logic to read and decode and display RTCM3
@@ -47,12 +63,22 @@ import (
 //
 // The message's String method can decode RTCM message type 1005 (which
 // gives the base station position) plus MSM7 and MSM4 messages for GPS,
-// Galileo, GLONASS and Beidou (which carry the base station's observations
-// of signals from satellites).  The structure of these messages is
+// Galileo, GLONASS, Beidou, QZSS and SBAS (which carry the base station's
+// observations of signals from satellites).  The timestamps in QZSS and
+// SBAS messages are GPS time, as the RTCM standard specifies, so they are
+// converted in the same way as GPS timestamps, but each constellation
+// tracks its own weekly rollover.  The structure of these messages is
 // described in the RTCM standard, which is not open source.  However, the
 // structure can be reverse-engineered by reading existing software such as
 // the RTKLIB library, which is written in the C programming language.
 //
+// A handler can be shared by goroutines.  However, it tracks the weekly
+// rollover of the timestamps by comparing each message with the one before,
+// so the messages given to it should come from one stream.  An application
+// that decodes several streams, from different base stations for example,
+// should create a handler for each stream with New, then apply the same
+// settings (SetValidationPolicy and so on) to each.
+//
 // For an example of usage, see the displayrtcm3 tool in this repository.
 // The tool reads a stream of message data from a base station and
 // emits a readable version of the messages.  That's useful when you are
@@ -69,7 +95,19 @@ import (
 // defined ready to support emerging equipment that's expected to give
 // better accuracy in the future.
 
-// Handler is the object used to fetch and analyse RTCM3 messages.
+// StartTimeTolerance is how long before the handler's start time a GPS,
+// Galileo, Beidou, QZSS or SBAS message may have been collected and still
+// be given a time close to the start time.  When the handler is reading a
+// live feed, the first few messages may have been collected before it
+// started, and if it started near the weekly rollover, the messages may be
+// from the end of the previous week.  Without the tolerance, a message
+// timestamped a moment before the start time would look like a rollover and
+// be given a time nearly a week later than it should.
+const StartTimeTolerance = time.Minute
+
+// Handler is the object used to fetch and analyse RTCM3 messages.  Its
+// methods are safe for concurrent use, but the Set methods should be called
+// before it's shared.
 type Handler struct {
 
 	// These dates are used to interpret the timestamps in RTCM3
@@ -91,6 +129,14 @@ type Handler struct {
 	// this Beidou week.
 	startOfBeidouWeek time.Time
 
+	// startOfQZSSWeek is the time in UTC of the start of
+	// this QZSS week.
+	startOfQZSSWeek time.Time
+
+	// startOfSBASWeek is the time in UTC of the start of
+	// this SBAS week.
+	startOfSBASWeek time.Time
+
 	// These dates are used to detect the timestamp rolling over into the
 	// next period.  (The strategy assumes that the time gap between
 	// messages is short.)
@@ -107,21 +153,107 @@ type Handler struct {
 	// multiple signal message (MSM).
 	timestampFromPreviousBeidouMessage uint
 
+	// timestampFromPreviousQZSSMessage is the timestamp of the previous QZSS
+	// multiple signal message (MSM).
+	timestampFromPreviousQZSSMessage uint
+
+	// timestampFromPreviousSBASMessage is the timestamp of the previous SBAS
+	// multiple signal message (MSM).
+	timestampFromPreviousSBASMessage uint
+
 	// glonassDayFromPreviousMessage is the day number from the previous Glonass
 	// multiple signal message (MSM).
 	glonassDayFromPreviousMessage uint
 
+	// These flags are false until the handler has seen a GPS, Galileo,
+	// Beidou, QZSS or SBAS message from at or after the start time.  Until
+	// then, the previous timestamp is the one derived from the start time,
+	// and messages from up to StartTimeTolerance before it are handled
+	// specially.  See getUTCFromTimestamp.
+
+	gpsTimeSettled     bool
+	galileoTimeSettled bool
+	beidouTimeSettled  bool
+	qzssTimeSettled    bool
+	sbasTimeSettled    bool
+
+	// weekMutex controls access to the start of week values, the previous
+	// timestamps and the settled flags above, so that the handler can be
+	// shared by goroutines that decode messages.
+	weekMutex sync.Mutex
+
 	// logLevel is a slog-style logging level (Debug, info
 	// etc).  It controls the data that String produces.
 	logLevel slog.Level
+
+	// validationPolicy decides which message frames are accepted as RTCM
+	// and which of those are decoded.
+	validationPolicy ValidationPolicy
+
+	// frameLimits controls the scanning of message frames.
+	frameLimits FrameLimits
+
+	// counters holds running counts of the messages handled.  See Stats.
+	counters *counters
+
+	// events holds the channels subscribed to the handler's events.  See
+	// Subscribe.
+	events *eventStream
+
+	// epochs measures the intervals between epochs.  See Stats.
+	epochs *epochTimer
+
+	// completeness measures the proportion of the expected epochs that
+	// arrived recently.  See Stats.
+	completeness *completenessMeter
+
+	// positionPrecision is the precision in metres to which the base
+	// position is displayed.  See SetPositionPrecision.
+	positionPrecision float64
+
+	// displayLocation is the time zone in which times are displayed.  See
+	// SetDisplayLocation.
+	displayLocation *time.Location
+
+	// clock, if not nil, disciplines the receipt times of the messages.
+	// See SetClockDiscipline.
+	clock *receiptClock
+
+	// parseNMEA is true if NMEA sentences in the non-RTCM data are to be
+	// returned as messages of their own.  See SetNMEAParsing.
+	parseNMEA bool
 }
 
 // New creates a handler using the given year, month and day to
-// identify which week the times in the messages refer to.  The
-// log level controls the String functions.
+// identify which week the times in the messages refer to.  If the stream
+// contains a GPS ephemeris (message type 1019) or a system parameters
+// message (type 1013), the weeks are set from that instead - see
+// setWeekFromMessage - so the start time only matters for the messages
+// before it, and the time of the handler's creation is usually good enough.
+// The log level controls the String functions.
 func New(startTime time.Time, logLevel slog.Level) *Handler {
 
-	level := logLevel
+	handler := Handler{
+		logLevel:         logLevel,
+		validationPolicy: &StrictPolicy{},
+		frameLimits:      DefaultFrameLimits(),
+		counters:         &counters{},
+		events:           &eventStream{},
+		epochs:           &epochTimer{},
+		completeness:     &completenessMeter{},
+	}
+
+	handler.setStartTime(startTime)
+
+	return &handler
+}
+
+// setStartTime sets the start of week values and the previous timestamps
+// from the given time, as if the handler had just been created.  New uses
+// it and so does setWeekFromMessage, when a message in the stream shows
+// that the weeks are wrong.  The caller must hold the week mutex, unless the
+// handler isn't yet shared.
+func (rtcmHandler *Handler) setStartTime(startTime time.Time) {
 
 	// GPS, Galileo and Beidou.  The week for each starts a few leap seconds
 	// before midnight at the end of Saturday in UTC so most of Saturday UTC
@@ -137,10 +269,12 @@ func New(startTime time.Time, logLevel slog.Level) *Handler {
 	startTime = startTime.In(utils.LocationUTC)
 
 	// Shift the start time forward by the number of leap seconds (so if it's
-	// in the last few seconds of Saturday we get a time in Sunday).
-	gpsShift := time.Duration(-1*utils.GPSLeapSeconds) * time.Second
+	// in the last few seconds of Saturday we get a time in Sunday).  The
+	// number depends on the date - see the leapseconds package.
+	leaps := leapseconds.Default()
+	gpsShift := leaps.GPSMinusUTC(startTime)
 	gpsShiftedStartTime := startTime.Add(gpsShift)
-	beidouShift := time.Duration(-1*utils.BeidouLeapSeconds) * time.Second
+	beidouShift := gpsShift - leapseconds.BeidouBehindGPS
 	beidouShiftedStartTime := startTime.Add(beidouShift)
 	glonassShift := time.Duration(-1 * int(utils.GlonassTimeOffset))
 	glonassShiftedStartOfWeek := startTime.Add(glonassShift)
@@ -151,30 +285,104 @@ func New(startTime time.Time, logLevel slog.Level) *Handler {
 	glonassMidnightLastSunday := getStartOfLastSundayUTC(glonassShiftedStartOfWeek)
 
 	// Crank back a few seconds to get the start of the GPS and Beidou weeks.
-	startOfGPSWeek := gpsMidnightLastSunday.Add(utils.GPSTimeOffset)
-	startOfBeidouWeek := beidouMidnightLastSunday.Add(utils.BeidouTimeOffset)
+	// (If there was a leap second between the start of the week and the
+	// start time, the week started one second less before midnight.)
+	startOfGPSWeek := leaps.UTC(gpsMidnightLastSunday)
+	startOfBeidouWeek := leaps.UTC(beidouMidnightLastSunday.Add(leapseconds.BeidouBehindGPS))
 	startOfGlonassWeek := glonassMidnightLastSunday.Add(utils.GlonassTimeOffset)
 
-	// Galileo keeps GPS time.
+	// Galileo keeps GPS time, and the timestamps in QZSS and SBAS messages
+	// are GPS time.
 	startOfGalileoWeek := startOfGPSWeek
+	startOfQZSSWeek := startOfGPSWeek
+	startOfSBASWeek := startOfGPSWeek
 
 	// Set the stored timestamps to match the start time.
 	timestampFromPreviousGPSMessage := (uint(startTime.Sub(startOfGPSWeek).Milliseconds()))
 	timestampFromPreviousGalileoMessage := timestampFromPreviousGPSMessage
+	timestampFromPreviousQZSSMessage := timestampFromPreviousGPSMessage
+	timestampFromPreviousSBASMessage := timestampFromPreviousGPSMessage
 	timestampFromPreviousBeidouMessage := (uint(startTime.Sub(startOfBeidouWeek).Milliseconds()))
 
-	handler := Handler{
-		startOfGPSWeek:                      startOfGPSWeek,
-		startOfGalileoWeek:                  startOfGalileoWeek,
-		startOfBeidouWeek:                   startOfBeidouWeek,
-		startOfGlonassWeek:                  startOfGlonassWeek,
-		timestampFromPreviousGPSMessage:     timestampFromPreviousGPSMessage,
-		timestampFromPreviousGalileoMessage: timestampFromPreviousGalileoMessage,
-		timestampFromPreviousBeidouMessage:  timestampFromPreviousBeidouMessage,
-		logLevel:                            level,
+	rtcmHandler.startOfGPSWeek = startOfGPSWeek
+	rtcmHandler.startOfGalileoWeek = startOfGalileoWeek
+	rtcmHandler.startOfBeidouWeek = startOfBeidouWeek
+	rtcmHandler.startOfGlonassWeek = startOfGlonassWeek
+	rtcmHandler.startOfQZSSWeek = startOfQZSSWeek
+	rtcmHandler.startOfSBASWeek = startOfSBASWeek
+	rtcmHandler.timestampFromPreviousGPSMessage = timestampFromPreviousGPSMessage
+	rtcmHandler.timestampFromPreviousGalileoMessage = timestampFromPreviousGalileoMessage
+	rtcmHandler.timestampFromPreviousBeidouMessage = timestampFromPreviousBeidouMessage
+	rtcmHandler.timestampFromPreviousQZSSMessage = timestampFromPreviousQZSSMessage
+	rtcmHandler.timestampFromPreviousSBASMessage = timestampFromPreviousSBASMessage
+	rtcmHandler.glonassDayFromPreviousMessage = 0
+	rtcmHandler.gpsTimeSettled = false
+	rtcmHandler.galileoTimeSettled = false
+	rtcmHandler.beidouTimeSettled = false
+	rtcmHandler.qzssTimeSettled = false
+	rtcmHandler.sbasTimeSettled = false
+}
+
+// SetValidationPolicy sets the policy that decides which message frames are
+// accepted and decoded.  A nil policy restores the default strict policy.
+func (rtcmHandler *Handler) SetValidationPolicy(policy ValidationPolicy) {
+	if policy == nil {
+		policy = &StrictPolicy{}
 	}
+	rtcmHandler.validationPolicy = policy
+}
 
-	return &handler
+// SetFrameLimits sets the maximum message length, the frame timeout and the
+// resync window.  A zero maximum message length means the standard maximum
+// and the length is capped at MaxExtendedMessageLength.
+func (rtcmHandler *Handler) SetFrameLimits(limits FrameLimits) {
+	if limits.MaxMessageLength == 0 {
+		limits.MaxMessageLength = MaxStandardMessageLength
+	}
+	if limits.MaxMessageLength > MaxExtendedMessageLength {
+		limits.MaxMessageLength = MaxExtendedMessageLength
+	}
+	rtcmHandler.frameLimits = limits
+}
+
+// SetPositionPrecision sets the precision in metres to which the base
+// position in messages of type 1005 and 1006 is displayed, for users who
+// publish their logs or status pages and don't want to give away the exact
+// location of the base station.  Each ECEF coordinate is rounded to the
+// nearest multiple of the precision (100 metres is typical) and the raw
+// frames of those messages aren't displayed.  The messages themselves are
+// passed on unchanged.  Zero, the default, displays the exact position.
+func (rtcmHandler *Handler) SetPositionPrecision(metres float64) {
+	rtcmHandler.positionPrecision = metres
+}
+
+// SetDisplayLocation sets the time zone in which the times in messages are
+// displayed, for field engineers who think in local time.  Nil, the
+// default, displays them in UTC.  Only the readable displays are affected.
+func (rtcmHandler *Handler) SetDisplayLocation(location *time.Location) {
+	rtcmHandler.displayLocation = location
+}
+
+// SetClockDiscipline controls whether the receipt times of the messages
+// are disciplined against the GNSS time in the MSMs, for hosts whose clocks
+// drift.  When it's on, each message carries the corrected receipt time as
+// well as the time from the host clock.  It's off by default.  See clock.go.
+func (rtcmHandler *Handler) SetClockDiscipline(on bool) {
+	if on {
+		rtcmHandler.clock = &receiptClock{}
+	} else {
+		rtcmHandler.clock = nil
+	}
+}
+
+// SetNMEAParsing controls whether NMEA sentences found between the RTCM
+// message frames are picked out of the non-RTCM data.  When it's on, each
+// complete sentence with a good checksum is returned as a message of type
+// NMEAMessage whose Readable part is the parsed sentence, and the data
+// around the sentences is returned as non-RTCM messages as before.  It's
+// off by default.
+func (rtcmHandler *Handler) SetNMEAParsing(on bool) {
+	rtcmHandler.parseNMEA = on
 }
 
 // HandleMessages reads bytes from ch_in, converts them to RTCM
@@ -210,6 +418,25 @@ func (rtcmHandler *Handler) HandleMessages(ch_in chan byte, ch_out chan Message)
 // that (the assumption being that the next call will get no text and the
 // same error).  Use GetMessage to extract the message from the result.
 func (rtcmHandler *Handler) FetchNextMessageFrame(pc *pushback.ByteChannel) (*Message, error) {
+	message, err := rtcmHandler.fetchNextMessageFrame(pc)
+	if rtcmHandler.parseNMEA && err == nil {
+		message = rtcmHandler.splitNMEA(pc, message)
+	}
+	rtcmHandler.counters.countMessage(message)
+	arrival := time.Now()
+	if message != nil {
+		message.ReceivedAt = arrival
+		if rtcmHandler.clock != nil {
+			message.CorrectedReceivedAt = rtcmHandler.clock.correct(arrival, message.SentAt)
+		}
+	}
+	rtcmHandler.epochs.record(message, arrival)
+	rtcmHandler.completeness.record(message, arrival)
+	return message, err
+}
+
+// fetchNextMessageFrame does the work for FetchNextMessageFrame.
+func (rtcmHandler *Handler) fetchNextMessageFrame(pc *pushback.ByteChannel) (*Message, error) {
 
 	// A valid RTCM3 message frame is a leader containing the start of message
 	// byte 0xd3 and two bytes containing a 10-bit message length, zero padded
@@ -238,6 +465,11 @@ func (rtcmHandler *Handler) FetchNextMessageFrame(pc *pushback.ByteChannel) (*Me
 	// phase 1: eat bytes until we see the start of message frame byte.
 	frame, eatError := eatUntilStartOfFrame(pc)
 
+	if rtcmHandler.validationPolicy.DiscardPadding() {
+		// Drop any zero padding that follows the previous frame.
+		frame = trimZeroPadding(frame)
+	}
+
 	if eatError != nil {
 		// The channel is exhausted. If there's nothing in the buffer, return
 		// an error.  If there is something in the buffer, continue and deal
@@ -262,8 +494,10 @@ func (rtcmHandler *Handler) FetchNextMessageFrame(pc *pushback.ByteChannel) (*Me
 		if frame[len(frame)-1] == utils.StartOfMessageFrame {
 			// The non-RTCM is followed by start of message byte.  Push the
 			// start byte back so we see it next time.  Return the rest of the
-			// buffer as a non-RTCM message.
-			pc.PushBack(utils.StartOfMessageFrame)
+			// buffer as a non-RTCM message.  (Resyncing may have left other
+			// bytes in the pushback buffer, so the start byte must go in
+			// front of them.)
+			pc.PushBackAll([]byte{utils.StartOfMessageFrame})
 			frameWithoutTrailingStartByte := frame[:len(frame)-1]
 			return NewNonRTCM(frameWithoutTrailingStartByte), nil
 		} else {
@@ -281,53 +515,134 @@ func (rtcmHandler *Handler) FetchNextMessageFrame(pc *pushback.ByteChannel) (*Me
 
 	const leaderAndMessageLength = utils.LeaderLengthBytes + 2
 
-	for i := 1; i < leaderAndMessageLength; i++ {
-
-		b, err := pc.GetNextByte()
+	// If there is a frame timeout, the rest of the frame must arrive by
+	// the deadline.
+	deadline := time.Now().Add(rtcmHandler.frameLimits.FrameTimeout)
 
-		if err != nil {
-			//Error - presumably end of input.  however, we've already read some
-			// test so return that.  the end of input will be picked up on the
-			// next call.
-			return NewNonRTCM(frame), nil
-		}
-
-		frame = append(frame, b)
+	frame, err := rtcmHandler.appendBytesOfFrame(pc, frame, leaderAndMessageLength-1, deadline)
+	if err != nil {
+		//Error - presumably end of input or timeout.  however, we've
+		// already read some text so return that.  the end of input will
+		// be picked up on the next call.
+		return NewNonRTCM(rtcmHandler.resync(pc, frame)), nil
 	}
 
 	// Figure out the length of the frame. (This may detect that the message is
 	// not RTCM.)
-	messageLength, _, typeError := rtcmHandler.getMessageLengthAndType(frame)
+	messageLength, messageType, typeError := rtcmHandler.getMessageLengthAndType(frame)
 
 	if typeError != nil {
 		// We thought we'd found the start of an RTCM message but it's some
 		// other data that just happens to contain the start of frame byte.
 		// Return the collected data as a non-RTCM message.
-		return NewNonRTCM(frame), nil
+		return NewNonRTCM(rtcmHandler.resync(pc, frame)), nil
 	}
 
 	// Phase 3: get the rest of the message frame.
 
+	// Now that the length is known, the buffer is made big enough for the
+	// whole frame so that it's only allocated once.
 	messageFrameLength := messageLength + utils.LeaderLengthBytes + utils.CRCLengthBytes
 	wantBytes := int(messageFrameLength) - len(frame)
+	wholeFrame := make([]byte, len(frame), messageFrameLength)
+	copy(wholeFrame, frame)
 
-	for i := 0; i < wantBytes; i++ {
-		b, err := pc.GetNextByte()
+	frame, err = rtcmHandler.appendBytesOfFrame(pc, wholeFrame, wantBytes, deadline)
+	if err != nil {
+		//Error - presumably end of input or timeout.  however, we've
+		// already read some text so return that.  the end of input will
+		// be picked up on the next call.
+		rtcmHandler.report(EventTruncatedFrame, messageType,
+			fmt.Sprintf("got %d of %d bytes - %v", len(frame), messageFrameLength, err))
+		return NewNonRTCM(rtcmHandler.resync(pc, frame)), nil
+	}
+
+	// Phase 4: create a message from the frame and return it.  (This also checks
+	// the CRC.  If that fails the text is returned as a non-RTCM message.)
 
+	message, messageError := rtcmHandler.GetMessage(frame)
+	if message != nil && message.MessageType == utils.NonRTCMMessage {
+		// The frame is not valid.  A real one may start inside it.
+		message.RawData = rtcmHandler.resync(pc, message.RawData)
+	}
+
+	return message, messageError
+}
+
+// splitNMEA is called when NMEA parsing is on.  If the message is non-RTCM
+// data, it's cut into NMEA sentences and the data between them.  The first
+// piece is returned, as an NMEA message if it's a valid sentence, and the
+// rest is pushed back to be fetched again.
+func (rtcmHandler *Handler) splitNMEA(pc *pushback.ByteChannel, message *Message) *Message {
+	if message == nil || message.MessageType != utils.NonRTCMMessage ||
+		len(message.ErrorMessage) > 0 {
+
+		return message
+	}
+
+	pieces := nmea.Split(message.RawData)
+	if len(pieces) == 0 {
+		return message
+	}
+	first := pieces[0]
+	if len(first) < len(message.RawData) {
+		pc.PushBackAll(message.RawData[len(first):])
+	}
+
+	parsed, err := nmea.Parse(string(first))
+	if err != nil {
+		return NewNonRTCM(first)
+	}
+
+	nmeaMessage := NewMessage(utils.NMEAMessage, "", first, rtcmHandler.logLevel)
+	nmeaMessage.Readable = parsed
+	return nmeaMessage
+}
+
+// appendBytesOfFrame reads the next n bytes of a message frame and appends
+// them to the frame.  If the handler has a frame timeout, each byte must
+// arrive before the deadline.  Otherwise the bytes are read in one go.  If
+// the input ends or the deadline passes, the frame so far is returned with
+// the error.
+func (rtcmHandler *Handler) appendBytesOfFrame(pc *pushback.ByteChannel, frame []byte, n int, deadline time.Time) ([]byte, error) {
+	if rtcmHandler.frameLimits.FrameTimeout <= 0 {
+		return pc.AppendBytes(frame, n)
+	}
+
+	for i := 0; i < n; i++ {
+		b, err := pc.GetNextByteWithTimeout(time.Until(deadline))
 		if err != nil {
-			//Error - presumably end of input.  however, we've already read some
-			// test so return that.  the end of input will be picked up on the
-			// next call.
-			return NewNonRTCM(frame), nil
+			return frame, err
 		}
-
 		frame = append(frame, b)
 	}
+	return frame, nil
+}
 
-	// Phase 4: create a message from the frame and return it.  (This also checks
-	// the CRC.  If that fails the text is returned as a non-RTCM message.)
+// resync is called when a candidate message frame turns out not to be valid.
+// If the handler has a resync window, it looks for another start of frame
+// byte within the window.  If it finds one, it pushes back the bytes from
+// there on, so they are scanned again, and returns the bytes before it.
+// Otherwise it returns the whole candidate.
+func (rtcmHandler *Handler) resync(pc *pushback.ByteChannel, frame []byte) []byte {
+	window := rtcmHandler.frameLimits.ResyncWindow
+	if window <= 0 {
+		return frame
+	}
+
+	end := len(frame)
+	if window+1 < end {
+		end = window + 1
+	}
+
+	for i := 1; i < end; i++ {
+		if frame[i] == utils.StartOfMessageFrame {
+			pc.PushBackAll(frame[i:])
+			return frame[:i]
+		}
+	}
 
-	return rtcmHandler.GetMessage(frame)
+	return frame
 }
 
 // eatUntilStartOfFrame reads bytes from the channel until it encounters
@@ -335,18 +650,17 @@ func (rtcmHandler *Handler) FetchNextMessageFrame(pc *pushback.ByteChannel) (*Me
 // It returns what it has eaten.  If there is an error (implying that the
 // channel is closed) it returns what it read so far and the error.
 func eatUntilStartOfFrame(pc *pushback.ByteChannel) ([]byte, error) {
-	stuff := make([]byte, 0)
-	for {
-		b, err := pc.GetNextByte()
-		if err != nil {
-			return stuff, err
-		}
-		stuff = append(stuff, b)
+	return pc.AppendUntil(make([]byte, 0), utils.StartOfMessageFrame)
+}
 
-		if b == utils.StartOfMessageFrame {
-			return stuff, nil
+// trimZeroPadding removes any leading zero bytes from the given slice.
+func trimZeroPadding(stuff []byte) []byte {
+	for i := range stuff {
+		if stuff[i] != 0 {
+			return stuff[i:]
 		}
 	}
+	return stuff[len(stuff):]
 }
 
 // getMessageLengthAndType extracts the message length and the message type from an
@@ -364,16 +678,24 @@ func (rtcmHandler *Handler) getMessageLengthAndType(bitStream []byte) (uint, int
 		return 0, utils.NonRTCMMessage, errors.New(message)
 	}
 
-	// The next six bits must be zero.  If not, we've just come across
-	// a 0xd3 byte in a stream of binary data.
-	sanityCheck := utils.GetBitsAsUint64(bitStream, 8, 6)
-	if sanityCheck != 0 {
-		errorMessage := fmt.Sprintf("bits 8-13 of header are %d, must be 0", sanityCheck)
-		return 0, utils.NonRTCMMessage, errors.New(errorMessage)
-	}
+	var length uint
+	if rtcmHandler.frameLimits.MaxMessageLength > MaxStandardMessageLength {
+		// The reserved bits extend the length field, so the bottom sixteen
+		// bits of the leader give the message length.
+		length = uint(utils.GetBitsAsUint64(bitStream, 8, 16))
+	} else {
+		// The next six bits must be zero.  If not, we've just come across
+		// a 0xd3 byte in a stream of binary data.  (Unless the validation
+		// policy says otherwise.)
+		sanityCheck := uint(utils.GetBitsAsUint64(bitStream, 8, 6))
+		if !rtcmHandler.validationPolicy.AcceptReservedBits(sanityCheck) {
+			errorMessage := fmt.Sprintf("bits 8-13 of header are %d, must be 0", sanityCheck)
+			return 0, utils.NonRTCMMessage, errors.New(errorMessage)
+		}
 
-	// The bottom ten bits of the leader give the message length.
-	length := uint(utils.GetBitsAsUint64(bitStream, 14, 10))
+		// The bottom ten bits of the leader give the message length.
+		length = uint(utils.GetBitsAsUint64(bitStream, 14, 10))
+	}
 
 	// The 12-bit message type follows the header.
 	messageType := int(utils.GetBitsAsUint64(bitStream, 24, 12))
@@ -385,6 +707,12 @@ func (rtcmHandler *Handler) getMessageLengthAndType(bitStream []byte) (uint, int
 		return 0, messageType, errors.New(errorMessage)
 	}
 
+	if length > rtcmHandler.frameLimits.MaxMessageLength {
+		errorMessage := fmt.Sprintf("message length %d is more than the maximum %d, type %d",
+			length, rtcmHandler.frameLimits.MaxMessageLength, messageType)
+		return 0, messageType, errors.New(errorMessage)
+	}
+
 	return length, messageType, nil
 }
 
@@ -423,17 +751,23 @@ func (rtcmHandler *Handler) GetMessage(bitStream []byte) (*Message, error) {
 		// in the input stream.)
 		message := NewNonRTCM(bitStream)
 		message.ErrorMessage = "incomplete message frame"
+		rtcmHandler.report(EventTruncatedFrame, messageType,
+			fmt.Sprintf("got %d of %d bytes", frameLength, expectedFrameLength))
 		return message, errors.New(message.ErrorMessage)
 	}
 
 	// We have a complete message.
 
-	// Check the CRC.
-	errorCRC := CheckCRC(messageType, messageLength, bitStream)
-	if errorCRC != nil {
-		message := NewNonRTCM(bitStream)
+	// Check the CRC (unless the validation policy says not to).
+	if rtcmHandler.validationPolicy.CheckCRC(messageType) {
+		errorCRC := CheckCRC(messageType, messageLength, bitStream)
+		if errorCRC != nil {
+			rtcmHandler.counters.countCRCFailure()
+			rtcmHandler.report(EventCRCFailure, messageType, errorCRC.Error())
+			message := NewNonRTCM(bitStream)
 
-		return message, errorCRC
+			return message, errorCRC
+		}
 	}
 
 	// The message is complete and the CRC check passes, so it's valid.
@@ -442,6 +776,27 @@ func (rtcmHandler *Handler) GetMessage(bitStream []byte) (*Message, error) {
 		"",
 		bitStream[:expectedFrameLength],
 		rtcmHandler.logLevel)
+	message.PositionPrecision = rtcmHandler.positionPrecision
+	message.handler = rtcmHandler
+
+	if !message.displayable() {
+		rtcmHandler.report(EventUnknownType, messageType, "the handler cannot decode this message type")
+	}
+
+	if !rtcmHandler.validationPolicy.Decode(messageType) {
+		// The policy says that this message should be passed on without
+		// decoding.  Setting the readable part stops String from trying.
+		message.Readable = fmt.Sprintf(
+			"message type %d accepted without decoding", messageType)
+		return message, nil
+	}
+
+	// A GPS ephemeris or a system parameters message says which week it is.
+	if message.MessageType == utils.MessageType1013 || message.MessageType == utils.MessageType1019 {
+		rtcmHandler.weekMutex.Lock()
+		rtcmHandler.setWeekFromMessage(message.MessageType, message.RawData)
+		rtcmHandler.weekMutex.Unlock()
+	}
 
 	// If the message is an MSM7, get the timestamp (for the heading if displaying)
 	// The message frame is: 3 bytes of leader, a 12-bit message type, a 12-bit
@@ -456,122 +811,191 @@ func (rtcmHandler *Handler) GetMessage(bitStream []byte) (*Message, error) {
 		// station ID and a timestamp.  The timestamp is relative to the start of
 		// the week.  Each constellation's week starts at a different UTC time.
 
+		// A frame can pass the CRC check and still be too short to hold an
+		// MSM header, so check before reading the timestamp.
+		if messageLength*8 < header.MinBitsInHeader {
+			message.ErrorMessage = fmt.Sprintf(
+				"message length %d is too short for an MSM header, type %d", messageLength, messageType)
+			rtcmHandler.report(EventTruncatedFrame, messageType, message.ErrorMessage)
+			return message, errors.New(message.ErrorMessage)
+		}
+
 		const timestampPosition = utils.LeaderLengthBits + header.LenMessageType + header.LenStationID
 
 		message.Timestamp =
 			uint(utils.GetBitsAsUint64(bitStream, timestampPosition, header.LenTimeStamp))
 
-		// Get the time from the timestamp.  This may advance the start of week value.
-		// If there is an error, BOTH the string and the error are returned..
-		sentAt, timeError := rtcmHandler.getTimeDisplayFromTimestamp(message.MessageType, message.Timestamp)
-
-		message.SentAt = sentAt
+		// Get the time from the timestamp.  This may advance the start of
+		// week value, so the lock is held until that's been copied into the
+		// message, so that another goroutine can't move it in between.
+		rtcmHandler.weekMutex.Lock()
+		defer rtcmHandler.weekMutex.Unlock()
 
+		timeError := rtcmHandler.setTimes(message)
 		if timeError != nil {
-			message.ErrorMessage = timeError.Error()
+			rtcmHandler.report(EventTimestampOutOfRange, messageType,
+				fmt.Sprintf("timestamp %d - %v", message.Timestamp, timeError))
 		}
 
-		// If the timestamp puts us into the next week that's now been handled so we can
-		// set the start of week value in the message.
-		message.StartOfWeek = rtcmHandler.getStartTimeDisplay(message.MessageType, message.Timestamp)
-
 		return message, timeError
 	}
 
 	return message, nil
 }
 
-// getTimeDisplayFromTimestamp gets a printable version of the time from the
-// timestamp.  If that provokes an error, BOTH the string and the error
-// are returned.
-func (rtcmHandler Handler) getTimeDisplayFromTimestamp(messageType int, timestamp uint) (string, error) {
-
-	result := "Time "
+// setTimes sets the time values in an MSM from its timestamp.  If the
+// timestamp can't be converted, the error is returned and also recorded in
+// the message.  The caller must hold the week mutex.
+func (rtcmHandler *Handler) setTimes(message *Message) error {
 
-	sentAt, err := rtcmHandler.getTimeFromTimeStamp(messageType, timestamp)
-	if err != nil {
+	message.Constellation = utils.GetConstellation(message.MessageType)
+	message.displayLocation = rtcmHandler.displayLocation
 
+	sentAt, timeError := rtcmHandler.getTimeFromTimeStamp(message.MessageType, message.Timestamp)
+	if timeError != nil {
 		// Error such as timestamp out of range.
-		// Return the string AND the error.
-		result += "(" + err.Error() + ")"
-		return result, err
+		message.ErrorMessage = timeError.Error()
+		message.sentAtError = timeError.Error()
+	} else {
+		message.SentAt = sentAt
 	}
 
-	result += sentAt.Format(utils.DateLayout)
-	return result, nil
-}
-
-func (rtcmHandler Handler) getStartTimeDisplay(messageType int, timestamp uint) string {
-
-	constellation := utils.GetConstellation(messageType)
-
-	display := "Start of " + constellation + " week "
-	startTime, startTimeError := rtcmHandler.getStartOfWeek(messageType)
-	if startTimeError != nil {
+	// If the timestamp puts us into the next week that's now been handled,
+	// so the start of week is the one that the timestamp counts from.
+	startOfWeek, startOfWeekError := rtcmHandler.getStartOfWeek(message.MessageType)
+	if startOfWeekError != nil {
 		// This is one of the constellations we don't handle.
-		display += fmt.Sprintf("(%s)", startTimeError.Error())
+		message.startOfWeekError = startOfWeekError.Error()
 	} else {
-		display += startTime.Format(utils.DateLayout)
+		message.StartOfWeek = startOfWeek
+		message.Week = weekNumber(message.Constellation, startOfWeek)
 	}
 
-	if rtcmHandler.logLevel == slog.LevelDebug {
+	day, millis, parseError := utils.ParseTimestamp(message.Constellation, message.Timestamp)
+	if parseError == nil {
+		message.Day = day
+		message.MillisOfDay = millis
+	}
 
-		display += " plus "
+	return timeError
+}
 
-		days, millisInTimestamp, err := utils.ParseTimestamp(constellation, timestamp)
-		if err != nil {
-			// The timestamp is illegal, for example it's out of range.
-			if utils.GetConstellation(messageType) == "Glonass" {
-				// Illegal Glonass timestamp.  It's in two parts, a
-				// 3-bit day and a 27-bit millisecond offset.
-				display += fmt.Sprintf("%s - 0x%x (%d/%d)",
-					err.Error(), timestamp, timestamp>>27,
-					timestamp&^utils.GlonassDayBitMask)
-				return display
+// weekNumber returns the number of the constellation's week that starts at
+// the given time, counting from the start of the constellation's time scale.
+// GLONASS doesn't number its weeks, so they are counted in the same way as
+// GPS weeks.  The start of week is a few leap seconds away from a whole
+// number of weeks after the origin in UTC, so the result is rounded.
+func weekNumber(constellation string, startOfWeek time.Time) int {
+	var origin time.Time
+	switch constellation {
+	case "Galileo":
+		origin = utils.GalileoTimeOrigin
+	case "Beidou":
+		origin = utils.BeidouTimeOrigin
+	default:
+		origin = utils.GPSTimeOrigin
+	}
 
-			}
-			// Not Glonass and timestamp out of range.  The timestamp
-			// is a millisecond offset from the start of the week.
-			const millisInOneDay = 24 * 3600 * 1000
-			display += fmt.Sprintf("%s - %d (%d/%d)",
-				err.Error(), timestamp, timestamp/millisInOneDay,
-				timestamp%millisInOneDay)
-			return display
-		}
+	const hoursPerWeek = 7 * 24
+	return int(math.Round(startOfWeek.Sub(origin).Hours() / hoursPerWeek))
+}
 
-		// The timestamp is valid.
+// decode decodes a message.  It's a variable to support testing.
+var decode = decodeMessage
 
-		hours, minutes, seconds, millis :=
-			utils.ParseMilliseconds(millisInTimestamp)
+// Analyse decodes the raw byte stream and fills in the broken out message.
+// A bug in a decoder, for example on an exotic message, mustn't stop the
+// messages being passed on, so a panic while decoding is recovered.  It's
+// logged with the frame in hex and the message is left undecoded with an
+// error message.  To have the panic counted in a handler's stats, use
+// Handler.Analyse.
+func Analyse(message *Message) {
+	analyse(message)
+}
 
-		display += fmt.Sprintf("timestamp %d (%dd %dh %dm %ds %dms)",
-			timestamp, days, hours, minutes, seconds, millis)
+// Analyse decodes a message as the package function Analyse does and
+// counts a panic while decoding in the handler's stats.  A message
+// returned by the handler is decoded in this way when it's displayed.
+func (rtcmHandler *Handler) Analyse(message *Message) {
+	if analyse(message) {
+		rtcmHandler.counters.countDecodePanic()
 	}
-
-	return display
 }
 
-// Analyse decodes the raw byte stream and fills in the broken out message.
-func Analyse(message *Message) {
-	var readable interface{}
+// analyse does the work for Analyse.  It returns true if a panic was
+// recovered.
+func analyse(message *Message) (recovered bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			recovered = true
+			slog.Error("panic while decoding a message",
+				"message_type", message.MessageType,
+				"panic", fmt.Sprint(r),
+				"frame", hex.EncodeToString(message.RawData))
+			message.ErrorMessage = fmt.Sprintf("cannot decode the message - %v", r)
+			message.Readable = fmt.Sprintf("message type %d could not be decoded", message.MessageType)
+		}
+	}()
 
+	decode(message)
+	return false
+}
+
+// decodeMessage does the work for Analyse.
+func decodeMessage(message *Message) {
 	switch {
 
+	case utils.MSM123(message.MessageType):
+		analyseMSM123(message.RawData, message)
+
 	case utils.MSM4(message.MessageType):
 		analyseMSM4(message.RawData, message)
 
+	case utils.MSM5(message.MessageType):
+		analyseMSM5(message.RawData, message)
+
+	case utils.MSM6(message.MessageType):
+		analyseMSM6(message.RawData, message)
+
 	case utils.MSM7(message.MessageType):
 		analyseMSM7(message.RawData, message)
 
+	case legacy.Legacy(message.MessageType):
+		analyseLegacy(message.RawData, message)
+
 	case message.MessageType == 1005:
 		analyse1005(message.RawData, message, message.LogLevel)
 
 	case message.MessageType == 1006:
 		analyse1006(message.RawData, message, message.LogLevel)
 
-	case message.MessageType == 1230:
-		readable = "(Message type 1230 - GLONASS code-phase biases - don't know how to decode this)"
-		message.Readable = readable
+	case message.MessageType == utils.MessageType1019:
+		analyse1019(message.RawData, message)
+
+	case message.MessageType == utils.MessageType1020:
+		analyse1020(message.RawData, message)
+
+	case message.MessageType == utils.MessageType1029:
+		analyse1029(message.RawData, message, message.LogLevel)
+
+	case message.MessageType == utils.MessageType1042:
+		analyse1042(message.RawData, message)
+
+	case message.MessageType == utils.MessageType1044:
+		analyse1044(message.RawData, message)
+
+	case message.MessageType == utils.MessageType1045,
+		message.MessageType == utils.MessageType1046:
+		analyseGalileoEphemeris(message.RawData, message)
+
+	case message.MessageType == utils.NMEAMessage:
+		analyseNMEA(message)
+
+	case message.MessageType == utils.MessageTypeGCPB:
+		analyse1230(message.RawData, message)
+
+	case message.MessageType == utils.MessageType4072:
+		analyse4072(message.RawData, message)
 
 	default:
 		readable := fmt.Sprintf("message type %d currently cannot be displayed", message.MessageType)
@@ -579,6 +1003,30 @@ func Analyse(message *Message) {
 	}
 }
 
+// analyseNMEA parses the sentence in an NMEA message.  (The parsed sentence
+// is dropped when the message is copied.)
+func analyseNMEA(message *Message) {
+	parsed, err := nmea.Parse(string(message.RawData))
+	if err != nil {
+		message.ErrorMessage = err.Error()
+		return
+	}
+
+	message.Readable = parsed
+}
+
+func analyseMSM123(messageBitStream []byte, message *Message) {
+	msm123Message, msm123Error :=
+		msm123Message.GetMessage(messageBitStream, message.LogLevel)
+
+	if msm123Error != nil {
+		message.ErrorMessage = msm123Error.Error()
+		return
+	}
+
+	message.Readable = msm123Message
+}
+
 func analyseMSM4(messageBitStream []byte, message *Message) {
 	msm4Message, msm4Error :=
 		msm4Message.GetMessage(messageBitStream, message.LogLevel)
@@ -591,6 +1039,30 @@ func analyseMSM4(messageBitStream []byte, message *Message) {
 	message.Readable = msm4Message
 }
 
+func analyseMSM5(messageBitStream []byte, message *Message) {
+	msm5Message, msm5Error :=
+		msm5Message.GetMessage(messageBitStream, message.LogLevel)
+
+	if msm5Error != nil {
+		message.ErrorMessage = msm5Error.Error()
+		return
+	}
+
+	message.Readable = msm5Message
+}
+
+func analyseMSM6(messageBitStream []byte, message *Message) {
+	msm6Message, msm6Error :=
+		msm6Message.GetMessage(messageBitStream, message.LogLevel)
+
+	if msm6Error != nil {
+		message.ErrorMessage = msm6Error.Error()
+		return
+	}
+
+	message.Readable = msm6Message
+}
+
 func analyseMSM7(messageBitStream []byte, message *Message) {
 	msm7Message, msm7Error :=
 		msm7Message.GetMessage(messageBitStream, message.LogLevel)
@@ -603,6 +1075,16 @@ func analyseMSM7(messageBitStream []byte, message *Message) {
 	message.Readable = msm7Message
 }
 
+func analyseLegacy(messageBitStream []byte, message *Message) {
+	legacyMessage, legacyError := legacy.GetMessage(messageBitStream)
+	if legacyError != nil {
+		message.ErrorMessage = legacyError.Error()
+		return
+	}
+
+	message.Readable = legacyMessage
+}
+
 func analyse1005(messageBitStream []byte, message *Message, logLevel slog.Level) {
 	message1005, message1005Error := type1005.GetMessage(messageBitStream, logLevel)
 	if message1005Error != nil {
@@ -610,6 +1092,10 @@ func analyse1005(messageBitStream []byte, message *Message, logLevel slog.Level)
 		return
 	}
 
+	if message.PositionPrecision > 0 {
+		message1005.Coarsen(message.PositionPrecision)
+	}
+
 	message.Readable = message1005
 }
 
@@ -620,9 +1106,95 @@ func analyse1006(messageBitStream []byte, message *Message, logLevel slog.Level)
 		return
 	}
 
+	if message.PositionPrecision > 0 {
+		message1006.Coarsen(message.PositionPrecision)
+	}
+
 	message.Readable = message1006
 }
 
+func analyse1029(messageBitStream []byte, message *Message, logLevel slog.Level) {
+	message1029, message1029Error := type1029.GetMessage(messageBitStream, logLevel)
+	if message1029Error != nil {
+		message.ErrorMessage = message1029Error.Error()
+		return
+	}
+
+	message.Readable = message1029
+}
+
+func analyse1019(messageBitStream []byte, message *Message) {
+	message1019, message1019Error := type1019.GetMessage(messageBitStream)
+	if message1019Error != nil {
+		message.ErrorMessage = message1019Error.Error()
+		return
+	}
+
+	message.Readable = message1019
+}
+
+func analyse1020(messageBitStream []byte, message *Message) {
+	message1020, message1020Error := type1020.GetMessage(messageBitStream)
+	if message1020Error != nil {
+		message.ErrorMessage = message1020Error.Error()
+		return
+	}
+
+	message.Readable = message1020
+}
+
+func analyse1230(messageBitStream []byte, message *Message) {
+	message1230, message1230Error := type1230.GetMessage(messageBitStream)
+	if message1230Error != nil {
+		message.ErrorMessage = message1230Error.Error()
+		return
+	}
+
+	message.Readable = message1230
+}
+
+func analyse4072(messageBitStream []byte, message *Message) {
+	message4072, message4072Error := type4072.GetMessage(messageBitStream)
+	if message4072Error != nil {
+		message.ErrorMessage = message4072Error.Error()
+		return
+	}
+
+	message.Readable = message4072
+}
+
+func analyse1042(messageBitStream []byte, message *Message) {
+	message1042, message1042Error := type1042.GetMessage(messageBitStream)
+	if message1042Error != nil {
+		message.ErrorMessage = message1042Error.Error()
+		return
+	}
+
+	message.Readable = message1042
+}
+
+func analyse1044(messageBitStream []byte, message *Message) {
+	message1044, message1044Error := type1044.GetMessage(messageBitStream)
+	if message1044Error != nil {
+		message.ErrorMessage = message1044Error.Error()
+		return
+	}
+
+	message.Readable = message1044
+}
+
+// analyseGalileoEphemeris handles messages of type 1045 and 1046, which have
+// the same layout apart from the last few fields.
+func analyseGalileoEphemeris(messageBitStream []byte, message *Message) {
+	ephemeris, ephemerisError := type1045.GetMessage(messageBitStream)
+	if ephemerisError != nil {
+		message.ErrorMessage = ephemerisError.Error()
+		return
+	}
+
+	message.Readable = ephemeris
+}
+
 // getTimeFromTimeStamp converts the 30-bit timestamp in the MSM header to a time value
 // in the UTC timezone.  The message must be an MSM as others don't have a timestamp.
 func (rtcmHandler *Handler) getTimeFromTimeStamp(messageType int, timestamp uint) (time.Time, error) {
@@ -635,30 +1207,25 @@ func (rtcmHandler *Handler) getTimeFromTimeStamp(messageType int, timestamp uint
 	//
 	// The timestamps have a maximum value, so the converter can return an error.
 
-	switch messageType {
-	case utils.MessageTypeMSM4GPS:
+	// All the MSMs of a constellation use the same time system.
+	switch utils.GetConstellation(messageType) {
+	case "GPS":
 		utcTime, err := rtcmHandler.getUTCFromGPSTime(timestamp)
 		return utcTime, err
-	case utils.MessageTypeMSM7GPS:
-		utcTime, err := rtcmHandler.getUTCFromGPSTime(timestamp)
-		return utcTime, err
-	case utils.MessageTypeMSM4Glonass:
-		utcTime, err := rtcmHandler.getUTCFromGlonassTime(timestamp)
-		return utcTime, err
-	case utils.MessageTypeMSM7Glonass:
+	case "Glonass":
 		utcTime, err := rtcmHandler.getUTCFromGlonassTime(timestamp)
 		return utcTime, err
-	case utils.MessageTypeMSM4Galileo:
-		utcTime, err := rtcmHandler.getUTCFromGalileoTime(timestamp)
-		return utcTime, err
-	case utils.MessageTypeMSM7Galileo:
+	case "Galileo":
 		utcTime, err := rtcmHandler.getUTCFromGalileoTime(timestamp)
 		return utcTime, err
-	case utils.MessageTypeMSM4Beidou:
+	case "Beidou":
 		utcTime, err := rtcmHandler.getUTCFromBeidouTime(timestamp)
 		return utcTime, err
-	case utils.MessageTypeMSM7Beidou:
-		utcTime, err := rtcmHandler.getUTCFromBeidouTime(timestamp)
+	case "QZSS":
+		utcTime, err := rtcmHandler.getUTCFromQZSSTime(timestamp)
+		return utcTime, err
+	case "SBAS":
+		utcTime, err := rtcmHandler.getUTCFromSBASTime(timestamp)
 		return utcTime, err
 	default:
 		// This MSM is one that we don't know how to decode.
@@ -672,23 +1239,19 @@ func (rtcmHandler *Handler) getStartOfWeek(messageType int) (time.Time, error) {
 
 	var zeroTimeValue time.Time
 
-	switch messageType {
-	case utils.MessageTypeMSM4GPS:
-		return rtcmHandler.startOfGPSWeek, nil
-	case utils.MessageTypeMSM7GPS:
+	switch utils.GetConstellation(messageType) {
+	case "GPS":
 		return rtcmHandler.startOfGPSWeek, nil
-	case utils.MessageTypeMSM4Glonass:
+	case "Glonass":
 		return rtcmHandler.startOfGlonassWeek, nil
-	case utils.MessageTypeMSM7Glonass:
-		return rtcmHandler.startOfGlonassWeek, nil
-	case utils.MessageTypeMSM4Galileo:
-		return rtcmHandler.startOfGalileoWeek, nil
-	case utils.MessageTypeMSM7Galileo:
+	case "Galileo":
 		return rtcmHandler.startOfGalileoWeek, nil
-	case utils.MessageTypeMSM4Beidou:
-		return rtcmHandler.startOfBeidouWeek, nil
-	case utils.MessageTypeMSM7Beidou:
+	case "Beidou":
 		return rtcmHandler.startOfBeidouWeek, nil
+	case "QZSS":
+		return rtcmHandler.startOfQZSSWeek, nil
+	case "SBAS":
+		return rtcmHandler.startOfSBASWeek, nil
 	default:
 		// This MSM is one that we don't know how to decode.
 		em := fmt.Sprintf("don't know the start of week for message type %d", messageType)
@@ -709,11 +1272,11 @@ func (rtcmHandler *Handler) getUTCFromGPSTime(timestamp uint) (time.Time, error)
 	// week.  If create a handler around then, we have to specify
 	// the start time carefully.
 
-	timeFromTimestamp, newStartOfWeek, err := getUTCFromTimestamp(
+	timeFromTimestamp, newStartOfWeek, late, err := getUTCFromTimestamp(
 		timestamp, rtcmHandler.timestampFromPreviousGPSMessage,
-		rtcmHandler.startOfGPSWeek)
+		rtcmHandler.startOfGPSWeek, rtcmHandler.gpsTimeSettled)
 
-	if err != nil {
+	if err != nil || late {
 		return timeFromTimestamp, err
 	}
 
@@ -722,6 +1285,7 @@ func (rtcmHandler *Handler) getUTCFromGPSTime(timestamp uint) (time.Time, error)
 
 	// Get ready for the next call.
 	rtcmHandler.timestampFromPreviousGPSMessage = timestamp
+	rtcmHandler.gpsTimeSettled = true
 
 	return timeFromTimestamp, nil
 }
@@ -795,12 +1359,12 @@ func (rtcmHandler *Handler) getUTCFromGalileoTime(timestamp uint) (time.Time, er
 	// week.  If create a handler around then, we have to specify
 	// the start time carefully.
 
-	timeFromTimestamp, newStartOfWeek, err := getUTCFromTimestamp(
+	timeFromTimestamp, newStartOfWeek, late, err := getUTCFromTimestamp(
 		timestamp,
 		rtcmHandler.timestampFromPreviousGalileoMessage,
-		rtcmHandler.startOfGPSWeek)
+		rtcmHandler.startOfGalileoWeek, rtcmHandler.galileoTimeSettled)
 
-	if err != nil {
+	if err != nil || late {
 		return timeFromTimestamp, err
 	}
 
@@ -809,6 +1373,7 @@ func (rtcmHandler *Handler) getUTCFromGalileoTime(timestamp uint) (time.Time, er
 
 	// Get ready for the next call.
 	rtcmHandler.timestampFromPreviousGalileoMessage = timestamp
+	rtcmHandler.galileoTimeSettled = true
 
 	return timeFromTimestamp, nil
 }
@@ -827,11 +1392,11 @@ func (rtcmHandler *Handler) getUTCFromBeidouTime(timestamp uint) (time.Time, err
 	// week.  If create a handler around then, we have to specify
 	// the start time carefully.
 
-	timeFromTimestamp, newStartOfWeek, err := getUTCFromTimestamp(
+	timeFromTimestamp, newStartOfWeek, late, err := getUTCFromTimestamp(
 		timestamp, rtcmHandler.timestampFromPreviousBeidouMessage,
-		rtcmHandler.startOfBeidouWeek)
+		rtcmHandler.startOfBeidouWeek, rtcmHandler.beidouTimeSettled)
 
-	if err != nil {
+	if err != nil || late {
 		return timeFromTimestamp, err
 	}
 
@@ -840,6 +1405,57 @@ func (rtcmHandler *Handler) getUTCFromBeidouTime(timestamp uint) (time.Time, err
 
 	// Get ready for the next call.
 	rtcmHandler.timestampFromPreviousBeidouMessage = timestamp
+	rtcmHandler.beidouTimeSettled = true
+
+	return timeFromTimestamp, nil
+}
+
+// getUTCFromQZSSTime converts a QZSS time to UTC, using the start time to
+// find the time of the start of the current week.
+func (rtcmHandler *Handler) getUTCFromQZSSTime(timestamp uint) (time.Time, error) {
+	// QZSS keeps its own time, but the RTCM standard says that the
+	// timestamp in a QZSS MSM is GPS time, so the week starts at the same
+	// moment as the GPS week.  We keep separate state variables.
+
+	timeFromTimestamp, newStartOfWeek, late, err := getUTCFromTimestamp(
+		timestamp, rtcmHandler.timestampFromPreviousQZSSMessage,
+		rtcmHandler.startOfQZSSWeek, rtcmHandler.qzssTimeSettled)
+
+	if err != nil || late {
+		return timeFromTimestamp, err
+	}
+
+	// We may have moved into the next week.
+	rtcmHandler.startOfQZSSWeek = newStartOfWeek
+
+	// Get ready for the next call.
+	rtcmHandler.timestampFromPreviousQZSSMessage = timestamp
+	rtcmHandler.qzssTimeSettled = true
+
+	return timeFromTimestamp, nil
+}
+
+// getUTCFromSBASTime converts an SBAS time to UTC, using the start time to
+// find the time of the start of the current week.
+func (rtcmHandler *Handler) getUTCFromSBASTime(timestamp uint) (time.Time, error) {
+	// SBAS network time is aligned with GPS time and the RTCM standard says
+	// that the timestamp in an SBAS MSM is GPS time, so the week starts at
+	// the same moment as the GPS week.  We keep separate state variables.
+
+	timeFromTimestamp, newStartOfWeek, late, err := getUTCFromTimestamp(
+		timestamp, rtcmHandler.timestampFromPreviousSBASMessage,
+		rtcmHandler.startOfSBASWeek, rtcmHandler.sbasTimeSettled)
+
+	if err != nil || late {
+		return timeFromTimestamp, err
+	}
+
+	// We may have moved into the next week.
+	rtcmHandler.startOfSBASWeek = newStartOfWeek
+
+	// Get ready for the next call.
+	rtcmHandler.timestampFromPreviousSBASMessage = timestamp
+	rtcmHandler.sbasTimeSettled = true
 
 	return timeFromTimestamp, nil
 }
@@ -876,11 +1492,56 @@ type Message struct {
 	// is a Multiple Signal message (MSM).
 	Timestamp uint
 
-	// SentAt is a text version of the time from the timestamp.
-	SentAt string
-
-	// StartOfWeek
-	StartOfWeek string
+	// Constellation is the constellation of an MSM, for example "GPS" or
+	// "Glonass".  It's empty for other messages.
+	Constellation string
+
+	// SentAt is the time from the timestamp of an MSM, in UTC.  It's zero
+	// for other messages and if the timestamp can't be converted.  See
+	// SentAtDisplay.
+	SentAt time.Time
+
+	// StartOfWeek is the time in UTC of the start of the constellation's
+	// week, from which the timestamp of an MSM counts.  It's zero for other
+	// messages and for a constellation whose week isn't known.  See
+	// StartOfWeekDisplay.
+	StartOfWeek time.Time
+
+	// Week is the number of the constellation's week that contains the
+	// timestamp of an MSM - see weekNumber.  It's only set if StartOfWeek
+	// is set.
+	Week int
+
+	// Day is the day of the week from the timestamp of an MSM, 0 to 6.  Day
+	// 0 is Sunday in the constellation's time scale.
+	Day uint
+
+	// MillisOfDay is the number of milliseconds since the start of the day
+	// from the timestamp of an MSM.
+	MillisOfDay uint
+
+	// ReceivedAt is the time, according to the host clock, at which the
+	// handler received the message frame.  It's only set by
+	// FetchNextMessageFrame.
+	ReceivedAt time.Time
+
+	// CorrectedReceivedAt is the receipt time disciplined against the GNSS
+	// time.  It's only set if the handler's clock discipline is on.  See
+	// SetClockDiscipline.
+	CorrectedReceivedAt time.Time
+
+	// sentAtError and startOfWeekError hold the reasons why SentAt and
+	// StartOfWeek couldn't be set, for display.
+	sentAtError      string
+	startOfWeekError string
+
+	// displayLocation is the time zone in which the times are displayed, nil
+	// for UTC.  See Handler.SetDisplayLocation.
+	displayLocation *time.Location
+
+	// handler is the handler that returned the message, if any.  A panic
+	// while decoding the message is counted in its stats.
+	handler *Handler
 
 	// ErrorMessage contains any error message encountered while fetching
 	// the message.
@@ -896,6 +1557,11 @@ type Message struct {
 
 	// LogLevel controls the data produced by String.
 	LogLevel slog.Level
+
+	// PositionPrecision, if not zero, is the precision in metres to which
+	// the base position in a message of type 1005 or 1006 is displayed.
+	// See Handler.SetPositionPrecision.
+	PositionPrecision float64
 }
 
 // NewMessage creates a new message.
@@ -928,13 +1594,108 @@ func (message *Message) Copy() Message {
 	// Create a new message.  Omit the readable part - it may not be needed
 	// and if it is needed, it will be created automatically at that point.
 	var newMessage = Message{
-		MessageType:  message.MessageType,
-		RawData:      rawData,
-		ErrorMessage: message.ErrorMessage,
+		MessageType:       message.MessageType,
+		RawData:           rawData,
+		ErrorMessage:      message.ErrorMessage,
+		PositionPrecision: message.PositionPrecision,
+
+		// The receipt times can't be worked out again from the raw data.
+		ReceivedAt:          message.ReceivedAt,
+		CorrectedReceivedAt: message.CorrectedReceivedAt,
+
+		// A panic while decoding the copy is counted by the same handler.
+		handler: message.handler,
 	}
 	return newMessage
 }
 
+// HidesPosition is true if the message contains the base position and the
+// handler that created it was told to hide the exact position.  The raw
+// frame of such a message should not be displayed.
+func (message *Message) HidesPosition() bool {
+	if message.PositionPrecision <= 0 {
+		return false
+	}
+	return message.MessageType == utils.MessageType1005 ||
+		message.MessageType == utils.MessageType1006
+}
+
+// frameDump returns a hex dump of the raw frame or, if the message hides
+// the position, a note saying why it's missing.
+func (message *Message) frameDump() string {
+	if message.HidesPosition() {
+		return "(not shown - the frame contains the base position)\n"
+	}
+	return hex.Dump(message.RawData)
+}
+
+// SentAtDisplay returns a readable version of the time from the timestamp
+// of an MSM, or the reason why it's not known.
+func (message *Message) SentAtDisplay() string {
+	if len(message.sentAtError) > 0 {
+		return "Time (" + message.sentAtError + ")"
+	}
+	return "Time " + message.displayTime(message.SentAt)
+}
+
+// StartOfWeekDisplay returns a readable version of the start of the
+// constellation's week for an MSM.  At debug level it adds the breakdown of
+// the timestamp.
+func (message *Message) StartOfWeekDisplay() string {
+
+	display := "Start of " + message.Constellation + " week "
+	if len(message.startOfWeekError) > 0 {
+		display += fmt.Sprintf("(%s)", message.startOfWeekError)
+	} else {
+		display += message.displayTime(message.StartOfWeek)
+	}
+
+	if message.LogLevel == slog.LevelDebug {
+
+		display += " plus "
+
+		days, millisInTimestamp, err := utils.ParseTimestamp(message.Constellation, message.Timestamp)
+		if err != nil {
+			// The timestamp is illegal, for example it's out of range.
+			if message.Constellation == "Glonass" {
+				// Illegal Glonass timestamp.  It's in two parts, a
+				// 3-bit day and a 27-bit millisecond offset.
+				display += fmt.Sprintf("%s - 0x%x (%d/%d)",
+					err.Error(), message.Timestamp, message.Timestamp>>27,
+					message.Timestamp&^utils.GlonassDayBitMask)
+				return display
+
+			}
+			// Not Glonass and timestamp out of range.  The timestamp
+			// is a millisecond offset from the start of the week.
+			const millisInOneDay = 24 * 3600 * 1000
+			display += fmt.Sprintf("%s - %d (%d/%d)",
+				err.Error(), message.Timestamp, message.Timestamp/millisInOneDay,
+				message.Timestamp%millisInOneDay)
+			return display
+		}
+
+		// The timestamp is valid.
+
+		hours, minutes, seconds, millis :=
+			utils.ParseMilliseconds(millisInTimestamp)
+
+		display += fmt.Sprintf("timestamp %d (%dd %dh %dm %ds %dms)",
+			message.Timestamp, days, hours, minutes, seconds, millis)
+	}
+
+	return display
+}
+
+// displayTime returns a printable version of the time in the display time
+// zone.
+func (message *Message) displayTime(t time.Time) string {
+	if message.displayLocation != nil {
+		t = t.In(message.displayLocation)
+	}
+	return t.Format(utils.DateLayout)
+}
+
 // String takes the given Message object and returns it
 // as a readable string.
 func (message *Message) String() string {
@@ -962,17 +1723,15 @@ func (message *Message) String() string {
 		if utils.MSM(message.MessageType) {
 			// A Multiple Signal Message (MSM) has a timestamp which gives
 			// the duration since the start of the constellation's week and
-			// the time that the message was sent.  When the handler created
-			// the message it set two strings containing readable versions
-			// of these times.
+			// the time that the message was sent.
 
-			display += message.SentAt + "\n"
-			display += message.StartOfWeek + "\n"
+			display += message.SentAtDisplay() + "\n"
+			display += message.StartOfWeekDisplay() + "\n"
 		}
 
 		display += fmt.Sprintf("Frame length %d bytes:\n", len(message.RawData))
 
-		display += hex.Dump(message.RawData) + "\n"
+		display += message.frameDump() + "\n"
 
 		if len(message.ErrorMessage) > 0 {
 			display += message.ErrorMessage + "\n"
@@ -986,8 +1745,21 @@ func (message *Message) String() string {
 		s, isString := message.Readable.(string)
 		m1005, is1005 := message.Readable.(*type1005.Message)
 		m1006, is1006 := message.Readable.(*type1006.Message)
+		msm123, isMSM123 := message.Readable.(*msm123Message.Message)
 		msm4, isMSM4 := message.Readable.(*msm4Message.Message)
+		msm5, isMSM5 := message.Readable.(*msm5Message.Message)
+		msm6, isMSM6 := message.Readable.(*msm6Message.Message)
 		msm7, isMSM7 := message.Readable.(*msm7Message.Message)
+		m1019, is1019 := message.Readable.(*type1019.Message)
+		m1020, is1020 := message.Readable.(*type1020.Message)
+		m1029, is1029 := message.Readable.(*type1029.Message)
+		m1042, is1042 := message.Readable.(*type1042.Message)
+		m1044, is1044 := message.Readable.(*type1044.Message)
+		galileo, isGalileo := message.Readable.(*type1045.Message)
+		sentence, isNMEA := message.Readable.(*nmea.Parsed)
+		observations, isLegacy := message.Readable.(*legacy.Message)
+		m1230, is1230 := message.Readable.(*type1230.Message)
+		m4072, is4072 := message.Readable.(*type4072.Message)
 		switch {
 		case isString:
 			display += s + "\n"
@@ -999,11 +1771,52 @@ func (message *Message) String() string {
 			// The message is type 1006 - base position and height.
 			display += m1006.String()
 			return display
+		case isMSM123:
+			display += msm123.String()
+
 		case isMSM4:
 			display += msm4.String()
 
+		case isMSM5:
+			display += msm5.String()
+
+		case isMSM6:
+			display += msm6.String()
+
 		case isMSM7:
 			display += msm7.String()
+
+		case is1019:
+			// The message is type 1019 - GPS ephemeris.
+			display += m1019.String()
+		case is1020:
+			// The message is type 1020 - Glonass ephemeris.
+			display += m1020.String()
+		case is1029:
+			// The message is type 1029 - Unicode text.
+			display += m1029.String()
+		case is1042:
+			// The message is type 1042 - Beidou ephemeris.
+			display += m1042.String()
+		case is1044:
+			// The message is type 1044 - QZSS ephemeris.
+			display += m1044.String()
+		case isGalileo:
+			// The message is type 1045 or 1046 - Galileo ephemeris.
+			display += galileo.String()
+		case isNMEA:
+			// The message is an NMEA sentence.
+			display += sentence.String()
+		case isLegacy:
+			// The message is one of the legacy observation messages,
+			// 1001-1004 or 1009-1012.
+			display += observations.String()
+		case is1230:
+			// The message is type 1230 - Glonass code-phase biases.
+			display += m1230.String()
+		case is4072:
+			// The message is type 4072 - u-blox proprietary.
+			display += m4072.String()
 		}
 
 		return display
@@ -1012,7 +1825,7 @@ func (message *Message) String() string {
 
 		display := fmt.Sprintf("Frame length %d bytes:\n", len(message.RawData))
 
-		display += hex.Dump(message.RawData) + "\n"
+		display += message.frameDump() + "\n"
 
 		titleAndComment := utils.GetTitleAndComment(message.MessageType)
 
@@ -1026,12 +1839,10 @@ func (message *Message) String() string {
 		if utils.MSM(message.MessageType) {
 			// A Multiple Signal Message (MSM) has a timestamp which gives
 			// the duration since the start of the constellation's week and
-			// the time that the message was sent.  When the handler created
-			// the message it set two strings containing readable versions
-			// of these times.
+			// the time that the message was sent.
 
-			display += message.SentAt + "\n"
-			display += message.StartOfWeek + "\n"
+			display += message.SentAtDisplay() + "\n"
+			display += message.StartOfWeekDisplay() + "\n"
 		}
 
 		if len(message.ErrorMessage) > 0 {
@@ -1046,8 +1857,21 @@ func (message *Message) String() string {
 		s, isString := message.Readable.(string)
 		m1005, is1005 := message.Readable.(*type1005.Message)
 		m1006, is1006 := message.Readable.(*type1006.Message)
+		msm123, isMSM123 := message.Readable.(*msm123Message.Message)
 		msm4, isMSM4 := message.Readable.(*msm4Message.Message)
+		msm5, isMSM5 := message.Readable.(*msm5Message.Message)
+		msm6, isMSM6 := message.Readable.(*msm6Message.Message)
 		msm7, isMSM7 := message.Readable.(*msm7Message.Message)
+		m1019, is1019 := message.Readable.(*type1019.Message)
+		m1020, is1020 := message.Readable.(*type1020.Message)
+		m1029, is1029 := message.Readable.(*type1029.Message)
+		m1042, is1042 := message.Readable.(*type1042.Message)
+		m1044, is1044 := message.Readable.(*type1044.Message)
+		galileo, isGalileo := message.Readable.(*type1045.Message)
+		sentence, isNMEA := message.Readable.(*nmea.Parsed)
+		observations, isLegacy := message.Readable.(*legacy.Message)
+		m1230, is1230 := message.Readable.(*type1230.Message)
+		m4072, is4072 := message.Readable.(*type4072.Message)
 		switch {
 		case isString:
 			display += s + "\n"
@@ -1059,11 +1883,52 @@ func (message *Message) String() string {
 			// The message is type 1006 - base position and height.
 			display += m1006.String()
 			return display
+		case isMSM123:
+			display += msm123.String()
+
 		case isMSM4:
 			display += msm4.String()
 
+		case isMSM5:
+			display += msm5.String()
+
+		case isMSM6:
+			display += msm6.String()
+
 		case isMSM7:
 			display += msm7.String()
+
+		case is1019:
+			// The message is type 1019 - GPS ephemeris.
+			display += m1019.String()
+		case is1020:
+			// The message is type 1020 - Glonass ephemeris.
+			display += m1020.String()
+		case is1029:
+			// The message is type 1029 - Unicode text.
+			display += m1029.String()
+		case is1042:
+			// The message is type 1042 - Beidou ephemeris.
+			display += m1042.String()
+		case is1044:
+			// The message is type 1044 - QZSS ephemeris.
+			display += m1044.String()
+		case isGalileo:
+			// The message is type 1045 or 1046 - Galileo ephemeris.
+			display += galileo.String()
+		case isNMEA:
+			// The message is an NMEA sentence.
+			display += sentence.String()
+		case isLegacy:
+			// The message is one of the legacy observation messages,
+			// 1001-1004 or 1009-1012.
+			display += observations.String()
+		case is1230:
+			// The message is type 1230 - Glonass code-phase biases.
+			display += m1230.String()
+		case is4072:
+			// The message is type 4072 - u-blox proprietary.
+			display += m4072.String()
 		}
 
 		return display
@@ -1073,15 +1938,27 @@ func (message *Message) String() string {
 // displayable is true if the message type is one that we know how
 // to display in a readable form.
 func (message *Message) displayable() bool {
-	// we currently can display messages of type 1005, MSM4 and MSM7.
+	// we currently can display messages of type 1005, 1006, 1029, 1230, 4072,
+	// the ephemeris messages, the legacy observation messages, all the MSMs
+	// and NMEA sentences.
 
 	if message.MessageType == utils.NonRTCMMessage {
 		return false
 	}
 
 	if utils.MSM(message.MessageType) ||
+		legacy.Legacy(message.MessageType) ||
 		message.MessageType == 1005 ||
-		message.MessageType == 1006 {
+		message.MessageType == 1006 ||
+		message.MessageType == utils.NMEAMessage {
+
+		return true
+	}
+
+	switch message.MessageType {
+	case utils.MessageType1019, utils.MessageType1020, utils.MessageType1029,
+		utils.MessageType1042, utils.MessageType1044, utils.MessageType1045,
+		utils.MessageType1046, utils.MessageTypeGCPB, utils.MessageType4072:
 
 		return true
 	}
@@ -1094,7 +1971,11 @@ func (message *Message) displayable() bool {
 func PrepareForDisplay(message *Message) interface{} {
 	// Do this at most once for each message.
 	if message.Readable == nil {
-		Analyse(message)
+		if message.handler != nil {
+			message.handler.Analyse(message)
+		} else {
+			Analyse(message)
+		}
 	}
 	return message.Readable
 }
@@ -1114,7 +1995,7 @@ func CheckCRC(messageType int, messageLength uint, frame []byte) error {
 	crcLoByte := frame[startOfCRC+2]
 
 	headerAndMessage := frame[:startOfCRC]
-	newCRC := crc24q.Hash(headerAndMessage)
+	newCRC := crc24q.Checksum(headerAndMessage)
 
 	if crc24q.HiByte(newCRC) != crcHiByte ||
 		crc24q.MiByte(newCRC) != crcMiByte ||
@@ -1134,10 +2015,19 @@ func CheckCRC(messageType int, messageLength uint, frame []byte) error {
 	return nil
 }
 
-// getUTCFromTimestamp converts a GPS, Galileo or Beidou timestamp to UTC
-// using the given start time to find the correct week.  If the timestamp
-// has rolled over, The returned start time is the start of the next week.
-func getUTCFromTimestamp(timestamp, timestampFromPreviousMessage uint, startOfWeek time.Time) (timeFromTimestamp, newStartOfWeek time.Time, rangeError error) {
+// getUTCFromTimestamp converts a GPS, Galileo, Beidou, QZSS or SBAS timestamp
+// to UTC using the given start time to find the correct week.  If the
+// timestamp has rolled over, The returned start time is the start of the next
+// week.
+//
+// If settled is false, the previous timestamp is the one derived from the
+// handler's start time rather than one from a real message.  A message
+// timestamped up to StartTimeTolerance before the start time is then late:
+// it was collected before the handler started.  It's given a time in the
+// week in which it was collected, which may be the week before, and late
+// is returned true, meaning that the caller should not update its record of
+// the previous timestamp or the start of week.
+func getUTCFromTimestamp(timestamp, timestampFromPreviousMessage uint, startOfWeek time.Time, settled bool) (timeFromTimestamp, newStartOfWeek time.Time, late bool, rangeError error) {
 	// GPS, Galileo and Beidou each measure time within a week starting on a
 	// Sunday, but at different times.  The timestamp in a multiple signal
 	// message (MSM) is milliseconds since the start of week.  If the timestamp
@@ -1147,20 +2037,63 @@ func getUTCFromTimestamp(timestamp, timestampFromPreviousMessage uint, startOfWe
 	if timestamp > utils.MaxTimestamp {
 		var zeroTimeValue time.Time // 0001-01-01 00:00:00 +0000 UTC.
 		rangeError = errors.New("timestamp out of range")
-		return zeroTimeValue, startOfWeek, rangeError
+		return zeroTimeValue, startOfWeek, false, rangeError
+	}
+
+	durationSinceStart := time.Duration(timestamp) * time.Millisecond
+
+	// The times below assume that the offset between the constellation's
+	// time and UTC is the same as it was at the start of the week.  If a
+	// leap second has happened since, allowForLeapSecond corrects them.
+	allowForLeapSecond := leapSecondCorrector(startOfWeek)
+
+	if !settled {
+		const tolerance = uint(StartTimeTolerance / time.Millisecond)
+		const week = utils.MaxTimestamp + 1
+
+		if timestamp < timestampFromPreviousMessage &&
+			timestampFromPreviousMessage-timestamp <= tolerance {
+			// The message was collected shortly before the start time, in
+			// the same week.  This is not a rollover.
+			return allowForLeapSecond(startOfWeek.Add(durationSinceStart)), startOfWeek, true, nil
+		}
+
+		if timestamp > timestampFromPreviousMessage &&
+			timestampFromPreviousMessage+week-timestamp <= tolerance {
+			// The handler was started just after the rollover and the
+			// message was collected just before it, in the previous week.
+			// This is typically a GPS message timestamped in the last few
+			// seconds of the GPS week, which is just before midnight at the
+			// end of Saturday UTC.
+			previousWeek := startOfWeek.AddDate(0, 0, -7)
+			return allowForLeapSecond(previousWeek.Add(durationSinceStart)), startOfWeek, true, nil
+		}
 	}
 
 	// watch for the timestamp rolling over.
 	if timestampFromPreviousMessage > timestamp {
 		// The timestamp has rolled over
 		newStartOfWeek = startOfWeek.AddDate(0, 0, 7) // Move to the next week.
+		timeFromTimestamp = allowForLeapSecond(newStartOfWeek.Add(durationSinceStart))
+		newStartOfWeek = allowForLeapSecond(newStartOfWeek)
 	} else {
 		newStartOfWeek = startOfWeek // Stay in the same week.
+		timeFromTimestamp = allowForLeapSecond(newStartOfWeek.Add(durationSinceStart))
 	}
 
-	durationSinceStart := time.Duration(timestamp) * time.Millisecond
-
-	timeFromTimestamp = newStartOfWeek.Add(durationSinceStart)
+	return timeFromTimestamp, newStartOfWeek, false, nil
+}
 
-	return timeFromTimestamp, newStartOfWeek, nil
+// leapSecondCorrector returns a function that corrects a time worked out by
+// adding a timestamp to the start of the week, for GPS and the other
+// constellations that keep a time scale locked to GPS time.  Adding the
+// timestamp assumes that the offset from UTC is the same as it was at the
+// start of the week.  If a leap second has happened since then, the offset
+// is one second more and the time is one second later than it should be.
+func leapSecondCorrector(startOfWeek time.Time) func(time.Time) time.Time {
+	leaps := leapseconds.Default()
+	offsetAtStart := leaps.GPSMinusUTC(startOfWeek)
+	return func(t time.Time) time.Time {
+		return leaps.UTC(t.Add(offsetAtStart))
+	}
 }
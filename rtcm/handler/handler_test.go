@@ -5,14 +5,20 @@ import (
 	"bytes"
 	"log/slog"
 	"math"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/goblimey/go-ntrip/nmea"
 	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/legacy"
 	"github.com/goblimey/go-ntrip/rtcm/pushback"
 	"github.com/goblimey/go-ntrip/rtcm/testdata"
 	"github.com/goblimey/go-ntrip/rtcm/type1005"
 	"github.com/goblimey/go-ntrip/rtcm/type1006"
+	"github.com/goblimey/go-ntrip/rtcm/type1029"
+	"github.com/goblimey/go-ntrip/rtcm/type1230"
 	msm4message "github.com/goblimey/go-ntrip/rtcm/type_msm4/message"
 	msm4satellite "github.com/goblimey/go-ntrip/rtcm/type_msm4/satellite"
 	msm4signal "github.com/goblimey/go-ntrip/rtcm/type_msm4/signal"
@@ -22,6 +28,13 @@ import (
 	"github.com/kylelemons/godebug/diff"
 )
 
+// gpsTimeOffset and beidouTimeOffset convert GPS and Beidou times to UTC.
+// The test data all comes from after the leap second at the end of 2016,
+// since when GPS time has been 18 seconds ahead of UTC and Beidou time,
+// which is 14 seconds behind GPS time, 4 seconds ahead.
+const gpsTimeOffset = -18 * time.Second
+const beidouTimeOffset = -4 * time.Second
+
 // A complete message frame (including 3-byte leader and 3-byte CRC).
 // The message type is the bottom half of byte 3 and all of byte 4 -
 // 0x449 - decimal 1097.
@@ -601,8 +614,8 @@ func TestGetLastSundayUTC(t *testing.T) {
 
 }
 
-// TestStartTimes checks that New sets the correct start of week for GPS, Galileo
-// and Beidou.  (Glonass keeps time using a slightly different system).
+// TestStartTimes checks that New sets the correct start of week for GPS, Galileo,
+// Beidou, QZSS and SBAS.  (Glonass keeps time using a slightly different system).
 func TestStartTimes(t *testing.T) {
 
 	// The timestamp is the number of milliseconds since the start of week, which is
@@ -629,29 +642,29 @@ func TestStartTimes(t *testing.T) {
 			//just before 1am BST is just before midnight UTC.
 			"Sunday 2020/08/02 BST, just before the end of the week.", "GPS", 1074,
 			time.Date(2020, time.August, 9, 00, 59, 41, int(999*time.Millisecond), utils.LocationLondon),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.GPSTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(gpsTimeOffset),
 		},
 		{
 			//just before 1am BST is just before midnight UTC.
 			"Sunday 2020/08/02 BST, just before the end of the week.", "GPS", 1077,
 			time.Date(2020, time.August, 9, 00, 59, 41, int(999*time.Millisecond), utils.LocationLondon),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.GPSTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(gpsTimeOffset),
 		},
 		{
 			"Saturday 2nd August, start of week", "GPS", 1077,
 			time.Date(2020, time.August, 2, 0, 59, 42, 0, utils.LocationLondon),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.GPSTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(gpsTimeOffset),
 		},
 		{
 			"Wednesday 2020/08/05", "GPS", 1077,
 			time.Date(2020, time.August, 5, 12, 0, 0, 0, utils.LocationLondon),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.GPSTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(gpsTimeOffset),
 		},
 		{
 			//just before 1am BST is just before midnight UTC.
 			"Sunday 2020/08/02 BST, just before the end of the week.", "GPS", 1077,
 			time.Date(2020, time.August, 9, 00, 59, 41, int(999*time.Millisecond), utils.LocationLondon),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.GPSTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(gpsTimeOffset),
 		},
 		{
 			"Sunday 2020/09/02 CET, at the start of the next week", "GPS", 1077,
@@ -693,39 +706,49 @@ func TestStartTimes(t *testing.T) {
 			time.Date(2020, time.August, 9, 1, 59, 44, 0, utils.LocationParis),
 			time.Date(2020, time.August, 8, 23, 59, 42, 0, utils.LocationUTC),
 		},
+		{
+			"Wednesday 2020/08/05", "QZSS", 1117,
+			time.Date(2020, time.August, 5, 12, 0, 0, 0, utils.LocationLondon),
+			time.Date(2020, time.August, 1, 23, 59, 42, 0, utils.LocationUTC),
+		},
+		{
+			"Wednesday 2020/08/05", "SBAS", 1104,
+			time.Date(2020, time.August, 5, 12, 0, 0, 0, utils.LocationLondon),
+			time.Date(2020, time.August, 1, 23, 59, 42, 0, utils.LocationUTC),
+		},
 		{
 			// This start time should be at the end of the previous week ...
 			"Saturday 8th August, end of week", "Beidou", 1124,
 			time.Date(2020, time.August, 8, 23, 59, 55, int(999*time.Millisecond), utils.LocationUTC),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 		},
 		{
 			// This start time should be at the end of the previous week ...
 			"Saturday 8th August, end of week", "Beidou", 1127,
 			time.Date(2020, time.August, 8, 23, 59, 55, int(999*time.Millisecond), utils.LocationUTC),
-			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 2, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 		},
 		{
 			// ... and this one too.
 			"Sunday 9th Aug", "Beidou", 1127,
 			time.Date(2020, time.August, 9, 1, 0, 0, 0, utils.LocationUTC),
-			time.Date(2020, time.August, 9, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 9, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 		},
 		{
 			// Saturday 15th, just before rollover.
 			"4", "Beidou", 1127,
 			time.Date(2020, time.August, 15, 23, 59, 55, int(999*time.Millisecond), utils.LocationUTC),
-			time.Date(2020, time.August, 9, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 9, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 		},
 		{
 			"start of next week", "Beidou", 1127,
 			time.Date(2020, time.August, 15, 23, 59, 56, 0, utils.LocationUTC),
-			time.Date(2020, time.August, 16, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 16, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 		},
 		{
 			"one second after the start of the next week", "Beidou", 1127,
 			time.Date(2020, time.August, 15, 23, 59, 57, 0, utils.LocationUTC),
-			time.Date(2020, time.August, 16, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 16, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 		},
 	}
 
@@ -964,6 +987,203 @@ func TestAnalyseWith1005(t *testing.T) {
 	}
 }
 
+// TestPositionPrecision checks that a handler told to hide the base position
+// coarsens the displayed position and doesn't display the raw frame.
+func TestPositionPrecision(t *testing.T) {
+	handler := New(time.Now(), slog.LevelInfo)
+	handler.SetPositionPrecision(100)
+
+	message, err := handler.GetMessage(testdata.MessageFrameType1005)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !message.HidesPosition() {
+		t.Error("want the message to hide the position")
+	}
+
+	// The copy must hide the position too.
+	c := message.Copy()
+	if !c.HidesPosition() {
+		t.Error("want the copy to hide the position")
+	}
+
+	display := message.String()
+
+	if !strings.Contains(display, "(not shown - the frame contains the base position)") {
+		t.Errorf("want the frame hidden, got\n%s", display)
+	}
+	if strings.Contains(display, "00000000  d3") {
+		t.Errorf("want no hex dump, got\n%s", display)
+	}
+
+	m1005, ok := message.Readable.(*type1005.Message)
+	if !ok {
+		t.Fatal("expecting Readable to contain a message type 1005")
+	}
+	const step = 1000000 // 100 metres in units of 0.1 mm.
+	if m1005.AntennaRefX%step != 0 || m1005.AntennaRefY%step != 0 || m1005.AntennaRefZ%step != 0 {
+		t.Errorf("want coordinates rounded to 100 m, got %v", m1005)
+	}
+
+	// Other messages are displayed as usual.
+	msm, msmError := handler.GetMessage(testdata.MessageFrameType1077)
+	if msmError != nil {
+		t.Fatal(msmError)
+	}
+	if msm.HidesPosition() {
+		t.Error("want an MSM not to hide anything")
+	}
+}
+
+// TestGetMessageConcurrently checks that a handler can be shared by
+// goroutines that decode messages.  Run with -race to see any data race.
+func TestGetMessageConcurrently(t *testing.T) {
+	const goroutines = 8
+	const messagesEach = 50
+
+	startTime := time.Date(2023, time.February, 14, 1, 2, 3, 0, utils.LocationUTC)
+
+	want, err := New(startTime, slog.LevelDebug).GetMessage(testdata.MessageFrameType1077)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := New(startTime, slog.LevelDebug)
+
+	var wg sync.WaitGroup
+	results := make(chan string, goroutines*messagesEach)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messagesEach; j++ {
+				message, messageError := handler.GetMessage(testdata.MessageFrameType1077)
+				if messageError != nil {
+					results <- messageError.Error()
+					continue
+				}
+				results <- message.SentAtDisplay() + " " + message.StartOfWeekDisplay()
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	for got := range results {
+		if got != want.SentAtDisplay()+" "+want.StartOfWeekDisplay() {
+			t.Errorf("want %s %s got %s", want.SentAtDisplay(), want.StartOfWeekDisplay(), got)
+			break
+		}
+	}
+}
+
+// TestDisplayLocation checks that the times in a message are displayed in
+// the chosen time zone.
+func TestDisplayLocation(t *testing.T) {
+	startTime := time.Date(2023, time.May, 15, 0, 0, 0, 0, utils.LocationUTC)
+
+	var testData = []struct {
+		location      *time.Location
+		wantSentAt    string
+		wantWeekStart string
+	}{
+		{nil, "Time 2023-05-19 00:00:05 +0000 UTC",
+			"Start of GPS week 2023-05-13 23:59:42 +0000 UTC"},
+		{time.FixedZone("BST", 3600), "Time 2023-05-19 01:00:05 +0100 BST",
+			"Start of GPS week 2023-05-14 00:59:42 +0100 BST"},
+	}
+	for _, td := range testData {
+		handler := New(startTime, slog.LevelDebug)
+		handler.SetDisplayLocation(td.location)
+
+		message, err := handler.GetMessage(testdata.MessageFrameType1077)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if message.SentAtDisplay() != td.wantSentAt {
+			t.Errorf("want %s got %s", td.wantSentAt, message.SentAtDisplay())
+		}
+		if !strings.HasPrefix(message.StartOfWeekDisplay(), td.wantWeekStart) {
+			t.Errorf("want %s got %s", td.wantWeekStart, message.StartOfWeekDisplay())
+		}
+	}
+}
+
+// TestTimeFields checks the time values that GetMessage sets in an MSM.
+func TestTimeFields(t *testing.T) {
+	startTime := time.Date(2023, time.May, 15, 0, 0, 0, 0, utils.LocationUTC)
+
+	var testData = []struct {
+		description     string
+		frame           []byte
+		wantSentAt      time.Time
+		wantStartOfWeek time.Time
+		wantWeek        int
+		wantDay         uint
+		wantMillis      uint
+	}{
+		{"GPS", testdata.MessageFrameType1077,
+			time.Date(2023, time.May, 19, 0, 0, 5, 0, utils.LocationUTC),
+			time.Date(2023, time.May, 13, 23, 59, 42, 0, utils.LocationUTC),
+			2262, 5, 23000},
+	}
+	for _, td := range testData {
+		handler := New(startTime, slog.LevelDebug)
+		handler.SetDisplayLocation(time.FixedZone("BST", 3600))
+
+		message, err := handler.GetMessage(td.frame)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if message.Constellation != td.description {
+			t.Errorf("%s: want constellation %s got %s", td.description, td.description, message.Constellation)
+		}
+		if !message.SentAt.Equal(td.wantSentAt) || message.SentAt.Location() != time.UTC {
+			t.Errorf("%s: want sent at %v got %v", td.description, td.wantSentAt, message.SentAt)
+		}
+		if !message.StartOfWeek.Equal(td.wantStartOfWeek) {
+			t.Errorf("%s: want start of week %v got %v", td.description, td.wantStartOfWeek, message.StartOfWeek)
+		}
+		if message.Week != td.wantWeek {
+			t.Errorf("%s: want week %d got %d", td.description, td.wantWeek, message.Week)
+		}
+		if message.Day != td.wantDay || message.MillisOfDay != td.wantMillis {
+			t.Errorf("%s: want day %d millis %d got %d %d", td.description,
+				td.wantDay, td.wantMillis, message.Day, message.MillisOfDay)
+		}
+	}
+}
+
+// TestWeekNumber checks that weekNumber counts from the origin of each
+// constellation's time scale.
+func TestWeekNumber(t *testing.T) {
+	var testData = []struct {
+		constellation string
+		startOfWeek   time.Time
+		want          int
+	}{
+		{"GPS", time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC), 0},
+		{"GPS", time.Date(2023, time.May, 13, 23, 59, 42, 0, time.UTC), 2262},
+		{"QZSS", time.Date(2023, time.May, 13, 23, 59, 42, 0, time.UTC), 2262},
+		// Galileo week numbers are 1024 behind GPS week numbers.
+		{"Galileo", time.Date(2023, time.May, 13, 23, 59, 42, 0, time.UTC), 1238},
+		// Beidou week numbers are 1356 behind GPS week numbers.
+		{"Beidou", time.Date(2023, time.May, 13, 23, 59, 56, 0, time.UTC), 906},
+		{"Glonass", time.Date(2023, time.May, 13, 21, 0, 0, 0, time.UTC), 2262},
+	}
+	for _, td := range testData {
+		got := weekNumber(td.constellation, td.startOfWeek)
+		if got != td.want {
+			t.Errorf("%s %v: want %d got %d", td.constellation, td.startOfWeek, td.want, got)
+		}
+	}
+}
+
 // TestAnalyseWith1006 checks that Analyse correctly handles a message type 1006 (base position and height).
 func TestAnalyseWith1006(t *testing.T) {
 
@@ -988,8 +1208,120 @@ func TestAnalyseWith1006(t *testing.T) {
 	}
 }
 
+// TestAnalyseWith1029 checks that Analyse correctly handles a message type 1029
+// (text) and that the frame created by type1029 passes the CRC check.
+func TestAnalyseWith1029(t *testing.T) {
+
+	text, _ := type1029.New(2, time.Now(), "maintenance at 12:00 UTC", slog.LevelDebug)
+	frame := text.Frame()
+
+	messageLength := uint(len(frame) - utils.LeaderLengthBytes - utils.CRCLengthBytes)
+	crcError := CheckCRC(utils.MessageType1029, messageLength, frame)
+	if crcError != nil {
+		t.Error(crcError)
+	}
+
+	message := NewMessage(
+		utils.MessageType1029,
+		"",
+		frame,
+		slog.LevelDebug,
+	)
+
+	Analyse(message)
+
+	if message.Readable == nil {
+		t.Error("Readable is nil")
+		return
+	}
+
+	got, ok := message.Readable.(*type1029.Message)
+
+	if !ok {
+		t.Error("expecting Readable to contain a message type 1029")
+		return
+	}
+
+	if got.Text != "maintenance at 12:00 UTC" {
+		t.Errorf("want the text, got %q", got.Text)
+	}
+}
+
+// TestStringWith1029 checks that a message type 1029 fetched by GetMessage
+// is displayed with its text and doesn't raise an unknown type event.
+func TestStringWith1029(t *testing.T) {
+	const want = "Frame length 35 bytes:\n" +
+		"00000000  d3 00 1d 40 50 02 ea af  54 60 14 14 67 6f 2d 6e  |...@P...T`..go-n|\n" +
+		"00000010  74 72 69 70 20 74 65 73  74 20 63 6f 72 70 75 73  |trip test corpus|\n" +
+		"00000020  58 97 b1                                          |X..|\n" +
+		"\n" +
+		"Message type 1029, Unicode Text String\n" +
+		"A message which provides a simple way to send short textual strings " +
+		"within the RTCM message set. About ~128 UTF-8 encoded characters are allowed.\n" +
+		"stationID 2, sent at 2023-05-15 12:00:00 +0000 UTC\n" +
+		"text \"go-ntrip test corpus\"\n"
+	rtcmHandler := New(time.Now(), slog.LevelInfo)
+	events := make(chan Event, 1)
+	rtcmHandler.Subscribe(events)
+
+	message, err := rtcmHandler.GetMessage(testdata.MessageFrameType1029)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.String()
+	if got != want {
+		t.Error(diff.Diff(want, got))
+	}
+
+	if len(events) != 0 {
+		event := <-events
+		t.Errorf("want no events, got %s", event.String())
+	}
+}
+
+// TestAnalyseWithLegacy checks that Analyse correctly handles a legacy
+// observation message type 1004 and that the frame created by the legacy
+// package passes the CRC check.
+func TestAnalyseWithLegacy(t *testing.T) {
+
+	observations := legacy.Message{
+		Header: legacy.Header{MessageType: 1004, StationID: 2, EpochTime: 1000},
+		Satellites: []legacy.Satellite{
+			{ID: 5, L1Pseudorange: 1000000, L1Ambiguity: 70, L1CNR: 180},
+		},
+	}
+	frame := observations.Frame()
+
+	messageLength := uint(len(frame) - utils.LeaderLengthBytes - utils.CRCLengthBytes)
+	crcError := CheckCRC(1004, messageLength, frame)
+	if crcError != nil {
+		t.Error(crcError)
+	}
+
+	message := NewMessage(1004, "", frame, slog.LevelDebug)
+
+	Analyse(message)
+
+	got, ok := message.Readable.(*legacy.Message)
+
+	if !ok {
+		t.Errorf("expecting Readable to contain a legacy message, got %v - %s",
+			message.Readable, message.ErrorMessage)
+		return
+	}
+
+	if len(got.Satellites) != 1 || got.Satellites[0].ID != 5 {
+		t.Errorf("want satellite 5, got %v", got.Satellites)
+	}
+
+	if !strings.Contains(message.String(), "Satellite ID {L1 code") {
+		t.Errorf("want the observations displayed, got\n%s", message.String())
+	}
+}
+
 // TestAnalyseWith1230 checks that Analyse correctly handles a message of type 1230
-// (the correct behaviour being to set the Readable field to a string).
+// (Glonass code-phase biases).
 func TestAnalyseWith1230(t *testing.T) {
 
 	message := NewMessage(
@@ -1001,10 +1333,15 @@ func TestAnalyseWith1230(t *testing.T) {
 
 	Analyse(message)
 
-	_, ok := message.Readable.(string)
+	got, ok := message.Readable.(*type1230.Message)
 
 	if !ok {
-		t.Error("expecting Readable to contain a string")
+		t.Error("expecting Readable to contain a message type 1230")
+		return
+	}
+
+	if !got.Present(type1230.L1CA) || !got.Present(type1230.L2CA) {
+		t.Errorf("want L1 C/A and L2 C/A biases, got mask %#x", got.SignalsMask)
 	}
 }
 
@@ -1046,7 +1383,7 @@ func TestConversionOfTimeToUTC(t *testing.T) {
 			"Beidou",
 			// midnight Sunday 9th August - 8th just before midnight in Beidou time,
 			// start of the Beidou week.  Stored timestamp is zero.
-			time.Date(2020, time.August, 9, 0, 0, 0, 0, utils.LocationUTC).Add(utils.BeidouTimeOffset),
+			time.Date(2020, time.August, 9, 0, 0, 0, 0, utils.LocationUTC).Add(beidouTimeOffset),
 			utils.MessageTypeMSM7Beidou,
 			// wantStartOfWeek1
 			time.Date(2020, time.August, 8, 23, 59, 56, 0, utils.LocationUTC),
@@ -1112,14 +1449,50 @@ func TestConversionOfTimeToUTC(t *testing.T) {
 			time.Date(2020, time.August, 8, 23, 59, 42, 0, utils.LocationUTC),
 			(((52*3600)+1800)*1000 + 300), // 2 days, 4.5 hours  plus 300 ms in ms.
 			time.Date(2020, time.August, 10, 04, 29, 42, int(300*time.Millisecond), utils.LocationUTC).
-				Add(utils.GPSTimeOffset),
+				Add(gpsTimeOffset),
+			(((74*3600)+30)*1000 + 700), // 3 days 2 hours 30 secondsand 400 ms.
+			time.Date(2020, time.August, 12, 23, 59, 30, int(700*time.Millisecond), utils.LocationUTC),
+			((2 * 3600 * 1000) + 4), // rolled over to the next day
+			// 2020-08-08 23:59:42.
+
+			time.Date(2020, time.August, 16, 00, 00, 00, 0, utils.LocationUTC).
+				Add(gpsTimeOffset),
+			time.Date(2020, time.August, 16, 1, 59, 42, int(4*time.Millisecond), utils.LocationUTC),
+		},
+		{
+			"QZSS",
+			// Monday 10th Aug.  Paris is two hours ahead of UTC.
+			time.Date(2020, time.August, 10, 23, 0, 0, 0, utils.LocationParis),
+			utils.MessageTypeMSM7QZSS,
+			time.Date(2020, time.August, 8, 23, 59, 42, 0, utils.LocationUTC),
+			(((52*3600)+1800)*1000 + 300), // 2 days, 4.5 hours  plus 300 ms in ms.
+			time.Date(2020, time.August, 10, 04, 29, 42, int(300*time.Millisecond), utils.LocationUTC).
+				Add(gpsTimeOffset),
+			(((74*3600)+30)*1000 + 700), // 3 days 2 hours 30 secondsand 400 ms.
+			time.Date(2020, time.August, 12, 23, 59, 30, int(700*time.Millisecond), utils.LocationUTC),
+			((2 * 3600 * 1000) + 4), // rolled over to the next day
+			// 2020-08-08 23:59:42.
+
+			time.Date(2020, time.August, 16, 00, 00, 00, 0, utils.LocationUTC).
+				Add(gpsTimeOffset),
+			time.Date(2020, time.August, 16, 1, 59, 42, int(4*time.Millisecond), utils.LocationUTC),
+		},
+		{
+			"SBAS",
+			// Monday 10th Aug.  Paris is two hours ahead of UTC.
+			time.Date(2020, time.August, 10, 23, 0, 0, 0, utils.LocationParis),
+			utils.MessageTypeMSM4SBAS,
+			time.Date(2020, time.August, 8, 23, 59, 42, 0, utils.LocationUTC),
+			(((52*3600)+1800)*1000 + 300), // 2 days, 4.5 hours  plus 300 ms in ms.
+			time.Date(2020, time.August, 10, 04, 29, 42, int(300*time.Millisecond), utils.LocationUTC).
+				Add(gpsTimeOffset),
 			(((74*3600)+30)*1000 + 700), // 3 days 2 hours 30 secondsand 400 ms.
 			time.Date(2020, time.August, 12, 23, 59, 30, int(700*time.Millisecond), utils.LocationUTC),
 			((2 * 3600 * 1000) + 4), // rolled over to the next day
 			// 2020-08-08 23:59:42.
 
 			time.Date(2020, time.August, 16, 00, 00, 00, 0, utils.LocationUTC).
-				Add(utils.GPSTimeOffset),
+				Add(gpsTimeOffset),
 			time.Date(2020, time.August, 16, 1, 59, 42, int(4*time.Millisecond), utils.LocationUTC),
 		},
 	}
@@ -1184,6 +1557,191 @@ func TestConversionOfTimeToUTC(t *testing.T) {
 	}
 }
 
+// TestConversionOfTimeToUTCWithLeapSeconds checks that the handler uses
+// the leap seconds in force at the time, both for data collected before the
+// last leap second and for a week that contains one.
+func TestConversionOfTimeToUTCWithLeapSeconds(t *testing.T) {
+	const day = 24 * 3600 * 1000
+	var testData = []struct {
+		description     string
+		startTime       time.Time
+		messageType     int
+		timestamps      []uint
+		wantTimes       []time.Time
+		wantStartOfWeek time.Time
+	}{
+		{
+			// In March 2012 GPS time was 15 seconds ahead of UTC.
+			"GPS in 2012",
+			time.Date(2012, time.March, 7, 12, 0, 0, 0, utils.LocationUTC),
+			utils.MessageTypeMSM4GPS,
+			[]uint{3*day + 13*3600*1000},
+			[]time.Time{time.Date(2012, time.March, 7, 12, 59, 45, 0, utils.LocationUTC)},
+			time.Date(2012, time.March, 3, 23, 59, 45, 0, utils.LocationUTC),
+		},
+		{
+			// Beidou time is always 14 seconds behind GPS time.
+			"Beidou in 2012",
+			time.Date(2012, time.March, 7, 12, 0, 0, 0, utils.LocationUTC),
+			utils.MessageTypeMSM7Beidou,
+			[]uint{3*day + 13*3600*1000},
+			[]time.Time{time.Date(2012, time.March, 7, 12, 59, 59, 0, utils.LocationUTC)},
+			time.Date(2012, time.March, 3, 23, 59, 59, 0, utils.LocationUTC),
+		},
+		{
+			// The leap second at the end of 2016 came 17 seconds into the
+			// GPS week.  The week after started one second nearer midnight.
+			"GPS across the leap second at the end of 2016",
+			time.Date(2016, time.December, 29, 12, 0, 0, 0, utils.LocationUTC),
+			utils.MessageTypeMSM7GPS,
+			[]uint{5 * day, 1000, 20000, 6 * day, 1000},
+			[]time.Time{
+				time.Date(2016, time.December, 29, 23, 59, 43, 0, utils.LocationUTC),
+				time.Date(2016, time.December, 31, 23, 59, 44, 0, utils.LocationUTC),
+				time.Date(2017, time.January, 1, 0, 0, 2, 0, utils.LocationUTC),
+				time.Date(2017, time.January, 6, 23, 59, 42, 0, utils.LocationUTC),
+				time.Date(2017, time.January, 7, 23, 59, 43, 0, utils.LocationUTC),
+			},
+			time.Date(2017, time.January, 7, 23, 59, 42, 0, utils.LocationUTC),
+		},
+	}
+	for _, td := range testData {
+		handler := New(td.startTime, slog.LevelDebug)
+		for i, timestamp := range td.timestamps {
+			got, err := handler.getTimeFromTimeStamp(td.messageType, timestamp)
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+				continue
+			}
+			if !td.wantTimes[i].Equal(got) {
+				t.Errorf("%s: timestamp %d want %s got %s", td.description, timestamp,
+					td.wantTimes[i].Format(utils.DateLayout), got.Format(utils.DateLayout))
+			}
+		}
+
+		gotStartOfWeek := getStartOfWeek(td.messageType, handler)
+		if !td.wantStartOfWeek.Equal(gotStartOfWeek) {
+			t.Errorf("%s: start of week want %s got %s", td.description,
+				td.wantStartOfWeek.Format(utils.DateLayout), gotStartOfWeek.Format(utils.DateLayout))
+		}
+	}
+}
+
+// TestConversionOfTimeToUTCNearRollover checks the handling of messages
+// that arrive within StartTimeTolerance of the start time, particularly when
+// the handler is started in the leap second window at the end of the
+// Saturday.  (The GPS and Galileo weeks start 18 seconds before midnight UTC
+// and the Beidou week 4 seconds before.)  A message collected shortly before
+// the start time is given the time when it was collected, in whichever week
+// that was.  Once the handler has seen a message from at or after the start
+// time, any fall in the timestamp is taken as a rollover.
+func TestConversionOfTimeToUTCNearRollover(t *testing.T) {
+
+	const week = utils.MaxTimestamp + 1
+
+	// The rollovers at the end of Saturday 8th August 2020.
+	gpsRollover := time.Date(2020, time.August, 8, 23, 59, 42, 0, utils.LocationUTC)
+	beidouRollover := time.Date(2020, time.August, 8, 23, 59, 56, 0, utils.LocationUTC)
+
+	var testData = []struct {
+		description string
+		startTime   time.Time
+		messageType int
+		timestamps  []uint
+		want        []time.Time
+	}{
+		{
+			"GPS, started in the leap second window, message from the new week",
+			gpsRollover.Add(8 * time.Second),
+			utils.MessageTypeMSM7GPS,
+			[]uint{9000},
+			[]time.Time{gpsRollover.Add(9 * time.Second)},
+		},
+		{
+			"GPS, started in the leap second window, message from the old week",
+			gpsRollover.Add(8 * time.Second),
+			utils.MessageTypeMSM7GPS,
+			[]uint{week - 5000, 9000, 10000},
+			[]time.Time{
+				gpsRollover.Add(-5 * time.Second),
+				gpsRollover.Add(9 * time.Second),
+				gpsRollover.Add(10 * time.Second),
+			},
+		},
+		{
+			"GPS, started just after the rollover, message from nearly a minute before",
+			gpsRollover.Add(time.Second),
+			utils.MessageTypeMSM4GPS,
+			[]uint{week - 58000, 2000},
+			[]time.Time{gpsRollover.Add(-58 * time.Second), gpsRollover.Add(2 * time.Second)},
+		},
+		{
+			"GPS, started before the rollover, message from a moment before the start time",
+			gpsRollover.Add(-12 * time.Second),
+			utils.MessageTypeMSM7GPS,
+			[]uint{week - 13000, week - 11000, 1000},
+			[]time.Time{
+				gpsRollover.Add(-13 * time.Second),
+				gpsRollover.Add(-11 * time.Second),
+				gpsRollover.Add(time.Second),
+			},
+		},
+		{
+			"GPS, started before the rollover, first message after it",
+			gpsRollover.Add(-12 * time.Second),
+			utils.MessageTypeMSM7GPS,
+			[]uint{1000},
+			[]time.Time{gpsRollover.Add(time.Second)},
+		},
+		{
+			"GPS, message collected more than the tolerance before the start time",
+			gpsRollover.Add(72 * time.Hour),
+			utils.MessageTypeMSM7GPS,
+			[]uint{(72 * 3600 * 1000) - 61000},
+			[]time.Time{gpsRollover.Add(7*24*time.Hour + 72*time.Hour - 61*time.Second)},
+		},
+		{
+			"Galileo, started in the leap second window, message from the old week",
+			gpsRollover.Add(8 * time.Second),
+			utils.MessageTypeMSM7Galileo,
+			[]uint{week - 5000, 9000},
+			[]time.Time{gpsRollover.Add(-5 * time.Second), gpsRollover.Add(9 * time.Second)},
+		},
+		{
+			"Beidou, started in the leap second window, message from the old week",
+			beidouRollover.Add(2 * time.Second),
+			utils.MessageTypeMSM7Beidou,
+			[]uint{week - 1000, 3000},
+			[]time.Time{beidouRollover.Add(-time.Second), beidouRollover.Add(3 * time.Second)},
+		},
+		{
+			"Beidou, started before the rollover, message from a moment before the start time",
+			beidouRollover.Add(-2 * time.Second),
+			utils.MessageTypeMSM4Beidou,
+			[]uint{week - 3000, 500},
+			[]time.Time{beidouRollover.Add(-3 * time.Second), beidouRollover.Add(500 * time.Millisecond)},
+		},
+	}
+	for _, td := range testData {
+
+		handler := New(td.startTime, slog.LevelDebug)
+
+		for i, timestamp := range td.timestamps {
+			got, err := handler.getTimeFromTimeStamp(td.messageType, timestamp)
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+				break
+			}
+
+			if !td.want[i].Equal(got) {
+				t.Errorf("%s: message %d want %s got %s",
+					td.description, i+1,
+					td.want[i].Format(time.RFC3339Nano), got.Format(time.RFC3339Nano))
+			}
+		}
+	}
+}
+
 // getStartOfWeek is a helper function.   It gets the start of the constellation's
 // current period. (For Glonass the start of the current day.  For the rest, the start
 // of the current week.)
@@ -1199,6 +1757,10 @@ func getStartOfWeek(messageType int, handler *Handler) time.Time {
 		return handler.startOfGlonassWeek
 	case "Beidou":
 		return handler.startOfBeidouWeek
+	case "QZSS":
+		return handler.startOfQZSSWeek
+	case "SBAS":
+		return handler.startOfSBASWeek
 	}
 
 	var zeroTime time.Time
@@ -1234,7 +1796,9 @@ func TestGetTimeFromTimeStampWithError(t *testing.T) {
 		{"Galileo MSM7", createHeader(utils.MessageTypeMSM7Galileo, math.MaxInt32/2+1), "timestamp out of range"},
 		{"Beidou MSM4", createHeader(utils.MessageTypeMSM4Beidou, utils.MaxTimestamp+2), "timestamp out of range"},
 		{"Beidou MSM7", createHeader(utils.MessageTypeMSM7Beidou, 0x40000000), "timestamp out of range"},
-		{"SBAS MSM7", createHeader(utils.MessageTypeMSM7SBAS, 0x40000000), "unknown message type"},
+		{"QZSS MSM4", createHeader(utils.MessageTypeMSM4QZSS, utils.MaxTimestamp+1), "timestamp out of range"},
+		{"SBAS MSM7", createHeader(utils.MessageTypeMSM7SBAS, 0x40000000), "timestamp out of range"},
+		{"NavIC MSM7", createHeader(utils.MessageTypeMSM7NavicIrnss, 1), "unknown message type"},
 	}
 
 	for _, td := range testData {
@@ -1456,9 +2020,10 @@ func createRTCMWithMSM4(msm4 *msm4message.Message, startOfWeek time.Time) *Messa
 	)
 	message.Readable = msm4
 	// In the real world these values would be set by handler.GetMessage.
-	message.SentAt = "Time 2023-02-11 23:59:42.002 +0000 UTC"
-	message.StartOfWeek =
-		"Start of GPS week 2023-02-11 23:59:42 +0000 UTC plus timestamp 2 (0d 0h 0m 0s 2ms)"
+	message.Timestamp = 2
+	message.Constellation = "GPS"
+	message.StartOfWeek = startOfWeek
+	message.SentAt = startOfWeek.Add(2 * time.Millisecond)
 
 	return message
 }
@@ -1750,9 +2315,10 @@ message type 1074 is not an MSM7
 		slog.LevelDebug,
 	)
 	incompleteMessage.Readable = incompleteMSM4
-	incompleteMessage.SentAt = "Time 2023-02-11 23:59:42.002 +0000 UTC"
-	incompleteMessage.StartOfWeek =
-		"Start of GPS week 2023-02-11 23:59:42 +0000 UTC plus timestamp 2 (0d 0h 0m 0s 2ms)"
+	incompleteMessage.Timestamp = 2
+	incompleteMessage.Constellation = "GPS"
+	incompleteMessage.StartOfWeek = startOfWeek
+	incompleteMessage.SentAt = startOfWeek.Add(2 * time.Millisecond)
 
 	// These messages have the wrong message type, which are
 	// treated as special cases.
@@ -1768,9 +2334,10 @@ message type 1074 is not an MSM7
 		testdata.MessageFrameType1077,
 		slog.LevelDebug,
 	)
-	crazyMSM4.SentAt = "Time 2023-02-11 23:59:42.002 +0000 UTC"
-	crazyMSM4.StartOfWeek =
-		"Start of GPS week 2023-02-11 23:59:42 +0000 UTC plus timestamp 2 (0d 0h 0m 0s 2ms)"
+	crazyMSM4.Timestamp = 2
+	crazyMSM4.Constellation = "GPS"
+	crazyMSM4.StartOfWeek = startOfWeek
+	crazyMSM4.SentAt = startOfWeek.Add(2 * time.Millisecond)
 	// This one is an MSM4 but the message type is forced to be MSM7.
 	crazyMSM7 := NewMessage(
 		utils.MessageTypeMSM7Galileo,
@@ -1779,9 +2346,10 @@ message type 1074 is not an MSM7
 		slog.LevelDebug,
 	)
 	crazyMSM7.MessageType = utils.MessageTypeMSM7Galileo
-	crazyMSM7.SentAt = "Time 2023-02-11 23:59:42.002 +0000 UTC"
-	crazyMSM7.StartOfWeek =
-		"Start of GPS week 2023-02-11 23:59:42 +0000 UTC plus timestamp 2 (0d 0h 0m 0s 2ms)"
+	crazyMSM7.Timestamp = 2
+	crazyMSM7.Constellation = "GPS"
+	crazyMSM7.StartOfWeek = startOfWeek
+	crazyMSM7.SentAt = startOfWeek.Add(2 * time.Millisecond)
 
 	rtcmHandler := New(startTime, slog.LevelDebug)
 
@@ -1941,19 +2509,35 @@ func TestDisplayable(t *testing.T) {
 		want        bool
 	}{
 		{utils.NonRTCMMessage, false},
+		{1001, true},
+		{1004, true},
+		{1009, true},
+		{1012, true},
+		{1013, false},
 		{1005, true},
 		{1006, true},
-		{1076, false},
+		{1019, true},
+		{1020, true},
+		{1042, true},
+		{1044, true},
+		{1045, true},
+		{1046, true},
+		{1029, true},
+		{1230, true},
+		{1071, true},
+		{1075, true},
+		{1076, true},
+		{1078, false},
 		{1074, true},
 		{1077, true},
 		{1107, true},
-		{1116, false},
+		{1116, true},
 		{1117, true},
 		{1118, false},
 		{1127, true},
 		{1134, true},
 		{1137, true},
-		{1136, false},
+		{1136, true},
 		{1137, true},
 		{1138, false},
 	}
@@ -1971,8 +2555,8 @@ func TestDisplayable(t *testing.T) {
 	}
 }
 
-// TestGetTimeDisplayFromTimestamp checks getTimeDisplayFromTimestamp.
-func TestGetTimeDisplayFromTimestamp(t *testing.T) {
+// TestSentAtDisplay checks the display of the time from the timestamp.
+func TestSentAtDisplay(t *testing.T) {
 
 	const timestampTooBig = 0x40000000
 
@@ -1983,6 +2567,8 @@ func TestGetTimeDisplayFromTimestamp(t *testing.T) {
 		wantDisplay string
 	}{
 		{utils.MessageTypeMSM7Galileo, 3 * 24 * 3600 * 1000, "", "Time 2023-02-14 23:59:42 +0000 UTC"},
+		{utils.MessageTypeMSM7QZSS, 3 * 24 * 3600 * 1000, "", "Time 2023-02-14 23:59:42 +0000 UTC"},
+		{utils.MessageTypeMSM4SBAS, 3 * 24 * 3600 * 1000, "", "Time 2023-02-14 23:59:42 +0000 UTC"},
 		{utils.MessageTypeMSM7GPS, timestampTooBig, "timestamp out of range", "Time (timestamp out of range)"},
 	}
 	for _, td := range testData {
@@ -1991,7 +2577,10 @@ func TestGetTimeDisplayFromTimestamp(t *testing.T) {
 
 		h := New(startTime, slog.LevelDebug)
 
-		display, displayErr := h.getTimeDisplayFromTimestamp(td.messageType, td.timestamp)
+		message := NewMessage(td.messageType, "", nil, slog.LevelDebug)
+		message.Timestamp = td.timestamp
+		displayErr := h.setTimes(message)
+		display := message.SentAtDisplay()
 
 		if len(td.wantError) > 0 {
 			if displayErr == nil {
@@ -2013,8 +2602,8 @@ func TestGetTimeDisplayFromTimestamp(t *testing.T) {
 	}
 }
 
-// TestGetStartTimeDisplay checks getStartTimeDisplay.
-func TestGetStartTimeDisplay(t *testing.T) {
+// TestStartOfWeekDisplay checks the display of the start of the week.
+func TestStartOfWeekDisplay(t *testing.T) {
 
 	const maxTimestamp = ((((6*24 + 23) * 3600) + 59*60 + 59) * 1000) + 999
 	const timestampTooBig = utils.MaxTimestamp + 1
@@ -2029,8 +2618,14 @@ func TestGetStartTimeDisplay(t *testing.T) {
 			"Start of Glonass week 2023-02-11 21:00:00 +0000 UTC plus timestamp 891706367 (6d 23h 59m 59s 999ms)"},
 		{utils.MessageTypeMSM7Galileo, maxTimestamp,
 			"Start of Galileo week 2023-02-11 23:59:42 +0000 UTC plus timestamp 604799999 (6d 23h 59m 59s 999ms)"},
+		// The time is found first, so a small timestamp moves the week on
+		// from the start time.
 		{utils.MessageTypeMSM7SBAS, 1,
-			"Start of SBAS week (don't know the start of week for message type 1107) plus timestamp 1 (0d 0h 0m 0s 1ms)"},
+			"Start of SBAS week 2023-02-18 23:59:42 +0000 UTC plus timestamp 1 (0d 0h 0m 0s 1ms)"},
+		{utils.MessageTypeMSM4QZSS, 1,
+			"Start of QZSS week 2023-02-18 23:59:42 +0000 UTC plus timestamp 1 (0d 0h 0m 0s 1ms)"},
+		{utils.MessageTypeMSM7NavicIrnss, 1,
+			"Start of NavIC/IRNSS week (don't know the start of week for message type 1137) plus timestamp 1 (0d 0h 0m 0s 1ms)"},
 		{utils.MessageTypeMSM7Glonass, glonassTimestampTooBig,
 			"Start of Glonass week 2023-02-11 21:00:00 +0000 UTC plus timestamp out of range - 0x35265c00 (6/86400000)"},
 		{utils.MessageTypeMSM7Galileo, timestampTooBig,
@@ -2042,10 +2637,177 @@ func TestGetStartTimeDisplay(t *testing.T) {
 
 		h := New(startTime, slog.LevelDebug)
 
-		display := h.getStartTimeDisplay(td.messageType, td.timestamp)
+		message := NewMessage(td.messageType, "", nil, slog.LevelDebug)
+		message.Timestamp = td.timestamp
+		h.setTimes(message)
+		display := message.StartOfWeekDisplay()
 
 		if td.wantDisplay != display {
 			t.Error(diff.Diff(td.wantDisplay, display))
 		}
 	}
 }
+
+// TestAnalyseRecoversFromPanic checks that a panic in a decoder leaves the
+// message undecoded and is counted by the handler that returned the
+// message, and only by that handler.
+func TestAnalyseRecoversFromPanic(t *testing.T) {
+	saved := decode
+	defer func() { decode = saved }()
+	decode = func(message *Message) {
+		var cells []int
+		_ = cells[message.MessageType] // Index out of range.
+	}
+
+	handler := New(time.Now(), slog.LevelDebug)
+	other := New(time.Now(), slog.LevelDebug)
+
+	message, err := handler.GetMessage(testdata.MessageFrameType1077)
+	if message == nil {
+		t.Fatal(err)
+	}
+
+	// Displaying the message decodes it.
+	display := message.String()
+
+	const wantError = "cannot decode the message - runtime error: index out of range [1077] with length 0"
+	if message.ErrorMessage != wantError {
+		t.Errorf("want error %s got %s", wantError, message.ErrorMessage)
+	}
+
+	const wantReadable = "message type 1077 could not be decoded"
+	if message.Readable != wantReadable {
+		t.Errorf("want readable %s got %v", wantReadable, message.Readable)
+	}
+
+	// The display shows the error rather than panicking again.
+	if !strings.Contains(display, wantError) {
+		t.Errorf("want the error in the display, got\n%s", display)
+	}
+
+	if got := handler.Stats().DecodePanics; got != 1 {
+		t.Errorf("want 1 panic got %d", got)
+	}
+	if got := other.Stats().DecodePanics; got != 0 {
+		t.Errorf("want no panics in the other handler, got %d", got)
+	}
+
+	// The package function recovers but doesn't count.
+	loose := NewMessage(utils.MessageTypeMSM7GPS, "", testdata.MessageFrameType1077, slog.LevelDebug)
+	Analyse(loose)
+	if loose.ErrorMessage != wantError {
+		t.Errorf("want error %s got %s", wantError, loose.ErrorMessage)
+	}
+	if got := handler.Stats().DecodePanics; got != 1 {
+		t.Errorf("want 1 panic got %d", got)
+	}
+}
+
+// TestGetMessageShortMSM checks that an MSM frame that passes the CRC check
+// but is too short to hold an MSM header is returned with an error rather
+// than causing a panic.
+func TestGetMessageShortMSM(t *testing.T) {
+	// A type 1077 with a message length of 2 - just the message type and
+	// half of the station ID.
+	frame := []byte{0xd3, 0x00, 0x02, 0x43, 0x50, 0x00, 0x00, 0x00}
+	utils.SetCRC(frame)
+
+	handler := New(time.Now(), slog.LevelDebug)
+	message, err := handler.GetMessage(frame)
+
+	const wantError = "message length 2 is too short for an MSM header, type 1077"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+	if message == nil {
+		t.Fatal("want a message")
+	}
+	if message.MessageType != 1077 || message.ErrorMessage != wantError {
+		t.Errorf("want type 1077 with error %s, got type %d with error %s",
+			wantError, message.MessageType, message.ErrorMessage)
+	}
+	if got := handler.Stats().Events["truncated_frame"]; got != 1 {
+		t.Errorf("want 1 truncated frame event got %d", got)
+	}
+}
+
+// TestNMEAParsing checks that the NMEA sentences in the non-RTCM data are
+// picked out when NMEA parsing is on, and left alone when it's off.
+func TestNMEAParsing(t *testing.T) {
+	gga := nmea.Sentence("GNGGA,120000.00,5128.67400,N,00007.68000,W,4,12,0.8,45.123,M,47.000,M,,")
+	gsv := nmea.Sentence("GPGSV,1,1,02,04,45,120,40,09,10,300,")
+	frame := testdata.MessageBatchWith1077[:226]
+
+	input := make([]byte, 0)
+	input = append(input, []byte("junk")...)
+	input = append(input, []byte(gga)...)
+	input = append(input, []byte(gsv)...)
+	input = append(input, []byte("more")...)
+	input = append(input, frame...)
+
+	var testData = []struct {
+		description string
+		parse       bool
+		wantTypes   []int
+		wantData    []string
+	}{
+		{
+			"off", false,
+			[]int{utils.NonRTCMMessage, 1077},
+			[]string{"junk" + gga + gsv + "more", string(frame)},
+		},
+		{
+			"on", true,
+			[]int{utils.NonRTCMMessage, utils.NMEAMessage, utils.NMEAMessage, utils.NonRTCMMessage, 1077},
+			[]string{"junk", gga, gsv, "more", string(frame)},
+		},
+	}
+
+	for _, td := range testData {
+		ch_source := make(chan byte, len(input))
+		for _, b := range input {
+			ch_source <- b
+		}
+		close(ch_source)
+		ch_result := make(chan Message, 10)
+
+		rtcmHandler := New(time.Now(), slog.LevelInfo)
+		rtcmHandler.SetNMEAParsing(td.parse)
+		rtcmHandler.HandleMessages(ch_source, ch_result)
+
+		messages := make([]Message, 0)
+		for message := range ch_result {
+			messages = append(messages, message)
+		}
+
+		if len(messages) != len(td.wantTypes) {
+			t.Errorf("%s: want %d messages, got %d", td.description, len(td.wantTypes), len(messages))
+			continue
+		}
+		for i := range messages {
+			if messages[i].MessageType != td.wantTypes[i] {
+				t.Errorf("%s: message %d - want type %d got %d",
+					td.description, i, td.wantTypes[i], messages[i].MessageType)
+			}
+			if string(messages[i].RawData) != td.wantData[i] {
+				t.Errorf("%s: message %d - want data %q got %q",
+					td.description, i, td.wantData[i], string(messages[i].RawData))
+			}
+		}
+
+		if td.parse {
+			// The sentences are decoded, even after a copy.
+			copied := messages[1].Copy()
+			display := copied.String()
+			const want = "NMEA GGA sentence, talker GN\n"
+			if !strings.Contains(display, want) {
+				t.Errorf("%s: want the display to contain %q, got\n%s", td.description, want, display)
+			}
+			stats := rtcmHandler.Stats()
+			if stats.Frames != 1 || stats.NonRTCM != 4 {
+				t.Errorf("%s: want 1 frame and 4 non-RTCM, got %d and %d",
+					td.description, stats.Frames, stats.NonRTCM)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"time"
+)
+
+// The health score summarises the state of a stream as a number between 0
+// (dead) and 100 (perfect) so that a dashboard can rank many base stations
+// at a glance.  It's the sum of four parts, each worth up to 25 points:
+//
+//   - latency: full marks if the last frame arrived within HealthLatencyGood,
+//     none if nothing has arrived for HealthLatencyBad, and in proportion in
+//     between.
+//   - completeness: the percentage of the expected epochs that arrived over
+//     the last five minutes, averaged over the constellations.  See
+//     Completeness.  Until the interval between epochs is known, this part
+//     scores nothing.
+//   - CRC: the proportion of candidate frames that passed the CRC check.
+//   - coverage: a quarter of the marks for each of GPS, GLONASS, Galileo
+//     and Beidou that has been seen in MSM observations.
+//
+// A stream that has produced no frames scores 0.
+
+// HealthLatencyGood is the time since the last frame within which a stream
+// scores full marks for latency.
+const HealthLatencyGood = 2 * time.Second
+
+// HealthLatencyBad is the time since the last frame after which a stream
+// scores nothing for latency.
+const HealthLatencyBad = time.Minute
+
+// healthPart is the number of points given by each part of the score.
+const healthPart = 25.0
+
+// healthConstellations gives the message type divided by 10 of the MSM
+// messages for each constellation counted in the coverage part of the score,
+// for example 107 for GPS (1071 to 1077).
+var healthConstellations = []int{107, 108, 109, 112}
+
+// HealthScore returns the health score at the given time, from 0 to 100.
+// The completeness part is taken from stats.Completeness, so that must be
+// filled in first.
+func (stats *Stats) HealthScore(now time.Time) int {
+	if stats.Frames == 0 || stats.LastFrame.IsZero() {
+		return 0
+	}
+
+	score := healthPart * latencyFactor(now.Sub(stats.LastFrame))
+
+	score += healthPart * completenessFactor(stats.Completeness)
+
+	score += healthPart * float64(stats.Frames) / float64(stats.Frames+stats.CRCFailures)
+
+	seen := 0
+	for _, group := range healthConstellations {
+		for messageType := group*10 + 1; messageType <= group*10+7; messageType++ {
+			if stats.MessagesByType[messageType] > 0 {
+				seen++
+				break
+			}
+		}
+	}
+	score += healthPart * float64(seen) / float64(len(healthConstellations))
+
+	return int(score + 0.5)
+}
+
+// completenessFactor returns the mean of the completeness over the last
+// five minutes of the constellations, as a fraction, or 0 if there are
+// none.
+func completenessFactor(completeness map[string]Completeness) float64 {
+	if len(completeness) == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, c := range completeness {
+		total += c.Last5MinutesPercent
+	}
+	return total / float64(len(completeness)) / 100
+}
+
+// latencyFactor returns 1 if the age is within HealthLatencyGood, 0 if it's
+// HealthLatencyBad or more, and in proportion in between.
+func latencyFactor(age time.Duration) float64 {
+	switch {
+	case age <= HealthLatencyGood:
+		return 1
+	case age >= HealthLatencyBad:
+		return 0
+	default:
+		return float64(HealthLatencyBad-age) / float64(HealthLatencyBad-HealthLatencyGood)
+	}
+}
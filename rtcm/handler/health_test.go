@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+// TestHealthScore checks the health score.
+func TestHealthScore(t *testing.T) {
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+
+	allConstellations := map[int]uint64{1005: 1, 1077: 1, 1087: 1, 1094: 1, 1127: 1}
+	complete := map[string]Completeness{"GPS": {100, 100}, "Galileo": {100, 100}}
+	patchy := map[string]Completeness{"GPS": {80, 90}, "Galileo": {40, 90}}
+
+	var testData = []struct {
+		description string
+		stats       Stats
+		want        int
+	}{
+		{"nothing seen", Stats{}, 0},
+		{"perfect",
+			Stats{Frames: 10, MessagesByType: allConstellations, Completeness: complete,
+				LastFrame: now.Add(-time.Second)}, 100},
+		{"silent",
+			Stats{Frames: 10, MessagesByType: allConstellations, Completeness: complete,
+				LastFrame: now.Add(-time.Hour)}, 75},
+		{"half way to silent",
+			Stats{Frames: 10, MessagesByType: allConstellations, Completeness: complete,
+				LastFrame: now.Add(-31 * time.Second)}, 88},
+		{"junk and CRC failures",
+			Stats{Frames: 10, NonRTCM: 10, CRCFailures: 30, MessagesByType: allConstellations,
+				Completeness: complete, LastFrame: now}, 81},
+		{"missing epochs",
+			Stats{Frames: 10, MessagesByType: allConstellations, Completeness: patchy, LastFrame: now}, 90},
+		{"interval not known",
+			Stats{Frames: 10, MessagesByType: allConstellations, LastFrame: now}, 75},
+		{"GPS only",
+			Stats{Frames: 10, MessagesByType: map[int]uint64{1074: 10}, Completeness: complete,
+				LastFrame: now}, 81},
+		{"no observations",
+			Stats{Frames: 10, MessagesByType: map[int]uint64{1005: 10}, LastFrame: now}, 50},
+	}
+	for _, td := range testData {
+		got := td.stats.HealthScore(now)
+		if got != td.want {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"time"
+)
+
+// FrameLimits controls how the handler scans the input for message frames.
+//
+// The RTCM standard gives a frame a 10-bit length, so an embedded message is
+// at most 1023 bytes.  Some vendor formats use the six reserved bits in the
+// leader to extend the length field.  Setting MaxMessageLength above 1023
+// tells the handler to read the length from all 16 bits.  Setting it below
+// 1023 makes the handler reject long frames as junk, which helps it to resync
+// sooner on inputs that only carry short messages.
+//
+// Once the handler has seen the start of a frame, it normally waits for as
+// long as it takes for the rest of the frame to arrive.  If FrameTimeout is
+// set, the handler gives up if the frame is not complete within that time and
+// returns what it has as a non-RTCM message.  On slow links (4800 baud is
+// about 480 bytes per second) the timeout must allow for the longest frame
+// expected.
+//
+// When a candidate frame turns out not to be valid (bad CRC, bad header,
+// incomplete etc), the handler normally returns the whole candidate as a
+// non-RTCM message.  If the 0xd3 byte that started it was not really the
+// start of a frame, a genuine frame may start inside the candidate and it
+// would be lost.  If ResyncWindow is set, the handler looks for another start
+// of frame byte within that many bytes of the bad one, returns only the bytes
+// before it as non-RTCM and rescans from there.
+type FrameLimits struct {
+	// MaxMessageLength is the maximum length in bytes of the embedded message.
+	MaxMessageLength uint
+
+	// FrameTimeout is the time allowed for a frame to arrive once its start
+	// byte has been seen.  Zero means wait forever.
+	FrameTimeout time.Duration
+
+	// ResyncWindow is the number of bytes after a bad start of frame byte
+	// within which to look for a new start of frame.  Zero turns resyncing off.
+	ResyncWindow int
+}
+
+// MaxStandardMessageLength is the longest message that the 10-bit length
+// field in a standard RTCM3 leader can describe.
+const MaxStandardMessageLength = 1023
+
+// MaxExtendedMessageLength is the longest message that a 16-bit extended
+// length field can describe.
+const MaxExtendedMessageLength = 0xffff
+
+// DefaultFrameLimits returns the limits that follow the RTCM standard.
+func DefaultFrameLimits() FrameLimits {
+	return FrameLimits{MaxMessageLength: MaxStandardMessageLength}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestSetFrameLimits checks that SetFrameLimits applies the defaults and caps.
+func TestSetFrameLimits(t *testing.T) {
+	var testData = []struct {
+		description string
+		limits      FrameLimits
+		want        uint
+	}{
+		{"zero", FrameLimits{}, MaxStandardMessageLength},
+		{"short", FrameLimits{MaxMessageLength: 100}, 100},
+		{"extended", FrameLimits{MaxMessageLength: 4096}, 4096},
+		{"too big", FrameLimits{MaxMessageLength: 100000}, MaxExtendedMessageLength},
+	}
+	for _, td := range testData {
+		handler := New(time.Now(), slog.LevelDebug)
+		handler.SetFrameLimits(td.limits)
+		if handler.frameLimits.MaxMessageLength != td.want {
+			t.Errorf("%s: want %d got %d",
+				td.description, td.want, handler.frameLimits.MaxMessageLength)
+		}
+	}
+}
+
+// TestFetchNextMessageFrameWithMaxLength checks that FetchNextMessageFrame
+// applies the maximum message length.
+func TestFetchNextMessageFrameWithMaxLength(t *testing.T) {
+
+	// A frame of type 4001 with a 1024-byte message, which needs the
+	// extended length field.
+	longMessage := make([]byte, 1024)
+	longMessage[0] = 0xfa
+	longMessage[1] = 0x10
+	longFrame := addCRC(append([]byte{0xd3, 0x04, 0x00}, longMessage...))
+
+	var testData = []struct {
+		description     string
+		limits          FrameLimits
+		bitStream       []byte
+		wantMessageType int
+		wantLength      int
+	}{
+		{"standard", DefaultFrameLimits(), testdata.MessageFrameType1005,
+			1005, len(testdata.MessageFrameType1005)},
+		{"below max", FrameLimits{MaxMessageLength: 19}, testdata.MessageFrameType1005,
+			1005, len(testdata.MessageFrameType1005)},
+		{"above max", FrameLimits{MaxMessageLength: 18}, testdata.MessageFrameType1005,
+			utils.NonRTCMMessage, 5},
+		{"extended length not allowed", DefaultFrameLimits(), longFrame,
+			utils.NonRTCMMessage, 5},
+		{"extended length", FrameLimits{MaxMessageLength: 2048}, longFrame,
+			4001, len(longFrame)},
+	}
+	for _, td := range testData {
+		ch := make(chan byte, 10000)
+		for _, b := range td.bitStream {
+			ch <- b
+		}
+		bc := pushback.New(ch)
+		bc.Close()
+
+		handler := New(time.Now(), slog.LevelDebug)
+		handler.SetValidationPolicy(&TolerantPolicy{
+			PassThroughTypes: []TypeRange{{First: 4001, Last: 4001}},
+		})
+		handler.SetFrameLimits(td.limits)
+
+		gotMessage, _ := handler.FetchNextMessageFrame(bc)
+
+		if gotMessage.MessageType != td.wantMessageType {
+			t.Errorf("%s: want type %d got %d",
+				td.description, td.wantMessageType, gotMessage.MessageType)
+		}
+
+		if len(gotMessage.RawData) != td.wantLength {
+			t.Errorf("%s: want length %d got %d",
+				td.description, td.wantLength, len(gotMessage.RawData))
+		}
+	}
+}
+
+// TestFetchNextMessageFrameWithTimeout checks that FetchNextMessageFrame
+// gives up on an incomplete frame when the frame timeout expires.
+func TestFetchNextMessageFrameWithTimeout(t *testing.T) {
+	// Send part of a frame and leave the channel open.
+	ch := make(chan byte, 100)
+	for _, b := range testdata.MessageFrameType1005[:10] {
+		ch <- b
+	}
+	bc := pushback.New(ch)
+
+	handler := New(time.Now(), slog.LevelDebug)
+	handler.SetFrameLimits(FrameLimits{FrameTimeout: 20 * time.Millisecond})
+
+	gotMessage, gotError := handler.FetchNextMessageFrame(bc)
+
+	if gotError != nil {
+		t.Error(gotError)
+	}
+
+	if gotMessage.MessageType != utils.NonRTCMMessage {
+		t.Errorf("want a non-RTCM message, got type %d", gotMessage.MessageType)
+	}
+
+	if len(gotMessage.RawData) != 10 {
+		t.Errorf("want 10 bytes, got %d", len(gotMessage.RawData))
+	}
+}
+
+// TestFetchNextMessageFrameWithResync checks that when the resync window is
+// set, a genuine message frame that starts within a bad one is found.
+func TestFetchNextMessageFrameWithResync(t *testing.T) {
+	// A start of frame byte and a length that make a bogus candidate frame,
+	// followed by a real frame.  The candidate swallows most of the real one.
+	bogus := []byte{0xd3, 0x00, 0x10}
+	bitStream := append(bogus, testdata.MessageFrameType1005...)
+
+	var testData = []struct {
+		description string
+		window      int
+		wantTypes   []int
+		wantLengths []int
+	}{
+		{"no resync", 0,
+			[]int{utils.NonRTCMMessage, utils.NonRTCMMessage},
+			[]int{22, len(bitStream) - 22}},
+		{"window too small", 2,
+			[]int{utils.NonRTCMMessage, utils.NonRTCMMessage},
+			[]int{22, len(bitStream) - 22}},
+		{"resync", 3,
+			[]int{utils.NonRTCMMessage, 1005},
+			[]int{3, len(testdata.MessageFrameType1005)}},
+	}
+	for _, td := range testData {
+		ch := make(chan byte, 10000)
+		for _, b := range bitStream {
+			ch <- b
+		}
+		bc := pushback.New(ch)
+		bc.Close()
+
+		handler := New(time.Now(), slog.LevelDebug)
+		handler.SetFrameLimits(FrameLimits{ResyncWindow: td.window})
+
+		for i := range td.wantTypes {
+			gotMessage, _ := handler.FetchNextMessageFrame(bc)
+			if gotMessage == nil {
+				t.Errorf("%s: message %d - want a message", td.description, i)
+				break
+			}
+			if gotMessage.MessageType != td.wantTypes[i] {
+				t.Errorf("%s: message %d - want type %d got %d",
+					td.description, i, td.wantTypes[i], gotMessage.MessageType)
+			}
+			if len(gotMessage.RawData) != td.wantLengths[i] {
+				t.Errorf("%s: message %d - want length %d got %d",
+					td.description, i, td.wantLengths[i], len(gotMessage.RawData))
+			}
+		}
+
+		// The input should now be exhausted.
+		_, err := handler.FetchNextMessageFrame(bc)
+		if err == nil {
+			t.Errorf("%s: want an error at end of input", td.description)
+		}
+	}
+}
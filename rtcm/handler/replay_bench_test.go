@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/generator"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+)
+
+// The replay benchmarks compare the two ways of reading a recording:
+//
+//	go test -run XXX -bench Replay ./rtcm/handler
+//
+// The Scanner reads the frames in slices straight from the reader and should
+// be well over ten times faster than passing the bytes through a channel.
+
+// replayData is a recording of about a megabyte, made of batches of
+// messages with some junk between them.
+var replayData = makeReplayData(1 << 20)
+
+// makeReplayData is a helper function.  It returns at least the given
+// number of bytes of recorded data.
+func makeReplayData(size int) []byte {
+	data := make([]byte, 0, size+len(testdata.MessageBatchWithJunk))
+	for len(data) < size {
+		data = append(data, testdata.MessageBatchWithJunk...)
+	}
+	return data
+}
+
+// BenchmarkReplayChannel measures the replay of a recording by feeding it a
+// byte at a time through a channel to HandleMessages, as the file handler
+// does.
+func BenchmarkReplayChannel(b *testing.B) {
+	b.SetBytes(int64(len(replayData)))
+	for i := 0; i < b.N; i++ {
+		handler := New(time.Now(), slog.LevelInfo)
+		byteChan := make(chan byte)
+		messageChan := make(chan Message, 100)
+		go handler.HandleMessages(byteChan, messageChan)
+		go func() {
+			for _, b := range replayData {
+				byteChan <- b
+			}
+			close(byteChan)
+		}()
+		for range messageChan {
+		}
+	}
+}
+
+// BenchmarkReplayScanner measures the replay of a recording with a Scanner.
+func BenchmarkReplayScanner(b *testing.B) {
+	b.SetBytes(int64(len(replayData)))
+	for i := 0; i < b.N; i++ {
+		scanner := NewScanner(bytes.NewReader(replayData))
+		for {
+			_, err := scanner.Next()
+			if err == io.EOF {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkDecodeGenerated measures the reading and decoding of ten minutes
+// of generated MSM7 data from a busy multi-constellation base station.
+func BenchmarkDecodeGenerated(b *testing.B) {
+	config := generator.Config{
+		MSM7:       true,
+		Satellites: map[string]int{"GPS": 12, "Glonass": 8, "Galileo": 10, "Beidou": 14},
+		Start:      time.Now().Truncate(time.Second),
+	}
+	gen, err := generator.New(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var data []byte
+	for i := 0; i < 600; i++ {
+		for _, frame := range gen.Epoch() {
+			data = append(data, frame...)
+		}
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := NewScanner(bytes.NewReader(data))
+		for {
+			message, err := scanner.Next()
+			if err == io.EOF {
+				break
+			}
+			Analyse(message)
+		}
+	}
+}
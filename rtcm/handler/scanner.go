@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
+)
+
+// Scanner reads messages from an io.Reader, much as bufio.Scanner reads
+// lines.  It's for programs that want to embed the decoder without managing
+// channels and goroutines:
+//
+//	scanner := handler.NewScanner(file)
+//	for {
+//		message, err := scanner.Next()
+//		if err != nil {
+//			break // io.EOF at the end of the input.
+//		}
+//		fmt.Println(message.String())
+//	}
+//
+// The messages are the same as the ones that HandleMessages produces,
+// including the non-RTCM data between the RTCM message frames.  Bad frames
+// are returned as messages, not as errors.  A frame that fails its CRC
+// check comes back as non-RTCM data (type utils.NonRTCMMessage) and is
+// reported as a crc_failure event - see Subscribe.  A frame that passes
+// the check but can't be decoded comes back with its ErrorMessage set.
+type Scanner struct {
+	// handler does the work.
+	handler *Handler
+
+	// byteChannel holds the bytes read from the reader.
+	byteChannel *pushback.ByteChannel
+}
+
+// NewScanner creates a Scanner that reads from the given reader.  It uses a
+// handler that starts at the current time and takes the weeks from the
+// messages if it can - see New.  Use Handler to change the handler's
+// settings before the first call of Next.
+func NewScanner(reader io.Reader) *Scanner {
+	return NewScannerAt(reader, time.Now())
+}
+
+// NewScannerAt is like NewScanner, but the handler starts at the given
+// time.  It's for reading a recording made in an earlier week, which may
+// not contain the messages from which the handler can take the weeks.
+func NewScannerAt(reader io.Reader, startTime time.Time) *Scanner {
+	scanner := Scanner{
+		handler:     New(startTime, slog.LevelInfo),
+		byteChannel: pushback.NewFromReader(reader),
+	}
+	return &scanner
+}
+
+// NewScannerWithHandler is like NewScanner, but it uses the given handler,
+// with whatever settings it has.  It's for a program that sets up a handler
+// and then hands it to code that reads the messages.
+func NewScannerWithHandler(reader io.Reader, handler *Handler) *Scanner {
+	scanner := Scanner{
+		handler:     handler,
+		byteChannel: pushback.NewFromReader(reader),
+	}
+	return &scanner
+}
+
+// Handler returns the handler that the Scanner uses, so that its Set
+// methods can be called.
+func (scanner *Scanner) Handler() *Handler {
+	return scanner.handler
+}
+
+// Next returns the next message.  At the end of the input it returns io.EOF
+// or, if the reader failed, the reader's error.
+func (scanner *Scanner) Next() (*Message, error) {
+	message, err := scanner.handler.FetchNextMessageFrame(scanner.byteChannel)
+	if message != nil {
+		return message, nil
+	}
+
+	if readError := scanner.byteChannel.Err(); readError != nil {
+		return nil, readError
+	}
+	if err != nil && err.Error() != "done" {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/nmea"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// brokenReader is an io.Reader that gives some data and then fails.
+type brokenReader struct {
+	data []byte
+}
+
+func (reader *brokenReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, reader.data)
+	reader.data = reader.data[n:]
+	return n, nil
+}
+
+// TestScanner checks that the Scanner returns the messages and then io.EOF.
+func TestScanner(t *testing.T) {
+	var input []byte
+	input = append(input, []byte("junk")...)
+	input = append(input, testdata.MessageFrameType1077...)
+	input = append(input, testdata.MessageFrameType1005...)
+
+	scanner := NewScanner(bytes.NewReader(input))
+
+	wantTypes := []int{utils.NonRTCMMessage, utils.MessageTypeMSM7GPS, utils.MessageType1005}
+	for i, want := range wantTypes {
+		message, err := scanner.Next()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if message.MessageType != want {
+			t.Errorf("%d: want type %d got %d", i, want, message.MessageType)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if message, err := scanner.Next(); err != io.EOF || message != nil {
+			t.Errorf("want nil, EOF got %v, %v", message, err)
+		}
+	}
+}
+
+// TestScannerWithCRCFailure checks that a frame that fails its CRC check
+// comes back as non-RTCM data, not as an error, that a crc_failure event is
+// raised and that the Scanner carries on with the next frame.
+func TestScannerWithCRCFailure(t *testing.T) {
+	var input []byte
+	input = append(input, testdata.MessageFrameWithCRCFailure...)
+	input = append(input, testdata.MessageFrameType1005...)
+
+	scanner := NewScanner(bytes.NewReader(input))
+	events := make(chan Event, 10)
+	scanner.Handler().Subscribe(events)
+
+	message, err := scanner.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.MessageType != utils.NonRTCMMessage {
+		t.Errorf("want type %d got %d", utils.NonRTCMMessage, message.MessageType)
+	}
+	if !bytes.Equal(testdata.MessageFrameWithCRCFailure, message.RawData) {
+		t.Error("want the frame that failed the check")
+	}
+
+	select {
+	case event := <-events:
+		if event.Kind != EventCRCFailure {
+			t.Errorf("want a CRC failure event, got %s", event.String())
+		}
+	default:
+		t.Error("want a CRC failure event")
+	}
+
+	message, err = scanner.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.MessageType != utils.MessageType1005 {
+		t.Errorf("want type %d got %d", utils.MessageType1005, message.MessageType)
+	}
+}
+
+// TestScannerSettings checks that the handler's settings apply.
+func TestScannerSettings(t *testing.T) {
+	gga := nmea.Sentence("GNGGA,120000.00,5128.67400,N,00007.68000,W,4,12,0.8,45.123,M,47.000,M,,")
+
+	scanner := NewScanner(bytes.NewReader([]byte(gga)))
+	scanner.Handler().SetNMEAParsing(true)
+
+	message, err := scanner.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.MessageType != utils.NMEAMessage {
+		t.Errorf("want an NMEA message got type %d", message.MessageType)
+	}
+	if scanner.Handler().Stats().NonRTCM != 1 {
+		t.Errorf("want the handler to count the message")
+	}
+}
+
+// TestScannerReadError checks that a read error is returned after the data
+// read before it.
+func TestScannerReadError(t *testing.T) {
+	scanner := NewScanner(&brokenReader{data: testdata.MessageFrameType1005})
+
+	message, err := scanner.Next()
+	if err != nil || message.MessageType != utils.MessageType1005 {
+		t.Fatalf("want a 1005 got %v, %v", message, err)
+	}
+
+	_, err = scanner.Next()
+	if err == nil || err.Error() != "connection reset" {
+		t.Errorf("want connection reset got %v", err)
+	}
+}
+
+// TestNewScannerAt checks that the times of the MSMs are in the week of the
+// start time.
+func TestNewScannerAt(t *testing.T) {
+	first := time.Date(2023, time.May, 17, 12, 0, 0, 0, time.UTC)
+	weekLater := first.AddDate(0, 0, 7)
+
+	var sentAt []time.Time
+	for _, start := range []time.Time{first, weekLater} {
+		scanner := NewScannerAt(bytes.NewReader(testdata.MessageFrameType1077), start)
+		message, err := scanner.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.SentAt.IsZero() {
+			t.Fatalf("%v: want a time got none", start)
+		}
+		sentAt = append(sentAt, message.SentAt)
+	}
+
+	if got := sentAt[1].Sub(sentAt[0]); got != 7*24*time.Hour {
+		t.Errorf("want the times a week apart got %v", got)
+	}
+	if sentAt[0].Before(first.AddDate(0, 0, -7)) || sentAt[0].After(first.AddDate(0, 0, 7)) {
+		t.Errorf("want a time near %v got %v", first, sentAt[0])
+	}
+}
+
+// TestNewScannerWithHandler checks that the Scanner uses the given handler.
+func TestNewScannerWithHandler(t *testing.T) {
+	handler := New(time.Now(), slog.LevelInfo)
+	scanner := NewScannerWithHandler(bytes.NewReader(testdata.MessageFrameType1005), handler)
+
+	if scanner.Handler() != handler {
+		t.Error("want the given handler")
+	}
+	message, err := scanner.Next()
+	if err != nil || message.MessageType != utils.MessageType1005 {
+		t.Fatalf("want a 1005 got %v, %v", message, err)
+	}
+	if handler.Stats().Frames != 1 {
+		t.Errorf("want the handler to count the message")
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The handler keeps running counts of what it has seen.  Stats returns a
+// snapshot of them.  Stats may be called from any goroutine at any time,
+// for example once per second by an HTTP status server, while the handler
+// is decoding.  The counters are updated and read using atomic operations,
+// so sampling them never takes a lock and never stalls the decoding.
+
+// maxMessageType is the largest message type that fits in the 12-bit
+// message type field.
+const maxMessageType = 4095
+
+// StatsSchemaVersion is the version of the JSON form of Stats.  A consumer
+// can rely on these rules:  a new field may be added without changing the
+// version, so a consumer should ignore fields that it doesn't know; the
+// version is increased if a field is removed or renamed or its meaning or
+// type changes.
+const StatsSchemaVersion = 1
+
+// Stats is a snapshot of the handler's counters.
+type Stats struct {
+	// SchemaVersion is StatsSchemaVersion.
+	SchemaVersion int `json:"schema_version"`
+
+	// Frames is the number of valid RTCM message frames.
+	Frames uint64 `json:"frames"`
+
+	// NonRTCM is the number of chunks of non-RTCM data, including any NMEA
+	// sentences picked out of it.
+	NonRTCM uint64 `json:"non_rtcm"`
+
+	// Bytes is the total number of bytes in the frames and the non-RTCM data.
+	Bytes uint64 `json:"bytes"`
+
+	// CRCFailures is the number of candidate frames that failed the CRC check.
+	CRCFailures uint64 `json:"crc_failures"`
+
+	// Events gives the number of events of each kind reported, by name,
+	// including those with a count of zero.  See Subscribe.
+	Events map[string]uint64 `json:"events"`
+
+	// DecodePanics is the number of panics recovered while decoding the
+	// handler's messages.  See Handler.Analyse.
+	DecodePanics uint64 `json:"decode_panics"`
+
+	// MessagesByType gives the number of frames of each message type seen.
+	MessagesByType map[int]uint64 `json:"messages_by_type"`
+
+	// LastFrame is the time at which the last valid frame was counted.  It's
+	// the zero time if there hasn't been one.
+	LastFrame time.Time `json:"last_frame"`
+
+	// Health is the health score when the snapshot was taken.  See HealthScore.
+	Health int `json:"health"`
+
+	// Epochs summarises the intervals between recent epochs.
+	Epochs EpochStats `json:"epochs"`
+
+	// Completeness gives the completeness of the stream for each
+	// constellation seen, by name.  It's nil until the interval between
+	// epochs is known.
+	Completeness map[string]Completeness `json:"completeness"`
+}
+
+// counters holds the handler's running counts.  The fields are all uint64s
+// so that they are correctly aligned for atomic access on 32-bit platforms
+// such as the Raspberry Pi, provided that the struct is allocated on its own.
+type counters struct {
+	frames       uint64
+	nonRTCM      uint64
+	bytes        uint64
+	crcFailures  uint64
+	decodePanics uint64
+	lastFrame    int64 // Unix time in nanoseconds.
+	events       [numEventKinds]uint64
+	byType       [maxMessageType + 1]uint64
+}
+
+// Stats returns a snapshot of the handler's counters.  It's safe to call
+// this while the handler is running.
+func (rtcmHandler *Handler) Stats() Stats {
+	c := rtcmHandler.counters
+
+	stats := Stats{
+		SchemaVersion:  StatsSchemaVersion,
+		Frames:         atomic.LoadUint64(&c.frames),
+		NonRTCM:        atomic.LoadUint64(&c.nonRTCM),
+		Bytes:          atomic.LoadUint64(&c.bytes),
+		CRCFailures:    atomic.LoadUint64(&c.crcFailures),
+		DecodePanics:   atomic.LoadUint64(&c.decodePanics),
+		Events:         make(map[string]uint64),
+		MessagesByType: make(map[int]uint64),
+	}
+
+	for _, kind := range EventKinds() {
+		stats.Events[kind.String()] = atomic.LoadUint64(&c.events[kind])
+	}
+
+	for messageType := range c.byType {
+		n := atomic.LoadUint64(&c.byType[messageType])
+		if n > 0 {
+			stats.MessagesByType[messageType] = n
+		}
+	}
+
+	lastFrame := atomic.LoadInt64(&c.lastFrame)
+	if lastFrame > 0 {
+		stats.LastFrame = time.Unix(0, lastFrame)
+	}
+
+	stats.Epochs = rtcmHandler.epochs.stats()
+
+	interval := time.Duration(stats.Epochs.IntervalMillisP50) * time.Millisecond
+	stats.Completeness = rtcmHandler.completeness.stats(time.Now(), interval)
+
+	stats.Health = stats.HealthScore(time.Now())
+
+	return stats
+}
+
+// countMessage updates the counters for a message returned by the handler.
+func (c *counters) countMessage(message *Message) {
+	if message == nil {
+		return
+	}
+
+	atomic.AddUint64(&c.bytes, uint64(len(message.RawData)))
+
+	if message.MessageType == utils.NonRTCMMessage ||
+		message.MessageType == utils.NMEAMessage {
+
+		atomic.AddUint64(&c.nonRTCM, 1)
+		return
+	}
+
+	atomic.AddUint64(&c.frames, 1)
+	atomic.StoreInt64(&c.lastFrame, time.Now().UnixNano())
+	if message.MessageType >= 0 && message.MessageType <= maxMessageType {
+		atomic.AddUint64(&c.byType[message.MessageType], 1)
+	}
+}
+
+// countCRCFailure counts a frame that failed the CRC check.
+func (c *counters) countCRCFailure() {
+	atomic.AddUint64(&c.crcFailures, 1)
+}
+
+// countDecodePanic counts a panic recovered while decoding a message.
+func (c *counters) countDecodePanic() {
+	atomic.AddUint64(&c.decodePanics, 1)
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/generator"
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestStats checks that the handler counts the messages that it handles.
+func TestStats(t *testing.T) {
+	var bitStream []byte
+	bitStream = append(bitStream, testdata.AllJunk...)
+	bitStream = append(bitStream, testdata.MessageFrameType1005...)
+	bitStream = append(bitStream, testdata.MessageFrameWithCRCFailure...)
+	bitStream = append(bitStream, testdata.MessageFrameType1077...)
+	bitStream = append(bitStream, testdata.MessageFrameType1005...)
+
+	want := Stats{
+		SchemaVersion: StatsSchemaVersion,
+		Frames:        3,
+		NonRTCM:       2,
+		Bytes:         uint64(len(bitStream)),
+		CRCFailures:   1,
+		Events: map[string]uint64{
+			"crc_failure": 1, "truncated_frame": 0, "timestamp_out_of_range": 0, "unknown_type": 0,
+		},
+		MessagesByType: map[int]uint64{1005: 2, utils.MessageTypeMSM7GPS: 1},
+		// 25 for latency, 18.75 for CRC and 6.25 for coverage.  With one
+		// epoch the interval isn't known, so there's nothing for
+		// completeness.
+		Health: 50,
+		// One epoch, so no intervals.
+		Epochs: EpochStats{Epochs: 1},
+	}
+
+	ch := make(chan byte, len(bitStream))
+	for _, b := range bitStream {
+		ch <- b
+	}
+	bc := pushback.New(ch)
+	bc.Close()
+
+	handler := New(time.Now(), slog.LevelDebug)
+
+	for {
+		_, err := handler.FetchNextMessageFrame(bc)
+		if err != nil && err.Error() == "done" {
+			break
+		}
+	}
+
+	got := handler.Stats()
+
+	// The time of the last frame is the time that the test ran.
+	if got.LastFrame.IsZero() {
+		t.Error("want the time of the last frame")
+	}
+	want.LastFrame = got.LastFrame
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestStatsWhenEmpty checks the stats of a handler that has seen nothing.
+func TestStatsWhenEmpty(t *testing.T) {
+	handler := New(time.Now(), slog.LevelDebug)
+
+	got := handler.Stats()
+
+	if got.Frames != 0 || got.NonRTCM != 0 || got.Bytes != 0 || got.CRCFailures != 0 {
+		t.Errorf("want zero counts, got %v", got)
+	}
+
+	if !got.LastFrame.IsZero() || got.Health != 0 {
+		t.Errorf("want no last frame and no health, got %v", got)
+	}
+
+	if got.MessagesByType == nil || len(got.MessagesByType) != 0 {
+		t.Errorf("want an empty map, got %v", got.MessagesByType)
+	}
+}
+
+// benchmarkFetch runs the handler over a batch of messages, b.N times.  If
+// sample is true, another goroutine calls Stats every millisecond while the
+// handler is running, which is far more often than any real status server.
+func benchmarkFetch(b *testing.B, sample bool) {
+	bitStream := testdata.MessageBatchWith1077
+
+	handler := New(time.Now(), slog.LevelInfo)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if sample {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					handler.Stats()
+				}
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ch := make(chan byte, len(bitStream))
+		for _, c := range bitStream {
+			ch <- c
+		}
+		bc := pushback.New(ch)
+		bc.Close()
+
+		for {
+			_, err := handler.FetchNextMessageFrame(bc)
+			if err != nil && err.Error() == "done" {
+				break
+			}
+		}
+	}
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
+
+// BenchmarkFetchNextMessageFrame measures the handler without sampling.
+func BenchmarkFetchNextMessageFrame(b *testing.B) {
+	benchmarkFetch(b, false)
+}
+
+// BenchmarkFetchNextMessageFrameWithStatsSampling measures the handler while
+// the stats are sampled continuously.  The result should be close to that of
+// BenchmarkFetchNextMessageFrame.
+func BenchmarkFetchNextMessageFrameWithStatsSampling(b *testing.B) {
+	benchmarkFetch(b, true)
+}
+
+// BenchmarkStatsWithLiveDecoder measures Stats on a handler that holds an
+// hour of epochs from four constellations, while another goroutine decodes
+// generated data with the same handler, as it would in a running server.
+// It reports the rate at which the decoder handled frames meanwhile, which
+// should stay close to the rate without sampling.
+func BenchmarkStatsWithLiveDecoder(b *testing.B) {
+	handler := New(time.Now(), slog.LevelInfo)
+
+	// Fill the epoch and completeness records with the last hour.
+	constellations := []int{
+		utils.MessageTypeMSM7GPS, utils.MessageTypeMSM7Glonass,
+		utils.MessageTypeMSM7Galileo, utils.MessageTypeMSM7Beidou,
+	}
+	hourAgo := time.Now().Add(-1 * time.Hour)
+	for i := 0; i < 3600; i++ {
+		arrival := hourAgo.Add(time.Duration(i) * time.Second)
+		for _, messageType := range constellations {
+			message := msmWithTimestamp(messageType, uint(1000*(i+1)))
+			handler.epochs.record(message, arrival)
+			handler.completeness.record(message, arrival)
+		}
+	}
+
+	config := generator.Config{
+		MSM7:       true,
+		Satellites: map[string]int{"GPS": 12, "Glonass": 8, "Galileo": 10, "Beidou": 14},
+		Start:      time.Now().Truncate(time.Second),
+	}
+	gen, err := generator.New(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var data []byte
+	for i := 0; i < 60; i++ {
+		for _, frame := range gen.Epoch() {
+			data = append(data, frame...)
+		}
+	}
+
+	// Feed the data round and round until the benchmark stops.
+	stop := make(chan struct{})
+	ch := make(chan byte, len(data))
+	go func() {
+		defer close(ch)
+		for {
+			for _, c := range data {
+				select {
+				case ch <- c:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+
+	var frames uint64
+	done := make(chan struct{})
+	bc := pushback.New(ch)
+	go func() {
+		defer close(done)
+		for {
+			_, err := handler.FetchNextMessageFrame(bc)
+			if err != nil && err.Error() == "done" {
+				return
+			}
+			atomic.AddUint64(&frames, 1)
+		}
+	}()
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		handler.Stats()
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	b.ReportMetric(float64(atomic.LoadUint64(&frames))/elapsed.Seconds(), "frames/s")
+
+	close(stop)
+	<-done
+}
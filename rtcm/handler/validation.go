@@ -0,0 +1,136 @@
+package handler
+
+// A ValidationPolicy decides which message frames the handler accepts as RTCM3
+// and which of those it decodes.  By default the handler uses a StrictPolicy,
+// which follows the RTCM standard to the letter:  the six reserved bits after
+// the start of frame byte must be zero, the CRC must match and all message
+// types are decoded (if the handler knows how).
+//
+// Some devices emit RTCM-like frames with vendor extensions that fail those
+// checks.  Rather than losing that data as non-RTCM messages, the handler
+// for that input can be given a more tolerant policy:
+//
+//	policy := handler.TolerantPolicy{
+//	    AllowReservedBits: true,
+//	    PassThroughTypes:  []handler.TypeRange{{First: 4000, Last: 4095}},
+//	}
+//	rtcmHandler.SetValidationPolicy(&policy)
+//
+// Each input should have its own handler, so each input can have its own policy.
+
+// ValidationPolicy is the interface that a validation policy must satisfy.
+type ValidationPolicy interface {
+	// AcceptReservedBits returns true if a frame is acceptable when the six
+	// reserved bits following the start of frame byte have the given value.
+	AcceptReservedBits(reservedBits uint) bool
+
+	// CheckCRC returns true if the CRC of a frame carrying a message of the
+	// given type should be checked.
+	CheckCRC(messageType int) bool
+
+	// Decode returns true if a message of the given type should be decoded.
+	// If not, the message is passed on as a valid RTCM message but its
+	// readable form just says that it was not decoded.
+	Decode(messageType int) bool
+
+	// DiscardPadding returns true if runs of zero bytes between frames should
+	// be dropped rather than passed on as non-RTCM messages.
+	DiscardPadding() bool
+}
+
+// StrictPolicy is the default validation policy.  It accepts only frames that
+// follow the RTCM standard.
+type StrictPolicy struct{}
+
+// This is a compile-time check that StrictPolicy implements ValidationPolicy.
+var _ ValidationPolicy = (*StrictPolicy)(nil)
+
+// AcceptReservedBits returns true if the reserved bits are all zero.
+func (policy *StrictPolicy) AcceptReservedBits(reservedBits uint) bool {
+	return reservedBits == 0
+}
+
+// CheckCRC returns true - the CRC of every frame is checked.
+func (policy *StrictPolicy) CheckCRC(messageType int) bool {
+	return true
+}
+
+// Decode returns true - every message is decoded.
+func (policy *StrictPolicy) Decode(messageType int) bool {
+	return true
+}
+
+// DiscardPadding returns false - padding is passed on as a non-RTCM message.
+func (policy *StrictPolicy) DiscardPadding() bool {
+	return false
+}
+
+// TypeRange is an inclusive range of message types, for example 4001 to 4095
+// (the proprietary messages).
+type TypeRange struct {
+	// First is the first message type in the range.
+	First int `json:"first"`
+
+	// Last is the last message type in the range.
+	Last int `json:"last"`
+}
+
+// Contains returns true if the message type is within the range.
+func (typeRange *TypeRange) Contains(messageType int) bool {
+	return messageType >= typeRange.First && messageType <= typeRange.Last
+}
+
+// TolerantPolicy is a configurable validation policy for inputs that produce
+// non-standard frames.  The zero value behaves like StrictPolicy.  It can be
+// read from a JSON config.
+type TolerantPolicy struct {
+	// AllowReservedBits says whether to accept frames whose reserved bits
+	// are not zero.
+	AllowReservedBits bool `json:"allow_reserved_bits"`
+
+	// SkipCRCTypes lists the message types whose CRC is not checked.
+	SkipCRCTypes []TypeRange `json:"skip_crc_types"`
+
+	// PassThroughTypes lists the message types that are accepted without
+	// being decoded.
+	PassThroughTypes []TypeRange `json:"pass_through_types"`
+
+	// DiscardZeroPadding says whether to drop runs of zero bytes between frames.
+	DiscardZeroPadding bool `json:"discard_zero_padding"`
+}
+
+// This is a compile-time check that TolerantPolicy implements ValidationPolicy.
+var _ ValidationPolicy = (*TolerantPolicy)(nil)
+
+// AcceptReservedBits returns true if the reserved bits are zero or the policy
+// allows them to be set.
+func (policy *TolerantPolicy) AcceptReservedBits(reservedBits uint) bool {
+	return reservedBits == 0 || policy.AllowReservedBits
+}
+
+// CheckCRC returns false if the message type is one of the types whose CRC
+// should not be checked.
+func (policy *TolerantPolicy) CheckCRC(messageType int) bool {
+	return !inRanges(messageType, policy.SkipCRCTypes)
+}
+
+// Decode returns false if the message type is one of the types that should
+// be passed through without decoding.
+func (policy *TolerantPolicy) Decode(messageType int) bool {
+	return !inRanges(messageType, policy.PassThroughTypes)
+}
+
+// DiscardPadding returns true if zero padding between frames should be dropped.
+func (policy *TolerantPolicy) DiscardPadding() bool {
+	return policy.DiscardZeroPadding
+}
+
+// inRanges returns true if the message type is in any of the given ranges.
+func inRanges(messageType int, ranges []TypeRange) bool {
+	for i := range ranges {
+		if ranges[i].Contains(messageType) {
+			return true
+		}
+	}
+	return false
+}
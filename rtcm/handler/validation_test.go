@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-crc24q/crc24q"
+	"github.com/goblimey/go-ntrip/rtcm/pushback"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestStrictPolicy checks the decisions made by the strict validation policy.
+func TestStrictPolicy(t *testing.T) {
+	policy := StrictPolicy{}
+
+	if !policy.AcceptReservedBits(0) {
+		t.Error("want reserved bits 0 to be accepted")
+	}
+
+	if policy.AcceptReservedBits(1) {
+		t.Error("want reserved bits 1 to be rejected")
+	}
+
+	if !policy.CheckCRC(1077) {
+		t.Error("want CRC to be checked")
+	}
+
+	if !policy.Decode(4072) {
+		t.Error("want message to be decoded")
+	}
+
+	if policy.DiscardPadding() {
+		t.Error("want padding to be kept")
+	}
+}
+
+// TestTolerantPolicy checks the decisions made by the tolerant validation policy.
+func TestTolerantPolicy(t *testing.T) {
+	var testData = []struct {
+		description      string
+		policy           TolerantPolicy
+		reservedBits     uint
+		messageType      int
+		wantAcceptBits   bool
+		wantCheckCRC     bool
+		wantDecode       bool
+		wantDropsPadding bool
+	}{
+		{"zero value", TolerantPolicy{}, 0, 1077, true, true, true, false},
+		{"zero value reserved bits", TolerantPolicy{}, 2, 1077, false, true, true, false},
+		{"allow reserved bits", TolerantPolicy{AllowReservedBits: true}, 2, 1077,
+			true, true, true, false},
+		{"skip CRC in range",
+			TolerantPolicy{SkipCRCTypes: []TypeRange{{First: 4000, Last: 4095}}},
+			0, 4000, true, false, true, false},
+		{"skip CRC out of range",
+			TolerantPolicy{SkipCRCTypes: []TypeRange{{First: 4000, Last: 4095}}},
+			0, 3999, true, true, true, false},
+		{"pass through in second range",
+			TolerantPolicy{PassThroughTypes: []TypeRange{{1, 2}, {4095, 4095}}},
+			0, 4095, true, true, false, false},
+		{"pass through out of range",
+			TolerantPolicy{PassThroughTypes: []TypeRange{{1, 2}, {4095, 4095}}},
+			0, 1077, true, true, true, false},
+		{"discard padding", TolerantPolicy{DiscardZeroPadding: true}, 0, 1077,
+			true, true, true, true},
+	}
+	for _, td := range testData {
+		if td.policy.AcceptReservedBits(td.reservedBits) != td.wantAcceptBits {
+			t.Errorf("%s: want AcceptReservedBits %v", td.description, td.wantAcceptBits)
+		}
+		if td.policy.CheckCRC(td.messageType) != td.wantCheckCRC {
+			t.Errorf("%s: want CheckCRC %v", td.description, td.wantCheckCRC)
+		}
+		if td.policy.Decode(td.messageType) != td.wantDecode {
+			t.Errorf("%s: want Decode %v", td.description, td.wantDecode)
+		}
+		if td.policy.DiscardPadding() != td.wantDropsPadding {
+			t.Errorf("%s: want DiscardPadding %v", td.description, td.wantDropsPadding)
+		}
+	}
+}
+
+// TestFetchNextMessageFrameWithPolicy checks that FetchNextMessageFrame
+// applies the handler's validation policy.
+func TestFetchNextMessageFrameWithPolicy(t *testing.T) {
+
+	// A vendor frame, type 4001, with bit 13 of the leader set.
+	vendorFrame := []byte{0xd3, 0x04, 0x03, 0xfa, 0x10, 0x42}
+	vendorFrame = addCRC(vendorFrame)
+
+	padded := append([]byte{0, 0, 0}, testdata.MessageFrameType1077...)
+
+	tolerant := TolerantPolicy{
+		AllowReservedBits:  true,
+		SkipCRCTypes:       []TypeRange{{First: 1230, Last: 1230}},
+		PassThroughTypes:   []TypeRange{{First: 4001, Last: 4001}},
+		DiscardZeroPadding: true,
+	}
+
+	var testData = []struct {
+		description     string
+		policy          ValidationPolicy
+		bitStream       []byte
+		wantMessageType int
+		wantReadable    string
+	}{
+		{"strict reserved bits", nil, vendorFrame, utils.NonRTCMMessage, ""},
+		{"tolerant reserved bits", &tolerant, vendorFrame, 4001,
+			"message type 4001 accepted without decoding"},
+		{"strict CRC", nil, testdata.MessageFrameWithCRCFailure, utils.NonRTCMMessage, ""},
+		{"tolerant CRC", &tolerant, testdata.MessageFrameWithCRCFailure, 1230, ""},
+		{"strict padding", nil, padded, utils.NonRTCMMessage, ""},
+		{"tolerant padding", &tolerant, padded, utils.MessageTypeMSM7GPS, ""},
+	}
+	for _, td := range testData {
+		ch := make(chan byte, 10000)
+		for _, b := range td.bitStream {
+			ch <- b
+		}
+		bc := pushback.New(ch)
+		bc.Close()
+
+		startDate := time.Date(2023, time.August, 29, 00, 00, 00, 0, utils.LocationUTC)
+		handler := New(startDate, slog.LevelDebug)
+		handler.SetValidationPolicy(td.policy)
+
+		gotMessage, _ := handler.FetchNextMessageFrame(bc)
+
+		if gotMessage == nil {
+			t.Errorf("%s: want a message", td.description)
+			continue
+		}
+
+		if gotMessage.MessageType != td.wantMessageType {
+			t.Errorf("%s: want type %d got %d",
+				td.description, td.wantMessageType, gotMessage.MessageType)
+		}
+
+		if len(td.wantReadable) > 0 {
+			readable, ok := gotMessage.Readable.(string)
+			if !ok || readable != td.wantReadable {
+				t.Errorf("%s: want readable %s got %v",
+					td.description, td.wantReadable, gotMessage.Readable)
+			}
+		}
+	}
+}
+
+// TestFetchNextMessageFrameWithOnlyPadding checks that when the input
+// contains just zero padding and the policy discards it, we get the end
+// of input error and no message.
+func TestFetchNextMessageFrameWithOnlyPadding(t *testing.T) {
+	ch := make(chan byte, 10)
+	for i := 0; i < 5; i++ {
+		ch <- 0
+	}
+	bc := pushback.New(ch)
+	bc.Close()
+
+	handler := New(time.Now(), slog.LevelDebug)
+	handler.SetValidationPolicy(&TolerantPolicy{DiscardZeroPadding: true})
+
+	gotMessage, gotError := handler.FetchNextMessageFrame(bc)
+
+	if gotMessage != nil {
+		t.Errorf("want no message, got type %d", gotMessage.MessageType)
+	}
+
+	if gotError == nil {
+		t.Error("want an error")
+	}
+}
+
+// addCRC returns the given leader and message with a CRC added.
+func addCRC(leaderAndMessage []byte) []byte {
+	crc := crc24q.Hash(leaderAndMessage)
+	frame := make([]byte, len(leaderAndMessage), len(leaderAndMessage)+3)
+	copy(frame, leaderAndMessage)
+	return append(frame, crc24q.HiByte(crc), crc24q.MiByte(crc), crc24q.LoByte(crc))
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goblimey/go-ntrip/leapseconds"
+	"github.com/goblimey/go-ntrip/rtcm/type1019"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The timestamp in an MSM only gives the time within the week, so the
+// handler has to be told which week it is - see New.  Some messages carry
+// the date, and when one of them arrives the handler uses it to set the
+// weeks, correcting the start time if it was wrong:
+//
+//	type 1013 (system parameters) gives the date and time in UTC as a
+//	Modified Julian Day and the seconds into the day.
+//
+//	type 1019 (GPS ephemeris) gives the GPS week number, modulo 1024.  The
+//	handler takes the week with that number that's nearest to the week it
+//	has, so the start time only has to be within ten years or so.  The time
+//	within the week is taken from the last GPS timestamp.
+//
+// If the date agrees with the weeks that the handler already has, nothing
+// changes.  Otherwise the weeks are set as if the handler had been created
+// with that date.  MSMs that arrived before the message keep the times that
+// they were given.
+
+// Lengths of the fields at the start of a message type 1013.
+const len1013MessageType = 12
+const len1013StationID = 12
+const len1013MJD = 16
+const len1013SecondsOfDay = 17
+
+// gpsWeekModulus is the number of weeks after which the week number in a
+// GPS ephemeris rolls over.
+const gpsWeekModulus = 1024
+
+// mjdOrigin is the start of Modified Julian Day 0.
+var mjdOrigin = time.Date(1858, time.November, 17, 0, 0, 0, 0, time.UTC)
+
+// setWeekFromMessage sets the weeks from a message of type 1013 or 1019 if
+// they disagree with the date in the message.  A message that can't be
+// read is ignored.  The caller must hold the week mutex.
+func (rtcmHandler *Handler) setWeekFromMessage(messageType int, frame []byte) {
+
+	var date time.Time
+	switch messageType {
+	case utils.MessageType1013:
+		utcTime, err := getTimeFrom1013(frame)
+		if err != nil {
+			return
+		}
+		date = utcTime
+	case utils.MessageType1019:
+		ephemeris, err := type1019.GetMessage(frame)
+		if err != nil {
+			return
+		}
+		date = rtcmHandler.getTimeFromGPSWeek(ephemeris.WeekNumber)
+	default:
+		return
+	}
+
+	// Compare the start of the GPS week, which is the same for any time
+	// within the week.
+	current := weekNumber("GPS", rtcmHandler.startOfGPSWeek)
+	leaps := leapseconds.Default()
+	startOfWeek := leaps.UTC(getStartOfLastSundayUTC(date.Add(leaps.GPSMinusUTC(date))))
+	if weekNumber("GPS", startOfWeek) == current {
+		return
+	}
+
+	rtcmHandler.setStartTime(date)
+}
+
+// getTimeFromGPSWeek returns a time in UTC in the GPS week with the given
+// number, modulo 1024, that's nearest to the handler's current week.  The
+// time within the week is given by the last GPS timestamp.
+func (rtcmHandler *Handler) getTimeFromGPSWeek(weekModulo1024 uint) time.Time {
+	current := weekNumber("GPS", rtcmHandler.startOfGPSWeek)
+
+	// The difference between the weeks, in the range -512 to 511.
+	difference := (int(weekModulo1024) - current%gpsWeekModulus + gpsWeekModulus) % gpsWeekModulus
+	if difference >= gpsWeekModulus/2 {
+		difference -= gpsWeekModulus
+	}
+
+	startOfWeek := rtcmHandler.startOfGPSWeek.AddDate(0, 0, 7*difference)
+	sinceStartOfWeek := time.Duration(rtcmHandler.timestampFromPreviousGPSMessage) * time.Millisecond
+	return startOfWeek.Add(sinceStartOfWeek)
+}
+
+// getTimeFrom1013 gets the time in UTC from a message frame of type 1013.
+func getTimeFrom1013(frame []byte) (time.Time, error) {
+	var zeroTimeValue time.Time
+
+	const lenFields = len1013MessageType + len1013StationID + len1013MJD + len1013SecondsOfDay
+	lenMessageInBits := len(frame)*8 - utils.LeaderLengthBits - utils.CRCLengthBits
+	if lenMessageInBits < lenFields {
+		em := fmt.Sprintf("overrun - expected %d bits in a message type 1013, got %d",
+			lenFields, lenMessageInBits)
+		return zeroTimeValue, errors.New(em)
+	}
+
+	pos := uint(utils.LeaderLengthBits + len1013MessageType + len1013StationID)
+	mjd := utils.GetBitsAsUint64(frame, pos, len1013MJD)
+	pos += len1013MJD
+	secondsOfDay := utils.GetBitsAsUint64(frame, pos, len1013SecondsOfDay)
+
+	// A receiver that doesn't know the date yet may send zeros.
+	const secondsPerDay = 24 * 60 * 60
+	if mjd == 0 || secondsOfDay > secondsPerDay {
+		em := fmt.Sprintf("message type 1013 - no date - MJD %d, seconds %d", mjd, secondsOfDay)
+		return zeroTimeValue, errors.New(em)
+	}
+
+	utcTime := mjdOrigin.AddDate(0, 0, int(mjd)).Add(time.Duration(secondsOfDay) * time.Second)
+	return utcTime, nil
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// frame1013 is a helper function.  It returns a message frame of type 1013
+// with the given Modified Julian Day and seconds of the day.
+func frame1013(mjd, secondsOfDay uint64) []byte {
+	const lenMessage = len1013MessageType + len1013StationID + len1013MJD + len1013SecondsOfDay + 5 + 8
+	frame := utils.NewFrame(lenMessage)
+	pos := uint(utils.LeaderLengthBits)
+	pos = utils.SetBits(frame, pos, len1013MessageType, utils.MessageType1013)
+	pos = utils.SetBits(frame, pos, len1013StationID, 0)
+	pos = utils.SetBits(frame, pos, len1013MJD, mjd)
+	pos = utils.SetBits(frame, pos, len1013SecondsOfDay, secondsOfDay)
+	pos = utils.SetBits(frame, pos, 5, 0)
+	utils.SetBits(frame, pos, 8, 18)
+	utils.SetCRC(frame)
+	return frame
+}
+
+// TestWeekFrom1019 checks that a GPS ephemeris sets the GPS week and the
+// weeks of the other constellations.
+func TestWeekFrom1019(t *testing.T) {
+	// The ephemeris is from GPS week 2262, in May 2023.  The handler starts
+	// more than three years later.
+	startTime := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	handler := New(startTime, slog.LevelInfo)
+
+	if _, err := handler.GetMessage(testdata.MessageFrameType1019); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := weekNumber("GPS", handler.startOfGPSWeek); got != 2262 {
+		t.Errorf("want GPS week 2262 got %d", got)
+	}
+	wantStartOfBeidouWeek := time.Date(2023, time.May, 14, 0, 0, 0, 0, time.UTC).Add(beidouTimeOffset)
+	if !handler.startOfBeidouWeek.Equal(wantStartOfBeidouWeek) {
+		t.Errorf("want the Beidou week to start at %v got %v", wantStartOfBeidouWeek, handler.startOfBeidouWeek)
+	}
+
+	// The MSMs after it are in that week.
+	message, err := handler.GetMessage(testdata.MessageFrameType1077)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Week != 2262 || message.SentAt.Year() != 2023 {
+		t.Errorf("want week 2262 in 2023 got week %d at %v", message.Week, message.SentAt)
+	}
+
+	// Another ephemeris from the same week changes nothing.
+	if !handler.gpsTimeSettled {
+		t.Fatal("want the GPS time settled after an MSM")
+	}
+	handler.GetMessage(testdata.MessageFrameType1019)
+	if !handler.gpsTimeSettled {
+		t.Error("want the weeks left alone")
+	}
+}
+
+// TestWeekFrom1013 checks that a system parameters message sets the weeks.
+func TestWeekFrom1013(t *testing.T) {
+	// MJD 60374 is the 5th of March 2024, a Tuesday.
+	startTime := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	handler := New(startTime, slog.LevelInfo)
+
+	if _, err := handler.GetMessage(frame1013(60374, 12*3600)); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStartOfGPSWeek := time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC).Add(gpsTimeOffset)
+	if !handler.startOfGPSWeek.Equal(wantStartOfGPSWeek) {
+		t.Errorf("want the GPS week to start at %v got %v", wantStartOfGPSWeek, handler.startOfGPSWeek)
+	}
+	wantTimestamp := uint((2*24*time.Hour + 12*time.Hour - gpsTimeOffset) / time.Millisecond)
+	if handler.timestampFromPreviousGPSMessage != wantTimestamp {
+		t.Errorf("want previous timestamp %d got %d", wantTimestamp, handler.timestampFromPreviousGPSMessage)
+	}
+}
+
+// TestGetTimeFrom1013 checks the decoding of the date and the errors.
+func TestGetTimeFrom1013(t *testing.T) {
+	var testData = []struct {
+		description string
+		frame       []byte
+		want        time.Time
+		wantError   string
+	}{
+		{"good", frame1013(60374, 3661), time.Date(2024, time.March, 5, 1, 1, 1, 0, time.UTC), ""},
+		{"MJD 0", frame1013(0, 3661), time.Time{},
+			"message type 1013 - no date - MJD 0, seconds 3661"},
+		{"too many seconds", frame1013(60374, 90000), time.Time{},
+			"message type 1013 - no date - MJD 60374, seconds 90000"},
+		{"short", frame1013(60374, 3661)[:10], time.Time{},
+			"overrun - expected 57 bits in a message type 1013, got 32"},
+	}
+	for _, td := range testData {
+		got, err := getTimeFrom1013(td.frame)
+		if len(td.wantError) > 0 {
+			if err == nil || err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !got.Equal(td.want) {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
+
+// TestGetTimeFromGPSWeek checks that the week nearest to the handler's week
+// is chosen.
+func TestGetTimeFromGPSWeek(t *testing.T) {
+	// The 15th of October 2026 is in GPS week 2440, which is 392 modulo 1024.
+	startTime := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+
+	var testData = []struct {
+		weekModulo1024 uint
+		want           int
+	}{
+		{392, 2440},
+		{393, 2441},
+		{214, 2262},
+		{903, 2951},
+		{905, 1929},
+	}
+	for _, td := range testData {
+		handler := New(startTime, slog.LevelInfo)
+		got := handler.getTimeFromGPSWeek(td.weekModulo1024)
+		week := weekNumber("GPS", getStartOfLastSundayUTC(got.Add(-gpsTimeOffset)).Add(gpsTimeOffset))
+		if week != td.want {
+			t.Errorf("%d: want week %d got %d", td.weekModulo1024, td.want, week)
+		}
+		if got.Weekday() != time.Thursday || got.Hour() != 12 {
+			t.Errorf("%d: want Thursday at noon got %v", td.weekModulo1024, got)
+		}
+	}
+}
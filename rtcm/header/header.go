@@ -28,8 +28,8 @@ const lenSignalMask = 32
 // The maximum length of the cell mask.
 const maxLengthOfCellMask = 64
 
-// The minimum length of an MSM header
-const minBitsInHeader = LenMessageType + LenStationID +
+// MinBitsInHeader is the minimum length of an MSM header in bits.
+const MinBitsInHeader = LenMessageType + LenStationID +
 	LenTimeStamp + lenMultipleMessageFlag + lenIssueOfDataStation +
 	lenSessionTransmissionTime + lenClockSteeringIndicator +
 	lenExternalClockIndicator + lenGNSSDivergenceFreeSmoothingIndicator +
@@ -158,6 +158,11 @@ type Header struct {
 	// its value.
 	NumSignalCells int
 
+	// Warning describes any disagreement between the cell mask and the signal
+	// data found while decoding the message, and what was done about it.  It's
+	// empty if there was none.
+	Warning string
+
 	// LogLevel controls the data output by String.
 	LogLevel slog.Level
 }
@@ -282,6 +287,10 @@ func (header *Header) String() string {
 	display += fmt.Sprintf("%d satellites, %d signal types, %d signals\n",
 		len(header.Satellites), len(header.Signals), header.NumSignalCells)
 
+	if len(header.Warning) > 0 {
+		display += "WARNING: " + header.Warning + "\n"
+	}
+
 	return display
 }
 
@@ -292,7 +301,7 @@ func (header *Header) GetTitle() string {
 	return tc.Title
 }
 
-// GetMSMHeader extracts the header from an MSM message (MSM4 or MSM7).
+// GetMSMHeader extracts the header from an MSM message (MSM1 to MSM7).
 // It returns the header data and the bit position of the start of the
 // satellite data (which comes next in the bit stream).  If the bit stream
 // is not long enough to hold the header, an error is returned.
@@ -352,10 +361,10 @@ func GetMSMHeader(bitStream []byte, logLevel slog.Level) (*Header, uint, error)
 
 	// We don't know the length of the header yet, but we have a minimum.
 	// Check that.
-	if lenMessageInBits < minBitsInHeader {
+	if lenMessageInBits < MinBitsInHeader {
 		// Error - not enough data.
 		em := fmt.Sprintf("bitstream is too short for an MSM header - got %d bits, expected at least %d",
-			lenMessageInBits, minBitsInHeader)
+			lenMessageInBits, MinBitsInHeader)
 		return nil, 0, errors.New(em)
 	}
 
@@ -440,7 +449,7 @@ func GetMSMHeader(bitStream []byte, logLevel slog.Level) (*Header, uint, error)
 
 	// lengthRequired is the required minimum length of the bitstream.
 	lengthRequired := utils.LeaderLengthBits + utils.CRCLengthBits +
-		minBitsInHeader + lenCellMaskBits
+		MinBitsInHeader + lenCellMaskBits
 
 	// Check that the bitstream is long enough.
 	if bitStreamLength < lengthRequired {
@@ -479,9 +488,41 @@ func GetMSMHeader(bitStream []byte, logLevel slog.Level) (*Header, uint, error)
 	return header, pos, nil
 }
 
+// LengthInBits returns the length of the header in a message frame, which
+// depends on the number of satellites and signals.
+func (header *Header) LengthInBits() uint {
+	return MinBitsInHeader + uint(len(header.Satellites)*len(header.Signals))
+}
+
+// SetBits writes the header into a message frame made by utils.NewFrame,
+// starting at bit position pos, and returns the position after it, which is
+// the start of the satellite cells.  It's the reverse of GetMSMHeader.  The
+// masks are written as they are, so the satellite and signal cells that
+// follow must agree with them.
+func (header *Header) SetBits(frame []byte, pos uint) uint {
+
+	pos = utils.SetBits(frame, pos, LenMessageType, uint64(header.MessageType))
+	pos = utils.SetBits(frame, pos, LenStationID, uint64(header.StationID))
+	pos = utils.SetBits(frame, pos, LenTimeStamp, uint64(header.Timestamp))
+	pos = utils.SetFlag(frame, pos, header.MultipleMessage)
+	pos = utils.SetBits(frame, pos, lenIssueOfDataStation, uint64(header.IssueOfDataStation))
+	pos = utils.SetBits(frame, pos, lenSessionTransmissionTime, uint64(header.SessionTransmissionTime))
+	pos = utils.SetBits(frame, pos, lenClockSteeringIndicator, uint64(header.ClockSteeringIndicator))
+	pos = utils.SetBits(frame, pos, lenExternalClockSteeringIndicator, uint64(header.ExternalClockSteeringIndicator))
+	pos = utils.SetFlag(frame, pos, header.GNSSDivergenceFreeSmoothingIndicator)
+	pos = utils.SetBits(frame, pos, lenGNSSSmoothingInterval, uint64(header.GNSSSmoothingInterval))
+	pos = utils.SetBits(frame, pos, lenSatelliteMask, header.SatelliteMask)
+	pos = utils.SetBits(frame, pos, lenSignalMask, uint64(header.SignalMask))
+
+	lenCellMaskBits := uint(len(header.Satellites) * len(header.Signals))
+	pos = utils.SetBits(frame, pos, lenCellMaskBits, header.CellMask)
+
+	return pos
+}
+
 // GetMSMType is a helper function for GetMSHeader.  It extracts the message type from the bit stream
 // and returns it, plus the number of bits consumed.  An error is returned if the message is too short
-// or not an MSM4 or an MSM7.
+// or not an MSM.
 func getMSMType(bitStream []byte) (int, uint, error) {
 
 	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
@@ -497,37 +538,8 @@ func getMSMType(bitStream []byte) (int, uint, error) {
 	pos += LenMessageType
 
 	// Check that the message type is an MSM.
-	switch messageType {
-	case utils.MessageTypeMSM4GPS: // GPS
-		break
-	case utils.MessageTypeMSM7GPS:
-		break
-	case utils.MessageTypeMSM4Glonass:
-		break
-	case utils.MessageTypeMSM7Glonass:
-		break
-	case utils.MessageTypeMSM4Galileo:
-		break
-	case utils.MessageTypeMSM7Galileo:
-		break
-	case utils.MessageTypeMSM4SBAS:
-		break
-	case utils.MessageTypeMSM7SBAS:
-		break
-	case utils.MessageTypeMSM4QZSS:
-		break
-	case utils.MessageTypeMSM7QZSS:
-		break
-	case utils.MessageTypeMSM4Beidou:
-		break
-	case utils.MessageTypeMSM7Beidou:
-		break
-	case utils.MessageTypeMSM4NavicIrnss:
-		break
-	case utils.MessageTypeMSM7NavicIrnss:
-		break
-	default:
-		em := fmt.Sprintf("message type %d is not an MSM4 or an MSM7", messageType)
+	if !utils.MSM(messageType) {
+		em := fmt.Sprintf("message type %d is not an MSM", messageType)
 		return 0, 0, errors.New(em)
 	}
 
@@ -96,7 +96,7 @@ func TestGetMSMType(t *testing.T) {
 	// handled the work that getMSMHeaderType does, we would need to
 	// hand-craft lots of them.
 
-	const errorForMaxMessageType = "message type 4095 is not an MSM4 or an MSM7"
+	const errorForMaxMessageType = "message type 4095 is not an MSM"
 
 	// The position in the bit stream after the message type has been read.
 	// The message frame contains the leader, the embedded message and the CRC.
@@ -124,15 +124,18 @@ func TestGetMSMType(t *testing.T) {
 		{1117, "", posAfterMessageType, "QZSS"},
 		{1127, "", posAfterMessageType, "Beidou"},
 		{1137, "", posAfterMessageType, "NavIC/IRNSS"},
+		{1071, "", posAfterMessageType, "GPS"},
+		{1073, "", posAfterMessageType, "GPS"},
+		{1085, "", posAfterMessageType, "GLONASS"},
+		{1096, "", posAfterMessageType, "Galileo"},
 
 		// These message numbers are not for MSM messages
-		{0, "message type 0 is not an MSM4 or an MSM7", 0, ""},
-		{1, "message type 1 is not an MSM4 or an MSM7", 0, ""},
-		{1073, "message type 1073 is not an MSM4 or an MSM7", 0, ""},
-		{1075, "message type 1075 is not an MSM4 or an MSM7", 0, ""},
-		{1076, "message type 1076 is not an MSM4 or an MSM7", 0, ""},
-		{1138, "message type 1138 is not an MSM4 or an MSM7", 0, ""},
-		{1023, "message type 1023 is not an MSM4 or an MSM7", 0, ""},
+		{0, "message type 0 is not an MSM", 0, ""},
+		{1, "message type 1 is not an MSM", 0, ""},
+		{1070, "message type 1070 is not an MSM", 0, ""},
+		{1078, "message type 1078 is not an MSM", 0, ""},
+		{1138, "message type 1138 is not an MSM", 0, ""},
+		{1023, "message type 1023 is not an MSM", 0, ""},
 		{utils.MaxMessageType, errorForMaxMessageType, 40, ""},
 	}
 	for _, td := range testData {
@@ -556,7 +559,7 @@ func TestGetMSMHeaderWithWrongMessageType(t *testing.T) {
 	// 12-bit message type and four trailing zero bits.
 	// For example 1074 (ignoring the leader): |0100 0001 1110|0000
 
-	messageType := 1073 // Not MSM
+	messageType := 1078 // Not MSM
 
 	// Shift the type to give 16 bits with 4 trailing bits.
 	tp := messageType << 4
@@ -578,7 +581,7 @@ func TestGetMSMHeaderWithWrongMessageType(t *testing.T) {
 	bitStream = append(bitStream, crc24q.MiByte(crc))
 	bitStream = append(bitStream, crc24q.LoByte(crc))
 
-	const wantError = "message type 1073 is not an MSM4 or an MSM7"
+	const wantError = "message type 1078 is not an MSM"
 
 	_, _, err := GetMSMHeader(bitStream, slog.LevelDebug)
 
@@ -869,3 +872,21 @@ cell mask: fff fft
 
 	}
 }
+
+// TestStringWithWarning checks that String displays any warning.
+func TestStringWithWarning(t *testing.T) {
+	const want = `stationID 2, single message, issue of data station 1
+session transmit time 5, clock steering 6, external clock 7
+divergence free smoothing true, smoothing interval 9
+2 satellites, 3 signal types, 1 signals
+WARNING: the cell mask gives 1 signal cells but the message contains 2 - ignoring the extra 1
+`
+	hdr := New(1074, 2, 3, false, 1, 5, 6, 7, true, 9, 3, 7, 1, slog.LevelInfo)
+	hdr.Warning = "the cell mask gives 1 signal cells but the message contains 2 - ignoring the extra 1"
+
+	got := hdr.String()
+
+	if want != got {
+		t.Error(diff.Diff(want, got))
+	}
+}
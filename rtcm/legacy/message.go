@@ -0,0 +1,616 @@
+// The legacy package handles the legacy RTK observation messages that came
+// before the Multiple Signal Messages - types 1001 to 1004 for GPS and 1009
+// to 1012 for Glonass.  Older receivers and many mountpoints still send
+// them, usually 1004 and 1012.
+//
+// Each message starts with a header giving the station, the epoch time and
+// the number of satellites, followed by a block of fields for each
+// satellite.  The types differ in which fields the blocks contain:
+//
+//	1001, 1009  L1 only
+//	1002, 1010  L1 with the pseudorange ambiguity and the CNR
+//	1003, 1011  L1 and L2
+//	1004, 1012  L1 and L2 with the ambiguity and the CNRs
+//
+// The L1 pseudorange is sent modulo one light millisecond (two for Glonass)
+// and the ambiguity gives the number of whole light milliseconds, so the
+// full pseudorange is only available from the extended types.  The phase
+// ranges and the L2 pseudorange are sent as differences from the L1
+// pseudorange.  The Message holds the values as they were sent and the
+// methods of Satellite convert them to metres and cycles.
+package legacy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Lengths of the header fields in the bit stream.
+const lenMessageType = 12
+const lenStationID = 12
+const lenGPSEpochTime = 30
+const lenGlonassEpochTime = 27
+const lenSynchronousGNSS = 1
+const lenNumSatellites = 5
+const lenSmoothingIndicator = 1
+const lenSmoothingInterval = 3
+
+// Lengths of the satellite fields in the bit stream.
+const lenSatelliteID = 6
+const lenL1CodeIndicator = 1
+const lenFrequencyChannel = 5
+const lenGPSL1Pseudorange = 24
+const lenGlonassL1Pseudorange = 25
+const lenPhaseRangeDifference = 20
+const lenLockTimeIndicator = 7
+const lenGPSAmbiguity = 8
+const lenGlonassAmbiguity = 7
+const lenCNR = 8
+const lenL2CodeIndicator = 2
+const lenPseudorangeDifference = 14
+
+// pseudorangeScale converts the L1 pseudorange and the L2-L1 pseudorange
+// difference to metres.
+const pseudorangeScale = 0.02
+
+// phaseRangeScale converts the phase range differences to metres.
+const phaseRangeScale = 0.0005
+
+// cnrScale converts the CNR to dB-Hz.
+const cnrScale = 0.25
+
+// glonassAmbiguityMetres is the unit of the Glonass pseudorange ambiguity,
+// two light milliseconds.  The GPS unit is one, utils.OneLightMillisecond.
+const glonassAmbiguityMetres = 2 * utils.OneLightMillisecond
+
+// frequencyChannelOffset converts the frequency channel field to the
+// channel number, -7 to +6.
+const frequencyChannelOffset = 7
+
+// InvalidPhaseRangeDifference is the value of a phase range difference
+// that means the phase range is not valid.
+const InvalidPhaseRangeDifference = -524288
+
+// InvalidPseudorangeDifference is the value of the L2-L1 pseudorange
+// difference that means the L2 pseudorange is not valid.
+const InvalidPseudorangeDifference = -8192
+
+// layout describes the fields in a type of legacy message.
+type layout struct {
+	// glonass is true for the Glonass types.
+	glonass bool
+
+	// extended is true if the L1 block has the ambiguity and the CNR, and
+	// the L2 block (if there is one) has the CNR.
+	extended bool
+
+	// l2 is true if there is an L2 block.
+	l2 bool
+}
+
+// layouts gives the layout of each legacy message type.
+var layouts = map[int]layout{
+	1001: {glonass: false, extended: false, l2: false},
+	1002: {glonass: false, extended: true, l2: false},
+	1003: {glonass: false, extended: false, l2: true},
+	1004: {glonass: false, extended: true, l2: true},
+	1009: {glonass: true, extended: false, l2: false},
+	1010: {glonass: true, extended: true, l2: false},
+	1011: {glonass: true, extended: false, l2: true},
+	1012: {glonass: true, extended: true, l2: true},
+}
+
+// Legacy returns true if the message type is one of the legacy observation
+// messages that this package handles.
+func Legacy(messageType int) bool {
+	_, ok := layouts[messageType]
+	return ok
+}
+
+// headerBits returns the length of the header in bits.
+func (l layout) headerBits() uint {
+	length := uint(lenMessageType + lenStationID + lenSynchronousGNSS +
+		lenNumSatellites + lenSmoothingIndicator + lenSmoothingInterval)
+	if l.glonass {
+		return length + lenGlonassEpochTime
+	}
+	return length + lenGPSEpochTime
+}
+
+// satelliteBits returns the length of a satellite block in bits.
+func (l layout) satelliteBits() uint {
+	length := uint(lenSatelliteID + lenL1CodeIndicator + lenPhaseRangeDifference + lenLockTimeIndicator)
+	if l.glonass {
+		length += lenFrequencyChannel + lenGlonassL1Pseudorange
+	} else {
+		length += lenGPSL1Pseudorange
+	}
+	if l.extended {
+		length += lenCNR
+		if l.glonass {
+			length += lenGlonassAmbiguity
+		} else {
+			length += lenGPSAmbiguity
+		}
+	}
+	if l.l2 {
+		length += lenL2CodeIndicator + lenPseudorangeDifference + lenPhaseRangeDifference + lenLockTimeIndicator
+		if l.extended {
+			length += lenCNR
+		}
+	}
+	return length
+}
+
+// Header is the header of a legacy observation message.
+type Header struct {
+	// MessageType - uint12 - 1001-1004 or 1009-1012.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// StationID - uint12.
+	StationID uint `json:"station_id,omitempty"`
+
+	// EpochTime is the time of the observations.  For GPS it's milliseconds
+	// since the start of the GPS week - uint30.  For Glonass it's
+	// milliseconds since the start of the day in Moscow time - uint27.
+	EpochTime uint `json:"epoch_time,omitempty"`
+
+	// SynchronousGNSS is true if more observation messages follow for the
+	// same epoch - bit(1).
+	SynchronousGNSS bool `json:"synchronous_gnss,omitempty"`
+
+	// NumSatellites is the number of satellites in the message - uint5.
+	NumSatellites uint `json:"num_satellites,omitempty"`
+
+	// SmoothingIndicator is true if divergence-free smoothing is used -
+	// bit(1).
+	SmoothingIndicator bool `json:"smoothing_indicator,omitempty"`
+
+	// SmoothingInterval is the smoothing interval indicator - bit(3).
+	SmoothingInterval uint `json:"smoothing_interval,omitempty"`
+}
+
+// Satellite holds the observations of one satellite.  The fields that are
+// not in the message type are zero.
+type Satellite struct {
+	// ID is the satellite ID, 1-63 - uint6.
+	ID uint `json:"id,omitempty"`
+
+	// FrequencyChannel is the Glonass frequency channel number plus 7 -
+	// uint5.  Glonass only.
+	FrequencyChannel uint `json:"frequency_channel,omitempty"`
+
+	// L1CodeIndicator gives the L1 code - bit(1).  0 is C/A, 1 is P(Y) for
+	// GPS or P for Glonass.
+	L1CodeIndicator uint `json:"l1_code_indicator,omitempty"`
+
+	// L1Pseudorange is the L1 pseudorange modulo the ambiguity - uint24
+	// (GPS) or uint25 (Glonass), 0.02 m.
+	L1Pseudorange uint `json:"l1_pseudorange,omitempty"`
+
+	// L1PhaseRangeDifference is the L1 phase range minus the L1
+	// pseudorange - int20, 0.0005 m.
+	L1PhaseRangeDifference int64 `json:"l1_phase_range_difference,omitempty"`
+
+	// L1LockTimeIndicator - uint7.  See LockTime.
+	L1LockTimeIndicator uint `json:"l1_lock_time_indicator,omitempty"`
+
+	// L1Ambiguity is the integer number of light milliseconds (two for
+	// Glonass) in the L1 pseudorange - uint8 (GPS) or uint7 (Glonass).
+	// Extended types only.
+	L1Ambiguity uint `json:"l1_ambiguity,omitempty"`
+
+	// L1CNR is the L1 carrier to noise ratio - uint8, 0.25 dB-Hz.  0 means
+	// not computed.  Extended types only.
+	L1CNR uint `json:"l1_cnr,omitempty"`
+
+	// L2CodeIndicator gives the L2 code - bit(2).  L1 and L2 types only.
+	L2CodeIndicator uint `json:"l2_code_indicator,omitempty"`
+
+	// L2PseudorangeDifference is the L2 pseudorange minus the L1
+	// pseudorange - int14, 0.02 m.  L1 and L2 types only.
+	L2PseudorangeDifference int64 `json:"l2_pseudorange_difference,omitempty"`
+
+	// L2PhaseRangeDifference is the L2 phase range minus the L1
+	// pseudorange - int20, 0.0005 m.  L1 and L2 types only.
+	L2PhaseRangeDifference int64 `json:"l2_phase_range_difference,omitempty"`
+
+	// L2LockTimeIndicator - uint7.  L1 and L2 types only.
+	L2LockTimeIndicator uint `json:"l2_lock_time_indicator,omitempty"`
+
+	// L2CNR is the L2 carrier to noise ratio - uint8, 0.25 dB-Hz.  Extended
+	// L1 and L2 types only.
+	L2CNR uint `json:"l2_cnr,omitempty"`
+
+	// glonass is true if the satellite is a Glonass satellite.
+	glonass bool
+}
+
+// Message is a legacy observation message.
+type Message struct {
+	// Header is the message header.
+	Header Header `json:"header"`
+
+	// Satellites holds the observations of each satellite.
+	Satellites []Satellite `json:"satellites"`
+}
+
+// Constellation returns "GPS" or "Glonass".
+func (message *Message) Constellation() string {
+	if layouts[int(message.Header.MessageType)].glonass {
+		return "Glonass"
+	}
+	return "GPS"
+}
+
+// Channel returns the Glonass frequency channel number, -7 to +6.
+func (satellite *Satellite) Channel() int {
+	return int(satellite.FrequencyChannel) - frequencyChannelOffset
+}
+
+// ambiguityMetres returns the unit of the pseudorange ambiguity.
+func (satellite *Satellite) ambiguityMetres() float64 {
+	if satellite.glonass {
+		return glonassAmbiguityMetres
+	}
+	return utils.OneLightMillisecond
+}
+
+// L1PseudorangeMetres returns the L1 pseudorange in metres.  In the types
+// that don't carry the ambiguity it's modulo one light millisecond (two for
+// Glonass).
+func (satellite *Satellite) L1PseudorangeMetres() float64 {
+	return float64(satellite.L1Pseudorange)*pseudorangeScale +
+		float64(satellite.L1Ambiguity)*satellite.ambiguityMetres()
+}
+
+// L1PhaseRangeValid returns true if the L1 phase range is valid.
+func (satellite *Satellite) L1PhaseRangeValid() bool {
+	return satellite.L1PhaseRangeDifference != InvalidPhaseRangeDifference
+}
+
+// L1PhaseRangeMetres returns the L1 phase range in metres.
+func (satellite *Satellite) L1PhaseRangeMetres() float64 {
+	return satellite.L1PseudorangeMetres() +
+		float64(satellite.L1PhaseRangeDifference)*phaseRangeScale
+}
+
+// L1PhaseRange returns the L1 phase range in cycles.
+func (satellite *Satellite) L1PhaseRange() float64 {
+	return satellite.L1PhaseRangeMetres() / satellite.L1Wavelength()
+}
+
+// L2PseudorangeValid returns true if the L2 pseudorange is valid.
+func (satellite *Satellite) L2PseudorangeValid() bool {
+	return satellite.L2PseudorangeDifference != InvalidPseudorangeDifference
+}
+
+// L2PseudorangeMetres returns the L2 pseudorange in metres.
+func (satellite *Satellite) L2PseudorangeMetres() float64 {
+	return satellite.L1PseudorangeMetres() +
+		float64(satellite.L2PseudorangeDifference)*pseudorangeScale
+}
+
+// L2PhaseRangeValid returns true if the L2 phase range is valid.
+func (satellite *Satellite) L2PhaseRangeValid() bool {
+	return satellite.L2PhaseRangeDifference != InvalidPhaseRangeDifference
+}
+
+// L2PhaseRangeMetres returns the L2 phase range in metres.
+func (satellite *Satellite) L2PhaseRangeMetres() float64 {
+	return satellite.L1PseudorangeMetres() +
+		float64(satellite.L2PhaseRangeDifference)*phaseRangeScale
+}
+
+// L2PhaseRange returns the L2 phase range in cycles.
+func (satellite *Satellite) L2PhaseRange() float64 {
+	return satellite.L2PhaseRangeMetres() / satellite.L2Wavelength()
+}
+
+// L1Wavelength returns the wavelength of the L1 carrier in metres.  Each
+// Glonass satellite has its own frequency, set by its channel.
+func (satellite *Satellite) L1Wavelength() float64 {
+	if satellite.glonass {
+		return utils.SpeedOfLightMS /
+			(utils.FreqL1Glonass + float64(satellite.Channel())*utils.BiasFreq1Glo)
+	}
+	return utils.SpeedOfLightMS / utils.Freq1
+}
+
+// L2Wavelength returns the wavelength of the L2 carrier in metres.
+func (satellite *Satellite) L2Wavelength() float64 {
+	if satellite.glonass {
+		return utils.SpeedOfLightMS /
+			(utils.FreqL2Glonass + float64(satellite.Channel())*utils.BiasFreq2Glo)
+	}
+	return utils.SpeedOfLightMS / utils.Freq2
+}
+
+// L1CNRdBHz returns the L1 carrier to noise ratio in dB-Hz, 0 if it's not
+// available.
+func (satellite *Satellite) L1CNRdBHz() float64 {
+	return float64(satellite.L1CNR) * cnrScale
+}
+
+// L2CNRdBHz returns the L2 carrier to noise ratio in dB-Hz, 0 if it's not
+// available.
+func (satellite *Satellite) L2CNRdBHz() float64 {
+	return float64(satellite.L2CNR) * cnrScale
+}
+
+// LockTime returns the minimum time in seconds for which the receiver has
+// been locked on to the signal, given the lock time indicator of a legacy
+// message.  (The MSMs use a different scheme.)  127 means 937 seconds or
+// more.
+func LockTime(indicator uint) uint {
+	switch {
+	case indicator < 24:
+		return indicator
+	case indicator < 48:
+		return indicator*2 - 24
+	case indicator < 72:
+		return indicator*4 - 120
+	case indicator < 96:
+		return indicator*8 - 408
+	case indicator < 120:
+		return indicator*16 - 1176
+	case indicator < 127:
+		return indicator*32 - 3096
+	default:
+		return 937
+	}
+}
+
+// String returns a readable version of the message.
+func (message *Message) String() string {
+	l := layouts[int(message.Header.MessageType)]
+	h := &message.Header
+
+	display := fmt.Sprintf("stationID %d, ", h.StationID)
+	if l.glonass {
+		hours, minutes, seconds, millis := utils.ParseMilliseconds(h.EpochTime)
+		display += fmt.Sprintf("epoch time %d (%dh %dm %ds %dms Moscow time)\n",
+			h.EpochTime, hours, minutes, seconds, millis)
+	} else {
+		days := h.EpochTime / utils.MillisIn24Hours
+		hours, minutes, seconds, millis := utils.ParseMilliseconds(h.EpochTime % utils.MillisIn24Hours)
+		display += fmt.Sprintf("epoch time %d (%dd %dh %dm %ds %dms)\n",
+			h.EpochTime, days, hours, minutes, seconds, millis)
+	}
+	display += fmt.Sprintf("synchronous GNSS %v, divergence free smoothing %v, smoothing interval %d\n",
+		h.SynchronousGNSS, h.SmoothingIndicator, h.SmoothingInterval)
+	display += fmt.Sprintf("%d satellites\n", h.NumSatellites)
+
+	heading := "Satellite ID"
+	if l.glonass {
+		heading += " channel"
+	}
+	heading += " {L1 code, L1 pseudorange m, L1 phase range, L1 lock s"
+	if l.extended {
+		heading += ", L1 CNR"
+	}
+	if l.l2 {
+		heading += ", L2 code, L2 pseudorange m, L2 phase range, L2 lock s"
+		if l.extended {
+			heading += ", L2 CNR"
+		}
+	}
+	display += heading + "}:\n"
+
+	for i := range message.Satellites {
+		display += message.Satellites[i].display(l) + "\n"
+	}
+
+	return display
+}
+
+// display returns a line showing the satellite's observations.
+func (satellite *Satellite) display(l layout) string {
+	line := fmt.Sprintf("%2d", satellite.ID)
+	if l.glonass {
+		line += fmt.Sprintf(" %2d", satellite.Channel())
+	}
+	line += fmt.Sprintf(" {%d, %.3f, %s, %d", satellite.L1CodeIndicator,
+		satellite.L1PseudorangeMetres(),
+		phaseRangeDisplay(satellite.L1PhaseRangeValid(), satellite.L1PhaseRange()),
+		LockTime(satellite.L1LockTimeIndicator))
+	if l.extended {
+		line += fmt.Sprintf(", %.2f", satellite.L1CNRdBHz())
+	}
+	if l.l2 {
+		l2Pseudorange := "invalid"
+		if satellite.L2PseudorangeValid() {
+			l2Pseudorange = fmt.Sprintf("%.3f", satellite.L2PseudorangeMetres())
+		}
+		line += fmt.Sprintf(", %d, %s, %s, %d", satellite.L2CodeIndicator, l2Pseudorange,
+			phaseRangeDisplay(satellite.L2PhaseRangeValid(), satellite.L2PhaseRange()),
+			LockTime(satellite.L2LockTimeIndicator))
+		if l.extended {
+			line += fmt.Sprintf(", %.2f", satellite.L2CNRdBHz())
+		}
+	}
+	return line + "}"
+}
+
+// phaseRangeDisplay is a helper for display.
+func phaseRangeDisplay(valid bool, phaseRange float64) string {
+	if !valid {
+		return "invalid"
+	}
+	return fmt.Sprintf("%.3f", phaseRange)
+}
+
+// Frame returns the message as a complete RTCM3 message frame, with the
+// leader and the CRC, ready to be sent.  It's the reverse of GetMessage.
+// The number of satellites in the header is taken from the list.
+func (message *Message) Frame() []byte {
+	l, ok := layouts[int(message.Header.MessageType)]
+	if !ok {
+		return nil
+	}
+
+	frame := utils.NewFrame(l.headerBits() + uint(len(message.Satellites))*l.satelliteBits())
+
+	h := &message.Header
+	var pos uint = utils.LeaderLengthBits
+	pos = utils.SetBits(frame, pos, lenMessageType, uint64(h.MessageType))
+	pos = utils.SetBits(frame, pos, lenStationID, uint64(h.StationID))
+	if l.glonass {
+		pos = utils.SetBits(frame, pos, lenGlonassEpochTime, uint64(h.EpochTime))
+	} else {
+		pos = utils.SetBits(frame, pos, lenGPSEpochTime, uint64(h.EpochTime))
+	}
+	pos = utils.SetFlag(frame, pos, h.SynchronousGNSS)
+	pos = utils.SetBits(frame, pos, lenNumSatellites, uint64(len(message.Satellites)))
+	pos = utils.SetFlag(frame, pos, h.SmoothingIndicator)
+	pos = utils.SetBits(frame, pos, lenSmoothingInterval, uint64(h.SmoothingInterval))
+
+	for i := range message.Satellites {
+		s := &message.Satellites[i]
+		pos = utils.SetBits(frame, pos, lenSatelliteID, uint64(s.ID))
+		pos = utils.SetBits(frame, pos, lenL1CodeIndicator, uint64(s.L1CodeIndicator))
+		if l.glonass {
+			pos = utils.SetBits(frame, pos, lenFrequencyChannel, uint64(s.FrequencyChannel))
+			pos = utils.SetBits(frame, pos, lenGlonassL1Pseudorange, uint64(s.L1Pseudorange))
+		} else {
+			pos = utils.SetBits(frame, pos, lenGPSL1Pseudorange, uint64(s.L1Pseudorange))
+		}
+		pos = utils.SetBits(frame, pos, lenPhaseRangeDifference, uint64(s.L1PhaseRangeDifference))
+		pos = utils.SetBits(frame, pos, lenLockTimeIndicator, uint64(s.L1LockTimeIndicator))
+		if l.extended {
+			if l.glonass {
+				pos = utils.SetBits(frame, pos, lenGlonassAmbiguity, uint64(s.L1Ambiguity))
+			} else {
+				pos = utils.SetBits(frame, pos, lenGPSAmbiguity, uint64(s.L1Ambiguity))
+			}
+			pos = utils.SetBits(frame, pos, lenCNR, uint64(s.L1CNR))
+		}
+		if l.l2 {
+			pos = utils.SetBits(frame, pos, lenL2CodeIndicator, uint64(s.L2CodeIndicator))
+			pos = utils.SetBits(frame, pos, lenPseudorangeDifference, uint64(s.L2PseudorangeDifference))
+			pos = utils.SetBits(frame, pos, lenPhaseRangeDifference, uint64(s.L2PhaseRangeDifference))
+			pos = utils.SetBits(frame, pos, lenLockTimeIndicator, uint64(s.L2LockTimeIndicator))
+			if l.extended {
+				pos = utils.SetBits(frame, pos, lenCNR, uint64(s.L2CNR))
+			}
+		}
+	}
+
+	utils.SetCRC(frame)
+
+	return frame
+}
+
+// GetMessage extracts a legacy observation message from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	if lenMessageInBits < lenMessageType {
+		em := fmt.Sprintf("overrun - expected at least %d bits in a legacy observation message, got %d",
+			lenMessageType, lenMessageInBits)
+		return nil, errors.New(em)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	messageType := uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	l, ok := layouts[int(messageType)]
+	if !ok {
+		em := fmt.Sprintf("message type %d is not a legacy observation message", messageType)
+		return nil, errors.New(em)
+	}
+
+	if lenMessageInBits < int(l.headerBits()) {
+		em := fmt.Sprintf("overrun - expected %d bits in the header of a message type %d, got %d",
+			l.headerBits(), messageType, lenMessageInBits)
+		return nil, errors.New(em)
+	}
+
+	var message Message
+	h := &message.Header
+	h.MessageType = messageType
+	h.StationID = uint(utils.GetBitsAsUint64(bitStream, pos, lenStationID))
+	pos += lenStationID
+	if l.glonass {
+		h.EpochTime = uint(utils.GetBitsAsUint64(bitStream, pos, lenGlonassEpochTime))
+		pos += lenGlonassEpochTime
+	} else {
+		h.EpochTime = uint(utils.GetBitsAsUint64(bitStream, pos, lenGPSEpochTime))
+		pos += lenGPSEpochTime
+	}
+	h.SynchronousGNSS = utils.GetBitsAsUint64(bitStream, pos, lenSynchronousGNSS) == 1
+	pos += lenSynchronousGNSS
+	h.NumSatellites = uint(utils.GetBitsAsUint64(bitStream, pos, lenNumSatellites))
+	pos += lenNumSatellites
+	h.SmoothingIndicator = utils.GetBitsAsUint64(bitStream, pos, lenSmoothingIndicator) == 1
+	pos += lenSmoothingIndicator
+	h.SmoothingInterval = uint(utils.GetBitsAsUint64(bitStream, pos, lenSmoothingInterval))
+	pos += lenSmoothingInterval
+
+	want := l.headerBits() + h.NumSatellites*l.satelliteBits()
+	if lenMessageInBits < int(want) {
+		em := fmt.Sprintf("overrun - expected %d bits in a message type %d with %d satellites, got %d",
+			want, messageType, h.NumSatellites, lenMessageInBits)
+		return nil, errors.New(em)
+	}
+
+	message.Satellites = make([]Satellite, h.NumSatellites)
+	for i := range message.Satellites {
+		s := &message.Satellites[i]
+		s.glonass = l.glonass
+		s.ID = uint(utils.GetBitsAsUint64(bitStream, pos, lenSatelliteID))
+		pos += lenSatelliteID
+		s.L1CodeIndicator = uint(utils.GetBitsAsUint64(bitStream, pos, lenL1CodeIndicator))
+		pos += lenL1CodeIndicator
+		if l.glonass {
+			s.FrequencyChannel = uint(utils.GetBitsAsUint64(bitStream, pos, lenFrequencyChannel))
+			pos += lenFrequencyChannel
+			s.L1Pseudorange = uint(utils.GetBitsAsUint64(bitStream, pos, lenGlonassL1Pseudorange))
+			pos += lenGlonassL1Pseudorange
+		} else {
+			s.L1Pseudorange = uint(utils.GetBitsAsUint64(bitStream, pos, lenGPSL1Pseudorange))
+			pos += lenGPSL1Pseudorange
+		}
+		s.L1PhaseRangeDifference = utils.GetBitsAsInt64(bitStream, pos, lenPhaseRangeDifference)
+		pos += lenPhaseRangeDifference
+		s.L1LockTimeIndicator = uint(utils.GetBitsAsUint64(bitStream, pos, lenLockTimeIndicator))
+		pos += lenLockTimeIndicator
+		if l.extended {
+			if l.glonass {
+				s.L1Ambiguity = uint(utils.GetBitsAsUint64(bitStream, pos, lenGlonassAmbiguity))
+				pos += lenGlonassAmbiguity
+			} else {
+				s.L1Ambiguity = uint(utils.GetBitsAsUint64(bitStream, pos, lenGPSAmbiguity))
+				pos += lenGPSAmbiguity
+			}
+			s.L1CNR = uint(utils.GetBitsAsUint64(bitStream, pos, lenCNR))
+			pos += lenCNR
+		}
+		if l.l2 {
+			s.L2CodeIndicator = uint(utils.GetBitsAsUint64(bitStream, pos, lenL2CodeIndicator))
+			pos += lenL2CodeIndicator
+			s.L2PseudorangeDifference = utils.GetBitsAsInt64(bitStream, pos, lenPseudorangeDifference)
+			pos += lenPseudorangeDifference
+			s.L2PhaseRangeDifference = utils.GetBitsAsInt64(bitStream, pos, lenPhaseRangeDifference)
+			pos += lenPhaseRangeDifference
+			s.L2LockTimeIndicator = uint(utils.GetBitsAsUint64(bitStream, pos, lenLockTimeIndicator))
+			pos += lenLockTimeIndicator
+			if l.extended {
+				s.L2CNR = uint(utils.GetBitsAsUint64(bitStream, pos, lenCNR))
+				pos += lenCNR
+			}
+		}
+	}
+
+	return &message, nil
+}
@@ -0,0 +1,278 @@
+package legacy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// newGPSMessage is a helper.  It returns a message of the given GPS type
+// with two satellites and every field set, so the fields that the type
+// doesn't carry must be cleared by the caller.
+func newGPSMessage(messageType uint) *Message {
+	return &Message{
+		Header: Header{
+			MessageType: messageType, StationID: 7, EpochTime: 262800000,
+			SynchronousGNSS: true, NumSatellites: 2,
+			SmoothingIndicator: false, SmoothingInterval: 3,
+		},
+		Satellites: []Satellite{
+			{
+				ID: 5, L1CodeIndicator: 0, L1Pseudorange: 1000000,
+				L1PhaseRangeDifference: 2000, L1LockTimeIndicator: 30,
+				L1Ambiguity: 70, L1CNR: 180,
+				L2CodeIndicator: 2, L2PseudorangeDifference: -100,
+				L2PhaseRangeDifference: InvalidPhaseRangeDifference,
+				L2LockTimeIndicator:    127, L2CNR: 160,
+			},
+			{
+				ID: 30, L1CodeIndicator: 1, L1Pseudorange: 16777215,
+				L1PhaseRangeDifference: -524287, L1LockTimeIndicator: 100,
+				L1Ambiguity: 255, L1CNR: 0,
+				L2CodeIndicator: 3, L2PseudorangeDifference: InvalidPseudorangeDifference,
+				L2PhaseRangeDifference: 524287,
+				L2LockTimeIndicator:    0, L2CNR: 255,
+			},
+		},
+	}
+}
+
+// newGlonassMessage is a helper.  It returns a message of type 1012 with
+// one satellite.
+func newGlonassMessage() *Message {
+	return &Message{
+		Header: Header{
+			MessageType: 1012, StationID: 4095, EpochTime: 45296789,
+			SynchronousGNSS: false, NumSatellites: 1,
+			SmoothingIndicator: true, SmoothingInterval: 7,
+		},
+		Satellites: []Satellite{
+			{
+				ID: 24, FrequencyChannel: 10, L1CodeIndicator: 1,
+				L1Pseudorange: 33554431, L1PhaseRangeDifference: -1,
+				L1LockTimeIndicator: 126, L1Ambiguity: 127, L1CNR: 1,
+				L2CodeIndicator: 1, L2PseudorangeDifference: 8191,
+				L2PhaseRangeDifference: -2, L2LockTimeIndicator: 23, L2CNR: 2,
+				glonass: true,
+			},
+		},
+	}
+}
+
+// clearFields is a helper.  It clears the fields of the satellites that
+// the message type doesn't carry.
+func clearFields(message *Message) {
+	l := layouts[int(message.Header.MessageType)]
+	for i := range message.Satellites {
+		s := &message.Satellites[i]
+		if !l.extended {
+			s.L1Ambiguity = 0
+			s.L1CNR = 0
+			s.L2CNR = 0
+		}
+		if !l.l2 {
+			s.L2CodeIndicator = 0
+			s.L2PseudorangeDifference = 0
+			s.L2PhaseRangeDifference = 0
+			s.L2LockTimeIndicator = 0
+			s.L2CNR = 0
+		}
+	}
+}
+
+// TestFrameAndGetMessage checks that each type of message survives a
+// round trip through Frame and GetMessage, and that the frames are the
+// right length.
+func TestFrameAndGetMessage(t *testing.T) {
+	var testData = []struct {
+		message    *Message
+		wantLength int // The length of the embedded message in bytes.
+	}{
+		{newGPSMessage(1001), (64 + 2*58 + 7) / 8},
+		{newGPSMessage(1002), (64 + 2*74 + 7) / 8},
+		{newGPSMessage(1003), (64 + 2*101 + 7) / 8},
+		{newGPSMessage(1004), (64 + 2*125 + 7) / 8},
+	}
+	for _, messageType := range []uint{1009, 1010, 1011, 1012} {
+		message := newGlonassMessage()
+		message.Header.MessageType = messageType
+		var satBits int
+		switch messageType {
+		case 1009:
+			satBits = 64
+		case 1010:
+			satBits = 79
+		case 1011:
+			satBits = 107
+		case 1012:
+			satBits = 130
+		}
+		testData = append(testData, struct {
+			message    *Message
+			wantLength int
+		}{message, (61 + satBits + 7) / 8})
+	}
+
+	for _, td := range testData {
+		want := td.message
+		clearFields(want)
+		messageType := want.Header.MessageType
+
+		frame := want.Frame()
+		gotLength := len(frame) - 6
+		if td.wantLength != gotLength {
+			t.Errorf("%d: want length %d got %d", messageType, td.wantLength, gotLength)
+		}
+
+		got, err := GetMessage(frame)
+		if err != nil {
+			t.Errorf("%d: %v", messageType, err)
+			continue
+		}
+
+		if !cmp.Equal(want, got, cmp.AllowUnexported(Satellite{})) {
+			t.Errorf("%d: %s", messageType, cmp.Diff(want, got, cmp.AllowUnexported(Satellite{})))
+		}
+	}
+}
+
+// TestSatelliteValues checks the conversions to metres, cycles and dB-Hz.
+func TestSatelliteValues(t *testing.T) {
+	const tolerance = 0.0000001
+
+	gps := newGPSMessage(1004).Satellites[0]
+	glonass := newGlonassMessage().Satellites[0]
+
+	wavelengthGPSL1 := 299792458.0 / 1575.42e6
+	wavelengthGPSL2 := 299792458.0 / 1227.60e6
+	wavelengthGlonassL1 := 299792458.0 / (1602e6 + 3*0.5625e6)
+	wavelengthGlonassL2 := 299792458.0 / (1246e6 + 3*0.4375e6)
+
+	gpsPseudorange := 70*299792.458 + 1000000*0.02
+	glonassPseudorange := 127*2*299792.458 + 33554431*0.02
+
+	var testData = []struct {
+		description string
+		want        float64
+		got         float64
+	}{
+		{"GPS L1 pseudorange", gpsPseudorange, gps.L1PseudorangeMetres()},
+		{"GPS L1 phase range metres", gpsPseudorange + 1, gps.L1PhaseRangeMetres()},
+		{"GPS L1 phase range", (gpsPseudorange + 1) / wavelengthGPSL1, gps.L1PhaseRange()},
+		{"GPS L2 pseudorange", gpsPseudorange - 2, gps.L2PseudorangeMetres()},
+		{"GPS L1 wavelength", wavelengthGPSL1, gps.L1Wavelength()},
+		{"GPS L2 wavelength", wavelengthGPSL2, gps.L2Wavelength()},
+		{"GPS L1 CNR", 45, gps.L1CNRdBHz()},
+		{"GPS L2 CNR", 40, gps.L2CNRdBHz()},
+		{"Glonass channel", 3, float64(glonass.Channel())},
+		{"Glonass L1 pseudorange", glonassPseudorange, glonass.L1PseudorangeMetres()},
+		{"Glonass L1 phase range", (glonassPseudorange - 0.0005) / wavelengthGlonassL1, glonass.L1PhaseRange()},
+		{"Glonass L2 pseudorange", glonassPseudorange + 8191*0.02, glonass.L2PseudorangeMetres()},
+		{"Glonass L2 phase range", (glonassPseudorange - 0.001) / wavelengthGlonassL2, glonass.L2PhaseRange()},
+	}
+	for _, td := range testData {
+		if math.Abs(td.want-td.got) > tolerance {
+			t.Errorf("%s: want %f got %f", td.description, td.want, td.got)
+		}
+	}
+
+	if !gps.L1PhaseRangeValid() || !gps.L2PseudorangeValid() || gps.L2PhaseRangeValid() {
+		t.Error("GPS satellite: wrong validity")
+	}
+}
+
+// TestLockTime checks LockTime at the edges of each range.
+func TestLockTime(t *testing.T) {
+	var testData = []struct {
+		indicator uint
+		want      uint
+	}{
+		{0, 0}, {23, 23}, {24, 24}, {47, 70}, {48, 72}, {71, 164},
+		{72, 168}, {95, 352}, {96, 360}, {119, 728}, {120, 744},
+		{126, 936}, {127, 937},
+	}
+	for _, td := range testData {
+		got := LockTime(td.indicator)
+		if td.want != got {
+			t.Errorf("%d: want %d got %d", td.indicator, td.want, got)
+		}
+	}
+}
+
+// TestString checks that String displays the messages in SI units.
+func TestString(t *testing.T) {
+	const wantGPS = `stationID 7, epoch time 262800000 (3d 1h 0m 0s 0ms)
+synchronous GNSS true, divergence free smoothing false, smoothing interval 3
+2 satellites
+Satellite ID {L1 code, L1 pseudorange m, L1 phase range, L1 lock s, L1 CNR, L2 code, L2 pseudorange m, L2 phase range, L2 lock s, L2 CNR}:
+ 5 {0, 21005472.060, 110384505.964, 36, 45.00, 2, 21005470.060, invalid, 937, 40.00}
+30 {1, 76782621.090, 403494019.624, 424, 0.00, 3, invalid, 314413071.250, 0, 63.75}
+`
+
+	const wantGlonass = `stationID 4095, epoch time 45296789 (12h 34m 56s 789ms Moscow time)
+synchronous GNSS false, divergence free smoothing true, smoothing interval 7
+1 satellites
+Satellite ID channel {L1 code, L1 pseudorange m, L1 phase range, L1 lock s, L1 CNR, L2 code, L2 pseudorange m, L2 phase range, L2 lock s, L2 CNR}:
+24  3 {1, 76818372.952, 410926496.599, 936, 0.25, 1, 76818536.772, 319609497.352, 23, 0.50}
+`
+
+	const wantL1Only = `stationID 7, epoch time 262800000 (3d 1h 0m 0s 0ms)
+synchronous GNSS true, divergence free smoothing false, smoothing interval 3
+2 satellites
+Satellite ID {L1 code, L1 pseudorange m, L1 phase range, L1 lock s}:
+ 5 {0, 20000.000, 105105.964, 36}
+30 {1, 335544.300, 1761919.624, 424}
+`
+
+	l1Only := newGPSMessage(1001)
+	clearFields(l1Only)
+
+	var testData = []struct {
+		message *Message
+		want    string
+	}{
+		{newGPSMessage(1004), wantGPS},
+		{newGlonassMessage(), wantGlonass},
+		{l1Only, wantL1Only},
+	}
+	for _, td := range testData {
+		got := td.message.String()
+		if td.want != got {
+			t.Error(diff.Diff(td.want, got))
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	frame1004 := newGPSMessage(1004).Frame()
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"empty", []byte{0xd3, 0, 0, 0, 0, 0},
+			"overrun - expected at least 12 bits in a legacy observation message, got 0"},
+		{"short header", frame1004[:10],
+			"overrun - expected 64 bits in the header of a message type 1004, got 32"},
+		{"short satellites", frame1004[:30],
+			"overrun - expected 314 bits in a message type 1004 with 2 satellites, got 192"},
+		{"wrong type", testdata.MessageFrameType1020,
+			"message type 1020 is not a legacy observation message"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
@@ -1,17 +1,25 @@
 package pushback
 
 import (
+	"bufio"
 	"errors"
+	"io"
+	"time"
 )
 
 type byteChan chan byte
 
-// ByteChannel is a channel of bytes with pushback.
+// ByteChannel is a channel of bytes with pushback.  The bytes come from a
+// channel or, if it's created by NewFromReader, from an io.Reader.
 type ByteChannel struct {
 	// pushBackBuffer contains any bytes that have been pushed back.
 	pushBackBuffer []byte
 	// This is the source of the bytes.
 	byteChan
+	// reader, if it's not nil, is the source of the bytes instead.
+	reader *bufio.Reader
+	// readError is the error, other than EOF, that ended the reading.
+	readError error
 }
 
 // New creates a ByteChannelWithPushback containing the given byte channel.
@@ -21,14 +29,36 @@ func New(ch chan byte) *ByteChannel {
 	return &bc
 }
 
-// Close closes the channel.
+// NewFromReader creates a ByteChannel that takes its bytes from the given
+// reader rather than from a channel, so no goroutine is needed to feed it.
+// The end of the input and any read error are reported as the channel being
+// closed.  Err gives the read error.  A reader can't time out, so
+// GetNextByteWithTimeout waits for it like GetNextByte.
+func NewFromReader(reader io.Reader) *ByteChannel {
+	bc := ByteChannel{reader: bufio.NewReader(reader)}
+	return &bc
+}
+
+// Err returns the error, other than EOF, that stopped the reader given to
+// NewFromReader, or nil if there wasn't one.
+func (bc *ByteChannel) Err() error {
+	return bc.readError
+}
+
+// Close closes the channel.  It does nothing to a reader.
 func (bc *ByteChannel) Close() {
+	if bc.reader != nil {
+		return
+	}
 	close(bc.byteChan)
 }
 
 // get reads the next byte from the channel (or returns an error),
 // ignoring any pushed back bytes.
 func (bc *ByteChannel) get() (byte, error) {
+	if bc.reader != nil {
+		return bc.read()
+	}
 	if bc.byteChan == nil {
 		return 0, errors.New("channel is nil")
 	}
@@ -39,6 +69,22 @@ func (bc *ByteChannel) get() (byte, error) {
 	return b, nil
 }
 
+// read reads the next byte from the reader.  The end of the input and any
+// error look like the channel being closed.
+func (bc *ByteChannel) read() (byte, error) {
+	if bc.readError != nil {
+		return 0, errors.New("done")
+	}
+	b, err := bc.reader.ReadByte()
+	if err != nil {
+		if err != io.EOF {
+			bc.readError = err
+		}
+		return 0, errors.New("done")
+	}
+	return b, nil
+}
+
 // GetNextByte gets the next byte from the channel or, if the channel
 // has been closed, returns an error.  If bytes have been pushed back,
 // it returns the first of them instead.
@@ -58,6 +104,147 @@ func (bc *ByteChannel) GetNextByte() (byte, error) {
 	return b, err
 }
 
+// GetNextByteWithTimeout is like GetNextByte but gives up and returns a
+// "timeout" error if no byte arrives within the given duration.  A duration of
+// zero or less only returns a byte if one is immediately available.
+func (bc *ByteChannel) GetNextByteWithTimeout(timeout time.Duration) (byte, error) {
+	if len(bc.pushBackBuffer) > 0 {
+		b := bc.pushBackBuffer[0]
+		bc.pushBackBuffer = bc.pushBackBuffer[1:]
+		return b, nil
+	}
+
+	if bc.reader != nil {
+		return bc.read()
+	}
+
+	if bc.byteChan == nil {
+		return 0, errors.New("channel is nil")
+	}
+
+	if timeout <= 0 {
+		select {
+		case b, more := <-bc.byteChan:
+			if !more {
+				return 0, errors.New("done")
+			}
+			return b, nil
+		default:
+			return 0, errors.New("timeout")
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case b, more := <-bc.byteChan:
+		if !more {
+			return 0, errors.New("done")
+		}
+		return b, nil
+	case <-timer.C:
+		return 0, errors.New("timeout")
+	}
+}
+
+// AppendUntil reads bytes up to and including the given delimiter and
+// appends them to the buffer.  If the input ends first, it returns what it
+// has read with the error.  Reading from a reader this way is much faster
+// than calling GetNextByte for each byte.
+func (bc *ByteChannel) AppendUntil(buffer []byte, delim byte) ([]byte, error) {
+	for len(bc.pushBackBuffer) > 0 {
+		b := bc.pushBackBuffer[0]
+		bc.pushBackBuffer = bc.pushBackBuffer[1:]
+		buffer = append(buffer, b)
+		if b == delim {
+			return buffer, nil
+		}
+	}
+
+	if bc.reader == nil {
+		for {
+			b, err := bc.get()
+			if err != nil {
+				return buffer, err
+			}
+			buffer = append(buffer, b)
+			if b == delim {
+				return buffer, nil
+			}
+		}
+	}
+
+	if bc.readError != nil {
+		return buffer, errors.New("done")
+	}
+	for {
+		chunk, err := bc.reader.ReadSlice(delim)
+		buffer = append(buffer, chunk...)
+		if err == nil {
+			return buffer, nil
+		}
+		if err != bufio.ErrBufferFull {
+			if err != io.EOF {
+				bc.readError = err
+			}
+			return buffer, errors.New("done")
+		}
+	}
+}
+
+// AppendBytes reads the given number of bytes and appends them to the
+// buffer.  If the input ends first, it returns what it has read with the
+// error.  Like AppendUntil, it's much faster than GetNextByte on a reader.
+func (bc *ByteChannel) AppendBytes(buffer []byte, n int) ([]byte, error) {
+	for n > 0 && len(bc.pushBackBuffer) > 0 {
+		buffer = append(buffer, bc.pushBackBuffer[0])
+		bc.pushBackBuffer = bc.pushBackBuffer[1:]
+		n--
+	}
+	if n == 0 {
+		return buffer, nil
+	}
+
+	if bc.reader == nil {
+		for ; n > 0; n-- {
+			b, err := bc.get()
+			if err != nil {
+				return buffer, err
+			}
+			buffer = append(buffer, b)
+		}
+		return buffer, nil
+	}
+
+	if bc.readError != nil {
+		return buffer, errors.New("done")
+	}
+	start := len(buffer)
+	if cap(buffer)-start < n {
+		grown := make([]byte, start, start+n)
+		copy(grown, buffer)
+		buffer = grown
+	}
+	buffer = buffer[:start+n]
+	got, err := io.ReadFull(bc.reader, buffer[start:])
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			bc.readError = err
+		}
+		return buffer[:start+got], errors.New("done")
+	}
+	return buffer, nil
+}
+
+// PushBackAll pushes back a sequence of bytes so that they are read again
+// before anything else, including any bytes already pushed back.
+func (bc *ByteChannel) PushBackAll(bytes []byte) {
+	buffer := make([]byte, 0, len(bytes)+len(bc.pushBackBuffer))
+	buffer = append(buffer, bytes...)
+	bc.pushBackBuffer = append(buffer, bc.pushBackBuffer...)
+}
+
 // Pushback pushes back a byte - the next call of FetchNextByte will read
 // from the buffer rather than the channel.
 func (bc *ByteChannel) PushBack(b byte) {
@@ -1,7 +1,10 @@
 package pushback
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestGetNextByte checks that GetNextByte correctly gets the next byte from the channel.
@@ -123,3 +126,196 @@ func TestPushBack(t *testing.T) {
 	}
 
 }
+
+// TestGetNextByteWithTimeout checks that GetNextByteWithTimeout gets the next
+// byte or times out.
+func TestGetNextByteWithTimeout(t *testing.T) {
+	ch := make(chan byte, 2)
+	bc := New(ch)
+	ch <- 'a'
+	ch <- 'b'
+
+	bc.PushBack('x')
+
+	var testData = []struct {
+		description string
+		timeout     time.Duration
+		want        byte
+		wantError   string
+	}{
+		{"pushed back", time.Millisecond, 'x', ""},
+		{"from channel", time.Millisecond, 'a', ""},
+		{"zero timeout", 0, 'b', ""},
+		{"timeout", time.Millisecond, 0, "timeout"},
+		{"zero timeout with no data", 0, 0, "timeout"},
+	}
+	for _, td := range testData {
+		got, err := bc.GetNextByteWithTimeout(td.timeout)
+		if len(td.wantError) > 0 {
+			if err == nil {
+				t.Errorf("%s: want an error", td.description)
+				continue
+			}
+			if err.Error() != td.wantError {
+				t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if got != td.want {
+			t.Errorf("%s: want %c got %c", td.description, td.want, got)
+		}
+	}
+
+	// Once the channel is closed we should get the "done" error.
+	bc.Close()
+	_, err := bc.GetNextByteWithTimeout(time.Millisecond)
+	if err == nil || err.Error() != "done" {
+		t.Errorf("want done error, got %v", err)
+	}
+}
+
+// TestPushBackAll checks that bytes pushed back as a sequence are read
+// again before any that were already pushed back.
+func TestPushBackAll(t *testing.T) {
+	const want = "abcxyz"
+
+	ch := make(chan byte, 10)
+	bc := New(ch)
+	ch <- 'z'
+	bc.Close()
+
+	bc.PushBack('y')
+	bc.PushBackAll([]byte("x"))
+	bc.PushBackAll([]byte("abc"))
+
+	got := ""
+	for {
+		b, err := bc.GetNextByte()
+		if err != nil {
+			break
+		}
+		got += string(b)
+	}
+
+	if got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+// failingReader is an io.Reader that gives some bytes and then an error.
+type failingReader struct {
+	data []byte
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		return 0, errors.New("broken")
+	}
+	n := copy(p, reader.data)
+	reader.data = reader.data[n:]
+	return n, nil
+}
+
+// TestNewFromReader checks that a ByteChannel made from a reader gives the
+// bytes, handles pushback and reports the end of the input as "done".
+func TestNewFromReader(t *testing.T) {
+	bc := NewFromReader(strings.NewReader("ab"))
+
+	first, err := bc.GetNextByte()
+	if err != nil || first != 'a' {
+		t.Fatalf("want a got %c, %v", first, err)
+	}
+	bc.PushBack(first)
+
+	var got []byte
+	for {
+		b, err := bc.GetNextByteWithTimeout(time.Millisecond)
+		if err != nil {
+			if err.Error() != "done" {
+				t.Errorf("want done got %v", err)
+			}
+			break
+		}
+		got = append(got, b)
+	}
+	if string(got) != "ab" {
+		t.Errorf("want ab got %q", got)
+	}
+	if bc.Err() != nil {
+		t.Errorf("want no error at the end of the input got %v", bc.Err())
+	}
+
+	// Close does nothing.
+	bc.Close()
+}
+
+// TestNewFromReaderError checks that a read error looks like the end of the
+// input and is given by Err.
+func TestNewFromReaderError(t *testing.T) {
+	bc := NewFromReader(&failingReader{data: []byte("x")})
+
+	if b, err := bc.GetNextByte(); err != nil || b != 'x' {
+		t.Fatalf("want x got %c, %v", b, err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := bc.GetNextByte(); err == nil || err.Error() != "done" {
+			t.Errorf("want done got %v", err)
+		}
+	}
+	if bc.Err() == nil || bc.Err().Error() != "broken" {
+		t.Errorf("want broken got %v", bc.Err())
+	}
+}
+
+// TestAppend checks AppendUntil and AppendBytes on a channel and on a
+// reader, with some bytes pushed back.
+func TestAppend(t *testing.T) {
+	const input = "abc|defgh"
+
+	newChannel := func() *ByteChannel {
+		ch := make(chan byte, len(input))
+		for i := range input {
+			ch <- input[i]
+		}
+		bc := New(ch)
+		bc.Close()
+		return bc
+	}
+	newReader := func() *ByteChannel {
+		return NewFromReader(strings.NewReader(input))
+	}
+
+	for _, source := range []struct {
+		description string
+		make        func() *ByteChannel
+	}{{"channel", newChannel}, {"reader", newReader}} {
+		bc := source.make()
+		first, _ := bc.GetNextByte()
+		bc.PushBack(first)
+
+		got, err := bc.AppendUntil([]byte(">"), '|')
+		if err != nil || string(got) != ">abc|" {
+			t.Errorf("%s: want >abc| got %q, %v", source.description, got, err)
+		}
+
+		got, err = bc.AppendBytes(nil, 3)
+		if err != nil || string(got) != "def" {
+			t.Errorf("%s: want def got %q, %v", source.description, got, err)
+		}
+
+		// The input ends before the count is reached.
+		got, err = bc.AppendBytes([]byte("x"), 5)
+		if err == nil || err.Error() != "done" || string(got) != "xgh" {
+			t.Errorf("%s: want xgh, done got %q, %v", source.description, got, err)
+		}
+
+		got, err = bc.AppendUntil(nil, '|')
+		if err == nil || err.Error() != "done" || len(got) != 0 {
+			t.Errorf("%s: want nothing, done got %q, %v", source.description, got, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package testdata
+
+import (
+	"github.com/goblimey/go-ntrip/rtcm/crc24q"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// The corpus holds one message frame of each type that the handler decodes,
+// for table-driven tests that cover them all.
+//
+// Captures are only available for some constellations.  The frames for the
+// others are derived from a GPS frame by Retype, which changes the message
+// type and recalculates the CRC.  The header, satellite and signal cells of
+// a derived frame are those of the GPS original, so the satellite and signal
+// IDs are not realistic for the constellation and a signal that the
+// constellation doesn't have is displayed without a wavelength.  The
+// timestamp is also that of the original, taken as a timestamp of the new
+// constellation.  That's enough to exercise the decoding.
+//
+// The ephemeris frames are hand-crafted - see ephemeris.go - and so are the
+// MSM1, MSM2, MSM3, MSM5 and MSM6 frames - see msm.go.  There are no
+// SSR samples since the handler doesn't decode those messages -
+// UnhandledMessageType1024 covers undecoded types.
+
+// CorpusEntry is one frame in the corpus.
+type CorpusEntry struct {
+	// Name is a short name for the frame, suitable for a file name.
+	Name string
+
+	// MessageType is the type of the message in the frame.
+	MessageType int
+
+	// Constellation is the constellation of an MSM, otherwise empty.
+	Constellation string
+
+	// Derived is true if the frame was made by Retype rather than captured
+	// or hand-crafted.
+	Derived bool
+
+	// Frame is the message frame, with leader and CRC.
+	Frame []byte
+}
+
+// MessageFrameType1029 is a message frame containing a message of type 1029
+// from station 2, sent at 12:00:00 UTC on 15th May 2023, with the text
+// "go-ntrip test corpus".  It was made by type1029.New.
+var MessageFrameType1029 = []byte{
+	0xd3, 0x00, 0x1d, 0x40, 0x50, 0x02, 0xea, 0xaf, 0x54, 0x60, 0x14, 0x14,
+	0x67, 0x6f, 0x2d, 0x6e, 0x74, 0x72, 0x69, 0x70, 0x20, 0x74, 0x65, 0x73,
+	0x74, 0x20, 0x63, 0x6f, 0x72, 0x70, 0x75, 0x73, 0x58, 0x97, 0xb1,
+}
+
+// Corpus holds the frames, ordered by message type.
+var Corpus = []CorpusEntry{
+	{"1005", utils.MessageType1005, "", false, MessageFrameType1005},
+	{"1006", utils.MessageType1006, "", false, MessageFrameType1006},
+	{"1019", utils.MessageType1019, "", false, MessageFrameType1019},
+	{"1020", utils.MessageType1020, "", false, MessageFrameType1020},
+	{"1029", utils.MessageType1029, "", false, MessageFrameType1029},
+	{"1042", utils.MessageType1042, "", false, MessageFrameType1042},
+	{"1044", utils.MessageType1044, "", false, MessageFrameType1044},
+	{"1045", utils.MessageType1045, "", false, MessageFrameType1045},
+	{"1046", utils.MessageType1046, "", false, MessageFrameType1046},
+	{"1071", 1071, "GPS", false, MessageFrameType1071},
+	{"1072", 1072, "GPS", false, MessageFrameType1072},
+	{"1073", 1073, "GPS", false, MessageFrameType1073},
+	{"1074", utils.MessageTypeMSM4GPS, "GPS", false, MessageFrameType1074_2},
+	{"1075", 1075, "GPS", false, MessageFrameType1075},
+	{"1077", utils.MessageTypeMSM7GPS, "GPS", false, Retype(MessageFrameType1077, utils.MessageTypeMSM7GPS)},
+	{"1084", utils.MessageTypeMSM4Glonass, "Glonass", true, Retype(MessageFrameType1074_2, utils.MessageTypeMSM4Glonass)},
+	{"1087", utils.MessageTypeMSM7Glonass, "Glonass", true, Retype(MessageFrameType1077, utils.MessageTypeMSM7Glonass)},
+	{"1094", utils.MessageTypeMSM4Galileo, "Galileo", true, Retype(MessageFrameType1074_2, utils.MessageTypeMSM4Galileo)},
+	{"1096", 1096, "Galileo", false, MessageFrameType1096},
+	{"1097", utils.MessageTypeMSM7Galileo, "Galileo", true, Retype(MessageFrameType1077, utils.MessageTypeMSM7Galileo)},
+	{"1104", utils.MessageTypeMSM4SBAS, "SBAS", true, Retype(MessageFrameType1074_2, utils.MessageTypeMSM4SBAS)},
+	{"1107", utils.MessageTypeMSM7SBAS, "SBAS", true, Retype(MessageFrameType1077, utils.MessageTypeMSM7SBAS)},
+	{"1114", utils.MessageTypeMSM4QZSS, "QZSS", true, Retype(MessageFrameType1074_2, utils.MessageTypeMSM4QZSS)},
+	{"1117", utils.MessageTypeMSM7QZSS, "QZSS", true, Retype(MessageFrameType1077, utils.MessageTypeMSM7QZSS)},
+	{"1124", utils.MessageTypeMSM4Beidou, "Beidou", true, Retype(MessageFrameType1074_2, utils.MessageTypeMSM4Beidou)},
+	{"1127", utils.MessageTypeMSM7Beidou, "Beidou", true, Retype(MessageFrameType1077, utils.MessageTypeMSM7Beidou)},
+	{"1134", utils.MessageTypeMSM4NavicIrnss, "NavIC/IRNSS", true, Retype(MessageFrameType1074_2, utils.MessageTypeMSM4NavicIrnss)},
+	{"1137", utils.MessageTypeMSM7NavicIrnss, "NavIC/IRNSS", true, Retype(MessageFrameType1077, utils.MessageTypeMSM7NavicIrnss)},
+	{"1230", utils.MessageTypeGCPB, "", false, Fake1230},
+	{"4072_0", utils.MessageType4072, "", false, Fake4072_0},
+}
+
+// Retype returns a copy of the first message frame in the given data with
+// the message type changed and the CRC recalculated.  Anything after the
+// frame is dropped.
+func Retype(frame []byte, messageType int) []byte {
+	length := int(frame[1]&0x03)<<8 | int(frame[2])
+	end := utils.LeaderLengthBytes + length
+
+	result := make([]byte, end, end+utils.CRCLengthBytes)
+	copy(result, frame[:end])
+
+	// The message type is the first 12 bits of the message.
+	result[3] = byte(messageType >> 4)
+	result[4] = byte(messageType&0x0f)<<4 | result[4]&0x0f
+
+	crc := crc24q.Checksum(result)
+	return append(result, crc24q.HiByte(crc), crc24q.MiByte(crc), crc24q.LoByte(crc))
+}
@@ -0,0 +1,73 @@
+package testdata
+
+// The ephemeris frames are hand-crafted.  The values are typical of the
+// broadcast ephemerides for May 2023 but they are not from any real satellite,
+// so they are only good for testing the decoding.
+
+// MessageFrameType1019 is a message frame containing a GPS ephemeris for
+// satellite G05, week 214 (2262 modulo 1024), with the reference time 08:00
+// on Monday.
+var MessageFrameType1019 = []byte{
+	0xd3, 0x00, 0x3d, 0x3f, 0xb1, 0x4d, 0x60, 0x7c, 0xf0, 0x2d, 0x46, 0x50,
+	0x00, 0xff, 0x9f, 0xf0, 0x45, 0x78, 0x2d, 0xf5, 0x53, 0x31, 0x37, 0x30,
+	0xe4, 0x74, 0x3b, 0xf6, 0xc6, 0x02, 0xa9, 0x93, 0x0c, 0x12, 0xaa, 0xa1,
+	0x0c, 0xcc, 0xcd, 0x46, 0x50, 0x00, 0x3b, 0xaa, 0x70, 0x34, 0x99, 0xff,
+	0xec, 0x27, 0x1d, 0x29, 0xc9, 0x1b, 0xaa, 0x1a, 0x7b, 0xbe, 0xf5, 0xff,
+	0xa7, 0x69, 0xe8, 0x00, 0xb0, 0x5a, 0xf6,
+}
+
+// MessageFrameType1020 is a message frame containing a Glonass ephemeris for
+// satellite R07 on frequency channel 5, with the reference time 08:45 Moscow
+// time.
+var MessageFrameType1020 = []byte{
+	0xd3, 0x00, 0x2d, 0x3f, 0xc1, 0xd9, 0xe8, 0x76, 0xa3, 0x21, 0xf9, 0x72,
+	0xb8, 0xbb, 0x74, 0xca, 0x8f, 0xcd, 0x36, 0x22, 0x75, 0x20, 0x12, 0xae,
+	0x06, 0x25, 0x4c, 0x10, 0x00, 0x13, 0x00, 0x1d, 0x0f, 0xba, 0x8c, 0xc0,
+	0x29, 0x9e, 0xe6, 0x7c, 0x00, 0x00, 0x01, 0x4a, 0x00, 0x00, 0x06, 0x00,
+	0xad, 0x36, 0x3f,
+}
+
+// MessageFrameType1042 is a message frame containing a Beidou ephemeris for
+// satellite C23 in BDT week 906.
+var MessageFrameType1042 = []byte{
+	0xd3, 0x00, 0x40, 0x41, 0x25, 0xc7, 0x14, 0x1f, 0x2e, 0x05, 0x19, 0x40,
+	0x00, 0x00, 0x34, 0xc7, 0x3a, 0xfb, 0x7f, 0x0f, 0xf5, 0x34, 0x4e, 0xc0,
+	0x3e, 0xbe, 0xc8, 0x5d, 0xfb, 0x63, 0x00, 0x27, 0xfa, 0x1a, 0x0a, 0x46,
+	0xb4, 0xa2, 0x99, 0x99, 0xa8, 0xca, 0x00, 0x01, 0x6b, 0x58, 0x22, 0xd7,
+	0x5b, 0xff, 0xf1, 0x27, 0x85, 0x77, 0x8d, 0x09, 0xe6, 0xb7, 0x71, 0x9e,
+	0xdc, 0x7f, 0xed, 0xae, 0x43, 0x4f, 0x88, 0x4b, 0x8e, 0xda,
+}
+
+// MessageFrameType1044 is a message frame containing a QZSS ephemeris for
+// satellite J02 (PRN 194) in week 214.
+var MessageFrameType1044 = []byte{
+	0xd3, 0x00, 0x3d, 0x41, 0x42, 0x46, 0x50, 0x00, 0x00, 0x14, 0xff, 0xf4,
+	0x9a, 0x13, 0x36, 0xc0, 0x60, 0x43, 0xbb, 0x8c, 0xf6, 0xe3, 0x92, 0xf4,
+	0x99, 0x30, 0xbe, 0x0c, 0x0f, 0xf3, 0x2b, 0xa6, 0x66, 0x69, 0x19, 0x43,
+	0xe7, 0xad, 0x82, 0x3f, 0xfc, 0x9f, 0xf1, 0xbc, 0x75, 0x57, 0x7d, 0x5b,
+	0xe5, 0x0f, 0x00, 0x21, 0x39, 0x57, 0xff, 0x97, 0x00, 0x36, 0x48, 0xd6,
+	0x10, 0x3d, 0xb8, 0x40, 0xfd, 0x9f, 0x5f,
+}
+
+// MessageFrameType1045 is a message frame containing a Galileo F/NAV
+// ephemeris for satellite E11 in GST week 1238.
+var MessageFrameType1045 = []byte{
+	0xd3, 0x00, 0x3e, 0x41, 0x52, 0xd3, 0x58, 0x50, 0x6b, 0xeb, 0xe1, 0x2c,
+	0x00, 0x3f, 0xfe, 0x3e, 0x01, 0x30, 0x16, 0x48, 0x06, 0x68, 0x7e, 0xe2,
+	0x58, 0x44, 0x10, 0xb0, 0x05, 0x1c, 0x00, 0x8d, 0x8e, 0xc8, 0x3f, 0xc2,
+	0xa8, 0x13, 0x33, 0x35, 0x2c, 0x0f, 0xff, 0x34, 0xaf, 0x7e, 0x56, 0xb0,
+	0x01, 0xe2, 0x7e, 0xdc, 0x55, 0x21, 0x60, 0x60, 0xca, 0x16, 0xad, 0x3f,
+	0xfc, 0x2c, 0x10, 0x28, 0x00, 0x12, 0xd0, 0x22,
+}
+
+// MessageFrameType1046 is a message frame containing a Galileo I/NAV
+// ephemeris for satellite E11 in GST week 1238, with the same orbit as
+// MessageFrameType1045.
+var MessageFrameType1046 = []byte{
+	0xd3, 0x00, 0x3f, 0x41, 0x62, 0xd3, 0x58, 0x50, 0x6b, 0xeb, 0xe1, 0x2c,
+	0x00, 0x3f, 0xfe, 0x3e, 0x01, 0x30, 0x16, 0x48, 0x06, 0x68, 0x7e, 0xe2,
+	0x58, 0x44, 0x10, 0xb0, 0x05, 0x1c, 0x00, 0x8d, 0x8e, 0xc8, 0x3f, 0xc2,
+	0xa8, 0x13, 0x33, 0x35, 0x2c, 0x0f, 0xff, 0x34, 0xaf, 0x7e, 0x56, 0xb0,
+	0x01, 0xe2, 0x7e, 0xdc, 0x55, 0x21, 0x60, 0x60, 0xca, 0x16, 0xad, 0x3f,
+	0xfc, 0x2c, 0x10, 0x28, 0x0b, 0x00, 0x06, 0xb5, 0x0c,
+}
@@ -0,0 +1,56 @@
+package testdata
+
+// The MSM1, MSM2, MSM3, MSM5 and MSM6 frames are hand-crafted.  They all have
+// the same timestamp and their satellites are at the same rough ranges, so
+// the decoded values can be compared.
+
+// MessageFrameType1071 is a message frame containing a GPS MSM1 with signals
+// 2 (L1 C/A) and 16 (L2C) from satellite 4 and signal 2 from satellite 9.  The
+// range delta of the third signal is invalid.
+var MessageFrameType1071 = []byte{
+	0xd3, 0x00, 0x1e, 0x42, 0xf0, 0x00, 0x44, 0xaa, 0x21, 0xec, 0x00, 0x00,
+	0x08, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x80, 0x00,
+	0x73, 0x42, 0x2f, 0x84, 0xd2, 0xed, 0xaf, 0x00, 0x00, 0x76, 0x66, 0xf7,
+}
+
+// MessageFrameType1072 is a message frame containing a GPS MSM2 with the
+// same satellites and signals as MessageFrameType1071.
+var MessageFrameType1072 = []byte{
+	0xd3, 0x00, 0x23, 0x43, 0x00, 0x00, 0x44, 0xaa, 0x21, 0xec, 0x00, 0x00,
+	0x08, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x80, 0x00,
+	0x73, 0x42, 0x2f, 0xfe, 0x44, 0x56, 0x0f, 0x12, 0x00, 0x30, 0x39, 0xbf,
+	0x26, 0x80, 0x72, 0x61, 0xfb,
+}
+
+// MessageFrameType1073 is a message frame containing a GPS MSM3 with the
+// same satellites and signals as MessageFrameType1071.
+var MessageFrameType1073 = []byte{
+	0xd3, 0x00, 0x28, 0x43, 0x10, 0x00, 0x44, 0xaa, 0x21, 0xec, 0x00, 0x00,
+	0x08, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x80, 0x00,
+	0x73, 0x42, 0x2f, 0x84, 0xd2, 0xed, 0xaf, 0x00, 0x03, 0xf2, 0x22, 0xb0,
+	0x78, 0x90, 0x01, 0x81, 0xcd, 0xf9, 0x34, 0x31, 0x0c, 0x36,
+}
+
+// MessageFrameType1075 is a message frame containing a GPS MSM5 with the
+// same satellites and signals as MessageFrameType1071.  The range delta and
+// the phase range rate delta of the third signal are invalid.
+var MessageFrameType1075 = []byte{
+	0xd3, 0x00, 0x37, 0x43, 0x30, 0x00, 0x44, 0xaa, 0x21, 0xec, 0x00, 0x00,
+	0x08, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x80, 0x00,
+	0x72, 0x42, 0x88, 0x03, 0x42, 0x2f, 0xfc, 0x00, 0x09, 0x88, 0x4d, 0x2e,
+	0xda, 0xf0, 0x00, 0x3f, 0x22, 0x2b, 0x07, 0x89, 0x00, 0x18, 0x1c, 0xdf,
+	0x93, 0x56, 0xcd, 0x4f, 0xb2, 0xe0, 0x46, 0xf0, 0x00, 0x00, 0xbc, 0x9b,
+	0xcf,
+}
+
+// MessageFrameType1096 is a message frame containing a Galileo MSM6 with
+// signals 2 (E1 C) and 23 (E5a Q) from satellite 11 and signal 2 from
+// satellite 24.  The range delta and the phase range delta of the third signal
+// are invalid.
+var MessageFrameType1096 = []byte{
+	0xd3, 0x00, 0x33, 0x44, 0x80, 0x00, 0x44, 0xaa, 0x21, 0xec, 0x00, 0x00,
+	0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x01, 0x00,
+	0x72, 0x42, 0x8b, 0x42, 0x2f, 0x84, 0xd2, 0x07, 0x6d, 0x70, 0x40, 0x00,
+	0x07, 0xe4, 0x45, 0x60, 0x3c, 0x48, 0x04, 0x00, 0x00, 0x05, 0x81, 0x00,
+	0x01, 0x8a, 0xd1, 0x98, 0x69, 0x10, 0xe0, 0x6f, 0xca,
+}
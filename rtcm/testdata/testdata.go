@@ -53,14 +53,28 @@ var UnhandledMessageType1024 = []byte{
 	0x4f, 0x5e, 0xe7,
 }
 
-// Fake1230 is a fake message with type 1230 (Glonass code/phase bias).
-// The contents is junk - it does not match the 1230 structure.
-// 1230 is 0x4ce.
+// Fake1230 is a hand-made message with type 1230 (Glonass code/phase bias).
+// It's from station 0, with the biases aligned and zero biases for L1 C/A
+// and L2 C/A.  1230 is 0x4ce.
 var Fake1230 = []byte{0xd3, 0x00, 0x08,
 	0x4c, 0xe0, 00, 0x8a, 0, 0, 0, 0,
 	0xa8, 0xf7, 0x2a,
 }
 
+// Fake4072_0 is a hand-made message with type 4072 (u-blox proprietary),
+// sub-type 0, with the bytes 1 to 8 as its data.  4072 is 0xfe8.
+var Fake4072_0 = []byte{0xd3, 0x00, 0x0b,
+	0xfe, 0x80, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+	0xda, 0xa1, 0xba,
+}
+
+// Fake4072_1 is a hand-made message with type 4072, sub-type 1, with four
+// bytes of data.
+var Fake4072_1 = []byte{0xd3, 0x00, 0x07,
+	0xfe, 0x80, 0x01, 0x55, 0xaa, 0x55, 0xaa,
+	0x45, 0xa2, 0x97,
+}
+
 var MessageFrameWithCRCFailure = []byte{
 	0xd3, 0, 0x08,
 	0x4c, 0xe0, 0x00,
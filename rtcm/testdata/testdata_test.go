@@ -32,3 +32,28 @@ func Test(t *testing.T) {
 
 	_ = crc
 }
+
+// TestRetype checks that Retype changes the message type, drops anything
+// after the frame and gives a valid CRC.
+func TestRetype(t *testing.T) {
+	frame := Retype(MessageFrameType1077, 1117)
+
+	if len(frame) != 225 {
+		t.Errorf("want 225 bytes got %d", len(frame))
+	}
+
+	messageType := int(frame[3])<<4 | int(frame[4])>>4
+	if messageType != 1117 {
+		t.Errorf("want type 1117 got %d", messageType)
+	}
+
+	crc := crc24q.Hash(frame[:len(frame)-3])
+	if crc24q.HiByte(crc) != frame[222] || crc24q.MiByte(crc) != frame[223] || crc24q.LoByte(crc) != frame[224] {
+		t.Error("CRC is wrong")
+	}
+
+	// The original is unchanged.
+	if MessageFrameType1077[4]>>4 != 0x05 {
+		t.Error("original changed")
+	}
+}
@@ -1,6 +1,8 @@
 package type1005
 
 import (
+	"bytes"
+	"encoding/hex"
 	"log/slog"
 	"testing"
 
@@ -132,3 +134,62 @@ func TestIncorrectMessageType(t *testing.T) {
 		t.Error("expected the message to be nil")
 	}
 }
+
+// TestCoarsen checks that Coarsen rounds the coordinates to the given
+// precision.
+func TestCoarsen(t *testing.T) {
+	var testData = []struct {
+		description string
+		metres      float64
+		wantX       int64
+		wantY       int64
+		wantZ       int64
+	}{
+		{"100 metres", 100, 38000000000, -1000000, 50000000000},
+		{"1 metre", 1, 38000120000, -1230000, 49999990000},
+		{"zero", 0, 38000123456, -1234567, 49999987654},
+	}
+	for _, td := range testData {
+		message := New(2, 3, 0, 38000123456, 0, -1234567, 0, 49999987654, slog.LevelInfo)
+
+		message.Coarsen(td.metres)
+
+		if message.AntennaRefX != td.wantX || message.AntennaRefY != td.wantY ||
+			message.AntennaRefZ != td.wantZ {
+			t.Errorf("%s: want (%d, %d, %d) got (%d, %d, %d)", td.description,
+				td.wantX, td.wantY, td.wantZ,
+				message.AntennaRefX, message.AntennaRefY, message.AntennaRefZ)
+		}
+	}
+}
+
+// TestFrame checks that Frame reproduces a message frame that's been
+// decoded.
+func TestFrame(t *testing.T) {
+	message, err := GetMessage(testdata.MessageFrameType1005, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.Frame()
+
+	if !bytes.Equal(testdata.MessageFrameType1005, got) {
+		t.Errorf("want\n%s\ngot\n%s",
+			hex.Dump(testdata.MessageFrameType1005), hex.Dump(got))
+	}
+}
+
+// TestFrameAndGetMessage checks that a message with negative coordinates
+// survives being turned into a frame and decoded again.
+func TestFrameAndGetMessage(t *testing.T) {
+	want := New(4095, 63, 0xf, -6378137, 3, -1, 2, -34359738368, slog.LevelDebug)
+
+	got, err := GetMessage(want.Frame(), slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *want != *got {
+		t.Errorf("want %v got %v", *want, *got)
+	}
+}
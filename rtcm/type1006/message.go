@@ -6,12 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 
 	"github.com/goblimey/go-ntrip/rtcm/utils"
 )
 
 const expectedMessageType = 1006
 
+// scaleFactor converts the antenna reference coordinates, which are in
+// units of 1/10,000 of a metre, to metres.
+const scaleFactor = 0.0001
+
 // Lengths of the fields in the bit stream.
 const lenMessageType = 12
 const lenStationID = 12
@@ -111,7 +116,6 @@ func (message *Message) String() string {
 	}
 
 	// The Antenna Reference coordinates and the height are in units of 1/10,000 of a metre.
-	const scaleFactor = 0.0001
 	x := float64(message.AntennaRefX) * scaleFactor
 	y := float64(message.AntennaRefY) * scaleFactor
 	z := float64(message.AntennaRefZ) * scaleFactor
@@ -126,6 +130,42 @@ func (message *Message) String() string {
 	return display
 }
 
+// Coarsen rounds each of the antenna reference coordinates to the nearest
+// multiple of the given distance in metres, so that the message can be
+// displayed without giving away the exact position of the base station.
+// A distance of zero or less leaves the coordinates alone.
+func (message *Message) Coarsen(metres float64) {
+	step := int64(math.Round(metres / scaleFactor))
+	if step <= 0 {
+		return
+	}
+	message.AntennaRefX = utils.RoundToMultiple(message.AntennaRefX, step)
+	message.AntennaRefY = utils.RoundToMultiple(message.AntennaRefY, step)
+	message.AntennaRefZ = utils.RoundToMultiple(message.AntennaRefZ, step)
+}
+
+// Frame returns the message as a complete RTCM3 message frame, with the
+// leader and the CRC, ready to be sent.  It's the reverse of GetMessage.
+func (message *Message) Frame() []byte {
+	frame := utils.NewFrame(lengthOfMessageInBits)
+
+	var pos uint = utils.LeaderLengthBits
+	pos = utils.SetBits(frame, pos, lenMessageType, expectedMessageType)
+	pos = utils.SetBits(frame, pos, lenStationID, uint64(message.StationID))
+	pos = utils.SetBits(frame, pos, lenITRFRealisationYear, uint64(message.ITRFRealisationYear))
+	pos = utils.SetBits(frame, pos, lenIgnoredBits1, uint64(message.Ignored1))
+	pos = utils.SetBits(frame, pos, lenAntennaRefX, uint64(message.AntennaRefX))
+	pos = utils.SetBits(frame, pos, lenIgnoredBits2, uint64(message.Ignored2))
+	pos = utils.SetBits(frame, pos, lenAntennaRefY, uint64(message.AntennaRefY))
+	pos = utils.SetBits(frame, pos, lenIgnoredBits3, uint64(message.Ignored3))
+	pos = utils.SetBits(frame, pos, lenAntennaRefZ, uint64(message.AntennaRefZ))
+	utils.SetBits(frame, pos, lenAntennaHeight, uint64(message.AntennaHeight))
+
+	utils.SetCRC(frame)
+
+	return frame
+}
+
 // GetMessage returns a text version of a message type 1006.  The
 // amount of data depends on the log level.
 func GetMessage(bitStream []byte, logLevel slog.Level) (*Message, error) {
@@ -1,6 +1,8 @@
 package type1006
 
 import (
+	"bytes"
+	"encoding/hex"
 	"log/slog"
 	"testing"
 
@@ -139,3 +141,48 @@ func TestIncorrectMessageType(t *testing.T) {
 		t.Error("expected the message to be nil")
 	}
 }
+
+// TestCoarsen checks that Coarsen rounds the coordinates to the given
+// precision and leaves the antenna height alone.
+func TestCoarsen(t *testing.T) {
+	message := New(2, 3, 0, 38000123456, 0, -1234567, 0, 49999987654, 15000, slog.LevelInfo)
+
+	message.Coarsen(100)
+
+	want := New(2, 3, 0, 38000000000, 0, -1000000, 0, 50000000000, 15000, slog.LevelInfo)
+
+	if *want != *message {
+		t.Errorf("want %v got %v", *want, *message)
+	}
+}
+
+// TestFrame checks that Frame reproduces a message frame that's been
+// decoded.
+func TestFrame(t *testing.T) {
+	message, err := GetMessage(testdata.MessageFrameType1006, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.Frame()
+
+	if !bytes.Equal(testdata.MessageFrameType1006, got) {
+		t.Errorf("want\n%s\ngot\n%s",
+			hex.Dump(testdata.MessageFrameType1006), hex.Dump(got))
+	}
+}
+
+// TestFrameAndGetMessage checks that a message with negative coordinates
+// survives being turned into a frame and decoded again.
+func TestFrameAndGetMessage(t *testing.T) {
+	want := New(4095, 63, 0xf, -6378137, 3, -1, 2, -34359738368, 0x8001, slog.LevelDebug)
+
+	got, err := GetMessage(want.Frame(), slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *want != *got {
+		t.Errorf("want %v got %v", *want, *got)
+	}
+}
@@ -0,0 +1,300 @@
+// type1019 handles messages of type 1019 - GPS ephemeris.  Each message
+// carries the broadcast orbit and clock parameters of one GPS satellite, as
+// sent by the satellite in its navigation message (see IS-GPS-200).  A rover
+// can use them to work out where the satellite is without waiting to collect
+// the navigation message itself.
+//
+// The orbit is given in Keplerian form.  The message sends the angles in
+// semicircles and most values as scaled integers.  The Message holds the
+// values as they were sent and String displays them in SI units, with the
+// angles in radians.
+package type1019
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+const expectedMessageType = 1019
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenSatelliteID = 6
+const lenWeekNumber = 10
+const lenURAIndex = 4
+const lenCodeOnL2 = 2
+const lenIDot = 14
+const lenIODE = 8
+const lenToc = 16
+const lenAf2 = 8
+const lenAf1 = 16
+const lenAf0 = 22
+const lenIODC = 10
+const lenCrs = 16
+const lenDeltaN = 16
+const lenM0 = 32
+const lenCuc = 16
+const lenEccentricity = 32
+const lenCus = 16
+const lenSqrtA = 32
+const lenToe = 16
+const lenCic = 16
+const lenOmega0 = 32
+const lenCis = 16
+const lenI0 = 32
+const lenCrc = 16
+const lenOmega = 32
+const lenOmegaDot = 24
+const lenTGD = 8
+const lenHealth = 6
+const lenL2PDataFlag = 1
+const lenFitInterval = 1
+
+const lengthOfMessageInBits = lenMessageType + lenSatelliteID + lenWeekNumber +
+	lenURAIndex + lenCodeOnL2 + lenIDot + lenIODE + lenToc + lenAf2 + lenAf1 +
+	lenAf0 + lenIODC + lenCrs + lenDeltaN + lenM0 + lenCuc + lenEccentricity +
+	lenCus + lenSqrtA + lenToe + lenCic + lenOmega0 + lenCis + lenI0 + lenCrc +
+	lenOmega + lenOmegaDot + lenTGD + lenHealth + lenL2PDataFlag + lenFitInterval
+
+// timeScale converts toc and toe to seconds of the GPS week.
+const timeScale = 16
+
+// Message contains a message of type 1019 - GPS ephemeris.  The comments
+// give the type of each field in the bit stream and the scale factor that
+// converts it to SI units.  Angles are in semicircles.
+type Message struct {
+	// MessageType - uint12 - always 1019.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// SatelliteID is the satellite number (PRN) - uint6.
+	SatelliteID uint `json:"satellite_id,omitempty"`
+
+	// WeekNumber is the GPS week number modulo 1024 - uint10.
+	WeekNumber uint `json:"week_number,omitempty"`
+
+	// URAIndex is the user range accuracy index - uint4.
+	URAIndex uint `json:"ura_index,omitempty"`
+
+	// CodeOnL2 says which code is sent on the L2 signal - bit(2).
+	CodeOnL2 uint `json:"code_on_l2,omitempty"`
+
+	// IDot is the rate of change of inclination - int14, 2^-43 semicircles/s.
+	IDot int64 `json:"idot,omitempty"`
+
+	// IODE is the issue of data (ephemeris) - uint8.
+	IODE uint `json:"iode,omitempty"`
+
+	// Toc is the clock reference time - uint16, 16 seconds.
+	Toc uint `json:"toc,omitempty"`
+
+	// Af2 is the clock drift rate - int8, 2^-55 s/s^2.
+	Af2 int64 `json:"af2,omitempty"`
+
+	// Af1 is the clock drift - int16, 2^-43 s/s.
+	Af1 int64 `json:"af1,omitempty"`
+
+	// Af0 is the clock bias - int22, 2^-31 s.
+	Af0 int64 `json:"af0,omitempty"`
+
+	// IODC is the issue of data (clock) - uint10.
+	IODC uint `json:"iodc,omitempty"`
+
+	// Crs is the sine harmonic correction to the orbit radius - int16, 2^-5 m.
+	Crs int64 `json:"crs,omitempty"`
+
+	// DeltaN is the mean motion difference - int16, 2^-43 semicircles/s.
+	DeltaN int64 `json:"delta_n,omitempty"`
+
+	// M0 is the mean anomaly at the reference time - int32, 2^-31 semicircles.
+	M0 int64 `json:"m0,omitempty"`
+
+	// Cuc is the cosine harmonic correction to the argument of latitude -
+	// int16, 2^-29 radians.
+	Cuc int64 `json:"cuc,omitempty"`
+
+	// Eccentricity - uint32, 2^-33.
+	Eccentricity uint64 `json:"eccentricity,omitempty"`
+
+	// Cus is the sine harmonic correction to the argument of latitude -
+	// int16, 2^-29 radians.
+	Cus int64 `json:"cus,omitempty"`
+
+	// SqrtA is the square root of the semi-major axis - uint32, 2^-19 m^1/2.
+	SqrtA uint64 `json:"sqrt_a,omitempty"`
+
+	// Toe is the ephemeris reference time - uint16, 16 seconds.
+	Toe uint `json:"toe,omitempty"`
+
+	// Cic is the cosine harmonic correction to the inclination - int16,
+	// 2^-29 radians.
+	Cic int64 `json:"cic,omitempty"`
+
+	// Omega0 is the longitude of the ascending node at the start of the
+	// week - int32, 2^-31 semicircles.
+	Omega0 int64 `json:"omega0,omitempty"`
+
+	// Cis is the sine harmonic correction to the inclination - int16, 2^-29
+	// radians.
+	Cis int64 `json:"cis,omitempty"`
+
+	// I0 is the inclination at the reference time - int32, 2^-31 semicircles.
+	I0 int64 `json:"i0,omitempty"`
+
+	// Crc is the cosine harmonic correction to the orbit radius - int16,
+	// 2^-5 m.
+	Crc int64 `json:"crc,omitempty"`
+
+	// Omega is the argument of perigee - int32, 2^-31 semicircles.
+	Omega int64 `json:"omega,omitempty"`
+
+	// OmegaDot is the rate of change of right ascension - int24, 2^-43
+	// semicircles/s.
+	OmegaDot int64 `json:"omega_dot,omitempty"`
+
+	// TGD is the group delay - int8, 2^-31 s.
+	TGD int64 `json:"tgd,omitempty"`
+
+	// Health is the satellite's health - uint6.  0 is healthy.
+	Health uint `json:"health,omitempty"`
+
+	// L2PDataFlag - bit(1).
+	L2PDataFlag uint `json:"l2p_data_flag,omitempty"`
+
+	// FitInterval - bit(1).  0 means four hours.
+	FitInterval uint `json:"fit_interval,omitempty"`
+}
+
+// scale returns the value multiplied by 2 to the power exp.
+func scale(value int64, exp int) float64 {
+	return math.Ldexp(float64(value), exp)
+}
+
+// String returns a text version of a message type 1019.
+func (message *Message) String() string {
+	display := fmt.Sprintf("satellite G%02d, week %d, IODE %d, IODC %d, URA index %d, health %d\n",
+		message.SatelliteID, message.WeekNumber, message.IODE, message.IODC,
+		message.URAIndex, message.Health)
+
+	display += fmt.Sprintf("clock: toc %d s, af0 %.4e s, af1 %.4e s/s, af2 %.4e s/s^2, TGD %.4e s\n",
+		message.Toc*timeScale, scale(message.Af0, -31), scale(message.Af1, -43),
+		scale(message.Af2, -55), scale(message.TGD, -31))
+
+	display += fmt.Sprintf("orbit: toe %d s, sqrt(A) %.6f m^1/2, e %.10f\n",
+		message.Toe*timeScale, scale(int64(message.SqrtA), -19),
+		scale(int64(message.Eccentricity), -33))
+
+	display += fmt.Sprintf("angles: i0 %.9f, OMEGA0 %.9f, omega %.9f, M0 %.9f rad\n",
+		scale(message.I0, -31)*math.Pi, scale(message.Omega0, -31)*math.Pi,
+		scale(message.Omega, -31)*math.Pi, scale(message.M0, -31)*math.Pi)
+
+	display += fmt.Sprintf("rates: delta n %.4e, IDOT %.4e, OMEGA dot %.4e rad/s\n",
+		scale(message.DeltaN, -43)*math.Pi, scale(message.IDot, -43)*math.Pi,
+		scale(message.OmegaDot, -43)*math.Pi)
+
+	display += fmt.Sprintf("corrections: Crs %.4f, Crc %.4f m, Cus %.4e, Cuc %.4e, Cis %.4e, Cic %.4e rad\n",
+		scale(message.Crs, -5), scale(message.Crc, -5),
+		scale(message.Cus, -29), scale(message.Cuc, -29),
+		scale(message.Cis, -29), scale(message.Cic, -29))
+
+	display += fmt.Sprintf("code on L2 %d, L2 P data flag %d, fit interval %d\n",
+		message.CodeOnL2, message.L2PDataFlag, message.FitInterval)
+
+	return display
+}
+
+// GetMessage extracts a message type 1019 from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	// Check that the bit stream is long enough.
+	if lenMessageInBits < lengthOfMessageInBits {
+		errorMessage := fmt.Sprintf("overrun - expected %d bits in a message type 1019, got %d",
+			lengthOfMessageInBits, lenMessageInBits)
+		return nil, errors.New(errorMessage)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	messageType := uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	// Sanity check.
+	if messageType != expectedMessageType {
+		em := fmt.Sprintf("expected message type %d got %d",
+			expectedMessageType, messageType)
+		return nil, errors.New(em)
+	}
+
+	var message Message
+	message.MessageType = messageType
+	message.SatelliteID = uint(utils.GetBitsAsUint64(bitStream, pos, lenSatelliteID))
+	pos += lenSatelliteID
+	message.WeekNumber = uint(utils.GetBitsAsUint64(bitStream, pos, lenWeekNumber))
+	pos += lenWeekNumber
+	message.URAIndex = uint(utils.GetBitsAsUint64(bitStream, pos, lenURAIndex))
+	pos += lenURAIndex
+	message.CodeOnL2 = uint(utils.GetBitsAsUint64(bitStream, pos, lenCodeOnL2))
+	pos += lenCodeOnL2
+	message.IDot = utils.GetBitsAsInt64(bitStream, pos, lenIDot)
+	pos += lenIDot
+	message.IODE = uint(utils.GetBitsAsUint64(bitStream, pos, lenIODE))
+	pos += lenIODE
+	message.Toc = uint(utils.GetBitsAsUint64(bitStream, pos, lenToc))
+	pos += lenToc
+	message.Af2 = utils.GetBitsAsInt64(bitStream, pos, lenAf2)
+	pos += lenAf2
+	message.Af1 = utils.GetBitsAsInt64(bitStream, pos, lenAf1)
+	pos += lenAf1
+	message.Af0 = utils.GetBitsAsInt64(bitStream, pos, lenAf0)
+	pos += lenAf0
+	message.IODC = uint(utils.GetBitsAsUint64(bitStream, pos, lenIODC))
+	pos += lenIODC
+	message.Crs = utils.GetBitsAsInt64(bitStream, pos, lenCrs)
+	pos += lenCrs
+	message.DeltaN = utils.GetBitsAsInt64(bitStream, pos, lenDeltaN)
+	pos += lenDeltaN
+	message.M0 = utils.GetBitsAsInt64(bitStream, pos, lenM0)
+	pos += lenM0
+	message.Cuc = utils.GetBitsAsInt64(bitStream, pos, lenCuc)
+	pos += lenCuc
+	message.Eccentricity = utils.GetBitsAsUint64(bitStream, pos, lenEccentricity)
+	pos += lenEccentricity
+	message.Cus = utils.GetBitsAsInt64(bitStream, pos, lenCus)
+	pos += lenCus
+	message.SqrtA = utils.GetBitsAsUint64(bitStream, pos, lenSqrtA)
+	pos += lenSqrtA
+	message.Toe = uint(utils.GetBitsAsUint64(bitStream, pos, lenToe))
+	pos += lenToe
+	message.Cic = utils.GetBitsAsInt64(bitStream, pos, lenCic)
+	pos += lenCic
+	message.Omega0 = utils.GetBitsAsInt64(bitStream, pos, lenOmega0)
+	pos += lenOmega0
+	message.Cis = utils.GetBitsAsInt64(bitStream, pos, lenCis)
+	pos += lenCis
+	message.I0 = utils.GetBitsAsInt64(bitStream, pos, lenI0)
+	pos += lenI0
+	message.Crc = utils.GetBitsAsInt64(bitStream, pos, lenCrc)
+	pos += lenCrc
+	message.Omega = utils.GetBitsAsInt64(bitStream, pos, lenOmega)
+	pos += lenOmega
+	message.OmegaDot = utils.GetBitsAsInt64(bitStream, pos, lenOmegaDot)
+	pos += lenOmegaDot
+	message.TGD = utils.GetBitsAsInt64(bitStream, pos, lenTGD)
+	pos += lenTGD
+	message.Health = uint(utils.GetBitsAsUint64(bitStream, pos, lenHealth))
+	pos += lenHealth
+	message.L2PDataFlag = uint(utils.GetBitsAsUint64(bitStream, pos, lenL2PDataFlag))
+	pos += lenL2PDataFlag
+	message.FitInterval = uint(utils.GetBitsAsUint64(bitStream, pos, lenFitInterval))
+
+	return &message, nil
+}
@@ -0,0 +1,78 @@
+package type1019
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestGetMessage checks that GetMessage extracts the fields of a message
+// type 1019.
+func TestGetMessage(t *testing.T) {
+	want := Message{
+		MessageType: 1019, SatelliteID: 5, WeekNumber: 214, URAIndex: 0, CodeOnL2: 1,
+		IDot: -784, IODE: 45, Toc: 18000, Af2: 0, Af1: -97, Af0: -257698, IODC: 45,
+		Crs: -2733, DeltaN: 12599, M0: 820278331, Cuc: -2362, Eccentricity: 44667660,
+		Cus: 4778, SqrtA: 2701970637, Toe: 18000, Cic: 59, Omega0: -1435487079,
+		Cis: -20, I0: 656222665, Crc: 7082, Omega: 444317429, OmegaDot: -22679,
+		TGD: -24, Health: 0, L2PDataFlag: 0, FitInterval: 0,
+	}
+
+	got, err := GetMessage(testdata.MessageFrameType1019)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(want, *got) {
+		t.Error(cmp.Diff(want, *got))
+	}
+}
+
+// TestString checks that String displays the message in SI units.
+func TestString(t *testing.T) {
+	const want = `satellite G05, week 214, IODE 45, IODC 45, URA index 0, health 0
+clock: toc 288000 s, af0 -1.2000e-04 s, af1 -1.1028e-11 s/s, af2 0.0000e+00 s/s^2, TGD -1.1176e-08 s
+orbit: toe 288000 s, sqrt(A) 5153.600000 m^1/2, e 0.0052000000
+angles: i0 0.960000001, OMEGA0 -2.100000000, omega 0.650000000, M0 1.200000000 rad
+rates: delta n 4.4998e-09, IDOT -2.8001e-10, OMEGA dot -8.1000e-09 rad/s
+corrections: Crs -85.4062, Crc 221.3125 m, Cus 8.8997e-06, Cuc -4.3996e-06, Cis -3.7253e-08, Cic 1.0990e-07 rad
+code on L2 1, L2 P data flag 0, fit interval 0
+`
+
+	message, err := GetMessage(testdata.MessageFrameType1019)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.String()
+	if want != got {
+		t.Error(diff.Diff(want, got))
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"short", testdata.MessageFrameType1019[:40],
+			"overrun - expected 488 bits in a message type 1019, got 272"},
+		{"wrong type", testdata.MessageFrameType1044,
+			"expected message type 1019 got 1044"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// type1020 handles messages of type 1020 - Glonass ephemeris.  Each message
+// carries the broadcast ephemeris of one Glonass satellite, as sent by the
+// satellite in its navigation message (see the GLONASS ICD).
+//
+// Unlike the other constellations, Glonass doesn't describe the orbit in
+// Keplerian form.  Instead it gives the position, velocity and acceleration
+// of the satellite in the PZ-90 earth-centred frame at a reference time, and
+// the rover integrates the equations of motion from there.  The times are in
+// Moscow time (UTC plus three hours).
+//
+// The signed values are sent as sign and magnitude rather than two's
+// complement.  The Message holds the values as they were sent and String
+// displays them in SI units.
+package type1020
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+const expectedMessageType = 1020
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenSatelliteID = 6
+const lenFrequencyChannel = 5
+const lenAlmanacHealth = 1
+const lenAlmanacHealthAvailable = 1
+const lenP1 = 2
+const lenTkHours = 5
+const lenTkMinutes = 6
+const lenTkHalfMinutes = 1
+const lenBn = 1
+const lenP2 = 1
+const lenTb = 7
+const lenVelocity = 24
+const lenPosition = 27
+const lenAcceleration = 5
+const lenP3 = 1
+const lenGammaN = 11
+const lenP = 2
+const lenLn3 = 1
+const lenTauN = 22
+const lenDeltaTauN = 5
+const lenEn = 5
+const lenP4 = 1
+const lenFT = 4
+const lenNT = 11
+const lenM = 2
+const lenAdditionalDataAvailable = 1
+const lenNA = 11
+const lenTauC = 32
+const lenN4 = 5
+const lenTauGPS = 22
+const lenLn5 = 1
+const lenReserved = 7
+
+const lengthOfMessageInBits = lenMessageType + lenSatelliteID +
+	lenFrequencyChannel + lenAlmanacHealth + lenAlmanacHealthAvailable + lenP1 +
+	lenTkHours + lenTkMinutes + lenTkHalfMinutes + lenBn + lenP2 + lenTb +
+	3*(lenVelocity+lenPosition+lenAcceleration) + lenP3 + lenGammaN + lenP +
+	lenLn3 + lenTauN + lenDeltaTauN + lenEn + lenP4 + lenFT + lenNT + lenM +
+	lenAdditionalDataAvailable + lenNA + lenTauC + lenN4 + lenTauGPS + lenLn5 +
+	lenReserved
+
+// frequencyChannelOffset converts the frequency channel field to the
+// channel number, -7 to +6.
+const frequencyChannelOffset = 7
+
+// tbScale converts tb to minutes of the day.
+const tbScale = 15
+
+// Message contains a message of type 1020 - Glonass ephemeris.  The comments
+// give the type of each field in the bit stream and the scale factor that
+// converts it to SI units.  intS is a sign-magnitude integer.
+type Message struct {
+	// MessageType - uint12 - always 1020.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// SatelliteID is the satellite's slot number - uint6.
+	SatelliteID uint `json:"satellite_id,omitempty"`
+
+	// FrequencyChannel is the frequency channel number plus 7 - uint5.
+	FrequencyChannel uint `json:"frequency_channel,omitempty"`
+
+	// AlmanacHealth is the health of the satellite according to the
+	// almanac - bit(1).  1 is healthy.
+	AlmanacHealth uint `json:"almanac_health,omitempty"`
+
+	// AlmanacHealthAvailable says whether AlmanacHealth is valid - bit(1).
+	AlmanacHealthAvailable uint `json:"almanac_health_available,omitempty"`
+
+	// P1 is the interval between adjacent values of tb - bit(2).
+	P1 uint `json:"p1,omitempty"`
+
+	// TkHours, TkMinutes and TkHalfMinutes give the time at which the
+	// navigation frame started, in Moscow time - uint5, uint6, bit(1).
+	TkHours       uint `json:"tk_hours,omitempty"`
+	TkMinutes     uint `json:"tk_minutes,omitempty"`
+	TkHalfMinutes uint `json:"tk_half_minutes,omitempty"`
+
+	// Bn is the most significant bit of the health flag - bit(1).  0 is
+	// healthy.
+	Bn uint `json:"bn,omitempty"`
+
+	// P2 is the oddness or evenness of tb - bit(1).
+	P2 uint `json:"p2,omitempty"`
+
+	// Tb is the reference time of the ephemeris in Moscow time - uint7, 15
+	// minutes.
+	Tb uint `json:"tb,omitempty"`
+
+	// Velocity is the X, Y and Z velocity of the satellite - intS24, 2^-20
+	// km/s.
+	Velocity [3]int64 `json:"velocity,omitempty"`
+
+	// Position is the X, Y and Z position of the satellite - intS27, 2^-11 km.
+	Position [3]int64 `json:"position,omitempty"`
+
+	// Acceleration is the X, Y and Z acceleration of the satellite due to
+	// the sun and the moon - intS5, 2^-30 km/s^2.
+	Acceleration [3]int64 `json:"acceleration,omitempty"`
+
+	// P3 says how many satellites the almanac covers - bit(1).
+	P3 uint `json:"p3,omitempty"`
+
+	// GammaN is the relative deviation of the carrier frequency - intS11,
+	// 2^-40.
+	GammaN int64 `json:"gamma_n,omitempty"`
+
+	// P is the Glonass-M operation mode - bit(2).
+	P uint `json:"p,omitempty"`
+
+	// Ln3 is the health flag from the third string - bit(1).
+	Ln3 uint `json:"ln3,omitempty"`
+
+	// TauN is the correction to the satellite's clock - intS22, 2^-30 s.
+	TauN int64 `json:"tau_n,omitempty"`
+
+	// DeltaTauN is the delay between the L2 and L1 signals - intS5, 2^-30 s.
+	DeltaTauN int64 `json:"delta_tau_n,omitempty"`
+
+	// En is the age of the data in days - uint5.
+	En uint `json:"en,omitempty"`
+
+	// P4 says whether the ephemeris has been updated - bit(1).
+	P4 uint `json:"p4,omitempty"`
+
+	// FT is the accuracy index - uint4.
+	FT uint `json:"ft,omitempty"`
+
+	// NT is the day number within the four-year interval - uint11.
+	NT uint `json:"nt,omitempty"`
+
+	// M is the type of satellite - bit(2).  01 is Glonass-M.
+	M uint `json:"m,omitempty"`
+
+	// AdditionalDataAvailable says whether the fields from NA onwards are
+	// valid - bit(1).
+	AdditionalDataAvailable uint `json:"additional_data_available,omitempty"`
+
+	// NA is the day number of the almanac within the four-year interval -
+	// uint11.
+	NA uint `json:"na,omitempty"`
+
+	// TauC is the difference between Glonass time and UTC(SU) - intS32,
+	// 2^-31 s.
+	TauC int64 `json:"tau_c,omitempty"`
+
+	// N4 is the number of the four-year interval since 1996 - uint5.
+	N4 uint `json:"n4,omitempty"`
+
+	// TauGPS is the fractional difference between GPS time and Glonass
+	// time - intS22, 2^-30 s.
+	TauGPS int64 `json:"tau_gps,omitempty"`
+
+	// Ln5 is the health flag from the fifth string - bit(1).
+	Ln5 uint `json:"ln5,omitempty"`
+}
+
+// scale returns the value multiplied by 2 to the power exp.
+func scale(value int64, exp int) float64 {
+	return math.Ldexp(float64(value), exp)
+}
+
+// String returns a text version of a message type 1020.
+func (message *Message) String() string {
+	channel := int(message.FrequencyChannel) - frequencyChannelOffset
+	tbMinutes := message.Tb * tbScale
+
+	display := fmt.Sprintf("satellite R%02d, frequency channel %d, health %d, age %d days\n",
+		message.SatelliteID, channel, message.Bn, message.En)
+
+	display += fmt.Sprintf("tk %02d:%02d:%02d, tb %02d:%02d Moscow time, day %d of four-year interval %d\n",
+		message.TkHours, message.TkMinutes, message.TkHalfMinutes*30,
+		tbMinutes/60, tbMinutes%60, message.NT, message.N4)
+
+	display += fmt.Sprintf("position (%.6f, %.6f, %.6f) km\n",
+		scale(message.Position[0], -11), scale(message.Position[1], -11),
+		scale(message.Position[2], -11))
+
+	display += fmt.Sprintf("velocity (%.6f, %.6f, %.6f) km/s\n",
+		scale(message.Velocity[0], -20), scale(message.Velocity[1], -20),
+		scale(message.Velocity[2], -20))
+
+	display += fmt.Sprintf("acceleration (%.4e, %.4e, %.4e) km/s^2\n",
+		scale(message.Acceleration[0], -30), scale(message.Acceleration[1], -30),
+		scale(message.Acceleration[2], -30))
+
+	display += fmt.Sprintf("clock: tau n %.4e s, gamma n %.4e, delta tau n %.4e s, tau c %.4e s, tau GPS %.4e s\n",
+		scale(message.TauN, -30), scale(message.GammaN, -40),
+		scale(message.DeltaTauN, -30), scale(message.TauC, -31),
+		scale(message.TauGPS, -30))
+
+	return display
+}
+
+// GetMessage extracts a message type 1020 from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	// Check that the bit stream is long enough.
+	if lenMessageInBits < lengthOfMessageInBits {
+		errorMessage := fmt.Sprintf("overrun - expected %d bits in a message type 1020, got %d",
+			lengthOfMessageInBits, lenMessageInBits)
+		return nil, errors.New(errorMessage)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	messageType := uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	// Sanity check.
+	if messageType != expectedMessageType {
+		em := fmt.Sprintf("expected message type %d got %d",
+			expectedMessageType, messageType)
+		return nil, errors.New(em)
+	}
+
+	var message Message
+	message.MessageType = messageType
+	message.SatelliteID = uint(utils.GetBitsAsUint64(bitStream, pos, lenSatelliteID))
+	pos += lenSatelliteID
+	message.FrequencyChannel = uint(utils.GetBitsAsUint64(bitStream, pos, lenFrequencyChannel))
+	pos += lenFrequencyChannel
+	message.AlmanacHealth = uint(utils.GetBitsAsUint64(bitStream, pos, lenAlmanacHealth))
+	pos += lenAlmanacHealth
+	message.AlmanacHealthAvailable = uint(utils.GetBitsAsUint64(bitStream, pos, lenAlmanacHealthAvailable))
+	pos += lenAlmanacHealthAvailable
+	message.P1 = uint(utils.GetBitsAsUint64(bitStream, pos, lenP1))
+	pos += lenP1
+	message.TkHours = uint(utils.GetBitsAsUint64(bitStream, pos, lenTkHours))
+	pos += lenTkHours
+	message.TkMinutes = uint(utils.GetBitsAsUint64(bitStream, pos, lenTkMinutes))
+	pos += lenTkMinutes
+	message.TkHalfMinutes = uint(utils.GetBitsAsUint64(bitStream, pos, lenTkHalfMinutes))
+	pos += lenTkHalfMinutes
+	message.Bn = uint(utils.GetBitsAsUint64(bitStream, pos, lenBn))
+	pos += lenBn
+	message.P2 = uint(utils.GetBitsAsUint64(bitStream, pos, lenP2))
+	pos += lenP2
+	message.Tb = uint(utils.GetBitsAsUint64(bitStream, pos, lenTb))
+	pos += lenTb
+
+	// The velocity, position and acceleration come in X, Y, Z order.
+	for i := range message.Position {
+		message.Velocity[i] = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenVelocity)
+		pos += lenVelocity
+		message.Position[i] = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenPosition)
+		pos += lenPosition
+		message.Acceleration[i] = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenAcceleration)
+		pos += lenAcceleration
+	}
+
+	message.P3 = uint(utils.GetBitsAsUint64(bitStream, pos, lenP3))
+	pos += lenP3
+	message.GammaN = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenGammaN)
+	pos += lenGammaN
+	message.P = uint(utils.GetBitsAsUint64(bitStream, pos, lenP))
+	pos += lenP
+	message.Ln3 = uint(utils.GetBitsAsUint64(bitStream, pos, lenLn3))
+	pos += lenLn3
+	message.TauN = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenTauN)
+	pos += lenTauN
+	message.DeltaTauN = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenDeltaTauN)
+	pos += lenDeltaTauN
+	message.En = uint(utils.GetBitsAsUint64(bitStream, pos, lenEn))
+	pos += lenEn
+	message.P4 = uint(utils.GetBitsAsUint64(bitStream, pos, lenP4))
+	pos += lenP4
+	message.FT = uint(utils.GetBitsAsUint64(bitStream, pos, lenFT))
+	pos += lenFT
+	message.NT = uint(utils.GetBitsAsUint64(bitStream, pos, lenNT))
+	pos += lenNT
+	message.M = uint(utils.GetBitsAsUint64(bitStream, pos, lenM))
+	pos += lenM
+	message.AdditionalDataAvailable = uint(utils.GetBitsAsUint64(bitStream, pos, lenAdditionalDataAvailable))
+	pos += lenAdditionalDataAvailable
+	message.NA = uint(utils.GetBitsAsUint64(bitStream, pos, lenNA))
+	pos += lenNA
+	message.TauC = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenTauC)
+	pos += lenTauC
+	message.N4 = uint(utils.GetBitsAsUint64(bitStream, pos, lenN4))
+	pos += lenN4
+	message.TauGPS = utils.GetBitsAsSignMagnitudeInt64(bitStream, pos, lenTauGPS)
+	pos += lenTauGPS
+	message.Ln5 = uint(utils.GetBitsAsUint64(bitStream, pos, lenLn5))
+
+	return &message, nil
+}
@@ -0,0 +1,80 @@
+package type1020
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestGetMessage checks that GetMessage extracts the fields of a message
+// type 1020, including the sign-magnitude values.
+func TestGetMessage(t *testing.T) {
+	want := Message{
+		MessageType: 1020, SatelliteID: 7, FrequencyChannel: 12,
+		AlmanacHealth: 1, AlmanacHealthAvailable: 1, P1: 3,
+		TkHours: 8, TkMinutes: 29, TkHalfMinutes: 1, Bn: 0, P2: 1, Tb: 35,
+		P3: 0, GammaN: 1, P: 3, Ln3: 0, TauN: -128849, DeltaTauN: -3, En: 0,
+		P4: 0, FT: 2, NT: 1231, M: 1, AdditionalDataAvailable: 1, NA: 1231,
+		TauC: -41, N4: 8, TauGPS: 6, Ln5: 0,
+		Velocity:     [3]int64{2226546, -1035574, -3016229},
+		Position:     [3]int64{-29744038, 18065664, 39878656},
+		Acceleration: [3]int64{10, -2, -3},
+	}
+
+	got, err := GetMessage(testdata.MessageFrameType1020)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(want, *got) {
+		t.Error(cmp.Diff(want, *got))
+	}
+}
+
+// TestString checks that String displays the message in SI units.
+func TestString(t *testing.T) {
+	const want = `satellite R07, frequency channel 5, health 0, age 0 days
+tk 08:29:30, tb 08:45 Moscow time, day 1231 of four-year interval 8
+position (-14523.456055, 8821.125000, 19472.000000) km
+velocity (2.123400, -0.987600, -2.876500) km/s
+acceleration (9.3132e-09, -1.8626e-09, -2.7940e-09) km/s^2
+clock: tau n -1.2000e-04 s, gamma n 9.0949e-13, delta tau n -2.7940e-09 s, tau c -1.9092e-08 s, tau GPS 5.5879e-09 s
+`
+
+	message, err := GetMessage(testdata.MessageFrameType1020)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.String()
+	if want != got {
+		t.Error(diff.Diff(want, got))
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"short", testdata.MessageFrameType1020[:40],
+			"overrun - expected 360 bits in a message type 1020, got 272"},
+		{"wrong type", testdata.MessageFrameType1019,
+			"expected message type 1020 got 1019"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
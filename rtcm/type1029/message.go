@@ -0,0 +1,208 @@
+// type1029 handles messages of type 1029 - Unicode Text String.  The message
+// carries a short piece of text in UTF-8, for example an announcement to the
+// users of a base station such as "maintenance at 12:00 UTC".
+package type1029
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+const expectedMessageType = 1029
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenStationID = 12
+const lenModifiedJulianDay = 16
+const lenSecondsOfDay = 17
+const lenNumCharacters = 7
+const lenNumCodeUnits = 8
+
+// lengthOfHeaderInBits is the length of the fixed part of the message.  The
+// text follows.
+const lengthOfHeaderInBits = lenMessageType + lenStationID +
+	lenModifiedJulianDay + lenSecondsOfDay + lenNumCharacters + lenNumCodeUnits
+
+// MaxCharacters is the largest number of characters that a message can carry.
+const MaxCharacters = 1<<lenNumCharacters - 1
+
+// MaxCodeUnits is the largest number of bytes of UTF-8 that a message can carry.
+const MaxCodeUnits = 1<<lenNumCodeUnits - 1
+
+// mjdOfUnixEpoch is the Modified Julian Day of 1st January 1970.
+const mjdOfUnixEpoch = 40587
+
+// Message contains a message of type 1029 - Unicode text string.
+type Message struct {
+	// MessageType - uint12 - always 1029.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// station ID - uint12.
+	StationID uint `json:"station_id,omitempty"`
+
+	// ModifiedJulianDay is the day on which the message was sent - uint16.
+	ModifiedJulianDay uint `json:"modified_julian_day,omitempty"`
+
+	// SecondsOfDay is the UTC time of day at which the message was sent - uint17.
+	SecondsOfDay uint `json:"seconds_of_day,omitempty"`
+
+	// NumCharacters is the number of Unicode characters in the text - uint7.
+	NumCharacters uint `json:"num_characters,omitempty"`
+
+	// NumCodeUnits is the number of bytes of UTF-8 in the text - uint8.
+	NumCodeUnits uint `json:"num_code_units,omitempty"`
+
+	// Text is the text.
+	Text string `json:"text,omitempty"`
+
+	// logLevel controls the data displayed by String.
+	logLevel slog.Level
+}
+
+// New creates a type 1029 message carrying the given text, sent at the given
+// time.  The logLevel is a slog-style logging level and controls the data
+// produced by the String function.  It returns an error if the text is not
+// valid UTF-8 or is too long.
+func New(stationID uint, sentAt time.Time, text string, logLevel slog.Level) (*Message, error) {
+	if !utf8.ValidString(text) {
+		return nil, errors.New("the text of a message type 1029 must be UTF-8")
+	}
+
+	numCharacters := utf8.RuneCountInString(text)
+	if numCharacters > MaxCharacters || len(text) > MaxCodeUnits {
+		em := fmt.Sprintf("the text of a message type 1029 can be at most %d characters and %d bytes, got %d and %d",
+			MaxCharacters, MaxCodeUnits, numCharacters, len(text))
+		return nil, errors.New(em)
+	}
+
+	sentAt = sentAt.UTC()
+	days := sentAt.Unix() / (24 * 3600)
+	secondsOfDay := sentAt.Hour()*3600 + sentAt.Minute()*60 + sentAt.Second()
+
+	message := Message{
+		MessageType:       utils.MessageType1029,
+		StationID:         stationID,
+		ModifiedJulianDay: uint(days + mjdOfUnixEpoch),
+		SecondsOfDay:      uint(secondsOfDay),
+		NumCharacters:     uint(numCharacters),
+		NumCodeUnits:      uint(len(text)),
+		Text:              text,
+		logLevel:          logLevel,
+	}
+
+	return &message, nil
+}
+
+// Time returns the time at which the message was sent, in UTC.
+func (message *Message) Time() time.Time {
+	days := int64(message.ModifiedJulianDay) - mjdOfUnixEpoch
+	return time.Unix(days*24*3600+int64(message.SecondsOfDay), 0).UTC()
+}
+
+// String returns a text version of a message type 1029.
+func (message *Message) String() string {
+	display := fmt.Sprintf("stationID %d, sent at %s\n",
+		message.StationID, message.Time().Format(utils.DateLayout))
+
+	if message.logLevel == slog.LevelDebug {
+		display += fmt.Sprintf("modified julian day %d, seconds of day %d, %d characters, %d bytes\n",
+			message.ModifiedJulianDay, message.SecondsOfDay,
+			message.NumCharacters, message.NumCodeUnits)
+	}
+
+	display += fmt.Sprintf("text %q\n", message.Text)
+
+	return display
+}
+
+// Frame returns the message as a complete RTCM3 message frame, with the
+// leader and the CRC, ready to be sent.
+func (message *Message) Frame() []byte {
+	frame := utils.NewFrame(uint(lengthOfHeaderInBits + 8*len(message.Text)))
+
+	var pos uint = utils.LeaderLengthBits
+	pos = utils.SetBits(frame, pos, lenMessageType, expectedMessageType)
+	pos = utils.SetBits(frame, pos, lenStationID, uint64(message.StationID))
+	pos = utils.SetBits(frame, pos, lenModifiedJulianDay, uint64(message.ModifiedJulianDay))
+	pos = utils.SetBits(frame, pos, lenSecondsOfDay, uint64(message.SecondsOfDay))
+	pos = utils.SetBits(frame, pos, lenNumCharacters, uint64(message.NumCharacters))
+	pos = utils.SetBits(frame, pos, lenNumCodeUnits, uint64(len(message.Text)))
+	for _, b := range []byte(message.Text) {
+		pos = utils.SetBits(frame, pos, 8, uint64(b))
+	}
+
+	utils.SetCRC(frame)
+
+	return frame
+}
+
+// GetMessage extracts a message type 1029 from a message frame.
+func GetMessage(bitStream []byte, logLevel slog.Level) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	// Check that the bit stream is long enough.
+	if lenMessageInBits < lengthOfHeaderInBits {
+		errorMessage := fmt.Sprintf("overrun - expected at least %d bits in a message type 1029, got %d",
+			lengthOfHeaderInBits, lenMessageInBits)
+		return nil, errors.New(errorMessage)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	messageType := uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	// Sanity check.
+	if messageType != expectedMessageType {
+		em := fmt.Sprintf("expected message type %d got %d",
+			expectedMessageType, messageType)
+		return nil, errors.New(em)
+	}
+
+	stationID := uint(utils.GetBitsAsUint64(bitStream, pos, lenStationID))
+	pos += lenStationID
+	modifiedJulianDay := uint(utils.GetBitsAsUint64(bitStream, pos, lenModifiedJulianDay))
+	pos += lenModifiedJulianDay
+	secondsOfDay := uint(utils.GetBitsAsUint64(bitStream, pos, lenSecondsOfDay))
+	pos += lenSecondsOfDay
+	numCharacters := uint(utils.GetBitsAsUint64(bitStream, pos, lenNumCharacters))
+	pos += lenNumCharacters
+	numCodeUnits := uint(utils.GetBitsAsUint64(bitStream, pos, lenNumCodeUnits))
+	pos += lenNumCodeUnits
+
+	if lenMessageInBits < lengthOfHeaderInBits+int(numCodeUnits)*8 {
+		errorMessage := fmt.Sprintf("overrun - expected %d bytes of text in a message type 1029, got %d",
+			numCodeUnits, (lenMessageInBits-lengthOfHeaderInBits)/8)
+		return nil, errors.New(errorMessage)
+	}
+
+	text := make([]byte, numCodeUnits)
+	for i := range text {
+		text[i] = byte(utils.GetBitsAsUint64(bitStream, pos, 8))
+		pos += 8
+	}
+
+	message := Message{
+		MessageType:       messageType,
+		StationID:         stationID,
+		ModifiedJulianDay: modifiedJulianDay,
+		SecondsOfDay:      secondsOfDay,
+		NumCharacters:     numCharacters,
+		NumCodeUnits:      numCodeUnits,
+		Text:              string(text),
+		logLevel:          logLevel,
+	}
+
+	return &message, nil
+}
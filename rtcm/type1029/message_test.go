@@ -0,0 +1,166 @@
+package type1029
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestNew checks that New fills in the fields.
+func TestNew(t *testing.T) {
+	sentAt := time.Date(2024, time.September, 1, 11, 30, 5, 0, time.UTC)
+
+	got, err := New(42, sentAt, "maintenance at 12:00 UTC", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Message{
+		MessageType:       1029,
+		StationID:         42,
+		ModifiedJulianDay: 60554,
+		SecondsOfDay:      41405,
+		NumCharacters:     24,
+		NumCodeUnits:      24,
+		Text:              "maintenance at 12:00 UTC",
+		logLevel:          slog.LevelInfo,
+	}
+
+	if !cmp.Equal(want, *got, cmp.AllowUnexported(Message{})) {
+		t.Error(cmp.Diff(want, *got, cmp.AllowUnexported(Message{})))
+	}
+
+	if !got.Time().Equal(sentAt) {
+		t.Errorf("want %v got %v", sentAt, got.Time())
+	}
+}
+
+// TestNewWithBadText checks that New rejects text that can't be sent.
+func TestNewWithBadText(t *testing.T) {
+	var testData = []struct {
+		description string
+		text        string
+		wantError   string
+	}{
+		{"not UTF-8", "\xff", "the text of a message type 1029 must be UTF-8"},
+		{"too many characters", strings.Repeat("a", 128),
+			"the text of a message type 1029 can be at most 127 characters and 255 bytes, got 128 and 128"},
+		{"too many bytes", strings.Repeat("€", 100),
+			"the text of a message type 1029 can be at most 127 characters and 255 bytes, got 100 and 300"},
+	}
+	for _, td := range testData {
+		_, err := New(1, time.Now(), td.text, slog.LevelInfo)
+		if err == nil {
+			t.Errorf("%s: want an error", td.description)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestFrameAndGetMessage checks that a message survives being turned into a
+// frame and decoded again.
+func TestFrameAndGetMessage(t *testing.T) {
+	sentAt := time.Date(2024, time.September, 1, 23, 59, 59, 0, time.UTC)
+
+	for _, text := range []string{"", "maintenance at 12:00 UTC", "Wartung um 12:00 – bitte Geduld"} {
+		want, err := New(4095, sentAt, text, slog.LevelInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame := want.Frame()
+
+		if frame[0] != 0xd3 {
+			t.Errorf("want the frame to start with d3, got %02x", frame[0])
+		}
+		gotLength := int(frame[1])<<8 | int(frame[2])
+		if gotLength != len(frame)-6 {
+			t.Errorf("%q: want length %d in the leader, got %d", text, len(frame)-6, gotLength)
+		}
+
+		got, getError := GetMessage(frame, slog.LevelInfo)
+		if getError != nil {
+			t.Errorf("%q: %v", text, getError)
+			continue
+		}
+
+		if !cmp.Equal(*want, *got, cmp.AllowUnexported(Message{})) {
+			t.Error(cmp.Diff(*want, *got, cmp.AllowUnexported(Message{})))
+		}
+	}
+}
+
+// TestGetMessageWithShortBitStream checks that GetMessage rejects a
+// truncated message.
+func TestGetMessageWithShortBitStream(t *testing.T) {
+	message, _ := New(1, time.Now(), "hello", slog.LevelInfo)
+	frame := message.Frame()
+
+	var testData = []struct {
+		bitStream []byte
+		want      string
+	}{
+		{frame[:10], "overrun - expected at least 72 bits in a message type 1029, got 32"},
+		// Lose two bytes of the text.
+		{append(append([]byte{}, frame[:len(frame)-5]...), 0, 0, 0),
+			"overrun - expected 5 bytes of text in a message type 1029, got 3"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream, slog.LevelInfo)
+		if err == nil {
+			t.Errorf("want error %s", td.want)
+			continue
+		}
+		if err.Error() != td.want {
+			t.Errorf("want error %s got %s", td.want, err.Error())
+		}
+	}
+}
+
+// TestGetMessageWithWrongType checks that GetMessage rejects another type.
+func TestGetMessageWithWrongType(t *testing.T) {
+	message, _ := New(1, time.Now(), "hello", slog.LevelInfo)
+	frame := message.Frame()
+	// Change the type to 1030.
+	frame[4] = frame[4] + 0x10
+
+	_, err := GetMessage(frame, slog.LevelInfo)
+	if err == nil || err.Error() != "expected message type 1029 got 1030" {
+		t.Errorf("want a message type error, got %v", err)
+	}
+}
+
+// TestString checks the readable version of the message.
+func TestString(t *testing.T) {
+	sentAt := time.Date(2024, time.September, 1, 11, 30, 5, 0, time.UTC)
+
+	const wantInfo = "stationID 42, sent at 2024-09-01 11:30:05 +0000 UTC\n" +
+		"text \"maintenance at 12:00 UTC\"\n"
+
+	const wantDebug = "stationID 42, sent at 2024-09-01 11:30:05 +0000 UTC\n" +
+		"modified julian day 60554, seconds of day 41405, 24 characters, 24 bytes\n" +
+		"text \"maintenance at 12:00 UTC\"\n"
+
+	var testData = []struct {
+		logLevel slog.Level
+		want     string
+	}{
+		{slog.LevelInfo, wantInfo},
+		{slog.LevelDebug, wantDebug},
+	}
+	for _, td := range testData {
+		message, _ := New(42, sentAt, "maintenance at 12:00 UTC", td.logLevel)
+
+		got := message.String()
+		if got != td.want {
+			t.Error(diff.Diff(td.want, got))
+		}
+	}
+}
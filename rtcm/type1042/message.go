@@ -0,0 +1,291 @@
+// type1042 handles messages of type 1042 - Beidou ephemeris.  Each message
+// carries the broadcast orbit and clock parameters of one Beidou satellite,
+// as sent by the satellite in its navigation message (see the BDS Signal In
+// Space ICD).  The parameters are much like those of a GPS ephemeris (message
+// type 1019) but some of the fields are longer, the scale factors are
+// different and the times are in Beidou time (BDT).
+//
+// The orbit is given in Keplerian form.  The message sends the angles in
+// semicircles and most values as scaled integers.  The Message holds the
+// values as they were sent and String displays them in SI units, with the
+// angles in radians.
+package type1042
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+const expectedMessageType = 1042
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenSatelliteID = 6
+const lenWeekNumber = 13
+const lenURAIndex = 4
+const lenIDot = 14
+const lenAODE = 5
+const lenToc = 17
+const lenAf2 = 11
+const lenAf1 = 22
+const lenAf0 = 24
+const lenAODC = 5
+const lenCrs = 18
+const lenDeltaN = 16
+const lenM0 = 32
+const lenCuc = 18
+const lenEccentricity = 32
+const lenCus = 18
+const lenSqrtA = 32
+const lenToe = 17
+const lenCic = 18
+const lenOmega0 = 32
+const lenCis = 18
+const lenI0 = 32
+const lenCrc = 18
+const lenOmega = 32
+const lenOmegaDot = 24
+const lenTGD1 = 10
+const lenTGD2 = 10
+const lenHealth = 1
+
+const lengthOfMessageInBits = lenMessageType + lenSatelliteID + lenWeekNumber +
+	lenURAIndex + lenIDot + lenAODE + lenToc + lenAf2 + lenAf1 + lenAf0 +
+	lenAODC + lenCrs + lenDeltaN + lenM0 + lenCuc + lenEccentricity + lenCus +
+	lenSqrtA + lenToe + lenCic + lenOmega0 + lenCis + lenI0 + lenCrc +
+	lenOmega + lenOmegaDot + lenTGD1 + lenTGD2 + lenHealth
+
+// timeScale converts toc and toe to seconds of the BDT week.
+const timeScale = 8
+
+// groupDelayScale converts the group delays to seconds.
+const groupDelayScale = 1e-10
+
+// Message contains a message of type 1042 - Beidou ephemeris.  The comments
+// give the type of each field in the bit stream and the scale factor that
+// converts it to SI units.  Angles are in semicircles.
+type Message struct {
+	// MessageType - uint12 - always 1042.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// SatelliteID is the satellite number (PRN) - uint6.
+	SatelliteID uint `json:"satellite_id,omitempty"`
+
+	// WeekNumber is the BDT week number - uint13.  BDT week 0 started on
+	// 1st January 2006.
+	WeekNumber uint `json:"week_number,omitempty"`
+
+	// URAIndex is the user range accuracy index - uint4.
+	URAIndex uint `json:"ura_index,omitempty"`
+
+	// IDot is the rate of change of inclination - int14, 2^-43 semicircles/s.
+	IDot int64 `json:"idot,omitempty"`
+
+	// AODE is the age of data (ephemeris) - uint5.
+	AODE uint `json:"aode,omitempty"`
+
+	// Toc is the clock reference time - uint17, 8 seconds.
+	Toc uint `json:"toc,omitempty"`
+
+	// Af2 is the clock drift rate - int11, 2^-66 s/s^2.
+	Af2 int64 `json:"af2,omitempty"`
+
+	// Af1 is the clock drift - int22, 2^-50 s/s.
+	Af1 int64 `json:"af1,omitempty"`
+
+	// Af0 is the clock bias - int24, 2^-33 s.
+	Af0 int64 `json:"af0,omitempty"`
+
+	// AODC is the age of data (clock) - uint5.
+	AODC uint `json:"aodc,omitempty"`
+
+	// Crs is the sine harmonic correction to the orbit radius - int18, 2^-6 m.
+	Crs int64 `json:"crs,omitempty"`
+
+	// DeltaN is the mean motion difference - int16, 2^-43 semicircles/s.
+	DeltaN int64 `json:"delta_n,omitempty"`
+
+	// M0 is the mean anomaly at the reference time - int32, 2^-31 semicircles.
+	M0 int64 `json:"m0,omitempty"`
+
+	// Cuc is the cosine harmonic correction to the argument of latitude -
+	// int18, 2^-31 radians.
+	Cuc int64 `json:"cuc,omitempty"`
+
+	// Eccentricity - uint32, 2^-33.
+	Eccentricity uint64 `json:"eccentricity,omitempty"`
+
+	// Cus is the sine harmonic correction to the argument of latitude -
+	// int18, 2^-31 radians.
+	Cus int64 `json:"cus,omitempty"`
+
+	// SqrtA is the square root of the semi-major axis - uint32, 2^-19 m^1/2.
+	SqrtA uint64 `json:"sqrt_a,omitempty"`
+
+	// Toe is the ephemeris reference time - uint17, 8 seconds.
+	Toe uint `json:"toe,omitempty"`
+
+	// Cic is the cosine harmonic correction to the inclination - int18,
+	// 2^-31 radians.
+	Cic int64 `json:"cic,omitempty"`
+
+	// Omega0 is the longitude of the ascending node at the start of the
+	// week - int32, 2^-31 semicircles.
+	Omega0 int64 `json:"omega0,omitempty"`
+
+	// Cis is the sine harmonic correction to the inclination - int18, 2^-31
+	// radians.
+	Cis int64 `json:"cis,omitempty"`
+
+	// I0 is the inclination at the reference time - int32, 2^-31 semicircles.
+	I0 int64 `json:"i0,omitempty"`
+
+	// Crc is the cosine harmonic correction to the orbit radius - int18,
+	// 2^-6 m.
+	Crc int64 `json:"crc,omitempty"`
+
+	// Omega is the argument of perigee - int32, 2^-31 semicircles.
+	Omega int64 `json:"omega,omitempty"`
+
+	// OmegaDot is the rate of change of right ascension - int24, 2^-43
+	// semicircles/s.
+	OmegaDot int64 `json:"omega_dot,omitempty"`
+
+	// TGD1 is the group delay of the B1I signal - int10, 0.1 ns.
+	TGD1 int64 `json:"tgd1,omitempty"`
+
+	// TGD2 is the group delay of the B2I signal - int10, 0.1 ns.
+	TGD2 int64 `json:"tgd2,omitempty"`
+
+	// Health is the satellite's health - uint1.  0 is healthy.
+	Health uint `json:"health,omitempty"`
+}
+
+// scale returns the value multiplied by 2 to the power exp.
+func scale(value int64, exp int) float64 {
+	return math.Ldexp(float64(value), exp)
+}
+
+// String returns a text version of a message type 1042.
+func (message *Message) String() string {
+	display := fmt.Sprintf("satellite C%02d, week %d, AODE %d, AODC %d, URA index %d, health %d\n",
+		message.SatelliteID, message.WeekNumber, message.AODE, message.AODC,
+		message.URAIndex, message.Health)
+
+	display += fmt.Sprintf("clock: toc %d s, af0 %.4e s, af1 %.4e s/s, af2 %.4e s/s^2, TGD1 %.4e s, TGD2 %.4e s\n",
+		message.Toc*timeScale, scale(message.Af0, -33), scale(message.Af1, -50),
+		scale(message.Af2, -66), float64(message.TGD1)*groupDelayScale,
+		float64(message.TGD2)*groupDelayScale)
+
+	display += fmt.Sprintf("orbit: toe %d s, sqrt(A) %.6f m^1/2, e %.10f\n",
+		message.Toe*timeScale, scale(int64(message.SqrtA), -19),
+		scale(int64(message.Eccentricity), -33))
+
+	display += fmt.Sprintf("angles: i0 %.9f, OMEGA0 %.9f, omega %.9f, M0 %.9f rad\n",
+		scale(message.I0, -31)*math.Pi, scale(message.Omega0, -31)*math.Pi,
+		scale(message.Omega, -31)*math.Pi, scale(message.M0, -31)*math.Pi)
+
+	display += fmt.Sprintf("rates: delta n %.4e, IDOT %.4e, OMEGA dot %.4e rad/s\n",
+		scale(message.DeltaN, -43)*math.Pi, scale(message.IDot, -43)*math.Pi,
+		scale(message.OmegaDot, -43)*math.Pi)
+
+	display += fmt.Sprintf("corrections: Crs %.4f, Crc %.4f m, Cus %.4e, Cuc %.4e, Cis %.4e, Cic %.4e rad\n",
+		scale(message.Crs, -6), scale(message.Crc, -6),
+		scale(message.Cus, -31), scale(message.Cuc, -31),
+		scale(message.Cis, -31), scale(message.Cic, -31))
+
+	return display
+}
+
+// GetMessage extracts a message type 1042 from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	// Check that the bit stream is long enough.
+	if lenMessageInBits < lengthOfMessageInBits {
+		errorMessage := fmt.Sprintf("overrun - expected %d bits in a message type 1042, got %d",
+			lengthOfMessageInBits, lenMessageInBits)
+		return nil, errors.New(errorMessage)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	messageType := uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	// Sanity check.
+	if messageType != expectedMessageType {
+		em := fmt.Sprintf("expected message type %d got %d",
+			expectedMessageType, messageType)
+		return nil, errors.New(em)
+	}
+
+	var message Message
+	message.MessageType = messageType
+	message.SatelliteID = uint(utils.GetBitsAsUint64(bitStream, pos, lenSatelliteID))
+	pos += lenSatelliteID
+	message.WeekNumber = uint(utils.GetBitsAsUint64(bitStream, pos, lenWeekNumber))
+	pos += lenWeekNumber
+	message.URAIndex = uint(utils.GetBitsAsUint64(bitStream, pos, lenURAIndex))
+	pos += lenURAIndex
+	message.IDot = utils.GetBitsAsInt64(bitStream, pos, lenIDot)
+	pos += lenIDot
+	message.AODE = uint(utils.GetBitsAsUint64(bitStream, pos, lenAODE))
+	pos += lenAODE
+	message.Toc = uint(utils.GetBitsAsUint64(bitStream, pos, lenToc))
+	pos += lenToc
+	message.Af2 = utils.GetBitsAsInt64(bitStream, pos, lenAf2)
+	pos += lenAf2
+	message.Af1 = utils.GetBitsAsInt64(bitStream, pos, lenAf1)
+	pos += lenAf1
+	message.Af0 = utils.GetBitsAsInt64(bitStream, pos, lenAf0)
+	pos += lenAf0
+	message.AODC = uint(utils.GetBitsAsUint64(bitStream, pos, lenAODC))
+	pos += lenAODC
+	message.Crs = utils.GetBitsAsInt64(bitStream, pos, lenCrs)
+	pos += lenCrs
+	message.DeltaN = utils.GetBitsAsInt64(bitStream, pos, lenDeltaN)
+	pos += lenDeltaN
+	message.M0 = utils.GetBitsAsInt64(bitStream, pos, lenM0)
+	pos += lenM0
+	message.Cuc = utils.GetBitsAsInt64(bitStream, pos, lenCuc)
+	pos += lenCuc
+	message.Eccentricity = utils.GetBitsAsUint64(bitStream, pos, lenEccentricity)
+	pos += lenEccentricity
+	message.Cus = utils.GetBitsAsInt64(bitStream, pos, lenCus)
+	pos += lenCus
+	message.SqrtA = utils.GetBitsAsUint64(bitStream, pos, lenSqrtA)
+	pos += lenSqrtA
+	message.Toe = uint(utils.GetBitsAsUint64(bitStream, pos, lenToe))
+	pos += lenToe
+	message.Cic = utils.GetBitsAsInt64(bitStream, pos, lenCic)
+	pos += lenCic
+	message.Omega0 = utils.GetBitsAsInt64(bitStream, pos, lenOmega0)
+	pos += lenOmega0
+	message.Cis = utils.GetBitsAsInt64(bitStream, pos, lenCis)
+	pos += lenCis
+	message.I0 = utils.GetBitsAsInt64(bitStream, pos, lenI0)
+	pos += lenI0
+	message.Crc = utils.GetBitsAsInt64(bitStream, pos, lenCrc)
+	pos += lenCrc
+	message.Omega = utils.GetBitsAsInt64(bitStream, pos, lenOmega)
+	pos += lenOmega
+	message.OmegaDot = utils.GetBitsAsInt64(bitStream, pos, lenOmegaDot)
+	pos += lenOmegaDot
+	message.TGD1 = utils.GetBitsAsInt64(bitStream, pos, lenTGD1)
+	pos += lenTGD1
+	message.TGD2 = utils.GetBitsAsInt64(bitStream, pos, lenTGD2)
+	pos += lenTGD2
+	message.Health = uint(utils.GetBitsAsUint64(bitStream, pos, lenHealth))
+
+	return &message, nil
+}
@@ -0,0 +1,77 @@
+package type1042
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestGetMessage checks that GetMessage extracts the fields of a message
+// type 1042.
+func TestGetMessage(t *testing.T) {
+	want := Message{
+		MessageType: 1042, SatelliteID: 23, WeekNumber: 906, URAIndex: 0, IDot: -420,
+		AODE: 1, Toc: 36000, Af2: 0, Af1: 13511, Af0: 3865471, AODC: 1, Crs: -1382,
+		DeltaN: 10080, M0: 526345262, Cuc: -2362, Eccentricity: 5239860, Cus: 21045,
+		SqrtA: 2769603789, Toe: 36000, Cic: 90, Omega0: -704072234, Cis: -15,
+		I0: 663058317, Crc: 10138, Omega: -574194831, OmegaDot: -18759,
+		TGD1: 52, TGD2: -30, Health: 0,
+	}
+
+	got, err := GetMessage(testdata.MessageFrameType1042)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(want, *got) {
+		t.Error(cmp.Diff(want, *got))
+	}
+}
+
+// TestString checks that String displays the message in SI units.
+func TestString(t *testing.T) {
+	const want = `satellite C23, week 906, AODE 1, AODC 1, URA index 0, health 0
+clock: toc 288000 s, af0 4.5000e-04 s, af1 1.2000e-11 s/s, af2 0.0000e+00 s/s^2, TGD1 5.2000e-09 s, TGD2 -3.0000e-09 s
+orbit: toe 288000 s, sqrt(A) 5282.600000 m^1/2, e 0.0006100000
+angles: i0 0.970000000, OMEGA0 -1.030000000, omega -0.839999999, M0 0.770000000 rad
+rates: delta n 3.6001e-09, IDOT -1.5001e-10, OMEGA dot -6.6999e-09 rad/s
+corrections: Crs -21.5938, Crc 158.4062 m, Cus 9.7998e-06, Cuc -1.0999e-06, Cis -6.9849e-09, Cic 4.1910e-08 rad
+`
+
+	message, err := GetMessage(testdata.MessageFrameType1042)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.String()
+	if want != got {
+		t.Error(diff.Diff(want, got))
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"short", testdata.MessageFrameType1042[:40],
+			"overrun - expected 511 bits in a message type 1042, got 272"},
+		{"wrong type", testdata.MessageFrameType1077,
+			"expected message type 1042 got 1077"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
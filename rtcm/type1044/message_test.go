@@ -0,0 +1,78 @@
+package type1044
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestGetMessage checks that GetMessage extracts the fields of a message
+// type 1044.
+func TestGetMessage(t *testing.T) {
+	want := Message{
+		MessageType: 1044, SatelliteID: 2, Toc: 18000, Af2: 0, Af1: 20, Af0: -730,
+		IODE: 132, Crs: -12880, DeltaN: 6160, M0: -287097416, Cuc: -6979,
+		Eccentricity: 642527107, Cus: 1020, SqrtA: 3404306842, Toe: 18000,
+		Cic: -1557, Omega0: 1620049703, Cis: -913, I0: 492166998, Crc: -1725,
+		Omega: -1073197483, OmegaDot: -6720, IDot: 868, CodeOnL2: 2,
+		WeekNumber: 214, URAIndex: 1, Health: 0, TGD: -10, IODC: 900, FitInterval: 0,
+	}
+
+	got, err := GetMessage(testdata.MessageFrameType1044)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(want, *got) {
+		t.Error(cmp.Diff(want, *got))
+	}
+}
+
+// TestString checks that String displays the message in SI units.
+func TestString(t *testing.T) {
+	const want = `satellite J02 (PRN 194), week 214, IODE 132, IODC 900, URA index 1, health 0
+clock: toc 288000 s, af0 -3.3993e-07 s, af1 2.2737e-12 s/s, af2 0.0000e+00 s/s^2, TGD -4.6566e-09 s
+orbit: toe 288000 s, sqrt(A) 6493.200001 m^1/2, e 0.0747999999
+angles: i0 0.719999999, OMEGA0 2.370000000, omega -1.570000001, M0 -0.420000000 rad
+rates: delta n 2.2001e-09, IDOT 3.1001e-10, OMEGA dot -2.4001e-09 rad/s
+corrections: Crs -402.5000, Crc -53.9062 m, Cus 1.8999e-06, Cuc -1.2999e-05, Cis -1.7006e-06, Cic -2.9001e-06 rad
+code on L2 2, fit interval 0
+`
+
+	message, err := GetMessage(testdata.MessageFrameType1044)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := message.String()
+	if want != got {
+		t.Error(diff.Diff(want, got))
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"short", testdata.MessageFrameType1044[:40],
+			"overrun - expected 485 bits in a message type 1044, got 272"},
+		{"wrong type", testdata.MessageFrameType1019,
+			"expected message type 1044 got 1019"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// type1045 handles messages of types 1045 and 1046 - Galileo ephemeris.
+// Each message carries the broadcast orbit and clock parameters of one
+// Galileo satellite, as sent by the satellite in one of its navigation
+// messages (see the Galileo OS SIS ICD).  Type 1045 carries the F/NAV data,
+// which is sent on the E5a signal.  Type 1046 carries the I/NAV data, which
+// is sent on the E1-B and E5b signals.  The two messages are the same apart
+// from the group delays and the health flags at the end, so one package
+// handles both.
+//
+// The orbit is given in Keplerian form.  The message sends the angles in
+// semicircles and most values as scaled integers.  The Message holds the
+// values as they were sent and String displays them in SI units, with the
+// angles in radians.
+package type1045
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenSatelliteID = 6
+const lenWeekNumber = 12
+const lenIODNav = 10
+const lenSISAIndex = 8
+const lenIDot = 14
+const lenToc = 14
+const lenAf2 = 6
+const lenAf1 = 21
+const lenAf0 = 31
+const lenCrs = 16
+const lenDeltaN = 16
+const lenM0 = 32
+const lenCuc = 16
+const lenEccentricity = 32
+const lenCus = 16
+const lenSqrtA = 32
+const lenToe = 14
+const lenCic = 16
+const lenOmega0 = 32
+const lenCis = 16
+const lenI0 = 32
+const lenCrc = 16
+const lenOmega = 32
+const lenOmegaDot = 24
+const lenBGD = 10
+const lenHealth = 2
+const lenDataValidity = 1
+const lenReservedFNAV = 7
+const lenReservedINAV = 2
+
+// lengthOfCommonPartInBits is the length of the part of the message that is
+// the same in both types.
+const lengthOfCommonPartInBits = lenMessageType + lenSatelliteID +
+	lenWeekNumber + lenIODNav + lenSISAIndex + lenIDot + lenToc + lenAf2 +
+	lenAf1 + lenAf0 + lenCrs + lenDeltaN + lenM0 + lenCuc + lenEccentricity +
+	lenCus + lenSqrtA + lenToe + lenCic + lenOmega0 + lenCis + lenI0 + lenCrc +
+	lenOmega + lenOmegaDot + lenBGD
+
+// lengthOfFNAVMessageInBits is the length of a message type 1045.
+const lengthOfFNAVMessageInBits = lengthOfCommonPartInBits + lenHealth +
+	lenDataValidity + lenReservedFNAV
+
+// lengthOfINAVMessageInBits is the length of a message type 1046.
+const lengthOfINAVMessageInBits = lengthOfCommonPartInBits + lenBGD +
+	2*(lenHealth+lenDataValidity) + lenReservedINAV
+
+// timeScale converts toc and toe to seconds of the GST week.
+const timeScale = 60
+
+// Message contains a message of type 1045 or 1046 - Galileo ephemeris.  The
+// comments give the type of each field in the bit stream and the scale
+// factor that converts it to SI units.  Angles are in semicircles.
+type Message struct {
+	// MessageType - uint12 - 1045 (F/NAV) or 1046 (I/NAV).
+	MessageType uint `json:"message_type,omitempty"`
+
+	// SatelliteID is the satellite number - uint6.
+	SatelliteID uint `json:"satellite_id,omitempty"`
+
+	// WeekNumber is the Galileo System Time (GST) week number - uint12.  GST
+	// week 0 started on 22nd August 1999.
+	WeekNumber uint `json:"week_number,omitempty"`
+
+	// IODNav is the issue of data of the navigation data - uint10.
+	IODNav uint `json:"iod_nav,omitempty"`
+
+	// SISAIndex is the signal in space accuracy index - uint8.
+	SISAIndex uint `json:"sisa_index,omitempty"`
+
+	// IDot is the rate of change of inclination - int14, 2^-43 semicircles/s.
+	IDot int64 `json:"idot,omitempty"`
+
+	// Toc is the clock reference time - uint14, 60 seconds.
+	Toc uint `json:"toc,omitempty"`
+
+	// Af2 is the clock drift rate - int6, 2^-59 s/s^2.
+	Af2 int64 `json:"af2,omitempty"`
+
+	// Af1 is the clock drift - int21, 2^-46 s/s.
+	Af1 int64 `json:"af1,omitempty"`
+
+	// Af0 is the clock bias - int31, 2^-34 s.
+	Af0 int64 `json:"af0,omitempty"`
+
+	// Crs is the sine harmonic correction to the orbit radius - int16, 2^-5 m.
+	Crs int64 `json:"crs,omitempty"`
+
+	// DeltaN is the mean motion difference - int16, 2^-43 semicircles/s.
+	DeltaN int64 `json:"delta_n,omitempty"`
+
+	// M0 is the mean anomaly at the reference time - int32, 2^-31 semicircles.
+	M0 int64 `json:"m0,omitempty"`
+
+	// Cuc is the cosine harmonic correction to the argument of latitude -
+	// int16, 2^-29 radians.
+	Cuc int64 `json:"cuc,omitempty"`
+
+	// Eccentricity - uint32, 2^-33.
+	Eccentricity uint64 `json:"eccentricity,omitempty"`
+
+	// Cus is the sine harmonic correction to the argument of latitude -
+	// int16, 2^-29 radians.
+	Cus int64 `json:"cus,omitempty"`
+
+	// SqrtA is the square root of the semi-major axis - uint32, 2^-19 m^1/2.
+	SqrtA uint64 `json:"sqrt_a,omitempty"`
+
+	// Toe is the ephemeris reference time - uint14, 60 seconds.
+	Toe uint `json:"toe,omitempty"`
+
+	// Cic is the cosine harmonic correction to the inclination - int16,
+	// 2^-29 radians.
+	Cic int64 `json:"cic,omitempty"`
+
+	// Omega0 is the longitude of the ascending node at the start of the
+	// week - int32, 2^-31 semicircles.
+	Omega0 int64 `json:"omega0,omitempty"`
+
+	// Cis is the sine harmonic correction to the inclination - int16, 2^-29
+	// radians.
+	Cis int64 `json:"cis,omitempty"`
+
+	// I0 is the inclination at the reference time - int32, 2^-31 semicircles.
+	I0 int64 `json:"i0,omitempty"`
+
+	// Crc is the cosine harmonic correction to the orbit radius - int16,
+	// 2^-5 m.
+	Crc int64 `json:"crc,omitempty"`
+
+	// Omega is the argument of perigee - int32, 2^-31 semicircles.
+	Omega int64 `json:"omega,omitempty"`
+
+	// OmegaDot is the rate of change of right ascension - int24, 2^-43
+	// semicircles/s.
+	OmegaDot int64 `json:"omega_dot,omitempty"`
+
+	// BGDE5aE1 is the E5a/E1 broadcast group delay - int10, 2^-32 s.
+	BGDE5aE1 int64 `json:"bgd_e5a_e1,omitempty"`
+
+	// BGDE5bE1 is the E5b/E1 broadcast group delay - int10, 2^-32 s.  Only
+	// in a message type 1046.
+	BGDE5bE1 int64 `json:"bgd_e5b_e1,omitempty"`
+
+	// E5aHealth is the E5a signal health status - uint2.  Only in a message
+	// type 1045.
+	E5aHealth uint `json:"e5a_health,omitempty"`
+
+	// E5aDataValidity is the E5a data validity status - bit(1).  Only in a
+	// message type 1045.
+	E5aDataValidity uint `json:"e5a_data_validity,omitempty"`
+
+	// E5bHealth is the E5b signal health status - uint2.  Only in a message
+	// type 1046.
+	E5bHealth uint `json:"e5b_health,omitempty"`
+
+	// E5bDataValidity is the E5b data validity status - bit(1).  Only in a
+	// message type 1046.
+	E5bDataValidity uint `json:"e5b_data_validity,omitempty"`
+
+	// E1BHealth is the E1-B signal health status - uint2.  Only in a message
+	// type 1046.
+	E1BHealth uint `json:"e1b_health,omitempty"`
+
+	// E1BDataValidity is the E1-B data validity status - bit(1).  Only in a
+	// message type 1046.
+	E1BDataValidity uint `json:"e1b_data_validity,omitempty"`
+}
+
+// scale returns the value multiplied by 2 to the power exp.
+func scale(value int64, exp int) float64 {
+	return math.Ldexp(float64(value), exp)
+}
+
+// String returns a text version of a message type 1045 or 1046.
+func (message *Message) String() string {
+	source := "F/NAV"
+	if message.MessageType == utils.MessageType1046 {
+		source = "I/NAV"
+	}
+
+	display := fmt.Sprintf("satellite E%02d, %s, week %d, IODnav %d, SISA index %d\n",
+		message.SatelliteID, source, message.WeekNumber, message.IODNav, message.SISAIndex)
+
+	display += fmt.Sprintf("clock: toc %d s, af0 %.4e s, af1 %.4e s/s, af2 %.4e s/s^2\n",
+		message.Toc*timeScale, scale(message.Af0, -34), scale(message.Af1, -46),
+		scale(message.Af2, -59))
+
+	display += fmt.Sprintf("orbit: toe %d s, sqrt(A) %.6f m^1/2, e %.10f\n",
+		message.Toe*timeScale, scale(int64(message.SqrtA), -19),
+		scale(int64(message.Eccentricity), -33))
+
+	display += fmt.Sprintf("angles: i0 %.9f, OMEGA0 %.9f, omega %.9f, M0 %.9f rad\n",
+		scale(message.I0, -31)*math.Pi, scale(message.Omega0, -31)*math.Pi,
+		scale(message.Omega, -31)*math.Pi, scale(message.M0, -31)*math.Pi)
+
+	display += fmt.Sprintf("rates: delta n %.4e, IDOT %.4e, OMEGA dot %.4e rad/s\n",
+		scale(message.DeltaN, -43)*math.Pi, scale(message.IDot, -43)*math.Pi,
+		scale(message.OmegaDot, -43)*math.Pi)
+
+	display += fmt.Sprintf("corrections: Crs %.4f, Crc %.4f m, Cus %.4e, Cuc %.4e, Cis %.4e, Cic %.4e rad\n",
+		scale(message.Crs, -5), scale(message.Crc, -5),
+		scale(message.Cus, -29), scale(message.Cuc, -29),
+		scale(message.Cis, -29), scale(message.Cic, -29))
+
+	if message.MessageType == utils.MessageType1046 {
+		display += fmt.Sprintf("BGD E5a/E1 %.4e s, BGD E5b/E1 %.4e s, E5b health %d, E5b data validity %d, E1-B health %d, E1-B data validity %d\n",
+			scale(message.BGDE5aE1, -32), scale(message.BGDE5bE1, -32),
+			message.E5bHealth, message.E5bDataValidity,
+			message.E1BHealth, message.E1BDataValidity)
+	} else {
+		display += fmt.Sprintf("BGD E5a/E1 %.4e s, E5a health %d, E5a data validity %d\n",
+			scale(message.BGDE5aE1, -32), message.E5aHealth, message.E5aDataValidity)
+	}
+
+	return display
+}
+
+// GetMessage extracts a message type 1045 or 1046 from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	// Check that the bit stream is long enough to hold the message type.
+	if lenMessageInBits < lenMessageType {
+		errorMessage := fmt.Sprintf("overrun - expected at least %d bits in a Galileo ephemeris, got %d",
+			lenMessageType, lenMessageInBits)
+		return nil, errors.New(errorMessage)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	messageType := uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	// Sanity check.
+	var lengthOfMessageInBits int
+	switch messageType {
+	case utils.MessageType1045:
+		lengthOfMessageInBits = lengthOfFNAVMessageInBits
+	case utils.MessageType1046:
+		lengthOfMessageInBits = lengthOfINAVMessageInBits
+	default:
+		em := fmt.Sprintf("expected message type %d or %d got %d",
+			utils.MessageType1045, utils.MessageType1046, messageType)
+		return nil, errors.New(em)
+	}
+
+	// Check that the bit stream is long enough.
+	if lenMessageInBits < lengthOfMessageInBits {
+		errorMessage := fmt.Sprintf("overrun - expected %d bits in a message type %d, got %d",
+			lengthOfMessageInBits, messageType, lenMessageInBits)
+		return nil, errors.New(errorMessage)
+	}
+
+	var message Message
+	message.MessageType = messageType
+	message.SatelliteID = uint(utils.GetBitsAsUint64(bitStream, pos, lenSatelliteID))
+	pos += lenSatelliteID
+	message.WeekNumber = uint(utils.GetBitsAsUint64(bitStream, pos, lenWeekNumber))
+	pos += lenWeekNumber
+	message.IODNav = uint(utils.GetBitsAsUint64(bitStream, pos, lenIODNav))
+	pos += lenIODNav
+	message.SISAIndex = uint(utils.GetBitsAsUint64(bitStream, pos, lenSISAIndex))
+	pos += lenSISAIndex
+	message.IDot = utils.GetBitsAsInt64(bitStream, pos, lenIDot)
+	pos += lenIDot
+	message.Toc = uint(utils.GetBitsAsUint64(bitStream, pos, lenToc))
+	pos += lenToc
+	message.Af2 = utils.GetBitsAsInt64(bitStream, pos, lenAf2)
+	pos += lenAf2
+	message.Af1 = utils.GetBitsAsInt64(bitStream, pos, lenAf1)
+	pos += lenAf1
+	message.Af0 = utils.GetBitsAsInt64(bitStream, pos, lenAf0)
+	pos += lenAf0
+	message.Crs = utils.GetBitsAsInt64(bitStream, pos, lenCrs)
+	pos += lenCrs
+	message.DeltaN = utils.GetBitsAsInt64(bitStream, pos, lenDeltaN)
+	pos += lenDeltaN
+	message.M0 = utils.GetBitsAsInt64(bitStream, pos, lenM0)
+	pos += lenM0
+	message.Cuc = utils.GetBitsAsInt64(bitStream, pos, lenCuc)
+	pos += lenCuc
+	message.Eccentricity = utils.GetBitsAsUint64(bitStream, pos, lenEccentricity)
+	pos += lenEccentricity
+	message.Cus = utils.GetBitsAsInt64(bitStream, pos, lenCus)
+	pos += lenCus
+	message.SqrtA = utils.GetBitsAsUint64(bitStream, pos, lenSqrtA)
+	pos += lenSqrtA
+	message.Toe = uint(utils.GetBitsAsUint64(bitStream, pos, lenToe))
+	pos += lenToe
+	message.Cic = utils.GetBitsAsInt64(bitStream, pos, lenCic)
+	pos += lenCic
+	message.Omega0 = utils.GetBitsAsInt64(bitStream, pos, lenOmega0)
+	pos += lenOmega0
+	message.Cis = utils.GetBitsAsInt64(bitStream, pos, lenCis)
+	pos += lenCis
+	message.I0 = utils.GetBitsAsInt64(bitStream, pos, lenI0)
+	pos += lenI0
+	message.Crc = utils.GetBitsAsInt64(bitStream, pos, lenCrc)
+	pos += lenCrc
+	message.Omega = utils.GetBitsAsInt64(bitStream, pos, lenOmega)
+	pos += lenOmega
+	message.OmegaDot = utils.GetBitsAsInt64(bitStream, pos, lenOmegaDot)
+	pos += lenOmegaDot
+	message.BGDE5aE1 = utils.GetBitsAsInt64(bitStream, pos, lenBGD)
+	pos += lenBGD
+
+	if messageType == utils.MessageType1046 {
+		message.BGDE5bE1 = utils.GetBitsAsInt64(bitStream, pos, lenBGD)
+		pos += lenBGD
+		message.E5bHealth = uint(utils.GetBitsAsUint64(bitStream, pos, lenHealth))
+		pos += lenHealth
+		message.E5bDataValidity = uint(utils.GetBitsAsUint64(bitStream, pos, lenDataValidity))
+		pos += lenDataValidity
+		message.E1BHealth = uint(utils.GetBitsAsUint64(bitStream, pos, lenHealth))
+		pos += lenHealth
+		message.E1BDataValidity = uint(utils.GetBitsAsUint64(bitStream, pos, lenDataValidity))
+	} else {
+		message.E5aHealth = uint(utils.GetBitsAsUint64(bitStream, pos, lenHealth))
+		pos += lenHealth
+		message.E5aDataValidity = uint(utils.GetBitsAsUint64(bitStream, pos, lenDataValidity))
+	}
+
+	return &message, nil
+}
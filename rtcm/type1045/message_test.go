@@ -0,0 +1,116 @@
+package type1045
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// galileoOrbit returns a message holding the fields that the test frames
+// for types 1045 and 1046 have in common.
+func galileoOrbit(messageType uint) Message {
+	return Message{
+		MessageType: messageType, SatelliteID: 11, WeekNumber: 1238, IODNav: 80,
+		SISAIndex: 107, IDot: -1288, Toc: 4800, Af2: 0, Af1: -225, Af0: 4982162,
+		Crs: 410, DeltaN: 8120, M0: -1777269716, Cuc: 327, Eccentricity: 2319282,
+		Cus: 4080, SqrtA: 2852441293, Toe: 4800, Cic: -13, Omega0: 1257760107,
+		Cis: 30, I0: 669893970, Crc: 5638, Omega: 211905235, OmegaDot: -15679,
+		BGDE5aE1: 10,
+	}
+}
+
+// TestGetMessage checks that GetMessage extracts the fields of messages of
+// type 1045 and 1046.
+func TestGetMessage(t *testing.T) {
+	fnav := galileoOrbit(1045)
+	inav := galileoOrbit(1046)
+	inav.BGDE5bE1 = 11
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		want        Message
+	}{
+		{"F/NAV", testdata.MessageFrameType1045, fnav},
+		{"I/NAV", testdata.MessageFrameType1046, inav},
+	}
+	for _, td := range testData {
+		got, err := GetMessage(td.bitStream)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+
+		if !cmp.Equal(td.want, *got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, *got))
+		}
+	}
+}
+
+// TestString checks that String displays the messages in SI units.
+func TestString(t *testing.T) {
+	const orbit = `clock: toc 288000 s, af0 2.9000e-04 s, af1 -3.1974e-12 s/s, af2 0.0000e+00 s/s^2
+orbit: toe 288000 s, sqrt(A) 5440.600000 m^1/2, e 0.0002700000
+angles: i0 0.980000000, OMEGA0 1.840000000, omega 0.309999999, M0 -2.599999999 rad
+rates: delta n 2.9001e-09, IDOT -4.6002e-10, OMEGA dot -5.5999e-09 rad/s
+corrections: Crs 12.8125, Crc 176.1875 m, Cus 7.5996e-06, Cuc 6.0908e-07, Cis 5.5879e-08, Cic -2.4214e-08 rad
+`
+
+	const wantFNAV = "satellite E11, F/NAV, week 1238, IODnav 80, SISA index 107\n" + orbit +
+		"BGD E5a/E1 2.3283e-09 s, E5a health 0, E5a data validity 0\n"
+
+	const wantINAV = "satellite E11, I/NAV, week 1238, IODnav 80, SISA index 107\n" + orbit +
+		"BGD E5a/E1 2.3283e-09 s, BGD E5b/E1 2.5611e-09 s, E5b health 0, E5b data validity 0, E1-B health 0, E1-B data validity 0\n"
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		want        string
+	}{
+		{"F/NAV", testdata.MessageFrameType1045, wantFNAV},
+		{"I/NAV", testdata.MessageFrameType1046, wantINAV},
+	}
+	for _, td := range testData {
+		message, err := GetMessage(td.bitStream)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+
+		got := message.String()
+		if td.want != got {
+			t.Errorf("%s: %s", td.description, diff.Diff(td.want, got))
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"very short", testdata.MessageFrameType1045[:7],
+			"overrun - expected at least 12 bits in a Galileo ephemeris, got 8"},
+		{"short F/NAV", testdata.MessageFrameType1045[:62],
+			"overrun - expected 496 bits in a message type 1045, got 448"},
+		{"short I/NAV", testdata.MessageFrameType1046[:66],
+			"overrun - expected 504 bits in a message type 1046, got 480"},
+		{"wrong type", testdata.MessageFrameType1019,
+			"expected message type 1045 or 1046 got 1019"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
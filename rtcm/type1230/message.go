@@ -0,0 +1,245 @@
+// type1230 handles messages of type 1230 - Glonass L1 and L2 code-phase
+// biases.  Glonass receivers from different manufacturers measure code and
+// phase with different biases, which spoils ambiguity resolution when a
+// rover from one manufacturer uses corrections from a base station from
+// another.  A base station sends a message type 1230 giving its biases so
+// that the rover can allow for them.
+//
+// The message has a mask saying which of the four Glonass FDMA signals (L1
+// C/A, L1 P, L2 C/A and L2 P) it covers, followed by a bias for each of
+// those signals, in the same order.  The Message holds the values as they
+// were sent and String displays them in metres.  Frame turns a Message back
+// into a message frame, so a caster or a filter can check or rewrite the
+// biases and send the result on.
+package type1230
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+const expectedMessageType = 1230
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenStationID = 12
+const lenBiasIndicator = 1
+const lenReserved = 3
+const lenSignalsMask = 4
+const lenBias = 16
+
+// lengthOfHeaderInBits is the length of the fixed part of the message.  A
+// 16-bit bias follows for each signal in the mask.
+const lengthOfHeaderInBits = lenMessageType + lenStationID + lenBiasIndicator +
+	lenReserved + lenSignalsMask
+
+// biasScale converts a bias to metres.
+const biasScale = 0.02
+
+// InvalidBias is the value of a bias that means it's not valid.
+const InvalidBias = -32768
+
+// The signals, in the order of the bits in the mask (from the top) and of
+// the biases in the message.
+const (
+	L1CA = iota
+	L1P
+	L2CA
+	L2P
+	numSignals
+)
+
+// signalNames gives the name of each signal.
+var signalNames = [numSignals]string{"L1 C/A", "L1 P", "L2 C/A", "L2 P"}
+
+// SignalName returns the name of the signal, for example "L1 C/A".
+func SignalName(signal int) string {
+	if signal < 0 || signal >= numSignals {
+		return fmt.Sprintf("signal %d", signal)
+	}
+	return signalNames[signal]
+}
+
+// Message contains a message of type 1230 - Glonass code-phase biases.
+type Message struct {
+	// MessageType - uint12 - always 1230.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// StationID - uint12.
+	StationID uint `json:"station_id,omitempty"`
+
+	// Aligned is the code-phase bias indicator - bit(1).  If true, the
+	// station aligns the L1 and L2 phase and code observations in the
+	// observation messages, so the biases should not be applied again.
+	Aligned bool `json:"aligned,omitempty"`
+
+	// Reserved - bit(3).
+	Reserved uint `json:"reserved,omitempty"`
+
+	// SignalsMask gives the signals with a bias in the message - bit(4).
+	// The top bit is L1 C/A.  See Present.
+	SignalsMask uint `json:"signals_mask,omitempty"`
+
+	// Biases holds the bias of each signal, indexed by L1CA, L1P, L2CA
+	// and L2P - int16, 0.02 m.  A bias that's not in the mask is zero.
+	Biases [numSignals]int64 `json:"biases"`
+}
+
+// New creates a message type 1230 with no biases.
+func New(stationID uint, aligned bool) *Message {
+	message := Message{
+		MessageType: expectedMessageType,
+		StationID:   stationID,
+		Aligned:     aligned,
+	}
+	return &message
+}
+
+// maskBit returns the bit in the signals mask for the signal.
+func maskBit(signal int) uint {
+	return 1 << (numSignals - 1 - signal)
+}
+
+// Present returns true if the message has a bias for the signal.
+func (message *Message) Present(signal int) bool {
+	if signal < 0 || signal >= numSignals {
+		return false
+	}
+	return message.SignalsMask&maskBit(signal) != 0
+}
+
+// SetBias sets the bias of the signal, as sent in the message, and adds
+// the signal to the mask.
+func (message *Message) SetBias(signal int, bias int64) {
+	if signal < 0 || signal >= numSignals {
+		return
+	}
+	message.SignalsMask |= maskBit(signal)
+	message.Biases[signal] = bias
+}
+
+// Valid returns true if the message has a valid bias for the signal.
+func (message *Message) Valid(signal int) bool {
+	return message.Present(signal) && message.Biases[signal] != InvalidBias
+}
+
+// BiasMetres returns the bias of the signal in metres.
+func (message *Message) BiasMetres(signal int) float64 {
+	if !message.Present(signal) {
+		return 0
+	}
+	return float64(message.Biases[signal]) * biasScale
+}
+
+// numBiases returns the number of biases in the message.
+func (message *Message) numBiases() uint {
+	var n uint
+	for signal := 0; signal < numSignals; signal++ {
+		if message.Present(signal) {
+			n++
+		}
+	}
+	return n
+}
+
+// String returns a readable version of the message.
+func (message *Message) String() string {
+	display := fmt.Sprintf("stationID %d, code-phase biases aligned %v\n",
+		message.StationID, message.Aligned)
+
+	if message.numBiases() == 0 {
+		return display + "no biases\n"
+	}
+
+	for signal := 0; signal < numSignals; signal++ {
+		if !message.Present(signal) {
+			continue
+		}
+		if message.Valid(signal) {
+			display += fmt.Sprintf("%s bias %.2f m\n",
+				SignalName(signal), message.BiasMetres(signal))
+		} else {
+			display += fmt.Sprintf("%s bias invalid\n", SignalName(signal))
+		}
+	}
+
+	return display
+}
+
+// Frame returns the message as a complete RTCM3 message frame, with the
+// leader and the CRC, ready to be sent.  It's the reverse of GetMessage.
+func (message *Message) Frame() []byte {
+	frame := utils.NewFrame(lengthOfHeaderInBits + message.numBiases()*lenBias)
+
+	var pos uint = utils.LeaderLengthBits
+	pos = utils.SetBits(frame, pos, lenMessageType, expectedMessageType)
+	pos = utils.SetBits(frame, pos, lenStationID, uint64(message.StationID))
+	pos = utils.SetFlag(frame, pos, message.Aligned)
+	pos = utils.SetBits(frame, pos, lenReserved, uint64(message.Reserved))
+	pos = utils.SetBits(frame, pos, lenSignalsMask, uint64(message.SignalsMask))
+	for signal := 0; signal < numSignals; signal++ {
+		if message.Present(signal) {
+			pos = utils.SetBits(frame, pos, lenBias, uint64(message.Biases[signal]))
+		}
+	}
+
+	utils.SetCRC(frame)
+
+	return frame
+}
+
+// GetMessage extracts a message type 1230 from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+
+	// The bit stream contains a 3-byte leader, an embedded message and a 3-byte CRC.
+	// Here we are only concerned with the embedded message.
+	lenBitStream := len(bitStream) * 8
+	lenMessageInBits := lenBitStream - utils.LeaderLengthBits - utils.CRCLengthBits
+
+	if lenMessageInBits < lengthOfHeaderInBits {
+		em := fmt.Sprintf("overrun - expected at least %d bits in a message type %d, got %d",
+			lengthOfHeaderInBits, expectedMessageType, lenMessageInBits)
+		return nil, errors.New(em)
+	}
+
+	// Pos is the position within the bitstream.
+	// Jump over the leader.
+	var pos uint = utils.LeaderLengthBits
+
+	var message Message
+
+	message.MessageType = uint(utils.GetBitsAsUint64(bitStream, pos, lenMessageType))
+	pos += lenMessageType
+
+	if message.MessageType != expectedMessageType {
+		em := fmt.Sprintf("expected message type %d got %d", expectedMessageType, message.MessageType)
+		return nil, errors.New(em)
+	}
+
+	message.StationID = uint(utils.GetBitsAsUint64(bitStream, pos, lenStationID))
+	pos += lenStationID
+	message.Aligned = utils.GetBitsAsUint64(bitStream, pos, lenBiasIndicator) == 1
+	pos += lenBiasIndicator
+	message.Reserved = uint(utils.GetBitsAsUint64(bitStream, pos, lenReserved))
+	pos += lenReserved
+	message.SignalsMask = uint(utils.GetBitsAsUint64(bitStream, pos, lenSignalsMask))
+	pos += lenSignalsMask
+
+	want := lengthOfHeaderInBits + message.numBiases()*lenBias
+	if lenMessageInBits < int(want) {
+		em := fmt.Sprintf("overrun - expected %d bits in a message type %d with %d biases, got %d",
+			want, expectedMessageType, message.numBiases(), lenMessageInBits)
+		return nil, errors.New(em)
+	}
+
+	for signal := 0; signal < numSignals; signal++ {
+		if message.Present(signal) {
+			message.Biases[signal] = utils.GetBitsAsInt64(bitStream, pos, lenBias)
+			pos += lenBias
+		}
+	}
+
+	return &message, nil
+}
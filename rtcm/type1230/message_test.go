@@ -0,0 +1,163 @@
+package type1230
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestGetMessage checks that GetMessage extracts the fields of a message
+// type 1230.  The test frame has biases for L1 C/A and L2 C/A, both zero.
+func TestGetMessage(t *testing.T) {
+	want := Message{
+		MessageType: 1230, StationID: 0, Aligned: true, Reserved: 0,
+		SignalsMask: 0xa,
+	}
+
+	got, err := GetMessage(testdata.Fake1230)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(want, *got) {
+		t.Error(cmp.Diff(want, *got))
+	}
+}
+
+// TestFrame checks that a message survives a round trip through Frame and
+// GetMessage, with various sets of biases.
+func TestFrame(t *testing.T) {
+	var testData = []struct {
+		description string
+		biases      map[int]int64
+	}{
+		{"none", map[int]int64{}},
+		{"all", map[int]int64{L1CA: 1, L1P: -1, L2CA: 32767, L2P: InvalidBias}},
+		{"L1 P only", map[int]int64{L1P: -250}},
+	}
+	for _, td := range testData {
+		want := New(4095, false)
+		for signal, bias := range td.biases {
+			want.SetBias(signal, bias)
+		}
+
+		frame := want.Frame()
+		wantLength := (32 + 16*len(td.biases) + 7) / 8
+		if len(frame)-6 != wantLength {
+			t.Errorf("%s: want length %d got %d", td.description, wantLength, len(frame)-6)
+		}
+
+		got, err := GetMessage(frame)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+
+		if !cmp.Equal(*want, *got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(*want, *got))
+		}
+	}
+}
+
+// TestBiases checks Present, Valid and BiasMetres.
+func TestBiases(t *testing.T) {
+	message := New(1, true)
+	message.SetBias(L1CA, 50)
+	message.SetBias(L2P, InvalidBias)
+
+	var testData = []struct {
+		signal      int
+		wantPresent bool
+		wantValid   bool
+		wantMetres  float64
+	}{
+		{L1CA, true, true, 1.0},
+		{L1P, false, false, 0},
+		{L2CA, false, false, 0},
+		{L2P, true, false, -655.36},
+		{-1, false, false, 0},
+		{4, false, false, 0},
+	}
+	for _, td := range testData {
+		if got := message.Present(td.signal); got != td.wantPresent {
+			t.Errorf("%d: want present %v got %v", td.signal, td.wantPresent, got)
+		}
+		if got := message.Valid(td.signal); got != td.wantValid {
+			t.Errorf("%d: want valid %v got %v", td.signal, td.wantValid, got)
+		}
+		if got := message.BiasMetres(td.signal); got != td.wantMetres {
+			t.Errorf("%d: want %f got %f", td.signal, td.wantMetres, got)
+		}
+	}
+
+	if message.SignalsMask != 0x9 {
+		t.Errorf("want mask 0x9 got %#x", message.SignalsMask)
+	}
+}
+
+// TestString checks that String displays the biases in metres.
+func TestString(t *testing.T) {
+	const wantBiases = `stationID 3, code-phase biases aligned false
+L1 C/A bias 1.00 m
+L1 P bias -0.02 m
+L2 P bias invalid
+`
+
+	const wantNone = `stationID 3, code-phase biases aligned true
+no biases
+`
+
+	withBiases := New(3, false)
+	withBiases.SetBias(L1CA, 50)
+	withBiases.SetBias(L1P, -1)
+	withBiases.SetBias(L2P, InvalidBias)
+
+	var testData = []struct {
+		message *Message
+		want    string
+	}{
+		{withBiases, wantBiases},
+		{New(3, true), wantNone},
+	}
+	for _, td := range testData {
+		got := td.message.String()
+		if td.want != got {
+			t.Error(diff.Diff(td.want, got))
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage rejects bad frames.
+func TestGetMessageWithErrors(t *testing.T) {
+	allBiases := New(2, false)
+	for signal := L1CA; signal <= L2P; signal++ {
+		allBiases.SetBias(signal, 0)
+	}
+	frame := allBiases.Frame()
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		wantError   string
+	}{
+		{"short header", testdata.Fake1230[:8],
+			"overrun - expected at least 32 bits in a message type 1230, got 16"},
+		{"short biases", frame[:10],
+			"overrun - expected 96 bits in a message type 1230 with 4 biases, got 32"},
+		{"wrong type", testdata.MessageFrameType1020,
+			"expected message type 1230 got 1020"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.bitStream)
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// type4072 handles messages of type 4072, which is assigned to u-blox for
+// its own use.  A u-blox ZED-F9P sends them when it's configured as the
+// moving base of a pair of receivers that measure a heading, and the rover
+// of the pair needs them along with the MSMs.  The message is divided into
+// sub-types, written as 4072.0, 4072.1 and so on:
+//
+//	4072.0 - reference station PVT
+//	4072.1 - additional reference station information
+//
+// The twelve bits after the message number give the sub-type.  u-blox
+// doesn't publish the layout of the rest of the message, so the Message
+// holds it as it was sent and String displays it in hex.  A filter can drop
+// the sub-types that it doesn't want to pass on - see GetSubType and the
+// typefilter package.
+package type4072
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+const expectedMessageType = 4072
+
+// Lengths of the fields in the bit stream.
+const lenMessageType = 12
+const lenSubType = 12
+
+// lengthOfHeaderInBits is the length of the part of the message that has
+// a published layout.  It's a whole number of bytes.
+const lengthOfHeaderInBits = lenMessageType + lenSubType
+
+// The known sub-types.
+const (
+	SubTypeReferenceStationPVT = 0
+	SubTypeAdditionalInfo      = 1
+)
+
+// subTypeNames gives the description of each known sub-type.
+var subTypeNames = map[uint]string{
+	SubTypeReferenceStationPVT: "reference station PVT",
+	SubTypeAdditionalInfo:      "additional reference station information",
+}
+
+// SubTypeName returns the description of the sub-type, for example
+// "reference station PVT".
+func SubTypeName(subType uint) string {
+	name, ok := subTypeNames[subType]
+	if !ok {
+		return "unknown sub-type"
+	}
+	return name
+}
+
+// Message contains a message of type 4072 - u-blox proprietary.
+type Message struct {
+	// MessageType - uint12 - always 4072.
+	MessageType uint `json:"message_type,omitempty"`
+
+	// SubType - uint12.
+	SubType uint `json:"sub_type"`
+
+	// Data is the rest of the message, as sent.
+	Data []byte `json:"data"`
+}
+
+// String returns a readable version of the message.
+func (message *Message) String() string {
+	display := fmt.Sprintf("u-blox proprietary message %d.%d - %s\n",
+		expectedMessageType, message.SubType, SubTypeName(message.SubType))
+	if len(message.Data) == 0 {
+		return display + "no data\n"
+	}
+	display += fmt.Sprintf("%d bytes of data in an undocumented format:\n", len(message.Data))
+	return display + hex.Dump(message.Data)
+}
+
+// checkFrame checks that the message frame holds a message type 4072 with
+// at least the message type and the sub-type, and returns the length of the
+// message in bits.
+func checkFrame(bitStream []byte) (int, error) {
+	lenMessageInBits := len(bitStream)*8 - utils.LeaderLengthBits - utils.CRCLengthBits
+	if lenMessageInBits < lengthOfHeaderInBits {
+		em := fmt.Sprintf("overrun - expected at least %d bits in a message type %d, got %d",
+			lengthOfHeaderInBits, expectedMessageType, lenMessageInBits)
+		return 0, errors.New(em)
+	}
+
+	messageType := utils.GetBitsAsUint64(bitStream, utils.LeaderLengthBits, lenMessageType)
+	if messageType != expectedMessageType {
+		em := fmt.Sprintf("expected message type %d got %d", expectedMessageType, messageType)
+		return 0, errors.New(em)
+	}
+
+	return lenMessageInBits, nil
+}
+
+// GetSubType gets the sub-type from a message frame of type 4072 without
+// decoding the rest.
+func GetSubType(bitStream []byte) (uint, error) {
+	if _, err := checkFrame(bitStream); err != nil {
+		return 0, err
+	}
+	pos := uint(utils.LeaderLengthBits + lenMessageType)
+	return uint(utils.GetBitsAsUint64(bitStream, pos, lenSubType)), nil
+}
+
+// GetMessage extracts a message type 4072 from a message frame.
+func GetMessage(bitStream []byte) (*Message, error) {
+	lenMessageInBits, err := checkFrame(bitStream)
+	if err != nil {
+		return nil, err
+	}
+
+	subType, _ := GetSubType(bitStream)
+
+	// The header is a whole number of bytes, so the data starts on a byte
+	// boundary.
+	start := (utils.LeaderLengthBits + lengthOfHeaderInBits) / 8
+	end := (utils.LeaderLengthBits + lenMessageInBits) / 8
+	data := make([]byte, end-start)
+	copy(data, bitStream[start:end])
+
+	message := Message{
+		MessageType: expectedMessageType,
+		SubType:     subType,
+		Data:        data,
+	}
+	return &message, nil
+}
@@ -0,0 +1,85 @@
+package type4072
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestGetMessage checks that GetMessage extracts the sub-type and the data.
+func TestGetMessage(t *testing.T) {
+	var testData = []struct {
+		description string
+		frame       []byte
+		want        Message
+	}{
+		{"4072.0", testdata.Fake4072_0,
+			Message{MessageType: 4072, SubType: 0, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+		{"4072.1", testdata.Fake4072_1,
+			Message{MessageType: 4072, SubType: 1, Data: []byte{0x55, 0xaa, 0x55, 0xaa}}},
+	}
+	for _, td := range testData {
+		got, err := GetMessage(td.frame)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		if !cmp.Equal(td.want, *got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, *got))
+		}
+
+		subType, err := GetSubType(td.frame)
+		if err != nil || subType != td.want.SubType {
+			t.Errorf("%s: want sub-type %d got %d, %v", td.description, td.want.SubType, subType, err)
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that a short frame or a frame of the
+// wrong type is rejected.
+func TestGetMessageWithErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		frame       []byte
+		want        string
+	}{
+		{"short", []byte{0xd3, 0x00, 0x02, 0xfe, 0x80, 0, 0, 0},
+			"overrun - expected at least 24 bits in a message type 4072, got 16"},
+		{"wrong type", testdata.Fake1230, "expected message type 4072 got 1230"},
+	}
+	for _, td := range testData {
+		_, err := GetMessage(td.frame)
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want error %s got %v", td.description, td.want, err)
+		}
+		_, err = GetSubType(td.frame)
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: GetSubType want error %s got %v", td.description, td.want, err)
+		}
+	}
+}
+
+// TestString checks the display of known and unknown sub-types.
+func TestString(t *testing.T) {
+	var testData = []struct {
+		description string
+		message     Message
+		want        string
+	}{
+		{"PVT", Message{MessageType: 4072, SubType: 0, Data: []byte("abc")},
+			"u-blox proprietary message 4072.0 - reference station PVT\n" +
+				"3 bytes of data in an undocumented format:\n" +
+				"00000000  61 62 63                                          |abc|\n"},
+		{"unknown", Message{MessageType: 4072, SubType: 7},
+			"u-blox proprietary message 4072.7 - unknown sub-type\nno data\n"},
+	}
+	for _, td := range testData {
+		got := td.message.String()
+		if td.want != got {
+			t.Errorf("%s: %s", td.description, diff.Diff(td.want, got))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm123/satellite"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm123/signal"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Message is a broken-out version of a compact MSM - an MSM1, MSM2 or MSM3.
+// The satellite cells carry only the rough range modulo one millisecond.
+type Message struct {
+	// Header is the MSM Header
+	Header *header.Header
+
+	// Satellites is a list of the satellites for which signals
+	// were observed in the message.
+	Satellites []satellite.Cell
+
+	// Signals is a list of sublists, one sublist per satellite,
+	// of signals at different frequencies observed by the base
+	// station from the satellites in the Satellite list.
+	Signals [][]signal.Cell
+
+	// LogLevel controls the data output by String.
+	LogLevel slog.Level
+}
+
+// New creates a compact MSM Message.
+func New(
+	header *header.Header,
+	satellites []satellite.Cell,
+	signals [][]signal.Cell,
+	logLevel slog.Level) *Message {
+	message := Message{
+		Header:     header,
+		Satellites: satellites,
+		Signals:    signals,
+		LogLevel:   logLevel,
+	}
+
+	return &message
+}
+
+// String return a text version of the compact MSM Message.
+func (message *Message) String() string {
+	result :=
+		message.Header.String() +
+			message.DisplaySatelliteCells() +
+			message.DisplaySignalCells()
+
+	return result
+}
+
+// DisplaySatelliteCells returns a text version of the satellite cells in the
+// Multiple Signal Message (MSM).
+func (message *Message) DisplaySatelliteCells() string {
+
+	if len(message.Satellites) < 1 {
+		return "No Satellites\n"
+	}
+
+	heading := "Satellite ID {approx range modulo 1 ms - frac, millis, metres}\n"
+
+	body := ""
+	for i := range message.Satellites {
+		body += message.Satellites[i].String() + "\n"
+	}
+
+	return heading + body
+}
+
+// DisplaySignalCells returns a text version of the signal data from the signal
+// cells in a compact multiple signal message.
+func (message *Message) DisplaySignalCells() string {
+
+	if len(message.Signals) < 1 {
+		return "No Signals\n"
+	}
+
+	heading := "Signals (ranges modulo 1 light ms):\nSat ID Sig ID {(range delta, delta m, range m), (phase range delta, cycles), lock time ind, half cycle ambiguity, wavelength}\n"
+
+	body := ""
+
+	for i := range message.Signals {
+		for j := range message.Signals[i] {
+			body += message.Signals[i][j].String() + "\n"
+		}
+	}
+
+	return heading + body
+}
+
+// GetMessage presents an MSM1, MSM2 or MSM3 (type 1071, 1072, 1073, 1081 etc)
+// as broken out fields.
+func GetMessage(bitStream []byte, logLevel slog.Level) (*Message, error) {
+
+	header, bitPosition, headerError := header.GetMSMHeader(
+		bitStream, logLevel)
+
+	if headerError != nil {
+		return nil, headerError
+	}
+
+	// Sanity check.  The message type must be an MSM1, MSM2 or MSM3.
+	if !utils.MSM123(header.MessageType) {
+		em := fmt.Sprintf("message type %d is not an MSM1, MSM2 or MSM3", header.MessageType)
+		return nil, errors.New(em)
+	}
+
+	satellites, fetchSatellitesError := satellite.GetSatelliteCells(
+		bitStream, bitPosition, header.Satellites, logLevel,
+	)
+
+	if fetchSatellitesError != nil {
+		return nil, fetchSatellitesError
+	}
+
+	bitPosition += uint(len(satellites) * satellite.CellLengthInBits)
+
+	signals, fetchSignalsError := signal.GetSignalCells(
+		bitStream, bitPosition, header, satellites, logLevel,
+	)
+
+	if fetchSignalsError != nil {
+		return nil, fetchSignalsError
+	}
+
+	return New(header, satellites, signals, logLevel), nil
+}
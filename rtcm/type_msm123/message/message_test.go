@@ -0,0 +1,164 @@
+package message
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestGetMessage checks that GetMessage correctly decodes MSM1, MSM2 and MSM3
+// messages.  The three frames carry the same satellites and signals, but each
+// level carries a different set of signal fields.
+func TestGetMessage(t *testing.T) {
+
+	var testData = []struct {
+		description         string
+		bitStream           []byte
+		wantType            int
+		wantRangeDelta      []int
+		wantPhaseRangeDelta []int
+		wantLock            []uint
+		wantHCA             []bool
+	}{
+		{
+			"MSM1", testdata.MessageFrameType1071, 1071,
+			[]int{1234, -2345, utils.InvalidRangeDelta},
+			[]int{0, 0, 0}, []uint{0, 0, 0}, []bool{false, false, false},
+		},
+		{
+			"MSM2", testdata.MessageFrameType1072, 1072,
+			[]int{0, 0, 0},
+			[]int{-56789, 123456, 98765}, []uint{15, 9, 3}, []bool{false, true, false},
+		},
+		{
+			"MSM3", testdata.MessageFrameType1073, 1073,
+			[]int{1234, -2345, utils.InvalidRangeDelta},
+			[]int{-56789, 123456, 98765}, []uint{15, 9, 3}, []bool{false, true, false},
+		},
+	}
+
+	for _, td := range testData {
+
+		message, err := GetMessage(td.bitStream, slog.LevelDebug)
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+
+		if message.Header.MessageType != td.wantType {
+			t.Errorf("%s: want type %d got %d",
+				td.description, td.wantType, message.Header.MessageType)
+		}
+
+		if message.Header.Warning != "" {
+			t.Errorf("%s: unexpected warning %s", td.description, message.Header.Warning)
+		}
+
+		// Check the satellite cells.
+		if len(message.Satellites) != 2 {
+			t.Errorf("%s: want 2 satellites got %d", td.description, len(message.Satellites))
+			continue
+		}
+
+		if message.Satellites[0].ID != 4 || message.Satellites[1].ID != 9 {
+			t.Errorf("%s: want satellites 4 and 9 got %d and %d", td.description,
+				message.Satellites[0].ID, message.Satellites[1].ID)
+		}
+
+		if message.Satellites[0].RangeFractionalMillis != 417 ||
+			message.Satellites[1].RangeFractionalMillis != 95 {
+			t.Errorf("%s: want ranges 417 and 95 got %d and %d", td.description,
+				message.Satellites[0].RangeFractionalMillis,
+				message.Satellites[1].RangeFractionalMillis)
+		}
+
+		// Check the signal cells.  The cell mask gives two signals for the
+		// first satellite and one for the second.
+		if len(message.Signals) != 2 || len(message.Signals[0]) != 2 || len(message.Signals[1]) != 1 {
+			t.Errorf("%s: want signals [2 1] got %v", td.description, message.Signals)
+			continue
+		}
+
+		signals := []struct {
+			satID, sigID uint
+		}{{4, 2}, {4, 16}, {9, 2}}
+
+		c := 0
+		for i := range message.Signals {
+			for j := range message.Signals[i] {
+				cell := message.Signals[i][j]
+
+				if cell.Satellite.ID != signals[c].satID || cell.ID != signals[c].sigID {
+					t.Errorf("%s: cell %d: want %d %d got %d %d", td.description, c,
+						signals[c].satID, signals[c].sigID, cell.Satellite.ID, cell.ID)
+				}
+
+				if cell.RangeDelta != td.wantRangeDelta[c] {
+					t.Errorf("%s: cell %d: want range delta %d got %d",
+						td.description, c, td.wantRangeDelta[c], cell.RangeDelta)
+				}
+
+				if cell.PhaseRangeDelta != td.wantPhaseRangeDelta[c] {
+					t.Errorf("%s: cell %d: want phase range delta %d got %d",
+						td.description, c, td.wantPhaseRangeDelta[c], cell.PhaseRangeDelta)
+				}
+
+				if cell.LockTimeIndicator != td.wantLock[c] {
+					t.Errorf("%s: cell %d: want lock time indicator %d got %d",
+						td.description, c, td.wantLock[c], cell.LockTimeIndicator)
+				}
+
+				if cell.HalfCycleAmbiguity != td.wantHCA[c] {
+					t.Errorf("%s: cell %d: want half cycle ambiguity %v got %v",
+						td.description, c, td.wantHCA[c], cell.HalfCycleAmbiguity)
+				}
+
+				c++
+			}
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage handles errors correctly.
+func TestGetMessageWithErrors(t *testing.T) {
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		want        string
+	}{
+		{
+			"header too short", testdata.MessageFrameType1073[:20],
+			"bitstream is too short for an MSM header - got 112 bits, expected at least 169",
+		},
+		{
+			"satellite cells too short", testdata.MessageFrameType1073[:28],
+			"overrun - not enough data for 2 MSM1-3 satellite cells - need 20 bits, got 3",
+		},
+		{
+			"signal cells too short", testdata.MessageFrameType1073[:36],
+			"overrun - want 3 MSM3 signals, got 1",
+		},
+		{
+			"not MSM1-3", testdata.MessageFrameType1077,
+			"message type 1077 is not an MSM1, MSM2 or MSM3",
+		},
+	}
+	for _, td := range testData {
+
+		gotMessage, gotError := GetMessage(td.bitStream, slog.LevelDebug)
+
+		if gotMessage != nil {
+			t.Errorf("%s: On error, the message should be nil", td.description)
+		}
+		if gotError == nil {
+			t.Errorf("%s: expected an error", td.description)
+		} else {
+			if gotError.Error() != td.want {
+				t.Errorf("%s:\nwant %s\n got %s", td.description, td.want, gotError.Error())
+			}
+		}
+	}
+}
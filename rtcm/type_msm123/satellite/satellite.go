@@ -0,0 +1,105 @@
+// The satellite package contains code to handle the satellite cells of the
+// compact Multiple Signal Messages, MSM1, MSM2 and MSM3.  The satellite cells
+// follow the header in the message.  Each cell contains just one value, the
+// rough range of the satellite modulo one millisecond, ie the fractional part
+// of the approximate transit time of the signals from the satellite to the GPS
+// device.  The value is ten bits and is in units of 1/1024 milliseconds.
+//
+// Unlike the other MSMs, the compact messages don't give the whole number of
+// milliseconds.  The receiver is expected to know roughly how far away the
+// satellite is (from the ephemeris and its own position) and resolve that
+// part for itself, so the ranges produced here are all less than one light
+// millisecond, about 300 Km.
+package satellite
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// lenFractionalMillis is the length of the rough range in the cell.
+const lenFractionalMillis = 10
+
+// CellLengthInBits is the number of bits in each cell.
+const CellLengthInBits = lenFractionalMillis
+
+// Cell holds the data for one satellite from a compact MSM message, type
+// MSM1, MSM2 or MSM3 (message type 1071, 1072, 1073, 1081 ...).
+type Cell struct {
+	// The field names, types and sizes are shown in comments in rtklib
+	// rtcm3.c - see the function decode_msm0().
+
+	// ID is the satellite ID, 1-64.
+	ID uint
+
+	// RangeFractionalMillis - uint10.  The rough range modulo one
+	// millisecond in units of 1/1024 milliseconds.  There is no invalid
+	// value.
+	RangeFractionalMillis uint
+
+	// LogLevel controls the data output by String.
+	LogLevel slog.Level
+}
+
+// New creates a compact MSM satellite cell from the given values.
+func New(id, fractionalMillis uint, logLevel slog.Level) *Cell {
+
+	cell := Cell{
+		ID:                    id,
+		RangeFractionalMillis: fractionalMillis,
+		LogLevel:              logLevel,
+	}
+
+	return &cell
+}
+
+func (cell *Cell) String() string {
+	// The whole milliseconds are not given, so work out the range as if
+	// they were zero.
+	approxRangeMilliseconds := utils.GetApproxRangeMilliseconds(0, cell.RangeFractionalMillis)
+	approxRangeMetres := utils.GetApproxRangeMetres(0, cell.RangeFractionalMillis)
+
+	return fmt.Sprintf("%2d {%d, %.3f, %.3f}",
+		cell.ID, cell.RangeFractionalMillis,
+		approxRangeMilliseconds, approxRangeMetres)
+}
+
+// GetSatelliteCells extracts the satellite cell data from an MSM1, MSM2 or
+// MSM3 message.  It returns a slice of cell data.  If the bitstream is not
+// long enough to contain the cells, it returns an error.
+func GetSatelliteCells(
+	bitStream []byte,
+	startOfSatelliteData uint,
+	Satellites []uint,
+	logLevel slog.Level,
+) ([]Cell, error) {
+
+	// The frame contain the 24-bit leader, the embedded message and the 24-bit CRC.
+	// startOfSatelliteData is the number of bits of the FRAME consumed so far.
+	bitsLeftInFrame := len(bitStream)*8 - int(startOfSatelliteData)
+	bitsLeftInMessage := bitsLeftInFrame - utils.CRCLengthBits
+	bitsNeededForCells := len(Satellites) * CellLengthInBits
+
+	if bitsLeftInMessage < bitsNeededForCells {
+
+		message := fmt.Sprintf("overrun - not enough data for %d MSM1-3 satellite cells - need %d bits, got %d",
+			len(Satellites), bitsNeededForCells, bitsLeftInMessage)
+
+		return nil, errors.New(message)
+	}
+
+	// Set the bit position to the start of the satellite data in the message.
+	pos := startOfSatelliteData
+
+	satData := make([]Cell, 0)
+	for i := range Satellites {
+		fraction := uint(utils.GetBitsAsUint64(bitStream, pos, lenFractionalMillis))
+		pos += lenFractionalMillis
+		satData = append(satData, *New(Satellites[i], fraction, logLevel))
+	}
+
+	return satData, nil
+}
@@ -0,0 +1,73 @@
+package satellite
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests for the handling of an MSM1, MSM2 or MSM3 satellite cell.
+
+// TestGetSatelliteCells checks that GetSatelliteCells correctly interprets a
+// bit stream from a compact MSM containing two satellite cells.
+func TestGetSatelliteCells(t *testing.T) {
+	satellites := []uint{42, 43}
+
+	// The bit stream starts at bit 8 and contains two 10-bit satellite cells:
+	// 1000 0000  01|11 1111  1111|0000
+	bitstream := []byte{0xff, 0x80, 0x7f, 0xf0,
+		// CRC
+		0, 0, 0}
+
+	want := []Cell{
+		{ID: 42, RangeFractionalMillis: 0x201, LogLevel: slog.LevelDebug},
+		{ID: 43, RangeFractionalMillis: 1023, LogLevel: slog.LevelDebug},
+	}
+
+	got, satError := GetSatelliteCells(bitstream, 8, satellites, slog.LevelDebug)
+
+	if satError != nil {
+		t.Fatal(satError)
+	}
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestGetSatelliteCellsWithError checks that GetSatelliteCells returns an
+// error when the bit stream is too short.
+func TestGetSatelliteCellsWithError(t *testing.T) {
+	// Three cells need 30 bits.  The bit stream has 8 bits of data after the
+	// start position plus the CRC.
+	bitstream := []byte{0xff, 0xff, 0, 0, 0}
+
+	const want = "overrun - not enough data for 3 MSM1-3 satellite cells - need 30 bits, got 8"
+
+	got, satError := GetSatelliteCells(bitstream, 8, []uint{1, 2, 3}, slog.LevelDebug)
+
+	if got != nil {
+		t.Error("On error, the result should be nil")
+	}
+
+	if satError == nil {
+		t.Fatal("expected an error")
+	}
+
+	if satError.Error() != want {
+		t.Errorf("want %s\n got %s", want, satError.Error())
+	}
+}
+
+// TestString checks that String displays the range modulo one millisecond.
+func TestString(t *testing.T) {
+	const want = " 4 {512, 0.500, 149896.229}"
+
+	cell := New(4, 512, slog.LevelDebug)
+
+	got := cell.String()
+	if want != got {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
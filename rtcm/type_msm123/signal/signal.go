@@ -0,0 +1,368 @@
+// package signal contains code to handle the data from a signal cell from one
+// of the compact Multiple Signal Messages, MSM1, MSM2 or MSM3 (message type
+// 1071, 1072, 1073, 1081 etc.).  The three share a layout but each carries a
+// different set of fields:
+//
+//	MSM1: range delta
+//	MSM2: phase range delta, lock time indicator, half-cycle ambiguity
+//	MSM3: all of those
+//
+// The fields that are present have the same sizes as in an MSM4.  Various
+// values are defined from values in the signal cell and its associated
+// satellite cell.  For convenience the ones from the satellite cell are
+// copied here.
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	msmHeader "github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm123/satellite"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Define the lengths of the fields in the signal cell of a compact MSM.
+const lenRangeDelta uint = 15
+const lenPhaseRangeDelta uint = 22
+const lenLockTimeIndicator uint = 4
+const lenHalfCycleAmbiguity uint = 1
+
+// Cell holds the data from an MSM1, MSM2 or MSM3 message for one signal
+// from one satellite, plus values copied from the satellite.
+type Cell struct {
+	// Field names, sizes, invalid values etc are derived from rtklib rtcm3.c
+	// (decode_msm1, decode_msm2 and decode_msm3 functions).
+
+	// ID is the ID of the signal that was observed: 1-32.
+	ID uint
+
+	// Level is the level of the message that carried the signal - 1, 2 or
+	// 3.  It controls which of the other fields are present.
+	Level uint
+
+	// Wavelength is the wavelength of the signal
+	Wavelength float64
+
+	// RangeDelta - int15, MSM1 and MSM3 only.  A scaled value representing a
+	// small signed delta to be added to the rough range from the satellite cell.
+	// The value is in units of (two to the power of -24) milliseconds.  Invalid
+	// if the top bit is set and the others are all zero (utils.InvalidRangeDelta).
+	RangeDelta int
+
+	// PhaseRangeDelta - int22, MSM2 and MSM3 only.  Invalid if the top bit is set
+	// and the others are all zero (utils.InvalidPhaseRangeDelta).
+	PhaseRangeDelta int
+
+	// LockTimeIndicator - uint4, MSM2 and MSM3 only.
+	LockTimeIndicator uint
+
+	// HalfCycleAmbiguity flag - 1 bit, MSM2 and MSM3 only.
+	HalfCycleAmbiguity bool
+
+	// The satellite that sent the signal.
+	Satellite *satellite.Cell
+
+	// LogLevel controls the data output by String.
+	LogLevel slog.Level
+}
+
+// New creates a compact MSM Signal Cell.
+func New(
+	signalID uint,
+	level uint,
+	satelliteCell *satellite.Cell,
+	rangeDelta,
+	phaseRangeDelta int,
+	lockTimeIndicator uint,
+	halfCycleAmbiguity bool,
+	wavelength float64,
+	logLevel slog.Level,
+) *Cell {
+
+	cell := Cell{
+		ID:                 signalID,
+		Level:              level,
+		Wavelength:         wavelength,
+		RangeDelta:         rangeDelta,
+		PhaseRangeDelta:    phaseRangeDelta,
+		LockTimeIndicator:  lockTimeIndicator,
+		HalfCycleAmbiguity: halfCycleAmbiguity,
+		Satellite:          satelliteCell,
+		LogLevel:           logLevel,
+	}
+
+	return &cell
+}
+
+// HasRange is true if the cell carries a range delta (MSM1 and MSM3).
+func (cell *Cell) HasRange() bool {
+	return cell.Level == 1 || cell.Level == 3
+}
+
+// HasPhaseRange is true if the cell carries a phase range delta, a lock
+// time indicator and a half-cycle ambiguity flag (MSM2 and MSM3).
+func (cell *Cell) HasPhaseRange() bool {
+	return cell.Level == 2 || cell.Level == 3
+}
+
+// String returns a readable version of a signal cell.  The fields that the
+// message doesn't carry are shown as "-".
+func (cell *Cell) String() string {
+
+	var satID string
+	if cell.Satellite == nil {
+		satID = "<nil>"
+	} else {
+		satID = fmt.Sprintf("%2d", cell.Satellite.ID)
+	}
+
+	var rangeM string
+	switch {
+	case !cell.HasRange():
+		rangeM = "-"
+	case cell.Satellite == nil:
+		rangeM = "invalid"
+	default:
+		// Convert the delta to float and divide by two to the power 24 to restore
+		// the scale.  This gives the delta in milliseconds.
+		rangeDeltaInMillis := float64(cell.RangeDelta) / float64(utils.TwoToThePower24)
+
+		rangeDeltaInMetres := rangeDeltaInMillis * utils.OneLightMillisecond
+
+		rangeM = fmt.Sprintf("(%d, %.3f, %.3f)",
+			cell.RangeDelta, rangeDeltaInMetres, cell.RangeInMetres())
+	}
+
+	phaseRange := "-"
+	lock := "-, -"
+	if cell.HasPhaseRange() {
+		switch {
+		case cell.Satellite == nil:
+			phaseRange = "invalid"
+		case cell.Wavelength == 0:
+			// The calculation involves dividing by the frequency
+			// so that must be non-zero.
+			phaseRange = "no wavelength"
+		default:
+			phaseRange = fmt.Sprintf("(%d, %.3f)",
+				cell.PhaseRangeDelta, cell.PhaseRange())
+		}
+		lock = fmt.Sprintf("%d, %v", cell.LockTimeIndicator, cell.HalfCycleAmbiguity)
+	}
+
+	return fmt.Sprintf("%s %2d {%s, %s, %s, %.3f}",
+		satID, cell.ID, rangeM, phaseRange, lock, cell.Wavelength)
+}
+
+// GetAggregateRange takes the range values from the signal cell and the satellite
+// cell and returns the range modulo one millisecond as a 37-bit scaled unsigned
+// integer with 8 bits whole part (always zero) and 29 bits fractional part.  If the
+// message doesn't carry a range, the result is 0.  If the delta in the signal cell
+// is invalid, the result is the rough range from the satellite cell.
+func (cell *Cell) GetAggregateRange() uint64 {
+
+	if cell.Satellite == nil || !cell.HasRange() {
+		return 0
+	}
+
+	if cell.RangeDelta == utils.InvalidRangeDelta {
+		// The range is valid but the delta is not.
+		return utils.GetScaledRange(0, cell.Satellite.RangeFractionalMillis, 0)
+	}
+
+	// The delta is 15 bits, as in an MSM4.  The calculation assumes the 20-bit
+	// MSM7 form, so normalise it.  The value may be negative, so multiply
+	// rather than shifting bits.
+	delta := cell.RangeDelta * 32
+
+	return utils.GetScaledRange(0, cell.Satellite.RangeFractionalMillis, delta)
+}
+
+// GetAggregatePhaseRange takes the phase range values from the signal cell and the
+// satellite cell and returns the phase range modulo one millisecond as a 41-bit
+// scaled unsigned integer.  If the message doesn't carry a phase range, the result
+// is 0.
+func (cell *Cell) GetAggregatePhaseRange() uint64 {
+
+	if cell.Satellite == nil || !cell.HasPhaseRange() {
+		return 0
+	}
+
+	var delta int
+
+	if cell.PhaseRangeDelta != utils.InvalidPhaseRangeDelta {
+		// The delta is 22 bits, as in an MSM4.  Normalise it to the 24-bit
+		// MSM7 form.
+		delta = cell.PhaseRangeDelta * 4
+	}
+
+	return utils.GetScaledPhaseRange(0, cell.Satellite.RangeFractionalMillis, delta)
+}
+
+// RangeInMetres gives the distance from the satellite to the GPS device modulo one
+// light millisecond, in metres.
+func (cell *Cell) RangeInMetres() float64 {
+
+	// Convert to float and divide by two to the power 29 to restore the scale.
+	rangeInMillis := float64(cell.GetAggregateRange()) / float64(utils.TwoToThePower29)
+
+	return rangeInMillis * utils.OneLightMillisecond
+}
+
+// PhaseRange combines the rough range and the phase range delta and returns the
+// result in cycles, modulo one light millisecond.
+func (cell *Cell) PhaseRange() float64 {
+
+	aggregatePhaseRange := cell.GetAggregatePhaseRange()
+
+	// Restore the scale of the aggregate value.
+	phaseRangeMilliSeconds := utils.GetPhaseRangeMilliseconds(aggregatePhaseRange)
+
+	// Convert to light milliseconds
+	phaseRangeLMS := utils.GetPhaseRangeLightMilliseconds(phaseRangeMilliSeconds)
+
+	// and divide by the wavelength to get cycles.
+	return phaseRangeLMS / cell.Wavelength
+}
+
+// GetSignalCells gets the data from the signal cells of an MSM1, MSM2 or MSM3
+// message.  The message type in the header decides which fields are present.
+func GetSignalCells(
+	bitStream []byte,
+	startOfSignalCells uint,
+	header *msmHeader.Header,
+	satCells []satellite.Cell,
+	logLevel slog.Level,
+) ([][]Cell, error) {
+	// The signal data is laid out as in the other MSMs - all of the range deltas,
+	// then all of the phase range deltas and so on - but some of the fields are
+	// missing.
+
+	var level uint
+	switch {
+	case utils.MSM1(header.MessageType):
+		level = 1
+	case utils.MSM2(header.MessageType):
+		level = 2
+	case utils.MSM3(header.MessageType):
+		level = 3
+	default:
+		em := fmt.Sprintf("message type %d is not an MSM1, MSM2 or MSM3", header.MessageType)
+		return nil, errors.New(em)
+	}
+
+	var bitsPerCell uint
+	if level != 2 {
+		bitsPerCell += lenRangeDelta
+	}
+	if level != 1 {
+		bitsPerCell += lenPhaseRangeDelta + lenLockTimeIndicator + lenHalfCycleAmbiguity
+	}
+
+	// The frame contain the 24-bit leader, the embedded message and the 24-bit CRC.
+	// startOfSignalCells is the number of bits of the FRAME consumed so far.
+	bitsLeftInFrame := uint(len(bitStream)*8 - int(startOfSignalCells))
+	bitsLeftInMessage := bitsLeftInFrame - utils.CRCLengthBits
+
+	// Pos is the position within the bitstream.
+	pos := startOfSignalCells
+
+	// The cells are small enough that the CRC could be mistaken for more of
+	// them, so leave it out when counting.
+	var signalData []byte
+	if len(bitStream) >= utils.CRCLengthBytes {
+		signalData = bitStream[:len(bitStream)-utils.CRCLengthBytes]
+	}
+	numSignalCells, warning := utils.CheckNumberOfSignalCells(
+		signalData, pos, bitsPerCell, header.NumSignalCells, header.MultipleMessage)
+	header.Warning = warning
+
+	if header.MultipleMessage {
+		// The message doesn't contain all the signal cells but there should be
+		// at least one.
+		if bitsLeftInMessage < bitsPerCell {
+			message := fmt.Sprintf("overrun - want at least one %d-bit signal cell when multiple message flag is set, got only %d bits left",
+				bitsPerCell, bitsLeftInMessage)
+			return nil, errors.New(message)
+		}
+	} else {
+		// This message should contain all the signal cells.  Check that
+		// there are the expected number.
+		if numSignalCells < header.NumSignalCells {
+			message := fmt.Sprintf("overrun - want %d MSM%d signals, got %d",
+				header.NumSignalCells, level, numSignalCells)
+			return nil, errors.New(message)
+		}
+	}
+
+	rangeDelta := make([]int, numSignalCells)
+	phaseRangeDelta := make([]int, numSignalCells)
+	lockTimeIndicator := make([]uint, numSignalCells)
+	halfCycleAmbiguity := make([]bool, numSignalCells)
+
+	if level != 2 {
+		// Get the range deltas.
+		for i := 0; i < numSignalCells; i++ {
+			rangeDelta[i] = int(utils.GetBitsAsInt64(bitStream, pos, lenRangeDelta))
+			pos += lenRangeDelta
+		}
+	}
+
+	if level != 1 {
+		// Get the phase range deltas.
+		for i := 0; i < numSignalCells; i++ {
+			phaseRangeDelta[i] = int(utils.GetBitsAsInt64(bitStream, pos, lenPhaseRangeDelta))
+			pos += lenPhaseRangeDelta
+		}
+
+		// Get the lock time indicators.
+		for i := 0; i < numSignalCells; i++ {
+			lockTimeIndicator[i] = uint(utils.GetBitsAsUint64(bitStream, pos, lenLockTimeIndicator))
+			pos += lenLockTimeIndicator
+		}
+
+		// Get the half-cycle ambiguity indicator bits.
+		for i := 0; i < numSignalCells; i++ {
+			halfCycleAmbiguity[i] = (utils.GetBitsAsUint64(bitStream, pos, lenHalfCycleAmbiguity) == 1)
+			pos += lenHalfCycleAmbiguity
+		}
+	}
+
+	// Create and return a slice of slices of signal cells, one outer slice per
+	// satellite and one inner slice per observed signal, as for an MSM4.
+
+	// c is the index into the slices of signal fields captured above.
+	c := 0
+
+	signalCells := make([][]Cell, 0)
+	for i := range header.Cells {
+		signalCells = append(signalCells, make([]Cell, 0))
+		for j := range header.Cells[i] {
+			// Beware!  If the multiple message flag is set, only some of the
+			// cells in the cell mask are in this message.
+			if c < numSignalCells {
+
+				if header.Cells[i][j] {
+
+					signalID := header.Signals[j]
+
+					wavelength := utils.GetSignalWavelength(header.Constellation, signalID)
+
+					cell := New(signalID, level, &satCells[i], rangeDelta[c],
+						phaseRangeDelta[c], lockTimeIndicator[c],
+						halfCycleAmbiguity[c], wavelength, logLevel,
+					)
+
+					signalCells[i] = append(signalCells[i], *cell)
+
+					// Prepare to process the next set of signal fields.
+					c++
+				}
+			}
+		}
+	}
+
+	return signalCells, nil
+}
@@ -0,0 +1,79 @@
+package signal
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/type_msm123/satellite"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestString checks that String only shows the fields that each level of
+// message carries.
+func TestString(t *testing.T) {
+
+	sat := satellite.New(4, 512, slog.LevelDebug)
+
+	var testData = []struct {
+		description string
+		cell        *Cell
+		want        string
+	}{
+		{
+			"MSM1", New(2, 1, sat, 1024, 0, 0, false, 0.19, slog.LevelDebug),
+			" 4  2 {(1024, 18.298, 149914.527), -, -, -, 0.190}",
+		},
+		{
+			"MSM2", New(2, 2, sat, 0, 4096, 7, true, 0.19, slog.LevelDebug),
+			" 4  2 {-, (4096, 788939.559), 7, true, 0.190}",
+		},
+		{
+			"MSM3", New(2, 3, sat, 1024, 4096, 7, true, 0.19, slog.LevelDebug),
+			" 4  2 {(1024, 18.298, 149914.527), (4096, 788939.559), 7, true, 0.190}",
+		},
+		{
+			"MSM2 no wavelength", New(2, 2, sat, 0, 4096, 7, true, 0, slog.LevelDebug),
+			" 4  2 {-, no wavelength, 7, true, 0.000}",
+		},
+		{
+			"MSM3 no satellite", New(2, 3, nil, 1024, 4096, 7, true, 0.19, slog.LevelDebug),
+			"<nil>  2 {invalid, invalid, 7, true, 0.190}",
+		},
+	}
+
+	for _, td := range testData {
+		got := td.cell.String()
+		if td.want != got {
+			t.Errorf("%s:\nwant %s\n got %s", td.description, td.want, got)
+		}
+	}
+}
+
+// TestGetAggregateRange checks that GetAggregateRange handles the levels and
+// the invalid delta.
+func TestGetAggregateRange(t *testing.T) {
+
+	sat := satellite.New(4, 512, slog.LevelDebug)
+
+	// The rough range is 512/1024 ms, so the scaled value is 2^28.
+	const roughRange = 1 << 28
+
+	var testData = []struct {
+		description string
+		cell        *Cell
+		want        uint64
+	}{
+		{"MSM1", New(2, 1, sat, 1, 0, 0, false, 0.19, slog.LevelDebug), roughRange + 32},
+		{"MSM2", New(2, 2, sat, 1, 0, 0, false, 0.19, slog.LevelDebug), 0},
+		{"MSM3 negative", New(2, 3, sat, -1, 0, 0, false, 0.19, slog.LevelDebug), roughRange - 32},
+		{"MSM3 invalid delta", New(2, 3, sat, utils.InvalidRangeDelta, 0, 0, false, 0.19, slog.LevelDebug), roughRange},
+		{"no satellite", New(2, 3, nil, 1, 0, 0, false, 0.19, slog.LevelDebug), 0},
+	}
+
+	for _, td := range testData {
+		got := td.cell.GetAggregateRange()
+		if td.want != got {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+	}
+}
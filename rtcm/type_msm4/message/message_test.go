@@ -1,6 +1,8 @@
 package message
 
 import (
+	"bytes"
+	"encoding/hex"
 	"log/slog"
 	"testing"
 
@@ -473,3 +475,68 @@ func TestGetMessageWithErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestFrame checks that Frame reproduces a message frame that's been
+// decoded, and that the result decodes to the same message.
+func TestFrame(t *testing.T) {
+	want, err := GetMessage(testdata.MessageFrameType1074_2, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := want.Frame()
+
+	if !bytes.Equal(testdata.MessageFrameType1074_2, frame) {
+		t.Errorf("want\n%s\ngot\n%s",
+			hex.Dump(testdata.MessageFrameType1074_2), hex.Dump(frame))
+	}
+
+	got, err := GetMessage(frame, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want.String() != got.String() {
+		t.Error(diff.Diff(want.String(), got.String()))
+	}
+}
+
+// TestFrameAndGetMessage checks that a message built from its parts survives
+// being turned into a frame and decoded again.
+func TestFrameAndGetMessage(t *testing.T) {
+	// Signals 2 and 16 from satellite 4, signal 16 from satellite 9.
+	const satelliteMask = 1<<(64-4) | 1<<(64-9)
+	const signalMask = 1<<(32-2) | 1<<(32-16)
+	const cellMask = 0xd // 11 01
+
+	h := header.New(1074, 4095, 345600000, false, 7, 127, 3, 2, true, 7,
+		satelliteMask, signalMask, cellMask, slog.LevelDebug)
+
+	satellites := []satellite.Cell{
+		*satellite.New(4, 81, 435, slog.LevelDebug),
+		*satellite.New(9, 67, 1023, slog.LevelDebug),
+	}
+
+	wavelength2 := utils.GetSignalWavelength("GPS", 2)
+	wavelength16 := utils.GetSignalWavelength("GPS", 16)
+	signals := [][]signal.Cell{
+		{
+			*signal.New(2, &satellites[0], -16384, 2097151, 15, true, 63, wavelength2, slog.LevelDebug),
+			*signal.New(16, &satellites[0], 16383, -2097152, 0, false, 40, wavelength16, slog.LevelDebug),
+		},
+		{
+			*signal.New(16, &satellites[1], -1, 1, 7, false, 1, wavelength16, slog.LevelDebug),
+		},
+	}
+
+	want := New(h, satellites, signals, slog.LevelDebug)
+
+	got, err := GetMessage(want.Frame(), slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want.String() != got.String() {
+		t.Error(diff.Diff(want.String(), got.String()))
+	}
+}
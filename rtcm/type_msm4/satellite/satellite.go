@@ -144,3 +144,19 @@ func GetSatelliteCells(
 
 	return satData, nil
 }
+
+// SetSatelliteCells writes the satellite cells into an MSM4 message frame,
+// starting at bit position pos, and returns the position after them, which
+// is the start of the signal cells.  It's the reverse of GetSatelliteCells.
+func SetSatelliteCells(frame []byte, pos uint, cells []Cell) uint {
+	// The values are laid out field by field, not cell by cell - all of the
+	// whole millis values, then all of the fractional millis values.
+	for i := range cells {
+		pos = utils.SetBits(frame, pos, lenWholeMillis, uint64(cells[i].RangeWholeMillis))
+	}
+	for i := range cells {
+		pos = utils.SetBits(frame, pos, lenFractionalMillis, uint64(cells[i].RangeFractionalMillis))
+	}
+
+	return pos
+}
@@ -14,6 +14,19 @@ import (
 	"github.com/goblimey/go-ntrip/rtcm/utils"
 )
 
+// Define the lengths of the fields in the signal cell of an MSM4 bitstream.
+const lenRangeDelta uint = 15
+const lenPhaseRangeDelta uint = 22
+const lenLockTimeIndicator uint = 4
+const lenHalfCycleAmbiguity uint = 1
+const lenCNR uint = 6
+
+const bitsPerCell = lenRangeDelta + lenPhaseRangeDelta +
+	lenLockTimeIndicator + lenHalfCycleAmbiguity + lenCNR
+
+// CellLengthInBits is the number of bits in each signal cell.
+const CellLengthInBits = bitsPerCell
+
 // Cell holds the data from an MSM4 message for one signal
 // from one satellite, plus values copied from the satellite.
 type Cell struct {
@@ -146,16 +159,6 @@ func GetSignalCells(
 	// of the signals.  If the multiple message flag is not set then we expect the
 	// message to contain all the signals.
 
-	// Define the lengths of the fields
-	const lenRangeDelta uint = 15
-	const lenPhaseRangeDelta uint = 22
-	const lenLockTimeIndicator uint = 4
-	const lenHalfCycleAmbiguity uint = 1
-	const lenCNR uint = 6
-
-	const bitsPerCell = lenRangeDelta + lenPhaseRangeDelta +
-		lenLockTimeIndicator + lenHalfCycleAmbiguity + lenCNR
-
 	// The frame contain the 24-bit leader, the embedded message and the 24-bit CRC.
 	// startOfSignalCells is the number of bits of the FRAME consumed so far.
 	bitsLeftInFrame := uint(len(bitStream)*8 - int(startOfSignalCells))
@@ -164,9 +167,13 @@ func GetSignalCells(
 	// Pos is the position within the bitstream.
 	pos := startOfSignalCells
 
-	// Find the number of signal cells, ignoring any padding.
+	// Find the number of signal cells, ignoring any padding.  If that disagrees
+	// with the cell mask, decode the number of cells that the mask gives, if
+	// possible, so that one malformed message doesn't misalign all the fields.
 
-	numSignalCells := utils.GetNumberOfSignalCells(bitStream, pos, bitsPerCell)
+	numSignalCells, warning := utils.CheckNumberOfSignalCells(
+		bitStream, pos, bitsPerCell, header.NumSignalCells, header.MultipleMessage)
+	header.Warning = warning
 
 	if header.MultipleMessage {
 		// The message doesn't contain all the signal cells but there should be
@@ -279,6 +286,37 @@ func GetSignalCells(
 	return signalCells, nil
 }
 
+// SetSignalCells writes the signal cells into an MSM4 message frame, starting
+// at bit position pos, and returns the position after them.  It's the
+// reverse of GetSignalCells.  The cells are given as a slice of slices, one
+// per satellite, and must agree with the cell mask in the header.
+func SetSignalCells(frame []byte, pos uint, cells [][]Cell) uint {
+	// The values are laid out field by field, not cell by cell - all of the
+	// range deltas, then all of the phase range deltas and so on.
+	all := make([]Cell, 0)
+	for i := range cells {
+		all = append(all, cells[i]...)
+	}
+
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenRangeDelta, uint64(all[i].RangeDelta))
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenPhaseRangeDelta, uint64(all[i].PhaseRangeDelta))
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenLockTimeIndicator, uint64(all[i].LockTimeIndicator))
+	}
+	for i := range all {
+		pos = utils.SetFlag(frame, pos, all[i].HalfCycleAmbiguity)
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenCNR, uint64(all[i].CarrierToNoiseRatio))
+	}
+
+	return pos
+}
+
 // GetAggregateRange takes the range values from an MSM4 signal cell (including some
 // copied from the MSM4satellite cell) and returns the range as a 37-bit scaled unsigned
 // integer with 8 bits whole part and 29 bits fractional part.  This is the transit time
@@ -376,6 +414,19 @@ func (cell *Cell) RangeInMillis() float64 {
 	return rangeInMillis
 }
 
+// CNR returns the carrier to noise ratio in dB-Hz, which is the value of
+// the S observation in a RINEX file.  In an MSM4 the ratio is given in whole
+// dB-Hz.  Zero means that the value is not available.
+func (cell *Cell) CNR() float64 {
+	return float64(cell.CarrierToNoiseRatio)
+}
+
+// SNRFlag returns the RINEX signal strength flag (1-9, or 0 if unknown)
+// derived from the carrier to noise ratio.
+func (cell *Cell) SNRFlag() uint {
+	return utils.RinexSNRFlag(cell.CNR())
+}
+
 // RangeInMetres gives the distance from the satellite to the GPS device derived from
 // the satellite and signal cell, in metres.
 func (cell *Cell) RangeInMetres() float64 {
@@ -204,6 +204,56 @@ func TestGetSignalCells(t *testing.T) {
 	}
 }
 
+// TestGetSignalCellsWithJunkAfterSignals checks that GetSignalCells ignores
+// non-zero data after the number of signal cells given by the cell mask and
+// sets a warning in the header.
+func TestGetSignalCellsWithJunkAfterSignals(t *testing.T) {
+	satellites := []uint{42, 43}
+	signals := []uint{8, 3}
+	cellMask := [][]bool{{true, true}, {true, false}}
+	satData := []satellite.Cell{{ID: 42}, {ID: 43}}
+
+	// Three signal cells starting at bit 8, as in TestGetSignalCells, and
+	// the CRC.
+	bitStream := []byte{
+		0x00, 0x40, 0x03, 0xff, 0xfc, 0x00, 0x07, 0xff,
+		0xff, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x03, 0xe0,
+		0x36, 0x10, 0x20,
+		0, 0, 0,
+	}
+	// The same with 48 bits of junk before the CRC, which looks like a
+	// fourth cell.
+	bitStreamWithJunk := append(append([]byte{}, bitStream[:19]...),
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0)
+
+	const wantWarning = "the cell mask gives 3 signal cells but the message contains 4 - ignoring the extra 1"
+
+	cleanHeader := header.Header{MessageType: 1074, Constellation: "GPS",
+		NumSignalCells: 3, Satellites: satellites, Signals: signals, Cells: cellMask}
+	want, wantError := GetSignalCells(bitStream, 8, &cleanHeader, satData, slog.LevelInfo)
+	if wantError != nil {
+		t.Fatal(wantError)
+	}
+	if len(cleanHeader.Warning) > 0 {
+		t.Errorf("want no warning, got %s", cleanHeader.Warning)
+	}
+
+	junkHeader := header.Header{MessageType: 1074, Constellation: "GPS",
+		NumSignalCells: 3, Satellites: satellites, Signals: signals, Cells: cellMask}
+	got, err := GetSignalCells(bitStreamWithJunk, 8, &junkHeader, satData, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if junkHeader.Warning != wantWarning {
+		t.Errorf("want warning %s got %s", wantWarning, junkHeader.Warning)
+	}
+
+	if !cmp.Equal(want, got) {
+		t.Errorf("the junk was not ignored:\n%s", cmp.Diff(want, got))
+	}
+}
+
 // TestGetMS4SignalCellsWithShortBitStream checks that GetMSMSignalCells produces
 // the correct error message if the bitstream is too short.
 func TestGetMS4SignalCellsWithShortBitStream(t *testing.T) {
@@ -700,3 +750,30 @@ func TestEqual(t *testing.T) {
 		}
 	}
 }
+
+// TestCNR checks the conversion of the carrier to noise ratio, which is in
+// whole dB-Hz, and the RINEX signal strength flag derived from it.
+func TestCNR(t *testing.T) {
+	var testData = []struct {
+		cnr      uint
+		want     float64
+		wantFlag uint
+	}{
+		{0, 0, 0},
+		{11, 11, 1},
+		{45, 45, 7},
+	}
+	for _, td := range testData {
+		cell := Cell{CarrierToNoiseRatio: td.cnr}
+
+		got := cell.CNR()
+		if got != td.want {
+			t.Errorf("%d: want %f got %f", td.cnr, td.want, got)
+		}
+
+		gotFlag := cell.SNRFlag()
+		if gotFlag != td.wantFlag {
+			t.Errorf("%d: want flag %d got %d", td.cnr, td.wantFlag, gotFlag)
+		}
+	}
+}
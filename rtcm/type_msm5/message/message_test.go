@@ -0,0 +1,123 @@
+package message
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm5/signal"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestGetMessage checks that GetMessage correctly decodes an MSM5 message.
+func TestGetMessage(t *testing.T) {
+
+	message, err := GetMessage(testdata.MessageFrameType1075, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Header.MessageType != 1075 {
+		t.Errorf("want type 1075 got %d", message.Header.MessageType)
+	}
+
+	if message.Header.Constellation != "GPS" {
+		t.Errorf("want GPS got %s", message.Header.Constellation)
+	}
+
+	// Check the satellite cells.
+	wantSatellites := []struct {
+		id, whole, frac uint
+		rate            int
+	}{{4, 72, 417, -512}, {9, 81, 95, 305}}
+
+	if len(message.Satellites) != len(wantSatellites) {
+		t.Fatalf("want %d satellites got %d", len(wantSatellites), len(message.Satellites))
+	}
+
+	for i, want := range wantSatellites {
+		got := message.Satellites[i]
+		if got.ID != want.id || got.RangeWholeMillis != want.whole ||
+			got.RangeFractionalMillis != want.frac || got.PhaseRangeRate != want.rate {
+			t.Errorf("satellite %d: want %v got {%d %d %d %d}", i, want,
+				got.ID, got.RangeWholeMillis, got.RangeFractionalMillis, got.PhaseRangeRate)
+		}
+	}
+
+	// Check the signal cells.  The cell mask gives two signals for the first
+	// satellite and one for the second.
+	wantSignals := []struct {
+		satID, sigID    uint
+		rangeDelta      int
+		phaseRangeDelta int
+		lock            uint
+		hca             bool
+		cnr             uint
+		rateDelta       int
+	}{
+		{4, 2, 1234, -56789, 15, false, 45, -1234},
+		{4, 16, -2345, 123456, 9, true, 38, 567},
+		{9, 2, utils.InvalidRangeDelta, 98765, 3, false, 41, signal.InvalidPhaseRangeRateDelta},
+	}
+
+	if len(message.Signals) != 2 || len(message.Signals[0]) != 2 || len(message.Signals[1]) != 1 {
+		t.Fatalf("want signals [2 1] got %v", message.Signals)
+	}
+
+	c := 0
+	for i := range message.Signals {
+		for j := range message.Signals[i] {
+			got := message.Signals[i][j]
+			want := wantSignals[c]
+			if got.Satellite.ID != want.satID || got.ID != want.sigID ||
+				got.RangeDelta != want.rangeDelta || got.PhaseRangeDelta != want.phaseRangeDelta ||
+				got.LockTimeIndicator != want.lock || got.HalfCycleAmbiguity != want.hca ||
+				got.CarrierToNoiseRatio != want.cnr || got.PhaseRangeRateDelta != want.rateDelta {
+				t.Errorf("signal %d: want %v got %s", c, want, got.String())
+			}
+			c++
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage handles errors correctly.
+func TestGetMessageWithErrors(t *testing.T) {
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		want        string
+	}{
+		{
+			"header too short", testdata.MessageFrameType1075[:20],
+			"bitstream is too short for an MSM header - got 112 bits, expected at least 169",
+		},
+		{
+			"satellite cells too short", testdata.MessageFrameType1075[:30],
+			"overrun - not enough data for 2 MSM7 satellite cells - need 72 bits, got 43",
+		},
+		{
+			"signal cells too short", testdata.MessageFrameType1075[:45],
+			"overrun - want 3 MSM5 signals, got 1",
+		},
+		{
+			"not MSM5", testdata.MessageFrameType1077,
+			"message type 1077 is not an MSM5",
+		},
+	}
+	for _, td := range testData {
+
+		gotMessage, gotError := GetMessage(td.bitStream, slog.LevelDebug)
+
+		if gotMessage != nil {
+			t.Errorf("%s: On error, the message should be nil", td.description)
+		}
+		if gotError == nil {
+			t.Errorf("%s: expected an error", td.description)
+		} else {
+			if gotError.Error() != td.want {
+				t.Errorf("%s:\nwant %s\n got %s", td.description, td.want, gotError.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,442 @@
+// package signal contains code to handle the data from a signal cell from a
+// Multiple Signal Message type 5 (message type 1075, 1085 etc.).  An MSM5
+// carries the same standard resolution range and phase range as an MSM4 plus
+// the phase range rate, and its satellite cells are the same as an MSM7's, so
+// the satellite data is handled by the type_msm7 satellite package.  Various
+// values are defined from values in the signal cell and its associated
+// satellite cell.  For convenience the ones from the satellite cell are
+// copied here.
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	msmHeader "github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm7/satellite"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Define the lengths of the fields in the signal cell of an MSM5 bitstream.
+const lenRangeDelta uint = 15
+const lenPhaseRangeDelta uint = 22
+const lenLockTimeIndicator uint = 4
+const lenHalfCycleAmbiguity uint = 1
+const lenCNR uint = 6
+const lenPhaseRangeRateDelta uint = 15
+
+const bitsPerCell = lenRangeDelta + lenPhaseRangeDelta +
+	lenLockTimeIndicator + lenHalfCycleAmbiguity + lenCNR + lenPhaseRangeRateDelta
+
+// InvalidPhaseRangeRateDelta is the invalid value for the delta in an MSM5
+// signal cell. 15 bit two's complement 100 0000 0000 0000
+const InvalidPhaseRangeRateDelta = -16384
+
+// Cell holds the data from a Multiple Signal Message type 5 for one signal
+// from one satellite, plus values copied from the satellite cell.
+type Cell struct {
+	// Field names, sizes, invalid values etc are derived from rtklib rtcm3.c
+	// (decode_msm5 function).
+
+	// ID is the ID of the signal, 1-32.
+	ID uint
+
+	// Wavelength is the wavelength of the signal
+	Wavelength float64
+
+	// RangeDelta - int15.  A scaled value representing a small signed delta to be added to
+	// the range values from the satellite to get the range as the transit time of the
+	// signal.  The value is in units of (two to the power of -24) milliseconds.  Invalid
+	// if the top bit is set and the others are all zero (utils.InvalidRangeDelta).
+	RangeDelta int
+
+	// PhaseRangeDelta - int22.  Invalid if the top bit is set and the others are all zero
+	// (utils.InvalidPhaseRangeDelta).  The true phase range for the signal is derived by
+	// scaling this and adding it to the approximate value in the satellite cell.  If this
+	// value is invalid, use just the approximate value.
+	PhaseRangeDelta int
+
+	// LockTimeIndicator - uint4.
+	LockTimeIndicator uint
+
+	// HalfCycleAmbiguity flag - 1 bit.
+	HalfCycleAmbiguity bool
+
+	// CarrierToNoiseRatio - uint6.
+	CarrierToNoiseRatio uint
+
+	// PhaseRangeRateDelta - int15 - invalid if the top bit is set and the others are all
+	// zero (InvalidPhaseRangeRateDelta).  The value is in tenth millimetres per second.
+	// The true value of the signal's phase range rate is derived by scaling this delta
+	// and adding it to the approximate value from the satellite cell.
+	PhaseRangeRateDelta int
+
+	// The satellite that sent the signal.
+	Satellite *satellite.Cell
+
+	// LogLevel controls the data output by String.
+	LogLevel slog.Level
+}
+
+// New creates an MSM5 Signal Cell.
+func New(
+	signalID uint,
+	satelliteCell *satellite.Cell,
+	rangeDelta int,
+	phaseRangeDelta int,
+	lockTimeIndicator uint,
+	halfCycleAmbiguity bool,
+	cnr uint,
+	phaseRangeRateDelta int,
+	wavelength float64,
+	logLevel slog.Level,
+) *Cell {
+
+	cell := Cell{
+		ID:                  signalID,
+		Wavelength:          wavelength,
+		RangeDelta:          rangeDelta,
+		PhaseRangeDelta:     phaseRangeDelta,
+		LockTimeIndicator:   lockTimeIndicator,
+		HalfCycleAmbiguity:  halfCycleAmbiguity,
+		CarrierToNoiseRatio: cnr,
+		PhaseRangeRateDelta: phaseRangeRateDelta,
+		Satellite:           satelliteCell,
+		LogLevel:            logLevel,
+	}
+
+	return &cell
+}
+
+// String returns a readable version of a signal cell.
+func (cell *Cell) String() string {
+
+	var satID string
+	if cell.Satellite == nil {
+		satID = "<nil>"
+	} else {
+		satID = fmt.Sprintf("%2d", cell.Satellite.ID)
+	}
+
+	var rangeM string
+	if cell.Satellite == nil || cell.Satellite.RangeWholeMillis == utils.InvalidRange {
+		rangeM = "invalid"
+	} else {
+		// Convert the delta to float and divide by two to the power 24 to restore
+		// the scale.  This gives the delta in milliseconds.
+		rangeDeltaInMillis := float64(cell.RangeDelta) / float64(utils.TwoToThePower24)
+
+		rangeDeltaInMetres := rangeDeltaInMillis * utils.OneLightMillisecond
+
+		rangeM = fmt.Sprintf("(%d, %.3f, %.3f)",
+			cell.RangeDelta, rangeDeltaInMetres, cell.RangeInMetres())
+	}
+
+	var phaseRange string
+	switch {
+	case cell.Satellite == nil || cell.Satellite.RangeWholeMillis == utils.InvalidRange:
+		phaseRange = "invalid"
+	case cell.Wavelength == 0:
+		// The calculation involves dividing by the frequency
+		// so that must be non-zero.
+		phaseRange = "no wavelength"
+	default:
+		phaseRange = fmt.Sprintf("(%d, %.3f)",
+			cell.PhaseRangeDelta, cell.PhaseRange())
+	}
+
+	var phaseRangeRate string
+	switch {
+	case cell.Satellite == nil || cell.Satellite.PhaseRangeRate == satellite.InvalidPhaseRangeRate:
+		phaseRangeRate = "invalid"
+	case cell.Wavelength == 0:
+		phaseRangeRate = "no wavelength"
+	default:
+		// The phase range rate is shown in metres per second and as the
+		// Doppler value in Hz.
+		phaseRangeRate = fmt.Sprintf("(%d, %.3f, %.3f)",
+			cell.PhaseRangeRateDelta, cell.PhaseRangeRate(),
+			cell.PhaseRangeRateDoppler())
+	}
+
+	return fmt.Sprintf("%s %2d {%s, %s, %s, %d, %v, %d, %.3f}",
+		satID, cell.ID, rangeM, phaseRange, phaseRangeRate,
+		cell.LockTimeIndicator, cell.HalfCycleAmbiguity,
+		cell.CarrierToNoiseRatio, cell.Wavelength)
+}
+
+// GetAggregateRange takes the range values from an MSM5 signal cell (including some
+// copied from the satellite cell) and returns the range as a 37-bit scaled unsigned
+// integer with 8 bits whole part and 29 bits fractional part.  This is the transit time
+// of the signal in milliseconds.  If the approximate range value in the satellite cell
+// is invalid, the result is 0.  If the delta in the signal cell is invalid, the result
+// is the approximate range.
+func (cell *Cell) GetAggregateRange() uint64 {
+
+	if cell.Satellite == nil {
+		return 0
+	}
+
+	if cell.Satellite.RangeWholeMillis == utils.InvalidRange {
+		return 0
+	}
+
+	if cell.RangeDelta == utils.InvalidRangeDelta {
+		// The range is valid but the delta is not.
+		return utils.GetScaledRange(cell.Satellite.RangeWholeMillis,
+			cell.Satellite.RangeFractionalMillis, 0)
+	}
+
+	// The delta is 15 bits, as in an MSM4.  The calculation assumes the 20-bit
+	// MSM7 form, so normalise it.  The value may be negative, so multiply
+	// rather than shifting bits.
+	delta := cell.RangeDelta * 32
+
+	return utils.GetScaledRange(cell.Satellite.RangeWholeMillis,
+		cell.Satellite.RangeFractionalMillis, delta)
+}
+
+// GetAggregatePhaseRange takes the phase range values from the satellite and signal
+// cells, aggregates them and returns them as a 41-bit scaled unsigned integer, 8 bits
+// whole part and 33 bits fractional part.
+func (cell *Cell) GetAggregatePhaseRange() uint64 {
+
+	if cell.Satellite == nil {
+		return 0
+	}
+
+	if cell.Satellite.RangeWholeMillis == utils.InvalidRange {
+		return 0
+	}
+
+	var delta int
+
+	if cell.PhaseRangeDelta != utils.InvalidPhaseRangeDelta {
+		// The delta is 22 bits, as in an MSM4.  Normalise it to the 24-bit
+		// MSM7 form.
+		delta = cell.PhaseRangeDelta * 4
+	}
+
+	return utils.GetScaledPhaseRange(
+		cell.Satellite.RangeWholeMillis,
+		cell.Satellite.RangeFractionalMillis,
+		delta,
+	)
+}
+
+// GetAggregatePhaseRangeRate returns the phase range rate as an int, scaled up
+// by 10,000.  If the rate value in the satellite cell is invalid, the result
+// is zero.  If the delta in the signal cell is invalid, the result is based on
+// the rate value in the satellite.
+func (cell *Cell) GetAggregatePhaseRangeRate() int64 {
+
+	if cell.Satellite == nil {
+		return 0
+	}
+
+	if cell.Satellite.PhaseRangeRate == satellite.InvalidPhaseRangeRate {
+		return 0
+	}
+
+	var delta int
+
+	if cell.PhaseRangeRateDelta != InvalidPhaseRangeRateDelta {
+		delta = cell.PhaseRangeRateDelta
+	}
+
+	return utils.GetScaledPhaseRangeRate(cell.Satellite.PhaseRangeRate, delta)
+}
+
+// RangeInMetres gives the distance from the satellite to the GPS device derived from
+// the values in the satellite and signal cell, converted to metres.
+func (cell *Cell) RangeInMetres() float64 {
+
+	// Get the range as a 37-bit scaled integer, 8 bits whole, 29 bits fractional
+	// representing the transit time in milliseconds.
+	scaledRange := cell.GetAggregateRange()
+
+	// Convert to float and divide by two to the power 29 to restore the scale.
+	rangeInMillis := float64(scaledRange) / float64(utils.TwoToThePower29)
+
+	// Use the speed of light to convert that to the distance from the
+	// satellite to the receiver.
+	return rangeInMillis * utils.OneLightMillisecond
+}
+
+// PhaseRange combines the range and the phase range from an MSM5
+// message and returns the result in cycles.  It returns zero if the input
+// measurements are invalid.
+func (cell *Cell) PhaseRange() float64 {
+
+	aggregatePhaseRange := cell.GetAggregatePhaseRange()
+
+	// Restore the scale of the aggregate value.
+	phaseRangeMilliSeconds := utils.GetPhaseRangeMilliseconds(aggregatePhaseRange)
+
+	// Convert to light milliseconds
+	phaseRangeLMS := utils.GetPhaseRangeLightMilliseconds(phaseRangeMilliSeconds)
+
+	// and divide by the wavelength to get cycles.
+	return phaseRangeLMS / cell.Wavelength
+}
+
+// PhaseRangeRate combines the components of the phase range rate and
+// returns the result in metres per second.
+func (cell *Cell) PhaseRangeRate() float64 {
+	// The aggregate is metres per second scaled up by 10,000.
+	return float64(cell.GetAggregatePhaseRangeRate()) / 10000
+}
+
+// PhaseRangeRateDoppler gets the Doppler value in Hz from the phase range
+// rate, as RTKLIB does - see the type_msm7 signal package.
+func (cell *Cell) PhaseRangeRateDoppler() float64 {
+	return (cell.PhaseRangeRate() / cell.Wavelength) * -1
+}
+
+// CNR returns the carrier to noise ratio in dB-Hz.  In an MSM5 the ratio is
+// given in whole dB-Hz.  Zero means that the value is not available.
+func (cell *Cell) CNR() float64 {
+	return float64(cell.CarrierToNoiseRatio)
+}
+
+// SNRFlag returns the RINEX signal strength flag (1-9, or 0 if unknown)
+// derived from the carrier to noise ratio.
+func (cell *Cell) SNRFlag() uint {
+	return utils.RinexSNRFlag(cell.CNR())
+}
+
+// GetSignalCells gets the data from the signal cells of an MSM5 message.
+func GetSignalCells(
+	bitStream []byte,
+	startOfSignalCells uint,
+	header *msmHeader.Header,
+	satCells []satellite.Cell,
+	logLevel slog.Level,
+) ([][]Cell, error) {
+	// The signal data is laid out as in an MSM7 - all of the range deltas, then
+	// all of the phase range deltas and so on - but the fields are the sizes
+	// used in an MSM4.  See the type_msm7 signal package for the details.
+
+	// The frame contain the 24-bit leader, the embedded message and the 24-bit CRC.
+	// startOfSignalCells is the number of bits of the FRAME consumed so far.
+	bitsLeftInFrame := uint(len(bitStream)*8 - int(startOfSignalCells))
+	bitsLeftInMessage := bitsLeftInFrame - utils.CRCLengthBits
+
+	// Pos is the position within the bitstream.
+	pos := startOfSignalCells
+
+	numSignalCells, warning := utils.CheckNumberOfSignalCells(
+		bitStream, pos, bitsPerCell, header.NumSignalCells, header.MultipleMessage)
+	header.Warning = warning
+
+	if header.MultipleMessage {
+		// The message doesn't contain all the signal cells but there should be
+		// at least one.
+		if bitsLeftInMessage < bitsPerCell {
+			message := fmt.Sprintf("overrun - want at least one %d-bit signal cell when multiple message flag is set, got only %d bits left",
+				bitsPerCell, bitsLeftInMessage)
+			return nil, errors.New(message)
+		}
+	} else {
+		// This message should contain all the signal cells.  Check that
+		// there are the expected number.
+		if numSignalCells < header.NumSignalCells {
+			message := fmt.Sprintf("overrun - want %d MSM5 signals, got %d",
+				header.NumSignalCells, numSignalCells)
+			return nil, errors.New(message)
+		}
+	}
+
+	// Get the range deltas.
+	rangeDelta := make([]int, 0)
+	for i := 0; i < numSignalCells; i++ {
+		rd := int(utils.GetBitsAsInt64(bitStream, pos, lenRangeDelta))
+		pos += lenRangeDelta
+		rangeDelta = append(rangeDelta, rd)
+	}
+
+	// Get the phase range deltas.
+	phaseRangeDelta := make([]int, 0)
+	for i := 0; i < numSignalCells; i++ {
+		prd := int(utils.GetBitsAsInt64(bitStream, pos, lenPhaseRangeDelta))
+		pos += lenPhaseRangeDelta
+		phaseRangeDelta = append(phaseRangeDelta, prd)
+	}
+
+	// Get the lock time indicators.
+	lockTimeIndicator := make([]uint, 0)
+	for i := 0; i < numSignalCells; i++ {
+		lti := uint(utils.GetBitsAsUint64(bitStream, pos, lenLockTimeIndicator))
+		pos += lenLockTimeIndicator
+		lockTimeIndicator = append(lockTimeIndicator, lti)
+	}
+
+	// Get the half-cycle ambiguity indicator bits.
+	halfCycleAmbiguity := make([]bool, 0)
+	for i := 0; i < numSignalCells; i++ {
+		hca := (utils.GetBitsAsUint64(bitStream, pos, lenHalfCycleAmbiguity) == 1)
+		pos += lenHalfCycleAmbiguity
+		halfCycleAmbiguity = append(halfCycleAmbiguity, hca)
+	}
+
+	// Get the CNRs.
+	cnr := make([]uint, 0)
+	for i := 0; i < numSignalCells; i++ {
+		c := uint(utils.GetBitsAsUint64(bitStream, pos, lenCNR))
+		pos += lenCNR
+		cnr = append(cnr, c)
+	}
+
+	// Get the phase range rate deltas.
+	phaseRangeRateDelta := make([]int, 0)
+	for i := 0; i < numSignalCells; i++ {
+		delta := int(utils.GetBitsAsInt64(bitStream, pos, lenPhaseRangeRateDelta))
+		pos += lenPhaseRangeRateDelta
+		phaseRangeRateDelta = append(phaseRangeRateDelta, delta)
+	}
+
+	// Create and return a slice of slices of signal cells, one outer slice per
+	// satellite and one inner slice per observed signal, as for an MSM7.
+
+	signalCells := make([][]Cell, len(header.Satellites))
+
+	// c is the index into the slices of signal fields captured above.
+	c := 0
+
+	for i := range header.Cells {
+		signalCells[i] = make([]Cell, 0)
+		for j := range header.Cells[i] {
+			// Beware!  We are cranking through the 1 bits in the cell mask and if
+			// the multiple message flag is set, not all those cells are there.
+			if c < numSignalCells {
+				if header.Cells[i][j] {
+
+					signalID := header.Signals[j]
+
+					wavelength := utils.GetSignalWavelength(header.Constellation, signalID)
+
+					cell := New(
+						signalID,
+						&(satCells[i]),
+						rangeDelta[c],
+						phaseRangeDelta[c],
+						lockTimeIndicator[c],
+						halfCycleAmbiguity[c],
+						cnr[c],
+						phaseRangeRateDelta[c],
+						wavelength,
+						logLevel,
+					)
+
+					signalCells[i] = append(signalCells[i], *cell)
+
+					// Prepare to process the next set of signal fields.
+					c++
+				}
+			}
+		}
+	}
+
+	return signalCells, nil
+}
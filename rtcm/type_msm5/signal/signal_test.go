@@ -0,0 +1,45 @@
+package signal
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/type_msm7/satellite"
+)
+
+// TestGetAggregatePhaseRangeRate checks that the phase range rate combines
+// the values from the satellite and signal cells, and handles invalid values.
+func TestGetAggregatePhaseRangeRate(t *testing.T) {
+
+	sat := satellite.New(4, 72, 417, 0, -512, slog.LevelDebug)
+	invalidSat := satellite.New(4, 72, 417, 0, satellite.InvalidPhaseRangeRate, slog.LevelDebug)
+
+	var testData = []struct {
+		description string
+		cell        *Cell
+		want        int64
+	}{
+		// The satellite rate is in metres per second and the delta is in
+		// units of 0.0001 metres per second.
+		{"valid", New(2, sat, 0, 0, 0, false, 0, 1234, 0.19, slog.LevelDebug), -5120000 + 1234},
+		{"invalid delta", New(2, sat, 0, 0, 0, false, 0, InvalidPhaseRangeRateDelta, 0.19, slog.LevelDebug), -5120000},
+		{"invalid satellite rate", New(2, invalidSat, 0, 0, 0, false, 0, 1234, 0.19, slog.LevelDebug), 0},
+		{"no satellite", New(2, nil, 0, 0, 0, false, 0, 1234, 0.19, slog.LevelDebug), 0},
+	}
+
+	for _, td := range testData {
+		got := td.cell.GetAggregatePhaseRangeRate()
+		if td.want != got {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+	}
+}
+
+// TestCNR checks that the carrier to noise ratio is given in whole dB-Hz.
+func TestCNR(t *testing.T) {
+	cell := New(2, nil, 0, 0, 0, false, 45, 0, 0.19, slog.LevelDebug)
+
+	if cell.CNR() != 45.0 {
+		t.Errorf("want 45.0 got %f", cell.CNR())
+	}
+}
@@ -0,0 +1,120 @@
+package message
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm6/signal"
+)
+
+// TestGetMessage checks that GetMessage correctly decodes an MSM6 message.
+func TestGetMessage(t *testing.T) {
+
+	message, err := GetMessage(testdata.MessageFrameType1096, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Header.MessageType != 1096 {
+		t.Errorf("want type 1096 got %d", message.Header.MessageType)
+	}
+
+	if message.Header.Constellation != "Galileo" {
+		t.Errorf("want Galileo got %s", message.Header.Constellation)
+	}
+
+	// Check the satellite cells.
+	wantSatellites := []struct {
+		id, whole, frac uint
+	}{{11, 72, 417}, {24, 81, 95}}
+
+	if len(message.Satellites) != len(wantSatellites) {
+		t.Fatalf("want %d satellites got %d", len(wantSatellites), len(message.Satellites))
+	}
+
+	for i, want := range wantSatellites {
+		got := message.Satellites[i]
+		if got.ID != want.id || got.RangeWholeMillis != want.whole ||
+			got.RangeFractionalMillis != want.frac {
+			t.Errorf("satellite %d: want %v got {%d %d %d}", i, want,
+				got.ID, got.RangeWholeMillis, got.RangeFractionalMillis)
+		}
+	}
+
+	// Check the signal cells.  The cell mask gives two signals for the first
+	// satellite and one for the second.
+	wantSignals := []struct {
+		satID, sigID    uint
+		rangeDelta      int
+		phaseRangeDelta int
+		lock            uint
+		hca             bool
+		cnr             uint
+	}{
+		{11, 2, 39488, -227156, 704, false, 721},
+		{11, 23, -75040, 493824, 512, true, 609},
+		{24, 2, signal.InvalidRangeDelta, signal.InvalidPhaseRangeDelta, 12, false, 657},
+	}
+
+	if len(message.Signals) != 2 || len(message.Signals[0]) != 2 || len(message.Signals[1]) != 1 {
+		t.Fatalf("want signals [2 1] got %v", message.Signals)
+	}
+
+	c := 0
+	for i := range message.Signals {
+		for j := range message.Signals[i] {
+			got := message.Signals[i][j]
+			want := wantSignals[c]
+			if got.Satellite.ID != want.satID || got.ID != want.sigID ||
+				got.RangeDelta != want.rangeDelta || got.PhaseRangeDelta != want.phaseRangeDelta ||
+				got.LockTimeIndicator != want.lock || got.HalfCycleAmbiguity != want.hca ||
+				got.CarrierToNoiseRatio != want.cnr {
+				t.Errorf("signal %d: want %v got %s", c, want, got.String())
+			}
+			c++
+		}
+	}
+}
+
+// TestGetMessageWithErrors checks that GetMessage handles errors correctly.
+func TestGetMessageWithErrors(t *testing.T) {
+
+	var testData = []struct {
+		description string
+		bitStream   []byte
+		want        string
+	}{
+		{
+			"header too short", testdata.MessageFrameType1096[:20],
+			"bitstream is too short for an MSM header - got 112 bits, expected at least 169",
+		},
+		{
+			"satellite cells too short", testdata.MessageFrameType1096[:30],
+			"overrun - not enough data for 2 MSM4 satellite cells - need 36 bits, got 19",
+		},
+		{
+			"signal cells too short", testdata.MessageFrameType1096[:40],
+			"overrun - want 3 MSM6 signals, got 1",
+		},
+		{
+			"not MSM6", testdata.MessageFrameType1077,
+			"message type 1077 is not an MSM6",
+		},
+	}
+	for _, td := range testData {
+
+		gotMessage, gotError := GetMessage(td.bitStream, slog.LevelDebug)
+
+		if gotMessage != nil {
+			t.Errorf("%s: On error, the message should be nil", td.description)
+		}
+		if gotError == nil {
+			t.Errorf("%s: expected an error", td.description)
+		} else {
+			if gotError.Error() != td.want {
+				t.Errorf("%s:\nwant %s\n got %s", td.description, td.want, gotError.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// package signal contains code to handle the data from a signal cell from a
+// Multiple Signal Message type 6 (message type 1076, 1086 etc.).  An MSM6
+// carries the same high resolution range and phase range as an MSM7 but no
+// phase range rate, and its satellite cells are the same as an MSM4's, so
+// the satellite data is handled by the type_msm4 satellite package.  Various
+// values are defined from values in the signal cell and its associated
+// satellite cell.  For convenience the ones from the satellite cell are
+// copied here.
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	msmHeader "github.com/goblimey/go-ntrip/rtcm/header"
+	"github.com/goblimey/go-ntrip/rtcm/type_msm4/satellite"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Define the lengths of the fields in the signal cell of an MSM6 bitstream.
+const lenRangeDelta uint = 20
+const lenPhaseRangeDelta uint = 24
+const lenLockTimeIndicator uint = 10
+const lenHalfCycleAmbiguity uint = 1
+const lenCNR uint = 10
+
+const bitsPerCell = lenRangeDelta + lenPhaseRangeDelta +
+	lenLockTimeIndicator + lenHalfCycleAmbiguity + lenCNR
+
+// InvalidRangeDelta is the invalid value for the range delta in an MSM6
+// signal cell. 20 bit two's complement 1000 0000 0000 0000 0000
+const InvalidRangeDelta = -524288
+
+// InvalidPhaseRangeDelta is the invalid value for the phase range delta
+// in an MSM6 signal cell.  24 bit two's complement: 1000 0000 0000 0000 0000 0000
+const InvalidPhaseRangeDelta = -8388608
+
+// Cell holds the data from a Multiple Signal Message type 6 for one signal
+// from one satellite, plus values copied from the satellite cell.
+type Cell struct {
+	// Field names, sizes, invalid values etc are derived from rtklib rtcm3.c
+	// (decode_msm6 function).
+
+	// ID is the ID of the signal, 1-32.
+	ID uint
+
+	// Wavelength is the wavelength of the signal
+	Wavelength float64
+
+	// RangeDelta - int20.  A scaled value representing a small signed delta to be added to
+	// the range values from the satellite to get the range as the transit time of the signal.
+	// Invalid if the top bit is set and the others are all zero (InvalidRangeDelta).
+	RangeDelta int
+
+	// PhaseRangeDelta - int24.  Invalid if the top bit is set and the others are all zero
+	// (InvalidPhaseRangeDelta).  The true phase range for the signal is derived by scaling
+	// this and adding it to the approximate value in the satellite cell.  If this value is
+	// invalid, use just the approximate value.
+	PhaseRangeDelta int
+
+	// LockTimeIndicator - uint10.
+	LockTimeIndicator uint
+
+	// HalfCycleAmbiguity flag - 1 bit.
+	HalfCycleAmbiguity bool
+
+	// CarrierToNoiseRatio - uint10.
+	CarrierToNoiseRatio uint
+
+	// The satellite that sent the signal.
+	Satellite *satellite.Cell
+
+	// LogLevel controls the data output by String.
+	LogLevel slog.Level
+}
+
+// New creates an MSM6 Signal Cell.
+func New(
+	signalID uint,
+	satelliteCell *satellite.Cell,
+	rangeDelta int,
+	phaseRangeDelta int,
+	lockTimeIndicator uint,
+	halfCycleAmbiguity bool,
+	cnr uint,
+	wavelength float64,
+	logLevel slog.Level,
+) *Cell {
+
+	cell := Cell{
+		ID:                  signalID,
+		Wavelength:          wavelength,
+		RangeDelta:          rangeDelta,
+		PhaseRangeDelta:     phaseRangeDelta,
+		LockTimeIndicator:   lockTimeIndicator,
+		HalfCycleAmbiguity:  halfCycleAmbiguity,
+		CarrierToNoiseRatio: cnr,
+		Satellite:           satelliteCell,
+		LogLevel:            logLevel,
+	}
+
+	return &cell
+}
+
+// String returns a readable version of a signal cell.
+func (cell *Cell) String() string {
+
+	var satID string
+	if cell.Satellite == nil {
+		satID = "<nil>"
+	} else {
+		satID = fmt.Sprintf("%2d", cell.Satellite.ID)
+	}
+
+	var rangeM string
+	if cell.Satellite == nil || cell.Satellite.RangeWholeMillis == utils.InvalidRange {
+		rangeM = "invalid"
+	} else {
+		// Convert the delta to float and divide by two to the power 29 to restore
+		// the scale.  That gives the delta in milliseconds.
+		rangeDeltaInMillis := float64(cell.RangeDelta) / float64(utils.TwoToThePower29)
+
+		rangeDeltaInMetres := rangeDeltaInMillis * utils.OneLightMillisecond
+
+		rangeM = fmt.Sprintf("(%d, %.3f, %.3f)",
+			cell.RangeDelta, rangeDeltaInMetres, cell.RangeInMetres())
+	}
+
+	var phaseRange string
+	switch {
+	case cell.Satellite == nil || cell.Satellite.RangeWholeMillis == utils.InvalidRange:
+		phaseRange = "invalid"
+	case cell.Wavelength == 0:
+		// The calculation involves dividing by the frequency
+		// so that must be non-zero.
+		phaseRange = "no wavelength"
+	default:
+		phaseRange = fmt.Sprintf("(%d, %.3f)",
+			cell.PhaseRangeDelta, cell.PhaseRange())
+	}
+
+	return fmt.Sprintf("%s %2d {%s, %s, %d, %v, %d, %.3f}",
+		satID, cell.ID, rangeM, phaseRange,
+		cell.LockTimeIndicator, cell.HalfCycleAmbiguity,
+		cell.CarrierToNoiseRatio, cell.Wavelength)
+}
+
+// GetAggregateRange takes the range values from an MSM6 signal cell (including some
+// copied from the satellite cell) and returns the range as a 37-bit scaled unsigned
+// integer with 8 bits whole part and 29 bits fractional part.  This is the transit time
+// of the signal in milliseconds.  If the approximate range value in the satellite cell
+// is invalid, the result is 0.  If the delta in the signal cell is invalid, the result
+// is the approximate range.
+func (cell *Cell) GetAggregateRange() uint64 {
+
+	if cell.Satellite == nil {
+		return 0
+	}
+
+	if cell.Satellite.RangeWholeMillis == utils.InvalidRange {
+		return 0
+	}
+
+	if cell.RangeDelta == InvalidRangeDelta {
+		// The range is valid but the delta is not.
+		return utils.GetScaledRange(cell.Satellite.RangeWholeMillis,
+			cell.Satellite.RangeFractionalMillis, 0)
+	}
+
+	// The delta value is valid.
+	return utils.GetScaledRange(cell.Satellite.RangeWholeMillis,
+		cell.Satellite.RangeFractionalMillis, cell.RangeDelta)
+}
+
+// GetAggregatePhaseRange takes the phase range values from the satellite and signal
+// cells, aggregates them and returns them as a 41-bit scaled unsigned integer, 8 bits
+// whole part and 33 bits fractional part.
+func (cell *Cell) GetAggregatePhaseRange() uint64 {
+
+	if cell.Satellite == nil {
+		return 0
+	}
+
+	if cell.Satellite.RangeWholeMillis == utils.InvalidRange {
+		return 0
+	}
+
+	var delta int
+
+	if cell.PhaseRangeDelta != InvalidPhaseRangeDelta {
+		// The range and the delta are valid.  Use both.
+		delta = cell.PhaseRangeDelta
+	}
+
+	return utils.GetScaledPhaseRange(
+		cell.Satellite.RangeWholeMillis,
+		cell.Satellite.RangeFractionalMillis,
+		delta,
+	)
+}
+
+// RangeInMetres gives the distance from the satellite to the GPS device derived from
+// the values in the satellite and signal cell, converted to metres.
+func (cell *Cell) RangeInMetres() float64 {
+
+	// Get the range as a 37-bit scaled integer, 8 bits whole, 29 bits fractional
+	// representing the transit time in milliseconds.
+	scaledRange := cell.GetAggregateRange()
+
+	// Convert to float and divide by two to the power 29 to restore the scale.
+	rangeInMillis := float64(scaledRange) / float64(utils.TwoToThePower29)
+
+	// Use the speed of light to convert that to the distance from the
+	// satellite to the receiver.
+	return rangeInMillis * utils.OneLightMillisecond
+}
+
+// PhaseRange combines the range and the phase range from an MSM6
+// message and returns the result in cycles.  It returns zero if the input
+// measurements are invalid.
+func (cell *Cell) PhaseRange() float64 {
+
+	aggregatePhaseRange := cell.GetAggregatePhaseRange()
+
+	// Restore the scale of the aggregate value.
+	phaseRangeMilliSeconds := utils.GetPhaseRangeMilliseconds(aggregatePhaseRange)
+
+	// Convert to light milliseconds
+	phaseRangeLMS := utils.GetPhaseRangeLightMilliseconds(phaseRangeMilliSeconds)
+
+	// and divide by the wavelength to get cycles.
+	return phaseRangeLMS / cell.Wavelength
+}
+
+// CNR returns the carrier to noise ratio in dB-Hz.  In an MSM6 the ratio is
+// an extended resolution value scaled up by 16.  Zero means that the value
+// is not available.
+func (cell *Cell) CNR() float64 {
+	return float64(cell.CarrierToNoiseRatio) / 16
+}
+
+// SNRFlag returns the RINEX signal strength flag (1-9, or 0 if unknown)
+// derived from the carrier to noise ratio.
+func (cell *Cell) SNRFlag() uint {
+	return utils.RinexSNRFlag(cell.CNR())
+}
+
+// GetSignalCells gets the data from the signal cells of an MSM6 message.
+func GetSignalCells(
+	bitStream []byte,
+	startOfSignalCells uint,
+	header *msmHeader.Header,
+	satCells []satellite.Cell,
+	logLevel slog.Level,
+) ([][]Cell, error) {
+	// The signal data is laid out as in an MSM7 - all of the range deltas, then
+	// all of the phase range deltas and so on - but there are no phase range rate
+	// deltas.  See the type_msm7 signal package for the details.
+
+	// The frame contain the 24-bit leader, the embedded message and the 24-bit CRC.
+	// startOfSignalCells is the number of bits of the FRAME consumed so far.
+	bitsLeftInFrame := uint(len(bitStream)*8 - int(startOfSignalCells))
+	bitsLeftInMessage := bitsLeftInFrame - utils.CRCLengthBits
+
+	// Pos is the position within the bitstream.
+	pos := startOfSignalCells
+
+	numSignalCells, warning := utils.CheckNumberOfSignalCells(
+		bitStream, pos, bitsPerCell, header.NumSignalCells, header.MultipleMessage)
+	header.Warning = warning
+
+	if header.MultipleMessage {
+		// The message doesn't contain all the signal cells but there should be
+		// at least one.
+		if bitsLeftInMessage < bitsPerCell {
+			message := fmt.Sprintf("overrun - want at least one %d-bit signal cell when multiple message flag is set, got only %d bits left",
+				bitsPerCell, bitsLeftInMessage)
+			return nil, errors.New(message)
+		}
+	} else {
+		// This message should contain all the signal cells.  Check that
+		// there are the expected number.
+		if numSignalCells < header.NumSignalCells {
+			message := fmt.Sprintf("overrun - want %d MSM6 signals, got %d",
+				header.NumSignalCells, numSignalCells)
+			return nil, errors.New(message)
+		}
+	}
+
+	// Get the range deltas.
+	rangeDelta := make([]int, 0)
+	for i := 0; i < numSignalCells; i++ {
+		rd := int(utils.GetBitsAsInt64(bitStream, pos, lenRangeDelta))
+		pos += lenRangeDelta
+		rangeDelta = append(rangeDelta, rd)
+	}
+
+	// Get the phase range deltas.
+	phaseRangeDelta := make([]int, 0)
+	for i := 0; i < numSignalCells; i++ {
+		prd := int(utils.GetBitsAsInt64(bitStream, pos, lenPhaseRangeDelta))
+		pos += lenPhaseRangeDelta
+		phaseRangeDelta = append(phaseRangeDelta, prd)
+	}
+
+	// Get the lock time indicators.
+	lockTimeIndicator := make([]uint, 0)
+	for i := 0; i < numSignalCells; i++ {
+		lti := uint(utils.GetBitsAsUint64(bitStream, pos, lenLockTimeIndicator))
+		pos += lenLockTimeIndicator
+		lockTimeIndicator = append(lockTimeIndicator, lti)
+	}
+
+	// Get the half-cycle ambiguity indicator bits.
+	halfCycleAmbiguity := make([]bool, 0)
+	for i := 0; i < numSignalCells; i++ {
+		hca := (utils.GetBitsAsUint64(bitStream, pos, lenHalfCycleAmbiguity) == 1)
+		pos += lenHalfCycleAmbiguity
+		halfCycleAmbiguity = append(halfCycleAmbiguity, hca)
+	}
+
+	// Get the CNRs.
+	cnr := make([]uint, 0)
+	for i := 0; i < numSignalCells; i++ {
+		c := uint(utils.GetBitsAsUint64(bitStream, pos, lenCNR))
+		pos += lenCNR
+		cnr = append(cnr, c)
+	}
+
+	// Create and return a slice of slices of signal cells, one outer slice per
+	// satellite and one inner slice per observed signal, as for an MSM7.
+
+	signalCells := make([][]Cell, len(header.Satellites))
+
+	// c is the index into the slices of signal fields captured above.
+	c := 0
+
+	for i := range header.Cells {
+		signalCells[i] = make([]Cell, 0)
+		for j := range header.Cells[i] {
+			// Beware!  We are cranking through the 1 bits in the cell mask and if
+			// the multiple message flag is set, not all those cells are there.
+			if c < numSignalCells {
+				if header.Cells[i][j] {
+
+					signalID := header.Signals[j]
+
+					wavelength := utils.GetSignalWavelength(header.Constellation, signalID)
+
+					cell := New(
+						signalID,
+						&(satCells[i]),
+						rangeDelta[c],
+						phaseRangeDelta[c],
+						lockTimeIndicator[c],
+						halfCycleAmbiguity[c],
+						cnr[c],
+						wavelength,
+						logLevel,
+					)
+
+					signalCells[i] = append(signalCells[i], *cell)
+
+					// Prepare to process the next set of signal fields.
+					c++
+				}
+			}
+		}
+	}
+
+	return signalCells, nil
+}
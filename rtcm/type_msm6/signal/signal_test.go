@@ -0,0 +1,49 @@
+package signal
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/type_msm4/satellite"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestGetAggregateRange checks that GetAggregateRange handles the 20-bit range
+// delta and the invalid values.
+func TestGetAggregateRange(t *testing.T) {
+
+	sat := satellite.New(11, 72, 512, slog.LevelDebug)
+	invalidSat := satellite.New(11, utils.InvalidRange, 512, slog.LevelDebug)
+
+	// The rough range is 72.5 ms scaled up by two to the power 29.
+	const roughRange = 72<<29 + 1<<28
+
+	var testData = []struct {
+		description string
+		cell        *Cell
+		want        uint64
+	}{
+		{"valid", New(2, sat, 39488, 0, 0, false, 0, 0.19, slog.LevelDebug), roughRange + 39488},
+		{"negative", New(2, sat, -75040, 0, 0, false, 0, 0.19, slog.LevelDebug), roughRange - 75040},
+		{"invalid delta", New(2, sat, InvalidRangeDelta, 0, 0, false, 0, 0.19, slog.LevelDebug), roughRange},
+		{"invalid range", New(2, invalidSat, 39488, 0, 0, false, 0, 0.19, slog.LevelDebug), 0},
+		{"no satellite", New(2, nil, 39488, 0, 0, false, 0, 0.19, slog.LevelDebug), 0},
+	}
+
+	for _, td := range testData {
+		got := td.cell.GetAggregateRange()
+		if td.want != got {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+	}
+}
+
+// TestCNR checks that the carrier to noise ratio is scaled from units of
+// 1/16 dB-Hz.
+func TestCNR(t *testing.T) {
+	cell := New(2, nil, 0, 0, 0, false, 721, 0.19, slog.LevelDebug)
+
+	if cell.CNR() != 45.0625 {
+		t.Errorf("want 45.0625 got %f", cell.CNR())
+	}
+}
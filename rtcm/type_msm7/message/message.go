@@ -109,6 +109,31 @@ func (message *Message) DisplaySignalCells() string {
 	return heading + body
 }
 
+// Frame returns the message as a complete RTCM3 message frame, with the
+// leader and the CRC, ready to be sent.  It's the reverse of GetMessage.
+// The satellite and signal cells must agree with the masks in the header.
+func (message *Message) Frame() []byte {
+	numSignalCells := 0
+	for i := range message.Signals {
+		numSignalCells += len(message.Signals[i])
+	}
+
+	lenMessageInBits := message.Header.LengthInBits() +
+		uint(len(message.Satellites)*satellite.CellLengthInBits) +
+		uint(numSignalCells)*signal.CellLengthInBits
+
+	frame := utils.NewFrame(lenMessageInBits)
+
+	var pos uint = utils.LeaderLengthBits
+	pos = message.Header.SetBits(frame, pos)
+	pos = satellite.SetSatelliteCells(frame, pos, message.Satellites)
+	signal.SetSignalCells(frame, pos, message.Signals)
+
+	utils.SetCRC(frame)
+
+	return frame
+}
+
 // GetMSM7Message presents an MSM7 (type 1077, 1087 etc) as broken out fields.
 func GetMessage(bitStream []byte, logLevel slog.Level) (*Message, error) {
 
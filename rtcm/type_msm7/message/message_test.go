@@ -1,6 +1,8 @@
 package message
 
 import (
+	"bytes"
+	"encoding/hex"
 	"log/slog"
 	"testing"
 
@@ -248,3 +250,32 @@ func TestGlonassBugFix(t *testing.T) {
 
 	_ = s
 }
+
+// TestFrame checks that Frame reproduces a real message frame that's been
+// decoded, and that the result decodes to the same message.  The original
+// is padded with null bytes, which Frame doesn't reproduce.
+func TestFrame(t *testing.T) {
+	want, err := GetMessage(testdata.MessageFrame1077, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := want.Frame()
+
+	// Compare the embedded messages, ignoring the padding.
+	lenMessage := len(frame) - utils.LeaderLengthBytes - utils.CRCLengthBytes
+	wantMessage := testdata.MessageFrame1077[utils.LeaderLengthBytes : utils.LeaderLengthBytes+lenMessage]
+	gotMessage := frame[utils.LeaderLengthBytes : utils.LeaderLengthBytes+lenMessage]
+	if !bytes.Equal(wantMessage, gotMessage) {
+		t.Errorf("want\n%s\ngot\n%s", hex.Dump(wantMessage), hex.Dump(gotMessage))
+	}
+
+	got, err := GetMessage(frame, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want.String() != got.String() {
+		t.Error(diff.Diff(want.String(), got.String()))
+	}
+}
@@ -209,3 +209,24 @@ func GetSatelliteCells(
 
 	return satData, nil
 }
+
+// SetSatelliteCells writes the satellite cells into an MSM7 message frame,
+// starting at bit position pos, and returns the position after them, which
+// is the start of the signal cells.  It's the reverse of GetSatelliteCells.
+func SetSatelliteCells(frame []byte, pos uint, cells []Cell) uint {
+	// The values are laid out field by field, not cell by cell.
+	for i := range cells {
+		pos = utils.SetBits(frame, pos, lenWholeMillis, uint64(cells[i].RangeWholeMillis))
+	}
+	for i := range cells {
+		pos = utils.SetBits(frame, pos, lenExtendedInfo, uint64(cells[i].ExtendedInfo))
+	}
+	for i := range cells {
+		pos = utils.SetBits(frame, pos, lenFractionalMillis, uint64(cells[i].RangeFractionalMillis))
+	}
+	for i := range cells {
+		pos = utils.SetBits(frame, pos, lenPhaseRangeRate, uint64(cells[i].PhaseRangeRate))
+	}
+
+	return pos
+}
@@ -25,6 +25,9 @@ const lenPhaseRangeRateDelta uint = 15
 const bitsPerCell = lenRangeDelta + lenPhaseRangeDelta +
 	lenLockTimeIndicator + lenHalfCycleAmbiguity + lenCNR + lenPhaseRangeRateDelta
 
+// CellLengthInBits is the number of bits in each signal cell.
+const CellLengthInBits = bitsPerCell
+
 // InvalidRangeDelta is the invalid value for the range delta in an MSM7
 // signal cell. 20 bit two's complement 1000 0000 0000 0000 0000
 const InvalidRangeDelta = -524288
@@ -43,6 +46,20 @@ const InvalidPhaseRangeRateDelta = -16384
 
 // Cell holds the data from a Multiple Signal Message type 7 for one signal
 // from one satellite, plus values copied from the satellite cell.
+// CNR returns the carrier to noise ratio in dB-Hz, which is the value of
+// the S observation in a RINEX file.  In an MSM7 the ratio is an extended
+// resolution value scaled up by 16.  Zero means that the value is not
+// available.
+func (cell *Cell) CNR() float64 {
+	return float64(cell.CarrierToNoiseRatio) / 16
+}
+
+// SNRFlag returns the RINEX signal strength flag (1-9, or 0 if unknown)
+// derived from the carrier to noise ratio.
+func (cell *Cell) SNRFlag() uint {
+	return utils.RinexSNRFlag(cell.CNR())
+}
+
 // RangeInMetres gives the distance from the satellite to the GPS device derived from
 // the values in the satellite and signal cell, converted to metres.
 type Cell struct {
@@ -389,6 +406,39 @@ func (cell *Cell) GetAggregatePhaseRangeRate() int64 {
 	return utils.GetScaledPhaseRangeRate(cell.Satellite.PhaseRangeRate, delta)
 }
 
+// SetSignalCells writes the signal cells into an MSM7 message frame, starting
+// at bit position pos, and returns the position after them.  It's the
+// reverse of GetSignalCells.  The cells are given as a slice of slices, one
+// per satellite, and must agree with the cell mask in the header.
+func SetSignalCells(frame []byte, pos uint, cells [][]Cell) uint {
+	// The values are laid out field by field, not cell by cell.
+	all := make([]Cell, 0)
+	for i := range cells {
+		all = append(all, cells[i]...)
+	}
+
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenRangeDelta, uint64(all[i].RangeDelta))
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenPhaseRangeDelta, uint64(all[i].PhaseRangeDelta))
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenLockTimeIndicator, uint64(all[i].LockTimeIndicator))
+	}
+	for i := range all {
+		pos = utils.SetFlag(frame, pos, all[i].HalfCycleAmbiguity)
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenCNR, uint64(all[i].CarrierToNoiseRatio))
+	}
+	for i := range all {
+		pos = utils.SetBits(frame, pos, lenPhaseRangeRateDelta, uint64(all[i].PhaseRangeRateDelta))
+	}
+
+	return pos
+}
+
 // GetSignalCells gets the data from the signal cells of an MSM7 message.
 func GetSignalCells(
 	bitStream []byte,
@@ -417,9 +467,13 @@ func GetSignalCells(
 	bitsInStream := uint(len(bitStream) * 8)
 	bitsLeft := bitsInStream - pos
 
-	// Find the number of signal cells, ignoring any padding.
+	// Find the number of signal cells, ignoring any padding.  If that disagrees
+	// with the cell mask, decode the number of cells that the mask gives, if
+	// possible, so that one malformed message doesn't misalign all the fields.
 
-	numSignalCells := utils.GetNumberOfSignalCells(bitStream, pos, bitsPerCell)
+	numSignalCells, warning := utils.CheckNumberOfSignalCells(
+		bitStream, pos, bitsPerCell, header.NumSignalCells, header.MultipleMessage)
+	header.Warning = warning
 
 	if header.MultipleMessage {
 		// The message doesn't contain all the signal cells but there should be
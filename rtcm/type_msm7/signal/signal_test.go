@@ -826,6 +826,55 @@ func TestGetSignalCells(t *testing.T) {
 	}
 }
 
+// TestGetSignalCellsWithJunkAfterSignals checks that GetSignalCells ignores
+// non-zero data after the number of signal cells given by the cell mask and
+// sets a warning in the header.
+func TestGetSignalCellsWithJunkAfterSignals(t *testing.T) {
+	satellites := []uint{42, 43}
+	signals := []uint{5, 7}
+	cellMask := [][]bool{{true, true}, {true, false}}
+	satData := []satellite.Cell{{ID: 42}, {ID: 43}}
+
+	// Three signal cells, as in TestGetSignalCells.
+	bitStream := []byte{
+		0x00, 0x00, 0x0f, 0xff, 0xff, 0x40,
+		0x00, 0x1f, 0xff, 0xff, 0xf0, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x5f, 0xfc,
+		0x00, 0x00, 0x58, 0x01, 0xff, 0x81,
+		0x5f, 0xff, 0xc0, 0x00, 0x00, 0x0d,
+	}
+	// The same followed by 80 bits of junk, which looks like a fourth cell.
+	junk := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	bitStreamWithJunk := append(append([]byte{}, bitStream...), junk...)
+
+	const wantWarning = "the cell mask gives 3 signal cells but the message contains 4 - ignoring the extra 1"
+
+	cleanHeader := header.Header{MessageType: 1077, NumSignalCells: 3,
+		Satellites: satellites, Signals: signals, Cells: cellMask}
+	want, wantError := GetSignalCells(bitStream, 0, &cleanHeader, satData, slog.LevelInfo)
+	if wantError != nil {
+		t.Fatal(wantError)
+	}
+	if len(cleanHeader.Warning) > 0 {
+		t.Errorf("want no warning, got %s", cleanHeader.Warning)
+	}
+
+	junkHeader := header.Header{MessageType: 1077, NumSignalCells: 3,
+		Satellites: satellites, Signals: signals, Cells: cellMask}
+	got, err := GetSignalCells(bitStreamWithJunk, 0, &junkHeader, satData, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if junkHeader.Warning != wantWarning {
+		t.Errorf("want warning %s got %s", wantWarning, junkHeader.Warning)
+	}
+
+	if !cmp.Equal(want, got) {
+		t.Errorf("the junk was not ignored:\n%s", cmp.Diff(want, got))
+	}
+}
+
 // TestGetSignalCellsWithShortBitStream checks that getSignalCells produces
 // the correct error message if the bitstream is too short.
 func TestGetSignalCellsWithShortBitStream(t *testing.T) {
@@ -1053,3 +1102,31 @@ func TestEqual(t *testing.T) {
 		}
 	}
 }
+
+// TestCNR checks the conversion of the carrier to noise ratio, which is in
+// sixteenths of a dB-Hz, and the RINEX signal strength flag derived from it.
+func TestCNR(t *testing.T) {
+	var testData = []struct {
+		cnr      uint
+		want     float64
+		wantFlag uint
+	}{
+		{0, 0, 0},
+		{1, 0.0625, 1},
+		{720, 45, 7},
+		{1023, 63.9375, 9},
+	}
+	for _, td := range testData {
+		cell := Cell{CarrierToNoiseRatio: td.cnr}
+
+		got := cell.CNR()
+		if got != td.want {
+			t.Errorf("%d: want %f got %f", td.cnr, td.want, got)
+		}
+
+		gotFlag := cell.SNRFlag()
+		if gotFlag != td.wantFlag {
+			t.Errorf("%d: want flag %d got %d", td.cnr, td.wantFlag, gotFlag)
+		}
+	}
+}
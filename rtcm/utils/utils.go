@@ -8,7 +8,8 @@ import (
 	"math"
 	"time"
 
-	"github.com/goblimey/go-tools/dailylogger"
+	"github.com/goblimey/go-ntrip/logrotate"
+	"github.com/goblimey/go-ntrip/rtcm/crc24q"
 )
 
 // StartOfMessageFrame is the value of the byte that starts an RTCM3 message frame.
@@ -28,10 +29,24 @@ const NonRTCMMessage = -1
 // of processes that would normally run indefinitely.
 const MessageTypeStop = -2
 
+// NMEAMessage indicates a Message that contains an NMEA sentence found in
+// the non-RTCM data between two RTCM3 messages.  The handler only produces
+// these if it's asked to parse NMEA - see Handler.SetNMEAParsing.
+const NMEAMessage = -3
+
 // RTCM3 Message types.
 const MessageType1005 = 1005 // Base position.
 const MessageType1006 = 1006 // Base position and height.
+const MessageType1013 = 1013 // System parameters.
+const MessageType1019 = 1019 // GPS ephemeris.
+const MessageType1020 = 1020 // Glonass ephemeris.
+const MessageType1029 = 1029 // Unicode text string.
+const MessageType1042 = 1042 // Beidou ephemeris.
+const MessageType1044 = 1044 // QZSS ephemeris.
+const MessageType1045 = 1045 // Galileo F/NAV ephemeris.
+const MessageType1046 = 1046 // Galileo I/NAV ephemeris.
 const MessageTypeGCPB = 1230 // Glonass code/phase bias.
+const MessageType4072 = 4072 // u-blox proprietary.
 const MessageTypeMSM4GPS = 1074
 const MessageTypeMSM7GPS = 1077
 const MessageTypeMSM4Glonass = 1084
@@ -48,7 +63,12 @@ const MessageTypeMSM4NavicIrnss = 1134
 const MessageTypeMSM7NavicIrnss = 1137
 
 // These are used to identify MSM messages - values are filled in by init.
+var MSM1MessageTypes map[int]interface{}
+var MSM2MessageTypes map[int]interface{}
+var MSM3MessageTypes map[int]interface{}
 var MSM4MessageTypes map[int]interface{}
+var MSM5MessageTypes map[int]interface{}
+var MSM6MessageTypes map[int]interface{}
 var MSM7MessageTypes map[int]interface{}
 
 // Scale factors.
@@ -88,19 +108,27 @@ const MaxTimestamp = (7 * 24 * 3600 * 1000) - 1
 // ((24 hours worth of milliseconds) - 1)
 const MaxTimestampGlonass = (6 << 27) + ((24 * 3600 * 1000) - 1)
 
-// GPSLeapSeconds is the duration that GPS time is ahead of UTC
-// in seconds, correct from the start of 2017/01/01.  An extra leap
-// second may be added every four years.  The start of 2021 was a
-// candidate for adding another leap second but it was not necessary.
-const GPSLeapSeconds = -18
-
-// GPSTimeOffset is the offset to convert a GPS time to UTC.
-var GPSTimeOffset time.Duration = time.Duration(GPSLeapSeconds) * time.Second
+// The number of leap seconds between GPS time and UTC changes from time to
+// time, so it's not kept here.  The leapseconds package gives the value for
+// a given date, and the time that Beidou time is behind GPS time.
 
 // GlonassTimeOffset is the offset to convert Glonass time to UTC.
 // Glonass keeps Moscow time which is 3 hours ahead of UTC.
 var GlonassTimeOffset = time.Duration(-1*3) * time.Hour
 
+// GPSTimeOrigin is the start of GPS week 0 in UTC.  QZSS, SBAS and NavIC
+// count their weeks from the same point.
+var GPSTimeOrigin = time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC)
+
+// GalileoTimeOrigin is the start of Galileo week 0.  Galileo System Time
+// started at midnight GPS time at the start of 22nd August 1999, which was 13
+// leap seconds before midnight UTC.
+var GalileoTimeOrigin = time.Date(1999, time.August, 21, 23, 59, 47, 0, time.UTC)
+
+// BeidouTimeOrigin is the start of Beidou week 0, midnight UTC at the start
+// of 2006.
+var BeidouTimeOrigin = time.Date(2006, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 // GlonassInvalidDay is the invalid value for the day part of the timestamp.
 const GlonassInvalidDay = 7
 
@@ -110,22 +138,6 @@ const GlonassInvalidDay = 7
 // day.
 const GlonassDayBitMask = 0x38000000 // 0011 1000 0000 0000 0000 0000 0000 0000
 
-// beidouTimeOffset is the offset to convert a BeiDou time value to
-// UTC.  UTC is based on International Atomic Time (TAI):
-// https://www.timeanddate.com/time/international-atomic-time.html.
-//
-// This reference from November 2013 compares Beidout Time (BDT) with
-// TAI: https://www.unoosa.org/pdf/icg/2016/Beidou-Timescale2016.pdf.
-//
-// "BDT is a uniform scale and is 33 seconds behind TAI"
-//
-// HOWEVER the rtklib software (decode_msm_header) says that BDT is
-// 14 seconds ahead of GPS time, which is 18 seconds behind UTC,
-// meaning that BDT is 4 seconds behind UTC.  Analysis of real data
-// confirms that.
-var BeidouLeapSeconds = -4
-var BeidouTimeOffset = time.Duration(BeidouLeapSeconds) * time.Second
-
 // DateLayout defines the layout of dates when they are displayed.  It
 // produces "yyyy-mm-dd hh:mm:ss.ms timeshift timezone", for example
 // "2023-05-12 00:00:05 +0000 UTC"
@@ -255,6 +267,22 @@ func init() {
 	MSM7MessageTypes[MessageTypeMSM7QZSS] = nil
 	MSM7MessageTypes[MessageTypeMSM7Beidou] = nil
 	MSM7MessageTypes[MessageTypeMSM7NavicIrnss] = nil
+
+	// Each constellation has a block of message types for its MSMs, 1071
+	// to 1077 for GPS, 1081 to 1087 for Glonass and so on, so the other
+	// MSM types are at fixed offsets from the MSM4 type.
+	MSM1MessageTypes = make(map[int]interface{})
+	MSM2MessageTypes = make(map[int]interface{})
+	MSM3MessageTypes = make(map[int]interface{})
+	MSM5MessageTypes = make(map[int]interface{})
+	MSM6MessageTypes = make(map[int]interface{})
+	for messageType := range MSM4MessageTypes {
+		MSM1MessageTypes[messageType-3] = nil
+		MSM2MessageTypes[messageType-2] = nil
+		MSM3MessageTypes[messageType-1] = nil
+		MSM5MessageTypes[messageType+1] = nil
+		MSM6MessageTypes[messageType+2] = nil
+	}
 }
 
 // ParseTimestamp returns the number of days and the remaining
@@ -311,18 +339,83 @@ func GetPhaseRangeLightMilliseconds(rangeMilliseconds float64) float64 {
 	return rangeMilliseconds * OneLightMillisecond
 }
 
+func MSM1(messageType int) bool {
+	_, prs := MSM1MessageTypes[messageType]
+	return prs
+}
+
+func MSM2(messageType int) bool {
+	_, prs := MSM2MessageTypes[messageType]
+	return prs
+}
+
+func MSM3(messageType int) bool {
+	_, prs := MSM3MessageTypes[messageType]
+	return prs
+}
+
 func MSM4(messageType int) bool {
 	_, prs := MSM4MessageTypes[messageType]
 	return prs
 }
 
+func MSM5(messageType int) bool {
+	_, prs := MSM5MessageTypes[messageType]
+	return prs
+}
+
+func MSM6(messageType int) bool {
+	_, prs := MSM6MessageTypes[messageType]
+	return prs
+}
+
 func MSM7(messageType int) bool {
 	_, prs := MSM7MessageTypes[messageType]
 	return prs
 }
 
+// MSM123 returns true if the message is one of the compact MSMs, an MSM1,
+// MSM2 or MSM3.  They share a layout, so they are decoded together.
+func MSM123(messageType int) bool {
+	return MSM1(messageType) || MSM2(messageType) || MSM3(messageType)
+}
+
+// MSM returns true if the message is a Multiple Signal Message of any level.
 func MSM(messageType int) bool {
-	return MSM4(messageType) || MSM7(messageType)
+	return MSM123(messageType) || MSM4(messageType) || MSM5(messageType) ||
+		MSM6(messageType) || MSM7(messageType)
+}
+
+// HasStationID returns true if messages of the given type carry a reference
+// station ID.  In those that do it's the 12 bits after the message type.
+// Ephemerides and the like describe the satellites, not the station, so
+// they don't have one.
+func HasStationID(messageType int) bool {
+	switch {
+	case messageType >= 1001 && messageType <= 1013:
+		// Legacy observations, positions, antenna descriptors and system
+		// parameters.
+		return true
+	case messageType == MessageType1029, messageType == 1032,
+		messageType == 1033, messageType == MessageTypeGCPB:
+		return true
+	default:
+		return MSM(messageType)
+	}
+}
+
+// GetStationID returns the reference station ID from a message frame,
+// including the leader.  The second result is false if messages of that type
+// have no station ID or the frame is too short to hold one.
+func GetStationID(messageType int, frame []byte) (uint, bool) {
+	const lenMessageType = 12
+	const lenStationID = 12
+	if !HasStationID(messageType) ||
+		len(frame)*8 < LeaderLengthBits+lenMessageType+lenStationID {
+		return 0, false
+	}
+	stationID := GetBitsAsUint64(frame, LeaderLengthBits+lenMessageType, lenStationID)
+	return uint(stationID), true
 }
 
 // GetScaledRange combines the components of the range from an MSM message and
@@ -504,11 +597,49 @@ func GetNumberOfSignalCells(bitStream []byte, startPosition, bitsPerCell uint) i
 	return len(cells)
 }
 
+// CheckNumberOfSignalCells compares the number of signal cells found in the
+// bit stream by GetNumberOfSignalCells with the number given by the cell mask
+// and returns the number of cells to decode.  Some receivers produce messages
+// where the two disagree.  If the signal data is followed by more non-zero
+// cells than the cell mask allows, the extra ones are ignored.  If the last
+// cells are all zero but the bit stream is long enough to hold the number
+// given by the cell mask, that number is used.  In either case the returned
+// warning says what was done.  Otherwise the warning is empty.  If the bit
+// stream is too short, the count found is returned and the caller should
+// treat the message as an overrun.
+func CheckNumberOfSignalCells(bitStream []byte, startPosition, bitsPerCell uint, numCellsInMask int, multipleMessage bool) (int, string) {
+
+	found := GetNumberOfSignalCells(bitStream, startPosition, bitsPerCell)
+
+	if found > numCellsInMask {
+		warning := fmt.Sprintf("the cell mask gives %d signal cells but the message contains %d - ignoring the extra %d",
+			numCellsInMask, found, found-numCellsInMask)
+		return numCellsInMask, warning
+	}
+
+	if found < numCellsInMask && !multipleMessage {
+		bitsLeft := len(bitStream)*8 - int(startPosition)
+		if bitsLeft >= numCellsInMask*int(bitsPerCell) {
+			warning := fmt.Sprintf("the cell mask gives %d signal cells but only %d contain data - assuming the last %d are zero",
+				numCellsInMask, found, numCellsInMask-found)
+			return numCellsInMask, warning
+		}
+	}
+
+	return found, ""
+}
+
 // GetConstellation returns the constellation given a message type.
 func GetConstellation(messageType int) string {
 
 	var constellation string
 
+	if MSM(messageType) {
+		// All the MSMs of a constellation are in the same block of ten
+		// message types, so find the MSM4 type in the block.
+		messageType = messageType - messageType%10 + 4
+	}
+
 	switch messageType {
 	case MessageTypeMSM4GPS:
 		constellation = "GPS"
@@ -524,20 +655,6 @@ func GetConstellation(messageType int) string {
 		constellation = "Beidou"
 	case MessageTypeMSM4NavicIrnss:
 		constellation = "NavIC/IRNSS"
-	case MessageTypeMSM7GPS:
-		constellation = "GPS"
-	case MessageTypeMSM7Glonass:
-		constellation = "Glonass"
-	case MessageTypeMSM7Galileo:
-		constellation = "Galileo"
-	case MessageTypeMSM7SBAS:
-		constellation = "SBAS"
-	case MessageTypeMSM7QZSS:
-		constellation = "QZSS"
-	case MessageTypeMSM7Beidou:
-		constellation = "Beidou"
-	case MessageTypeMSM7NavicIrnss:
-		constellation = "NavIC/IRNSS"
 
 	default:
 		constellation = "unknown constellation"
@@ -563,6 +680,9 @@ func GetTitleAndComment(messageType int) *TitleAndComment {
 			Title:   "Non-RTCM data",
 			Comment: "Data which is not in RTCM3 format, for example NMEA messages.",
 		},
+		NMEAMessage: {
+			Title: "NMEA sentence",
+		},
 		1001: {"L1-Only GPS RTK Observables",
 			"This GPS message type is not generally used or supported; type 1004 is to be preferred."},
 		1002: {"Extended L1-Only GPS RTK Observables",
@@ -1137,6 +1257,71 @@ func GetBitsAsInt64(buff []byte, pos uint, len uint) int64 {
 	return int64(uval)
 }
 
+// GetBitsAsSignMagnitudeInt64 extracts len bits from a slice of bytes,
+// starting at bit position pos, interprets the bits as a sign-magnitude
+// integer (the top bit is the sign and the rest is the magnitude) and returns
+// the result as a 64-bit signed int.  The Glonass ephemeris uses this form.
+// See RTKLIB's getbitg() function.
+func GetBitsAsSignMagnitudeInt64(buff []byte, pos uint, len uint) int64 {
+	negative := GetBitsAsUint64(buff, pos, 1) == 1
+	magnitude := int64(GetBitsAsUint64(buff, pos+1, len-1))
+	if negative {
+		return -magnitude
+	}
+	return magnitude
+}
+
+// SetBits writes the bottom len bits of the value into the buffer, starting
+// at bit position pos, and returns the position after them.  It's the
+// reverse of GetBitsAsUint64.  A signed value converted with uint64() is
+// written in twos-complement form, the reverse of GetBitsAsInt64.  See
+// RTKLIB's setbitu() and setbits() functions.
+func SetBits(buff []byte, pos uint, len uint, value uint64) uint {
+	for i := uint(0); i < len; i++ {
+		bit := byte(value>>(len-1-i)) & 1
+		p := pos + i
+		buff[p/8] |= bit << (7 - p%8)
+	}
+	return pos + len
+}
+
+// SetFlag writes a one-bit flag into the buffer at bit position pos and
+// returns the position after it.
+func SetFlag(buff []byte, pos uint, flag bool) uint {
+	if flag {
+		return SetBits(buff, pos, 1, 1)
+	}
+	return pos + 1
+}
+
+// NewFrame returns a zeroed RTCM3 message frame big enough for an embedded
+// message of the given number of bits, padded to a whole number of bytes.
+// The leader is filled in.  The embedded message starts at bit position
+// LeaderLengthBits.  Once it's been written, SetCRC finishes the frame.
+func NewFrame(lenMessageInBits uint) []byte {
+	lenMessageInBytes := (lenMessageInBits + 7) / 8
+
+	frame := make([]byte, LeaderLengthBytes+int(lenMessageInBytes)+CRCLengthBytes)
+
+	// The leader is the start of frame byte, six reserved bits and the
+	// 10-bit message length.
+	frame[0] = StartOfMessageFrame
+	frame[1] = byte(lenMessageInBytes >> 8)
+	frame[2] = byte(lenMessageInBytes)
+
+	return frame
+}
+
+// SetCRC calculates the Cyclic Redundancy Check of a message frame made by
+// NewFrame and writes it into the last three bytes.
+func SetCRC(frame []byte) {
+	startOfCRC := len(frame) - CRCLengthBytes
+	crc := crc24q.Checksum(frame[:startOfCRC])
+	frame[startOfCRC] = crc24q.HiByte(crc)
+	frame[startOfCRC+1] = crc24q.MiByte(crc)
+	frame[startOfCRC+2] = crc24q.LoByte(crc)
+}
+
 // getScaledValue is a helper for functions such as getScaledRange.
 func getScaledValue(v1, shift1, v2, shift2 uint, delta int) uint64 {
 	scaledApprox := (uint64(v1) << shift1) | (uint64(v2) << shift2)
@@ -1179,12 +1364,36 @@ func EqualWithin(precision uint, f1, f2 float64) bool {
 	return math.Abs(f1-f2) <= 0.1
 }
 
+// RoundToMultiple rounds the value to the nearest multiple of the step, which
+// must be positive.  Halves are rounded away from zero.
+func RoundToMultiple(value, step int64) int64 {
+	return int64(math.Round(float64(value)/float64(step))) * step
+}
+
+// RinexSNRFlag maps a carrier to noise ratio in dB-Hz to the signal strength
+// flag used in RINEX observation files: 1 for less than 12 dB-Hz, 2 for 12-17
+// and so on in steps of 6 dB-Hz up to 9 for 54 dB-Hz or more.  A ratio of
+// zero means that the receiver didn't give one, which is flag 0 (unknown).
+func RinexSNRFlag(cnr float64) uint {
+	if cnr <= 0 {
+		return 0
+	}
+	flag := uint(cnr / 6)
+	if flag < 1 {
+		return 1
+	}
+	if flag > 9 {
+		return 9
+	}
+	return flag
+}
+
 // GetDailyLogger gets a daily log file which can be written to as a logger
 // (each line decorated with filename, date, time, etc).  The name argument
 // is used to form the log file name.
 func GetDailyLogger(leader string) *log.Logger {
 	name := leader + "."
-	dailyLog := dailylogger.New("logs", name, ".log")
+	dailyLog := logrotate.New("logs", name, ".log")
 	logFlags := log.LstdFlags | log.Lshortfile | log.Lmicroseconds
 	return log.New(dailyLog, leader, logFlags)
 }
@@ -847,6 +847,33 @@ func TestGetBitsAsInt64(t *testing.T) {
 	}
 }
 
+// TestGetBitsAsSignMagnitudeInt64 checks the extraction of sign-magnitude
+// integers.
+func TestGetBitsAsSignMagnitudeInt64(t *testing.T) {
+	var bitStream = []byte{0x00, 0xaa, 0x85, 0xff, 0x80, 0x00}
+	var testData = []struct {
+		position uint
+		length   uint
+		want     int64
+	}{
+		{0, 8, 0},
+		{8, 8, -42},
+		{9, 7, 42},
+		{16, 8, -5},
+		{24, 8, -127},
+		{25, 7, -63},
+		{32, 16, 0}, // minus zero.
+	}
+
+	for _, td := range testData {
+		got := GetBitsAsSignMagnitudeInt64(bitStream, td.position, td.length)
+		if td.want != got {
+			t.Errorf("%d %d want %d got %d",
+				td.position, td.length, td.want, got)
+		}
+	}
+}
+
 func TestGetNumberOfSignalCells(t *testing.T) {
 	// The bit stream starts at byte 6 and contains three signal cells - three
 	// 20-bit signed range deltas, followed by three 24-bit signed phase range
@@ -900,6 +927,62 @@ func TestGetNumberOfSignalCells(t *testing.T) {
 	}
 }
 
+// TestCheckNumberOfSignalCells checks that CheckNumberOfSignalCells repairs
+// disagreements between the cell mask and the signal data.
+func TestCheckNumberOfSignalCells(t *testing.T) {
+	// The bit stream starts at byte 6 and contains three 80-bit MSM7 signal
+	// cells (see TestGetNumberOfSignalCells) followed by 240 bits of padding.
+	bitStream := []byte{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06,
+		// Start of message:
+		0x00, 0x00, 0x0f, 0xff, 0xff, 0x40,
+		0x00, 0x1f, 0xff, 0xff, 0xf0, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x5f, 0xfc,
+		0x00, 0x00, 0x58, 0x01, 0xff, 0x81,
+		0x5f, 0xff, 0xc0, 0x00, 0x00, 0x0d,
+		// Padding
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	const bitsPerMSM7SignalCell = 80
+
+	const startPosition = 48 // Byte 6.
+
+	var testData = []struct {
+		description     string
+		numCellsInMask  int
+		multipleMessage bool
+		want            int
+		wantWarning     string
+	}{
+		{"agree", 3, false, 3, ""},
+		{"too many", 2, false, 2,
+			"the cell mask gives 2 signal cells but the message contains 3 - ignoring the extra 1"},
+		{"too many multiple", 2, true, 2,
+			"the cell mask gives 2 signal cells but the message contains 3 - ignoring the extra 1"},
+		{"zero cells", 5, false, 5,
+			"the cell mask gives 5 signal cells but only 3 contain data - assuming the last 2 are zero"},
+		{"overrun", 7, false, 3, ""},
+		{"multiple", 5, true, 3, ""},
+	}
+	for _, td := range testData {
+		got, gotWarning := CheckNumberOfSignalCells(
+			bitStream, startPosition, bitsPerMSM7SignalCell, td.numCellsInMask, td.multipleMessage)
+
+		if td.want != got {
+			t.Errorf("%s: want %d got %d", td.description, td.want, got)
+		}
+
+		if td.wantWarning != gotWarning {
+			t.Errorf("%s: want warning %q got %q", td.description, td.wantWarning, gotWarning)
+		}
+	}
+}
+
 func TestSlicesEqual(t *testing.T) {
 	empty1 := make([]uint, 0)
 	empty2 := make([]uint, 0)
@@ -962,6 +1045,39 @@ func TestMSM4(t *testing.T) {
 	}
 }
 
+// TestMSMLevels checks the MSM1, MSM2, MSM3, MSM5 and MSM6 functions and
+// MSM123.
+func TestMSMLevels(t *testing.T) {
+	var testData = []struct {
+		messageType int
+		want        [5]bool // MSM1, MSM2, MSM3, MSM5, MSM6
+		wantMSM123  bool
+	}{
+		{NonRTCMMessage, [5]bool{false, false, false, false, false}, false},
+		{1071, [5]bool{true, false, false, false, false}, true},
+		{1082, [5]bool{false, true, false, false, false}, true},
+		{1093, [5]bool{false, false, true, false, false}, true},
+		{1104, [5]bool{false, false, false, false, false}, false},
+		{1115, [5]bool{false, false, false, true, false}, false},
+		{1126, [5]bool{false, false, false, false, true}, false},
+		{1137, [5]bool{false, false, false, false, false}, false},
+		{1141, [5]bool{false, false, false, false, false}, false},
+		{1131, [5]bool{true, false, false, false, false}, true},
+	}
+	for _, td := range testData {
+		got := [5]bool{
+			MSM1(td.messageType), MSM2(td.messageType), MSM3(td.messageType),
+			MSM5(td.messageType), MSM6(td.messageType),
+		}
+		if got != td.want {
+			t.Errorf("%d: want %v, got %v", td.messageType, td.want, got)
+		}
+		if MSM123(td.messageType) != td.wantMSM123 {
+			t.Errorf("%d: want MSM123 %v", td.messageType, td.wantMSM123)
+		}
+	}
+}
+
 // TestMSM7 checks the MSM7 function.
 func TestMSM7(t *testing.T) {
 	var testData = []struct {
@@ -996,19 +1112,27 @@ func TestMSM(t *testing.T) {
 		want        bool
 	}{
 		{NonRTCMMessage, false},
-		{1076, false},
+		{1070, false},
+		{1071, true},
+		{1073, true},
+		{1075, true},
+		{1076, true},
 		{1074, true},
 		{1077, true},
+		{1078, false},
+		{1080, false},
 		{1107, true},
-		{1116, false},
+		{1116, true},
 		{1117, true},
 		{1118, false},
 		{1127, true},
+		{1131, true},
 		{1134, true},
 		{1137, true},
-		{1136, false},
+		{1136, true},
 		{1137, true},
 		{1138, false},
+		{1141, false},
 	}
 	for _, td := range testData {
 		got := MSM(td.messageType)
@@ -1018,6 +1142,47 @@ func TestMSM(t *testing.T) {
 	}
 }
 
+// TestGetStationID checks that GetStationID finds the station ID in the
+// messages that have one.
+func TestGetStationID(t *testing.T) {
+	// frame is a frame with the given message type and station ID 4095.
+	frame := func(messageType int) []byte {
+		f := NewFrame(24)
+		SetBits(f, LeaderLengthBits, 12, uint64(messageType))
+		SetBits(f, LeaderLengthBits+12, 12, 4095)
+		SetCRC(f)
+		return f
+	}
+
+	var testData = []struct {
+		description string
+		messageType int
+		frame       []byte
+		wantOK      bool
+	}{
+		{"1005", 1005, frame(1005), true},
+		{"1012", 1012, frame(1012), true},
+		{"1013", 1013, frame(1013), true},
+		{"1033", 1033, frame(1033), true},
+		{"1230", 1230, frame(1230), true},
+		{"MSM", 1077, frame(1077), true},
+		{"ephemeris", 1019, frame(1019), false},
+		{"other", 4072, frame(4072), false},
+		{"non-RTCM", NonRTCMMessage, []byte("junk"), false},
+		{"short", 1005, []byte{0xd3, 0, 1, 0x3e}, false},
+	}
+	for _, td := range testData {
+		got, ok := GetStationID(td.messageType, td.frame)
+		if ok != td.wantOK {
+			t.Errorf("%s: want %v got %v", td.description, td.wantOK, ok)
+			continue
+		}
+		if ok && got != 4095 {
+			t.Errorf("%s: want 4095 got %d", td.description, got)
+		}
+	}
+}
+
 // TestGetConstellation checks the getConstellation helper function, which should
 // return an error if the message type is not an MSM.
 func TestGetConstellation(t *testing.T) {
@@ -1048,9 +1213,16 @@ func TestGetConstellation(t *testing.T) {
 		{1, "unknown constellation"},
 		{1023, "unknown constellation"},
 		{1138, "unknown constellation"},
-		{1073, "unknown constellation"},
-		{1075, "unknown constellation"},
-		{1076, "unknown constellation"},
+		{1070, "unknown constellation"},
+		{1078, "unknown constellation"},
+		{1071, "GPS"},
+		{1076, "GPS"},
+		{1083, "Glonass"},
+		{1095, "Galileo"},
+		{1102, "SBAS"},
+		{1116, "QZSS"},
+		{1121, "Beidou"},
+		{1135, "NavIC/IRNSS"},
 
 		{MaxMessageType, "unknown constellation"},
 	}
@@ -1199,3 +1371,119 @@ func TestGetDailyLogger(t *testing.T) {
 	}
 
 }
+
+// TestRoundToMultiple checks rounding to the nearest multiple of a step.
+func TestRoundToMultiple(t *testing.T) {
+	var testData = []struct {
+		value int64
+		step  int64
+		want  int64
+	}{
+		{0, 10, 0},
+		{14, 10, 10},
+		{15, 10, 20},
+		{-14, 10, -10},
+		{-15, 10, -20},
+		{38000123456789, 1000000, 38000123000000},
+	}
+	for _, td := range testData {
+		got := RoundToMultiple(td.value, td.step)
+		if got != td.want {
+			t.Errorf("%d step %d: want %d got %d", td.value, td.step, td.want, got)
+		}
+	}
+}
+
+// TestRinexSNRFlag checks the mapping of carrier to noise ratios to RINEX
+// signal strength flags.
+func TestRinexSNRFlag(t *testing.T) {
+	var testData = []struct {
+		cnr  float64
+		want uint
+	}{
+		{0, 0},
+		{0.0625, 1},
+		{11.9, 1},
+		{12, 2},
+		{17.9375, 2},
+		{41, 6},
+		{42, 7},
+		{53.5, 8},
+		{54, 9},
+		{63, 9},
+	}
+	for _, td := range testData {
+		got := RinexSNRFlag(td.cnr)
+		if got != td.want {
+			t.Errorf("%f: want %d got %d", td.cnr, td.want, got)
+		}
+	}
+}
+
+// TestSetBits checks that SetBits writes values that GetBitsAsUint64 and
+// GetBitsAsInt64 read back.
+func TestSetBits(t *testing.T) {
+	var testData = []struct {
+		position uint
+		length   uint
+		value    int64
+	}{
+		{0, 1, 1},
+		{3, 12, 1005},
+		{7, 38, 123456789},
+		{7, 38, -123456789},
+		{9, 15, -1},
+		{0, 64, -9223372036854775808},
+		{64, 64, 9223372036854775807},
+	}
+
+	for _, td := range testData {
+		buff := make([]byte, 16)
+		gotPos := SetBits(buff, td.position, td.length, uint64(td.value))
+		if gotPos != td.position+td.length {
+			t.Errorf("%d %d: want position %d got %d",
+				td.position, td.length, td.position+td.length, gotPos)
+		}
+		got := GetBitsAsInt64(buff, td.position, td.length)
+		if got != td.value {
+			t.Errorf("%d %d: want %d got %d", td.position, td.length, td.value, got)
+		}
+		// The bits either side are untouched.
+		if td.position > 0 && GetBitsAsUint64(buff, 0, td.position) != 0 {
+			t.Errorf("%d %d: bits before the field were changed", td.position, td.length)
+		}
+	}
+}
+
+// TestSetFlag checks that SetFlag sets one bit.
+func TestSetFlag(t *testing.T) {
+	buff := make([]byte, 1)
+	pos := SetFlag(buff, 2, true)
+	pos = SetFlag(buff, pos, false)
+	pos = SetFlag(buff, pos, true)
+	if pos != 5 {
+		t.Errorf("want position 5 got %d", pos)
+	}
+	if buff[0] != 0x28 {
+		t.Errorf("want 0x28 got 0x%02x", buff[0])
+	}
+}
+
+// TestNewFrameAndSetCRC checks that NewFrame and SetCRC produce a valid
+// message frame.
+func TestNewFrameAndSetCRC(t *testing.T) {
+	// A frame of type 1230 with junk contents and a valid CRC.
+	want := []byte{0xd3, 0x00, 0x08,
+		0x4c, 0xe0, 00, 0x8a, 0, 0, 0, 0,
+		0xa8, 0xf7, 0x2a,
+	}
+
+	// The message is 61 bits, which is padded to 8 bytes.
+	frame := NewFrame(61)
+	copy(frame[LeaderLengthBytes:], want[LeaderLengthBytes:len(want)-CRCLengthBytes])
+	SetCRC(frame)
+
+	if !cmp.Equal(want, frame) {
+		t.Error(cmp.Diff(want, frame))
+	}
+}
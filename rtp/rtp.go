@@ -0,0 +1,180 @@
+// The rtp package handles the Real-time Transport Protocol (RTP, RFC 3550)
+// packets in which NTRIP version 2 carries RTCM data over UDP.
+//
+// Some radio modem and VPN setups only pass UDP.  Over UDP, datagrams can be
+// lost or arrive out of order, so each one is sent as an RTP packet: a
+// 12-byte header carrying a sequence number and a timestamp, followed by the
+// payload.  The receiver can use the sequence numbers to count the lost
+// packets.  NTRIP version 2 uses payload type 96 for the GNSS data.
+//
+//	packet := rtp.Packet{PayloadType: rtp.PayloadTypeGNSS, SequenceNumber: n, Payload: frame}
+//	conn.Write(packet.Marshal())
+//	...
+//	packet, err := rtp.Parse(datagram)
+//	tracker.Record(packet.SequenceNumber)
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// HeaderLength is the length of an RTP header with no contributing sources
+// or extension.
+const HeaderLength = 12
+
+// Version is the RTP version.
+const Version = 2
+
+// PayloadTypeGNSS is the payload type that NTRIP version 2 uses for GNSS
+// data such as RTCM.
+const PayloadTypeGNSS = 96
+
+// Packet is an RTP packet.
+type Packet struct {
+	// PayloadType identifies the contents of the payload.
+	PayloadType uint8
+
+	// SequenceNumber goes up by one with each packet, wrapping from 65535
+	// to 0.
+	SequenceNumber uint16
+
+	// Timestamp is the sampling time of the payload.  For NTRIP it's
+	// generally the time in milliseconds.
+	Timestamp uint32
+
+	// SSRC identifies the source of the stream.
+	SSRC uint32
+
+	// Payload is the data, for example an RTCM message frame.
+	Payload []byte
+}
+
+// Marshal returns the packet in its binary form.
+func (packet *Packet) Marshal() []byte {
+	buffer := make([]byte, HeaderLength+len(packet.Payload))
+	buffer[0] = Version << 6
+	buffer[1] = packet.PayloadType & 0x7f
+	binary.BigEndian.PutUint16(buffer[2:4], packet.SequenceNumber)
+	binary.BigEndian.PutUint32(buffer[4:8], packet.Timestamp)
+	binary.BigEndian.PutUint32(buffer[8:12], packet.SSRC)
+	copy(buffer[HeaderLength:], packet.Payload)
+	return buffer
+}
+
+// Parse extracts an RTP packet from a datagram.  It skips any contributing
+// sources and header extension and removes any padding.  The payload shares
+// storage with the datagram.
+func Parse(datagram []byte) (*Packet, error) {
+	if len(datagram) < HeaderLength {
+		em := fmt.Sprintf("RTP packet too short - %d bytes", len(datagram))
+		return nil, errors.New(em)
+	}
+
+	version := datagram[0] >> 6
+	if version != Version {
+		em := fmt.Sprintf("RTP version %d - want %d", version, Version)
+		return nil, errors.New(em)
+	}
+
+	padding := datagram[0]&0x20 != 0
+	extension := datagram[0]&0x10 != 0
+	contributors := int(datagram[0] & 0x0f)
+
+	start := HeaderLength + 4*contributors
+	if extension {
+		if len(datagram) < start+4 {
+			return nil, errors.New("RTP packet too short for its header extension")
+		}
+		extensionWords := int(binary.BigEndian.Uint16(datagram[start+2 : start+4]))
+		start += 4 + 4*extensionWords
+	}
+
+	end := len(datagram)
+	if padding && end > 0 {
+		end -= int(datagram[end-1])
+	}
+
+	if start > end {
+		return nil, errors.New("RTP packet too short for its header")
+	}
+
+	packet := Packet{
+		PayloadType:    datagram[1] & 0x7f,
+		SequenceNumber: binary.BigEndian.Uint16(datagram[2:4]),
+		Timestamp:      binary.BigEndian.Uint32(datagram[4:8]),
+		SSRC:           binary.BigEndian.Uint32(datagram[8:12]),
+		Payload:        datagram[start:end],
+	}
+
+	return &packet, nil
+}
+
+// LossStats counts the packets received and lost.
+type LossStats struct {
+	// Received is the number of packets received.
+	Received uint64 `json:"received"`
+
+	// Lost is the number of packets that were skipped in the sequence and
+	// haven't turned up since.
+	Lost uint64 `json:"lost"`
+
+	// Late is the number of packets that arrived after a later one,
+	// including duplicates.
+	Late uint64 `json:"late"`
+}
+
+// Tracker uses the sequence numbers of the incoming packets to count the
+// lost packets.  It's safe for concurrent use.
+type Tracker struct {
+	// started is true once the first packet has been seen.
+	started bool
+
+	// highest is the highest sequence number seen so far.
+	highest uint16
+
+	stats LossStats
+
+	// The mutex controls access to all the fields.
+	mutex sync.Mutex
+}
+
+// Record notes the arrival of a packet with the given sequence number.
+func (tracker *Tracker) Record(sequenceNumber uint16) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.stats.Received++
+
+	if !tracker.started {
+		tracker.started = true
+		tracker.highest = sequenceNumber
+		return
+	}
+
+	// The difference is taken modulo 65536, so a small negative value means
+	// a late packet and a small positive value means a jump forward, even
+	// when the sequence number has wrapped.
+	gap := int16(sequenceNumber - tracker.highest)
+
+	switch {
+	case gap > 0:
+		tracker.stats.Lost += uint64(gap - 1)
+		tracker.highest = sequenceNumber
+	default:
+		// A late packet may be one that was counted as lost.
+		tracker.stats.Late++
+		if gap < 0 && tracker.stats.Lost > 0 {
+			tracker.stats.Lost--
+		}
+	}
+}
+
+// Stats returns a copy of the counts.
+func (tracker *Tracker) Stats() LossStats {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.stats
+}
@@ -0,0 +1,117 @@
+package rtp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestMarshalAndParse checks that a packet survives the round trip.
+func TestMarshalAndParse(t *testing.T) {
+	want := Packet{
+		PayloadType:    PayloadTypeGNSS,
+		SequenceNumber: 65535,
+		Timestamp:      123456789,
+		SSRC:           0xdeadbeef,
+		Payload:        []byte{0xd3, 0x00, 0x01, 0x02},
+	}
+
+	datagram := want.Marshal()
+
+	if len(datagram) != HeaderLength+len(want.Payload) {
+		t.Errorf("want %d bytes got %d", HeaderLength+len(want.Payload), len(datagram))
+	}
+
+	got, err := Parse(datagram)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !cmp.Equal(want, *got) {
+		t.Error(cmp.Diff(want, *got))
+	}
+}
+
+// TestParseWithOptionalParts checks that Parse skips the contributing
+// sources and the header extension and removes the padding.
+func TestParseWithOptionalParts(t *testing.T) {
+	payload := []byte("RTCM")
+
+	var datagram []byte
+	// Version 2, padding, extension, one contributing source.
+	datagram = append(datagram, 0x80|0x20|0x10|0x01, PayloadTypeGNSS, 0, 7)
+	datagram = append(datagram, 0, 0, 0, 1, 0, 0, 0, 2)
+	// Contributing source.
+	datagram = append(datagram, 0, 0, 0, 3)
+	// Extension header with one word.
+	datagram = append(datagram, 0, 0, 0, 1, 9, 9, 9, 9)
+	datagram = append(datagram, payload...)
+	// Three bytes of padding, the last giving the count.
+	datagram = append(datagram, 0, 0, 3)
+
+	got, err := Parse(datagram)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if got.SequenceNumber != 7 {
+		t.Errorf("want sequence number 7 got %d", got.SequenceNumber)
+	}
+
+	if !bytes.Equal(payload, got.Payload) {
+		t.Errorf("want payload %q got %q", payload, got.Payload)
+	}
+}
+
+// TestParseWithError checks that Parse rejects bad packets.
+func TestParseWithError(t *testing.T) {
+	var testData = []struct {
+		description string
+		datagram    []byte
+		wantError   string
+	}{
+		{"short", []byte{0x80, 96, 0, 1}, "RTP packet too short - 4 bytes"},
+		{"version 1", append([]byte{0x40}, make([]byte, 11)...), "RTP version 1 - want 2"},
+		{"contributors", append([]byte{0x8f}, make([]byte, 11)...), "RTP packet too short for its header"},
+		{"extension", append([]byte{0x90}, make([]byte, 11)...), "RTP packet too short for its header extension"},
+	}
+	for _, td := range testData {
+		_, err := Parse(td.datagram)
+		if err == nil {
+			t.Errorf("%s: want an error", td.description)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestTracker checks the counting of lost and late packets.
+func TestTracker(t *testing.T) {
+	var testData = []struct {
+		description string
+		sequence    []uint16
+		want        LossStats
+	}{
+		{"in order", []uint16{1, 2, 3, 4}, LossStats{Received: 4}},
+		{"lost", []uint16{1, 2, 5, 6}, LossStats{Received: 4, Lost: 2}},
+		{"late", []uint16{1, 3, 2, 4}, LossStats{Received: 4, Late: 1}},
+		{"duplicate", []uint16{1, 2, 2, 3}, LossStats{Received: 4, Late: 1}},
+		{"wrap", []uint16{65534, 65535, 0, 2}, LossStats{Received: 4, Lost: 1}},
+	}
+	for _, td := range testData {
+		var tracker Tracker
+		for _, n := range td.sequence {
+			tracker.Record(n)
+		}
+
+		got := tracker.Stats()
+		if got != td.want {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package serialin
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// A device in the config can be the name of a serial port, for example
+// "/dev/ttyACM0" on Linux, "/dev/cu.usbmodem14101" on a Mac or "COM4" on
+// Windows, or a pattern that matches several, for example "/dev/ttyACM*" or
+// "COM*".  The devices are matched against the ports that the serial
+// library finds, so the same config works on all of those systems.  On
+// Windows the name of a COM port is not case sensitive and may be given in
+// the device namespace, for example "\\.\COM10", which is the only way to
+// open a COM port above COM9 as an ordinary file.
+
+// windowsDevicePrefix is the prefix of a name in the Windows device
+// namespace.
+const windowsDevicePrefix = `\\.\`
+
+// FindPorts returns the names of the known serial ports that match the
+// devices, in the order of the devices and, where a pattern matches
+// several ports, in order of their names.  The names are as given in the
+// known list.  A port that matches more than one device is only returned
+// once.
+func FindPorts(devices, known []string) []string {
+	sorted := make([]string, len(known))
+	copy(sorted, known)
+	sort.Strings(sorted)
+
+	found := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		pattern := portName(device)
+		for _, name := range sorted {
+			if seen[name] {
+				continue
+			}
+			matched, matchError := path.Match(pattern, portName(name))
+			if matchError != nil {
+				// A malformed pattern can only match itself.
+				matched = pattern == portName(name)
+			}
+			if matched {
+				found = append(found, name)
+				seen[name] = true
+			}
+		}
+	}
+	return found
+}
+
+// IsPattern returns true if the device is a pattern rather than a name.
+func IsPattern(device string) bool {
+	return strings.ContainsAny(portName(device), "*?[")
+}
+
+// portName returns the name of a port in a form that can be compared,
+// without the Windows device prefix and with the name of a COM port in
+// upper case.
+func portName(name string) string {
+	name = strings.TrimPrefix(name, windowsDevicePrefix)
+	if strings.HasPrefix(strings.ToUpper(name), "COM") {
+		return strings.ToUpper(name)
+	}
+	return name
+}
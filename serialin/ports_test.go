@@ -0,0 +1,59 @@
+package serialin
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestFindPorts checks that the devices in the config are matched against
+// the known ports, including Windows COM ports.
+func TestFindPorts(t *testing.T) {
+	linux := []string{"/dev/ttyS0", "/dev/ttyACM1", "/dev/ttyACM0"}
+	windows := []string{"COM1", "COM10", "COM4"}
+
+	var testData = []struct {
+		description string
+		devices     []string
+		known       []string
+		want        []string
+	}{
+		{"name", []string{"/dev/ttyACM0"}, linux, []string{"/dev/ttyACM0"}},
+		{"absent", []string{"/dev/ttyUSB0"}, linux, []string{}},
+		{"pattern", []string{"/dev/ttyACM*"}, linux, []string{"/dev/ttyACM0", "/dev/ttyACM1"}},
+		{"order of devices", []string{"/dev/ttyS0", "/dev/ttyACM*"}, linux,
+			[]string{"/dev/ttyS0", "/dev/ttyACM0", "/dev/ttyACM1"}},
+		{"no repeats", []string{"/dev/ttyACM1", "/dev/ttyACM*"}, linux,
+			[]string{"/dev/ttyACM1", "/dev/ttyACM0"}},
+		{"COM port", []string{"COM4"}, windows, []string{"COM4"}},
+		{"lower case", []string{"com4"}, windows, []string{"COM4"}},
+		{"device namespace", []string{`\\.\COM10`}, windows, []string{"COM10"}},
+		{"COM pattern", []string{"COM*"}, windows, []string{"COM1", "COM10", "COM4"}},
+		{"COM on Linux", []string{"COM4"}, linux, []string{}},
+		{"bad pattern", []string{"/dev/ttyACM["}, linux, []string{}},
+	}
+	for _, td := range testData {
+		got := FindPorts(td.devices, td.known)
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestIsPattern checks that patterns are told apart from names.
+func TestIsPattern(t *testing.T) {
+	var testData = []struct {
+		device string
+		want   bool
+	}{
+		{"/dev/ttyACM0", false},
+		{"/dev/ttyACM*", true},
+		{"COM?", true},
+		{`\\.\COM10`, false},
+	}
+	for _, td := range testData {
+		if got := IsPattern(td.device); got != td.want {
+			t.Errorf("%s: want %v got %v", td.device, td.want, got)
+		}
+	}
+}
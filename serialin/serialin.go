@@ -0,0 +1,256 @@
+// The serialin package reads data from the serial line of a GNSS device,
+// typically a USB port, in the same way as serial_usb_grabber but inside the
+// application, so that the device can be read without a separate process
+// and a pipe.  A USB device can vanish, for example when it's unplugged or
+// reset, and come back, perhaps under another name.  A Reader is given the
+// input section of the config, which lists the devices to try:
+//
+//	"input": {
+//	    "devices": ["/dev/ttyACM0", "/dev/ttyACM1"],
+//	    "serial": {"speed": 115200},
+//	    "receiver": {"message_types": [1005, 1077, 1087, 1097, 1127]},
+//	    "read_timeout_milliseconds": 1000,
+//	    "sleep_time_after_failed_open_milliseconds": 500,
+//	    "wait_time_on_eof_milliseconds": 100
+//	}
+//
+// A device can also be a pattern such as "/dev/ttyACM*" or, on Windows,
+// "COM*" - see FindPorts.  It opens the first of the devices that the
+// serial library finds.  If a read fails or times out because the device
+// has gone quiet, it closes the line, waits for
+// wait_time_on_eof_milliseconds and opens a device again.  If none can be
+// found it waits for sleep_time_after_failed_open_milliseconds and tries
+// again.  So a Reader never reaches the end of its input unless it's
+// closed.  If the config has a receiver part, the settings that it gives
+// are sent to the device each time it's opened - see the ubx package.
+// Like serial_usb_grabber, an application can insist that a device is
+// present at the start by calling Open:
+//
+//	reader, err := serialin.New(&config.Input, logger)
+//	err = reader.Open()
+//	...
+//	n, err := reader.Read(buffer)
+package serialin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/ubx"
+)
+
+// port is the part of serial.Port that a Reader uses.
+type port interface {
+	io.ReadWriteCloser
+	SetReadTimeout(t time.Duration) error
+}
+
+// Reader reads from the first of a list of serial devices that it can open,
+// opening one again when the line is lost.
+type Reader struct {
+	// input gives the devices and the timings.
+	input *config.Input
+
+	// mode is the mode with which to open the serial line.
+	mode *serial.Mode
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// port is the open serial line, nil if there isn't one.
+	port port
+
+	// device is the name of the open device.
+	device string
+
+	// closed is set when Close is called.
+	closed bool
+
+	// failureLogged is true if the last failure to open a device has been
+	// logged.
+	failureLogged bool
+
+	// listPorts lists the serial devices that the system knows about.  It's
+	// replaced in tests.
+	listPorts func() ([]string, error)
+
+	// open opens a device.  It's replaced in tests.
+	open func(device string, mode *serial.Mode) (port, error)
+
+	// sleep pauses.  It's replaced in tests.
+	sleep func(d time.Duration)
+
+	// The mutex controls access to port, device and closed.
+	mutex sync.Mutex
+}
+
+// New creates a Reader for the devices in the input config.  It doesn't
+// open a device until it's read or Open is called.  It returns an error if
+// the config has no devices or the serial parameters are not valid.  The
+// logger may be nil.
+func New(input *config.Input, logger *log.Logger) (*Reader, error) {
+	if len(input.Devices) == 0 {
+		return nil, errors.New("serialin - the input config has no devices")
+	}
+	mode, modeError := input.Serial.Mode()
+	if modeError != nil {
+		return nil, modeError
+	}
+
+	reader := Reader{
+		input:     input,
+		mode:      mode,
+		logger:    logger,
+		listPorts: serial.GetPortsList,
+		open:      openPort,
+		sleep:     time.Sleep,
+	}
+	return &reader, nil
+}
+
+// Open opens the first of the devices that it can, if none is open yet.  It
+// returns an error if none of them can be opened.
+func (reader *Reader) Open() error {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	if reader.port != nil {
+		return nil
+	}
+	return reader.connect()
+}
+
+// Device returns the name of the open device, or "" if none is open.
+func (reader *Reader) Device() string {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	return reader.device
+}
+
+// Read reads some data from the serial line.  It waits until there is some,
+// opening a device again if the line is lost or goes quiet.  It only
+// returns an error, io.EOF, after the Reader is closed.
+func (reader *Reader) Read(buffer []byte) (int, error) {
+	for {
+		reader.mutex.Lock()
+		if reader.closed {
+			reader.mutex.Unlock()
+			return 0, io.EOF
+		}
+		if reader.port == nil {
+			openError := reader.connect()
+			if openError != nil {
+				if !reader.failureLogged {
+					eventlog.Println(reader.logger, openError.Error()+".  Retrying")
+					reader.failureLogged = true
+				}
+				reader.mutex.Unlock()
+				reader.sleep(reader.input.SleepTimeAfterFailedOpen())
+				continue
+			}
+		}
+		p := reader.port
+		device := reader.device
+		reader.mutex.Unlock()
+
+		n, readError := p.Read(buffer)
+		if n > 0 {
+			return n, nil
+		}
+
+		// The read failed or, if it returned nothing, timed out because the
+		// device has gone quiet.  Close the line, wait and open it again.
+		if readError != nil {
+			eventlog.Printf(reader.logger, "serialin - lost %s - %v", device, readError)
+		} else {
+			eventlog.Printf(reader.logger, "serialin - %s timed out", device)
+		}
+		reader.mutex.Lock()
+		if reader.port == p {
+			p.Close()
+			reader.port = nil
+			reader.device = ""
+		}
+		reader.mutex.Unlock()
+		reader.sleep(reader.input.WaitTimeOnEOF())
+	}
+}
+
+// Close closes the serial line, if it's open, and makes any later Read
+// return io.EOF.
+func (reader *Reader) Close() error {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	reader.closed = true
+	if reader.port == nil {
+		return nil
+	}
+	err := reader.port.Close()
+	reader.port = nil
+	reader.device = ""
+	return err
+}
+
+// connect opens the first device in the config that the system knows
+// about.  The caller must hold the mutex.
+func (reader *Reader) connect() error {
+	known, listError := reader.listPorts()
+	if listError != nil {
+		em := fmt.Sprintf("serialin - cannot list the serial ports - %v", listError)
+		return errors.New(em)
+	}
+
+	ports := FindPorts(reader.input.Devices, known)
+	if len(ports) == 0 {
+		return errors.New("serialin - none of the devices is present")
+	}
+
+	device := ports[0]
+	p, openError := reader.open(device, reader.mode)
+	if openError != nil {
+		em := fmt.Sprintf("serialin - cannot open %s - %v", device, openError)
+		return errors.New(em)
+	}
+	// A zero timeout would make every read return at once, so it means wait
+	// for ever.
+	timeout := reader.input.ReadTimeout()
+	if timeout == 0 {
+		timeout = serial.NoTimeout
+	}
+	p.SetReadTimeout(timeout)
+	reader.configureReceiver(p, device)
+	eventlog.Println(reader.logger, "serialin - reading from "+device)
+	reader.port = p
+	reader.device = device
+	reader.failureLogged = false
+	return nil
+}
+
+// configureReceiver sends the settings given by the receiver part of the
+// config, if there is one, to the device.  The receiver may have lost the
+// settings since the line was last opened, for example if it was reset, so
+// they are sent every time.  A failure is logged but the device is still
+// read.
+func (reader *Reader) configureReceiver(p port, device string) {
+	if reader.input.Receiver == nil {
+		return
+	}
+	if err := ubx.Configure(p, reader.input.Receiver); err != nil {
+		eventlog.Printf(reader.logger, "serialin - cannot configure the receiver on %s - %v", device, err)
+		return
+	}
+	eventlog.Println(reader.logger, "serialin - configured the receiver on "+device)
+}
+
+// openPort opens a serial device.
+func openPort(device string, mode *serial.Mode) (port, error) {
+	return serial.Open(device, mode)
+}
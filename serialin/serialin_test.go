@@ -0,0 +1,256 @@
+package serialin
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/goblimey/go-ntrip/config"
+	"github.com/goblimey/go-ntrip/ubx"
+)
+
+// fakePort is a serial line that gives a series of reads.  An empty string
+// is a timeout and "error" is a failure.
+type fakePort struct {
+	reads   []string
+	written []byte
+	timeout time.Duration
+	closed  bool
+}
+
+func (port *fakePort) Read(buffer []byte) (int, error) {
+	if len(port.reads) == 0 {
+		return 0, errors.New("device not configured")
+	}
+	next := port.reads[0]
+	port.reads = port.reads[1:]
+	if next == "error" {
+		return 0, errors.New("device not configured")
+	}
+	return copy(buffer, next), nil
+}
+
+func (port *fakePort) Write(buffer []byte) (int, error) {
+	port.written = append(port.written, buffer...)
+	return len(buffer), nil
+}
+
+func (port *fakePort) Close() error {
+	port.closed = true
+	return nil
+}
+
+func (port *fakePort) SetReadTimeout(t time.Duration) error {
+	port.timeout = t
+	return nil
+}
+
+// fakeSystem is a set of serial devices.  Each call of open gives the next
+// port for the device.
+type fakeSystem struct {
+	ports  map[string][]*fakePort
+	sleeps []time.Duration
+}
+
+func (system *fakeSystem) listPorts() ([]string, error) {
+	names := make([]string, 0)
+	for name, ports := range system.ports {
+		if len(ports) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (system *fakeSystem) open(device string, mode *serial.Mode) (port, error) {
+	ports := system.ports[device]
+	if len(ports) == 0 {
+		return nil, errors.New("no such file or directory")
+	}
+	system.ports[device] = ports[1:]
+	return ports[0], nil
+}
+
+func (system *fakeSystem) sleep(d time.Duration) {
+	system.sleeps = append(system.sleeps, d)
+}
+
+// newTestReader is a helper function.  It creates a Reader for two devices
+// on the fake system.
+func newTestReader(t *testing.T, system *fakeSystem, logBuffer *bytes.Buffer) *Reader {
+	input := config.Input{
+		Devices:                              []string{"ttyACM0", "ttyACM1"},
+		ReadTimeoutMilliseconds:              1000,
+		SleepTimeAfterFailedOpenMilliseconds: 500,
+		WaitTimeOnEOFMilliseconds:            100,
+	}
+	reader, err := New(&input, log.New(logBuffer, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.listPorts = system.listPorts
+	reader.open = system.open
+	reader.sleep = system.sleep
+	return reader
+}
+
+// TestNew checks the checks on the config.
+func TestNew(t *testing.T) {
+	_, err := New(&config.Input{}, nil)
+	if err == nil || err.Error() != "serialin - the input config has no devices" {
+		t.Errorf("want no devices error, got %v", err)
+	}
+
+	input := config.Input{Devices: []string{"COM4"}, Serial: config.Serial{Parity: "junk"}}
+	_, err = New(&input, nil)
+	if err == nil || err.Error() != "config - illegal parity value junk" {
+		t.Errorf("want parity error, got %v", err)
+	}
+}
+
+// TestOpen checks that Open fails if no device is present and otherwise
+// opens the first one in the config.
+func TestOpen(t *testing.T) {
+	var logBuffer bytes.Buffer
+	system := fakeSystem{ports: map[string][]*fakePort{}}
+	reader := newTestReader(t, &system, &logBuffer)
+
+	err := reader.Open()
+	if err == nil || err.Error() != "serialin - none of the devices is present" {
+		t.Errorf("want none present error, got %v", err)
+	}
+
+	second := &fakePort{}
+	system.ports["ttyACM1"] = []*fakePort{second}
+	if err := reader.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if reader.Device() != "ttyACM1" || second.timeout != time.Second {
+		t.Errorf("want ttyACM1 with a one second timeout, got %s %v", reader.Device(), second.timeout)
+	}
+
+	if err := reader.Close(); err != nil || !second.closed {
+		t.Errorf("want the port closed, got %v", err)
+	}
+	if _, err := reader.Read(make([]byte, 10)); err != io.EOF {
+		t.Errorf("want EOF after Close, got %v", err)
+	}
+}
+
+// TestOpenConfiguresReceiver checks that the settings for the receiver are
+// sent when the device is opened.
+func TestOpenConfiguresReceiver(t *testing.T) {
+	var logBuffer bytes.Buffer
+	port := &fakePort{}
+	system := fakeSystem{ports: map[string][]*fakePort{"ttyACM0": {port}}}
+	reader := newTestReader(t, &system, &logBuffer)
+	receiver := ubx.Config{MessageTypes: []int{1005, 1077}}
+	reader.input.Receiver = &receiver
+
+	if err := reader.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []byte
+	commands, err := receiver.Commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range commands {
+		want = append(want, command...)
+	}
+	if !bytes.Equal(want, port.written) {
+		t.Errorf("want the receiver commands written, got %d bytes", len(port.written))
+	}
+
+	wantLog := "serialin - configured the receiver on ttyACM0\nserialin - reading from ttyACM0\n"
+	if logBuffer.String() != wantLog {
+		t.Errorf("want log\n%s\ngot\n%s", wantLog, logBuffer.String())
+	}
+}
+
+// TestReadReconnects checks that the Reader carries on reading when the
+// device goes quiet, fails or comes back under another name.
+func TestReadReconnects(t *testing.T) {
+	var logBuffer bytes.Buffer
+	system := fakeSystem{ports: map[string][]*fakePort{
+		// The first port gives some data, times out, and then the second
+		// gives more data and fails.
+		"ttyACM0": {
+			{reads: []string{"ab", ""}},
+			{reads: []string{"cd", "error"}},
+		},
+		// The device comes back under another name.
+		"ttyACM1": {
+			{reads: []string{"ef"}},
+		},
+	}}
+	reader := newTestReader(t, &system, &logBuffer)
+
+	buffer := make([]byte, 10)
+	var got string
+	for i := 0; i < 3; i++ {
+		n, err := reader.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got += string(buffer[:n])
+	}
+	if got != "abcdef" {
+		t.Errorf("want abcdef got %s", got)
+	}
+
+	wantSleeps := []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}
+	if len(system.sleeps) != len(wantSleeps) ||
+		system.sleeps[0] != wantSleeps[0] || system.sleeps[1] != wantSleeps[1] {
+		t.Errorf("want sleeps %v got %v", wantSleeps, system.sleeps)
+	}
+
+	wantLog := []string{
+		"serialin - reading from ttyACM0",
+		"serialin - ttyACM0 timed out",
+		"serialin - reading from ttyACM0",
+		"serialin - lost ttyACM0 - device not configured",
+		"serialin - reading from ttyACM1",
+	}
+	gotLog := strings.Split(strings.TrimSpace(logBuffer.String()), "\n")
+	if strings.Join(wantLog, "\n") != strings.Join(gotLog, "\n") {
+		t.Errorf("want log\n%s\ngot\n%s", strings.Join(wantLog, "\n"), strings.Join(gotLog, "\n"))
+	}
+}
+
+// TestReadWaitsForDevice checks that the Reader waits when no device is
+// present and logs only the first failure.
+func TestReadWaitsForDevice(t *testing.T) {
+	var logBuffer bytes.Buffer
+	system := fakeSystem{ports: map[string][]*fakePort{}}
+	reader := newTestReader(t, &system, &logBuffer)
+
+	// The device appears after the Reader has slept twice.
+	reader.sleep = func(d time.Duration) {
+		system.sleep(d)
+		if len(system.sleeps) == 2 {
+			system.ports["ttyACM0"] = []*fakePort{{reads: []string{"x"}}}
+		}
+	}
+
+	buffer := make([]byte, 10)
+	n, err := reader.Read(buffer)
+	if err != nil || string(buffer[:n]) != "x" {
+		t.Errorf("want x got %q %v", buffer[:n], err)
+	}
+	if len(system.sleeps) != 2 || system.sleeps[0] != 500*time.Millisecond {
+		t.Errorf("want two sleeps of 500ms, got %v", system.sleeps)
+	}
+
+	wantLog := "serialin - none of the devices is present.  Retrying\nserialin - reading from ttyACM0\n"
+	if logBuffer.String() != wantLog {
+		t.Errorf("want log\n%s\ngot\n%s", wantLog, logBuffer.String())
+	}
+}
@@ -0,0 +1,192 @@
+// The serialout package writes data to a serial line, typically RTCM
+// corrections to the USB port of a rover's GNSS device.  A USB device can
+// vanish, for example when it's unplugged or reset, and come back, perhaps
+// under another name such as /dev/ttyACM1 rather than /dev/ttyACM0.  A
+// Writer copes with that in the same way as the serial input of
+// serial_usb_grabber: it's given a list of devices and uses the first one
+// that it can open.  If writing fails, it closes the line and tries the
+// devices again, pausing between attempts:
+//
+//	writer := serialout.New(
+//	    []string{"/dev/ttyACM0", "/dev/ttyACM1"}, mode, time.Second, logger)
+//	err := writer.Open() // Fail at the start if there's no device.
+//	...
+//	writer.Write(corrections)
+//
+// RTCM corrections are no use to a rover when they are late, so data written
+// while there is no device is dropped rather than queued.  Only the first of
+// a series of failures to open a device is logged.
+package serialout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+)
+
+// DefaultRetry is the pause between attempts to open a device used when
+// New is given zero.
+const DefaultRetry = time.Second
+
+// Writer writes to the first of a list of serial devices that it can open.
+// It's safe for concurrent use.
+type Writer struct {
+	// devices is the list of devices to try, in order.
+	devices []string
+
+	// mode is the mode with which to open the serial line.
+	mode *serial.Mode
+
+	// retry is the pause between attempts to open a device.
+	retry time.Duration
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// port is the open serial line, nil if there isn't one.
+	port io.WriteCloser
+
+	// device is the name of the open device.
+	device string
+
+	// nextAttempt is the earliest time at which to try to open a device again.
+	nextAttempt time.Time
+
+	// failureLogged is true if the last failure to open a device has been
+	// logged.
+	failureLogged bool
+
+	// open opens a device.  It's replaced in tests.
+	open func(device string, mode *serial.Mode) (io.WriteCloser, error)
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// New creates a Writer for the given devices, which are tried in order.  It
+// doesn't open a device until it's written to or Open is called.  A retry of
+// zero means DefaultRetry.  The logger may be nil.
+func New(devices []string, mode *serial.Mode, retry time.Duration, logger *log.Logger) *Writer {
+	if retry == 0 {
+		retry = DefaultRetry
+	}
+	writer := Writer{
+		devices: devices,
+		mode:    mode,
+		retry:   retry,
+		logger:  logger,
+		open:    openPort,
+		now:     time.Now,
+	}
+	return &writer
+}
+
+// Open opens the first of the devices that it can, if none is open yet.  It
+// returns an error if none of them can be opened.  An application can call
+// it at the start to check that there is a device, as serial_usb_grabber
+// does.  After that, Write opens a device as needed.
+func (writer *Writer) Open() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.port != nil {
+		return nil
+	}
+	return writer.connect()
+}
+
+// Device returns the name of the open device, or "" if none is open.
+func (writer *Writer) Device() string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.device
+}
+
+// Write writes the data to the serial line, opening a device first if need
+// be.  If no device can be opened the data is dropped.  If the write fails,
+// the line is closed and the next write tries the devices again.  It never
+// returns an error, so that a pipeline writing to it keeps going.
+func (writer *Writer) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.port == nil {
+		now := writer.now()
+		if now.Before(writer.nextAttempt) {
+			return len(p), nil
+		}
+		openError := writer.connect()
+		if openError != nil {
+			if !writer.failureLogged {
+				eventlog.Println(writer.logger, openError.Error()+".  Retrying")
+				writer.failureLogged = true
+			}
+			writer.nextAttempt = now.Add(writer.retry)
+			return len(p), nil
+		}
+	}
+
+	_, writeError := writer.port.Write(p)
+	if writeError != nil {
+		eventlog.Printf(writer.logger, "serialout - lost %s - %v", writer.device, writeError)
+		writer.port.Close()
+		writer.port = nil
+		writer.device = ""
+	}
+
+	return len(p), nil
+}
+
+// Close closes the serial line, if it's open.
+func (writer *Writer) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.port == nil {
+		return nil
+	}
+	err := writer.port.Close()
+	writer.port = nil
+	writer.device = ""
+	return err
+}
+
+// connect opens the first of the devices that it can.  The caller must hold
+// the mutex.
+func (writer *Writer) connect() error {
+	if len(writer.devices) == 0 {
+		return errors.New("serialout - no devices")
+	}
+
+	failures := make([]string, 0, len(writer.devices))
+	for _, device := range writer.devices {
+		port, openError := writer.open(device, writer.mode)
+		if openError != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", device, openError))
+			continue
+		}
+		eventlog.Println(writer.logger, "serialout - writing to "+device)
+		writer.port = port
+		writer.device = device
+		writer.failureLogged = false
+		return nil
+	}
+
+	em := "serialout - cannot open a device - " + strings.Join(failures, ", ")
+	return errors.New(em)
+}
+
+// openPort opens a serial device.
+func openPort(device string, mode *serial.Mode) (io.WriteCloser, error) {
+	return serial.Open(device, mode)
+}
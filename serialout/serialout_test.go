@@ -0,0 +1,148 @@
+package serialout
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// fakePort is a serial line that records what's written to it and can be
+// made to fail.
+type fakePort struct {
+	bytes.Buffer
+	fail   bool
+	closed bool
+}
+
+func (port *fakePort) Write(p []byte) (int, error) {
+	if port.fail {
+		return 0, errors.New("device not configured")
+	}
+	return port.Buffer.Write(p)
+}
+
+func (port *fakePort) Close() error {
+	port.closed = true
+	return nil
+}
+
+// fakeDevices is a set of serial devices, some of which are present.
+type fakeDevices struct {
+	ports map[string]*fakePort
+}
+
+func (devices *fakeDevices) open(device string, mode *serial.Mode) (io.WriteCloser, error) {
+	port, ok := devices.ports[device]
+	if !ok {
+		return nil, errors.New("no such file or directory")
+	}
+	return port, nil
+}
+
+// newTestWriter is a helper function.  It creates a Writer for two devices
+// with fake devices and a fake clock.
+func newTestWriter(devices *fakeDevices, clock *time.Time, logBuffer *bytes.Buffer) *Writer {
+	writer := New([]string{"ttyACM0", "ttyACM1"}, &serial.Mode{BaudRate: 115200}, 0, log.New(logBuffer, "", 0))
+	writer.open = devices.open
+	writer.now = func() time.Time { return *clock }
+	return writer
+}
+
+// TestOpen checks that Open uses the first device it can and fails if there
+// is none.
+func TestOpen(t *testing.T) {
+	var logBuffer bytes.Buffer
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	devices := fakeDevices{ports: map[string]*fakePort{}}
+	writer := newTestWriter(&devices, &clock, &logBuffer)
+
+	const wantError = "serialout - cannot open a device - ttyACM0: no such file or directory, ttyACM1: no such file or directory"
+	err := writer.Open()
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+
+	devices.ports["ttyACM1"] = &fakePort{}
+	if err := writer.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if writer.Device() != "ttyACM1" {
+		t.Errorf("want ttyACM1 got %s", writer.Device())
+	}
+
+	if err := New(nil, nil, 0, nil).Open(); err == nil || err.Error() != "serialout - no devices" {
+		t.Errorf("want no devices error, got %v", err)
+	}
+}
+
+// TestWriteReconnects checks that the Writer drops data while there's no
+// device, finds the device again when it reappears under another name and
+// logs only the first of a series of failures.
+func TestWriteReconnects(t *testing.T) {
+	var logBuffer bytes.Buffer
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := &fakePort{}
+	devices := fakeDevices{ports: map[string]*fakePort{"ttyACM0": first}}
+	writer := newTestWriter(&devices, &clock, &logBuffer)
+
+	writer.Write([]byte("a"))
+	if first.String() != "a" {
+		t.Errorf("want a got %q", first.String())
+	}
+
+	// The device vanishes.  The failed write closes it.
+	first.fail = true
+	delete(devices.ports, "ttyACM0")
+	if n, err := writer.Write([]byte("b")); n != 1 || err != nil {
+		t.Errorf("want 1 and no error, got %d %v", n, err)
+	}
+	if !first.closed || writer.Device() != "" {
+		t.Error("want the port closed")
+	}
+
+	// There's no device, so data is dropped.  Only the first failure is
+	// logged and the Writer doesn't try again until the retry time is up.
+	writer.Write([]byte("c"))
+	writer.Write([]byte("d"))
+
+	// The device reappears under another name.  Before the retry time is
+	// up it's not used.
+	second := &fakePort{}
+	devices.ports["ttyACM1"] = second
+	writer.Write([]byte("e"))
+	if second.Len() != 0 {
+		t.Errorf("want nothing written before the retry time, got %q", second.String())
+	}
+
+	clock = clock.Add(DefaultRetry)
+	writer.Write([]byte("f"))
+	if second.String() != "f" {
+		t.Errorf("want f got %q", second.String())
+	}
+	if writer.Device() != "ttyACM1" {
+		t.Errorf("want ttyACM1 got %s", writer.Device())
+	}
+
+	wantLog := []string{
+		"serialout - writing to ttyACM0",
+		"serialout - lost ttyACM0 - device not configured",
+		"serialout - cannot open a device - ttyACM0: no such file or directory, ttyACM1: no such file or directory.  Retrying",
+		"serialout - writing to ttyACM1",
+	}
+	gotLog := strings.Split(strings.TrimSpace(logBuffer.String()), "\n")
+	if strings.Join(wantLog, "\n") != strings.Join(gotLog, "\n") {
+		t.Errorf("want log\n%s\ngot\n%s", strings.Join(wantLog, "\n"), strings.Join(gotLog, "\n"))
+	}
+
+	if err := writer.Close(); err != nil || !second.closed {
+		t.Errorf("want the port closed, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// The station package holds the description of a base station: its name,
+// who runs it, where it is and what antenna it has.  The description is
+// entered once, in the "station" section of an application's JSON config,
+// and used wherever it's needed, for example on the proxy's status page:
+//
+//	"station": {
+//	    "name": "HOME00GBR0",
+//	    "operator": "Example Surveys Ltd",
+//	    "contact": "base@example.com",
+//	    "position": {"x": 3977478.6, "y": -9616.8, "z": 4968953.4},
+//	    "antenna_model": "TRM59800.00     SCIS",
+//	    "antenna_height_metres": 0.082
+//	}
+//
+//	if err := config.Station.Validate(); err != nil { ... }
+//	display := config.Station.String(100)
+package station
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MaxAntennaModelLength is the longest antenna model allowed.  It's the
+// width of the antenna type in a RINEX header, which is the same as the
+// descriptor in the IGS table of antennas: a 15-character model followed
+// by a space and a 4-character radome code.
+const MaxAntennaModelLength = 20
+
+// Position is the surveyed position of the antenna reference point as
+// Earth-centred, Earth-fixed (ECEF) coordinates in metres, the same form
+// as in a message of type 1005.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Config describes a base station.
+type Config struct {
+	// Name is the name of the station, typically the mountpoint name or a
+	// RINEX marker name.
+	Name string `json:"name"`
+
+	// Operator is the person or organisation that runs the station.
+	Operator string `json:"operator"`
+
+	// Contact is an email address or similar for the operator.
+	Contact string `json:"contact"`
+
+	// Position is the surveyed position.  It may be nil if the station
+	// hasn't been surveyed.
+	Position *Position `json:"position"`
+
+	// AntennaModel is the antenna model and radome, as in the IGS table of
+	// antennas.
+	AntennaModel string `json:"antenna_model"`
+
+	// AntennaHeightMetres is the height of the antenna reference point
+	// above the marker.
+	AntennaHeightMetres float64 `json:"antenna_height_metres"`
+}
+
+// Validate checks the description.  A nil config is valid - it means that
+// the station isn't described.
+func (config *Config) Validate() error {
+	if config == nil {
+		return nil
+	}
+
+	if len(strings.TrimSpace(config.Name)) == 0 {
+		return errors.New("station - want a name")
+	}
+
+	if len(config.AntennaModel) > MaxAntennaModelLength {
+		em := fmt.Sprintf("station %s - antenna model %q is longer than %d characters",
+			config.Name, config.AntennaModel, MaxAntennaModelLength)
+		return errors.New(em)
+	}
+
+	if config.AntennaHeightMetres < 0 {
+		em := fmt.Sprintf("station %s - antenna height %.4f is negative",
+			config.Name, config.AntennaHeightMetres)
+		return errors.New(em)
+	}
+
+	return nil
+}
+
+// String returns a readable version of the description.  The coordinates of
+// the position are rounded to the given precision in metres, so that a
+// status page doesn't give away the exact location.  Zero gives the exact
+// position.
+func (config *Config) String(precision float64) string {
+	if config == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Station %s\n", config.Name)
+	if len(config.Operator) > 0 {
+		fmt.Fprintf(&b, "Operator %s\n", config.Operator)
+	}
+	if len(config.Contact) > 0 {
+		fmt.Fprintf(&b, "Contact %s\n", config.Contact)
+	}
+	if config.Position != nil {
+		fmt.Fprintf(&b, "Position {%.4f, %.4f, %.4f}\n",
+			coarsen(config.Position.X, precision),
+			coarsen(config.Position.Y, precision),
+			coarsen(config.Position.Z, precision))
+	}
+	if len(config.AntennaModel) > 0 {
+		fmt.Fprintf(&b, "Antenna %s height %.4f\n", config.AntennaModel, config.AntennaHeightMetres)
+	}
+
+	return b.String()
+}
+
+// coarsen rounds the value to the nearest multiple of the precision.
+func coarsen(value, precision float64) float64 {
+	if precision <= 0 {
+		return value
+	}
+	return math.Round(value/precision) * precision
+}
@@ -0,0 +1,90 @@
+package station
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// TestValidate checks that Validate accepts good descriptions and rejects
+// bad ones.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      *Config
+		wantError   string
+	}{
+		{"nil", nil, ""},
+		{"name only", &Config{Name: "HOME00GBR0"}, ""},
+		{"full", &Config{Name: "HOME", AntennaModel: "TRM59800.00     SCIS", AntennaHeightMetres: 0.1}, ""},
+		{"no name", &Config{Operator: "me"}, "station - want a name"},
+		{"long antenna", &Config{Name: "HOME", AntennaModel: "TRM59800.00      SCIS"},
+			`station HOME - antenna model "TRM59800.00      SCIS" is longer than 20 characters`},
+		{"negative height", &Config{Name: "HOME", AntennaHeightMetres: -1},
+			"station HOME - antenna height -1.0000 is negative"},
+	}
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.wantError)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestString checks the readable version of a description, with and
+// without the position rounded.
+func TestString(t *testing.T) {
+	config := Config{
+		Name:                "HOME00GBR0",
+		Operator:            "Example Surveys Ltd",
+		Contact:             "base@example.com",
+		Position:            &Position{X: 3977478.6123, Y: -9616.8456, Z: 4968953.4789},
+		AntennaModel:        "TRM59800.00     SCIS",
+		AntennaHeightMetres: 0.082,
+	}
+
+	var testData = []struct {
+		precision float64
+		want      string
+	}{
+		{0, `Station HOME00GBR0
+Operator Example Surveys Ltd
+Contact base@example.com
+Position {3977478.6123, -9616.8456, 4968953.4789}
+Antenna TRM59800.00     SCIS height 0.0820
+`},
+		{100, `Station HOME00GBR0
+Operator Example Surveys Ltd
+Contact base@example.com
+Position {3977500.0000, -9600.0000, 4969000.0000}
+Antenna TRM59800.00     SCIS height 0.0820
+`},
+	}
+	for _, td := range testData {
+		got := config.String(td.precision)
+		if got != td.want {
+			t.Errorf("precision %f:\n%s", td.precision, diff.Diff(td.want, got))
+		}
+	}
+
+	// Only the name is required.
+	nameOnly := Config{Name: "HOME"}
+	if got := nameOnly.String(0); got != "Station HOME\n" {
+		t.Errorf("want just the name, got %q", got)
+	}
+
+	var none *Config
+	if got := none.String(0); got != "" {
+		t.Errorf("want nothing, got %q", got)
+	}
+}
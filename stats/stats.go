@@ -0,0 +1,483 @@
+// The stats package keeps rolling statistics about the observations in a
+// stream of RTCM messages, so that slow changes such as a failing antenna
+// or a cable letting in water show up before the rovers lose their fix.
+// Over a window of recent time (ten minutes unless told otherwise) the
+// Aggregator keeps:
+//
+//   - the satellites seen in each epoch of each constellation,
+//   - the mean carrier to noise ratio (CNR) of each signal of each
+//     constellation, from MSM4 to MSM7 (MSM1 to MSM3 don't carry it),
+//   - the gaps between the messages of each type, and
+//   - the completeness of the epochs - the proportion of them that contain
+//     observations from all of the constellations seen in the window.
+//
+// A falling CNR across all signals points to the antenna or its cable, a
+// falling CNR on one constellation's signals points to interference and a
+// falling number of satellites points to an obstruction.
+//
+// The application creates an Aggregator and feeds it:
+//
+//	aggregator := stats.New(0)
+//	aggregator.Observe(&message)  // Call for each message.
+//	snapshot := aggregator.Snapshot()
+//
+// The metrics package serves the figures to Prometheus - see its
+// WatchStats method.
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	msm123Message "github.com/goblimey/go-ntrip/rtcm/type_msm123/message"
+	msm4Message "github.com/goblimey/go-ntrip/rtcm/type_msm4/message"
+	msm5Message "github.com/goblimey/go-ntrip/rtcm/type_msm5/message"
+	msm6Message "github.com/goblimey/go-ntrip/rtcm/type_msm6/message"
+	msm7Message "github.com/goblimey/go-ntrip/rtcm/type_msm7/message"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// DefaultWindow is the window used when New is given zero.
+const DefaultWindow = 10 * time.Minute
+
+// Snapshot holds the statistics over the window at one time.
+type Snapshot struct {
+	// At is the time at which the snapshot was taken.
+	At time.Time `json:"at"`
+
+	// WindowSeconds is the length of the window.
+	WindowSeconds float64 `json:"window_seconds"`
+
+	// Constellations gives the satellites seen in each constellation, by
+	// name.
+	Constellations map[string]Satellites `json:"constellations"`
+
+	// Signals gives the mean CNR of each signal, in order of constellation
+	// and signal ID.
+	Signals []Signal `json:"signals"`
+
+	// Messages gives the gaps between the messages of each type, by type.
+	Messages map[int]Gaps `json:"messages"`
+
+	// Epochs gives the completeness of the epochs.
+	Epochs Completeness `json:"epochs"`
+}
+
+// Satellites describes the satellites seen in the epochs of one
+// constellation.
+type Satellites struct {
+	// Epochs is the number of epochs seen.
+	Epochs int `json:"epochs"`
+
+	// Latest is the number of satellites in the latest epoch.
+	Latest int `json:"latest"`
+
+	// Min, Mean and Max summarise the number of satellites in the epochs.
+	Min  int     `json:"min"`
+	Mean float64 `json:"mean"`
+	Max  int     `json:"max"`
+}
+
+// Signal gives the mean CNR of one signal of one constellation.
+type Signal struct {
+	Constellation string `json:"constellation"`
+
+	// ID is the signal ID from the MSM, 1 to 32.  Its meaning depends on
+	// the constellation.
+	ID uint `json:"id"`
+
+	// Observations is the number of satellites' observations of the
+	// signal that carried a CNR.
+	Observations int `json:"observations"`
+
+	// MeanCNR is the mean CNR in dB-Hz.
+	MeanCNR float64 `json:"mean_cnr"`
+}
+
+// Gaps describes the gaps between the messages of one type.
+type Gaps struct {
+	// Count is the number of messages seen.
+	Count int `json:"count"`
+
+	// LastSeen is the time that the last message arrived.
+	LastSeen time.Time `json:"last_seen"`
+
+	// MeanIntervalSeconds is the mean time between the messages, zero if
+	// fewer than two were seen.
+	MeanIntervalSeconds float64 `json:"mean_interval_seconds"`
+
+	// MaxGapSeconds is the longest time between two of the messages, or
+	// since the last one if that's longer.
+	MaxGapSeconds float64 `json:"max_gap_seconds"`
+}
+
+// Completeness describes the completeness of the epochs.  The latest epoch
+// isn't counted, as more of it may be on its way.
+type Completeness struct {
+	// Epochs is the number of epochs seen.
+	Epochs int `json:"epochs"`
+
+	// Complete is the number of epochs that contain observations from all
+	// of the constellations seen in the window.
+	Complete int `json:"complete"`
+
+	// Percent is the percentage of the epochs that are complete, 100 if
+	// there are none.
+	Percent float64 `json:"percent"`
+}
+
+// epoch records the satellites in one epoch of one constellation.
+type epoch struct {
+	arrival    time.Time
+	timestamp  uint
+	satellites map[uint]bool
+}
+
+// signalKey identifies a signal.
+type signalKey struct {
+	constellation string
+	id            uint
+}
+
+// cnrSample is the total CNR of a signal over the satellites in one
+// message.
+type cnrSample struct {
+	arrival time.Time
+	total   float64
+	n       int
+}
+
+// epochTime records the constellations seen in an epoch of the stream.
+type epochTime struct {
+	arrival        time.Time
+	constellations map[string]bool
+}
+
+// Aggregator keeps the statistics.  It's safe for concurrent use.
+type Aggregator struct {
+	// window is the period over which the statistics are kept.
+	window time.Duration
+
+	// epochs holds the recent epochs of each constellation, oldest first.
+	epochs map[string][]*epoch
+
+	// cnr holds the recent CNR samples of each signal, oldest first.
+	cnr map[signalKey][]cnrSample
+
+	// arrivals holds the recent arrival times of the messages of each
+	// type, oldest first.
+	arrivals map[int][]time.Time
+
+	// epochTimes holds the constellations seen in each recent epoch of
+	// the stream, by the time of the epoch in UTC.
+	epochTimes map[time.Time]*epochTime
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// New creates an Aggregator that keeps statistics over the given window.
+// Zero means DefaultWindow.
+func New(window time.Duration) *Aggregator {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	aggregator := Aggregator{
+		window:     window,
+		epochs:     make(map[string][]*epoch),
+		cnr:        make(map[signalKey][]cnrSample),
+		arrivals:   make(map[int][]time.Time),
+		epochTimes: make(map[time.Time]*epochTime),
+		now:        time.Now,
+	}
+	return &aggregator
+}
+
+// Observe takes a message into the statistics.  Non-RTCM data is ignored.
+// An MSM that hasn't been decoded is decoded here, without changing the
+// caller's copy.
+func (aggregator *Aggregator) Observe(message *rtcm.Message) {
+	if message == nil || message.MessageType < 0 {
+		return
+	}
+
+	var observations *msmObservations
+	if utils.MSM(message.MessageType) {
+		observations = getObservations(message)
+	}
+
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	now := aggregator.now()
+	aggregator.arrivals[message.MessageType] = append(aggregator.arrivals[message.MessageType], now)
+
+	if observations != nil {
+		aggregator.addObservations(message, observations, now)
+	}
+
+	aggregator.prune(now)
+}
+
+// addObservations adds the observations from an MSM.
+func (aggregator *Aggregator) addObservations(message *rtcm.Message, observations *msmObservations, now time.Time) {
+	constellation := utils.GetConstellation(message.MessageType)
+
+	// An epoch of a constellation may be split across several messages
+	// and may be sent as more than one MSM type, all with the same
+	// timestamp.
+	epochs := aggregator.epochs[constellation]
+	var latest *epoch
+	if len(epochs) > 0 && epochs[len(epochs)-1].timestamp == message.Timestamp {
+		latest = epochs[len(epochs)-1]
+	} else {
+		latest = &epoch{arrival: now, timestamp: message.Timestamp, satellites: make(map[uint]bool)}
+		aggregator.epochs[constellation] = append(epochs, latest)
+	}
+	for _, satellite := range observations.satellites {
+		latest.satellites[satellite] = true
+	}
+
+	for id, sample := range observations.cnr {
+		key := signalKey{constellation: constellation, id: id}
+		sample.arrival = now
+		aggregator.cnr[key] = append(aggregator.cnr[key], sample)
+	}
+
+	if !message.SentAt.IsZero() {
+		et, found := aggregator.epochTimes[message.SentAt]
+		if !found {
+			et = &epochTime{arrival: now, constellations: make(map[string]bool)}
+			aggregator.epochTimes[message.SentAt] = et
+		}
+		et.constellations[constellation] = true
+	}
+}
+
+// prune drops everything that arrived before the window.
+func (aggregator *Aggregator) prune(now time.Time) {
+	start := now.Add(-aggregator.window)
+
+	for constellation, epochs := range aggregator.epochs {
+		i := 0
+		for i < len(epochs) && epochs[i].arrival.Before(start) {
+			i++
+		}
+		if i == len(epochs) {
+			delete(aggregator.epochs, constellation)
+		} else {
+			aggregator.epochs[constellation] = epochs[i:]
+		}
+	}
+
+	for key, samples := range aggregator.cnr {
+		i := 0
+		for i < len(samples) && samples[i].arrival.Before(start) {
+			i++
+		}
+		if i == len(samples) {
+			delete(aggregator.cnr, key)
+		} else {
+			aggregator.cnr[key] = samples[i:]
+		}
+	}
+
+	// The arrivals of a type that has stopped are kept until the gap is
+	// a window long, so that the gap shows.
+	for messageType, arrivals := range aggregator.arrivals {
+		i := 0
+		for i < len(arrivals)-1 && arrivals[i].Before(start) {
+			i++
+		}
+		if arrivals[len(arrivals)-1].Before(start.Add(-aggregator.window)) {
+			delete(aggregator.arrivals, messageType)
+		} else {
+			aggregator.arrivals[messageType] = arrivals[i:]
+		}
+	}
+
+	for sentAt, et := range aggregator.epochTimes {
+		if et.arrival.Before(start) {
+			delete(aggregator.epochTimes, sentAt)
+		}
+	}
+}
+
+// Snapshot returns the statistics over the window.
+func (aggregator *Aggregator) Snapshot() *Snapshot {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	now := aggregator.now()
+	aggregator.prune(now)
+
+	snapshot := Snapshot{
+		At:             now,
+		WindowSeconds:  aggregator.window.Seconds(),
+		Constellations: make(map[string]Satellites),
+		Signals:        make([]Signal, 0, len(aggregator.cnr)),
+		Messages:       make(map[int]Gaps),
+	}
+
+	for constellation, epochs := range aggregator.epochs {
+		satellites := Satellites{Epochs: len(epochs), Min: len(epochs[0].satellites)}
+		total := 0
+		for _, e := range epochs {
+			n := len(e.satellites)
+			total += n
+			if n < satellites.Min {
+				satellites.Min = n
+			}
+			if n > satellites.Max {
+				satellites.Max = n
+			}
+		}
+		satellites.Latest = len(epochs[len(epochs)-1].satellites)
+		satellites.Mean = float64(total) / float64(len(epochs))
+		snapshot.Constellations[constellation] = satellites
+	}
+
+	for key, samples := range aggregator.cnr {
+		signal := Signal{Constellation: key.constellation, ID: key.id}
+		var total float64
+		for _, sample := range samples {
+			total += sample.total
+			signal.Observations += sample.n
+		}
+		signal.MeanCNR = total / float64(signal.Observations)
+		snapshot.Signals = append(snapshot.Signals, signal)
+	}
+	sort.Slice(snapshot.Signals, func(i, j int) bool {
+		a, b := snapshot.Signals[i], snapshot.Signals[j]
+		if a.Constellation != b.Constellation {
+			return a.Constellation < b.Constellation
+		}
+		return a.ID < b.ID
+	})
+
+	for messageType, arrivals := range aggregator.arrivals {
+		last := arrivals[len(arrivals)-1]
+		gaps := Gaps{Count: len(arrivals), LastSeen: last}
+		if len(arrivals) > 1 {
+			gaps.MeanIntervalSeconds = last.Sub(arrivals[0]).Seconds() / float64(len(arrivals)-1)
+		}
+		maxGap := now.Sub(last)
+		for i := 1; i < len(arrivals); i++ {
+			if gap := arrivals[i].Sub(arrivals[i-1]); gap > maxGap {
+				maxGap = gap
+			}
+		}
+		gaps.MaxGapSeconds = maxGap.Seconds()
+		snapshot.Messages[messageType] = gaps
+	}
+
+	snapshot.Epochs = aggregator.completeness()
+
+	return &snapshot
+}
+
+// completeness returns the completeness of the epochs in the window.
+func (aggregator *Aggregator) completeness() Completeness {
+	completeness := Completeness{Percent: 100}
+
+	var latest time.Time
+	seen := make(map[string]bool)
+	for sentAt, et := range aggregator.epochTimes {
+		if sentAt.After(latest) {
+			latest = sentAt
+		}
+		for constellation := range et.constellations {
+			seen[constellation] = true
+		}
+	}
+
+	for sentAt, et := range aggregator.epochTimes {
+		if sentAt.Equal(latest) {
+			continue
+		}
+		completeness.Epochs++
+		if len(et.constellations) == len(seen) {
+			completeness.Complete++
+		}
+	}
+
+	if completeness.Epochs > 0 {
+		completeness.Percent = float64(completeness.Complete) * 100 / float64(completeness.Epochs)
+	}
+
+	return completeness
+}
+
+// msmObservations holds what the statistics need from an MSM.
+type msmObservations struct {
+	// satellites holds the IDs of the satellites observed.
+	satellites []uint
+
+	// cnr holds the total CNR of each signal, by signal ID.
+	cnr map[uint]cnrSample
+}
+
+// getObservations returns the observations in an MSM, nil if it can't be
+// decoded.
+func getObservations(message *rtcm.Message) *msmObservations {
+	readable := message.Readable
+	if readable == nil {
+		decoded := message.Copy()
+		rtcm.PrepareForDisplay(&decoded)
+		readable = decoded.Readable
+	}
+
+	observations := msmObservations{cnr: make(map[uint]cnrSample)}
+	add := func(id uint, cnr float64) {
+		// Zero means that the CNR is not available.
+		if cnr == 0 {
+			return
+		}
+		sample := observations.cnr[id]
+		sample.total += cnr
+		sample.n++
+		observations.cnr[id] = sample
+	}
+
+	switch m := readable.(type) {
+	case *msm123Message.Message:
+		observations.satellites = m.Header.Satellites
+	case *msm4Message.Message:
+		observations.satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				add(cells[i].ID, cells[i].CNR())
+			}
+		}
+	case *msm5Message.Message:
+		observations.satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				add(cells[i].ID, cells[i].CNR())
+			}
+		}
+	case *msm6Message.Message:
+		observations.satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				add(cells[i].ID, cells[i].CNR())
+			}
+		}
+	case *msm7Message.Message:
+		observations.satellites = m.Header.Satellites
+		for _, cells := range m.Signals {
+			for i := range cells {
+				add(cells[i].ID, cells[i].CNR())
+			}
+		}
+	default:
+		return nil
+	}
+
+	return &observations
+}
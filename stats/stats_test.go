@@ -0,0 +1,172 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// The test frames hold these observations:
+//
+//	1077: satellites 4, 9, 16, 18, 25, 26, 29 and 31, signal 2 with a
+//	      total CNR of 302 over 7 satellites, signal 16 with 263 over 7.
+//	1074: satellite 4, signal 2 with a CNR of 7, signal 16 with 16.
+
+// msm is a helper function.  It returns an MSM of the given type made from
+// one of the test frames, with the given timestamp and time of the epoch.
+func msm(messageType int, timestamp uint, sentAt time.Time) *rtcm.Message {
+	frame := testdata.MessageFrameType1074_2
+	if utils.MSM7(messageType) {
+		frame = testdata.MessageFrameType1077
+	}
+	return &rtcm.Message{
+		MessageType: messageType,
+		RawData:     testdata.Retype(frame, messageType),
+		Timestamp:   timestamp,
+		SentAt:      sentAt,
+	}
+}
+
+// closeTo checks that two floats are nearly equal.
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestSnapshot checks the statistics from a few epochs.
+func TestSnapshot(t *testing.T) {
+	start := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	now := start
+	aggregator := New(0)
+	aggregator.now = func() time.Time { return now }
+
+	// Four epochs a second apart.  The second has only an MSM4 from GPS and
+	// nothing from GLONASS, so it's incomplete.  In the third GPS sends an
+	// MSM7 and an MSM4.  The fourth is the latest, which isn't counted for
+	// completeness.
+	epochs := [][]*rtcm.Message{
+		{msm(1077, 1, start), msm(1084, 11, start)},
+		{msm(1074, 2, start.Add(time.Second))},
+		{msm(1077, 3, start.Add(2*time.Second)), msm(1074, 3, start.Add(2*time.Second)),
+			msm(1084, 13, start.Add(2*time.Second))},
+		{msm(1077, 4, start.Add(3*time.Second))},
+	}
+	for i, messages := range epochs {
+		now = start.Add(time.Duration(i) * time.Second)
+		for _, message := range messages {
+			aggregator.Observe(message)
+		}
+	}
+	aggregator.Observe(&rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")})
+	aggregator.Observe(nil)
+
+	now = start.Add(8 * time.Second)
+	got := aggregator.Snapshot()
+
+	if got.WindowSeconds != DefaultWindow.Seconds() {
+		t.Errorf("want a window of %f got %f", DefaultWindow.Seconds(), got.WindowSeconds)
+	}
+
+	wantConstellations := map[string]Satellites{
+		"GPS":     {Epochs: 4, Latest: 8, Min: 1, Mean: 6.25, Max: 8},
+		"Glonass": {Epochs: 2, Latest: 1, Min: 1, Mean: 1, Max: 1},
+	}
+	if !cmp.Equal(wantConstellations, got.Constellations) {
+		t.Errorf("%s", cmp.Diff(wantConstellations, got.Constellations))
+	}
+
+	wantSignals := []Signal{
+		{Constellation: "GPS", ID: 2, Observations: 23, MeanCNR: 920.0 / 23},
+		{Constellation: "GPS", ID: 16, Observations: 23, MeanCNR: 821.0 / 23},
+		{Constellation: "Glonass", ID: 2, Observations: 2, MeanCNR: 7},
+		{Constellation: "Glonass", ID: 16, Observations: 2, MeanCNR: 16},
+	}
+	if len(got.Signals) != len(wantSignals) {
+		t.Fatalf("want %d signals got %+v", len(wantSignals), got.Signals)
+	}
+	for i, want := range wantSignals {
+		signal := got.Signals[i]
+		if signal.Constellation != want.Constellation || signal.ID != want.ID ||
+			signal.Observations != want.Observations || !closeTo(signal.MeanCNR, want.MeanCNR) {
+			t.Errorf("%d: want %+v got %+v", i, want, signal)
+		}
+	}
+
+	gaps := got.Messages[1077]
+	if gaps.Count != 3 || !gaps.LastSeen.Equal(start.Add(3*time.Second)) ||
+		gaps.MeanIntervalSeconds != 1.5 || gaps.MaxGapSeconds != 5 {
+		t.Errorf("unexpected gaps for 1077 %+v", gaps)
+	}
+	gaps = got.Messages[1084]
+	if gaps.Count != 2 || gaps.MeanIntervalSeconds != 2 || gaps.MaxGapSeconds != 6 {
+		t.Errorf("unexpected gaps for 1084 %+v", gaps)
+	}
+	if _, found := got.Messages[utils.NonRTCMMessage]; found {
+		t.Error("want no figures for non-RTCM data")
+	}
+
+	wantEpochs := Completeness{Epochs: 3, Complete: 2, Percent: 200.0 / 3}
+	if got.Epochs.Epochs != wantEpochs.Epochs || got.Epochs.Complete != wantEpochs.Complete ||
+		!closeTo(got.Epochs.Percent, wantEpochs.Percent) {
+		t.Errorf("want %+v got %+v", wantEpochs, got.Epochs)
+	}
+}
+
+// TestWindow checks that old observations are dropped.
+func TestWindow(t *testing.T) {
+	start := time.Now()
+	now := start
+	aggregator := New(time.Minute)
+	aggregator.now = func() time.Time { return now }
+
+	aggregator.Observe(msm(1077, 1, start))
+	now = start.Add(time.Second)
+	aggregator.Observe(msm(1077, 2, now))
+
+	// After two minutes the observations have gone but the message type is
+	// still shown, with the gap since it was last seen.
+	now = start.Add(2 * time.Minute)
+	got := aggregator.Snapshot()
+	if len(got.Constellations) != 0 || len(got.Signals) != 0 {
+		t.Errorf("want no observations got %+v", got)
+	}
+	wantEpochs := Completeness{Percent: 100}
+	if got.Epochs != wantEpochs {
+		t.Errorf("want %+v got %+v", wantEpochs, got.Epochs)
+	}
+	gaps, found := got.Messages[1077]
+	if !found || gaps.Count != 1 || gaps.MaxGapSeconds != 119 {
+		t.Errorf("unexpected gaps %+v", gaps)
+	}
+
+	// After two windows without it, the message type is dropped.
+	now = start.Add(3 * time.Minute)
+	if got := aggregator.Snapshot(); len(got.Messages) != 0 {
+		t.Errorf("want no message types got %+v", got.Messages)
+	}
+}
+
+// TestDecoded checks that a message that has already been decoded is used
+// as it is.
+func TestDecoded(t *testing.T) {
+	message := msm(1077, 1, time.Time{})
+	rtcm.Analyse(message)
+	message.RawData = nil
+
+	aggregator := New(0)
+	aggregator.Observe(message)
+
+	got := aggregator.Snapshot()
+	if got.Constellations["GPS"].Latest != 8 {
+		t.Errorf("want 8 satellites got %+v", got.Constellations)
+	}
+	// Without the time of the epoch, the completeness isn't known.
+	if got.Epochs.Epochs != 0 {
+		t.Errorf("want no epochs got %+v", got.Epochs)
+	}
+}
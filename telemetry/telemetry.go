@@ -0,0 +1,275 @@
+// The telemetry package reports anonymous statistics about the messages that
+// an application handles, if the user opts in.
+//
+// The maintainers of go-ntrip have no idea which message types and
+// constellations people's base stations actually send, so they can't tell
+// which decoders are worth writing next.  The Reporter counts the messages
+// and at intervals sends a Report to a configurable endpoint.  A report
+// holds only aggregate figures - the rate of each message type, the share
+// of the MSMs from each constellation and the version of the software.  It
+// doesn't contain the station ID, the position, the host name or anything
+// else that identifies the user.
+//
+// Telemetry is off unless the application's config has a telemetry section:
+//
+//	"telemetry": {
+//	    "endpoint": "https://telemetry.example.com/go-ntrip",
+//	    "interval_hours": 24
+//	}
+//
+// and the application runs the Reporter:
+//
+//	reporter, err := telemetry.New(config, version.String("rtcmfilter"), logger)
+//	...
+//	reporter.Count(&message)  // Call for each message.
+//	go reporter.Run(nil)
+//
+// By default the report is POSTed to the endpoint as JSON.  SetSender plugs
+// in some other way to send it.
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// DefaultInterval is the time between reports used when the config doesn't
+// give one.
+const DefaultInterval = 24 * time.Hour
+
+// SchemaVersion is the version of the JSON form of Report, following the
+// same rules as the handler's StatsSchemaVersion.
+const SchemaVersion = 1
+
+// httpTimeout is the time allowed for a report to be POSTed.
+const httpTimeout = 30 * time.Second
+
+// Config is the config of a Reporter, as it appears in an application's
+// JSON config file.
+type Config struct {
+	// Endpoint is the http or https URL to which reports are sent.
+	Endpoint string `json:"endpoint"`
+
+	// IntervalHours is the time between reports.  0 means DefaultInterval.
+	IntervalHours uint `json:"interval_hours"`
+}
+
+// Interval returns the time between reports.
+func (config *Config) Interval() time.Duration {
+	if config.IntervalHours == 0 {
+		return DefaultInterval
+	}
+	return time.Duration(config.IntervalHours) * time.Hour
+}
+
+// Report holds the statistics for one period.
+type Report struct {
+	// SchemaVersion is SchemaVersion.
+	SchemaVersion int `json:"schema_version"`
+
+	// Version describes the software, as given by version.String.
+	Version string `json:"version"`
+
+	// PeriodSeconds is the length of the period covered by the report.
+	PeriodSeconds int64 `json:"period_seconds"`
+
+	// MessagesPerHour gives the rate of each RTCM message type seen during
+	// the period.
+	MessagesPerHour map[int]float64 `json:"messages_per_hour"`
+
+	// ConstellationShare gives, for each constellation seen in MSMs, the
+	// proportion of the MSMs that came from it.  The shares add up to 1.
+	ConstellationShare map[string]float64 `json:"constellation_share"`
+}
+
+// Sender sends a report somewhere.
+type Sender interface {
+	Send(report *Report) error
+}
+
+// Reporter counts messages and sends reports.
+type Reporter struct {
+	// version describes the software.
+	version string
+
+	// interval is the time between reports when the Reporter is running.
+	interval time.Duration
+
+	// sender sends the reports.
+	sender Sender
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// byType holds the number of messages of each type seen in the
+	// current period.
+	byType map[int]uint64
+
+	// periodStart is the start of the current period.
+	periodStart time.Time
+
+	// now returns the current time.  It's a variable to support testing.
+	now func() time.Time
+
+	// The mutex controls access to byType, periodStart and sender.
+	mutex sync.Mutex
+}
+
+// New creates a Reporter that sends reports to the endpoint in the config.
+// The version describes the software.  The logger may be nil.
+func New(config Config, version string, logger *log.Logger) (*Reporter, error) {
+	endpoint, parseError := url.Parse(config.Endpoint)
+	if parseError != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || len(endpoint.Host) == 0 {
+		em := fmt.Sprintf("telemetry - the endpoint %q is not an http or https URL", config.Endpoint)
+		return nil, errors.New(em)
+	}
+
+	reporter := Reporter{
+		version:  version,
+		interval: config.Interval(),
+		sender:   NewHTTPSender(config.Endpoint),
+		logger:   logger,
+		byType:   make(map[int]uint64),
+		now:      time.Now,
+	}
+	reporter.periodStart = reporter.now()
+
+	return &reporter, nil
+}
+
+// SetSender replaces the sender that the Reporter uses.
+func (reporter *Reporter) SetSender(sender Sender) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.sender = sender
+}
+
+// Count counts a message.  Non-RTCM data is ignored.
+func (reporter *Reporter) Count(message *rtcm.Message) {
+	if message == nil || message.MessageType == utils.NonRTCMMessage {
+		return
+	}
+
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.byType[message.MessageType]++
+}
+
+// Report returns the report for the period so far and starts a new period.
+func (reporter *Reporter) Report() *Report {
+	reporter.mutex.Lock()
+	byType := reporter.byType
+	periodStart := reporter.periodStart
+	reporter.byType = make(map[int]uint64)
+	reporter.periodStart = reporter.now()
+	reporter.mutex.Unlock()
+
+	period := reporter.periodStart.Sub(periodStart)
+
+	report := Report{
+		SchemaVersion:      SchemaVersion,
+		Version:            reporter.version,
+		PeriodSeconds:      int64(period / time.Second),
+		MessagesPerHour:    make(map[int]float64),
+		ConstellationShare: make(map[string]float64),
+	}
+
+	var msms uint64
+	msmsByConstellation := make(map[string]uint64)
+	for messageType, n := range byType {
+		if period > 0 {
+			report.MessagesPerHour[messageType] = float64(n) / period.Hours()
+		}
+		if utils.MSM(messageType) {
+			msms += n
+			msmsByConstellation[utils.GetConstellation(messageType)] += n
+		}
+	}
+
+	for constellation, n := range msmsByConstellation {
+		report.ConstellationShare[constellation] = float64(n) / float64(msms)
+	}
+
+	return &report
+}
+
+// Send sends the report for the period so far and starts a new period.  A
+// failure is logged and the figures for the period are lost.
+func (reporter *Reporter) Send() error {
+	report := reporter.Report()
+
+	reporter.mutex.Lock()
+	sender := reporter.sender
+	reporter.mutex.Unlock()
+
+	err := sender.Send(report)
+	if err != nil {
+		eventlog.Println(reporter.logger, err.Error())
+	}
+	return err
+}
+
+// Run sends a report at intervals until the stop channel is closed.  If the
+// channel is nil, it runs forever.  It can be run in a goroutine.
+func (reporter *Reporter) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(reporter.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reporter.Send()
+		}
+	}
+}
+
+// HTTPSender POSTs reports to an endpoint as JSON.
+type HTTPSender struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPSender creates an HTTPSender for the given endpoint.
+func NewHTTPSender(endpoint string) *HTTPSender {
+	sender := HTTPSender{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: httpTimeout},
+	}
+	return &sender
+}
+
+// Send POSTs the report.
+func (sender *HTTPSender) Send(report *Report) error {
+	body, marshalError := json.Marshal(report)
+	if marshalError != nil {
+		em := fmt.Sprintf("telemetry - cannot encode the report - %v", marshalError)
+		return errors.New(em)
+	}
+
+	response, postError := sender.client.Post(sender.endpoint, "application/json", bytes.NewReader(body))
+	if postError != nil {
+		em := fmt.Sprintf("telemetry - report failed - %v", postError)
+		return errors.New(em)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		em := fmt.Sprintf("telemetry - report failed - %s", response.Status)
+		return errors.New(em)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// recorder is a Sender that records the reports.
+type recorder struct {
+	reports []*Report
+}
+
+func (r *recorder) Send(report *Report) error {
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+// TestNew checks that New checks the endpoint.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		endpoint  string
+		wantError string
+	}{
+		{"https://telemetry.example.com/go-ntrip", ""},
+		{"http://localhost:8080", ""},
+		{"", `telemetry - the endpoint "" is not an http or https URL`},
+		{"ftp://example.com", `telemetry - the endpoint "ftp://example.com" is not an http or https URL`},
+		{"https://", `telemetry - the endpoint "https://" is not an http or https URL`},
+	}
+	for _, td := range testData {
+		_, err := New(Config{Endpoint: td.endpoint}, "test", nil)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.endpoint, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.endpoint, td.wantError)
+		} else if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.endpoint, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestInterval checks the interval between reports.
+func TestInterval(t *testing.T) {
+	var testData = []struct {
+		hours uint
+		want  time.Duration
+	}{
+		{0, DefaultInterval},
+		{6, 6 * time.Hour},
+	}
+	for _, td := range testData {
+		config := Config{IntervalHours: td.hours}
+		got := config.Interval()
+		if got != td.want {
+			t.Errorf("%d: want %v got %v", td.hours, td.want, got)
+		}
+	}
+}
+
+// TestReport checks the figures in a report and that a new period starts.
+func TestReport(t *testing.T) {
+	reporter, _ := New(Config{Endpoint: "https://example.com"}, "rtcmfilter v1.2.0", nil)
+
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	reporter.now = func() time.Time { return now }
+	reporter.periodStart = start
+
+	// In two hours, 3600 GPS MSM7s, 2400 Galileo MSM7s, 7 messages of type
+	// 1005 and some junk, which doesn't count.
+	counts := map[int]int{
+		utils.MessageTypeMSM7GPS:     3600,
+		utils.MessageTypeMSM7Galileo: 2400,
+		utils.MessageType1005:        7,
+		utils.NonRTCMMessage:         5,
+	}
+	for messageType, n := range counts {
+		for i := 0; i < n; i++ {
+			reporter.Count(&rtcm.Message{MessageType: messageType})
+		}
+	}
+	reporter.Count(nil)
+	now = start.Add(2 * time.Hour)
+
+	want := &Report{
+		SchemaVersion: SchemaVersion,
+		Version:       "rtcmfilter v1.2.0",
+		PeriodSeconds: 7200,
+		MessagesPerHour: map[int]float64{
+			utils.MessageTypeMSM7GPS:     1800,
+			utils.MessageTypeMSM7Galileo: 1200,
+			utils.MessageType1005:        3.5,
+		},
+		ConstellationShare: map[string]float64{"GPS": 0.6, "Galileo": 0.4},
+	}
+
+	got := reporter.Report()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	// The next report covers a new, empty period.
+	now = start.Add(3 * time.Hour)
+	next := reporter.Report()
+	if next.PeriodSeconds != 3600 || len(next.MessagesPerHour) != 0 || len(next.ConstellationShare) != 0 {
+		t.Errorf("want an empty report for one hour got %+v", next)
+	}
+}
+
+// TestSetSender checks that Send uses a plugged-in sender.
+func TestSetSender(t *testing.T) {
+	reporter, _ := New(Config{Endpoint: "https://example.com"}, "test", nil)
+	r := &recorder{}
+	reporter.SetSender(r)
+
+	reporter.Count(&rtcm.Message{MessageType: utils.MessageType1005})
+	if err := reporter.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.reports) != 1 {
+		t.Fatalf("want 1 report got %d", len(r.reports))
+	}
+	if r.reports[0].Version != "test" {
+		t.Errorf("want version test got %s", r.reports[0].Version)
+	}
+}
+
+// TestHTTPSender checks the request sent by an HTTPSender.
+func TestHTTPSender(t *testing.T) {
+	var gotMethod, gotContentType string
+	var gotReport Report
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotContentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&gotReport)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(server.URL)
+	report := &Report{
+		SchemaVersion:      SchemaVersion,
+		Version:            "test",
+		PeriodSeconds:      60,
+		MessagesPerHour:    map[int]float64{1077: 3600},
+		ConstellationShare: map[string]float64{"GPS": 1},
+	}
+
+	if err := sender.Send(report); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != http.MethodPost {
+		t.Errorf("want method POST got %s", gotMethod)
+	}
+	if gotContentType != "application/json" {
+		t.Errorf("want content type application/json got %s", gotContentType)
+	}
+	if !cmp.Equal(*report, gotReport) {
+		t.Error(cmp.Diff(*report, gotReport))
+	}
+
+	// The endpoint refuses the report.
+	status = http.StatusServiceUnavailable
+	const wantError = "telemetry - report failed - 503 Service Unavailable"
+	err := sender.Send(report)
+	if err == nil {
+		t.Error("want an error")
+	} else if err.Error() != wantError {
+		t.Errorf("want error %s got %s", wantError, err.Error())
+	}
+}
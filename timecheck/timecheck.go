@@ -0,0 +1,286 @@
+// The timecheck package compares the system clock against an NTP server.
+//
+// The RTCM handler uses the system time to decide which week the timestamps
+// in the incoming messages belong to.  If the clock is wrong by a few seconds
+// close to the weekly rollover of the GPS or GLONASS timestamps, the handler
+// can pick the wrong week and get every time wrong by seven days.  (See the
+// README.)  The checker asks an NTP server for the time using the simple
+// network time protocol (SNTP, RFC 4330) and warns if the offset is over a
+// threshold.
+//
+//	checker := timecheck.New("pool.ntp.org", 2*time.Second, logger)
+//	result, err := checker.Check()
+//	if result.Refuse(30*time.Minute) { ... }
+//	go checker.Run(nil, time.Hour)
+package timecheck
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+)
+
+// DefaultServer is the NTP server used when none is given.
+const DefaultServer = "pool.ntp.org"
+
+// DefaultThreshold is the largest acceptable clock offset when none is given.
+const DefaultThreshold = 2 * time.Second
+
+// DefaultRolloverWindow is the time either side of a weekly rollover within
+// which a bad clock is dangerous, used when none is given.
+const DefaultRolloverWindow = 30 * time.Minute
+
+// queryTimeout is the time allowed for the NTP server to respond.
+const queryTimeout = 5 * time.Second
+
+// ntpPort is the port on which NTP servers listen.
+const ntpPort = "123"
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and
+// the Unix epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// packetLength is the length of an SNTP packet without extensions.
+const packetLength = 48
+
+// Config is the config of a time check, as it appears in an application's
+// JSON config file, for example:
+//
+//	"time_check": {
+//	    "server": "pool.ntp.org",
+//	    "threshold_milliseconds": 2000,
+//	    "interval_minutes": 60,
+//	    "refuse_to_start": true
+//	}
+type Config struct {
+	// Server is the NTP server.  Empty means DefaultServer.
+	Server string `json:"server"`
+
+	// ThresholdMilliseconds is the largest acceptable clock offset.  0 means
+	// DefaultThreshold.
+	ThresholdMilliseconds uint `json:"threshold_milliseconds"`
+
+	// IntervalMinutes is the time between checks after the one at startup.
+	// 0 means only check at startup.
+	IntervalMinutes uint `json:"interval_minutes"`
+
+	// RefuseToStart says that the application should not start if the
+	// clock is bad near a weekly rollover.
+	RefuseToStart bool `json:"refuse_to_start"`
+
+	// RolloverWindowMinutes is the time either side of a rollover within
+	// which a bad clock is refused.  0 means DefaultRolloverWindow.
+	RolloverWindowMinutes uint `json:"rollover_window_minutes"`
+}
+
+// Threshold returns the threshold as a duration.
+func (config *Config) Threshold() time.Duration {
+	return time.Duration(config.ThresholdMilliseconds) * time.Millisecond
+}
+
+// Interval returns the interval between checks as a duration.
+func (config *Config) Interval() time.Duration {
+	return time.Duration(config.IntervalMinutes) * time.Minute
+}
+
+// RolloverWindow returns the rollover window as a duration.
+func (config *Config) RolloverWindow() time.Duration {
+	if config.RolloverWindowMinutes == 0 {
+		return DefaultRolloverWindow
+	}
+	return time.Duration(config.RolloverWindowMinutes) * time.Minute
+}
+
+// Result is the result of a check.
+type Result struct {
+	// Time is the system time when the check was made.
+	Time time.Time
+	// Offset is the amount by which the system clock is behind the NTP
+	// server.  Negative means that the system clock is ahead.
+	Offset time.Duration
+	// Bad is true if the size of the offset is over the threshold.
+	Bad bool
+}
+
+// Refuse returns true if the clock is bad and the time of the check is
+// within the given window of a weekly rollover, in which case an
+// application that depends on the time to interpret RTCM timestamps should
+// not start.
+func (result *Result) Refuse(window time.Duration) bool {
+	return result.Bad && NearRollover(result.Time, window)
+}
+
+// Checker compares the system clock against an NTP server.
+type Checker struct {
+	// Server is the host name of the NTP server, with an optional port.
+	Server string
+
+	// Threshold is the largest acceptable clock offset.
+	Threshold time.Duration
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// now returns the system time.  It's a variable to support testing.
+	now func() time.Time
+}
+
+// New creates a Checker.  If the server is empty, DefaultServer is used.  If
+// the threshold is zero, DefaultThreshold is used.  The logger may be nil.
+func New(server string, threshold time.Duration, logger *log.Logger) *Checker {
+	if len(server) == 0 {
+		server = DefaultServer
+	}
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	checker := Checker{
+		Server:    server,
+		Threshold: threshold,
+		logger:    logger,
+		now:       time.Now,
+	}
+
+	return &checker
+}
+
+// Check asks the NTP server for the time and compares it with the system
+// time.  If the offset is over the threshold, it logs a warning.
+func (checker *Checker) Check() (*Result, error) {
+	offset, err := checker.query()
+	if err != nil {
+		eventlog.Printf(checker.logger, "cannot check the system clock against %s - %v",
+			checker.Server, err)
+		return nil, err
+	}
+
+	result := Result{Time: checker.now(), Offset: offset}
+
+	if abs(offset) > checker.Threshold {
+		result.Bad = true
+		direction := "behind"
+		if offset < 0 {
+			direction = "ahead"
+		}
+		eventlog.Printf(checker.logger, "WARNING: the system clock is %v %s according to %s - "+
+			"RTCM timestamps may be given the wrong week near a rollover",
+			abs(offset).Round(time.Millisecond), direction, checker.Server)
+	}
+
+	return &result, nil
+}
+
+// Run checks the clock at the given intervals until the stop channel is
+// closed.  If the channel is nil, it runs forever.  It can be run in a
+// goroutine.
+func (checker *Checker) Run(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			checker.Check()
+		}
+	}
+}
+
+// NearRollover returns true if the given time is within the window of a
+// weekly rollover of the GPS, Galileo or Beidou timestamps (midnight UTC at
+// the start of Sunday, give or take a few leap seconds) or of the GLONASS
+// timestamp (21:00 UTC on Saturday).
+func NearRollover(t time.Time, window time.Duration) bool {
+	t = t.UTC()
+
+	// Find the start of the nearest Sunday, which may be in the past or
+	// the future.
+	startOfDay := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	sunday := startOfDay.AddDate(0, 0, -int(t.Weekday()))
+	if t.Sub(sunday) > 84*time.Hour {
+		sunday = sunday.AddDate(0, 0, 7)
+	}
+
+	glonassRollover := sunday.Add(-3 * time.Hour)
+
+	return abs(t.Sub(sunday)) <= window || abs(t.Sub(glonassRollover)) <= window
+}
+
+// query asks the NTP server for the time and returns the offset of the
+// system clock, using the calculation in RFC 4330.
+func (checker *Checker) query() (time.Duration, error) {
+	address := checker.Server
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, ntpPort)
+	}
+
+	conn, dialError := net.DialTimeout("udp", address, queryTimeout)
+	if dialError != nil {
+		return 0, dialError
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(queryTimeout))
+
+	// The request is an empty packet apart from the first byte: leap
+	// indicator 0, version 4, mode 3 (client).
+	request := make([]byte, packetLength)
+	request[0] = 0x23
+
+	originateTime := checker.now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, packetLength)
+	n, readError := conn.Read(response)
+	if readError != nil {
+		return 0, readError
+	}
+	destinationTime := checker.now()
+
+	if n < packetLength {
+		em := fmt.Sprintf("short NTP response - %d bytes", n)
+		return 0, errors.New(em)
+	}
+
+	mode := response[0] & 0x7
+	if mode != 4 {
+		em := fmt.Sprintf("NTP response has mode %d - want 4 (server)", mode)
+		return 0, errors.New(em)
+	}
+
+	stratum := response[1]
+	if stratum == 0 {
+		return 0, errors.New("NTP server sent a kiss of death")
+	}
+
+	receiveTime := fromNTPTime(response[32:40])
+	transmitTime := fromNTPTime(response[40:48])
+
+	offset := (receiveTime.Sub(originateTime) + transmitTime.Sub(destinationTime)) / 2
+
+	return offset, nil
+}
+
+// fromNTPTime converts an 8-byte NTP timestamp to a time.
+func fromNTPTime(b []byte) time.Time {
+	seconds := binary.BigEndian.Uint32(b[0:4])
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	nanoseconds := (int64(fraction) * 1e9) >> 32
+	return time.Unix(int64(seconds)-ntpEpochOffset, nanoseconds)
+}
+
+// abs returns the size of a duration.
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,205 @@
+package timecheck
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// toNTPTime converts a time to an 8-byte NTP timestamp.
+func toNTPTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	seconds := uint32(t.Unix() + ntpEpochOffset)
+	fraction := uint32((int64(t.Nanosecond()) << 32) / 1e9)
+	binary.BigEndian.PutUint32(b[0:4], seconds)
+	binary.BigEndian.PutUint32(b[4:8], fraction)
+	return b
+}
+
+// fakeNTPServer answers one request with a clock that's offset from the
+// system clock by the given amount.  It returns the address of the server.
+func fakeNTPServer(t *testing.T, offset time.Duration, mode, stratum byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer conn.Close()
+		request := make([]byte, packetLength)
+		_, address, readError := conn.ReadFrom(request)
+		if readError != nil {
+			return
+		}
+		serverTime := time.Now().Add(offset)
+		response := make([]byte, packetLength)
+		response[0] = 0x20 | mode
+		response[1] = stratum
+		copy(response[32:40], toNTPTime(serverTime))
+		copy(response[40:48], toNTPTime(serverTime))
+		conn.WriteTo(response, address)
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// TestNTPTime checks the conversion to and from NTP timestamps.
+func TestNTPTime(t *testing.T) {
+	want := time.Date(2024, time.September, 1, 12, 0, 0, 500000000, time.UTC)
+
+	got := fromNTPTime(toNTPTime(want))
+
+	if abs(got.Sub(want)) > time.Microsecond {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+// TestCheck checks that Check measures the offset and logs a warning when
+// it's too big.
+func TestCheck(t *testing.T) {
+	var testData = []struct {
+		description string
+		offset      time.Duration
+		wantBad     bool
+		wantLog     string
+	}{
+		{"good", 0, false, ""},
+		{"behind", 10 * time.Second, true, "WARNING: the system clock is 10s behind"},
+		{"ahead", -5 * time.Second, true, "WARNING: the system clock is 5s ahead"},
+	}
+	for _, td := range testData {
+		server := fakeNTPServer(t, td.offset, 4, 2)
+
+		var logBuffer bytes.Buffer
+		logger := log.New(&logBuffer, "", 0)
+
+		checker := New(server, time.Second, logger)
+
+		result, err := checker.Check()
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+
+		if abs(result.Offset-td.offset) > 100*time.Millisecond {
+			t.Errorf("%s: want offset %v got %v", td.description, td.offset, result.Offset)
+		}
+
+		if result.Bad != td.wantBad {
+			t.Errorf("%s: want bad %v", td.description, td.wantBad)
+		}
+
+		if len(td.wantLog) == 0 {
+			if logBuffer.Len() > 0 {
+				t.Errorf("%s: want no log, got %s", td.description, logBuffer.String())
+			}
+		} else {
+			if !strings.HasPrefix(logBuffer.String(), td.wantLog) {
+				t.Errorf("%s: want log %s, got %s", td.description, td.wantLog, logBuffer.String())
+			}
+		}
+	}
+}
+
+// TestCheckWithBadResponse checks that Check rejects bad responses.
+func TestCheckWithBadResponse(t *testing.T) {
+	var testData = []struct {
+		description string
+		mode        byte
+		stratum     byte
+		wantError   string
+	}{
+		{"client", 3, 2, "NTP response has mode 3 - want 4 (server)"},
+		{"kiss of death", 4, 0, "NTP server sent a kiss of death"},
+	}
+	for _, td := range testData {
+		server := fakeNTPServer(t, 0, td.mode, td.stratum)
+
+		checker := New(server, time.Second, nil)
+
+		_, err := checker.Check()
+		if err == nil {
+			t.Errorf("%s: want an error", td.description)
+			continue
+		}
+		if err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %s", td.description, td.wantError, err.Error())
+		}
+	}
+}
+
+// TestNearRollover checks the detection of times near the weekly rollovers.
+func TestNearRollover(t *testing.T) {
+	// Sunday 1st September 2024.
+	sunday := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+	window := 30 * time.Minute
+
+	var testData = []struct {
+		description string
+		time        time.Time
+		want        bool
+	}{
+		{"GPS rollover", sunday, true},
+		{"just before GPS rollover", sunday.Add(-10 * time.Minute), true},
+		{"just after GPS rollover", sunday.Add(29 * time.Minute), true},
+		{"after GPS rollover", sunday.Add(31 * time.Minute), false},
+		{"GLONASS rollover", sunday.Add(-3 * time.Hour), true},
+		{"just after GLONASS rollover", sunday.Add(-3*time.Hour + 20*time.Minute), true},
+		{"between the rollovers", sunday.Add(-90 * time.Minute), false},
+		{"midweek", sunday.Add(-84 * time.Hour), false},
+		{"next GLONASS rollover", sunday.Add(7*24*time.Hour - 3*time.Hour - time.Minute), true},
+		{"other timezone", sunday.In(time.FixedZone("X", 5*3600)), true},
+	}
+	for _, td := range testData {
+		got := NearRollover(td.time, window)
+		if got != td.want {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
+
+// TestRefuse checks that a result only refuses when the clock is bad near
+// a rollover.
+func TestRefuse(t *testing.T) {
+	sunday := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+	wednesday := sunday.Add(-84 * time.Hour)
+
+	var testData = []struct {
+		result Result
+		want   bool
+	}{
+		{Result{Time: sunday, Bad: true}, true},
+		{Result{Time: sunday, Bad: false}, false},
+		{Result{Time: wednesday, Bad: true}, false},
+	}
+	for _, td := range testData {
+		got := td.result.Refuse(DefaultRolloverWindow)
+		if got != td.want {
+			t.Errorf("%v: want %v got %v", td.result, td.want, got)
+		}
+	}
+}
+
+// TestConfig checks the durations given by a Config.
+func TestConfig(t *testing.T) {
+	config := Config{ThresholdMilliseconds: 1500, IntervalMinutes: 60}
+
+	if config.Threshold() != 1500*time.Millisecond {
+		t.Errorf("want 1.5s got %v", config.Threshold())
+	}
+	if config.Interval() != time.Hour {
+		t.Errorf("want 1h got %v", config.Interval())
+	}
+	if config.RolloverWindow() != DefaultRolloverWindow {
+		t.Errorf("want %v got %v", DefaultRolloverWindow, config.RolloverWindow())
+	}
+
+	config.RolloverWindowMinutes = 10
+	if config.RolloverWindow() != 10*time.Minute {
+		t.Errorf("want 10m got %v", config.RolloverWindow())
+	}
+}
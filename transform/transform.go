@@ -0,0 +1,135 @@
+// The transform package passes RTCM messages through an external command.
+//
+// It's an escape hatch for advanced users who want to insert a processing
+// step that this software doesn't provide, for example a conversion done
+// by RTKLIB's str2str, without changing the code.  The raw frames of the
+// incoming RTCM messages are written to the command's standard input and
+// its standard output is read back through an RTCM handler, so only valid
+// RTCM messages come out the other end.  Anything else that the command
+// writes is logged and dropped.
+//
+//	handler := rtcm.New(time.Now(), slog.LevelInfo)
+//	transformer, err := transform.New([]string{"str2str", "-in", "-", "-out", "-"}, handler, logger)
+//	...
+//	go transformer.Run(in, func(message rtcm.Message) { ... })
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync/atomic"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Transformer passes RTCM messages through an external command.
+type Transformer struct {
+	// command is the command and its arguments.
+	command []string
+
+	// handler reads the messages from the command's output.
+	handler *rtcm.Handler
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// dropped is the number of bytes of output that were not valid RTCM.
+	// It's accessed atomically.
+	dropped uint64
+}
+
+// New creates a Transformer which runs the given command and reads its
+// output using the given RTCM handler.  The logger may be nil.
+func New(command []string, handler *rtcm.Handler, logger *log.Logger) (*Transformer, error) {
+	if len(command) == 0 || len(command[0]) == 0 {
+		return nil, errors.New("transform - want a command")
+	}
+
+	transformer := Transformer{command: command, handler: handler, logger: logger}
+
+	return &transformer, nil
+}
+
+// Dropped returns the number of bytes of the command's output that were
+// not valid RTCM messages.
+func (transformer *Transformer) Dropped() uint64 {
+	return atomic.LoadUint64(&transformer.dropped)
+}
+
+// Run starts the command, writes the raw frames of the RTCM messages from
+// the channel to it and calls release with each valid RTCM message that it
+// produces.  Non-RTCM messages in the channel are not sent to the command.
+// When the channel is closed, the command's input is closed.  Run returns
+// when the command's output ends, with any error from the command.  It can
+// be run in a go routine.
+func (transformer *Transformer) Run(in <-chan rtcm.Message, release func(rtcm.Message)) error {
+	cmd := exec.Command(transformer.command[0], transformer.command[1:]...)
+	cmd.Stderr = os.Stderr
+
+	stdin, stdinError := cmd.StdinPipe()
+	if stdinError != nil {
+		drain(in)
+		return stdinError
+	}
+	stdout, stdoutError := cmd.StdoutPipe()
+	if stdoutError != nil {
+		drain(in)
+		return stdoutError
+	}
+
+	if err := cmd.Start(); err != nil {
+		drain(in)
+		em := fmt.Sprintf("transform - cannot start %s - %v", transformer.command[0], err)
+		return errors.New(em)
+	}
+
+	go transformer.feed(in, stdin)
+
+	scanner := rtcm.NewScannerWithHandler(stdout, transformer.handler)
+	for {
+		message, scanError := scanner.Next()
+		if scanError != nil {
+			break
+		}
+		if message.MessageType == utils.NonRTCMMessage {
+			atomic.AddUint64(&transformer.dropped, uint64(len(message.RawData)))
+			eventlog.Printf(transformer.logger, "transform - dropped %d bytes of output that are not RTCM",
+				len(message.RawData))
+			continue
+		}
+		release(*message)
+	}
+
+	return cmd.Wait()
+}
+
+// feed writes the raw frames of the RTCM messages from the channel to the
+// writer, closing the writer when the channel is closed.  If a write fails,
+// the rest of the messages are drained so that the sender isn't blocked.
+func (transformer *Transformer) feed(in <-chan rtcm.Message, writer io.WriteCloser) {
+	defer writer.Close()
+
+	var writeError error
+	for message := range in {
+		if message.MessageType == utils.NonRTCMMessage || writeError != nil {
+			continue
+		}
+		_, writeError = writer.Write(message.RawData)
+		if writeError != nil {
+			eventlog.Printf(transformer.logger, "transform - cannot write to %s - %v",
+				transformer.command[0], writeError)
+		}
+	}
+}
+
+// drain reads the channel until it's closed.
+func drain(in <-chan rtcm.Message) {
+	for range in {
+	}
+}
@@ -0,0 +1,125 @@
+package transform
+
+import (
+	"bytes"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// needCommand skips the test if the named command isn't available.
+func needCommand(t *testing.T, name string) {
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s is not available", name)
+	}
+}
+
+// run passes the messages through a Transformer running the command and
+// returns the messages that come out.
+func run(t *testing.T, command []string, messages []rtcm.Message) (*Transformer, []rtcm.Message, error) {
+	transformer, err := New(command, rtcm.New(time.Now(), slog.LevelInfo), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan rtcm.Message)
+	go func() {
+		for _, m := range messages {
+			in <- m
+		}
+		close(in)
+	}()
+
+	got := make([]rtcm.Message, 0)
+	runError := transformer.Run(in, func(m rtcm.Message) { got = append(got, m) })
+
+	return transformer, got, runError
+}
+
+// TestNewWithNoCommand checks that New rejects an empty command.
+func TestNewWithNoCommand(t *testing.T) {
+	const wantError = "transform - want a command"
+
+	_, err := New(nil, rtcm.New(time.Now(), slog.LevelInfo), nil)
+	if err == nil || err.Error() != wantError {
+		t.Errorf("want error %s got %v", wantError, err)
+	}
+}
+
+// TestRun checks that the RTCM messages go through the command and come out
+// again and that non-RTCM messages are not sent to it.
+func TestRun(t *testing.T) {
+	needCommand(t, "cat")
+
+	messages := []rtcm.Message{
+		{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")},
+		{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005},
+		{MessageType: utils.MessageTypeMSM7GPS, RawData: testdata.MessageFrameType1077},
+	}
+
+	transformer, got, err := run(t, []string{"cat"}, messages)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("want 2 messages got %d", len(got))
+	}
+	if !bytes.Equal(got[0].RawData, testdata.MessageFrameType1005) ||
+		!bytes.Equal(got[1].RawData, testdata.MessageFrameType1077) {
+		t.Error("want the RTCM messages unchanged")
+	}
+
+	if transformer.Dropped() != 0 {
+		t.Errorf("want nothing dropped, got %d", transformer.Dropped())
+	}
+}
+
+// TestRunWithBadOutput checks that output that isn't valid RTCM is dropped.
+func TestRunWithBadOutput(t *testing.T) {
+	needCommand(t, "sh")
+
+	messages := []rtcm.Message{
+		{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005},
+	}
+
+	// The command writes some junk before copying its input.
+	command := []string{"sh", "-c", "printf 'junk\n'; cat"}
+
+	transformer, got, err := run(t, command, messages)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(got) != 1 || got[0].MessageType != utils.MessageType1005 {
+		t.Errorf("want one message type 1005, got %v", got)
+	}
+
+	if transformer.Dropped() != 5 {
+		t.Errorf("want 5 bytes dropped, got %d", transformer.Dropped())
+	}
+}
+
+// TestRunWithMissingCommand checks that Run returns an error if the command
+// can't be started, after draining the channel.
+func TestRunWithMissingCommand(t *testing.T) {
+	messages := []rtcm.Message{
+		{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005},
+	}
+
+	_, got, err := run(t, []string{"/no/such/command"}, messages)
+
+	if err == nil || !strings.HasPrefix(err.Error(), "transform - cannot start /no/such/command") {
+		t.Errorf("want a start error, got %v", err)
+	}
+
+	if len(got) != 0 {
+		t.Errorf("want no messages, got %d", len(got))
+	}
+}
@@ -0,0 +1,447 @@
+// The transport package connects an application to RTCM data carried over
+// a network rather than a serial line or a pipe.  Some receivers stream
+// their corrections over Ethernet to a TCP or UDP port, and some consumers
+// take them on a TCP port.
+//
+// A Listener is an io.Reader that listens on a TCP or UDP port and gives
+// the data that arrives there:
+//
+//	"listen": {"network": "tcp", "address": ":5000"}
+//
+// Over TCP it serves one connection at a time.  When the sender drops the
+// connection, the Listener waits for it to connect again, much as the
+// serial input waits for a device to reappear after it's unplugged.  Over
+// UDP the datagrams from all senders are joined into one stream.
+//
+// A Forwarder is an io.Writer that sends the data to a TCP (or UDP)
+// endpoint:
+//
+//	"forward": {"address": "192.168.1.20:2103"}
+//
+// It connects when it's first written to and connects again after the
+// connection fails, pausing between attempts.  RTCM corrections are no use
+// to a rover when they are late, so data written while the endpoint can't
+// be reached is dropped rather than queued.
+//
+// The network "rtp" is UDP with each datagram carried in an RTP packet, as
+// in NTRIP version 2, so that a Listener can use the sequence numbers to
+// count the datagrams that were lost on the way (see LossStats).  Each Write
+// to a Forwarder goes in its own packet, so write one RTCM message at a time.
+// The RTSP session that NTRIP version 2 uses to set up an RTP stream with a
+// caster is not handled - the two ends are given each other's addresses.
+//
+// Only the first of a series of connection failures is logged.
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	"github.com/goblimey/go-ntrip/rtp"
+)
+
+// DefaultNetwork is the network used when the config doesn't give one.
+const DefaultNetwork = "tcp"
+
+// DefaultRetry is the pause between attempts to connect used when the
+// config doesn't give one.
+const DefaultRetry = time.Second
+
+// dialTimeout is the time allowed to connect to an endpoint.
+const dialTimeout = 10 * time.Second
+
+// writeTimeout is the time allowed to write to an endpoint, so that one
+// that has stopped reading doesn't stall the application.
+const writeTimeout = 10 * time.Second
+
+// maxDatagram is the size of the largest UDP datagram.
+const maxDatagram = 65535
+
+// Config is the config of a Listener or a Forwarder, as it appears in an
+// application's JSON config file.
+type Config struct {
+	// Network is "tcp", "udp" or "rtp".  Empty means DefaultNetwork.
+	Network string `json:"network"`
+
+	// Address is the host:port to listen on or to connect to, for example
+	// ":5000" to listen on all interfaces.
+	Address string `json:"address"`
+
+	// RetryMilliseconds is the pause after a failed attempt to connect
+	// before the next one.  0 means DefaultRetry.
+	RetryMilliseconds uint `json:"retry_milliseconds"`
+}
+
+// NetworkName returns the network.
+func (config *Config) NetworkName() string {
+	if len(config.Network) == 0 {
+		return DefaultNetwork
+	}
+	return config.Network
+}
+
+// socketNetwork returns the network of the socket - "udp" for RTP.
+func (config *Config) socketNetwork() string {
+	if config.NetworkName() == "rtp" {
+		return "udp"
+	}
+	return config.NetworkName()
+}
+
+// Retry returns the pause after a failed attempt to connect.
+func (config *Config) Retry() time.Duration {
+	if config.RetryMilliseconds == 0 {
+		return DefaultRetry
+	}
+	return time.Duration(config.RetryMilliseconds) * time.Millisecond
+}
+
+// String describes the transport, for example "tcp :5000".
+func (config *Config) String() string {
+	return config.NetworkName() + " " + config.Address
+}
+
+// Validate checks the config.
+func (config *Config) Validate() error {
+	network := config.NetworkName()
+	if network != "tcp" && network != "udp" && network != "rtp" {
+		em := fmt.Sprintf("transport - network %q - want tcp, udp or rtp", config.Network)
+		return errors.New(em)
+	}
+	_, _, splitError := net.SplitHostPort(config.Address)
+	if splitError != nil {
+		em := fmt.Sprintf("transport - the address %q is not host:port", config.Address)
+		return errors.New(em)
+	}
+	return nil
+}
+
+// Listener gives the data that arrives on a TCP or UDP port, or in RTP
+// packets.  Read may be
+// called from one goroutine and Close from another.
+type Listener struct {
+	// config is the config of the Listener.
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// listener accepts TCP connections.  It's nil for UDP.
+	listener net.Listener
+
+	// packetConn receives UDP datagrams.  It's nil for TCP.
+	packetConn net.PacketConn
+
+	// tracker counts the RTP packets lost.  It's nil unless the network is
+	// RTP.
+	tracker *rtp.Tracker
+
+	// buffer holds the last datagram and pending is the part of it that
+	// hasn't been read yet.
+	buffer  []byte
+	pending []byte
+
+	// failureLogged is true if the last failure to accept a connection has
+	// been logged.
+	failureLogged bool
+
+	// conn is the current TCP connection, nil if there isn't one.
+	conn net.Conn
+
+	// closed is true once Close has been called.
+	closed bool
+
+	// The mutex controls access to conn and closed.
+	mutex sync.Mutex
+}
+
+// Listen starts listening on the network and address in the config.  The
+// logger may be nil.
+func Listen(config Config, logger *log.Logger) (*Listener, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	l := Listener{config: config, logger: logger}
+
+	var listenError error
+	if config.socketNetwork() == "udp" {
+		l.packetConn, listenError = net.ListenPacket("udp", config.Address)
+		l.buffer = make([]byte, maxDatagram)
+		if config.NetworkName() == "rtp" {
+			l.tracker = &rtp.Tracker{}
+		}
+	} else {
+		l.listener, listenError = net.Listen("tcp", config.Address)
+	}
+	if listenError != nil {
+		em := fmt.Sprintf("transport - cannot listen on %s - %v", config.String(), listenError)
+		return nil, errors.New(em)
+	}
+
+	return &l, nil
+}
+
+// Addr returns the address on which the Listener is listening.
+func (l *Listener) Addr() net.Addr {
+	if l.packetConn != nil {
+		return l.packetConn.LocalAddr()
+	}
+	return l.listener.Addr()
+}
+
+// Read reads data that has arrived.  It blocks until there is some.  It
+// returns io.EOF once the Listener has been closed.
+func (l *Listener) Read(p []byte) (int, error) {
+	if l.packetConn != nil {
+		return l.readDatagrams(p)
+	}
+	return l.readConnections(p)
+}
+
+// readDatagrams reads from the UDP datagrams.
+func (l *Listener) readDatagrams(p []byte) (int, error) {
+	for len(l.pending) == 0 {
+		n, _, err := l.packetConn.ReadFrom(l.buffer)
+		if err != nil {
+			if l.isClosed() {
+				return 0, io.EOF
+			}
+			eventlog.Printf(l.logger, "transport - %s - %v", l.config.String(), err)
+			continue
+		}
+		l.pending = l.buffer[:n]
+
+		if l.tracker != nil {
+			packet, parseError := rtp.Parse(l.pending)
+			if parseError != nil {
+				eventlog.Printf(l.logger, "transport - %s - %v", l.config.String(), parseError)
+				l.pending = nil
+				continue
+			}
+			l.tracker.Record(packet.SequenceNumber)
+			l.pending = packet.Payload
+		}
+	}
+
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// readConnections reads from the current TCP connection, waiting for a new
+// one if there isn't one or it fails.
+func (l *Listener) readConnections(p []byte) (int, error) {
+	for {
+		l.mutex.Lock()
+		conn := l.conn
+		l.mutex.Unlock()
+
+		if conn == nil {
+			newConn, acceptError := l.listener.Accept()
+			if acceptError != nil {
+				if l.isClosed() {
+					return 0, io.EOF
+				}
+				if !l.failureLogged {
+					eventlog.Printf(l.logger, "transport - cannot accept a connection on %s - %v.  Retrying",
+						l.config.String(), acceptError)
+					l.failureLogged = true
+				}
+				time.Sleep(l.config.Retry())
+				continue
+			}
+			l.failureLogged = false
+			eventlog.Printf(l.logger, "transport - connection from %s on %s",
+				newConn.RemoteAddr(), newConn.LocalAddr())
+
+			l.mutex.Lock()
+			if l.closed {
+				l.mutex.Unlock()
+				newConn.Close()
+				return 0, io.EOF
+			}
+			l.conn = newConn
+			l.mutex.Unlock()
+			conn = newConn
+		}
+
+		n, readError := conn.Read(p)
+		if readError != nil {
+			if l.isClosed() {
+				return 0, io.EOF
+			}
+			eventlog.Printf(l.logger, "transport - lost the connection from %s - %v",
+				conn.RemoteAddr(), readError)
+			conn.Close()
+			l.mutex.Lock()
+			l.conn = nil
+			l.mutex.Unlock()
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// LossStats returns the counts of the RTP packets received, lost and late.
+// They are all zero unless the network is RTP.
+func (l *Listener) LossStats() rtp.LossStats {
+	if l.tracker == nil {
+		return rtp.LossStats{}
+	}
+	return l.tracker.Stats()
+}
+
+// Close stops the Listener.  A Read in progress returns io.EOF.
+func (l *Listener) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	if l.packetConn != nil {
+		return l.packetConn.Close()
+	}
+	return l.listener.Close()
+}
+
+// isClosed returns true if Close has been called.
+func (l *Listener) isClosed() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.closed
+}
+
+// Forwarder sends data to an endpoint.  It's safe for concurrent use.
+type Forwarder struct {
+	// config is the config of the Forwarder.
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// conn is the connection to the endpoint, nil if there isn't one.
+	conn net.Conn
+
+	// packet is the RTP packet in which the data is sent, carrying the
+	// sequence number of the next one.  It's nil unless the network is RTP.
+	packet *rtp.Packet
+
+	// nextAttempt is the earliest time at which to try to connect again.
+	nextAttempt time.Time
+
+	// failureLogged is true if the last failure to connect has been logged.
+	failureLogged bool
+
+	// now gives the time.  It's replaced in tests.
+	now func() time.Time
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// NewForwarder creates a Forwarder that sends to the network and address
+// in the config.  It doesn't connect until it's written to.  The logger may
+// be nil.
+func NewForwarder(config Config, logger *log.Logger) (*Forwarder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	forwarder := Forwarder{config: config, logger: logger, now: time.Now}
+	if config.NetworkName() == "rtp" {
+		// RFC 3550 says to start the sequence number at a random value.
+		forwarder.packet = &rtp.Packet{
+			PayloadType:    rtp.PayloadTypeGNSS,
+			SequenceNumber: uint16(rand.Uint32()),
+			SSRC:           rand.Uint32(),
+		}
+	}
+	return &forwarder, nil
+}
+
+// Check connects to the endpoint and disconnects again.
+func (forwarder *Forwarder) Check() error {
+	conn, dialError := forwarder.dial()
+	if dialError != nil {
+		return dialError
+	}
+	return conn.Close()
+}
+
+// Write sends the data to the endpoint, connecting first if need be.  If
+// the endpoint can't be reached the data is dropped.  It never returns an
+// error, so that a pipeline writing to it keeps going.  Over RTP the data
+// goes in one packet.
+func (forwarder *Forwarder) Write(p []byte) (int, error) {
+	forwarder.mutex.Lock()
+	defer forwarder.mutex.Unlock()
+
+	if forwarder.conn == nil {
+		now := forwarder.now()
+		if now.Before(forwarder.nextAttempt) {
+			return len(p), nil
+		}
+		conn, dialError := forwarder.dial()
+		if dialError != nil {
+			if !forwarder.failureLogged {
+				eventlog.Println(forwarder.logger, dialError.Error()+".  Retrying")
+				forwarder.failureLogged = true
+			}
+			forwarder.nextAttempt = now.Add(forwarder.config.Retry())
+			return len(p), nil
+		}
+		eventlog.Printf(forwarder.logger, "transport - connected to %s", forwarder.config.String())
+		forwarder.failureLogged = false
+		forwarder.conn = conn
+	}
+
+	data := p
+	if forwarder.packet != nil {
+		forwarder.packet.Timestamp = uint32(forwarder.now().UnixNano() / int64(time.Millisecond))
+		forwarder.packet.Payload = p
+		data = forwarder.packet.Marshal()
+		forwarder.packet.SequenceNumber++
+	}
+
+	forwarder.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, writeError := forwarder.conn.Write(data)
+	if writeError != nil {
+		eventlog.Printf(forwarder.logger, "transport - lost the connection to %s - %v",
+			forwarder.config.String(), writeError)
+		forwarder.conn.Close()
+		forwarder.conn = nil
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection to the endpoint, if there is one.
+func (forwarder *Forwarder) Close() error {
+	forwarder.mutex.Lock()
+	defer forwarder.mutex.Unlock()
+	if forwarder.conn == nil {
+		return nil
+	}
+	err := forwarder.conn.Close()
+	forwarder.conn = nil
+	return err
+}
+
+// dial connects to the endpoint.
+func (forwarder *Forwarder) dial() (net.Conn, error) {
+	conn, dialError := net.DialTimeout(forwarder.config.socketNetwork(), forwarder.config.Address, dialTimeout)
+	if dialError != nil {
+		em := fmt.Sprintf("transport - cannot connect to %s - %v", forwarder.config.String(), dialError)
+		return nil, errors.New(em)
+	}
+	return conn, nil
+}
@@ -0,0 +1,320 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goblimey/go-ntrip/rtp"
+)
+
+// TestValidate checks the checks on the config.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"tcp by default", Config{Address: ":5000"}, ""},
+		{"udp", Config{Network: "udp", Address: "localhost:5000"}, ""},
+		{"rtp", Config{Network: "rtp", Address: "localhost:5000"}, ""},
+		{"bad network", Config{Network: "serial", Address: ":5000"},
+			`transport - network "serial" - want tcp, udp or rtp`},
+		{"no port", Config{Address: "localhost"},
+			`transport - the address "localhost" is not host:port`},
+	}
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+		if _, err := Listen(td.config, nil); err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want Listen error %s got %v", td.description, td.wantError, err)
+		}
+		if _, err := NewForwarder(td.config, nil); err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want NewForwarder error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestConfigDefaults checks the defaults.
+func TestConfigDefaults(t *testing.T) {
+	config := Config{Address: ":5000"}
+	if config.NetworkName() != "tcp" || config.Retry() != DefaultRetry || config.String() != "tcp :5000" {
+		t.Errorf("unexpected defaults %s %v", config.String(), config.Retry())
+	}
+	config = Config{Network: "udp", Address: ":5000", RetryMilliseconds: 250}
+	if config.Retry() != 250*time.Millisecond || config.String() != "udp :5000" {
+		t.Errorf("unexpected values %s %v", config.String(), config.Retry())
+	}
+}
+
+// readString is a helper function.  It reads from the Listener until it has
+// the given number of bytes.
+func readString(t *testing.T, reader io.Reader, n int) string {
+	buffer := make([]byte, n)
+	_, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buffer)
+}
+
+// TestListenTCP checks that the Listener reads from one connection and then
+// from the next when the first is dropped.
+func TestListenTCP(t *testing.T) {
+	var logBuffer bytes.Buffer
+	listener, err := Listen(Config{Address: "127.0.0.1:0"}, log.New(&logBuffer, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	first, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Write([]byte("hello "))
+	if got := readString(t, listener, 6); got != "hello " {
+		t.Errorf("want hello got %q", got)
+	}
+	first.Close()
+
+	second, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.Write([]byte("again"))
+	if got := readString(t, listener, 5); got != "again" {
+		t.Errorf("want again got %q", got)
+	}
+
+	if strings.Count(logBuffer.String(), "transport - connection from ") != 2 {
+		t.Errorf("want two connections logged\n%s", logBuffer.String())
+	}
+}
+
+// TestListenUDP checks that the Listener joins the datagrams and gives them
+// in pieces if need be.
+func TestListenUDP(t *testing.T) {
+	listener, err := Listen(Config{Network: "udp", Address: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sender, err := net.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	sender.Write([]byte("abcdef"))
+	sender.Write([]byte("gh"))
+
+	buffer := make([]byte, 4)
+	n, _ := listener.Read(buffer)
+	if string(buffer[:n]) != "abcd" {
+		t.Errorf("want abcd got %q", buffer[:n])
+	}
+	if got := readString(t, listener, 4); got != "efgh" {
+		t.Errorf("want efgh got %q", got)
+	}
+}
+
+// TestRTP checks that a Forwarder sends each write in an RTP packet and a
+// Listener takes the data out of the packets, counting the lost packets and
+// dropping any datagram that isn't RTP.
+func TestRTP(t *testing.T) {
+	var logBuffer bytes.Buffer
+	listener, err := Listen(Config{Network: "rtp", Address: "127.0.0.1:0"}, log.New(&logBuffer, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	forwarder, err := NewForwarder(Config{Network: "rtp", Address: listener.Addr().String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Close()
+
+	forwarder.Write([]byte("first"))
+	if got := readString(t, listener, 5); got != "first" {
+		t.Errorf("want first got %q", got)
+	}
+
+	// A datagram that isn't RTP is dropped.
+	sender, err := net.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	sender.Write([]byte("junk"))
+
+	// Two packets go missing.
+	forwarder.packet.SequenceNumber += 2
+	forwarder.Write([]byte("second"))
+	if got := readString(t, listener, 6); got != "second" {
+		t.Errorf("want second got %q", got)
+	}
+
+	want := rtp.LossStats{Received: 2, Lost: 2}
+	if got := listener.LossStats(); got != want {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+	if !strings.Contains(logBuffer.String(), "RTP packet too short") {
+		t.Errorf("want the bad datagram logged\n%s", logBuffer.String())
+	}
+}
+
+// TestListenerClose checks that a Read in progress ends when the Listener is
+// closed.
+func TestListenerClose(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		listener, err := Listen(Config{Network: network, Address: "127.0.0.1:0"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error)
+		go func() {
+			_, readError := listener.Read(make([]byte, 10))
+			done <- readError
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		listener.Close()
+		select {
+		case readError := <-done:
+			if readError != io.EOF {
+				t.Errorf("%s: want EOF got %v", network, readError)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: Read didn't stop", network)
+		}
+	}
+}
+
+// TestListenFails checks that Listen reports an address that's in use.
+func TestListenFails(t *testing.T) {
+	first, err := Listen(Config{Address: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	address := first.Addr().String()
+
+	_, err = Listen(Config{Address: address}, nil)
+	wantPrefix := "transport - cannot listen on tcp " + address + " - "
+	if err == nil || !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("want error starting %s got %v", wantPrefix, err)
+	}
+}
+
+// TestForwarder checks that the Forwarder sends the data, drops it while the
+// endpoint is down and connects again when it comes back.
+func TestForwarder(t *testing.T) {
+	endpoint, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := endpoint.Addr().String()
+
+	var logBuffer bytes.Buffer
+	forwarder, err := NewForwarder(Config{Address: address}, log.New(&logBuffer, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Close()
+	now := time.Now()
+	forwarder.now = func() time.Time { return now }
+
+	if err := forwarder.Check(); err != nil {
+		t.Fatal(err)
+	}
+	checkConn, _ := endpoint.Accept()
+	checkConn.Close()
+
+	n, writeError := forwarder.Write([]byte("first"))
+	if n != 5 || writeError != nil {
+		t.Errorf("want 5, nil got %d, %v", n, writeError)
+	}
+	conn, _ := endpoint.Accept()
+	if got := readString(t, conn, 5); got != "first" {
+		t.Errorf("want first got %q", got)
+	}
+
+	// The endpoint goes away.  The writes are dropped and only the first
+	// failure to connect is logged.
+	conn.Close()
+	endpoint.Close()
+	for i := 0; i < 5; i++ {
+		forwarder.Write([]byte("lost "))
+		time.Sleep(10 * time.Millisecond)
+		now = now.Add(2 * DefaultRetry)
+	}
+	if strings.Count(logBuffer.String(), "transport - cannot connect to tcp "+address) != 1 {
+		t.Errorf("want one failure logged\n%s", logBuffer.String())
+	}
+	if err := forwarder.Check(); err == nil {
+		t.Error("want the check to fail")
+	}
+
+	// It comes back.
+	endpoint, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("cannot listen on %s again - %v", address, err)
+	}
+	defer endpoint.Close()
+	now = now.Add(2 * DefaultRetry)
+	forwarder.Write([]byte("back"))
+	conn, _ = endpoint.Accept()
+	defer conn.Close()
+	if got := readString(t, conn, 4); got != "back" {
+		t.Errorf("want back got %q", got)
+	}
+}
+
+// TestForwarderWaits checks that the Forwarder doesn't try to connect again
+// until the retry time has passed.
+func TestForwarderWaits(t *testing.T) {
+	endpoint, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := endpoint.Addr().String()
+	endpoint.Close()
+
+	forwarder, _ := NewForwarder(Config{Address: address, RetryMilliseconds: 60000}, nil)
+	now := time.Now()
+	forwarder.now = func() time.Time { return now }
+	forwarder.Write([]byte("lost"))
+
+	endpoint, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("cannot listen on %s again - %v", address, err)
+	}
+	defer endpoint.Close()
+
+	// Within the retry time the data is dropped without connecting.
+	forwarder.Write([]byte("dropped"))
+	if forwarder.conn != nil {
+		t.Error("want no connection within the retry time")
+	}
+
+	now = now.Add(time.Minute)
+	forwarder.Write([]byte("sent"))
+	if forwarder.conn == nil {
+		t.Error("want a connection after the retry time")
+	}
+	forwarder.Close()
+}
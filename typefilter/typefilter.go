@@ -0,0 +1,203 @@
+// The typefilter package chooses which RTCM message types are passed on,
+// for example to strip message type 1230 or the legacy type 1004 from the
+// stream sent to a caster to save bandwidth, without reconfiguring the
+// receiver.  A filter has a list of the types to forward, a list of the
+// types to drop, or both:
+//
+//	filter, err := typefilter.New([]int{1005, 1074, 1084, 1094, 1124}, nil)
+//	...
+//	if filter.Keep(message.MessageType) {
+//	    // send the message
+//	}
+//
+// If there is a forward list, only the types in it are kept.  The types in
+// the drop list are never kept.  Non-RTCM data is never kept.
+//
+// The u-blox proprietary message type 4072 is divided into sub-types, and a
+// filter can also drop some of them and keep the rest.  The sub-type is
+// inside the message, so the filter needs the message frame:
+//
+//	err = filter.DropSubTypes([]string{"4072.1"})
+//	...
+//	if filter.KeepFrame(message.MessageType, message.RawData) {
+//	    // send the message
+//	}
+package typefilter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/go-ntrip/rtcm/type4072"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// Filter decides which message types are kept.
+type Filter struct {
+	// forward holds the types to forward.  If it's empty, all types are
+	// forwarded unless they are dropped.
+	forward map[int]bool
+
+	// drop holds the types to drop.
+	drop map[int]bool
+
+	// dropSubTypes holds the sub-types of message type 4072 to drop.
+	dropSubTypes map[uint]bool
+}
+
+// New creates a Filter from the lists of types to forward and to drop.  It
+// returns an error if a type is not a legal RTCM message type or if it's in
+// both lists.
+func New(forward, drop []int) (*Filter, error) {
+	filter := Filter{
+		forward: make(map[int]bool),
+		drop:    make(map[int]bool),
+	}
+
+	for _, list := range []struct {
+		types []int
+		set   map[int]bool
+	}{{forward, filter.forward}, {drop, filter.drop}} {
+		for _, messageType := range list.types {
+			if messageType <= 0 || messageType > utils.MaxMessageType {
+				em := fmt.Sprintf("typefilter - illegal message type %d", messageType)
+				return nil, errors.New(em)
+			}
+			list.set[messageType] = true
+		}
+	}
+
+	for messageType := range filter.drop {
+		if filter.forward[messageType] {
+			em := fmt.Sprintf("typefilter - message type %d is both forwarded and dropped", messageType)
+			return nil, errors.New(em)
+		}
+	}
+
+	return &filter, nil
+}
+
+// Keep returns true if messages of the given type should be passed on.
+func (filter *Filter) Keep(messageType int) bool {
+	if messageType <= 0 {
+		// Non-RTCM data.
+		return false
+	}
+	if filter.drop[messageType] {
+		return false
+	}
+	if len(filter.forward) > 0 {
+		return filter.forward[messageType]
+	}
+	return true
+}
+
+// DropSubTypes adds to the sub-types that the filter drops.  Each is given
+// as the message type and the sub-type separated by a dot, for example
+// "4072.1".  Only message type 4072 has sub-types.
+func (filter *Filter) DropSubTypes(subTypes []string) error {
+	for _, text := range subTypes {
+		messageType, subType, err := ParseSubType(text)
+		if err != nil {
+			return err
+		}
+		if messageType != utils.MessageType4072 {
+			em := fmt.Sprintf("typefilter - message type %d has no sub-types", messageType)
+			return errors.New(em)
+		}
+		if filter.dropSubTypes == nil {
+			filter.dropSubTypes = make(map[uint]bool)
+		}
+		filter.dropSubTypes[subType] = true
+	}
+	return nil
+}
+
+// ParseSubType splits a message type and sub-type such as "4072.1" into
+// its parts.
+func ParseSubType(text string) (int, uint, error) {
+	parts := strings.Split(strings.TrimSpace(text), ".")
+	if len(parts) == 2 {
+		messageType, typeError := strconv.Atoi(parts[0])
+		subType, subTypeError := strconv.ParseUint(parts[1], 10, 12)
+		if typeError == nil && subTypeError == nil {
+			return messageType, uint(subType), nil
+		}
+	}
+	em := fmt.Sprintf("typefilter - %q - want a message type and a sub-type, for example 4072.1", text)
+	return 0, 0, errors.New(em)
+}
+
+// KeepFrame is like Keep, but it also looks into the message frame for the
+// sub-type of a message type 4072 and drops it if the sub-type is in the
+// list.  A frame too short to hold a sub-type is judged by its type alone.
+func (filter *Filter) KeepFrame(messageType int, frame []byte) bool {
+	if !filter.Keep(messageType) {
+		return false
+	}
+	if messageType != utils.MessageType4072 || len(filter.dropSubTypes) == 0 {
+		return true
+	}
+	subType, err := type4072.GetSubType(frame)
+	if err != nil {
+		return true
+	}
+	return !filter.dropSubTypes[subType]
+}
+
+// String describes the filter, for example "forward 1005,1077" or "drop
+// 1230,4072.1".
+func (filter *Filter) String() string {
+	parts := make([]string, 0, 2)
+	if len(filter.forward) > 0 {
+		parts = append(parts, "forward "+list(filter.forward))
+	}
+	if len(filter.drop) > 0 || len(filter.dropSubTypes) > 0 {
+		dropped := make([]string, 0, 2)
+		if len(filter.drop) > 0 {
+			dropped = append(dropped, list(filter.drop))
+		}
+		if len(filter.dropSubTypes) > 0 {
+			dropped = append(dropped, subTypeList(filter.dropSubTypes))
+		}
+		parts = append(parts, "drop "+strings.Join(dropped, ","))
+	}
+	if len(parts) == 0 {
+		return "forward all"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// list returns the types in the set in order, separated by commas.
+func list(set map[int]bool) string {
+	types := make([]int, 0, len(set))
+	for messageType := range set {
+		types = append(types, messageType)
+	}
+	sort.Ints(types)
+
+	text := make([]string, 0, len(types))
+	for _, messageType := range types {
+		text = append(text, fmt.Sprintf("%d", messageType))
+	}
+	return strings.Join(text, ",")
+}
+
+// subTypeList returns the sub-types of message type 4072 in the set in
+// order, for example "4072.0,4072.1".
+func subTypeList(set map[uint]bool) string {
+	subTypes := make([]int, 0, len(set))
+	for subType := range set {
+		subTypes = append(subTypes, int(subType))
+	}
+	sort.Ints(subTypes)
+
+	text := make([]string, 0, len(subTypes))
+	for _, subType := range subTypes {
+		text = append(text, fmt.Sprintf("%d.%d", utils.MessageType4072, subType))
+	}
+	return strings.Join(text, ",")
+}
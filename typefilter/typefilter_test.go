@@ -0,0 +1,170 @@
+package typefilter
+
+import (
+	"testing"
+
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// TestNew checks that New rejects bad lists of types.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		description string
+		forward     []int
+		drop        []int
+		want        string
+	}{
+		{"empty", nil, nil, ""},
+		{"forward", []int{1005, 1077}, nil, ""},
+		{"drop", nil, []int{1230}, ""},
+		{"both", []int{1005, 1077}, []int{1230}, ""},
+		{"zero", []int{0}, nil, "typefilter - illegal message type 0"},
+		{"too big", nil, []int{4096}, "typefilter - illegal message type 4096"},
+		{"clash", []int{1005, 1230}, []int{1230}, "typefilter - message type 1230 is both forwarded and dropped"},
+	}
+
+	for _, td := range testData {
+		_, err := New(td.forward, td.drop)
+		if len(td.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.want)
+		} else if err.Error() != td.want {
+			t.Errorf("%s: want error %s got %s", td.description, td.want, err.Error())
+		}
+	}
+}
+
+// TestKeep checks which types each filter keeps.
+func TestKeep(t *testing.T) {
+	all, _ := New(nil, nil)
+	forward, _ := New([]int{1005, 1074}, nil)
+	drop, _ := New(nil, []int{1004, 1230})
+	both, _ := New([]int{1005, 1074}, []int{1230})
+
+	var testData = []struct {
+		description string
+		filter      *Filter
+		messageType int
+		want        bool
+	}{
+		{"all", all, 1005, true},
+		{"all", all, 1230, true},
+		{"all", all, utils.NonRTCMMessage, false},
+		{"forward", forward, 1005, true},
+		{"forward", forward, 1074, true},
+		{"forward", forward, 1084, false},
+		{"forward", forward, utils.NonRTCMMessage, false},
+		{"drop", drop, 1004, false},
+		{"drop", drop, 1230, false},
+		{"drop", drop, 1077, true},
+		{"both", both, 1005, true},
+		{"both", both, 1230, false},
+		{"both", both, 1077, false},
+	}
+
+	for _, td := range testData {
+		got := td.filter.Keep(td.messageType)
+		if got != td.want {
+			t.Errorf("%s %d: want %v got %v", td.description, td.messageType, td.want, got)
+		}
+	}
+}
+
+// TestString checks the description of a filter.
+func TestString(t *testing.T) {
+	all, _ := New(nil, nil)
+	forward, _ := New([]int{1074, 1005}, nil)
+	both, _ := New([]int{1074, 1005}, []int{1230, 1004})
+	subTypes, _ := New(nil, []int{1230})
+	subTypes.DropSubTypes([]string{"4072.1", "4072.0"})
+
+	var testData = []struct {
+		filter *Filter
+		want   string
+	}{
+		{all, "forward all"},
+		{forward, "forward 1005,1074"},
+		{both, "forward 1005,1074, drop 1004,1230"},
+		{subTypes, "drop 1230,4072.0,4072.1"},
+	}
+
+	for _, td := range testData {
+		got := td.filter.String()
+		if got != td.want {
+			t.Errorf("want %s got %s", td.want, got)
+		}
+	}
+}
+
+// TestDropSubTypes checks that DropSubTypes rejects bad sub-types.
+func TestDropSubTypes(t *testing.T) {
+	var testData = []struct {
+		description string
+		subTypes    []string
+		want        string
+	}{
+		{"good", []string{"4072.0", " 4072.1 "}, ""},
+		{"no sub-type", []string{"4072"},
+			`typefilter - "4072" - want a message type and a sub-type, for example 4072.1`},
+		{"junk", []string{"4072.x"},
+			`typefilter - "4072.x" - want a message type and a sub-type, for example 4072.1`},
+		{"sub-type too big", []string{"4072.4096"},
+			`typefilter - "4072.4096" - want a message type and a sub-type, for example 4072.1`},
+		{"no sub-types", []string{"1230.1"}, "typefilter - message type 1230 has no sub-types"},
+	}
+
+	for _, td := range testData {
+		filter, _ := New(nil, nil)
+		err := filter.DropSubTypes(td.subTypes)
+		if len(td.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: want error %s", td.description, td.want)
+		} else if err.Error() != td.want {
+			t.Errorf("%s: want error %s got %s", td.description, td.want, err.Error())
+		}
+	}
+}
+
+// TestKeepFrame checks that KeepFrame drops the chosen sub-types of message
+// type 4072 as well as the types that Keep drops.
+func TestKeepFrame(t *testing.T) {
+	all, _ := New(nil, nil)
+	dropOne, _ := New(nil, []int{1230})
+	dropOne.DropSubTypes([]string{"4072.1"})
+	dropAll, _ := New(nil, []int{4072})
+
+	var testData = []struct {
+		description string
+		filter      *Filter
+		messageType int
+		frame       []byte
+		want        bool
+	}{
+		{"all 4072.0", all, 4072, testdata.Fake4072_0, true},
+		{"all 4072.1", all, 4072, testdata.Fake4072_1, true},
+		{"drop one 4072.0", dropOne, 4072, testdata.Fake4072_0, true},
+		{"drop one 4072.1", dropOne, 4072, testdata.Fake4072_1, false},
+		{"drop one 1230", dropOne, 1230, testdata.Fake1230, false},
+		{"drop one 1005", dropOne, 1005, testdata.MessageFrameType1005, true},
+		{"drop one short", dropOne, 4072, []byte{0xd3, 0x00, 0x01, 0xfe, 0, 0, 0}, true},
+		{"drop all 4072.0", dropAll, 4072, testdata.Fake4072_0, false},
+	}
+
+	for _, td := range testData {
+		got := td.filter.KeepFrame(td.messageType, td.frame)
+		if got != td.want {
+			t.Errorf("%s: want %v got %v", td.description, td.want, got)
+		}
+	}
+}
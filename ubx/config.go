@@ -0,0 +1,206 @@
+package ubx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DefaultMessageTypes are the RTCM messages turned on if the config doesn't
+// list any - the base position and the MSM7 observations of GPS, Glonass,
+// Galileo and BeiDou.
+var DefaultMessageTypes = []int{1005, 1077, 1087, 1097, 1127}
+
+// interfaces gives the position of each of the receiver's interfaces in the
+// run of keys that control a message's output rate.  The keys for the
+// I2C interface come first.
+var interfaces = map[string]uint32{
+	"i2c":   0,
+	"uart1": 1,
+	"uart2": 2,
+	"usb":   3,
+	"spi":   4,
+}
+
+// outputProtocolKeys gives the group of the CFG-xxxOUTPROT keys, which turn
+// protocols on and off, for each of the receiver's interfaces.
+var outputProtocolKeys = map[string]uint32{
+	"i2c":   0x10720000,
+	"uart1": 0x10740000,
+	"uart2": 0x10760000,
+	"usb":   0x10780000,
+	"spi":   0x107a0000,
+}
+
+// The items in a CFG-xxxOUTPROT group.
+const (
+	protocolNMEA   = 0x0002
+	protocolRTCM3X = 0x0004
+)
+
+// rtcmKeys gives the CFG-MSGOUT-RTCM_3X key that sets the output rate of
+// each RTCM message on the I2C interface.  The keys for the other
+// interfaces follow it - see interfaces.
+var rtcmKeys = map[int]uint32{
+	1005: 0x209102bd,
+	1074: 0x2091035e,
+	1077: 0x209102cc,
+	1084: 0x20910363,
+	1087: 0x209102d1,
+	1094: 0x20910368,
+	1097: 0x20910318,
+	1124: 0x2091036d,
+	1127: 0x209102d6,
+	1230: 0x20910303,
+}
+
+// The keys that set the navigation rate.  CFG-RATE-MEAS is the time between
+// measurements in milliseconds and CFG-RATE-NAV is the number of
+// measurements per navigation solution.
+const (
+	keyRateMeas = 0x30210001
+	keyRateNav  = 0x30210002
+)
+
+// Config is the config of a u-blox receiver, as it appears in the input
+// section of an application's JSON config.
+type Config struct {
+	// Interface is the receiver's interface to which the host is
+	// connected - "usb" (the default), "uart1", "uart2", "i2c" or "spi".
+	Interface string `json:"interface"`
+
+	// MessageTypes lists the RTCM messages to turn on, at 1 Hz.  The other
+	// messages that the receiver can produce as a base station are turned
+	// off.  Empty means DefaultMessageTypes.  See MessageTypesSupported.
+	MessageTypes []int `json:"message_types"`
+
+	// KeepNMEA is true if the NMEA sentences are not to be turned off.
+	KeepNMEA bool `json:"keep_nmea"`
+
+	// Save is true if the settings are to be kept when the receiver is
+	// reset or loses power.  Otherwise they only last until then, and are
+	// made again when the line is next opened.
+	Save bool `json:"save"`
+}
+
+// MessageTypesSupported returns the RTCM messages that the receiver can be
+// told to produce, in order.
+func MessageTypesSupported() []int {
+	types := make([]int, 0, len(rtcmKeys))
+	for messageType := range rtcmKeys {
+		types = append(types, messageType)
+	}
+	sort.Ints(types)
+	return types
+}
+
+// Validate checks the config.  A nil config is valid - it means that the
+// receiver isn't configured.
+func (config *Config) Validate() error {
+	if config == nil {
+		return nil
+	}
+	if _, ok := interfaces[config.iface()]; !ok {
+		em := fmt.Sprintf("ubx - unknown interface %q, want usb, uart1, uart2, i2c or spi",
+			config.Interface)
+		return errors.New(em)
+	}
+	for _, messageType := range config.MessageTypes {
+		if _, ok := rtcmKeys[messageType]; !ok {
+			em := fmt.Sprintf("ubx - the receiver cannot produce message type %d", messageType)
+			return errors.New(em)
+		}
+	}
+	return nil
+}
+
+// iface returns the name of the interface, applying the default.
+func (config *Config) iface() string {
+	if len(config.Interface) == 0 {
+		return "usb"
+	}
+	return config.Interface
+}
+
+// messageTypes returns the message types to turn on, applying the default.
+func (config *Config) messageTypes() []int {
+	if len(config.MessageTypes) == 0 {
+		return DefaultMessageTypes
+	}
+	return config.MessageTypes
+}
+
+// layers returns the layers in which to store the settings.
+func (config *Config) layers() byte {
+	if config.Save {
+		return LayerRAM | LayerBBR | LayerFlash
+	}
+	return LayerRAM
+}
+
+// Settings returns the settings that the config asks for:  the RTCM output
+// turned on, each supported RTCM message turned on at 1 Hz or off, the
+// navigation rate set to 1 Hz and, unless KeepNMEA is set, the NMEA output
+// turned off.
+func (config *Config) Settings() ([]Setting, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	iface := config.iface()
+	protocols := outputProtocolKeys[iface]
+	settings := []Setting{
+		{Key: keyRateMeas, Value: 1000},
+		{Key: keyRateNav, Value: 1},
+		{Key: protocols | protocolRTCM3X, Value: 1},
+	}
+	if !config.KeepNMEA {
+		settings = append(settings, Setting{Key: protocols | protocolNMEA, Value: 0})
+	}
+
+	wanted := make(map[int]bool)
+	for _, messageType := range config.messageTypes() {
+		wanted[messageType] = true
+	}
+	for _, messageType := range MessageTypesSupported() {
+		// The rate is the number of navigation solutions per message, so 1
+		// means one message per second.
+		var rate uint64
+		if wanted[messageType] {
+			rate = 1
+		}
+		key := rtcmKeys[messageType] + interfaces[iface]
+		settings = append(settings, Setting{Key: key, Value: rate})
+	}
+
+	return settings, nil
+}
+
+// Commands returns the UBX-CFG-VALSET commands that make the settings.
+func (config *Config) Commands() ([][]byte, error) {
+	settings, err := config.Settings()
+	if err != nil {
+		return nil, err
+	}
+	return ValSet(config.layers(), settings)
+}
+
+// Configure writes the commands that make the settings in the config to
+// the receiver.  It does nothing if the config is nil.
+func Configure(writer io.Writer, config *Config) error {
+	if config == nil {
+		return nil
+	}
+	commands, err := config.Commands()
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if _, writeError := writer.Write(command); writeError != nil {
+			em := fmt.Sprintf("ubx - cannot write to the receiver - %v", writeError)
+			return errors.New(em)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package ubx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestSettings checks the settings made for a config.
+func TestSettings(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		want        map[uint32]uint64
+	}{
+		{
+			"defaults", Config{},
+			map[uint32]uint64{
+				0x30210001: 1000, 0x30210002: 1, // 1 Hz.
+				0x10780004: 1, 0x10780002: 0, // RTCM on, NMEA off.
+				0x209102c0: 1, // 1005
+				0x20910361: 0, // 1074
+				0x209102cf: 1, // 1077
+				0x20910366: 0, // 1084
+				0x209102d4: 1, // 1087
+				0x2091036b: 0, // 1094
+				0x2091031b: 1, // 1097
+				0x20910370: 0, // 1124
+				0x209102d9: 1, // 1127
+				0x20910306: 0, // 1230
+			},
+		},
+		{
+			"MSM4 on UART1 keeping NMEA",
+			Config{Interface: "uart1", MessageTypes: []int{1005, 1074, 1084}, KeepNMEA: true},
+			map[uint32]uint64{
+				0x30210001: 1000, 0x30210002: 1,
+				0x10740004: 1,
+				0x209102be: 1, // 1005
+				0x2091035f: 1, // 1074
+				0x209102cd: 0, // 1077
+				0x20910364: 1, // 1084
+				0x209102d2: 0, // 1087
+				0x20910369: 0, // 1094
+				0x20910319: 0, // 1097
+				0x2091036e: 0, // 1124
+				0x209102d7: 0, // 1127
+				0x20910304: 0, // 1230
+			},
+		},
+	}
+	for _, td := range testData {
+		settings, err := td.config.Settings()
+		if err != nil {
+			t.Errorf("%s: %v", td.description, err)
+			continue
+		}
+		got := make(map[uint32]uint64)
+		for _, setting := range settings {
+			got[setting.Key] = setting.Value
+		}
+		if !cmp.Equal(td.want, got) {
+			t.Errorf("%s: %s", td.description, cmp.Diff(td.want, got))
+		}
+	}
+}
+
+// TestValidate checks the checks on the config.
+func TestValidate(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      *Config
+		want        string
+	}{
+		{"nil", nil, ""},
+		{"empty", &Config{}, ""},
+		{"SPI", &Config{Interface: "spi"}, ""},
+		{"bad interface", &Config{Interface: "bluetooth"},
+			`ubx - unknown interface "bluetooth", want usb, uart1, uart2, i2c or spi`},
+		{"bad type", &Config{MessageTypes: []int{1005, 1019}},
+			"ubx - the receiver cannot produce message type 1019"},
+	}
+	for _, td := range testData {
+		err := td.config.Validate()
+		if len(td.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want error %s got %v", td.description, td.want, err)
+		}
+	}
+}
+
+// failingWriter is a writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("device not configured")
+}
+
+// TestConfigure checks that Configure writes the commands, storing the
+// settings in all the layers if they are to be saved.
+func TestConfigure(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := Configure(&buffer, nil); err != nil || buffer.Len() != 0 {
+		t.Errorf("nil config: want nothing written got %d bytes, %v", buffer.Len(), err)
+	}
+
+	config := Config{Save: true}
+	if err := Configure(&buffer, &config); err != nil {
+		t.Fatal(err)
+	}
+	commands, err := config.Commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 || !bytes.Equal(commands[0], buffer.Bytes()) {
+		t.Errorf("want the commands written")
+	}
+	const layersOffset = headerLen + 1
+	if got := buffer.Bytes()[layersOffset]; got != LayerRAM|LayerBBR|LayerFlash {
+		t.Errorf("want all layers got 0x%02x", got)
+	}
+
+	const want = "ubx - cannot write to the receiver - device not configured"
+	err = Configure(failingWriter{}, &config)
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %s got %v", want, err)
+	}
+}
@@ -0,0 +1,146 @@
+// The ubx package configures a u-blox receiver such as the ZED-F9P to act
+// as a base station, so that a new station doesn't need a separate session
+// with u-center.  It writes UBX-CFG-VALSET commands down the serial line,
+// normally when the line is opened, to turn on the wanted RTCM messages at
+// 1 Hz and turn off the NMEA sentences.  It's driven by the "receiver"
+// part of the input section of an application's JSON config:
+//
+//	"input": {
+//	    "devices": ["/dev/ttyACM*"],
+//	    "receiver": {
+//	        "interface": "usb",
+//	        "message_types": [1005, 1077, 1087, 1097, 1127, 1230],
+//	        "save": true
+//	    }
+//	}
+//
+// The receiver answers each command with a UBX-ACK-ACK or UBX-ACK-NAK
+// frame, which arrives in the input among the RTCM messages.  The RTCM
+// handler treats it as non-RTCM data.
+//
+//	commands, err := config.Input.Receiver.Commands()
+//	...
+//	err = ubx.Configure(port, config.Input.Receiver)
+//
+// The format of UBX frames and the configuration keys are given in the
+// u-blox ZED-F9P Interface Description.
+package ubx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The two bytes at the start of every UBX frame.
+const (
+	syncChar1 = 0xb5
+	syncChar2 = 0x62
+)
+
+// headerLen is the length of the part of a UBX frame before the payload -
+// the sync characters, the class, the ID and the length.
+const headerLen = 6
+
+// The class and ID of UBX-CFG-VALSET.
+const (
+	ClassCFG = 0x06
+	IDValSet = 0x8a
+)
+
+// The layers in which a UBX-CFG-VALSET command stores the settings.  RAM
+// is lost when the receiver is reset or loses power, BBR (battery-backed
+// RAM) survives a reset and Flash survives a loss of power.
+const (
+	LayerRAM   = 0x01
+	LayerBBR   = 0x02
+	LayerFlash = 0x04
+)
+
+// MaxValSetItems is the most settings that one UBX-CFG-VALSET command can
+// carry.
+const MaxValSetItems = 64
+
+// Setting is the value of a configuration key.  Bits 28-30 of the key give
+// the size of the value.
+type Setting struct {
+	Key   uint32
+	Value uint64
+}
+
+// size returns the number of bytes that the value of the setting takes
+// in a UBX-CFG-VALSET command, or 0 if the key is not valid.
+func (setting Setting) size() int {
+	switch (setting.Key >> 28) & 0x07 {
+	case 1, 2:
+		// A one-bit value takes a whole byte.
+		return 1
+	case 3:
+		return 2
+	case 4:
+		return 4
+	case 5:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Frame returns a UBX frame with the given class, ID and payload.
+func Frame(class, id byte, payload []byte) []byte {
+	frame := make([]byte, 0, headerLen+len(payload)+2)
+	frame = append(frame, syncChar1, syncChar2, class, id,
+		byte(len(payload)), byte(len(payload)>>8))
+	frame = append(frame, payload...)
+	a, b := checksum(frame[2:])
+	return append(frame, a, b)
+}
+
+// checksum returns the two bytes of the 8-bit Fletcher checksum that ends
+// a UBX frame, taken over the class, ID, length and payload.
+func checksum(data []byte) (byte, byte) {
+	var a, b byte
+	for _, c := range data {
+		a += c
+		b += a
+	}
+	return a, b
+}
+
+// ValSet returns UBX-CFG-VALSET commands that store the settings in the
+// given layers.  There's one command for each MaxValSetItems settings.
+func ValSet(layers byte, settings []Setting) ([][]byte, error) {
+	if layers == 0 {
+		return nil, errors.New("ubx - no layers to store the settings in")
+	}
+	commands := make([][]byte, 0)
+	for start := 0; start < len(settings); start += MaxValSetItems {
+		end := start + MaxValSetItems
+		if end > len(settings) {
+			end = len(settings)
+		}
+
+		// The payload is the version (0), the layers and two reserved bytes
+		// followed by the keys and values, little-endian.
+		payload := []byte{0, layers, 0, 0}
+		for _, setting := range settings[start:end] {
+			size := setting.size()
+			if size == 0 {
+				em := fmt.Sprintf("ubx - key 0x%08x has no valid size", setting.Key)
+				return nil, errors.New(em)
+			}
+			payload = appendLittleEndian(payload, uint64(setting.Key), 4)
+			payload = appendLittleEndian(payload, setting.Value, size)
+		}
+		commands = append(commands, Frame(ClassCFG, IDValSet, payload))
+	}
+	return commands, nil
+}
+
+// appendLittleEndian appends the bottom size bytes of the value, least
+// significant first.
+func appendLittleEndian(b []byte, value uint64, size int) []byte {
+	for i := 0; i < size; i++ {
+		b = append(b, byte(value>>(8*i)))
+	}
+	return b
+}
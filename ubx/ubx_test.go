@@ -0,0 +1,86 @@
+package ubx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestFrame checks the framing and the checksum against the well-known
+// poll for UBX-MON-VER.
+func TestFrame(t *testing.T) {
+	want := []byte{0xb5, 0x62, 0x0a, 0x04, 0x00, 0x00, 0x0e, 0x34}
+	got := Frame(0x0a, 0x04, nil)
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// TestValSet checks the layout of a UBX-CFG-VALSET command.
+func TestValSet(t *testing.T) {
+	settings := []Setting{
+		{Key: 0x10780002, Value: 0},    // CFG-USBOUTPROT-NMEA, one bit.
+		{Key: 0x209102c0, Value: 1},    // CFG-MSGOUT-RTCM_3X_TYPE1005_USB, one byte.
+		{Key: 0x30210001, Value: 1000}, // CFG-RATE-MEAS, two bytes.
+	}
+	commands, err := ValSet(LayerRAM|LayerBBR, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 {
+		t.Fatalf("want 1 command got %d", len(commands))
+	}
+
+	payload := []byte{
+		0x00, 0x03, 0x00, 0x00,
+		0x02, 0x00, 0x78, 0x10, 0x00,
+		0xc0, 0x02, 0x91, 0x20, 0x01,
+		0x01, 0x00, 0x21, 0x30, 0xe8, 0x03,
+	}
+	want := Frame(ClassCFG, IDValSet, payload)
+	if !cmp.Equal(want, commands[0]) {
+		t.Error(cmp.Diff(want, commands[0]))
+	}
+}
+
+// TestValSetSplits checks that a long list of settings is split into
+// several commands.
+func TestValSetSplits(t *testing.T) {
+	settings := make([]Setting, MaxValSetItems+1)
+	for i := range settings {
+		settings[i] = Setting{Key: 0x20910000 + uint32(i), Value: 1}
+	}
+	commands, err := ValSet(LayerRAM, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("want 2 commands got %d", len(commands))
+	}
+	// Each setting takes a 4-byte key and a 1-byte value.
+	wantLengths := []int{headerLen + 4 + 5*MaxValSetItems + 2, headerLen + 4 + 5 + 2}
+	for i, command := range commands {
+		if len(command) != wantLengths[i] {
+			t.Errorf("command %d: want length %d got %d", i, wantLengths[i], len(command))
+		}
+	}
+}
+
+// TestValSetErrors checks the errors from ValSet.
+func TestValSetErrors(t *testing.T) {
+	var testData = []struct {
+		description string
+		layers      byte
+		settings    []Setting
+		want        string
+	}{
+		{"no layers", 0, []Setting{{Key: 0x10780002}}, "ubx - no layers to store the settings in"},
+		{"bad key", LayerRAM, []Setting{{Key: 0x00780002}}, "ubx - key 0x00780002 has no valid size"},
+	}
+	for _, td := range testData {
+		_, err := ValSet(td.layers, td.settings)
+		if err == nil || err.Error() != td.want {
+			t.Errorf("%s: want error %s got %v", td.description, td.want, err)
+		}
+	}
+}
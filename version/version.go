@@ -0,0 +1,41 @@
+// The version package holds the version of the software.  The values are
+// set at build time by the release tool, for example:
+//
+//	go run ./apps/release -version v1.2.0
+//
+// which builds each application with linker flags such as:
+//
+//	-X github.com/goblimey/go-ntrip/version.Version=v1.2.0
+//
+// A binary built with an ordinary "go build" reports the version "dev".
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version is the release version, for example "v1.2.0".
+var Version = "dev"
+
+// Commit is the git commit from which the release was built.
+var Commit = ""
+
+// BuildDate is the date on which the release was built, in RFC 3339 form.
+var BuildDate = ""
+
+// String returns a one-line description of the version suitable for a
+// --version option, for example "rtcmfilter v1.2.0 (abc1234, 2024-09-01T10:00:00Z) linux/arm".
+func String(program string) string {
+	details := ""
+	switch {
+	case len(Commit) > 0 && len(BuildDate) > 0:
+		details = fmt.Sprintf(" (%s, %s)", Commit, BuildDate)
+	case len(Commit) > 0:
+		details = fmt.Sprintf(" (%s)", Commit)
+	case len(BuildDate) > 0:
+		details = fmt.Sprintf(" (%s)", BuildDate)
+	}
+
+	return fmt.Sprintf("%s %s%s %s/%s", program, Version, details, runtime.GOOS, runtime.GOARCH)
+}
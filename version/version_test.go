@@ -0,0 +1,42 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+// TestString checks that String describes the version.
+func TestString(t *testing.T) {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	var testData = []struct {
+		description string
+		version     string
+		commit      string
+		buildDate   string
+		want        string
+	}{
+		{"dev", "dev", "", "", "prog dev " + platform},
+		{"version only", "v1.2.0", "", "", "prog v1.2.0 " + platform},
+		{"commit", "v1.2.0", "abc1234", "", "prog v1.2.0 (abc1234) " + platform},
+		{"date", "v1.2.0", "", "2024-09-01T10:00:00Z",
+			"prog v1.2.0 (2024-09-01T10:00:00Z) " + platform},
+		{"all", "v1.2.0", "abc1234", "2024-09-01T10:00:00Z",
+			"prog v1.2.0 (abc1234, 2024-09-01T10:00:00Z) " + platform},
+	}
+	for _, td := range testData {
+		Version = td.version
+		Commit = td.commit
+		BuildDate = td.buildDate
+
+		got := String("prog")
+
+		if got != td.want {
+			t.Errorf("%s: want %s got %s", td.description, td.want, got)
+		}
+	}
+
+	Version = "dev"
+	Commit = ""
+	BuildDate = ""
+}
@@ -0,0 +1,494 @@
+// The websocket package serves RTCM messages over WebSocket, so that a
+// rover app in a browser or on a phone can take corrections straight from
+// the base station on the local network, without a caster on the
+// Internet.  Each valid RTCM message is sent to every subscriber as one
+// binary WebSocket message holding the complete frame, with its leader and
+// CRC, ready to be passed to the rover's receiver.  In a browser:
+//
+//	const socket = new WebSocket("ws://raspberrypi.local:2102/rtcm");
+//	socket.binaryType = "arraybuffer";
+//	socket.onmessage = (event) => sendToReceiver(new Uint8Array(event.data));
+//
+// The server is off unless the application's config has a websocket
+// section:
+//
+//	"websocket": {"listen_address": ":2102", "path": "/rtcm", "max_clients": 8}
+//
+// The path defaults to /rtcm and the number of subscribers to 16.
+//
+// Corrections are no use to a rover when they are late, so a subscriber
+// that can't keep up misses messages rather than holding up the others.
+// The server doesn't check the origin of the page that opens the
+// connection, so any page that a browser on the network has open can
+// subscribe.  The data is the same as the base station would send to a
+// caster, so that's no worse than an open mountpoint.
+//
+// The application creates the Server, starts listening and feeds it:
+//
+//	server, err := websocket.New(config, logger)
+//	...
+//	err = server.Listen()
+//	...
+//	go server.Run(nil)
+//	server.Publish(&message)  // Call for each message.
+//
+// Only as much of the WebSocket protocol (RFC 6455) as a server that sends
+// binary messages needs is implemented.  Messages from the subscribers are
+// read and ignored, pings are answered and a close is acknowledged.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/go-ntrip/eventlog"
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// DefaultPath is the path of the endpoint used when the config doesn't give
+// one.
+const DefaultPath = "/rtcm"
+
+// DefaultMaxClients is the number of subscribers allowed at once when the
+// config doesn't give one.
+const DefaultMaxClients = 16
+
+// clientBuffer is the number of messages that can wait to be sent to a
+// subscriber.  Beyond that, messages to the subscriber are dropped.
+const clientBuffer = 64
+
+// writeTimeout is the time allowed to write a message to a subscriber.
+const writeTimeout = 10 * time.Second
+
+// maxIncoming is the largest message accepted from a subscriber.  The
+// subscribers have nothing to say except pings and closes.
+const maxIncoming = 4096
+
+// acceptGUID is the value defined by RFC 6455 that's added to the key in
+// the handshake.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The WebSocket opcodes.
+const (
+	opBinary = 0x2
+	opClose  = 0x8
+	opPing   = 0x9
+	opPong   = 0xa
+)
+
+// Config is the config of a Server, as it appears in an application's JSON
+// config file.
+type Config struct {
+	// ListenAddress is the host:port on which the endpoint is served, for
+	// example ":2102" for all interfaces.
+	ListenAddress string `json:"listen_address"`
+
+	// Path is the path of the endpoint.  Empty means DefaultPath.
+	Path string `json:"path"`
+
+	// MaxClients is the number of subscribers allowed at once.  Zero means
+	// DefaultMaxClients.
+	MaxClients int `json:"max_clients"`
+}
+
+// EndpointPath returns the path of the endpoint.
+func (config *Config) EndpointPath() string {
+	if len(config.Path) == 0 {
+		return DefaultPath
+	}
+	return config.Path
+}
+
+// ClientLimit returns the number of subscribers allowed at once.
+func (config *Config) ClientLimit() int {
+	if config.MaxClients == 0 {
+		return DefaultMaxClients
+	}
+	return config.MaxClients
+}
+
+// client is a subscriber.
+type client struct {
+	// conn is the connection to the subscriber, nil until the handshake
+	// starts.
+	conn net.Conn
+
+	// send carries the frames to be written to the subscriber.
+	send chan []byte
+}
+
+// Server sends the messages to the subscribers.  It's safe for concurrent
+// use.
+type Server struct {
+	// config is the config of the Server.
+	config Config
+
+	// logger receives the event log entries.  It may be nil.
+	logger *log.Logger
+
+	// listener is the listener on which the endpoint is served, nil until
+	// Listen is called.
+	listener net.Listener
+
+	// clients holds the subscribers.
+	clients map[*client]bool
+
+	// dropped is the number of messages not sent to a subscriber because
+	// it couldn't keep up.
+	dropped uint64
+
+	// The mutex controls access to all of the above.
+	mutex sync.Mutex
+}
+
+// New creates a Server that serves on the address in the config.  The
+// logger may be nil.
+func New(config Config, logger *log.Logger) (*Server, error) {
+	_, _, splitError := net.SplitHostPort(config.ListenAddress)
+	if splitError != nil {
+		em := fmt.Sprintf("websocket - the listen address %q is not host:port", config.ListenAddress)
+		return nil, errors.New(em)
+	}
+	if !strings.HasPrefix(config.EndpointPath(), "/") {
+		em := fmt.Sprintf("websocket - the path %q doesn't start with /", config.Path)
+		return nil, errors.New(em)
+	}
+	if config.MaxClients < 0 {
+		em := fmt.Sprintf("websocket - max_clients is %d - want a positive number", config.MaxClients)
+		return nil, errors.New(em)
+	}
+
+	server := Server{
+		config:  config,
+		logger:  logger,
+		clients: make(map[*client]bool),
+	}
+
+	return &server, nil
+}
+
+// Publish sends a message to every subscriber.  Non-RTCM data, which
+// includes messages with a bad CRC, is not sent.
+func (server *Server) Publish(message *rtcm.Message) {
+	if message == nil || message.MessageType == utils.NonRTCMMessage {
+		return
+	}
+
+	frame := wsFrame(opBinary, message.RawData)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for c := range server.clients {
+		select {
+		case c.send <- frame:
+		default:
+			server.dropped++
+		}
+	}
+}
+
+// Clients returns the number of subscribers.
+func (server *Server) Clients() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return len(server.clients)
+}
+
+// Dropped returns the number of messages not sent to a subscriber because
+// it couldn't keep up.
+func (server *Server) Dropped() uint64 {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.dropped
+}
+
+// ServeHTTP accepts a WebSocket connection on the endpoint and sends the
+// messages on it until the subscriber goes away.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != server.config.EndpointPath() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet ||
+		!headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "want a WebSocket connection", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "want WebSocket version 13", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if len(key) == 0 {
+		http.Error(w, "no Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+
+	c := client{send: make(chan []byte, clientBuffer)}
+	if !server.add(&c) {
+		http.Error(w, "too many subscribers", http.StatusServiceUnavailable)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		server.remove(&c)
+		http.Error(w, "cannot take over the connection", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, hijackError := hijacker.Hijack()
+	if hijackError != nil {
+		server.remove(&c)
+		eventlog.Printf(server.logger, "websocket - %v", hijackError)
+		return
+	}
+	server.mutex.Lock()
+	c.conn = conn
+	server.mutex.Unlock()
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, writeError := conn.Write([]byte(response))
+	if writeError != nil {
+		server.remove(&c)
+		conn.Close()
+		return
+	}
+
+	eventlog.Printf(server.logger, "websocket - subscriber %s connected", conn.RemoteAddr())
+	go server.write(&c)
+	server.read(&c, rw.Reader)
+	server.remove(&c)
+	eventlog.Printf(server.logger, "websocket - subscriber %s gone", conn.RemoteAddr())
+}
+
+// add adds a subscriber if there is room.  It returns false if there isn't.
+func (server *Server) add(c *client) bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.clients) >= server.config.ClientLimit() {
+		return false
+	}
+	server.clients[c] = true
+	return true
+}
+
+// remove removes a subscriber, which stops its writer.
+func (server *Server) remove(c *client) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.clients[c] {
+		delete(server.clients, c)
+		close(c.send)
+	}
+}
+
+// write writes the frames to a subscriber until its send channel is closed.
+// If a write fails it closes the connection, which ends read.
+func (server *Server) write(c *client) {
+	defer c.conn.Close()
+	for frame := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, writeError := c.conn.Write(frame)
+		if writeError != nil {
+			return
+		}
+	}
+}
+
+// read reads the frames from a subscriber, answering pings, until the
+// subscriber closes the connection or it fails.
+func (server *Server) read(c *client, reader *bufio.Reader) {
+	for {
+		opcode, payload, readError := readFrame(reader)
+		if readError != nil {
+			return
+		}
+
+		var reply []byte
+		switch opcode {
+		case opPing:
+			reply = wsFrame(opPong, payload)
+		case opClose:
+			reply = wsFrame(opClose, payload)
+		default:
+			continue
+		}
+
+		server.mutex.Lock()
+		if server.clients[c] {
+			select {
+			case c.send <- reply:
+			default:
+			}
+		}
+		server.mutex.Unlock()
+
+		if opcode == opClose {
+			return
+		}
+	}
+}
+
+// Listen starts listening on the address in the config.  It returns an
+// error if the address can't be used, for example because another program
+// is listening on it.
+func (server *Server) Listen() error {
+	listener, listenError := net.Listen("tcp", server.config.ListenAddress)
+	if listenError != nil {
+		em := fmt.Sprintf("websocket - cannot listen on %s - %v", server.config.ListenAddress, listenError)
+		return errors.New(em)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.listener = listener
+	return nil
+}
+
+// Addr returns the address on which the Server is listening, nil if Listen
+// has not been called.
+func (server *Server) Addr() net.Addr {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.listener == nil {
+		return nil
+	}
+	return server.listener.Addr()
+}
+
+// Run serves the endpoint until the stop channel is closed, then drops the
+// subscribers.  If the channel is nil, it runs forever.  Listen must be
+// called first.  It can be run in a goroutine.
+func (server *Server) Run(stop <-chan struct{}) {
+	server.mutex.Lock()
+	listener := server.listener
+	server.mutex.Unlock()
+	if listener == nil {
+		eventlog.Println(server.logger, "websocket - Run called before Listen")
+		return
+	}
+
+	httpServer := http.Server{Handler: server}
+
+	go func() {
+		<-stop
+		httpServer.Close()
+		// The server doesn't close the connections that it has handed
+		// over.
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		for c := range server.clients {
+			if c.conn != nil {
+				c.conn.Close()
+			}
+		}
+	}()
+
+	serveError := httpServer.Serve(listener)
+	if serveError != nil && serveError != http.ErrServerClosed {
+		eventlog.Printf(server.logger, "websocket - %v", serveError)
+	}
+}
+
+// AcceptKey returns the value of the Sec-WebSocket-Accept header in the
+// reply to a handshake with the given Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// headerHasToken returns true if the header has the token in its
+// comma-separated list, ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsFrame returns an unmasked WebSocket frame, as a server sends, holding
+// the whole of a message.
+func wsFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	return append(frame, payload...)
+}
+
+// readFrame reads a WebSocket frame from a subscriber and returns the
+// opcode and the unmasked payload.  A subscriber must mask its frames.
+func readFrame(reader io.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("websocket - unmasked frame from a subscriber")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxIncoming {
+		em := fmt.Sprintf("websocket - a frame of %d bytes from a subscriber is too big", length)
+		return 0, nil, errors.New(em)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
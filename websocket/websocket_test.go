@@ -0,0 +1,344 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rtcm "github.com/goblimey/go-ntrip/rtcm/handler"
+	"github.com/goblimey/go-ntrip/rtcm/testdata"
+	"github.com/goblimey/go-ntrip/rtcm/utils"
+)
+
+// testKey is the key from the example in RFC 6455.
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// subscribe is a helper function.  It connects to the server, makes the
+// handshake and checks the reply.  It returns the connection and a reader
+// for the frames.
+func subscribe(t *testing.T, address, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + address + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + testKey + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("want status %d got %d", http.StatusSwitchingProtocols, response.StatusCode)
+	}
+	if got := response.Header.Get("Sec-WebSocket-Accept"); got != AcceptKey(testKey) {
+		t.Errorf("want accept key %s got %s", AcceptKey(testKey), got)
+	}
+
+	return conn, reader
+}
+
+// readServerFrame is a helper function.  It reads an unmasked frame from
+// the server.
+func readServerFrame(t *testing.T, conn net.Conn, reader *bufio.Reader) (byte, []byte) {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var header [2]byte
+	if _, err := reader.Read(header[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(header[1:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		high, _ := reader.ReadByte()
+		low, _ := reader.ReadByte()
+		length = int(high)<<8 | int(low)
+	}
+	payload := make([]byte, length)
+	for n := 0; n < length; {
+		m, err := reader.Read(payload[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += m
+	}
+	return header[0] & 0x0f, payload
+}
+
+// maskedFrame is a helper function.  It returns a masked frame, as a
+// subscriber sends.
+func maskedFrame(opcode byte, payload []byte) []byte {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// waitForClients is a helper function.  It waits until the server has the
+// given number of subscribers.
+func waitForClients(t *testing.T, server *Server, want int) {
+	for i := 0; i < 500; i++ {
+		if server.Clients() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("want %d subscribers got %d", want, server.Clients())
+}
+
+// TestNew checks that New checks the config.
+func TestNew(t *testing.T) {
+	var testData = []struct {
+		description string
+		config      Config
+		wantError   string
+	}{
+		{"defaults", Config{ListenAddress: ":2102"}, ""},
+		{"everything", Config{ListenAddress: "localhost:2102", Path: "/base", MaxClients: 2}, ""},
+		{"no port", Config{ListenAddress: "localhost"},
+			`websocket - the listen address "localhost" is not host:port`},
+		{"bad path", Config{ListenAddress: ":2102", Path: "rtcm"},
+			`websocket - the path "rtcm" doesn't start with /`},
+		{"negative limit", Config{ListenAddress: ":2102", MaxClients: -1},
+			"websocket - max_clients is -1 - want a positive number"},
+	}
+	for _, td := range testData {
+		_, err := New(td.config, nil)
+		if len(td.wantError) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", td.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestAcceptKey checks the key against the example in RFC 6455.
+func TestAcceptKey(t *testing.T) {
+	const want = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got := AcceptKey(testKey); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+// TestWSFrame checks the three forms of the length.
+func TestWSFrame(t *testing.T) {
+	var testData = []struct {
+		length     int
+		wantHeader []byte
+	}{
+		{0, []byte{0x82, 0}},
+		{125, []byte{0x82, 125}},
+		{126, []byte{0x82, 126, 0, 126}},
+		{65535, []byte{0x82, 126, 0xff, 0xff}},
+		{65536, []byte{0x82, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+	}
+	for _, td := range testData {
+		frame := wsFrame(opBinary, make([]byte, td.length))
+		if !bytes.Equal(td.wantHeader, frame[:len(td.wantHeader)]) {
+			t.Errorf("%d: want header % x got % x", td.length, td.wantHeader, frame[:len(td.wantHeader)])
+		}
+		if len(frame) != len(td.wantHeader)+td.length {
+			t.Errorf("%d: want %d bytes got %d", td.length, len(td.wantHeader)+td.length, len(frame))
+		}
+	}
+}
+
+// TestReadFrame checks that a masked frame is unmasked and that a bad one
+// is rejected.
+func TestReadFrame(t *testing.T) {
+	opcode, payload, err := readFrame(bytes.NewReader(maskedFrame(opPing, []byte("hello"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opPing || string(payload) != "hello" {
+		t.Errorf("want ping hello got %x %q", opcode, string(payload))
+	}
+
+	var testData = []struct {
+		description string
+		frame       []byte
+		wantError   string
+	}{
+		{"unmasked", wsFrame(opPing, nil), "websocket - unmasked frame from a subscriber"},
+		{"too big", []byte{0x82, 0xfe, 0x10, 0x01}, "websocket - a frame of 4097 bytes from a subscriber is too big"},
+	}
+	for _, td := range testData {
+		_, _, err := readFrame(bytes.NewReader(td.frame))
+		if err == nil || err.Error() != td.wantError {
+			t.Errorf("%s: want error %s got %v", td.description, td.wantError, err)
+		}
+	}
+}
+
+// TestServeHTTPErrors checks the replies to requests that are not WebSocket
+// handshakes.
+func TestServeHTTPErrors(t *testing.T) {
+	server, err := New(Config{ListenAddress: ":0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = []struct {
+		description string
+		path        string
+		version     string
+		upgrade     bool
+		wantCode    int
+	}{
+		{"wrong path", "/other", "13", true, http.StatusNotFound},
+		{"plain GET", "/rtcm", "13", false, http.StatusBadRequest},
+		{"old version", "/rtcm", "8", true, http.StatusUpgradeRequired},
+	}
+	for _, td := range testData {
+		request := httptest.NewRequest("GET", td.path, nil)
+		request.Header.Set("Sec-WebSocket-Version", td.version)
+		request.Header.Set("Sec-WebSocket-Key", testKey)
+		if td.upgrade {
+			request.Header.Set("Connection", "Upgrade")
+			request.Header.Set("Upgrade", "websocket")
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Code != td.wantCode {
+			t.Errorf("%s: want status %d got %d", td.description, td.wantCode, recorder.Code)
+		}
+	}
+}
+
+// TestPublish checks that the messages reach the subscribers, that non-RTCM
+// data doesn't, that pings are answered, that a close is acknowledged and
+// that the limit on subscribers is applied.
+func TestPublish(t *testing.T) {
+	server, err := New(Config{ListenAddress: "127.0.0.1:0", MaxClients: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go server.Run(stop)
+	address := server.Addr().String()
+
+	first, firstReader := subscribe(t, address, DefaultPath)
+	second, secondReader := subscribe(t, address, DefaultPath)
+	waitForClients(t, server, 2)
+
+	// A third is turned away.
+	request, _ := http.NewRequest("GET", "http://"+address+DefaultPath, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Key", testKey)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	response, getError := http.DefaultClient.Do(request)
+	if getError != nil {
+		t.Fatal(getError)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("third subscriber: want status %d got %d", http.StatusServiceUnavailable, response.StatusCode)
+	}
+
+	server.Publish(&rtcm.Message{MessageType: utils.NonRTCMMessage, RawData: []byte("junk")})
+	server.Publish(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+	server.Publish(&rtcm.Message{MessageType: utils.MessageTypeMSM7GPS, RawData: testdata.MessageFrameType1077})
+
+	for _, s := range []struct {
+		conn   net.Conn
+		reader *bufio.Reader
+	}{{first, firstReader}, {second, secondReader}} {
+		for _, want := range [][]byte{testdata.MessageFrameType1005, testdata.MessageFrameType1077} {
+			opcode, got := readServerFrame(t, s.conn, s.reader)
+			if opcode != opBinary || !bytes.Equal(want, got) {
+				t.Errorf("want binary % x\ngot %x % x", want, opcode, got)
+			}
+		}
+	}
+
+	// A ping gets a pong.
+	first.Write(maskedFrame(opPing, []byte("ping")))
+	if opcode, payload := readServerFrame(t, first, firstReader); opcode != opPong || string(payload) != "ping" {
+		t.Errorf("want pong got %x %q", opcode, string(payload))
+	}
+
+	// A close gets a close and the subscriber is dropped.
+	first.Write(maskedFrame(opClose, []byte{0x03, 0xe8}))
+	if opcode, _ := readServerFrame(t, first, firstReader); opcode != opClose {
+		t.Errorf("want close got %x", opcode)
+	}
+	waitForClients(t, server, 1)
+
+	// A subscriber that goes away is dropped too.
+	second.Close()
+	server.Publish(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+	waitForClients(t, server, 0)
+}
+
+// TestPublishSlowSubscriber checks that messages to a subscriber that
+// can't keep up are dropped.
+func TestPublishSlowSubscriber(t *testing.T) {
+	server, err := New(Config{ListenAddress: ":0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client{send: make(chan []byte, clientBuffer)}
+	if !server.add(&c) {
+		t.Fatal("want the subscriber added")
+	}
+
+	for i := 0; i < clientBuffer+3; i++ {
+		server.Publish(&rtcm.Message{MessageType: utils.MessageType1005, RawData: testdata.MessageFrameType1005})
+	}
+	if got := server.Dropped(); got != 3 {
+		t.Errorf("want 3 dropped got %d", got)
+	}
+
+	server.remove(&c)
+	if _, ok := <-c.send; !ok {
+		t.Error("want the waiting messages kept after remove")
+	}
+}
+
+// TestListenError checks the error when the address is in use.
+func TestListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	server, err := New(Config{ListenAddress: address}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Listen()
+	wantPrefix := "websocket - cannot listen on " + address + " - "
+	if err == nil || !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("want %q... got %v", wantPrefix, err)
+	}
+}